@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Limits for working out access
+const (
+	maxAccessProbes    = 500
+	accessProbeWorkers = 8
+	accessProbeTimeout = 5 * time.Second
+	accessRoleMaxDepth = 16 // Guards against cycles in member_of
+)
+
+// Where GetAccessibleObjects got its answer
+const (
+	accessSourceNoAuth = "no_auth"
+	accessSourceSuper  = "superuser"
+	accessSourceAuth   = "system_auth"
+	accessSourceProbe  = "probe"
+)
+
+// alwaysReadableKeyspaces can be read by every role and modified by none
+var alwaysReadableKeyspaces = map[string]bool{
+	"system":                true,
+	"system_schema":         true,
+	"system_virtual_schema": true,
+	"system_views":          true,
+}
+
+// ObjectAccess is what the session's role may do with a keyspace or table.
+// A nil permission could not be determined.
+type ObjectAccess struct {
+	Keyspace string `json:"keyspace"`
+	Table    string `json:"table,omitempty"`
+	Select   *bool  `json:"select"`
+	Modify   *bool  `json:"modify"`
+	Partial  bool   `json:"partial,omitempty"` // Keyspaces: only some tables allow select
+}
+
+// AccessibleObjects is the result of GetAccessibleObjects
+type AccessibleObjects struct {
+	Role      string         `json:"role,omitempty"`
+	Superuser bool           `json:"superuser"`
+	Source    string         `json:"source"`          // no_auth, superuser, system_auth or probe
+	Roles     []string       `json:"roles,omitempty"` // The role and the roles granted to it, transitively
+	Keyspaces []ObjectAccess `json:"keyspaces"`
+	Tables    []ObjectAccess `json:"tables"`
+	Probed    int            `json:"probed,omitempty"`    // Tables read to test access (source probe)
+	Truncated bool           `json:"truncated,omitempty"` // More tables than could be probed; the rest are unknown
+}
+
+// rolePermissions are the permissions of a role and its granted roles by resource
+type rolePermissions struct {
+	superuser bool
+	roles     []string
+	resources map[string]map[string]bool // "data/ks/table" -> SELECT, MODIFY, ...
+}
+
+// has reports whether permission is granted on the table, its keyspace or all keyspaces
+func (p *rolePermissions) has(permission, keyspace, table string) bool {
+	for _, resource := range []string{"data", "data/" + keyspace, "data/" + keyspace + "/" + table} {
+		if p.resources[resource][permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRolePermissions reads the role graph and permissions from system_auth.
+// It fails when the role may not read system_auth.
+func loadRolePermissions(session *db.Session, role string) (*rolePermissions, error) {
+	perms := &rolePermissions{resources: make(map[string]map[string]bool)}
+	seen := map[string]bool{role: true}
+	queue := []string{role}
+	for depth := 0; len(queue) > 0 && depth < accessRoleMaxDepth; depth++ {
+		var next []string
+		for _, name := range queue {
+			var superuser bool
+			var memberOf []string
+			err := session.Query("SELECT is_superuser, member_of FROM system_auth.roles WHERE role = ?", name).Scan(&superuser, &memberOf)
+			if err != nil && !errors.Is(err, gocql.ErrNotFound) {
+				return nil, err
+			}
+			perms.roles = append(perms.roles, name)
+			perms.superuser = perms.superuser || superuser
+			for _, parent := range memberOf {
+				if !seen[parent] {
+					seen[parent] = true
+					next = append(next, parent)
+				}
+			}
+		}
+		queue = next
+	}
+	if perms.superuser {
+		return perms, nil
+	}
+
+	for _, name := range perms.roles {
+		var resource string
+		var granted []string
+		iter := session.Query("SELECT resource, permissions FROM system_auth.role_permissions WHERE role = ?", name).Iter()
+		for iter.Scan(&resource, &granted) {
+			if perms.resources[resource] == nil {
+				perms.resources[resource] = make(map[string]bool)
+			}
+			for _, p := range granted {
+				perms.resources[resource][strings.ToUpper(p)] = true
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return perms, nil
+}
+
+// isUnauthorized reports whether err is the server refusing access
+func isUnauthorized(err error) bool {
+	var reqErr gocql.RequestError
+	return errors.As(err, &reqErr) && reqErr.Code() == gocql.ErrCodeUnauthorized
+}
+
+// probeSelect tests whether a table can be read by reading one partition
+// key. Authorization is checked before a query runs, so any other error
+// (e.g. a timeout) still means access was granted.
+func probeSelect(session *db.Session, keyspace, table, column string) *bool {
+	ctx, cancel := context.WithTimeout(context.Background(), accessProbeTimeout)
+	defer cancel()
+	query := fmt.Sprintf("SELECT %s FROM %s.%s LIMIT 1", quoteIdentifier(column), quoteIdentifier(keyspace), quoteIdentifier(table))
+	iter := session.Query(query).WithContext(ctx).PageSize(1).Iter()
+	err := iter.Close()
+	switch {
+	case err == nil:
+		return boolPtr(true)
+	case isUnauthorized(err):
+		return boolPtr(false)
+	case ctx.Err() != nil:
+		return nil
+	default:
+		var reqErr gocql.RequestError
+		if errors.As(err, &reqErr) {
+			return boolPtr(true)
+		}
+		return nil
+	}
+}
+
+// boolPtr returns a pointer to b
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// getAccessibleObjects works out which keyspaces and tables the session's
+// role can read and write. Permissions come from system_auth when the role
+// can read it; otherwise each table is probed with a one-row read and write
+// access is left unknown, since it cannot be tested without writing.
+func getAccessibleObjects(handle int, session *db.Session) (*AccessibleObjects, error) {
+	tables := make(map[string][]string)
+	var ks, table string
+	iter := session.Query("SELECT keyspace_name, table_name FROM system_schema.tables").Iter()
+	for iter.Scan(&ks, &table) {
+		tables[ks] = append(tables[ks], table)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %v", err)
+	}
+	iter = session.Query("SELECT keyspace_name FROM system_schema.keyspaces").Iter()
+	for iter.Scan(&ks) {
+		if _, ok := tables[ks]; !ok {
+			tables[ks] = nil
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to list keyspaces: %v", err)
+	}
+
+	result := &AccessibleObjects{Role: session.Username(), Keyspaces: []ObjectAccess{}, Tables: []ObjectAccess{}}
+
+	var perms *rolePermissions
+	if result.Role != "" {
+		// Any failure (not authorized, or no system_auth as on Astra) falls
+		// back to probing
+		perms, _ = loadRolePermissions(session, result.Role)
+	}
+
+	// decide gives the access to a table, or to a keyspace when table is empty
+	var decide func(keyspace, table string) (selectOK, modifyOK *bool)
+	switch {
+	case result.Role == "":
+		// No credentials: the cluster does not authenticate
+		result.Source = accessSourceNoAuth
+		decide = func(string, string) (*bool, *bool) { return boolPtr(true), boolPtr(true) }
+	case perms != nil && perms.superuser:
+		result.Source = accessSourceSuper
+		result.Superuser = true
+		result.Roles = perms.roles
+		decide = func(string, string) (*bool, *bool) { return boolPtr(true), boolPtr(true) }
+	case perms != nil:
+		result.Source = accessSourceAuth
+		result.Roles = perms.roles
+		decide = func(keyspace, table string) (*bool, *bool) {
+			return boolPtr(perms.has("SELECT", keyspace, table)), boolPtr(perms.has("MODIFY", keyspace, table))
+		}
+	default:
+		result.Source = accessSourceProbe
+		probed := probeTables(handle, session, tables, result)
+		decide = func(keyspace, table string) (*bool, *bool) {
+			if table == "" {
+				return nil, nil
+			}
+			return probed[tableKey{keyspace: keyspace, table: table}], nil
+		}
+	}
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, keyspace := range names {
+		sort.Strings(tables[keyspace])
+		if alwaysReadableKeyspaces[keyspace] {
+			result.Keyspaces = append(result.Keyspaces, ObjectAccess{Keyspace: keyspace, Select: boolPtr(true), Modify: boolPtr(false)})
+			for _, table := range tables[keyspace] {
+				result.Tables = append(result.Tables, ObjectAccess{Keyspace: keyspace, Table: table, Select: boolPtr(true), Modify: boolPtr(false)})
+			}
+			continue
+		}
+
+		ksAccess := ObjectAccess{Keyspace: keyspace}
+		ksAccess.Select, ksAccess.Modify = decide(keyspace, "")
+		readable := 0
+		for _, table := range tables[keyspace] {
+			access := ObjectAccess{Keyspace: keyspace, Table: table}
+			access.Select, access.Modify = decide(keyspace, table)
+			if access.Select != nil && *access.Select {
+				readable++
+			}
+			if access.Modify != nil && *access.Modify {
+				ksAccess.Modify = boolPtr(true)
+			}
+			result.Tables = append(result.Tables, access)
+		}
+
+		// A keyspace with any readable table stays expandable in the sidebar
+		if readable > 0 {
+			ksAccess.Select = boolPtr(true)
+			ksAccess.Partial = readable < len(tables[keyspace])
+		}
+		result.Keyspaces = append(result.Keyspaces, ksAccess)
+	}
+	return result, nil
+}
+
+// probeTables reads one row from each user table, in parallel, up to
+// maxAccessProbes tables
+func probeTables(handle int, session *db.Session, tables map[string][]string, result *AccessibleObjects) map[tableKey]*bool {
+	type probe struct {
+		key    tableKey
+		column string
+	}
+	var probes []probe
+	for keyspace, names := range tables {
+		if alwaysReadableKeyspaces[keyspace] {
+			continue
+		}
+		meta, err := session.KeyspaceMetadata(keyspace)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			t := meta.Tables[name]
+			if t == nil || len(t.PartitionKey) == 0 {
+				continue
+			}
+			probes = append(probes, probe{key: tableKey{keyspace: keyspace, table: name}, column: t.PartitionKey[0].Name})
+		}
+	}
+	sort.Slice(probes, func(i, j int) bool {
+		a, b := probes[i].key, probes[j].key
+		return a.keyspace+"."+a.table < b.keyspace+"."+b.table
+	})
+	if len(probes) > maxAccessProbes {
+		probes = probes[:maxAccessProbes]
+		result.Truncated = true
+	}
+	result.Probed = len(probes)
+
+	results := make(map[tableKey]*bool, len(probes))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan probe)
+	for i := 0; i < accessProbeWorkers && i < len(probes); i++ {
+		wg.Add(1)
+		trackHandleWorkers(handle, 1)
+		go func() {
+			defer wg.Done()
+			defer trackHandleWorkers(handle, -1)
+			for p := range work {
+				ok := probeSelect(session, p.key.keyspace, p.key.table, p.column)
+				mu.Lock()
+				results[p.key] = ok
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, p := range probes {
+		work <- p
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Access heatmap
+//
+// An opt-in sampler per session that polls the coordinator latency virtual
+// tables of every node and turns their cumulative request counts into
+// per-table read and write counters. On 4.1+ it also samples
+// system_views.queries, counting the tables of the queries running at each
+// tick. The UI reads the counters with GetAccessHeatmap to highlight hot tables.
+
+// Sampling intervals
+const (
+	defaultHeatmapInterval = 10 * time.Second
+	minHeatmapInterval     = time.Second
+)
+
+// AccessHeatmapOptions configures access sampling for a session
+type AccessHeatmapOptions struct {
+	Enabled    *bool `json:"enabled,omitempty"`    // false stops sampling and drops the counters (default true)
+	IntervalMs int   `json:"intervalMs,omitempty"` // Time between samples (default 10000, minimum 1000)
+}
+
+// TableAccess is the sampled activity of one table
+type TableAccess struct {
+	Keyspace        string  `json:"keyspace"`
+	Table           string  `json:"table"`
+	Reads           int64   `json:"reads"`           // Coordinator reads since sampling started
+	Writes          int64   `json:"writes"`          // Coordinator writes since sampling started
+	ReadsPerSecond  float64 `json:"readsPerSecond"`  // Over the last interval
+	WritesPerSecond float64 `json:"writesPerSecond"` // Over the last interval
+	Running         int64   `json:"running"`         // Times seen in system_views.queries
+	Heat            float64 `json:"heat"`            // 0-1, reads and writes relative to the hottest table
+	LastActive      string  `json:"lastActive,omitempty"`
+}
+
+// AccessHeatmap is the result of GetAccessHeatmap
+type AccessHeatmap struct {
+	Sampling     bool              `json:"sampling"`
+	IntervalMs   int64             `json:"intervalMs,omitempty"`
+	StartedAt    string            `json:"startedAt,omitempty"`
+	LastSampleAt string            `json:"lastSampleAt,omitempty"`
+	Samples      int               `json:"samples"`
+	QueriesTable bool              `json:"queriesTable"`     // system_views.queries was readable on some node
+	Tables       []TableAccess     `json:"tables"`           // Hottest first
+	Errors       map[string]string `json:"errors,omitempty"` // Last error per host
+}
+
+// heatmapCounters are the cumulative counts a node reported at the last sample
+type heatmapCounters struct {
+	reads, writes map[tableKey]int64
+}
+
+// accessSampler is the sampling goroutine and counters of one session
+type accessSampler struct {
+	stop     chan struct{}
+	interval time.Duration
+	started  time.Time
+
+	mu         sync.Mutex
+	tables     map[tableKey]*TableAccess
+	previous   map[string]heatmapCounters // By host ID
+	lastSample time.Time
+	samples    int
+	queries    bool
+	errors     map[string]string
+}
+
+// Access samplers per session handle
+var (
+	accessSamplers     = make(map[int]*accessSampler)
+	accessSamplersLock sync.Mutex
+)
+
+// startAccessSampler replaces the session's sampler, restarting the counters
+func startAccessSampler(handle int, session *db.Session, interval time.Duration) *accessSampler {
+	sampler := &accessSampler{
+		stop:     make(chan struct{}),
+		interval: interval,
+		started:  time.Now(),
+		tables:   make(map[tableKey]*TableAccess),
+		previous: make(map[string]heatmapCounters),
+		errors:   make(map[string]string),
+	}
+
+	accessSamplersLock.Lock()
+	if previous := accessSamplers[handle]; previous != nil {
+		close(previous.stop)
+	}
+	accessSamplers[handle] = sampler
+	accessSamplersLock.Unlock()
+
+	go sampler.run(handle, session)
+	return sampler
+}
+
+// stopAccessSampler stops the session's sampler and drops its counters
+func stopAccessSampler(handle int) {
+	accessSamplersLock.Lock()
+	defer accessSamplersLock.Unlock()
+	if sampler := accessSamplers[handle]; sampler != nil {
+		close(sampler.stop)
+		delete(accessSamplers, handle)
+	}
+}
+
+// discardAccessSampler stops sampling when the session is closed. The
+// goroutine is signalled, not waited for, since a sample in progress may be
+// waiting for the handle lock.
+func discardAccessSampler(handle int) {
+	stopAccessSampler(handle)
+}
+
+// run samples until stopped or the session is closed
+func (s *accessSampler) run(handle int, session *db.Session) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.sample(handle, session)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if getSession(handle) != session {
+				return
+			}
+			s.sample(handle, session)
+		}
+	}
+}
+
+// sample reads the latency tables and running queries of every node that is up
+func (s *accessSampler) sample(handle int, session *db.Session) {
+	unlock := lockHandleShared(handle)
+	defer unlock()
+
+	// Rates cover the latest interval only
+	s.mu.Lock()
+	for _, t := range s.tables {
+		t.ReadsPerSecond, t.WritesPerSecond = 0, 0
+	}
+	s.mu.Unlock()
+
+	now := time.Now()
+	for _, host := range session.GetHosts() {
+		if !host.IsUp() {
+			continue
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		hostID := host.HostID()
+		counters, err := readAccessCounters(session, hostID)
+		running, queriesErr := readRunningTables(session, hostID)
+
+		s.mu.Lock()
+		if err != nil {
+			s.errors[host.ConnectAddressAndPort()] = err.Error()
+		} else {
+			delete(s.errors, host.ConnectAddressAndPort())
+			s.addCounters(hostID, counters, now)
+		}
+		if queriesErr == nil {
+			s.queries = true
+			for _, key := range running {
+				entry := s.entry(key)
+				entry.Running++
+				entry.LastActive = now.UTC().Format(time.RFC3339)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.lastSample = now
+	s.samples++
+	s.mu.Unlock()
+}
+
+// entry returns the counters of a table, creating them if needed
+func (s *accessSampler) entry(key tableKey) *TableAccess {
+	entry := s.tables[key]
+	if entry == nil {
+		entry = &TableAccess{Keyspace: key.keyspace, Table: key.table}
+		s.tables[key] = entry
+	}
+	return entry
+}
+
+// addCounters folds a node's cumulative counts into the table counters. The
+// first sample of a node is its baseline; a count lower than the last one
+// means the node restarted, so the new count is all new requests.
+func (s *accessSampler) addCounters(hostID string, current heatmapCounters, now time.Time) {
+	previous, seen := s.previous[hostID]
+	s.previous[hostID] = current
+	if !seen {
+		return
+	}
+
+	elapsed := now.Sub(s.lastSample).Seconds()
+	delta := func(cur, prev map[tableKey]int64, apply func(*TableAccess, int64, float64)) {
+		for key, count := range cur {
+			d := count - prev[key]
+			if d < 0 {
+				d = count
+			}
+			if d == 0 {
+				continue
+			}
+			rate := 0.0
+			if elapsed > 0 {
+				rate = float64(d) / elapsed
+			}
+			entry := s.entry(key)
+			apply(entry, d, rate)
+			entry.LastActive = now.UTC().Format(time.RFC3339)
+		}
+	}
+	delta(current.reads, previous.reads, func(t *TableAccess, d int64, rate float64) {
+		t.Reads += d
+		t.ReadsPerSecond += rate
+	})
+	delta(current.writes, previous.writes, func(t *TableAccess, d int64, rate float64) {
+		t.Writes += d
+		t.WritesPerSecond += rate
+	})
+}
+
+// readAccessCounters reads a node's cumulative coordinator read and write counts per user table
+func readAccessCounters(session *db.Session, hostID string) (heatmapCounters, error) {
+	counters := heatmapCounters{reads: make(map[tableKey]int64), writes: make(map[tableKey]int64)}
+	for table, counts := range map[string]map[tableKey]int64{
+		"coordinator_read_latency":  counters.reads,
+		"coordinator_write_latency": counters.writes,
+	} {
+		var keyspace, name string
+		var count int64
+		iter := session.Query("SELECT keyspace_name, table_name, count FROM system_views." + table).SetHostID(hostID).Iter()
+		for iter.Scan(&keyspace, &name, &count) {
+			if !isSystemKeyspace(keyspace) {
+				counts[tableKey{keyspace: keyspace, table: name}] = count
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return counters, err
+		}
+	}
+	return counters, nil
+}
+
+// readRunningTables returns the user tables of the queries a node is running.
+// system_views.queries only exists from Cassandra 4.1.
+func readRunningTables(session *db.Session, hostID string) ([]tableKey, error) {
+	var keys []tableKey
+	var task string
+	iter := session.Query("SELECT task FROM system_views.queries").SetHostID(hostID).Iter()
+	for iter.Scan(&task) {
+		keyspace, table := parseTableReference(task, "")
+		if keyspace != "" && table != "" && !isSystemKeyspace(keyspace) {
+			keys = append(keys, tableKey{keyspace: keyspace, table: table})
+		}
+	}
+	return keys, iter.Close()
+}
+
+// accessHeatmap returns the session's counters, hottest table first
+func accessHeatmap(handle int) *AccessHeatmap {
+	accessSamplersLock.Lock()
+	s := accessSamplers[handle]
+	accessSamplersLock.Unlock()
+
+	result := &AccessHeatmap{Tables: []TableAccess{}}
+	if s == nil {
+		return result
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result.Sampling = true
+	result.IntervalMs = s.interval.Milliseconds()
+	result.StartedAt = s.started.UTC().Format(time.RFC3339)
+	if !s.lastSample.IsZero() {
+		result.LastSampleAt = s.lastSample.UTC().Format(time.RFC3339)
+	}
+	result.Samples = s.samples
+	result.QueriesTable = s.queries
+	if len(s.errors) > 0 {
+		result.Errors = make(map[string]string, len(s.errors))
+		for host, err := range s.errors {
+			result.Errors[host] = err
+		}
+	}
+
+	hottest := int64(0)
+	for _, t := range s.tables {
+		result.Tables = append(result.Tables, *t)
+		hottest = max(hottest, t.Reads+t.Writes)
+	}
+	for i := range result.Tables {
+		if hottest > 0 {
+			t := &result.Tables[i]
+			t.Heat = math.Round(float64(t.Reads+t.Writes)/float64(hottest)*1000) / 1000
+		}
+	}
+	sort.Slice(result.Tables, func(i, j int) bool {
+		a, b := result.Tables[i], result.Tables[j]
+		if a.Reads+a.Writes != b.Reads+b.Writes {
+			return a.Reads+a.Writes > b.Reads+b.Writes
+		}
+		if a.Running != b.Running {
+			return a.Running > b.Running
+		}
+		return a.Keyspace+"."+a.Table < b.Keyspace+"."+b.Table
+	})
+	return result
+}
@@ -2,17 +2,22 @@ package main
 
 import (
 	"archive/zip"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/axonops/cqlai-node/internal/logger"
 )
 
 // AstraBundleInfo represents parsed secure connect bundle information
@@ -269,36 +274,105 @@ func ValidateAstraBundle(bundlePath string) (bool, []string) {
 	return len(errors) == 0, errors
 }
 
-// FetchAstraMetadata connects to the Astra metadata service and retrieves
-// the actual connection endpoints (SNI proxy address and contact points).
-// This must be called after ParseAstraBundle to get the real connection info.
-func FetchAstraMetadata(bundleInfo *AstraBundleInfo, timeout time.Duration) error {
-	if timeout == 0 {
-		timeout = 10 * time.Second
-	}
+// AstraMetadataRetry controls how the metadata service is retried. A failed
+// request is retried after Backoff, doubling up to MaxBackoff, until Attempts
+// requests have been made. Responses that cannot change on a retry (a bad
+// certificate, a 4xx status, a malformed body) are not retried.
+type AstraMetadataRetry struct {
+	Timeout    time.Duration // Per request; 10s when 0
+	Attempts   int           // 1 when 0
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// astraMetadataError is a failed metadata request that may succeed if retried
+type astraMetadataError struct {
+	err       error
+	retryable bool
+}
 
+func (e *astraMetadataError) Error() string { return e.err.Error() }
+func (e *astraMetadataError) Unwrap() error { return e.err }
+
+// astraTLSConfig returns the mTLS config of a bundle's certificates
+func astraTLSConfig(bundleInfo *AstraBundleInfo) (*tls.Config, error) {
 	// Load CA certificate
 	caCert, err := os.ReadFile(bundleInfo.CACertPath)
 	if err != nil {
-		return fmt.Errorf("failed to read CA certificate: %v", err)
+		return nil, fmt.Errorf("failed to read CA certificate: %v", err)
 	}
 
 	caCertPool := x509.NewCertPool()
 	if !caCertPool.AppendCertsFromPEM(caCert) {
-		return fmt.Errorf("failed to parse CA certificate")
+		return nil, fmt.Errorf("failed to parse CA certificate")
 	}
 
 	// Load client certificate and key for mTLS
 	clientCert, err := tls.LoadX509KeyPair(bundleInfo.CertPath, bundleInfo.KeyPath)
 	if err != nil {
-		return fmt.Errorf("failed to load client certificate: %v", err)
+		return nil, fmt.Errorf("failed to load client certificate: %v", err)
 	}
 
-	// Create TLS config for mTLS connection to metadata service
-	tlsConfig := &tls.Config{
+	return &tls.Config{
 		RootCAs:      caCertPool,
 		Certificates: []tls.Certificate{clientCert},
 		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// astraMetadataURL is the metadata service URL of a bundle
+func astraMetadataURL(bundleInfo *AstraBundleInfo) string {
+	return fmt.Sprintf("https://%s/metadata", net.JoinHostPort(bundleInfo.Host, strconv.Itoa(bundleInfo.Port)))
+}
+
+// FetchAstraMetadata connects to the Astra metadata service and retrieves
+// the actual connection endpoints (SNI proxy address and contact points).
+// This must be called after ParseAstraBundle to get the real connection info.
+func FetchAstraMetadata(bundleInfo *AstraBundleInfo, timeout time.Duration) error {
+	return FetchAstraMetadataWithRetry(context.Background(), bundleInfo, AstraMetadataRetry{Timeout: timeout})
+}
+
+// FetchAstraMetadataWithRetry is FetchAstraMetadata with retries. It stops
+// waiting between attempts when ctx is done.
+func FetchAstraMetadataWithRetry(ctx context.Context, bundleInfo *AstraBundleInfo, retry AstraMetadataRetry) error {
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+	tlsConfig, err := astraTLSConfig(bundleInfo)
+	if err != nil {
+		return err
+	}
+
+	backoff := retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err = fetchAstraMetadata(ctx, bundleInfo, tlsConfig, retry.Timeout)
+		var metaErr *astraMetadataError
+		if err == nil || !errors.As(err, &metaErr) || !metaErr.retryable {
+			return err
+		}
+		if attempt >= retry.Attempts {
+			if attempt > 1 {
+				return fmt.Errorf("%v (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+		logger.DebugfToFile("Astra", "Metadata request %d of %d failed, retrying in %v: %v", attempt, retry.Attempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if retry.MaxBackoff > 0 && backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
+}
+
+// fetchAstraMetadata makes one request to the metadata service
+func fetchAstraMetadata(ctx context.Context, bundleInfo *AstraBundleInfo, tlsConfig *tls.Config, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = 10 * time.Second
 	}
 
 	// Create HTTP client with TLS config
@@ -308,25 +382,36 @@ func FetchAstraMetadata(bundleInfo *AstraBundleInfo, timeout time.Duration) erro
 			TLSClientConfig: tlsConfig,
 		},
 	}
+	defer client.CloseIdleConnections()
 
 	// Build metadata URL
-	metadataURL := fmt.Sprintf("https://%s:%d/metadata", bundleInfo.Host, bundleInfo.Port)
+	metadataURL := astraMetadataURL(bundleInfo)
 
 	// Make request to metadata service
-	resp, err := client.Get(metadataURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
 	if err != nil {
-		return fmt.Errorf("failed to connect to metadata service at %s: %v", metadataURL, err)
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &astraMetadataError{
+			err:       fmt.Errorf("failed to connect to metadata service at %s: %v", metadataURL, err),
+			retryable: ctx.Err() == nil,
+		}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("metadata service returned status %d", resp.StatusCode)
+		return &astraMetadataError{
+			err:       fmt.Errorf("metadata service returned status %d", resp.StatusCode),
+			retryable: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		}
 	}
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read metadata response: %v", err)
+		return &astraMetadataError{err: fmt.Errorf("failed to read metadata response: %v", err), retryable: true}
 	}
 
 	// Parse metadata response
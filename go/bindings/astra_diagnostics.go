@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Astra connectivity
+//
+// Connecting to Astra takes three hops: the metadata service named in the
+// secure connect bundle is resolved and asked over mutual TLS for the SNI
+// proxy and contact points, then every CQL connection goes to the SNI proxy.
+// The metadata request is retried with exponential backoff, and
+// DiagnoseAstraConnectivity checks each hop on its own so that a failure
+// can be reported against the hop that caused it.
+
+// Defaults of AstraMetadataOptions
+const (
+	defaultAstraMetadataAttempts   = 3
+	defaultAstraMetadataBackoff    = 500 * time.Millisecond
+	defaultAstraMetadataMaxBackoff = 8 * time.Second
+)
+
+// AstraMetadataOptions controls the requests to the Astra metadata service
+type AstraMetadataOptions struct {
+	TimeoutSeconds int `json:"timeoutSeconds"` // Per request (default 10)
+	Attempts       int `json:"attempts"`       // Requests made before giving up (default 3)
+	BackoffMs      int `json:"backoffMs"`      // Wait before the first retry, doubled for each one after (default 500)
+	MaxBackoffMs   int `json:"maxBackoffMs"`   // Longest wait between retries (default 8000)
+}
+
+// astraMetadataRetry converts the options, filling in the defaults
+func astraMetadataRetry(opts *AstraMetadataOptions) (AstraMetadataRetry, error) {
+	retry := AstraMetadataRetry{
+		Attempts:   defaultAstraMetadataAttempts,
+		Backoff:    defaultAstraMetadataBackoff,
+		MaxBackoff: defaultAstraMetadataMaxBackoff,
+	}
+	if opts == nil {
+		return retry, nil
+	}
+	if opts.TimeoutSeconds < 0 || opts.Attempts < 0 || opts.BackoffMs < 0 || opts.MaxBackoffMs < 0 {
+		return retry, fmt.Errorf("metadataFetch options must not be negative")
+	}
+	retry.Timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	if opts.Attempts > 0 {
+		retry.Attempts = opts.Attempts
+	}
+	if opts.BackoffMs > 0 {
+		retry.Backoff = time.Duration(opts.BackoffMs) * time.Millisecond
+	}
+	if opts.MaxBackoffMs > 0 {
+		retry.MaxBackoff = time.Duration(opts.MaxBackoffMs) * time.Millisecond
+	}
+	if retry.MaxBackoff < retry.Backoff {
+		retry.MaxBackoff = retry.Backoff
+	}
+	return retry, nil
+}
+
+// Checks made by DiagnoseAstraConnectivity, in order
+const (
+	astraCheckBundle   = "bundle"
+	astraCheckDNS      = "dns"
+	astraCheckMetadata = "metadataService"
+	astraCheckSNIProxy = "sniProxy"
+)
+
+// DiagnoseAstraOptions are the options of DiagnoseAstraConnectivity
+type DiagnoseAstraOptions struct {
+	BundlePath     string `json:"bundlePath"`
+	ExtractDir     string `json:"extractDir"`
+	TimeoutSeconds int    `json:"timeoutSeconds"` // Per check (default 10)
+}
+
+// AstraCheck is the result of one connectivity check
+type AstraCheck struct {
+	Name       string      `json:"name"`
+	Target     string      `json:"target,omitempty"`
+	Status     string      `json:"status"` // "ok", "failed" or "skipped" when an earlier check failed
+	DurationMs float64     `json:"durationMs"`
+	Error      string      `json:"error,omitempty"`
+	Detail     interface{} `json:"detail,omitempty"`
+}
+
+// AstraDiagnosis is the result of DiagnoseAstraConnectivity
+type AstraDiagnosis struct {
+	OK       bool         `json:"ok"`
+	FailedAt string       `json:"failedAt,omitempty"` // Name of the first failed check
+	Checks   []AstraCheck `json:"checks"`
+}
+
+// run records a check; once one has failed the rest are skipped
+func (d *AstraDiagnosis) run(name, target string, check func() (interface{}, error)) {
+	result := AstraCheck{Name: name, Target: target}
+	if d.FailedAt != "" {
+		result.Status = "skipped"
+		d.Checks = append(d.Checks, result)
+		return
+	}
+	start := time.Now()
+	detail, err := check()
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	result.Detail = detail
+	result.Status = "ok"
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+		d.FailedAt = name
+	}
+	d.Checks = append(d.Checks, result)
+}
+
+// diagnoseAstra checks each hop of an Astra connection in turn
+func diagnoseAstra(opts DiagnoseAstraOptions) *AstraDiagnosis {
+	timeout := 10 * time.Second
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+	diagnosis := &AstraDiagnosis{Checks: []AstraCheck{}}
+
+	var bundleInfo *AstraBundleInfo
+	diagnosis.run(astraCheckBundle, opts.BundlePath, func() (interface{}, error) {
+		if ok, problems := ValidateAstraBundle(opts.BundlePath); !ok {
+			return problems, fmt.Errorf("invalid bundle")
+		}
+		info, err := ParseAstraBundle(opts.BundlePath, opts.ExtractDir)
+		if err != nil {
+			return nil, err
+		}
+		bundleInfo = info
+		return map[string]interface{}{"host": info.Host, "port": info.Port}, nil
+	})
+	if bundleInfo != nil {
+		defer CleanupAstraBundle(bundleInfo.ExtractedDir)
+	}
+
+	var metadataHost string
+	if bundleInfo != nil {
+		metadataHost = bundleInfo.Host
+	}
+	diagnosis.run(astraCheckDNS, metadataHost, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupHost(ctx, metadataHost)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"addresses": addrs}, nil
+	})
+
+	var metadataURL string
+	if bundleInfo != nil {
+		metadataURL = astraMetadataURL(bundleInfo)
+	}
+	diagnosis.run(astraCheckMetadata, metadataURL, func() (interface{}, error) {
+		// A single request, so a failure is reported as it happened
+		err := FetchAstraMetadataWithRetry(context.Background(), bundleInfo, AstraMetadataRetry{Timeout: timeout})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"sniProxy":      net.JoinHostPort(bundleInfo.SniHost, strconv.Itoa(bundleInfo.SniPort)),
+			"contactPoints": len(bundleInfo.ContactPoints),
+			"localDC":       bundleInfo.LocalDC,
+		}, nil
+	})
+
+	var sniAddress string
+	if bundleInfo != nil && bundleInfo.SniHost != "" {
+		sniAddress = net.JoinHostPort(bundleInfo.SniHost, strconv.Itoa(bundleInfo.SniPort))
+	}
+	diagnosis.run(astraCheckSNIProxy, sniAddress, func() (interface{}, error) {
+		if len(bundleInfo.ContactPoints) == 0 {
+			return nil, fmt.Errorf("metadata service returned no contact points")
+		}
+		conn, err := net.DialTimeout("tcp", sniAddress, timeout)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return map[string]interface{}{"remoteAddress": conn.RemoteAddr().String()}, nil
+	})
+
+	diagnosis.OK = diagnosis.FailedAt == ""
+	return diagnosis
+}
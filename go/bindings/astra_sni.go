@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Astra contact point refresh
+//
+// An Astra session connects through the SNI proxy of its secure connect
+// bundle, naming the node it wants by host ID (see internal/db/sni.go). The
+// metadata service lists the host IDs to use as contact points; nodes are
+// replaced over time, so the list is fetched again periodically and the
+// session's next connections use the new one. Open connections are kept.
+
+// defaultAstraRefresh is how often the contact points are fetched again
+const defaultAstraRefresh = 5 * time.Minute
+
+// AstraEndpoints reports how an Astra session connects, for GetSessionInfo
+type AstraEndpoints struct {
+	*db.SNIProxyInfo
+	RefreshIntervalSeconds int    `json:"refreshIntervalSeconds"` // 0 when refresh is disabled
+	LastRefreshAt          string `json:"lastRefreshAt,omitempty"`
+	LastRefreshError       string `json:"lastRefreshError,omitempty"`
+	Refreshes              int    `json:"refreshes"`
+}
+
+// astraRefresh is the refresh loop of one Astra session
+type astraRefresh struct {
+	ctx      context.Context
+	stop     context.CancelFunc
+	interval time.Duration
+	retry    AstraMetadataRetry
+
+	mu        sync.Mutex
+	lastAt    time.Time
+	lastError string
+	refreshes int
+}
+
+// Astra refresh loops per session handle
+var (
+	astraRefreshes     = make(map[int]*astraRefresh)
+	astraRefreshesLock sync.Mutex
+)
+
+// astraSNIProxy returns the SNI proxy options of a bundle whose metadata has
+// been fetched
+func astraSNIProxy(info *AstraBundleInfo) *db.SNIProxyOptions {
+	return &db.SNIProxyOptions{
+		Address:     net.JoinHostPort(info.SniHost, strconv.Itoa(info.SniPort)),
+		ServerNames: info.ContactPoints,
+	}
+}
+
+// astraRefreshInterval converts the metadataRefreshSeconds option; 0 means
+// the refresh is disabled
+func astraRefreshInterval(seconds int) time.Duration {
+	switch {
+	case seconds < 0:
+		return 0
+	case seconds == 0:
+		return defaultAstraRefresh
+	default:
+		return time.Duration(seconds) * time.Second
+	}
+}
+
+// startAstraRefresh records an Astra session's endpoints and, unless interval
+// is 0, refreshes its contact points every interval until it is closed
+func startAstraRefresh(handle int, session *db.Session, bundle *AstraBundleInfo, interval time.Duration, retry AstraMetadataRetry) {
+	ctx, stop := context.WithCancel(context.Background())
+	r := &astraRefresh{ctx: ctx, stop: stop, interval: interval, retry: retry}
+	astraRefreshesLock.Lock()
+	astraRefreshes[handle] = r
+	astraRefreshesLock.Unlock()
+	if interval > 0 {
+		go r.run(session, *bundle)
+	}
+}
+
+// run fetches the metadata every interval until stopped
+func (r *astraRefresh) run(session *db.Session, bundle AstraBundleInfo) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.refresh(session, bundle)
+		}
+	}
+}
+
+// refresh fetches the metadata once and hands the new contact points to the
+// session. On failure the previous ones stay in use.
+func (r *astraRefresh) refresh(session *db.Session, bundle AstraBundleInfo) {
+	err := FetchAstraMetadataWithRetry(r.ctx, &bundle, r.retry)
+	if r.ctx.Err() != nil {
+		return
+	}
+	if err == nil && len(bundle.ContactPoints) == 0 {
+		err = fmt.Errorf("metadata service returned no contact points")
+	}
+	if err == nil {
+		proxy := astraSNIProxy(&bundle)
+		err = session.SetSNIProxy(proxy.Address, proxy.ServerNames)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastAt = time.Now()
+	r.refreshes++
+	r.lastError = ""
+	if err != nil {
+		r.lastError = err.Error()
+	}
+}
+
+// astraEndpoints reports the endpoints of an Astra session, or nil for other sessions
+func astraEndpoints(handle int, session *db.Session) *AstraEndpoints {
+	proxy := session.SNIProxy()
+	if proxy == nil || !isAstraSession(handle) {
+		return nil
+	}
+	endpoints := &AstraEndpoints{SNIProxyInfo: proxy}
+
+	astraRefreshesLock.Lock()
+	r := astraRefreshes[handle]
+	astraRefreshesLock.Unlock()
+	if r != nil {
+		r.mu.Lock()
+		endpoints.RefreshIntervalSeconds = int(r.interval / time.Second)
+		if !r.lastAt.IsZero() {
+			endpoints.LastRefreshAt = r.lastAt.UTC().Format(time.RFC3339)
+		}
+		endpoints.LastRefreshError = r.lastError
+		endpoints.Refreshes = r.refreshes
+		r.mu.Unlock()
+	}
+	return endpoints
+}
+
+// discardAstraRefresh stops the refresh loop of a closed session. It is
+// called with sessionMutex held, so it does not wait for a refresh in progress.
+func discardAstraRefresh(handle int) {
+	astraRefreshesLock.Lock()
+	r := astraRefreshes[handle]
+	delete(astraRefreshes, handle)
+	astraRefreshesLock.Unlock()
+	if r != nil {
+		r.stop()
+	}
+}
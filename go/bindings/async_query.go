@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Asynchronous queries
+//
+// ExecuteQueryAsync runs a statement on its own goroutine and returns a query
+// ID straight away, so a slow SELECT does not hold the calling thread. The
+// host polls PollQueryResult until the status is no longer "running", and may
+// stop the query with CancelAsyncQuery (or Cancel, since the ID is a cancel
+// token). A finished result is handed out by the first poll that sees it and
+// then forgotten.
+
+// Async query statuses
+const (
+	asyncRunning   = "running"
+	asyncCompleted = "completed"
+	asyncFailed    = "failed"
+	asyncCancelled = "cancelled"
+)
+
+// AsyncQueryOptions are the options of ExecuteQueryAsync
+type AsyncQueryOptions struct {
+	Force       bool   `json:"force"`       // Run partition scans the scan guard would refuse
+	CancelToken string `json:"cancelToken"` // Query ID to use (default: one is issued)
+}
+
+// AsyncQueryStatus is the state of an asynchronous query
+type AsyncQueryStatus struct {
+	QueryID   string           `json:"queryId"`
+	Status    string           `json:"status"` // running, completed, failed or cancelled
+	ElapsedMs int64            `json:"elapsedMs"`
+	Result    *StatementResult `json:"result,omitempty"` // Once completed or failed
+}
+
+// asyncQuery is a statement running, or finished and not yet polled
+type asyncQuery struct {
+	id      string
+	handle  int
+	started time.Time
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	status   string
+	result   *StatementResult
+	finished time.Time
+}
+
+// snapshot returns the query's state, with the result once it has finished
+func (q *asyncQuery) snapshot() AsyncQueryStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	end := time.Now()
+	if !q.finished.IsZero() {
+		end = q.finished
+	}
+	return AsyncQueryStatus{
+		QueryID:   q.id,
+		Status:    q.status,
+		ElapsedMs: end.Sub(q.started).Milliseconds(),
+		Result:    q.result,
+	}
+}
+
+// finish records the outcome unless the query was cancelled first
+func (q *asyncQuery) finish(status string, result *StatementResult) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.status != asyncRunning {
+		return
+	}
+	q.status = status
+	q.result = result
+	q.finished = time.Now()
+}
+
+// Asynchronous queries by query ID
+var (
+	asyncQueries     = make(map[string]*asyncQuery)
+	asyncQueriesLock sync.Mutex
+)
+
+// startAsyncQuery registers a query and runs it in the background
+func startAsyncQuery(handle int, stmt string, opts AsyncQueryOptions) (string, error) {
+	session := getSession(handle)
+	id := opts.CancelToken
+	if id == "" {
+		id = newCancelToken()
+	}
+	ctx, done, err := startCancellable(id, handle, "asyncQuery")
+	if err != nil {
+		return "", err
+	}
+
+	q := &asyncQuery{id: id, handle: handle, started: time.Now(), status: asyncRunning, cancel: done}
+	asyncQueriesLock.Lock()
+	asyncQueries[id] = q
+	asyncQueriesLock.Unlock()
+
+	trackHandleWorkers(handle, 1)
+	go func() {
+		defer trackHandleWorkers(handle, -1)
+		defer done()
+
+		interactive := beginInteractive()
+		defer interactive()
+
+		// Same Astra tracing workaround as ExecuteQuery
+		tracingWasEnabled := false
+		var unlock func()
+		if isAstraSession(handle) && session.Tracing() {
+			unlock = lockHandleExclusive(handle)
+			tracingWasEnabled = true
+			session.SetTracing(false)
+		} else {
+			unlock = lockHandleShared(handle)
+		}
+		defer unlock()
+
+		identifier := ""
+		if fields := strings.Fields(stmt); len(fields) > 0 {
+			identifier = strings.ToUpper(fields[0])
+		}
+
+		var result StatementResult
+		if estimate := checkScanGuard(handle, session, stmt, opts.Force); estimate != nil {
+			result = StatementResult{
+				Identifier:   identifier,
+				Error:        scanGuardMessage(estimate),
+				ErrorCode:    "SCAN_LIMIT_EXCEEDED",
+				ScanEstimate: estimate,
+			}
+		} else if tooLarge := checkStatementPayload(handle, session, 0, stmt, nil); tooLarge != nil {
+			result = payloadStatementResult(0, identifier, tooLarge)
+		} else {
+			result = executeStatement(ctx, handle, session, stmt, 0, identifier, nil)
+		}
+		if tracingWasEnabled {
+			session.SetTracing(true)
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			q.finish(asyncCancelled, nil)
+		case result.Success:
+			q.finish(asyncCompleted, &result)
+		default:
+			q.finish(asyncFailed, &result)
+		}
+	}()
+	return id, nil
+}
+
+// pollAsyncQuery returns the state of a query of the handle. A finished
+// query is forgotten once its state has been returned.
+func pollAsyncQuery(handle int, id string) (AsyncQueryStatus, bool) {
+	asyncQueriesLock.Lock()
+	defer asyncQueriesLock.Unlock()
+	q := asyncQueries[id]
+	if q == nil || q.handle != handle {
+		return AsyncQueryStatus{}, false
+	}
+	status := q.snapshot()
+	if status.Status != asyncRunning {
+		delete(asyncQueries, id)
+	}
+	return status, true
+}
+
+// cancelAsyncQuery stops a running query. A statement already sent to the
+// server is abandoned rather than interrupted: its rows are discarded when
+// they arrive. The query reports "cancelled" from then on.
+func cancelAsyncQuery(handle int, id string) (AsyncQueryStatus, bool) {
+	asyncQueriesLock.Lock()
+	q := asyncQueries[id]
+	asyncQueriesLock.Unlock()
+	if q == nil || q.handle != handle {
+		return AsyncQueryStatus{}, false
+	}
+	q.finish(asyncCancelled, nil)
+	q.cancel()
+	return q.snapshot(), true
+}
+
+// discardAsyncQueries cancels the session's queries and forgets their results
+func discardAsyncQueries(handle int) {
+	asyncQueriesLock.Lock()
+	var cancelled []*asyncQuery
+	for id, q := range asyncQueries {
+		if q.handle == handle {
+			cancelled = append(cancelled, q)
+			delete(asyncQueries, id)
+		}
+	}
+	asyncQueriesLock.Unlock()
+
+	for _, q := range cancelled {
+		q.finish(asyncCancelled, nil)
+		q.cancel()
+	}
+}
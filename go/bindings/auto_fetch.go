@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Auto-fetch
+//
+// With auto-fetch on (SetAutoFetch), ExecuteQueryPaged and FetchNextPage
+// keep reading pages until the query is exhausted or the session's row cap
+// is reached, instead of stopping after one page. A query cut off by the cap
+// is returned with truncated set and stays open, so the rest can still be
+// fetched or cancelled. GetFetchProgress reports the rows read so far.
+
+// FetchProgress is the state of the session's running or latest auto-fetch
+type FetchProgress struct {
+	Rows      int64 `json:"rows"`  // Rows read so far
+	Pages     int64 `json:"pages"` // Pages of pageSize rows read so far
+	MaxRows   int   `json:"maxRows"`
+	Running   bool  `json:"running"`
+	Truncated bool  `json:"truncated"` // Stopped at maxRows with rows remaining
+	ElapsedMs int64 `json:"elapsedMs"`
+}
+
+// fetchState tracks a running auto-fetch for GetFetchProgress
+type fetchState struct {
+	pageSize  int
+	maxRows   int
+	started   time.Time
+	rows      atomic.Int64
+	truncated atomic.Bool
+	finished  atomic.Int64 // Unix milliseconds, 0 while running
+}
+
+func (s *fetchState) progress() FetchProgress {
+	end := time.Now()
+	if ms := s.finished.Load(); ms != 0 {
+		end = time.UnixMilli(ms)
+	}
+	rows := s.rows.Load()
+	return FetchProgress{
+		Rows:      rows,
+		Pages:     (rows + int64(s.pageSize) - 1) / int64(s.pageSize),
+		MaxRows:   s.maxRows,
+		Running:   s.finished.Load() == 0,
+		Truncated: s.truncated.Load(),
+		ElapsedMs: end.Sub(s.started).Milliseconds(),
+	}
+}
+
+// finish marks the fetch as done
+func (s *fetchState) finish(truncated bool) {
+	s.truncated.Store(truncated)
+	s.finished.Store(time.Now().UnixMilli())
+}
+
+var (
+	fetchStates     = make(map[int]*fetchState)
+	fetchStatesLock sync.Mutex
+)
+
+// pageLimit returns how many rows the next read of a paged query returns:
+// one page, or with auto-fetch on the session's row cap, in which case the
+// read is tracked for GetFetchProgress. The returned state is nil for a
+// single page.
+func pageLimit(handle int, session *db.Session, pageSize int) (int, *fetchState) {
+	if !session.AutoFetch() {
+		return pageSize, nil
+	}
+	state := &fetchState{pageSize: pageSize, maxRows: session.AutoFetchMaxRows(), started: time.Now()}
+	fetchStatesLock.Lock()
+	fetchStates[handle] = state
+	fetchStatesLock.Unlock()
+	return state.maxRows, state
+}
+
+// rowSource reads the rows of a paged query one at a time, as a
+// db.RowScanner does
+type rowSource interface {
+	Next() (map[string]interface{}, bool)
+}
+
+// readRows appends rows from the scanner until it is exhausted or rows holds
+// limit rows, counting them on fetch when auto-fetching
+func readRows(rows []map[string]interface{}, scanner rowSource, limit int, fetch *fetchState) []map[string]interface{} {
+	if fetch != nil {
+		fetch.rows.Store(int64(len(rows)))
+	}
+	for len(rows) < limit {
+		row, ok := scanner.Next()
+		if !ok {
+			break
+		}
+		rows = append(rows, row)
+		if fetch != nil {
+			fetch.rows.Add(1)
+		}
+	}
+	return rows
+}
+
+// fetchProgress returns the progress of the session's latest auto-fetch, or nil
+func fetchProgress(handle int) *FetchProgress {
+	fetchStatesLock.Lock()
+	state := fetchStates[handle]
+	fetchStatesLock.Unlock()
+	if state == nil {
+		return nil
+	}
+	p := state.progress()
+	return &p
+}
+
+// discardFetchProgress forgets the session's auto-fetch progress
+func discardFetchProgress(handle int) {
+	fetchStatesLock.Lock()
+	delete(fetchStates, handle)
+	fetchStatesLock.Unlock()
+}
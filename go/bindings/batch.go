@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Batches
+//
+// ExecuteBatch sends INSERT, UPDATE and DELETE statements to the server as
+// one BATCH in a single round trip, unlike ExecuteMultiQuery which runs them
+// one by one. A LOGGED batch is applied atomically; an UNLOGGED batch skips
+// the batch log and is faster, best kept to a single partition; a COUNTER
+// batch holds counter updates only. Statements are CQL text, optionally with
+// bind values converted to their variables' types as for ExecutePrepared, or
+// statements prepared with PrepareStatement. With chunk, an UNLOGGED or
+// COUNTER batch larger than the server's batch size fail threshold is sent as
+// several smaller batches (see payload_size.go).
+
+// maxBatchStatements is the most statements a batch frame can carry
+const maxBatchStatements = 65535
+
+// BatchRequest is the payload of ExecuteBatch
+type BatchRequest struct {
+	Type        string           `json:"type"` // LOGGED (default), UNLOGGED or COUNTER
+	Statements  []BatchStatement `json:"statements"`
+	Timestamp   int64            `json:"timestamp"`   // Write time in microseconds; 0 lets the coordinator pick
+	CancelToken string           `json:"cancelToken"` // Token for Cancel
+	Chunk       bool             `json:"chunk"`       // Split an UNLOGGED or COUNTER batch that is too large into several
+}
+
+// BatchStatement is one statement of a batch. Exactly one of Query and
+// StatementID is set.
+type BatchStatement struct {
+	Query       string          `json:"query,omitempty"`
+	StatementID string          `json:"statementId,omitempty"` // From PrepareStatement
+	Values      json.RawMessage `json:"values,omitempty"`      // Array in bind marker order, or object by variable name
+}
+
+// BatchResult is the outcome of a batch
+type BatchResult struct {
+	Type           string                   `json:"type"`
+	Statements     int                      `json:"statements"`
+	Applied        *bool                    `json:"applied,omitempty"` // Set for conditional (IF ...) batches
+	Rows           []map[string]interface{} `json:"rows,omitempty"`    // Current values when a conditional batch was not applied
+	Duration       string                   `json:"duration"`
+	TraceSessionID string                   `json:"traceSessionId,omitempty"`
+	Warnings       []string                 `json:"warnings,omitempty"` // Server warnings, e.g. a batch over the size warning threshold
+	Batches        int                      `json:"batches,omitempty"`  // Batches sent, when chunk split the statements
+}
+
+// batchTypes maps the batch types of a request to the driver's
+var batchTypes = map[string]gocql.BatchType{
+	"LOGGED":   gocql.LoggedBatch,
+	"UNLOGGED": gocql.UnloggedBatch,
+	"COUNTER":  gocql.CounterBatch,
+}
+
+// boundStatement is a statement of a batch with its values bound
+type boundStatement struct {
+	query  string
+	values []interface{}
+	size   int64 // Estimated serialized size
+}
+
+// bindBatch checks the statements of a request and binds their values.
+// It reports whether any statement is conditional.
+func bindBatch(handle int, session *db.Session, req *BatchRequest) ([]boundStatement, bool, error) {
+	if req.Type == "" {
+		req.Type = "LOGGED"
+	}
+	req.Type = strings.ToUpper(req.Type)
+	if _, ok := batchTypes[req.Type]; !ok {
+		return nil, false, fmt.Errorf("batch type must be LOGGED, UNLOGGED or COUNTER, got %s", req.Type)
+	}
+	if len(req.Statements) == 0 {
+		return nil, false, fmt.Errorf("batch has no statements")
+	}
+	if len(req.Statements) > maxBatchStatements {
+		return nil, false, fmt.Errorf("batch has %d statements; at most %d are allowed", len(req.Statements), maxBatchStatements)
+	}
+
+	var stmts []boundStatement
+	conditional := false
+	prepared := make(map[string]*preparedStatement) // Queries with values, prepared once per batch
+	for i, entry := range req.Statements {
+		if (entry.Query == "") == (entry.StatementID == "") {
+			return nil, false, fmt.Errorf("statement %d: exactly one of query and statementId is required", i+1)
+		}
+
+		stmt := prepared[entry.Query]
+		if entry.StatementID != "" {
+			if stmt = getPrepared(handle, entry.StatementID); stmt == nil {
+				return nil, false, fmt.Errorf("statement %d: prepared statement %s not found or closed", i+1, entry.StatementID)
+			}
+		}
+		query := entry.Query
+		if stmt != nil {
+			query = stmt.info.Query
+		}
+
+		desc := cql.DescribeStatement(query)
+		switch desc.Kind {
+		case "INSERT", "UPDATE", "DELETE":
+		default:
+			return nil, false, fmt.Errorf("statement %d: batches can only contain INSERT, UPDATE and DELETE, got %s", i+1, desc.Kind)
+		}
+		conditional = conditional || desc.Options.Conditional
+
+		if stmt == nil && len(entry.Values) == 0 {
+			stmts = append(stmts, boundStatement{query: query, size: statementSize(query, nil)})
+			continue
+		}
+		if stmt == nil {
+			var err error
+			if stmt, err = newPreparedStatement(session, query); err != nil {
+				return nil, false, fmt.Errorf("statement %d: %v", i+1, err)
+			}
+			prepared[query] = stmt
+		}
+		values, err := stmt.bindValues(string(entry.Values))
+		if err != nil {
+			return nil, false, fmt.Errorf("statement %d: %v", i+1, err)
+		}
+		stmts = append(stmts, boundStatement{query: query, values: values, size: statementSize(query, values)})
+	}
+	if req.Chunk && (req.Type == "LOGGED" || conditional) {
+		return nil, false, fmt.Errorf("only UNLOGGED and COUNTER batches without conditions can be split with chunk")
+	}
+	return stmts, conditional, nil
+}
+
+// planBatches checks the size of a batch's statements and groups them into
+// the batches to send: one, unless the request asks for chunks and the batch
+// is larger than the server's batch size fail threshold. A batch larger than
+// the mutation or frame size that cannot be split is refused.
+func planBatches(handle int, session *db.Session, req *BatchRequest, stmts []boundStatement) ([][]boundStatement, *PayloadTooLarge) {
+	var total int64
+	for _, stmt := range stmts {
+		total += stmt.size
+	}
+	if total < payloadCheckFloor && !req.Chunk {
+		return [][]boundStatement{stmts}, nil
+	}
+
+	limits := payloadLimitsFor(handle, session)
+	for i, stmt := range stmts {
+		if tooLarge := limits.check(i, stmt.size, true); tooLarge != nil {
+			return nil, tooLarge
+		}
+	}
+
+	if !req.Chunk || total <= limits.BatchFailBytes {
+		var size int64
+		for i, stmt := range stmts {
+			size += stmt.size
+			if tooLarge := limits.check(i, size, true); tooLarge != nil {
+				tooLarge.Batch = true
+				return nil, tooLarge
+			}
+		}
+		return [][]boundStatement{stmts}, nil
+	}
+
+	// A statement larger than the threshold goes on its own: a batch of one
+	// statement writes one partition, which the threshold does not apply to
+	var groups [][]boundStatement
+	var size int64
+	start := 0
+	for i, stmt := range stmts {
+		if i > start && size+stmt.size > limits.BatchFailBytes {
+			groups = append(groups, stmts[start:i])
+			start, size = i, 0
+		}
+		size += stmt.size
+	}
+	return append(groups, stmts[start:]), nil
+}
+
+// newBatch builds the driver batch of some of a request's statements
+func newBatch(session *db.Session, req *BatchRequest, stmts []boundStatement) *gocql.Batch {
+	b := session.NewBatchWithDefaults(batchTypes[req.Type])
+	if req.Timestamp != 0 {
+		b.WithTimestamp(req.Timestamp)
+	}
+	for _, stmt := range stmts {
+		b.Query(stmt.query, stmt.values...)
+	}
+	return b
+}
+
+// executeBatches sends the planned batches in order and stops at the first
+// that fails; the batches before it stay applied
+func executeBatches(ctx context.Context, session *db.Session, req *BatchRequest, groups [][]boundStatement, conditional bool) (*BatchResult, error) {
+	if len(groups) == 1 {
+		return executeBatch(ctx, session, req, newBatch(session, req, groups[0]), conditional)
+	}
+
+	start := time.Now()
+	result := &BatchResult{Type: req.Type, Statements: len(req.Statements), Batches: len(groups)}
+	first := 0
+	for i, group := range groups {
+		part, err := executeBatch(ctx, session, req, newBatch(session, req, group), false)
+		if err != nil {
+			return nil, fmt.Errorf("batch %d of %d (statements %d-%d) failed after %d batches were applied: %v",
+				i+1, len(groups), first+1, first+len(group), i, err)
+		}
+		result.Warnings = append(result.Warnings, part.Warnings...)
+		first += len(group)
+	}
+	result.Duration = time.Since(start).String()
+	result.TraceSessionID = getTraceIDIfEnabled(session)
+	return result, nil
+}
+
+// executeBatch runs a batch. A conditional batch reports whether it was
+// applied and, when it was not, the current values of the rows it checked.
+func executeBatch(ctx context.Context, session *db.Session, req *BatchRequest, b *gocql.Batch, conditional bool) (*BatchResult, error) {
+	start := time.Now()
+	result := &BatchResult{Type: req.Type, Statements: len(req.Statements)}
+
+	if conditional {
+		row := make(map[string]interface{})
+		applied, iter, err := b.MapExecCASContext(ctx, row)
+		if iter != nil {
+			result.Warnings = iter.Warnings()
+		}
+		if err != nil {
+			if iter != nil {
+				_ = iter.Close()
+			}
+			return nil, err
+		}
+		result.Applied = &applied
+		if !applied {
+			result.Rows = append(result.Rows, row)
+			for {
+				row = make(map[string]interface{})
+				if !iter.MapScan(row) {
+					break
+				}
+				delete(row, "[applied]")
+				result.Rows = append(result.Rows, row)
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	} else {
+		iter := b.IterContext(ctx)
+		result.Warnings = iter.Warnings()
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Duration = time.Since(start).String()
+	result.TraceSessionID = getTraceIDIfEnabled(session)
+	return result, nil
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Micro-benchmarks
+//
+// BenchmarkWrites measures coordinator latency for synthetic writes to a
+// throwaway table, and BenchmarkReads for reads of sampled partitions of an
+// existing table, once per combination of consistency level and concurrency.
+// Every run is rate limited and the whole benchmark has a hard time limit, so
+// the defaults are safe to point at a shared cluster.
+
+// Defaults and limits for benchmarks
+const (
+	defaultBenchRequests      = 1000
+	maxBenchRequests          = 100000
+	defaultBenchRate          = 500
+	maxBenchRate              = 50000
+	defaultBenchMaxDuration   = time.Minute
+	maxBenchMaxDuration       = 10 * time.Minute
+	maxBenchConcurrency       = 256
+	defaultBenchValueColumns  = 4
+	maxBenchValueColumns      = 32
+	defaultBenchValueSize     = 100
+	maxBenchValueSize         = 64 * 1024
+	maxBenchRowsPerPartition  = 10000
+	benchScratchLeaseSeconds  = 3600
+	benchWarmupRequestsPerRun = 20 // Unmeasured requests before each run
+	defaultBenchSampleKeys    = 1000
+	maxBenchSampleKeys        = 10000
+	benchSampleStarts         = 16 // Random ring positions partition keys are sampled from
+	defaultBenchRowsPerRead   = 100
+	maxBenchRowsPerRead       = 10000
+)
+
+// defaultBenchConsistency and defaultBenchConcurrency are the runs made when
+// the options do not list any
+var (
+	defaultBenchConsistency = []string{"ONE", "LOCAL_QUORUM"}
+	defaultBenchConcurrency = []int{1, 8}
+)
+
+// BenchmarkTableSpec describes the synthetic table BenchmarkWrites writes to
+type BenchmarkTableSpec struct {
+	Keyspace         string `json:"keyspace"`         // Keyspace for the table; a scratch space is created when empty
+	ValueColumns     int    `json:"valueColumns"`     // Text columns per row (default 4, max 32)
+	ValueSize        int    `json:"valueSize"`        // Bytes per value (default 100, max 65536)
+	RowsPerPartition int    `json:"rowsPerPartition"` // Rows written to each partition (default 1)
+}
+
+// BenchmarkOptions sets the runs of a benchmark and its limits
+type BenchmarkOptions struct {
+	ConsistencyLevels []string `json:"consistencyLevels"` // One run per level and concurrency (default ONE, LOCAL_QUORUM)
+	Concurrency       []int    `json:"concurrency"`       // Requests in flight (default 1 and 8)
+	Requests          int      `json:"requests"`          // Measured requests per run (default 1000)
+	RatePerSecond     int      `json:"ratePerSecond"`     // Request rate limit per run (default 500)
+	MaxDurationMs     int      `json:"maxDurationMs"`     // Hard limit for the whole benchmark (default 60000, max 600000)
+	CancelToken       string   `json:"cancelToken"`       // Token for Cancel; CancelQuery also stops the benchmark
+}
+
+// BenchmarkReadsOptions adds the key sample to the benchmark options
+type BenchmarkReadsOptions struct {
+	BenchmarkOptions
+	SampleKeys  int `json:"sampleKeys"`  // Partition keys sampled from the table (default 1000, max 10000)
+	RowsPerRead int `json:"rowsPerRead"` // LIMIT of each partition read (default 100)
+}
+
+// LatencyReport summarizes request latencies in milliseconds
+type LatencyReport struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p999"`
+	Max  float64 `json:"max"`
+}
+
+// BenchmarkRun is the result of one consistency level and concurrency
+type BenchmarkRun struct {
+	Consistency string         `json:"consistency"`
+	Concurrency int            `json:"concurrency"`
+	Requests    int            `json:"requests"` // Requests completed, including failed ones
+	Errors      int            `json:"errors"`
+	ErrorRate   float64        `json:"errorRate"`
+	ErrorTypes  map[string]int `json:"errorTypes,omitempty"` // e.g. write_timeout, unavailable
+	Throughput  float64        `json:"throughput"`           // Requests per second
+	DurationMs  int64          `json:"durationMs"`
+	Latency     LatencyReport  `json:"latency"` // Of successful requests
+}
+
+// BenchmarkResult is the report of a benchmark
+type BenchmarkResult struct {
+	Keyspace      string         `json:"keyspace"`
+	Table         string         `json:"table"`
+	ScratchSpace  bool           `json:"scratchSpace,omitempty"` // The table was created in a scratch keyspace
+	SampledKeys   int            `json:"sampledKeys,omitempty"`  // Partition keys read by BenchmarkReads
+	ServerVersion string         `json:"serverVersion"`
+	Datacenter    string         `json:"datacenter"`            // Datacenter of the coordinator
+	Replication   int            `json:"replication,omitempty"` // Replication factor of the keyspace in that datacenter
+	Runs          []BenchmarkRun `json:"runs"`
+	Complete      bool           `json:"complete"`
+	StopReason    string         `json:"stopReason,omitempty"`   // maxDuration or cancelled
+	CleanupError  string         `json:"cleanupError,omitempty"` // Set when the benchmark table could not be dropped
+	RatePerSecond int            `json:"ratePerSecond"`
+	DurationMs    int64          `json:"durationMs"`
+	Warnings      []string       `json:"warnings"`
+}
+
+// benchRun is a consistency level and concurrency to measure
+type benchRun struct {
+	level       string
+	consistency gocql.Consistency
+	concurrency int
+}
+
+// benchmarkPlan validates the options and returns the runs to make
+func benchmarkPlan(opts *BenchmarkOptions) ([]benchRun, error) {
+	levels := opts.ConsistencyLevels
+	if len(levels) == 0 {
+		levels = defaultBenchConsistency
+	}
+	concurrency := opts.Concurrency
+	if len(concurrency) == 0 {
+		concurrency = defaultBenchConcurrency
+	}
+	if opts.Requests <= 0 {
+		opts.Requests = defaultBenchRequests
+	}
+	opts.Requests = min(opts.Requests, maxBenchRequests)
+	if opts.RatePerSecond <= 0 {
+		opts.RatePerSecond = defaultBenchRate
+	}
+	opts.RatePerSecond = min(opts.RatePerSecond, maxBenchRate)
+
+	var runs []benchRun
+	for _, level := range levels {
+		c, err := gocql.ParseConsistencyWrapper(strings.ToUpper(level))
+		if err != nil {
+			return nil, fmt.Errorf("invalid consistency level %q", level)
+		}
+		for _, n := range concurrency {
+			if n < 1 || n > maxBenchConcurrency {
+				return nil, fmt.Errorf("concurrency must be between 1 and %d, got %d", maxBenchConcurrency, n)
+			}
+			runs = append(runs, benchRun{level: c.String(), consistency: c, concurrency: n})
+		}
+	}
+	return runs, nil
+}
+
+// benchmarkDeadline returns the hard time limit of a benchmark started now
+func benchmarkDeadline(opts BenchmarkOptions) time.Time {
+	limit := defaultBenchMaxDuration
+	if opts.MaxDurationMs > 0 {
+		limit = min(time.Duration(opts.MaxDurationMs)*time.Millisecond, maxBenchMaxDuration)
+	}
+	return time.Now().Add(limit)
+}
+
+// benchPacer spaces requests evenly at a fixed rate across all workers
+type benchPacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newBenchPacer(rate int) *benchPacer {
+	return &benchPacer{interval: time.Second / time.Duration(rate), next: time.Now()}
+}
+
+// wait blocks until the caller's request slot, or returns false when ctx ends first
+func (p *benchPacer) wait(ctx context.Context) bool {
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	slot := p.next
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// benchErrorType names the kind of a failed request for BenchmarkRun.ErrorTypes
+func benchErrorType(err error) string {
+	var writeTimeout *gocql.RequestErrWriteTimeout
+	var readTimeout *gocql.RequestErrReadTimeout
+	var unavailable *gocql.RequestErrUnavailable
+	var overloaded *gocql.RequestErrOverloaded
+	var writeFailure *gocql.RequestErrWriteFailure
+	var readFailure *gocql.RequestErrReadFailure
+	switch {
+	case errors.As(err, &writeTimeout):
+		return "write_timeout"
+	case errors.As(err, &readTimeout):
+		return "read_timeout"
+	case errors.As(err, &unavailable):
+		return "unavailable"
+	case errors.As(err, &overloaded):
+		return "overloaded"
+	case errors.As(err, &writeFailure):
+		return "write_failure"
+	case errors.As(err, &readFailure):
+		return "read_failure"
+	case errors.Is(err, gocql.ErrTimeoutNoResponse):
+		return "client_timeout"
+	default:
+		return "other"
+	}
+}
+
+// toMillis converts a latency to milliseconds with microsecond precision
+func toMillis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// newLatencyReport computes nearest-rank percentiles of the samples
+func newLatencyReport(samples []time.Duration) LatencyReport {
+	if len(samples) == 0 {
+		return LatencyReport{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p*float64(len(samples)))) - 1
+		return toMillis(samples[max(rank, 0)])
+	}
+	var total time.Duration
+	for _, s := range samples {
+		total += s
+	}
+	return LatencyReport{
+		Min:  toMillis(samples[0]),
+		Mean: toMillis(total / time.Duration(len(samples))),
+		P50:  percentile(0.50),
+		P90:  percentile(0.90),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+		P999: percentile(0.999),
+		Max:  toMillis(samples[len(samples)-1]),
+	}
+}
+
+// runBenchmark issues requests with the given concurrency until the run has
+// made its requests or ctx ends. op makes request seq of the run; warmup
+// requests have a negative seq and are not measured.
+func runBenchmark(ctx context.Context, handle int, run benchRun, requests, rate int, op func(seq int) error) BenchmarkRun {
+	result := BenchmarkRun{Consistency: run.level, Concurrency: run.concurrency}
+	pacer := newBenchPacer(rate)
+
+	for seq := -benchWarmupRequestsPerRun; seq < 0 && ctx.Err() == nil; seq++ {
+		if pacer.wait(ctx) {
+			_ = op(seq)
+		}
+	}
+
+	var next atomic.Int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	samples := make([]time.Duration, 0, requests)
+	errorTypes := make(map[string]int)
+
+	start := time.Now()
+	for w := 0; w < run.concurrency; w++ {
+		wg.Add(1)
+		trackHandleWorkers(handle, 1)
+		go func() {
+			defer wg.Done()
+			defer trackHandleWorkers(handle, -1)
+			for {
+				seq := int(next.Add(1)) - 1
+				if seq >= requests || !pacer.wait(ctx) {
+					return
+				}
+				began := time.Now()
+				err := op(seq)
+				elapsed := time.Since(began)
+				if err != nil && ctx.Err() != nil {
+					return // Cancelled mid-request; not a server error
+				}
+
+				mu.Lock()
+				result.Requests++
+				if err != nil {
+					result.Errors++
+					errorTypes[benchErrorType(err)]++
+				} else {
+					samples = append(samples, elapsed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	result.DurationMs = elapsed.Milliseconds()
+	if result.Requests > 0 {
+		result.ErrorRate = math.Round(float64(result.Errors)/float64(result.Requests)*10000) / 10000
+		result.Throughput = math.Round(float64(result.Requests)/elapsed.Seconds()*10) / 10
+	}
+	if len(errorTypes) > 0 {
+		result.ErrorTypes = errorTypes
+	}
+	result.Latency = newLatencyReport(samples)
+	return result
+}
+
+// runBenchmarks makes every run in turn until the deadline or cancellation
+func runBenchmarks(ctx context.Context, handle int, result *BenchmarkResult, runs []benchRun, opts BenchmarkOptions, deadline time.Time, op func(run benchRun, seq int) error) {
+	runCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	for _, run := range runs {
+		if runCtx.Err() != nil {
+			break
+		}
+		result.Runs = append(result.Runs, runBenchmark(runCtx, handle, run, opts.Requests, opts.RatePerSecond, func(seq int) error {
+			return op(run, seq)
+		}))
+	}
+
+	complete := len(result.Runs) == len(runs)
+	for _, run := range result.Runs {
+		if run.Requests < opts.Requests {
+			complete = false
+		}
+	}
+	result.Complete = complete
+	switch {
+	case complete:
+	case ctx.Err() != nil:
+		result.StopReason = "cancelled"
+	default:
+		result.StopReason = "maxDuration"
+	}
+}
+
+// randomBenchValue returns a printable value of n bytes
+func randomBenchValue(n int) string {
+	buf := make([]byte, (n+1)/2)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)[:n]
+}
+
+// benchmarkWrites creates a benchmark table, measures writes to it and drops it
+func benchmarkWrites(ctx context.Context, handle int, session *db.Session, spec BenchmarkTableSpec, opts BenchmarkOptions) (*BenchmarkResult, error) {
+	recordUsage(usageBenchmarks, 1)
+	start := time.Now()
+	runs, err := benchmarkPlan(&opts)
+	if err != nil {
+		return nil, err
+	}
+	deadline := benchmarkDeadline(opts)
+
+	if spec.ValueColumns <= 0 {
+		spec.ValueColumns = defaultBenchValueColumns
+	}
+	spec.ValueColumns = min(spec.ValueColumns, maxBenchValueColumns)
+	if spec.ValueSize <= 0 {
+		spec.ValueSize = defaultBenchValueSize
+	}
+	spec.ValueSize = min(spec.ValueSize, maxBenchValueSize)
+	if spec.RowsPerPartition <= 0 {
+		spec.RowsPerPartition = 1
+	}
+	spec.RowsPerPartition = min(spec.RowsPerPartition, maxBenchRowsPerPartition)
+
+	result := &BenchmarkResult{
+		Keyspace:      spec.Keyspace,
+		Runs:          []BenchmarkRun{},
+		RatePerSecond: opts.RatePerSecond,
+		Warnings:      []string{},
+	}
+	if result.Keyspace == "" {
+		space, err := createScratchSpace(handle, session, ScratchSpaceOptions{TTLSeconds: benchScratchLeaseSeconds})
+		if err != nil {
+			return nil, err
+		}
+		result.Keyspace = space.Keyspace
+		result.ScratchSpace = true
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	result.Table = "bench_" + hex.EncodeToString(suffix)
+	qualified := quoteIdentifier(result.Keyspace) + "." + quoteIdentifier(result.Table)
+
+	columns := make([]string, spec.ValueColumns)
+	definitions := make([]string, spec.ValueColumns)
+	for i := range columns {
+		columns[i] = fmt.Sprintf("v%d", i)
+		definitions[i] = columns[i] + " text"
+	}
+	create := fmt.Sprintf("CREATE TABLE %s (pk uuid, ck int, %s, PRIMARY KEY (pk, ck))", qualified, strings.Join(definitions, ", "))
+
+	cleanup := func() {
+		var err error
+		if result.ScratchSpace {
+			err = dropScratchSpace(handle, session, result.Keyspace)
+		} else {
+			err = session.Query("DROP TABLE IF EXISTS " + qualified).Exec()
+		}
+		if err != nil {
+			result.CleanupError = err.Error()
+		}
+	}
+
+	if err := session.Query(create).Exec(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to create benchmark table: %v", err)
+	}
+	defer cleanup()
+	_ = session.GocqlSession().AwaitSchemaAgreement(ctx)
+
+	insert := fmt.Sprintf("INSERT INTO %s (pk, ck, %s) VALUES (?, ?%s)", qualified,
+		strings.Join(columns, ", "), strings.Repeat(", ?", spec.ValueColumns))
+	value := randomBenchValue(spec.ValueSize)
+
+	// RowsPerPartition consecutive requests share a partition key: a random
+	// prefix followed by the partition number
+	var keyPrefix [8]byte
+	_, _ = rand.Read(keyPrefix[:])
+	partitionKey := func(seq int) gocql.UUID {
+		var key gocql.UUID
+		copy(key[:8], keyPrefix[:])
+		binary.BigEndian.PutUint64(key[8:], uint64(seq/spec.RowsPerPartition)) // #nosec G115 - seq is non-negative
+		return key
+	}
+
+	runBenchmarks(ctx, handle, result, runs, opts, deadline, func(run benchRun, seq int) error {
+		values := make([]interface{}, 0, spec.ValueColumns+2)
+		values = append(values, partitionKey(seq), seq%spec.RowsPerPartition)
+		for range spec.ValueColumns {
+			values = append(values, value)
+		}
+		return session.Query(insert, values...).WithContext(ctx).Consistency(run.consistency).Exec()
+	})
+
+	describeBenchEnvironment(session, result)
+	if result.Replication == 1 {
+		result.Warnings = append(result.Warnings,
+			"the benchmark keyspace has one replica, so every consistency level waits for the same single node; pass keyspace with a keyspace replicated like production to compare levels")
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// describeBenchEnvironment records the server version, the coordinator's
+// datacenter and the keyspace's replication there, so that reports from
+// different clusters can be compared
+func describeBenchEnvironment(session *db.Session, result *BenchmarkResult) {
+	result.ServerVersion = session.CassandraVersion()
+	_ = session.Query("SELECT data_center FROM system.local").Scan(&result.Datacenter)
+	ks, err := session.KeyspaceMetadata(result.Keyspace)
+	if err != nil {
+		return
+	}
+	for dc, rf := range replicationByDatacenter(ks) {
+		if dc == result.Datacenter || dc == "*" {
+			_, _ = fmt.Sscan(rf, &result.Replication)
+		}
+	}
+}
+
+// sampleBenchKeys reads up to n distinct partition keys from random positions
+// of the token ring
+func sampleBenchKeys(ctx context.Context, session *db.Session, keyspace string, table *gocql.TableMetadata, n int) ([][]interface{}, error) {
+	partitionKey := make([]string, len(table.PartitionKey))
+	for i, col := range table.PartitionKey {
+		partitionKey[i] = quoteIdentifier(col.Name)
+	}
+	pkList := strings.Join(partitionKey, ", ")
+	query := fmt.Sprintf("SELECT DISTINCT %s FROM %s.%s WHERE token(%s) > ? LIMIT ?",
+		pkList, quoteIdentifier(keyspace), quoteIdentifier(table.Name), pkList)
+	perStart := (n + benchSampleStarts - 1) / benchSampleStarts
+
+	var keys [][]interface{}
+	seen := make(map[string]bool)
+	for i := 0; i < benchSampleStarts && len(keys) < n; i++ {
+		var start [8]byte
+		_, _ = rand.Read(start[:])
+		iter := session.Query(query, int64(binary.BigEndian.Uint64(start[:])), perStart).WithContext(ctx).Iter() // #nosec G115 - any token will do
+		for len(keys) < n {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			key := make([]interface{}, len(table.PartitionKey))
+			for j, col := range table.PartitionKey {
+				key[j] = row[col.Name]
+			}
+			if id := fmt.Sprint(key...); !seen[id] {
+				seen[id] = true
+				keys = append(keys, key)
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return nil, fmt.Errorf("failed to sample partition keys: %v", err)
+		}
+	}
+	return keys, nil
+}
+
+// benchmarkReads measures reads of partitions sampled from an existing table
+func benchmarkReads(ctx context.Context, handle int, session *db.Session, keyspace, tableName string, opts BenchmarkReadsOptions) (*BenchmarkResult, error) {
+	recordUsage(usageBenchmarks, 1)
+	start := time.Now()
+	runs, err := benchmarkPlan(&opts.BenchmarkOptions)
+	if err != nil {
+		return nil, err
+	}
+	deadline := benchmarkDeadline(opts.BenchmarkOptions)
+
+	if opts.SampleKeys <= 0 {
+		opts.SampleKeys = defaultBenchSampleKeys
+	}
+	opts.SampleKeys = min(opts.SampleKeys, maxBenchSampleKeys)
+	if opts.RowsPerRead <= 0 {
+		opts.RowsPerRead = defaultBenchRowsPerRead
+	}
+	opts.RowsPerRead = min(opts.RowsPerRead, maxBenchRowsPerRead)
+
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var partitioner string
+	_ = session.Query("SELECT partitioner FROM system.local").Scan(&partitioner)
+	if !strings.HasSuffix(partitioner, "Murmur3Partitioner") {
+		return nil, fmt.Errorf("key sampling requires the Murmur3 partitioner, cluster uses %s", partitioner)
+	}
+
+	keys, err := sampleBenchKeys(ctx, session, keyspace, table, opts.SampleKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("table %s.%s has no rows to read", keyspace, tableName)
+	}
+
+	result := &BenchmarkResult{
+		Keyspace:      keyspace,
+		Table:         tableName,
+		SampledKeys:   len(keys),
+		Runs:          []BenchmarkRun{},
+		RatePerSecond: opts.RatePerSecond,
+		Warnings:      []string{},
+	}
+	if len(keys) < opts.SampleKeys {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"only %d of %d partition keys could be sampled; reads repeat keys and may be served from cache", len(keys), opts.SampleKeys))
+	}
+
+	conditions := make([]string, len(table.PartitionKey))
+	for i, col := range table.PartitionKey {
+		conditions[i] = quoteIdentifier(col.Name) + " = ?"
+	}
+	query := fmt.Sprintf("SELECT * FROM %s.%s WHERE %s LIMIT %d",
+		quoteIdentifier(keyspace), quoteIdentifier(tableName), strings.Join(conditions, " AND "), opts.RowsPerRead)
+
+	runBenchmarks(ctx, handle, result, runs, opts.BenchmarkOptions, deadline, func(run benchRun, seq int) error {
+		key := keys[(seq%len(keys)+len(keys))%len(keys)] // Warm-up requests have a negative seq
+		scanner := session.Query(query, key...).WithContext(ctx).Consistency(run.consistency).Iter().Scanner()
+		for scanner.Next() {
+		}
+		return scanner.Err()
+	})
+
+	describeBenchEnvironment(session, result)
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Keyset pagination for table browsing.
+//
+// Unlike ExecuteQueryPaged, which keeps a live gocql iterator per query, keyset
+// pagination is stateless on the Go side. Each page is fetched with queries
+// generated from the table's primary key:
+//
+//	WHERE pk = ? AND ck1 = ? AND ck2 > ?   (remaining rows in the partition)
+//	WHERE pk = ? AND ck1 > ?
+//	WHERE token(pk) > token(?)             (following partitions)
+//
+// The position is returned to the caller as an opaque cursor holding the key
+// of the last row on the page plus the start positions of earlier pages, so a
+// cursor survives process restarts and can be used to step back a page. The
+// key values are kept serialized and bound to the queries, never spliced into
+// them, so a crafted cursor cannot change the statement.
+
+// BrowseTableOptions represents options for keyset-paginated table browsing
+type BrowseTableOptions struct {
+	Keyspace string   `json:"keyspace"`          // Keyspace name (defaults to current keyspace)
+	Table    string   `json:"table"`             // Table name (required)
+	Columns  []string `json:"columns,omitempty"` // Columns to select; primary key columns are always included
+	PageSize int      `json:"pageSize"`          // Rows per page (defaults to session page size, then 100)
+	Cursor   string   `json:"cursor,omitempty"`  // Cursor from a previous nextCursor/prevCursor; empty for first page
+
+	// IncludeTTL adds "ttl(col)" and "writetime(col)" fields to each row for
+	// the selected regular and static columns that support them
+	IncludeTTL bool `json:"includeTTL,omitempty"`
+
+	// Projections are paths into user type and collection columns
+	// (address.city, phones[0].number) returned as extra flattened columns
+	// named by the path (see projection.go)
+	Projections []string `json:"projections,omitempty"`
+}
+
+// BrowseTableResult represents a page of rows fetched by primary key
+type BrowseTableResult struct {
+	Columns     []string                 `json:"columns"`
+	ColumnTypes []string                 `json:"columnTypes"`
+	Rows        []map[string]interface{} `json:"rows"`
+	RowCount    int                      `json:"rowCount"`
+	HasMore     bool                     `json:"hasMore"`
+	PageNumber  int                      `json:"pageNumber"`           // 1-based position of this page
+	NextCursor  string                   `json:"nextCursor,omitempty"` // Cursor for the following page (empty when no more rows)
+	PrevCursor  string                   `json:"prevCursor,omitempty"` // Cursor for the preceding page (empty on the first page)
+	Keyspace    string                   `json:"keyspace"`
+	Table       string                   `json:"table"`
+	TTLColumns  []string                 `json:"ttlColumns,omitempty"`  // Columns with ttl()/writetime() fields in each row (includeTTL)
+	Projections []ColumnProjection       `json:"projections,omitempty"` // Projected columns, last in columns
+}
+
+// maxCursorHistory is how many earlier pages a cursor can step back to.
+// Older positions are dropped so the cursor stays small on long walks.
+const maxCursorHistory = 50
+
+// keysetCursor is the decoded form of a browse cursor
+type keysetCursor struct {
+	Keyspace string        `json:"ks"`
+	Table    string        `json:"t"`
+	After    []keysetKey   `json:"a,omitempty"` // Primary key of the last row seen; empty = start of table
+	History  [][]keysetKey `json:"h,omitempty"` // After positions of earlier pages, oldest first, at most maxCursorHistory
+	Page     int           `json:"p,omitempty"` // 1-based page the cursor leads to; 0 = len(History)+1
+}
+
+// keysetKey is one primary key column value of a cursor in the driver's
+// serialized form, bound to the keyset queries as it is
+type keysetKey struct {
+	Type  string `json:"t"` // CQL type of the column, to detect a changed table
+	Value []byte `json:"v"`
+}
+
+// MarshalCQL returns the serialized value
+func (k keysetKey) MarshalCQL(gocql.TypeInfo) ([]byte, error) {
+	return k.Value, nil
+}
+
+// pageNumber returns the 1-based page the cursor leads to
+func (c *keysetCursor) pageNumber() int {
+	if c.Page > 0 {
+		return c.Page
+	}
+	return len(c.History) + 1
+}
+
+// keyMatches reports whether key has the primary key columns of keyCols
+func keyMatches(key []keysetKey, keyCols []*gocql.ColumnMetadata) bool {
+	if len(key) != len(keyCols) {
+		return false
+	}
+	for i, col := range keyCols {
+		if key[i].Type != db.TypeInfoToString(col.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// encode serializes the cursor into an opaque URL-safe string
+func (c *keysetCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeKeysetCursor parses a cursor produced by encode
+func decodeKeysetCursor(s string) (*keysetCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor: %v", err)
+	}
+	var c keysetCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %v", err)
+	}
+	return &c, nil
+}
+
+// primaryKeyColumns returns the partition key followed by the clustering columns
+func primaryKeyColumns(table *gocql.TableMetadata) []*gocql.ColumnMetadata {
+	cols := make([]*gocql.ColumnMetadata, 0, len(table.PartitionKey)+len(table.ClusteringColumns))
+	cols = append(cols, table.PartitionKey...)
+	cols = append(cols, table.ClusteringColumns...)
+	return cols
+}
+
+// ttlColumns returns the columns ttl() and writetime() can be applied to:
+// regular and static columns that are not counters or non-frozen collections
+// and UDTs, whose cells each carry their own timestamp.
+func ttlColumns(table *gocql.TableMetadata, names []string) []string {
+	var cols []string
+	for _, name := range names {
+		col, ok := table.Columns[name]
+		if !ok || (col.Kind != gocql.ColumnRegular && col.Kind != gocql.ColumnStatic) {
+			continue
+		}
+		if col.Type.Type() == gocql.TypeCounter {
+			continue
+		}
+		if typ, err := db.ParseCQLType(col.Validator); err == nil {
+			switch typ.BaseType {
+			case "list", "set", "map", "udt":
+				if !typ.Frozen {
+					continue
+				}
+			}
+		} else {
+			switch col.Type.Type() {
+			case gocql.TypeList, gocql.TypeSet, gocql.TypeMap, gocql.TypeUDT:
+				continue
+			}
+		}
+		cols = append(cols, name)
+	}
+	return cols
+}
+
+// keysetQuery is a SELECT of buildKeysetQueries and the key values it binds
+type keysetQuery struct {
+	stmt   string
+	values []interface{}
+}
+
+// buildKeysetQueries returns the SELECT statements (without LIMIT) that, run in
+// order, yield the rows following the given key position in token/clustering order
+func buildKeysetQueries(table *gocql.TableMetadata, selectList string, after []keysetKey) []keysetQuery {
+	base := fmt.Sprintf("SELECT %s FROM %s.%s", selectList, quoteIdentifier(table.Keyspace), quoteIdentifier(table.Name))
+	if len(after) == 0 {
+		return []keysetQuery{{stmt: base}}
+	}
+
+	pkCount := len(table.PartitionKey)
+	pkConds := make([]string, 0, pkCount)
+	pkNames := make([]string, 0, pkCount)
+	pkValues := make([]interface{}, 0, pkCount)
+	for i, col := range table.PartitionKey {
+		pkConds = append(pkConds, quoteIdentifier(col.Name)+" = ?")
+		pkNames = append(pkNames, quoteIdentifier(col.Name))
+		pkValues = append(pkValues, after[i])
+	}
+
+	queries := make([]keysetQuery, 0, len(table.ClusteringColumns)+1)
+
+	// Remaining rows in the current partition, from the deepest clustering
+	// column outwards. Each column is compared in its own clustering order so
+	// mixed ASC/DESC tables page correctly.
+	for i := len(table.ClusteringColumns) - 1; i >= 0; i-- {
+		conds := append([]string{}, pkConds...)
+		values := append([]interface{}{}, pkValues...)
+		for j := 0; j < i; j++ {
+			ck := table.ClusteringColumns[j]
+			conds = append(conds, quoteIdentifier(ck.Name)+" = ?")
+			values = append(values, after[pkCount+j])
+		}
+		ck := table.ClusteringColumns[i]
+		op := ">"
+		if ck.Order == gocql.DESC {
+			op = "<"
+		}
+		conds = append(conds, fmt.Sprintf("%s %s ?", quoteIdentifier(ck.Name), op))
+		values = append(values, after[pkCount+i])
+		queries = append(queries, keysetQuery{stmt: base + " WHERE " + strings.Join(conds, " AND "), values: values})
+	}
+
+	// Following partitions in token order
+	markers := strings.TrimSuffix(strings.Repeat("?, ", pkCount), ", ")
+	queries = append(queries, keysetQuery{
+		stmt:   fmt.Sprintf("%s WHERE token(%s) > token(%s)", base, strings.Join(pkNames, ", "), markers),
+		values: pkValues,
+	})
+
+	return queries
+}
+
+// keyLiteral formats a primary key value as a CQL literal for the given column type
+func keyLiteral(val interface{}, typ gocql.Type) (string, error) {
+	if val == nil {
+		return "", fmt.Errorf("primary key value is null")
+	}
+
+	switch typ {
+	case gocql.TypeAscii, gocql.TypeText, gocql.TypeVarchar:
+		return "'" + escapeString(fmt.Sprintf("%v", val)) + "'", nil
+	case gocql.TypeInet:
+		return "'" + fmt.Sprintf("%v", val) + "'", nil
+	case gocql.TypeBigInt, gocql.TypeInt, gocql.TypeSmallInt, gocql.TypeTinyInt,
+		gocql.TypeCounter, gocql.TypeVarint, gocql.TypeDecimal:
+		return fmt.Sprint(val), nil
+	case gocql.TypeFloat, gocql.TypeDouble:
+		var f float64
+		bits := 64
+		switch v := val.(type) {
+		case float32:
+			f, bits = float64(v), 32
+		case float64:
+			f = v
+		default:
+			return "", fmt.Errorf("unexpected %T for floating point key", val)
+		}
+		switch {
+		case math.IsNaN(f):
+			return "NaN", nil
+		case math.IsInf(f, 1):
+			return "Infinity", nil
+		case math.IsInf(f, -1):
+			return "-Infinity", nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, bits), nil
+	case gocql.TypeBoolean:
+		return fmt.Sprintf("%v", val), nil
+	case gocql.TypeUUID, gocql.TypeTimeUUID:
+		if u, ok := val.(gocql.UUID); ok {
+			return u.String(), nil
+		}
+		return fmt.Sprintf("%v", val), nil
+	case gocql.TypeTimestamp:
+		if t, ok := val.(time.Time); ok {
+			return strconv.FormatInt(t.UnixMilli(), 10), nil
+		}
+	case gocql.TypeDate:
+		if t, ok := val.(time.Time); ok {
+			return "'" + t.UTC().Format("2006-01-02") + "'", nil
+		}
+	case gocql.TypeTime:
+		if d, ok := val.(time.Duration); ok {
+			return strconv.FormatInt(int64(d), 10), nil
+		}
+	case gocql.TypeBlob:
+		if b, ok := val.([]byte); ok {
+			return fmt.Sprintf("0x%x", b), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported primary key type %s for keyset pagination", db.TypeToString(typ))
+}
+
+// rowKey extracts the primary key of a row for a cursor
+func rowKey(row map[string]interface{}, keyCols []*gocql.ColumnMetadata) ([]keysetKey, error) {
+	key := make([]keysetKey, 0, len(keyCols))
+	for _, col := range keyCols {
+		val := row[col.Name]
+		if val == nil {
+			return nil, fmt.Errorf("column %s: primary key value is null", col.Name)
+		}
+		data, err := gocql.Marshal(col.Type, val)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", col.Name, err)
+		}
+		key = append(key, keysetKey{Type: db.TypeInfoToString(col.Type), Value: data})
+	}
+	return key, nil
+}
+
+// browseTable fetches one page of rows by primary key position
+func browseTable(session *db.Session, opts BrowseTableOptions) (*BrowseTableResult, error) {
+	table, err := session.GetTableMetadata(opts.Keyspace, opts.Table)
+	if err != nil {
+		return nil, err
+	}
+	keyCols := primaryKeyColumns(table)
+	projections, err := planProjections(session, table, opts.Projections)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := &keysetCursor{Keyspace: opts.Keyspace, Table: opts.Table}
+	if opts.Cursor != "" {
+		cursor, err = decodeKeysetCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Keyspace != opts.Keyspace || cursor.Table != opts.Table {
+			return nil, fmt.Errorf("cursor belongs to %s.%s, not %s.%s", cursor.Keyspace, cursor.Table, opts.Keyspace, opts.Table)
+		}
+		if len(cursor.After) != 0 && !keyMatches(cursor.After, keyCols) {
+			return nil, fmt.Errorf("cursor does not match the primary key of %s.%s; the table may have changed", opts.Keyspace, opts.Table)
+		}
+	}
+
+	// Build the select list, making sure every primary key column is present
+	selectList := "*"
+	var ttlCols []string
+	helperCols := make(map[string]bool) // Selected only for a client-side projection
+	if len(opts.Columns) > 0 || opts.IncludeTTL || len(projections) > 0 {
+		names := opts.Columns
+		if len(names) == 0 {
+			names = table.OrderedColumns
+		}
+		cols := make([]string, 0, len(names)+len(keyCols))
+		seen := make(map[string]bool)
+		for _, col := range names {
+			seen[col] = true
+			cols = append(cols, quoteIdentifier(col))
+		}
+		for _, col := range keyCols {
+			if !seen[col.Name] {
+				seen[col.Name] = true
+				cols = append(cols, quoteIdentifier(col.Name))
+			}
+		}
+		for _, p := range projections {
+			switch {
+			case p.ServerSide:
+				cols = append(cols, p.selector())
+			case !seen[p.path.Column]:
+				seen[p.path.Column] = true
+				helperCols[p.path.Column] = true
+				cols = append(cols, quoteIdentifier(p.path.Column))
+			}
+		}
+
+		// Alias the functions to the names Cassandra gives them so the
+		// fields are the same whatever the column's case
+		if opts.IncludeTTL {
+			ttlCols = ttlColumns(table, names)
+			for _, col := range ttlCols {
+				cols = append(cols,
+					fmt.Sprintf("ttl(%s) AS %s", quoteIdentifier(col), quoteIdentifier("ttl("+col+")")),
+					fmt.Sprintf("writetime(%s) AS %s", quoteIdentifier(col), quoteIdentifier("writetime("+col+")")))
+			}
+		}
+		selectList = strings.Join(cols, ", ")
+	}
+
+	// Fetch one extra row to detect whether another page exists
+	limit := opts.PageSize + 1
+	rows := make([]map[string]interface{}, 0, limit)
+	var columns []gocql.ColumnInfo
+
+	for _, query := range buildKeysetQueries(table, selectList, cursor.After) {
+		remaining := limit - len(rows)
+		if remaining <= 0 {
+			break
+		}
+
+		iter := session.Query(fmt.Sprintf("%s LIMIT %d", query.stmt, remaining), query.values...).Iter()
+		if columns == nil {
+			columns = iter.Columns()
+		}
+		for {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			rows = append(rows, row)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, fmt.Errorf("query failed: %v", err)
+		}
+	}
+
+	hasMore := len(rows) > opts.PageSize
+	if hasMore {
+		rows = rows[:opts.PageSize]
+	}
+	for _, row := range rows {
+		for _, p := range projections {
+			if !p.ServerSide {
+				p.extract(row)
+			}
+		}
+		for col := range helperCols {
+			delete(row, col)
+			for i := 0; ; i++ { // A tuple's elements
+				name := gocql.TupleColumnName(col, i)
+				if _, ok := row[name]; !ok {
+					break
+				}
+				delete(row, name)
+			}
+		}
+	}
+
+	result := &BrowseTableResult{
+		Columns:     make([]string, 0, len(columns)),
+		ColumnTypes: make([]string, 0, len(columns)),
+		Rows:        rows,
+		RowCount:    len(rows),
+		HasMore:     hasMore,
+		PageNumber:  cursor.pageNumber(),
+		Keyspace:    opts.Keyspace,
+		Table:       opts.Table,
+		TTLColumns:  ttlCols,
+	}
+	skipFields := make(map[string]bool, 2*len(ttlCols)+len(projections)+len(helperCols))
+	for _, col := range ttlCols {
+		skipFields["ttl("+col+")"] = true
+		skipFields["writetime("+col+")"] = true
+	}
+	for _, p := range projections {
+		skipFields[p.Path] = true
+	}
+	for col := range helperCols {
+		skipFields[col] = true
+	}
+	for _, col := range columns {
+		if skipFields[col.Name] {
+			continue
+		}
+		result.Columns = append(result.Columns, col.Name)
+		result.ColumnTypes = append(result.ColumnTypes, db.TypeInfoToString(col.TypeInfo))
+	}
+	for _, p := range projections {
+		result.Columns = append(result.Columns, p.Path)
+		result.ColumnTypes = append(result.ColumnTypes, p.Type)
+		result.Projections = append(result.Projections, p.ColumnProjection)
+	}
+
+	if hasMore {
+		lastKey, err := rowKey(rows[len(rows)-1], keyCols)
+		if err != nil {
+			return nil, err
+		}
+		history := make([][]keysetKey, 0, len(cursor.History)+1)
+		history = append(history, cursor.History...)
+		history = append(history, cursor.After)
+		if len(history) > maxCursorHistory {
+			history = history[len(history)-maxCursorHistory:]
+		}
+		next := &keysetCursor{Keyspace: opts.Keyspace, Table: opts.Table, After: lastKey, History: history, Page: result.PageNumber + 1}
+		result.NextCursor = next.encode()
+	}
+
+	// Only the last maxCursorHistory pages can be stepped back to
+	if n := len(cursor.History); n > 0 {
+		prev := &keysetCursor{Keyspace: opts.Keyspace, Table: opts.Table, After: cursor.History[n-1], History: cursor.History[:n-1], Page: result.PageNumber - 1}
+		result.PrevCursor = prev.encode()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// keyColumn is primary key metadata for a column of type typ
+func keyColumn(name string, typ gocql.Type, order gocql.ColumnOrder) *gocql.ColumnMetadata {
+	return &gocql.ColumnMetadata{Name: name, Type: gocql.NewNativeType(4, typ, ""), Order: order}
+}
+
+// keysOf stands in for a cursor position with one key value per name
+func keysOf(names ...string) []keysetKey {
+	key := make([]keysetKey, len(names))
+	for i, name := range names {
+		key[i] = keysetKey{Type: "text", Value: []byte(name)}
+	}
+	return key
+}
+
+func TestBuildKeysetQueries(t *testing.T) {
+	text := gocql.TypeText
+	tests := []struct {
+		name   string
+		table  *gocql.TableMetadata
+		after  []keysetKey
+		want   []string
+		values [][]string // Key values bound to each query
+	}{
+		{
+			name:  "start of table",
+			table: &gocql.TableMetadata{Keyspace: "app", Name: "t", PartitionKey: []*gocql.ColumnMetadata{keyColumn("id", text, gocql.ASC)}},
+			want:  []string{"SELECT * FROM app.t"},
+		},
+		{
+			name:   "partition key only",
+			table:  &gocql.TableMetadata{Keyspace: "app", Name: "t", PartitionKey: []*gocql.ColumnMetadata{keyColumn("id", text, gocql.ASC)}},
+			after:  keysOf("a"),
+			want:   []string{"SELECT * FROM app.t WHERE token(id) > token(?)"},
+			values: [][]string{{"a"}},
+		},
+		{
+			name: "composite partition key",
+			table: &gocql.TableMetadata{Keyspace: "app", Name: "t",
+				PartitionKey:      []*gocql.ColumnMetadata{keyColumn("tenant", text, gocql.ASC), keyColumn("Day", text, gocql.ASC)},
+				ClusteringColumns: []*gocql.ColumnMetadata{keyColumn("seq", text, gocql.ASC)},
+			},
+			after: keysOf("a", "b", "c"),
+			want: []string{
+				`SELECT * FROM app.t WHERE tenant = ? AND "Day" = ? AND seq > ?`,
+				`SELECT * FROM app.t WHERE token(tenant, "Day") > token(?, ?)`,
+			},
+			values: [][]string{{"a", "b", "c"}, {"a", "b"}},
+		},
+		{
+			name: "mixed clustering order",
+			table: &gocql.TableMetadata{Keyspace: "app", Name: "events",
+				PartitionKey: []*gocql.ColumnMetadata{keyColumn("id", text, gocql.ASC)},
+				ClusteringColumns: []*gocql.ColumnMetadata{
+					keyColumn("day", text, gocql.ASC),
+					keyColumn("ts", text, gocql.DESC),
+					keyColumn("seq", text, gocql.ASC),
+				},
+			},
+			after: keysOf("a", "b", "c", "d"),
+			want: []string{
+				"SELECT * FROM app.events WHERE id = ? AND day = ? AND ts = ? AND seq > ?",
+				"SELECT * FROM app.events WHERE id = ? AND day = ? AND ts < ?",
+				"SELECT * FROM app.events WHERE id = ? AND day > ?",
+				"SELECT * FROM app.events WHERE token(id) > token(?)",
+			},
+			values: [][]string{{"a", "b", "c", "d"}, {"a", "b", "c"}, {"a", "b"}, {"a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries := buildKeysetQueries(tt.table, "*", tt.after)
+			if len(queries) != len(tt.want) {
+				t.Fatalf("got %d queries, want %d", len(queries), len(tt.want))
+			}
+			for i, q := range queries {
+				if q.stmt != tt.want[i] {
+					t.Errorf("query %d = %q, want %q", i, q.stmt, tt.want[i])
+				}
+				if n := strings.Count(q.stmt, "?"); n != len(q.values) {
+					t.Errorf("query %d has %d markers and %d values", i, n, len(q.values))
+				}
+				var values []string
+				for _, v := range q.values {
+					values = append(values, string(v.(keysetKey).Value))
+				}
+				var want []string
+				if tt.values != nil {
+					want = tt.values[i]
+				}
+				if !reflect.DeepEqual(values, want) {
+					t.Errorf("query %d binds %q, want %q", i, values, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeysetCursorKeepsKeyOutOfStatement(t *testing.T) {
+	table := &gocql.TableMetadata{Keyspace: "app", Name: "t",
+		PartitionKey: []*gocql.ColumnMetadata{keyColumn("id", gocql.TypeText, gocql.ASC)},
+	}
+	keyCols := primaryKeyColumns(table)
+	injected := "x') OR token(id) > token('"
+	after, err := rowKey(map[string]interface{}{"id": injected}, keyCols)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key survives the cursor and is only ever bound
+	cursor, err := decodeKeysetCursor((&keysetCursor{Keyspace: "app", Table: "t", After: after}).encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keyMatches(cursor.After, keyCols) {
+		t.Fatalf("decoded key %+v does not match the table", cursor.After)
+	}
+	for _, q := range buildKeysetQueries(table, "*", cursor.After) {
+		if strings.Contains(q.stmt, "OR") {
+			t.Errorf("key spliced into %q", q.stmt)
+		}
+		data, err := gocql.Marshal(keyCols[0].Type, q.values[0])
+		if err != nil || string(data) != injected {
+			t.Errorf("bound %q, %v; want %q", data, err, injected)
+		}
+	}
+
+	// A key from a table whose key changed type is refused
+	changed := []*gocql.ColumnMetadata{keyColumn("id", gocql.TypeInt, gocql.ASC)}
+	if keyMatches(cursor.After, changed) || keyMatches(cursor.After, nil) {
+		t.Error("cursor key accepted for a different primary key")
+	}
+	if _, err := rowKey(map[string]interface{}{}, keyCols); err == nil {
+		t.Error("null key value accepted")
+	}
+}
+
+func TestKeysetCursorPageNumber(t *testing.T) {
+	history := make([][]keysetKey, maxCursorHistory)
+	if n := (&keysetCursor{History: history[:3]}).pageNumber(); n != 4 {
+		t.Errorf("page %d without a page number, want 4", n)
+	}
+	if n := (&keysetCursor{History: history, Page: 120}).pageNumber(); n != 120 {
+		t.Errorf("page %d with a trimmed history, want 120", n)
+	}
+}
+
+func TestKeyLiteral(t *testing.T) {
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	uuid, err := gocql.ParseUUID("5b6962dd-3f90-4c93-8f61-eabfa4a803e2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		val  interface{}
+		typ  gocql.Type
+		want string
+	}{
+		{"o'brien", gocql.TypeText, "'o''brien'"},
+		{"abc", gocql.TypeAscii, "'abc'"},
+		{int64(-42), gocql.TypeBigInt, "-42"},
+		{int16(7), gocql.TypeSmallInt, "7"},
+		{big.NewInt(1 << 62), gocql.TypeVarint, "4611686018427387904"},
+		{float32(1.5), gocql.TypeFloat, "1.5"},
+		{0.1, gocql.TypeDouble, "0.1"},
+		{math.NaN(), gocql.TypeDouble, "NaN"},
+		{math.Inf(-1), gocql.TypeDouble, "-Infinity"},
+		{true, gocql.TypeBoolean, "true"},
+		{uuid, gocql.TypeUUID, "5b6962dd-3f90-4c93-8f61-eabfa4a803e2"},
+		{ts, gocql.TypeTimestamp, "1709294400000"},
+		{ts, gocql.TypeDate, "'2024-03-01'"},
+		{90 * time.Second, gocql.TypeTime, "90000000000"},
+		{[]byte{0xca, 0xfe}, gocql.TypeBlob, "0xcafe"},
+	}
+	for _, tt := range tests {
+		got, err := keyLiteral(tt.val, tt.typ)
+		if err != nil || got != tt.want {
+			t.Errorf("keyLiteral(%v, %v) = %q, %v; want %q", tt.val, tt.typ, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range []struct {
+		val interface{}
+		typ gocql.Type
+	}{
+		{nil, gocql.TypeText},
+		{"1.5", gocql.TypeDouble},
+		{"2024-03-01", gocql.TypeTimestamp},
+		{[]int{1}, gocql.TypeList},
+	} {
+		if got, err := keyLiteral(bad.val, bad.typ); err == nil {
+			t.Errorf("keyLiteral(%v, %v) = %q, want an error", bad.val, bad.typ, got)
+		}
+	}
+}
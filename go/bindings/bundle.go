@@ -0,0 +1,407 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Connection bundles for self-managed clusters.
+//
+// A connection bundle is a zip holding a cqlshrc plus the files it refers to:
+// CA and client certificates, the client key and optionally a cqlsh
+// credentials file. Paths inside the cqlshrc are usually those of the machine
+// that produced the bundle, so each one is resolved to the extracted copy by
+// relative path first and then by file name.
+
+// bundleMarker is written to every extracted bundle so cleanup only ever
+// removes directories this library created
+const bundleMarker = ".cqlai-bundle"
+
+// certExpiryWarning is how close to expiry a bundled certificate is reported
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// ConnectionBundleOptions represents options for parsing a connection bundle
+type ConnectionBundleOptions struct {
+	BundlePath string `json:"bundlePath"`
+	ExtractDir string `json:"extractDir"` // Optional, uses managed storage if empty
+}
+
+// ConnectionBundleInfo is a parsed connection bundle
+type ConnectionBundleInfo struct {
+	BundlePath   string `json:"bundlePath"`
+	ExtractedDir string `json:"extractedDir"`
+	CqlshrcPath  string `json:"cqlshrcPath"`
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	Keyspace     string `json:"keyspace,omitempty"`
+	Username     string `json:"username,omitempty"`
+	HasPassword  bool   `json:"hasPassword"`
+	CACertPath   string `json:"caCertPath,omitempty"`
+	CertPath     string `json:"certPath,omitempty"`
+	KeyPath      string `json:"keyPath,omitempty"`
+	SSLValidate  bool   `json:"sslValidate"`
+	CertExpires  string `json:"certExpires,omitempty"` // Earliest expiry among the bundled certificates
+
+	// Options that can be passed to CreateSession as they are
+	SessionOptions map[string]interface{} `json:"sessionOptions"`
+	Warnings       []string               `json:"warnings,omitempty"`
+}
+
+// bundleStorageDir returns the managed extraction directory for a bundle. The
+// directory is keyed by the bundle's content so re-parsing an updated bundle
+// never mixes old and new files.
+func bundleStorageDir(bundlePath string) (string, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	name := strings.TrimSuffix(filepath.Base(bundlePath), filepath.Ext(bundlePath))
+	return filepath.Join(base, "cqlai", "connection-bundles", name+"-"+hex.EncodeToString(h.Sum(nil))[:12]), nil
+}
+
+// ExtractConnectionBundle extracts a connection bundle, validates the files its
+// cqlshrc refers to and returns ready-to-use session options
+func ExtractConnectionBundle(bundlePath, extractDir string) (*ConnectionBundleInfo, error) {
+	if _, err := os.Stat(bundlePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("bundle file not found: %s", bundlePath)
+	}
+	r, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid zip file: %v", err)
+	}
+	r.Close()
+
+	if extractDir == "" {
+		dir, err := bundleStorageDir(bundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %v", err)
+		}
+		extractDir = dir
+	}
+
+	// Start from an empty directory and keep credentials private to the user.
+	// A previous extraction is replaced; any other non-empty directory is refused.
+	if entries, err := os.ReadDir(extractDir); err == nil && len(entries) > 0 {
+		if err := RemoveConnectionBundle(extractDir); err != nil {
+			return nil, fmt.Errorf("extractDir %s is not empty", extractDir)
+		}
+	}
+	if err := os.MkdirAll(extractDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(extractDir, bundleMarker), []byte(bundlePath), 0600); err != nil {
+		return nil, err
+	}
+	if err := extractZip(bundlePath, extractDir); err != nil {
+		RemoveConnectionBundle(extractDir)
+		return nil, fmt.Errorf("failed to extract bundle: %v", err)
+	}
+	if err := restrictBundlePermissions(extractDir); err != nil {
+		RemoveConnectionBundle(extractDir)
+		return nil, err
+	}
+
+	info, err := parseExtractedBundle(extractDir)
+	if err != nil {
+		RemoveConnectionBundle(extractDir)
+		return nil, err
+	}
+	info.BundlePath = bundlePath
+	return info, nil
+}
+
+// parseExtractedBundle reads the cqlshrc of an extracted bundle
+func parseExtractedBundle(dir string) (*ConnectionBundleInfo, error) {
+	cqlshrcPath, err := findBundleCqlshrc(dir)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseCqlshrc(cqlshrcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filepath.Base(cqlshrcPath), err)
+	}
+
+	info := &ConnectionBundleInfo{
+		ExtractedDir: dir,
+		CqlshrcPath:  cqlshrcPath,
+		Host:         config.Connection.Hostname,
+		Port:         config.Connection.Port,
+		Keyspace:     config.Authentication.Keyspace,
+		Username:     config.Authentication.Username,
+		SSLValidate:  config.SSL.Validate,
+	}
+	if info.Host == "" {
+		info.Host = "127.0.0.1"
+		info.Warnings = append(info.Warnings, "cqlshrc has no [connection] hostname; using 127.0.0.1")
+	}
+	password := config.Authentication.Password
+
+	// A credentials file takes the place of username/password in the cqlshrc
+	if ref := config.Authentication.Credentials; ref != "" {
+		path, ok := resolveBundlePath(dir, ref)
+		if !ok {
+			return nil, fmt.Errorf("credentials file %s referenced by cqlshrc is not in the bundle", ref)
+		}
+		user, pass, err := parseCredentialsFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials file: %v", err)
+		}
+		if user != "" {
+			info.Username = user
+		}
+		if pass != "" {
+			password = pass
+		}
+	}
+	if info.Username != "" && password == "" {
+		info.Warnings = append(info.Warnings, "bundle has a username but no password; the password must be supplied when connecting")
+	}
+	info.HasPassword = password != ""
+
+	// Certificates and key
+	refs := []struct {
+		ref  string
+		dest *string
+		name string
+	}{
+		{config.SSL.CAFile, &info.CACertPath, "CA certificate"},
+		{config.SSL.Certfile, &info.CertPath, "client certificate"},
+		{config.SSL.Keyfile, &info.KeyPath, "client key"},
+	}
+	for _, r := range refs {
+		if r.ref == "" {
+			continue
+		}
+		path, ok := resolveBundlePath(dir, r.ref)
+		if !ok {
+			return nil, fmt.Errorf("%s %s referenced by cqlshrc is not in the bundle", r.name, r.ref)
+		}
+		*r.dest = path
+	}
+	if config.SSL.UserKeyStore != "" {
+		info.Warnings = append(info.Warnings, "Java keystores (userkeystore) are not supported; use PEM usercert and userkey files")
+	}
+
+	expires, err := validateBundleCerts(info)
+	if err != nil {
+		return nil, err
+	}
+	if !expires.IsZero() {
+		info.CertExpires = expires.UTC().Format(time.RFC3339)
+		switch {
+		case time.Now().After(expires):
+			info.Warnings = append(info.Warnings, "a bundled certificate expired on "+expires.UTC().Format("2006-01-02"))
+		case time.Until(expires) < certExpiryWarning:
+			info.Warnings = append(info.Warnings, "a bundled certificate expires on "+expires.UTC().Format("2006-01-02"))
+		}
+	}
+
+	info.SessionOptions = map[string]interface{}{
+		"host": info.Host,
+		"port": info.Port,
+	}
+	if info.Keyspace != "" {
+		info.SessionOptions["keyspace"] = info.Keyspace
+	}
+	if info.Username != "" {
+		info.SessionOptions["username"] = info.Username
+	}
+	if password != "" {
+		info.SessionOptions["password"] = password
+	}
+	if config.Connection.Timeout > 0 {
+		info.SessionOptions["connectTimeout"] = config.Connection.Timeout
+	}
+	if info.CACertPath != "" || info.CertPath != "" {
+		info.SessionOptions["sslCaFile"] = info.CACertPath
+		info.SessionOptions["sslCertfile"] = info.CertPath
+		info.SessionOptions["sslKeyfile"] = info.KeyPath
+		info.SessionOptions["sslValidate"] = info.SSLValidate
+	}
+	return info, nil
+}
+
+// findBundleCqlshrc locates the single cqlshrc in an extracted bundle
+func findBundleCqlshrc(dir string) (string, error) {
+	var found []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := strings.ToLower(d.Name())
+		if name == "cqlshrc" || strings.HasSuffix(name, ".cqlshrc") || name == "cqlshrc.ini" {
+			found = append(found, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("cqlshrc not found in bundle")
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("bundle contains %d cqlshrc files; expected one", len(found))
+}
+
+// resolveBundlePath maps a path from the cqlshrc to the extracted file: first
+// relative to the bundle root, then by file name anywhere in the bundle
+func resolveBundlePath(dir, ref string) (string, bool) {
+	ref = strings.TrimPrefix(ref, "~/")
+	if !filepath.IsAbs(ref) {
+		candidate := filepath.Join(dir, ref)
+		if strings.HasPrefix(candidate, filepath.Clean(dir)+string(os.PathSeparator)) {
+			if st, err := os.Stat(candidate); err == nil && !st.IsDir() {
+				return candidate, true
+			}
+		}
+	}
+
+	base := filepath.Base(ref)
+	var match string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || match != "" {
+			return err
+		}
+		if !d.IsDir() && d.Name() == base {
+			match = path
+		}
+		return nil
+	})
+	return match, match != ""
+}
+
+// parseCredentialsFile reads a cqlsh credentials file:
+//
+//	[PlainTextAuthProvider]
+//	username = ...
+//	password = ...
+func parseCredentialsFile(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	var username, password, section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.Trim(line, "[]"))
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || section != "plaintextauthprovider" {
+			continue
+		}
+		switch strings.TrimSpace(strings.ToLower(parts[0])) {
+		case "username":
+			username = strings.TrimSpace(parts[1])
+		case "password":
+			password = strings.TrimSpace(parts[1])
+		}
+	}
+	return username, password, scanner.Err()
+}
+
+// validateBundleCerts checks that the bundled PEM files load and returns the
+// earliest certificate expiry
+func validateBundleCerts(info *ConnectionBundleInfo) (time.Time, error) {
+	var earliest time.Time
+	note := func(cert *x509.Certificate) {
+		if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+
+	if info.CACertPath != "" {
+		data, err := os.ReadFile(info.CACertPath)
+		if err != nil {
+			return earliest, err
+		}
+		count := 0
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return earliest, fmt.Errorf("CA certificate %s: %v", filepath.Base(info.CACertPath), err)
+			}
+			note(cert)
+			count++
+		}
+		if count == 0 {
+			return earliest, fmt.Errorf("CA certificate %s contains no PEM certificates", filepath.Base(info.CACertPath))
+		}
+	}
+
+	switch {
+	case info.CertPath != "" && info.KeyPath != "":
+		pair, err := tls.LoadX509KeyPair(info.CertPath, info.KeyPath)
+		if err != nil {
+			return earliest, fmt.Errorf("client certificate and key do not load: %v", err)
+		}
+		if cert, err := x509.ParseCertificate(pair.Certificate[0]); err == nil {
+			note(cert)
+		}
+	case info.CertPath != "":
+		return earliest, fmt.Errorf("cqlshrc sets usercert but no userkey")
+	case info.KeyPath != "":
+		return earliest, fmt.Errorf("cqlshrc sets userkey but no usercert")
+	}
+	return earliest, nil
+}
+
+// restrictBundlePermissions makes the extracted files readable only by the user
+func restrictBundlePermissions(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.Chmod(path, 0700)
+		}
+		return os.Chmod(path, 0600)
+	})
+}
+
+// RemoveConnectionBundle removes an extracted connection bundle. Directories
+// without the marker written at extraction are left alone.
+func RemoveConnectionBundle(extractedDir string) error {
+	if extractedDir == "" {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(extractedDir, bundleMarker)); err != nil {
+		return fmt.Errorf("%s is not an extracted connection bundle", extractedDir)
+	}
+	return os.RemoveAll(extractedDir)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cancellation tokens
+//
+// Long-running calls (connection tests, multi-statement execution, source
+// execution, partition scans) take a cancelToken in their options: any string
+// the caller picks, or one issued by NewCancelToken. Cancel(token) stops the
+// call whichever export started it, by cancelling the context the call runs
+// under. Paged query IDs are tokens too, so Cancel(queryId) closes the query.
+//
+// A token cancelled before its call starts is remembered for a short while,
+// so the host does not have to wait for the call to register before it can
+// cancel it.
+
+// earlyCancelTTL is how long a cancel for a token not in use yet is kept
+const earlyCancelTTL = time.Minute
+
+// errCancelTokenInUse is returned when a call reuses the token of a running call
+var errCancelTokenInUse = errors.New("cancelToken is already in use by a running call")
+
+// cancellable is a running call that can be cancelled by token
+type cancellable struct {
+	handle int    // Session handle, 0 for calls without a session
+	kind   string // e.g. "connection", "sourceFiles", "multiQuery", "findPartitions"
+	cancel context.CancelFunc
+}
+
+// CancelResult reports what Cancel stopped
+type CancelResult struct {
+	Cancelled bool   `json:"cancelled"`
+	Kind      string `json:"kind,omitempty"`   // Kind of call that was cancelled, or "pagedQuery"
+	Reason    string `json:"reason,omitempty"` // Why nothing was cancelled
+}
+
+// Running calls by token
+var (
+	cancellables     = make(map[string]*cancellable)
+	cancelledEarly   = make(map[string]time.Time) // Tokens cancelled before their call started
+	cancellablesLock sync.Mutex
+	nextCancelToken  int64
+)
+
+// newCancelToken issues a token no other call uses
+func newCancelToken() string {
+	cancellablesLock.Lock()
+	defer cancellablesLock.Unlock()
+	nextCancelToken++
+	return "cancel-" + strconv.FormatInt(nextCancelToken, 10)
+}
+
+// startCancellable returns the context a call runs under. The call is
+// registered under token, or under a token of its own when token is empty so
+// it can still be cancelled per handle; the returned function unregisters it
+// and must be called when the call ends.
+func startCancellable(token string, handle int, kind string) (context.Context, func(), error) {
+	if token == "" {
+		token = newCancelToken()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &cancellable{handle: handle, kind: kind, cancel: cancel}
+
+	cancellablesLock.Lock()
+	if _, exists := cancellables[token]; exists {
+		cancellablesLock.Unlock()
+		cancel()
+		return nil, nil, errCancelTokenInUse
+	}
+	cancellables[token] = entry
+	if _, early := cancelledEarly[token]; early {
+		delete(cancelledEarly, token)
+		cancel()
+	}
+	cancellablesLock.Unlock()
+
+	return ctx, func() {
+		cancellablesLock.Lock()
+		if cancellables[token] == entry {
+			delete(cancellables, token)
+		}
+		cancellablesLock.Unlock()
+		cancel()
+	}, nil
+}
+
+// cancelByToken cancels the call or paged query using token. A token nothing
+// uses yet is remembered, and the call that starts with it within
+// earlyCancelTTL is cancelled right away.
+func cancelByToken(token string) CancelResult {
+	cancellablesLock.Lock()
+	entry := cancellables[token]
+	if entry != nil {
+		delete(cancellables, token)
+	}
+	cancellablesLock.Unlock()
+	if entry != nil {
+		entry.cancel()
+		return CancelResult{Cancelled: true, Kind: entry.kind}
+	}
+
+	pagedQueriesMutex.Lock()
+	state := pagedQueries[token]
+	if state != nil {
+		delete(pagedQueries, token)
+	}
+	pagedQueriesMutex.Unlock()
+	if state != nil {
+		state.close()
+		return CancelResult{Cancelled: true, Kind: "pagedQuery"}
+	}
+
+	now := time.Now()
+	cancellablesLock.Lock()
+	for early, at := range cancelledEarly {
+		if now.Sub(at) > earlyCancelTTL {
+			delete(cancelledEarly, early)
+		}
+	}
+	cancelledEarly[token] = now
+	cancellablesLock.Unlock()
+	return CancelResult{Reason: "No running call uses this token"}
+}
+
+// cancelHandleCalls cancels the calls of a handle, only those of the given
+// kinds when any are given, and returns how many there were
+func cancelHandleCalls(handle int, kinds ...string) int {
+	cancellablesLock.Lock()
+	var cancelled []*cancellable
+	for token, entry := range cancellables {
+		if entry.handle != handle || (len(kinds) > 0 && !slices.Contains(kinds, entry.kind)) {
+			continue
+		}
+		cancelled = append(cancelled, entry)
+		delete(cancellables, token)
+	}
+	cancellablesLock.Unlock()
+
+	for _, entry := range cancelled {
+		entry.cancel()
+	}
+	return len(cancelled)
+}
+
+// discardCancellables cancels the calls still running when the session is closed
+func discardCancellables(handle int) {
+	cancelHandleCalls(handle)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/cdc"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// CDC log browsing
+//
+// Cassandra copies the commit log segments holding writes to tables with
+// cdc=true into its cdc_raw directory. BrowseCDC reads those segments from a
+// directory this process can see (a local node, a mounted volume or a copy)
+// and decodes them with the schema of the connected cluster, which must be
+// the cluster that wrote them: mutations only carry table ids.
+
+// Limits on the changes returned per BrowseCDC call
+const (
+	defaultCDCLimit = 100
+	maxCDCLimit     = 1000
+)
+
+// defaultCDCDirectories are the usual cdc_raw locations of package and
+// tarball installs, tried when the node does not report its setting
+var defaultCDCDirectories = []string{
+	"/var/lib/cassandra/cdc_raw",
+	"/var/lib/cassandra/data/cdc_raw",
+}
+
+// BrowseCDCOptions represents options for reading the CDC log
+type BrowseCDCOptions struct {
+	Directory string `json:"directory"` // cdc_raw directory; located from the node's settings when empty
+	Keyspace  string `json:"keyspace"`  // Only changes to this keyspace
+	Table     string `json:"table"`     // Only changes to this table (requires keyspace)
+	Limit     int    `json:"limit"`     // Changes per call (default 100, max 1000)
+	Cursor    string `json:"cursor"`    // nextCursor of a previous call
+}
+
+// CDCEntryError reports a mutation that could not be (fully) decoded
+type CDCEntryError struct {
+	Segment  string `json:"segment"`
+	Position int64  `json:"position"`
+	Error    string `json:"error"`
+}
+
+// BrowseCDCResult represents changes read from the CDC log
+type BrowseCDCResult struct {
+	Directory  string            `json:"directory"`
+	CDCTables  []string          `json:"cdcTables"` // keyspace.table of the tables with cdc=true
+	Segments   []cdc.SegmentInfo `json:"segments"`
+	Changes    []cdc.Change      `json:"changes"`
+	Errors     []CDCEntryError   `json:"errors,omitempty"`
+	NextCursor string            `json:"nextCursor,omitempty"` // Set when there are more changes to read
+}
+
+// cdcCursor is the position after the last mutation returned
+type cdcCursor struct {
+	segment  int64
+	position int64
+}
+
+func (c cdcCursor) String() string {
+	return strconv.FormatInt(c.segment, 10) + ":" + strconv.FormatInt(c.position, 10)
+}
+
+func parseCDCCursor(s string) (cdcCursor, error) {
+	seg, pos, ok := strings.Cut(s, ":")
+	if ok {
+		segment, err1 := strconv.ParseInt(seg, 10, 64)
+		position, err2 := strconv.ParseInt(pos, 10, 64)
+		if err1 == nil && err2 == nil {
+			return cdcCursor{segment: segment, position: position}, nil
+		}
+	}
+	return cdcCursor{}, fmt.Errorf("malformed cursor %q", s)
+}
+
+// errCDCDirectoryNotFound is returned when no cdc_raw directory can be read
+var errCDCDirectoryNotFound = errors.New("CDC directory not found")
+
+// locateCDCDirectory returns dir when given, otherwise the node's
+// cdc_raw_directory setting (Cassandra 4.0+) or a default location, if this
+// process can read it
+func locateCDCDirectory(session *db.Session, dir string) (string, error) {
+	if dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("%w: %s is not a readable directory", errCDCDirectoryNotFound, dir)
+		}
+		return dir, nil
+	}
+
+	var candidates []string
+	if session.SupportsVirtualTables() {
+		var setting string
+		if err := session.Query("SELECT value FROM system_views.settings WHERE name = 'cdc_raw_directory'").Scan(&setting); err == nil && setting != "" {
+			candidates = append(candidates, setting)
+		}
+	}
+	if home := os.Getenv("CASSANDRA_HOME"); home != "" {
+		candidates = append(candidates, filepath.Join(home, "data", "cdc_raw"))
+	}
+	candidates = append(candidates, defaultCDCDirectories...)
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%w; tried %s. Pass directory with a path to the node's cdc_raw_directory that this machine can read",
+		errCDCDirectoryNotFound, strings.Join(candidates, ", "))
+}
+
+// cdcSchema resolves table ids against system_schema, loading the columns of
+// a table the first time one of its mutations is seen
+type cdcSchema struct {
+	session *db.Session
+	ids     map[gocql.UUID][2]string // keyspace, table
+	cdc     []string
+	tables  map[gocql.UUID]*cdc.Table
+}
+
+func loadCDCSchema(session *db.Session) (*cdcSchema, error) {
+	s := &cdcSchema{
+		session: session,
+		ids:     make(map[gocql.UUID][2]string),
+		tables:  make(map[gocql.UUID]*cdc.Table),
+		cdc:     []string{},
+	}
+
+	var keyspace, table string
+	var id gocql.UUID
+	var enabled bool
+	iter := session.Query("SELECT keyspace_name, table_name, id, cdc FROM system_schema.tables").Iter()
+	for iter.Scan(&keyspace, &table, &id, &enabled) {
+		s.ids[id] = [2]string{keyspace, table}
+		if enabled {
+			s.cdc = append(s.cdc, keyspace+"."+table)
+		}
+	}
+	if err := iter.Close(); err == nil {
+		return s, nil
+	}
+
+	// The cdc column was added in 3.8
+	iter = session.Query("SELECT keyspace_name, table_name, id FROM system_schema.tables").Iter()
+	for iter.Scan(&keyspace, &table, &id) {
+		s.ids[id] = [2]string{keyspace, table}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to read table ids: %v", err)
+	}
+	return s, nil
+}
+
+// table implements cdc.TableResolver
+func (s *cdcSchema) table(id gocql.UUID) (*cdc.Table, error) {
+	if t, ok := s.tables[id]; ok {
+		return t, nil
+	}
+	name, ok := s.ids[id]
+	if !ok {
+		s.tables[id] = nil
+		return nil, nil
+	}
+
+	t := &cdc.Table{Keyspace: name[0], Name: name[1], Columns: make(map[string]*db.CQLTypeInfo)}
+	var partitionKey, clustering []cdc.Column
+	var partitionPos, clusteringPos []int
+
+	var column, kind, typ string
+	var position int
+	iter := s.session.Query("SELECT column_name, kind, position, type FROM system_schema.columns WHERE keyspace_name = ? AND table_name = ?", name[0], name[1]).Iter()
+	for iter.Scan(&column, &kind, &position, &typ) {
+		parsed, err := db.ParseCQLType(typ)
+		if err != nil {
+			parsed = nil // Decoded as hex
+		}
+		switch kind {
+		case "partition_key":
+			partitionKey = append(partitionKey, cdc.Column{Name: column, Type: parsed})
+			partitionPos = append(partitionPos, position)
+		case "clustering":
+			clustering = append(clustering, cdc.Column{Name: column, Type: parsed})
+			clusteringPos = append(clusteringPos, position)
+		default:
+			t.Columns[column] = parsed
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s.%s: %v", name[0], name[1], err)
+	}
+
+	t.PartitionKey = orderCDCColumns(partitionKey, partitionPos)
+	t.Clustering = orderCDCColumns(clustering, clusteringPos)
+	s.tables[id] = t
+	return t, nil
+}
+
+// orderCDCColumns places key columns at their schema positions
+func orderCDCColumns(columns []cdc.Column, positions []int) []cdc.Column {
+	ordered := make([]cdc.Column, len(columns))
+	for i, col := range columns {
+		if pos := positions[i]; pos >= 0 && pos < len(ordered) {
+			ordered[pos] = col
+		} else {
+			ordered[i] = col
+		}
+	}
+	return ordered
+}
+
+// browseCDC reads changes from the CDC log, starting after opts.Cursor
+func browseCDC(session *db.Session, opts BrowseCDCOptions) (*BrowseCDCResult, error) {
+	dir, err := locateCDCDirectory(session, opts.Directory)
+	if err != nil {
+		return nil, err
+	}
+	var after *cdcCursor
+	if opts.Cursor != "" {
+		c, err := parseCDCCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &c
+	}
+
+	schema, err := loadCDCSchema(session)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := cdc.ListSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BrowseCDCResult{
+		Directory: dir,
+		CDCTables: schema.cdc,
+		Segments:  segments,
+		Changes:   []cdc.Change{},
+	}
+	decoder := &cdc.Decoder{
+		Tables: schema.table,
+		Values: db.NewBinaryDecoder(session.GetUDTRegistry()),
+		UDTs:   session.GetUDTRegistry(),
+	}
+
+	for i := range result.Segments {
+		seg := &result.Segments[i]
+		if after != nil && seg.ID < after.segment {
+			continue
+		}
+		if result.NextCursor != "" {
+			break
+		}
+
+		err := cdc.ReadSegment(filepath.Join(dir, seg.File), seg.Offset, func(entry cdc.Entry) bool {
+			if after != nil && seg.ID == after.segment && entry.Position <= after.position {
+				return true
+			}
+			if len(result.Changes) >= opts.Limit {
+				result.NextCursor = cdcCursor{segment: seg.ID, position: entry.Position - 1}.String()
+				return false
+			}
+
+			changes, err := decoder.Decode(entry.Data)
+			if err != nil {
+				result.Errors = append(result.Errors, CDCEntryError{Segment: seg.File, Position: entry.Position, Error: err.Error()})
+			}
+			for _, change := range changes {
+				if (opts.Keyspace != "" && change.Keyspace != opts.Keyspace) || (opts.Table != "" && change.Table != opts.Table) {
+					continue
+				}
+				change.Segment = seg.File
+				change.Position = entry.Position
+				result.Changes = append(result.Changes, change)
+				seg.Changes++
+			}
+			return true
+		})
+		if err != nil {
+			seg.Error = err.Error()
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Row-level data comparison between two tables, e.g. a migration source and target.
+//
+// Rows are sampled from the source table by reading short runs of rows from
+// random points on the token ring (or from the start of the table when the
+// partitioner is not Murmur3). Each sampled row is then looked up by primary
+// key in the target table and its values are compared column by column.
+
+// Defaults and limits for CompareTables
+const (
+	defaultCompareSampleSize    = 1000
+	maxCompareSampleSize        = 100000
+	defaultCompareMaxMismatches = 100
+	compareTokenSegments        = 16
+)
+
+// CompareSampleSpec controls how rows are sampled and compared
+type CompareSampleSpec struct {
+	SampleSize           int      `json:"sampleSize"`           // Rows sampled from the source table (default 1000)
+	Columns              []string `json:"columns,omitempty"`    // Columns to compare (default: all non-key columns present in both tables)
+	TimestampToleranceMs int64    `json:"timestampToleranceMs"` // Allowed difference for timestamp values
+	FloatTolerance       float64  `json:"floatTolerance"`       // Allowed absolute difference for float, double and decimal values
+	MaxMismatches        int      `json:"maxMismatches"`        // Mismatched rows reported in detail (default 100)
+}
+
+// ColumnDiff is a single differing column value
+type ColumnDiff struct {
+	Column string      `json:"column"`
+	Source interface{} `json:"source"`
+	Target interface{} `json:"target"`
+}
+
+// RowMismatch describes a sampled row that differs between the tables
+type RowMismatch struct {
+	Key     map[string]interface{} `json:"key"`
+	Missing bool                   `json:"missing,omitempty"` // Row does not exist in the target table
+	Diffs   []ColumnDiff           `json:"diffs,omitempty"`
+}
+
+// CompareTablesResult is the mismatch report of CompareTables
+type CompareTablesResult struct {
+	Source           string         `json:"source"` // keyspace.table
+	Target           string         `json:"target"`
+	Sampling         string         `json:"sampling"` // "token-ranges" or "sequential"
+	Columns          []string       `json:"columns"`
+	Sampled          int            `json:"sampled"`
+	Matched          int            `json:"matched"`
+	Mismatched       int            `json:"mismatched"`      // Rows present in both tables with different values
+	MissingInTarget  int            `json:"missingInTarget"` // Rows not found in the target table
+	ColumnMismatches map[string]int `json:"columnMismatches,omitempty"`
+	Mismatches       []RowMismatch  `json:"mismatches"`
+	Truncated        bool           `json:"truncated,omitempty"` // More mismatches than maxMismatches were found
+	DurationMs       int64          `json:"durationMs"`
+}
+
+// splitTableName splits "keyspace.table" (either part may be double-quoted);
+// a bare table name uses defaultKeyspace
+func splitTableName(name, defaultKeyspace string) (keyspace, table string) {
+	inQuotes := false
+	for i, c := range name {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '.' && !inQuotes:
+			return unquoteTablePart(name[:i]), unquoteTablePart(name[i+1:])
+		}
+	}
+	return defaultKeyspace, unquoteTablePart(name)
+}
+
+// unquoteTablePart returns a quoted name as written and an unquoted one lowercased
+func unquoteTablePart(part string) string {
+	part = strings.TrimSpace(part)
+	if len(part) >= 2 && strings.HasPrefix(part, `"`) && strings.HasSuffix(part, `"`) {
+		return strings.ReplaceAll(part[1:len(part)-1], `""`, `"`)
+	}
+	return strings.ToLower(part)
+}
+
+// compareTables samples rows from source and diffs them against target
+func compareTables(source *db.Session, sourceKs, sourceTable string, target *db.Session, targetKs, targetTable string, spec CompareSampleSpec) (*CompareTablesResult, error) {
+	start := time.Now()
+
+	if spec.SampleSize <= 0 {
+		spec.SampleSize = defaultCompareSampleSize
+	}
+	if spec.SampleSize > maxCompareSampleSize {
+		return nil, fmt.Errorf("sampleSize cannot exceed %d", maxCompareSampleSize)
+	}
+	if spec.MaxMismatches <= 0 {
+		spec.MaxMismatches = defaultCompareMaxMismatches
+	}
+
+	srcMeta, err := source.GetTableMetadata(sourceKs, sourceTable)
+	if err != nil {
+		return nil, err
+	}
+	dstMeta, err := target.GetTableMetadata(targetKs, targetTable)
+	if err != nil {
+		return nil, err
+	}
+
+	keyCols := primaryKeyColumns(srcMeta)
+	dstKeyCols := primaryKeyColumns(dstMeta)
+	if len(keyCols) != len(dstKeyCols) {
+		return nil, fmt.Errorf("primary keys differ: %s.%s has %d key columns, %s.%s has %d", sourceKs, sourceTable, len(keyCols), targetKs, targetTable, len(dstKeyCols))
+	}
+	keyNames := make([]string, len(keyCols))
+	for i, col := range keyCols {
+		if col.Name != dstKeyCols[i].Name {
+			return nil, fmt.Errorf("primary keys differ: key column %d is %s in the source and %s in the target", i+1, col.Name, dstKeyCols[i].Name)
+		}
+		keyNames[i] = col.Name
+	}
+
+	columns, err := compareColumns(srcMeta, dstMeta, spec.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CompareTablesResult{
+		Source:     sourceKs + "." + sourceTable,
+		Target:     targetKs + "." + targetTable,
+		Columns:    columns,
+		Mismatches: []RowMismatch{},
+	}
+
+	selectCols := make([]string, 0, len(keyNames)+len(columns))
+	for _, name := range append(append([]string{}, keyNames...), columns...) {
+		selectCols = append(selectCols, quoteIdentifier(name))
+	}
+	selectList := strings.Join(selectCols, ", ")
+
+	rows, sampling, err := sampleRows(source, srcMeta, selectList, spec.SampleSize)
+	if err != nil {
+		return nil, err
+	}
+	result.Sampling = sampling
+	result.Sampled = len(rows)
+
+	// Look each sampled row up by primary key in the target
+	where := make([]string, len(keyNames))
+	for i, name := range keyNames {
+		where[i] = quoteIdentifier(name) + " = ?"
+	}
+	lookup := fmt.Sprintf("SELECT %s FROM %s.%s WHERE %s", selectList,
+		quoteIdentifier(targetKs), quoteIdentifier(targetTable), strings.Join(where, " AND "))
+
+	for _, row := range rows {
+		key := make(map[string]interface{}, len(keyNames))
+		values := make([]interface{}, len(keyNames))
+		for i, name := range keyNames {
+			key[name] = row[name]
+			values[i] = row[name]
+		}
+
+		other := make(map[string]interface{})
+		err := target.Query(lookup, values...).MapScan(other)
+		if err == gocql.ErrNotFound {
+			result.MissingInTarget++
+			result.addMismatch(RowMismatch{Key: key, Missing: true}, spec.MaxMismatches)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("lookup in %s failed: %v", result.Target, err)
+		}
+
+		var diffs []ColumnDiff
+		for _, col := range columns {
+			if !valuesMatch(row[col], other[col], spec) {
+				diffs = append(diffs, ColumnDiff{Column: col, Source: row[col], Target: other[col]})
+				if result.ColumnMismatches == nil {
+					result.ColumnMismatches = make(map[string]int)
+				}
+				result.ColumnMismatches[col]++
+			}
+		}
+		if len(diffs) == 0 {
+			result.Matched++
+			continue
+		}
+		result.Mismatched++
+		result.addMismatch(RowMismatch{Key: key, Diffs: diffs}, spec.MaxMismatches)
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// addMismatch records a mismatch in detail until the limit is reached
+func (r *CompareTablesResult) addMismatch(m RowMismatch, limit int) {
+	if len(r.Mismatches) >= limit {
+		r.Truncated = true
+		return
+	}
+	r.Mismatches = append(r.Mismatches, m)
+}
+
+// compareColumns returns the non-key columns to compare. Requested columns must
+// exist in both tables; by default every non-key column the tables share is used.
+func compareColumns(src, dst *gocql.TableMetadata, requested []string) ([]string, error) {
+	isKey := make(map[string]bool)
+	for _, col := range primaryKeyColumns(src) {
+		isKey[col.Name] = true
+	}
+
+	if len(requested) > 0 {
+		var columns []string
+		for _, name := range requested {
+			if _, ok := src.Columns[name]; !ok {
+				return nil, fmt.Errorf("column %s not found in %s.%s", name, src.Keyspace, src.Name)
+			}
+			if _, ok := dst.Columns[name]; !ok {
+				return nil, fmt.Errorf("column %s not found in %s.%s", name, dst.Keyspace, dst.Name)
+			}
+			if !isKey[name] {
+				columns = append(columns, name)
+			}
+		}
+		return columns, nil
+	}
+
+	var columns []string
+	for name := range src.Columns {
+		if _, ok := dst.Columns[name]; ok && !isKey[name] {
+			columns = append(columns, name)
+		}
+	}
+	sort.Strings(columns)
+	return columns, nil
+}
+
+// sampleRows reads up to size rows from the table. With the Murmur3
+// partitioner the rows come from runs starting at random tokens, so the sample
+// spreads across the ring instead of covering only its first partitions.
+func sampleRows(session *db.Session, table *gocql.TableMetadata, selectList string, size int) ([]map[string]interface{}, string, error) {
+	base := fmt.Sprintf("SELECT %s FROM %s.%s", selectList, quoteIdentifier(table.Keyspace), quoteIdentifier(table.Name))
+	keyCols := primaryKeyColumns(table)
+
+	var partitioner string
+	_ = session.Query("SELECT partitioner FROM system.local").Scan(&partitioner)
+
+	seen := make(map[string]bool)
+	rows := make([]map[string]interface{}, 0, size)
+	collect := func(query string, limit int, values ...interface{}) error {
+		iter := session.Query(fmt.Sprintf("%s LIMIT %d", query, limit), values...).Iter()
+		for {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			key := make([]interface{}, len(keyCols))
+			for i, col := range keyCols {
+				key[i] = row[col.Name]
+			}
+			id := fmt.Sprint(key...)
+			if seen[id] || len(rows) >= size {
+				continue
+			}
+			seen[id] = true
+			rows = append(rows, row)
+		}
+		return iter.Close()
+	}
+
+	if !strings.HasSuffix(partitioner, "Murmur3Partitioner") {
+		if err := collect(base, size); err != nil {
+			return nil, "", err
+		}
+		return rows, "sequential", nil
+	}
+
+	partitionKey := make([]string, len(table.PartitionKey))
+	for i, col := range table.PartitionKey {
+		partitionKey[i] = quoteIdentifier(col.Name)
+	}
+	tokenQuery := fmt.Sprintf("%s WHERE token(%s) >= ?", base, strings.Join(partitionKey, ", "))
+
+	segments := min(compareTokenSegments, size)
+	perSegment := (size + segments - 1) / segments
+	for i := 0; i < segments && len(rows) < size; i++ {
+		startToken := int64(rand.Uint64())
+		if err := collect(tokenQuery, perSegment, startToken); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Runs near the end of the ring can come back short; top up from the start
+	if len(rows) < size {
+		if err := collect(base, size); err != nil {
+			return nil, "", err
+		}
+	}
+	return rows, "token-ranges", nil
+}
+
+// valuesMatch compares two column values, allowing the configured tolerance
+// for timestamps and floating point numbers
+func valuesMatch(a, b interface{}, spec CompareSampleSpec) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		if !ok {
+			return false
+		}
+		diff := ta.Sub(tb)
+		if diff < 0 {
+			diff = -diff
+		}
+		return diff <= time.Duration(spec.TimestampToleranceMs)*time.Millisecond
+	}
+
+	fa, okA := floatValue(a)
+	fb, okB := floatValue(b)
+	if okA && okB && reflect.TypeOf(a) == reflect.TypeOf(b) {
+		return math.Abs(fa-fb) <= spec.FloatTolerance
+	}
+	return false
+}
+
+// floatValue converts float, double and decimal values for tolerant comparison.
+// Decimals (*inf.Dec) are converted through their string form.
+func floatValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case fmt.Stringer:
+		if reflect.ValueOf(n).Kind() == reflect.Pointer && reflect.ValueOf(n).IsNil() {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
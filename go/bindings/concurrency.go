@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Thread-safety model
+//
+// The Node host may call into the library for the same session handle from
+// several worker threads at once. Each exported function runs on its own
+// goroutine, so the bindings layer guarantees the following:
+//
+//   - Session settings (consistency, page size, tracing, expand, auto-fetch)
+//     are guarded inside db.Session and may be changed while queries execute.
+//     A query snapshots the settings when it is built.
+//   - Operations that use the underlying gocql session (queries, COPY, source
+//     files, metadata and DDL) hold the handle's shared lock and may run
+//     concurrently with each other.
+//   - Operations that replace the underlying gocql session (SetKeyspace) or
+//     temporarily change settings on behalf of a single query (the Astra
+//     tracing workaround) hold the handle's exclusive lock and wait for
+//     in-flight operations on that handle to finish. Scripts keep the shared
+//     lock throughout: USE and settings directives apply to the script's own
+//     statements, not the session (exec_context.go).
+//   - Bulk operations (COPY, source files, partition scans, table
+//     comparisons) wait for a slot from the process-wide scheduler in
+//     scheduler.go before taking the handle lock, so a queued operation never
+//     holds up SetKeyspace.
+//   - Paged query iterators are not safe for concurrent use; each paged query
+//     has its own mutex so concurrent FetchNextPage calls on the same query ID
+//     are serialized.
+//
+// Cancellation entry points (CancelQuery, CancelPagedQuery,
+// StopSourceExecution) never take the handle lock so they cannot be blocked by
+// the operation they are cancelling.
+
+// handleState holds the per-handle lock and counters for work running on the handle
+type handleState struct {
+	lock             sync.RWMutex
+	activeOperations atomic.Int64 // Exported calls currently holding the handle lock
+	workerGoroutines atomic.Int64 // Helper goroutines started by those calls (e.g. COPY FROM workers)
+}
+
+// Per-handle state, created with the session and removed when it is closed
+var (
+	handleStates      = make(map[int]*handleState)
+	handleStatesMutex sync.Mutex
+)
+
+// createHandleState allocates the state for a newly registered session handle
+func createHandleState(handle int) {
+	handleStatesMutex.Lock()
+	defer handleStatesMutex.Unlock()
+	handleStates[handle] = &handleState{}
+}
+
+// deleteHandleState releases the state for a closed session handle
+func deleteHandleState(handle int) {
+	handleStatesMutex.Lock()
+	defer handleStatesMutex.Unlock()
+	delete(handleStates, handle)
+}
+
+// getHandleState returns the state for a session handle, or nil if unknown
+func getHandleState(handle int) *handleState {
+	handleStatesMutex.Lock()
+	defer handleStatesMutex.Unlock()
+	return handleStates[handle]
+}
+
+// lockHandleShared acquires the shared lock for operations that use the
+// session concurrently with others. The returned function releases it.
+func lockHandleShared(handle int) func() {
+	state := getHandleState(handle)
+	if state == nil {
+		return func() {}
+	}
+	state.lock.RLock()
+	state.activeOperations.Add(1)
+	return func() {
+		state.activeOperations.Add(-1)
+		state.lock.RUnlock()
+	}
+}
+
+// lockHandleExclusive acquires the exclusive lock for operations that must not
+// overlap any other operation on the same handle. The returned function
+// releases it.
+func lockHandleExclusive(handle int) func() {
+	state := getHandleState(handle)
+	if state == nil {
+		return func() {}
+	}
+	state.lock.Lock()
+	state.activeOperations.Add(1)
+	return func() {
+		state.activeOperations.Add(-1)
+		state.lock.Unlock()
+	}
+}
+
+// trackHandleWorkers records helper goroutines started on behalf of a handle.
+// Call with a positive count when starting them and the negative count when
+// they have all exited.
+func trackHandleWorkers(handle int, delta int) {
+	if state := getHandleState(handle); state != nil {
+		state.workerGoroutines.Add(int64(delta))
+	}
+}
@@ -0,0 +1,244 @@
+//go:build race
+
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Stress tests for concurrent calls on one session handle, run with
+// go test -race ./bindings. The sessions have no cluster: paged queries read
+// a fake iterator, and SetKeyspace, which needs a node to replace the driver
+// session, is stood in for by the exclusive lock it takes.
+
+// stressHandle registers a session without a cluster under a handle of its
+// own, removed when the test ends
+func stressHandle(t *testing.T, n int) (int, *db.Session) {
+	t.Helper()
+	h := 1<<21 + n
+	session := &db.Session{}
+	sessionMutex.Lock()
+	sessions[h] = session
+	sessionMutex.Unlock()
+	createHandleState(h)
+	t.Cleanup(func() { removeSession(h) })
+	return h, session
+}
+
+// stressIterator is a paged query iterator that records how it was used.
+// rows is deliberately unguarded, so the race detector reports reads that
+// the paged query's mutex does not serialize.
+type stressIterator struct {
+	rows  int
+	check func() // Called on each read, with the handle lock held by the reader
+
+	reading    atomic.Int32
+	closes     atomic.Int32
+	concurrent atomic.Int32 // Reads that overlapped another read
+	afterClose atomic.Int32 // Reads after Close
+}
+
+// Next reads a row, standing in for the db.RowScanner over the iterator
+func (it *stressIterator) Next() (map[string]interface{}, bool) {
+	if it.reading.Add(1) != 1 {
+		it.concurrent.Add(1)
+	}
+	defer it.reading.Add(-1)
+	if it.closes.Load() > 0 {
+		it.afterClose.Add(1)
+	}
+	if it.check != nil {
+		it.check()
+	}
+	if it.rows == 0 {
+		return nil, false
+	}
+	it.rows--
+	return map[string]interface{}{"n": it.rows}, true
+}
+
+func (it *stressIterator) MapScan(map[string]interface{}) bool { return false }
+
+func (it *stressIterator) Close() error {
+	it.closes.Add(1)
+	return nil
+}
+
+// registerStressQuery registers a paged query over it, as ExecuteQuery does
+// for a SELECT with more than a page of rows
+func registerStressQuery(h int, session *db.Session, it *stressIterator) string {
+	qID := generateQueryID(h)
+	pagedQueriesMutex.Lock()
+	pagedQueries[qID] = &pagedQueryState{
+		Session:     session,
+		Iterator:    it,
+		ColumnNames: []string{"n"},
+		ColumnTypes: []string{"int"},
+		PageSize:    7,
+		Rows:        it,
+	}
+	pagedQueriesMutex.Unlock()
+	return qID
+}
+
+// stressResponse decodes a response without failing the test, for goroutines
+func stressResponse(raw string) (success bool, code string) {
+	var resp struct {
+		Success bool   `json:"success"`
+		Code    string `json:"code"`
+	}
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		return false, "INVALID_RESPONSE"
+	}
+	return resp.Success, resp.Code
+}
+
+func TestStressFetchAndCancelPagedQuery(t *testing.T) {
+	h, session := stressHandle(t, 1)
+
+	for i := 0; i < 200; i++ {
+		// Some queries run out while being fetched, the others are cancelled.
+		// Every other cancel waits until a fetch is reading the iterator.
+		reading := make(chan struct{})
+		var once sync.Once
+		it := &stressIterator{rows: i % 40, check: func() {
+			once.Do(func() {
+				close(reading)
+				time.Sleep(50 * time.Microsecond)
+			})
+		}}
+		qID := registerStressQuery(h, session, it)
+
+		var wg sync.WaitGroup
+		for f := 0; f < 4; f++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 3; j++ {
+					if ok, code := stressResponse(callHandle(FetchNextPage, h, qID)); !ok && code != "QUERY_NOT_FOUND" {
+						t.Errorf("FetchNextPage failed with %s", code)
+					}
+				}
+			}()
+		}
+		wg.Add(1)
+		go func(wait bool) {
+			defer wg.Done()
+			if wait {
+				<-reading
+			}
+			if ok, code := stressResponse(callHandle(CancelPagedQuery, h, qID)); !ok {
+				t.Errorf("CancelPagedQuery failed with %s", code)
+			}
+		}(i%2 == 0)
+		wg.Wait()
+
+		if n := it.closes.Load(); n != 1 {
+			t.Fatalf("query %d: iterator closed %d times, want once", i, n)
+		}
+		if it.concurrent.Load() != 0 || it.afterClose.Load() != 0 {
+			t.Fatalf("query %d: %d overlapping reads, %d reads after close", i, it.concurrent.Load(), it.afterClose.Load())
+		}
+		pagedQueriesMutex.Lock()
+		_, leaked := pagedQueries[qID]
+		pagedQueriesMutex.Unlock()
+		if leaked {
+			t.Fatalf("query %d is still registered", i)
+		}
+	}
+}
+
+func TestStressExclusiveLockExcludesSharedOperations(t *testing.T) {
+	h, session := stressHandle(t, 2)
+	state := getHandleState(h)
+	if err := session.SetConsistency("ONE"); err != nil {
+		t.Fatal(err)
+	}
+
+	var exclusive atomic.Bool
+	var underExclusive, settingLeaks atomic.Int32
+	it := &stressIterator{rows: 1 << 30, check: func() {
+		if exclusive.Load() {
+			underExclusive.Add(1)
+		}
+		// A script's CONSISTENCY applies only to the script
+		if session.Consistency() != "ONE" {
+			settingLeaks.Add(1)
+		}
+	}}
+	qID := registerStressQuery(h, session, it)
+	t.Cleanup(func() { callHandle(CancelPagedQuery, h, qID) })
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	run := func(op func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					op()
+				}
+			}
+		}()
+	}
+
+	// Shared operations: fetching pages, and scripts, whose CONSISTENCY
+	// directive applies only to their own statements
+	for i := 0; i < 3; i++ {
+		run(func() {
+			if ok, code := stressResponse(callHandle(FetchNextPage, h, qID)); !ok {
+				t.Errorf("FetchNextPage failed with %s", code)
+			}
+		})
+	}
+	run(func() {
+		raw := callHandleOptions(ExecuteMultiQuery, h, "CONSISTENCY QUORUM;", "{}")
+		if ok, code := stressResponse(raw); !ok {
+			t.Errorf("ExecuteMultiQuery failed with %s", code)
+		}
+	})
+
+	// SetKeyspace holds the exclusive lock while it replaces the session
+	var exclusiveRuns, overlaps int
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		unlock := lockHandleExclusive(h)
+		exclusive.Store(true)
+		if n := state.activeOperations.Load(); n != 1 {
+			overlaps++
+		}
+		time.Sleep(100 * time.Microsecond)
+		exclusive.Store(false)
+		unlock()
+		exclusiveRuns++
+		time.Sleep(100 * time.Microsecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	if overlaps > 0 || underExclusive.Load() > 0 {
+		t.Errorf("exclusive lock held alongside %d shared operations and %d page reads", overlaps, underExclusive.Load())
+	}
+	if settingLeaks.Load() > 0 {
+		t.Errorf("%d page reads saw a script's consistency", settingLeaks.Load())
+	}
+	if n := state.activeOperations.Load(); n != 0 {
+		t.Errorf("%d operations still counted after the calls returned", n)
+	}
+	if session.Consistency() != "ONE" {
+		t.Errorf("consistency %s after the scripts, want ONE", session.Consistency())
+	}
+	if exclusiveRuns == 0 || it.concurrent.Load() != 0 {
+		t.Errorf("%d exclusive runs, %d overlapping reads", exclusiveRuns, it.concurrent.Load())
+	}
+}
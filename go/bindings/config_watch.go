@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Config watching
+//
+// A session can watch the JSON config file it was created from. When the file
+// changes, the reloadable settings are applied to the session (see
+// db.Session.ApplyConfig) and a CONFIG_RELOADED event is queued for the
+// caller to collect with PollConfigEvents.
+
+// maxConfigEvents bounds the events kept per session; older ones are dropped
+const maxConfigEvents = 100
+
+// ConfigWatchOptions configures config watching for a session
+type ConfigWatchOptions struct {
+	Enabled    *bool `json:"enabled,omitempty"`    // false stops watching (default true)
+	IntervalMs int   `json:"intervalMs,omitempty"` // How often to check the file (default 2000)
+}
+
+// ConfigReloadEvent reports a reload of the config file
+type ConfigReloadEvent struct {
+	Type  string `json:"type"` // CONFIG_RELOADED
+	Path  string `json:"path"`
+	Time  string `json:"time"`
+	Error string `json:"error,omitempty"` // Set when the file could not be loaded; nothing was applied
+	db.ConfigReload
+}
+
+// configWatch is the watcher and undelivered events of one session
+type configWatch struct {
+	watcher *config.Watcher
+	events  []ConfigReloadEvent
+}
+
+// Config watchers per session handle
+var (
+	configWatches     = make(map[int]*configWatch)
+	configWatchesLock sync.Mutex
+)
+
+// startConfigWatch replaces the session's watcher with a new one, keeping
+// undelivered events
+func startConfigWatch(handle int, session *db.Session, interval time.Duration) (*config.Watcher, error) {
+	watcher, err := config.WatchConfig(session.ConfigFile(), interval, func(cfg *config.Config, changed []string, err error) {
+		applyConfigReload(handle, session, cfg, changed, err)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	configWatchesLock.Lock()
+	previous := configWatches[handle]
+	watch := &configWatch{watcher: watcher}
+	if previous != nil {
+		watch.events = previous.events
+	}
+	configWatches[handle] = watch
+	configWatchesLock.Unlock()
+
+	if previous != nil {
+		previous.watcher.Stop()
+	}
+	return watcher, nil
+}
+
+// applyConfigReload runs on the watcher goroutine. It takes no handle lock:
+// ApplyConfig only changes settings guarded inside the session, and timeouts
+// wait there for the next SetKeyspace or ReconnectSession.
+func applyConfigReload(handle int, session *db.Session, cfg *config.Config, changed []string, err error) {
+	if getSession(handle) != session {
+		return
+	}
+
+	event := ConfigReloadEvent{
+		Type: "CONFIG_RELOADED",
+		Path: config.FindConfigFile(session.ConfigFile()),
+		Time: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.ConfigReload = session.ApplyConfig(cfg, changed)
+	}
+
+	configWatchesLock.Lock()
+	defer configWatchesLock.Unlock()
+	watch := configWatches[handle]
+	if watch == nil {
+		return
+	}
+	watch.events = append(watch.events, event)
+	if len(watch.events) > maxConfigEvents {
+		watch.events = watch.events[len(watch.events)-maxConfigEvents:]
+	}
+}
+
+// takeConfigEvents returns and clears the session's undelivered events
+func takeConfigEvents(handle int) []ConfigReloadEvent {
+	configWatchesLock.Lock()
+	defer configWatchesLock.Unlock()
+	watch := configWatches[handle]
+	if watch == nil || len(watch.events) == 0 {
+		return []ConfigReloadEvent{}
+	}
+	events := watch.events
+	watch.events = nil
+	return events
+}
+
+// stopConfigWatch stops the session's watcher, if any, and drops its events
+func stopConfigWatch(handle int) {
+	configWatchesLock.Lock()
+	watch := configWatches[handle]
+	delete(configWatches, handle)
+	configWatchesLock.Unlock()
+
+	if watch != nil {
+		watch.watcher.Stop()
+	}
+}
+
+// discardConfigWatch stops watching when the session is closed. It is called
+// with sessionMutex held, which a reload in progress may be waiting for, so
+// the watcher is stopped without waiting for it.
+func discardConfigWatch(handle int) {
+	configWatchesLock.Lock()
+	watch := configWatches[handle]
+	delete(configWatches, handle)
+	configWatchesLock.Unlock()
+
+	if watch != nil {
+		go watch.watcher.Stop()
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Connection test phases
+//
+// TestConnectionWithID runs a connection test as a sequence of phases, each
+// with its own timeout, and reports how long each one took, so that a slow
+// connection can be traced to the step it spends its time in. The TCP
+// connect and TLS handshake are made on a probe connection to the first
+// contact point, closed before the driver opens its own; the auth phase is
+// the driver's session setup, protocol negotiation and authentication.
+// TestAstraConnectionWithID runs its own phases, from extracting the bundle
+// to the first query. While a test started with a cancel token runs, and for
+// connectionProgressRetention after, GetConnectionProgress with the token
+// returns the phase it is in and the phases it has finished, so a host can
+// show the progress of a slow connection rather than a spinner.
+
+// Phases of a connection test, in order
+const (
+	connectPhaseConfig = "config"
+	connectPhaseTCP    = "tcpConnect"
+	connectPhaseTLS    = "tlsHandshake"
+	connectPhaseAuth   = "auth"
+	connectPhaseQuery  = "systemLocal"
+)
+
+var connectPhaseOrder = []string{connectPhaseConfig, connectPhaseTCP, connectPhaseTLS, connectPhaseAuth, connectPhaseQuery}
+
+// Phases of an Astra connection test, in order
+const (
+	astraPhaseBundle   = "extractBundle"
+	astraPhaseMetadata = "fetchMetadata"
+	astraPhaseConnect  = "connect"
+	astraPhaseVerify   = "verify"
+)
+
+var astraPhaseOrder = []string{astraPhaseBundle, astraPhaseMetadata, astraPhaseConnect, astraPhaseVerify}
+
+// Defaults of ConnectionPhaseTimeouts not derived from the session options
+const (
+	defaultConfigPhaseTimeout  = 5 * time.Second
+	defaultNetworkPhaseTimeout = 10 * time.Second
+)
+
+// connectionProgressRetention is how long a finished test's progress is kept
+const connectionProgressRetention = 5 * time.Minute
+
+// Connection test statuses
+const (
+	connectionRunning   = "running"
+	connectionSucceeded = "succeeded"
+	connectionFailed    = "failed"
+	connectionCancelled = "cancelled"
+)
+
+// ConnectionPhaseTimeouts bounds each phase of a connection test
+type ConnectionPhaseTimeouts struct {
+	ConfigMs  int `json:"configMs"`  // Config resolution (default 5000)
+	ConnectMs int `json:"connectMs"` // TCP connect (default connectTimeout, or 10000)
+	TLSMs     int `json:"tlsMs"`     // TLS handshake (default connectTimeout, or 10000)
+	AuthMs    int `json:"authMs"`    // Session setup and authentication (default 10000)
+	QueryMs   int `json:"queryMs"`   // system.local and system.peers queries (default requestTimeout, or 10000)
+}
+
+// ConnectionPhase is the outcome of one phase of a connection test
+type ConnectionPhase struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"` // "ok", "failed", "timeout" or "skipped"
+	DurationMs float64 `json:"durationMs"`
+	TimeoutMs  int64   `json:"timeoutMs,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// ConnectionPhaseFailure is the data of a connection test that failed in a phase
+type ConnectionPhaseFailure struct {
+	FailedAt string            `json:"failedAt"`
+	Phases   []ConnectionPhase `json:"phases"`
+}
+
+// ConnectionProgress is the state of a connection test, for GetConnectionProgress
+type ConnectionProgress struct {
+	CancelToken    string            `json:"cancelToken"`
+	Status         string            `json:"status"`          // running, succeeded, failed or cancelled
+	Phase          string            `json:"phase,omitempty"` // The phase running
+	Step           int               `json:"step"`            // Position of the running phase, or of the last one run once the test ended
+	Steps          int               `json:"steps"`
+	PhaseElapsedMs int64             `json:"phaseElapsedMs,omitempty"` // Time spent in the running phase
+	ElapsedMs      int64             `json:"elapsedMs"`
+	Phases         []ConnectionPhase `json:"phases"` // Phases finished so far
+	FailedAt       string            `json:"failedAt,omitempty"`
+}
+
+// connectionPhases times the phases of a connection test
+type connectionPhases struct {
+	ctx      context.Context // The test's context, ended by Cancel
+	token    string
+	order    []string
+	timeouts ConnectionPhaseTimeouts
+	started  time.Time
+
+	// Read by GetConnectionProgress while the test runs
+	mu           sync.Mutex
+	phases       []ConnectionPhase
+	failedAt     string
+	current      string
+	currentStart time.Time
+	status       string
+	finished     time.Time
+}
+
+// Connection tests by cancel token
+var (
+	connectionTests     = make(map[string]*connectionPhases)
+	connectionTestsLock sync.Mutex
+)
+
+// newConnectionPhases validates the timeouts of a connection test running
+// the phases of order. A test with a cancel token is registered for
+// GetConnectionProgress; end must be called when it returns.
+func newConnectionPhases(ctx context.Context, token string, order []string, timeouts *ConnectionPhaseTimeouts) (*connectionPhases, error) {
+	p := &connectionPhases{ctx: ctx, token: token, order: order, started: time.Now(), phases: []ConnectionPhase{}, status: connectionRunning}
+	if timeouts != nil {
+		if timeouts.ConfigMs < 0 || timeouts.ConnectMs < 0 || timeouts.TLSMs < 0 || timeouts.AuthMs < 0 || timeouts.QueryMs < 0 {
+			return nil, fmt.Errorf("phaseTimeouts must not be negative")
+		}
+		p.timeouts = *timeouts
+	}
+	if token == "" {
+		return p, nil
+	}
+
+	now := time.Now()
+	connectionTestsLock.Lock()
+	for id, old := range connectionTests {
+		old.mu.Lock()
+		expired := !old.finished.IsZero() && now.Sub(old.finished) > connectionProgressRetention
+		old.mu.Unlock()
+		if expired {
+			delete(connectionTests, id)
+		}
+	}
+	connectionTests[token] = p
+	connectionTestsLock.Unlock()
+	return p, nil
+}
+
+// end records how the test ended. It must run before the test's context is
+// released, so that a cancelled test is told from one that finished.
+func (p *connectionPhases) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.ctx.Err() != nil:
+		p.status = connectionCancelled
+	case p.failedAt != "":
+		p.status = connectionFailed
+	default:
+		p.status = connectionSucceeded
+	}
+	p.current = ""
+	p.finished = time.Now()
+}
+
+// progress returns the test's state
+func (p *connectionPhases) progress() ConnectionProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	end := p.finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	result := ConnectionProgress{
+		CancelToken: p.token,
+		Status:      p.status,
+		Phase:       p.current,
+		Step:        len(p.phases),
+		Steps:       len(p.order),
+		ElapsedMs:   end.Sub(p.started).Milliseconds(),
+		Phases:      append([]ConnectionPhase{}, p.phases...),
+		FailedAt:    p.failedAt,
+	}
+	if p.current != "" {
+		result.Step++
+		result.PhaseElapsedMs = time.Since(p.currentStart).Milliseconds()
+	}
+	return result
+}
+
+// connectionTestProgress returns the progress of the test with a cancel token
+func connectionTestProgress(token string) (ConnectionProgress, bool) {
+	connectionTestsLock.Lock()
+	p := connectionTests[token]
+	connectionTestsLock.Unlock()
+	if p == nil {
+		return ConnectionProgress{}, false
+	}
+	return p.progress(), true
+}
+
+// phaseTimeout returns a phase's timeout: the one given, else seconds from the
+// session options, else the default
+func phaseTimeout(ms int, seconds int, fallback time.Duration) time.Duration {
+	switch {
+	case ms > 0:
+		return time.Duration(ms) * time.Millisecond
+	case seconds > 0:
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// run runs a phase, ending its context at the phase's timeout, if any. The
+// test stops at the first phase that fails.
+func (p *connectionPhases) run(name string, timeout time.Duration, phase func(ctx context.Context) error) error {
+	result := ConnectionPhase{Name: name, TimeoutMs: timeout.Milliseconds()}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(p.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(p.ctx)
+	}
+	defer cancel()
+
+	start := time.Now()
+	p.mu.Lock()
+	p.current, p.currentStart = name, start
+	p.mu.Unlock()
+	err := phase(ctx)
+	result.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	result.Status = "ok"
+	if err != nil {
+		result.Status = "failed"
+		if p.ctx.Err() == nil && ctx.Err() == context.DeadlineExceeded {
+			result.Status = "timeout"
+			err = fmt.Errorf("%s timed out after %v", name, timeout)
+		}
+		result.Error = err.Error()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		p.failedAt = name
+	}
+	p.phases = append(p.phases, result)
+	p.current = ""
+	return err
+}
+
+// skip records a phase that does not apply to the connection
+func (p *connectionPhases) skip(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phases = append(p.phases, ConnectionPhase{Name: name, Status: "skipped"})
+}
+
+// timedOut reports whether the failed phase ran past its timeout
+func (p *connectionPhases) timedOut() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.phases) > 0 && p.phases[len(p.phases)-1].Status == "timeout"
+}
+
+// completed returns the phases run so far
+func (p *connectionPhases) completed() []ConnectionPhase {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ConnectionPhase{}, p.phases...)
+}
+
+// failure returns the phases of a failed test, those not run marked skipped
+func (p *connectionPhases) failure() ConnectionPhaseFailure {
+	phases := p.completed()
+	recorded := make(map[string]bool, len(phases))
+	for _, phase := range phases {
+		recorded[phase.Name] = true
+	}
+	for _, name := range p.order {
+		if !recorded[name] {
+			phases = append(phases, ConnectionPhase{Name: name, Status: "skipped"})
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ConnectionPhaseFailure{FailedAt: p.failedAt, Phases: phases}
+}
+
+// await runs work in a goroutine and waits for it or for ctx to end. When
+// ctx ends first the work is left to finish, and abandon, when set, is given
+// what it returns.
+func await[T any](ctx context.Context, work func() (T, error), abandon func(T)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := work()
+		done <- result{value, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		if abandon != nil {
+			go func() {
+				if res := <-done; res.err == nil {
+					abandon(res.value)
+				}
+			}()
+		}
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// probeAddress returns the first contact point of the options
+func probeAddress(opts *SessionOptions) string {
+	host, port := opts.Host, opts.Port
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if port == 0 {
+		port = 9042
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// probeTLS makes a TLS handshake over the probe connection to address with
+// the configuration the driver will use, naming the server as the driver does
+func probeTLS(ctx context.Context, conn net.Conn, address string, ssl *config.SSLConfig) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := db.NewTLSConfig(ssl, host)
+	if err != nil {
+		return err
+	}
+	if !tlsConfig.InsecureSkipVerify && tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	return tls.Client(conn, tlsConfig).HandshakeContext(ctx)
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,6 +15,9 @@ import (
 	"time"
 
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/batch"
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/cql"
 	"github.com/axonops/cqlai-node/internal/db"
 )
 
@@ -23,6 +27,34 @@ type CopyParams struct {
 	Columns  []string          `json:"columns,omitempty"`
 	Filename string            `json:"filename"`
 	Options  map[string]string `json:"options,omitempty"`
+
+	// Query exports the result of a SELECT instead of a whole table (COPY TO
+	// only). It replaces Table and Columns.
+	Query string `json:"query,omitempty"`
+
+	// Format is the file format: csv (default), json or jsonl (see
+	// copy_json.go), or parquet (see copy_parquet.go). The FORMAT option sets
+	// it too.
+	Format string `json:"format,omitempty"`
+
+	// JobID lets COPY TO progress be polled with GetCopyProgress and the
+	// export stopped with CancelCopy or Cancel (see copy_progress.go)
+	JobID string `json:"jobId,omitempty"`
+
+	// ValidateOnly makes CopyFrom check the file against the table's column
+	// types and report errors without writing anything
+	ValidateOnly bool `json:"validateOnly,omitempty"`
+
+	// Mapping maps CSV header fields to table columns (COPY FROM only), as
+	// returned by PlanCsvMapping. It implies HEADER=true and replaces
+	// Columns; header fields it leaves out are skipped.
+	Mapping map[string]string `json:"mapping,omitempty"`
+
+	// Resume makes a CSV or JSONL COPY FROM save its progress to a
+	// checkpoint file, and carry on from a checkpoint an earlier import left
+	// (see copy_checkpoint.go). CheckpointFile replaces <file>.checkpoint.
+	Resume         bool   `json:"resume,omitempty"`
+	CheckpointFile string `json:"checkpointFile,omitempty"`
 }
 
 // CopyResult represents the result of a COPY operation
@@ -32,12 +64,31 @@ type CopyResult struct {
 	Errors       int64 `json:"errors,omitempty"`
 	ParseErrors  int   `json:"parse_errors,omitempty"`
 	SkippedRows  int   `json:"skipped_rows,omitempty"`
+
+	// COPY FROM: NULLVAL fields written as null, each creating a tombstone
+	// (0 with UNSETNULLS, which leaves those columns unset instead)
+	NullValues int64    `json:"null_values,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+
+	// COPY FROM: unlogged batches sent, and batches sent again after a
+	// timeout or an overloaded coordinator
+	Batches int64 `json:"batches,omitempty"`
+	Retries int64 `json:"retries,omitempty"`
+
+	// COPY FROM with resume: the checkpoint file, and the byte offset the
+	// import carried on from (0 when it started at the beginning)
+	Checkpoint  string `json:"checkpoint,omitempty"`
+	ResumedFrom int64  `json:"resumed_from,omitempty"`
+
+	// CSV dialect detected for options set to "auto" (see copy_dialect.go)
+	Dialect *CsvDialect `json:"dialect,omitempty"`
 }
 
 // batchEntry holds a prepared query and its values for batch execution
 type batchEntry struct {
 	query  string
 	values []interface{}
+	chunk  *copyChunk // COPY FROM with resume: the part of the file the row is from
 }
 
 // defaultCopyOptions returns default options for COPY operations
@@ -58,6 +109,12 @@ func defaultCopyOptions() map[string]string {
 		"MAXINSERTERRORS": "1000",
 		"MAXBATCHSIZE":    "20",
 		"MINBATCHSIZE":    "2",
+		// Attempts per batch when the write times out or the coordinator is overloaded
+		"MAXATTEMPTS": "5",
+		// Leave NULLVAL columns unset instead of writing null (no tombstones)
+		"UNSETNULLS": "false",
+		// Warn when COPY FROM writes more null cells than this (-1 disables)
+		"WARNNULLTOMBSTONES": "-1",
 	}
 }
 
@@ -88,22 +145,68 @@ func formatCSVValue(val interface{}) string {
 		if val == nil {
 			return ""
 		}
+		// Vectors and lists of scalars, e.g. []float32, as JSON arrays that
+		// COPY FROM reads back
+		if kind := reflect.TypeOf(val).Kind(); kind == reflect.Slice || kind == reflect.Array {
+			if jsonBytes, err := json.Marshal(val); err == nil {
+				return string(jsonBytes)
+			}
+		}
 		return fmt.Sprintf("%v", val)
 	}
 }
 
-// executeCopyTo exports data from a table to a CSV file
-func executeCopyTo(session *db.Session, params CopyParams, options map[string]string) (*CopyResult, error) {
+// selectForCopy checks that query is a single SELECT statement and returns it
+// without the trailing semicolon
+func selectForCopy(query string) (string, error) {
+	split, err := batch.SplitStatements(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid query: %v", err)
+	}
+	if split.Incomplete {
+		return "", fmt.Errorf("query is incomplete")
+	}
+	stmts := split.GetStatementStrings()
+	if len(stmts) != 1 {
+		return "", fmt.Errorf("query must be a single SELECT statement, got %d statements", len(stmts))
+	}
+	if d := cql.DescribeStatement(stmts[0]); d.Kind != "SELECT" {
+		return "", fmt.Errorf("query must be a SELECT statement, got %s", d.Kind)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(stmts[0], ";")), nil
+}
+
+// executeCopyTo exports data from a table, or the result of params.Query, to a
+// CSV, JSON, JSONL or Parquet file. Cancelling ctx stops the export between
+// rows; job, when not nil, counts the rows and bytes written.
+func executeCopyTo(ctx context.Context, session *db.Session, params CopyParams, options map[string]string, job *copyJob) (*CopyResult, error) {
+	recordUsage(usageCopyTo, 1)
+	format, err := copyFormat(params, options)
+	if err != nil {
+		return nil, err
+	}
+	if format == copyParquet {
+		return executeCopyToParquet(ctx, session, params, options, job)
+	}
+	if format != copyCSV {
+		return executeCopyToJSON(ctx, session, params, options, job, format)
+	}
+
 	// Build SELECT query
 	var query string
-	if len(params.Columns) > 0 {
+	if params.Query != "" {
+		query = params.Query
+	} else if len(params.Columns) > 0 {
 		query = fmt.Sprintf("SELECT %s FROM %s", strings.Join(params.Columns, ", "), params.Table)
 	} else {
 		query = fmt.Sprintf("SELECT * FROM %s", params.Table)
 	}
 
 	// Open output file
-	cleanPath := filepath.Clean(params.Filename)
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
 	file, err := os.Create(cleanPath) // #nosec G304 - user-provided path
 	if err != nil {
 		return nil, fmt.Errorf("error creating file: %v", err)
@@ -111,11 +214,17 @@ func executeCopyTo(session *db.Session, params CopyParams, options map[string]st
 	defer file.Close()
 
 	// Create CSV writer
-	csvWriter := csv.NewWriter(file)
+	csvWriter := csv.NewWriter(job.writer(file))
 	if delimiter := options["DELIMITER"]; delimiter != "" && len(delimiter) > 0 {
 		csvWriter.Comma = rune(delimiter[0])
 	}
 
+	// Stopping keeps the rows written so far
+	cancelled := func(rowCount int64) (*CopyResult, error) {
+		csvWriter.Flush()
+		return &CopyResult{RowsExported: rowCount}, fmt.Errorf("export cancelled after %d rows", rowCount)
+	}
+
 	maxRows, _ := strconv.Atoi(options["MAXROWS"])
 	nullVal := options["NULLVAL"]
 	writeHeader := strings.ToLower(options["HEADER"]) == "true"
@@ -144,6 +253,9 @@ func executeCopyTo(session *db.Session, params CopyParams, options map[string]st
 			if maxRows != -1 && rowCount >= int64(maxRows) {
 				break
 			}
+			if ctx.Err() != nil {
+				return cancelled(rowCount)
+			}
 
 			rowMap := make(map[string]interface{})
 			if !v.Iterator.MapScan(rowMap) {
@@ -167,6 +279,7 @@ func executeCopyTo(session *db.Session, params CopyParams, options map[string]st
 				return nil, fmt.Errorf("error writing row: %v", err)
 			}
 			rowCount++
+			job.addRow()
 
 			if rowCount%int64(pageSize) == 0 {
 				csvWriter.Flush()
@@ -193,6 +306,9 @@ func executeCopyTo(session *db.Session, params CopyParams, options map[string]st
 			if maxRows != -1 && rowCount >= int64(maxRows) {
 				break
 			}
+			if ctx.Err() != nil {
+				return cancelled(rowCount)
+			}
 			processedRow := make([]string, len(row))
 			for i, cell := range row {
 				if nullVal != "" && (cell == "null" || cell == "<null>") {
@@ -205,6 +321,7 @@ func executeCopyTo(session *db.Session, params CopyParams, options map[string]st
 				return nil, fmt.Errorf("error writing row: %v", err)
 			}
 			rowCount++
+			job.addRow()
 		}
 
 		csvWriter.Flush()
@@ -222,23 +339,46 @@ func executeCopyTo(session *db.Session, params CopyParams, options map[string]st
 	}
 }
 
-// executeCopyFrom imports data from a CSV file into a table
-func executeCopyFrom(session *db.Session, params CopyParams, options map[string]string) (*CopyResult, error) {
+// nullTombstoneWarning returns a warning when an import writes more null cells
+// than the WARNNULLTOMBSTONES threshold, or "" if it does not
+func nullTombstoneWarning(nullValues int64, options map[string]string) string {
+	threshold, err := strconv.ParseInt(options["WARNNULLTOMBSTONES"], 10, 64)
+	if err != nil || threshold < 0 || nullValues <= threshold {
+		return ""
+	}
+	return fmt.Sprintf("%d null values are written as tombstones (threshold %d); set UNSETNULLS=true to leave those columns unset instead", nullValues, threshold)
+}
+
+// executeCopyFrom imports data from a CSV, JSON, JSONL or Parquet file into a table
+func executeCopyFrom(handle int, session *db.Session, params CopyParams, options map[string]string) (*CopyResult, error) {
+	recordUsage(usageCopyFrom, 1)
+	format, err := copyFormat(params, options)
+	if err != nil {
+		return nil, err
+	}
+	if format != copyCSV {
+		return executeCopyFromJSON(handle, session, params, options, format)
+	}
+
 	// Open CSV file
-	cleanPath := filepath.Clean(params.Filename)
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
 	file, err := os.Open(cleanPath) // #nosec G304 - user-provided path
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %v", err)
 	}
 	defer file.Close()
 
-	// Create CSV reader
-	csvReader := csv.NewReader(file)
-	if delimiter := options["DELIMITER"]; delimiter != "" && len(delimiter) > 0 {
-		csvReader.Comma = rune(delimiter[0])
+	// Detect the options left to "auto" (see copy_dialect.go)
+	dialect, err := resolveCsvDialect(session, params.Table, cleanPath, options)
+	if err != nil {
+		return nil, err
 	}
-	if quote := options["QUOTE"]; quote != "" && len(quote) > 0 {
-		csvReader.LazyQuotes = true
+	csvReader, err := newCopyCSVReader(file, options)
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse options
@@ -250,7 +390,10 @@ func executeCopyFrom(session *db.Session, params CopyParams, options map[string]
 	maxParseErrors, _ := strconv.Atoi(options["MAXPARSEERRORS"])
 	maxInsertErrors, _ := strconv.Atoi(options["MAXINSERTERRORS"])
 	maxBatchSize, _ := strconv.Atoi(options["MAXBATCHSIZE"])
+	minBatchSize, _ := strconv.Atoi(options["MINBATCHSIZE"])
 	maxRequests, _ := strconv.Atoi(options["MAXREQUESTS"])
+	maxAttempts, _ := strconv.Atoi(options["MAXATTEMPTS"])
+	unsetNulls := strings.ToLower(options["UNSETNULLS"]) == "true"
 
 	if chunkSize <= 0 {
 		chunkSize = 5000
@@ -258,19 +401,28 @@ func executeCopyFrom(session *db.Session, params CopyParams, options map[string]
 	if maxBatchSize <= 0 {
 		maxBatchSize = 20
 	}
+	if minBatchSize <= 0 {
+		minBatchSize = 2
+	}
 	if maxRequests < 1 {
 		maxRequests = 6
 	}
 
 	columns := params.Columns
+	if params.Mapping != nil {
+		hasHeader = true
+	}
 
 	// Read header if present
 	var headerColumns []string
+	var mappedFields []int
+	fieldsPerRecord := 0
 	if hasHeader {
 		headerRow, err := csvReader.Read()
 		if err != nil {
 			return nil, fmt.Errorf("error reading header: %v", err)
 		}
+		fieldsPerRecord = len(headerRow)
 		headerColumns = make([]string, len(headerRow))
 		for i, col := range headerRow {
 			cleanCol := strings.TrimSpace(col)
@@ -283,6 +435,12 @@ func executeCopyFrom(session *db.Session, params CopyParams, options map[string]
 			}
 			headerColumns[i] = strings.TrimSpace(cleanCol)
 		}
+		if params.Mapping != nil {
+			columns, mappedFields, err = applyCsvMapping(headerColumns, params.Mapping)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	// Determine columns
@@ -298,6 +456,43 @@ func executeCopyFrom(session *db.Session, params CopyParams, options map[string]
 		}
 	}
 
+	// With resume, carry on from the checkpoint of an earlier import. A new
+	// reader at the checkpoint's offset expects the record width the first
+	// one took from the header, or else the columns' number.
+	var checkpoint *copyCheckpointer
+	var checkpointPath string
+	var resumedFrom, baseOffset int64
+	if params.Resume {
+		if csvReader.encoding != "utf8" {
+			return nil, fmt.Errorf("resume applies to UTF-8 files; this one is read as %s", csvReader.encoding)
+		}
+		if checkpointPath, err = copyCheckpointPath(params.Filename, params.CheckpointFile); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint path: %v", err)
+		}
+		cp, err := startCopyCheckpoint(checkpointPath, file, cleanPath, params.Table, copyCSV, columns)
+		if err != nil {
+			return nil, err
+		}
+		if cp.Completed {
+			return &CopyResult{Checkpoint: checkpointPath, Warnings: []string{completedCheckpointWarning(cp)}}, nil
+		}
+		if cp.Offset > 0 {
+			if _, err := file.Seek(cp.Offset, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("cannot resume at offset %d: %v", cp.Offset, err)
+			}
+			if csvReader, err = newCopyCSVReader(file, options); err != nil {
+				return nil, err
+			}
+			if fieldsPerRecord == 0 {
+				fieldsPerRecord = len(columns)
+			}
+			csvReader.FieldsPerRecord = fieldsPerRecord
+			resumedFrom, baseOffset, skipRows = cp.Offset, cp.Offset, 0
+		}
+		checkpoint = newCopyCheckpointer(checkpointPath, *cp, chunkSize)
+	}
+	offset := func() int64 { return baseOffset + csvReader.Offset() }
+
 	// Skip rows if requested
 	skippedRows := 0
 	for i := 0; i < skipRows; i++ {
@@ -306,7 +501,15 @@ func executeCopyFrom(session *db.Session, params CopyParams, options map[string]
 			break
 		}
 		skippedRows++
+		checkpoint.read(offset(), false, false)
 	}
+	if checkpoint != nil && skippedRows > 0 {
+		checkpoint.state.SkippedRows = skippedRows
+	}
+
+	// Vector columns are bound from their [x, y, ...] text; other values
+	// are bound as parsed
+	vectors := vectorCoercers(session, params.Table, columns)
 
 	// Build INSERT template
 	placeholders := make([]string, len(columns))
@@ -316,30 +519,38 @@ func executeCopyFrom(session *db.Session, params CopyParams, options map[string]
 	insertTemplate := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
 		params.Table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
 
-	// Concurrent batch execution
-	var rowCount int64
-	var insertErrorCount int64
+	// Concurrent batch execution, with rows grouped by partition and replica
 	processedRows := 0
 	parseErrorCount := 0
-
-	batchChan := make(chan []batchEntry, maxRequests*2)
-	var wg sync.WaitGroup
-
-	// Start workers
-	for i := 0; i < maxRequests; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for batch := range batchChan {
-				errors := executeBatchWithValues(session, batch)
-				atomic.AddInt64(&insertErrorCount, int64(errors))
-				atomic.AddInt64(&rowCount, int64(len(batch)-errors))
-			}
-		}()
+	var nullValues int64
+
+	workers := startCopyWorkers(handle, session, maxRequests, maxAttempts)
+	workers.checkpoint = checkpoint
+	grouper := &copyGrouper{
+		router:   newCopyRouter(session, params.Table, columns),
+		workers:  workers,
+		nullVal:  nullVal,
+		minBatch: minBatchSize,
+		maxBatch: maxBatchSize,
+		chunk:    max(chunkSize, maxBatchSize),
+	}
+	copyResult := func() *CopyResult {
+		return &CopyResult{
+			RowsImported: workers.rows.Load(),
+			Errors:       workers.errors.Load(),
+			ParseErrors:  parseErrorCount,
+			SkippedRows:  skippedRows,
+			NullValues:   nullValues,
+			Warnings:     workers.warnings(),
+			Batches:      workers.batches.Load(),
+			Retries:      workers.retries.Load(),
+			Checkpoint:   checkpointPath,
+			ResumedFrom:  resumedFrom,
+			Dialect:      dialect,
+		}
 	}
 
-	batch := make([]batchEntry, 0, maxBatchSize)
-
+	complete := true // The whole file was read
 	for {
 		record, err := csvReader.Read()
 		if err == io.EOF {
@@ -348,84 +559,261 @@ func executeCopyFrom(session *db.Session, params CopyParams, options map[string]
 		if err != nil {
 			parseErrorCount++
 			if maxParseErrors != -1 && parseErrorCount > maxParseErrors {
-				close(batchChan)
-				wg.Wait()
-				return &CopyResult{
-					RowsImported: atomic.LoadInt64(&rowCount),
-					Errors:       atomic.LoadInt64(&insertErrorCount),
-					ParseErrors:  parseErrorCount,
-					SkippedRows:  skippedRows,
-				}, fmt.Errorf("too many parse errors (%d)", parseErrorCount)
+				workers.wait()
+				return copyResult(), fmt.Errorf("too many parse errors (%d)", parseErrorCount)
 			}
+			checkpoint.read(offset(), false, true)
 			continue
 		}
 
 		if maxRows != -1 && processedRows >= maxRows {
+			complete = false
 			break
 		}
 		processedRows++
 
+		if mappedFields != nil {
+			if len(record) != len(headerColumns) {
+				record = nil // Counted as a parse error below
+			} else {
+				record = selectFields(record, mappedFields)
+			}
+		}
+
 		if len(record) != len(columns) {
 			parseErrorCount++
 			if maxParseErrors != -1 && parseErrorCount > maxParseErrors {
-				close(batchChan)
-				wg.Wait()
-				return &CopyResult{
-					RowsImported: atomic.LoadInt64(&rowCount),
-					Errors:       atomic.LoadInt64(&insertErrorCount),
-					ParseErrors:  parseErrorCount,
-					SkippedRows:  skippedRows,
-				}, fmt.Errorf("too many parse errors (%d)", parseErrorCount)
+				workers.wait()
+				return copyResult(), fmt.Errorf("too many parse errors (%d)", parseErrorCount)
 			}
+			checkpoint.read(offset(), true, true)
 			continue
 		}
 
-		// Convert values
+		// Convert values. A bound null deletes the cell and writes a
+		// tombstone; an unset value leaves the column untouched.
 		values := make([]interface{}, len(record))
+		valid := true
 		for i, val := range record {
-			if val == nullVal {
+			switch {
+			case val == nullVal && unsetNulls:
+				values[i] = gocql.UnsetValue
+			case val == nullVal:
 				values[i] = nil
-			} else {
+				nullValues++
+			case vectors[i] != nil:
+				v, err := vectors[i].CoerceBindable(val)
+				valid = valid && err == nil
+				values[i] = v
+			default:
 				values[i] = parseValueForBinding(val)
 			}
 		}
+		if !valid {
+			parseErrorCount++
+			if maxParseErrors != -1 && parseErrorCount > maxParseErrors {
+				workers.wait()
+				return copyResult(), fmt.Errorf("too many parse errors (%d)", parseErrorCount)
+			}
+			checkpoint.read(offset(), true, true)
+			continue
+		}
+
+		if maxInsertErrors != -1 && workers.errors.Load() > int64(maxInsertErrors) {
+			workers.wait()
+			return copyResult(), fmt.Errorf("too many insert errors (%d)", workers.errors.Load())
+		}
+		chunk := checkpoint.read(offset(), true, false)
+		grouper.add(batchEntry{query: insertTemplate, values: values, chunk: chunk}, record)
+	}
 
-		batch = append(batch, batchEntry{query: insertTemplate, values: values})
+	// Send the rows of the last chunk
+	grouper.flush()
+	workers.wait()
+	checkpoint.finish(offset(), complete)
+
+	result := copyResult()
+	if warning := checkpoint.warning(); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+	if warning := nullTombstoneWarning(nullValues, options); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+	return result, nil
+}
+
+// copyWorkers inserts the batches of a COPY FROM concurrently. The queue
+// holds two batches per worker; once it is full the reader waits, so a slow
+// or overloaded cluster slows the import down instead of filling memory.
+type copyWorkers struct {
+	queue       chan []batchEntry
+	limits      PayloadLimits
+	maxAttempts int
+	wg          sync.WaitGroup
+	rows        atomic.Int64             // Rows inserted
+	errors      atomic.Int64             // Rows that failed to insert
+	oversized   atomic.Int64             // Rows not sent because they are larger than max_mutation_size
+	batches     atomic.Int64             // Batches sent
+	retries     atomic.Int64             // Batches sent again after a timeout
+	checkpoint  *copyCheckpointer        // Told of each row inserted or failed, with resume
+	execBatch   func([]batchEntry) error // Executes rows as an unlogged batch
+	execRow     func(batchEntry) error   // Executes a row on its own
+}
+
+// startCopyWorkers starts n workers inserting batches into session, each
+// batch tried up to maxAttempts times. Batches larger than the server's
+// batch_size_fail_threshold are sent in parts.
+func startCopyWorkers(handle int, session *db.Session, n, maxAttempts int) *copyWorkers {
+	w := &copyWorkers{
+		queue:       make(chan []batchEntry, n*2),
+		limits:      payloadLimitsFor(handle, session),
+		maxAttempts: max(maxAttempts, 1),
+		execBatch:   func(entries []batchEntry) error { return executeCopyBatch(session, entries) },
+		execRow:     func(entry batchEntry) error { return session.Query(entry.query, entry.values...).Exec() },
+	}
+	for i := 0; i < n; i++ {
+		w.wg.Add(1)
+		trackHandleWorkers(handle, 1)
+		go func() {
+			defer w.wg.Done()
+			defer trackHandleWorkers(handle, -1)
+			for batch := range w.queue {
+				for _, part := range w.split(batch) {
+					errors := w.insert(part)
+					w.errors.Add(int64(errors))
+					w.rows.Add(int64(len(part) - errors))
+				}
+			}
+		}()
+	}
+	return w
+}
 
-		if len(batch) >= maxBatchSize {
-			if maxInsertErrors != -1 && atomic.LoadInt64(&insertErrorCount) > int64(maxInsertErrors) {
-				close(batchChan)
-				wg.Wait()
-				return &CopyResult{
-					RowsImported: atomic.LoadInt64(&rowCount),
-					Errors:       atomic.LoadInt64(&insertErrorCount),
-					ParseErrors:  parseErrorCount,
-					SkippedRows:  skippedRows,
-				}, fmt.Errorf("too many insert errors (%d)", atomic.LoadInt64(&insertErrorCount))
+// insert executes a batch, sending it again after a timeout or an overloaded
+// coordinator, and falls back to inserting its rows one at a time when it
+// still fails. It returns the number of rows that failed.
+func (w *copyWorkers) insert(entries []batchEntry) int {
+	if len(entries) == 0 {
+		return 0
+	}
+	for attempt := 1; ; attempt++ {
+		w.batches.Add(1)
+		err := w.execBatch(entries)
+		if err == nil {
+			for _, entry := range entries {
+				w.checkpoint.done(entry.chunk, true)
 			}
-			batchCopy := make([]batchEntry, len(batch))
-			copy(batchCopy, batch)
-			batchChan <- batchCopy
-			batch = batch[:0]
+			return 0
+		}
+		if attempt >= w.maxAttempts || !retryableCopyError(err) {
+			break
+		}
+		w.retries.Add(1)
+		time.Sleep(copyRetryBackoff(attempt))
+	}
+
+	errors := 0
+	for _, entry := range entries {
+		execErr := w.execRow(entry)
+		if execErr != nil {
+			errors++
+		}
+		w.checkpoint.done(entry.chunk, execErr == nil)
+	}
+	return errors
+}
+
+// retryableCopyError reports whether a failed batch is worth sending again:
+// it timed out, so it may or may not have been applied, or the coordinator
+// was too busy to take it. Inserts apply the same way twice.
+func retryableCopyError(err error) bool {
+	switch benchErrorType(err) {
+	case "write_timeout", "client_timeout", "overloaded":
+		return true
+	}
+	return false
+}
+
+// copyRetryBackoff is the pause before the next attempt of a batch: 100ms,
+// doubling up to 2s
+func copyRetryBackoff(attempt int) time.Duration {
+	return min(100*time.Millisecond<<min(attempt-1, 5), 2*time.Second)
+}
+
+// split drops the rows of a batch that are too large to insert, counting them
+// as errors, and groups the others into batches under batch_size_fail_threshold
+func (w *copyWorkers) split(batch []batchEntry) [][]batchEntry {
+	var parts [][]batchEntry
+	start, size := 0, int64(0)
+	kept := make([]batchEntry, 0, len(batch))
+	for _, entry := range batch {
+		n := statementSize(entry.query, entry.values)
+		if n > w.limits.MaxMutationBytes {
+			w.oversized.Add(1)
+			w.errors.Add(1)
+			w.checkpoint.done(entry.chunk, false)
+			continue
 		}
+		if len(kept) > start && size+n > w.limits.BatchFailBytes {
+			parts = append(parts, kept[start:])
+			start, size = len(kept), 0
+		}
+		kept = append(kept, entry)
+		size += n
+	}
+	if len(kept) > start {
+		parts = append(parts, kept[start:])
+	}
+	return parts
+}
+
+// warnings reports the rows that were too large to insert
+func (w *copyWorkers) warnings() []string {
+	if n := w.oversized.Load(); n > 0 {
+		return []string{fmt.Sprintf("%d rows are larger than the server's max_mutation_size of %d bytes and were not inserted", n, w.limits.MaxMutationBytes)}
 	}
+	return nil
+}
 
-	// Send remaining batch
-	if len(batch) > 0 {
-		batchCopy := make([]batchEntry, len(batch))
-		copy(batchCopy, batch)
-		batchChan <- batchCopy
+// send queues a copy of batch, which the caller may then reuse
+func (w *copyWorkers) send(batch []batchEntry) {
+	if len(batch) == 0 {
+		return
 	}
+	batchCopy := make([]batchEntry, len(batch))
+	copy(batchCopy, batch)
+	w.queue <- batchCopy
+}
 
-	close(batchChan)
-	wg.Wait()
+// wait waits for the queued batches to be inserted. No batch can be sent
+// afterwards.
+func (w *copyWorkers) wait() {
+	close(w.queue)
+	w.wg.Wait()
+}
 
-	return &CopyResult{
-		RowsImported: atomic.LoadInt64(&rowCount),
-		Errors:       atomic.LoadInt64(&insertErrorCount),
-		ParseErrors:  parseErrorCount,
-		SkippedRows:  skippedRows,
-	}, nil
+// vectorCoercers returns a coercer for each of columns that is a vector, and
+// nil for the others or when the table's metadata cannot be read
+func vectorCoercers(session *db.Session, table string, columns []string) []*db.Coercer {
+	coercers := make([]*db.Coercer, len(columns))
+	keyspace, tableName := splitTableName(table, session.Keyspace())
+	meta, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return coercers
+	}
+	for i, col := range columns {
+		column := lookupColumn(meta, col)
+		if column == nil {
+			continue
+		}
+		if _, ok := column.Type.(gocql.VectorType); !ok {
+			continue
+		}
+		if coercer, err := db.NewCoercer(formatTypeInfo(column.Type)); err == nil {
+			coercers[i] = coercer
+		}
+	}
+	return coercers
 }
 
 // getTableColumns retrieves column names for a table from system_schema
@@ -481,26 +869,11 @@ func parseValueForBinding(value string) interface{} {
 	return value
 }
 
-// executeBatchWithValues executes a batch of queries, falling back to individual on failure
-func executeBatchWithValues(session *db.Session, entries []batchEntry) int {
-	if len(entries) == 0 {
-		return 0
-	}
-
+// executeCopyBatch executes entries as one unlogged batch
+func executeCopyBatch(session *db.Session, entries []batchEntry) error {
 	batch := session.CreateBatch(gocql.UnloggedBatch)
 	for _, entry := range entries {
 		batch.Query(entry.query, entry.values...)
 	}
-
-	err := session.ExecuteBatch(batch)
-	if err != nil {
-		errors := 0
-		for _, entry := range entries {
-			if execErr := session.Query(entry.query, entry.values...).Exec(); execErr != nil {
-				errors++
-			}
-		}
-		return errors
-	}
-	return 0
+	return session.ExecuteBatch(batch)
 }
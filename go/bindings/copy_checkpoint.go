@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/config"
+)
+
+// Resumable COPY FROM
+//
+// With resume, CopyFrom records how far it got through a CSV or JSONL file
+// in a checkpoint file next to it (<file>.checkpoint unless checkpointFile
+// names another). The file is read in chunks of CHUNKSIZE rows. Once every
+// row of a chunk, and of each chunk before it, has been inserted or has
+// failed, the checkpoint moves past the chunk: its byte offset and the rows
+// counted so far. Another CopyFrom of the same file with resume seeks to the
+// offset and goes on from there. Rows of chunks still in flight when an
+// import stopped are inserted again, which for INSERT writes the same values.
+// The checkpoint is replaced atomically, and kept once the import completes
+// so GetCopyCheckpoint can tell how it ended.
+
+const (
+	copyCheckpointVersion = 1
+	copyCheckpointSuffix  = ".checkpoint"
+)
+
+// CopyCheckpoint is the progress of a resumable COPY FROM, as saved in its
+// checkpoint file
+type CopyCheckpoint struct {
+	Version      int       `json:"version"`
+	Filename     string    `json:"filename"`
+	Table        string    `json:"table"`
+	Format       string    `json:"format"`
+	Columns      []string  `json:"columns,omitempty"` // CSV: columns the fields are inserted into
+	FileSize     int64     `json:"fileSize"`          // Size and modification time of the file when the import started
+	FileModTime  time.Time `json:"fileModTime"`
+	Offset       int64     `json:"offset"`   // Bytes of the file imported
+	RowsRead     int64     `json:"rowsRead"` // Rows read up to offset, after skipped rows
+	RowsImported int64     `json:"rowsImported"`
+	Errors       int64     `json:"errors"` // Rows that failed to insert
+	ParseErrors  int64     `json:"parseErrors"`
+	SkippedRows  int       `json:"skippedRows"`
+	Completed    bool      `json:"completed"` // The whole file was read
+	StartedAt    time.Time `json:"startedAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// CopyCheckpointRequest locates the checkpoint of an import
+type CopyCheckpointRequest struct {
+	Filename       string `json:"filename"`
+	CheckpointFile string `json:"checkpointFile,omitempty"`
+}
+
+// CopyCheckpointStatus is a checkpoint with how it compares to its file now
+type CopyCheckpointStatus struct {
+	CopyCheckpoint
+	CheckpointFile string  `json:"checkpointFile"`
+	PercentDone    float64 `json:"percentDone"`
+	FileChanged    bool    `json:"fileChanged"` // The file differs from when the import started; it cannot resume
+}
+
+// copyCheckpointPath returns the checkpoint file of an import of filename
+func copyCheckpointPath(filename, checkpointFile string) (string, error) {
+	if checkpointFile != "" {
+		return config.NormalizePath(checkpointFile)
+	}
+	path, err := config.NormalizePath(filename)
+	if err != nil {
+		return "", err
+	}
+	return path + copyCheckpointSuffix, nil
+}
+
+// loadCopyCheckpoint reads a checkpoint file; it returns nil when there is none
+func loadCopyCheckpoint(path string) (*CopyCheckpoint, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - checkpoint of a user-provided path
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read checkpoint %s: %v", path, err)
+	}
+	var cp CopyCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s is not valid: %v", path, err)
+	}
+	if cp.Version != copyCheckpointVersion {
+		return nil, fmt.Errorf("checkpoint %s has version %d, want %d", path, cp.Version, copyCheckpointVersion)
+	}
+	return &cp, nil
+}
+
+// copyCheckpointStatus reads the checkpoint of an import for GetCopyCheckpoint
+func copyCheckpointStatus(req CopyCheckpointRequest) (*CopyCheckpointStatus, error) {
+	path, err := copyCheckpointPath(req.Filename, req.CheckpointFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	cp, err := loadCopyCheckpoint(path)
+	if err != nil || cp == nil {
+		return nil, err
+	}
+	status := &CopyCheckpointStatus{CopyCheckpoint: *cp, CheckpointFile: path}
+	if cp.FileSize > 0 {
+		status.PercentDone = float64(cp.Offset) * 100 / float64(cp.FileSize)
+	}
+	if cp.Completed {
+		status.PercentDone = 100
+	}
+	info, err := os.Stat(cp.Filename)
+	status.FileChanged = err != nil || info.Size() != cp.FileSize || !info.ModTime().Equal(cp.FileModTime)
+	return status, nil
+}
+
+// startCopyCheckpoint returns the checkpoint an import of file resumes from,
+// a fresh one when there is none yet. It fails when the checkpoint is of
+// another import, or the file changed since it was written.
+func startCopyCheckpoint(path string, file *os.File, filename, table, format string, columns []string) (*CopyCheckpoint, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	cp, err := loadCopyCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	if cp == nil {
+		now := time.Now().UTC()
+		return &CopyCheckpoint{
+			Version:     copyCheckpointVersion,
+			Filename:    filename,
+			Table:       table,
+			Format:      format,
+			Columns:     columns,
+			FileSize:    info.Size(),
+			FileModTime: info.ModTime(),
+			StartedAt:   now,
+			UpdatedAt:   now,
+		}, nil
+	}
+
+	switch {
+	case cp.Filename != filename || cp.Table != table || cp.Format != format:
+		return nil, fmt.Errorf("checkpoint %s is of an import of %s into %s as %s; delete it to start over", path, cp.Filename, cp.Table, cp.Format)
+	case !slices.Equal(cp.Columns, columns):
+		return nil, fmt.Errorf("checkpoint %s imported columns (%v), not (%v); delete it to start over", path, cp.Columns, columns)
+	case info.Size() != cp.FileSize || !info.ModTime().Equal(cp.FileModTime):
+		return nil, fmt.Errorf("%s changed since checkpoint %s was written; delete the checkpoint to start over", filename, path)
+	}
+	return cp, nil
+}
+
+// completedCheckpointWarning explains why a resumed import had nothing to do
+func completedCheckpointWarning(cp *CopyCheckpoint) string {
+	return fmt.Sprintf("the checkpoint shows this file was imported completely on %s (%d rows imported, %d failed); nothing was resumed. Delete the checkpoint to import it again",
+		cp.UpdatedAt.Format(time.RFC3339), cp.RowsImported, cp.Errors)
+}
+
+// copyCheckpointer moves a checkpoint along as the chunks of an import are
+// done. A nil checkpointer records nothing, for imports without resume.
+type copyCheckpointer struct {
+	path      string
+	chunkRows int
+
+	mu      sync.Mutex
+	state   CopyCheckpoint
+	chunks  []*copyChunk // Not yet in the checkpoint, in file order
+	current *copyChunk
+	err     error // First failure to save the checkpoint
+}
+
+// copyChunk is a run of rows of the file. It is done once it is closed and
+// none of its rows are waiting to be inserted.
+type copyChunk struct {
+	rows        int   // Records read, parse errors included
+	end         int64 // Offset after its last record
+	closed      bool
+	rowsRead    int64
+	parseErrors int64
+	pending     int
+	imported    int64
+	errors      int64
+}
+
+// newCopyCheckpointer records the progress of an import from cp onwards in path
+func newCopyCheckpointer(path string, cp CopyCheckpoint, chunkRows int) *copyCheckpointer {
+	return &copyCheckpointer{path: path, state: cp, chunkRows: max(chunkRows, 1)}
+}
+
+// read counts a record the reader got, which ends at offset. A parsed row
+// counts towards RowsRead, a parse error towards ParseErrors, and neither
+// for records only read past. A parsed row without a parse error is sent to
+// the workers, and is counted as waiting before its chunk can close, so the
+// chunk is not done until it is inserted. It returns the record's chunk.
+func (c *copyCheckpointer) read(offset int64, parsed, parseError bool) *copyChunk {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == nil {
+		c.current = &copyChunk{}
+		c.chunks = append(c.chunks, c.current)
+	}
+	chunk := c.current
+	chunk.rows++
+	chunk.end = offset
+	if parsed {
+		chunk.rowsRead++
+	}
+	if parseError {
+		chunk.parseErrors++
+	}
+	if parsed && !parseError {
+		chunk.pending++
+	}
+	if chunk.rows >= c.chunkRows {
+		chunk.closed = true
+		c.current = nil
+		c.advanceLocked()
+	}
+	return chunk
+}
+
+// done counts a row sent to the workers as inserted or failed
+func (c *copyCheckpointer) done(chunk *copyChunk, inserted bool) {
+	if c == nil || chunk == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chunk.pending--
+	if inserted {
+		chunk.imported++
+	} else {
+		chunk.errors++
+	}
+	if chunk.closed && chunk.pending == 0 {
+		c.advanceLocked()
+	}
+}
+
+// finish closes the last chunk once the workers are done. When the whole file
+// was read, the import is marked completed up to offset, the end of the file.
+func (c *copyCheckpointer) finish(offset int64, completed bool) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != nil {
+		c.current.closed = true
+		c.current = nil
+	}
+	c.advanceLocked()
+	if completed && len(c.chunks) == 0 {
+		c.state.Completed = true
+		c.state.Offset = max(c.state.Offset, offset)
+		c.saveLocked()
+	}
+}
+
+// warning reports a checkpoint that could not be saved
+func (c *copyCheckpointer) warning() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		return ""
+	}
+	return fmt.Sprintf("the checkpoint could not be saved, so the import cannot resume from where it stopped: %v", c.err)
+}
+
+// advanceLocked moves the checkpoint past the leading chunks that are done
+func (c *copyCheckpointer) advanceLocked() {
+	moved := false
+	for len(c.chunks) > 0 && c.chunks[0].closed && c.chunks[0].pending == 0 {
+		chunk := c.chunks[0]
+		c.chunks = c.chunks[1:]
+		c.state.Offset = chunk.end
+		c.state.RowsRead += chunk.rowsRead
+		c.state.ParseErrors += chunk.parseErrors
+		c.state.RowsImported += chunk.imported
+		c.state.Errors += chunk.errors
+		moved = true
+	}
+	if moved {
+		c.saveLocked()
+	}
+}
+
+// saveLocked replaces the checkpoint file, writing a temporary file first so
+// a crash leaves either the old checkpoint or the new one
+func (c *copyCheckpointer) saveLocked() {
+	c.state.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err == nil {
+		tmp := c.path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o600); err == nil {
+			if err = os.Rename(tmp, c.path); err != nil {
+				_ = os.Remove(tmp)
+			}
+		}
+	}
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+}
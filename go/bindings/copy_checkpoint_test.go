@@ -0,0 +1,217 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCheckpointer records progress in a checkpoint file of a fresh temporary
+// directory, in chunks of chunkRows
+func testCheckpointer(t *testing.T, chunkRows int) (*copyCheckpointer, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.csv"+copyCheckpointSuffix)
+	return newCopyCheckpointer(path, CopyCheckpoint{Version: copyCheckpointVersion}, chunkRows), path
+}
+
+// savedCheckpoint loads the checkpoint file, failing the test if there is none
+func savedCheckpoint(t *testing.T, path string) *CopyCheckpoint {
+	t.Helper()
+	cp, err := loadCopyCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp == nil {
+		t.Fatal("no checkpoint saved")
+	}
+	return cp
+}
+
+func TestCopyCheckpointerOutOfOrder(t *testing.T) {
+	c, path := testCheckpointer(t, 2)
+
+	// Three chunks of two rows, each row ending 10 bytes further on
+	chunks := make([]*copyChunk, 6)
+	for i := range chunks {
+		chunks[i] = c.read(int64(10*(i+1)), true, false)
+	}
+	if chunks[0] != chunks[1] || chunks[1] == chunks[2] || chunks[3] == chunks[4] {
+		t.Fatal("rows not chunked in twos")
+	}
+
+	// The later chunks are done first; the first holds the checkpoint back
+	for _, i := range []int{5, 2, 4, 3, 1} {
+		c.done(chunks[i], i != 4)
+	}
+	if cp, _ := loadCopyCheckpoint(path); cp != nil {
+		t.Fatalf("checkpoint at offset %d with the first row not inserted", cp.Offset)
+	}
+
+	c.done(chunks[0], true)
+	cp := savedCheckpoint(t, path)
+	if cp.Offset != 60 || cp.RowsRead != 6 || cp.RowsImported != 5 || cp.Errors != 1 || cp.Completed {
+		t.Errorf("checkpoint %+v", cp)
+	}
+}
+
+func TestCopyCheckpointerWaitsForLastRowOfChunk(t *testing.T) {
+	c, path := testCheckpointer(t, 2)
+
+	// The first row is inserted before the row closing its chunk is read
+	first := c.read(10, true, false)
+	c.done(first, true)
+	last := c.read(20, true, false)
+	if cp, _ := loadCopyCheckpoint(path); cp != nil {
+		t.Fatalf("checkpoint at offset %d before the chunk's last row was inserted", cp.Offset)
+	}
+
+	c.done(last, true)
+	if cp := savedCheckpoint(t, path); cp.Offset != 20 || cp.RowsImported != 2 {
+		t.Errorf("checkpoint %+v", cp)
+	}
+}
+
+func TestCopyCheckpointerParseErrorsAndSkippedRows(t *testing.T) {
+	c, path := testCheckpointer(t, 3)
+
+	// Skipped rows and parse errors fill a chunk with nothing to insert
+	c.read(5, false, false)
+	c.read(12, false, true)
+	c.read(20, true, true) // Parsed, but with the wrong number of fields
+	cp := savedCheckpoint(t, path)
+	if cp.Offset != 20 || cp.RowsRead != 1 || cp.ParseErrors != 2 || cp.RowsImported != 0 {
+		t.Errorf("after the first chunk: %+v", cp)
+	}
+
+	row := c.read(30, true, false)
+	c.read(40, false, true)
+	c.done(row, true)
+	if cp := savedCheckpoint(t, path); cp.Offset != 20 {
+		t.Errorf("open chunk checkpointed at offset %d", cp.Offset)
+	}
+
+	c.finish(40, false)
+	cp = savedCheckpoint(t, path)
+	if cp.Offset != 40 || cp.RowsRead != 2 || cp.ParseErrors != 3 || cp.RowsImported != 1 || cp.Completed {
+		t.Errorf("after finish: %+v", cp)
+	}
+}
+
+func TestCopyCheckpointerFinish(t *testing.T) {
+	c, path := testCheckpointer(t, 10)
+
+	rows := []*copyChunk{c.read(10, true, false), c.read(20, true, false)}
+	for _, chunk := range rows {
+		c.done(chunk, true)
+	}
+	c.finish(25, true) // Trailing bytes after the last record
+	cp := savedCheckpoint(t, path)
+	if !cp.Completed || cp.Offset != 25 || cp.RowsRead != 2 || cp.RowsImported != 2 {
+		t.Errorf("completed checkpoint %+v", cp)
+	}
+	if cp.UpdatedAt.IsZero() {
+		t.Error("completed checkpoint has no update time")
+	}
+	if c.warning() != "" {
+		t.Errorf("warning %q", c.warning())
+	}
+
+	// A row still waiting keeps the import from completing
+	c, path = testCheckpointer(t, 10)
+	c.read(10, true, false)
+	c.finish(10, true)
+	if cp, _ := loadCopyCheckpoint(path); cp != nil {
+		t.Errorf("checkpoint %+v saved with a row waiting", cp)
+	}
+}
+
+func TestCopyCheckpointerNilAndSaveFailure(t *testing.T) {
+	var c *copyCheckpointer
+	if chunk := c.read(10, true, false); chunk != nil {
+		t.Error("nil checkpointer returned a chunk")
+	}
+	c.done(nil, true)
+	c.finish(10, true)
+	if c.warning() != "" {
+		t.Error("nil checkpointer warned")
+	}
+
+	c = newCopyCheckpointer(filepath.Join(t.TempDir(), "missing", "data.checkpoint"), CopyCheckpoint{}, 1)
+	c.read(10, false, false)
+	if !strings.Contains(c.warning(), "cannot resume") {
+		t.Errorf("warning %q", c.warning())
+	}
+}
+
+func TestStartCopyCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "data.csv")
+	if err := os.WriteFile(filename, []byte("1,a\n2,b\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filename + copyCheckpointSuffix
+	columns := []string{"id", "name"}
+	start := func(filename, table, format string, columns []string) (*CopyCheckpoint, error) {
+		file, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		return startCopyCheckpoint(path, file, filename, table, format, columns)
+	}
+
+	cp, err := start(filename, "app.t", copyCSV, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Offset != 0 || cp.FileSize != 8 || cp.Version != copyCheckpointVersion {
+		t.Fatalf("fresh checkpoint %+v", cp)
+	}
+	c := newCopyCheckpointer(path, *cp, 1)
+	c.done(c.read(4, true, false), true)
+
+	cp, err = start(filename, "app.t", copyCSV, columns)
+	if err != nil || cp.Offset != 4 || cp.RowsImported != 1 {
+		t.Fatalf("resumed checkpoint %+v, %v", cp, err)
+	}
+
+	other := filepath.Join(dir, "other.csv")
+	if err := os.WriteFile(other, []byte("1,a\n2,b\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		filename string
+		table    string
+		format   string
+		columns  []string
+	}{
+		{"another file", other, "app.t", copyCSV, columns},
+		{"another table", filename, "app.u", copyCSV, columns},
+		{"another format", filename, "app.t", copyJSONL, columns},
+		{"other columns", filename, "app.t", copyCSV, []string{"name", "id"}},
+		{"fewer columns", filename, "app.t", copyCSV, columns[:1]},
+	}
+	for _, tt := range tests {
+		if _, err := start(tt.filename, tt.table, tt.format, tt.columns); err == nil {
+			t.Errorf("%s: checkpoint accepted", tt.name)
+		}
+	}
+
+	// A file changed since the checkpoint was written
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filename, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := start(filename, "app.t", copyCSV, columns); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("changed modification time: %v", err)
+	}
+	if err := os.WriteFile(filename, []byte("1,a\n2,b\n3,c\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := start(filename, "app.t", copyCSV, columns); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("changed size: %v", err)
+	}
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// CSV dialects
+//
+// COPY FROM reads CSV files in UTF-8, UTF-16 or Latin-1 (ENCODING), quoted
+// with " or ' (QUOTE). DELIMITER, QUOTE, ENCODING and HEADER may be "auto",
+// in which case they are detected from the first csvDialectSampleBytes of the
+// file: the encoding from its byte order mark or byte patterns, the quote
+// from where each candidate appears next to field boundaries, the delimiter
+// as the one splitting the sampled records into the most consistent number
+// of fields, and the header from the table: a first row naming its columns,
+// or holding values its column types reject while the rows below accept
+// them. DetectCsvDialect runs the same detection so the result can be
+// confirmed before importing.
+
+// csvDialectSampleBytes is how much of a file dialect detection reads
+const csvDialectSampleBytes = 64 << 10
+
+// csvDialectDelimiters are the delimiters detection tries, most likely first
+var csvDialectDelimiters = []string{",", ";", "\t", "|", ":", "^"}
+
+// csvDialectOptions are the COPY options that may be detected
+var csvDialectOptions = []string{"ENCODING", "QUOTE", "DELIMITER", "HEADER"}
+
+// CsvDialectParams represents the input to DetectCsvDialect
+type CsvDialectParams struct {
+	Table    string            `json:"table,omitempty"` // Table whose columns tell a header from data; optional
+	Filename string            `json:"filename"`
+	Options  map[string]string `json:"options,omitempty"` // DELIMITER, QUOTE, ENCODING or HEADER given (and not "auto") are kept
+}
+
+// CsvDialect is how a CSV file is written, as detected from a sample of it
+type CsvDialect struct {
+	Encoding      string            `json:"encoding"` // utf8, utf16le, utf16be or latin1
+	BOM           bool              `json:"bom"`      // The file starts with a byte order mark, which is skipped
+	Delimiter     string            `json:"delimiter"`
+	Quote         string            `json:"quote"`
+	Header        bool              `json:"header"`
+	Fields        int               `json:"fields"`      // Fields in most sampled records
+	SampledRows   int               `json:"sampledRows"` // Records in the sample, header included
+	Consistency   float64           `json:"consistency"` // Share of sampled records with Fields fields
+	HeaderColumns int               `json:"headerColumns,omitempty"`
+	Detected      []string          `json:"detected"` // Options detected rather than given
+	Options       map[string]string `json:"options"`  // COPY options of the dialect, for CopyFrom
+	Warnings      []string          `json:"warnings,omitempty"`
+}
+
+// isAutoOption reports whether a COPY option asks for detection
+func isAutoOption(value string) bool {
+	return strings.EqualFold(strings.TrimSpace(value), "auto")
+}
+
+// autoCsvOption returns the first dialect option set to "auto", or "" if none is
+func autoCsvOption(options map[string]string) string {
+	for _, key := range csvDialectOptions {
+		if isAutoOption(options[key]) {
+			return key
+		}
+	}
+	return ""
+}
+
+// normalizeCsvEncoding returns the ENCODING option as utf8, utf16 (byte
+// order from the byte order mark), utf16le, utf16be or latin1
+func normalizeCsvEncoding(name string) (string, error) {
+	n := strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(name))
+	switch n {
+	case "", "utf8":
+		return "utf8", nil
+	case "utf16", "utf16le", "utf16be", "latin1":
+		return n, nil
+	case "iso88591", "l1":
+		return "latin1", nil
+	}
+	return "", fmt.Errorf("unsupported ENCODING %q (want utf8, utf16, utf16le, utf16be, latin1 or auto)", name)
+}
+
+// sniffCsvEncoding guesses the encoding of the start of a file, and returns
+// the length of its byte order mark. Without one, ASCII text in UTF-16 shows
+// as zero bytes at every other position; text that is not valid UTF-8 is
+// taken for Latin-1.
+func sniffCsvEncoding(sample []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf8", 3
+	case bytes.HasPrefix(sample, []byte{0xFF, 0xFE}):
+		return "utf16le", 2
+	case bytes.HasPrefix(sample, []byte{0xFE, 0xFF}):
+		return "utf16be", 2
+	}
+
+	var evenZeros, oddZeros int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case pairs > 0 && oddZeros > pairs/3 && evenZeros < pairs/10:
+		return "utf16le", 0
+	case pairs > 0 && evenZeros > pairs/3 && oddZeros < pairs/10:
+		return "utf16be", 0
+	}
+
+	// A sample cut short may end inside a character
+	text := sample
+	if len(text) == csvDialectSampleBytes {
+		if i := bytes.LastIndexByte(text, '\n'); i >= 0 {
+			text = text[:i]
+		}
+	}
+	if utf8.Valid(text) {
+		return "utf8", 0
+	}
+	return "latin1", 0
+}
+
+// decodeCsvText returns the text of a CSV file as UTF-8, skipping a byte
+// order mark, and the length of the mark skipped
+func decodeCsvText(r io.Reader, encoding string) (io.Reader, int64, error) {
+	src := bufio.NewReader(r)
+	mark, _ := src.Peek(3)
+	switch encoding {
+	case "utf8":
+		if bytes.HasPrefix(mark, []byte{0xEF, 0xBB, 0xBF}) {
+			_, _ = src.Discard(3)
+			return src, 3, nil
+		}
+		return src, 0, nil
+	case "latin1":
+		return &csvTextDecoder{src: src, next: nextLatin1}, 0, nil
+	case "utf16", "utf16le", "utf16be":
+		bigEndian := encoding == "utf16be"
+		var skipped int64
+		switch {
+		case bytes.HasPrefix(mark, []byte{0xFF, 0xFE}):
+			bigEndian, skipped = false, 2
+		case bytes.HasPrefix(mark, []byte{0xFE, 0xFF}):
+			bigEndian, skipped = true, 2
+		}
+		_, _ = src.Discard(int(skipped))
+		return &csvTextDecoder{src: src, next: nextUTF16(bigEndian)}, skipped, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// csvTextDecoder converts text in another encoding to UTF-8, a character at
+// a time
+type csvTextDecoder struct {
+	src     *bufio.Reader
+	next    func(*bufio.Reader) (rune, error)
+	pending []byte
+	err     error
+}
+
+func (d *csvTextDecoder) Read(p []byte) (int, error) {
+	for len(d.pending) < len(p) && d.err == nil {
+		r, err := d.next(d.src)
+		if err != nil {
+			d.err = err
+			break
+		}
+		d.pending = utf8.AppendRune(d.pending, r)
+	}
+	n := copy(p, d.pending)
+	d.pending = append(d.pending[:0], d.pending[n:]...)
+	if n == 0 && d.err != nil {
+		return 0, d.err
+	}
+	return n, nil
+}
+
+func nextLatin1(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	return rune(b), err
+}
+
+// nextUTF16 reads UTF-16 code units; an unpaired surrogate reads as U+FFFD
+func nextUTF16(bigEndian bool) func(*bufio.Reader) (rune, error) {
+	unit := func(b []byte) uint16 {
+		if bigEndian {
+			return uint16(b[0])<<8 | uint16(b[1])
+		}
+		return uint16(b[1])<<8 | uint16(b[0])
+	}
+	return func(src *bufio.Reader) (rune, error) {
+		var buf [2]byte
+		if _, err := io.ReadFull(src, buf[:]); err != nil {
+			return 0, err
+		}
+		first := rune(unit(buf[:]))
+		if !utf16.IsSurrogate(first) {
+			return first, nil
+		}
+		next, err := src.Peek(2)
+		if err != nil {
+			return utf8.RuneError, nil
+		}
+		if r := utf16.DecodeRune(first, rune(unit(next))); r != utf8.RuneError {
+			_, _ = src.Discard(2)
+			return r, nil
+		}
+		return utf8.RuneError, nil
+	}
+}
+
+// quoteSwapReader swaps ' and " in its input, so encoding/csv, which only
+// knows ", reads a file quoted with '. copyCSVReader swaps them back in the
+// fields read.
+type quoteSwapReader struct {
+	r io.Reader
+}
+
+func (q quoteSwapReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	swapQuoteBytes(p[:n])
+	return n, err
+}
+
+func swapQuoteBytes(p []byte) {
+	for i, b := range p {
+		switch b {
+		case '\'':
+			p[i] = '"'
+		case '"':
+			p[i] = '\''
+		}
+	}
+}
+
+func swapQuotes(s string) string {
+	if !strings.ContainsAny(s, `'"`) {
+		return s
+	}
+	b := []byte(s)
+	swapQuoteBytes(b)
+	return string(b)
+}
+
+// copyCSVReader reads the records of a COPY FROM file in its dialect
+type copyCSVReader struct {
+	*csv.Reader
+	encoding   string
+	bom        int64 // Length of the byte order mark skipped
+	swapQuotes bool  // QUOTE is ': the input has ' and " swapped
+}
+
+// Read returns the next record
+func (r *copyCSVReader) Read() ([]string, error) {
+	record, err := r.Reader.Read()
+	if r.swapQuotes {
+		for i, field := range record {
+			record[i] = swapQuotes(field)
+		}
+	}
+	return record, err
+}
+
+// Offset returns the bytes of the file read, for UTF-8 files
+func (r *copyCSVReader) Offset() int64 {
+	return r.bom + r.InputOffset()
+}
+
+// newCopyCSVReader returns a reader of the CSV records of a COPY FROM file,
+// in the ENCODING, QUOTE and DELIMITER of options
+func newCopyCSVReader(r io.Reader, options map[string]string) (*copyCSVReader, error) {
+	encoding, err := normalizeCsvEncoding(options["ENCODING"])
+	if err != nil {
+		return nil, err
+	}
+	text, bom, err := decodeCsvText(r, encoding)
+	if err != nil {
+		return nil, err
+	}
+	quote := options["QUOTE"]
+	swap := quote == "'"
+	if swap {
+		text = quoteSwapReader{r: text}
+	}
+
+	csvReader := csv.NewReader(text)
+	if delimiter := options["DELIMITER"]; delimiter != "" {
+		csvReader.Comma = rune(delimiter[0])
+	}
+	if quote != "" {
+		csvReader.LazyQuotes = true
+	}
+	return &copyCSVReader{Reader: csvReader, encoding: encoding, bom: bom, swapQuotes: swap}, nil
+}
+
+// resolveCsvDialect detects the DELIMITER, QUOTE, ENCODING and HEADER options
+// set to "auto" and puts the detected values in options. It returns nil when
+// none of them is.
+func resolveCsvDialect(session *db.Session, table, path string, options map[string]string) (*CsvDialect, error) {
+	if autoCsvOption(options) == "" {
+		return nil, nil
+	}
+	dialect, err := detectCsvDialect(session, table, path, options)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range dialect.Options {
+		options[key] = value
+	}
+	return dialect, nil
+}
+
+// detectCsvDialect detects the dialect of a CSV file from a sample of it.
+// Options given in options, and not "auto", are taken as they are.
+func detectCsvDialect(session *db.Session, table, path string, options map[string]string) (*CsvDialect, error) {
+	file, err := os.Open(path) // #nosec G304 - user-provided path
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+	sample := make([]byte, csvDialectSampleBytes)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	sample = sample[:n]
+
+	dialect := &CsvDialect{Detected: []string{}, Options: make(map[string]string)}
+	given := func(key string) bool {
+		if isAutoOption(options[key]) {
+			dialect.Detected = append(dialect.Detected, key)
+			return false
+		}
+		return true
+	}
+
+	// Encoding
+	sniffed, bom := sniffCsvEncoding(sample)
+	dialect.Encoding, dialect.BOM = sniffed, bom > 0
+	if given("ENCODING") {
+		if dialect.Encoding, err = normalizeCsvEncoding(options["ENCODING"]); err != nil {
+			return nil, err
+		}
+		if dialect.Encoding == "utf16" {
+			dialect.Encoding = "utf16le"
+			if sniffed == "utf16be" {
+				dialect.Encoding = sniffed
+			}
+		}
+		dialect.BOM = bom > 0 && sniffed == dialect.Encoding
+	} else if sniffed == "latin1" {
+		dialect.Warnings = append(dialect.Warnings, "the file is not valid UTF-8; it is read as Latin-1 (ISO-8859-1)")
+	}
+	textReader, _, err := decodeCsvText(bytes.NewReader(sample), dialect.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	decoded, _ := io.ReadAll(textReader) // A sample cut short may end inside a character
+	text := string(decoded)
+	if n == csvDialectSampleBytes {
+		// Leave out the last line, which the sample may have cut short
+		if i := strings.LastIndexByte(text, '\n'); i > 0 {
+			text = text[:i+1]
+		}
+	}
+
+	// Quote, then delimiter
+	dialect.Quote = options["QUOTE"]
+	if !given("QUOTE") {
+		dialect.Quote = detectCsvQuote(text)
+	}
+	delimiters := csvDialectDelimiters
+	if given("DELIMITER") {
+		delimiters = []string{options["DELIMITER"]}
+	}
+	var records [][]string
+	best := -1.0
+	for _, delimiter := range delimiters {
+		candidate, fields, consistency := sampleCsvRecords(text, delimiter, dialect.Quote)
+		score := consistency
+		if fields < 2 {
+			score /= 2 // A delimiter that splits nothing is a last resort
+		}
+		if score > best || (score == best && fields > dialect.Fields) {
+			best = score
+			records = candidate
+			dialect.Delimiter, dialect.Fields, dialect.Consistency = delimiter, fields, consistency
+		}
+	}
+	dialect.SampledRows = len(records)
+	if dialect.SampledRows > 1 && dialect.Consistency < 0.9 {
+		dialect.Warnings = append(dialect.Warnings, fmt.Sprintf("only %.0f%% of the sampled records have %d fields; check the delimiter and quote",
+			dialect.Consistency*100, dialect.Fields))
+	}
+
+	// Header
+	if given("HEADER") {
+		dialect.Header = strings.EqualFold(options["HEADER"], "true")
+	} else {
+		var reason string
+		dialect.Header, dialect.HeaderColumns, reason = detectCsvHeader(session, table, records, options["NULLVAL"])
+		if reason != "" {
+			dialect.Warnings = append(dialect.Warnings, reason)
+		}
+	}
+
+	dialect.Options["ENCODING"] = dialect.Encoding
+	dialect.Options["QUOTE"] = dialect.Quote
+	dialect.Options["DELIMITER"] = dialect.Delimiter
+	dialect.Options["HEADER"] = strconv.FormatBool(dialect.Header)
+	return dialect, nil
+}
+
+// detectCsvQuote picks the quote character found more often next to a field
+// boundary (the start or end of a line, or a delimiter), " on a tie
+func detectCsvQuote(text string) string {
+	boundary := func(b byte) bool {
+		return b == '\n' || b == '\r' || strings.IndexByte(",;\t|:^", b) >= 0
+	}
+	count := func(q byte) int {
+		n := 0
+		for i := 0; i < len(text); i++ {
+			if text[i] != q {
+				continue
+			}
+			if i == 0 || boundary(text[i-1]) || i == len(text)-1 || boundary(text[i+1]) {
+				n++
+			}
+		}
+		return n
+	}
+	if count('\'') > count('"') {
+		return "'"
+	}
+	return `"`
+}
+
+// sampleCsvRecords parses the sampled text with a delimiter and quote. It
+// returns the records, the number of fields most of them have, and the share
+// of records having it; records that fail to parse count against it.
+func sampleCsvRecords(text, delimiter, quote string) ([][]string, int, float64) {
+	if delimiter == "" {
+		return nil, 0, 0
+	}
+	var r io.Reader = strings.NewReader(text)
+	if quote == "'" {
+		r = quoteSwapReader{r: r}
+	}
+	csvReader := csv.NewReader(r)
+	csvReader.Comma = rune(delimiter[0])
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true // As the import reads them
+
+	var records [][]string
+	counts := make(map[int]int)
+	failed := 0
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				break
+			}
+			failed++
+			continue
+		}
+		if quote == "'" {
+			for i, field := range record {
+				record[i] = swapQuotes(field)
+			}
+		}
+		records = append(records, record)
+		counts[len(record)]++
+	}
+
+	fields, most := 0, 0
+	for n, c := range counts {
+		if c > most || (c == most && n > fields) {
+			fields, most = n, c
+		}
+	}
+	total := len(records) + failed
+	if total == 0 {
+		return records, fields, 0
+	}
+	return records, fields, float64(most) / float64(total)
+}
+
+// detectCsvHeader decides whether the first sampled record is a header. With
+// a table, it is when most of its fields name the table's columns, or when a
+// column's type rejects its value but accepts most values below it. Without
+// one, or when the table cannot be read, it is when a field is not a number
+// while the values below it are. It returns the fields naming columns and,
+// when the table was not used, why.
+func detectCsvHeader(session *db.Session, table string, records [][]string, nullVal string) (bool, int, string) {
+	if len(records) == 0 {
+		return false, 0, ""
+	}
+	first, rest := records[0], records[1:]
+
+	var reason string
+	var coercers []*db.Coercer
+	if session != nil && table != "" {
+		keyspace, tableName := splitTableName(table, session.Keyspace())
+		meta, err := session.GetTableMetadata(keyspace, tableName)
+		if err != nil {
+			reason = fmt.Sprintf("header detected without the schema of %s: %v", table, err)
+		} else {
+			header := make([]string, len(first))
+			for i, field := range first {
+				header[i] = cleanCsvHeader(field)
+			}
+			named := 0
+			for _, match := range matchCsvColumns(header, meta) {
+				if match.Column != "" && match.Match != "fuzzy" {
+					named++
+				}
+			}
+			if named > 0 && named*2 >= len(first) {
+				return true, named, ""
+			}
+
+			// Without a header, fields are read in the order of the table's columns
+			columns := getTableColumns(session, table)
+			coercers = make([]*db.Coercer, len(first))
+			for i := range first {
+				if i >= len(columns) {
+					break
+				}
+				if col, ok := meta.Columns[columns[i]]; ok {
+					coercers[i], _ = db.NewCoercer(col.Validator)
+				}
+			}
+			return headerByValues(first, rest, nullVal, func(i int, value string) bool {
+				if coercers[i] == nil {
+					return true
+				}
+				_, err := coercers[i].Coerce(value)
+				return err == nil
+			}), named, ""
+		}
+	}
+
+	isNumber := func(_ int, value string) bool {
+		_, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return err == nil
+	}
+	return headerByValues(first, rest, nullVal, isNumber), 0, reason
+}
+
+// headerByValues reports whether a value of first does not fit its field
+// while at least 80% of the values below it do
+func headerByValues(first []string, rest [][]string, nullVal string, fits func(int, string) bool) bool {
+	if len(rest) == 0 {
+		return false
+	}
+	for i, value := range first {
+		if value == "" || value == nullVal || fits(i, value) {
+			continue
+		}
+		checked, passed := 0, 0
+		for _, record := range rest {
+			if i >= len(record) || record[i] == "" || record[i] == nullVal {
+				continue
+			}
+			checked++
+			if fits(i, record[i]) {
+				passed++
+			}
+		}
+		if checked > 0 && passed*5 >= checked*4 {
+			return true
+		}
+	}
+	return false
+}
+
+// detectCsvDialectFile runs DetectCsvDialect
+func detectCsvDialectFile(session *db.Session, params CsvDialectParams) (*CsvDialect, error) {
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	options := mergeCopyOptions(defaultCopyOptions(), params.Options)
+	for _, key := range csvDialectOptions {
+		if !hasOptionKey(params.Options, key) {
+			options[key] = "auto"
+		}
+	}
+	return detectCsvDialect(session, params.Table, cleanPath, options)
+}
+
+// hasOptionKey reports whether options sets key, in any case
+func hasOptionKey(options map[string]string, key string) bool {
+	for k := range options {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
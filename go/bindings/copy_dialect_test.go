@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+// Byte fixtures are built from UTF-8 text so each case reads as what it holds
+
+// utf16Bytes encodes s as UTF-16, with a byte order mark when bom is set
+func utf16Bytes(s string, bigEndian, bom bool) []byte {
+	var order binary.AppendByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	out := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		out = order.AppendUint16(out, u)
+	}
+	return out
+}
+
+// latin1Bytes encodes s, which must only hold runes below U+0100, as Latin-1
+func latin1Bytes(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+func TestSniffCsvEncoding(t *testing.T) {
+	const text = "id;name\n1;Zoë\n2;Ana\n"
+
+	// A full sample whose last line was cut inside a character
+	cut := bytes.Repeat([]byte("a,b\n"), csvDialectSampleBytes/4)
+	cut[len(cut)-1] = 0xc3
+
+	tests := []struct {
+		name   string
+		sample []byte
+		want   string
+		bom    int
+	}{
+		{"utf8", []byte(text), "utf8", 0},
+		{"utf8 bom", append([]byte{0xEF, 0xBB, 0xBF}, text...), "utf8", 3},
+		{"utf16le bom", utf16Bytes(text, false, true), "utf16le", 2},
+		{"utf16be bom", utf16Bytes(text, true, true), "utf16be", 2},
+		{"utf16le", utf16Bytes(text, false, false), "utf16le", 0},
+		{"utf16be", utf16Bytes(text, true, false), "utf16be", 0},
+		{"latin1", latin1Bytes(text), "latin1", 0},
+		{"ascii", []byte("a,b\n1,2\n"), "utf8", 0},
+		{"empty", nil, "utf8", 0},
+		{"sample cut in a character", cut, "utf8", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, bom := sniffCsvEncoding(tt.sample)
+			if got != tt.want || bom != tt.bom {
+				t.Errorf("sniffCsvEncoding = %s, %d; want %s, %d", got, bom, tt.want, tt.bom)
+			}
+		})
+	}
+}
+
+func TestDecodeCsvText(t *testing.T) {
+	const text = "id,name\n1,Zoë 😀\n"
+	tests := []struct {
+		name     string
+		input    []byte
+		encoding string
+		want     string
+		skipped  int64
+	}{
+		{"utf8", []byte(text), "utf8", text, 0},
+		{"utf8 bom", append([]byte{0xEF, 0xBB, 0xBF}, text...), "utf8", text, 3},
+		{"utf16le", utf16Bytes(text, false, false), "utf16le", text, 0},
+		{"utf16be", utf16Bytes(text, true, false), "utf16be", text, 0},
+		{"utf16le bom", utf16Bytes(text, false, true), "utf16le", text, 2},
+		{"bom wins over the byte order given", utf16Bytes(text, true, true), "utf16le", text, 2},
+		{"utf16 without bom is little-endian", utf16Bytes(text, false, false), "utf16", text, 0},
+		{"latin1", latin1Bytes("id,name\n1,Zoë\n"), "latin1", "id,name\n1,Zoë\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, skipped, err := decodeCsvText(bytes.NewReader(tt.input), tt.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// One byte at a time, so a character spans reads
+			got, err := io.ReadAll(iotest.OneByteReader(r))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want || skipped != tt.skipped {
+				t.Errorf("decoded %q skipping %d, want %q skipping %d", got, skipped, tt.want, tt.skipped)
+			}
+		})
+	}
+
+	if _, _, err := decodeCsvText(bytes.NewReader(nil), "ebcdic"); err == nil {
+		t.Error("unknown encoding accepted")
+	}
+}
+
+func TestNextUTF16(t *testing.T) {
+	tests := []struct {
+		name      string
+		units     []uint16
+		bigEndian bool
+		want      string
+	}{
+		{"bmp", []uint16{'a', 0x00E9}, false, "aé"},
+		{"surrogate pair", []uint16{0xD83D, 0xDE00}, false, "😀"},
+		{"surrogate pair big-endian", []uint16{0xD83D, 0xDE00}, true, "😀"},
+		{"unpaired high surrogate", []uint16{0xD83D, 'a'}, false, "\ufffda"},
+		{"lone low surrogate", []uint16{0xDE00, 'a'}, false, "\ufffda"},
+		{"high surrogate at the end", []uint16{'a', 0xD83D}, true, "a\ufffd"},
+		{"bom is a character once skipped", []uint16{0xFEFF, 'a'}, false, "\ufeffa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order binary.AppendByteOrder = binary.LittleEndian
+			if tt.bigEndian {
+				order = binary.BigEndian
+			}
+			var input []byte
+			for _, u := range tt.units {
+				input = order.AppendUint16(input, u)
+			}
+			d := &csvTextDecoder{src: bufio.NewReader(bytes.NewReader(input)), next: nextUTF16(tt.bigEndian)}
+			got, err := io.ReadAll(d)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("decoded %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// A trailing odd byte ends the text with an error
+	d := &csvTextDecoder{src: bufio.NewReader(bytes.NewReader([]byte{'a', 0, 'b'})), next: nextUTF16(false)}
+	if got, err := io.ReadAll(d); string(got) != "a" || err != io.ErrUnexpectedEOF {
+		t.Errorf("odd length: %q, %v", got, err)
+	}
+}
+
+func TestQuoteSwap(t *testing.T) {
+	if got := swapQuotes(`it's "quoted"`); got != `it"s 'quoted'` {
+		t.Errorf("swapQuotes = %q", got)
+	}
+	if s := "plain"; swapQuotes(s) != s {
+		t.Error("swapQuotes changed a string without quotes")
+	}
+
+	swapped, err := io.ReadAll(iotest.HalfReader(quoteSwapReader{r: strings.NewReader(`'a',"b"`)}))
+	if err != nil || string(swapped) != `"a",'b'` {
+		t.Errorf("quoteSwapReader read %q, %v", swapped, err)
+	}
+
+	// Fields quoted with ' keep the " they contain, and '' escapes a quote
+	input := "1,'say \"hi\"'\n2,'it''s'\n3,plain\n"
+	r, err := newCopyCSVReader(strings.NewReader(input), map[string]string{"QUOTE": "'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	want := [][]string{{"1", `say "hi"`}, {"2", "it's"}, {"3", "plain"}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records %q, want %q", records, want)
+	}
+}
+
+func TestDetectCsvQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"double", "\"a\",\"b\"\n\"c\",\"d\"\n", `"`},
+		{"single", "'a','b'\n'c','d'\n", "'"},
+		{"single holding double", "1;'say \"hi\"'\n2;'x'\n", "'"},
+		{"apostrophes inside words", "1,it's fine\n2,don't\n", `"`},
+		{"tab delimited single", "'a'\t'b'\n", "'"},
+		{"no quotes", "a,b\n", `"`},
+		{"tie", "'a\",\n", `"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectCsvQuote(tt.text); got != tt.want {
+				t.Errorf("detectCsvQuote = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleCsvRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		delimiter   string
+		quote       string
+		records     int
+		fields      int
+		consistency float64
+	}{
+		{"semicolon", "a;b;c\n1;2;3\n4;5;6\n", ";", `"`, 3, 3, 1},
+		{"semicolon read with comma", "a;b;c\n1;2;3\n", ",", `"`, 2, 1, 1},
+		{"tab", "a\tb\n1\t2\n3\t4\n", "\t", `"`, 3, 2, 1},
+		{"single quote holding delimiter and double", "1,'a, \"b\"'\n2,'c'\n", ",", "'", 2, 2, 1},
+		{"uneven records", "a,b,c\n1,2,3\n4,5\n6,7,8\n", ",", `"`, 4, 3, 0.75},
+		{"no delimiter", "a,b\n", "", `"`, 0, 0, 0},
+		{"empty", "", ",", `"`, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, fields, consistency := sampleCsvRecords(tt.text, tt.delimiter, tt.quote)
+			if len(records) != tt.records || fields != tt.fields || consistency != tt.consistency {
+				t.Errorf("got %d records, %d fields, %.2f; want %d, %d, %.2f",
+					len(records), fields, consistency, tt.records, tt.fields, tt.consistency)
+			}
+		})
+	}
+
+	// Quotes are swapped back in the fields
+	records, _, _ := sampleCsvRecords("1,'a \"b\"'\n", ",", "'")
+	if len(records) != 1 || records[0][1] != `a "b"` {
+		t.Errorf("records %q", records)
+	}
+}
+
+func TestHeaderByValues(t *testing.T) {
+	isNumber := func(_ int, value string) bool {
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	}
+	tests := []struct {
+		name    string
+		first   []string
+		rest    [][]string
+		nullVal string
+		want    bool
+	}{
+		{"header", []string{"id", "name"}, [][]string{{"1", "a"}, {"2", "b"}}, "", true},
+		{"numbers", []string{"1", "a"}, [][]string{{"2", "b"}}, "", false},
+		{"no rows below", []string{"id", "name"}, nil, "", false},
+		{"values below do not fit either", []string{"id"}, [][]string{{"x"}, {"y"}}, "", false},
+		{"80% fit", []string{"id"}, [][]string{{"1"}, {"2"}, {"3"}, {"4"}, {"x"}}, "", true},
+		{"60% fit", []string{"id"}, [][]string{{"1"}, {"2"}, {"3"}, {"x"}, {"y"}}, "", false},
+		{"null value is not a header", []string{"NULL", "b"}, [][]string{{"1", "c"}}, "NULL", false},
+		{"empty and null values below are skipped", []string{"id"}, [][]string{{""}, {"NULL"}, {"1"}}, "NULL", true},
+		{"short records below", []string{"a", "id"}, [][]string{{"x"}, {"y", "2"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := headerByValues(tt.first, tt.rest, tt.nullVal, isNumber); got != tt.want {
+				t.Errorf("headerByValues = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCsvDialectFixtures(t *testing.T) {
+	auto := func() map[string]string {
+		return map[string]string{"ENCODING": "auto", "QUOTE": "auto", "DELIMITER": "auto", "HEADER": "auto"}
+	}
+	tests := []struct {
+		name   string
+		file   []byte
+		want   CsvDialect
+		warned bool
+	}{
+		{
+			name: "utf16le bom semicolon header",
+			file: utf16Bytes("id;name\n1;Zoë\n2;Ana\n3;Bo\n", false, true),
+			want: CsvDialect{Encoding: "utf16le", BOM: true, Delimiter: ";", Quote: `"`, Header: true, Fields: 2, SampledRows: 4, Consistency: 1},
+		},
+		{
+			name: "utf16be tab no header",
+			file: utf16Bytes("1\tZoë\n2\tAna\n", true, false),
+			want: CsvDialect{Encoding: "utf16be", Delimiter: "\t", Quote: `"`, Fields: 2, SampledRows: 2, Consistency: 1},
+		},
+		{
+			name:   "latin1 comma header",
+			file:   latin1Bytes("id,city\n1,Málaga\n2,Zürich\n"),
+			want:   CsvDialect{Encoding: "latin1", Delimiter: ",", Quote: `"`, Header: true, Fields: 2, SampledRows: 3, Consistency: 1},
+			warned: true,
+		},
+		{
+			name: "single quoted fields holding double quotes",
+			file: []byte("1,'say \"hi\", twice'\n2,'it''s'\n3,'x'\n"),
+			want: CsvDialect{Encoding: "utf8", Delimiter: ",", Quote: "'", Fields: 2, SampledRows: 3, Consistency: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.csv")
+			if err := os.WriteFile(path, tt.file, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := detectCsvDialect(nil, "", path, auto())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(got.Warnings) > 0) != tt.warned {
+				t.Errorf("warnings %q", got.Warnings)
+			}
+			if !reflect.DeepEqual(got.Detected, csvDialectOptions) {
+				t.Errorf("detected %v, want all of %v", got.Detected, csvDialectOptions)
+			}
+			got.Warnings, got.Detected, got.Options = nil, nil, nil
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("dialect %+v\nwant    %+v", *got, tt.want)
+			}
+		})
+	}
+
+	// Options given are kept as they are
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte("a;b\n1;2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	options := auto()
+	options["DELIMITER"], options["HEADER"] = ",", "false"
+	got, err := detectCsvDialect(nil, "", path, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Delimiter != "," || got.Header || !reflect.DeepEqual(got.Detected, []string{"ENCODING", "QUOTE"}) {
+		t.Errorf("given options not kept: %+v", got)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build integration
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axonops/cqlai-node/testkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyCall runs CopyTo or CopyFrom with params
+func copyCall(t *testing.T, fn func(handle int, params string) string, handle int, params CopyParams) string {
+	t.Helper()
+	paramsJSON, err := json.Marshal(params)
+	require.NoError(t, err)
+	return fn(handle, string(paramsJSON))
+}
+
+func copyTo(handle int, params string) string   { return callHandle(CopyTo, handle, params) }
+func copyFrom(handle int, params string) string { return callHandle(CopyFrom, handle, params) }
+
+func TestCopyRoundTrip(t *testing.T) {
+	cluster := testkit.Require(t)
+	const columns = "id int PRIMARY KEY, name text, score double, tags set<text>, seen timestamp"
+	stmts := []string{
+		"CREATE TABLE source (" + columns + ")",
+		"CREATE TABLE target (" + columns + ")",
+		"INSERT INTO source (id, name, score, tags, seen) VALUES (0, 'comma, and \"quotes\"', 1.5, {'a', 'b'}, '2024-01-15 10:30:00+0000')",
+		"INSERT INTO source (id, name) VALUES (1, null)",
+	}
+	for id := 2; id < 50; id++ {
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO source (id, name, score) VALUES (%d, 'row %d', %d.25)", id, id, id))
+	}
+	ks := cluster.Keyspace(t, stmts...)
+	handle := connect(t, cluster, ks, nil)
+	file := filepath.Join(t.TempDir(), "source.csv")
+
+	raw := copyCall(t, copyTo, handle, CopyParams{Table: "source", Filename: file, Options: map[string]string{"HEADER": "true"}})
+	testkit.Golden(t, "copy_to", raw)
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"comma, and ""quotes"""`)
+
+	raw = copyCall(t, copyFrom, handle, CopyParams{Table: "target", Filename: file, Options: map[string]string{"HEADER": "true"}})
+	var imported CopyResult
+	testkit.Data(t, raw, &imported)
+	assert.EqualValues(t, 50, imported.RowsImported)
+	assert.Zero(t, imported.Errors)
+	assert.Zero(t, imported.ParseErrors)
+
+	// Both tables hold the same rows
+	var source, target QueryResult
+	testkit.Data(t, query(t, handle, "SELECT * FROM source"), &source)
+	testkit.Data(t, query(t, handle, "SELECT * FROM target"), &target)
+	assert.Equal(t, 50, target.RowCount)
+	assert.ElementsMatch(t, source.Rows, target.Rows)
+}
+
+func TestCopyFromParseErrors(t *testing.T) {
+	cluster := testkit.Require(t)
+	ks := cluster.Keyspace(t, "CREATE TABLE nums (id int PRIMARY KEY, n int)")
+	handle := connect(t, cluster, ks, nil)
+	file := filepath.Join(t.TempDir(), "nums.csv")
+	require.NoError(t, os.WriteFile(file, []byte("id,n\n1,10\n2,not a number\n3,30\n"), 0o644))
+
+	raw := copyCall(t, copyFrom, handle, CopyParams{Table: "nums", Filename: file, Options: map[string]string{"HEADER": "true"}})
+	var result CopyResult
+	testkit.Data(t, raw, &result)
+	assert.EqualValues(t, 2, result.RowsImported)
+	assert.Equal(t, 1, result.ParseErrors)
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// JSON COPY formats
+//
+// CSV flattens maps, sets and user types into text that does not always read
+// back as the same value. The JSON formats let Cassandra do the conversion
+// both ways: COPY TO runs SELECT JSON, so every row is written as the server
+// encodes it, and COPY FROM sends each object to INSERT ... JSON, so the
+// server decodes it against the column types. A file written by COPY TO
+// therefore imports back unchanged, collections and user types included.
+
+// COPY file formats
+const (
+	copyCSV   = "csv"
+	copyJSON  = "json"  // One JSON array of row objects
+	copyJSONL = "jsonl" // One row object per line
+)
+
+// selectKeywordPattern matches the SELECT keyword of a query, and JSON when
+// the query already selects it
+var selectKeywordPattern = regexp.MustCompile(`(?is)^\s*SELECT\s+(JSON\s+)?`)
+
+// copyFormat returns the file format of a COPY: params.Format, else the FORMAT
+// option, else CSV
+func copyFormat(params CopyParams, options map[string]string) (string, error) {
+	format := params.Format
+	if format == "" {
+		format = options["FORMAT"]
+	}
+	switch format = strings.ToLower(strings.TrimSpace(format)); format {
+	case "":
+		return copyCSV, nil
+	case copyCSV, copyJSON, copyJSONL, copyParquet:
+		return format, nil
+	case "ndjson":
+		return copyJSONL, nil
+	}
+	return "", fmt.Errorf("unknown format %q: use csv, json, jsonl or parquet", format)
+}
+
+// executeCopyToJSON exports rows as the server encodes them with SELECT JSON.
+// HEADER, DELIMITER and NULLVAL do not apply; nulls are written as null.
+func executeCopyToJSON(ctx context.Context, session *db.Session, params CopyParams, options map[string]string, job *copyJob, format string) (*CopyResult, error) {
+	var query string
+	if params.Query != "" {
+		query = selectKeywordPattern.ReplaceAllString(params.Query, "SELECT JSON ")
+	} else if len(params.Columns) > 0 {
+		query = fmt.Sprintf("SELECT JSON %s FROM %s", strings.Join(params.Columns, ", "), params.Table)
+	} else {
+		query = fmt.Sprintf("SELECT JSON * FROM %s", params.Table)
+	}
+
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	file, err := os.Create(cleanPath) // #nosec G304 - user-provided path
+	if err != nil {
+		return nil, fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+	out := bufio.NewWriter(job.writer(file))
+
+	maxRows, _ := strconv.Atoi(options["MAXROWS"])
+	pageSize, _ := strconv.Atoi(options["PAGESIZE"])
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
+	var iter *db.StreamingQueryResult
+	switch v := session.ExecuteStreamingQuery(query).(type) {
+	case db.StreamingQueryResult:
+		iter = &v
+	case error:
+		return nil, fmt.Errorf("query error: %v", v)
+	default:
+		return nil, fmt.Errorf("query returned no rows to export")
+	}
+	defer iter.Iterator.Close()
+
+	// The array is closed even when the export stops early, so the file
+	// stays valid JSON
+	finish := func(rowCount int64) error {
+		if format == copyJSON {
+			if rowCount > 0 {
+				out.WriteString("\n")
+			}
+			out.WriteString("]\n")
+		}
+		if err := out.Flush(); err != nil {
+			return fmt.Errorf("error writing file: %v", err)
+		}
+		return nil
+	}
+	if format == copyJSON {
+		out.WriteString("[")
+	}
+
+	rowCount := int64(0)
+	var line string
+	for {
+		if maxRows != -1 && rowCount >= int64(maxRows) {
+			break
+		}
+		if ctx.Err() != nil {
+			if err := finish(rowCount); err != nil {
+				return nil, err
+			}
+			return &CopyResult{RowsExported: rowCount}, fmt.Errorf("export cancelled after %d rows", rowCount)
+		}
+		if !iter.Iterator.Scan(&line) {
+			break
+		}
+
+		switch {
+		case format == copyJSONL:
+		case rowCount > 0:
+			out.WriteString(",\n")
+		default:
+			out.WriteString("\n")
+		}
+		out.WriteString(line)
+		if format == copyJSONL {
+			out.WriteString("\n")
+		}
+		rowCount++
+		job.addRow()
+
+		if rowCount%int64(pageSize) == 0 {
+			if err := out.Flush(); err != nil {
+				return nil, fmt.Errorf("error writing file: %v", err)
+			}
+		}
+	}
+	if err := iter.Iterator.Close(); err != nil {
+		return nil, fmt.Errorf("query error after %d rows: %v", rowCount, err)
+	}
+	if err := finish(rowCount); err != nil {
+		return nil, err
+	}
+	return &CopyResult{RowsExported: rowCount}, nil
+}
+
+// copyRowSource returns the rows of a COPY FROM file as JSON objects, with
+// the errors of jsonRowReader.next
+type copyRowSource interface {
+	next() ([]byte, error)
+}
+
+// jsonRowReader reads the row objects of a JSON or JSONL file
+type jsonRowReader struct {
+	lines  *bufio.Reader // JSONL
+	dec    *json.Decoder // JSON array
+	began  bool
+	offset int64 // JSONL: bytes of the file read, up to the end of the last line
+}
+
+// Errors reading a row object
+var (
+	errJSONRow    = errors.New("invalid row")  // The row is skipped
+	errJSONSyntax = errors.New("invalid JSON") // Nothing after it can be read
+)
+
+// next returns the next row object, compacted. A row that is not a JSON
+// object wraps errJSONRow and reading goes on with the next one; a syntax
+// error between the elements of a JSON array wraps errJSONSyntax.
+func (r *jsonRowReader) next() ([]byte, error) {
+	if r.dec != nil {
+		return r.nextElement()
+	}
+	for {
+		line, err := r.lines.ReadBytes('\n')
+		r.offset += int64(len(line))
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return compactJSONRow(line)
+	}
+}
+
+// nextElement returns the next element of the JSON array
+func (r *jsonRowReader) nextElement() ([]byte, error) {
+	if !r.began {
+		r.began = true
+		tok, err := r.dec.Token()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if delim, ok := tok.(json.Delim); err != nil || !ok || delim != '[' {
+			return nil, fmt.Errorf("%w: a json file must hold an array of row objects; use jsonl for one object per line", errJSONSyntax)
+		}
+	}
+	if !r.dec.More() {
+		return nil, io.EOF
+	}
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", errJSONSyntax, err)
+	}
+	return compactJSONRow(raw)
+}
+
+// compactJSONRow checks that data is a JSON object and removes its whitespace
+func compactJSONRow(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, fmt.Errorf("%w: %v", errJSONRow, err)
+	}
+	if buf.Len() == 0 || buf.Bytes()[0] != '{' {
+		return nil, fmt.Errorf("%w: not a JSON object", errJSONRow)
+	}
+	return buf.Bytes(), nil
+}
+
+// executeCopyFromJSON imports row objects with INSERT ... JSON, which converts
+// each field to its column's type on the server. Columns left out of an object
+// are written as null, or left unset with UNSETNULLS. Parquet rows are read as
+// row objects too (see copy_parquet.go).
+func executeCopyFromJSON(handle int, session *db.Session, params CopyParams, options map[string]string, format string) (*CopyResult, error) {
+	if len(params.Columns) > 0 || params.Mapping != nil {
+		return nil, fmt.Errorf("columns and mapping apply to CSV files only; the fields of each JSON object name its columns")
+	}
+
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	file, err := os.Open(cleanPath) // #nosec G304 - user-provided path
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	// With resume, carry on from the checkpoint of an earlier import (JSONL
+	// only, see copy_checkpoint.go)
+	var checkpoint *copyCheckpointer
+	var checkpointPath string
+	var resumedFrom int64
+	if params.Resume {
+		if format != copyJSONL {
+			return nil, fmt.Errorf("resume applies to CSV and JSONL files")
+		}
+		if checkpointPath, err = copyCheckpointPath(params.Filename, params.CheckpointFile); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint path: %v", err)
+		}
+		cp, err := startCopyCheckpoint(checkpointPath, file, cleanPath, params.Table, format, nil)
+		if err != nil {
+			return nil, err
+		}
+		if cp.Completed {
+			return &CopyResult{Checkpoint: checkpointPath, Warnings: []string{completedCheckpointWarning(cp)}}, nil
+		}
+		if cp.Offset > 0 {
+			if _, err := file.Seek(cp.Offset, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("cannot resume at offset %d: %v", cp.Offset, err)
+			}
+			resumedFrom = cp.Offset
+		}
+		chunkSize, _ := strconv.Atoi(options["CHUNKSIZE"])
+		if chunkSize <= 0 {
+			chunkSize = 5000
+		}
+		checkpoint = newCopyCheckpointer(checkpointPath, *cp, chunkSize)
+	}
+
+	var reader copyRowSource
+	var lines *jsonRowReader
+	switch format {
+	case copyJSON:
+		reader = &jsonRowReader{dec: json.NewDecoder(bufio.NewReader(file))}
+	case copyParquet:
+		if reader, err = newParquetRowReader(file); err != nil {
+			return nil, fmt.Errorf("error reading file: %v", err)
+		}
+	default:
+		lines = &jsonRowReader{lines: bufio.NewReader(file), offset: resumedFrom}
+		reader = lines
+	}
+	offset := func() int64 {
+		if lines == nil {
+			return 0
+		}
+		return lines.offset
+	}
+
+	maxRows, _ := strconv.Atoi(options["MAXROWS"])
+	skipRows, _ := strconv.Atoi(options["SKIPROWS"])
+	maxParseErrors, _ := strconv.Atoi(options["MAXPARSEERRORS"])
+	maxInsertErrors, _ := strconv.Atoi(options["MAXINSERTERRORS"])
+	maxBatchSize, _ := strconv.Atoi(options["MAXBATCHSIZE"])
+	maxRequests, _ := strconv.Atoi(options["MAXREQUESTS"])
+	maxAttempts, _ := strconv.Atoi(options["MAXATTEMPTS"])
+	if maxBatchSize <= 0 {
+		maxBatchSize = 20
+	}
+	if maxRequests < 1 {
+		maxRequests = 6
+	}
+	if resumedFrom > 0 {
+		skipRows = 0 // Skipped before the checkpoint
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s JSON ?", params.Table)
+	if strings.ToLower(options["UNSETNULLS"]) == "true" {
+		insert += " DEFAULT UNSET"
+	}
+
+	workers := startCopyWorkers(handle, session, maxRequests, maxAttempts)
+	workers.checkpoint = checkpoint
+	batch := make([]batchEntry, 0, maxBatchSize)
+	processedRows := 0
+	parseErrorCount := 0
+	skippedRows := 0
+
+	result := func() *CopyResult {
+		return &CopyResult{
+			RowsImported: workers.rows.Load(),
+			Errors:       workers.errors.Load(),
+			ParseErrors:  parseErrorCount,
+			SkippedRows:  skippedRows,
+			Warnings:     workers.warnings(),
+			Batches:      workers.batches.Load(),
+			Retries:      workers.retries.Load(),
+			Checkpoint:   checkpointPath,
+			ResumedFrom:  resumedFrom,
+		}
+	}
+
+	complete := true // The whole file was read
+	for {
+		row, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, errJSONRow) {
+			workers.wait()
+			return result(), fmt.Errorf("error reading file: %v", err)
+		}
+		if skippedRows < skipRows {
+			skippedRows++
+			checkpoint.read(offset(), false, false)
+			if checkpoint != nil {
+				checkpoint.state.SkippedRows = skippedRows
+			}
+			continue
+		}
+		if err != nil {
+			parseErrorCount++
+			if maxParseErrors != -1 && parseErrorCount > maxParseErrors {
+				workers.wait()
+				return result(), fmt.Errorf("too many parse errors (%d)", parseErrorCount)
+			}
+			checkpoint.read(offset(), false, true)
+			continue
+		}
+		if maxRows != -1 && processedRows >= maxRows {
+			complete = false
+			break
+		}
+		processedRows++
+
+		chunk := checkpoint.read(offset(), true, false)
+		batch = append(batch, batchEntry{query: insert, values: []interface{}{string(row)}, chunk: chunk})
+		if len(batch) >= maxBatchSize {
+			if maxInsertErrors != -1 && workers.errors.Load() > int64(maxInsertErrors) {
+				workers.wait()
+				return result(), fmt.Errorf("too many insert errors (%d)", workers.errors.Load())
+			}
+			workers.send(batch)
+			batch = batch[:0]
+		}
+	}
+
+	workers.send(batch)
+	workers.wait()
+	checkpoint.finish(offset(), complete)
+
+	res := result()
+	if warning := checkpoint.warning(); warning != "" {
+		res.Warnings = append(res.Warnings, warning)
+	}
+	return res, nil
+}
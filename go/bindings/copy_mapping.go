@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Sample limits for PlanCsvMapping type checks
+const (
+	defaultMappingSampleRows = 100
+	maxMappingSampleRows     = 10000
+)
+
+// CsvMappingParams represents the input to PlanCsvMapping
+type CsvMappingParams struct {
+	Table      string            `json:"table"`
+	Filename   string            `json:"filename"`
+	Options    map[string]string `json:"options,omitempty"`    // COPY options; DELIMITER, QUOTE, SKIPROWS and NULLVAL apply
+	SampleRows int               `json:"sampleRows,omitempty"` // Data rows checked against the column types (default 100)
+}
+
+// CsvColumnMatch is how one header field maps to a table column
+type CsvColumnMatch struct {
+	Index  int     `json:"index"`            // Field position in the header
+	Header string  `json:"header"`           // Header field as written
+	Column string  `json:"column,omitempty"` // Matched table column; empty when unmapped
+	Type   string  `json:"type,omitempty"`   // CQL type of the column
+	Match  string  `json:"match,omitempty"`  // exact, case-insensitive, normalized or fuzzy
+	Score  float64 `json:"score,omitempty"`  // 1 for exact matches, lower for looser ones
+
+	// Type compatibility of the sampled values with the column
+	Sampled      int    `json:"sampled"`
+	Invalid      int    `json:"invalid"`
+	Nulls        int    `json:"nulls"`
+	Compatible   bool   `json:"compatible"`
+	InvalidValue string `json:"invalidValue,omitempty"` // First value the column type rejected
+	InvalidError string `json:"invalidError,omitempty"`
+}
+
+// CsvMappingPlan is the result of PlanCsvMapping. Mapping can be edited and
+// passed to CopyFrom as params.mapping.
+type CsvMappingPlan struct {
+	Keyspace          string            `json:"keyspace"`
+	Table             string            `json:"table"`
+	Header            []string          `json:"header"`
+	Columns           []CsvColumnMatch  `json:"columns"`
+	Mapping           map[string]string `json:"mapping"`           // Header field -> table column
+	UnmappedHeaders   []string          `json:"unmappedHeaders"`   // Header fields matching no column; skipped on import
+	MissingColumns    []string          `json:"missingColumns"`    // Table columns no header field maps to
+	MissingKeyColumns []string          `json:"missingKeyColumns"` // Primary key columns among them; the import cannot run
+	SampledRows       int               `json:"sampledRows"`
+	Ready             bool              `json:"ready"`             // All key columns are mapped and every sampled value fits its column
+	Dialect           *CsvDialect       `json:"dialect,omitempty"` // Detected for options set to "auto"
+}
+
+// csvMatchKinds orders the match kinds from most to least certain
+var csvMatchKinds = []string{"exact", "case-insensitive", "normalized", "fuzzy"}
+
+// normalizeCsvName reduces a column name to lower-case letters and digits, so
+// "Customer ID", "customer_id" and "customerId" compare equal
+func normalizeCsvName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// cleanCsvHeader trims a header field and drops the (PK) and (C) markers
+// COPY TO writes after key columns
+func cleanCsvHeader(field string) string {
+	field = strings.TrimSpace(field)
+	field = strings.TrimSuffix(field, " (PK)")
+	field = strings.TrimSuffix(field, " (C)")
+	return strings.TrimSpace(field)
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// matchCsvHeader scores how well a header field names a column. It returns
+// the match kind and a score in (0, 1], or "" when they do not match. Fuzzy
+// matches allow one edit per four characters of the normalized names.
+func matchCsvHeader(header, column string) (string, float64) {
+	switch {
+	case header == column:
+		return "exact", 1
+	case strings.EqualFold(header, column):
+		return "case-insensitive", 0.95
+	}
+	h, c := normalizeCsvName(header), normalizeCsvName(column)
+	if h == "" || c == "" {
+		return "", 0
+	}
+	if h == c {
+		return "normalized", 0.9
+	}
+	longest := max(len([]rune(h)), len([]rune(c)))
+	distance := editDistance(h, c)
+	if distance > max(1, longest/4) {
+		return "", 0
+	}
+	return "fuzzy", math.Round(80*(1-float64(distance)/float64(longest))) / 100
+}
+
+// matchCsvColumns assigns each header field at most one table column and each
+// column at most one field, taking the most certain pairs first. Duplicate
+// header fields keep the first assignment.
+func matchCsvColumns(header []string, table *gocql.TableMetadata) []CsvColumnMatch {
+	type candidate struct {
+		field  int
+		column string
+		kind   int
+		score  float64
+	}
+	var candidates []candidate
+	for i, field := range header {
+		if field == "" {
+			continue
+		}
+		for _, column := range table.OrderedColumns {
+			kind, score := matchCsvHeader(field, column)
+			if kind == "" {
+				continue
+			}
+			for k, name := range csvMatchKinds {
+				if name == kind {
+					candidates = append(candidates, candidate{field: i, column: column, kind: k, score: score})
+				}
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].kind != candidates[j].kind {
+			return candidates[i].kind < candidates[j].kind
+		}
+		return candidates[i].score > candidates[j].score
+	})
+
+	matches := make([]CsvColumnMatch, len(header))
+	for i, field := range header {
+		matches[i] = CsvColumnMatch{Index: i, Header: field}
+	}
+	taken := make(map[string]bool)
+	for _, c := range candidates {
+		if matches[c.field].Column != "" || taken[c.column] {
+			continue
+		}
+		taken[c.column] = true
+		matches[c.field].Column = c.column
+		matches[c.field].Type = table.Columns[c.column].Validator
+		matches[c.field].Match = csvMatchKinds[c.kind]
+		matches[c.field].Score = c.score
+	}
+	return matches
+}
+
+// newCsvReader builds a CSV reader with the COPY ENCODING, DELIMITER and
+// QUOTE options that accepts any number of fields per record
+func newCsvReader(r io.Reader, options map[string]string) (*copyCSVReader, error) {
+	csvReader, err := newCopyCSVReader(r, options)
+	if err != nil {
+		return nil, err
+	}
+	csvReader.FieldsPerRecord = -1
+	return csvReader, nil
+}
+
+// planCsvMapping reads the header of a CSV file, matches its fields to the
+// table's columns and checks a sample of rows against the matched types
+func planCsvMapping(session *db.Session, params CsvMappingParams, options map[string]string) (*CsvMappingPlan, error) {
+	keyspace, tableName := splitTableName(params.Table, session.Keyspace())
+	if keyspace == "" {
+		return nil, fmt.Errorf("no keyspace specified and no current keyspace")
+	}
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	file, err := os.Open(cleanPath) // #nosec G304 - user-provided path
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	dialect, err := resolveCsvDialect(session, params.Table, cleanPath, options)
+	if err != nil {
+		return nil, err
+	}
+	csvReader, err := newCsvReader(file, options)
+	if err != nil {
+		return nil, err
+	}
+	headerRow, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %v", err)
+	}
+	header := make([]string, len(headerRow))
+	for i, field := range headerRow {
+		header[i] = cleanCsvHeader(field)
+	}
+
+	plan := &CsvMappingPlan{
+		Keyspace:          keyspace,
+		Table:             tableName,
+		Header:            header,
+		Columns:           matchCsvColumns(header, table),
+		Mapping:           make(map[string]string),
+		UnmappedHeaders:   []string{},
+		MissingColumns:    []string{},
+		MissingKeyColumns: []string{},
+		Dialect:           dialect,
+	}
+
+	mapped := make(map[string]bool)
+	coercers := make([]*db.Coercer, len(header))
+	for i, match := range plan.Columns {
+		if match.Column == "" {
+			plan.UnmappedHeaders = append(plan.UnmappedHeaders, match.Header)
+			continue
+		}
+		mapped[match.Column] = true
+		plan.Mapping[match.Header] = match.Column
+		plan.Columns[i].Compatible = true
+		if coercer, err := db.NewCoercer(match.Type); err == nil {
+			coercers[i] = coercer
+		}
+	}
+	for _, column := range table.OrderedColumns {
+		if !mapped[column] {
+			plan.MissingColumns = append(plan.MissingColumns, column)
+		}
+	}
+	for _, col := range primaryKeyColumns(table) {
+		if !mapped[col.Name] {
+			plan.MissingKeyColumns = append(plan.MissingKeyColumns, col.Name)
+		}
+	}
+
+	// Check a sample of rows against the matched column types
+	sampleRows := params.SampleRows
+	if sampleRows <= 0 {
+		sampleRows = defaultMappingSampleRows
+	}
+	sampleRows = min(sampleRows, maxMappingSampleRows)
+	nullVal := options["NULLVAL"]
+	skipRows, _ := strconv.Atoi(options["SKIPROWS"])
+	for i := 0; i < skipRows; i++ {
+		if _, err := csvReader.Read(); err != nil {
+			break
+		}
+	}
+	for plan.SampledRows < sampleRows {
+		fields, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			continue // Parse errors are reported by a validateOnly COPY FROM
+		}
+		plan.SampledRows++
+		for i, value := range fields {
+			if i >= len(coercers) || coercers[i] == nil {
+				continue
+			}
+			match := &plan.Columns[i]
+			match.Sampled++
+			if value == nullVal {
+				match.Nulls++
+				continue
+			}
+			if _, err := coercers[i].Coerce(value); err != nil {
+				match.Invalid++
+				match.Compatible = false
+				if match.InvalidError == "" {
+					match.InvalidValue = truncateValue(value)
+					match.InvalidError = err.Error()
+				}
+			}
+		}
+	}
+
+	plan.Ready = len(plan.MissingKeyColumns) == 0
+	for _, match := range plan.Columns {
+		if match.Column != "" && !match.Compatible {
+			plan.Ready = false
+		}
+	}
+	return plan, nil
+}
+
+// applyCsvMapping resolves a CopyFrom mapping against the file header. It
+// returns the table columns to insert, quoted for CQL, and the header field
+// each one is read from. Fields not in the mapping, or mapped to "", are
+// skipped.
+func applyCsvMapping(header []string, mapping map[string]string) ([]string, []int, error) {
+	var columns []string
+	var fields []int
+	targets := make(map[string]string)
+	for i, field := range header {
+		column := mapping[field]
+		if column == "" {
+			continue
+		}
+		if previous, ok := targets[column]; ok {
+			return nil, nil, fmt.Errorf("header fields %s and %s both map to column %s", previous, field, column)
+		}
+		targets[column] = field
+		columns = append(columns, cql.QuoteIdentifier(column))
+		fields = append(fields, i)
+	}
+	for field, column := range mapping {
+		if column == "" {
+			continue
+		}
+		if _, ok := targets[column]; !ok {
+			return nil, nil, fmt.Errorf("mapped header field %s is not in the file header", field)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("mapping does not map any header field to a column")
+	}
+	return columns, fields, nil
+}
+
+// selectFields returns the fields of record at the given positions
+func selectFields(record []string, positions []int) []string {
+	selected := make([]string, len(positions))
+	for i, pos := range positions {
+		selected[i] = record[pos]
+	}
+	return selected
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+	"github.com/axonops/cqlai-node/internal/parquet"
+)
+
+// Parquet COPY format
+//
+// COPY TO writes a flat Parquet file with one column per selected column,
+// typed from the statement's result metadata. Rows are read with SELECT JSON
+// like the JSON formats, so collections, user types, tuples and vectors are
+// stored as JSON text columns and read back unchanged. COPY FROM reads each
+// row into a JSON object and sends it to INSERT ... JSON, so files written by
+// Spark, Arrow or pandas import as long as their columns are flat.
+
+// copyParquet is the Parquet COPY format
+const copyParquet = "parquet"
+
+// Layouts of the values SELECT JSON returns
+const (
+	jsonTimestampLayout = "2006-01-02 15:04:05.999Z07:00"
+	jsonDateLayout      = "2006-01-02"
+	jsonTimeLayout      = "15:04:05.999999999"
+)
+
+// maxDecimalPrecision is the precision of a DECIMAL stored in 16 bytes
+const maxDecimalPrecision = 38
+
+// parquetField is a result column and the Parquet column it is written to
+type parquetField struct {
+	col parquet.Column
+	typ gocql.Type
+}
+
+// parquetFieldFor maps a CQL column to a Parquet column. Decimals are written
+// as text unless decimalScale is at least 0, when they are DECIMAL(38, scale).
+func parquetFieldFor(name string, info gocql.TypeInfo, decimalScale int) parquetField {
+	col := parquet.Column{Name: name}
+	typ := gocql.TypeCustom
+	if info != nil {
+		typ = info.Type()
+	}
+	switch typ {
+	case gocql.TypeBoolean:
+		col.Type = parquet.Boolean
+	case gocql.TypeTinyInt, gocql.TypeSmallInt, gocql.TypeInt:
+		col.Type, col.Logical = parquet.Int32, parquet.LogicalInt
+		col.BitWidth = map[gocql.Type]int{gocql.TypeTinyInt: 8, gocql.TypeSmallInt: 16, gocql.TypeInt: 32}[typ]
+	case gocql.TypeBigInt, gocql.TypeCounter:
+		col.Type, col.Logical, col.BitWidth = parquet.Int64, parquet.LogicalInt, 64
+	case gocql.TypeFloat:
+		col.Type = parquet.Float
+	case gocql.TypeDouble:
+		col.Type = parquet.Double
+	case gocql.TypeTimestamp:
+		col.Type, col.Logical, col.Unit, col.UTC = parquet.Int64, parquet.LogicalTimestamp, parquet.Millis, true
+	case gocql.TypeDate:
+		col.Type, col.Logical = parquet.Int32, parquet.LogicalDate
+	case gocql.TypeTime:
+		col.Type, col.Logical, col.Unit = parquet.Int64, parquet.LogicalTime, parquet.Nanos
+	case gocql.TypeUUID, gocql.TypeTimeUUID:
+		col.Type, col.TypeLength, col.Logical = parquet.FixedLenByteArray, 16, parquet.LogicalUUID
+	case gocql.TypeBlob:
+		col.Type = parquet.ByteArray
+	case gocql.TypeDecimal:
+		if decimalScale >= 0 {
+			col.Type, col.TypeLength, col.Logical = parquet.FixedLenByteArray, 16, parquet.LogicalDecimal
+			col.Precision, col.Scale = maxDecimalPrecision, decimalScale
+		} else {
+			col.Type, col.Logical = parquet.ByteArray, parquet.LogicalString
+		}
+	case gocql.TypeAscii, gocql.TypeText, gocql.TypeVarchar, gocql.TypeInet, gocql.TypeDuration, gocql.TypeVarint:
+		col.Type, col.Logical = parquet.ByteArray, parquet.LogicalString
+	default:
+		// Collections, user types, tuples, vectors and custom types
+		col.Type, col.Logical = parquet.ByteArray, parquet.LogicalJSON
+	}
+	return parquetField{col: col, typ: typ}
+}
+
+// parquetValue converts a field of a SELECT JSON row to the column's value
+func (f parquetField) parquetValue(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if f.col.Logical == parquet.LogicalJSON {
+		return []byte(raw), nil
+	}
+
+	// Everything else is a number, a boolean or a string
+	var text string
+	if raw[0] == '"' {
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+	} else {
+		text = string(raw)
+	}
+
+	switch f.typ {
+	case gocql.TypeBoolean:
+		return strconv.ParseBool(text)
+	case gocql.TypeTinyInt, gocql.TypeSmallInt, gocql.TypeInt:
+		i, err := strconv.ParseInt(text, 10, f.col.BitWidth)
+		return int32(i), err
+	case gocql.TypeBigInt, gocql.TypeCounter:
+		return strconv.ParseInt(text, 10, 64)
+	case gocql.TypeFloat:
+		v, err := strconv.ParseFloat(text, 32)
+		return float32(v), err
+	case gocql.TypeDouble:
+		return strconv.ParseFloat(text, 64)
+	case gocql.TypeTimestamp:
+		t, err := time.Parse(jsonTimestampLayout, text)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339Nano, text); err != nil {
+				return nil, err
+			}
+		}
+		return t.UnixMilli(), nil
+	case gocql.TypeDate:
+		t, err := time.Parse(jsonDateLayout, text)
+		if err != nil {
+			return nil, err
+		}
+		return int32(t.Unix() / 86400), nil
+	case gocql.TypeTime:
+		t, err := time.Parse(jsonTimeLayout, text)
+		if err != nil {
+			return nil, err
+		}
+		return int64(t.Sub(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))), nil
+	case gocql.TypeUUID, gocql.TypeTimeUUID:
+		u, err := gocql.ParseUUID(text)
+		if err != nil {
+			return nil, err
+		}
+		return u.Bytes(), nil
+	case gocql.TypeBlob:
+		return hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X"))
+	case gocql.TypeDecimal:
+		if f.col.Logical == parquet.LogicalDecimal {
+			return encodeDecimal(text, f.col.Scale)
+		}
+	}
+	return []byte(text), nil
+}
+
+// encodeDecimal returns a decimal's unscaled value at scale as a 16-byte two's
+// complement integer. A value with more decimal places, or more than 38
+// digits, is an error rather than being rounded.
+func encodeDecimal(text string, scale int) ([]byte, error) {
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", text)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("decimal %s has more than %d decimal places; raise DECIMALSCALE", text, scale)
+	}
+	n := new(big.Int).Set(r.Num())
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(maxDecimalPrecision), nil)
+	if new(big.Int).Abs(n).Cmp(limit) >= 0 {
+		return nil, fmt.Errorf("decimal %s has more than %d digits at scale %d", text, maxDecimalPrecision, scale)
+	}
+	if n.Sign() < 0 {
+		n.Add(n, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return n.FillBytes(make([]byte, 16)), nil
+}
+
+// decodeDecimal formats a big-endian two's complement unscaled value at scale
+func decodeDecimal(b []byte, scale int) string {
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return formatUnscaled(n, scale)
+}
+
+// formatUnscaled formats an unscaled decimal value at scale
+func formatUnscaled(n *big.Int, scale int) string {
+	digits := new(big.Int).Abs(n).String()
+	sign := ""
+	if n.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits + strings.Repeat("0", -scale)
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// jsonRowFields returns the values of a SELECT JSON row in column order
+func jsonRowFields(line string, n int) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("row is not a JSON object")
+	}
+	fields := make([]json.RawMessage, 0, n)
+	for dec.More() {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		fields = append(fields, raw)
+	}
+	if len(fields) != n {
+		return nil, fmt.Errorf("row has %d fields for %d columns", len(fields), n)
+	}
+	return fields, nil
+}
+
+// executeCopyToParquet exports rows to a Parquet file. The column types come
+// from the result metadata of the SELECT, prepared without running it.
+func executeCopyToParquet(ctx context.Context, session *db.Session, params CopyParams, options map[string]string, job *copyJob) (*CopyResult, error) {
+	var query string
+	if params.Query != "" {
+		query = params.Query
+	} else if len(params.Columns) > 0 {
+		query = fmt.Sprintf("SELECT %s FROM %s", strings.Join(params.Columns, ", "), params.Table)
+	} else {
+		query = fmt.Sprintf("SELECT * FROM %s", params.Table)
+	}
+
+	decimalScale := -1
+	if s := strings.TrimSpace(options["DECIMALSCALE"]); s != "" {
+		scale, err := strconv.Atoi(s)
+		if err != nil || scale < 0 || scale > maxDecimalPrecision {
+			return nil, fmt.Errorf("DECIMALSCALE must be between 0 and %d", maxDecimalPrecision)
+		}
+		decimalScale = scale
+	}
+
+	metaCtx, cancel := context.WithTimeout(ctx, prepareTimeout)
+	meta, err := session.GocqlSession().StatementMetadata(metaCtx, query, session.Keyspace())
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("query error: %v", err)
+	}
+	if len(meta.ResultColumns) == 0 {
+		return nil, fmt.Errorf("query returned no rows to export")
+	}
+	fields := make([]parquetField, len(meta.ResultColumns))
+	columns := make([]parquet.Column, len(fields))
+	for i, col := range meta.ResultColumns {
+		fields[i] = parquetFieldFor(col.Name, col.TypeInfo, decimalScale)
+		columns[i] = fields[i].col
+	}
+
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	file, err := os.Create(cleanPath) // #nosec G304 - user-provided path
+	if err != nil {
+		return nil, fmt.Errorf("error creating file: %v", err)
+	}
+	defer file.Close()
+	out := bufio.NewWriter(job.writer(file))
+
+	rowGroupRows, _ := strconv.Atoi(options["ROWGROUPSIZE"])
+	writer, err := parquet.NewWriter(out, columns, rowGroupRows)
+	if err != nil {
+		return nil, err
+	}
+	maxRows, _ := strconv.Atoi(options["MAXROWS"])
+
+	var iter *db.StreamingQueryResult
+	switch v := session.ExecuteStreamingQuery(selectKeywordPattern.ReplaceAllString(query, "SELECT JSON ")).(type) {
+	case db.StreamingQueryResult:
+		iter = &v
+	case error:
+		return nil, fmt.Errorf("query error: %v", v)
+	default:
+		return nil, fmt.Errorf("query returned no rows to export")
+	}
+	defer iter.Iterator.Close()
+
+	// The footer is written even when the export stops early, so the file
+	// stays readable
+	finish := func() error {
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("error writing file: %v", err)
+		}
+		if err := out.Flush(); err != nil {
+			return fmt.Errorf("error writing file: %v", err)
+		}
+		return nil
+	}
+
+	rowCount := int64(0)
+	var line string
+	row := make([]interface{}, len(fields))
+	for {
+		if maxRows != -1 && rowCount >= int64(maxRows) {
+			break
+		}
+		if ctx.Err() != nil {
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			return &CopyResult{RowsExported: rowCount}, fmt.Errorf("export cancelled after %d rows", rowCount)
+		}
+		if !iter.Iterator.Scan(&line) {
+			break
+		}
+
+		raw, err := jsonRowFields(line, len(fields))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", rowCount+1, err)
+		}
+		for i, f := range fields {
+			if row[i], err = f.parquetValue(raw[i]); err != nil {
+				return nil, fmt.Errorf("row %d, column %s: %v", rowCount+1, f.col.Name, err)
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, fmt.Errorf("row %d: %v", rowCount+1, err)
+		}
+		rowCount++
+		job.addRow()
+	}
+	if err := iter.Iterator.Close(); err != nil {
+		return nil, fmt.Errorf("query error after %d rows: %v", rowCount, err)
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return &CopyResult{RowsExported: rowCount}, nil
+}
+
+// parquetRowReader reads the rows of a Parquet file as JSON row objects, a row
+// group at a time
+type parquetRowReader struct {
+	file    *parquet.Reader
+	columns []parquet.Column
+	keys    [][]byte // JSON encoded field name of each column
+	group   int
+	values  [][]interface{}
+	row     int
+	rows    int
+}
+
+// newParquetRowReader reads the metadata of a Parquet file
+func newParquetRowReader(file *os.File) (*parquetRowReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pr, err := parquet.NewReader(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	r := &parquetRowReader{file: pr, columns: pr.Columns()}
+	for _, col := range r.columns {
+		// INSERT JSON reads case-sensitive names quoted inside the field name
+		key, err := json.Marshal(cql.QuoteIdentifier(col.Name))
+		if err != nil {
+			return nil, err
+		}
+		r.keys = append(r.keys, key)
+	}
+	return r, nil
+}
+
+// next returns the next row as a JSON object, leaving out null columns. A
+// value that cannot be converted wraps errJSONRow and the row is skipped.
+func (r *parquetRowReader) next() ([]byte, error) {
+	for r.row >= r.rows {
+		if r.group >= r.file.NumRowGroups() {
+			return nil, io.EOF
+		}
+		values, err := r.file.ReadRowGroup(r.group)
+		if err != nil {
+			return nil, err
+		}
+		r.group++
+		r.values, r.row, r.rows = values, 0, 0
+		if len(values) > 0 {
+			r.rows = len(values[0])
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for c, col := range r.columns {
+		v := r.values[c][r.row]
+		if v == nil {
+			continue
+		}
+		value, err := parquetJSONValue(col, v)
+		if err != nil {
+			r.row++
+			return nil, fmt.Errorf("%w: column %s: %v", errJSONRow, col.Name, err)
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(r.keys[c])
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	r.row++
+	return buf.Bytes(), nil
+}
+
+// parquetJSONValue encodes a Parquet value as INSERT JSON reads it for the
+// column's CQL type
+func parquetJSONValue(col parquet.Column, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case bool:
+		return json.Marshal(v)
+	case int32:
+		switch col.Logical {
+		case parquet.LogicalDate:
+			return json.Marshal(time.Unix(int64(v)*86400, 0).UTC().Format(jsonDateLayout))
+		case parquet.LogicalTime:
+			return json.Marshal(formatTimeOfDay(time.Duration(v) * time.Millisecond))
+		case parquet.LogicalDecimal:
+			return []byte(formatUnscaled(big.NewInt(int64(v)), col.Scale)), nil
+		case parquet.LogicalInt:
+			if col.Unsigned {
+				return []byte(strconv.FormatUint(uint64(uint32(v)), 10)), nil
+			}
+		}
+		return []byte(strconv.FormatInt(int64(v), 10)), nil
+	case int64:
+		switch col.Logical {
+		case parquet.LogicalTimestamp:
+			// Timestamps are written as milliseconds since the epoch
+			return []byte(strconv.FormatInt(timestampMillis(v, col.Unit), 10)), nil
+		case parquet.LogicalTime:
+			nanos := v * 1000
+			if col.Unit == parquet.Nanos {
+				nanos = v
+			}
+			return json.Marshal(formatTimeOfDay(time.Duration(nanos)))
+		case parquet.LogicalDecimal:
+			return []byte(formatUnscaled(big.NewInt(v), col.Scale)), nil
+		case parquet.LogicalInt:
+			if col.Unsigned {
+				return []byte(strconv.FormatUint(uint64(v), 10)), nil
+			}
+		}
+		return []byte(strconv.FormatInt(v, 10)), nil
+	case float32:
+		return jsonFloat(float64(v), 32), nil
+	case float64:
+		return jsonFloat(v, 64), nil
+	case []byte:
+		switch {
+		case col.Type == parquet.Int96:
+			// Nanoseconds of the day, then the Julian day
+			nanos := int64(binary.LittleEndian.Uint64(v))
+			days := int64(binary.LittleEndian.Uint32(v[8:])) - 2440588
+			return []byte(strconv.FormatInt(days*86400000+nanos/1e6, 10)), nil
+		case col.Logical == parquet.LogicalDecimal:
+			return []byte(decodeDecimal(v, col.Scale)), nil
+		case col.Logical == parquet.LogicalUUID && len(v) == 16:
+			u, err := gocql.UUIDFromBytes(v)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(u.String())
+		case col.Logical == parquet.LogicalJSON:
+			if !json.Valid(v) {
+				return nil, fmt.Errorf("invalid JSON")
+			}
+			return v, nil
+		case col.Logical == parquet.LogicalString:
+			return json.Marshal(string(v))
+		}
+		return json.Marshal("0x" + hex.EncodeToString(v))
+	}
+	return nil, fmt.Errorf("unsupported value %T", v)
+}
+
+// timestampMillis converts a timestamp in unit to milliseconds, rounding down
+func timestampMillis(v int64, unit parquet.TimeUnit) int64 {
+	div := int64(1)
+	switch unit {
+	case parquet.Micros:
+		div = 1000
+	case parquet.Nanos:
+		div = 1000000
+	}
+	ms := v / div
+	if v%div < 0 {
+		ms--
+	}
+	return ms
+}
+
+// formatTimeOfDay formats a time of day as Cassandra's time type reads it
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d:%02d.%09d", int64(d/time.Hour), int64(d/time.Minute%60), int64(d/time.Second%60), int64(d%time.Second))
+}
+
+// jsonFloat encodes a float, with NaN and the infinities as the strings
+// Cassandra reads for them
+func jsonFloat(f float64, bits int) []byte {
+	switch {
+	case math.IsNaN(f):
+		return []byte(`"NaN"`)
+	case math.IsInf(f, 1):
+		return []byte(`"Infinity"`)
+	case math.IsInf(f, -1):
+		return []byte(`"-Infinity"`)
+	}
+	return []byte(strconv.FormatFloat(f, 'g', -1, bits))
+}
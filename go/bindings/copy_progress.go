@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// COPY TO progress
+//
+// CopyTo writes the whole export before it returns. A host that passes a
+// jobId (any string, or one issued by NewCancelToken) can poll
+// GetCopyProgress with it from another call for the rows exported, bytes
+// written and rate so far, and stop the export between rows with CancelCopy,
+// or with Cancel since the job ID is a cancel token. A job is kept for
+// copyJobRetention after it ends so the last poll sees how it ended.
+
+// copyJobRetention is how long a finished job's progress is kept
+const copyJobRetention = 10 * time.Minute
+
+// Copy job statuses
+const (
+	copyRunning   = "running"
+	copyCompleted = "completed"
+	copyFailed    = "failed"
+	copyCancelled = "cancelled"
+)
+
+// CopyProgress is the state of a COPY TO job
+type CopyProgress struct {
+	JobID          string  `json:"jobId"`
+	Status         string  `json:"status"` // running, completed, failed or cancelled
+	Table          string  `json:"table,omitempty"`
+	Filename       string  `json:"filename"`
+	RowsExported   int64   `json:"rowsExported"`
+	BytesWritten   int64   `json:"bytesWritten"`
+	RowsPerSecond  float64 `json:"rowsPerSecond"`
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+	ElapsedMs      int64   `json:"elapsedMs"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// copyJob tracks a running export. A nil job tracks nothing, for exports
+// started without a job ID.
+type copyJob struct {
+	id       string
+	handle   int
+	table    string
+	filename string
+	started  time.Time
+	cancel   func()
+	rows     atomic.Int64
+	bytes    atomic.Int64
+
+	mu       sync.Mutex
+	status   string
+	err      string
+	finished time.Time
+}
+
+// COPY TO jobs by job ID
+var (
+	copyJobs     = make(map[string]*copyJob)
+	copyJobsLock sync.Mutex
+)
+
+// startCopyJob registers an export under id and returns the context it runs
+// under. The returned job is nil when id is empty; end must be called with
+// the export's outcome.
+func startCopyJob(id string, handle int, params CopyParams) (context.Context, *copyJob, func(error), error) {
+	ctx, done, err := startCancellable(id, handle, "copyTo")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if id == "" {
+		return ctx, nil, func(error) { done() }, nil
+	}
+
+	job := &copyJob{
+		id:       id,
+		handle:   handle,
+		table:    params.Table,
+		filename: params.Filename,
+		started:  time.Now(),
+		cancel:   done,
+		status:   copyRunning,
+	}
+	now := time.Now()
+	copyJobsLock.Lock()
+	for jobID, old := range copyJobs {
+		old.mu.Lock()
+		expired := !old.finished.IsZero() && now.Sub(old.finished) > copyJobRetention
+		old.mu.Unlock()
+		if expired {
+			delete(copyJobs, jobID)
+		}
+	}
+	copyJobs[id] = job
+	copyJobsLock.Unlock()
+
+	return ctx, job, func(err error) {
+		switch {
+		case err == nil:
+			job.finish(copyCompleted, "")
+		case ctx.Err() != nil:
+			job.finish(copyCancelled, "")
+		default:
+			job.finish(copyFailed, err.Error())
+		}
+		done()
+	}, nil
+}
+
+// finish records how the job ended unless it was cancelled first
+func (j *copyJob) finish(status, errMsg string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != copyRunning {
+		return
+	}
+	j.status = status
+	j.err = errMsg
+	j.finished = time.Now()
+}
+
+// progress returns the job's state
+func (j *copyJob) progress() CopyProgress {
+	j.mu.Lock()
+	status, errMsg, end := j.status, j.err, j.finished
+	j.mu.Unlock()
+	if end.IsZero() {
+		end = time.Now()
+	}
+
+	elapsed := end.Sub(j.started)
+	p := CopyProgress{
+		JobID:        j.id,
+		Status:       status,
+		Table:        j.table,
+		Filename:     j.filename,
+		RowsExported: j.rows.Load(),
+		BytesWritten: j.bytes.Load(),
+		ElapsedMs:    elapsed.Milliseconds(),
+		Error:        errMsg,
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		p.RowsPerSecond = float64(p.RowsExported) / secs
+		p.BytesPerSecond = float64(p.BytesWritten) / secs
+	}
+	return p
+}
+
+// addRow counts an exported row
+func (j *copyJob) addRow() {
+	if j != nil {
+		j.rows.Add(1)
+	}
+}
+
+// writer counts the bytes written to w
+func (j *copyJob) writer(w io.Writer) io.Writer {
+	if j == nil {
+		return w
+	}
+	return &copyProgressWriter{w: w, job: j}
+}
+
+// copyProgressWriter counts the bytes of an export as they reach the file
+type copyProgressWriter struct {
+	w   io.Writer
+	job *copyJob
+}
+
+func (cw *copyProgressWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.job.bytes.Add(int64(n))
+	return n, err
+}
+
+// copyJobProgress returns the progress of a job of the handle
+func copyJobProgress(handle int, id string) (CopyProgress, bool) {
+	copyJobsLock.Lock()
+	job := copyJobs[id]
+	copyJobsLock.Unlock()
+	if job == nil || job.handle != handle {
+		return CopyProgress{}, false
+	}
+	return job.progress(), true
+}
+
+// cancelCopyJob stops a running job of the handle. It reports "cancelled"
+// from then on; the rows already written stay in the file.
+func cancelCopyJob(handle int, id string) (CopyProgress, bool) {
+	copyJobsLock.Lock()
+	job := copyJobs[id]
+	copyJobsLock.Unlock()
+	if job == nil || job.handle != handle {
+		return CopyProgress{}, false
+	}
+	job.finish(copyCancelled, "")
+	job.cancel()
+	return job.progress(), true
+}
+
+// discardCopyJobs cancels the session's exports and forgets their progress
+func discardCopyJobs(handle int) {
+	copyJobsLock.Lock()
+	var cancelled []*copyJob
+	for id, job := range copyJobs {
+		if job.handle == handle {
+			cancelled = append(cancelled, job)
+			delete(copyJobs, id)
+		}
+	}
+	copyJobsLock.Unlock()
+
+	for _, job := range cancelled {
+		job.finish(copyCancelled, "")
+		job.cancel()
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+	"github.com/axonops/cqlai-node/internal/ring"
+)
+
+// Token-aware COPY FROM batching
+//
+// Rows are read in chunks of CHUNKSIZE and grouped the way cqlsh groups
+// them: the rows of a partition with at least MINBATCHSIZE rows in the chunk
+// are batched together, and the others are batched with rows whose token the
+// same node owns. An unlogged batch then goes to a coordinator that holds its
+// data (the driver routes a batch by its first statement) instead of being
+// fanned out from an arbitrary node. Rows whose partition key cannot be
+// encoded are batched in file order, as are all rows when the partition key
+// is not among the imported columns.
+
+// copyRouter places the rows of a CSV import on the ring
+type copyRouter struct {
+	keyFields []int // Fields of the partition key columns, in key order
+	keyTypes  []gocql.TypeInfo
+	coercers  []*db.Coercer
+	ring      *ring.Ring // Empty when the tokens cannot be read
+}
+
+// newCopyRouter returns a router for rows of columns, or nil when the
+// partition key of the table cannot be taken from them
+func newCopyRouter(session *db.Session, table string, columns []string) *copyRouter {
+	keyspace, tableName := splitTableName(table, session.Keyspace())
+	meta, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil || len(meta.PartitionKey) == 0 {
+		return nil
+	}
+	fields := make(map[string]int, len(columns))
+	for i, name := range columns {
+		if col := lookupColumn(meta, name); col != nil {
+			fields[col.Name] = i
+		}
+	}
+
+	r := &copyRouter{}
+	for _, col := range meta.PartitionKey {
+		field, ok := fields[col.Name]
+		if !ok {
+			return nil
+		}
+		coercer, err := db.NewCoercer(col.Validator)
+		if err != nil {
+			return nil
+		}
+		r.keyFields = append(r.keyFields, field)
+		r.keyTypes = append(r.keyTypes, col.Type)
+		r.coercers = append(r.coercers, coercer)
+	}
+	nodes, _ := readRingNodes(session)
+	r.ring = ring.New(nodes)
+	return r
+}
+
+// place returns the serialized partition key of a record and the node that
+// owns its token ("" when the ring is unknown). ok is false when the key
+// cannot be encoded, e.g. when part of it is null.
+func (r *copyRouter) place(record []string, nullVal string) (key, owner string, ok bool) {
+	components := make([][]byte, len(r.keyFields))
+	for i, field := range r.keyFields {
+		if record[field] == nullVal {
+			return "", "", false
+		}
+		value, err := r.coercers[i].CoerceBindable(record[field])
+		if err != nil {
+			return "", "", false
+		}
+		if components[i], err = gocql.Marshal(r.keyTypes[i], value); err != nil {
+			return "", "", false
+		}
+	}
+	routingKey := ring.PartitionKey(components)
+	if !r.ring.Empty() {
+		node, _, _ := r.ring.Owner(ring.Murmur3Token(routingKey))
+		owner = node.HostID
+	}
+	return string(routingKey), owner, true
+}
+
+// copyRow is a row waiting in a chunk, with its place on the ring
+type copyRow struct {
+	entry  batchEntry
+	key    string
+	owner  string
+	routed bool
+}
+
+// copyGrouper collects the rows of a COPY FROM into batches for the workers.
+// Without a router it sends rows in file order, maxBatch at a time.
+type copyGrouper struct {
+	router   *copyRouter
+	workers  *copyWorkers
+	nullVal  string
+	minBatch int
+	maxBatch int
+	chunk    int
+	rows     []copyRow
+}
+
+// add queues a row read from record, sending batches once a chunk is full
+func (g *copyGrouper) add(entry batchEntry, record []string) {
+	row := copyRow{entry: entry}
+	if g.router != nil {
+		row.key, row.owner, row.routed = g.router.place(record, g.nullVal)
+	}
+	g.rows = append(g.rows, row)
+	if (g.router == nil && len(g.rows) >= g.maxBatch) || len(g.rows) >= g.chunk {
+		g.flush()
+	}
+}
+
+// flush sends the queued rows: partitions with minBatch rows or more in
+// batches of their own, the other rows grouped by the node owning them
+func (g *copyGrouper) flush() {
+	if len(g.rows) == 0 {
+		return
+	}
+	if g.router == nil {
+		g.send(g.rows)
+		g.rows = g.rows[:0]
+		return
+	}
+
+	var keys []string
+	partitions := make(map[string][]copyRow)
+	var unrouted []copyRow
+	for _, row := range g.rows {
+		if !row.routed {
+			unrouted = append(unrouted, row)
+			continue
+		}
+		if _, ok := partitions[row.key]; !ok {
+			keys = append(keys, row.key)
+		}
+		partitions[row.key] = append(partitions[row.key], row)
+	}
+
+	var owners []string
+	byOwner := make(map[string][]copyRow)
+	for _, key := range keys {
+		rows := partitions[key]
+		if len(rows) >= g.minBatch {
+			g.send(rows)
+			continue
+		}
+		owner := rows[0].owner
+		if _, ok := byOwner[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		byOwner[owner] = append(byOwner[owner], rows...)
+	}
+	for _, owner := range owners {
+		g.send(byOwner[owner])
+	}
+	g.send(unrouted)
+	g.rows = g.rows[:0]
+}
+
+// send queues rows to the workers in batches of at most maxBatch
+func (g *copyGrouper) send(rows []copyRow) {
+	batch := make([]batchEntry, 0, min(len(rows), g.maxBatch))
+	for _, row := range rows {
+		batch = append(batch, row.entry)
+		if len(batch) == g.maxBatch {
+			g.workers.send(batch)
+			batch = batch[:0]
+		}
+	}
+	g.workers.send(batch)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+	"github.com/axonops/cqlai-node/internal/ring"
+)
+
+// testRouter places rows on their first field, a text partition key, on a
+// ring of two nodes: a owns the tokens up to 0 and b the others
+func testRouter(t *testing.T, nodes ...ring.Node) *copyRouter {
+	t.Helper()
+	coercer, err := db.NewCoercer("text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &copyRouter{
+		keyFields: []int{0},
+		keyTypes:  []gocql.TypeInfo{gocql.NewNativeType(4, gocql.TypeText, "")},
+		coercers:  []*db.Coercer{coercer},
+		ring:      ring.New(nodes),
+	}
+}
+
+var testRingNodes = []ring.Node{
+	{HostID: "a", Tokens: []int64{0}},
+	{HostID: "b", Tokens: []int64{math.MaxInt64}},
+}
+
+// keysOwnedBy returns n partition keys whose tokens node a (or b) owns
+func keysOwnedBy(t *testing.T, n int, a bool) []string {
+	t.Helper()
+	var keys []string
+	for i := 0; len(keys) < n && i < 1000; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if owned := ring.Murmur3Token(ring.PartitionKey([][]byte{[]byte(key)})) <= 0; owned == a {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) < n {
+		t.Fatal("not enough keys found")
+	}
+	return keys
+}
+
+// testGrouper groups rows into workers that only queue the batches
+func testGrouper(router *copyRouter, minBatch, maxBatch, chunk int) *copyGrouper {
+	return &copyGrouper{
+		router:   router,
+		workers:  &copyWorkers{queue: make(chan []batchEntry, 100)},
+		minBatch: minBatch,
+		maxBatch: maxBatch,
+		chunk:    chunk,
+	}
+}
+
+// addRow adds a row whose partition key is key, its entry named name
+func addRow(g *copyGrouper, name, key string) {
+	g.add(batchEntry{query: name}, []string{key})
+}
+
+// sentBatches returns the batches queued so far, each as the names of its rows
+func sentBatches(g *copyGrouper) [][]string {
+	var batches [][]string
+	for len(g.workers.queue) > 0 {
+		var names []string
+		for _, entry := range <-g.workers.queue {
+			names = append(names, entry.query)
+		}
+		batches = append(batches, names)
+	}
+	return batches
+}
+
+func TestCopyGrouperWithoutRouter(t *testing.T) {
+	g := testGrouper(nil, 2, 3, 100)
+	for i := 0; i < 7; i++ {
+		addRow(g, fmt.Sprintf("r%d", i), "same")
+	}
+	// Rows go in file order, maxBatch at a time, without waiting for a chunk
+	want := [][]string{{"r0", "r1", "r2"}, {"r3", "r4", "r5"}}
+	if got := sentBatches(g); !reflect.DeepEqual(got, want) {
+		t.Fatalf("before flush: %v", got)
+	}
+	g.flush()
+	if got := sentBatches(g); !reflect.DeepEqual(got, [][]string{{"r6"}}) {
+		t.Errorf("after flush: %v", got)
+	}
+	g.flush()
+	if got := sentBatches(g); got != nil {
+		t.Errorf("empty flush sent %v", got)
+	}
+}
+
+func TestCopyGrouperByPartitionAndOwner(t *testing.T) {
+	ownedByA, ownedByB := keysOwnedBy(t, 3, true), keysOwnedBy(t, 1, false)
+	big, a1, a2, b1 := ownedByA[0], ownedByA[1], ownedByA[2], ownedByB[0]
+
+	g := testGrouper(testRouter(t, testRingNodes...), 2, 10, 100)
+	g.nullVal = "null"
+	addRow(g, "r0", big)
+	addRow(g, "r1", a1)
+	addRow(g, "r2", "null") // A null key cannot be placed
+	addRow(g, "r3", b1)
+	addRow(g, "r4", big)
+	addRow(g, "r5", a2)
+	if got := sentBatches(g); got != nil {
+		t.Fatalf("sent %v before the chunk was full", got)
+	}
+	g.flush()
+
+	// The partition with minBatch rows first, then rows by owner in the
+	// order their owners came up, and unrouted rows last
+	want := [][]string{{"r0", "r4"}, {"r1", "r5"}, {"r3"}, {"r2"}}
+	if got := sentBatches(g); !reflect.DeepEqual(got, want) {
+		t.Errorf("batches %v, want %v", got, want)
+	}
+}
+
+func TestCopyGrouperSplitsAtMaxBatch(t *testing.T) {
+	keys := keysOwnedBy(t, 6, true)
+	g := testGrouper(testRouter(t, testRingNodes...), 3, 2, 100)
+	for i := 0; i < 5; i++ {
+		addRow(g, "big", keys[0])
+	}
+	for _, key := range keys[1:] {
+		addRow(g, key, key)
+	}
+	g.flush()
+
+	var sizes []int
+	for _, batch := range sentBatches(g) {
+		sizes = append(sizes, len(batch))
+	}
+	// A partition of 5 rows, then 5 single-row partitions of the same owner
+	if want := []int{2, 2, 1, 2, 2, 1}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("batch sizes %v, want %v", sizes, want)
+	}
+}
+
+func TestCopyGrouperFlushesFullChunk(t *testing.T) {
+	keys := keysOwnedBy(t, 4, false)
+	g := testGrouper(testRouter(t, testRingNodes...), 2, 10, 4)
+	for _, key := range keys[:3] {
+		addRow(g, key, key)
+	}
+	if got := sentBatches(g); got != nil {
+		t.Fatalf("sent %v before the chunk was full", got)
+	}
+	addRow(g, keys[3], keys[3])
+	if got := sentBatches(g); len(got) != 1 || len(got[0]) != 4 || len(g.rows) != 0 {
+		t.Errorf("full chunk sent as %v, %d rows left", got, len(g.rows))
+	}
+}
+
+func TestCopyGrouperWithoutRing(t *testing.T) {
+	// Tokens unknown: every row has the same owner, so small partitions
+	// share batches
+	keys := keysOwnedBy(t, 2, true)
+	keys = append(keys, keysOwnedBy(t, 2, false)...)
+	g := testGrouper(testRouter(t), 2, 10, 100)
+	for i, key := range []string{keys[0], keys[2], keys[1], keys[3]} {
+		addRow(g, fmt.Sprintf("r%d", i), key)
+	}
+	g.flush()
+	if got := sentBatches(g); !reflect.DeepEqual(got, [][]string{{"r0", "r1", "r2", "r3"}}) {
+		t.Errorf("batches %v", got)
+	}
+}
+
+func TestCopyRouterPlace(t *testing.T) {
+	r := testRouter(t, testRingNodes...)
+	a, b := keysOwnedBy(t, 1, true)[0], keysOwnedBy(t, 1, false)[0]
+
+	key, owner, ok := r.place([]string{a}, "null")
+	if !ok || key != a || owner != "a" {
+		t.Errorf("place(%s) = %q, %q, %v", a, key, owner, ok)
+	}
+	if _, owner, _ := r.place([]string{b}, "null"); owner != "b" {
+		t.Errorf("place(%s) owner %q, want b", b, owner)
+	}
+	if _, _, ok := r.place([]string{"null"}, "null"); ok {
+		t.Error("null key placed")
+	}
+
+	// A key that does not coerce is left unrouted
+	coercer, err := db.NewCoercer("int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.coercers[0], r.keyTypes[0] = coercer, gocql.NewNativeType(4, gocql.TypeInt, "")
+	if _, _, ok := r.place([]string{"x"}, "null"); ok {
+		t.Error("int key placed from text")
+	}
+}
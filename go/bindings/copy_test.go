@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+func TestRetryableCopyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&gocql.RequestErrWriteTimeout{}, true},
+		{fmt.Errorf("batch: %w", &gocql.RequestErrWriteTimeout{}), true},
+		{&gocql.RequestErrOverloaded{}, true},
+		{fmt.Errorf("batch: %w", gocql.ErrTimeoutNoResponse), true},
+		{&gocql.RequestErrReadTimeout{}, false},
+		{&gocql.RequestErrUnavailable{}, false},
+		{&gocql.RequestErrWriteFailure{}, false},
+		{errors.New("unconfigured table t"), false},
+	}
+	for _, tt := range tests {
+		if got := retryableCopyError(tt.err); got != tt.want {
+			t.Errorf("retryableCopyError(%T %v) = %v, want %v", tt.err, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCopyRetryBackoff(t *testing.T) {
+	want := []time.Duration{100, 200, 400, 800, 1600, 2000, 2000}
+	for i, ms := range want {
+		if got := copyRetryBackoff(i + 1); got != ms*time.Millisecond {
+			t.Errorf("attempt %d: %v, want %v", i+1, got, ms*time.Millisecond)
+		}
+	}
+	if got := copyRetryBackoff(100); got != 2*time.Second {
+		t.Errorf("attempt 100: %v, want the 2s cap", got)
+	}
+}
+
+// testCopyWorkers inserts with batches failing with the errors of batchErrs
+// in turn, then succeeding, and rows failing when named in failRows
+func testCopyWorkers(maxAttempts int, batchErrs []error, failRows ...string) (*copyWorkers, *[]string) {
+	var rows []string
+	w := &copyWorkers{maxAttempts: maxAttempts}
+	w.execBatch = func([]batchEntry) error {
+		if len(batchErrs) == 0 {
+			return nil
+		}
+		err := batchErrs[0]
+		batchErrs = batchErrs[1:]
+		return err
+	}
+	w.execRow = func(entry batchEntry) error {
+		rows = append(rows, entry.query)
+		for _, name := range failRows {
+			if entry.query == name {
+				return errors.New("rejected")
+			}
+		}
+		return nil
+	}
+	return w, &rows
+}
+
+func TestCopyWorkersInsert(t *testing.T) {
+	timeout := &gocql.RequestErrWriteTimeout{}
+	entries := []batchEntry{{query: "r0"}, {query: "r1"}}
+
+	t.Run("batch inserted", func(t *testing.T) {
+		w, rows := testCopyWorkers(3, nil)
+		if failed := w.insert(entries); failed != 0 || w.batches.Load() != 1 || w.retries.Load() != 0 || *rows != nil {
+			t.Errorf("%d failed, %d batches, %d retries, rows %v", failed, w.batches.Load(), w.retries.Load(), *rows)
+		}
+	})
+
+	t.Run("retried after timeouts", func(t *testing.T) {
+		w, rows := testCopyWorkers(3, []error{timeout, timeout})
+		if failed := w.insert(entries); failed != 0 || w.batches.Load() != 3 || w.retries.Load() != 2 || *rows != nil {
+			t.Errorf("%d failed, %d batches, %d retries, rows %v", failed, w.batches.Load(), w.retries.Load(), *rows)
+		}
+	})
+
+	t.Run("rows one at a time after the last attempt", func(t *testing.T) {
+		w, rows := testCopyWorkers(2, []error{timeout, timeout}, "r1")
+		if failed := w.insert(entries); failed != 1 || w.batches.Load() != 2 || w.retries.Load() != 1 || len(*rows) != 2 {
+			t.Errorf("%d failed, %d batches, %d retries, rows %v", failed, w.batches.Load(), w.retries.Load(), *rows)
+		}
+	})
+
+	t.Run("not retried after other errors", func(t *testing.T) {
+		w, rows := testCopyWorkers(5, []error{errors.New("invalid")})
+		if failed := w.insert(entries); failed != 0 || w.batches.Load() != 1 || w.retries.Load() != 0 || len(*rows) != 2 {
+			t.Errorf("%d failed, %d batches, %d retries, rows %v", failed, w.batches.Load(), w.retries.Load(), *rows)
+		}
+	})
+
+	t.Run("nothing to insert", func(t *testing.T) {
+		w, _ := testCopyWorkers(1, []error{errors.New("invalid")})
+		if failed := w.insert(nil); failed != 0 || w.batches.Load() != 0 {
+			t.Errorf("%d failed, %d batches", failed, w.batches.Load())
+		}
+	})
+}
+
+func TestCopyWorkersInsertTellsCheckpoint(t *testing.T) {
+	c, path := testCheckpointer(t, 2)
+	chunk := c.read(10, true, false)
+	c.read(20, true, false)
+
+	w, _ := testCopyWorkers(1, []error{errors.New("invalid")}, "r1")
+	w.checkpoint = c
+	w.insert([]batchEntry{{query: "r0", chunk: chunk}, {query: "r1", chunk: chunk}})
+	if cp := savedCheckpoint(t, path); cp.Offset != 20 || cp.RowsImported != 1 || cp.Errors != 1 {
+		t.Errorf("checkpoint %+v", cp)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// maxValidationSamples caps the line errors returned by a validateOnly COPY FROM
+const maxValidationSamples = 100
+
+// CopyLineError is one problem found while validating a COPY FROM input line
+type CopyLineError struct {
+	Line   int    `json:"line"`             // 1-based line in the file
+	Column string `json:"column,omitempty"` // Empty for errors affecting the whole line
+	Value  string `json:"value,omitempty"`
+	Error  string `json:"error"`
+}
+
+// CopyValidationResult reports a validateOnly COPY FROM: nothing is written
+type CopyValidationResult struct {
+	Columns        map[string]string `json:"columns"` // Column name -> CQL type checked against
+	RowsChecked    int               `json:"rowsChecked"`
+	ValidRows      int               `json:"validRows"`
+	InvalidRows    int               `json:"invalidRows"`
+	ParseErrors    int               `json:"parseErrors"` // Lines the CSV reader could not parse or with the wrong field count
+	SkippedRows    int               `json:"skippedRows,omitempty"`
+	ErrorsByColumn map[string]int    `json:"errorsByColumn"`
+	Errors         []CopyLineError   `json:"errors"` // First maxValidationSamples errors
+	Truncated      bool              `json:"truncated,omitempty"`
+	Bytes          int64             `json:"bytes"`
+	NullValues     int64             `json:"nullValues"` // Null cells the import would write as tombstones (0 with UNSETNULLS)
+	Warnings       []string          `json:"warnings,omitempty"`
+	// Import estimate from the measured round trip, batch size and concurrency.
+	// It is a lower bound: server write latency and throttling are not included.
+	RoundTripMs         float64 `json:"roundTripMs"`
+	EstimatedDurationMs int64   `json:"estimatedDurationMs"`
+	DurationMs          int64   `json:"durationMs"`
+	// CSV dialect detected for options set to "auto"
+	Dialect *CsvDialect `json:"dialect,omitempty"`
+}
+
+// validateCopyFrom reads the whole input of a COPY FROM and checks every value
+// against the destination column's type without writing to the cluster. It
+// applies the same HEADER, SKIPROWS, MAXROWS and NULLVAL options as the import.
+func validateCopyFrom(session *db.Session, params CopyParams, options map[string]string) (*CopyValidationResult, error) {
+	start := time.Now()
+
+	keyspace, tableName := splitTableName(params.Table, session.Keyspace())
+	if keyspace == "" {
+		return nil, fmt.Errorf("no keyspace specified and no current keyspace")
+	}
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanPath, err := config.NormalizePath(params.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	file, err := os.Open(cleanPath) // #nosec G304 - user-provided path
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+
+	dialect, err := resolveCsvDialect(session, params.Table, cleanPath, options)
+	if err != nil {
+		return nil, err
+	}
+	csvReader, err := newCsvReader(file, options) // Field counts are checked per line below
+	if err != nil {
+		return nil, err
+	}
+
+	hasHeader := strings.ToLower(options["HEADER"]) == "true"
+	nullVal := options["NULLVAL"]
+	unsetNulls := strings.ToLower(options["UNSETNULLS"]) == "true"
+	maxRows, _ := strconv.Atoi(options["MAXROWS"])
+	skipRows, _ := strconv.Atoi(options["SKIPROWS"])
+	maxBatchSize, _ := strconv.Atoi(options["MAXBATCHSIZE"])
+	maxRequests, _ := strconv.Atoi(options["MAXREQUESTS"])
+	if maxBatchSize <= 0 {
+		maxBatchSize = 20
+	}
+	if maxRequests < 1 {
+		maxRequests = 6
+	}
+
+	columns := params.Columns
+	var headerWidth int
+	var mappedFields []int
+	if params.Mapping != nil {
+		hasHeader = true
+	}
+	if hasHeader {
+		headerRow, err := csvReader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("error reading header: %v", err)
+		}
+		header := make([]string, len(headerRow))
+		for i, col := range headerRow {
+			header[i] = cleanCsvHeader(col)
+		}
+		headerWidth = len(header)
+		if params.Mapping != nil {
+			columns, mappedFields, err = applyCsvMapping(header, params.Mapping)
+			if err != nil {
+				return nil, err
+			}
+		} else if len(columns) == 0 {
+			columns = header
+		}
+	}
+	if len(columns) == 0 {
+		columns = table.OrderedColumns
+	}
+
+	// Resolve each input column to the table column and its coercer
+	result := &CopyValidationResult{
+		Columns:        make(map[string]string, len(columns)),
+		ErrorsByColumn: make(map[string]int),
+		Errors:         []CopyLineError{},
+		Bytes:          info.Size(),
+		Dialect:        dialect,
+	}
+	coercers := make([]*db.Coercer, len(columns))
+	names := make([]string, len(columns))
+	keyColumns := make(map[string]bool)
+	for _, col := range primaryKeyColumns(table) {
+		keyColumns[col.Name] = true
+	}
+	for i, col := range columns {
+		meta := lookupColumn(table, col)
+		if meta == nil {
+			return nil, fmt.Errorf("column %s does not exist in %s.%s", col, keyspace, tableName)
+		}
+		coercer, err := db.NewCoercer(meta.Validator)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: unsupported type %s: %v", meta.Name, meta.Validator, err)
+		}
+		names[i] = meta.Name
+		coercers[i] = coercer
+		result.Columns[meta.Name] = meta.Validator
+	}
+	for name := range keyColumns {
+		if _, ok := result.Columns[name]; !ok {
+			return nil, fmt.Errorf("primary key column %s is missing from the input columns", name)
+		}
+	}
+
+	record := func(lineErr CopyLineError) {
+		if lineErr.Column != "" {
+			result.ErrorsByColumn[lineErr.Column]++
+		}
+		if len(result.Errors) < maxValidationSamples {
+			result.Errors = append(result.Errors, lineErr)
+		} else {
+			result.Truncated = true
+		}
+	}
+
+	for i := 0; i < skipRows; i++ {
+		if _, err := csvReader.Read(); err != nil {
+			break
+		}
+		result.SkippedRows++
+	}
+
+	for {
+		if maxRows != -1 && result.RowsChecked >= maxRows {
+			break
+		}
+		fields, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		result.RowsChecked++
+
+		if err != nil {
+			result.ParseErrors++
+			result.InvalidRows++
+			line := 0
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				line = parseErr.StartLine
+			}
+			record(CopyLineError{Line: line, Error: err.Error()})
+			continue
+		}
+		line, _ := csvReader.FieldPos(0)
+
+		expected := len(columns)
+		if mappedFields != nil {
+			expected = headerWidth
+		}
+		if len(fields) != expected {
+			result.ParseErrors++
+			result.InvalidRows++
+			record(CopyLineError{Line: line, Error: fmt.Sprintf("expected %d fields, got %d", expected, len(fields))})
+			continue
+		}
+		if mappedFields != nil {
+			fields = selectFields(fields, mappedFields)
+		}
+
+		valid := true
+		for i, value := range fields {
+			if value == nullVal {
+				if keyColumns[names[i]] {
+					valid = false
+					record(CopyLineError{Line: line, Column: names[i], Value: value, Error: "primary key column cannot be null"})
+				} else if !unsetNulls {
+					result.NullValues++
+				}
+				continue
+			}
+			if _, err := coercers[i].Coerce(value); err != nil {
+				valid = false
+				pos := i
+				if mappedFields != nil {
+					pos = mappedFields[i]
+				}
+				fieldLine, _ := csvReader.FieldPos(pos)
+				record(CopyLineError{Line: fieldLine, Column: names[i], Value: truncateValue(value), Error: err.Error()})
+			}
+		}
+		if valid {
+			result.ValidRows++
+		} else {
+			result.InvalidRows++
+		}
+	}
+
+	// Estimate the import from the round trip to the coordinator
+	result.RoundTripMs = measureRoundTrip(session)
+	batches := (result.ValidRows + maxBatchSize - 1) / maxBatchSize
+	rounds := (batches + maxRequests - 1) / maxRequests
+	result.EstimatedDurationMs = int64(float64(rounds) * result.RoundTripMs)
+
+	if warning := nullTombstoneWarning(result.NullValues, options); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// lookupColumn finds a table column by its name as written in a header or
+// column list: quoted names are exact, unquoted names are case-insensitive
+func lookupColumn(table *gocql.TableMetadata, name string) *gocql.ColumnMetadata {
+	if strings.HasPrefix(name, "\"") && strings.HasSuffix(name, "\"") && len(name) > 1 {
+		return table.Columns[strings.ReplaceAll(name[1:len(name)-1], "\"\"", "\"")]
+	}
+	if col, ok := table.Columns[name]; ok {
+		return col
+	}
+	return table.Columns[strings.ToLower(name)]
+}
+
+// truncateValue shortens a value sample for an error report
+func truncateValue(value string) string {
+	const limit = 200
+	if len(value) <= limit {
+		return value
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut] + "..."
+}
+
+// measureRoundTrip returns the mean latency of a few local reads in milliseconds
+func measureRoundTrip(session *db.Session) float64 {
+	const probes = 5
+	var total time.Duration
+	var ok int
+	for i := 0; i < probes; i++ {
+		start := time.Now()
+		if err := session.Query("SELECT key FROM system.local").Exec(); err != nil {
+			continue
+		}
+		total += time.Since(start)
+		ok++
+	}
+	if ok == 0 {
+		return 0
+	}
+	return float64(total.Microseconds()) / float64(ok) / 1000
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Parallel row counting.
+//
+// A plain SELECT COUNT(*) makes one coordinator page through the whole table
+// and times out on anything large. CountTable splits the Murmur3 ring into
+// token ranges and counts each range with its own token-restricted COUNT(*),
+// several at a time, so every request stays small and the work is spread
+// over the replicas. The sum is exact as of the time each range was read.
+
+// Defaults and limits for CountTable
+const (
+	defaultCountSplits      = 256
+	maxCountSplits          = 65536
+	defaultCountConcurrency = 8
+	maxCountConcurrency     = 64
+	countRetrySubranges     = 4 // A range that fails is retried once as this many smaller ranges
+)
+
+// CountTableOptions tunes a parallel count
+type CountTableOptions struct {
+	Splits      int    `json:"splits"`      // Token ranges to count separately (default 256)
+	Concurrency int    `json:"concurrency"` // Ranges counted at once (default 8, max 64)
+	Consistency string `json:"consistency"` // Consistency level for the range queries (default: session level)
+	CancelToken string `json:"cancelToken"` // Token for Cancel; CancelQuery also stops the count
+}
+
+// CountTableResult is the row count of a table
+type CountTableResult struct {
+	Keyspace      string   `json:"keyspace"`
+	Table         string   `json:"table"`
+	Count         int64    `json:"count"` // Rows counted; a lower bound when the count is incomplete
+	RangesCounted int      `json:"rangesCounted"`
+	RangesTotal   int      `json:"rangesTotal"`
+	RangesRetried int      `json:"rangesRetried,omitempty"` // Ranges that failed once and were counted in smaller pieces
+	Complete      bool     `json:"complete"`
+	StopReason    string   `json:"stopReason,omitempty"` // cancelled
+	EstimatedRows int64    `json:"estimatedRows,omitempty"`
+	DurationMs    int64    `json:"durationMs"`
+	Warnings      []string `json:"warnings"`
+}
+
+// CountProgress is the state of the latest CountTable call on a session
+type CountProgress struct {
+	Keyspace      string `json:"keyspace"`
+	Table         string `json:"table"`
+	Count         int64  `json:"count"`
+	RangesCounted int64  `json:"rangesCounted"`
+	RangesTotal   int    `json:"rangesTotal"`
+	Running       bool   `json:"running"`
+	ElapsedMs     int64  `json:"elapsedMs"`
+}
+
+// countState tracks a running count for GetCountProgress
+type countState struct {
+	keyspace, table string
+	total           int
+	started         time.Time
+	count           atomic.Int64
+	ranges          atomic.Int64
+	finished        atomic.Int64 // Unix milliseconds, 0 while running
+}
+
+func (s *countState) progress() CountProgress {
+	end := time.Now()
+	if ms := s.finished.Load(); ms != 0 {
+		end = time.UnixMilli(ms)
+	}
+	return CountProgress{
+		Keyspace:      s.keyspace,
+		Table:         s.table,
+		Count:         s.count.Load(),
+		RangesCounted: s.ranges.Load(),
+		RangesTotal:   s.total,
+		Running:       s.finished.Load() == 0,
+		ElapsedMs:     end.Sub(s.started).Milliseconds(),
+	}
+}
+
+var (
+	countStates     = make(map[int]*countState)
+	countStatesLock sync.Mutex
+)
+
+// countProgress returns the progress of the session's latest count, or nil
+func countProgress(handle int) *CountProgress {
+	countStatesLock.Lock()
+	state := countStates[handle]
+	countStatesLock.Unlock()
+	if state == nil {
+		return nil
+	}
+	p := state.progress()
+	return &p
+}
+
+// discardCountProgress forgets the session's count progress
+func discardCountProgress(handle int) {
+	countStatesLock.Lock()
+	delete(countStates, handle)
+	countStatesLock.Unlock()
+}
+
+// tokenRange is a half-open (start, end] range of Murmur3 tokens
+type tokenRange struct {
+	start, end int64
+}
+
+// splitTokenRange divides (start, end] into n ranges of about equal width
+func splitTokenRange(start, end int64, n int) []tokenRange {
+	lo, hi := big.NewInt(start), big.NewInt(end)
+	width := new(big.Int).Sub(hi, lo)
+	if width.Cmp(big.NewInt(int64(n))) < 0 {
+		n = max(int(width.Int64()), 1)
+	}
+	ranges := make([]tokenRange, 0, n)
+	prev := start
+	for i := 1; i <= n; i++ {
+		next := end
+		if i < n {
+			step := new(big.Int).Mul(width, big.NewInt(int64(i)))
+			next = new(big.Int).Add(lo, step.Div(step, big.NewInt(int64(n)))).Int64()
+		}
+		ranges = append(ranges, tokenRange{start: prev, end: next})
+		prev = next
+	}
+	return ranges
+}
+
+// countTable counts a table's rows with parallel token-range COUNT(*) queries
+func countTable(ctx context.Context, handle int, session *db.Session, keyspace, tableName string, opts CountTableOptions) (*CountTableResult, error) {
+	start := time.Now()
+
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var partitioner string
+	_ = session.Query("SELECT partitioner FROM system.local").Scan(&partitioner)
+	if !strings.HasSuffix(partitioner, "Murmur3Partitioner") {
+		return nil, fmt.Errorf("token range counts require the Murmur3 partitioner, cluster uses %s", partitioner)
+	}
+
+	splits := opts.Splits
+	if splits <= 0 {
+		splits = defaultCountSplits
+	}
+	splits = min(splits, maxCountSplits)
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultCountConcurrency
+	}
+	concurrency = min(concurrency, maxCountConcurrency, splits)
+
+	partitionKey := make([]string, len(table.PartitionKey))
+	for i, col := range table.PartitionKey {
+		partitionKey[i] = quoteIdentifier(col.Name)
+	}
+	pkList := strings.Join(partitionKey, ", ")
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s.%s WHERE token(%s) > ? AND token(%s) <= ?",
+		quoteIdentifier(keyspace), quoteIdentifier(tableName), pkList, pkList)
+
+	result := &CountTableResult{
+		Keyspace:    keyspace,
+		Table:       tableName,
+		RangesTotal: splits,
+		Warnings:    []string{},
+	}
+	result.EstimatedRows = estimateTableRows(session, keyspace, tableName)
+
+	state := &countState{keyspace: keyspace, table: tableName, total: splits, started: start}
+	countStatesLock.Lock()
+	countStates[handle] = state
+	countStatesLock.Unlock()
+	defer state.finished.Store(time.Now().UnixMilli())
+
+	var consistency *gocql.Consistency
+	if opts.Consistency != "" {
+		c, err := gocql.ParseConsistencyWrapper(opts.Consistency)
+		if err != nil {
+			return nil, err
+		}
+		consistency = &c
+	}
+
+	countRange := func(r tokenRange) (int64, error) {
+		q := session.Query(query, r.start, r.end).WithContext(ctx)
+		if consistency != nil {
+			q.Consistency(*consistency)
+		}
+		var n int64
+		err := q.Scan(&n)
+		return n, err
+	}
+
+	// The ring is (MinInt64, MaxInt64]; MinInt64 is never a row's token
+	ranges := splitTokenRange(math.MinInt64, math.MaxInt64, splits)
+	work := make(chan tokenRange)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var retried int
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		trackHandleWorkers(handle, 1)
+		go func() {
+			defer wg.Done()
+			defer trackHandleWorkers(handle, -1)
+			for r := range work {
+				n, err := countRange(r)
+				if err != nil && ctx.Err() == nil {
+					// Retry a range that timed out or failed as smaller pieces
+					n, err = 0, nil
+					for _, sub := range splitTokenRange(r.start, r.end, countRetrySubranges) {
+						var subCount int64
+						if subCount, err = countRange(sub); err != nil {
+							break
+						}
+						n += subCount
+					}
+					mu.Lock()
+					retried++
+					mu.Unlock()
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil && ctx.Err() == nil {
+						firstErr = fmt.Errorf("count of token range (%d, %d] failed: %v", r.start, r.end, err)
+					}
+					mu.Unlock()
+					continue
+				}
+				state.count.Add(n)
+				state.ranges.Add(1)
+			}
+		}()
+	}
+
+feed:
+	for _, r := range ranges {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		select {
+		case work <- r:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	result.Count = state.count.Load()
+	result.RangesCounted = int(state.ranges.Load())
+	result.RangesRetried = retried
+	result.Complete = result.RangesCounted == result.RangesTotal
+	if !result.Complete && ctx.Err() != nil {
+		result.StopReason = "cancelled"
+	}
+	if retried > 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"%d token ranges failed and were counted in %d smaller pieces; use more splits for this table", retried, countRetrySubranges))
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
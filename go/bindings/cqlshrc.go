@@ -25,8 +25,10 @@ type ConnectionConfig struct {
 
 // AuthenticationConfig holds [authentication] section values
 type AuthenticationConfig struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Keyspace    string `json:"keyspace,omitempty"`
+	Credentials string `json:"credentials,omitempty"` // Path to a cqlsh credentials file
 }
 
 // SSLConfig holds [ssl] section values
@@ -117,6 +119,10 @@ func ParseCqlshrc(filePath string) (*CqlshrcConfig, error) {
 				config.Authentication.Username = value
 			case "password":
 				config.Authentication.Password = value
+			case "keyspace":
+				config.Authentication.Keyspace = value
+			case "credentials":
+				config.Authentication.Credentials = value
 			}
 
 		case "ssl":
@@ -317,6 +323,10 @@ func ParseCqlshrcWithVariables(cqlshrcPath, manifestPath, valuesPath, workspaceI
 				config.Authentication.Username = value
 			case "password":
 				config.Authentication.Password = value
+			case "keyspace":
+				config.Authentication.Keyspace = value
+			case "credentials":
+				config.Authentication.Credentials = value
 			}
 
 		case "ssl":
@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/cql"
 )
 
 // tableKey is used as a map key for table-level metadata
@@ -31,6 +32,27 @@ type ddlMetadataCache struct {
 type DDLResult struct {
 	DDL   string `json:"ddl"`
 	Scope string `json:"scope"`
+
+	// Set by GetDDL; false when the cluster has no system_virtual_schema,
+	// so cluster DDL with includeSystem contains no virtual keyspaces
+	VirtualTablesSupported bool `json:"virtualTablesSupported"`
+
+	// Set instead of DDL when outputPath, outputDir or chunked is requested
+	OutputPath   string   `json:"outputPath,omitempty"`   // File the DDL was written to
+	Bytes        int64    `json:"bytes,omitempty"`        // Size of the written DDL
+	OutputDir    string   `json:"outputDir,omitempty"`    // Directory the per-object files were written to
+	ManifestPath string   `json:"manifestPath,omitempty"` // manifest.json describing the files
+	Files        int      `json:"files,omitempty"`        // Number of object files written
+	OperationID  string   `json:"operationId,omitempty"`  // Pass to GetDDLChunk to read the chunks
+	Chunks       int      `json:"chunks,omitempty"`       // Number of chunks in the operation
+	Keyspaces    []string `json:"keyspaces,omitempty"`    // Keyspaces covered, in output order
+}
+
+// ddlSection is the DDL of a single keyspace. File and chunked output never
+// split a section, so every chunk holds whole keyspaces.
+type ddlSection struct {
+	keyspace string
+	ddl      string
 }
 
 // GenerateDDLWithOptions generates DDL statements based on DDLOptions
@@ -44,10 +66,17 @@ type DDLResult struct {
 //   - keyspace + function: specific function
 //   - keyspace + aggregate: specific aggregate
 //   - keyspace + view: specific materialized view
+//   - outputPath: write the DDL to a file instead of returning it
+//   - outputDir: write one file per object plus a manifest (cluster or keyspace scope)
+//   - chunked: keep the DDL for GetDDLChunk and return an operation ID
 func GenerateDDLWithOptions(session *gocql.Session, opts DDLOptions) (*DDLResult, error) {
+	if opts.outputModes() > 0 {
+		return generateDDLOutput(session, opts)
+	}
+
 	// Cluster-level DDL
 	if opts.Cluster {
-		return generateClusterDDL(session, opts.IncludeSystem)
+		return generateClusterDDL(session, opts.IncludeSystem, !opts.skipVirtual)
 	}
 
 	// Keyspace is required for non-cluster operations
@@ -103,7 +132,7 @@ func GenerateDDL(session *gocql.Session, scope string) (*DDLResult, error) {
 
 	switch parts[0] {
 	case "cluster":
-		return generateClusterDDL(session, true)
+		return generateClusterDDL(session, true, true)
 	case "keyspace":
 		if len(parts) < 2 {
 			return nil, fmt.Errorf("invalid scope: keyspace name required")
@@ -148,7 +177,8 @@ func GenerateDDL(session *gocql.Session, scope string) (*DDLResult, error) {
 
 // loadAllMetadata fetches all schema metadata in batch queries
 // This reduces N+1 queries to ~10 queries total for the entire cluster
-func loadAllMetadata(session *gocql.Session, includeSystem bool) (*ddlMetadataCache, error) {
+// Virtual keyspaces are only queried when both includeSystem and includeVirtual are set.
+func loadAllMetadata(session *gocql.Session, includeSystem, includeVirtual bool) (*ddlMetadataCache, error) {
 	cache := &ddlMetadataCache{
 		keyspaces:  make(map[string]ddlKeyspaceInfo),
 		tables:     make(map[string][]ddlTableInfo),
@@ -184,8 +214,8 @@ func loadAllMetadata(session *gocql.Session, includeSystem bool) (*ddlMetadataCa
 		return nil, fmt.Errorf("failed to fetch keyspaces: %v", err)
 	}
 
-	// 1b. Fetch virtual keyspaces if includeSystem is true
-	if includeSystem {
+	// 1b. Fetch virtual keyspaces if includeSystem is true and the cluster has them
+	if includeSystem && includeVirtual {
 		iter = session.Query("SELECT keyspace_name FROM system_virtual_schema.keyspaces").Iter()
 		for iter.Scan(&ksName) {
 			// Virtual keyspaces don't have replication settings
@@ -217,8 +247,8 @@ func loadAllMetadata(session *gocql.Session, includeSystem bool) (*ddlMetadataCa
 		return nil, fmt.Errorf("failed to fetch tables: %v", err)
 	}
 
-	// 2b. Fetch virtual tables if includeSystem is true
-	if includeSystem {
+	// 2b. Fetch virtual tables if includeSystem is true and the cluster has them
+	if includeSystem && includeVirtual {
 		iter = session.Query("SELECT keyspace_name, table_name, comment FROM system_virtual_schema.tables").Iter()
 		for iter.Scan(&ksName, &tableName, &comment) {
 			if _, ok := cache.keyspaces[ksName]; !ok {
@@ -278,8 +308,8 @@ func loadAllMetadata(session *gocql.Session, includeSystem bool) (*ddlMetadataCa
 		return nil, fmt.Errorf("failed to fetch columns: %v", err)
 	}
 
-	// 3b. Fetch virtual table columns if includeSystem is true
-	if includeSystem {
+	// 3b. Fetch virtual table columns if includeSystem is true and the cluster has them
+	if includeSystem && includeVirtual {
 		iter = session.Query(`SELECT keyspace_name, table_name, column_name, type, kind, position, clustering_order
 			FROM system_virtual_schema.columns`).Iter()
 		for iter.Scan(&ksName, &tableName, &colName, &colType, &kind, &position, &clusteringOrder) {
@@ -930,9 +960,31 @@ func loadTableMetadata(session *gocql.Session, ksName, tableName string) (ddlTab
 	return table, columns, indexes, nil
 }
 
-func generateClusterDDL(session *gocql.Session, includeSystem bool) (*DDLResult, error) {
+func generateClusterDDL(session *gocql.Session, includeSystem, includeVirtual bool) (*DDLResult, error) {
+	sections, err := generateClusterSections(session, includeSystem, includeVirtual)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build final DDL in sorted order
+	var ddl strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			ddl.WriteString("\n")
+		}
+		ddl.WriteString(section.ddl)
+	}
+
+	return &DDLResult{
+		DDL:   ddl.String(),
+		Scope: "cluster",
+	}, nil
+}
+
+// generateClusterSections generates the DDL of every keyspace, sorted by keyspace name
+func generateClusterSections(session *gocql.Session, includeSystem, includeVirtual bool) ([]ddlSection, error) {
 	// Load all metadata in batch (8-10 queries total)
-	cache, err := loadAllMetadata(session, includeSystem)
+	cache, err := loadAllMetadata(session, includeSystem, includeVirtual)
 	if err != nil {
 		return nil, err
 	}
@@ -977,19 +1029,11 @@ func generateClusterDDL(session *gocql.Session, includeSystem bool) (*DDLResult,
 		ddlMap[r.name] = r.ddl
 	}
 
-	// Build final DDL in sorted order
-	var ddl strings.Builder
-	for i, name := range keyspaceNames {
-		if i > 0 {
-			ddl.WriteString("\n")
-		}
-		ddl.WriteString(ddlMap[name])
+	sections := make([]ddlSection, 0, len(keyspaceNames))
+	for _, name := range keyspaceNames {
+		sections = append(sections, ddlSection{keyspace: name, ddl: ddlMap[name]})
 	}
-
-	return &DDLResult{
-		DDL:   ddl.String(),
-		Scope: "cluster",
-	}, nil
+	return sections, nil
 }
 
 func generateKeyspaceDDL(session *gocql.Session, ksName string) (*DDLResult, error) {
@@ -1279,13 +1323,15 @@ func generateCreateTable(ksName string, table ddlTableInfo, columns []ddlColumnI
 		return sortedColumns[i].Position < sortedColumns[j].Position
 	})
 
-	// Write column definitions
+	// Write column definitions; the PRIMARY KEY line follows when the
+	// partition key is known (partition key columns sort first)
+	hasPrimaryKey := len(sortedColumns) > 0 && sortedColumns[0].Kind == "partition_key"
 	for i, col := range sortedColumns {
 		sb.WriteString(fmt.Sprintf("    %s %s", quoteIdentifier(col.Name), col.Type))
 		if col.Kind == "static" {
 			sb.WriteString(" STATIC")
 		}
-		if i < len(sortedColumns)-1 {
+		if i < len(sortedColumns)-1 || hasPrimaryKey {
 			sb.WriteString(",")
 		}
 		sb.WriteString("\n")
@@ -1358,11 +1404,16 @@ func generateCreateTable(ksName string, table ddlTableInfo, columns []ddlColumnI
 	return sb.String()
 }
 
+// generateCreateIndex renders CREATE INDEX. A custom index (SAI, SASI or
+// any other class) keeps its class and every option but target and
+// class_name, e.g. SAI's case_sensitive or similarity_function and SASI's
+// mode and analyzer_class, so that the statement recreates the same index.
 func generateCreateIndex(ksName, tableName string, idx ddlIndexInfo) string {
 	var sb strings.Builder
 
+	custom := strings.EqualFold(idx.Kind, "CUSTOM")
 	sb.WriteString("CREATE")
-	if idx.Kind == "CUSTOM" {
+	if custom {
 		sb.WriteString(" CUSTOM")
 	}
 	sb.WriteString(fmt.Sprintf(" INDEX %s ON %s.%s ",
@@ -1376,9 +1427,29 @@ func generateCreateIndex(ksName, tableName string, idx ddlIndexInfo) string {
 		sb.WriteString(fmt.Sprintf("(%s)", target))
 	}
 
-	if idx.Kind == "CUSTOM" {
-		if className, ok := idx.Options["class_name"]; ok {
-			sb.WriteString(fmt.Sprintf(" USING '%s'", className))
+	if custom {
+		if className := idx.Options["class_name"]; className != "" {
+			// Cassandra 5 resolves the short name of its built-in SAI class
+			if indexKindName(idx.Kind, idx.Options) == "sai" {
+				className = "StorageAttachedIndex"
+			}
+			sb.WriteString(fmt.Sprintf(" USING '%s'", escapeString(className)))
+		}
+
+		// Options other than target and class_name; a non-custom index has none
+		var keys []string
+		for key := range idx.Options {
+			if key != "target" && key != "class_name" {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			options := make([]string, len(keys))
+			for i, key := range keys {
+				options[i] = fmt.Sprintf("'%s': '%s'", escapeString(key), escapeString(idx.Options[key]))
+			}
+			sb.WriteString(" WITH OPTIONS = {" + strings.Join(options, ", ") + "}")
 		}
 	}
 
@@ -1818,60 +1889,11 @@ func ddlReconstructViewDefinition(session *gocql.Session, ksName, viewName, base
 // Utility functions
 
 func quoteIdentifier(name string) string {
-	// Check if identifier needs quoting
-	needsQuoting := false
-
-	// Reserved words (simplified list)
-	reserved := map[string]bool{
-		"add": true, "allow": true, "alter": true, "and": true, "any": true,
-		"apply": true, "asc": true, "authorize": true, "batch": true, "begin": true,
-		"by": true, "columnfamily": true, "create": true, "delete": true, "desc": true,
-		"drop": true, "each_quorum": true, "from": true, "grant": true, "in": true,
-		"index": true, "inet": true, "infinity": true, "insert": true, "into": true,
-		"key": true, "keyspace": true, "keyspaces": true, "limit": true, "local_one": true,
-		"local_quorum": true, "modify": true, "nan": true, "norecursive": true, "not": true,
-		"of": true, "on": true, "one": true, "order": true, "password": true,
-		"primary": true, "quorum": true, "rename": true, "revoke": true, "schema": true,
-		"select": true, "set": true, "table": true, "three": true, "to": true,
-		"token": true, "truncate": true, "two": true, "unlogged": true, "update": true,
-		"use": true, "using": true, "where": true, "with": true,
-	}
-
-	lower := strings.ToLower(name)
-	if reserved[lower] {
-		needsQuoting = true
-	}
-
-	// Check for special characters
-	for _, c := range name {
-		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_') {
-			needsQuoting = true
-			break
-		}
-	}
-
-	// Check if starts with number
-	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
-		needsQuoting = true
-	}
-
-	// Check for uppercase (CQL identifiers are case-insensitive unless quoted)
-	for _, c := range name {
-		if c >= 'A' && c <= 'Z' {
-			needsQuoting = true
-			break
-		}
-	}
-
-	if needsQuoting {
-		return fmt.Sprintf("\"%s\"", strings.ReplaceAll(name, "\"", "\"\""))
-	}
-
-	return name
+	return cql.QuoteIdentifier(name)
 }
 
 func escapeString(s string) string {
-	return strings.ReplaceAll(s, "'", "''")
+	return cql.EscapeString(s)
 }
 
 func isSystemKeyspace(name string) bool {
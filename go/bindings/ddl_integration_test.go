@@ -0,0 +1,63 @@
+//go:build integration
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+	"github.com/axonops/cqlai-node/testkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keyspaceDDL returns GetDDL's DDL for a keyspace, read with a new session
+// so no schema cache of an earlier one is involved
+func keyspaceDDL(t *testing.T, cluster *testkit.Cluster, ks string) (string, string) {
+	t.Helper()
+	handle := connect(t, cluster, ks, nil)
+	opts, _ := json.Marshal(DDLOptions{Keyspace: ks})
+	raw := callHandle(GetDDL, handle, string(opts))
+
+	var result DDLResult
+	testkit.Data(t, raw, &result)
+	assert.Equal(t, "keyspace>"+ks, result.Scope)
+	return raw, result.DDL
+}
+
+func TestDDLRoundTrip(t *testing.T) {
+	cluster := testkit.Require(t)
+	ks := cluster.Keyspace(t,
+		"CREATE TYPE address (street text, zip int)",
+		"CREATE TABLE users (id uuid, added timestamp, name text, home frozen<address>, PRIMARY KEY (id, added)) WITH CLUSTERING ORDER BY (added DESC) AND comment = 'it''s a test'",
+		"CREATE INDEX users_name ON users (name)",
+	)
+
+	raw, ddl := keyspaceDDL(t, cluster, ks)
+	testkit.Golden(t, "ddl_keyspace", raw, testkit.Shape())
+	for _, want := range []string{"CREATE KEYSPACE " + ks, "CREATE TYPE " + ks + ".address", "CREATE TABLE " + ks + ".users", "CLUSTERING ORDER BY (added DESC)", "it''s a test", "CREATE INDEX users_name"} {
+		assert.Contains(t, ddl, want)
+	}
+
+	// Recreating the keyspace from its DDL gives the same DDL back
+	stmts, err := batch.SplitForNode(ddl)
+	require.NoError(t, err)
+	cluster.Exec(t, "", "DROP KEYSPACE "+ks)
+	cluster.Exec(t, "", stmts...)
+
+	_, again := keyspaceDDL(t, cluster, ks)
+	assert.Equal(t, strings.TrimSpace(ddl), strings.TrimSpace(again))
+}
+
+func TestDDLMissingTable(t *testing.T) {
+	cluster := testkit.Require(t)
+	ks := cluster.Keyspace(t)
+	handle := connect(t, cluster, ks, nil)
+
+	opts, _ := json.Marshal(DDLOptions{Keyspace: ks, Table: "missing"})
+	resp := testkit.Decode(t, callHandle(GetDDL, handle, string(opts)))
+	assert.False(t, resp.Success)
+	assert.NotEmpty(t, resp.Error)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// defaultDDLChunkSize is the chunk size used when chunked DDL has no chunkSize.
+// A keyspace larger than the chunk size gets a chunk of its own.
+const defaultDDLChunkSize = 1 << 20
+
+// DDLChunk is a single chunk of a chunked DDL operation
+type DDLChunk struct {
+	OperationID string   `json:"operationId"`
+	Index       int      `json:"index"`
+	Total       int      `json:"total"`
+	Keyspaces   []string `json:"keyspaces"` // Whole keyspaces contained in this chunk
+	DDL         string   `json:"ddl"`
+	Done        bool     `json:"done"` // Every chunk has been read and the operation was released
+}
+
+// ddlOperation holds the chunks of a chunked DDL generation until they are read
+type ddlOperation struct {
+	handle    int
+	chunks    []ddlChunkData
+	served    []bool
+	remaining int
+}
+
+type ddlChunkData struct {
+	keyspaces []string
+	ddl       string
+}
+
+// Chunked DDL operations by operation ID
+var (
+	ddlOperations     = make(map[string]*ddlOperation)
+	ddlOperationsLock sync.Mutex
+	nextDDLOperation  = 1
+)
+
+var (
+	errDDLOperationNotFound = errors.New("DDL operation not found or already released")
+	errDDLOutputModes       = errors.New("outputPath, outputDir and chunked cannot be combined")
+)
+
+// outputModes counts the requested output modes; at most one may be set
+func (opts DDLOptions) outputModes() int {
+	modes := 0
+	for _, set := range []bool{opts.OutputPath != "", opts.OutputDir != "", opts.Chunked} {
+		if set {
+			modes++
+		}
+	}
+	return modes
+}
+
+// ddlManifestFile is written at the root of an OutputDir export
+const ddlManifestFile = "manifest.json"
+
+// DDLManifest describes the files of an OutputDir export. Objects are listed
+// in the order they can be applied: per keyspace, the keyspace itself, then
+// types, functions, aggregates, tables (with their indexes) and views.
+type DDLManifest struct {
+	Version   int                 `json:"version"`
+	Scope     string              `json:"scope"`
+	Keyspaces []string            `json:"keyspaces"`
+	Objects   []DDLManifestObject `json:"objects"`
+}
+
+// DDLManifestObject is a single exported file
+type DDLManifestObject struct {
+	Keyspace string `json:"keyspace"`
+	Type     string `json:"type"` // keyspace, type, function, aggregate, table or view
+	Name     string `json:"name"`
+	File     string `json:"file"` // Relative to the output directory, always with forward slashes
+	SHA256   string `json:"sha256"`
+}
+
+// ddlObjectFile is an exported file before it is written
+type ddlObjectFile struct {
+	object DDLManifestObject
+	ddl    string
+}
+
+// generateDDLOutput generates DDL for opts and writes it to opts.OutputPath or
+// opts.OutputDir, or stores it in chunks for GetDDLChunk, instead of returning it inline
+func generateDDLOutput(session *gocql.Session, opts DDLOptions) (*DDLResult, error) {
+	if opts.outputModes() > 1 {
+		return nil, errDDLOutputModes
+	}
+	if opts.OutputDir != "" {
+		return exportDDLDir(session, opts)
+	}
+
+	var sections []ddlSection
+	scope := "cluster"
+	if opts.Cluster {
+		var err error
+		sections, err = generateClusterSections(session, opts.IncludeSystem, !opts.skipVirtual)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Narrower scopes belong to a single keyspace, so they are one section
+		inline := opts
+		inline.OutputPath = ""
+		inline.Chunked = false
+		generated, err := GenerateDDLWithOptions(session, inline)
+		if err != nil {
+			return nil, err
+		}
+		scope = generated.Scope
+		sections = []ddlSection{{keyspace: opts.Keyspace, ddl: generated.DDL}}
+	}
+
+	result := &DDLResult{
+		Scope:     scope,
+		Keyspaces: make([]string, 0, len(sections)),
+	}
+	for _, section := range sections {
+		result.Keyspaces = append(result.Keyspaces, section.keyspace)
+	}
+
+	if opts.OutputPath != "" {
+		written, err := writeDDLFile(opts.OutputPath, sections)
+		if err != nil {
+			return nil, err
+		}
+		result.OutputPath = opts.OutputPath
+		result.Bytes = written
+		return result, nil
+	}
+
+	chunks := splitDDLChunks(sections, opts.ChunkSize)
+	result.OperationID = storeDDLOperation(opts.handle, chunks)
+	result.Chunks = len(chunks)
+	return result, nil
+}
+
+// writeDDLFile writes the sections to path, separated the same way as inline
+// cluster DDL. The file is written next to path and renamed into place, so a
+// failed generation never leaves a truncated file behind.
+func writeDDLFile(path string, sections []ddlSection) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create DDL file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	var written int64
+	for i, section := range sections {
+		if i > 0 {
+			n, _ := w.WriteString("\n")
+			written += int64(n)
+		}
+		n, err := w.WriteString(section.ddl)
+		written += int64(n)
+		if err != nil {
+			tmp.Close()
+			return 0, fmt.Errorf("failed to write DDL file: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write DDL file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write DDL file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("failed to write DDL file: %v", err)
+	}
+	return written, nil
+}
+
+// splitDDLChunks packs whole keyspaces into chunks of at most size bytes.
+// There is always at least one chunk, so an empty cluster can still be read.
+func splitDDLChunks(sections []ddlSection, size int) []ddlChunkData {
+	if size <= 0 {
+		size = defaultDDLChunkSize
+	}
+
+	chunks := make([]ddlChunkData, 0)
+	current := ddlChunkData{keyspaces: []string{}}
+	var ddl strings.Builder
+	flush := func() {
+		current.ddl = ddl.String()
+		chunks = append(chunks, current)
+		current = ddlChunkData{keyspaces: []string{}}
+		ddl.Reset()
+	}
+
+	for _, section := range sections {
+		if len(current.keyspaces) > 0 && ddl.Len()+1+len(section.ddl) > size {
+			flush()
+		}
+		if len(current.keyspaces) > 0 {
+			ddl.WriteString("\n")
+		}
+		ddl.WriteString(section.ddl)
+		current.keyspaces = append(current.keyspaces, section.keyspace)
+	}
+	if len(current.keyspaces) > 0 || len(chunks) == 0 {
+		flush()
+	}
+	return chunks
+}
+
+// storeDDLOperation keeps chunks for GetDDLChunk and returns the operation ID
+func storeDDLOperation(handle int, chunks []ddlChunkData) string {
+	ddlOperationsLock.Lock()
+	defer ddlOperationsLock.Unlock()
+	id := fmt.Sprintf("ddl-%d-%d", handle, nextDDLOperation)
+	nextDDLOperation++
+	ddlOperations[id] = &ddlOperation{
+		handle:    handle,
+		chunks:    chunks,
+		served:    make([]bool, len(chunks)),
+		remaining: len(chunks),
+	}
+	return id
+}
+
+// readDDLChunk returns a chunk of a session's operation. The operation is
+// released once every chunk has been read at least once.
+func readDDLChunk(handle int, id string, index int) (*DDLChunk, error) {
+	ddlOperationsLock.Lock()
+	defer ddlOperationsLock.Unlock()
+
+	op := ddlOperations[id]
+	if op == nil || op.handle != handle {
+		return nil, errDDLOperationNotFound
+	}
+	if index < 0 || index >= len(op.chunks) {
+		return nil, fmt.Errorf("chunk index %d out of range (0-%d)", index, len(op.chunks)-1)
+	}
+
+	if !op.served[index] {
+		op.served[index] = true
+		op.remaining--
+	}
+	done := op.remaining == 0
+	if done {
+		delete(ddlOperations, id)
+	}
+
+	chunk := op.chunks[index]
+	return &DDLChunk{
+		OperationID: id,
+		Index:       index,
+		Total:       len(op.chunks),
+		Keyspaces:   chunk.keyspaces,
+		DDL:         chunk.ddl,
+		Done:        done,
+	}, nil
+}
+
+// discardDDLOperations drops the session's unread chunks when the session is closed
+func discardDDLOperations(handle int) {
+	ddlOperationsLock.Lock()
+	defer ddlOperationsLock.Unlock()
+	for id, op := range ddlOperations {
+		if op.handle == handle {
+			delete(ddlOperations, id)
+		}
+	}
+}
+
+// exportDDLDir writes one file per schema object below opts.OutputDir:
+//
+//	<keyspace>/keyspace.cql
+//	<keyspace>/types/<name>.cql
+//	<keyspace>/functions/<name>.cql   (all overloads of the function)
+//	<keyspace>/aggregates/<name>.cql  (all overloads of the aggregate)
+//	<keyspace>/tables/<name>.cql      (the table and its indexes)
+//	<keyspace>/views/<name>.cql
+//	manifest.json
+//
+// Files whose content did not change are left untouched, and files listed in
+// a previous manifest that no longer belong to the schema are removed, so the
+// directory can be committed to version control as is.
+func exportDDLDir(session *gocql.Session, opts DDLOptions) (*DDLResult, error) {
+	if opts.Table != "" || opts.Type != "" || opts.Function != "" || opts.Aggregate != "" || opts.View != "" {
+		return nil, fmt.Errorf("outputDir requires cluster or keyspace scope")
+	}
+
+	var cache *ddlMetadataCache
+	var err error
+	scope := "cluster"
+	if opts.Cluster {
+		cache, err = loadAllMetadata(session, opts.IncludeSystem, !opts.skipVirtual)
+	} else if opts.Keyspace != "" {
+		cache, err = loadKeyspaceMetadata(session, opts.Keyspace)
+		scope = fmt.Sprintf("keyspace>%s", opts.Keyspace)
+	} else {
+		return nil, fmt.Errorf("keyspace is required when cluster is false")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyspaceNames := make([]string, 0, len(cache.keyspaces))
+	for name := range cache.keyspaces {
+		keyspaceNames = append(keyspaceNames, name)
+	}
+	sort.Strings(keyspaceNames)
+
+	manifest := DDLManifest{
+		Version:   1,
+		Scope:     scope,
+		Keyspaces: keyspaceNames,
+		Objects:   []DDLManifestObject{},
+	}
+	var files []ddlObjectFile
+	for _, ksName := range keyspaceNames {
+		files = append(files, keyspaceObjectFiles(cache, ksName)...)
+	}
+
+	if err := os.MkdirAll(opts.OutputDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	previous := readDDLManifest(opts.OutputDir)
+
+	written := make(map[string]bool, len(files))
+	for i := range files {
+		f := &files[i]
+		sum := sha256.Sum256([]byte(f.ddl))
+		f.object.SHA256 = hex.EncodeToString(sum[:])
+		if err := writeFileIfChanged(filepath.Join(opts.OutputDir, filepath.FromSlash(f.object.File)), []byte(f.ddl)); err != nil {
+			return nil, err
+		}
+		written[f.object.File] = true
+		manifest.Objects = append(manifest.Objects, f.object)
+	}
+
+	// Remove files of objects that were dropped since the previous export
+	if previous != nil {
+		for _, obj := range previous.Objects {
+			if written[obj.File] || !filepath.IsLocal(filepath.FromSlash(obj.File)) {
+				continue
+			}
+			path := filepath.Join(opts.OutputDir, filepath.FromSlash(obj.File))
+			if err := os.Remove(path); err == nil {
+				removeEmptyDirs(opts.OutputDir, filepath.Dir(path))
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := filepath.Join(opts.OutputDir, ddlManifestFile)
+	if err := writeFileIfChanged(manifestPath, append(data, '\n')); err != nil {
+		return nil, err
+	}
+
+	return &DDLResult{
+		Scope:        scope,
+		OutputDir:    opts.OutputDir,
+		ManifestPath: manifestPath,
+		Files:        len(files),
+		Keyspaces:    keyspaceNames,
+	}, nil
+}
+
+// keyspaceObjectFiles splits a keyspace's DDL into one file per object, in apply order
+func keyspaceObjectFiles(cache *ddlMetadataCache, ksName string) []ddlObjectFile {
+	dir := ddlFileName(ksName)
+	object := func(objType, name, file, ddl string) ddlObjectFile {
+		return ddlObjectFile{
+			object: DDLManifestObject{Keyspace: ksName, Type: objType, Name: name, File: file},
+			ddl:    ddl + "\n",
+		}
+	}
+
+	files := []ddlObjectFile{object("keyspace", ksName, dir+"/keyspace.cql", generateCreateKeyspace(cache.keyspaces[ksName]))}
+
+	for _, t := range cache.types[ksName] {
+		files = append(files, object("type", t.Name, dir+"/types/"+ddlFileName(t.Name)+".cql", generateCreateType(ksName, t)))
+	}
+
+	// Overloads share a name, so they share a file
+	var functionNames []string
+	functions := make(map[string][]string)
+	for _, f := range cache.functions[ksName] {
+		if _, ok := functions[f.Name]; !ok {
+			functionNames = append(functionNames, f.Name)
+		}
+		functions[f.Name] = append(functions[f.Name], generateCreateFunction(ksName, f))
+	}
+	for _, name := range functionNames {
+		files = append(files, object("function", name, dir+"/functions/"+ddlFileName(name)+".cql", strings.Join(functions[name], "\n\n")))
+	}
+
+	var aggregateNames []string
+	aggregates := make(map[string][]string)
+	for _, a := range cache.aggregates[ksName] {
+		if _, ok := aggregates[a.Name]; !ok {
+			aggregateNames = append(aggregateNames, a.Name)
+		}
+		aggregates[a.Name] = append(aggregates[a.Name], generateCreateAggregate(ksName, a))
+	}
+	for _, name := range aggregateNames {
+		files = append(files, object("aggregate", name, dir+"/aggregates/"+ddlFileName(name)+".cql", strings.Join(aggregates[name], "\n\n")))
+	}
+
+	for _, t := range cache.tables[ksName] {
+		key := tableKey{keyspace: ksName, table: t.Name}
+		var ddl strings.Builder
+		ddl.WriteString(generateCreateTable(ksName, t, cache.columns[key]))
+		for _, idx := range cache.indexes[key] {
+			ddl.WriteString("\n")
+			ddl.WriteString(generateCreateIndex(ksName, t.Name, idx))
+		}
+		files = append(files, object("table", t.Name, dir+"/tables/"+ddlFileName(t.Name)+".cql", ddl.String()))
+	}
+
+	for _, v := range cache.views[ksName] {
+		viewDef := ddlReconstructViewDefinitionFromCache(cache, ksName, v)
+		files = append(files, object("view", v.Name, dir+"/views/"+ddlFileName(v.Name)+".cql", generateCreateViewWithDef(ksName, v.Name, viewDef)))
+	}
+
+	return files
+}
+
+// ddlFileName maps a schema object name to a file name. Unquoted CQL names are
+// kept as is; any other byte is percent-encoded so quoted names stay distinct
+// and cannot escape the output directory.
+func ddlFileName(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// readDDLManifest reads the manifest of a previous export, or returns nil
+func readDDLManifest(dir string) *DDLManifest {
+	data, err := os.ReadFile(filepath.Join(dir, ddlManifestFile))
+	if err != nil {
+		return nil
+	}
+	var manifest DDLManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil
+	}
+	return &manifest
+}
+
+// writeFileIfChanged writes data to path unless the file already holds it,
+// creating parent directories as needed
+func writeFileIfChanged(path string, data []byte) error {
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == string(data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, stopping at root
+func removeEmptyDirs(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
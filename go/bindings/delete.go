@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Tombstone-aware deletes.
+//
+// Deleting rows one at a time writes one tombstone per row, and every read of
+// the partition has to skip them until compaction removes them after
+// gc_grace_seconds. DeletePartition and DeleteRange instead write the smallest
+// number of tombstones the server supports:
+//
+//	partition   DELETE ... WHERE pk = ?                      one partition tombstone
+//	range       DELETE ... WHERE pk = ? AND ck >= ? AND ...  one range tombstone (Cassandra 3.0+)
+//	rows        one DELETE per row                           one row tombstone each (older servers)
+//
+// Before writing, the rows covered by the delete are counted. Above the
+// confirmAbove threshold the delete is refused unless confirm is set.
+
+const (
+	// defaultDeleteConfirmAbove is the row count above which a delete needs confirm
+	defaultDeleteConfirmAbove = 1000
+	// maxDeleteCountRows stops counting affected rows; larger counts are lower bounds
+	maxDeleteCountRows = 100000
+)
+
+// DeleteOptions controls confirmation and execution of a delete
+type DeleteOptions struct {
+	Confirm      bool  `json:"confirm"`             // Required when more than confirmAbove rows are affected
+	ConfirmAbove *int  `json:"confirmAbove"`        // Row threshold for confirm (default 1000, 0 always requires it)
+	DryRun       bool  `json:"dryRun"`              // Return the plan without deleting
+	Timestamp    int64 `json:"timestamp,omitempty"` // USING TIMESTAMP microseconds
+}
+
+// ClusteringRange bounds the next clustering column after the key prefix
+type ClusteringRange struct {
+	Column        string      `json:"column"`
+	From          interface{} `json:"from"` // Omitted or null for no lower bound
+	To            interface{} `json:"to"`   // Omitted or null for no upper bound
+	FromInclusive *bool       `json:"fromInclusive"`
+	ToInclusive   bool        `json:"toInclusive"`
+}
+
+// DeletePlan describes a delete and, once run, its outcome
+type DeletePlan struct {
+	Statement            string   `json:"statement"` // The DELETE with values inlined, for display
+	Strategy             string   `json:"strategy"`  // "partition", "range" or "rows"
+	RowsAffected         int64    `json:"rowsAffected"`
+	RowsCountCapped      bool     `json:"rowsCountCapped,omitempty"` // Counting stopped at maxDeleteCountRows
+	Tombstones           int64    `json:"tombstones"`                // Tombstones written to the table itself
+	GCGraceSeconds       int      `json:"gcGraceSeconds"`            // How long the tombstones are kept (-1 if unknown)
+	MeanPartitionBytes   int64    `json:"meanPartitionBytes,omitempty"`
+	Views                []string `json:"views,omitempty"` // Materialized views that also receive tombstones
+	ConfirmAbove         int      `json:"confirmAbove"`
+	ConfirmationRequired bool     `json:"confirmationRequired"`
+	Executed             bool     `json:"executed"`
+	Warnings             []string `json:"warnings,omitempty"`
+	DurationMs           int64    `json:"durationMs"`
+}
+
+// deleteCondition is one restriction of a DELETE's WHERE clause
+type deleteCondition struct {
+	column  *gocql.ColumnMetadata
+	op      string
+	value   interface{}
+	literal string
+}
+
+// clause renders the restriction. Decimal values are inlined because gocql
+// only binds them from inf.Dec; the coercer has already validated the text.
+func (c deleteCondition) clause() (string, []interface{}) {
+	if c.column.Type.Type() == gocql.TypeDecimal {
+		return fmt.Sprintf("%s %s %s", quoteIdentifier(c.column.Name), c.op, c.literal), nil
+	}
+	return fmt.Sprintf("%s %s ?", quoteIdentifier(c.column.Name), c.op), []interface{}{c.value}
+}
+
+// newDeleteCondition coerces a JSON value to the column type
+func newDeleteCondition(col *gocql.ColumnMetadata, op string, raw interface{}) (deleteCondition, error) {
+	if raw == nil {
+		return deleteCondition{}, fmt.Errorf("column %s: value must not be null", col.Name)
+	}
+	var text string
+	switch v := raw.(type) {
+	case string:
+		text = v
+	case json.Number:
+		text = v.String()
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		text = string(encoded)
+	}
+
+	coercer, err := db.NewCoercer(col.Validator)
+	if err != nil {
+		return deleteCondition{}, fmt.Errorf("column %s: unsupported type %s: %v", col.Name, col.Validator, err)
+	}
+	value, err := coercer.Coerce(text)
+	if err != nil {
+		return deleteCondition{}, fmt.Errorf("column %s: %v", col.Name, err)
+	}
+	literal, err := keyLiteral(value, col.Type.Type())
+	if err != nil {
+		literal = "'" + escapeString(text) + "'"
+	}
+	return deleteCondition{column: col, op: op, value: value, literal: literal}, nil
+}
+
+// keyConditions builds equality restrictions for the whole partition key and,
+// when allowed, a prefix of the clustering columns. It returns the number of
+// clustering columns restricted.
+func keyConditions(table *gocql.TableMetadata, key map[string]interface{}, allowClustering bool) ([]deleteCondition, int, error) {
+	remaining := make(map[string]interface{}, len(key))
+	for name, v := range key {
+		col := lookupColumn(table, name)
+		if col == nil {
+			return nil, 0, fmt.Errorf("column %s does not exist in %s.%s", name, table.Keyspace, table.Name)
+		}
+		remaining[col.Name] = v
+	}
+
+	var conds []deleteCondition
+	for _, col := range table.PartitionKey {
+		v, ok := remaining[col.Name]
+		if !ok {
+			return nil, 0, fmt.Errorf("partition key column %s is required", col.Name)
+		}
+		cond, err := newDeleteCondition(col, "=", v)
+		if err != nil {
+			return nil, 0, err
+		}
+		conds = append(conds, cond)
+		delete(remaining, col.Name)
+	}
+
+	prefix := 0
+	if allowClustering {
+		for _, col := range table.ClusteringColumns {
+			v, ok := remaining[col.Name]
+			if !ok {
+				break
+			}
+			cond, err := newDeleteCondition(col, "=", v)
+			if err != nil {
+				return nil, 0, err
+			}
+			conds = append(conds, cond)
+			delete(remaining, col.Name)
+			prefix++
+		}
+	}
+
+	for name := range remaining {
+		col := table.Columns[name]
+		switch {
+		case col.Kind == gocql.ColumnClusteringKey && allowClustering:
+			return nil, 0, fmt.Errorf("clustering column %s can only be set after the columns before it", name)
+		case col.Kind == gocql.ColumnClusteringKey:
+			return nil, 0, fmt.Errorf("clustering column %s is not allowed in a partition delete; use DeleteRange", name)
+		default:
+			return nil, 0, fmt.Errorf("column %s is not part of the primary key", name)
+		}
+	}
+	return conds, prefix, nil
+}
+
+// rangeConditions builds the bounds of a clustering range. The column must be
+// the clustering column that follows the equality prefix.
+func rangeConditions(table *gocql.TableMetadata, rng *ClusteringRange, prefix int) ([]deleteCondition, error) {
+	if prefix >= len(table.ClusteringColumns) {
+		return nil, fmt.Errorf("the key already sets every clustering column; there is nothing left to range over")
+	}
+	next := table.ClusteringColumns[prefix]
+	if col := lookupColumn(table, rng.Column); col == nil || col.Name != next.Name {
+		return nil, fmt.Errorf("range column must be %s, the clustering column after the key prefix", next.Name)
+	}
+	if rng.From == nil && rng.To == nil {
+		return nil, fmt.Errorf("range needs from, to or both")
+	}
+
+	var conds []deleteCondition
+	if rng.From != nil {
+		op := ">="
+		if rng.FromInclusive != nil && !*rng.FromInclusive {
+			op = ">"
+		}
+		cond, err := newDeleteCondition(next, op, rng.From)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	if rng.To != nil {
+		op := "<"
+		if rng.ToInclusive {
+			op = "<="
+		}
+		cond, err := newDeleteCondition(next, op, rng.To)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+// whereClause renders restrictions for execution and for display
+func whereClause(conds []deleteCondition) (string, string, []interface{}) {
+	var parts, display []string
+	var values []interface{}
+	for _, c := range conds {
+		part, vals := c.clause()
+		parts = append(parts, part)
+		values = append(values, vals...)
+		display = append(display, fmt.Sprintf("%s %s %s", quoteIdentifier(c.column.Name), c.op, c.literal))
+	}
+	return strings.Join(parts, " AND "), strings.Join(display, " AND "), values
+}
+
+// tableTombstoneSettings reads gc_grace_seconds and the views built on a table
+func tableTombstoneSettings(session *db.Session, keyspace, table string) (int, []string) {
+	gcGrace := 0
+	if err := session.Query("SELECT gc_grace_seconds FROM system_schema.tables WHERE keyspace_name = ? AND table_name = ?",
+		keyspace, table).Scan(&gcGrace); err != nil {
+		gcGrace = -1
+	}
+
+	var views []string
+	iter := session.Query("SELECT view_name, base_table_name FROM system_schema.views WHERE keyspace_name = ?", keyspace).Iter()
+	var view, base string
+	for iter.Scan(&view, &base) {
+		if base == table {
+			views = append(views, view)
+		}
+	}
+	_ = iter.Close()
+	return gcGrace, views
+}
+
+// meanPartitionBytes averages the partition sizes in system.size_estimates
+func meanPartitionBytes(session *db.Session, keyspace, table string) int64 {
+	iter := session.Query("SELECT mean_partition_size FROM system.size_estimates WHERE keyspace_name = ? AND table_name = ?", keyspace, table).Iter()
+	var size, total, n int64
+	for iter.Scan(&size) {
+		total += size
+		n++
+	}
+	if err := iter.Close(); err != nil || n == 0 {
+		return 0
+	}
+	return total / n
+}
+
+// runDelete plans a delete, checks confirmation and runs it
+func runDelete(session *db.Session, table *gocql.TableMetadata, conds []deleteCondition, clusteringRestricted bool, opts DeleteOptions) (*DeletePlan, error) {
+	start := time.Now()
+
+	plan := &DeletePlan{ConfirmAbove: defaultDeleteConfirmAbove}
+	if opts.ConfirmAbove != nil {
+		plan.ConfirmAbove = *opts.ConfirmAbove
+	}
+	tableRef := fmt.Sprintf("%s.%s", quoteIdentifier(table.Keyspace), quoteIdentifier(table.Name))
+	using := ""
+	if opts.Timestamp != 0 {
+		using = fmt.Sprintf(" USING TIMESTAMP %d", opts.Timestamp)
+	}
+	where, display, values := whereClause(conds)
+	plan.Statement = fmt.Sprintf("DELETE FROM %s%s WHERE %s", tableRef, using, display)
+
+	// Count the rows covered, reading only the primary key
+	keyCols := primaryKeyColumns(table)
+	keyNames := make([]string, len(keyCols))
+	for i, col := range keyCols {
+		keyNames[i] = quoteIdentifier(col.Name)
+	}
+	selectStmt := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(keyNames, ", "), tableRef, where)
+
+	switch {
+	case !clusteringRestricted:
+		plan.Strategy = "partition"
+	case session.IsVersion3OrHigher():
+		plan.Strategy = "range"
+	default:
+		plan.Strategy = "rows"
+	}
+
+	// Older servers delete row by row, so the keys are kept for the deletes
+	var rowKeys [][]interface{}
+	iter := session.Query(selectStmt, values...).PageSize(5000).Iter()
+	for {
+		row := make(map[string]interface{})
+		if !iter.MapScan(row) {
+			break
+		}
+		plan.RowsAffected++
+		if plan.Strategy == "rows" {
+			key := make([]interface{}, len(keyCols))
+			for i, col := range keyCols {
+				key[i] = row[col.Name]
+			}
+			rowKeys = append(rowKeys, key)
+		}
+		if plan.RowsAffected >= maxDeleteCountRows {
+			plan.RowsCountCapped = true
+			break
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("counting affected rows: %v", err)
+	}
+
+	switch plan.Strategy {
+	case "rows":
+		plan.Tombstones = plan.RowsAffected
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+			"Cassandra %s does not support range deletes; each row is deleted with its own tombstone", session.CassandraVersion()))
+	default:
+		plan.Tombstones = 1
+	}
+
+	var gcGrace int
+	gcGrace, plan.Views = tableTombstoneSettings(session, table.Keyspace, table.Name)
+	plan.GCGraceSeconds = gcGrace
+	if plan.Strategy == "partition" {
+		plan.MeanPartitionBytes = meanPartitionBytes(session, table.Keyspace, table.Name)
+	}
+	if len(plan.Views) > 0 && plan.RowsAffected > 0 {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf(
+			"materialized views %s receive a row tombstone for each of the %d rows deleted", strings.Join(plan.Views, ", "), plan.RowsAffected))
+	}
+	if gcGrace == 0 {
+		plan.Warnings = append(plan.Warnings, "gc_grace_seconds is 0: tombstones can be purged before every replica has seen them, so deleted data may reappear after a repair")
+	}
+
+	plan.ConfirmationRequired = plan.RowsAffected > int64(plan.ConfirmAbove)
+	if opts.DryRun || (plan.ConfirmationRequired && !opts.Confirm) {
+		plan.DurationMs = time.Since(start).Milliseconds()
+		return plan, nil
+	}
+
+	if plan.Strategy == "rows" {
+		if plan.RowsCountCapped {
+			return nil, fmt.Errorf("more than %d rows to delete one by one; split the range", maxDeleteCountRows)
+		}
+		keyWhere := make([]string, len(keyCols))
+		for i, name := range keyNames {
+			keyWhere[i] = name + " = ?"
+		}
+		rowStmt := fmt.Sprintf("DELETE FROM %s%s WHERE %s", tableRef, using, strings.Join(keyWhere, " AND "))
+		for _, key := range rowKeys {
+			if err := session.Query(rowStmt, key...).Exec(); err != nil {
+				return nil, fmt.Errorf("deleting row: %v", err)
+			}
+		}
+	} else {
+		stmt := fmt.Sprintf("DELETE FROM %s%s WHERE %s", tableRef, using, where)
+		if err := session.Query(stmt, values...).Exec(); err != nil {
+			return nil, err
+		}
+	}
+	plan.Executed = true
+	plan.DurationMs = time.Since(start).Milliseconds()
+	return plan, nil
+}
+
+// deletePartition deletes a whole partition with one partition tombstone
+func deletePartition(session *db.Session, keyspace, tableName string, key map[string]interface{}, opts DeleteOptions) (*DeletePlan, error) {
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+	conds, _, err := keyConditions(table, key, false)
+	if err != nil {
+		return nil, err
+	}
+	return runDelete(session, table, conds, false, opts)
+}
+
+// deleteRange deletes the rows under a clustering prefix, optionally bounded
+// on the next clustering column, with one range tombstone
+func deleteRange(session *db.Session, keyspace, tableName string, key map[string]interface{}, rng *ClusteringRange, opts DeleteOptions) (*DeletePlan, error) {
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(table.ClusteringColumns) == 0 {
+		return nil, fmt.Errorf("%s.%s has no clustering columns; use DeletePartition", keyspace, tableName)
+	}
+	conds, prefix, err := keyConditions(table, key, true)
+	if err != nil {
+		return nil, err
+	}
+	if rng != nil {
+		bounds, err := rangeConditions(table, rng, prefix)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, bounds...)
+	} else if prefix == 0 {
+		return nil, fmt.Errorf("set a clustering prefix in the key or a range; to delete the whole partition use DeletePartition")
+	} else if prefix == len(table.ClusteringColumns) {
+		return nil, fmt.Errorf("the key sets every clustering column, which selects a single row rather than a range")
+	}
+	return runDelete(session, table, conds, true, opts)
+}
+
+// decodeDeleteJSON decodes with UseNumber so key values keep their precision
+func decodeDeleteJSON(s string, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
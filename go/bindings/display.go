@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Display options
+//
+// A caller that needs 3 of a result's 80 columns still pays for the other 77
+// to be converted to JSON and copied across the cgo boundary. Display options
+// pick the columns to return, their order and the names they are returned
+// under; each row is trimmed as it is read, before the response is built.
+
+// DisplayOptions selects, orders and renames the columns of a query result
+type DisplayOptions struct {
+	Columns []string          `json:"columns,omitempty"` // Columns to return, in this order; every column when empty
+	Rename  map[string]string `json:"rename,omitempty"`  // Result column -> name it is returned under
+}
+
+// validate checks the options that do not depend on the result
+func (d *DisplayOptions) validate() error {
+	if d == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(d.Columns))
+	for _, col := range d.Columns {
+		if strings.TrimSpace(col) == "" {
+			return fmt.Errorf("display.columns must not contain empty names")
+		}
+		if seen[col] {
+			return fmt.Errorf("display.columns lists %q more than once", col)
+		}
+		seen[col] = true
+	}
+	for col, name := range d.Rename {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("display.rename gives %q an empty name", col)
+		}
+	}
+	return nil
+}
+
+// resultDisplay is a DisplayOptions resolved against the columns of a result
+type resultDisplay struct {
+	source []string // Result column of each returned column
+	names  []string // Name each one is returned under
+	types  []string
+}
+
+// newResultDisplay resolves d against a result's columns and their types. It
+// returns nil when d leaves the result unchanged.
+func newResultDisplay(d *DisplayOptions, columns, types []string) (*resultDisplay, error) {
+	if d == nil || (len(d.Columns) == 0 && len(d.Rename) == 0) {
+		return nil, nil
+	}
+	index := make(map[string]int, len(columns))
+	for i, col := range columns {
+		index[col] = i
+	}
+	for col := range d.Rename {
+		if _, ok := index[col]; !ok {
+			return nil, fmt.Errorf("display.rename: column %q is not in the result", col)
+		}
+	}
+
+	selected := d.Columns
+	if len(selected) == 0 {
+		selected = columns
+	}
+	display := &resultDisplay{
+		source: make([]string, len(selected)),
+		names:  make([]string, len(selected)),
+		types:  make([]string, len(selected)),
+	}
+	names := make(map[string]string, len(selected))
+	for i, col := range selected {
+		pos, ok := index[col]
+		if !ok {
+			return nil, fmt.Errorf("display.columns: column %q is not in the result (columns: %s)", col, strings.Join(columns, ", "))
+		}
+		name := col
+		if renamed, ok := d.Rename[col]; ok {
+			name = renamed
+		}
+		if other, ok := names[name]; ok {
+			return nil, fmt.Errorf("display: columns %q and %q would both be returned as %q", other, col, name)
+		}
+		names[name] = col
+
+		display.source[i] = col
+		display.names[i] = name
+		if pos < len(types) {
+			display.types[i] = types[pos]
+		}
+	}
+	return display, nil
+}
+
+// row returns the returned columns of a result row
+func (d *resultDisplay) row(row map[string]interface{}) map[string]interface{} {
+	if d == nil {
+		return row
+	}
+	out := make(map[string]interface{}, len(d.source))
+	for i, col := range d.source {
+		out[d.names[i]] = row[col]
+	}
+	return out
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Script execution context
+//
+// Scripts written for cqlsh depend on USE and on the shell's CONSISTENCY,
+// SERIAL CONSISTENCY, PAGING and TRACING lines, which the server does not
+// understand. ExecuteMultiQuery and ExecuteSourceFiles carry an
+// executionContext through a script so it runs unmodified: USE and each
+// directive apply to the statements after it until the script ends, passed to
+// each statement as query options. Each USE or directive reports its effect.
+//
+// A script holds the handle's shared lock throughout and never changes the
+// session, so other calls on the handle run alongside it with the session's
+// own settings. Only the shell (ExecuteShellCommand) persists directives: it
+// sets them on the session, and applies a USE under the exclusive lock once
+// the command has released the shared one.
+
+// Scopes of a directive's effect
+const (
+	directiveScopeScript  = "script"  // Until the script ends
+	directiveScopeSession = "session" // Kept after the script (shell commands)
+)
+
+// defaultScriptPageSize is the page size PAGING ON uses when paging was off,
+// the cqlsh default
+const defaultScriptPageSize = 100
+
+// DirectiveEffect is what a USE or cqlsh directive in a script did
+type DirectiveEffect struct {
+	Directive string `json:"directive"`           // USE, CONSISTENCY, SERIAL CONSISTENCY, PAGING or TRACING
+	Value     string `json:"value"`               // Setting in effect after the statement
+	Previous  string `json:"previous,omitempty"`  // Setting before it; omitted when the directive only showed it
+	Scope     string `json:"scope"`               // script or session
+	Statement int    `json:"statement,omitempty"` // 1-based statement number in the file (source files only)
+}
+
+// ScriptSettings are the session settings a statement ran with
+type ScriptSettings struct {
+	Keyspace          string `json:"keyspace"`
+	Consistency       string `json:"consistency"`
+	SerialConsistency string `json:"serialConsistency"`
+	PageSize          int    `json:"pageSize"` // 0 is paging off
+	Tracing           bool   `json:"tracing"`
+}
+
+// executionContext tracks USE and directives through one script
+type executionContext struct {
+	handle  int
+	session *db.Session
+	unlock  func()
+	persist bool // Set directives on the session, as ExecuteShellCommand does
+	changed bool // A USE or directive changed a setting
+
+	// Settings the script's statements run with, from the session at the start
+	keyspace          string
+	consistency       string
+	serialConsistency string
+	pageSize          int
+	tracing           bool
+}
+
+// newExecutionContext takes the handle's shared lock for a script. close
+// releases it.
+func newExecutionContext(handle int, session *db.Session) *executionContext {
+	ec := &executionContext{
+		handle:  handle,
+		session: session,
+		unlock:  lockHandleShared(handle),
+	}
+	ec.keyspace = session.Keyspace()
+	ec.consistency = session.Consistency()
+	ec.serialConsistency = session.SerialConsistency()
+	ec.pageSize = session.PageSize()
+	ec.tracing = session.Tracing()
+	return ec
+}
+
+// close releases the shared lock. When directives persist, a keyspace chosen
+// by USE is then set on the session under the exclusive lock, since that
+// replaces the driver session.
+func (ec *executionContext) close() error {
+	if ec.unlock == nil {
+		return nil
+	}
+	ec.unlock()
+	ec.unlock = nil
+	if !ec.persist || ec.keyspace == ec.session.Keyspace() {
+		return nil
+	}
+	unlock := lockHandleExclusive(ec.handle)
+	defer unlock()
+	closeRowStreams(ec.handle)
+	return ec.session.SetKeyspace(ec.keyspace)
+}
+
+// settings returns the settings statements run with once USE or a
+// directive has changed one, or nil
+func (ec *executionContext) settings() *ScriptSettings {
+	if !ec.changed {
+		return nil
+	}
+	return &ScriptSettings{
+		Keyspace:          ec.keyspace,
+		Consistency:       ec.consistency,
+		SerialConsistency: ec.serialConsistency,
+		PageSize:          ec.pageSize,
+		Tracing:           ec.tracing,
+	}
+}
+
+// queryOptions returns the options the next statement runs with, or nil
+// while the script has the session's settings
+func (ec *executionContext) queryOptions() (*db.QueryOptions, error) {
+	if ec == nil || !ec.changed {
+		return nil, nil
+	}
+	// Only settings that differ from the session's are overridden
+	opts := &db.QueryOptions{}
+	if ec.consistency != ec.session.Consistency() {
+		opts.Consistency = ec.consistency
+	}
+	if ec.serialConsistency != ec.session.SerialConsistency() {
+		opts.SerialConsistency = ec.serialConsistency
+	}
+	if ec.pageSize != ec.session.PageSize() {
+		opts.PageSize = ec.pageSize
+		opts.DefaultPaging = ec.pageSize <= 0
+	}
+	if ec.tracing != ec.session.Tracing() {
+		tracing := ec.tracing
+		opts.Tracing = &tracing
+	}
+	if ec.keyspace != ec.session.Keyspace() {
+		// Older protocols have no per-statement keyspace; the driver would
+		// drop it and run the statement in the session's keyspace
+		if ec.session.ProtocolVersion() < 5 {
+			return nil, fmt.Errorf("USE in a script needs native protocol v5 (Cassandra 4.0 or later); qualify table names with %s instead", ec.keyspace)
+		}
+		opts.Keyspace = ec.keyspace
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// parseDirective splits a USE or cqlsh directive into its name and argument.
+// ok is false for any other statement.
+func parseDirective(stmt string) (name, arg string, ok bool) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	name = strings.ToUpper(fields[0])
+	args := fields[1:]
+	switch name {
+	case "USE", "CONSISTENCY", "PAGING", "TRACING":
+	case "SERIAL":
+		if len(fields) < 2 || !strings.EqualFold(fields[1], "CONSISTENCY") {
+			return "", "", false
+		}
+		name, args = "SERIAL CONSISTENCY", fields[2:]
+	default:
+		return "", "", false
+	}
+	return name, strings.Join(args, " "), true
+}
+
+// runDirective applies stmt when it is USE or a cqlsh directive. ok is false
+// for any other statement, which the caller executes as usual.
+func (ec *executionContext) runDirective(stmt string) (sr StatementResult, ok bool) {
+	name, arg, ok := parseDirective(stmt)
+	if !ok {
+		return sr, false
+	}
+	sr = StatementResult{Identifier: strings.Fields(name)[0], Success: true}
+	effect := &DirectiveEffect{Directive: name, Scope: directiveScopeScript}
+	if ec.persist {
+		effect.Scope = directiveScopeSession
+	}
+	fail := func(code, format string, args ...interface{}) (StatementResult, bool) {
+		sr.Success = false
+		sr.Error = fmt.Sprintf(format, args...)
+		sr.ErrorCode = code
+		return sr, true
+	}
+
+	switch name {
+	case "USE":
+		keyspace := strings.Trim(arg, `"`)
+		if keyspace == arg {
+			keyspace = strings.ToLower(keyspace) // Unquoted names are case-insensitive
+		}
+		if keyspace == "" {
+			return fail("KEYSPACE_ERROR", "USE requires a keyspace name")
+		}
+		// Checks the keyspace exists
+		if err, isErr := ec.session.ExecuteCQLQuery("USE " + keyspace).(error); isErr {
+			return fail("KEYSPACE_ERROR", "%v", err)
+		}
+		effect.Previous = ec.keyspace
+		ec.keyspace = keyspace
+		ec.changed = true
+		effect.Value = keyspace
+		sr.Message = "Now using keyspace " + keyspace
+
+	case "CONSISTENCY":
+		if arg == "" {
+			effect.Value = ec.consistency
+			sr.Message = fmt.Sprintf("Current consistency level is %s.", effect.Value)
+			break
+		}
+		level := strings.ToUpper(arg)
+		if err := (&db.QueryOptions{Consistency: level}).Validate(); err != nil {
+			return fail("INVALID_CONSISTENCY", "%v", err)
+		}
+		if ec.persist {
+			if err := ec.session.SetConsistency(level); err != nil {
+				return fail("INVALID_CONSISTENCY", "%v", err)
+			}
+		}
+		effect.Previous = ec.consistency
+		ec.consistency = level
+		ec.changed = true
+		effect.Value = level
+		sr.Message = fmt.Sprintf("Consistency level set to %s.", level)
+
+	case "SERIAL CONSISTENCY":
+		if arg == "" {
+			effect.Value = ec.serialConsistency
+			sr.Message = fmt.Sprintf("Current serial consistency level is %s.", effect.Value)
+			break
+		}
+		level := strings.ToUpper(arg)
+		if err := (&db.QueryOptions{SerialConsistency: level}).Validate(); err != nil {
+			return fail("INVALID_CONSISTENCY", "%v", err)
+		}
+		if ec.persist {
+			if err := ec.session.SetSerialConsistency(level); err != nil {
+				return fail("INVALID_CONSISTENCY", "%v", err)
+			}
+		}
+		effect.Previous = ec.serialConsistency
+		ec.serialConsistency = level
+		ec.changed = true
+		effect.Value = level
+		sr.Message = fmt.Sprintf("Serial consistency level set to %s.", level)
+
+	case "PAGING":
+		if arg != "" {
+			size, err := strconv.Atoi(arg)
+			switch {
+			case strings.EqualFold(arg, "ON"):
+				size = ec.pageSize
+				if size <= 0 {
+					size = defaultScriptPageSize
+				}
+			case strings.EqualFold(arg, "OFF"):
+				size = 0
+			case err != nil || size < 0:
+				return fail("INVALID_VALUE", "Invalid paging value: %s (use ON, OFF or a page size)", arg)
+			}
+			if ec.persist {
+				ec.session.SetPageSize(size)
+			}
+			effect.Previous = pagingValue(ec.pageSize)
+			ec.pageSize = size
+			ec.changed = true
+		}
+		effect.Value = pagingValue(ec.pageSize)
+		if ec.pageSize > 0 {
+			sr.Message = fmt.Sprintf("Page size: %d", ec.pageSize)
+		} else {
+			sr.Message = "Disabled paging."
+		}
+
+	case "TRACING":
+		if arg != "" {
+			enabled := strings.EqualFold(arg, "ON")
+			if !enabled && !strings.EqualFold(arg, "OFF") {
+				return fail("INVALID_VALUE", "Invalid tracing value: %s (use ON or OFF)", arg)
+			}
+			if ec.persist {
+				ec.session.SetTracing(enabled)
+			}
+			effect.Previous = onOff(ec.tracing)
+			ec.tracing = enabled
+			ec.changed = true
+		}
+		effect.Value = onOff(ec.tracing)
+		if arg != "" {
+			sr.Message = "TRACING set to " + effect.Value
+		} else {
+			sr.Message = "TRACING is " + effect.Value
+		}
+	}
+
+	sr.Directive = effect
+	return sr, true
+}
+
+// pagingValue is the PAGING setting for a page size
+func pagingValue(size int) string {
+	if size <= 0 {
+		return "OFF"
+	}
+	return strconv.Itoa(size)
+}
+
+// onOff is the TRACING setting for a flag
+func onOff(enabled bool) string {
+	if enabled {
+		return "ON"
+	}
+	return "OFF"
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// scriptContext opens an execution context on a session without a cluster
+func scriptContext(t *testing.T, persist bool) (*executionContext, *db.Session) {
+	t.Helper()
+	const handle = 1 << 22
+	session := &db.Session{}
+	if err := session.SetConsistency("ONE"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.SetSerialConsistency("SERIAL"); err != nil {
+		t.Fatal(err)
+	}
+	session.SetPageSize(50)
+	createHandleState(handle)
+	ec := newExecutionContext(handle, session)
+	ec.persist = persist
+	t.Cleanup(func() {
+		ec.close()
+		deleteHandleState(handle)
+	})
+	return ec, session
+}
+
+func TestScriptDirectivesStayInScript(t *testing.T) {
+	ec, session := scriptContext(t, false)
+
+	if opts, err := ec.queryOptions(); opts != nil || err != nil {
+		t.Fatalf("queryOptions before any directive = %+v, %v; want nil", opts, err)
+	}
+	for _, stmt := range []string{"CONSISTENCY quorum;", "SERIAL CONSISTENCY LOCAL_SERIAL", "PAGING OFF", "TRACING ON"} {
+		sr, ok := ec.runDirective(stmt)
+		if !ok || !sr.Success {
+			t.Fatalf("%s: ok %v, result %+v", stmt, ok, sr)
+		}
+		if sr.Directive.Scope != directiveScopeScript {
+			t.Errorf("%s: scope %s, want script", stmt, sr.Directive.Scope)
+		}
+	}
+
+	if session.Consistency() != "ONE" || session.SerialConsistency() != "SERIAL" || session.PageSize() != 50 || session.Tracing() {
+		t.Errorf("session changed to %s/%s/%d/%v", session.Consistency(), session.SerialConsistency(), session.PageSize(), session.Tracing())
+	}
+
+	opts, err := ec.queryOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Consistency != "QUORUM" || opts.SerialConsistency != "LOCAL_SERIAL" {
+		t.Errorf("consistency %q/%q, want QUORUM/LOCAL_SERIAL", opts.Consistency, opts.SerialConsistency)
+	}
+	if opts.PageSize != 0 || !opts.DefaultPaging {
+		t.Errorf("pageSize %d, defaultPaging %v; want paging off", opts.PageSize, opts.DefaultPaging)
+	}
+	if !opts.TracingEnabled(session) || opts.Keyspace != "" {
+		t.Errorf("tracing %v, keyspace %q", opts.TracingEnabled(session), opts.Keyspace)
+	}
+
+	want := ScriptSettings{Consistency: "QUORUM", SerialConsistency: "LOCAL_SERIAL", Tracing: true}
+	if got := ec.settings(); got == nil || *got != want {
+		t.Errorf("settings = %+v, want %+v", got, want)
+	}
+
+	// PAGING ON comes back to a page size rather than the session's
+	if sr, _ := ec.runDirective("PAGING ON"); sr.Directive.Value != "100" || sr.Directive.Previous != "OFF" {
+		t.Errorf("PAGING ON: %+v", sr.Directive)
+	}
+	if opts, _ := ec.queryOptions(); opts.PageSize != 100 || opts.DefaultPaging {
+		t.Errorf("after PAGING ON: pageSize %d, defaultPaging %v", opts.PageSize, opts.DefaultPaging)
+	}
+}
+
+func TestScriptDirectivesKeepSharedLock(t *testing.T) {
+	ec, _ := scriptContext(t, false)
+	state := getHandleState(ec.handle)
+
+	if sr, _ := ec.runDirective("CONSISTENCY LOCAL_QUORUM"); !sr.Success {
+		t.Fatalf("CONSISTENCY: %s", sr.Error)
+	}
+	if !state.lock.TryRLock() {
+		t.Fatal("another shared operation waits for the script")
+	}
+	state.lock.RUnlock()
+	if state.lock.TryLock() {
+		state.lock.Unlock()
+		t.Fatal("the script does not hold the shared lock")
+	}
+}
+
+func TestScriptDirectiveErrors(t *testing.T) {
+	ec, _ := scriptContext(t, false)
+
+	tests := []struct {
+		stmt string
+		code string
+	}{
+		{"CONSISTENCY FAST", "INVALID_CONSISTENCY"},
+		{"SERIAL CONSISTENCY QUORUM", "INVALID_CONSISTENCY"},
+		{"PAGING -1", "INVALID_VALUE"},
+		{"PAGING SOME", "INVALID_VALUE"},
+		{"TRACING MAYBE", "INVALID_VALUE"},
+		{"USE", "KEYSPACE_ERROR"},
+	}
+	for _, tt := range tests {
+		sr, ok := ec.runDirective(tt.stmt)
+		if !ok || sr.Success || sr.ErrorCode != tt.code {
+			t.Errorf("%s: ok %v, success %v, code %q; want %s", tt.stmt, ok, sr.Success, sr.ErrorCode, tt.code)
+		}
+	}
+	if ec.settings() != nil {
+		t.Errorf("failed directives changed the settings: %+v", ec.settings())
+	}
+	if _, ok := ec.runDirective("SELECT * FROM t"); ok {
+		t.Error("SELECT taken for a directive")
+	}
+}
+
+func TestScriptKeyspaceNeedsProtocolV5(t *testing.T) {
+	ec, _ := scriptContext(t, false)
+
+	// As USE leaves it once the keyspace was found
+	ec.keyspace, ec.changed = "shop", true
+	if _, err := ec.queryOptions(); err == nil {
+		t.Error("a keyspace override without protocol v5 was accepted")
+	}
+}
+
+func TestShellDirectivesPersist(t *testing.T) {
+	ec, session := scriptContext(t, true)
+
+	for _, stmt := range []string{"CONSISTENCY LOCAL_QUORUM", "PAGING 20", "TRACING ON"} {
+		sr, _ := ec.runDirective(stmt)
+		if !sr.Success || sr.Directive.Scope != directiveScopeSession {
+			t.Fatalf("%s: %+v", stmt, sr)
+		}
+	}
+	if session.Consistency() != "LOCAL_QUORUM" || session.PageSize() != 20 || !session.Tracing() {
+		t.Errorf("session has %s/%d/%v", session.Consistency(), session.PageSize(), session.Tracing())
+	}
+	if err := ec.close(); err != nil {
+		t.Fatal(err)
+	}
+	if session.Consistency() != "LOCAL_QUORUM" {
+		t.Errorf("consistency %s after close, want LOCAL_QUORUM", session.Consistency())
+	}
+}
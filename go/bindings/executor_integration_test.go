@@ -0,0 +1,73 @@
+//go:build integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/axonops/cqlai-node/testkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutorSelect(t *testing.T) {
+	cluster := testkit.Require(t)
+	ks := cluster.Keyspace(t,
+		"CREATE TABLE items (id int PRIMARY KEY, name text, active boolean, tags list<text>, counts map<text, int>)",
+		"INSERT INTO items (id, name, active, tags, counts) VALUES (1, 'first', true, ['a', 'b'], {'x': 1})",
+	)
+	handle := connect(t, cluster, ks, nil)
+
+	raw := query(t, handle, "SELECT * FROM items WHERE id = 1")
+	testkit.Golden(t, "executor_select", raw, testkit.Shape(), testkit.Drop("execution"))
+
+	var result QueryResult
+	testkit.Data(t, raw, &result)
+	assert.Equal(t, []string{"id", "active", "counts", "name", "tags"}, result.Columns)
+	assert.Equal(t, []string{"int", "boolean", "map<text, int>", "text", "list<text>"}, result.ColumnTypes)
+	assert.Equal(t, 1, result.RowCount)
+	assert.Equal(t, ks, result.Keyspace)
+	assert.Equal(t, "items", result.Table)
+	if assert.Len(t, result.Rows, 1) {
+		row := result.Rows[0]
+		assert.EqualValues(t, 1, row["id"])
+		assert.Equal(t, "first", row["name"])
+		assert.Equal(t, true, row["active"])
+		assert.Equal(t, []interface{}{"a", "b"}, row["tags"])
+		assert.Equal(t, map[string]interface{}{"x": float64(1)}, row["counts"])
+	}
+}
+
+func TestExecutorWrites(t *testing.T) {
+	cluster := testkit.Require(t)
+	ks := cluster.Keyspace(t, "CREATE TABLE kv (k text PRIMARY KEY, v int)")
+	handle := connect(t, cluster, ks, nil)
+
+	raw := query(t, handle, "INSERT INTO kv (k, v) VALUES ('a', 1)")
+	testkit.Golden(t, "executor_insert", raw, testkit.Shape())
+
+	var lwt QueryResult
+	testkit.Data(t, query(t, handle, "INSERT INTO kv (k, v) VALUES ('a', 2) IF NOT EXISTS"), &lwt)
+	if assert.NotNil(t, lwt.Applied) {
+		assert.False(t, *lwt.Applied)
+	}
+
+	var result QueryResult
+	testkit.Data(t, query(t, handle, "SELECT v FROM kv WHERE k = 'a'"), &result)
+	if assert.Len(t, result.Rows, 1) {
+		assert.EqualValues(t, 1, result.Rows[0]["v"])
+	}
+}
+
+func TestExecutorErrors(t *testing.T) {
+	cluster := testkit.Require(t)
+	ks := cluster.Keyspace(t)
+	handle := connect(t, cluster, ks, nil)
+
+	resp := testkit.Decode(t, callHandle(ExecuteQuery, handle, "SELECT * FROM missing_table"))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "QUERY_ERROR", resp.Code)
+	assert.Contains(t, resp.Error, "missing_table")
+
+	resp = testkit.Decode(t, callHandle(ExecuteQuery, -1, "SELECT * FROM system.local"))
+	assert.Equal(t, "INVALID_HANDLE", resp.Code)
+}
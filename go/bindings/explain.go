@@ -0,0 +1,500 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+	"github.com/axonops/cqlai-node/internal/ring"
+)
+
+// Query explainer
+//
+// ExplainQuery tells where a SELECT would read without running it. The
+// partition key values of the WHERE clause are encoded as the driver binds
+// them and hashed with Murmur3 to their tokens, and the replicas of each
+// token are placed from the tokens of system.local and system.peers with the
+// keyspace's replication strategy, the way Cassandra places them. The
+// restrictions are checked against the primary key and the table's indexes
+// to tell whether the server needs ALLOW FILTERING to run the query.
+
+// maxExplainPartitions caps the partitions listed for IN lists
+const maxExplainPartitions = 100
+
+// Access kinds of an explained query
+const (
+	accessPartition      = "partition"       // A single partition
+	accessMultiPartition = "multi-partition" // The partitions of IN lists
+	accessTokenRange     = "token-range"     // A token() range of the ring
+	accessIndex          = "index"           // A secondary index lookup on every replica set
+	accessFullScan       = "full-scan"       // Every partition of the table
+)
+
+// ExplainReplica is a node holding a partition
+type ExplainReplica struct {
+	Address    string `json:"address"`
+	HostID     string `json:"hostId"`
+	Datacenter string `json:"datacenter"`
+	Rack       string `json:"rack"`
+	Up         *bool  `json:"up,omitempty"` // Absent when the driver has no connection to the node
+}
+
+// ExplainPartition is a partition the query reads
+type ExplainPartition struct {
+	Key      map[string]string `json:"key,omitempty"` // Partition key values as written; absent for token() = n
+	Token    int64             `json:"token"`
+	Replicas []ExplainReplica  `json:"replicas"`
+}
+
+// QueryExplanation is the result of ExplainQuery
+type QueryExplanation struct {
+	Keyspace               string             `json:"keyspace"`
+	Table                  string             `json:"table"`
+	Access                 string             `json:"access"`
+	PartitionRestricted    bool               `json:"partitionRestricted"` // Every partition key column restricted with = or IN
+	AllowFiltering         bool               `json:"allowFiltering"`      // The query has ALLOW FILTERING
+	RequiresAllowFiltering bool               `json:"requiresAllowFiltering"`
+	FilteringReasons       []string           `json:"filteringReasons,omitempty"`
+	Indexes                []string           `json:"indexes,omitempty"` // Secondary indexes the restrictions can use
+	Restrictions           []cql.Restriction  `json:"restrictions"`
+	Partitioner            string             `json:"partitioner"`
+	Replication            map[string]string  `json:"replication"`
+	Partitions             []ExplainPartition `json:"partitions,omitempty"`
+	PartitionCount         int                `json:"partitionCount,omitempty"`      // Partitions the IN lists select, when more are selected than listed
+	EstimatedPartitions    int64              `json:"estimatedPartitions,omitempty"` // Partitions a scan reads, from system.size_estimates
+	Warnings               []string           `json:"warnings,omitempty"`
+}
+
+// explainIndex is a secondary index and the column it indexes
+type explainIndex struct {
+	name   string
+	column string
+	target string // column, keys, values, entries or full
+	sai    bool   // SAI or SASI: several indexes and ranges per query
+}
+
+// explainQuery explains a SELECT statement
+func explainQuery(session *db.Session, query string) (*QueryExplanation, error) {
+	analysis, err := cql.AnalyzeSelect(query)
+	if err != nil {
+		return nil, err
+	}
+	keyspace := analysis.Keyspace
+	if keyspace == "" {
+		keyspace = session.Keyspace()
+	}
+	if keyspace == "" {
+		return nil, fmt.Errorf("no keyspace selected; qualify the table or USE a keyspace")
+	}
+	table, err := session.GetTableMetadata(keyspace, analysis.Table)
+	if err != nil {
+		return nil, err
+	}
+	restrictions, err := cql.ParseRestrictions(analysis.Where)
+	if err != nil {
+		return nil, err
+	}
+	if restrictions == nil {
+		restrictions = []cql.Restriction{}
+	}
+	for _, r := range restrictions {
+		for _, name := range r.Columns {
+			if table.Columns[name] == nil {
+				return nil, fmt.Errorf("column %s does not exist in %s.%s", name, keyspace, table.Name)
+			}
+		}
+	}
+
+	result := &QueryExplanation{
+		Keyspace:       keyspace,
+		Table:          table.Name,
+		AllowFiltering: analysis.AllowFiltering,
+		Restrictions:   restrictions,
+		Partitioner:    clusterPartitioner(session),
+	}
+	indexes, err := tableIndexes(session, keyspace, table.Name)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("cannot read the table's indexes: %v", err))
+	}
+	checkRestrictions(result, table, restrictions, indexes)
+
+	ks, err := session.KeyspaceMetadata(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	result.Replication = replicationByDatacenter(ks)
+
+	switch result.Access {
+	case accessPartition, accessMultiPartition, accessTokenRange:
+		placePartitions(session, result, table, ks, restrictions)
+	}
+	if result.Access != accessPartition && result.Access != accessMultiPartition {
+		result.EstimatedPartitions = estimateTableRows(session, keyspace, table.Name)
+	}
+
+	if result.RequiresAllowFiltering && !result.AllowFiltering {
+		result.Warnings = append(result.Warnings, "the server rejects this query without ALLOW FILTERING")
+	}
+	if result.Access == accessFullScan {
+		result.Warnings = append(result.Warnings, "the query reads every partition of the table")
+	}
+	return result, nil
+}
+
+// checkRestrictions classifies the query's access and finds the restrictions
+// the server can only apply by filtering
+func checkRestrictions(result *QueryExplanation, table *gocql.TableMetadata, restrictions []cql.Restriction, indexes []explainIndex) {
+	byColumn := make(map[string][]cql.Restriction)
+	tokenRestricted := false
+	for _, r := range restrictions {
+		if r.Token {
+			tokenRestricted = true
+			continue
+		}
+		byColumn[r.Columns[0]] = append(byColumn[r.Columns[0]], r)
+	}
+	var reasons []string
+	filter := func(format string, args ...interface{}) {
+		reasons = append(reasons, fmt.Sprintf(format, args...))
+	}
+
+	// Regular columns are served by an index or filtered
+	var usedIndexes []explainIndex
+	for _, r := range restrictions {
+		col := table.Columns[r.Columns[0]]
+		if r.Token || len(r.Columns) > 1 || col.Kind == gocql.ColumnPartitionKey || col.Kind == gocql.ColumnClusteringKey {
+			continue
+		}
+		idx := indexFor(indexes, r)
+		switch {
+		case idx == nil:
+			filter("column %s has no secondary index", col.Name)
+		case !idx.sai && len(usedIndexes) > 0 && !usedIndexes[0].sai:
+			filter("only one secondary index is used; column %s is filtered", col.Name)
+		default:
+			usedIndexes = append(usedIndexes, *idx)
+		}
+	}
+	for _, idx := range usedIndexes {
+		result.Indexes = append(result.Indexes, idx.name)
+	}
+
+	// The partition key: = or IN on every column, or a token() range
+	restricted, ranged := 0, []string{}
+	for _, col := range table.PartitionKey {
+		for _, r := range byColumn[col.Name] {
+			if r.Operator == "=" || r.Operator == "IN" {
+				restricted++
+				break
+			}
+			ranged = append(ranged, col.Name)
+		}
+	}
+	result.PartitionRestricted = restricted == len(table.PartitionKey)
+	if len(usedIndexes) == 0 {
+		for _, name := range ranged {
+			filter("partition key column %s is restricted by a range; only token() ranges select partitions", name)
+		}
+		if restricted > 0 && !result.PartitionRestricted {
+			filter("only part of the partition key is restricted")
+		}
+	}
+
+	// Clustering columns: a prefix of = or IN, optionally ending in a range
+	if len(usedIndexes) == 0 {
+		clusteringRestricted := false
+		prefix := true
+		for i := 0; i < len(table.ClusteringColumns); i++ {
+			col := table.ClusteringColumns[i]
+			rs := byColumn[col.Name]
+			if len(rs) == 0 {
+				prefix = false
+				continue
+			}
+			clusteringRestricted = true
+			if !prefix {
+				filter("clustering column %s is restricted but a clustering column before it is not", col.Name)
+				continue
+			}
+			for _, r := range rs {
+				if r.Operator == "CONTAINS" || r.Operator == "CONTAINS KEY" || r.Operator == "LIKE" {
+					filter("clustering column %s is restricted with %s", col.Name, r.Operator)
+				}
+				if r.Operator != "=" && r.Operator != "IN" {
+					// A slice ends the prefix
+					prefix = false
+				}
+				// A tuple restriction covers the columns after this one
+				i += len(r.Columns) - 1
+			}
+		}
+		if clusteringRestricted && !result.PartitionRestricted {
+			filter("clustering columns are restricted without the whole partition key")
+		}
+	}
+
+	result.FilteringReasons = reasons
+	result.RequiresAllowFiltering = len(reasons) > 0
+
+	switch {
+	case result.PartitionRestricted:
+		result.Access = accessPartition
+		for _, col := range table.PartitionKey {
+			for _, r := range byColumn[col.Name] {
+				if r.Operator == "IN" && len(r.Values) != 1 {
+					result.Access = accessMultiPartition
+				}
+			}
+		}
+	case tokenRestricted:
+		result.Access = accessTokenRange
+	case len(usedIndexes) > 0:
+		result.Access = accessIndex
+	default:
+		result.Access = accessFullScan
+	}
+}
+
+// placePartitions computes the tokens of the partitions the query reads and
+// their replicas
+func placePartitions(session *db.Session, result *QueryExplanation, table *gocql.TableMetadata, ks *gocql.KeyspaceMetadata, restrictions []cql.Restriction) {
+	if !strings.HasSuffix(result.Partitioner, "Murmur3Partitioner") {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("tokens are only computed for the Murmur3 partitioner; the cluster uses %s", result.Partitioner))
+		return
+	}
+
+	var partitions []ExplainPartition
+	if result.Access == accessTokenRange {
+		// token(key) = n names a single token
+		for _, r := range restrictions {
+			if !r.Token || r.Operator != "=" {
+				continue
+			}
+			token, err := strconv.ParseInt(r.Values[0], 10, 64)
+			if err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("cannot place token %s", r.Values[0]))
+				continue
+			}
+			partitions = append(partitions, ExplainPartition{Token: token})
+		}
+	} else {
+		var err error
+		partitions, result.PartitionCount, err = partitionTokens(table, restrictions)
+		if err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+			return
+		}
+		if result.PartitionCount <= len(partitions) {
+			result.PartitionCount = 0
+		} else {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("the IN lists select %d partitions; the first %d are listed", result.PartitionCount, len(partitions)))
+		}
+	}
+	if len(partitions) == 0 {
+		return
+	}
+
+	nodes, err := readRingNodes(session)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("cannot read the ring: %v", err))
+	}
+	strategy, err := ring.ParseStrategy(ks.StrategyClass, ks.StrategyOptions)
+	if err != nil {
+		result.Warnings = append(result.Warnings, err.Error())
+	}
+	r := ring.New(nodes)
+	switch {
+	case r.Empty():
+		result.Warnings = append(result.Warnings, "no node reports tokens; replicas are unknown")
+	case strategy.Class == "LocalStrategy":
+		result.Warnings = append(result.Warnings, "the keyspace uses LocalStrategy; every node holds its own data")
+	case strategy.Class != "SimpleStrategy" && strategy.Class != "NetworkTopologyStrategy" && strategy.Class != "EverywhereStrategy":
+		result.Warnings = append(result.Warnings, fmt.Sprintf("replicas of strategy %s are unknown", ks.StrategyClass))
+	}
+
+	up := make(map[string]bool)
+	for _, host := range session.GetHosts() {
+		up[host.HostID()] = host.IsUp()
+	}
+	for i := range partitions {
+		partitions[i].Replicas = []ExplainReplica{}
+		for _, node := range r.Replicas(partitions[i].Token, strategy) {
+			replica := ExplainReplica{Address: node.Address, HostID: node.HostID, Datacenter: node.DataCenter, Rack: node.Rack}
+			if isUp, ok := up[node.HostID]; ok {
+				replica.Up = &isUp
+			}
+			partitions[i].Replicas = append(partitions[i].Replicas, replica)
+		}
+	}
+	result.Partitions = partitions
+}
+
+// partitionTokens returns the partitions selected by the = and IN
+// restrictions of the partition key, at most maxExplainPartitions of them,
+// and how many they select
+func partitionTokens(table *gocql.TableMetadata, restrictions []cql.Restriction) ([]ExplainPartition, int, error) {
+	values := make([][]string, len(table.PartitionKey))
+	encoded := make([][][]byte, len(table.PartitionKey))
+	total := 1
+	for i, col := range table.PartitionKey {
+		for _, r := range restrictions {
+			if !r.Token && len(r.Columns) == 1 && r.Columns[0] == col.Name && (r.Operator == "=" || r.Operator == "IN") {
+				values[i] = r.Values
+				break
+			}
+		}
+		coercer, err := db.NewCoercer(col.Validator)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot encode partition key column %s of type %s: %v", col.Name, col.Validator, err)
+		}
+		for _, v := range values[i] {
+			if cql.IsBindMarker(v) {
+				return nil, 0, fmt.Errorf("partition key column %s is a bind marker; tokens need literal values", col.Name)
+			}
+			value, err := coercer.CoerceBindable(cql.LiteralText(v))
+			if err != nil {
+				return nil, 0, fmt.Errorf("cannot encode %s for partition key column %s: %v", v, col.Name, err)
+			}
+			b, err := gocql.Marshal(col.Type, value)
+			if err != nil {
+				return nil, 0, fmt.Errorf("cannot encode %s for partition key column %s: %v", v, col.Name, err)
+			}
+			encoded[i] = append(encoded[i], b)
+		}
+		total *= len(values[i])
+	}
+
+	// The cartesian product of the IN lists, in list order
+	var partitions []ExplainPartition
+	choice := make([]int, len(values))
+	for n := 0; n < min(total, maxExplainPartitions); n++ {
+		key := make(map[string]string, len(values))
+		components := make([][]byte, len(values))
+		for i, col := range table.PartitionKey {
+			key[col.Name] = values[i][choice[i]]
+			components[i] = encoded[i][choice[i]]
+		}
+		partitions = append(partitions, ExplainPartition{Key: key, Token: ring.Murmur3Token(ring.PartitionKey(components))})
+		for i := len(choice) - 1; i >= 0; i-- {
+			choice[i]++
+			if choice[i] < len(values[i]) {
+				break
+			}
+			choice[i] = 0
+		}
+	}
+	return partitions, total, nil
+}
+
+// readRingNodes reads the tokens of every node from system.local and
+// system.peers
+func readRingNodes(session *db.Session) ([]ring.Node, error) {
+	nodes, _, err := readRingTokens(session)
+	return nodes, err
+}
+
+// readRingTokens reads the ring's nodes along with each node's tokens as the
+// cluster reports them, which for partitioners other than Murmur3 are not
+// ring tokens
+func readRingTokens(session *db.Session) ([]ring.Node, [][]string, error) {
+	var nodes []ring.Node
+	var raw [][]string
+	var address, dc, rack string
+	var hostID gocql.UUID
+	var tokens []string
+
+	iter := session.Query("SELECT broadcast_address, host_id, data_center, rack, tokens FROM system.local").Iter()
+	for iter.Scan(&address, &hostID, &dc, &rack, &tokens) {
+		nodes = append(nodes, ringNode(address, hostID, dc, rack, tokens))
+		raw = append(raw, tokens)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	iter = session.Query("SELECT peer, host_id, data_center, rack, tokens FROM system.peers").Iter()
+	for iter.Scan(&address, &hostID, &dc, &rack, &tokens) {
+		nodes = append(nodes, ringNode(address, hostID, dc, rack, tokens))
+		raw = append(raw, tokens)
+	}
+	if err := iter.Close(); err != nil {
+		return nodes, raw, err
+	}
+	return nodes, raw, nil
+}
+
+// ringNode builds a ring node, skipping tokens that are not Murmur3 tokens
+func ringNode(address string, hostID gocql.UUID, dc, rack string, tokens []string) ring.Node {
+	node := ring.Node{Address: address, HostID: hostID.String(), DataCenter: dc, Rack: rack}
+	for _, t := range tokens {
+		if token, err := strconv.ParseInt(t, 10, 64); err == nil {
+			node.Tokens = append(node.Tokens, token)
+		}
+	}
+	return node
+}
+
+// tableIndexes reads the secondary indexes of a table
+func tableIndexes(session *db.Session, keyspace, table string) ([]explainIndex, error) {
+	iter := session.Query("SELECT index_name, kind, options FROM system_schema.indexes WHERE keyspace_name = ? AND table_name = ?", keyspace, table).Iter()
+	var indexes []explainIndex
+	var name, kind string
+	var options map[string]string
+	for iter.Scan(&name, &kind, &options) {
+		idx := explainIndex{name: name, target: "column"}
+		idx.column = options["target"]
+		if open := strings.IndexByte(idx.column, '('); open > 0 && strings.HasSuffix(idx.column, ")") {
+			idx.target = idx.column[:open]
+			idx.column = idx.column[open+1 : len(idx.column)-1]
+		}
+		if strings.HasPrefix(idx.column, `"`) && strings.HasSuffix(idx.column, `"`) && len(idx.column) > 1 {
+			idx.column = strings.ReplaceAll(idx.column[1:len(idx.column)-1], `""`, `"`)
+		}
+		class := options["class_name"]
+		idx.sai = kind == "CUSTOM" && (strings.Contains(class, "StorageAttachedIndex") || strings.Contains(class, "SASIIndex"))
+		indexes = append(indexes, idx)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].name < indexes[j].name })
+	return indexes, nil
+}
+
+// indexFor returns the index that can serve a restriction of a regular
+// column, or nil. Legacy indexes serve equality only; SAI and SASI also
+// serve ranges, and LIKE is served by SASI and SAI only.
+func indexFor(indexes []explainIndex, r cql.Restriction) *explainIndex {
+	target := "column"
+	switch {
+	case r.Operator == "CONTAINS KEY":
+		target = "keys"
+	case r.Operator == "CONTAINS":
+		target = "values"
+	case r.Element != "":
+		target = "entries"
+	}
+	for i := range indexes {
+		idx := &indexes[i]
+		if idx.column != r.Columns[0] {
+			continue
+		}
+		if idx.target != target && !(target == "column" && idx.target == "full") && !(target == "values" && idx.target == "column") {
+			continue
+		}
+		switch r.Operator {
+		case "=", "CONTAINS", "CONTAINS KEY":
+			return idx
+		case "IN", "<", "<=", ">", ">=", "LIKE":
+			if idx.sai {
+				return idx
+			}
+		}
+	}
+	return nil
+}
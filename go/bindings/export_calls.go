@@ -0,0 +1,38 @@
+//go:build integration || race
+
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import "unsafe"
+
+// Go entry points to the exports taking a session handle, shared by the
+// integration suites and the race stress tests, which cannot use cgo
+// themselves. Each returns the export's JSON response and frees it the way
+// the JavaScript side does.
+
+// callHandle calls an export that takes a session handle and a JSON or
+// string argument
+func callHandle(fn func(C.int, *C.char) *C.char, handle int, arg string) string {
+	cArg := C.CString(arg)
+	defer C.free(unsafe.Pointer(cArg))
+	return goResponse(fn(C.int(handle), cArg))
+}
+
+// callHandleOptions calls an export that takes a session handle, a string
+// argument and a JSON options argument
+func callHandleOptions(fn func(C.int, *C.char, *C.char) *C.char, handle int, arg, options string) string {
+	cArg := C.CString(arg)
+	defer C.free(unsafe.Pointer(cArg))
+	cOptions := C.CString(options)
+	defer C.free(unsafe.Pointer(cOptions))
+	return goResponse(fn(C.int(handle), cArg, cOptions))
+}
+
+// goResponse copies a response into Go memory and frees it
+func goResponse(resp *C.char) string {
+	defer FreeString(resp)
+	return C.GoString(resp)
+}
@@ -5,22 +5,44 @@ package main
 */
 import "C"
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
 	"unsafe"
 
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
 	"github.com/axonops/cqlai-node/internal/batch"
+	"github.com/axonops/cqlai-node/internal/catalog"
 	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/cql"
 	"github.com/axonops/cqlai-node/internal/db"
+	"github.com/axonops/cqlai-node/internal/filesink"
+	"github.com/axonops/cqlai-node/internal/logger"
 )
 
 // getTraceIDIfEnabled returns the trace session ID only if tracing is currently enabled
 // This prevents returning stale trace IDs from previous traced queries
 func getTraceIDIfEnabled(session *db.Session) string {
-	if session.Tracing() {
+	return statementTraceID(session, nil)
+}
+
+// statementTraceID returns the trace ID of a statement run with opts, or ""
+// when it was not traced
+func statementTraceID(session *db.Session, opts *db.QueryOptions) string {
+	if opts.TracingEnabled(session) {
 		return session.LastTraceID()
 	}
 	return ""
@@ -30,6 +52,41 @@ func getTraceIDIfEnabled(session *db.Session) string {
 // Supports: SELECT/INSERT/UPDATE/DELETE FROM [keyspace.]table
 // Handles quoted identifiers: "Keyspace"."Table"
 func parseTableReference(query string, currentKeyspace string) (keyspace, table string) {
+	match := tableReference(query)
+	if match == "" {
+		return "", ""
+	}
+
+	// Remove quotes and split by dot
+	match = strings.ReplaceAll(match, `"`, "")
+	parts := strings.Split(match, ".")
+
+	if len(parts) == 2 {
+		// keyspace.table format
+		keyspace = parts[0]
+		table = parts[1]
+	} else if len(parts) == 1 {
+		// Just table name, use current keyspace
+		keyspace = currentKeyspace
+		table = parts[0]
+	}
+
+	return keyspace, table
+}
+
+// schemaTableReference is parseTableReference with the names as the schema
+// has them: unquoted names lowercased, quoted ones as written
+func schemaTableReference(query string, currentKeyspace string) (keyspace, table string) {
+	match := tableReference(query)
+	if match == "" {
+		return "", ""
+	}
+	return splitTableName(match, currentKeyspace)
+}
+
+// tableReference returns the [keyspace.]table a CQL query reads or writes,
+// quotes included, or "" when none is found
+func tableReference(query string) string {
 	// Normalize whitespace and convert to uppercase for keyword matching
 	normalized := strings.Join(strings.Fields(query), " ")
 	upper := strings.ToUpper(normalized)
@@ -55,7 +112,7 @@ func parseTableReference(query string, currentKeyspace string) (keyspace, table
 	}
 
 	if fromIdx == -1 {
-		return "", ""
+		return ""
 	}
 
 	// Extract the part after FROM/INTO/UPDATE
@@ -64,51 +121,76 @@ func parseTableReference(query string, currentKeyspace string) (keyspace, table
 	// Parse table reference (handles keyspace.table and quoted identifiers)
 	// Pattern: optional_keyspace.table or "keyspace"."table"
 	tableRefPattern := regexp.MustCompile(`^("?[a-zA-Z_][a-zA-Z0-9_]*"?\.)?("?[a-zA-Z_][a-zA-Z0-9_]*"?)`)
-	match := tableRefPattern.FindString(remainder)
-
-	if match == "" {
-		return "", ""
-	}
-
-	// Remove quotes and split by dot
-	match = strings.ReplaceAll(match, `"`, "")
-	parts := strings.Split(match, ".")
-
-	if len(parts) == 2 {
-		// keyspace.table format
-		keyspace = parts[0]
-		table = parts[1]
-	} else if len(parts) == 1 {
-		// Just table name, use current keyspace
-		keyspace = currentKeyspace
-		table = parts[0]
-	}
-
-	return keyspace, table
+	return tableRefPattern.FindString(remainder)
 }
 
 // Session handle management
 var (
 	sessions      = make(map[int]*db.Session)
-	astraSessions = make(map[int]bool) // Track which sessions are Astra connections
+	astraSessions = make(map[int]string) // Bundle paths of the sessions that are Astra connections
 	sessionMutex  sync.RWMutex
 	nextHandle    = 1
 )
 
-// Pending connection cancellation support
-var (
-	pendingConnections      = make(map[string]chan struct{})
-	pendingConnectionsMutex sync.Mutex
-)
-
 // Paged query iterator storage
 type pagedQueryState struct {
+	mu          sync.Mutex // Serializes iterator access; gocql iterators are not goroutine-safe
+	closed      bool
 	Session     *db.Session
 	Iterator    interface{ MapScan(map[string]interface{}) bool; Close() error }
 	ColumnNames []string
 	ColumnTypes []string
 	PageSize    int
+	Display     *resultDisplay         // Columns shown, for a result switched to paging by ExecuteQueryWithOptions
+	Rows        rowSource              // Reads Iterator into pooled row maps
 	PeekedRow   map[string]interface{} // Row peeked ahead to check hasMore
+	Execution   *db.ExecutionObserver  // Attempts made for each page fetched
+	Keyspace    string                 // Source keyspace, for schema drop detection
+	Table       string                 // Source table, for schema drop detection
+
+	schemaChanged atomic.Pointer[string] // Set when the source keyspace or table is dropped
+	cancel        context.CancelFunc     // Ends the context the query runs under, for a result switched to paging
+}
+
+// close closes the iterator once, waiting for any in-flight fetch to finish.
+// Callers must not hold pagedQueriesMutex.
+func (state *pagedQueryState) close() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.closed {
+		return
+	}
+	state.closeLocked()
+}
+
+// closeLocked closes the iterator and ends the query's context. Callers hold
+// state.mu and have checked that it is not closed yet.
+func (state *pagedQueryState) closeLocked() error {
+	state.closed = true
+	var err error
+	if state.Iterator != nil {
+		err = state.Iterator.Close()
+	}
+	if state.cancel != nil {
+		state.cancel()
+	}
+	return err
+}
+
+// discardPagedQueries closes the paged queries of a session that is closing
+func discardPagedQueries(session *db.Session) {
+	pagedQueriesMutex.Lock()
+	var closed []*pagedQueryState
+	for qID, state := range pagedQueries {
+		if state.Session == session {
+			closed = append(closed, state)
+			delete(pagedQueries, qID)
+		}
+	}
+	pagedQueriesMutex.Unlock()
+	for _, state := range closed {
+		state.close()
+	}
 }
 
 var (
@@ -145,6 +227,12 @@ type SessionOptions struct {
 	Consistency    string `json:"consistency"`
 	ConnectTimeout int    `json:"connectTimeout"`
 	RequestTimeout int    `json:"requestTimeout"`
+	QueryTimeout   int    `json:"queryTimeout"` // Milliseconds a statement may take, all pages included
+	PageSize       int    `json:"pageSize"`     // Rows per page (0 = the config file or 100)
+
+	// Seconds of silence before TCP keepalive probes are sent on driver
+	// connections (0 = the Go default of 15s)
+	SocketKeepalive int `json:"socketKeepalive"`
 
 	// cqlshrc-based connection
 	Cqlshrc string `json:"cqlshrc"` // Path to cqlshrc file
@@ -168,6 +256,195 @@ type SessionOptions struct {
 	// RSA credential decryption
 	RSAPrivateKey     string `json:"rsaPrivateKey"`     // PEM-encoded private key
 	RSAPrivateKeyFile string `json:"rsaPrivateKeyFile"` // Path to private key file
+
+	// Speculative execution for reads
+	SpeculativeExecution *SpeculativeExecutionOptions `json:"speculativeExecution"`
+
+	// Schema cache scope: "full" (default), "keyspace" or "off"
+	SchemaCache string `json:"schemaCache"`
+
+	// Save a full schema cache between connections, in schemaCacheDir or the
+	// user cache directory
+	PersistSchemaCache bool   `json:"persistSchemaCache"`
+	SchemaCacheDir     string `json:"schemaCacheDir"`
+
+	// Consistency level to retry a read at when the requested one cannot be met
+	ConsistencyFallback string `json:"consistencyFallback"`
+
+	// Client-side circuit breaker that avoids coordinators with a high error rate
+	CircuitBreaker *CircuitBreakerOptions `json:"circuitBreaker"`
+
+	// Contact points besides host ("host" or "host:port"), and how
+	// coordinators are picked
+	Hosts         []string              `json:"hosts"`
+	LoadBalancing *LoadBalancingOptions `json:"loadBalancing"`
+}
+
+// SpeculativeExecutionOptions configures the driver's speculative execution policy.
+// Only SELECT statements are executed speculatively since they are idempotent.
+type SpeculativeExecutionOptions struct {
+	MaxAttempts int `json:"maxAttempts"` // Additional executions to start (0 = disabled)
+	DelayMs     int `json:"delayMs"`     // Delay before each additional execution
+}
+
+// applySpeculativeExecution validates the options and copies them onto the db session options
+func applySpeculativeExecution(opts *SpeculativeExecutionOptions, dbOpts *db.SessionOptions) error {
+	if opts == nil || opts.MaxAttempts == 0 {
+		return nil
+	}
+	if opts.MaxAttempts < 0 {
+		return fmt.Errorf("speculativeExecution.maxAttempts must not be negative")
+	}
+	if opts.DelayMs <= 0 {
+		return fmt.Errorf("speculativeExecution.delayMs must be greater than 0")
+	}
+	dbOpts.SpeculativeAttempts = opts.MaxAttempts
+	dbOpts.SpeculativeDelay = time.Duration(opts.DelayMs) * time.Millisecond
+	return nil
+}
+
+// applyConsistencyFallback validates the consistencyFallback option and copies it onto the db session options
+func applyConsistencyFallback(level string, dbOpts *db.SessionOptions) error {
+	if level != "" && !db.ValidConsistency(level) {
+		return fmt.Errorf("consistencyFallback must be a consistency level such as \"LOCAL_ONE\"")
+	}
+	dbOpts.ConsistencyFallback = level
+	return nil
+}
+
+// CircuitBreakerOptions configures the client-side circuit breaker. Options
+// left at 0 take the defaults of db.DefaultCircuitBreakerOptions.
+type CircuitBreakerOptions struct {
+	ErrorRate   float64 `json:"errorRate"`   // Error rate (0-1) over the window that opens the breaker
+	MinRequests int     `json:"minRequests"` // Requests in the window before the rate is judged
+	WindowMs    int     `json:"windowMs"`    // Window the error rate is measured over
+	OpenMs      int     `json:"openMs"`      // How long a host is avoided before a probe request
+}
+
+// toDB converts the options to the db session's, checking them
+func (o *CircuitBreakerOptions) toDB() (*db.CircuitBreakerOptions, error) {
+	if o == nil {
+		return nil, nil
+	}
+	opts, err := db.CircuitBreakerOptions{
+		ErrorRate:   o.ErrorRate,
+		MinRequests: o.MinRequests,
+		Window:      time.Duration(o.WindowMs) * time.Millisecond,
+		OpenFor:     time.Duration(o.OpenMs) * time.Millisecond,
+	}.WithDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
+
+// circuitBreakerSettings returns the session's breaker settings, or nil when it is disabled
+func circuitBreakerSettings(session *db.Session) *CircuitBreakerOptions {
+	opts := session.CircuitBreaker()
+	if opts == nil {
+		return nil
+	}
+	return &CircuitBreakerOptions{
+		ErrorRate:   opts.ErrorRate,
+		MinRequests: opts.MinRequests,
+		WindowMs:    int(opts.Window.Milliseconds()),
+		OpenMs:      int(opts.OpenFor.Milliseconds()),
+	}
+}
+
+// applyCircuitBreaker validates the circuitBreaker option and copies it onto the db session options
+func applyCircuitBreaker(opts *CircuitBreakerOptions, dbOpts *db.SessionOptions) error {
+	breaker, err := opts.toDB()
+	if err != nil {
+		return err
+	}
+	dbOpts.CircuitBreaker = breaker
+	return nil
+}
+
+// LoadBalancingOptions chooses how coordinators are picked
+type LoadBalancingOptions struct {
+	Policy     string `json:"policy"`     // "round-robin" (default) or "dc-aware"
+	LocalDC    string `json:"localDC"`    // Data center whose hosts are preferred; required by dc-aware
+	TokenAware bool   `json:"tokenAware"` // Send statements to a replica of their partition first
+}
+
+// applyLoadBalancing validates the hosts and loadBalancing options and copies
+// them onto the db session options
+func applyLoadBalancing(hosts []string, opts *LoadBalancingOptions, dbOpts *db.SessionOptions) error {
+	dbOpts.Hosts = hosts
+	if opts == nil {
+		return nil
+	}
+	lb, err := db.LoadBalancingOptions{Policy: opts.Policy, LocalDC: opts.LocalDC, TokenAware: opts.TokenAware}.WithDefaults()
+	if err != nil {
+		return err
+	}
+	dbOpts.LoadBalancing = &lb
+	return nil
+}
+
+// applySchemaCacheMode validates the schemaCache option and copies it onto the db session options
+func applySchemaCacheMode(mode string, dbOpts *db.SessionOptions) error {
+	if mode != "" && !db.ValidSchemaCacheMode(mode) {
+		return fmt.Errorf("schemaCache must be \"full\", \"keyspace\" or \"off\"")
+	}
+	dbOpts.SchemaCache = mode
+	return nil
+}
+
+// applySchemaCachePersistence sets the directory a full schema cache is saved
+// in when persist is set: dir, or cqlai/schema-cache in the user cache directory
+func applySchemaCachePersistence(persist bool, dir string, dbOpts *db.SessionOptions) error {
+	if !persist {
+		if dir != "" {
+			return fmt.Errorf("schemaCacheDir requires persistSchemaCache")
+		}
+		return nil
+	}
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		dbOpts.SchemaCacheDir = filepath.Join(base, "cqlai", "schema-cache")
+		return nil
+	}
+	cleanDir, err := config.NormalizePath(dir)
+	if err != nil {
+		return fmt.Errorf("invalid schemaCacheDir: %v", err)
+	}
+	dbOpts.SchemaCacheDir = cleanDir
+	return nil
+}
+
+// refreshSavedSchemaCache reloads, in the background, a schema cache the
+// session loaded from disk, so lookups are answered from the saved copy until
+// the cluster's metadata has been read. It holds the handle shared, so USE and
+// SetSchemaCacheMode wait for it.
+func refreshSavedSchemaCache(handle int, session *db.Session) {
+	cache := session.GetSchemaCache()
+	if cache == nil {
+		return
+	}
+	cache.Mu.RLock()
+	source := cache.Source
+	cache.Mu.RUnlock()
+	if source != db.SchemaSourceDisk {
+		return
+	}
+	trackHandleWorkers(handle, 1)
+	go func() {
+		defer trackHandleWorkers(handle, -1)
+		unlock := lockHandleShared(handle)
+		defer unlock()
+		if getSession(handle) != session {
+			return
+		}
+		if err := session.RefreshSchemaCache(); err != nil {
+			logger.DebugfToFile("SchemaCache", "Background schema refresh failed: %v", err)
+		}
+	}()
 }
 
 // QueryResult represents query results for JSON serialization
@@ -180,12 +457,25 @@ type QueryResult struct {
 	TraceSessionID string                   `json:"traceSessionId,omitempty"` // Present when tracing is enabled
 	Keyspace       string                   `json:"keyspace,omitempty"`       // Source keyspace for the query
 	Table          string                   `json:"table,omitempty"`          // Source table for the query
+	Execution      *db.ExecutionInfo        `json:"execution,omitempty"`      // Coordinator and attempts that served the query
+	Applied        *bool                    `json:"applied,omitempty"`        // Set for conditional (IF ...) writes; rows then hold [applied]
+
+	// Set when the result passed the session's result limit and rows is
+	// its first page (see result_limit.go)
+	ModeSwitched bool   `json:"modeSwitched,omitempty"`
+	HasMore      bool   `json:"hasMore,omitempty"`
+	QueryID      string `json:"queryId,omitempty"` // For FetchNextPage
+	Warning      string `json:"warning,omitempty"`
+
+	Split *InSplitInfo `json:"split,omitempty"` // Set when the IN list was split into several queries (see in_split.go)
 }
 
 // StatementResult represents the result of executing a single statement in multi-query
 type StatementResult struct {
 	Index          int                      `json:"index"`                     // 0-based statement index
-	Statement      string                   `json:"statement"`                 // The CQL statement text (truncated)
+	Statement      string                   `json:"statement"`                 // The CQL statement text, truncated to the preview length
+	StatementHash  string                   `json:"statementHash"`             // SHA-256 of the full text, for GetStatementText
+	Truncated      bool                     `json:"truncated,omitempty"`       // True if Statement is a preview
 	Identifier     string                   `json:"identifier"`                // Statement type (SELECT, INSERT, etc.)
 	Success        bool                     `json:"success"`
 	Error          string                   `json:"error,omitempty"`
@@ -199,11 +489,31 @@ type StatementResult struct {
 	TraceSessionID string                   `json:"traceSessionId,omitempty"`
 	Keyspace       string                   `json:"keyspace,omitempty"`
 	Table          string                   `json:"table,omitempty"`
+	Execution      *db.ExecutionInfo        `json:"execution,omitempty"`
+	Applied        *bool                    `json:"applied,omitempty"`     // Set for conditional (IF ...) writes
+	Descriptor     *cql.StatementDescriptor `json:"descriptor,omitempty"`  // Structured kind, target and options of the statement
+	ScanEstimate   *ScanEstimate            `json:"scanEstimate,omitempty"` // Set when the scan guard refused the statement
+	PayloadTooLarge *PayloadTooLarge        `json:"payloadTooLarge,omitempty"` // Set when the statement is larger than the server accepts
+	Score          *SimilarityScore         `json:"score,omitempty"`        // Column added by the similarityScore option
+	Directive      *DirectiveEffect         `json:"directive,omitempty"`    // Set for USE and cqlsh directives (CONSISTENCY, PAGING, ...)
+	Settings       *ScriptSettings          `json:"settings,omitempty"`     // Settings the statement ran with, once the script changed them
+	Warnings       []string                 `json:"warnings,omitempty"`
 }
 
 // MultiQueryOptions contains options for multi-statement execution
 type MultiQueryOptions struct {
-	StopOnError bool `json:"stopOnError"` // Stop execution on first error
+	StopOnError   bool   `json:"stopOnError"`   // Stop execution on first error
+	Force         bool   `json:"force"`         // Run partition scans the scan guard would refuse
+	CancelToken   string `json:"cancelToken"`   // Token for Cancel; CancelQuery also stops execution
+	PreviewLength int    `json:"previewLength"` // Characters of each statement echoed in results; 0 is 500, negative keeps all
+
+	// Add the similarity score to vector searches (ORDER BY ... ANN OF):
+	// cosine, euclidean, dot_product, or auto for the index's function
+	SimilarityScore string `json:"similarityScore"`
+
+	handle int               // Session whose scan guard applies
+	ctx    context.Context   // Cancelled by Cancel or CancelQuery; nil runs uncancellable
+	exec   *executionContext // Applies USE and cqlsh directives; nil sends them to the server
 }
 
 // MultiQueryResult represents the result of executing multiple statements
@@ -214,15 +524,19 @@ type MultiQueryResult struct {
 	ExtraTokens        []string          `json:"extraTokens"`        // 2nd/3rd tokens from first statement
 	SecondTokens       []string          `json:"secondTokens"`       // 2nd meaningful token of each statement
 	ThirdTokens        []string          `json:"thirdTokens"`        // 3rd meaningful token of each statement
+	Descriptors        []cql.StatementDescriptor `json:"descriptors"` // Structured form of the token arrays above, one per statement
 	Results            []StatementResult `json:"results"`
 	Incomplete         bool              `json:"incomplete"`         // True if input was incomplete
 	ParseError         string            `json:"parseError,omitempty"`
 	Stopped            bool              `json:"stopped"`            // True if stopped due to error
+	Cancelled          bool              `json:"cancelled,omitempty"` // True if stopped by Cancel or CancelQuery
 }
 
-// resolveSessionOptions merges cqlshrc config with direct options
-// Direct options override cqlshrc values
-func resolveSessionOptions(opts *SessionOptions) error {
+// resolveSessionOptions merges cqlshrc config and workspace defaults with
+// direct options. Direct options override cqlshrc values, which override the
+// workspace defaults (see settings.go). It returns the layer each session
+// setting comes from.
+func resolveSessionOptions(opts *SessionOptions) (map[string]string, error) {
 	// If cqlshrc is provided and valid, parse it and merge
 	if opts.Cqlshrc != "" && opts.Cqlshrc != "undefined" {
 		config, err := ParseCqlshrcWithVariables(
@@ -232,7 +546,7 @@ func resolveSessionOptions(opts *SessionOptions) error {
 			opts.WorkspaceID,
 		)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// Apply cqlshrc values only if not already set by direct options
@@ -264,6 +578,7 @@ func resolveSessionOptions(opts *SessionOptions) error {
 			opts.SSLValidate = &config.SSL.Validate
 		}
 	}
+	sources := applyWorkspaceDefaults(opts)
 
 	// Set defaults
 	if opts.Host == "" {
@@ -279,7 +594,7 @@ func resolveSessionOptions(opts *SessionOptions) error {
 		opts.Password = tryDecryptCredential(opts.Password, opts.RSAPrivateKey, opts.RSAPrivateKeyFile)
 	}
 
-	return nil
+	return sources, nil
 }
 
 // tryDecryptCredential attempts to decrypt a value using RSA private key
@@ -331,6 +646,9 @@ func registerSession(s *db.Session) int {
 	handle := nextHandle
 	sessions[handle] = s
 	nextHandle++
+	createHandleState(handle)
+	watchSchemaDrops(s)
+	recordUsage(usageSessions, 1)
 	return handle
 }
 
@@ -347,20 +665,53 @@ func removeSession(handle int) {
 	defer sessionMutex.Unlock()
 	delete(sessions, handle)
 	delete(astraSessions, handle)
+	deleteHandleState(handle)
+	discardRollbackPlan(handle)
+	discardDDLOperations(handle)
+	discardScanGuard(handle)
+	discardResultLimit(handle)
+	discardInSplit(handle)
+	discardPayloadLimits(handle)
+	discardCountProgress(handle)
+	discardFetchProgress(handle)
+	discardAsyncQueries(handle)
+	discardStreams(handle)
+	discardCopyJobs(handle)
+	discardStatementTexts(handle)
+	discardPreparedStatements(handle)
+	discardScratchSpaces(handle)
+	discardConfigWatch(handle)
+	discardSchemaSubscription(handle)
+	discardAstraRefresh(handle)
+	discardCapture(handle)
+	discardAccessSampler(handle)
+	discardQueryProfiler(handle)
+	discardCancellables(handle)
+	discardSessionSettings(handle)
+	removeSchedulerHandle(handle)
 }
 
-// markSessionAsAstra marks a session as an Astra connection
-func markSessionAsAstra(handle int) {
+// markSessionAsAstra marks a session as an Astra connection made with a
+// secure connect bundle
+func markSessionAsAstra(handle int, bundlePath string) {
 	sessionMutex.Lock()
 	defer sessionMutex.Unlock()
-	astraSessions[handle] = true
+	astraSessions[handle] = bundlePath
+}
+
+// astraBundlePath returns the secure connect bundle of an Astra session, or ""
+func astraBundlePath(handle int) string {
+	sessionMutex.RLock()
+	defer sessionMutex.RUnlock()
+	return astraSessions[handle]
 }
 
 // isAstraSession checks if a session is an Astra connection
 func isAstraSession(handle int) bool {
 	sessionMutex.RLock()
 	defer sessionMutex.RUnlock()
-	return astraSessions[handle]
+	_, ok := astraSessions[handle]
+	return ok
 }
 
 //export CreateSession
@@ -372,8 +723,9 @@ func CreateSession(optionsJSON *C.char) *C.char {
 		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
-	// Resolve options (cqlshrc + variables + defaults)
-	if err := resolveSessionOptions(&opts); err != nil {
+	// Resolve options (cqlshrc + variables + workspace defaults + defaults)
+	sources, err := resolveSessionOptions(&opts)
+	if err != nil {
 		return jsonResponse(false, nil, "Failed to parse config: "+err.Error(), "CONFIG_ERROR")
 	}
 
@@ -387,7 +739,34 @@ func CreateSession(optionsJSON *C.char) *C.char {
 		Consistency:    opts.Consistency,
 		ConnectTimeout: opts.ConnectTimeout,
 		RequestTimeout: opts.RequestTimeout,
+		QueryTimeout:   time.Duration(opts.QueryTimeout) * time.Millisecond,
 		BatchMode:      false, // Enable schema cache for better performance
+		Workspace:      opts.WorkspaceID,
+	}
+	if opts.SocketKeepalive < 0 {
+		return jsonResponse(false, nil, "socketKeepalive must not be negative", "INVALID_OPTIONS")
+	}
+	if opts.PageSize < 0 {
+		return jsonResponse(false, nil, "pageSize must not be negative", "INVALID_OPTIONS")
+	}
+	dbOpts.SocketKeepalive = time.Duration(opts.SocketKeepalive) * time.Second
+	if err := applySpeculativeExecution(opts.SpeculativeExecution, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applySchemaCacheMode(opts.SchemaCache, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applySchemaCachePersistence(opts.PersistSchemaCache, opts.SchemaCacheDir, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applyConsistencyFallback(opts.ConsistencyFallback, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applyCircuitBreaker(opts.CircuitBreaker, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applyLoadBalancing(opts.Hosts, opts.LoadBalancing, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
 	}
 
 	// Apply SSL options if provided
@@ -412,8 +791,14 @@ func CreateSession(optionsJSON *C.char) *C.char {
 		return jsonResponse(false, nil, "Connection failed: "+err.Error(), "CONNECTION_FAILED")
 	}
 
+	if opts.PageSize > 0 {
+		session.SetPageSize(opts.PageSize)
+	}
+
 	// Register and return handle
 	handle := registerSession(session)
+	recordSessionSettings(handle, session, sources)
+	refreshSavedSchemaCache(handle, session)
 
 	// Build response with connection info
 	responseData := map[string]interface{}{
@@ -443,6 +828,12 @@ func CloseSession(handle C.int) *C.char {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
+	dropSessionScratchSpaces(h, session)
+	discardPagedQueries(session)
+	closeRowStreams(h)
+	if err := session.SaveSchemaCache(); err != nil {
+		logger.DebugfToFile("SchemaCache", "Failed to save schema cache: %v", err)
+	}
 	session.Close()
 	removeSession(h)
 	return jsonResponse(true, nil, "", "")
@@ -456,17 +847,140 @@ func ExecuteQuery(handle C.int, query *C.char) *C.char {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	cql := C.GoString(query)
+	// An empty token cannot be in use, so this never fails
+	ctx, finish, _ := startCancellable("", h, "query")
+	defer finish()
+	return executeQuery(ctx, h, session, C.GoString(query), nil, nil, getResultLimit(h), getInSplit(h))
+}
+
+// QueryCallOptions are the options of ExecuteQueryWithOptions
+type QueryCallOptions struct {
+	db.QueryOptions
+	Timeout     int                 `json:"timeout,omitempty"`     // Milliseconds for the query and all of its pages; the session query timeout when 0
+	Display     *DisplayOptions     `json:"display,omitempty"`     // Columns to return, their order and names
+	CancelToken string              `json:"cancelToken,omitempty"` // Token Cancel interrupts the query with
+	ResultLimit *ResultLimitOptions `json:"resultLimit,omitempty"` // Replaces the session's result limit for this query
+	InSplit     *InSplitOptions     `json:"inSplit,omitempty"`     // Replaces the session's IN split settings for this query
+}
+
+// ExecuteQueryWithOptions runs a query as ExecuteQuery does, with optionsJSON
+// {"consistency", "serialConsistency", "timeout", "pageSize", "idempotent",
+// "resultLimit", "inSplit"} overriding the session's settings for this query only,
+// "display" choosing the columns of the result (see display.go) and
+// "cancelToken" naming the query for Cancel
+//
+//export ExecuteQueryWithOptions
+func ExecuteQueryWithOptions(handle C.int, query *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts QueryCallOptions
+	if optionsJSON != nil {
+		if optStr := C.GoString(optionsJSON); optStr != "" {
+			if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+				return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+			}
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if opts.Timeout < 0 {
+		return jsonResponse(false, nil, "timeout must not be negative", "INVALID_OPTIONS")
+	}
+	if err := opts.Display.validate(); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	limit := getResultLimit(h)
+	if opts.ResultLimit != nil {
+		if err := opts.ResultLimit.validate(); err != nil {
+			return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+		}
+		limit = *opts.ResultLimit
+	}
+	inSplit := getInSplit(h)
+	if opts.InSplit != nil {
+		if err := opts.InSplit.validate(); err != nil {
+			return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+		}
+		inSplit = *opts.InSplit
+	}
+
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "query")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(opts.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	return executeQuery(ctx, h, session, C.GoString(query), &opts.QueryOptions, opts.Display, limit, inSplit)
+}
+
+// executeQuery runs a query for ExecuteQuery and ExecuteQueryWithOptions and
+// reads its whole result, or its first page once it passes limit. A long IN
+// list is split as inSplit allows. opts and display may be nil. Cancelling
+// ctx interrupts the request in flight; ctx without a deadline is bounded by
+// the session query timeout.
+func executeQuery(ctx context.Context, h int, session *db.Session, cql string, opts *db.QueryOptions, display *DisplayOptions, limit ResultLimitOptions, inSplit InSplitOptions) *C.char {
+	done := beginInteractive()
+	defer done()
+	recordUsage(usageQueries, 1)
+
+	ctx, cancel := session.WithQueryTimeout(ctx)
+	defer cancel()
+
+	// A result that switches to paging is read after this call returns, so
+	// the query runs under a context the paged query takes over
+	queryCtx := ctx
+	var switchable *switchableContext
+	if limit.enabled() {
+		switchable = newSwitchableContext(ctx)
+		defer switchable.release()
+		queryCtx = switchable.ctx
+	}
 
 	// WORKAROUND: Astra hangs indefinitely when tracing is enabled for queries.
 	// Only apply this workaround for Astra connections (detected via Secure Connect Bundle).
+	// Toggling tracing is visible to every query on the handle, so the exclusive
+	// lock keeps other operations out until it is restored.
 	tracingWasEnabled := false
+	var unlock func()
 	if isAstraSession(h) && session.Tracing() {
+		unlock = lockHandleExclusive(h)
 		tracingWasEnabled = true
 		session.SetTracing(false)
+	} else {
+		unlock = lockHandleShared(h)
 	}
+	defer unlock()
 
-	result := session.ExecuteCQLQuery(cql)
+	if estimate := checkScanGuard(h, session, cql, false); estimate != nil {
+		if tracingWasEnabled {
+			session.SetTracing(true)
+		}
+		return jsonResponse(false, estimate, scanGuardMessage(estimate), "SCAN_LIMIT_EXCEEDED")
+	}
+	if tooLarge := checkStatementPayload(h, session, 0, cql, nil); tooLarge != nil {
+		if tracingWasEnabled {
+			session.SetTracing(true)
+		}
+		return jsonResponse(false, tooLarge, tooLarge.message(), "PAYLOAD_TOO_LARGE")
+	}
+
+	prof := profileStatement(h, session, "query", cql, opts)
+	var result interface{}
+	var split *InSplitInfo
+	if parts := splitQuery(cql, inSplit); parts != nil {
+		result, split = executeSplitQuery(ctx, h, session, parts, inSplit, opts, limit)
+	} else {
+		result = session.ExecuteCQLQueryWithOptions(queryCtx, cql, opts)
+	}
 
 	// Re-enable tracing if it was disabled for Astra
 	if tracingWasEnabled {
@@ -475,49 +989,107 @@ func ExecuteQuery(handle C.int, query *C.char) *C.char {
 
 	// Handle nil result - this can happen with authorization failures on managed services like Astra
 	if result == nil {
+		prof.done(0, "no result")
 		return jsonResponse(false, nil, "Query returned no result - this may indicate a permission issue or connection problem", "NO_RESULT")
 	}
 
 	// Parse keyspace and table from the query for TABLEMETA:INFO support
 	keyspace, table := parseTableReference(cql, session.Keyspace())
+	sourceKeyspace, sourceTable := schemaTableReference(cql, session.Keyspace()) // For schema drop detection
 
 	// Handle different result types
 	switch v := result.(type) {
 	case db.QueryResult:
+		shown, err := newResultDisplay(display, v.Headers, v.ColumnTypes)
+		if err != nil {
+			return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+		}
+		columns, columnTypes := v.Headers, v.ColumnTypes
+		if shown != nil {
+			columns, columnTypes = shown.names, shown.types
+		}
+
 		// Convert to our QueryResult format
 		rows := make([]map[string]interface{}, 0, len(v.RawData))
 		for _, rawRow := range v.RawData {
-			rows = append(rows, rawRow)
+			rows = append(rows, shown.row(rawRow))
 		}
 
+		prof.done(v.RowCount, "")
 		qr := QueryResult{
-			Columns:        v.Headers,
-			ColumnTypes:    v.ColumnTypes,
+			Columns:        columns,
+			ColumnTypes:    columnTypes,
 			Rows:           rows,
 			RowCount:       v.RowCount,
 			Duration:       v.Duration.String(),
 			TraceSessionID: getTraceIDIfEnabled(session), // Include trace ID if tracing is enabled
 			Keyspace:       keyspace,
 			Table:          table,
+			Execution:      v.Execution,
+			Applied:        v.Applied,
+			Split:          split,
+			Warning:        inSplitWarning(split, limit, len(rows)),
 		}
 		return jsonResponse(true, qr, "", "")
 
 	case db.StreamingQueryResult:
-		// For streaming results, we need to fetch all rows
-		defer v.Iterator.Close()
+		// For streaming results, we need to fetch all rows. A result that
+		// switches to paging hands the iterator over to the paged query.
+		pagedQueryID := ""
+		defer func() {
+			if pagedQueryID == "" {
+				v.Iterator.Close()
+			}
+		}()
 
-		rows := make([]map[string]interface{}, 0)
+		shown, err := newResultDisplay(display, v.ColumnNames, v.ColumnTypes)
+		if err != nil {
+			return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+		}
+		columns, columnTypes := v.ColumnNames, v.ColumnTypes
+		if shown != nil {
+			columns, columnTypes = shown.names, shown.types
+		}
+
+		buf := resultBuffer{limit: limit, rows: make([]map[string]interface{}, 0)}
 		for {
 			row := make(map[string]interface{})
 			if !v.Iterator.MapScan(row) {
 				break
 			}
-			rows = append(rows, row)
+			if buf.add(shown.row(row)) {
+				if pagedQueryID = switchToPaged(h, session, v, shown, sourceKeyspace, sourceTable, switchable); pagedQueryID != "" {
+					prof.done(len(buf.rows), "")
+					return jsonResponse(true, QueryResult{
+						Columns:        columns,
+						ColumnTypes:    columnTypes,
+						Rows:           buf.rows,
+						RowCount:       len(buf.rows),
+						TraceSessionID: getTraceIDIfEnabled(session),
+						Keyspace:       keyspace,
+						Table:          table,
+						Execution:      v.Execution.Info(v.Iterator),
+						ModeSwitched:   true,
+						HasMore:        true,
+						QueryID:        pagedQueryID,
+						Warning:        resultLimitWarning(limit, len(buf.rows), buf.bytes),
+					}, "", "")
+				}
+				break
+			}
 		}
+		rows := buf.rows
 
 		// Check for iterator errors after scanning (important for Astra authorization errors)
 		if err := v.Iterator.Close(); err != nil {
 			errStr := err.Error()
+			prof.done(len(buf.rows), errStr)
+			if ctx.Err() == context.DeadlineExceeded {
+				return jsonResponse(false, nil, "Query timed out: "+errStr, "TIMEOUT")
+			}
+			if ctx.Err() == context.Canceled {
+				return jsonResponse(false, nil, "Query aborted: "+errStr, "CANCELLED")
+			}
 			// Check for authorization/permission errors common on managed services
 			if strings.Contains(strings.ToLower(errStr), "unauthorized") ||
 				strings.Contains(strings.ToLower(errStr), "permission") ||
@@ -527,26 +1099,36 @@ func ExecuteQuery(handle C.int, query *C.char) *C.char {
 			return jsonResponse(false, nil, "Query failed: "+errStr, "QUERY_ERROR")
 		}
 
+		prof.done(len(rows), "")
 		qr := QueryResult{
-			Columns:        v.ColumnNames,
-			ColumnTypes:    v.ColumnTypes,
+			Columns:        columns,
+			ColumnTypes:    columnTypes,
 			Rows:           rows,
 			RowCount:       len(rows),
 			Duration:       "", // Duration not available for streaming
 			TraceSessionID: getTraceIDIfEnabled(session), // Include trace ID if tracing is enabled
 			Keyspace:       keyspace,
 			Table:          table,
+			Execution:      v.Execution.Info(v.Iterator),
 		}
 		return jsonResponse(true, qr, "", "")
 
 	case string:
 		// Simple string result (e.g., "Query executed successfully", "No results")
+		prof.done(0, "")
 		return jsonResponse(true, map[string]interface{}{
 			"message": v,
 		}, "", "")
 
 	case error:
 		errStr := v.Error()
+		prof.done(0, errStr)
+		if ctx.Err() == context.DeadlineExceeded {
+			return jsonResponse(false, nil, "Query timed out: "+errStr, "TIMEOUT")
+		}
+		if ctx.Err() == context.Canceled {
+			return jsonResponse(false, nil, "Query aborted: "+errStr, "CANCELLED")
+		}
 		// Check for authorization/permission errors common on managed services like Astra
 		if strings.Contains(strings.ToLower(errStr), "unauthorized") ||
 			strings.Contains(strings.ToLower(errStr), "permission") ||
@@ -560,6 +1142,7 @@ func ExecuteQuery(handle C.int, query *C.char) *C.char {
 		if result == nil {
 			return jsonResponse(false, nil, "Query returned no result", "NO_RESULT")
 		}
+		prof.done(0, "")
 		return jsonResponse(true, map[string]interface{}{
 			"result": v,
 		}, "", "")
@@ -574,6 +1157,14 @@ func ExecuteMultiQuery(handle C.int, query *C.char, optionsJSON *C.char) *C.char
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
+	done := beginInteractive()
+	defer done()
+
+	// Holds the handle's shared lock; USE and directives apply to the
+	// statements after them
+	exec := newExecutionContext(h, session)
+	defer exec.close()
+
 	cql := C.GoString(query)
 
 	// Parse options
@@ -584,35 +1175,265 @@ func ExecuteMultiQuery(handle C.int, query *C.char, optionsJSON *C.char) *C.char
 			json.Unmarshal([]byte(optStr), &opts)
 		}
 	}
+	opts.handle = h
+	if opts.SimilarityScore != "" && !validSimilarity(opts.SimilarityScore) {
+		return jsonResponse(false, nil, "similarityScore must be cosine, euclidean, dot_product or auto", "INVALID_OPTIONS")
+	}
+
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "multiQuery")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+	opts.ctx = ctx
+	opts.exec = exec
 
 	result := executeMultiQuery(session, cql, opts)
+	recordUsage(usageScripts, 1)
 	return jsonResponse(true, result, "", "")
 }
 
-// executeMultiQuery executes multiple CQL statements and returns combined results
-func executeMultiQuery(session *db.Session, cql string, opts MultiQueryOptions) *MultiQueryResult {
-	result := &MultiQueryResult{
-		Results:      []StatementResult{},
-		Identifiers:  []string{},
-		ExtraTokens:  []string{},
-		SecondTokens: []string{},
-		ThirdTokens:  []string{},
+// GetStatementText returns the full text of a statement that executeMulti
+// results show truncated, looked up by its statementHash
+//
+//export GetStatementText
+func GetStatementText(handle C.int, hash *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Handle empty input
-	cql = strings.TrimSpace(cql)
-	if cql == "" {
-		return result
+	key := strings.ToLower(C.GoString(hash))
+	if key == "" {
+		return jsonResponse(false, nil, "Statement hash is required", "INVALID_OPTIONS")
+	}
+	stmt, ok := lookupStatementText(h, key)
+	if !ok {
+		return jsonResponse(false, nil, "Statement not found; only the last 256 truncated statements are kept", "STATEMENT_NOT_FOUND")
 	}
+	return jsonResponse(true, map[string]interface{}{
+		"statement":     stmt,
+		"statementHash": key,
+	}, "", "")
+}
 
-	// Split statements using the CQL splitter from internal/batch
-	splitResult, err := batch.SplitStatements(cql)
-	if err != nil {
-		result.ParseError = err.Error()
-		return result
+// PrepareStatement prepares a statement with bind markers (? or :name) and
+// returns its statement ID and bind variables
+//
+//export PrepareStatement
+func PrepareStatement(handle C.int, query *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	if splitResult.Incomplete {
+	cql := strings.TrimSuffix(strings.TrimSpace(C.GoString(query)), ";")
+	if cql == "" {
+		return jsonResponse(false, nil, "Query is required", "INVALID_OPTIONS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	info, err := prepareStatement(h, session, cql)
+	if err != nil {
+		return jsonResponse(false, nil, "Prepare failed: "+err.Error(), "PREPARE_ERROR")
+	}
+	return jsonResponse(true, info, "", "")
+}
+
+// ExecutePrepared runs a prepared statement. valuesJSON is an array of
+// values in bind marker order, or an object of values by variable name;
+// each value is converted to its variable's type.
+//
+//export ExecutePrepared
+func ExecutePrepared(handle C.int, statementID *C.char, valuesJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	stmt := getPrepared(h, C.GoString(statementID))
+	if stmt == nil {
+		return jsonResponse(false, nil, "Prepared statement not found or closed", "STATEMENT_NOT_FOUND")
+	}
+	values, err := stmt.bindValues(C.GoString(valuesJSON))
+	if err != nil {
+		return jsonResponse(false, nil, "Invalid bind values: "+err.Error(), "INVALID_PARAMS")
+	}
+
+	done := beginInteractive()
+	defer done()
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	if tooLarge := checkStatementPayload(h, session, 0, stmt.info.Query, values); tooLarge != nil {
+		return jsonResponse(false, tooLarge, tooLarge.message(), "PAYLOAD_TOO_LARGE")
+	}
+
+	// Registered without a token so closing the session stops it
+	ctx, finish, err := startCancellable("", h, "executePrepared")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+
+	recordUsage(usagePrepared, 1)
+	prof := profileStatement(h, session, "prepared", stmt.info.Query, nil)
+	result, err := executePrepared(ctx, session, stmt, values)
+	if err != nil {
+		prof.done(0, err.Error())
+		return jsonResponse(false, nil, "Query failed: "+err.Error(), "QUERY_ERROR")
+	}
+	prof.done(result.RowCount, "")
+	return jsonResponse(true, result, "", "")
+}
+
+// ClosePrepared forgets a prepared statement. The driver's cache of
+// server-side prepared IDs is shared by the session and is not affected.
+//
+//export ClosePrepared
+func ClosePrepared(handle C.int, statementID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	if !closePrepared(h, C.GoString(statementID)) {
+		return jsonResponse(false, nil, "Prepared statement not found or closed", "STATEMENT_NOT_FOUND")
+	}
+	return jsonResponse(true, map[string]interface{}{
+		"closed": true,
+	}, "", "")
+}
+
+// ExecuteBatch runs INSERT, UPDATE and DELETE statements as a single BATCH.
+// batchJSON is {"type", "statements": [{"query" | "statementId", "values"}],
+// "timestamp", "cancelToken", "chunk"}; values are converted as for
+// ExecutePrepared.
+//
+//export ExecuteBatch
+func ExecuteBatch(handle C.int, batchJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var req BatchRequest
+	if err := json.Unmarshal([]byte(C.GoString(batchJSON)), &req); err != nil {
+		return jsonResponse(false, nil, "Invalid batch JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	done := beginInteractive()
+	defer done()
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	stmts, conditional, err := bindBatch(h, session, &req)
+	if err != nil {
+		return jsonResponse(false, nil, "Invalid batch: "+err.Error(), "INVALID_PARAMS")
+	}
+	groups, tooLarge := planBatches(h, session, &req, stmts)
+	if tooLarge != nil {
+		return jsonResponse(false, tooLarge, tooLarge.message(), "PAYLOAD_TOO_LARGE")
+	}
+
+	ctx, finish, err := startCancellable(req.CancelToken, h, "batch")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+
+	recordUsage(usageBatches, 1)
+	prof := profileBatch(h, session, stmts)
+	result, err := executeBatches(ctx, session, &req, groups, conditional)
+	if err != nil {
+		prof.done(0, err.Error())
+	} else {
+		prof.done(len(result.Rows), "")
+	}
+	if err != nil && ctx.Err() != nil {
+		return jsonResponse(false, nil, "Batch cancelled; it may still be applied by the server", "CANCELLED")
+	}
+	if err != nil {
+		return jsonResponse(false, nil, "Batch failed: "+err.Error(), "QUERY_ERROR")
+	}
+	return jsonResponse(true, result, "", "")
+}
+
+// ExecuteShellCommand runs one line of input as cqlsh would: a special
+// command (DESCRIBE, SHOW, CONSISTENCY, COPY, SOURCE, CAPTURE, ...) or a CQL
+// statement. optionsJSON is {"cancelToken", "stopOnError", "force"}.
+//
+//export ExecuteShellCommand
+func ExecuteShellCommand(handle C.int, command *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts ShellCommandOptions
+	if optStr := C.GoString(optionsJSON); optStr != "" {
+		if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	done := beginInteractive()
+	defer done()
+
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "shellCommand")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+
+	recordUsage(usageShellCommands, 1)
+	result, err := executeShellCommand(ctx, h, session, C.GoString(command), opts)
+	if err != nil {
+		code := "QUERY_ERROR"
+		if se, ok := err.(*shellError); ok && se.code != "" {
+			code = se.code
+		}
+		return jsonResponse(false, nil, err.Error(), code)
+	}
+	if result.Command != "CAPTURE" {
+		captureOutput(h, result)
+	}
+	return jsonResponse(true, result, "", "")
+}
+
+// executeMultiQuery executes multiple CQL statements and returns combined results
+func executeMultiQuery(session *db.Session, cql string, opts MultiQueryOptions) *MultiQueryResult {
+	result := &MultiQueryResult{
+		Results:      []StatementResult{},
+		Identifiers:  []string{},
+		ExtraTokens:  []string{},
+		SecondTokens: []string{},
+		ThirdTokens:  []string{},
+		Descriptors:  describeStatements(nil),
+	}
+
+	// Handle empty input
+	cql = strings.TrimSpace(cql)
+	if cql == "" {
+		return result
+	}
+
+	// Split statements using the CQL splitter from internal/batch
+	splitResult, err := batch.SplitStatements(cql)
+	if err != nil {
+		result.ParseError = err.Error()
+		return result
+	}
+
+	if splitResult.Incomplete {
 		result.Incomplete = true
 		result.ParseError = "Incomplete statement"
 		return result
@@ -626,6 +1447,16 @@ func executeMultiQuery(session *db.Session, cql string, opts MultiQueryOptions)
 
 	// Get statement strings
 	stmtStrings := splitResult.GetStatementStrings()
+	result.Descriptors = describeStatements(stmtStrings)
+
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	previewLength := opts.PreviewLength
+	if previewLength == 0 {
+		previewLength = defaultStatementPreview
+	}
 
 	// Execute each statement
 	for i, stmtText := range stmtStrings {
@@ -633,6 +1464,10 @@ func executeMultiQuery(session *db.Session, cql string, opts MultiQueryOptions)
 		if stmtText == "" {
 			continue
 		}
+		if ctx.Err() != nil {
+			result.Cancelled = true
+			break
+		}
 
 		// Get identifier for this statement
 		identifier := ""
@@ -640,7 +1475,55 @@ func executeMultiQuery(session *db.Session, cql string, opts MultiQueryOptions)
 			identifier = result.Identifiers[i]
 		}
 
-		stmtResult := executeStatement(session, stmtText, i, identifier)
+		// USE and cqlsh directives change the context of the statements after them
+		var stmtResult StatementResult
+		directive := false
+		if opts.exec != nil {
+			stmtResult, directive = opts.exec.runDirective(stmtText)
+			stmtResult.Index = i
+		}
+
+		// Vector searches get a score column when asked for; the statement
+		// echoed in the result stays as written
+		execText := stmtText
+		var score *SimilarityScore
+		var warnings []string
+		if !directive && opts.SimilarityScore != "" && strings.EqualFold(identifier, "SELECT") {
+			rewritten, s, err := addSimilarityScore(session, stmtText, opts.SimilarityScore)
+			if err != nil {
+				warnings = append(warnings, "similarity score not added: "+err.Error())
+			}
+			execText, score = rewritten, s
+		}
+
+		if !directive {
+			if estimate := checkScanGuard(opts.handle, session, execText, opts.Force); estimate != nil {
+				stmtResult = StatementResult{
+					Index:        i,
+					Identifier:   identifier,
+					Error:        scanGuardMessage(estimate),
+					ErrorCode:    "SCAN_LIMIT_EXCEEDED",
+					ScanEstimate: estimate,
+				}
+			} else if tooLarge := checkStatementPayload(opts.handle, session, i, execText, nil); tooLarge != nil {
+				stmtResult = payloadStatementResult(i, identifier, tooLarge)
+			} else if queryOpts, err := opts.exec.queryOptions(); err != nil {
+				stmtResult = StatementResult{Index: i, Identifier: identifier, Error: err.Error(), ErrorCode: "KEYSPACE_ERROR"}
+			} else {
+				stmtResult = executeStatement(ctx, opts.handle, session, execText, i, identifier, queryOpts)
+			}
+			if opts.exec != nil {
+				stmtResult.Settings = opts.exec.settings()
+			}
+		}
+		if stmtResult.Success {
+			stmtResult.Score = score
+		}
+		stmtResult.Warnings = warnings
+		stmtResult.Statement, stmtResult.StatementHash, stmtResult.Truncated = previewStatement(opts.handle, stmtText, previewLength)
+		if i < len(result.Descriptors) {
+			stmtResult.Descriptor = &result.Descriptors[i]
+		}
 		result.Results = append(result.Results, stmtResult)
 		result.StatementsExecuted++
 
@@ -654,22 +1537,41 @@ func executeMultiQuery(session *db.Session, cql string, opts MultiQueryOptions)
 	return result
 }
 
-// executeStatement executes a single CQL statement and returns the result
-func executeStatement(session *db.Session, stmt string, index int, identifier string) StatementResult {
+// describeStatements returns the structured descriptor of each statement
+func describeStatements(stmts []string) []cql.StatementDescriptor {
+	descriptors := make([]cql.StatementDescriptor, len(stmts))
+	for i, stmt := range stmts {
+		descriptors[i] = cql.DescribeStatement(stmt)
+	}
+	return descriptors
+}
+
+// executeStatement executes a single CQL statement, with opts overriding the
+// session's settings when not nil, and returns the result. Cancelling ctx
+// stops reading a streamed result between rows.
+func executeStatement(ctx context.Context, handle int, session *db.Session, stmt string, index int, identifier string, opts *db.QueryOptions) StatementResult {
 	sr := StatementResult{
 		Index:      index,
-		Statement:  truncateStmt(stmt, 500),
 		Identifier: identifier,
 		Success:    true,
 	}
 
 	// Parse keyspace and table for TABLEMETA:INFO support
-	keyspace, table := parseTableReference(stmt, session.Keyspace())
+	currentKeyspace := session.Keyspace()
+	if opts != nil && opts.Keyspace != "" {
+		currentKeyspace = opts.Keyspace
+	}
+	keyspace, table := parseTableReference(stmt, currentKeyspace)
 	sr.Keyspace = keyspace
 	sr.Table = table
 
-	// Execute the query
-	queryResult := session.ExecuteCQLQuery(stmt)
+	// Execute the query; cancelling ctx interrupts the request in flight
+	ctx, cancel := session.WithQueryTimeout(ctx)
+	defer cancel()
+	recordUsage(usageQueries, 1)
+	prof := profileStatement(handle, session, "query", stmt, nil)
+	queryResult := session.ExecuteCQLQueryWithOptions(ctx, stmt, opts)
+	defer func() { prof.done(sr.RowCount, sr.Error) }()
 
 	switch v := queryResult.(type) {
 	case db.QueryResult:
@@ -678,26 +1580,39 @@ func executeStatement(session *db.Session, stmt string, index int, identifier st
 		sr.Rows = v.RawData
 		sr.RowCount = v.RowCount
 		sr.Duration = v.Duration.String()
-		sr.TraceSessionID = getTraceIDIfEnabled(session)
+		sr.TraceSessionID = statementTraceID(session, opts)
+		sr.Execution = v.Execution
+		sr.Applied = v.Applied
 
 	case db.StreamingQueryResult:
 		// For streaming results, fetch all rows (no pagination in multi-query)
 		defer v.Iterator.Close()
 
 		rows := make([]map[string]interface{}, 0)
-		for {
+		for ctx.Err() == nil {
 			row := make(map[string]interface{})
 			if !v.Iterator.MapScan(row) {
 				break
 			}
 			rows = append(rows, row)
 		}
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			sr.Success = false
+			sr.Error = "Query timed out"
+			sr.ErrorCode = "TIMEOUT"
+		case context.Canceled:
+			sr.Success = false
+			sr.Error = "Query cancelled"
+			sr.ErrorCode = "CANCELLED"
+		}
 
 		sr.Columns = v.ColumnNames
 		sr.ColumnTypes = v.ColumnTypes
 		sr.Rows = rows
 		sr.RowCount = len(rows)
-		sr.TraceSessionID = getTraceIDIfEnabled(session)
+		sr.TraceSessionID = statementTraceID(session, opts)
+		sr.Execution = v.Execution.Info(v.Iterator)
 
 	case string:
 		sr.Message = v
@@ -705,7 +1620,14 @@ func executeStatement(session *db.Session, stmt string, index int, identifier st
 	case error:
 		sr.Success = false
 		sr.Error = v.Error()
-		sr.ErrorCode = "QUERY_ERROR"
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			sr.ErrorCode = "TIMEOUT"
+		case context.Canceled:
+			sr.ErrorCode = "CANCELLED"
+		default:
+			sr.ErrorCode = "QUERY_ERROR"
+		}
 
 	default:
 		sr.Message = ""
@@ -714,14 +1636,6 @@ func executeStatement(session *db.Session, stmt string, index int, identifier st
 	return sr
 }
 
-// truncateStmt truncates a statement to maxLen characters for display
-func truncateStmt(stmt string, maxLen int) string {
-	if len(stmt) <= maxLen {
-		return stmt
-	}
-	return stmt[:maxLen] + "..."
-}
-
 //export SetConsistency
 func SetConsistency(handle C.int, level *C.char) *C.char {
 	h := int(handle)
@@ -736,7 +1650,122 @@ func SetConsistency(handle C.int, level *C.char) *C.char {
 	}
 
 	return jsonResponse(true, map[string]interface{}{
-		"consistency": levelStr,
+		"consistency":    levelStr,
+		"readRepairHint": db.ReadRepairHint(levelStr),
+	}, "", "")
+}
+
+// SetSerialConsistency sets the serial consistency level (SERIAL or
+// LOCAL_SERIAL) used by conditional statements
+//
+//export SetSerialConsistency
+func SetSerialConsistency(handle C.int, level *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	if err := session.SetSerialConsistency(strings.ToUpper(C.GoString(level))); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_CONSISTENCY")
+	}
+
+	return jsonResponse(true, map[string]interface{}{
+		"serialConsistency": session.SerialConsistency(),
+	}, "", "")
+}
+
+// SetConsistencyFallback sets the consistency level reads are retried at, once,
+// when the coordinator reports the session consistency cannot be met. The
+// result reports the downgrade in execution.consistencyDowngrade. An empty
+// level disables the retry.
+//
+//export SetConsistencyFallback
+func SetConsistencyFallback(handle C.int, level *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	if err := session.SetConsistencyFallback(C.GoString(level)); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_CONSISTENCY")
+	}
+
+	return jsonResponse(true, map[string]interface{}{
+		"consistency":         session.Consistency(),
+		"consistencyFallback": session.ConsistencyFallback(),
+	}, "", "")
+}
+
+// SetQueryTimeout sets the milliseconds a statement may take, all of its pages
+// included; 0 removes the limit. A query's own timeout option overrides it.
+//
+//export SetQueryTimeout
+func SetQueryTimeout(handle C.int, timeoutMs C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+	if timeoutMs < 0 {
+		return jsonResponse(false, nil, "timeout must not be negative", "INVALID_PARAMS")
+	}
+
+	session.SetQueryTimeout(time.Duration(timeoutMs) * time.Millisecond)
+	return jsonResponse(true, map[string]interface{}{
+		"queryTimeout": int(timeoutMs),
+	}, "", "")
+}
+
+// options, or disables it when optionsJSON is empty or null. Coordinators
+// whose error rate reaches the threshold are tried only after the others
+// until a probe request succeeds.
+//
+//export SetCircuitBreaker
+func SetCircuitBreaker(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts *CircuitBreakerOptions
+	if raw := C.GoString(optionsJSON); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	breaker, err := opts.toDB()
+	if err == nil {
+		err = session.SetCircuitBreaker(breaker)
+	}
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	return jsonResponse(true, map[string]interface{}{
+		"circuitBreaker": circuitBreakerSettings(session),
+	}, "", "")
+}
+
+// GetSessionMetrics returns the requests, error rate, latency, circuit
+// breaker state and connection heartbeats of each coordinator the session has
+// used. It does not take the handle lock so it can be called while other
+// operations are running.
+//
+//export GetSessionMetrics
+func GetSessionMetrics(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	return jsonResponse(true, map[string]interface{}{
+		"hosts":             session.HostMetrics(),
+		"circuitBreaker":    circuitBreakerSettings(session),
+		"heartbeatInterval": int(db.DriverHeartbeatInterval / time.Second),
 	}, "", "")
 }
 
@@ -749,6 +1778,13 @@ func SetKeyspace(handle C.int, keyspace *C.char) *C.char {
 	}
 
 	ks := C.GoString(keyspace)
+
+	// SetKeyspace replaces the underlying gocql session; wait for in-flight
+	// operations on this handle and keep new ones out until it is done
+	unlock := lockHandleExclusive(h)
+	defer unlock()
+
+	closeRowStreams(h)
 	if err := session.SetKeyspace(ks); err != nil {
 		return jsonResponse(false, nil, err.Error(), "KEYSPACE_ERROR")
 	}
@@ -758,6 +1794,50 @@ func SetKeyspace(handle C.int, keyspace *C.char) *C.char {
 	}, "", "")
 }
 
+// ReconnectSession replaces the session's driver session with a new one built
+// from the options it was created with, for use after a network outage. The
+// handle, its settings (consistency, paging, tracing, expand, ...) and its
+// prepared statements are kept; paged results and row streams still being
+// read belonged to the old connection and are closed.
+//
+//export ReconnectSession
+func ReconnectSession(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	// Like SetKeyspace, reconnecting replaces the underlying gocql session
+	unlock := lockHandleExclusive(h)
+	defer unlock()
+
+	closeRowStreams(h)
+	report, err := session.Reconnect()
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CONNECTION_FAILED")
+	}
+
+	pagedQueriesMutex.Lock()
+	closed := make([]*pagedQueryState, 0)
+	for qID, state := range pagedQueries {
+		if state.Session == session {
+			closed = append(closed, state)
+			delete(pagedQueries, qID)
+		}
+	}
+	pagedQueriesMutex.Unlock()
+	for _, state := range closed {
+		state.close()
+	}
+
+	return jsonResponse(true, map[string]interface{}{
+		"restored":           report,
+		"preparedStatements": preparedStatementCount(h),
+		"closedPagedQueries": len(closed),
+	}, "", "")
+}
+
 //export SetPaging
 func SetPaging(handle C.int, value *C.char) *C.char {
 	h := int(handle)
@@ -826,6 +1906,41 @@ func SetExpand(handle C.int, enabled C.int) *C.char {
 	}, "", "")
 }
 
+// SetAutoFetch turns auto-fetch on or off. While on, paged queries read every
+// page up to maxRows rows (0 = the default cap) and report truncated when
+// rows remain (see auto_fetch.go).
+//
+//export SetAutoFetch
+func SetAutoFetch(handle C.int, enabled C.int, maxRows C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	if err := session.SetAutoFetch(enabled != 0, int(maxRows)); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	return jsonResponse(true, map[string]interface{}{
+		"autoFetch": session.AutoFetch(),
+		"maxRows":   session.AutoFetchMaxRows(),
+	}, "", "")
+}
+
+// GetFetchProgress returns the progress of the session's running or latest
+// auto-fetch, or null when there has been none
+//
+//export GetFetchProgress
+func GetFetchProgress(handle C.int) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	return jsonResponse(true, fetchProgress(h), "", "")
+}
+
 //export GetSessionInfo
 func GetSessionInfo(handle C.int) *C.char {
 	h := int(handle)
@@ -839,322 +1954,2470 @@ func GetSessionInfo(handle C.int) *C.char {
 	_ = session.Query("SELECT cluster_name, data_center, rack FROM system.local").Scan(&clusterName, &datacenter, &rack)
 
 	info := map[string]interface{}{
-		"cassandraVersion":  session.CassandraVersion(),
-		"keyspace":          session.Keyspace(),
-		"consistency":       session.Consistency(),
-		"serialConsistency": "SERIAL", // Default serial consistency
-		"pageSize":          session.PageSize(),
-		"tracing":           session.Tracing(),
-		"expand":            session.Expand(),
-		"username":          session.Username(),
-		"host":              session.Host(),
-		"clusterName":       clusterName,
-		"datacenter":        datacenter,
-		"rack":              rack,
+		"cassandraVersion":       session.CassandraVersion(),
+		"virtualTablesSupported": session.SupportsVirtualTables(),
+		"scyllaVersion":          session.ScyllaVersion(), // Empty for Apache Cassandra
+		"keyspace":               session.Keyspace(),
+		"consistency":            session.Consistency(),
+		"serialConsistency":      session.SerialConsistency(),
+		"pageSize":               session.PageSize(),
+		"tracing":                session.Tracing(),
+		"expand":                 session.Expand(),
+		"autoFetch":              session.AutoFetch(),
+		"autoFetchMaxRows":       session.AutoFetchMaxRows(),
+		"username":               session.Username(),
+		"host":                   session.Host(),
+		"clusterName":            clusterName,
+		"datacenter":             datacenter,
+		"rack":                   rack,
+		"speculativeExecution":   session.SpeculativeExecution(),
+		"consistencyFallback":    session.ConsistencyFallback(),
+		"circuitBreaker":         circuitBreakerSettings(session),
+		"readRepairHint":         db.ReadRepairHint(session.Consistency()),
+		"workspaceID":            session.Workspace(),
+	}
+	if astra := astraEndpoints(h, session); astra != nil {
+		info["astra"] = astra
+	}
+	if session.SchemaPinned() {
+		info["schemaPin"] = session.SchemaPinStatus()
 	}
 
 	return jsonResponse(true, info, "", "")
 }
 
-// DatacenterInfo represents a node's datacenter info
-type DatacenterInfo struct {
-	Address    string `json:"address"`
-	Datacenter string `json:"datacenter"`
-}
+// GetResourceUsage reports iterators, buffered rows, goroutines and cache size held by a session
+// It does not take the handle lock so it can be called while other operations are running
+//
+//export GetResourceUsage
+func GetResourceUsage(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
 
-// ClusterInfo represents cluster connection test results
-type ClusterInfo struct {
-	Build       string           `json:"build"`
-	Protocol    int              `json:"protocol"`
-	CQL         string           `json:"cql"`
-	Datacenter  string           `json:"datacenter"`
-	Datacenters []DatacenterInfo `json:"datacenters"`
+	return jsonResponse(true, collectResourceUsage(h, session), "", "")
 }
 
-//export TestConnection
-func TestConnection(optionsJSON *C.char) *C.char {
-	// Parse options JSON
-	optStr := C.GoString(optionsJSON)
-	var opts SessionOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
-		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+// SetSchemaCacheMode switches a session's schema cache between "full",
+// "keyspace" and "off" and returns the new cache usage. Turning the cache off
+// releases it; the other modes rebuild it immediately.
+//
+//export SetSchemaCacheMode
+func SetSchemaCacheMode(handle C.int, mode *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Resolve options (cqlshrc + variables + defaults)
-	if err := resolveSessionOptions(&opts); err != nil {
-		return jsonResponse(false, nil, "Failed to parse config: "+err.Error(), "CONFIG_ERROR")
+	unlock := lockHandleExclusive(h)
+	defer unlock()
+
+	if err := session.SetSchemaCacheMode(C.GoString(mode)); err != nil {
+		return jsonResponse(false, nil, err.Error(), "SCHEMA_CACHE_ERROR")
 	}
 
-	// Create session options - use batch mode to skip schema cache for faster connection
-	dbOpts := db.SessionOptions{
-		Host:           opts.Host,
-		Port:           opts.Port,
-		Keyspace:       opts.Keyspace,
-		Username:       opts.Username,
-		Password:       opts.Password,
-		Consistency:    opts.Consistency,
-		ConnectTimeout: opts.ConnectTimeout,
-		RequestTimeout: opts.RequestTimeout,
-		BatchMode:      true, // Skip schema cache for faster test
+	return jsonResponse(true, schemaCacheUsage(session), "", "")
+}
+
+// SchemaPinOptions are the options of PinSchema
+type SchemaPinOptions struct {
+	Keyspaces []string `json:"keyspaces"` // Keyspaces to snapshot (default every keyspace)
+}
+
+// PinSchema snapshots the schema so that metadata lookups through the session
+// read the snapshot until UnpinSchema, and returns the pin's status
+//
+//export PinSchema
+func PinSchema(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Apply SSL options if provided
-	if opts.SSLCertfile != "" || opts.SSLCAFile != "" {
-		sslValidate := true
-		if opts.SSLValidate != nil {
-			sslValidate = *opts.SSLValidate
-		}
-		dbOpts.SSL = &config.SSLConfig{
-			Enabled:            true,
-			CertPath:           opts.SSLCertfile,
-			KeyPath:            opts.SSLKeyfile,
-			CAPath:             opts.SSLCAFile,
-			HostVerification:   sslValidate,
-			InsecureSkipVerify: !sslValidate,
-		}
+	var opts SchemaPinOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
-	// Create session
-	session, err := db.NewSessionWithOptions(dbOpts)
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	status, err := session.PinSchema(opts.Keyspaces)
 	if err != nil {
-		return jsonResponse(false, nil, "Connection failed: "+err.Error(), "CONNECTION_FAILED")
+		return jsonResponse(false, nil, err.Error(), "SCHEMA_PIN_ERROR")
 	}
-	defer session.Close()
+	return jsonResponse(true, status, "", "")
+}
 
-	// Query local node info
-	var releaseVersion, cqlVersion, datacenter string
-	localQuery := session.Query("SELECT release_version, cql_version, data_center FROM system.local")
-	if err := localQuery.Scan(&releaseVersion, &cqlVersion, &datacenter); err != nil {
-		return jsonResponse(false, nil, "Failed to query system.local: "+err.Error(), "QUERY_ERROR")
+// UnpinSchema returns the session to the live schema
+//
+//export UnpinSchema
+func UnpinSchema(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Determine display host (use override if provided, for SSH tunnel scenarios)
-	displayHost := opts.Host
-	if opts.OverrideHost != "" {
-		displayHost = opts.OverrideHost
-	}
+	unlock := lockHandleShared(h)
+	defer unlock()
 
-	// Collect datacenters - start with local node
-	datacenters := []DatacenterInfo{
-		{
-			Address:    displayHost,
-			Datacenter: datacenter,
-		},
+	return jsonResponse(true, map[string]interface{}{"unpinned": session.UnpinSchema()}, "", "")
+}
+
+// GetSchemaPin reports whether the session reads a pinned schema and whether
+// the live schema has diverged from it
+//
+//export GetSchemaPin
+func GetSchemaPin(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Query peers for other nodes
-	peersIter := session.Query("SELECT peer, data_center FROM system.peers").Iter()
-	var peerAddr, peerDC string
-	for peersIter.Scan(&peerAddr, &peerDC) {
-		datacenters = append(datacenters, DatacenterInfo{
-			Address:    peerAddr,
-			Datacenter: peerDC,
-		})
+	return jsonResponse(true, session.SchemaPinStatus(), "", "")
+}
+
+// SetScanGuard sets the partition limit above which SELECTs that scan the
+// table are refused (see scan_guard.go); maxPartitions 0 disables the guard
+//
+//export SetScanGuard
+func SetScanGuard(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
-	peersIter.Close()
 
-	// Build result
-	info := ClusterInfo{
-		Build:       releaseVersion,
-		Protocol:    5, // We try protocol 5 first in NewSessionWithOptions
-		CQL:         cqlVersion,
-		Datacenter:  datacenter,
-		Datacenters: datacenters,
+	var opts ScanGuardOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	if opts.MaxPartitions < 0 {
+		return jsonResponse(false, nil, "maxPartitions must not be negative", "INVALID_OPTIONS")
 	}
 
-	return jsonResponse(true, info, "", "")
+	setScanGuard(h, opts)
+	return jsonResponse(true, getScanGuard(h), "", "")
 }
 
-// TestConnectionOptions extends SessionOptions with request ID for cancellation
-type TestConnectionOptions struct {
-	SessionOptions
-	RequestID string `json:"requestID"` // Unique ID for cancellation
-}
+// SetInSplit sets the IN list length above which ExecuteQuery splits a
+// SELECT into several queries and merges their rows (see in_split.go);
+// maxValues 0 disables splitting
+//
+//export SetInSplit
+func SetInSplit(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
 
-//export TestConnectionWithID
-func TestConnectionWithID(optionsJSON *C.char) *C.char {
-	// Parse options JSON
-	optStr := C.GoString(optionsJSON)
-	var opts TestConnectionOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+	var opts InSplitOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
 		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
+	if err := opts.validate(); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
 
-	// Create cancellation channel if requestID provided
-	var cancelChan chan struct{}
-	if opts.RequestID != "" {
-		cancelChan = make(chan struct{})
-		pendingConnectionsMutex.Lock()
-		pendingConnections[opts.RequestID] = cancelChan
-		pendingConnectionsMutex.Unlock()
+	setInSplit(h, opts)
+	return jsonResponse(true, getInSplit(h), "", "")
+}
 
-		// Cleanup when done
-		defer func() {
-			pendingConnectionsMutex.Lock()
-			delete(pendingConnections, opts.RequestID)
-			pendingConnectionsMutex.Unlock()
-		}()
+// GetPayloadLimits returns the request size limits statements are checked
+// against before they are sent (see payload_size.go)
+//
+//export GetPayloadLimits
+func GetPayloadLimits(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Check if already cancelled before starting
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		default:
-		}
-	}
+	unlock := lockHandleShared(h)
+	defer unlock()
 
-	// Resolve options (cqlshrc + variables + defaults)
-	if err := resolveSessionOptions(&opts.SessionOptions); err != nil {
-		return jsonResponse(false, nil, "Failed to parse config: "+err.Error(), "CONFIG_ERROR")
-	}
+	return jsonResponse(true, payloadLimitsFor(h, session), "", "")
+}
 
-	// Check if cancelled after config resolution
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		default:
-		}
+// SetResultLimit sets the rows or bytes above which ExecuteQuery returns the
+// first page of a result and pages the rest (see result_limit.go); zero
+// limits disable it
+//
+//export SetResultLimit
+func SetResultLimit(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Create session options - use batch mode to skip schema cache for faster connection
-	dbOpts := db.SessionOptions{
-		Host:           opts.Host,
-		Port:           opts.Port,
-		Keyspace:       opts.Keyspace,
-		Username:       opts.Username,
-		Password:       opts.Password,
-		Consistency:    opts.Consistency,
-		ConnectTimeout: opts.ConnectTimeout,
-		RequestTimeout: opts.RequestTimeout,
-		BatchMode:      true, // Skip schema cache for faster test
+	var opts ResultLimitOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	if err := opts.validate(); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
 	}
 
-	// Apply SSL options if provided
-	if opts.SSLCertfile != "" || opts.SSLCAFile != "" {
-		sslValidate := true
-		if opts.SSLValidate != nil {
-			sslValidate = *opts.SSLValidate
-		}
-		dbOpts.SSL = &config.SSLConfig{
-			Enabled:            true,
-			CertPath:           opts.SSLCertfile,
-			KeyPath:            opts.SSLKeyfile,
-			CAPath:             opts.SSLCAFile,
-			HostVerification:   sslValidate,
-			InsecureSkipVerify: !sslValidate,
-		}
+	setResultLimit(h, opts)
+	return jsonResponse(true, getResultLimit(h), "", "")
+}
+
+// WatchConfig starts or stops watching the session's JSON config file. Safe
+// settings from a changed file are applied to the session and reported as
+// CONFIG_RELOADED events, collected with PollConfigEvents (see config_watch.go).
+//
+//export WatchConfig
+func WatchConfig(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Create session (this is the blocking part)
-	// We run it in a goroutine to allow cancellation
-	type sessionResult struct {
-		session *db.Session
-		err     error
+	var opts ConfigWatchOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	if opts.IntervalMs < 0 {
+		return jsonResponse(false, nil, "intervalMs must not be negative", "INVALID_OPTIONS")
 	}
-	resultChan := make(chan sessionResult, 1)
 
-	go func() {
-		session, err := db.NewSessionWithOptions(dbOpts)
-		resultChan <- sessionResult{session, err}
-	}()
+	if opts.Enabled != nil && !*opts.Enabled {
+		stopConfigWatch(h)
+		return jsonResponse(true, map[string]interface{}{
+			"watching": false,
+		}, "", "")
+	}
 
-	// Wait for either session creation or cancellation
-	var session *db.Session
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			// Cancelled - we can't stop the goroutine but we won't use its result
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		case res := <-resultChan:
-			if res.err != nil {
-				return jsonResponse(false, nil, "Connection failed: "+res.err.Error(), "CONNECTION_FAILED")
-			}
-			session = res.session
-		}
-	} else {
-		res := <-resultChan
-		if res.err != nil {
-			return jsonResponse(false, nil, "Connection failed: "+res.err.Error(), "CONNECTION_FAILED")
-		}
-		session = res.session
+	// Not under the handle lock: replacing a watcher waits for its reload,
+	// which takes the lock itself
+	watcher, err := startConfigWatch(h, session, time.Duration(opts.IntervalMs)*time.Millisecond)
+	if err != nil {
+		return jsonResponse(false, nil, "Failed to load config: "+err.Error(), "CONFIG_ERROR")
 	}
-	defer session.Close()
+	return jsonResponse(true, map[string]interface{}{
+		"watching": true,
+		"path":     watcher.Path(),
+	}, "", "")
+}
 
-	// Check cancelled before querying
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		default:
-		}
+// PollConfigEvents returns the CONFIG_RELOADED events queued since the last
+// call, oldest first
+//
+//export PollConfigEvents
+func PollConfigEvents(handle C.int) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
+	return jsonResponse(true, takeConfigEvents(h), "", "")
+}
 
-	// Query local node info
-	var releaseVersion, cqlVersion, datacenter string
-	localQuery := session.Query("SELECT release_version, cql_version, data_center FROM system.local")
-	if err := localQuery.Scan(&releaseVersion, &cqlVersion, &datacenter); err != nil {
-		return jsonResponse(false, nil, "Failed to query system.local: "+err.Error(), "QUERY_ERROR")
+// SubscribeSchemaEvents starts or stops queueing the schema changes made on
+// the cluster (keyspaces, tables, types, functions and aggregates created,
+// altered or dropped), collected with PollSchemaEvents (see schema_events.go).
+// optionsJSON is {"enabled", "keyspaces", "targets"}.
+//
+//export SubscribeSchemaEvents
+func SubscribeSchemaEvents(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Determine display host (use override if provided, for SSH tunnel scenarios)
-	displayHost := opts.Host
-	if opts.OverrideHost != "" {
-		displayHost = opts.OverrideHost
+	var opts SchemaEventOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
-	// Collect datacenters - start with local node
-	datacenters := []DatacenterInfo{
-		{
-			Address:    displayHost,
-			Datacenter: datacenter,
-		},
+	if opts.Enabled != nil && !*opts.Enabled {
+		unsubscribeSchemaEvents(h)
+		return jsonResponse(true, map[string]interface{}{
+			"subscribed": false,
+		}, "", "")
 	}
+	if err := subscribeSchemaEvents(h, session, opts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, map[string]interface{}{
+		"subscribed": true,
+	}, "", "")
+}
 
-	// Query peers for other nodes
-	peersIter := session.Query("SELECT peer, data_center FROM system.peers").Iter()
-	var peerAddr, peerDC string
-	for peersIter.Scan(&peerAddr, &peerDC) {
-		datacenters = append(datacenters, DatacenterInfo{
-			Address:    peerAddr,
-			Datacenter: peerDC,
-		})
+// PollSchemaEvents returns the schema changes queued since the last call,
+// oldest first
+//
+//export PollSchemaEvents
+func PollSchemaEvents(handle C.int) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
-	peersIter.Close()
+	return jsonResponse(true, takeSchemaEvents(h), "", "")
+}
 
-	// Build result
-	info := ClusterInfo{
-		Build:       releaseVersion,
-		Protocol:    5,
+// GetEffectiveConfig returns the merged settings the session is using, with
+// API keys redacted. The AI settings are left out unless the aiBridge
+// feature flag is on.
+//
+//export GetEffectiveConfig
+func GetEffectiveConfig(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+	cfg := session.EffectiveConfig()
+	if !featureEnabled(session.Workspace(), featureAIBridge) {
+		cfg.AI = nil
+	}
+	return jsonResponse(true, cfg, "", "")
+}
+
+// GetEffectiveSettings returns each session setting with the layer it came
+// from: the defaults, the workspace defaults, the session's options, or a
+// change made on the session since
+//
+//export GetEffectiveSettings
+func GetEffectiveSettings(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+	return jsonResponse(true, effectiveSettings(h, session), "", "")
+}
+
+// SetWorkspaceDefaults sets the session settings sessions of a workspace
+// inherit when their options leave them unset. optionsJSON is
+// {"workspaceID", "defaults"}; null defaults clear them. Sessions already
+// open keep their settings.
+//
+//export SetWorkspaceDefaults
+func SetWorkspaceDefaults(optionsJSON *C.char) *C.char {
+	var req WorkspaceDefaultsRequest
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &req); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	defaults, err := setWorkspaceDefaults(req.WorkspaceID, req.Defaults)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, defaults, "", "")
+}
+
+// GetWorkspaceDefaults returns the session defaults of a workspace
+//
+//export GetWorkspaceDefaults
+func GetWorkspaceDefaults(workspaceID *C.char) *C.char {
+	return jsonResponse(true, workspaceDefaultsFor(C.GoString(workspaceID)), "", "")
+}
+
+// SetFeatureFlags turns experimental subsystems on or off (see features.go).
+// optionsJSON is {"workspaceID", "flags"}; without a workspaceID the flags
+// apply to the whole process, and null flags clear the layer.
+//
+//export SetFeatureFlags
+func SetFeatureFlags(optionsJSON *C.char) *C.char {
+	var req FeatureFlagsRequest
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &req); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	flags, err := setFeatureFlags(req)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, flags, "", "")
+}
+
+// GetFeatureFlags reports which feature flags the loaded binary supports and
+// whether each is on for a workspace (the process-wide flags for "")
+//
+//export GetFeatureFlags
+func GetFeatureFlags(workspaceID *C.char) *C.char {
+	return jsonResponse(true, featureFlags(C.GoString(workspaceID)), "", "")
+}
+
+// GetSchedulerStats reports the process-wide bulk operation scheduler: limits,
+// per-handle weights and the running and queued operations
+//
+//export GetSchedulerStats
+func GetSchedulerStats() *C.char {
+	return jsonResponse(true, schedulerStats(), "", "")
+}
+
+// ConfigureScheduler changes the process-wide bulk operation limits
+//
+//export ConfigureScheduler
+func ConfigureScheduler(optionsJSON *C.char) *C.char {
+	var update SchedulerConfigUpdate
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &update); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	config, err := configureScheduler(update)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	return jsonResponse(true, config, "", "")
+}
+
+// ConfigureTelemetry enables or disables the process-wide usage counters.
+// They are disabled by default; disabling them discards the counts.
+//
+//export ConfigureTelemetry
+func ConfigureTelemetry(optionsJSON *C.char) *C.char {
+	var opts TelemetryOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, configureTelemetry(opts), "", "")
+}
+
+// GetTelemetrySnapshot returns the usage counters for the host app to show
+// or upload with the user's consent
+//
+//export GetTelemetrySnapshot
+func GetTelemetrySnapshot(optionsJSON *C.char) *C.char {
+	var opts TelemetrySnapshotOptions
+	if optStr := C.GoString(optionsJSON); optStr != "" {
+		if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	return jsonResponse(true, telemetrySnapshot(opts), "", "")
+}
+
+// SetRedactionPolicy sets how statements and bind values are written to logs
+// for a workspace. optionsJSON is {"workspaceID", "policy"}; a null policy
+// restores the default, which hashes every value. The salt is not returned.
+//
+//export SetRedactionPolicy
+func SetRedactionPolicy(optionsJSON *C.char) *C.char {
+	var req RedactionPolicyRequest
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &req); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	policy, err := logger.SetRedactionPolicy(req.WorkspaceID, req.Policy)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, withoutSalt(policy), "", "")
+}
+
+// GetRedactionPolicy returns the redaction policy of a workspace, without its salt
+//
+//export GetRedactionPolicy
+func GetRedactionPolicy(workspaceID *C.char) *C.char {
+	return jsonResponse(true, withoutSalt(logger.RedactionPolicyFor(C.GoString(workspaceID))), "", "")
+}
+
+// RedactStatement returns a statement and its bind values as the workspace's
+// redaction policy allows them to be logged. optionsJSON is {"workspaceID",
+// "query", "values"}.
+//
+//export RedactStatement
+func RedactStatement(optionsJSON *C.char) *C.char {
+	var req RedactStatementRequest
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &req); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	result, err := redactStatement(req)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_PARAMS")
+	}
+	return jsonResponse(true, result, "", "")
+}
+
+// ConfigureLogFiles sets the files and rotation of the debug, trace, history,
+// audit and slow query logs for the process. optionsJSON is {"rotation",
+// "sinks"}, with per-log overrides of the rotation under sinks. Returns the
+// log files now in use.
+//
+//export ConfigureLogFiles
+func ConfigureLogFiles(optionsJSON *C.char) *C.char {
+	var cfg filesink.Config
+	if optStr := C.GoString(optionsJSON); optStr != "" {
+		if err := json.Unmarshal([]byte(optStr), &cfg); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	files, err := config.NormalizeLogFiles(&cfg)
+	if err == nil {
+		err = logger.ConfigureFiles(files)
+	}
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, logger.Files(), "", "")
+}
+
+// GetLogFiles returns the file, size and rotated files of each log that has one
+//
+//export GetLogFiles
+func GetLogFiles() *C.char {
+	return jsonResponse(true, logger.Files(), "", "")
+}
+
+// WriteLogRecord appends a record to one of the logs the host keeps (trace,
+// history, audit or slowQuery), or to the debug log
+//
+//export WriteLogRecord
+func WriteLogRecord(name *C.char, record *C.char) *C.char {
+	logName := C.GoString(name)
+	if !slices.Contains(logger.FileNames, logName) {
+		return jsonResponse(false, nil, fmt.Sprintf("Unknown log %q", logName), "INVALID_PARAMS")
+	}
+	if err := logger.WriteRecord(logName, C.GoString(record)); err != nil {
+		return jsonResponse(false, nil, err.Error(), "LOG_FILE_ERROR")
+	}
+	return jsonResponse(true, nil, "", "")
+}
+
+// RotateLogFile starts a new file for a log and returns its state
+//
+//export RotateLogFile
+func RotateLogFile(name *C.char) *C.char {
+	logName := C.GoString(name)
+	if !slices.Contains(logger.FileNames, logName) {
+		return jsonResponse(false, nil, fmt.Sprintf("Unknown log %q", logName), "INVALID_PARAMS")
+	}
+	file, err := logger.RotateFile(logName)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "LOG_FILE_ERROR")
+	}
+	return jsonResponse(true, file, "", "")
+}
+
+// SetSchedulerLimits sets a session's share of bulk operation slots. Values <= 0
+// keep the current setting.
+//
+//export SetSchedulerLimits
+func SetSchedulerLimits(handle C.int, weight C.int, maxConcurrent C.int) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	w, limit := setHandleSchedule(h, int(weight), int(maxConcurrent))
+	return jsonResponse(true, map[string]interface{}{
+		"weight":        w,
+		"maxConcurrent": limit,
+	}, "", "")
+}
+
+// GetLanguageCatalog returns the CQL keywords, functions, types and index options valid
+// for the connected server's version
+//
+//export GetLanguageCatalog
+func GetLanguageCatalog(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	return jsonResponse(true, catalog.ForVersion(session.CassandraVersion()), "", "")
+}
+
+// DatacenterInfo represents a node's datacenter info
+type DatacenterInfo struct {
+	Address    string `json:"address"`
+	Datacenter string `json:"datacenter"`
+}
+
+// ClusterInfo represents cluster connection test results
+type ClusterInfo struct {
+	Build       string            `json:"build"`
+	Protocol    int               `json:"protocol"`
+	CQL         string            `json:"cql"`
+	Datacenter  string            `json:"datacenter"`
+	Datacenters []DatacenterInfo  `json:"datacenters"`
+	Phases      []ConnectionPhase `json:"phases,omitempty"` // Timing of each phase, from TestConnectionWithID
+}
+
+//export TestConnection
+func TestConnection(optionsJSON *C.char) *C.char {
+	// Parse options JSON
+	optStr := C.GoString(optionsJSON)
+	var opts SessionOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Resolve options (cqlshrc + variables + workspace defaults + defaults)
+	if _, err := resolveSessionOptions(&opts); err != nil {
+		return jsonResponse(false, nil, "Failed to parse config: "+err.Error(), "CONFIG_ERROR")
+	}
+
+	// Create session options - use batch mode to skip schema cache for faster connection
+	dbOpts := db.SessionOptions{
+		Host:           opts.Host,
+		Port:           opts.Port,
+		Keyspace:       opts.Keyspace,
+		Username:       opts.Username,
+		Password:       opts.Password,
+		Consistency:    opts.Consistency,
+		ConnectTimeout: opts.ConnectTimeout,
+		RequestTimeout: opts.RequestTimeout,
+		BatchMode:      true, // Skip schema cache for faster test
+	}
+	if err := applyLoadBalancing(opts.Hosts, opts.LoadBalancing, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Apply SSL options if provided
+	if opts.SSLCertfile != "" || opts.SSLCAFile != "" {
+		sslValidate := true
+		if opts.SSLValidate != nil {
+			sslValidate = *opts.SSLValidate
+		}
+		dbOpts.SSL = &config.SSLConfig{
+			Enabled:            true,
+			CertPath:           opts.SSLCertfile,
+			KeyPath:            opts.SSLKeyfile,
+			CAPath:             opts.SSLCAFile,
+			HostVerification:   sslValidate,
+			InsecureSkipVerify: !sslValidate,
+		}
+	}
+
+	// Create session
+	session, err := db.NewSessionWithOptions(dbOpts)
+	if err != nil {
+		return jsonResponse(false, nil, "Connection failed: "+err.Error(), "CONNECTION_FAILED")
+	}
+	defer session.Close()
+
+	// Query local node info
+	var releaseVersion, cqlVersion, datacenter string
+	localQuery := session.Query("SELECT release_version, cql_version, data_center FROM system.local")
+	if err := localQuery.Scan(&releaseVersion, &cqlVersion, &datacenter); err != nil {
+		return jsonResponse(false, nil, "Failed to query system.local: "+err.Error(), "QUERY_ERROR")
+	}
+
+	// Determine display host (use override if provided, for SSH tunnel scenarios)
+	displayHost := opts.Host
+	if opts.OverrideHost != "" {
+		displayHost = opts.OverrideHost
+	}
+
+	// Collect datacenters - start with local node
+	datacenters := []DatacenterInfo{
+		{
+			Address:    displayHost,
+			Datacenter: datacenter,
+		},
+	}
+
+	// Query peers for other nodes
+	peersIter := session.Query("SELECT peer, data_center FROM system.peers").Iter()
+	var peerAddr, peerDC string
+	for peersIter.Scan(&peerAddr, &peerDC) {
+		datacenters = append(datacenters, DatacenterInfo{
+			Address:    peerAddr,
+			Datacenter: peerDC,
+		})
+	}
+	peersIter.Close()
+
+	// Build result
+	info := ClusterInfo{
+		Build:       releaseVersion,
+		Protocol:    5, // We try protocol 5 first in NewSessionWithOptions
 		CQL:         cqlVersion,
 		Datacenter:  datacenter,
 		Datacenters: datacenters,
 	}
 
-	return jsonResponse(true, info, "", "")
-}
+	return jsonResponse(true, info, "", "")
+}
+
+// TestConnectionOptions extends SessionOptions with a token for cancellation
+type TestConnectionOptions struct {
+	SessionOptions
+	CancelToken string `json:"cancelToken"` // Token for Cancel
+	RequestID   string `json:"requestID"`   // Older name for cancelToken, used by CancelTestConnection
+
+	PhaseTimeouts *ConnectionPhaseTimeouts `json:"phaseTimeouts"` // Timeout of each phase of the test
+}
+
+// cancelToken returns the token the test is registered under
+func (opts TestConnectionOptions) cancelToken() string {
+	if opts.CancelToken != "" {
+		return opts.CancelToken
+	}
+	return opts.RequestID
+}
+
+//export TestConnectionWithID
+func TestConnectionWithID(optionsJSON *C.char) *C.char {
+	// Parse options JSON
+	optStr := C.GoString(optionsJSON)
+	var opts TestConnectionOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Register the token so Cancel (or CancelTestConnection) can stop the test
+	ctx, finish, err := startCancellable(opts.cancelToken(), 0, "connection")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+
+	// Check if already cancelled before starting
+	if ctx.Err() != nil {
+		return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
+	}
+
+	phases, err := newConnectionPhases(ctx, opts.cancelToken(), connectPhaseOrder, opts.PhaseTimeouts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer phases.end()
+	timeouts := phases.timeouts
+
+	// A failed phase is reported with the timing of the phases before it
+	failed := func(err error, message, code string) *C.char {
+		if ctx.Err() != nil {
+			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
+		}
+		if phases.timedOut() {
+			code = "PHASE_TIMEOUT"
+		}
+		return jsonResponse(false, phases.failure(), message+err.Error(), code)
+	}
+
+	// Resolve options (cqlshrc + variables + workspace defaults + defaults)
+	// into a copy, which a resolution left running past its timeout may
+	// still write to
+	err = phases.run(connectPhaseConfig, phaseTimeout(timeouts.ConfigMs, 0, defaultConfigPhaseTimeout), func(ctx context.Context) error {
+		resolved, err := await(ctx, func() (SessionOptions, error) {
+			resolved := opts.SessionOptions
+			_, err := resolveSessionOptions(&resolved)
+			return resolved, err
+		}, nil)
+		if err == nil {
+			opts.SessionOptions = resolved
+		}
+		return err
+	})
+	if err != nil {
+		return failed(err, "Failed to parse config: ", "CONFIG_ERROR")
+	}
+
+	// Create session options - use batch mode to skip schema cache for faster connection
+	dbOpts := db.SessionOptions{
+		Host:           opts.Host,
+		Port:           opts.Port,
+		Keyspace:       opts.Keyspace,
+		Username:       opts.Username,
+		Password:       opts.Password,
+		Consistency:    opts.Consistency,
+		ConnectTimeout: opts.ConnectTimeout,
+		RequestTimeout: opts.RequestTimeout,
+		BatchMode:      true, // Skip schema cache for faster test
+	}
+	if err := applyLoadBalancing(opts.Hosts, opts.LoadBalancing, &dbOpts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Apply SSL options if provided
+	if opts.SSLCertfile != "" || opts.SSLCAFile != "" {
+		sslValidate := true
+		if opts.SSLValidate != nil {
+			sslValidate = *opts.SSLValidate
+		}
+		dbOpts.SSL = &config.SSLConfig{
+			Enabled:            true,
+			CertPath:           opts.SSLCertfile,
+			KeyPath:            opts.SSLKeyfile,
+			CAPath:             opts.SSLCAFile,
+			HostVerification:   sslValidate,
+			InsecureSkipVerify: !sslValidate,
+		}
+	}
+
+	// Probe the first contact point for the TCP connect and TLS handshake
+	address := probeAddress(&opts.SessionOptions)
+	var probe net.Conn
+	err = phases.run(connectPhaseTCP, phaseTimeout(timeouts.ConnectMs, opts.ConnectTimeout, defaultNetworkPhaseTimeout), func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		probe = conn
+		return err
+	})
+	if err != nil {
+		return failed(err, "Connection failed: ", "CONNECTION_FAILED")
+	}
+	if dbOpts.SSL != nil {
+		err = phases.run(connectPhaseTLS, phaseTimeout(timeouts.TLSMs, opts.ConnectTimeout, defaultNetworkPhaseTimeout), func(ctx context.Context) error {
+			return probeTLS(ctx, probe, address, dbOpts.SSL)
+		})
+	} else {
+		phases.skip(connectPhaseTLS)
+	}
+	probe.Close()
+	if err != nil {
+		return failed(err, "TLS handshake failed: ", "CONNECTION_FAILED")
+	}
+
+	// Create session (this is the blocking part). It cannot be interrupted,
+	// so a session still created after a timeout or cancellation is closed.
+	var session *db.Session
+	err = phases.run(connectPhaseAuth, phaseTimeout(timeouts.AuthMs, 0, defaultNetworkPhaseTimeout), func(ctx context.Context) error {
+		var err error
+		session, err = await(ctx, func() (*db.Session, error) {
+			return db.NewSessionWithOptions(dbOpts)
+		}, func(session *db.Session) {
+			session.Close()
+		})
+		return err
+	})
+	if err != nil {
+		return failed(err, "Connection failed: ", "CONNECTION_FAILED")
+	}
+	defer session.Close()
+
+	// Query local node info, then peers for other nodes
+	var releaseVersion, cqlVersion, datacenter string
+	var peers []DatacenterInfo
+	err = phases.run(connectPhaseQuery, phaseTimeout(timeouts.QueryMs, opts.RequestTimeout, defaultNetworkPhaseTimeout), func(ctx context.Context) error {
+		localQuery := session.Query("SELECT release_version, cql_version, data_center FROM system.local")
+		if err := localQuery.ScanContext(ctx, &releaseVersion, &cqlVersion, &datacenter); err != nil {
+			return err
+		}
+		peersIter := session.Query("SELECT peer, data_center FROM system.peers").IterContext(ctx)
+		var peerAddr, peerDC string
+		for peersIter.Scan(&peerAddr, &peerDC) {
+			peers = append(peers, DatacenterInfo{
+				Address:    peerAddr,
+				Datacenter: peerDC,
+			})
+		}
+		peersIter.Close()
+		return nil
+	})
+	if err != nil {
+		return failed(err, "Failed to query system.local: ", "QUERY_ERROR")
+	}
+
+	// Determine display host (use override if provided, for SSH tunnel scenarios)
+	displayHost := opts.Host
+	if opts.OverrideHost != "" {
+		displayHost = opts.OverrideHost
+	}
+
+	// Collect datacenters - start with local node
+	datacenters := []DatacenterInfo{
+		{
+			Address:    displayHost,
+			Datacenter: datacenter,
+		},
+	}
+	datacenters = append(datacenters, peers...)
+
+	// Build result
+	info := ClusterInfo{
+		Build:       releaseVersion,
+		Protocol:    5,
+		CQL:         cqlVersion,
+		Datacenter:  datacenter,
+		Datacenters: datacenters,
+		Phases:      phases.completed(),
+	}
+
+	return jsonResponse(true, info, "", "")
+}
+
+// CancelTestConnection cancels a connection test by its request ID. It is
+// Cancel with the response kept for existing callers.
+//
+//export CancelTestConnection
+func CancelTestConnection(requestID *C.char) *C.char {
+	reqID := C.GoString(requestID)
+	if reqID == "" {
+		return jsonResponse(false, nil, "Request ID is required", "INVALID_OPTIONS")
+	}
+
+	if !cancelByToken(reqID).Cancelled {
+		return jsonResponse(true, map[string]interface{}{
+			"cancelled": false,
+			"reason":    "No pending connection with this ID",
+		}, "", "")
+	}
+
+	return jsonResponse(true, map[string]interface{}{
+		"cancelled": true,
+	}, "", "")
+}
+
+// NewCancelToken issues a token for a long-running call, to pass as its
+// cancelToken option (see cancel.go)
+//
+//export NewCancelToken
+func NewCancelToken() *C.char {
+	return jsonResponse(true, map[string]interface{}{
+		"cancelToken": newCancelToken(),
+	}, "", "")
+}
+
+// Cancel stops the call running with a cancel token, or closes the paged
+// query with that ID. A token not in use yet cancels the call that starts
+// with it within the next minute.
+//
+//export Cancel
+func Cancel(token *C.char) *C.char {
+	tok := C.GoString(token)
+	if tok == "" {
+		return jsonResponse(false, nil, "Cancel token is required", "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, cancelByToken(tok), "", "")
+}
+
+//export GetClusterMetadata
+func GetClusterMetadata(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	metadata, err := GetClusterMetadataFromSession(session)
+	if err != nil {
+		return jsonResponse(false, nil, "Failed to get cluster metadata: "+err.Error(), "METADATA_ERROR")
+	}
+
+	return jsonResponse(true, metadata, "", "")
+}
+
+// GetSchemaSummary returns counts and rollups of the user schema, computed from
+// the driver's cached metadata, for overview pages
+//
+//export GetSchemaSummary
+func GetSchemaSummary(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	summary, err := getSchemaSummary(session)
+	if err != nil {
+		return jsonResponse(false, nil, "Failed to get schema summary: "+err.Error(), "METADATA_ERROR")
+	}
+
+	return jsonResponse(true, summary, "", "")
+}
+
+// GetTokenRing returns the token ring: the tokens of each node, the share of
+// the ring each node owns, and the replicas of every range under each
+// replication setting in use
+//
+//export GetTokenRing
+func GetTokenRing(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts TokenRingOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := getTokenRing(session, opts)
+	if err != nil {
+		return jsonResponse(false, nil, "Failed to get token ring: "+err.Error(), "METADATA_ERROR")
+	}
+
+	return jsonResponse(true, result, "", "")
+}
+
+// GetUDTDefinition returns the current definition of a user-defined type.
+// Definitions are cached and reloaded after the type is altered.
+//
+//export GetUDTDefinition
+func GetUDTDefinition(handle C.int, keyspace *C.char, name *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	udtName := C.GoString(name)
+	if ks == "" || udtName == "" {
+		return jsonResponse(false, nil, "keyspace and type name are required", "INVALID_PARAMS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	def, err := session.GetUDTDefinition(ks, udtName)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "METADATA_ERROR")
+	}
+
+	return jsonResponse(true, convertUDTDefinition(def), "", "")
+}
+
+// GetTableStats returns the estimated partition count and size, compaction
+// and other settings of a table from the system tables (see table_stats.go)
+//
+//export GetTableStats
+func GetTableStats(handle C.int, keyspace *C.char, table *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tableName := C.GoString(table)
+	if ks == "" || tableName == "" {
+		return jsonResponse(false, nil, "keyspace and table name are required", "INVALID_PARAMS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	stats, err := collectTableStats(session, ks, tableName)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "METADATA_ERROR")
+	}
+
+	return jsonResponse(true, stats, "", "")
+}
+
+// CollectNodeMetrics reads caches, thread pools and read histograms from the
+// system_views tables of every reachable node
+//
+//export CollectNodeMetrics
+func CollectNodeMetrics(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := collectNodeMetrics(h, session)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "METRICS_ERROR")
+	}
+
+	return jsonResponse(true, result, "", "")
+}
+
+// ConfigureAccessHeatmap starts or stops sampling table access for the
+// session (see access_heatmap.go). Starting again restarts the counters.
+//
+//export ConfigureAccessHeatmap
+func ConfigureAccessHeatmap(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts AccessHeatmapOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	if opts.Enabled != nil && !*opts.Enabled {
+		stopAccessSampler(h)
+		return jsonResponse(true, accessHeatmap(h), "", "")
+	}
+
+	interval := defaultHeatmapInterval
+	if opts.IntervalMs != 0 {
+		interval = time.Duration(opts.IntervalMs) * time.Millisecond
+	}
+	if interval < minHeatmapInterval {
+		return jsonResponse(false, nil, "intervalMs must be at least 1000", "INVALID_OPTIONS")
+	}
+	if !session.SupportsVirtualTables() {
+		return jsonResponse(false, nil, "access sampling requires virtual tables (Cassandra 4.0 or later); connected to "+session.CassandraVersion(), "METRICS_ERROR")
+	}
+
+	startAccessSampler(h, session, interval)
+	return jsonResponse(true, accessHeatmap(h), "", "")
+}
+
+// GetAccessHeatmap returns the per-table access counters sampled since
+// ConfigureAccessHeatmap started, hottest table first
+//
+//export GetAccessHeatmap
+func GetAccessHeatmap(handle C.int) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+	return jsonResponse(true, accessHeatmap(h), "", "")
+}
+
+// EnableQueryProfiling starts or stops recording the statements the session
+// runs into a ring buffer (see query_profile.go). optionsJSON is {"enabled",
+// "capacity"} and may be empty; enabling again empties the buffer.
+//
+//export EnableQueryProfiling
+func EnableQueryProfiling(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts QueryProfilingOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	if opts.Enabled != nil && !*opts.Enabled {
+		stopQueryProfiling(h)
+		return jsonResponse(true, queryProfile(h, QueryProfileOptions{}), "", "")
+	}
+
+	capacity := defaultProfileCapacity
+	if opts.Capacity != 0 {
+		capacity = opts.Capacity
+	}
+	if capacity < 1 || capacity > maxProfileCapacity {
+		return jsonResponse(false, nil, fmt.Sprintf("capacity must be between 1 and %d", maxProfileCapacity), "INVALID_OPTIONS")
+	}
+
+	startQueryProfiling(h, capacity)
+	return jsonResponse(true, queryProfile(h, QueryProfileOptions{}), "", "")
+}
+
+// GetQueryProfile returns the latency percentiles, rows and errors of each
+// statement shape recorded since EnableQueryProfiling, the shape the session
+// spent most time in first. optionsJSON is {"statements", "shape", "reset"}
+// and may be empty.
+//
+//export GetQueryProfile
+func GetQueryProfile(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts QueryProfileOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	return jsonResponse(true, queryProfile(h, opts), "", "")
+}
+
+// GetAccessibleObjects reports which keyspaces and tables the session's role
+// can SELECT and MODIFY, so inaccessible objects can be shown as such
+//
+//export GetAccessibleObjects
+func GetAccessibleObjects(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := getAccessibleObjects(h, session)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "METADATA_ERROR")
+	}
+
+	return jsonResponse(true, result, "", "")
+}
+
+// GetSecurityOverview reports the roles of the cluster, their members and
+// superuser flags, and the permissions each holds per resource. It reads
+// system_auth when the session's role may, and otherwise reports what LIST
+// ROLES and LIST PERMISSIONS show.
+//
+//export GetSecurityOverview
+func GetSecurityOverview(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	return jsonResponse(true, getSecurityOverview(session), "", "")
+}
+
+// DDLOptions represents options for DDL generation
+type DDLOptions struct {
+	Cluster       bool   `json:"cluster"`       // If true, generate DDL for entire cluster
+	Keyspace      string `json:"keyspace"`      // Keyspace name (required if not cluster)
+	Table         string `json:"table"`         // Table name (optional)
+	Index         string `json:"index"`         // Index name (optional, requires table)
+	Type          string `json:"type"`          // User type name (optional)
+	Function      string `json:"function"`      // Function name (optional)
+	Aggregate     string `json:"aggregate"`     // Aggregate name (optional)
+	View          string `json:"view"`          // Materialized view name (optional)
+	IncludeSystem bool   `json:"includeSystem"` // If true, include system keyspaces in cluster DDL
+	OutputPath    string `json:"outputPath"`    // Write the DDL to this file instead of returning it
+	OutputDir     string `json:"outputDir"`     // Write one file per object and a manifest to this directory
+	Chunked       bool   `json:"chunked"`       // Keep the DDL for GetDDLChunk instead of returning it
+	ChunkSize     int    `json:"chunkSize"`     // Maximum chunk size in bytes (default 1 MiB)
+
+	skipVirtual bool // Set when the cluster has no system_virtual_schema
+	handle      int  // Session that owns the chunked operation
+}
+
+//export GetDDL
+func GetDDL(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	optStr := C.GoString(optionsJSON)
+	var opts DDLOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	if opts.outputModes() > 1 {
+		return jsonResponse(false, nil, errDDLOutputModes.Error(), "INVALID_OPTIONS")
+	}
+
+	virtualSupported := session.SupportsVirtualTables()
+	opts.skipVirtual = !virtualSupported
+	opts.handle = h
+
+	recordUsage(usageDDL, 1)
+	ddlResult, err := GenerateDDLWithOptions(session.GocqlSession(), opts)
+	if err != nil {
+		return jsonResponse(false, nil, "Failed to generate DDL: "+err.Error(), "DDL_ERROR")
+	}
+	ddlResult.VirtualTablesSupported = virtualSupported
+
+	return jsonResponse(true, ddlResult, "", "")
+}
+
+// GetDDLChunk returns a chunk of a chunked GetDDL operation. Chunks hold whole
+// keyspaces; the operation is released once every chunk has been read.
+//
+//export GetDDLChunk
+func GetDDLChunk(handle C.int, operationID *C.char, index C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	opID := C.GoString(operationID)
+	if opID == "" {
+		return jsonResponse(false, nil, "Operation ID is required", "INVALID_PARAMS")
+	}
+
+	chunk, err := readDDLChunk(h, opID, int(index))
+	if err == errDDLOperationNotFound {
+		return jsonResponse(false, nil, err.Error(), "OPERATION_NOT_FOUND")
+	}
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_PARAMS")
+	}
+
+	return jsonResponse(true, chunk, "", "")
+}
+
+// TLSCheckOptions represents options for TLS security check
+type TLSCheckOptions struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	CAFile     string `json:"caFile"`
+	CertFile   string `json:"certFile"`
+	KeyFile    string `json:"keyFile"`
+	SkipVerify bool   `json:"skipVerify"`
+	FilesOnly  bool   `json:"filesOnly"` // Only check certificate files, don't connect
+}
+
+//export CheckTLS
+func CheckTLS(optionsJSON *C.char) *C.char {
+	optStr := C.GoString(optionsJSON)
+	var opts TLSCheckOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Set defaults
+	if opts.Port == 0 {
+		opts.Port = 9042
+	}
+
+	var result *TLSSecurityInfo
+	var err error
+
+	if opts.FilesOnly {
+		// Only analyze certificate files
+		result, err = CheckTLSSecurityFromFiles(opts.CAFile, opts.CertFile, opts.KeyFile)
+	} else {
+		// Connect and analyze
+		if opts.Host == "" {
+			return jsonResponse(false, nil, "Host is required for TLS connection check", "INVALID_OPTIONS")
+		}
+		result, err = CheckTLSSecurity(opts.Host, opts.Port, opts.CAFile, opts.CertFile, opts.KeyFile, opts.SkipVerify)
+	}
+
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "TLS_CHECK_ERROR")
+	}
+
+	return jsonResponse(true, result, "", "")
+}
+
+// DecryptOptions represents options for decryption
+type DecryptOptions struct {
+	Ciphertext     string `json:"ciphertext"`     // Base64 encoded
+	PrivateKey     string `json:"privateKey"`     // PEM string
+	PrivateKeyFile string `json:"privateKeyFile"` // Path to PEM file
+}
+
+//export DecryptCredential
+func DecryptCredential(optionsJSON *C.char) *C.char {
+	optStr := C.GoString(optionsJSON)
+	var opts DecryptOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	if opts.Ciphertext == "" {
+		return jsonResponse(false, nil, "Ciphertext is required", "INVALID_OPTIONS")
+	}
+
+	var plaintext string
+	var err error
+
+	if opts.PrivateKeyFile != "" {
+		plaintext, err = DecryptWithPrivateKeyFile(opts.Ciphertext, opts.PrivateKeyFile)
+	} else if opts.PrivateKey != "" {
+		plaintext, err = DecryptWithPrivateKey(opts.Ciphertext, opts.PrivateKey)
+	} else {
+		return jsonResponse(false, nil, "Either privateKey or privateKeyFile is required", "INVALID_OPTIONS")
+	}
+
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "DECRYPT_ERROR")
+	}
+
+	return jsonResponse(true, map[string]string{"plaintext": plaintext}, "", "")
+}
+
+// AstraBundleOptions represents options for parsing Astra bundle
+type AstraBundleOptions struct {
+	BundlePath string `json:"bundlePath"`
+	ExtractDir string `json:"extractDir"` // Optional, uses temp dir if empty
+}
+
+//export ParseAstraSecureBundle
+func ParseAstraSecureBundle(optionsJSON *C.char) *C.char {
+	optStr := C.GoString(optionsJSON)
+	var opts AstraBundleOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	if opts.BundlePath == "" {
+		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
+	}
+
+	bundleInfo, err := ParseAstraBundle(opts.BundlePath, opts.ExtractDir)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "BUNDLE_ERROR")
+	}
+
+	return jsonResponse(true, bundleInfo, "", "")
+}
+
+// ParseConnectionBundle extracts a connection bundle (a zip of cqlshrc,
+// credentials and certificates for a self-managed cluster) to managed storage,
+// validates the files it references and returns ready-to-use session options
+//
+//export ParseConnectionBundle
+func ParseConnectionBundle(optionsJSON *C.char) *C.char {
+	optStr := C.GoString(optionsJSON)
+	var opts ConnectionBundleOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	if opts.BundlePath == "" {
+		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
+	}
+
+	info, err := ExtractConnectionBundle(opts.BundlePath, opts.ExtractDir)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "BUNDLE_ERROR")
+	}
+
+	return jsonResponse(true, info, "", "")
+}
+
+// CleanupConnectionBundle removes a directory created by ParseConnectionBundle
+//
+//export CleanupConnectionBundle
+func CleanupConnectionBundle(extractedDir *C.char) *C.char {
+	if err := RemoveConnectionBundle(C.GoString(extractedDir)); err != nil {
+		return jsonResponse(false, nil, err.Error(), "BUNDLE_ERROR")
+	}
+	return jsonResponse(true, nil, "", "")
+}
+
+//export ValidateAstraSecureBundle
+func ValidateAstraSecureBundle(bundlePath *C.char) *C.char {
+	path := C.GoString(bundlePath)
+
+	valid, errors := ValidateAstraBundle(path)
+
+	result := map[string]interface{}{
+		"valid":  valid,
+		"errors": errors,
+	}
+
+	return jsonResponse(true, result, "", "")
+}
+
+// AstraConnectOptions represents options for connecting with Astra bundle
+type AstraConnectOptions struct {
+	BundlePath string `json:"bundlePath"`
+	ExtractDir string `json:"extractDir"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Keyspace   string `json:"keyspace"` // Override keyspace from bundle
+
+	SpeculativeExecution *SpeculativeExecutionOptions `json:"speculativeExecution"`
+	SchemaCache          string                       `json:"schemaCache"`         // "full" (default), "keyspace" or "off"
+	PersistSchemaCache   bool                         `json:"persistSchemaCache"`  // Save a full schema cache between connections
+	SchemaCacheDir       string                       `json:"schemaCacheDir"`      // Where to save it; the user cache directory when empty
+	ConsistencyFallback  string                       `json:"consistencyFallback"` // Level to retry reads at when the requested one cannot be met
+	CircuitBreaker       *CircuitBreakerOptions       `json:"circuitBreaker"`      // Avoid coordinators with a high error rate
+	WorkspaceID          string                       `json:"workspaceID"`         // Workspace whose redaction policy the session's logs follow
+
+	// Seconds between refreshes of the contact points from the metadata
+	// service (0 = 300, negative = never)
+	MetadataRefresh int                   `json:"metadataRefreshSeconds"`
+	MetadataFetch   *AstraMetadataOptions `json:"metadataFetch"` // Timeout and retries of the metadata requests
+}
+
+//export CreateAstraSession
+func CreateAstraSession(optionsJSON *C.char) *C.char {
+	optStr := C.GoString(optionsJSON)
+	var opts AstraConnectOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	if opts.BundlePath == "" {
+		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
+	}
+	if opts.Username == "" || opts.Password == "" {
+		return jsonResponse(false, nil, "username and password are required", "INVALID_OPTIONS")
+	}
+
+	retry, err := astraMetadataRetry(opts.MetadataFetch)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Parse the bundle
+	bundleInfo, err := ParseAstraBundle(opts.BundlePath, opts.ExtractDir)
+	if err != nil {
+		return jsonResponse(false, nil, "Failed to parse bundle: "+err.Error(), "BUNDLE_ERROR")
+	}
+
+	// Fetch metadata from Astra metadata service to get actual connection endpoints
+	if err := FetchAstraMetadataWithRetry(context.Background(), bundleInfo, retry); err != nil {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, "Failed to fetch Astra metadata: "+err.Error(), "METADATA_ERROR")
+	}
+
+	// Validate we got the required metadata
+	if bundleInfo.SniHost == "" || bundleInfo.SniPort == 0 || len(bundleInfo.ContactPoints) == 0 {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, "Invalid metadata: missing SNI proxy or contact points", "METADATA_ERROR")
+	}
+
+	// Build session options
+	sources := applyAstraWorkspaceDefaults(&opts)
+	keyspace := opts.Keyspace
+	if keyspace == "" {
+		keyspace = bundleInfo.Keyspace
+	}
+
+	// Create session options for db
+	// Connect through the SNI proxy, with the contact point host IDs as TLS
+	// server names (see astra_sni.go)
+	// Note: InsecureSkipVerify is needed because the cert is valid for *.db.astra.datastax.com
+	// but SNI uses UUID host IDs for routing. The CA cert still validates the chain.
+	dbOpts := db.SessionOptions{
+		Host:     bundleInfo.SniHost,
+		Port:     bundleInfo.SniPort,
+		Keyspace:  keyspace,
+		Username:  opts.Username,
+		Password:  opts.Password,
+		Workspace: opts.WorkspaceID,
+		SSL: &config.SSLConfig{
+			Enabled:            true,
+			CertPath:           bundleInfo.CertPath,
+			KeyPath:            bundleInfo.KeyPath,
+			CAPath:             bundleInfo.CACertPath,
+			HostVerification:   false, // SNI proxy uses host IDs, not hostnames
+			InsecureSkipVerify: true,  // Skip hostname verification (UUID != *.db.astra.datastax.com)
+		},
+		SNIProxy: astraSNIProxy(bundleInfo),
+	}
+	if err := applySpeculativeExecution(opts.SpeculativeExecution, &dbOpts); err != nil {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applySchemaCacheMode(opts.SchemaCache, &dbOpts); err != nil {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applySchemaCachePersistence(opts.PersistSchemaCache, opts.SchemaCacheDir, &dbOpts); err != nil {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applyConsistencyFallback(opts.ConsistencyFallback, &dbOpts); err != nil {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if err := applyCircuitBreaker(opts.CircuitBreaker, &dbOpts); err != nil {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Create session
+	session, err := db.NewSessionWithOptions(dbOpts)
+	if err != nil {
+		CleanupAstraBundle(bundleInfo.ExtractedDir)
+		return jsonResponse(false, nil, "Connection failed: "+err.Error(), "CONNECTION_FAILED")
+	}
+
+	// Register session and mark as Astra connection
+	handle := registerSession(session)
+	recordSessionSettings(handle, session, sources)
+	markSessionAsAstra(handle, opts.BundlePath)
+	startAstraRefresh(handle, session, bundleInfo, astraRefreshInterval(opts.MetadataRefresh), retry)
+	refreshSavedSchemaCache(handle, session)
+	return jsonResponse(true, map[string]interface{}{
+		"handle":           handle,
+		"cassandraVersion": session.CassandraVersion(),
+		"keyspace":         session.Keyspace(),
+		"bundleInfo":       bundleInfo,
+	}, "", "")
+}
+
+// TestAstraConnectionOptions extends AstraConnectOptions with request ID for cancellation
+type TestAstraConnectionOptions struct {
+	BundlePath  string `json:"bundlePath"`
+	ExtractDir  string `json:"extractDir"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Keyspace    string `json:"keyspace"`
+	CancelToken string `json:"cancelToken"` // Token for Cancel
+	RequestID   string `json:"requestID"`   // Older name for cancelToken, used by CancelTestConnection
+
+	MetadataFetch *AstraMetadataOptions `json:"metadataFetch"` // Timeout and retries of the metadata requests
+}
+
+// cancelToken returns the token the test is registered under
+func (opts TestAstraConnectionOptions) cancelToken() string {
+	if opts.CancelToken != "" {
+		return opts.CancelToken
+	}
+	return opts.RequestID
+}
+
+//export TestAstraConnectionWithID
+func TestAstraConnectionWithID(optionsJSON *C.char) *C.char {
+	optStr := C.GoString(optionsJSON)
+	var opts TestAstraConnectionOptions
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	if opts.BundlePath == "" {
+		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
+	}
+	if opts.Username == "" || opts.Password == "" {
+		return jsonResponse(false, nil, "username and password are required", "INVALID_OPTIONS")
+	}
+	retry, err := astraMetadataRetry(opts.MetadataFetch)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	// Register the token so Cancel (or CancelTestConnection) can stop the test
+	ctx, finish, err := startCancellable(opts.cancelToken(), 0, "connection")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+
+	// Check if already cancelled before starting
+	if ctx.Err() != nil {
+		return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
+	}
+
+	phases, err := newConnectionPhases(ctx, opts.cancelToken(), astraPhaseOrder, nil)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer phases.end()
+
+	// A failed phase is reported with the timing of the phases before it
+	failed := func(err error, message, code string) *C.char {
+		if ctx.Err() != nil {
+			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
+		}
+		return jsonResponse(false, phases.failure(), message+err.Error(), code)
+	}
+
+	// Parse the bundle
+	var bundleInfo *AstraBundleInfo
+	err = phases.run(astraPhaseBundle, 0, func(ctx context.Context) error {
+		info, err := ParseAstraBundle(opts.BundlePath, opts.ExtractDir)
+		bundleInfo = info
+		return err
+	})
+	if err != nil {
+		return failed(err, "Failed to parse bundle: ", "BUNDLE_ERROR")
+	}
+	// Cleanup extracted files once the test ends
+	defer CleanupAstraBundle(bundleInfo.ExtractedDir)
+
+	// Fetch metadata from Astra metadata service to get actual connection endpoints
+	err = phases.run(astraPhaseMetadata, 0, func(ctx context.Context) error {
+		if err := FetchAstraMetadataWithRetry(ctx, bundleInfo, retry); err != nil {
+			return err
+		}
+		// Validate we got the required metadata
+		if bundleInfo.SniHost == "" || bundleInfo.SniPort == 0 || len(bundleInfo.ContactPoints) == 0 {
+			return errors.New("invalid metadata: missing SNI proxy or contact points")
+		}
+		return nil
+	})
+	if err != nil {
+		return failed(err, "Failed to fetch Astra metadata: ", "METADATA_ERROR")
+	}
+
+	// Build session options
+	keyspace := opts.Keyspace
+	if keyspace == "" {
+		keyspace = bundleInfo.Keyspace
+	}
+
+	// Connect through the SNI proxy, with the contact point host IDs as TLS
+	// server names (see astra_sni.go)
+	// Note: InsecureSkipVerify is needed because the cert is valid for *.db.astra.datastax.com
+	// but SNI uses UUID host IDs for routing. The CA cert still validates the chain.
+	dbOpts := db.SessionOptions{
+		Host:     bundleInfo.SniHost,
+		Port:     bundleInfo.SniPort,
+		Keyspace: keyspace,
+		Username: opts.Username,
+		Password: opts.Password,
+		SSL: &config.SSLConfig{
+			Enabled:            true,
+			CertPath:           bundleInfo.CertPath,
+			KeyPath:            bundleInfo.KeyPath,
+			CAPath:             bundleInfo.CACertPath,
+			HostVerification:   false, // SNI proxy uses host IDs, not hostnames
+			InsecureSkipVerify: true,  // Skip hostname verification (UUID != *.db.astra.datastax.com)
+		},
+		SNIProxy: astraSNIProxy(bundleInfo),
+		BatchMode: true, // Skip schema cache for faster test
+	}
+
+	// Session creation cannot be interrupted; a session created after the
+	// test was cancelled is closed
+	var session *db.Session
+	err = phases.run(astraPhaseConnect, 0, func(ctx context.Context) error {
+		s, err := await(ctx, func() (*db.Session, error) {
+			return db.NewSessionWithOptions(dbOpts)
+		}, func(s *db.Session) { s.Close() })
+		session = s
+		return err
+	})
+	if err != nil {
+		return failed(err, "Connection failed: ", "CONNECTION_FAILED")
+	}
+	defer session.Close()
+
+	// Query to verify connection and get version info
+	var releaseVersion string
+	err = phases.run(astraPhaseVerify, 0, func(ctx context.Context) error {
+		return session.Query("SELECT release_version FROM system.local").WithContext(ctx).Scan(&releaseVersion)
+	})
+	if err != nil {
+		return failed(err, "Failed to query system.local: ", "QUERY_ERROR")
+	}
+
+	// Build result similar to testConnection
+	info := ClusterInfo{
+		Build:      releaseVersion,
+		Protocol:   5,
+		Datacenter: bundleInfo.LocalDC,
+		Datacenters: []DatacenterInfo{
+			{
+				Address:    bundleInfo.SniHost,
+				Datacenter: bundleInfo.LocalDC,
+			},
+		},
+		Phases: phases.completed(),
+	}
+
+	return jsonResponse(true, info, "", "")
+}
+
+// GetConnectionProgress returns the phase a connection test started with a
+// cancel token is in and the phases it has finished, while it runs and for a
+// while after
+//
+//export GetConnectionProgress
+func GetConnectionProgress(cancelToken *C.char) *C.char {
+	token := C.GoString(cancelToken)
+	if token == "" {
+		return jsonResponse(false, nil, "Cancel token is required", "INVALID_OPTIONS")
+	}
+
+	progress, ok := connectionTestProgress(token)
+	if !ok {
+		return jsonResponse(false, nil, "Connection test not found", "JOB_NOT_FOUND")
+	}
+	return jsonResponse(true, progress, "", "")
+}
+
+// DiagnoseAstraConnectivity checks each hop of an Astra connection in turn:
+// the bundle, DNS resolution of the metadata service, an HTTPS request to it
+// and a TCP connection to the SNI proxy it returns. Checks after the first
+// failure are skipped, and failedAt names the hop that failed.
+//
+//export DiagnoseAstraConnectivity
+func DiagnoseAstraConnectivity(optionsJSON *C.char) *C.char {
+	var opts DiagnoseAstraOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	if opts.BundlePath == "" {
+		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
+	}
+	return jsonResponse(true, diagnoseAstra(opts), "", "")
+}
+
+//export CleanupAstraExtracted
+func CleanupAstraExtracted(extractedDir *C.char) *C.char {
+	dir := C.GoString(extractedDir)
+	if err := CleanupAstraBundle(dir); err != nil {
+		return jsonResponse(false, nil, err.Error(), "CLEANUP_ERROR")
+	}
+	return jsonResponse(true, nil, "", "")
+}
+
+// SourceFilesRequest represents the request for executing CQL files.
+// Files are run first, then Sources, in the order given.
+type SourceFilesRequest struct {
+	Files       []string       `json:"files"`
+	Sources     []SourceScript `json:"sources"` // Inline content or https URLs (with sha256)
+	StopOnError bool           `json:"stopOnError"`
+	Savepoint   bool           `json:"savepoint"`   // Record a rollback plan (see RollbackPlan)
+	CancelToken string         `json:"cancelToken"` // Token for Cancel; StopSourceExecution also stops it
+}
+
+// sourceFileProgress tracks progress for a source file execution - keyed by session handle for isolation
+var (
+	sourceProgress     = make(map[int][]FileExecutionProgress)
+	sourceProgressLock sync.Mutex
+)
+
+//export ExecuteSourceFiles
+func ExecuteSourceFiles(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	optStr := C.GoString(optionsJSON)
+	var opts SourceFilesRequest
+	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	if len(opts.Files) == 0 && len(opts.Sources) == 0 {
+		return jsonResponse(false, nil, "No files or sources provided", "INVALID_OPTIONS")
+	}
+
+	scripts := make([]SourceScript, 0, len(opts.Files)+len(opts.Sources))
+	for _, file := range opts.Files {
+		scripts = append(scripts, SourceScript{Path: file})
+	}
+	for i, source := range opts.Sources {
+		if err := source.validate(); err != nil {
+			return jsonResponse(false, nil, fmt.Sprintf("Invalid source %d: %v", i, err), "INVALID_OPTIONS")
+		}
+		scripts = append(scripts, source)
+	}
+
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "sourceFiles")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
+
+	release, err := acquireBulkContext(ctx, h, "sourceFiles")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
+	}
+	defer release()
+
+	// Holds the handle's shared lock; USE and directives apply to the
+	// statements after them
+	exec := newExecutionContext(h, session)
+	defer exec.close()
+
+	// Reset progress tracking for this session
+	sourceProgressLock.Lock()
+	sourceProgress[h] = []FileExecutionProgress{}
+	sourceProgressLock.Unlock()
+
+	// Execute with progress callback
+	sourceOpts := &SourceFilesOptions{
+		Scripts:     scripts,
+		StopOnError: opts.StopOnError,
+		Savepoint:   opts.Savepoint,
+	}
+
+	recordUsage(usageScripts, 1)
+	result, err := executeSourceFiles(ctx, h, session, exec, sourceOpts, func(progress FileExecutionProgress) {
+		sourceProgressLock.Lock()
+		// Update or append progress for this session
+		sessionProgress := sourceProgress[h]
+		found := false
+		for i, p := range sessionProgress {
+			if p.FilePath == progress.FilePath {
+				sessionProgress[i] = progress
+				found = true
+				break
+			}
+		}
+		if !found {
+			sessionProgress = append(sessionProgress, progress)
+		}
+		sourceProgress[h] = sessionProgress
+		sourceProgressLock.Unlock()
+	})
+
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "EXECUTION_ERROR")
+	}
+	recordUsage(usageQueries, result.StatementsOK+result.StatementsFailed)
+
+	// Include final progress with result
+	sourceProgressLock.Lock()
+	sessionProgress := sourceProgress[h]
+	finalProgress := make([]FileExecutionProgress, len(sessionProgress))
+	copy(finalProgress, sessionProgress)
+	sourceProgressLock.Unlock()
+
+	return jsonResponse(true, map[string]interface{}{
+		"result":   result,
+		"progress": finalProgress,
+	}, "", "")
+}
+
+//export GetSourceProgress
+func GetSourceProgress(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	sourceProgressLock.Lock()
+	sessionProgress := sourceProgress[h]
+	progress := make([]FileExecutionProgress, len(sessionProgress))
+	copy(progress, sessionProgress)
+	sourceProgressLock.Unlock()
+
+	return jsonResponse(true, progress, "", "")
+}
+
+//export StopSourceExecution
+func StopSourceExecution(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	cancelHandleCalls(h, "sourceFiles")
+	return jsonResponse(true, nil, "", "")
+}
+
+// RollbackPlanOptions selects and optionally executes a rollback plan
+type RollbackPlanOptions struct {
+	PlanID  string `json:"planId"`  // Must match the latest plan when set
+	Execute bool   `json:"execute"` // Run the compensating statements; otherwise only return the plan
+}
+
+//export RollbackPlan
+func RollbackPlan(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts RollbackPlanOptions
+	if optStr := C.GoString(optionsJSON); optStr != "" {
+		if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	plan := getRollbackPlan(h)
+	if plan == nil || (opts.PlanID != "" && plan.ID != opts.PlanID) {
+		return jsonResponse(false, nil, "No rollback plan found; run executeSourceFiles with savepoint enabled", "PLAN_NOT_FOUND")
+	}
+	if !opts.Execute {
+		return jsonResponse(true, &RollbackResult{Plan: plan}, "", "")
+	}
+	if plan.RolledBack {
+		return jsonResponse(false, nil, "Rollback plan "+plan.ID+" has already been executed", "ALREADY_ROLLED_BACK")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result := executeRollbackPlan(h, session, plan)
+	if result.Failed > 0 {
+		return jsonResponse(false, result, "Rollback stopped at a failed step; the remaining steps are kept in the plan", "ROLLBACK_FAILED")
+	}
+	return jsonResponse(true, result, "", "")
+}
+
+//export GetQueryTrace
+func GetQueryTrace(handle C.int, sessionID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	sessionIDStr := C.GoString(sessionID)
+	if sessionIDStr == "" {
+		return jsonResponse(false, nil, "Session ID is required", "INVALID_OPTIONS")
+	}
+
+	trace, err := getQueryTraceBySessionID(session, sessionIDStr)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "TRACE_ERROR")
+	}
+
+	return jsonResponse(true, trace, "", "")
+}
+
+// GetQueryTraceWithOptions retrieves a query trace, optionally polling until
+// the coordinator and replicas have finished writing it
+//
+//export GetQueryTraceWithOptions
+func GetQueryTraceWithOptions(handle C.int, sessionID *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	sessionIDStr := C.GoString(sessionID)
+	if sessionIDStr == "" {
+		return jsonResponse(false, nil, "Session ID is required", "INVALID_OPTIONS")
+	}
+	var opts TraceOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	if opts.TimeoutMs < 0 {
+		return jsonResponse(false, nil, "timeoutMs must not be negative", "INVALID_OPTIONS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	if !opts.Wait {
+		trace, err := getQueryTraceBySessionID(session, sessionIDStr)
+		if err != nil {
+			return jsonResponse(false, nil, err.Error(), "TRACE_ERROR")
+		}
+		return jsonResponse(true, trace, "", "")
+	}
+
+	timeout := defaultTraceWait
+	if opts.TimeoutMs > 0 {
+		timeout = min(time.Duration(opts.TimeoutMs)*time.Millisecond, maxTraceWait)
+	}
+	ctx, finish, _ := startCancellable("", h, "trace")
+	defer finish()
+
+	trace, err := waitForQueryTrace(ctx, session, sessionIDStr, timeout)
+	if err != nil {
+		if ctx.Err() != nil {
+			return jsonResponse(false, nil, "Trace wait was cancelled", "CANCELLED")
+		}
+		return jsonResponse(false, nil, err.Error(), "TRACE_ERROR")
+	}
+	return jsonResponse(true, trace, "", "")
+}
+
+// ExportTrace writes a captured trace to a file as JSON or folded stacks
+//
+//export ExportTrace
+func ExportTrace(handle C.int, sessionID *C.char, format *C.char, path *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	sessionIDStr := C.GoString(sessionID)
+	if sessionIDStr == "" {
+		return jsonResponse(false, nil, "Session ID is required", "INVALID_OPTIONS")
+	}
+	formatStr := strings.ToLower(C.GoString(format))
+	if formatStr == "" {
+		formatStr = TraceFormatJSON
+	}
+	if formatStr != TraceFormatJSON && formatStr != TraceFormatFolded {
+		return jsonResponse(false, nil, "Invalid format: "+formatStr+" (use json or folded)", "INVALID_OPTIONS")
+	}
+	pathStr := C.GoString(path)
+	if pathStr == "" {
+		return jsonResponse(false, nil, "Path is required", "INVALID_OPTIONS")
+	}
+
+	trace, err := getQueryTraceBySessionID(session, sessionIDStr)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "TRACE_ERROR")
+	}
+
+	result, err := exportTrace(session, trace, formatStr, pathStr)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "EXPORT_ERROR")
+	}
+
+	return jsonResponse(true, result, "", "")
+}
+
+// PagedQueryResult represents a page of query results
+type PagedQueryResult struct {
+	Columns        []string                 `json:"columns"`
+	ColumnTypes    []string                 `json:"columnTypes"`
+	Rows           []map[string]interface{} `json:"rows"`
+	RowCount       int                      `json:"rowCount"`
+	HasMore        bool                     `json:"hasMore"`
+	AllCompleted   bool                     `json:"allCompleted"`           // True when no more pages (hasMore=false)
+	Truncated      bool                     `json:"truncated,omitempty"`    // Auto-fetch stopped at its row cap; hasMore is true
+	QueryID        string                   `json:"queryId"`
+	TraceSessionID string                   `json:"traceSessionId,omitempty"` // Present when tracing is enabled
+	Keyspace       string                   `json:"keyspace,omitempty"`     // Source keyspace for the query
+	Table          string                   `json:"table,omitempty"`        // Source table for the query
+	Execution      *db.ExecutionInfo        `json:"execution,omitempty"`    // Coordinator and attempts that served the page
+	Applied        *bool                    `json:"applied,omitempty"`      // Set for conditional (IF ...) writes
+}
+
+//export ExecuteQueryPaged
+func ExecuteQueryPaged(handle C.int, query *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	cql := C.GoString(query)
+
+	done := beginInteractive()
+	defer done()
+
+	// WORKAROUND: Astra hangs indefinitely when tracing is enabled for queries.
+	// Only apply this workaround for Astra connections (detected via Secure Connect Bundle).
+	// Toggling tracing is visible to every query on the handle, so the exclusive
+	// lock keeps other operations out until it is restored.
+	tracingWasEnabled := false
+	var unlock func()
+	if isAstraSession(h) && session.Tracing() {
+		unlock = lockHandleExclusive(h)
+		tracingWasEnabled = true
+		session.SetTracing(false)
+	} else {
+		unlock = lockHandleShared(h)
+	}
+	defer unlock()
+
+	if estimate := checkScanGuard(h, session, cql, false); estimate != nil {
+		if tracingWasEnabled {
+			session.SetTracing(true)
+		}
+		return jsonResponse(false, estimate, scanGuardMessage(estimate), "SCAN_LIMIT_EXCEEDED")
+	}
+	if tooLarge := checkStatementPayload(h, session, 0, cql, nil); tooLarge != nil {
+		if tracingWasEnabled {
+			session.SetTracing(true)
+		}
+		return jsonResponse(false, tooLarge, tooLarge.message(), "PAYLOAD_TOO_LARGE")
+	}
+
+	recordUsage(usageQueries, 1)
+	prof := profileStatement(h, session, "query", cql, nil)
+	result := session.ExecuteCQLQuery(cql)
+
+	// Re-enable tracing if it was disabled for Astra
+	if tracingWasEnabled {
+		session.SetTracing(true)
+	}
+
+	// Parse keyspace and table from the query for TABLEMETA:INFO support
+	keyspace, table := parseTableReference(cql, session.Keyspace())
+	sourceKeyspace, sourceTable := schemaTableReference(cql, session.Keyspace()) // For schema drop detection
+
+	// Handle different result types
+	switch v := result.(type) {
+	case db.QueryResult:
+		// Non-streaming result - return all rows, no pagination needed
+		rows := make([]map[string]interface{}, 0, len(v.RawData))
+		for _, rawRow := range v.RawData {
+			rows = append(rows, rawRow)
+		}
+
+		prof.done(v.RowCount, "")
+		qr := PagedQueryResult{
+			Columns:        v.Headers,
+			ColumnTypes:    v.ColumnTypes,
+			Rows:           rows,
+			RowCount:       v.RowCount,
+			HasMore:        false,
+			AllCompleted:   true,
+			QueryID:        "",
+			TraceSessionID: getTraceIDIfEnabled(session),
+			Keyspace:       keyspace,
+			Table:          table,
+			Execution:      v.Execution,
+			Applied:        v.Applied,
+		}
+		return jsonResponse(true, qr, "", "")
+
+	case db.StreamingQueryResult:
+		// Streaming result - fetch first page and store iterator
+		pageSize := session.PageSize()
+		if pageSize <= 0 {
+			pageSize = 100 // Default page size
+		}
+
+		// With auto-fetch on, read every page up to the session's row cap
+		limit, fetch := pageLimit(h, session, pageSize)
+
+		// Rows come from a pool and go back to it once the page is serialized
+		scanner := db.NewRowScanner(v.Iterator)
+		rows := readRows(make([]map[string]interface{}, 0, min(limit, pageSize)), scanner, limit, fetch)
+		defer db.ReleaseRows(rows)
+
+		// Check if there are more rows by trying to scan one more
+		if testRow, ok := scanner.Next(); ok {
+			// We read one extra row, store it for next page
+			queryID := generateQueryID(h)
+
+			pagedQueriesMutex.Lock()
+			pagedQueries[queryID] = &pagedQueryState{
+				Session:     session,
+				Iterator:    v.Iterator,
+				Rows:        scanner,
+				ColumnNames: v.ColumnNames,
+				ColumnTypes: v.ColumnTypes,
+				PageSize:    pageSize,
+				PeekedRow:   testRow, // Store the peeked row for next call
+				Execution:   v.Execution,
+				Keyspace:    sourceKeyspace,
+				Table:       sourceTable,
+			}
+			pagedQueriesMutex.Unlock()
+			if fetch != nil {
+				fetch.finish(true)
+			}
+			prof.done(len(rows), "")
+
+			qr := PagedQueryResult{
+				Columns:        v.ColumnNames,
+				ColumnTypes:    v.ColumnTypes,
+				Rows:           rows,
+				RowCount:       len(rows),
+				HasMore:        true,
+				AllCompleted:   false,
+				Truncated:      fetch != nil,
+				QueryID:        queryID,
+				TraceSessionID: getTraceIDIfEnabled(session),
+				Keyspace:       keyspace,
+				Table:          table,
+				Execution:      v.Execution.Info(v.Iterator),
+			}
+			return jsonResponse(true, qr, "", "")
+		}
+
+		// No more rows, close iterator
+		v.Iterator.Close()
+		if fetch != nil {
+			fetch.finish(false)
+		}
+		prof.done(len(rows), "")
+
+		qr := PagedQueryResult{
+			Columns:        v.ColumnNames,
+			ColumnTypes:    v.ColumnTypes,
+			Rows:           rows,
+			RowCount:       len(rows),
+			HasMore:        false,
+			AllCompleted:   true,
+			QueryID:        "",
+			TraceSessionID: getTraceIDIfEnabled(session),
+			Keyspace:       keyspace,
+			Table:          table,
+			Execution:      v.Execution.Info(v.Iterator),
+		}
+		return jsonResponse(true, qr, "", "")
+
+	case string:
+		prof.done(0, "")
+		return jsonResponse(true, map[string]interface{}{
+			"message": v,
+		}, "", "")
+
+	case error:
+		prof.done(0, v.Error())
+		return jsonResponse(false, nil, v.Error(), "QUERY_ERROR")
+
+	default:
+		prof.done(0, "")
+		return jsonResponse(true, map[string]interface{}{
+			"result": v,
+		}, "", "")
+	}
+}
+
+//export FetchNextPage
+func FetchNextPage(handle C.int, queryID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	qID := C.GoString(queryID)
+	if qID == "" {
+		return jsonResponse(false, nil, "Query ID is required", "INVALID_OPTIONS")
+	}
+
+	pagedQueriesMutex.Lock()
+	state, exists := pagedQueries[qID]
+	pagedQueriesMutex.Unlock()
+
+	if !exists {
+		return jsonResponse(false, nil, "Query not found or already closed", "QUERY_NOT_FOUND")
+	}
+
+	done := beginInteractive()
+	defer done()
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	// Only one fetch may drive the iterator at a time
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.closed {
+		return jsonResponse(false, nil, "Query not found or already closed", "QUERY_NOT_FOUND")
+	}
+
+	// The source keyspace or table was dropped: the remaining pages cannot be
+	// read, so release the iterator and report the schema change
+	if reason := state.schemaChanged.Load(); reason != nil {
+		state.closeLocked()
+		pagedQueriesMutex.Lock()
+		delete(pagedQueries, qID)
+		pagedQueriesMutex.Unlock()
+		return jsonResponse(false, nil, "Query invalidated: "+*reason, "SCHEMA_CHANGED")
+	}
+
+	// Fetch next page
+	pageSize := state.PageSize
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+
+	// With auto-fetch on, read every remaining page up to the row cap
+	limit, fetch := pageLimit(h, session, pageSize)
+
+	rows := make([]map[string]interface{}, 0, min(limit, pageSize))
+	defer func() { db.ReleaseRows(rows) }()
+
+	// First, include the peeked row from previous call if it exists
+	if state.PeekedRow != nil {
+		rows = append(rows, state.PeekedRow)
+		state.PeekedRow = nil
+	}
+
+	// Fetch remaining rows to fill up to the limit
+	rows = readRows(rows, state.Rows, limit, fetch)
+
+	// Check if there are more rows by peeking ahead
+	hasMore := false
+	if len(rows) == limit {
+		if testRow, ok := state.Rows.Next(); ok {
+			hasMore = true
+			// Store the peeked row for next call instead of appending
+			state.PeekedRow = testRow
+		}
+	}
+
+	if fetch != nil {
+		fetch.finish(hasMore)
+	}
+
+	// Read execution info before the iterator is closed
+	var execution *db.ExecutionInfo
+	if iter, ok := state.Iterator.(*gocql.Iter); ok {
+		execution = state.Execution.Info(iter)
+	}
+
+	if !hasMore {
+		// No more rows, clean up
+		err := state.closeLocked()
+		pagedQueriesMutex.Lock()
+		delete(pagedQueries, qID)
+		pagedQueriesMutex.Unlock()
+
+		// A drop that races the fetch surfaces as a driver error before the
+		// schema event arrives
+		if reason := state.schemaChanged.Load(); reason != nil {
+			return jsonResponse(false, nil, "Query invalidated: "+*reason, "SCHEMA_CHANGED")
+		}
+		if isSchemaChangeError(err) {
+			return jsonResponse(false, nil, "Query invalidated: "+err.Error(), "SCHEMA_CHANGED")
+		}
+	}
+
+	// Rows go back to the pool from rows; the display picks columns into new maps
+	shownRows := rows
+	if state.Display != nil {
+		shownRows = make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			shownRows[i] = state.Display.row(row)
+		}
+	}
+
+	qr := PagedQueryResult{
+		Columns:      state.ColumnNames,
+		ColumnTypes:  state.ColumnTypes,
+		Rows:         shownRows,
+		RowCount:     len(rows),
+		HasMore:      hasMore,
+		AllCompleted: !hasMore,
+		Truncated:    fetch != nil && hasMore,
+		QueryID:      qID,
+		Execution:    execution,
+	}
+
+	if !hasMore {
+		qr.QueryID = "" // Clear query ID when done
+	}
+
+	return jsonResponse(true, qr, "", "")
+}
+
+//export CancelPagedQuery
+func CancelPagedQuery(handle C.int, queryID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	qID := C.GoString(queryID)
+	if qID == "" {
+		return jsonResponse(false, nil, "Query ID is required", "INVALID_OPTIONS")
+	}
 
-//export CancelTestConnection
-func CancelTestConnection(requestID *C.char) *C.char {
-	reqID := C.GoString(requestID)
-	if reqID == "" {
-		return jsonResponse(false, nil, "Request ID is required", "INVALID_OPTIONS")
+	pagedQueriesMutex.Lock()
+	state, exists := pagedQueries[qID]
+	if exists {
+		delete(pagedQueries, qID)
 	}
+	pagedQueriesMutex.Unlock()
 
-	pendingConnectionsMutex.Lock()
-	cancelChan, exists := pendingConnections[reqID]
 	if exists {
-		close(cancelChan)
-		delete(pendingConnections, reqID)
+		state.close()
 	}
-	pendingConnectionsMutex.Unlock()
 
 	if !exists {
 		return jsonResponse(true, map[string]interface{}{
 			"cancelled": false,
-			"reason":    "No pending connection with this ID",
+			"reason":    "Query not found or already closed",
 		}, "", "")
 	}
 
@@ -1163,907 +4426,1007 @@ func CancelTestConnection(requestID *C.char) *C.char {
 	}, "", "")
 }
 
-//export GetClusterMetadata
-func GetClusterMetadata(handle C.int) *C.char {
+// CancelQuery cancels any active paged queries, multi-statement executions and
+// partition scans for the session, and aborts its running queries
+// This is used when the user interrupts a running query (e.g., CTRL+C)
+//
+//export CancelQuery
+func CancelQuery(handle C.int) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	metadata, err := GetClusterMetadataFromSession(session)
-	if err != nil {
-		return jsonResponse(false, nil, "Failed to get cluster metadata: "+err.Error(), "METADATA_ERROR")
+	// Find and remove all paged queries for this session, then close them
+	// outside pagedQueriesMutex so an in-flight fetch can finish first
+	pagedQueriesMutex.Lock()
+	cancelled := make([]*pagedQueryState, 0)
+	for qID, state := range pagedQueries {
+		if state.Session == session {
+			cancelled = append(cancelled, state)
+			delete(pagedQueries, qID)
+		}
 	}
+	pagedQueriesMutex.Unlock()
 
-	return jsonResponse(true, metadata, "", "")
-}
+	for _, state := range cancelled {
+		state.close()
+	}
+	cancelledCount := len(cancelled)
 
-// DDLOptions represents options for DDL generation
-type DDLOptions struct {
-	Cluster       bool   `json:"cluster"`       // If true, generate DDL for entire cluster
-	Keyspace      string `json:"keyspace"`      // Keyspace name (required if not cluster)
-	Table         string `json:"table"`         // Table name (optional)
-	Index         string `json:"index"`         // Index name (optional, requires table)
-	Type          string `json:"type"`          // User type name (optional)
-	Function      string `json:"function"`      // Function name (optional)
-	Aggregate     string `json:"aggregate"`     // Aggregate name (optional)
-	View          string `json:"view"`          // Materialized view name (optional)
-	IncludeSystem bool   `json:"includeSystem"` // If true, include system keyspaces in cluster DDL
+	return jsonResponse(true, map[string]interface{}{
+		"cancelledQueries":      cancelledCount,
+		"cancelledMultiQueries": cancelHandleCalls(h, "multiQuery"),
+		"cancelledScans":        cancelHandleCalls(h, "findPartitions", "countTable", "benchmark", "generate"),
+		"cancelledQueued":       cancelQueuedBulk(h),
+		"cancelledAsyncQueries": cancelHandleCalls(h, "asyncQuery"),
+		"abortedQueries":        cancelHandleCalls(h, "query"),
+	}, "", "")
 }
 
-//export GetDDL
-func GetDDL(handle C.int, optionsJSON *C.char) *C.char {
+// AbortRunningQuery interrupts the queries the session is running through
+// ExecuteQuery and ExecuteQueryWithOptions. The driver abandons the request in
+// flight, so the call returns at once with a CANCELLED error; a write the
+// coordinator already received may still be applied.
+//
+//export AbortRunningQuery
+func AbortRunningQuery(handle C.int) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	optStr := C.GoString(optionsJSON)
-	var opts DDLOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
-		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
-	}
-
-	ddlResult, err := GenerateDDLWithOptions(session.GocqlSession(), opts)
-	if err != nil {
-		return jsonResponse(false, nil, "Failed to generate DDL: "+err.Error(), "DDL_ERROR")
-	}
-
-	return jsonResponse(true, ddlResult, "", "")
-}
-
-// TLSCheckOptions represents options for TLS security check
-type TLSCheckOptions struct {
-	Host       string `json:"host"`
-	Port       int    `json:"port"`
-	CAFile     string `json:"caFile"`
-	CertFile   string `json:"certFile"`
-	KeyFile    string `json:"keyFile"`
-	SkipVerify bool   `json:"skipVerify"`
-	FilesOnly  bool   `json:"filesOnly"` // Only check certificate files, don't connect
+	return jsonResponse(true, map[string]interface{}{
+		"abortedQueries": cancelHandleCalls(h, "query"),
+	}, "", "")
 }
 
-//export CheckTLS
-func CheckTLS(optionsJSON *C.char) *C.char {
-	optStr := C.GoString(optionsJSON)
-	var opts TLSCheckOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
-		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+// ExecuteQueryAsync starts a statement in the background and returns its
+// query ID at once. Poll the ID with PollQueryResult; stop it with
+// CancelAsyncQuery or Cancel. optionsJSON may be empty.
+//
+//export ExecuteQueryAsync
+func ExecuteQueryAsync(handle C.int, query *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Set defaults
-	if opts.Port == 0 {
-		opts.Port = 9042
+	if !featureEnabled(session.Workspace(), featureAsyncQueries) {
+		return jsonResponse(false, nil, featureDisabledMessage(session.Workspace(), featureAsyncQueries), "FEATURE_DISABLED")
 	}
 
-	var result *TLSSecurityInfo
-	var err error
+	cql := strings.TrimSpace(C.GoString(query))
+	if cql == "" {
+		return jsonResponse(false, nil, "Query is required", "INVALID_OPTIONS")
+	}
 
-	if opts.FilesOnly {
-		// Only analyze certificate files
-		result, err = CheckTLSSecurityFromFiles(opts.CAFile, opts.CertFile, opts.KeyFile)
-	} else {
-		// Connect and analyze
-		if opts.Host == "" {
-			return jsonResponse(false, nil, "Host is required for TLS connection check", "INVALID_OPTIONS")
+	var opts AsyncQueryOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 		}
-		result, err = CheckTLSSecurity(opts.Host, opts.Port, opts.CAFile, opts.CertFile, opts.KeyFile, opts.SkipVerify)
 	}
 
+	queryID, err := startAsyncQuery(h, cql, opts)
 	if err != nil {
-		return jsonResponse(false, nil, err.Error(), "TLS_CHECK_ERROR")
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
 	}
-
-	return jsonResponse(true, result, "", "")
-}
-
-// DecryptOptions represents options for decryption
-type DecryptOptions struct {
-	Ciphertext     string `json:"ciphertext"`     // Base64 encoded
-	PrivateKey     string `json:"privateKey"`     // PEM string
-	PrivateKeyFile string `json:"privateKeyFile"` // Path to PEM file
+	return jsonResponse(true, map[string]interface{}{
+		"queryId": queryID,
+	}, "", "")
 }
 
-//export DecryptCredential
-func DecryptCredential(optionsJSON *C.char) *C.char {
-	optStr := C.GoString(optionsJSON)
-	var opts DecryptOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
-		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+// PollQueryResult returns the status of an asynchronous query, with its
+// result once it has finished. A finished query can be polled only once.
+//
+//export PollQueryResult
+func PollQueryResult(handle C.int, queryID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	if opts.Ciphertext == "" {
-		return jsonResponse(false, nil, "Ciphertext is required", "INVALID_OPTIONS")
+	status, ok := pollAsyncQuery(h, C.GoString(queryID))
+	if !ok {
+		return jsonResponse(false, nil, "Query not found or already polled", "QUERY_NOT_FOUND")
 	}
+	return jsonResponse(true, status, "", "")
+}
 
-	var plaintext string
-	var err error
+// OpenStream starts a flow-controlled stream of a SELECT's rows, a COPY TO
+// job's progress or schema events, and returns its state with the stream ID.
+// The stream queues only as many items as the host grants credits for (see
+// flow_streams.go).
+//
+//export OpenStream
+func OpenStream(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
 
-	if opts.PrivateKeyFile != "" {
-		plaintext, err = DecryptWithPrivateKeyFile(opts.Ciphertext, opts.PrivateKeyFile)
-	} else if opts.PrivateKey != "" {
-		plaintext, err = DecryptWithPrivateKey(opts.Ciphertext, opts.PrivateKey)
-	} else {
-		return jsonResponse(false, nil, "Either privateKey or privateKeyFile is required", "INVALID_OPTIONS")
+	var opts StreamOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
+	stream, code, err := openStream(h, session, opts)
 	if err != nil {
-		return jsonResponse(false, nil, err.Error(), "DECRYPT_ERROR")
+		return jsonResponse(false, nil, err.Error(), code)
 	}
-
-	return jsonResponse(true, map[string]string{"plaintext": plaintext}, "", "")
+	return jsonResponse(true, stream.grant(0), "", "")
 }
 
-// AstraBundleOptions represents options for parsing Astra bundle
-type AstraBundleOptions struct {
-	BundlePath string `json:"bundlePath"`
-	ExtractDir string `json:"extractDir"` // Optional, uses temp dir if empty
-}
-
-//export ParseAstraSecureBundle
-func ParseAstraSecureBundle(optionsJSON *C.char) *C.char {
-	optStr := C.GoString(optionsJSON)
-	var opts AstraBundleOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
-		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+// ReadStream returns the items a stream has queued, optionally waiting for
+// one and granting more credits. optionsJSON is {"max", "waitMs", "grant",
+// "window"} and may be empty. Once done is true the stream can be closed.
+//
+//export ReadStream
+func ReadStream(handle C.int, streamID *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	if opts.BundlePath == "" {
-		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
+	var opts StreamReadOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
 	}
-
-	bundleInfo, err := ParseAstraBundle(opts.BundlePath, opts.ExtractDir)
-	if err != nil {
-		return jsonResponse(false, nil, err.Error(), "BUNDLE_ERROR")
+	if opts.Max < 0 || opts.WaitMs < 0 || opts.Grant < 0 || opts.Window < 0 {
+		return jsonResponse(false, nil, "max, waitMs, grant and window must not be negative", "INVALID_OPTIONS")
 	}
 
-	return jsonResponse(true, bundleInfo, "", "")
+	stream := getStream(h, C.GoString(streamID))
+	if stream == nil {
+		return jsonResponse(false, nil, "Stream not found or already closed", "STREAM_NOT_FOUND")
+	}
+	return jsonResponse(true, stream.read(opts), "", "")
 }
 
-//export ValidateAstraSecureBundle
-func ValidateAstraSecureBundle(bundlePath *C.char) *C.char {
-	path := C.GoString(bundlePath)
-
-	valid, errors := ValidateAstraBundle(path)
-
-	result := map[string]interface{}{
-		"valid":  valid,
-		"errors": errors,
+// GrantStreamCredits lets a stream queue credits more items
+//
+//export GrantStreamCredits
+func GrantStreamCredits(handle C.int, streamID *C.char, credits C.int) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+	if credits < 0 {
+		return jsonResponse(false, nil, "credits must not be negative", "INVALID_OPTIONS")
 	}
 
-	return jsonResponse(true, result, "", "")
-}
-
-// AstraConnectOptions represents options for connecting with Astra bundle
-type AstraConnectOptions struct {
-	BundlePath string `json:"bundlePath"`
-	ExtractDir string `json:"extractDir"`
-	Username   string `json:"username"`
-	Password   string `json:"password"`
-	Keyspace   string `json:"keyspace"` // Override keyspace from bundle
+	stream := getStream(h, C.GoString(streamID))
+	if stream == nil {
+		return jsonResponse(false, nil, "Stream not found or already closed", "STREAM_NOT_FOUND")
+	}
+	return jsonResponse(true, stream.grant(int(credits)), "", "")
 }
 
-//export CreateAstraSession
-func CreateAstraSession(optionsJSON *C.char) *C.char {
-	optStr := C.GoString(optionsJSON)
-	var opts AstraConnectOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
-		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+// CloseStream stops a stream's producer and drops its queued items
+//
+//export CloseStream
+func CloseStream(handle C.int, streamID *C.char) *C.char {
+	h := int(handle)
+	if getSession(h) == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	if opts.BundlePath == "" {
-		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
-	}
-	if opts.Username == "" || opts.Password == "" {
-		return jsonResponse(false, nil, "username and password are required", "INVALID_OPTIONS")
+	state, ok := closeStream(h, C.GoString(streamID))
+	if !ok {
+		return jsonResponse(false, nil, "Stream not found or already closed", "STREAM_NOT_FOUND")
 	}
+	return jsonResponse(true, state, "", "")
+}
 
-	// Parse the bundle
-	bundleInfo, err := ParseAstraBundle(opts.BundlePath, opts.ExtractDir)
-	if err != nil {
-		return jsonResponse(false, nil, "Failed to parse bundle: "+err.Error(), "BUNDLE_ERROR")
+// CancelAsyncQuery cancels an asynchronous query. It reports "cancelled" from
+// then on and any result that still arrives is dropped.
+//
+//export CancelAsyncQuery
+func CancelAsyncQuery(handle C.int, queryID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Fetch metadata from Astra metadata service to get actual connection endpoints
-	if err := FetchAstraMetadata(bundleInfo, 0); err != nil {
-		CleanupAstraBundle(bundleInfo.ExtractedDir)
-		return jsonResponse(false, nil, "Failed to fetch Astra metadata: "+err.Error(), "METADATA_ERROR")
+	status, ok := cancelAsyncQuery(h, C.GoString(queryID))
+	if !ok {
+		return jsonResponse(false, nil, "Query not found or already polled", "QUERY_NOT_FOUND")
 	}
+	return jsonResponse(true, status, "", "")
+}
 
-	// Validate we got the required metadata
-	if bundleInfo.SniHost == "" || bundleInfo.SniPort == 0 || len(bundleInfo.ContactPoints) == 0 {
-		CleanupAstraBundle(bundleInfo.ExtractedDir)
-		return jsonResponse(false, nil, "Invalid metadata: missing SNI proxy or contact points", "METADATA_ERROR")
+//export BrowseTable
+func BrowseTable(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Build session options
-	keyspace := opts.Keyspace
-	if keyspace == "" {
-		keyspace = bundleInfo.Keyspace
+	var opts BrowseTableOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
-	// Create session options for db
-	// Use SNI proxy host:port as the connection endpoint
-	// Use first contact point (host ID) as the TLS ServerName for SNI routing
-	// Note: InsecureSkipVerify is needed because the cert is valid for *.db.astra.datastax.com
-	// but SNI uses UUID host IDs for routing. The CA cert still validates the chain.
-	dbOpts := db.SessionOptions{
-		Host:     bundleInfo.SniHost,
-		Port:     bundleInfo.SniPort,
-		Keyspace: keyspace,
-		Username: opts.Username,
-		Password: opts.Password,
-		SSL: &config.SSLConfig{
-			Enabled:            true,
-			CertPath:           bundleInfo.CertPath,
-			KeyPath:            bundleInfo.KeyPath,
-			CAPath:             bundleInfo.CACertPath,
-			HostVerification:   false,                       // SNI proxy uses host IDs, not hostnames
-			InsecureSkipVerify: true,                        // Skip hostname verification (UUID != *.db.astra.datastax.com)
-			ServerName:         bundleInfo.ContactPoints[0], // Use host ID as SNI for routing
-		},
+	if opts.Table == "" {
+		return jsonResponse(false, nil, "table is required", "INVALID_OPTIONS")
+	}
+	if opts.Keyspace == "" {
+		opts.Keyspace = session.Keyspace()
+		if opts.Keyspace == "" {
+			return jsonResponse(false, nil, "No keyspace specified and no current keyspace", "INVALID_OPTIONS")
+		}
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = session.PageSize()
+		if opts.PageSize <= 0 {
+			opts.PageSize = 100
+		}
 	}
 
-	// Create session
-	session, err := db.NewSessionWithOptions(dbOpts)
+	done := beginInteractive()
+	defer done()
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := browseTable(session, opts)
 	if err != nil {
-		CleanupAstraBundle(bundleInfo.ExtractedDir)
-		return jsonResponse(false, nil, "Connection failed: "+err.Error(), "CONNECTION_FAILED")
+		return jsonResponse(false, nil, err.Error(), "BROWSE_ERROR")
 	}
 
-	// Register session and mark as Astra connection
-	handle := registerSession(session)
-	markSessionAsAstra(handle)
-	return jsonResponse(true, map[string]interface{}{
-		"handle":           handle,
-		"cassandraVersion": session.CassandraVersion(),
-		"keyspace":         session.Keyspace(),
-		"bundleInfo":       bundleInfo,
-	}, "", "")
+	return jsonResponse(true, result, "", "")
 }
 
-// TestAstraConnectionOptions extends AstraConnectOptions with request ID for cancellation
-type TestAstraConnectionOptions struct {
-	BundlePath string `json:"bundlePath"`
-	ExtractDir string `json:"extractDir"`
-	Username   string `json:"username"`
-	Password   string `json:"password"`
-	Keyspace   string `json:"keyspace"`
-	RequestID  string `json:"requestID"` // Unique ID for cancellation
-}
+// SampleTable reads a sample of a table's rows: the first rows, rows from
+// random token ranges, or the last rows of a partition
+//
+//export SampleTable
+func SampleTable(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
 
-//export TestAstraConnectionWithID
-func TestAstraConnectionWithID(optionsJSON *C.char) *C.char {
-	optStr := C.GoString(optionsJSON)
-	var opts TestAstraConnectionOptions
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+	var opts SampleTableOptions
+	if err := decodeDeleteJSON(C.GoString(optionsJSON), &opts); err != nil {
 		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
-	if opts.BundlePath == "" {
-		return jsonResponse(false, nil, "bundlePath is required", "INVALID_OPTIONS")
+	if opts.Table == "" {
+		return jsonResponse(false, nil, "table is required", "INVALID_OPTIONS")
 	}
-	if opts.Username == "" || opts.Password == "" {
-		return jsonResponse(false, nil, "username and password are required", "INVALID_OPTIONS")
+	if opts.Keyspace == "" {
+		opts.Keyspace = session.Keyspace()
+		if opts.Keyspace == "" {
+			return jsonResponse(false, nil, "No keyspace specified and no current keyspace", "INVALID_OPTIONS")
+		}
+	}
+	opts.Mode = strings.ToLower(strings.TrimSpace(opts.Mode))
+	if opts.Mode == "" {
+		opts.Mode = sampleFirst
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultSampleLimit
+	}
+	if opts.Limit > maxSampleLimit {
+		return jsonResponse(false, nil, fmt.Sprintf("limit must not exceed %d", maxSampleLimit), "INVALID_OPTIONS")
 	}
 
-	// Create cancellation channel if requestID provided
-	var cancelChan chan struct{}
-	if opts.RequestID != "" {
-		cancelChan = make(chan struct{})
-		pendingConnectionsMutex.Lock()
-		pendingConnections[opts.RequestID] = cancelChan
-		pendingConnectionsMutex.Unlock()
+	done := beginInteractive()
+	defer done()
 
-		// Cleanup when done
-		defer func() {
-			pendingConnectionsMutex.Lock()
-			delete(pendingConnections, opts.RequestID)
-			pendingConnectionsMutex.Unlock()
-		}()
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := sampleTable(session, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "BROWSE_ERROR")
 	}
 
-	// Check if already cancelled before starting
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		default:
+	return jsonResponse(true, result, "", "")
+}
+
+// GetSampleModes reports which SampleTable modes a table supports, and why
+// the others are not available
+//
+//export GetSampleModes
+func GetSampleModes(handle C.int, keyspace *C.char, table *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	ks := C.GoString(keyspace)
+	tableName := C.GoString(table)
+	if tableName == "" {
+		return jsonResponse(false, nil, "table is required", "INVALID_PARAMS")
+	}
+	if ks == "" {
+		ks = session.Keyspace()
+		if ks == "" {
+			return jsonResponse(false, nil, "No keyspace specified and no current keyspace", "INVALID_PARAMS")
 		}
 	}
 
-	// Parse the bundle
-	bundleInfo, err := ParseAstraBundle(opts.BundlePath, opts.ExtractDir)
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	meta, err := session.GetTableMetadata(ks, tableName)
 	if err != nil {
-		return jsonResponse(false, nil, "Failed to parse bundle: "+err.Error(), "BUNDLE_ERROR")
+		return jsonResponse(false, nil, err.Error(), "BROWSE_ERROR")
 	}
 
-	// Check if cancelled after bundle parsing
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			// Cleanup extracted files
-			CleanupAstraBundle(bundleInfo.ExtractedDir)
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		default:
+	return jsonResponse(true, sampleModes(meta, clusterPartitioner(session)), "", "")
+}
+
+// BrowseCDC reads row-level changes from the commit log segments in the
+// node's cdc_raw directory and decodes them with the session's schema
+//
+//export BrowseCDC
+func BrowseCDC(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts BrowseCDCOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	if opts.Table != "" && opts.Keyspace == "" {
+		opts.Keyspace = session.Keyspace()
+		if opts.Keyspace == "" {
+			return jsonResponse(false, nil, "No keyspace specified and no current keyspace", "INVALID_OPTIONS")
+		}
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultCDCLimit
+	}
+	if opts.Limit > maxCDCLimit {
+		opts.Limit = maxCDCLimit
+	}
+	if opts.Cursor != "" {
+		if _, err := parseCDCCursor(opts.Cursor); err != nil {
+			return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
 		}
 	}
 
-	// Fetch metadata from Astra metadata service to get actual connection endpoints
-	if err := FetchAstraMetadata(bundleInfo, 0); err != nil {
-		CleanupAstraBundle(bundleInfo.ExtractedDir)
-		return jsonResponse(false, nil, "Failed to fetch Astra metadata: "+err.Error(), "METADATA_ERROR")
+	done := beginInteractive()
+	defer done()
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := browseCDC(session, opts)
+	if errors.Is(err, errCDCDirectoryNotFound) {
+		return jsonResponse(false, nil, err.Error(), "CDC_NOT_FOUND")
+	}
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CDC_ERROR")
 	}
 
-	// Check if cancelled after metadata fetch
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			CleanupAstraBundle(bundleInfo.ExtractedDir)
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		default:
+	return jsonResponse(true, result, "", "")
+}
+
+// CompareTables samples rows of tableA by primary key and diffs them against
+// tableB, which may be on another session (e.g. a migration target)
+//
+//export CompareTables
+func CompareTables(handleA C.int, tableA *C.char, handleB C.int, tableB *C.char, sampleSpecJSON *C.char) *C.char {
+	hA, hB := int(handleA), int(handleB)
+	sessionA := getSession(hA)
+	sessionB := getSession(hB)
+	if sessionA == nil || sessionB == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var spec CompareSampleSpec
+	if specStr := C.GoString(sampleSpecJSON); specStr != "" {
+		if err := json.Unmarshal([]byte(specStr), &spec); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 		}
 	}
 
-	// Validate we got the required metadata
-	if bundleInfo.SniHost == "" || bundleInfo.SniPort == 0 || len(bundleInfo.ContactPoints) == 0 {
-		CleanupAstraBundle(bundleInfo.ExtractedDir)
-		return jsonResponse(false, nil, "Invalid metadata: missing SNI proxy or contact points", "METADATA_ERROR")
+	ksA, tblA := splitTableName(C.GoString(tableA), sessionA.Keyspace())
+	ksB, tblB := splitTableName(C.GoString(tableB), sessionB.Keyspace())
+	if tblA == "" || tblB == "" {
+		return jsonResponse(false, nil, "Both tables are required", "INVALID_OPTIONS")
+	}
+	if ksA == "" || ksB == "" {
+		return jsonResponse(false, nil, "No keyspace specified and no current keyspace", "INVALID_OPTIONS")
 	}
 
-	// Build session options
-	keyspace := opts.Keyspace
-	if keyspace == "" {
-		keyspace = bundleInfo.Keyspace
+	release, err := acquireBulk(hA, "compareTables")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
 	}
+	defer release()
 
-	// Use SNI proxy host:port as the connection endpoint
-	// Use first contact point (host ID) as the TLS ServerName for SNI routing
-	// Note: InsecureSkipVerify is needed because the cert is valid for *.db.astra.datastax.com
-	// but SNI uses UUID host IDs for routing. The CA cert still validates the chain.
-	dbOpts := db.SessionOptions{
-		Host:     bundleInfo.SniHost,
-		Port:     bundleInfo.SniPort,
-		Keyspace: keyspace,
-		Username: opts.Username,
-		Password: opts.Password,
-		SSL: &config.SSLConfig{
-			Enabled:            true,
-			CertPath:           bundleInfo.CertPath,
-			KeyPath:            bundleInfo.KeyPath,
-			CAPath:             bundleInfo.CACertPath,
-			HostVerification:   false,                       // SNI proxy uses host IDs, not hostnames
-			InsecureSkipVerify: true,                        // Skip hostname verification (UUID != *.db.astra.datastax.com)
-			ServerName:         bundleInfo.ContactPoints[0], // Use host ID as SNI for routing
-		},
-		BatchMode: true, // Skip schema cache for faster test
+	// Lock both handles in a fixed order so two comparisons in opposite
+	// directions cannot wait on each other
+	first, second := hA, hB
+	if first > second {
+		first, second = second, first
+	}
+	unlockFirst := lockHandleShared(first)
+	defer unlockFirst()
+	if second != first {
+		unlockSecond := lockHandleShared(second)
+		defer unlockSecond()
 	}
 
-	// Create session in a goroutine to allow cancellation
-	type sessionResult struct {
-		session *db.Session
-		err     error
+	recordUsage(usageTableComparisons, 1)
+	result, err := compareTables(sessionA, ksA, tblA, sessionB, ksB, tblB, spec)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "COMPARE_ERROR")
 	}
-	resultChan := make(chan sessionResult, 1)
 
-	go func() {
-		session, err := db.NewSessionWithOptions(dbOpts)
-		resultChan <- sessionResult{session, err}
-	}()
+	return jsonResponse(true, result, "", "")
+}
 
-	// Wait for either session creation or cancellation
-	var session *db.Session
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			CleanupAstraBundle(bundleInfo.ExtractedDir)
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		case res := <-resultChan:
-			if res.err != nil {
-				CleanupAstraBundle(bundleInfo.ExtractedDir)
-				return jsonResponse(false, nil, "Connection failed: "+res.err.Error(), "CONNECTION_FAILED")
-			}
-			session = res.session
+// CompareSchemas diffs two schemas, each read from a session or given as
+// metadata exported with GetClusterMetadata, and returns the changes and the
+// CQL that turns the "from" schema into the "to" schema
+//
+//export CompareSchemas
+func CompareSchemas(optionsJSON *C.char) *C.char {
+	var opts CompareSchemasOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+
+	var handles []int
+	for _, side := range []SchemaSource{opts.From, opts.To} {
+		if (side.Handle == nil) == (side.Metadata == nil) {
+			return jsonResponse(false, nil, "from and to each need either a handle or metadata", "INVALID_OPTIONS")
 		}
-	} else {
-		res := <-resultChan
-		if res.err != nil {
-			CleanupAstraBundle(bundleInfo.ExtractedDir)
-			return jsonResponse(false, nil, "Connection failed: "+res.err.Error(), "CONNECTION_FAILED")
+		if side.Handle != nil {
+			if getSession(*side.Handle) == nil {
+				return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+			}
+			handles = append(handles, *side.Handle)
 		}
-		session = res.session
 	}
-	defer session.Close()
 
-	// Check cancelled before querying
-	if cancelChan != nil {
-		select {
-		case <-cancelChan:
-			CleanupAstraBundle(bundleInfo.ExtractedDir)
-			return jsonResponse(false, nil, "Connection cancelled", "CANCELLED")
-		default:
+	// Lock the handles in a fixed order, as CompareTables does
+	sort.Ints(handles)
+	for i, h := range handles {
+		if i > 0 && h == handles[i-1] {
+			continue
 		}
+		unlock := lockHandleShared(h)
+		defer unlock()
 	}
 
-	// Query to verify connection and get version info
-	var releaseVersion string
-	localQuery := session.Query("SELECT release_version FROM system.local")
-	if err := localQuery.Scan(&releaseVersion); err != nil {
-		CleanupAstraBundle(bundleInfo.ExtractedDir)
-		return jsonResponse(false, nil, "Failed to query system.local: "+err.Error(), "QUERY_ERROR")
+	schemas := make([]*ClusterMetadata, 2)
+	for i, side := range []SchemaSource{opts.From, opts.To} {
+		if side.Metadata != nil {
+			schemas[i] = side.Metadata
+			continue
+		}
+		metadata, err := GetClusterMetadataFromSession(getSession(*side.Handle))
+		if err != nil {
+			return jsonResponse(false, nil, "Failed to get cluster metadata: "+err.Error(), "METADATA_ERROR")
+		}
+		schemas[i] = metadata
 	}
 
-	// Cleanup extracted files after successful test
-	CleanupAstraBundle(bundleInfo.ExtractedDir)
+	recordUsage(usageSchemaComparisons, 1)
+	return jsonResponse(true, compareSchemas(schemas[0], schemas[1], opts.Keyspaces, true), "", "")
+}
 
-	// Build result similar to testConnection
-	info := ClusterInfo{
-		Build:      releaseVersion,
-		Protocol:   5,
-		Datacenter: bundleInfo.LocalDC,
-		Datacenters: []DatacenterInfo{
-			{
-				Address:    bundleInfo.SniHost,
-				Datacenter: bundleInfo.LocalDC,
-			},
-		},
+// PlanSchemaMigration lists the statements that bring the session's cluster
+// to a target schema, given as CREATE statements or as metadata, in an order
+// that runs. Drops are listed as skipped unless allowDrops is set.
+//
+//export PlanSchemaMigration
+func PlanSchemaMigration(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	return jsonResponse(true, info, "", "")
-}
+	var opts PlanSchemaMigrationOptions
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &opts); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	if (opts.CQL == "") == (opts.Metadata == nil) {
+		return jsonResponse(false, nil, "either cql or metadata is required", "INVALID_OPTIONS")
+	}
 
-//export CleanupAstraExtracted
-func CleanupAstraExtracted(extractedDir *C.char) *C.char {
-	dir := C.GoString(extractedDir)
-	if err := CleanupAstraBundle(dir); err != nil {
-		return jsonResponse(false, nil, err.Error(), "CLEANUP_ERROR")
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	live, err := GetClusterMetadataFromSession(session)
+	if err != nil {
+		return jsonResponse(false, nil, "Failed to get cluster metadata: "+err.Error(), "METADATA_ERROR")
 	}
-	return jsonResponse(true, nil, "", "")
-}
 
-// SourceFilesRequest represents the request for executing CQL files
-type SourceFilesRequest struct {
-	Files       []string `json:"files"`
-	StopOnError bool     `json:"stopOnError"`
-}
+	target := opts.Metadata
+	var ignored []string
+	if opts.CQL != "" {
+		def, err := cql.ParseSchemaDefinition(opts.CQL, session.Keyspace())
+		if err != nil {
+			return jsonResponse(false, nil, "Invalid target schema: "+err.Error(), "INVALID_OPTIONS")
+		}
+		if target, err = metadataFromDefinition(def, live); err != nil {
+			return jsonResponse(false, nil, "Invalid target schema: "+err.Error(), "INVALID_OPTIONS")
+		}
+		ignored = def.Ignored
+	}
 
-// sourceFileProgress tracks progress for a source file execution - keyed by session handle for isolation
-var (
-	sourceProgress     = make(map[int][]FileExecutionProgress)
-	sourceProgressLock sync.Mutex
-)
+	recordUsage(usageSchemaComparisons, 1)
+	return jsonResponse(true, planSchemaMigration(live, target, opts.Keyspaces, opts.AllowDrops, ignored), "", "")
+}
 
-//export ExecuteSourceFiles
-func ExecuteSourceFiles(handle C.int, optionsJSON *C.char) *C.char {
+// FindPartitions scans a table's token ranges and returns the partition keys
+// with rows matching a client-side predicate on any columns. The scan is rate
+// limited and bounded; it can be stopped with Cancel or CancelQuery.
+//
+//export FindPartitions
+func FindPartitions(handle C.int, keyspace *C.char, table *C.char, predicateJSON *C.char, maxResults C.int) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	optStr := C.GoString(optionsJSON)
-	var opts SourceFilesRequest
-	if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+	var pred PartitionPredicate
+	if err := json.Unmarshal([]byte(C.GoString(predicateJSON)), &pred); err != nil {
 		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
-	if len(opts.Files) == 0 {
-		return jsonResponse(false, nil, "No files provided", "INVALID_OPTIONS")
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
 	}
 
-	// Reset progress tracking for this session
-	sourceProgressLock.Lock()
-	sourceProgress[h] = []FileExecutionProgress{}
-	sourceProgressLock.Unlock()
+	ctx, finish, err := startCancellable(pred.CancelToken, h, "findPartitions")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
 
-	// Execute with progress callback
-	sourceOpts := &SourceFilesOptions{
-		Files:       opts.Files,
-		StopOnError: opts.StopOnError,
+	release, err := acquireBulkContext(ctx, h, "findPartitions")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
 	}
+	defer release()
 
-	result, err := executeSourceFiles(h, session, sourceOpts, func(progress FileExecutionProgress) {
-		sourceProgressLock.Lock()
-		// Update or append progress for this session
-		sessionProgress := sourceProgress[h]
-		found := false
-		for i, p := range sessionProgress {
-			if p.FilePath == progress.FilePath {
-				sessionProgress[i] = progress
-				found = true
-				break
-			}
-		}
-		if !found {
-			sessionProgress = append(sessionProgress, progress)
-		}
-		sourceProgress[h] = sessionProgress
-		sourceProgressLock.Unlock()
-	})
+	unlock := lockHandleShared(h)
+	defer unlock()
 
+	result, err := findPartitions(ctx, session, ks, tbl, pred, int(maxResults))
 	if err != nil {
-		return jsonResponse(false, nil, err.Error(), "EXECUTION_ERROR")
+		return jsonResponse(false, nil, err.Error(), "FIND_ERROR")
 	}
 
-	// Include final progress with result
-	sourceProgressLock.Lock()
-	sessionProgress := sourceProgress[h]
-	finalProgress := make([]FileExecutionProgress, len(sessionProgress))
-	copy(finalProgress, sessionProgress)
-	sourceProgressLock.Unlock()
-
-	return jsonResponse(true, map[string]interface{}{
-		"result":   result,
-		"progress": finalProgress,
-	}, "", "")
+	return jsonResponse(true, result, "", "")
 }
 
-//export GetSourceProgress
-func GetSourceProgress(handle C.int) *C.char {
-	h := int(handle)
-	session := getSession(h)
-	if session == nil {
-		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+// CountTable counts a table's rows exactly with parallel COUNT(*) queries over
+// token ranges. It can be stopped with Cancel or CancelQuery.
+//
+//export CountTable
+func CountTable(handle C.int, keyspace *C.char, table *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var opts CountTableOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	if opts.Consistency != "" && !db.ValidConsistency(opts.Consistency) {
+		return jsonResponse(false, nil, "Invalid consistency level: "+opts.Consistency, "INVALID_OPTIONS")
+	}
+
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
+	}
+
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "countTable")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
 	}
+	defer finish()
 
-	sourceProgressLock.Lock()
-	sessionProgress := sourceProgress[h]
-	progress := make([]FileExecutionProgress, len(sessionProgress))
-	copy(progress, sessionProgress)
-	sourceProgressLock.Unlock()
+	release, err := acquireBulkContext(ctx, h, "countTable")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
+	}
+	defer release()
 
-	return jsonResponse(true, progress, "", "")
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := countTable(ctx, h, session, ks, tbl, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "COUNT_ERROR")
+	}
+
+	return jsonResponse(true, result, "", "")
 }
 
-//export StopSourceExecution
-func StopSourceExecution(handle C.int) *C.char {
+// GetCountProgress returns the progress of the session's running or latest
+// CountTable call, or null when there has been none
+//
+//export GetCountProgress
+func GetCountProgress(handle C.int) *C.char {
 	h := int(handle)
-	session := getSession(h)
-	if session == nil {
+	if getSession(h) == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	cancelSourceExecution(h)
-	return jsonResponse(true, nil, "", "")
+	return jsonResponse(true, countProgress(h), "", "")
 }
 
-//export GetQueryTrace
-func GetQueryTrace(handle C.int, sessionID *C.char) *C.char {
+// BenchmarkWrites measures write latency at each requested consistency level
+// and concurrency against a synthetic table, which is dropped afterwards
+//
+//export BenchmarkWrites
+func BenchmarkWrites(handle C.int, tableSpec *C.char, optionsJSON *C.char) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	sessionIDStr := C.GoString(sessionID)
-	if sessionIDStr == "" {
-		return jsonResponse(false, nil, "Session ID is required", "INVALID_OPTIONS")
+	var spec BenchmarkTableSpec
+	if specStr := C.GoString(tableSpec); specStr != "" {
+		if err := json.Unmarshal([]byte(specStr), &spec); err != nil {
+			return jsonResponse(false, nil, "Invalid table spec JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	var opts BenchmarkOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	if _, err := benchmarkPlan(&opts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	if spec.Keyspace == "" && isAstraSession(h) {
+		return jsonResponse(false, nil, "keyspace is required on Astra, where scratch keyspaces cannot be created", "INVALID_OPTIONS")
 	}
 
-	trace, err := getQueryTraceBySessionID(session, sessionIDStr)
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "benchmark")
 	if err != nil {
-		return jsonResponse(false, nil, err.Error(), "TRACE_ERROR")
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
 	}
+	defer finish()
 
-	return jsonResponse(true, trace, "", "")
-}
+	release, err := acquireBulkContext(ctx, h, "benchmark")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
+	}
+	defer release()
 
-// PagedQueryResult represents a page of query results
-type PagedQueryResult struct {
-	Columns        []string                 `json:"columns"`
-	ColumnTypes    []string                 `json:"columnTypes"`
-	Rows           []map[string]interface{} `json:"rows"`
-	RowCount       int                      `json:"rowCount"`
-	HasMore        bool                     `json:"hasMore"`
-	AllCompleted   bool                     `json:"allCompleted"`           // True when no more pages (hasMore=false)
-	QueryID        string                   `json:"queryId"`
-	TraceSessionID string                   `json:"traceSessionId,omitempty"` // Present when tracing is enabled
-	Keyspace       string                   `json:"keyspace,omitempty"`     // Source keyspace for the query
-	Table          string                   `json:"table,omitempty"`        // Source table for the query
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := benchmarkWrites(ctx, h, session, spec, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "BENCHMARK_ERROR")
+	}
+
+	return jsonResponse(true, result, "", "")
 }
 
-//export ExecuteQueryPaged
-func ExecuteQueryPaged(handle C.int, query *C.char) *C.char {
+// BenchmarkReads measures read latency at each requested consistency level and
+// concurrency by reading partitions sampled from an existing table
+//
+//export BenchmarkReads
+func BenchmarkReads(handle C.int, keyspace *C.char, table *C.char, optionsJSON *C.char) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	cql := C.GoString(query)
-
-	// WORKAROUND: Astra hangs indefinitely when tracing is enabled for queries.
-	// Only apply this workaround for Astra connections (detected via Secure Connect Bundle).
-	tracingWasEnabled := false
-	if isAstraSession(h) && session.Tracing() {
-		tracingWasEnabled = true
-		session.SetTracing(false)
+	var opts BenchmarkReadsOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
 	}
-
-	result := session.ExecuteCQLQuery(cql)
-
-	// Re-enable tracing if it was disabled for Astra
-	if tracingWasEnabled {
-		session.SetTracing(true)
+	if _, err := benchmarkPlan(&opts.BenchmarkOptions); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
 	}
 
-	// Parse keyspace and table from the query for TABLEMETA:INFO support
-	keyspace, table := parseTableReference(cql, session.Keyspace())
-
-	// Handle different result types
-	switch v := result.(type) {
-	case db.QueryResult:
-		// Non-streaming result - return all rows, no pagination needed
-		rows := make([]map[string]interface{}, 0, len(v.RawData))
-		for _, rawRow := range v.RawData {
-			rows = append(rows, rawRow)
-		}
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
+	}
 
-		qr := PagedQueryResult{
-			Columns:        v.Headers,
-			ColumnTypes:    v.ColumnTypes,
-			Rows:           rows,
-			RowCount:       v.RowCount,
-			HasMore:        false,
-			AllCompleted:   true,
-			QueryID:        "",
-			TraceSessionID: getTraceIDIfEnabled(session),
-			Keyspace:       keyspace,
-			Table:          table,
-		}
-		return jsonResponse(true, qr, "", "")
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "benchmark")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
 
-	case db.StreamingQueryResult:
-		// Streaming result - fetch first page and store iterator
-		pageSize := session.PageSize()
-		if pageSize <= 0 {
-			pageSize = 100 // Default page size
-		}
+	release, err := acquireBulkContext(ctx, h, "benchmark")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
+	}
+	defer release()
 
-		rows := make([]map[string]interface{}, 0, pageSize)
+	unlock := lockHandleShared(h)
+	defer unlock()
 
-		for i := 0; i < pageSize; i++ {
-			row := make(map[string]interface{})
-			if !v.Iterator.MapScan(row) {
-				break
-			}
-			rows = append(rows, row)
-		}
+	result, err := benchmarkReads(ctx, h, session, ks, tbl, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "BENCHMARK_ERROR")
+	}
 
-		// Check if there are more rows by trying to scan one more
-		testRow := make(map[string]interface{})
-		if v.Iterator.MapScan(testRow) {
-			// We read one extra row, store it for next page
-			queryID := generateQueryID(h)
+	return jsonResponse(true, result, "", "")
+}
 
-			pagedQueriesMutex.Lock()
-			pagedQueries[queryID] = &pagedQueryState{
-				Session:     session,
-				Iterator:    v.Iterator,
-				ColumnNames: v.ColumnNames,
-				ColumnTypes: v.ColumnTypes,
-				PageSize:    pageSize,
-				PeekedRow:   testRow, // Store the peeked row for next call
-			}
-			pagedQueriesMutex.Unlock()
+// GenerateTestData inserts synthetic rows into an existing table, with values
+// of each column's type following the distributions in the options
+//
+//export GenerateTestData
+func GenerateTestData(handle C.int, keyspace *C.char, table *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
 
-			qr := PagedQueryResult{
-				Columns:        v.ColumnNames,
-				ColumnTypes:    v.ColumnTypes,
-				Rows:           rows,
-				RowCount:       len(rows),
-				HasMore:        true,
-				AllCompleted:   false,
-				QueryID:        queryID,
-				TraceSessionID: getTraceIDIfEnabled(session),
-				Keyspace:       keyspace,
-				Table:          table,
-			}
-			return jsonResponse(true, qr, "", "")
+	var opts GenerateTestDataOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 		}
+	}
+	if err := validateGenerateOptions(&opts); err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
 
-		// No more rows, close iterator
-		v.Iterator.Close()
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
+	}
 
-		qr := PagedQueryResult{
-			Columns:        v.ColumnNames,
-			ColumnTypes:    v.ColumnTypes,
-			Rows:           rows,
-			RowCount:       len(rows),
-			HasMore:        false,
-			AllCompleted:   true,
-			QueryID:        "",
-			TraceSessionID: getTraceIDIfEnabled(session),
-			Keyspace:       keyspace,
-			Table:          table,
-		}
-		return jsonResponse(true, qr, "", "")
+	ctx, finish, err := startCancellable(opts.CancelToken, h, "generate")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+	defer finish()
 
-	case string:
-		return jsonResponse(true, map[string]interface{}{
-			"message": v,
-		}, "", "")
+	release, err := acquireBulkContext(ctx, h, "generate")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
+	}
+	defer release()
 
-	case error:
-		return jsonResponse(false, nil, v.Error(), "QUERY_ERROR")
+	unlock := lockHandleShared(h)
+	defer unlock()
 
-	default:
-		return jsonResponse(true, map[string]interface{}{
-			"result": v,
-		}, "", "")
+	result, err := generateTestData(ctx, h, session, ks, tbl, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "GENERATE_ERROR")
 	}
+
+	return jsonResponse(true, result, "", "")
 }
 
-//export FetchNextPage
-func FetchNextPage(handle C.int, queryID *C.char) *C.char {
+// CreateScratchSpace creates a uniquely named keyspace for experiments. It is
+// dropped when the session is closed unless options.keepOnClose is set.
+//
+//export CreateScratchSpace
+func CreateScratchSpace(handle C.int, optionsJSON *C.char) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	qID := C.GoString(queryID)
-	if qID == "" {
-		return jsonResponse(false, nil, "Query ID is required", "INVALID_OPTIONS")
+	var opts ScratchSpaceOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
 	}
-
-	pagedQueriesMutex.Lock()
-	state, exists := pagedQueries[qID]
-	pagedQueriesMutex.Unlock()
-
-	if !exists {
-		return jsonResponse(false, nil, "Query not found or already closed", "QUERY_NOT_FOUND")
+	if isAstraSession(h) {
+		return jsonResponse(false, nil, "Astra keyspaces cannot be created with CQL; create one in the Astra portal", "SCRATCH_ERROR")
 	}
 
-	// Fetch next page
-	pageSize := state.PageSize
-	if pageSize <= 0 {
-		pageSize = 100
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	space, err := createScratchSpace(h, session, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "SCRATCH_ERROR")
 	}
 
-	rows := make([]map[string]interface{}, 0, pageSize)
+	return jsonResponse(true, space, "", "")
+}
 
-	// First, include the peeked row from previous call if it exists
-	if state.PeekedRow != nil {
-		rows = append(rows, state.PeekedRow)
-		state.PeekedRow = nil
+// ListScratchSpaces lists the scratch keyspaces on the cluster, including
+// those of other sessions and abandoned ones whose lease expired
+//
+//export ListScratchSpaces
+func ListScratchSpaces(handle C.int) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	// Fetch remaining rows to fill up to pageSize
-	for len(rows) < pageSize {
-		row := make(map[string]interface{})
-		if !state.Iterator.MapScan(row) {
-			break
-		}
-		rows = append(rows, row)
-	}
+	unlock := lockHandleShared(h)
+	defer unlock()
 
-	// Check if there are more rows by peeking ahead
-	hasMore := false
-	if len(rows) == pageSize {
-		testRow := make(map[string]interface{})
-		if state.Iterator.MapScan(testRow) {
-			hasMore = true
-			// Store the peeked row for next call instead of appending
-			state.PeekedRow = testRow
-		}
+	spaces, err := listScratchSpaces(h, session)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "SCRATCH_ERROR")
 	}
 
-	if !hasMore {
-		// No more rows, clean up
-		state.Iterator.Close()
-		pagedQueriesMutex.Lock()
-		delete(pagedQueries, qID)
-		pagedQueriesMutex.Unlock()
+	return jsonResponse(true, spaces, "", "")
+}
+
+// CleanupScratchSpaces drops scratch keyspaces: one by name, all expired
+// ones, or by default those created by this session
+//
+//export CleanupScratchSpaces
+func CleanupScratchSpaces(handle C.int, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	qr := PagedQueryResult{
-		Columns:      state.ColumnNames,
-		ColumnTypes:  state.ColumnTypes,
-		Rows:         rows,
-		RowCount:     len(rows),
-		HasMore:      hasMore,
-		AllCompleted: !hasMore,
-		QueryID:      qID,
+	var opts CleanupScratchOptions
+	if optsStr := C.GoString(optionsJSON); optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
 	}
 
-	if !hasMore {
-		qr.QueryID = "" // Clear query ID when done
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := cleanupScratchSpaces(h, session, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "SCRATCH_ERROR")
 	}
 
-	return jsonResponse(true, qr, "", "")
+	return jsonResponse(true, result, "", "")
 }
 
-//export CancelPagedQuery
-func CancelPagedQuery(handle C.int, queryID *C.char) *C.char {
+// BuildSelectQuery generates a SELECT for a grouping/limit spec, pushing GROUP BY and
+// PER PARTITION LIMIT down to the server where the table and version allow it
+//
+//export BuildSelectQuery
+func BuildSelectQuery(handle C.int, specJSON *C.char) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	qID := C.GoString(queryID)
-	if qID == "" {
-		return jsonResponse(false, nil, "Query ID is required", "INVALID_OPTIONS")
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	var spec cql.SelectSpec
+	if err := json.Unmarshal([]byte(C.GoString(specJSON)), &spec); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
 	}
 
-	pagedQueriesMutex.Lock()
-	state, exists := pagedQueries[qID]
-	if exists {
-		state.Iterator.Close()
-		delete(pagedQueries, qID)
+	if spec.Table == "" {
+		return jsonResponse(false, nil, "table is required", "INVALID_OPTIONS")
 	}
-	pagedQueriesMutex.Unlock()
 
-	if !exists {
-		return jsonResponse(true, map[string]interface{}{
-			"cancelled": false,
-			"reason":    "Query not found or already closed",
-		}, "", "")
+	result, err := buildSelectQuery(session, spec)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "BUILD_ERROR")
 	}
 
-	return jsonResponse(true, map[string]interface{}{
-		"cancelled": true,
-	}, "", "")
+	return jsonResponse(true, result, "", "")
 }
 
-// CancelQuery cancels any active paged queries for the session
-// This is used when the user interrupts a running query (e.g., CTRL+C)
+// AnalyzeQuery parses a SELECT and reports its clauses plus GROUP BY / PER PARTITION LIMIT validity
 //
-//export CancelQuery
-func CancelQuery(handle C.int) *C.char {
+//export AnalyzeQuery
+func AnalyzeQuery(handle C.int, query *C.char) *C.char {
 	h := int(handle)
 	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	pagedQueriesMutex.Lock()
-	defer pagedQueriesMutex.Unlock()
+	unlock := lockHandleShared(h)
+	defer unlock()
 
-	// Find and cancel all paged queries for this session
-	cancelledCount := 0
-	queryIDs := make([]string, 0)
+	result, err := analyzeSelectQuery(session, C.GoString(query))
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "ANALYZE_ERROR")
+	}
 
-	for qID, state := range pagedQueries {
-		if state.Session == session {
-			queryIDs = append(queryIDs, qID)
-		}
+	return jsonResponse(true, result, "", "")
+}
+
+// ExplainQuery reports where a SELECT reads without running it: the tokens and
+// replicas of its partitions, and whether it needs ALLOW FILTERING
+//
+//export ExplainQuery
+func ExplainQuery(handle C.int, query *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
 
-	for _, qID := range queryIDs {
-		state := pagedQueries[qID]
-		if state.Iterator != nil {
-			state.Iterator.Close()
-		}
-		delete(pagedQueries, qID)
-		cancelledCount++
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := explainQuery(session, C.GoString(query))
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "EXPLAIN_ERROR")
 	}
 
-	return jsonResponse(true, map[string]interface{}{
-		"cancelledQueries": cancelledCount,
-	}, "", "")
+	return jsonResponse(true, result, "", "")
 }
 
 // SplitCQLResult represents the result of splitting CQL statements
+
 type SplitCQLResult struct {
-	Statements   []string `json:"statements"`
-	Identifiers  []string `json:"identifiers"`
-	ExtraTokens  []string `json:"extraTokens"`
-	SecondTokens []string `json:"secondTokens"`
-	ThirdTokens  []string `json:"thirdTokens"`
-	Incomplete   bool     `json:"incomplete"`
-	Error        string   `json:"error,omitempty"`
+	Statements      []string                  `json:"statements"`
+	Identifiers     []string                  `json:"identifiers"`
+	ExtraTokens     []string                  `json:"extraTokens"`
+	SecondTokens    []string                  `json:"secondTokens"`
+	ThirdTokens     []string                  `json:"thirdTokens"`
+	Descriptors     []cql.StatementDescriptor `json:"descriptors"`               // One per statement: kind, object type, qualified name and options
+	Ranges          []SourceRange             `json:"ranges"`                    // One per statement: where it is in the input
+	IncompleteRange *SourceRange              `json:"incompleteRange,omitempty"` // The unfinished last statement, when incomplete
+	Incomplete      bool                      `json:"incomplete"`
+	Error           string                    `json:"error,omitempty"`
 }
 
 //export SplitCQL
 func SplitCQL(cql *C.char) *C.char {
-	cqlStr := C.GoString(cql)
+	source := C.GoString(cql)
 
 	// Handle empty input
-	cqlStr = strings.TrimSpace(cqlStr)
+	cqlStr := strings.TrimSpace(source)
 	if cqlStr == "" {
 		return jsonResponse(true, SplitCQLResult{
 			Statements:   []string{},
@@ -2071,6 +5434,8 @@ func SplitCQL(cql *C.char) *C.char {
 			ExtraTokens:  []string{},
 			SecondTokens: []string{},
 			ThirdTokens:  []string{},
+			Descriptors:  describeStatements(nil),
+			Ranges:       []SourceRange{},
 			Incomplete:   false,
 		}, "", "")
 	}
@@ -2084,26 +5449,185 @@ func SplitCQL(cql *C.char) *C.char {
 			ExtraTokens:  []string{},
 			SecondTokens: []string{},
 			ThirdTokens:  []string{},
+			Descriptors:  describeStatements(nil),
+			Ranges:       []SourceRange{},
 			Incomplete:   false,
 			Error:        err.Error(),
 		}, "", "")
 	}
 
+	statements := splitResult.GetStatementStrings()
 	result := SplitCQLResult{
-		Statements:   splitResult.GetStatementStrings(),
+		Statements:   statements,
 		Identifiers:  splitResult.Identifiers,
 		ExtraTokens:  splitResult.ExtraTokens,
 		SecondTokens: splitResult.SecondTokens,
 		ThirdTokens:  splitResult.ThirdTokens,
+		Descriptors:  describeStatements(statements),
+		Ranges:       make([]SourceRange, 0, len(statements)),
 		Incomplete:   splitResult.Incomplete,
 	}
 
+	// Ranges are in the input as given, before leading whitespace was trimmed
+	base := len(source) - len(strings.TrimLeftFunc(source, unicode.IsSpace))
+	positions := newSourcePositions(source)
+	for _, span := range splitResult.GetStatementSpans() {
+		result.Ranges = append(result.Ranges, positions.sourceRange(span, base))
+	}
+	if span := splitResult.IncompleteSpan(); span != nil {
+		r := positions.sourceRange(*span, base)
+		result.IncompleteRange = &r
+	}
+
+	return jsonResponse(true, result, "", "")
+}
+
+// InsertRows writes JSON objects into a table. Keys set to null delete the cell
+// (a tombstone); absent keys leave the column unset unless options say otherwise.
+//
+//export InsertRows
+func InsertRows(handle C.int, keyspace *C.char, table *C.char, rowsJSON *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var rows []json.RawMessage
+	if err := json.Unmarshal([]byte(C.GoString(rowsJSON)), &rows); err != nil {
+		return jsonResponse(false, nil, "Invalid rows JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	var opts InsertRowsOptions
+	if optStr := C.GoString(optionsJSON); optStr != "" {
+		if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := insertRows(session, ks, tbl, rows, opts)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INSERT_ERROR")
+	}
+	if result.Failed > 0 && result.Inserted == 0 {
+		return jsonResponse(false, result, result.Errors[0].Error, "INSERT_ERROR")
+	}
+
 	return jsonResponse(true, result, "", "")
 }
 
+// deleteResponse reports a delete plan. A delete refused for lack of confirm
+// fails with CONFIRMATION_REQUIRED and carries the plan so it can be shown.
+func deleteResponse(plan *DeletePlan, err error, opts DeleteOptions) *C.char {
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "DELETE_ERROR")
+	}
+	if plan.ConfirmationRequired && !opts.Confirm && !opts.DryRun {
+		return jsonResponse(false, plan, fmt.Sprintf(
+			"delete affects %d rows, more than confirmAbove (%d); set confirm to proceed", plan.RowsAffected, plan.ConfirmAbove), "CONFIRMATION_REQUIRED")
+	}
+	return jsonResponse(true, plan, "", "")
+}
+
+// DeletePartition deletes one partition with a single partition tombstone.
+// keyJSON holds every partition key column.
+//
+//export DeletePartition
+func DeletePartition(handle C.int, keyspace *C.char, table *C.char, keyJSON *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var key map[string]interface{}
+	if err := decodeDeleteJSON(C.GoString(keyJSON), &key); err != nil || key == nil {
+		return jsonResponse(false, nil, "Invalid key JSON: key must be an object of column values", "INVALID_OPTIONS")
+	}
+	var opts DeleteOptions
+	if optStr := C.GoString(optionsJSON); optStr != "" {
+		if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	plan, err := deletePartition(session, ks, tbl, key, opts)
+	return deleteResponse(plan, err, opts)
+}
+
+// DeleteRange deletes the rows under a clustering prefix, optionally bounded on
+// the next clustering column, with a single range tombstone where supported.
+// rangeJSON may be empty when the key holds a clustering prefix.
+//
+//export DeleteRange
+func DeleteRange(handle C.int, keyspace *C.char, table *C.char, keyJSON *C.char, rangeJSON *C.char, optionsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var key map[string]interface{}
+	if err := decodeDeleteJSON(C.GoString(keyJSON), &key); err != nil || key == nil {
+		return jsonResponse(false, nil, "Invalid key JSON: key must be an object of column values", "INVALID_OPTIONS")
+	}
+	var rng *ClusteringRange
+	if rangeStr := C.GoString(rangeJSON); rangeStr != "" && rangeStr != "null" {
+		rng = &ClusteringRange{}
+		if err := decodeDeleteJSON(rangeStr, rng); err != nil {
+			return jsonResponse(false, nil, "Invalid range JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+	var opts DeleteOptions
+	if optStr := C.GoString(optionsJSON); optStr != "" {
+		if err := json.Unmarshal([]byte(optStr), &opts); err != nil {
+			return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+		}
+	}
+
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	plan, err := deleteRange(session, ks, tbl, key, rng, opts)
+	return deleteResponse(plan, err, opts)
+}
+
 //export CopyTo
 func CopyTo(handle C.int, paramsJSON *C.char) *C.char {
-	session := getSession(int(handle))
+	h := int(handle)
+	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
@@ -2113,12 +5637,52 @@ func CopyTo(handle C.int, paramsJSON *C.char) *C.char {
 		return jsonResponse(false, nil, "Invalid params JSON: "+err.Error(), "INVALID_PARAMS")
 	}
 
-	if params.Table == "" || params.Filename == "" {
-		return jsonResponse(false, nil, "table and filename are required", "INVALID_PARAMS")
+	if (params.Table == "" && params.Query == "") || params.Filename == "" {
+		return jsonResponse(false, nil, "table or query, and filename are required", "INVALID_PARAMS")
+	}
+	if params.Query != "" {
+		if params.Table != "" || len(params.Columns) > 0 {
+			return jsonResponse(false, nil, "query cannot be combined with table or columns", "INVALID_PARAMS")
+		}
+		query, err := selectForCopy(params.Query)
+		if err != nil {
+			return jsonResponse(false, nil, err.Error(), "INVALID_PARAMS")
+		}
+		params.Query = query
 	}
-
 	options := mergeCopyOptions(defaultCopyOptions(), params.Options)
-	result, err := executeCopyTo(session, params, options)
+	format, err := copyFormat(params, options)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_PARAMS")
+	}
+	if format == copyParquet && !featureEnabled(session.Workspace(), featureParquetCopy) {
+		return jsonResponse(false, nil, featureDisabledMessage(session.Workspace(), featureParquetCopy), "FEATURE_DISABLED")
+	}
+	if key := autoCsvOption(options); key != "" {
+		return jsonResponse(false, nil, key+"=auto applies to COPY FROM only", "INVALID_PARAMS")
+	}
+
+	ctx, job, end, err := startCopyJob(params.JobID, h, params)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_OPTIONS")
+	}
+
+	release, err := acquireBulkContext(ctx, h, "copyTo")
+	if err != nil {
+		end(err)
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
+	}
+	defer release()
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := executeCopyTo(ctx, session, params, options, job)
+	end(err)
+	if err != nil && ctx.Err() != nil {
+		// Partial export - the rows written so far stay in the file
+		return jsonResponse(false, result, err.Error(), "CANCELLED")
+	}
 	if err != nil {
 		return jsonResponse(false, nil, err.Error(), "COPY_ERROR")
 	}
@@ -2126,9 +5690,46 @@ func CopyTo(handle C.int, paramsJSON *C.char) *C.char {
 	return jsonResponse(true, result, "", "")
 }
 
+// GetCopyProgress returns the rows exported, bytes written and rate of the
+// CopyTo call started with jobId, while it runs and for a while after
+//
+//export GetCopyProgress
+func GetCopyProgress(handle C.int, jobID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	progress, ok := copyJobProgress(h, C.GoString(jobID))
+	if !ok {
+		return jsonResponse(false, nil, "Copy job not found", "JOB_NOT_FOUND")
+	}
+	return jsonResponse(true, progress, "", "")
+}
+
+// CancelCopy stops the CopyTo call started with jobId between rows. The rows
+// already exported stay in the file.
+//
+//export CancelCopy
+func CancelCopy(handle C.int, jobID *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	progress, ok := cancelCopyJob(h, C.GoString(jobID))
+	if !ok {
+		return jsonResponse(false, nil, "Copy job not found", "JOB_NOT_FOUND")
+	}
+	return jsonResponse(true, progress, "", "")
+}
+
 //export CopyFrom
 func CopyFrom(handle C.int, paramsJSON *C.char) *C.char {
-	session := getSession(int(handle))
+	h := int(handle)
+	session := getSession(h)
 	if session == nil {
 		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
 	}
@@ -2141,9 +5742,50 @@ func CopyFrom(handle C.int, paramsJSON *C.char) *C.char {
 	if params.Table == "" || params.Filename == "" {
 		return jsonResponse(false, nil, "table and filename are required", "INVALID_PARAMS")
 	}
+	if params.Mapping != nil && len(params.Columns) > 0 {
+		return jsonResponse(false, nil, "mapping cannot be combined with columns", "INVALID_PARAMS")
+	}
 
 	options := mergeCopyOptions(defaultCopyOptions(), params.Options)
-	result, err := executeCopyFrom(session, params, options)
+	format, err := copyFormat(params, options)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "INVALID_PARAMS")
+	}
+	if format == copyParquet && !featureEnabled(session.Workspace(), featureParquetCopy) {
+		return jsonResponse(false, nil, featureDisabledMessage(session.Workspace(), featureParquetCopy), "FEATURE_DISABLED")
+	}
+	if format != copyCSV && (params.ValidateOnly || params.Mapping != nil || len(params.Columns) > 0) {
+		return jsonResponse(false, nil, "columns, mapping and validateOnly apply to CSV files only", "INVALID_PARAMS")
+	}
+	if params.Resume && format != copyCSV && format != copyJSONL {
+		return jsonResponse(false, nil, "resume applies to CSV and JSONL files only", "INVALID_PARAMS")
+	}
+	if params.Resume && params.ValidateOnly {
+		return jsonResponse(false, nil, "resume cannot be combined with validateOnly", "INVALID_PARAMS")
+	}
+
+	// A dry run only reads the file and schema, so it does not wait for a bulk slot
+	if params.ValidateOnly {
+		unlock := lockHandleShared(h)
+		defer unlock()
+
+		result, err := validateCopyFrom(session, params, options)
+		if err != nil {
+			return jsonResponse(false, nil, err.Error(), "COPY_ERROR")
+		}
+		return jsonResponse(true, result, "", "")
+	}
+
+	release, err := acquireBulk(h, "copyFrom")
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "CANCELLED")
+	}
+	defer release()
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	result, err := executeCopyFrom(h, session, params, options)
 	if err != nil {
 		if result != nil {
 			// Partial success - return result with error
@@ -2155,6 +5797,126 @@ func CopyFrom(handle C.int, paramsJSON *C.char) *C.char {
 	return jsonResponse(true, result, "", "")
 }
 
+// GetCopyCheckpoint returns the checkpoint CopyFrom with resume keeps for a
+// file: how far the import got, and whether the file changed since.
+// optionsJSON is {"filename", "checkpointFile"}. It needs no session.
+//
+//export GetCopyCheckpoint
+func GetCopyCheckpoint(optionsJSON *C.char) *C.char {
+	var req CopyCheckpointRequest
+	if err := json.Unmarshal([]byte(C.GoString(optionsJSON)), &req); err != nil {
+		return jsonResponse(false, nil, "Invalid options JSON: "+err.Error(), "INVALID_OPTIONS")
+	}
+	if req.Filename == "" {
+		return jsonResponse(false, nil, "filename is required", "INVALID_OPTIONS")
+	}
+
+	status, err := copyCheckpointStatus(req)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "COPY_ERROR")
+	}
+	if status == nil {
+		return jsonResponse(false, nil, "No checkpoint found for "+req.Filename, "CHECKPOINT_NOT_FOUND")
+	}
+	return jsonResponse(true, status, "", "")
+}
+
+// PlanCsvMapping matches the header of a CSV file to a table's columns and
+// checks sampled values against their types, for review before CopyFrom
+//
+//export PlanCsvMapping
+func PlanCsvMapping(handle C.int, paramsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var params CsvMappingParams
+	if err := json.Unmarshal([]byte(C.GoString(paramsJSON)), &params); err != nil {
+		return jsonResponse(false, nil, "Invalid params JSON: "+err.Error(), "INVALID_PARAMS")
+	}
+	if params.Table == "" || params.Filename == "" {
+		return jsonResponse(false, nil, "table and filename are required", "INVALID_PARAMS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	options := mergeCopyOptions(defaultCopyOptions(), params.Options)
+	plan, err := planCsvMapping(session, params, options)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "COPY_ERROR")
+	}
+
+	return jsonResponse(true, plan, "", "")
+}
+
+// DetectCsvDialect detects the encoding, quote, delimiter and header of a CSV
+// file from a sample of it, for confirmation before CopyFrom. Options given
+// in params are kept; the returned options can be passed to CopyFrom.
+//
+//export DetectCsvDialect
+func DetectCsvDialect(handle C.int, paramsJSON *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	var params CsvDialectParams
+	if err := json.Unmarshal([]byte(C.GoString(paramsJSON)), &params); err != nil {
+		return jsonResponse(false, nil, "Invalid params JSON: "+err.Error(), "INVALID_PARAMS")
+	}
+	if params.Filename == "" {
+		return jsonResponse(false, nil, "filename is required", "INVALID_PARAMS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	dialect, err := detectCsvDialectFile(session, params)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "COPY_ERROR")
+	}
+	return jsonResponse(true, dialect, "", "")
+}
+
+// GenerateLoaderConfig returns a dsbulk or Spark Cassandra Connector
+// configuration for a table that connects like the session, for transfers
+// too large for COPY. keyspace may be empty for the current keyspace.
+//
+//export GenerateLoaderConfig
+func GenerateLoaderConfig(handle C.int, keyspace *C.char, table *C.char, target *C.char) *C.char {
+	h := int(handle)
+	session := getSession(h)
+	if session == nil {
+		return jsonResponse(false, nil, "Invalid session handle", "INVALID_HANDLE")
+	}
+
+	ks := C.GoString(keyspace)
+	if ks == "" {
+		ks = session.Keyspace()
+	}
+	tbl := C.GoString(table)
+	if ks == "" || tbl == "" {
+		return jsonResponse(false, nil, "keyspace and table are required", "INVALID_OPTIONS")
+	}
+	tgt := strings.ToLower(C.GoString(target))
+	if !validLoaderTarget(tgt) {
+		return jsonResponse(false, nil, "target must be dsbulk or spark", "INVALID_OPTIONS")
+	}
+
+	unlock := lockHandleShared(h)
+	defer unlock()
+
+	cfg, err := generateLoaderConfig(h, session, ks, tbl, tgt)
+	if err != nil {
+		return jsonResponse(false, nil, err.Error(), "METADATA_ERROR")
+	}
+	return jsonResponse(true, cfg, "", "")
+}
+
 //export FreeString
 func FreeString(str *C.char) {
 	C.free(unsafe.Pointer(str))
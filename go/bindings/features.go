@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Feature flags
+//
+// Experimental subsystems are gated by flags, so a host app can turn a
+// preview on for one workspace without shipping a separate build. A flag is
+// on when the loaded binary was built with its subsystem (see
+// features_previews.go) and the first of these layers that sets it says so:
+//
+//   - the flags of the session's workspace (SetFeatureFlags with a workspaceID)
+//   - the process-wide flags (SetFeatureFlags without one)
+//   - the flag's default
+//
+// Flags are checked when a gated call is made, so a change applies to
+// sessions that are already open.
+
+// Feature flags of the experimental subsystems
+const (
+	featureAsyncQueries = "asyncQueries" // ExecuteQueryAsync
+	featureParquetCopy  = "parquetCopy"  // COPY TO and COPY FROM with FORMAT='parquet'
+	featureAIBridge     = "aiBridge"     // AI provider settings in GetEffectiveConfig
+)
+
+// featureDef describes a feature flag
+type featureDef struct {
+	name        string
+	description string
+	enabled     bool // Default; previews that shipped before flags existed stay on
+}
+
+// featureDefs lists every flag in the order GetFeatureFlags reports them
+var featureDefs = []featureDef{
+	{featureAsyncQueries, "Background queries with executeAsync() and pollQueryResult()", true},
+	{featureParquetCopy, "COPY TO and COPY FROM Parquet files", true},
+	{featureAIBridge, "AI provider settings of the config file, reported by getEffectiveConfig()", true},
+}
+
+// Layers a feature flag can come from
+const (
+	flagBinary    = "binary" // Not built into the loaded binary
+	flagWorkspace = "workspace"
+	flagProcess   = "process"
+	flagDefault   = "default"
+)
+
+// FeatureFlagsRequest sets or clears the flags of a workspace, or the
+// process-wide flags when WorkspaceID is empty
+type FeatureFlagsRequest struct {
+	WorkspaceID string          `json:"workspaceID"`
+	Flags       map[string]bool `json:"flags"` // Flags to set; nil clears every flag of the layer
+}
+
+// FeatureFlag is the state of a flag for a workspace
+type FeatureFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Compiled    bool   `json:"compiled"` // Built into the loaded binary
+	Default     bool   `json:"default"`
+	Enabled     bool   `json:"enabled"`
+	Source      string `json:"source"` // Layer the value came from: workspace, process, default or binary
+}
+
+// FeatureFlags is the result of GetFeatureFlags and SetFeatureFlags
+type FeatureFlags struct {
+	WorkspaceID string        `json:"workspaceID,omitempty"`
+	Flags       []FeatureFlag `json:"flags"`
+}
+
+var (
+	processFlags   = make(map[string]bool)
+	workspaceFlags = make(map[string]map[string]bool)
+	featureFlagsMu sync.RWMutex
+)
+
+// setFeatureFlags merges flags into a layer; nil flags clear the layer
+func setFeatureFlags(req FeatureFlagsRequest) (*FeatureFlags, error) {
+	var unknown []string
+	for name := range req.Flags {
+		if findFeature(name) == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown feature flags: %v", unknown)
+	}
+
+	featureFlagsMu.Lock()
+	switch {
+	case req.Flags == nil && req.WorkspaceID == "":
+		processFlags = make(map[string]bool)
+	case req.Flags == nil:
+		delete(workspaceFlags, req.WorkspaceID)
+	default:
+		layer := processFlags
+		if req.WorkspaceID != "" {
+			if layer = workspaceFlags[req.WorkspaceID]; layer == nil {
+				layer = make(map[string]bool)
+				workspaceFlags[req.WorkspaceID] = layer
+			}
+		}
+		for name, enabled := range req.Flags {
+			layer[name] = enabled
+		}
+	}
+	featureFlagsMu.Unlock()
+	return featureFlags(req.WorkspaceID), nil
+}
+
+// featureFlags returns the state of every flag for a workspace
+func featureFlags(workspace string) *FeatureFlags {
+	result := &FeatureFlags{WorkspaceID: workspace, Flags: make([]FeatureFlag, 0, len(featureDefs))}
+	for _, def := range featureDefs {
+		enabled, source := featureState(workspace, def)
+		result.Flags = append(result.Flags, FeatureFlag{
+			Name:        def.name,
+			Description: def.description,
+			Compiled:    compiledFeatures[def.name],
+			Default:     def.enabled,
+			Enabled:     enabled,
+			Source:      source,
+		})
+	}
+	return result
+}
+
+// featureState resolves a flag for a workspace and returns the layer it came from
+func featureState(workspace string, def featureDef) (bool, string) {
+	if !compiledFeatures[def.name] {
+		return false, flagBinary
+	}
+	featureFlagsMu.RLock()
+	defer featureFlagsMu.RUnlock()
+	if enabled, ok := workspaceFlags[workspace][def.name]; ok && workspace != "" {
+		return enabled, flagWorkspace
+	}
+	if enabled, ok := processFlags[def.name]; ok {
+		return enabled, flagProcess
+	}
+	return def.enabled, flagDefault
+}
+
+// featureEnabled reports whether a flag is on for a workspace
+func featureEnabled(workspace, name string) bool {
+	def := findFeature(name)
+	if def == nil {
+		return false
+	}
+	enabled, _ := featureState(workspace, *def)
+	return enabled
+}
+
+// featureDisabledMessage explains why a gated call was refused
+func featureDisabledMessage(workspace, name string) string {
+	def := findFeature(name)
+	if def != nil {
+		if _, source := featureState(workspace, *def); source == flagBinary {
+			return fmt.Sprintf("%s is not supported by this build of the library", name)
+		}
+	}
+	return fmt.Sprintf("%s is disabled; enable it with setFeatureFlags()", name)
+}
+
+// findFeature returns the definition of a flag, or nil for an unknown name
+func findFeature(name string) *featureDef {
+	for i := range featureDefs {
+		if featureDefs[i].name == name {
+			return &featureDefs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build nopreviews
+
+package main
+
+// compiledFeatures is empty in a build without previews: every feature flag
+// is reported as not compiled and stays off
+var compiledFeatures = map[string]bool{}
@@ -0,0 +1,12 @@
+//go:build !nopreviews
+
+package main
+
+// compiledFeatures are the feature flags whose subsystems this build
+// supports. Building with -tags nopreviews leaves every preview off,
+// whatever the runtime flags say.
+var compiledFeatures = map[string]bool{
+	featureAsyncQueries: true,
+	featureParquetCopy:  true,
+	featureAIBridge:     true,
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Flow-controlled streams
+//
+// A stream delivers rows, COPY TO progress or schema events to a host that
+// reads them with ReadStream, but it only produces as many items as the host
+// has granted credits for: each queued item takes a credit, and the host
+// hands out more with ReadStream or GrantStreamCredits. When the credits run
+// out the producer pauses, so a slow renderer never makes the Go side buffer
+// more than it asked for:
+//
+//   - a row stream stops reading its iterator, and the driver fetches no
+//     further pages until credits arrive
+//   - a progress stream keeps only the latest sample
+//   - a schema event stream cannot hold the cluster back, so it counts the
+//     events it has no credit for as dropped
+//
+// Credits plus queued items never exceed maxStreamWindow.
+
+// Stream kinds
+const (
+	streamRows         = "rows"
+	streamCopyProgress = "copyProgress"
+	streamSchemaEvents = "schemaEvents"
+)
+
+// Stream limits
+const (
+	defaultStreamCredits  = 100
+	maxStreamWindow       = 10000 // Credits plus queued items
+	defaultProgressPeriod = 500 * time.Millisecond
+	maxStreamWait         = 30 * time.Second
+)
+
+// StreamOptions are the options of OpenStream
+type StreamOptions struct {
+	Kind    string `json:"kind"`    // rows, copyProgress or schemaEvents
+	Credits int    `json:"credits"` // Items the stream may queue before the first read (default 100)
+
+	// rows
+	Query       string `json:"query,omitempty"`       // SELECT to stream
+	Force       bool   `json:"force,omitempty"`       // Run partition scans the scan guard would refuse
+	CancelToken string `json:"cancelToken,omitempty"` // Stream ID to use, cancellable with Cancel (default: one is issued)
+
+	// copyProgress
+	JobID      string `json:"jobId,omitempty"`      // COPY TO job started with jobId
+	IntervalMs int    `json:"intervalMs,omitempty"` // Sampling interval (default 500)
+
+	// schemaEvents
+	Keyspaces []string `json:"keyspaces,omitempty"`
+	Targets   []string `json:"targets,omitempty"`
+}
+
+// StreamReadOptions are the options of ReadStream
+type StreamReadOptions struct {
+	Max    int `json:"max"`    // Most items to return (default: all queued)
+	WaitMs int `json:"waitMs"` // Wait up to this long for an item when none is queued
+	Grant  int `json:"grant"`  // Credits to add after reading
+	Window int `json:"window"` // Top credits up so that credits plus queued items reach this
+}
+
+// StreamState reports a stream's flow control
+type StreamState struct {
+	StreamID      string `json:"streamId"`
+	Kind          string `json:"kind"`
+	Credits       int    `json:"credits"`       // Items the stream may still queue
+	Buffered      int    `json:"buffered"`      // Items queued and not yet read
+	BufferedBytes int64  `json:"bufferedBytes"` // Approximate size of the queued items
+	Paused        bool   `json:"paused"`        // The producer is waiting for credits
+	Delivered     int64  `json:"delivered"`     // Items returned by ReadStream so far
+	Dropped       int64  `json:"dropped,omitempty"`
+}
+
+// StreamBatch is the result of ReadStream
+type StreamBatch struct {
+	StreamState
+	Columns     []string      `json:"columns,omitempty"`     // Row streams
+	ColumnTypes []string      `json:"columnTypes,omitempty"` // Row streams
+	Items       []interface{} `json:"items"`
+	Done        bool          `json:"done"` // The producer has finished and every item has been read
+	Error       string        `json:"error,omitempty"`
+	ErrorCode   string        `json:"errorCode,omitempty"`
+}
+
+// StreamsUsage summarizes a session's streams for GetResourceUsage
+type StreamsUsage struct {
+	Open          int           `json:"open"`
+	Paused        int           `json:"paused"`
+	Buffered      int           `json:"buffered"`
+	BufferedBytes int64         `json:"bufferedBytes"`
+	Credits       int           `json:"credits"`
+	Streams       []StreamState `json:"streams"`
+}
+
+// flowStream is an open stream
+type flowStream struct {
+	id     string
+	kind   string
+	handle int
+	stop   func()
+	filter schemaEventFilter // Schema event streams
+
+	mu          sync.Mutex
+	changed     chan struct{} // Closed and replaced on every change
+	credits     int
+	items       []interface{}
+	sizes       []int64
+	bytes       int64
+	pending     interface{} // Latest progress sample waiting for a credit
+	columns     []string
+	columnTypes []string
+	delivered   int64
+	dropped     int64
+	paused      bool
+	done        bool
+	closed      bool
+	err         string
+	errCode     string
+}
+
+// Open streams by stream ID, and the handles whose schema events are
+// dispatched to streams
+var (
+	flowStreams         = make(map[string]*flowStream)
+	schemaStreamHandles = make(map[int]bool)
+	flowStreamsLock     sync.Mutex
+)
+
+// openStream validates the options, registers a stream and starts its producer
+func openStream(handle int, session *db.Session, opts StreamOptions) (*flowStream, string, error) {
+	if opts.Credits < 0 {
+		return nil, "INVALID_OPTIONS", errors.New("credits must not be negative")
+	}
+	credits := opts.Credits
+	if credits == 0 {
+		credits = defaultStreamCredits
+	}
+	s := &flowStream{
+		id:      opts.CancelToken,
+		kind:    opts.Kind,
+		handle:  handle,
+		changed: make(chan struct{}),
+		credits: min(credits, maxStreamWindow),
+	}
+	if s.id == "" {
+		s.id = newCancelToken()
+	} else if getStream(handle, s.id) != nil {
+		return nil, "INVALID_OPTIONS", errCancelTokenInUse
+	}
+
+	switch opts.Kind {
+	case streamRows:
+		if kind := cql.DescribeStatement(opts.Query).Kind; kind != "SELECT" {
+			return nil, "INVALID_OPTIONS", errors.New("only SELECT statements can be streamed")
+		}
+		if estimate := checkScanGuard(handle, session, opts.Query, opts.Force); estimate != nil {
+			return nil, "SCAN_LIMIT_EXCEEDED", errors.New(scanGuardMessage(estimate))
+		}
+		ctx, done, err := startCancellable(s.id, handle, "stream")
+		if err != nil {
+			return nil, "INVALID_OPTIONS", err
+		}
+		s.stop = done
+		s.register()
+		trackHandleWorkers(handle, 1)
+		go func() {
+			defer trackHandleWorkers(handle, -1)
+			defer done()
+			s.produceRows(ctx, session, opts.Query)
+		}()
+
+	case streamCopyProgress:
+		if _, ok := copyJobProgress(handle, opts.JobID); !ok {
+			return nil, "JOB_NOT_FOUND", errors.New("Copy job not found")
+		}
+		interval := defaultProgressPeriod
+		if opts.IntervalMs > 0 {
+			interval = time.Duration(opts.IntervalMs) * time.Millisecond
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stop = cancel
+		s.register()
+		trackHandleWorkers(handle, 1)
+		go func() {
+			defer trackHandleWorkers(handle, -1)
+			s.produceProgress(ctx, opts.JobID, interval)
+		}()
+
+	case streamSchemaEvents:
+		filter, err := newSchemaEventFilter(opts.Keyspaces, opts.Targets)
+		if err != nil {
+			return nil, "INVALID_OPTIONS", err
+		}
+		s.filter = filter
+		s.stop = func() {}
+		s.register()
+		watchSchemaStreams(handle, session)
+
+	default:
+		return nil, "INVALID_OPTIONS", fmt.Errorf("unknown stream kind %q (use rows, copyProgress or schemaEvents)", opts.Kind)
+	}
+	return s, "", nil
+}
+
+// register makes the stream visible to ReadStream
+func (s *flowStream) register() {
+	flowStreamsLock.Lock()
+	flowStreams[s.id] = s
+	flowStreamsLock.Unlock()
+}
+
+// produceRows runs the query and queues its rows as credits allow. The
+// handle is held shared while rows are read, and released while paused; a
+// session change meanwhile closes the stream (closeRowStreams), which cancels
+// ctx and with it the iterator.
+func (s *flowStream) produceRows(ctx context.Context, session *db.Session, query string) {
+	unlock := lockHandleShared(s.handle)
+	defer func() { unlock() }()
+
+	queue := func(row map[string]interface{}) bool {
+		if !s.hasCredit() {
+			unlock()
+			if !s.waitCredit(ctx) {
+				unlock = func() {}
+				return false
+			}
+			unlock = lockHandleShared(s.handle)
+		}
+		return s.queue(row)
+	}
+
+	switch v := session.ExecuteCQLQueryWithOptions(ctx, query, nil).(type) {
+	case db.StreamingQueryResult:
+		s.setColumns(v.ColumnNames, v.ColumnTypes)
+		for {
+			row := make(map[string]interface{})
+			if !v.Iterator.MapScan(row) || !queue(row) {
+				break
+			}
+		}
+		if err := v.Iterator.Close(); err != nil && ctx.Err() == nil {
+			s.finish(err.Error(), "QUERY_ERROR")
+			return
+		}
+	case db.QueryResult:
+		s.setColumns(v.Headers, v.ColumnTypes)
+		for _, row := range v.RawData {
+			if !queue(row) {
+				break
+			}
+		}
+	case error:
+		s.finish(v.Error(), "QUERY_ERROR")
+		return
+	}
+	if ctx.Err() != nil {
+		s.finish("Stream cancelled", "CANCELLED")
+		return
+	}
+	s.finish("", "")
+}
+
+// produceProgress samples a COPY TO job until it ends. Samples without a
+// credit replace each other, so the host always gets the latest one.
+func (s *flowStream) produceProgress(ctx context.Context, jobID string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		progress, ok := copyJobProgress(s.handle, jobID)
+		if !ok {
+			s.finish("Copy job not found", "JOB_NOT_FOUND")
+			return
+		}
+		s.offerLatest(progress)
+		if progress.Status != copyRunning {
+			s.finish("", "")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchSchemaStreams dispatches the session's schema events to its schema
+// event streams. The driver's handler cannot be removed, so it is added once
+// per handle.
+func watchSchemaStreams(handle int, session *db.Session) {
+	flowStreamsLock.Lock()
+	defer flowStreamsLock.Unlock()
+	if schemaStreamHandles[handle] {
+		return
+	}
+	schemaStreamHandles[handle] = true
+	session.OnSchemaChanged(func(event db.SchemaChangeEvent) {
+		if getSession(handle) != session {
+			return
+		}
+		for _, s := range handleStreams(handle) {
+			if s.kind == streamSchemaEvents && s.filter.matches(event) {
+				s.offer(event)
+			}
+		}
+	})
+}
+
+// notifyLocked wakes everything waiting for a change of the stream
+func (s *flowStream) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// hasCredit reports whether an item can be queued without waiting
+func (s *flowStream) hasCredit() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.credits > 0
+}
+
+// waitCredit waits until the stream has a credit; false when it was closed
+// or ctx ended first
+func (s *flowStream) waitCredit(ctx context.Context) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.credits == 0 && !s.closed {
+		s.paused = true
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+		s.mu.Lock()
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	s.paused = false
+	return s.credits > 0 && !s.closed && ctx.Err() == nil
+}
+
+// queue adds an item, taking a credit the caller made sure of
+func (s *flowStream) queue(item interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.credits == 0 {
+		return false
+	}
+	s.queueLocked(item)
+	return true
+}
+
+func (s *flowStream) queueLocked(item interface{}) {
+	size := estimateItemSize(item)
+	s.credits--
+	s.items = append(s.items, item)
+	s.sizes = append(s.sizes, size)
+	s.bytes += size
+	s.notifyLocked()
+}
+
+// offer queues an item if there is a credit for it, and counts it as
+// dropped otherwise
+func (s *flowStream) offer(item interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.done {
+		return
+	}
+	if s.credits == 0 {
+		s.dropped++
+		return
+	}
+	s.queueLocked(item)
+}
+
+// offerLatest queues an item if there is a credit for it, and otherwise
+// keeps it until there is one, in place of any item kept before
+func (s *flowStream) offerLatest(item interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if s.credits == 0 {
+		s.pending = item
+		s.paused = true
+		return
+	}
+	s.pending = nil
+	s.paused = false
+	s.queueLocked(item)
+}
+
+// setColumns records the columns of a row stream
+func (s *flowStream) setColumns(columns, columnTypes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.columns, s.columnTypes = columns, columnTypes
+}
+
+// finish records that the producer has ended, with an error when errMsg is set
+func (s *flowStream) finish(errMsg, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	s.err, s.errCode = errMsg, code
+	s.notifyLocked()
+}
+
+// grantLocked adds credits, within the stream's window, and queues a kept
+// progress sample once there is a credit for it
+func (s *flowStream) grantLocked(n int) {
+	if n <= 0 {
+		return
+	}
+	s.credits = max(s.credits, min(s.credits+n, maxStreamWindow-len(s.items)))
+	if s.pending != nil && s.credits > 0 {
+		s.queueLocked(s.pending)
+		s.pending = nil
+		s.paused = false
+	}
+	s.notifyLocked()
+}
+
+// grant adds credits and returns the stream's state
+func (s *flowStream) grant(n int) StreamState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grantLocked(n)
+	return s.stateLocked()
+}
+
+// read returns queued items, waiting up to opts.WaitMs for one, then grants
+// the credits opts asks for. Closing the stream ends the wait.
+func (s *flowStream) read(opts StreamReadOptions) StreamBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if wait := min(time.Duration(opts.WaitMs)*time.Millisecond, maxStreamWait); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+	waiting:
+		for len(s.items) == 0 && !s.done && !s.closed {
+			changed := s.changed
+			s.mu.Unlock()
+			select {
+			case <-changed:
+				s.mu.Lock()
+			case <-timer.C:
+				s.mu.Lock()
+				break waiting
+			}
+		}
+	}
+
+	n := len(s.items)
+	if opts.Max > 0 {
+		n = min(n, opts.Max)
+	}
+	batch := StreamBatch{Items: s.items[:n:n], Columns: s.columns, ColumnTypes: s.columnTypes}
+	for _, size := range s.sizes[:n] {
+		s.bytes -= size
+	}
+	s.items, s.sizes = s.items[n:], s.sizes[n:]
+	if len(s.items) == 0 {
+		s.items, s.sizes = nil, nil
+	}
+	s.delivered += int64(n)
+
+	if opts.Window > 0 {
+		s.grantLocked(opts.Window - len(s.items) - s.credits)
+	}
+	s.grantLocked(opts.Grant)
+
+	batch.StreamState = s.stateLocked()
+	batch.Done = s.done && len(s.items) == 0 && s.pending == nil
+	if batch.Done {
+		batch.Error, batch.ErrorCode = s.err, s.errCode
+	}
+	return batch
+}
+
+// stateLocked returns the stream's flow control state
+func (s *flowStream) stateLocked() StreamState {
+	return StreamState{
+		StreamID:      s.id,
+		Kind:          s.kind,
+		Credits:       s.credits,
+		Buffered:      len(s.items),
+		BufferedBytes: s.bytes,
+		Paused:        s.paused,
+		Delivered:     s.delivered,
+		Dropped:       s.dropped,
+	}
+}
+
+// close stops the producer and drops the queued items
+func (s *flowStream) close() StreamState {
+	s.mu.Lock()
+	s.closed = true
+	s.items, s.sizes, s.bytes, s.pending = nil, nil, 0, nil
+	s.notifyLocked()
+	state := s.stateLocked()
+	s.mu.Unlock()
+	s.stop()
+	return state
+}
+
+// getStream returns an open stream of the handle
+func getStream(handle int, id string) *flowStream {
+	flowStreamsLock.Lock()
+	defer flowStreamsLock.Unlock()
+	s := flowStreams[id]
+	if s == nil || s.handle != handle {
+		return nil
+	}
+	return s
+}
+
+// closeStream closes and forgets a stream of the handle
+func closeStream(handle int, id string) (StreamState, bool) {
+	flowStreamsLock.Lock()
+	s := flowStreams[id]
+	if s == nil || s.handle != handle {
+		flowStreamsLock.Unlock()
+		return StreamState{}, false
+	}
+	delete(flowStreams, id)
+	flowStreamsLock.Unlock()
+	return s.close(), true
+}
+
+// handleStreams returns the open streams of a handle
+func handleStreams(handle int) []*flowStream {
+	flowStreamsLock.Lock()
+	defer flowStreamsLock.Unlock()
+	var streams []*flowStream
+	for _, s := range flowStreams {
+		if s.handle == handle {
+			streams = append(streams, s)
+		}
+	}
+	return streams
+}
+
+// streamsUsage reports the buffers of a handle's streams
+func streamsUsage(handle int) StreamsUsage {
+	usage := StreamsUsage{Streams: []StreamState{}}
+	for _, s := range handleStreams(handle) {
+		s.mu.Lock()
+		state := s.stateLocked()
+		s.mu.Unlock()
+		usage.Open++
+		if state.Paused {
+			usage.Paused++
+		}
+		usage.Buffered += state.Buffered
+		usage.BufferedBytes += state.BufferedBytes
+		usage.Credits += state.Credits
+		usage.Streams = append(usage.Streams, state)
+	}
+	return usage
+}
+
+// closeRowStreams closes the handle's row streams before its driver session
+// is closed or replaced. Their iterators belong to that driver session, and a
+// paused stream holds one without the handle lock; closing the stream cancels
+// the iterator's context.
+func closeRowStreams(handle int) {
+	flowStreamsLock.Lock()
+	var closed []*flowStream
+	for id, s := range flowStreams {
+		if s.handle == handle && s.kind == streamRows {
+			closed = append(closed, s)
+			delete(flowStreams, id)
+		}
+	}
+	flowStreamsLock.Unlock()
+
+	for _, s := range closed {
+		s.close()
+	}
+}
+
+// discardStreams closes the streams of a closed session
+func discardStreams(handle int) {
+	flowStreamsLock.Lock()
+	var closed []*flowStream
+	for id, s := range flowStreams {
+		if s.handle == handle {
+			closed = append(closed, s)
+			delete(flowStreams, id)
+		}
+	}
+	delete(schemaStreamHandles, handle)
+	flowStreamsLock.Unlock()
+
+	for _, s := range closed {
+		s.close()
+	}
+}
+
+// estimateItemSize approximates the in-memory size of a queued item
+func estimateItemSize(item interface{}) int64 {
+	switch v := item.(type) {
+	case map[string]interface{}:
+		return estimateRowSize(v)
+	case db.SchemaChangeEvent:
+		return int64(len(v.Keyspace)+len(v.Name)) + 64
+	}
+	return 128
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStream is a stream without a producer, holding credits
+func testStream(kind string, credits int) *flowStream {
+	return &flowStream{
+		id:      newCancelToken(),
+		kind:    kind,
+		changed: make(chan struct{}),
+		credits: credits,
+		stop:    func() {},
+	}
+}
+
+// waitDone fails the test unless done is closed within a second
+func waitDone(t *testing.T, done <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s did not return", what)
+	}
+}
+
+func TestFlowStreamGrantLocked(t *testing.T) {
+	s := testStream(streamRows, 0)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.grantLocked(0)
+	s.grantLocked(-5)
+	if s.credits != 0 {
+		t.Fatalf("credits %d after granting nothing", s.credits)
+	}
+	s.grantLocked(10)
+	if s.credits != 10 {
+		t.Fatalf("credits %d, want 10", s.credits)
+	}
+
+	// Credits plus queued items stay within the window
+	for i := 0; i < 10; i++ {
+		s.queueLocked(i)
+	}
+	s.grantLocked(2 * maxStreamWindow)
+	if s.credits+len(s.items) != maxStreamWindow {
+		t.Fatalf("credits %d with %d queued, want a window of %d", s.credits, len(s.items), maxStreamWindow)
+	}
+
+	// A grant never takes credits back, even over the window
+	s.credits = maxStreamWindow
+	s.grantLocked(1)
+	if s.credits != maxStreamWindow {
+		t.Errorf("credits %d, want %d kept", s.credits, maxStreamWindow)
+	}
+}
+
+func TestFlowStreamGrantQueuesKeptSample(t *testing.T) {
+	s := testStream(streamCopyProgress, 0)
+	s.offerLatest("first")
+	s.offerLatest("second")
+	if s.pending != "second" || len(s.items) != 0 || !s.paused {
+		t.Fatalf("pending %v, %d queued, paused %v", s.pending, len(s.items), s.paused)
+	}
+
+	state := s.grant(3)
+	if state.Buffered != 1 || state.Credits != 2 || state.Paused || s.items[0] != "second" || s.pending != nil {
+		t.Errorf("after grant: %+v, items %v, pending %v", state, s.items, s.pending)
+	}
+
+	// With a credit the sample is queued at once
+	s.offerLatest("third")
+	if len(s.items) != 2 || s.credits != 1 {
+		t.Errorf("%d queued, %d credits", len(s.items), s.credits)
+	}
+}
+
+func TestFlowStreamOfferDropsWithoutCredit(t *testing.T) {
+	s := testStream(streamSchemaEvents, 2)
+	for i := 0; i < 5; i++ {
+		s.offer(i)
+	}
+	if len(s.items) != 2 || s.dropped != 3 || s.credits != 0 {
+		t.Fatalf("%d queued, %d dropped, %d credits; want 2, 3, 0", len(s.items), s.dropped, s.credits)
+	}
+
+	// Nothing is queued or counted once the stream ends
+	s.finish("", "")
+	s.grant(5)
+	s.offer(5)
+	if len(s.items) != 2 || s.dropped != 3 {
+		t.Errorf("after finish: %d queued, %d dropped", len(s.items), s.dropped)
+	}
+}
+
+func TestFlowStreamRead(t *testing.T) {
+	s := testStream(streamRows, 5)
+	for i := 0; i < 5; i++ {
+		if !s.queue(i) {
+			t.Fatalf("item %d not queued", i)
+		}
+	}
+	if s.queue(5) {
+		t.Fatal("item queued without a credit")
+	}
+
+	batch := s.read(StreamReadOptions{Max: 2, Grant: 3})
+	if len(batch.Items) != 2 || batch.Items[0] != 0 || batch.Buffered != 3 || batch.Credits != 3 || batch.Delivered != 2 || batch.Done {
+		t.Fatalf("first read: %+v", batch)
+	}
+
+	// Window tops the credits up to the window less what is still queued
+	batch = s.read(StreamReadOptions{Max: 1, Window: 10})
+	if len(batch.Items) != 1 || batch.Buffered != 2 || batch.Credits != 8 {
+		t.Fatalf("window read: %+v", batch)
+	}
+	batch = s.read(StreamReadOptions{Window: 4})
+	if len(batch.Items) != 2 || batch.Credits != 8 || batch.BufferedBytes != 0 {
+		t.Errorf("a window below the credits took some back: %+v", batch)
+	}
+
+	s.finish("boom", "QUERY_ERROR")
+	batch = s.read(StreamReadOptions{})
+	if !batch.Done || batch.Error != "boom" || batch.ErrorCode != "QUERY_ERROR" || len(batch.Items) != 0 {
+		t.Errorf("read after finish: %+v", batch)
+	}
+}
+
+func TestFlowStreamReadWaits(t *testing.T) {
+	s := testStream(streamRows, 1)
+
+	// Without items the read times out empty
+	start := time.Now()
+	if batch := s.read(StreamReadOptions{WaitMs: 20}); len(batch.Items) != 0 || batch.Done {
+		t.Fatalf("empty read: %+v", batch)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("read returned before waitMs")
+	}
+
+	// An item queued while waiting ends the wait
+	got := make(chan StreamBatch)
+	go func() { got <- s.read(StreamReadOptions{WaitMs: 10000}) }()
+	time.Sleep(10 * time.Millisecond)
+	s.queue("row")
+	select {
+	case batch := <-got:
+		if len(batch.Items) != 1 {
+			t.Errorf("woken read: %+v", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read kept waiting after an item was queued")
+	}
+}
+
+func TestFlowStreamWaitCredit(t *testing.T) {
+	s := testStream(streamRows, 0)
+
+	result := make(chan bool, 1)
+	go func() { result <- s.waitCredit(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	if s.mu.Lock(); !s.paused {
+		t.Error("producer waiting for credits is not reported paused")
+	}
+	s.mu.Unlock()
+	s.grant(1)
+	if !<-result {
+		t.Fatal("waitCredit failed after a grant")
+	}
+	if s.paused {
+		t.Error("still paused after the grant")
+	}
+
+	// Cancelling the producer's context ends the wait
+	s.credits = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { result <- s.waitCredit(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if <-result {
+		t.Error("waitCredit succeeded after its context was cancelled")
+	}
+}
+
+func TestFlowStreamCloseWakesWaiters(t *testing.T) {
+	s := testStream(streamRows, 0)
+	var stopped atomic.Bool
+	s.stop = func() { stopped.Store(true) }
+
+	credit, read := make(chan struct{}), make(chan struct{})
+	go func() {
+		if s.waitCredit(context.Background()) {
+			t.Error("waitCredit succeeded on a closed stream")
+		}
+		close(credit)
+	}()
+	go func() {
+		s.read(StreamReadOptions{WaitMs: 10000})
+		close(read)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	s.offerLatest("kept")
+	state := s.close()
+	waitDone(t, credit, "waitCredit")
+	waitDone(t, read, "read")
+	if !stopped.Load() || state.Buffered != 0 || s.pending != nil {
+		t.Errorf("stopped %v, state %+v, pending %v", stopped.Load(), state, s.pending)
+	}
+	if s.queue("late") {
+		t.Error("item queued on a closed stream")
+	}
+}
+
+func TestCloseRowStreams(t *testing.T) {
+	const handle, other = 1 << 23, 1<<23 + 1
+	var stops atomic.Int32
+	rows, events, otherRows := testStream(streamRows, 1), testStream(streamSchemaEvents, 1), testStream(streamRows, 1)
+	rows.handle, events.handle, otherRows.handle = handle, handle, other
+	for _, s := range []*flowStream{rows, events, otherRows} {
+		s.stop = func() { stops.Add(1) }
+		s.register()
+	}
+	t.Cleanup(func() {
+		discardStreams(handle)
+		discardStreams(other)
+	})
+
+	closeRowStreams(handle)
+	if getStream(handle, rows.id) != nil || !rows.closed || stops.Load() != 1 {
+		t.Errorf("row stream still open: closed %v, %d stops", rows.closed, stops.Load())
+	}
+	if getStream(handle, events.id) == nil || events.closed {
+		t.Error("schema event stream closed with the row streams")
+	}
+	if getStream(other, otherRows.id) == nil || otherRows.closed {
+		t.Error("another handle's row stream closed")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+
+	"github.com/axonops/cqlai-node/internal/datagen"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Test data generation
+//
+// GenerateTestData fills an existing table with synthetic rows. Every column
+// gets values of its type, nested collections, tuples, UDTs and vectors
+// included, following a distribution the caller may set per column. Rows are
+// derived from the seed and their row number alone, so a run can be
+// repeated exactly by passing the seed it reported. Partition key columns
+// take the partition's number and clustering columns the row's position in
+// its partition, unless given a distribution, so rowsPerPartition sets the
+// shape of the partitions.
+
+// Defaults and limits for data generation
+const (
+	defaultGenerateRows        = 1000
+	maxGenerateRows            = 10000000
+	defaultGenerateConcurrency = 8
+	maxGenerateErrors          = 100 // Failed inserts after which generation stops
+)
+
+// GenerateColumnSpec sets the values of one column
+type GenerateColumnSpec struct {
+	datagen.ColumnSpec
+	Values []json.RawMessage `json:"values"` // Values of the values distribution, as for bind variables
+}
+
+// GenerateTestDataOptions are the options of GenerateTestData
+type GenerateTestDataOptions struct {
+	Rows             int                           `json:"rows"`             // Rows to insert (default 1000, max 10000000)
+	RowsPerPartition int                           `json:"rowsPerPartition"` // Rows of each partition (default 1)
+	Columns          map[string]GenerateColumnSpec `json:"columns"`          // Per column settings; other columns are uniform
+	Seed             *int64                        `json:"seed"`             // Seed of the rows (default random, reported in the result)
+	Concurrency      int                           `json:"concurrency"`      // Inserts in flight (default 8, max 256)
+	RatePerSecond    int                           `json:"ratePerSecond"`    // Insert rate limit (default unlimited)
+	Consistency      string                        `json:"consistency"`      // Consistency of the inserts (default the session's)
+	TTLSeconds       int                           `json:"ttlSeconds"`       // TTL of the inserted rows (default none)
+	CancelToken      string                        `json:"cancelToken"`      // Token for Cancel; CancelQuery also stops generation
+}
+
+// GenerateTestDataResult is the report of GenerateTestData
+type GenerateTestDataResult struct {
+	Keyspace      string         `json:"keyspace"`
+	Table         string         `json:"table"`
+	Seed          int64          `json:"seed"` // Pass as options.seed to generate the same rows again
+	RowsRequested int            `json:"rowsRequested"`
+	RowsWritten   int64          `json:"rowsWritten"`
+	Partitions    int64          `json:"partitions"` // Partitions the requested rows are spread over
+	Errors        int64          `json:"errors"`
+	ErrorTypes    map[string]int `json:"errorTypes,omitempty"` // e.g. write_timeout, unavailable
+	FirstError    string         `json:"firstError,omitempty"`
+	Complete      bool           `json:"complete"`
+	StopReason    string         `json:"stopReason,omitempty"` // cancelled or errors
+	DurationMs    int64          `json:"durationMs"`
+	RowsPerSecond float64        `json:"rowsPerSecond"`
+	Warnings      []string       `json:"warnings"`
+}
+
+// generateColumn is a column of the insert and how its values are drawn
+type generateColumn struct {
+	*datagen.Column
+	partitionKey bool
+	clustering   bool
+}
+
+// validateGenerateOptions applies the defaults of the options
+func validateGenerateOptions(opts *GenerateTestDataOptions) error {
+	if opts.Rows < 0 || opts.Rows > maxGenerateRows {
+		return fmt.Errorf("rows must be between 1 and %d", maxGenerateRows)
+	}
+	if opts.Rows == 0 {
+		opts.Rows = defaultGenerateRows
+	}
+	if opts.RowsPerPartition < 0 {
+		return fmt.Errorf("rowsPerPartition must not be negative")
+	}
+	if opts.RowsPerPartition == 0 {
+		opts.RowsPerPartition = 1
+	}
+	if opts.Concurrency < 0 || opts.Concurrency > maxBenchConcurrency {
+		return fmt.Errorf("concurrency must be between 1 and %d, got %d", maxBenchConcurrency, opts.Concurrency)
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = defaultGenerateConcurrency
+	}
+	if opts.RatePerSecond < 0 {
+		return fmt.Errorf("ratePerSecond must not be negative")
+	}
+	if opts.TTLSeconds < 0 {
+		return fmt.Errorf("ttlSeconds must not be negative")
+	}
+	if opts.Consistency != "" {
+		if _, err := gocql.ParseConsistencyWrapper(strings.ToUpper(opts.Consistency)); err != nil {
+			return fmt.Errorf("invalid consistency level %q", opts.Consistency)
+		}
+	}
+	return nil
+}
+
+// generateSeed returns the seed of the options, or a random one small enough
+// to round-trip through a JavaScript number
+func generateSeed(opts GenerateTestDataOptions) int64 {
+	if opts.Seed != nil {
+		return *opts.Seed
+	}
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+	return int64(binary.BigEndian.Uint64(buf[:]) >> 11) // #nosec G115 - 53 bits
+}
+
+// generateColumns builds the generators of a table's columns, in the order
+// of the insert's bind variables
+func generateColumns(table *gocql.TableMetadata, bindColumns []gocql.ColumnInfo, opts GenerateTestDataOptions, seed uint64, result *GenerateTestDataResult) ([]generateColumn, error) {
+	for name := range opts.Columns {
+		if _, ok := table.Columns[name]; !ok {
+			return nil, fmt.Errorf("column %s not found in table %s.%s", name, table.Keyspace, table.Name)
+		}
+	}
+
+	columns := make([]generateColumn, len(bindColumns))
+	for i, bind := range bindColumns {
+		meta := table.Columns[bind.Name]
+		spec := opts.Columns[bind.Name]
+		gc := generateColumn{
+			partitionKey: meta.Kind == gocql.ColumnPartitionKey,
+			clustering:   meta.Kind == gocql.ColumnClusteringKey,
+		}
+		if len(spec.Values) > 0 && spec.Distribution == "" {
+			spec.Distribution = datagen.Values
+		}
+		if gc.partitionKey || gc.clustering {
+			if spec.NullRate > 0 {
+				return nil, fmt.Errorf("column %s: key columns cannot be null", bind.Name)
+			}
+			if spec.Distribution == "" {
+				spec.Distribution = datagen.Sequential
+			} else if spec.Distribution != datagen.Sequential {
+				result.Warnings = append(result.Warnings, fmt.Sprintf(
+					"key column %s is not sequential; rows that draw the same key overwrite one another", bind.Name))
+			}
+		}
+
+		if len(spec.Values) > 0 {
+			typ := formatTypeInfo(bind.TypeInfo)
+			coercer, err := db.NewCoercer(typ)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: unsupported type %s: %v", bind.Name, typ, err)
+			}
+			spec.Choices = make([]interface{}, len(spec.Values))
+			for j, raw := range spec.Values {
+				v, err := coercer.CoerceJSON(raw)
+				if err != nil {
+					return nil, fmt.Errorf("column %s: value %s: %v", bind.Name, raw, err)
+				}
+				if v == nil && (gc.partitionKey || gc.clustering) {
+					return nil, fmt.Errorf("column %s: key columns cannot be null", bind.Name)
+				}
+				spec.Choices[j] = v
+			}
+		}
+
+		col, err := datagen.NewColumn(bind.Name, bind.TypeInfo, spec.ColumnSpec, seed)
+		if err != nil {
+			return nil, err
+		}
+		gc.Column = col
+		columns[i] = gc
+	}
+	return columns, nil
+}
+
+// generateTestData inserts synthetic rows into a table
+func generateTestData(ctx context.Context, handle int, session *db.Session, keyspace, tableName string, opts GenerateTestDataOptions) (*GenerateTestDataResult, error) {
+	recordUsage(usageDataGeneration, 1)
+	start := time.Now()
+
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+	seed := generateSeed(opts)
+	rows, perPartition := int64(opts.Rows), int64(opts.RowsPerPartition)
+	result := &GenerateTestDataResult{
+		Keyspace:      keyspace,
+		Table:         tableName,
+		Seed:          seed,
+		RowsRequested: opts.Rows,
+		Partitions:    (rows + perPartition - 1) / perPartition,
+		Warnings:      []string{},
+	}
+	if perPartition > 1 && len(table.ClusteringColumns) == 0 {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"table %s.%s has no clustering columns; each partition keeps only its last row", keyspace, tableName))
+	}
+
+	names := make([]string, 0, len(table.Columns))
+	markers := make([]string, 0, len(table.Columns))
+	for _, name := range table.OrderedColumns {
+		names = append(names, quoteIdentifier(name))
+		markers = append(markers, "?")
+	}
+	query := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s)", quoteIdentifier(keyspace), quoteIdentifier(tableName),
+		strings.Join(names, ", "), strings.Join(markers, ", "))
+	if opts.TTLSeconds > 0 {
+		query += fmt.Sprintf(" USING TTL %d", opts.TTLSeconds)
+	}
+
+	// The server's bind variables carry the full types, UDT fields included
+	meta, err := session.GocqlSession().StatementMetadata(ctx, query, keyspace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare insert: %v", err)
+	}
+	rowSeed := uint64(seed) // #nosec G115 - any seed will do
+	columns, err := generateColumns(table, meta.BindColumns, opts, rowSeed, result)
+	if err != nil {
+		return nil, err
+	}
+	var consistency gocql.Consistency
+	if opts.Consistency != "" {
+		consistency, _ = gocql.ParseConsistencyWrapper(strings.ToUpper(opts.Consistency))
+	}
+
+	var pacer *benchPacer
+	if opts.RatePerSecond > 0 {
+		pacer = newBenchPacer(opts.RatePerSecond)
+	}
+	var next, written, failed atomic.Int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errorTypes := make(map[string]int)
+
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		trackHandleWorkers(handle, 1)
+		go func() {
+			defer wg.Done()
+			defer trackHandleWorkers(handle, -1)
+			values := make([]interface{}, len(columns))
+			for {
+				row := next.Add(1) - 1
+				if row >= rows || failed.Load() >= maxGenerateErrors || ctx.Err() != nil {
+					return
+				}
+				if pacer != nil && !pacer.wait(ctx) {
+					return
+				}
+
+				partition, position := row/perPartition, row%perPartition
+				rowSource := datagen.RowSource(rowSeed, row)
+				keySource := datagen.PartitionSource(rowSeed, partition)
+				for i, col := range columns {
+					var v interface{}
+					switch {
+					case col.partitionKey:
+						v = col.Value(keySource, partition)
+					case col.clustering:
+						v = col.Value(rowSource, position)
+					default:
+						v = col.Value(rowSource, row)
+					}
+					if v == nil {
+						v = gocql.UnsetValue // Leave the cell empty rather than write a tombstone
+					}
+					values[i] = v
+				}
+
+				q := session.Query(query, values...).WithContext(ctx)
+				if opts.Consistency != "" {
+					q = q.Consistency(consistency)
+				}
+				err := q.Exec()
+				switch {
+				case err == nil:
+					written.Add(1)
+				case ctx.Err() != nil:
+					return // Cancelled mid-insert; not a server error
+				default:
+					failed.Add(1)
+					mu.Lock()
+					errorTypes[benchErrorType(err)]++
+					if result.FirstError == "" {
+						result.FirstError = err.Error()
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	result.RowsWritten = written.Load()
+	result.Errors = failed.Load()
+	if len(errorTypes) > 0 {
+		result.ErrorTypes = errorTypes
+	}
+	result.Complete = result.RowsWritten == rows
+	switch {
+	case result.Complete:
+	case ctx.Err() != nil:
+		result.StopReason = "cancelled"
+	case result.Errors >= maxGenerateErrors:
+		result.StopReason = "errors"
+	}
+	result.DurationMs = elapsed.Milliseconds()
+	if elapsed > 0 {
+		result.RowsPerSecond = math.Round(float64(result.RowsWritten)/elapsed.Seconds()*10) / 10
+	}
+	return result, nil
+}
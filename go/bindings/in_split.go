@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// IN clause splitting
+//
+// A SELECT with a long IN list, such as a pasted list of IDs, makes a single
+// coordinator read every listed partition at once, which can time out or be
+// refused. When a session sets a maximum, ExecuteQuery splits a longer list
+// into queries of at most that many values, runs a few of them at a time and
+// returns their rows concatenated in list order, with split describing what
+// was done. Statements whose rows cannot simply be concatenated (ORDER BY,
+// LIMIT, GROUP BY, aggregates) run as written.
+
+// InSplitOptions configures IN clause splitting of a session
+type InSplitOptions struct {
+	MaxValues   int `json:"maxValues"`   // Split IN lists longer than this (0 = disabled)
+	Concurrency int `json:"concurrency"` // Queries of a split list run at once (default 4)
+}
+
+// Concurrency bounds of a split query
+const (
+	defaultInSplitConcurrency = 4
+	maxInSplitConcurrency     = 32
+)
+
+// validate rejects negative or out of range settings
+func (o InSplitOptions) validate() error {
+	if o.MaxValues < 0 {
+		return fmt.Errorf("maxValues must not be negative")
+	}
+	if o.Concurrency < 0 || o.Concurrency > maxInSplitConcurrency {
+		return fmt.Errorf("concurrency must be between 0 and %d", maxInSplitConcurrency)
+	}
+	return nil
+}
+
+// InSplitInfo describes a split query in its result
+type InSplitInfo struct {
+	Column    string `json:"column"`              // Column restricted by the split list
+	Values    int    `json:"values"`              // Values in the list
+	MaxValues int    `json:"maxValues"`           // Values per query
+	Queries   int    `json:"queries"`             // Queries the list was split into
+	Truncated bool   `json:"truncated,omitempty"` // Rows stop early because the result passed the result limit
+}
+
+// IN split settings per session handle
+var (
+	inSplits     = make(map[int]InSplitOptions)
+	inSplitsLock sync.Mutex
+)
+
+// setInSplit replaces the session's IN split settings; maxValues 0 disables splitting
+func setInSplit(handle int, opts InSplitOptions) {
+	inSplitsLock.Lock()
+	defer inSplitsLock.Unlock()
+	if opts.MaxValues <= 0 {
+		delete(inSplits, handle)
+		return
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = defaultInSplitConcurrency
+	}
+	inSplits[handle] = opts
+}
+
+// getInSplit returns the session's IN split settings, disabled by default
+func getInSplit(handle int) InSplitOptions {
+	inSplitsLock.Lock()
+	defer inSplitsLock.Unlock()
+	return inSplits[handle]
+}
+
+// discardInSplit forgets the session's IN split settings when the session is closed
+func discardInSplit(handle int) {
+	inSplitsLock.Lock()
+	delete(inSplits, handle)
+	inSplitsLock.Unlock()
+}
+
+// splitQuery returns the split of a query's IN list, or nil when the query
+// runs as written
+func splitQuery(query string, opts InSplitOptions) *cql.InSplit {
+	if opts.MaxValues <= 0 {
+		return nil
+	}
+	return cql.SplitInClause(query, opts.MaxValues)
+}
+
+// splitChunk is the result of one query of a split list
+type splitChunk struct {
+	columns     []string
+	columnTypes []string
+	rows        []map[string]interface{}
+	done        bool
+}
+
+// executeSplitQuery runs the queries of a split IN list and concatenates their
+// rows in list order. It returns a db.QueryResult, or the first error. Once
+// the rows read pass limit, the remaining queries are cancelled and the
+// result ends with the last query whose rows all came before that point.
+func executeSplitQuery(ctx context.Context, h int, session *db.Session, split *cql.InSplit, opts InSplitOptions, queryOpts *db.QueryOptions, limit ResultLimitOptions) (interface{}, *InSplitInfo) {
+	start := time.Now()
+	info := &InSplitInfo{Column: split.Column, Values: split.Values, MaxValues: opts.MaxValues, Queries: len(split.Statements)}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultInSplitConcurrency
+	}
+	concurrency = min(concurrency, len(split.Statements))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make([]splitChunk, len(split.Statements))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	var firstString string
+	var rowCount int
+	var byteCount int64
+
+	// add counts a chunk's row and reports whether the result is over its limit
+	add := func(row map[string]interface{}) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		rowCount++
+		if limit.MaxBytes > 0 {
+			if data, err := json.Marshal(row); err == nil {
+				byteCount += int64(len(data))
+			}
+		}
+		over := (limit.MaxRows > 0 && rowCount > limit.MaxRows) || (limit.MaxBytes > 0 && byteCount > limit.MaxBytes)
+		if over {
+			info.Truncated = true
+		}
+		return over
+	}
+	fail := func(i int, err error) {
+		mu.Lock()
+		if firstErr == nil && !info.Truncated {
+			firstErr = fmt.Errorf("query %d of %d: %v", i+1, len(split.Statements), err)
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	run := func(i int) {
+		chunk := &chunks[i]
+		switch v := session.ExecuteCQLQueryWithOptions(ctx, split.Statements[i], queryOpts).(type) {
+		case db.QueryResult:
+			chunk.columns, chunk.columnTypes = v.Headers, v.ColumnTypes
+			for _, row := range v.RawData {
+				if add(row) {
+					cancel()
+					return
+				}
+				chunk.rows = append(chunk.rows, row)
+			}
+			chunk.done = true
+		case db.StreamingQueryResult:
+			chunk.columns, chunk.columnTypes = v.ColumnNames, v.ColumnTypes
+			for {
+				row := make(map[string]interface{})
+				if !v.Iterator.MapScan(row) {
+					break
+				}
+				if add(row) {
+					v.Iterator.Close()
+					cancel()
+					return
+				}
+				chunk.rows = append(chunk.rows, row)
+			}
+			if err := v.Iterator.Close(); err != nil {
+				fail(i, err)
+				return
+			}
+			chunk.done = true
+		case string:
+			// No rows
+			mu.Lock()
+			if firstString == "" {
+				firstString = v
+			}
+			mu.Unlock()
+			chunk.done = true
+		case error:
+			fail(i, v)
+		case nil:
+			fail(i, fmt.Errorf("query returned no result"))
+		default:
+			fail(i, fmt.Errorf("unexpected result %T", v))
+		}
+	}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		trackHandleWorkers(h, 1)
+		go func() {
+			defer wg.Done()
+			defer trackHandleWorkers(h, -1)
+			for i := range work {
+				if ctx.Err() == nil {
+					run(i)
+				}
+			}
+		}()
+	}
+feed:
+	for i := range split.Statements {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr, info
+	}
+	if !info.Truncated && ctx.Err() != nil {
+		return ctx.Err(), info
+	}
+
+	result := db.QueryResult{RawData: []map[string]interface{}{}}
+	for _, chunk := range chunks {
+		if !chunk.done {
+			break
+		}
+		if result.Headers == nil && chunk.columns != nil {
+			result.Headers, result.ColumnTypes = chunk.columns, chunk.columnTypes
+		}
+		result.RawData = append(result.RawData, chunk.rows...)
+	}
+	if result.Headers == nil && firstString != "" && !info.Truncated {
+		return firstString, info
+	}
+	result.RowCount = len(result.RawData)
+	result.Duration = time.Since(start)
+	return result, info
+}
+
+// inSplitWarning explains a split result that stops early
+func inSplitWarning(info *InSplitInfo, limit ResultLimitOptions, rows int) string {
+	if info == nil || !info.Truncated {
+		return ""
+	}
+	if limit.MaxBytes > 0 && (limit.MaxRows <= 0 || rows < limit.MaxRows) {
+		return fmt.Sprintf("Result of the split IN list is larger than %d bytes; returned the first %d rows", limit.MaxBytes, rows)
+	}
+	return fmt.Sprintf("Result of the split IN list has more than %d rows; returned the first %d", limit.MaxRows, rows)
+}
@@ -0,0 +1,26 @@
+//go:build integration
+
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import "unsafe"
+
+// Go entry points to the exports for the integration suites, which cannot
+// use cgo themselves. Each returns the export's JSON response and frees it
+// the way the JavaScript side does. The calls taking a session handle are in
+// export_calls.go.
+
+// callJSON calls an export that takes a JSON or string argument
+func callJSON(fn func(*C.char) *C.char, arg string) string {
+	cArg := C.CString(arg)
+	defer C.free(unsafe.Pointer(cArg))
+	return goResponse(fn(cArg))
+}
+
+// closeSession closes a session opened by a suite
+func closeSession(handle int) string {
+	return goResponse(CloseSession(C.int(handle)))
+}
@@ -0,0 +1,55 @@
+//go:build integration
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/axonops/cqlai-node/testkit"
+)
+
+// The integration suites run the exports against a real node started by
+// testkit: go test -tags integration ./bindings. Without Docker or
+// CQLAI_TESTKIT_HOST they are skipped.
+
+func TestMain(m *testing.M) {
+	os.Exit(testkit.Run(m, testkit.Options{}))
+}
+
+// connect opens a session in keyspace with extra session options, and
+// closes it when the test ends
+func connect(t *testing.T, cluster *testkit.Cluster, keyspace string, options map[string]interface{}) int {
+	t.Helper()
+	opts := map[string]interface{}{
+		"host":     cluster.Host,
+		"port":     cluster.Port,
+		"keyspace": keyspace,
+		"username": cluster.Username,
+		"password": cluster.Password,
+	}
+	for k, v := range options {
+		opts[k] = v
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var session struct {
+		Handle int `json:"handle"`
+	}
+	testkit.Data(t, callJSON(CreateSession, string(optsJSON)), &session)
+	t.Cleanup(func() { closeSession(session.Handle) })
+	return session.Handle
+}
+
+// query runs a statement with ExecuteQuery and returns the raw response,
+// failing the test when it does not succeed
+func query(t *testing.T, handle int, cql string) string {
+	t.Helper()
+	raw := callHandle(ExecuteQuery, handle, cql)
+	testkit.Succeeded(t, raw)
+	return raw
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Loader configs
+//
+// COPY reads and writes through this process, which is fine for a few
+// million rows but not for a full table migration. GenerateLoaderConfig
+// writes the configuration for DataStax Bulk Loader (dsbulk) or the Spark
+// Cassandra Connector that connects the way the session does, so the
+// transfer can be handed to a tool built for it. Passwords are never
+// written into a config: they are read from CASSANDRA_PASSWORD instead.
+
+// Loader config targets
+const (
+	loaderDSBulk = "dsbulk"
+	loaderSpark  = "spark"
+)
+
+// loaderPasswordEnv is the environment variable generated configs read the
+// password from
+const loaderPasswordEnv = "CASSANDRA_PASSWORD"
+
+// LoaderConfig is a configuration file for an external bulk loader
+type LoaderConfig struct {
+	Target   string   `json:"target"`   // dsbulk or spark
+	Keyspace string   `json:"keyspace"` // Keyspace of the table
+	Table    string   `json:"table"`
+	FileName string   `json:"fileName"` // Suggested file name
+	Content  string   `json:"content"`  // File contents
+	Commands []string `json:"commands"` // Example invocations using the file
+	Notes    []string `json:"notes,omitempty"`
+}
+
+// loaderConnection is what a loader needs to connect like the session
+type loaderConnection struct {
+	hosts       []string
+	port        int
+	datacenter  string
+	username    string
+	consistency string
+	ssl         *config.SSLConfig
+	bundlePath  string // Astra secure connect bundle; replaces hosts and TLS
+}
+
+// validLoaderTarget reports whether target is a GenerateLoaderConfig target
+func validLoaderTarget(target string) bool {
+	return target == loaderDSBulk || target == loaderSpark
+}
+
+// generateLoaderConfig returns the target's configuration for a table
+func generateLoaderConfig(handle int, session *db.Session, keyspace, table, target string) (*LoaderConfig, error) {
+	ks, err := session.KeyspaceMetadata(keyspace)
+	if err != nil {
+		return nil, fmt.Errorf("keyspace %s not found: %v", keyspace, err)
+	}
+	tableMeta := ks.Tables[table]
+	if tableMeta == nil {
+		return nil, fmt.Errorf("table %s.%s not found", keyspace, table)
+	}
+
+	conn := loaderConnection{
+		hosts:       []string{session.Host()},
+		port:        session.Port(),
+		username:    session.Username(),
+		consistency: session.Consistency(),
+		ssl:         session.SSL(),
+		bundlePath:  astraBundlePath(handle),
+	}
+	if conn.bundlePath != "" {
+		if abs, err := filepath.Abs(conn.bundlePath); err == nil {
+			conn.bundlePath = abs
+		}
+	}
+	_ = session.Query("SELECT data_center FROM system.local").Scan(&conn.datacenter)
+
+	cfg := &LoaderConfig{Target: target, Keyspace: keyspace, Table: table}
+	if target == loaderSpark {
+		sparkConfig(cfg, conn, tableMeta.OrderedColumns)
+	} else {
+		dsbulkConfig(cfg, conn, tableMeta.OrderedColumns)
+	}
+	return cfg, nil
+}
+
+// dsbulkConfig writes a dsbulk application.conf (HOCON) usable for both
+// load and unload
+func dsbulkConfig(cfg *LoaderConfig, conn loaderConnection, columns []string) {
+	var b strings.Builder
+	line := func(key string, value interface{}) {
+		fmt.Fprintf(&b, "%s = %s\n", key, hoconValue(value))
+	}
+
+	fmt.Fprintf(&b, "# dsbulk configuration for %s.%s\n", cfg.Keyspace, cfg.Table)
+	b.WriteString("dsbulk {\n")
+	line("  schema.keyspace", cfg.Keyspace)
+	line("  schema.table", cfg.Table)
+	line("  schema.mapping", loaderMapping(columns))
+	line("  connector.name", "csv")
+	line("  connector.csv.header", true)
+	b.WriteString("}\n\n")
+
+	b.WriteString("datastax-java-driver {\n")
+	if conn.bundlePath != "" {
+		line("  basic.cloud.secure-connect-bundle", "file:"+filepath.ToSlash(conn.bundlePath))
+	} else {
+		contactPoints := make([]string, len(conn.hosts))
+		for i, h := range conn.hosts {
+			contactPoints[i] = fmt.Sprintf("%s:%d", h, conn.port)
+		}
+		line("  basic.contact-points", contactPoints)
+		if conn.datacenter != "" {
+			line("  basic.load-balancing-policy.local-datacenter", conn.datacenter)
+		}
+	}
+	line("  basic.request.consistency", conn.consistency)
+	if conn.username != "" {
+		line("  advanced.auth-provider.class", "PlainTextAuthProvider")
+		line("  advanced.auth-provider.username", conn.username)
+		fmt.Fprintf(&b, "  advanced.auth-provider.password = ${?%s}\n", loaderPasswordEnv)
+	}
+	if conn.ssl != nil && conn.bundlePath == "" {
+		line("  advanced.ssl-engine-factory.class", "DefaultSslEngineFactory")
+		line("  advanced.ssl-engine-factory.hostname-validation", conn.ssl.HostVerification && !conn.ssl.InsecureSkipVerify)
+		if conn.ssl.CAPath != "" {
+			line("  advanced.ssl-engine-factory.truststore-path", keystorePath(conn.ssl.CAPath, "truststore"))
+			b.WriteString("  advanced.ssl-engine-factory.truststore-password = ${?TRUSTSTORE_PASSWORD}\n")
+		}
+		if conn.ssl.CertPath != "" && conn.ssl.KeyPath != "" {
+			line("  advanced.ssl-engine-factory.keystore-path", keystorePath(conn.ssl.CertPath, "keystore"))
+			b.WriteString("  advanced.ssl-engine-factory.keystore-password = ${?KEYSTORE_PASSWORD}\n")
+		}
+	}
+	b.WriteString("}\n")
+
+	cfg.FileName = "dsbulk.conf"
+	cfg.Content = b.String()
+	cfg.Commands = []string{
+		"dsbulk unload -f dsbulk.conf -url ./" + cfg.Table,
+		"dsbulk load -f dsbulk.conf -url ./" + cfg.Table,
+	}
+	if conn.username != "" {
+		cfg.Notes = append(cfg.Notes, fmt.Sprintf("Set %s to the password of %s before running dsbulk", loaderPasswordEnv, conn.username))
+	}
+	cfg.Notes = append(cfg.Notes, sslNotes(conn)...)
+}
+
+// sparkConfig writes Spark Cassandra Connector properties for
+// spark-submit --properties-file, with a PySpark read of the table
+func sparkConfig(cfg *LoaderConfig, conn loaderConnection, columns []string) {
+	var b strings.Builder
+	line := func(key string, value string) {
+		fmt.Fprintf(&b, "%s %s\n", key, value)
+	}
+
+	fmt.Fprintf(&b, "# Spark Cassandra Connector properties for %s.%s\n", cfg.Keyspace, cfg.Table)
+	if conn.bundlePath != "" {
+		line("spark.files", conn.bundlePath)
+		line("spark.cassandra.connection.config.cloud.path", filepath.Base(conn.bundlePath))
+	} else {
+		line("spark.cassandra.connection.host", strings.Join(conn.hosts, ","))
+		line("spark.cassandra.connection.port", strconv.Itoa(conn.port))
+		if conn.datacenter != "" {
+			line("spark.cassandra.connection.localDC", conn.datacenter)
+		}
+	}
+	line("spark.cassandra.input.consistency.level", conn.consistency)
+	line("spark.cassandra.output.consistency.level", conn.consistency)
+	if conn.username != "" {
+		line("spark.cassandra.auth.username", conn.username)
+		fmt.Fprintf(&b, "# spark.cassandra.auth.password is passed with --conf from $%s\n", loaderPasswordEnv)
+	}
+	if conn.ssl != nil && conn.bundlePath == "" {
+		line("spark.cassandra.connection.ssl.enabled", "true")
+		if conn.ssl.CAPath != "" {
+			line("spark.cassandra.connection.ssl.trustStore.path", keystorePath(conn.ssl.CAPath, "truststore"))
+			line("spark.cassandra.connection.ssl.trustStore.type", "JKS")
+		}
+		if conn.ssl.CertPath != "" && conn.ssl.KeyPath != "" {
+			line("spark.cassandra.connection.ssl.clientAuth.enabled", "true")
+			line("spark.cassandra.connection.ssl.keyStore.path", keystorePath(conn.ssl.CertPath, "keystore"))
+			line("spark.cassandra.connection.ssl.keyStore.type", "JKS")
+		}
+	}
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = strconv.Quote(c)
+	}
+	b.WriteString("\n# PySpark:\n")
+	fmt.Fprintf(&b, "# df = spark.read.format(\"org.apache.spark.sql.cassandra\").options(keyspace=%s, table=%s).load()\n",
+		strconv.Quote(cfg.Keyspace), strconv.Quote(cfg.Table))
+	fmt.Fprintf(&b, "# df.select(%s).write.format(\"org.apache.spark.sql.cassandra\").options(keyspace=%s, table=%s).mode(\"append\").save()\n",
+		strings.Join(quoted, ", "), strconv.Quote(cfg.Keyspace), strconv.Quote(cfg.Table))
+
+	submit := "spark-submit --properties-file spark-cassandra.properties --packages com.datastax.spark:spark-cassandra-connector_2.12:3.5.1"
+	if conn.username != "" {
+		submit += fmt.Sprintf(" --conf spark.cassandra.auth.password=\"$%s\"", loaderPasswordEnv)
+	}
+	if conn.ssl != nil && conn.bundlePath == "" {
+		if conn.ssl.CAPath != "" {
+			submit += ` --conf spark.cassandra.connection.ssl.trustStore.password="$TRUSTSTORE_PASSWORD"`
+		}
+		if conn.ssl.CertPath != "" && conn.ssl.KeyPath != "" {
+			submit += ` --conf spark.cassandra.connection.ssl.keyStore.password="$KEYSTORE_PASSWORD"`
+		}
+	}
+	cfg.FileName = "spark-cassandra.properties"
+	cfg.Content = b.String()
+	cfg.Commands = []string{submit + " job.py"}
+	if conn.username != "" {
+		cfg.Notes = append(cfg.Notes, fmt.Sprintf("Set %s to the password of %s before running spark-submit", loaderPasswordEnv, conn.username))
+	}
+	cfg.Notes = append(cfg.Notes, sslNotes(conn)...)
+}
+
+// loaderMapping returns a dsbulk mapping of same-named fields to columns
+func loaderMapping(columns []string) string {
+	mapped := make([]string, len(columns))
+	for i, c := range columns {
+		q := quoteIdentifier(c)
+		mapped[i] = q + " = " + q
+	}
+	return strings.Join(mapped, ", ")
+}
+
+// keystorePath returns the Java keystore a PEM file is to be converted to
+func keystorePath(pemPath, kind string) string {
+	return strings.TrimSuffix(pemPath, filepath.Ext(pemPath)) + "." + kind + ".jks"
+}
+
+// sslNotes explains converting the session's PEM files to the Java
+// keystores the loaders read
+func sslNotes(conn loaderConnection) []string {
+	if conn.ssl == nil || conn.bundlePath != "" {
+		return nil
+	}
+	var notes []string
+	if conn.ssl.CAPath != "" {
+		notes = append(notes, fmt.Sprintf("Java loaders need a JKS truststore: keytool -importcert -noprompt -alias cassandra-ca -file %s -keystore %s (set TRUSTSTORE_PASSWORD to its password)",
+			conn.ssl.CAPath, keystorePath(conn.ssl.CAPath, "truststore")))
+	}
+	if conn.ssl.CertPath != "" && conn.ssl.KeyPath != "" {
+		p12 := strings.TrimSuffix(conn.ssl.CertPath, filepath.Ext(conn.ssl.CertPath)) + ".p12"
+		notes = append(notes, fmt.Sprintf("Client certificates need a JKS keystore: openssl pkcs12 -export -in %s -inkey %s -out %s, then keytool -importkeystore -srckeystore %s -srcstoretype PKCS12 -destkeystore %s (set KEYSTORE_PASSWORD to its password)",
+			conn.ssl.CertPath, conn.ssl.KeyPath, p12, p12, keystorePath(conn.ssl.CertPath, "keystore")))
+	}
+	return notes
+}
+
+// hoconValue formats a value for a HOCON file
+func hoconValue(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return strconv.Quote(fmt.Sprint(v))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strconv"
 	"strings"
 	"sync"
 
@@ -20,12 +21,55 @@ type HostInfo struct {
 
 // ColumnInfo represents a column in a table
 type ColumnInfo struct {
-	Name       string `json:"name"`
-	CQLType    string `json:"cql_type"`
-	Kind       string `json:"kind"` // partition_key, clustering, regular, static
-	Position   int    `json:"position"`
-	IsReversed bool   `json:"is_reversed"`
-	IsStatic   bool   `json:"is_static"`
+	Name       string      `json:"name"`
+	CQLType    string      `json:"cql_type"`
+	Type       *ColumnType `json:"type,omitempty"` // Structured form of cql_type; omitted if it cannot be parsed
+	Kind       string      `json:"kind"`           // partition_key, clustering, regular, static
+	Position   int         `json:"position"`
+	IsReversed bool        `json:"is_reversed"`
+	IsStatic   bool        `json:"is_static"`
+}
+
+// ColumnType is one node of a parsed CQL type, e.g. map<frozen<address>, list<int>>
+// is a map node with a frozen udt node and a list node as parameters
+type ColumnType struct {
+	BaseType    string        `json:"base_type"` // Lower case: text, int, list, set, map, tuple, vector, udt, ...
+	CQLType     string        `json:"cql_type"`  // This node as a type string
+	Frozen      bool          `json:"frozen"`
+	Parameters  []*ColumnType `json:"parameters,omitempty"`   // Element types: list/set/vector element, map key and value, tuple fields
+	Dimension   int           `json:"dimension,omitempty"`    // Vector length
+	UDTKeyspace string        `json:"udt_keyspace,omitempty"` // Keyspace of a udt, the column's keyspace if unqualified
+	UDTName     string        `json:"udt_name,omitempty"`
+}
+
+// columnTypeTree parses a CQL type string into its structured form, or
+// returns nil if the type is not understood (e.g. a custom Java type)
+func columnTypeTree(cqlType, keyspace string) *ColumnType {
+	parsed, err := db.ParseCQLType(cqlType)
+	if err != nil {
+		return nil
+	}
+	var convert func(t *db.CQLTypeInfo) *ColumnType
+	convert = func(t *db.CQLTypeInfo) *ColumnType {
+		node := &ColumnType{
+			BaseType:  t.BaseType,
+			CQLType:   t.String(),
+			Frozen:    t.Frozen,
+			Dimension: t.Dimension,
+		}
+		if t.BaseType == "udt" {
+			node.UDTKeyspace = t.Keyspace
+			if node.UDTKeyspace == "" {
+				node.UDTKeyspace = keyspace
+			}
+			node.UDTName = strings.Trim(t.UDTName, `"`)
+		}
+		for _, p := range t.Parameters {
+			node.Parameters = append(node.Parameters, convert(p))
+		}
+		return node
+	}
+	return convert(parsed)
 }
 
 // KeyInfo represents a key column (for primary_key, partition_key, clustering_key arrays)
@@ -71,6 +115,15 @@ type UserTypeInfo struct {
 	FieldTypes []string `json:"field_types"`
 }
 
+// UDTDefinitionInfo is a single user-defined type as returned by GetUDTDefinition
+type UDTDefinitionInfo struct {
+	Keyspace    string   `json:"keyspace"`
+	Name        string   `json:"name"`
+	FieldNames  []string `json:"field_names"`
+	FieldTypes  []string `json:"field_types"`
+	NestedTypes []string `json:"nested_types,omitempty"` // Other UDTs used by the fields, as keyspace.name
+}
+
 // FunctionInfo represents a user-defined function
 type FunctionInfo struct {
 	Name              string   `json:"name"`
@@ -100,6 +153,8 @@ type ViewInfo struct {
 	PartitionKey  []KeyInfo    `json:"partition_key"`
 	ClusteringKey []KeyInfo    `json:"clustering_key"`
 	Columns       []ColumnInfo `json:"columns"`
+
+	statement string // CREATE statement, set for views read from CQL by PlanSchemaMigration
 }
 
 // KeyspaceInfo represents a keyspace with all its contents
@@ -139,6 +194,14 @@ type ClusterMetadata struct {
 	Keyspaces   []KeyspaceInfo       `json:"keyspaces"`
 	Roles       []RoleMetadata       `json:"roles"`
 	Permissions []PermissionMetadata `json:"permissions"`
+
+	// False on clusters without system_virtual_schema (before 4.0); virtual
+	// keyspaces are then absent because they do not exist, not because they failed to load
+	VirtualTablesSupported bool `json:"virtual_tables_supported"`
+
+	// The session's pinned schema, when it reads a snapshot; diverged is
+	// set once the live schema changed
+	SchemaPin *db.SchemaPinStatus `json:"schema_pin,omitempty"`
 }
 
 // indexKey is used as a map key for index lookup
@@ -162,6 +225,10 @@ func GetClusterMetadataFromSession(session *db.Session) (*ClusterMetadata, error
 	}
 	metadata.ClusterName = clusterName
 	metadata.Partitioner = partitioner
+	metadata.VirtualTablesSupported = session.SupportsVirtualTables()
+	if session.SchemaPinned() {
+		metadata.SchemaPin = session.SchemaPinStatus()
+	}
 
 	// Run hosts, keyspaces, and roles/permissions in parallel
 	var wg sync.WaitGroup
@@ -299,8 +366,11 @@ func getKeyspacesUsingMetadataAPI(session *db.Session, metadata *ClusterMetadata
 	var wg sync.WaitGroup
 	var ksErr error
 
+	// Virtual schema queries are only sent to clusters that have it
+	fetchVirtual := metadata.VirtualTablesSupported
+
 	// Fetch regular keyspace names
-	wg.Add(6)
+	wg.Add(3)
 	go func() {
 		defer wg.Done()
 		var names []string
@@ -314,25 +384,7 @@ func getKeyspacesUsingMetadataAPI(session *db.Session, metadata *ClusterMetadata
 			return
 		}
 		mu.Lock()
-		keyspaceNames = append(keyspaceNames, names...)
-		mu.Unlock()
-	}()
-
-	// Fetch virtual keyspace names
-	go func() {
-		defer wg.Done()
-		var names []string
-		iter := session.Query("SELECT keyspace_name FROM system_virtual_schema.keyspaces").Iter()
-		var name string
-		for iter.Scan(&name) {
-			names = append(names, name)
-			mu.Lock()
-			virtualKeyspaces[name] = true
-			mu.Unlock()
-		}
-		iter.Close()
-		mu.Lock()
-		keyspaceNames = append(keyspaceNames, names...)
+		keyspaceNames = append(keyspaceNames, session.ListedKeyspaces(names)...)
 		mu.Unlock()
 	}()
 
@@ -377,50 +429,73 @@ func getKeyspacesUsingMetadataAPI(session *db.Session, metadata *ClusterMetadata
 		iter.Close()
 	}()
 
-	// Fetch virtual tables
-	go func() {
-		defer wg.Done()
-		iter := session.Query("SELECT keyspace_name, table_name, comment FROM system_virtual_schema.tables").Iter()
-		var vtKs, vtTable, vtComment string
-		for iter.Scan(&vtKs, &vtTable, &vtComment) {
-			mu.Lock()
-			virtualTables[vtKs] = append(virtualTables[vtKs], TableInfo{
-				Name:            vtTable,
-				Virtual:         true,
-				IsCQLCompatible: false,
-				PrimaryKey:      []KeyInfo{},
-				PartitionKey:    []KeyInfo{},
-				ClusteringKey:   []KeyInfo{},
-				Columns:         []ColumnInfo{},
-				Indexes:         []IndexInfo{},
-				Triggers:        []TriggerInfo{},
-				Views:           []string{},
-				Options:         make(map[string]interface{}),
-			})
-			mu.Unlock()
-		}
-		iter.Close()
-	}()
-
-	// Fetch virtual columns
-	go func() {
-		defer wg.Done()
-		iter := session.Query("SELECT keyspace_name, table_name, column_name, type, kind, position FROM system_virtual_schema.columns").Iter()
-		var vcKs, vcTable, vcName, vcType, vcKind string
-		var vcPos int
-		for iter.Scan(&vcKs, &vcTable, &vcName, &vcType, &vcKind, &vcPos) {
-			key := indexKey{keyspace: vcKs, table: vcTable}
+	if fetchVirtual {
+		wg.Add(3)
+
+		// Fetch virtual keyspace names
+		go func() {
+			defer wg.Done()
+			var names []string
+			iter := session.Query("SELECT keyspace_name FROM system_virtual_schema.keyspaces").Iter()
+			var name string
+			for iter.Scan(&name) {
+				names = append(names, name)
+				mu.Lock()
+				virtualKeyspaces[name] = true
+				mu.Unlock()
+			}
+			iter.Close()
 			mu.Lock()
-			virtualColumns[key] = append(virtualColumns[key], ColumnInfo{
-				Name:     vcName,
-				CQLType:  vcType,
-				Kind:     vcKind,
-				Position: vcPos,
-			})
+			keyspaceNames = append(keyspaceNames, names...)
 			mu.Unlock()
-		}
-		iter.Close()
-	}()
+		}()
+
+		// Fetch virtual tables
+		go func() {
+			defer wg.Done()
+			iter := session.Query("SELECT keyspace_name, table_name, comment FROM system_virtual_schema.tables").Iter()
+			var vtKs, vtTable, vtComment string
+			for iter.Scan(&vtKs, &vtTable, &vtComment) {
+				mu.Lock()
+				virtualTables[vtKs] = append(virtualTables[vtKs], TableInfo{
+					Name:            vtTable,
+					Virtual:         true,
+					IsCQLCompatible: false,
+					PrimaryKey:      []KeyInfo{},
+					PartitionKey:    []KeyInfo{},
+					ClusteringKey:   []KeyInfo{},
+					Columns:         []ColumnInfo{},
+					Indexes:         []IndexInfo{},
+					Triggers:        []TriggerInfo{},
+					Views:           []string{},
+					Options:         make(map[string]interface{}),
+				})
+				mu.Unlock()
+			}
+			iter.Close()
+		}()
+
+		// Fetch virtual columns
+		go func() {
+			defer wg.Done()
+			iter := session.Query("SELECT keyspace_name, table_name, column_name, type, kind, position FROM system_virtual_schema.columns").Iter()
+			var vcKs, vcTable, vcName, vcType, vcKind string
+			var vcPos int
+			for iter.Scan(&vcKs, &vcTable, &vcName, &vcType, &vcKind, &vcPos) {
+				key := indexKey{keyspace: vcKs, table: vcTable}
+				mu.Lock()
+				virtualColumns[key] = append(virtualColumns[key], ColumnInfo{
+					Name:     vcName,
+					CQLType:  vcType,
+					Type:     columnTypeTree(vcType, vcKs),
+					Kind:     vcKind,
+					Position: vcPos,
+				})
+				mu.Unlock()
+			}
+			iter.Close()
+		}()
+	}
 
 	wg.Wait()
 
@@ -637,9 +712,11 @@ func convertTableMetadata(keyspace string, tableMeta *gocql.TableMetadata, isVir
 			}
 		}
 
+		cqlType := formatTypeInfo(col.Type)
 		colInfo := ColumnInfo{
 			Name:     col.Name,
-			CQLType:  formatTypeInfo(col.Type),
+			CQLType:  cqlType,
+			Type:     columnTypeTree(cqlType, keyspace),
 			Kind:     kind,
 			Position: position,
 		}
@@ -674,6 +751,42 @@ func convertUserTypeMetadata(udtMeta *gocql.UserTypeMetadata) UserTypeInfo {
 	}
 }
 
+// convertUDTDefinition converts a registry definition to UDTDefinitionInfo
+func convertUDTDefinition(def *db.UDTDefinition) UDTDefinitionInfo {
+	info := UDTDefinitionInfo{
+		Keyspace:   def.Keyspace,
+		Name:       def.Name,
+		FieldNames: make([]string, len(def.Fields)),
+		FieldTypes: make([]string, len(def.Fields)),
+	}
+	seen := make(map[string]bool)
+	var collect func(t *db.CQLTypeInfo)
+	collect = func(t *db.CQLTypeInfo) {
+		if t == nil {
+			return
+		}
+		if t.BaseType == "udt" {
+			ks := t.Keyspace
+			if ks == "" {
+				ks = def.Keyspace
+			}
+			if name := ks + "." + t.UDTName; !seen[name] {
+				seen[name] = true
+				info.NestedTypes = append(info.NestedTypes, name)
+			}
+		}
+		for _, p := range t.Parameters {
+			collect(p)
+		}
+	}
+	for i, f := range def.Fields {
+		info.FieldNames[i] = f.Name
+		info.FieldTypes[i] = f.TypeStr
+		collect(f.TypeInfo)
+	}
+	return info
+}
+
 // convertFunctionMetadata converts gocql.FunctionMetadata to our FunctionInfo format
 func convertFunctionMetadata(funcMeta *gocql.FunctionMetadata) FunctionInfo {
 	argTypes := make([]string, len(funcMeta.ArgumentTypes))
@@ -763,6 +876,10 @@ func formatTypeInfo(typeInfo gocql.TypeInfo) string {
 			}
 			return udtType.Name
 		}
+	case gocql.TypeCustom:
+		if vecType, ok := typeInfo.(gocql.VectorType); ok {
+			return "vector<" + formatTypeInfo(vecType.SubType) + ", " + strconv.Itoa(vecType.Dimensions) + ">"
+		}
 	}
 
 	return typeNameFromType(baseType)
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Row writes with explicit null semantics.
+//
+// A column can be written three ways, and they are not equivalent:
+//
+//	{"a": 1}      the value is written
+//	{"a": null}   the cell is deleted, which writes a tombstone
+//	{}            the column is unset and any existing value is kept
+//
+// InsertRows sends each row as INSERT ... JSON ... DEFAULT UNSET (or DEFAULT
+// NULL when missing columns should be cleared), so the server converts values
+// using the column types and absent keys never create tombstones.
+
+// defaultNullWarnThreshold is the number of null cells in one InsertRows call
+// above which a warning is returned
+const defaultNullWarnThreshold = 1000
+
+// InsertRowsOptions controls how nulls and missing columns are written
+type InsertRowsOptions struct {
+	Missing       string `json:"missing"`             // "unset" (default): absent keys keep existing values; "null": absent keys are deleted
+	Nulls         string `json:"nulls"`               // "write" (default): JSON null deletes the cell; "unset": JSON null is treated as absent
+	WarnNullCells *int   `json:"warnNullCells"`       // Warn when more null cells than this are written (default 1000, -1 disables)
+	StopOnError   bool   `json:"stopOnError"`         // Stop at the first failed row
+	TTL           int    `json:"ttl,omitempty"`       // USING TTL seconds
+	Timestamp     int64  `json:"timestamp,omitempty"` // USING TIMESTAMP microseconds
+}
+
+// InsertRowError is a row that could not be written
+type InsertRowError struct {
+	Index int    `json:"index"` // Position in the rows array
+	Error string `json:"error"`
+}
+
+// InsertRowsResult reports what was written
+type InsertRowsResult struct {
+	Inserted      int              `json:"inserted"`
+	Failed        int              `json:"failed"`
+	NullCells     int              `json:"nullCells"`     // Cells deleted by an explicit null (tombstones)
+	UnsetNulls    int              `json:"unsetNulls"`    // Explicit nulls left unset because nulls is "unset"
+	MissingAction string           `json:"missingAction"` // What happened to absent keys: "unset" or "null"
+	Errors        []InsertRowError `json:"errors,omitempty"`
+	Warnings      []string         `json:"warnings,omitempty"`
+	DurationMs    int64            `json:"durationMs"`
+}
+
+// insertRows writes JSON objects into a table, one INSERT ... JSON per row
+func insertRows(session *db.Session, keyspace, table string, rows []json.RawMessage, opts InsertRowsOptions) (*InsertRowsResult, error) {
+	start := time.Now()
+
+	switch opts.Missing {
+	case "":
+		opts.Missing = "unset"
+	case "unset", "null":
+	default:
+		return nil, fmt.Errorf("missing must be \"unset\" or \"null\"")
+	}
+	switch opts.Nulls {
+	case "", "write", "unset":
+	default:
+		return nil, fmt.Errorf("nulls must be \"write\" or \"unset\"")
+	}
+	if _, err := session.GetTableMetadata(keyspace, table); err != nil {
+		return nil, err
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO %s.%s JSON ? DEFAULT %s", quoteIdentifier(keyspace), quoteIdentifier(table), map[string]string{"unset": "UNSET", "null": "NULL"}[opts.Missing])
+	switch {
+	case opts.TTL > 0 && opts.Timestamp != 0:
+		stmt += fmt.Sprintf(" USING TTL %d AND TIMESTAMP %d", opts.TTL, opts.Timestamp)
+	case opts.TTL > 0:
+		stmt += fmt.Sprintf(" USING TTL %d", opts.TTL)
+	case opts.Timestamp != 0:
+		stmt += fmt.Sprintf(" USING TIMESTAMP %d", opts.Timestamp)
+	}
+
+	result := &InsertRowsResult{MissingAction: opts.Missing}
+	for i, raw := range rows {
+		// Decode with UseNumber so numbers reach the server unchanged
+		var row map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&row); err != nil || row == nil {
+			result.Failed++
+			result.Errors = append(result.Errors, InsertRowError{Index: i, Error: "row is not a JSON object"})
+			if opts.StopOnError {
+				break
+			}
+			continue
+		}
+
+		// INSERT JSON reads keys as CQL identifiers, so case-sensitive
+		// column names must carry their own double quotes
+		doc := make(map[string]interface{}, len(row))
+		nulls := 0
+		for col, v := range row {
+			if v == nil {
+				if opts.Nulls == "unset" {
+					result.UnsetNulls++
+					continue
+				}
+				nulls++
+			}
+			if !strings.HasPrefix(col, `"`) {
+				col = quoteIdentifier(col)
+			}
+			doc[col] = v
+		}
+
+		encoded, _ := json.Marshal(doc)
+		if err := session.Query(stmt, string(encoded)).Exec(); err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, InsertRowError{Index: i, Error: err.Error()})
+			if opts.StopOnError {
+				break
+			}
+			continue
+		}
+		result.Inserted++
+		result.NullCells += nulls
+	}
+
+	threshold := defaultNullWarnThreshold
+	if opts.WarnNullCells != nil {
+		threshold = *opts.WarnNullCells
+	}
+	if threshold >= 0 && result.NullCells > threshold {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"%d null values were written as tombstones; omit the keys or use nulls: \"unset\" to leave those columns unchanged", result.NullCells))
+	}
+	if opts.Missing == "null" {
+		result.Warnings = append(result.Warnings, "missing: \"null\" deletes every column absent from a row, writing a tombstone for each")
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
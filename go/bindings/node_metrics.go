@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// nodeMetricsTables are the system_views tables collected from every node.
+// Virtual tables are node-local, so each one is read from each host.
+var nodeMetricsTables = []string{
+	"caches",
+	"thread_pools",
+	"tombstones_per_read",
+	"local_read_latency",
+	"coordinator_read_latency",
+}
+
+// NodeMetrics holds the virtual table rows read from one node
+type NodeMetrics struct {
+	Host       string                              `json:"host"` // address:port
+	HostID     string                              `json:"hostId,omitempty"`
+	Datacenter string                              `json:"datacenter,omitempty"`
+	Rack       string                              `json:"rack,omitempty"`
+	Reachable  bool                                `json:"reachable"`
+	Tables     map[string][]map[string]interface{} `json:"tables,omitempty"` // Rows keyed by system_views table name
+	Errors     map[string]string                   `json:"errors,omitempty"` // Per-table errors (e.g. table missing on this version)
+	Error      string                              `json:"error,omitempty"`  // Why the node could not be queried
+	DurationMs int64                               `json:"durationMs"`
+}
+
+// NodeMetricsResult is the merged metrics of all nodes, keyed by host
+type NodeMetricsResult struct {
+	CollectedAt string                  `json:"collectedAt"`
+	Tables      []string                `json:"tables"`
+	Nodes       map[string]*NodeMetrics `json:"nodes"` // Keyed by host (address:port)
+	Reachable   int                     `json:"reachable"`
+	Unreachable int                     `json:"unreachable"`
+}
+
+// collectNodeMetrics reads nodeMetricsTables from every node the driver is
+// connected to, in parallel. Nodes listed in system.peers without a driver
+// connection (e.g. because initial host lookup is disabled) are reported as
+// unreachable rather than silently skipped.
+func collectNodeMetrics(handle int, session *db.Session) (*NodeMetricsResult, error) {
+	if !session.SupportsVirtualTables() {
+		return nil, fmt.Errorf("node metrics require virtual tables (Cassandra 4.0 or later); connected to %s", session.CassandraVersion())
+	}
+
+	result := &NodeMetricsResult{
+		CollectedAt: time.Now().UTC().Format(time.RFC3339),
+		Tables:      nodeMetricsTables,
+		Nodes:       make(map[string]*NodeMetrics),
+	}
+
+	hosts := session.GetHosts()
+	connected := make(map[string]bool, len(hosts))
+	nodes := make([]*NodeMetrics, len(hosts))
+
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		connected[host.HostID()] = true
+		nodes[i] = &NodeMetrics{
+			Host:       host.ConnectAddressAndPort(),
+			HostID:     host.HostID(),
+			Datacenter: host.DataCenter(),
+			Rack:       host.Rack(),
+		}
+		if !host.IsUp() {
+			nodes[i].Error = "node is down"
+			continue
+		}
+
+		wg.Add(1)
+		trackHandleWorkers(handle, 1)
+		go func(node *NodeMetrics, hostID string) {
+			defer wg.Done()
+			defer trackHandleWorkers(handle, -1)
+			collectHostMetrics(session, hostID, node)
+		}(nodes[i], host.HostID())
+	}
+	wg.Wait()
+
+	for _, node := range nodes {
+		result.Nodes[node.Host] = node
+	}
+
+	// Report cluster members the driver has no connection to
+	for _, peer := range unconnectedPeers(session, connected) {
+		result.Nodes[peer.Host] = peer
+	}
+
+	for _, node := range result.Nodes {
+		if node.Reachable {
+			result.Reachable++
+		} else {
+			result.Unreachable++
+		}
+	}
+
+	return result, nil
+}
+
+// collectHostMetrics reads each metrics table from a single host
+func collectHostMetrics(session *db.Session, hostID string, node *NodeMetrics) {
+	start := time.Now()
+	defer func() { node.DurationMs = time.Since(start).Milliseconds() }()
+
+	node.Tables = make(map[string][]map[string]interface{})
+	for _, table := range nodeMetricsTables {
+		iter := session.Query("SELECT * FROM system_views." + table).SetHostID(hostID).Iter()
+		rows := make([]map[string]interface{}, 0)
+		for {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			rows = append(rows, row)
+		}
+		if err := iter.Close(); err != nil {
+			if node.Errors == nil {
+				node.Errors = make(map[string]string)
+			}
+			node.Errors[table] = err.Error()
+			continue
+		}
+		node.Tables[table] = rows
+		node.Reachable = true
+	}
+
+	if !node.Reachable {
+		node.Error = "no metrics table could be read from this node"
+	}
+}
+
+// unconnectedPeers lists nodes from system.peers that are not in the driver's host pool
+func unconnectedPeers(session *db.Session, connected map[string]bool) []*NodeMetrics {
+	iter := session.Query("SELECT peer, host_id, data_center, rack FROM system.peers").Iter()
+
+	var peers []*NodeMetrics
+	var peer string
+	var hostID gocql.UUID
+	var dc, rack string
+	for iter.Scan(&peer, &hostID, &dc, &rack) {
+		if connected[hostID.String()] {
+			continue
+		}
+		peers = append(peers, &NodeMetrics{
+			Host:       peer,
+			HostID:     hostID.String(),
+			Datacenter: dc,
+			Rack:       rack,
+			Error:      "no driver connection to this node",
+		})
+	}
+	_ = iter.Close()
+
+	return peers
+}
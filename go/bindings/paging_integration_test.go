@@ -0,0 +1,98 @@
+//go:build integration
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/axonops/cqlai-node/testkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPagination(t *testing.T) {
+	cluster := testkit.Require(t)
+	stmts := []string{"CREATE TABLE events (pk int, ck int, v text, PRIMARY KEY (pk, ck))"}
+	for ck := 0; ck < 5; ck++ {
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO events (pk, ck, v) VALUES (1, %d, 'v%d')", ck, ck))
+	}
+	ks := cluster.Keyspace(t, stmts...)
+	handle := connect(t, cluster, ks, map[string]interface{}{"pageSize": 2})
+
+	raw := callHandle(ExecuteQueryPaged, handle, "SELECT ck, v FROM events WHERE pk = 1")
+	testkit.Golden(t, "paging_first_page", raw, testkit.Shape(), testkit.Drop("execution"))
+
+	var page PagedQueryResult
+	testkit.Data(t, raw, &page)
+	assert.Equal(t, []string{"ck", "v"}, page.Columns)
+	assert.Equal(t, ks, page.Keyspace)
+	assert.Equal(t, "events", page.Table)
+
+	var cks []int
+	pages := 1
+	for {
+		require.LessOrEqual(t, page.RowCount, 2)
+		for _, row := range page.Rows {
+			cks = append(cks, int(row["ck"].(float64)))
+		}
+		if !page.HasMore {
+			assert.True(t, page.AllCompleted)
+			assert.Empty(t, page.QueryID)
+			break
+		}
+		require.NotEmpty(t, page.QueryID)
+		require.Less(t, pages, 10, "paging did not end")
+
+		queryID := page.QueryID
+		page = PagedQueryResult{}
+		testkit.Data(t, callHandle(FetchNextPage, handle, queryID), &page)
+		pages++
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, cks)
+	assert.GreaterOrEqual(t, pages, 3)
+}
+
+func TestPaginationUnknownQuery(t *testing.T) {
+	cluster := testkit.Require(t)
+	handle := connect(t, cluster, cluster.Keyspace(t), nil)
+
+	resp := testkit.Decode(t, callHandle(FetchNextPage, handle, "no-such-query"))
+	assert.False(t, resp.Success)
+	assert.Equal(t, "QUERY_NOT_FOUND", resp.Code)
+}
+
+func TestResultLimitSwitchKeepsPaging(t *testing.T) {
+	cluster := testkit.Require(t)
+	stmts := []string{"CREATE TABLE events (pk int, ck int, PRIMARY KEY (pk, ck))"}
+	for ck := 0; ck < 20; ck++ {
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO events (pk, ck) VALUES (1, %d)", ck))
+	}
+	ks := cluster.Keyspace(t, stmts...)
+	handle := connect(t, cluster, ks, map[string]interface{}{"pageSize": 5})
+
+	// The result switches to paging inside the driver's first page; the pages
+	// after it are fetched once ExecuteQueryWithOptions has returned
+	var first QueryResult
+	testkit.Data(t, callHandleOptions(ExecuteQueryWithOptions, handle, "SELECT ck FROM events WHERE pk = 1", `{"resultLimit": {"maxRows": 2}}`), &first)
+	require.True(t, first.ModeSwitched)
+	require.NotEmpty(t, first.QueryID)
+
+	cks := make([]int, 0, 20)
+	for _, row := range first.Rows {
+		cks = append(cks, int(row["ck"].(float64)))
+	}
+	queryID := first.QueryID
+	for pages := 0; pages < 2; pages++ {
+		var page PagedQueryResult
+		testkit.Data(t, callHandle(FetchNextPage, handle, queryID), &page)
+		require.Equal(t, 5, page.RowCount)
+		require.True(t, page.HasMore)
+		for _, row := range page.Rows {
+			cks = append(cks, int(row["ck"].(float64)))
+		}
+		queryID = page.QueryID
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, cks)
+	testkit.Succeeded(t, callHandle(CancelPagedQuery, handle, queryID))
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Brute-force partition search.
+//
+// FindPartitions walks the Murmur3 token ring in fixed ranges and evaluates a
+// predicate on each row in Go, instead of issuing one unbounded
+// ALLOW FILTERING query that times out on the coordinator. Every range query
+// is token-restricted and paged, reads are rate limited, and the scan stops at
+// a row, time or result budget, so the cost is bounded and visible up front.
+
+// Defaults and limits for FindPartitions
+const (
+	defaultFindRowsPerSecond  = 2000
+	defaultFindMaxRowsScanned = 1000000
+	defaultFindMaxDuration    = 5 * time.Minute
+	defaultFindPageSize       = 500
+	defaultFindMaxResults     = 100
+	findTokenRanges           = 256
+)
+
+// PartitionCondition is one client-side test on a column value
+type PartitionCondition struct {
+	Column string      `json:"column"`
+	Op     string      `json:"op"` // =, !=, <, <=, >, >=, contains, matches, isNull, isNotNull
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// PartitionPredicate selects rows and bounds the cost of the scan
+type PartitionPredicate struct {
+	Conditions     []PartitionCondition `json:"conditions"`
+	Match          string               `json:"match"`          // "all" (default) or "any"
+	RowsPerSecond  int                  `json:"rowsPerSecond"`  // Read rate limit (default 2000)
+	MaxRowsScanned int64                `json:"maxRowsScanned"` // Stop after reading this many rows (default 1,000,000)
+	MaxDurationMs  int64                `json:"maxDurationMs"`  // Stop after this long (default 5 minutes)
+	PageSize       int                  `json:"pageSize"`       // Rows per page (default 500)
+	StartToken     *int64               `json:"startToken"`     // Resume from a previous result's nextToken
+	CancelToken    string               `json:"cancelToken"`    // Token for Cancel; CancelQuery also stops the scan
+}
+
+// PartitionMatch is a partition with at least one matching row
+type PartitionMatch struct {
+	Key          map[string]interface{} `json:"key"` // Partition key columns
+	Token        int64                  `json:"token"`
+	MatchingRows int                    `json:"matchingRows"`
+}
+
+// FindPartitionsResult reports the partitions found and what the scan cost
+type FindPartitionsResult struct {
+	Partitions    []PartitionMatch `json:"partitions"`
+	RowsScanned   int64            `json:"rowsScanned"`
+	RangesScanned int              `json:"rangesScanned"`
+	RangesTotal   int              `json:"rangesTotal"`
+	Complete      bool             `json:"complete"`             // The whole ring was scanned
+	StopReason    string           `json:"stopReason,omitempty"` // maxResults, maxRowsScanned, maxDuration or cancelled
+	NextToken     *int64           `json:"nextToken,omitempty"`  // Pass as startToken to continue an incomplete scan
+	EstimatedRows int64            `json:"estimatedRows,omitempty"`
+	DurationMs    int64            `json:"durationMs"`
+	Warnings      []string         `json:"warnings"`
+}
+
+// compiledCondition is a PartitionCondition with its value prepared for comparison
+type compiledCondition struct {
+	PartitionCondition
+	number  float64
+	numeric bool
+	text    string
+	pattern *regexp.Regexp
+}
+
+// compilePredicate validates the conditions against the table's columns
+func compilePredicate(pred PartitionPredicate, table *gocql.TableMetadata) ([]compiledCondition, error) {
+	if len(pred.Conditions) == 0 {
+		return nil, fmt.Errorf("at least one condition is required")
+	}
+	if pred.Match != "" && pred.Match != "all" && pred.Match != "any" {
+		return nil, fmt.Errorf("match must be \"all\" or \"any\"")
+	}
+
+	compiled := make([]compiledCondition, 0, len(pred.Conditions))
+	for _, cond := range pred.Conditions {
+		if _, ok := table.Columns[cond.Column]; !ok {
+			return nil, fmt.Errorf("column %s not found in %s.%s", cond.Column, table.Keyspace, table.Name)
+		}
+		c := compiledCondition{PartitionCondition: cond}
+		switch cond.Op {
+		case "isNull", "isNotNull":
+		case "=", "!=", "<", "<=", ">", ">=", "contains":
+			if cond.Value == nil {
+				return nil, fmt.Errorf("condition on %s: %s needs a value", cond.Column, cond.Op)
+			}
+			c.text = fmt.Sprint(cond.Value)
+			if n, ok := cond.Value.(float64); ok {
+				c.number, c.numeric = n, true
+			}
+		case "matches":
+			pattern, ok := cond.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("condition on %s: matches needs a regular expression string", cond.Column)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("condition on %s: %v", cond.Column, err)
+			}
+			c.pattern = re
+		default:
+			return nil, fmt.Errorf("condition on %s: unsupported op %q", cond.Column, cond.Op)
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// rowMatches applies the predicate to a scanned row
+func rowMatches(row map[string]interface{}, conds []compiledCondition, matchAny bool) bool {
+	for _, c := range conds {
+		if c.matches(row[c.Column]) == matchAny {
+			return matchAny
+		}
+	}
+	return !matchAny
+}
+
+// matches tests a single column value
+func (c compiledCondition) matches(value interface{}) bool {
+	null := isNullValue(value)
+	switch c.Op {
+	case "isNull":
+		return null
+	case "isNotNull":
+		return !null
+	}
+	if null {
+		return false
+	}
+
+	text := columnText(value)
+	switch c.Op {
+	case "contains":
+		return strings.Contains(text, c.text)
+	case "matches":
+		return c.pattern.MatchString(text)
+	}
+
+	var cmp int
+	if n, ok := columnNumber(value); ok && c.numeric {
+		cmp = compareFloat(n, c.number)
+	} else if t, ok := value.(time.Time); ok {
+		parsed, err := time.Parse(time.RFC3339Nano, c.text)
+		if err != nil {
+			return false
+		}
+		cmp = t.Compare(parsed)
+	} else {
+		cmp = strings.Compare(text, c.text)
+	}
+
+	switch c.Op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// isNullValue reports whether a scanned value represents CQL null. MapScan
+// returns nil slices and maps for null collections and nil pointers for
+// null decimals and varints.
+func isNullValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return v.IsNil()
+	}
+	return false
+}
+
+// columnText renders a value for text comparisons
+func columnText(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// columnNumber converts numeric column values
+func columnNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, true
+	case fmt.Stringer:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// estimateTableRows sums system.size_estimates for the table. The estimate only
+// covers ranges the coordinator holds, so it is scaled by the ring share scanned.
+func estimateTableRows(session *db.Session, keyspace, table string) int64 {
+	est, err := readSizeEstimates(session, keyspace, table)
+	if err != nil {
+		return 0
+	}
+	return est.ringPartitions()
+}
+
+// findPartitions scans the table's token ranges for partitions with a matching row
+func findPartitions(ctx context.Context, session *db.Session, keyspace, tableName string, pred PartitionPredicate, maxResults int) (*FindPartitionsResult, error) {
+	start := time.Now()
+
+	table, err := session.GetTableMetadata(keyspace, tableName)
+	if err != nil {
+		return nil, err
+	}
+	var partitioner string
+	_ = session.Query("SELECT partitioner FROM system.local").Scan(&partitioner)
+	if !strings.HasSuffix(partitioner, "Murmur3Partitioner") {
+		return nil, fmt.Errorf("token range scans require the Murmur3 partitioner, cluster uses %s", partitioner)
+	}
+	conds, err := compilePredicate(pred, table)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxResults <= 0 {
+		maxResults = defaultFindMaxResults
+	}
+	if pred.RowsPerSecond <= 0 {
+		pred.RowsPerSecond = defaultFindRowsPerSecond
+	}
+	if pred.MaxRowsScanned <= 0 {
+		pred.MaxRowsScanned = defaultFindMaxRowsScanned
+	}
+	maxDuration := defaultFindMaxDuration
+	if pred.MaxDurationMs > 0 {
+		maxDuration = time.Duration(pred.MaxDurationMs) * time.Millisecond
+	}
+	if pred.PageSize <= 0 {
+		pred.PageSize = defaultFindPageSize
+	}
+
+	result := &FindPartitionsResult{
+		Partitions:  []PartitionMatch{},
+		RangesTotal: findTokenRanges,
+		Warnings:    []string{},
+	}
+
+	result.EstimatedRows = estimateTableRows(session, keyspace, tableName)
+	if result.EstimatedRows > 0 {
+		seconds := result.EstimatedRows / int64(pred.RowsPerSecond)
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"full scan of about %d partitions; at %d rows/s this takes at least %s", result.EstimatedRows, pred.RowsPerSecond, time.Duration(seconds)*time.Second))
+	}
+	if result.EstimatedRows > pred.MaxRowsScanned {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"maxRowsScanned (%d) is below the estimated size; the scan will stop early and return nextToken", pred.MaxRowsScanned))
+	}
+
+	// Select the partition key, its token and the predicate columns
+	partitionKey := make([]string, len(table.PartitionKey))
+	for i, col := range table.PartitionKey {
+		partitionKey[i] = quoteIdentifier(col.Name)
+	}
+	pkList := strings.Join(partitionKey, ", ")
+	selectCols := append([]string{}, partitionKey...)
+	selectCols = append(selectCols, "token("+pkList+") AS scan_token")
+	seen := make(map[string]bool)
+	for _, col := range table.PartitionKey {
+		seen[col.Name] = true
+	}
+	for _, c := range conds {
+		if !seen[c.Column] {
+			seen[c.Column] = true
+			selectCols = append(selectCols, quoteIdentifier(c.Column))
+		}
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s.%s WHERE token(%s) > ? AND token(%s) <= ?",
+		strings.Join(selectCols, ", "), quoteIdentifier(keyspace), quoteIdentifier(tableName), pkList, pkList)
+
+	// Split the ring into equal ranges; the first range also covers the minimum token
+	width := new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(findTokenRanges))
+	rangeStart := func(i int) int64 {
+		if i == 0 {
+			return math.MinInt64
+		}
+		v := new(big.Int).Mul(width, big.NewInt(int64(i)))
+		return new(big.Int).Add(v, big.NewInt(math.MinInt64)).Int64()
+	}
+
+	matches := make(map[int64]int) // token -> index in result.Partitions
+	deadline := start.Add(maxDuration)
+	matchAny := pred.Match == "any"
+
+	stop := func(reason string, token int64) {
+		result.StopReason = reason
+		next := token
+		result.NextToken = &next
+	}
+
+scan:
+	for i := 0; i < findTokenRanges; i++ {
+		lower, upper := rangeStart(i), int64(math.MaxInt64)
+		if i+1 < findTokenRanges {
+			upper = rangeStart(i + 1)
+		}
+		if pred.StartToken != nil {
+			if upper <= *pred.StartToken {
+				result.RangesScanned++
+				continue
+			}
+			if lower < *pred.StartToken {
+				lower = *pred.StartToken
+			}
+		}
+
+		iter := session.Query(query, lower, upper).WithContext(ctx).PageSize(pred.PageSize).Iter()
+		lastToken := lower
+		for {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			result.RowsScanned++
+			token, _ := row["scan_token"].(int64)
+
+			if rowMatches(row, conds, matchAny) {
+				if idx, ok := matches[token]; ok {
+					result.Partitions[idx].MatchingRows++
+				} else if len(result.Partitions) < maxResults {
+					key := make(map[string]interface{}, len(table.PartitionKey))
+					for _, col := range table.PartitionKey {
+						key[col.Name] = row[col.Name]
+					}
+					matches[token] = len(result.Partitions)
+					result.Partitions = append(result.Partitions, PartitionMatch{Key: key, Token: token, MatchingRows: 1})
+				} else {
+					// Resume before this partition so it is not lost
+					_ = iter.Close()
+					stop("maxResults", lastToken)
+					break scan
+				}
+			}
+			lastToken = token
+
+			switch {
+			case ctx.Err() != nil:
+				_ = iter.Close()
+				stop("cancelled", lastToken)
+				break scan
+			case result.RowsScanned >= pred.MaxRowsScanned:
+				_ = iter.Close()
+				stop("maxRowsScanned", lastToken)
+				break scan
+			case time.Now().After(deadline):
+				_ = iter.Close()
+				stop("maxDuration", lastToken)
+				break scan
+			}
+
+			// Rate limit: sleep until the scan is back under rowsPerSecond
+			if result.RowsScanned%100 == 0 {
+				expected := time.Duration(float64(result.RowsScanned) / float64(pred.RowsPerSecond) * float64(time.Second))
+				if ahead := expected - time.Since(start); ahead > 0 {
+					time.Sleep(ahead)
+				}
+			}
+		}
+		if err := iter.Close(); err != nil {
+			if ctx.Err() != nil {
+				stop("cancelled", lastToken)
+				break
+			}
+			return nil, fmt.Errorf("scan of token range %d failed: %v", i, err)
+		}
+		result.RangesScanned++
+	}
+
+	result.Complete = result.StopReason == ""
+	result.DurationMs = time.Since(start).Milliseconds()
+	return result, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Payload size checks
+//
+// A request larger than the server accepts fails late and obscurely: a write
+// over the maximum mutation size is refused by the replicas, and a request
+// over the native transport's maximum frame size makes the server close the
+// connection, which the driver reports as a lost connection. Statements are
+// measured before they are sent, against limits read from
+// system_views.settings (Cassandra 4.0+) or the server version's defaults,
+// and refused with PAYLOAD_TOO_LARGE and the index of the statement that is
+// too large. Batches and COPY FROM use the limits to size their batches.
+//
+// Sizes are estimates of the serialized statement: its text plus the
+// encoded size of its bound values.
+
+// PayloadLimits are the request size limits of a cluster
+type PayloadLimits struct {
+	MaxMutationBytes int64  `json:"maxMutationBytes"` // max_mutation_size, by default half of commitlog_segment_size
+	MaxFrameBytes    int64  `json:"maxFrameBytes"`    // native_transport_max_frame_size
+	BatchFailBytes   int64  `json:"batchFailBytes"`   // batch_size_fail_threshold, for batches spanning partitions
+	Source           string `json:"source"`           // settings (read from system_views.settings) or defaults
+}
+
+// PayloadTooLarge is returned with a statement refused by the payload size check
+type PayloadTooLarge struct {
+	StatementIndex int    `json:"statementIndex"` // 0-based index in the batch or script; 0 for a single statement
+	Bytes          int64  `json:"bytes"`          // Estimated size
+	Limit          int64  `json:"limit"`
+	LimitName      string `json:"limitName"` // max_mutation_size or native_transport_max_frame_size
+	Batch          bool   `json:"batch,omitempty"`
+}
+
+// message describes a refused statement
+func (p *PayloadTooLarge) message() string {
+	if p.Batch {
+		return fmt.Sprintf("Batch is larger than the server's %s of %d bytes from statement %d on (about %d bytes up to it); send fewer statements per batch",
+			p.LimitName, p.Limit, p.StatementIndex+1, p.Bytes)
+	}
+	return fmt.Sprintf("Statement %d is about %d bytes, larger than the server's %s of %d bytes",
+		p.StatementIndex+1, p.Bytes, p.LimitName, p.Limit)
+}
+
+// payloadCheckFloor is the size below which a statement is not checked: no
+// server limit is this low, and the first check of a session costs a query
+const payloadCheckFloor = 512 * 1024
+
+// Default limits, as in cassandra.yaml
+const (
+	defaultMaxMutationBytes = 16 * 1024 * 1024  // Half of the 32 MiB commit log segment
+	defaultMaxFrameBytes    = 16 * 1024 * 1024  // Cassandra 4.0+
+	legacyMaxFrameBytes     = 256 * 1024 * 1024 // Before Cassandra 4.0
+	defaultBatchFailBytes   = 50 * 1024
+)
+
+// Payload limits per session handle, read once
+var (
+	payloadLimits     = make(map[int]PayloadLimits)
+	payloadLimitsLock sync.Mutex
+)
+
+// payloadLimitsFor returns the session's payload limits, reading them on first use
+func payloadLimitsFor(handle int, session *db.Session) PayloadLimits {
+	payloadLimitsLock.Lock()
+	limits, ok := payloadLimits[handle]
+	payloadLimitsLock.Unlock()
+	if ok {
+		return limits
+	}
+
+	limits = readPayloadLimits(session)
+	payloadLimitsLock.Lock()
+	payloadLimits[handle] = limits
+	payloadLimitsLock.Unlock()
+	return limits
+}
+
+// discardPayloadLimits forgets the session's payload limits when the session is closed
+func discardPayloadLimits(handle int) {
+	payloadLimitsLock.Lock()
+	delete(payloadLimits, handle)
+	payloadLimitsLock.Unlock()
+}
+
+// readPayloadLimits reads the limits from system_views.settings, keeping the
+// defaults for settings that are missing or unset
+func readPayloadLimits(session *db.Session) PayloadLimits {
+	limits := PayloadLimits{
+		MaxMutationBytes: defaultMaxMutationBytes,
+		MaxFrameBytes:    defaultMaxFrameBytes,
+		BatchFailBytes:   defaultBatchFailBytes,
+		Source:           "defaults",
+	}
+	if !session.IsVersion4OrHigher() {
+		limits.MaxFrameBytes = legacyMaxFrameBytes
+	}
+	if !session.SupportsVirtualTables() {
+		return limits
+	}
+
+	settings := make(map[string]string)
+	iter := session.Query("SELECT name, value FROM system_views.settings").Iter()
+	var name, value string
+	for iter.Scan(&name, &value) {
+		settings[name] = value
+	}
+	if err := iter.Close(); err != nil {
+		return limits
+	}
+	limits.Source = "settings"
+
+	// Cassandra 4.1 renamed the settings and added units to their values
+	setting := func(name, legacyName string, legacyUnit int64) (int64, bool) {
+		if n, ok := parseDataSize(settings[name], 1); ok {
+			return n, true
+		}
+		return parseDataSize(settings[legacyName], legacyUnit)
+	}
+	if n, ok := setting("commitlog_segment_size", "commitlog_segment_size_in_mb", 1024*1024); ok {
+		limits.MaxMutationBytes = n / 2
+	}
+	if n, ok := setting("max_mutation_size", "max_mutation_size_in_kb", 1024); ok {
+		limits.MaxMutationBytes = n
+	}
+	if n, ok := setting("native_transport_max_frame_size", "native_transport_max_frame_size_in_mb", 1024*1024); ok {
+		limits.MaxFrameBytes = n
+	}
+	if n, ok := setting("batch_size_fail_threshold", "batch_size_fail_threshold_in_kb", 1024); ok {
+		limits.BatchFailBytes = n
+	}
+	return limits
+}
+
+// dataSizeUnits are the units of data size settings, longest suffix first
+var dataSizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GiB", 1024 * 1024 * 1024}, {"MiB", 1024 * 1024}, {"KiB", 1024}, {"B", 1},
+}
+
+// parseDataSize parses a data size setting: "32MiB", or a plain number of
+// unit bytes. Unset values ("", "null") are not sizes.
+func parseDataSize(value string, unit int64) (int64, bool) {
+	value = strings.TrimSpace(value)
+	for _, u := range dataSizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n * unit, true
+}
+
+// check measures a statement against the limits that apply to it. Writes are
+// held to the mutation size, every request to the frame size.
+func (l PayloadLimits) check(index int, size int64, write bool) *PayloadTooLarge {
+	if write && size > l.MaxMutationBytes {
+		return &PayloadTooLarge{StatementIndex: index, Bytes: size, Limit: l.MaxMutationBytes, LimitName: "max_mutation_size"}
+	}
+	if size > l.MaxFrameBytes {
+		return &PayloadTooLarge{StatementIndex: index, Bytes: size, Limit: l.MaxFrameBytes, LimitName: "native_transport_max_frame_size"}
+	}
+	return nil
+}
+
+// checkStatementPayload checks a statement about to be sent on its own, as
+// the statement at index of a script. It returns nil when it may be sent.
+func checkStatementPayload(handle int, session *db.Session, index int, query string, values []interface{}) *PayloadTooLarge {
+	size := statementSize(query, values)
+	if size < payloadCheckFloor {
+		return nil
+	}
+	switch cql.DescribeStatement(query).Kind {
+	case "INSERT", "UPDATE", "DELETE", "BATCH":
+		return payloadLimitsFor(handle, session).check(index, size, true)
+	}
+	return payloadLimitsFor(handle, session).check(index, size, false)
+}
+
+// statementSize estimates the serialized size of a statement and its values
+func statementSize(query string, values []interface{}) int64 {
+	size := int64(len(query))
+	for _, v := range values {
+		size += 4 + valueSize(v)
+	}
+	return size
+}
+
+// valueSize estimates the encoded size of a bound value
+func valueSize(v interface{}) int64 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(x))
+	case []byte:
+		return int64(len(x))
+	case gocql.UUID:
+		return 16
+	case time.Time, time.Duration, int, int64, uint64, float64:
+		return 8
+	case int32, uint32, float32:
+		return 4
+	case int16, uint16:
+		return 2
+	case bool, int8, uint8:
+		return 1
+	case fmt.Stringer:
+		return int64(len(x.String())) // varint, decimal, inet
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		size := int64(4)
+		for i := 0; i < rv.Len(); i++ {
+			size += 4 + valueSize(rv.Index(i).Interface())
+		}
+		return size
+	case reflect.Map:
+		size := int64(4)
+		iter := rv.MapRange()
+		for iter.Next() {
+			size += 8 + valueSize(iter.Key().Interface()) + valueSize(iter.Value().Interface())
+		}
+		return size
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return 0
+		}
+		return valueSize(rv.Elem().Interface())
+	}
+	return int64(len(fmt.Sprint(v)))
+}
+
+// payloadStatementResult is the result of a script statement refused by the
+// payload size check
+func payloadStatementResult(index int, identifier string, tooLarge *PayloadTooLarge) StatementResult {
+	return StatementResult{
+		Index:           index,
+		Identifier:      identifier,
+		Error:           tooLarge.message(),
+		ErrorCode:       "PAYLOAD_TOO_LARGE",
+		PayloadTooLarge: tooLarge,
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Prepared statements
+//
+// PrepareStatement prepares a statement with bind markers on the server and
+// returns a statement ID with the statement's bind variables. ExecutePrepared
+// runs it with a JSON array of values (or an object of values by variable
+// name), each converted to its variable's type, so values never have to be
+// interpolated into CQL text. The driver keeps the server-side prepared ID
+// and re-prepares transparently if a node forgets it.
+
+const (
+	maxPreparedStatements = 1000             // Per session
+	prepareTimeout        = 30 * time.Second // Preparing a statement
+)
+
+// BindVariable is a bind marker of a prepared statement
+type BindVariable struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// PreparedStatementInfo describes a prepared statement
+type PreparedStatementInfo struct {
+	StatementID         string         `json:"statementId"`
+	Query               string         `json:"query"`
+	Keyspace            string         `json:"keyspace,omitempty"`
+	Table               string         `json:"table,omitempty"`
+	Variables           []BindVariable `json:"variables"`
+	PartitionKeyIndexes []int          `json:"partitionKeyIndexes,omitempty"` // Variables that make up the partition key
+	Columns             []string       `json:"columns,omitempty"`             // Result columns of a SELECT
+}
+
+// PreparedResult is the result of executing a prepared statement
+type PreparedResult struct {
+	StatementID    string                   `json:"statementId"`
+	Columns        []string                 `json:"columns,omitempty"`
+	ColumnTypes    []string                 `json:"columnTypes,omitempty"`
+	Rows           []map[string]interface{} `json:"rows,omitempty"`
+	RowCount       int                      `json:"rowCount"`
+	Duration       string                   `json:"duration"`
+	TraceSessionID string                   `json:"traceSessionId,omitempty"`
+}
+
+// preparedStatement is a statement prepared on a session
+type preparedStatement struct {
+	info     PreparedStatementInfo
+	handle   int
+	coercers []*db.Coercer // Per variable; nil when the type is unknown
+}
+
+// Prepared statements by statement ID
+var (
+	preparedStatements     = make(map[string]*preparedStatement)
+	preparedStatementsLock sync.Mutex
+	nextPreparedID         int
+)
+
+// prepareStatement prepares a statement and registers it on the handle
+func prepareStatement(handle int, session *db.Session, query string) (*PreparedStatementInfo, error) {
+	if count := preparedStatementCount(handle); count >= maxPreparedStatements {
+		return nil, fmt.Errorf("session has %d prepared statements; close some with ClosePrepared first", count)
+	}
+
+	stmt, err := newPreparedStatement(session, query)
+	if err != nil {
+		return nil, err
+	}
+	stmt.handle = handle
+
+	preparedStatementsLock.Lock()
+	nextPreparedID++
+	stmt.info.StatementID = strconv.Itoa(handle) + ":prepared:" + strconv.Itoa(nextPreparedID)
+	preparedStatements[stmt.info.StatementID] = stmt
+	preparedStatementsLock.Unlock()
+
+	info := stmt.info
+	return &info, nil
+}
+
+// newPreparedStatement prepares a statement on the server and reads its bind
+// variables, without registering it
+func newPreparedStatement(session *db.Session, query string) (*preparedStatement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), prepareTimeout)
+	defer cancel()
+	meta, err := session.GocqlSession().StatementMetadata(ctx, query, session.Keyspace())
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &preparedStatement{
+		info: PreparedStatementInfo{
+			Query:               query,
+			Keyspace:            meta.Keyspace,
+			Table:               meta.Table,
+			Variables:           make([]BindVariable, len(meta.BindColumns)),
+			PartitionKeyIndexes: meta.PKBindColumnIndexes,
+		},
+		coercers: make([]*db.Coercer, len(meta.BindColumns)),
+	}
+	for i, col := range meta.BindColumns {
+		typ := formatTypeInfo(col.TypeInfo)
+		stmt.info.Variables[i] = BindVariable{Name: col.Name, Type: typ}
+		if c, err := db.NewCoercer(typ); err == nil {
+			stmt.coercers[i] = c
+		}
+	}
+	for _, col := range meta.ResultColumns {
+		stmt.info.Columns = append(stmt.info.Columns, col.Name)
+	}
+	return stmt, nil
+}
+
+// getPrepared returns a statement prepared on the handle, or nil
+func getPrepared(handle int, id string) *preparedStatement {
+	preparedStatementsLock.Lock()
+	defer preparedStatementsLock.Unlock()
+	stmt := preparedStatements[id]
+	if stmt == nil || stmt.handle != handle {
+		return nil
+	}
+	return stmt
+}
+
+// closePrepared forgets a prepared statement, reporting whether it existed
+func closePrepared(handle int, id string) bool {
+	preparedStatementsLock.Lock()
+	defer preparedStatementsLock.Unlock()
+	stmt := preparedStatements[id]
+	if stmt == nil || stmt.handle != handle {
+		return false
+	}
+	delete(preparedStatements, id)
+	return true
+}
+
+// preparedStatementCount returns the number of statements prepared on the handle
+func preparedStatementCount(handle int) int {
+	preparedStatementsLock.Lock()
+	defer preparedStatementsLock.Unlock()
+	count := 0
+	for _, stmt := range preparedStatements {
+		if stmt.handle == handle {
+			count++
+		}
+	}
+	return count
+}
+
+// discardPreparedStatements forgets the session's prepared statements
+func discardPreparedStatements(handle int) {
+	preparedStatementsLock.Lock()
+	defer preparedStatementsLock.Unlock()
+	for id, stmt := range preparedStatements {
+		if stmt.handle == handle {
+			delete(preparedStatements, id)
+		}
+	}
+}
+
+// bindValues converts the JSON values of an execution: an array in variable
+// order, or an object keyed by variable name
+func (p *preparedStatement) bindValues(raw string) ([]interface{}, error) {
+	vars := p.info.Variables
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		raw = "[]"
+	}
+
+	var values []json.RawMessage
+	if strings.HasPrefix(raw, "{") {
+		var named map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(raw), &named); err != nil {
+			return nil, err
+		}
+		values = make([]json.RawMessage, len(vars))
+		for i, v := range vars {
+			value, ok := named[v.Name]
+			if !ok {
+				return nil, fmt.Errorf("no value for bind variable %s", v.Name)
+			}
+			values[i] = value
+		}
+		for name := range named {
+			if !p.hasVariable(name) {
+				return nil, fmt.Errorf("statement has no bind variable %s", name)
+			}
+		}
+	} else if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+	if len(values) != len(vars) {
+		return nil, fmt.Errorf("statement has %d bind variables, got %d values", len(vars), len(values))
+	}
+
+	bound := make([]interface{}, len(values))
+	for i, value := range values {
+		c := p.coercers[i]
+		if c == nil {
+			// Unknown type: let the driver marshal the plain JSON value
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err != nil {
+				return nil, fmt.Errorf("%s: %v", vars[i].Name, err)
+			}
+			bound[i] = v
+			continue
+		}
+		v, err := c.CoerceJSON(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s (%s): %v", vars[i].Name, vars[i].Type, err)
+		}
+		bound[i] = v
+	}
+	return bound, nil
+}
+
+// hasVariable reports whether the statement has a bind variable named name
+func (p *preparedStatement) hasVariable(name string) bool {
+	for _, v := range p.info.Variables {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// executePrepared runs a prepared statement with bound values. Rows are
+// read until the result is exhausted or ctx is cancelled.
+func executePrepared(ctx context.Context, session *db.Session, stmt *preparedStatement, values []interface{}) (*PreparedResult, error) {
+	start := time.Now()
+	iter := session.Traced(session.Query(stmt.info.Query, values...)).WithContext(ctx).Iter()
+
+	result := &PreparedResult{StatementID: stmt.info.StatementID}
+	columns := iter.Columns()
+	if len(columns) > 0 {
+		result.Columns = make([]string, len(columns))
+		result.ColumnTypes = make([]string, len(columns))
+		for i, col := range columns {
+			result.Columns[i] = col.Name
+			result.ColumnTypes[i] = formatTypeInfo(col.TypeInfo)
+		}
+		result.Rows = make([]map[string]interface{}, 0)
+		for ctx.Err() == nil {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			result.Rows = append(result.Rows, row)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result.RowCount = len(result.Rows)
+	result.Duration = time.Since(start).String()
+	result.TraceSessionID = getTraceIDIfEnabled(session)
+	return result, nil
+}
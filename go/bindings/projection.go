@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Column projections
+//
+// A projection flattens a value nested in a user type or collection column
+// into a column of its own, named by its path (address.city,
+// phones[0].number, attrs['color']). Paths that only select user type fields
+// are selected by the server (SELECT address.city AS "address.city"), so
+// only the field crosses the wire; other paths select the whole column and
+// are extracted from each row in Go.
+
+// ColumnProjection describes a projected column of a result
+type ColumnProjection struct {
+	Path       string `json:"path"`       // Column name in the rows
+	Type       string `json:"type"`       // CQL type of the projected value
+	ServerSide bool   `json:"serverSide"` // Selected by the server rather than extracted in Go
+}
+
+// columnProjection is a planned projection
+type columnProjection struct {
+	ColumnProjection
+	path *db.ColumnPath
+}
+
+// planProjections checks projection paths against a table and decides where
+// each one is evaluated
+func planProjections(session *db.Session, table *gocql.TableMetadata, paths []string) ([]*columnProjection, error) {
+	projections := make([]*columnProjection, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, raw := range paths {
+		path, err := db.ParseColumnPath(raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(path.Steps) == 0 {
+			return nil, fmt.Errorf("projection %s selects a whole column; list it in columns instead", raw)
+		}
+		if seen[path.Path] {
+			continue
+		}
+		seen[path.Path] = true
+
+		col, ok := table.Columns[path.Column]
+		if !ok {
+			return nil, fmt.Errorf("projection %s: column %s not found in %s.%s", raw, path.Column, table.Keyspace, table.Name)
+		}
+		colType, err := db.ParseCQLType(col.Validator)
+		if err != nil {
+			return nil, fmt.Errorf("projection %s: %v", raw, err)
+		}
+		typ, err := path.ResolveType(colType, table.Keyspace, session.GetUDTDefinition)
+		if err != nil {
+			return nil, fmt.Errorf("projection %v", err)
+		}
+		projections = append(projections, &columnProjection{
+			ColumnProjection: ColumnProjection{Path: path.Path, Type: typ.String(), ServerSide: path.FieldsOnly()},
+			path:             path,
+		})
+	}
+	return projections, nil
+}
+
+// selector returns the select clause of a server-side projection
+func (p *columnProjection) selector() string {
+	parts := []string{quoteIdentifier(p.path.Column)}
+	for _, step := range p.path.Steps {
+		parts = append(parts, quoteIdentifier(step.Field))
+	}
+	return strings.Join(parts, ".") + " AS " + quoteIdentifier(p.Path)
+}
+
+// extract adds a client-side projection to a row. Top-level tuples are
+// already split into col[0], col[1], ... by the driver.
+func (p *columnProjection) extract(row map[string]interface{}) {
+	value, ok := row[p.path.Column]
+	steps := p.path
+	if !ok && p.path.Steps[0].Kind == db.StepIndex {
+		value = row[gocql.TupleColumnName(p.path.Column, p.path.Steps[0].Index)]
+		steps = &db.ColumnPath{Steps: p.path.Steps[1:]}
+	}
+	value, _ = steps.Extract(value)
+	row[p.Path] = value
+}
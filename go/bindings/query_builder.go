@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/axonops/cqlai-node/internal/catalog"
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// QueryAnalysisResult is the result of analyzing a SELECT statement against the schema
+type QueryAnalysisResult struct {
+	Analysis               *cql.SelectAnalysis `json:"analysis"`
+	GroupByValid           *bool               `json:"groupByValid,omitempty"` // nil when there is no GROUP BY or the table is unknown
+	PerPartitionLimitValid *bool               `json:"perPartitionLimitValid,omitempty"`
+	Warnings               []string            `json:"warnings,omitempty"`
+}
+
+// serverFeatures returns the optional SELECT clauses supported by the connected server.
+// An unknown version is treated like the catalog does: as the latest release.
+// ScyllaDB reports release_version 3.0.8 but supports all of them.
+func serverFeatures(session *db.Session) cql.Features {
+	if session.IsScylla() {
+		return cql.Features{PerPartitionLimit: true, GroupBy: true, Scylla: true}
+	}
+	version := session.CassandraVersion()
+	if !catalog.ForVersion(version).Exact {
+		return cql.Features{PerPartitionLimit: true, GroupBy: true}
+	}
+	return cql.Features{
+		PerPartitionLimit: catalog.AtLeast(version, "3.6"),
+		GroupBy:           catalog.AtLeast(version, "3.10"),
+	}
+}
+
+// tableKeys returns the primary key layout of a table from driver metadata
+func tableKeys(session *db.Session, keyspace, table string) (cql.TableKeys, error) {
+	meta, err := session.GetTableMetadata(keyspace, table)
+	if err != nil {
+		return cql.TableKeys{}, err
+	}
+	keys := cql.TableKeys{}
+	for _, col := range meta.PartitionKey {
+		keys.PartitionKey = append(keys.PartitionKey, col.Name)
+	}
+	for _, col := range meta.ClusteringColumns {
+		keys.ClusteringColumns = append(keys.ClusteringColumns, col.Name)
+	}
+	return keys, nil
+}
+
+// buildSelectQuery generates a SELECT for a grid grouping/limit spec
+func buildSelectQuery(session *db.Session, spec cql.SelectSpec) (*cql.BuildResult, error) {
+	if spec.Keyspace == "" {
+		spec.Keyspace = session.Keyspace()
+	}
+	keys, err := tableKeys(session, spec.Keyspace, spec.Table)
+	if err != nil {
+		return nil, err
+	}
+	return cql.BuildSelect(spec, keys, serverFeatures(session))
+}
+
+// analyzeSelectQuery inspects a SELECT and validates GROUP BY and PER PARTITION LIMIT
+func analyzeSelectQuery(session *db.Session, query string) (*QueryAnalysisResult, error) {
+	analysis, err := cql.AnalyzeSelect(query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryAnalysisResult{Analysis: analysis}
+	features := serverFeatures(session)
+
+	keyspace := analysis.Keyspace
+	if keyspace == "" {
+		keyspace = session.Keyspace()
+	}
+
+	if analysis.PerPartitionLimit > 0 {
+		valid := features.PerPartitionLimit
+		result.PerPartitionLimitValid = &valid
+		if !valid {
+			result.Warnings = append(result.Warnings, "PER PARTITION LIMIT requires Cassandra 3.6 or later")
+		}
+	}
+
+	if len(analysis.GroupBy) > 0 {
+		if !features.GroupBy {
+			valid := false
+			result.GroupByValid = &valid
+			result.Warnings = append(result.Warnings, "GROUP BY requires Cassandra 3.10 or later")
+		} else if keys, err := tableKeys(session, keyspace, analysis.Table); err == nil {
+			valid, reason := cql.CanPushDownGroupBy(analysis.GroupBy, keys, cql.SplitConditions(analysis.Where))
+			result.GroupByValid = &valid
+			if !valid {
+				result.Warnings = append(result.Warnings, reason)
+			}
+		} else {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("cannot validate GROUP BY: %v", err))
+		}
+	}
+
+	if !features.Scylla {
+		if analysis.BypassCache {
+			result.Warnings = append(result.Warnings, "BYPASS CACHE is only supported by ScyllaDB")
+		}
+		if analysis.Timeout != "" {
+			result.Warnings = append(result.Warnings, "USING TIMEOUT is only supported by ScyllaDB")
+		}
+	}
+
+	if analysis.HasAggregates && len(analysis.GroupBy) == 0 && analysis.Where == "" {
+		result.Warnings = append(result.Warnings, "aggregate without WHERE or GROUP BY scans the whole table")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// Query profiling
+//
+// An opt-in recorder per session that keeps the last statements the session
+// ran (queries, scripts, prepared statements and batches) in a ring buffer:
+// their text, duration, rows, consistency, error and trace ID. The profile
+// groups them by statement shape, the text with its literals replaced by ?,
+// so a slow workbench session can be diagnosed from the p50/p95/p99 latency
+// of each kind of statement without external tooling. Statements refused
+// before they are sent, by the scan guard or the payload check, are not
+// recorded, nor are flow-controlled streams, whose duration is set by the
+// consumer.
+
+// Ring buffer sizes
+const (
+	defaultProfileCapacity = 1000
+	maxProfileCapacity     = 100000
+)
+
+// QueryProfilingOptions configures query profiling for a session
+type QueryProfilingOptions struct {
+	Enabled  *bool `json:"enabled,omitempty"`  // false stops profiling and drops the recorded statements (default true)
+	Capacity int   `json:"capacity,omitempty"` // Statements kept; the oldest are overwritten (default 1000, max 100000)
+}
+
+// QueryProfileOptions are the options of GetQueryProfile
+type QueryProfileOptions struct {
+	Statements bool   `json:"statements"` // Include the recorded statements, newest first
+	Shape      string `json:"shape"`      // Only statements and stats of this shape
+	Reset      bool   `json:"reset"`      // Empty the buffer after the profile is taken
+}
+
+// ProfiledStatement is one statement the session ran
+type ProfiledStatement struct {
+	At             string  `json:"at"`
+	Kind           string  `json:"kind"` // query, prepared or batch
+	Statement      string  `json:"statement"`
+	Shape          string  `json:"shape"`
+	DurationMs     float64 `json:"durationMs"`
+	Rows           int     `json:"rows"`
+	Consistency    string  `json:"consistency"`
+	Error          string  `json:"error,omitempty"`
+	TraceSessionID string  `json:"traceSessionId,omitempty"`
+}
+
+// ShapeProfile aggregates the recorded statements of one shape
+type ShapeProfile struct {
+	Shape     string        `json:"shape"`
+	Kind      string        `json:"kind"`
+	Count     int           `json:"count"`
+	Errors    int           `json:"errors"`
+	Rows      int64         `json:"rows"`
+	TotalMs   float64       `json:"totalMs"` // Time spent in the shape, to rank what dominates a session
+	Latency   LatencyReport `json:"latency"`
+	LastAt    string        `json:"lastAt"`
+	LastTrace string        `json:"lastTraceSessionId,omitempty"`
+}
+
+// QueryProfile is the result of GetQueryProfile
+type QueryProfile struct {
+	Profiling  bool                `json:"profiling"`
+	Capacity   int                 `json:"capacity,omitempty"`
+	StartedAt  string              `json:"startedAt,omitempty"`
+	Recorded   int64               `json:"recorded"` // Statements recorded since profiling started
+	Buffered   int                 `json:"buffered"` // Statements still in the buffer
+	Dropped    int64               `json:"dropped"`  // Statements overwritten, or emptied by reset
+	Shapes     []ShapeProfile      `json:"shapes"`   // Most total time first
+	Statements []ProfiledStatement `json:"statements,omitempty"`
+}
+
+// queryProfiler is the ring buffer of one session
+type queryProfiler struct {
+	mu       sync.Mutex
+	started  time.Time
+	entries  []ProfiledStatement
+	next     int
+	full     bool
+	recorded int64
+}
+
+// Query profilers per session handle
+var (
+	queryProfilers     = make(map[int]*queryProfiler)
+	queryProfilersLock sync.Mutex
+)
+
+// startQueryProfiling replaces the session's profiler, emptying the buffer
+func startQueryProfiling(handle, capacity int) {
+	queryProfilersLock.Lock()
+	defer queryProfilersLock.Unlock()
+	queryProfilers[handle] = &queryProfiler{
+		started: time.Now(),
+		entries: make([]ProfiledStatement, capacity),
+	}
+}
+
+// stopQueryProfiling stops profiling the session and drops its statements
+func stopQueryProfiling(handle int) {
+	queryProfilersLock.Lock()
+	delete(queryProfilers, handle)
+	queryProfilersLock.Unlock()
+}
+
+// discardQueryProfiler forgets the session's profiler when it is closed
+func discardQueryProfiler(handle int) {
+	stopQueryProfiling(handle)
+}
+
+// getQueryProfiler returns the session's profiler, nil when profiling is off
+func getQueryProfiler(handle int) *queryProfiler {
+	queryProfilersLock.Lock()
+	defer queryProfilersLock.Unlock()
+	return queryProfilers[handle]
+}
+
+// statementProfile measures one statement for the session's profiler. A nil
+// *statementProfile, returned when profiling is off, records nothing.
+type statementProfile struct {
+	profiler *queryProfiler
+	session  *db.Session
+	start    time.Time
+	entry    ProfiledStatement
+}
+
+// profileStatement starts measuring a statement about to be sent. opts may
+// be nil; its consistency, when set, replaces the session's.
+func profileStatement(handle int, session *db.Session, kind, stmt string, opts *db.QueryOptions) *statementProfile {
+	profiler := getQueryProfiler(handle)
+	if profiler == nil {
+		return nil
+	}
+	consistency := session.Consistency()
+	if opts != nil && opts.Consistency != "" {
+		consistency = opts.Consistency
+	}
+	return &statementProfile{
+		profiler: profiler,
+		session:  session,
+		start:    time.Now(),
+		entry: ProfiledStatement{
+			Kind:        kind,
+			Statement:   stmt,
+			Consistency: consistency,
+		},
+	}
+}
+
+// done records the statement with the rows it returned, and errMsg when it
+// failed
+func (p *statementProfile) done(rows int, errMsg string) {
+	if p == nil {
+		return
+	}
+	p.entry.DurationMs = toMillis(time.Since(p.start))
+	p.entry.At = p.start.UTC().Format(time.RFC3339Nano)
+	p.entry.Rows = rows
+	p.entry.Error = errMsg
+	p.entry.TraceSessionID = getTraceIDIfEnabled(p.session)
+	if p.entry.Shape == "" {
+		p.entry.Shape = logger.StatementShape(p.entry.Statement)
+	}
+	p.profiler.record(p.entry)
+}
+
+// profileBatch starts measuring a batch. Its statement is the batch's
+// statements joined by "; ", and its shape their shapes.
+func profileBatch(handle int, session *db.Session, stmts []boundStatement) *statementProfile {
+	if getQueryProfiler(handle) == nil {
+		return nil
+	}
+	queries := make([]string, len(stmts))
+	shapes := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		queries[i] = stmt.query
+		shapes[i] = logger.StatementShape(stmt.query)
+	}
+	p := profileStatement(handle, session, "batch", strings.Join(queries, "; "), nil)
+	if p != nil {
+		p.entry.Shape = "BATCH " + strings.Join(shapes, "; ")
+	}
+	return p
+}
+
+// record adds a statement to the buffer, overwriting the oldest when full
+func (p *queryProfiler) record(entry ProfiledStatement) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries[p.next] = entry
+	p.next++
+	if p.next == len(p.entries) {
+		p.next = 0
+		p.full = true
+	}
+	p.recorded++
+}
+
+// newestFirst returns the buffered statements, newest first
+func (p *queryProfiler) newestFirst() []ProfiledStatement {
+	n := p.next
+	if p.full {
+		n = len(p.entries)
+	}
+	out := make([]ProfiledStatement, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, p.entries[(p.next-i+len(p.entries))%len(p.entries)])
+	}
+	return out
+}
+
+// queryProfile aggregates the session's buffer by shape
+func queryProfile(handle int, opts QueryProfileOptions) QueryProfile {
+	profiler := getQueryProfiler(handle)
+	if profiler == nil {
+		return QueryProfile{Shapes: []ShapeProfile{}}
+	}
+
+	profiler.mu.Lock()
+	entries := profiler.newestFirst()
+	profile := QueryProfile{
+		Profiling: true,
+		Capacity:  len(profiler.entries),
+		StartedAt: profiler.started.UTC().Format(time.RFC3339),
+		Recorded:  profiler.recorded,
+		Buffered:  len(entries),
+		Dropped:   profiler.recorded - int64(len(entries)),
+	}
+	if opts.Reset {
+		profiler.next, profiler.full = 0, false
+		clear(profiler.entries)
+	}
+	profiler.mu.Unlock()
+
+	byShape := make(map[string]*ShapeProfile)
+	samples := make(map[string][]time.Duration)
+	for _, entry := range entries {
+		if opts.Shape != "" && entry.Shape != opts.Shape {
+			continue
+		}
+		shape := byShape[entry.Shape]
+		if shape == nil {
+			// Entries are newest first, so the first one seen is the last run
+			shape = &ShapeProfile{Shape: entry.Shape, Kind: entry.Kind, LastAt: entry.At, LastTrace: entry.TraceSessionID}
+			byShape[entry.Shape] = shape
+		}
+		shape.Count++
+		if entry.Error != "" {
+			shape.Errors++
+		}
+		shape.Rows += int64(entry.Rows)
+		shape.TotalMs += entry.DurationMs
+		samples[entry.Shape] = append(samples[entry.Shape], time.Duration(entry.DurationMs*float64(time.Millisecond)))
+		if opts.Statements {
+			profile.Statements = append(profile.Statements, entry)
+		}
+	}
+
+	profile.Shapes = make([]ShapeProfile, 0, len(byShape))
+	for key, shape := range byShape {
+		shape.Latency = newLatencyReport(samples[key])
+		shape.TotalMs = toMillis(time.Duration(shape.TotalMs * float64(time.Millisecond)))
+		profile.Shapes = append(profile.Shapes, *shape)
+	}
+	sort.Slice(profile.Shapes, func(i, j int) bool {
+		if profile.Shapes[i].TotalMs != profile.Shapes[j].TotalMs {
+			return profile.Shapes[i].TotalMs > profile.Shapes[j].TotalMs
+		}
+		return profile.Shapes[i].Shape < profile.Shapes[j].Shape
+	})
+	return profile
+}
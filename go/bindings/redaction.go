@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// Redaction policies
+//
+// The debug log and the driver's warnings record statements through the
+// workspace's redaction policy (see internal/logger/redact.go). The host
+// keeps its own history, audit and slow query logs; RedactStatement gives
+// them the same shape and the same hashes for a statement and its values,
+// so an entry in one log can be matched with the others.
+
+// RedactionPolicyRequest sets or clears the policy of a workspace
+type RedactionPolicyRequest struct {
+	WorkspaceID string                  `json:"workspaceID"`
+	Policy      *logger.RedactionPolicy `json:"policy"` // nil restores the default
+}
+
+// RedactStatementRequest is a statement to redact under a workspace's policy
+type RedactStatementRequest struct {
+	WorkspaceID string          `json:"workspaceID"`
+	Query       string          `json:"query"`
+	Values      json.RawMessage `json:"values"` // Array in bind marker order, or object by variable name
+}
+
+// RedactedStatement is a statement as its workspace's policy allows it to be logged
+type RedactedStatement struct {
+	Shape  string   `json:"shape"`            // Statement with its literals replaced by ?
+	Values []string `json:"values,omitempty"` // Redacted bind values; "name=value" for named values
+	Text   string   `json:"text"`             // Shape followed by the values, as written to the debug log
+	Mode   string   `json:"mode"`
+}
+
+// redactStatement applies the workspace's policy to a statement and its values
+func redactStatement(req RedactStatementRequest) (*RedactedStatement, error) {
+	policy := logger.RedactionPolicyFor(req.WorkspaceID)
+	result := &RedactedStatement{
+		Shape: policy.Statement(req.Query, nil),
+		Mode:  policy.Mode,
+	}
+
+	if len(req.Values) > 0 && string(req.Values) != "null" {
+		// Numbers are kept as written, so they hash as the driver's values do
+		var values interface{}
+		dec := json.NewDecoder(bytes.NewReader(req.Values))
+		dec.UseNumber()
+		if err := dec.Decode(&values); err != nil {
+			return nil, fmt.Errorf("invalid values: %v", err)
+		}
+		switch v := values.(type) {
+		case []interface{}:
+			result.Values = policy.Values(v)
+		case map[string]interface{}:
+			result.Values = policy.NamedValues(v)
+		default:
+			return nil, fmt.Errorf("values must be an array or an object")
+		}
+	}
+
+	result.Text = result.Shape
+	if len(result.Values) > 0 {
+		result.Text += " [" + strings.Join(result.Values, ", ") + "]"
+	}
+	return result, nil
+}
+
+// withoutSalt returns a policy for display; the salt is never given back
+func withoutSalt(p logger.RedactionPolicy) logger.RedactionPolicy {
+	p.Salt = ""
+	return p
+}
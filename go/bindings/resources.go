@@ -0,0 +1,169 @@
+package main
+
+import (
+	"runtime"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// ResourceUsage reports resources currently held by a session handle
+type ResourceUsage struct {
+	OpenIterators         int              `json:"openIterators"`         // Paged queries with a live iterator
+	BusyIterators         int              `json:"busyIterators"`         // Iterators being read by an in-flight FetchNextPage
+	PreparedStatements    int              `json:"preparedStatements"`    // Statements prepared with PrepareStatement and not yet closed
+	BufferedRows          int              `json:"bufferedRows"`          // Rows held in driver pages and peeked rows
+	BufferedBytesEstimate int64            `json:"bufferedBytesEstimate"` // Approximate size of the buffered rows
+	ActiveOperations      int64            `json:"activeOperations"`      // Exported calls currently running on the handle
+	WorkerGoroutines      int64            `json:"workerGoroutines"`      // Helper goroutines started by those calls
+	Goroutines            int64            `json:"goroutines"`            // activeOperations + workerGoroutines
+	ProcessGoroutines     int              `json:"processGoroutines"`     // All goroutines in the library, for leak comparison
+	SchemaCache           SchemaCacheUsage `json:"schemaCache"`
+	SourceExecution       bool             `json:"sourceExecution"` // True while ExecuteSourceFiles is running
+	Streams               StreamsUsage     `json:"streams"`         // Flow-controlled streams and their buffers (see flow_streams.go)
+}
+
+// SchemaCacheUsage reports the size of a session's schema cache
+type SchemaCacheUsage struct {
+	Enabled        bool   `json:"enabled"`
+	Mode           string `json:"mode"` // "full", "keyspace" or "off"
+	Keyspaces      int    `json:"keyspaces"`
+	Tables         int    `json:"tables"`
+	Columns        int    `json:"columns"`
+	EstimatedBytes int64  `json:"estimatedBytes"` // Approximate memory held by the cache
+	LastRefresh    string `json:"lastRefresh,omitempty"`
+	Source         string `json:"source,omitempty"`        // "cluster", or "disk" until the background refresh of a saved cache completes
+	SchemaVersion  string `json:"schemaVersion,omitempty"` // Cluster schema version of a persisted cache
+	PersistDir     string `json:"persistDir,omitempty"`    // Where the cache is saved between connections
+}
+
+// schemaCacheUsage reports a session's schema cache mode and size
+func schemaCacheUsage(session *db.Session) SchemaCacheUsage {
+	usage := SchemaCacheUsage{Mode: session.SchemaCacheMode(), PersistDir: session.SchemaCacheDir()}
+	cache := session.GetSchemaCache()
+	if cache == nil {
+		return usage
+	}
+	stats := cache.Stats()
+	usage.Enabled = true
+	usage.Keyspaces = stats.Keyspaces
+	usage.Tables = stats.Tables
+	usage.Columns = stats.Columns
+	usage.EstimatedBytes = stats.EstimatedBytes
+	usage.Source = stats.Source
+	usage.SchemaVersion = stats.SchemaVersion
+	if !stats.LastRefresh.IsZero() {
+		usage.LastRefresh = stats.LastRefresh.Format(time.RFC3339)
+	}
+	return usage
+}
+
+// collectResourceUsage gathers the resource report for a session handle
+func collectResourceUsage(handle int, session *db.Session) *ResourceUsage {
+	usage := &ResourceUsage{
+		ProcessGoroutines: runtime.NumGoroutine(),
+	}
+
+	if state := getHandleState(handle); state != nil {
+		usage.ActiveOperations = state.activeOperations.Load()
+		usage.WorkerGoroutines = state.workerGoroutines.Load()
+		usage.Goroutines = usage.ActiveOperations + usage.WorkerGoroutines
+	}
+
+	// preparedStatementCount takes preparedStatementsLock itself; the report
+	// never waits for the handle lock
+	usage.PreparedStatements = preparedStatementCount(handle)
+
+	// Snapshot this session's paged queries, then inspect them without holding
+	// pagedQueriesMutex (see pagedQueryState.close for the lock order)
+	pagedQueriesMutex.Lock()
+	states := make([]*pagedQueryState, 0)
+	for _, state := range pagedQueries {
+		if state.Session == session {
+			states = append(states, state)
+		}
+	}
+	pagedQueriesMutex.Unlock()
+
+	for _, state := range states {
+		usage.OpenIterators++
+
+		// Don't wait behind a fetch in progress; report it as busy instead
+		if !state.mu.TryLock() {
+			usage.BusyIterators++
+			continue
+		}
+		rowBytes := int64(0)
+		if state.PeekedRow != nil {
+			usage.BufferedRows++
+			rowBytes = estimateRowSize(state.PeekedRow)
+			usage.BufferedBytesEstimate += rowBytes
+		}
+		// The driver holds the current page in memory; its size is only
+		// observable as a row count, so estimate bytes from the peeked row
+		if iter, ok := state.Iterator.(*gocql.Iter); ok && !state.closed {
+			pageRows := iter.NumRows()
+			usage.BufferedRows += pageRows
+			usage.BufferedBytesEstimate += int64(pageRows) * rowBytes
+		}
+		state.mu.Unlock()
+	}
+
+	usage.SchemaCache = schemaCacheUsage(session)
+	usage.Streams = streamsUsage(handle)
+
+	sourceProgressLock.Lock()
+	for _, p := range sourceProgress[handle] {
+		if !p.IsComplete {
+			usage.SourceExecution = true
+			break
+		}
+	}
+	sourceProgressLock.Unlock()
+
+	return usage
+}
+
+// estimateRowSize approximates the in-memory size of a scanned row in bytes
+func estimateRowSize(row map[string]interface{}) int64 {
+	size := int64(0)
+	for name, val := range row {
+		size += int64(len(name)) + estimateValueSize(val)
+	}
+	return size
+}
+
+// estimateValueSize approximates the in-memory size of a scanned value in bytes
+func estimateValueSize(val interface{}) int64 {
+	switch v := val.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case gocql.UUID:
+		return 16
+	case bool, int8:
+		return 1
+	case int16:
+		return 2
+	case int32, float32:
+		return 4
+	case int, int64, float64, time.Duration:
+		return 8
+	case time.Time:
+		return 24
+	case []interface{}:
+		size := int64(0)
+		for _, item := range v {
+			size += estimateValueSize(item)
+		}
+		return size
+	case map[string]interface{}:
+		return estimateRowSize(v)
+	default:
+		return 16
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+func TestCollectResourceUsagePreparedStatements(t *testing.T) {
+	const handle, other = 1 << 20, 1<<20 + 1
+	createHandleState(handle)
+	t.Cleanup(func() {
+		discardPreparedStatements(handle)
+		discardPreparedStatements(other)
+		deleteHandleState(handle)
+	})
+
+	preparedStatementsLock.Lock()
+	for id, h := range map[string]int{"a": handle, "b": handle, "c": other} {
+		preparedStatements["test:"+id] = &preparedStatement{handle: h}
+	}
+	preparedStatementsLock.Unlock()
+
+	usage := collectResourceUsage(handle, &db.Session{})
+	if usage.PreparedStatements != 2 {
+		t.Errorf("preparedStatements = %d, want 2", usage.PreparedStatements)
+	}
+	if usage.ActiveOperations != 0 {
+		t.Errorf("activeOperations = %d, want 0: the report counted itself", usage.ActiveOperations)
+	}
+
+	if !closePrepared(handle, "test:a") || closePrepared(handle, "test:c") {
+		t.Fatalf("closePrepared closed the wrong statements")
+	}
+	if usage := collectResourceUsage(handle, &db.Session{}); usage.PreparedStatements != 1 {
+		t.Errorf("preparedStatements after close = %d, want 1", usage.PreparedStatements)
+	}
+}
+
+func TestCollectResourceUsageDoesNotWaitForHandleLock(t *testing.T) {
+	const handle = 1<<20 + 2
+	createHandleState(handle)
+	t.Cleanup(func() { deleteHandleState(handle) })
+
+	// As SetKeyspace holds it while it replaces the driver session
+	unlock := lockHandleExclusive(handle)
+	defer unlock()
+
+	done := make(chan *ResourceUsage)
+	go func() { done <- collectResourceUsage(handle, &db.Session{}) }()
+	select {
+	case usage := <-done:
+		if usage.ActiveOperations != 1 {
+			t.Errorf("activeOperations = %d, want the exclusive holder", usage.ActiveOperations)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the report waited for the exclusive lock")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Result limit
+//
+// ExecuteQuery reads the whole result before it returns, which a host calling
+// the simple API may not expect of a large table. When a session sets a
+// result limit, a result that grows past it stops being buffered: the rows
+// read so far are returned as the first page, with a queryId FetchNextPage
+// reads the rest from, and modeSwitched set so the host knows to page.
+
+// ResultLimitOptions configures the result limit of a session
+type ResultLimitOptions struct {
+	MaxRows  int   `json:"maxRows"`  // Switch to paging above this many rows (0 = no row limit)
+	MaxBytes int64 `json:"maxBytes"` // Switch to paging above this many bytes of JSON rows (0 = no byte limit)
+}
+
+// enabled reports whether the limit applies to anything
+func (l ResultLimitOptions) enabled() bool {
+	return l.MaxRows > 0 || l.MaxBytes > 0
+}
+
+// validate rejects negative limits
+func (l ResultLimitOptions) validate() error {
+	if l.MaxRows < 0 || l.MaxBytes < 0 {
+		return fmt.Errorf("maxRows and maxBytes must not be negative")
+	}
+	return nil
+}
+
+// Result limits per session handle
+var (
+	resultLimits     = make(map[int]ResultLimitOptions)
+	resultLimitsLock sync.Mutex
+)
+
+// setResultLimit replaces the session's result limit; zero limits disable it
+func setResultLimit(handle int, opts ResultLimitOptions) {
+	resultLimitsLock.Lock()
+	defer resultLimitsLock.Unlock()
+	if !opts.enabled() {
+		delete(resultLimits, handle)
+		return
+	}
+	resultLimits[handle] = opts
+}
+
+// getResultLimit returns the session's result limit, disabled by default
+func getResultLimit(handle int) ResultLimitOptions {
+	resultLimitsLock.Lock()
+	defer resultLimitsLock.Unlock()
+	return resultLimits[handle]
+}
+
+// discardResultLimit forgets the session's result limit when the session is closed
+func discardResultLimit(handle int) {
+	resultLimitsLock.Lock()
+	delete(resultLimits, handle)
+	resultLimitsLock.Unlock()
+}
+
+// resultBuffer collects the rows of a result until it passes its limit
+type resultBuffer struct {
+	limit ResultLimitOptions
+	rows  []map[string]interface{}
+	bytes int64
+}
+
+// add appends a row and reports whether the result has passed its limit
+func (b *resultBuffer) add(row map[string]interface{}) bool {
+	b.rows = append(b.rows, row)
+	if b.limit.MaxBytes > 0 {
+		if data, err := json.Marshal(row); err == nil {
+			b.bytes += int64(len(data))
+		}
+		if b.bytes > b.limit.MaxBytes {
+			return true
+		}
+	}
+	return b.limit.MaxRows > 0 && len(b.rows) >= b.limit.MaxRows
+}
+
+// switchableContext is the context of a query whose result may switch to
+// paging. The driver fetches every page with the query's context, so it must
+// outlive the call once the result switches. Until then it is cancelled with
+// the call's context; afterwards only when the paged query is closed.
+type switchableContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   func() bool // Detaches ctx from the call's context
+	kept   bool
+}
+
+// newSwitchableContext returns a context cancelled with call, without its deadline
+func newSwitchableContext(call context.Context) *switchableContext {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(call))
+	return &switchableContext{ctx: ctx, cancel: cancel, stop: context.AfterFunc(call, cancel)}
+}
+
+// keep hands the context over to a paged query, returning its cancel function
+func (s *switchableContext) keep() context.CancelFunc {
+	s.stop()
+	s.kept = true
+	return s.cancel
+}
+
+// release cancels the context when the result did not switch to paging
+func (s *switchableContext) release() {
+	if !s.kept {
+		s.stop()
+		s.cancel()
+	}
+}
+
+// switchToPaged registers the rest of a result that passed its limit as a
+// paged query, which takes over the query's context from switchable (nil
+// when the query runs under the call's context). It returns the query ID, or
+// "" when no rows are left.
+func switchToPaged(h int, session *db.Session, v db.StreamingQueryResult, shown *resultDisplay, keyspace, table string, switchable *switchableContext) string {
+	scanner := db.NewRowScanner(v.Iterator)
+	next, ok := scanner.Next()
+	if !ok {
+		return ""
+	}
+	pageSize := session.PageSize()
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	columns, columnTypes := v.ColumnNames, v.ColumnTypes
+	if shown != nil {
+		columns, columnTypes = shown.names, shown.types
+	}
+
+	var cancel context.CancelFunc
+	if switchable != nil {
+		cancel = switchable.keep()
+	}
+
+	queryID := generateQueryID(h)
+	pagedQueriesMutex.Lock()
+	pagedQueries[queryID] = &pagedQueryState{
+		Session:     session,
+		Iterator:    v.Iterator,
+		Rows:        scanner,
+		ColumnNames: columns,
+		ColumnTypes: columnTypes,
+		Display:     shown,
+		PageSize:    pageSize,
+		PeekedRow:   next,
+		Execution:   v.Execution,
+		Keyspace:    keyspace,
+		Table:       table,
+		cancel:      cancel,
+	}
+	pagedQueriesMutex.Unlock()
+	return queryID
+}
+
+// resultLimitWarning explains a switch to paging
+func resultLimitWarning(limit ResultLimitOptions, rows int, bytes int64) string {
+	if limit.MaxBytes > 0 && bytes > limit.MaxBytes {
+		return fmt.Sprintf("Result is larger than %d bytes; returned the first %d rows, fetch the rest with queryId", limit.MaxBytes, rows)
+	}
+	return fmt.Sprintf("Result has more than %d rows; returned the first %d, fetch the rest with queryId", limit.MaxRows, rows)
+}
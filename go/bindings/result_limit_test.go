@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSwitchableContext(t *testing.T) {
+	// Kept by a paged query: outlives the call, ends when the query is closed
+	call, endCall := context.WithCancel(context.Background())
+	s := newSwitchableContext(call)
+	cancel := s.keep()
+	s.release()
+	endCall()
+	if s.ctx.Err() != nil {
+		t.Fatalf("kept context ended with the call: %v", s.ctx.Err())
+	}
+	state := &pagedQueryState{cancel: cancel}
+	state.close()
+	if s.ctx.Err() == nil {
+		t.Errorf("kept context still running after the paged query closed")
+	}
+
+	// Not switched: ends with the call
+	call, endCall = context.WithCancel(context.Background())
+	s = newSwitchableContext(call)
+	s.release()
+	if s.ctx.Err() == nil {
+		t.Errorf("context still running after release")
+	}
+	endCall()
+
+	// Cancelled while the call runs
+	call, endCall = context.WithCancel(context.Background())
+	s = newSwitchableContext(call)
+	defer s.release()
+	endCall()
+	<-s.ctx.Done()
+}
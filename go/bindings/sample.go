@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Table samples
+//
+// A preview of a table usually shows its first rows, which all come from the
+// partitions with the lowest tokens. The sample modes give other views:
+//
+//	first   SELECT ... LIMIT n
+//	random  runs of rows starting at random tokens (see sampleRows)
+//	last    the last rows of one partition: ORDER BY the clustering columns,
+//	        each reversed from the table's clustering order
+//
+// Which modes a table supports depends on its metadata and the cluster's
+// partitioner, so GetSampleModes reports them before a sample is taken.
+
+// Sample modes
+const (
+	sampleFirst  = "first"
+	sampleRandom = "random"
+	sampleLast   = "last"
+)
+
+// Sample sizes
+const (
+	defaultSampleLimit = 100
+	maxSampleLimit     = 10000
+)
+
+// SampleTableOptions are the options of SampleTable
+type SampleTableOptions struct {
+	Keyspace  string                 `json:"keyspace"`            // Defaults to the current keyspace
+	Table     string                 `json:"table"`               // Required
+	Mode      string                 `json:"mode"`                // "first" (default), "random" or "last"
+	Limit     int                    `json:"limit"`               // Rows to return (default 100)
+	Columns   []string               `json:"columns,omitempty"`   // Columns to select; all when empty
+	Partition map[string]interface{} `json:"partition,omitempty"` // Partition key values; required by "last", optional for "first"
+}
+
+// SampleMode reports whether a table supports a sample mode
+type SampleMode struct {
+	Mode           string `json:"mode"`
+	Available      bool   `json:"available"`
+	NeedsPartition bool   `json:"needsPartition,omitempty"` // The partition key values must be given
+	Reason         string `json:"reason,omitempty"`         // Why the mode is not available
+}
+
+// SampleTableResult is a sample of a table's rows
+type SampleTableResult struct {
+	Keyspace    string                   `json:"keyspace"`
+	Table       string                   `json:"table"`
+	Mode        string                   `json:"mode"`
+	Columns     []string                 `json:"columns"`
+	ColumnTypes []string                 `json:"columnTypes"`
+	Rows        []map[string]interface{} `json:"rows"`
+	RowCount    int                      `json:"rowCount"`
+	Query       string                   `json:"query,omitempty"` // Statement run for "first" and "last"
+}
+
+// clusterPartitioner returns the partitioner class of the cluster
+func clusterPartitioner(session *db.Session) string {
+	var partitioner string
+	_ = session.Query("SELECT partitioner FROM system.local").Scan(&partitioner)
+	return partitioner
+}
+
+// sampleModes reports the sample modes a table supports
+func sampleModes(table *gocql.TableMetadata, partitioner string) []SampleMode {
+	modes := []SampleMode{{Mode: sampleFirst, Available: true}}
+
+	random := SampleMode{Mode: sampleRandom, Available: true}
+	if !strings.HasSuffix(partitioner, "Murmur3Partitioner") {
+		random.Available = false
+		random.Reason = fmt.Sprintf("random sampling needs the Murmur3 partitioner; the cluster uses %s", partitioner)
+	}
+	modes = append(modes, random)
+
+	last := SampleMode{Mode: sampleLast, Available: true, NeedsPartition: true}
+	if len(table.ClusteringColumns) == 0 {
+		last.Available = false
+		last.NeedsPartition = false
+		last.Reason = "the table has no clustering columns, so a partition holds a single row"
+	}
+	return append(modes, last)
+}
+
+// reverseClusteringOrder returns the ORDER BY clause that reads a partition
+// from its last row
+func reverseClusteringOrder(table *gocql.TableMetadata) string {
+	parts := make([]string, len(table.ClusteringColumns))
+	for i, col := range table.ClusteringColumns {
+		dir := "DESC"
+		if col.Order == gocql.DESC {
+			dir = "ASC"
+		}
+		parts[i] = quoteIdentifier(col.Name) + " " + dir
+	}
+	return "ORDER BY " + strings.Join(parts, ", ")
+}
+
+// sampleTable reads a sample of a table's rows in the requested mode
+func sampleTable(session *db.Session, opts SampleTableOptions) (*SampleTableResult, error) {
+	table, err := session.GetTableMetadata(opts.Keyspace, opts.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	var mode *SampleMode
+	modes := sampleModes(table, clusterPartitioner(session))
+	for i := range modes {
+		if modes[i].Mode == opts.Mode {
+			mode = &modes[i]
+		}
+	}
+	switch {
+	case mode == nil:
+		return nil, fmt.Errorf("unknown sample mode %q: use first, random or last", opts.Mode)
+	case !mode.Available:
+		return nil, fmt.Errorf("%s sampling is not available for %s.%s: %s", opts.Mode, opts.Keyspace, opts.Table, mode.Reason)
+	case mode.NeedsPartition && len(opts.Partition) == 0:
+		return nil, fmt.Errorf("%s sampling reads one partition; give its key in partition", opts.Mode)
+	case opts.Mode == sampleRandom && len(opts.Partition) > 0:
+		return nil, fmt.Errorf("partition applies to first and last sampling only")
+	}
+
+	selectList := "*"
+	selected := make(map[string]bool, len(opts.Columns))
+	if len(opts.Columns) > 0 {
+		cols := make([]string, len(opts.Columns))
+		for i, name := range opts.Columns {
+			col := lookupColumn(table, name)
+			if col == nil {
+				return nil, fmt.Errorf("column %s does not exist in %s.%s", name, opts.Keyspace, opts.Table)
+			}
+			cols[i] = quoteIdentifier(col.Name)
+			selected[col.Name] = true
+		}
+		selectList = strings.Join(cols, ", ")
+	}
+
+	result := &SampleTableResult{Keyspace: opts.Keyspace, Table: opts.Table, Mode: opts.Mode}
+	if opts.Mode == sampleRandom {
+		// sampleRows tells rows apart by their primary key, so the key columns
+		// are always read and the ones not asked for are dropped afterwards
+		var extra []string
+		if len(selected) > 0 {
+			for _, col := range primaryKeyColumns(table) {
+				if !selected[col.Name] {
+					extra = append(extra, col.Name)
+					selectList += ", " + quoteIdentifier(col.Name)
+				}
+			}
+		}
+		rows, _, err := sampleRows(session, table, selectList, opts.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("query failed: %v", err)
+		}
+		for _, row := range rows {
+			for _, name := range extra {
+				delete(row, name)
+			}
+		}
+		result.Rows = rows
+		result.RowCount = len(rows)
+		result.Columns, result.ColumnTypes = sampleColumns(table, opts.Columns)
+		return result, nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s.%s", selectList, quoteIdentifier(table.Keyspace), quoteIdentifier(table.Name))
+	var values []interface{}
+	if len(opts.Partition) > 0 {
+		conds, _, err := keyConditions(table, opts.Partition, false)
+		if err != nil {
+			return nil, err
+		}
+		where, display, vals := whereClause(conds)
+		query += " WHERE " + where
+		result.Query = fmt.Sprintf("SELECT %s FROM %s.%s WHERE %s", selectList, quoteIdentifier(table.Keyspace), quoteIdentifier(table.Name), display)
+		values = vals
+	} else {
+		result.Query = query
+	}
+	suffix := ""
+	if opts.Mode == sampleLast {
+		suffix = " " + reverseClusteringOrder(table)
+	}
+	suffix += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	query += suffix
+	result.Query += suffix
+
+	iter := session.Query(query, values...).Iter()
+	rows := make([]map[string]interface{}, 0, opts.Limit)
+	for {
+		row := make(map[string]interface{})
+		if !iter.MapScan(row) {
+			break
+		}
+		rows = append(rows, row)
+	}
+	columns := iter.Columns()
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+
+	result.Rows = rows
+	result.RowCount = len(rows)
+	result.Columns = make([]string, len(columns))
+	result.ColumnTypes = make([]string, len(columns))
+	for i, col := range columns {
+		result.Columns[i] = col.Name
+		result.ColumnTypes[i] = db.TypeInfoToString(col.TypeInfo)
+	}
+	return result, nil
+}
+
+// sampleColumns returns the columns of a sample and their types from the
+// table metadata: names, or every column in the table's order
+func sampleColumns(table *gocql.TableMetadata, names []string) ([]string, []string) {
+	if len(names) == 0 {
+		names = table.OrderedColumns
+	}
+	columns := make([]string, 0, len(names))
+	types := make([]string, 0, len(names))
+	for _, name := range names {
+		if col := lookupColumn(table, name); col != nil {
+			columns = append(columns, col.Name)
+			types = append(types, db.TypeInfoToString(col.Type))
+		}
+	}
+	return columns, types
+}
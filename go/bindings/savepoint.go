@@ -0,0 +1,471 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/batch"
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Rollback step status after RollbackPlan executes a plan
+const (
+	rollbackStatusDone    = "done"
+	rollbackStatusFailed  = "failed"
+	rollbackStatusSkipped = "skipped"
+)
+
+// RollbackStep reverts a single applied schema statement
+type RollbackStep struct {
+	Source       string   `json:"source"` // Script the statement came from
+	Statement    string   `json:"statement"`
+	Object       string   `json:"object,omitempty"`   // e.g. "TABLE ks.events"
+	Compensation []string `json:"compensation"`       // Statements that undo it, in order
+	Reversible   bool     `json:"reversible"`         // False when the change cannot be undone automatically
+	Note         string   `json:"note,omitempty"`     // Caveats, e.g. data that is not restored
+	Snapshot     string   `json:"snapshot,omitempty"` // DDL of the object before the statement, for manual recovery
+	Status       string   `json:"status,omitempty"`   // done, failed or skipped once the plan is executed
+	Error        string   `json:"error,omitempty"`
+}
+
+// SavepointPlan reverts the schema changes of a source execution to the schema
+// before it started. Steps are in rollback order: most recent statement first.
+type SavepointPlan struct {
+	ID           string         `json:"id"`
+	CreatedAt    string         `json:"createdAt"`
+	Steps        []RollbackStep `json:"steps"`
+	Irreversible int            `json:"irreversible"` // Steps that need manual recovery
+	Untracked    int            `json:"untracked"`    // Applied statements that are not schema changes (DML, TRUNCATE, roles)
+	RolledBack   bool           `json:"rolledBack"`   // The plan has been executed
+}
+
+// Latest rollback plan per session handle
+var (
+	rollbackPlans     = make(map[int]*SavepointPlan)
+	rollbackPlansLock sync.Mutex
+)
+
+// newRollbackPlan starts an empty plan for a source execution, replacing the previous one
+func newRollbackPlan(handle int) *SavepointPlan {
+	plan := &SavepointPlan{
+		ID:        fmt.Sprintf("rb-%d", time.Now().UnixNano()),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Steps:     []RollbackStep{},
+	}
+	rollbackPlansLock.Lock()
+	rollbackPlans[handle] = plan
+	rollbackPlansLock.Unlock()
+	return plan
+}
+
+// getRollbackPlan returns a copy of the session's latest plan, or nil
+func getRollbackPlan(handle int) *SavepointPlan {
+	rollbackPlansLock.Lock()
+	defer rollbackPlansLock.Unlock()
+	plan := rollbackPlans[handle]
+	if plan == nil {
+		return nil
+	}
+	cp := *plan
+	cp.Steps = append([]RollbackStep(nil), plan.Steps...)
+	return &cp
+}
+
+// discardRollbackPlan forgets the session's plan when the session is closed
+func discardRollbackPlan(handle int) {
+	rollbackPlansLock.Lock()
+	delete(rollbackPlans, handle)
+	rollbackPlansLock.Unlock()
+}
+
+// savepoint records compensating statements while a source execution runs.
+// prepare is called before each statement, while the schema still has its
+// previous state; applied adds the step once the statement succeeded.
+type savepoint struct {
+	session *db.Session
+	plan    *SavepointPlan
+}
+
+// prepare computes how to revert stmt, with unqualified names in current, the
+// script's keyspace. It returns nil for statements that do not change the
+// schema.
+func (sp *savepoint) prepare(source, stmt, current string) *RollbackStep {
+	d, err := cql.ParseDDL(stmt)
+	if err != nil {
+		return &RollbackStep{Source: source, Statement: stmt, Compensation: []string{}, Note: "could not parse statement: " + err.Error()}
+	}
+	if d == nil {
+		return nil
+	}
+
+	step := &RollbackStep{Source: source, Statement: stmt, Compensation: []string{}}
+	keyspace := d.Keyspace
+	if d.Kind == cql.KindKeyspace {
+		keyspace = d.Name
+	} else if keyspace == "" {
+		keyspace = current
+	}
+	if keyspace == "" {
+		step.Note = "no keyspace for " + d.Name
+		return step
+	}
+	step.Object = d.Kind + " " + qualifiedObjectName(d, keyspace)
+
+	compensateDDL(sp.session.GocqlSession(), d, keyspace, step)
+	return step
+}
+
+// applied adds a prepared step to the plan
+func (sp *savepoint) applied(step *RollbackStep) {
+	rollbackPlansLock.Lock()
+	defer rollbackPlansLock.Unlock()
+	if step == nil {
+		sp.plan.Untracked++
+		return
+	}
+	if !step.Reversible {
+		sp.plan.Irreversible++
+	}
+	sp.plan.Steps = append([]RollbackStep{*step}, sp.plan.Steps...)
+}
+
+// qualifiedObjectName returns the quoted name of the object a statement changes
+func qualifiedObjectName(d *cql.DDLStatement, keyspace string) string {
+	if d.Kind == cql.KindKeyspace {
+		return quoteIdentifier(d.Name)
+	}
+	return quoteIdentifier(keyspace) + "." + quoteIdentifier(d.Name)
+}
+
+// compensateDDL fills in the statements that revert d, based on the current schema
+func compensateDDL(session *gocql.Session, d *cql.DDLStatement, keyspace string, step *RollbackStep) {
+	name := qualifiedObjectName(d, keyspace)
+
+	switch d.Action {
+	case "CREATE":
+		existed, err := schemaObjectExists(session, d, keyspace)
+		if err != nil {
+			step.Note = "could not check existing schema: " + err.Error()
+			return
+		}
+		if !existed {
+			drop := "DROP " + d.Kind + " IF EXISTS " + name
+			if d.Kind == cql.KindFunction || d.Kind == cql.KindAggregate {
+				drop += "(" + d.Signature + ")"
+			}
+			step.Compensation = append(step.Compensation, drop)
+			step.Reversible = true
+			return
+		}
+		if !d.OrReplace {
+			// IF NOT EXISTS is a no-op; without it the statement fails and is never recorded
+			step.Reversible = true
+			step.Note = "object already existed; statement made no change"
+			return
+		}
+		// CREATE OR REPLACE of an existing function or aggregate
+		previous, err := routineDDL(session, d, keyspace)
+		if err != nil {
+			step.Note = "could not snapshot previous definition: " + err.Error()
+			return
+		}
+		if previous == "" {
+			// A new overload
+			step.Compensation = append(step.Compensation, "DROP "+d.Kind+" IF EXISTS "+name+"("+d.Signature+")")
+		} else {
+			step.Snapshot = previous
+			step.Compensation = append(step.Compensation, strings.Replace(previous, "CREATE "+d.Kind, "CREATE OR REPLACE "+d.Kind, 1))
+		}
+		step.Reversible = true
+
+	case "DROP":
+		existed, err := schemaObjectExists(session, d, keyspace)
+		if err != nil {
+			step.Note = "could not check existing schema: " + err.Error()
+			return
+		}
+		if !existed {
+			step.Reversible = true
+			step.Note = "object did not exist; statement made no change"
+			return
+		}
+		snapshot, err := objectDDL(session, d, keyspace)
+		if err != nil {
+			step.Note = "could not snapshot object: " + err.Error()
+			return
+		}
+		statements, err := batch.SplitForNode(snapshot)
+		if err != nil || len(statements) == 0 {
+			step.Snapshot = snapshot
+			step.Note = "could not split snapshot DDL"
+			return
+		}
+		step.Snapshot = snapshot
+		step.Compensation = statements
+		step.Reversible = true
+		switch d.Kind {
+		case cql.KindKeyspace, cql.KindTable:
+			step.Note = "re-creates the schema only; dropped data is not restored"
+		case cql.KindIndex, cql.KindView:
+			step.Note = "re-created from the base table, which may take time on large tables"
+		}
+
+	case "ALTER":
+		compensateAlter(session, d, keyspace, name, step)
+	}
+}
+
+// compensateAlter reverts ALTER KEYSPACE, ALTER TABLE and ALTER TYPE where the
+// previous state can be expressed as another ALTER
+func compensateAlter(session *gocql.Session, d *cql.DDLStatement, keyspace, name string, step *RollbackStep) {
+	alter := "ALTER " + d.Kind + " " + name
+
+	switch {
+	case d.Kind == cql.KindKeyspace:
+		ks, err := ddlGetKeyspaceInfo(session, keyspace)
+		if err != nil {
+			step.Note = "could not snapshot keyspace: " + err.Error()
+			return
+		}
+		previous := strings.TrimSuffix(generateCreateKeyspace(ks), ";")
+		step.Snapshot = previous + ";"
+		previous = strings.Replace(previous, "CREATE KEYSPACE", "ALTER KEYSPACE", 1)
+		if ks.DurableWrites {
+			previous += " AND durable_writes = true"
+		}
+		step.Compensation = append(step.Compensation, previous)
+		step.Reversible = true
+
+	case d.AlterOp == "RENAME":
+		var pairs []string
+		for i := len(d.Renames) - 1; i >= 0; i-- {
+			pairs = append(pairs, quoteIdentifier(d.Renames[i].To)+" TO "+quoteIdentifier(d.Renames[i].From))
+		}
+		step.Compensation = append(step.Compensation, alter+" RENAME "+strings.Join(pairs, " AND "))
+		step.Reversible = len(pairs) > 0
+
+	case d.Kind == cql.KindTable && d.AlterOp == "ADD":
+		for _, col := range d.Columns {
+			step.Compensation = append(step.Compensation, alter+" DROP "+quoteIdentifier(col))
+		}
+		step.Reversible = len(d.Columns) > 0
+		step.Note = "data written to the added columns is lost"
+
+	case d.Kind == cql.KindTable && d.AlterOp == "DROP":
+		columns, err := ddlGetColumns(session, keyspace, d.Name)
+		if err != nil {
+			step.Note = "could not snapshot columns: " + err.Error()
+			return
+		}
+		types := make(map[string]string, len(columns))
+		for _, col := range columns {
+			colType := col.Type
+			if col.Kind == "static" {
+				colType += " STATIC"
+			}
+			types[col.Name] = colType
+		}
+		for _, col := range d.Columns {
+			colType, ok := types[col]
+			if !ok {
+				step.Compensation = []string{}
+				step.Note = "column " + col + " not found"
+				return
+			}
+			step.Compensation = append(step.Compensation, alter+" ADD "+quoteIdentifier(col)+" "+colType)
+		}
+		step.Reversible = len(d.Columns) > 0
+		step.Note = "re-adds the columns only; dropped values are not restored"
+
+	case d.Kind == cql.KindType && d.AlterOp == "ADD":
+		step.Note = "fields cannot be removed from a user type"
+
+	default:
+		// Option changes and column type changes: keep the previous definition for manual recovery
+		if snapshot, err := objectDDL(session, d, keyspace); err == nil {
+			step.Snapshot = snapshot
+		}
+		step.Note = "ALTER " + d.Kind + " " + d.AlterOp + " cannot be reverted automatically; see snapshot"
+	}
+}
+
+// schemaObjectExists reports whether the object a statement names is in system_schema
+func schemaObjectExists(session *gocql.Session, d *cql.DDLStatement, keyspace string) (bool, error) {
+	var query string
+	args := []interface{}{keyspace, d.Name}
+	switch d.Kind {
+	case cql.KindKeyspace:
+		query = "SELECT keyspace_name FROM system_schema.keyspaces WHERE keyspace_name = ?"
+		args = args[:1]
+	case cql.KindTable:
+		query = "SELECT table_name FROM system_schema.tables WHERE keyspace_name = ? AND table_name = ?"
+	case cql.KindView:
+		query = "SELECT view_name FROM system_schema.views WHERE keyspace_name = ? AND view_name = ?"
+	case cql.KindType:
+		query = "SELECT type_name FROM system_schema.types WHERE keyspace_name = ? AND type_name = ?"
+	case cql.KindIndex:
+		table, err := indexTable(session, keyspace, d.Name)
+		return table != "", err
+	case cql.KindFunction, cql.KindAggregate:
+		previous, err := routineDDL(session, d, keyspace)
+		return previous != "", err
+	default:
+		return false, fmt.Errorf("unsupported object kind %s", d.Kind)
+	}
+
+	var name string
+	err := session.Query(query, args...).Scan(&name)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// indexTable returns the table an index belongs to, or "" if there is no such index
+func indexTable(session *gocql.Session, keyspace, index string) (string, error) {
+	iter := session.Query("SELECT table_name, index_name FROM system_schema.indexes WHERE keyspace_name = ?", keyspace).Iter()
+	var table, name, found string
+	for iter.Scan(&table, &name) {
+		if name == index {
+			found = table
+		}
+	}
+	return found, iter.Close()
+}
+
+// routineDDL returns the CREATE statement of a function or aggregate overload.
+// Without a signature the first overload is used, as DROP does when the name is unique.
+func routineDDL(session *gocql.Session, d *cql.DDLStatement, keyspace string) (string, error) {
+	signature := normalizeSignature(d.Signature)
+
+	if d.Kind == cql.KindAggregate {
+		aggregates, err := ddlGetAggregates(session, keyspace)
+		if err != nil {
+			return "", err
+		}
+		for _, a := range aggregates {
+			if a.Name == d.Name && (signature == "" || normalizeSignature(strings.Join(a.ArgumentTypes, ",")) == signature) {
+				return generateCreateAggregate(keyspace, a), nil
+			}
+		}
+		return "", nil
+	}
+
+	functions, err := ddlGetFunctions(session, keyspace)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range functions {
+		if f.Name == d.Name && (signature == "" || normalizeSignature(strings.Join(f.ArgumentTypes, ",")) == signature) {
+			return generateCreateFunction(keyspace, f), nil
+		}
+	}
+	return "", nil
+}
+
+// normalizeSignature makes argument type lists comparable
+func normalizeSignature(signature string) string {
+	return strings.ToLower(strings.Join(strings.Fields(signature), ""))
+}
+
+// objectDDL returns the current CREATE statements for the object a statement names
+func objectDDL(session *gocql.Session, d *cql.DDLStatement, keyspace string) (string, error) {
+	var result *DDLResult
+	var err error
+	switch d.Kind {
+	case cql.KindKeyspace:
+		result, err = generateKeyspaceDDL(session, keyspace)
+	case cql.KindTable:
+		ddl, tableErr := generateFullTableDDL(session, keyspace, d.Name)
+		return strings.TrimSpace(ddl), tableErr
+	case cql.KindType:
+		result, err = generateTypeDDL(session, keyspace, d.Name)
+	case cql.KindView:
+		result, err = generateViewDDL(session, keyspace, d.Name)
+	case cql.KindIndex:
+		table, tableErr := indexTable(session, keyspace, d.Name)
+		if tableErr != nil {
+			return "", tableErr
+		}
+		result, err = generateIndexDDL(session, keyspace, table, d.Name)
+	case cql.KindFunction, cql.KindAggregate:
+		return routineDDL(session, d, keyspace)
+	default:
+		return "", fmt.Errorf("unsupported object kind %s", d.Kind)
+	}
+	if err != nil {
+		return "", err
+	}
+	return result.DDL, nil
+}
+
+// RollbackResult reports the outcome of executing a rollback plan
+type RollbackResult struct {
+	Plan     *SavepointPlan `json:"plan"`
+	Executed bool           `json:"executed"`
+	Done     int            `json:"done"`
+	Failed   int            `json:"failed"`
+	Skipped  int            `json:"skipped"` // Irreversible steps left for manual recovery
+}
+
+// executeRollbackPlan runs the compensating statements of a plan in order. It
+// stops at the first failure, since later steps assume the earlier ones ran.
+func executeRollbackPlan(handle int, session *db.Session, plan *SavepointPlan) *RollbackResult {
+	result := &RollbackResult{Plan: plan, Executed: true}
+	gocqlSession := session.GocqlSession()
+
+	failed := false
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		switch {
+		case failed:
+			continue
+		case !step.Reversible:
+			step.Status = rollbackStatusSkipped
+			result.Skipped++
+			continue
+		}
+
+		step.Status = rollbackStatusDone
+		for _, stmt := range step.Compensation {
+			if err := gocqlSession.Query(stmt).Exec(); err != nil {
+				step.Status = rollbackStatusFailed
+				step.Error = fmt.Sprintf("%s: %v", stmt, err)
+				failed = true
+				break
+			}
+		}
+		if failed {
+			result.Failed++
+		} else {
+			result.Done++
+		}
+	}
+
+	plan.RolledBack = !failed
+	rollbackPlansLock.Lock()
+	if current := rollbackPlans[handle]; current != nil && current.ID == plan.ID {
+		if failed {
+			// Keep the steps that still need to run for a retry
+			var remaining []RollbackStep
+			for _, step := range plan.Steps {
+				if step.Status != rollbackStatusDone {
+					step.Status = ""
+					step.Error = ""
+					remaining = append(remaining, step)
+				}
+			}
+			current.Steps = remaining
+		} else {
+			current.RolledBack = true
+			current.Steps = plan.Steps
+		}
+	}
+	rollbackPlansLock.Unlock()
+
+	return result
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Scan guard
+//
+// A SELECT that does not restrict the whole partition key with = or IN reads
+// every partition of the table. When a session sets a limit, such queries are
+// checked against system.size_estimates before they run and refused when the
+// estimate exceeds it. The caller can run the query anyway with force.
+
+// ScanGuardOptions configures the scan guard of a session
+type ScanGuardOptions struct {
+	MaxPartitions int64 `json:"maxPartitions"` // Refuse scans estimated above this many partitions (0 = disabled)
+}
+
+// ScanEstimate is returned with a refused query
+type ScanEstimate struct {
+	Keyspace            string `json:"keyspace"`
+	Table               string `json:"table"`
+	EstimatedPartitions int64  `json:"estimatedPartitions"`
+	MaxPartitions       int64  `json:"maxPartitions"`
+}
+
+// Scan guard limits per session handle
+var (
+	scanGuards     = make(map[int]ScanGuardOptions)
+	scanGuardsLock sync.Mutex
+)
+
+// setScanGuard replaces the session's scan guard; a zero limit disables it
+func setScanGuard(handle int, opts ScanGuardOptions) {
+	scanGuardsLock.Lock()
+	defer scanGuardsLock.Unlock()
+	if opts.MaxPartitions <= 0 {
+		delete(scanGuards, handle)
+		return
+	}
+	scanGuards[handle] = opts
+}
+
+// getScanGuard returns the session's scan guard, disabled by default
+func getScanGuard(handle int) ScanGuardOptions {
+	scanGuardsLock.Lock()
+	defer scanGuardsLock.Unlock()
+	return scanGuards[handle]
+}
+
+// discardScanGuard forgets the session's scan guard when the session is closed
+func discardScanGuard(handle int) {
+	scanGuardsLock.Lock()
+	delete(scanGuards, handle)
+	scanGuardsLock.Unlock()
+}
+
+// checkScanGuard returns the estimate when query is a partition scan larger
+// than the session allows, or nil when it may run. Queries that cannot be
+// analyzed (not a SELECT, unknown table) are left to the server.
+func checkScanGuard(handle int, session *db.Session, query string, force bool) *ScanEstimate {
+	guard := getScanGuard(handle)
+	if guard.MaxPartitions <= 0 || force {
+		return nil
+	}
+
+	analysis, err := cql.AnalyzeSelect(query)
+	if err != nil {
+		return nil
+	}
+	keyspace := analysis.Keyspace
+	if keyspace == "" {
+		keyspace = session.Keyspace()
+	}
+	keys, err := tableKeys(session, keyspace, analysis.Table)
+	if err != nil {
+		return nil
+	}
+	if cql.RestrictsPartitionKey(cql.SplitConditions(analysis.Where), keys) {
+		return nil
+	}
+
+	// A small LIMIT stops the scan early unless rows are filtered or aggregated
+	if analysis.Limit > 0 && int64(analysis.Limit) <= guard.MaxPartitions && !analysis.AllowFiltering && !analysis.HasAggregates {
+		return nil
+	}
+
+	estimated := estimateTableRows(session, keyspace, analysis.Table)
+	if estimated <= guard.MaxPartitions {
+		return nil
+	}
+	return &ScanEstimate{
+		Keyspace:            keyspace,
+		Table:               analysis.Table,
+		EstimatedPartitions: estimated,
+		MaxPartitions:       guard.MaxPartitions,
+	}
+}
+
+// scanGuardMessage describes a refused query
+func scanGuardMessage(estimate *ScanEstimate) string {
+	return fmt.Sprintf("Query scans %s.%s, estimated at %d partitions (limit %d); restrict the partition key or run it with force",
+		estimate.Keyspace, estimate.Table, estimate.EstimatedPartitions, estimate.MaxPartitions)
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bulk operation scheduling
+//
+// COPY, source execution, partition scans and table comparisons can each keep
+// the cluster busy for minutes. When several sessions in one process run them
+// at once, admission goes through a process-wide scheduler:
+//
+//   - At most maxBulkOperations bulk operations run at a time, and each handle
+//     is limited to its own maxConcurrent.
+//   - Free slots go to the waiting handle that has received the least service
+//     relative to its weight (start-time fair queuing), so a handle that queues
+//     many jobs cannot starve one that queues a single job.
+//   - While interactive queries (ExecuteQuery, paging, browsing) are in flight,
+//     interactiveReserve slots are withheld from new bulk operations. Running
+//     operations are not preempted.
+//
+// Interactive queries are never queued; they are only counted.
+
+// Scheduler defaults
+const (
+	defaultMaxBulkOperations  = 4
+	defaultInteractiveReserve = 1
+	defaultHandleWeight       = 1
+	defaultHandleConcurrency  = 2
+)
+
+// errOperationCancelled is returned to a bulk operation cancelled while queued
+var errOperationCancelled = errors.New("operation cancelled while waiting for a scheduler slot")
+
+// SchedulerConfig holds the process-wide scheduler limits
+type SchedulerConfig struct {
+	MaxBulkOperations  int `json:"maxBulkOperations"`  // Bulk operations running at once across all handles
+	InteractiveReserve int `json:"interactiveReserve"` // Slots withheld from bulk work while interactive queries run
+}
+
+// scheduledOp is a bulk operation in the operations registry
+type scheduledOp struct {
+	id        int64
+	handle    int
+	kind      string // e.g. "copyFrom", "sourceFiles"
+	running   bool
+	queuedAt  time.Time
+	startedAt time.Time
+	ready     chan struct{} // Closed when the operation is admitted or cancelled
+	err       error         // Set when cancelled while queued
+	sched     *handleSchedule
+}
+
+// handleSchedule is the scheduling state of one session handle
+type handleSchedule struct {
+	weight        int
+	maxConcurrent int
+	running       int
+	queue         []*scheduledOp
+	vtime         float64 // Service received, in slots divided by weight
+	completed     int64
+	totalWait     time.Duration
+}
+
+// scheduler admits bulk operations; see the comment at the top of the file
+type scheduler struct {
+	mu          sync.Mutex
+	config      SchedulerConfig
+	running     int
+	interactive int
+	handles     map[int]*handleSchedule
+	ops         map[int64]*scheduledOp
+	nextID      int64
+}
+
+var bulkScheduler = &scheduler{
+	config: SchedulerConfig{
+		MaxBulkOperations:  defaultMaxBulkOperations,
+		InteractiveReserve: defaultInteractiveReserve,
+	},
+	handles: make(map[int]*handleSchedule),
+	ops:     make(map[int64]*scheduledOp),
+}
+
+// handleLocked returns the schedule for a handle, creating it with defaults
+func (s *scheduler) handleLocked(handle int) *handleSchedule {
+	hs := s.handles[handle]
+	if hs == nil {
+		hs = &handleSchedule{weight: defaultHandleWeight, maxConcurrent: defaultHandleConcurrency}
+		s.handles[handle] = hs
+	}
+	return hs
+}
+
+// capacityLocked is the number of bulk operations that may run right now
+func (s *scheduler) capacityLocked() int {
+	capacity := s.config.MaxBulkOperations
+	if s.interactive > 0 {
+		capacity -= s.config.InteractiveReserve
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	return capacity
+}
+
+// dispatchLocked admits queued operations while there are free slots
+func (s *scheduler) dispatchLocked() {
+	for s.running < s.capacityLocked() {
+		var next *handleSchedule
+		for _, hs := range s.handles {
+			if len(hs.queue) == 0 || hs.running >= hs.maxConcurrent {
+				continue
+			}
+			if next == nil || hs.vtime < next.vtime {
+				next = hs
+			}
+		}
+		if next == nil {
+			return
+		}
+
+		op := next.queue[0]
+		next.queue = next.queue[1:]
+		next.running++
+		next.vtime += 1 / float64(next.weight)
+		next.totalWait += time.Since(op.queuedAt)
+		s.running++
+		op.running = true
+		op.startedAt = time.Now()
+		close(op.ready)
+	}
+}
+
+// busyVtimeLocked returns the lowest service level among handles with work,
+// so a handle that was idle cannot claim the service it did not use
+func (s *scheduler) busyVtimeLocked() (float64, bool) {
+	lowest, found := 0.0, false
+	for _, hs := range s.handles {
+		if hs.running == 0 && len(hs.queue) == 0 {
+			continue
+		}
+		if !found || hs.vtime < lowest {
+			lowest, found = hs.vtime, true
+		}
+	}
+	return lowest, found
+}
+
+// acquireBulk waits for a slot for a bulk operation on a handle. The returned
+// function releases the slot and must be called when the operation ends.
+func acquireBulk(handle int, kind string) (func(), error) {
+	return acquireBulkContext(context.Background(), handle, kind)
+}
+
+// acquireBulkContext is acquireBulk for a cancellable call; cancelling ctx
+// while the operation is queued gives up its place
+func acquireBulkContext(ctx context.Context, handle int, kind string) (func(), error) {
+	s := bulkScheduler
+	s.mu.Lock()
+	hs := s.handleLocked(handle)
+	if hs.running == 0 && len(hs.queue) == 0 {
+		if busy, ok := s.busyVtimeLocked(); ok && busy > hs.vtime {
+			hs.vtime = busy
+		}
+	}
+	s.nextID++
+	op := &scheduledOp{
+		id:       s.nextID,
+		handle:   handle,
+		kind:     kind,
+		queuedAt: time.Now(),
+		ready:    make(chan struct{}),
+		sched:    hs,
+	}
+	s.ops[op.id] = op
+	hs.queue = append(hs.queue, op)
+	s.dispatchLocked()
+	s.mu.Unlock()
+
+	select {
+	case <-op.ready:
+	case <-ctx.Done():
+		// ready is closed under s.mu, so it cannot be admitted meanwhile
+		s.mu.Lock()
+		select {
+		case <-op.ready:
+			s.mu.Unlock()
+		default:
+			hs.queue = slices.DeleteFunc(hs.queue, func(queued *scheduledOp) bool { return queued == op })
+			delete(s.ops, op.id)
+			s.mu.Unlock()
+			return nil, errOperationCancelled
+		}
+	}
+	if op.err != nil {
+		return nil, op.err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.ops, op.id)
+			op.sched.running--
+			op.sched.completed++
+			s.running--
+			s.dispatchLocked()
+		})
+	}, nil
+}
+
+// beginInteractive counts an interactive query until the returned function is called
+func beginInteractive() func() {
+	s := bulkScheduler
+	s.mu.Lock()
+	s.interactive++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.interactive--
+			if s.interactive == 0 {
+				s.dispatchLocked()
+			}
+		})
+	}
+}
+
+// cancelQueuedBulk fails the operations of a handle that are still waiting for
+// a slot and returns how many there were
+func cancelQueuedBulk(handle int) int {
+	s := bulkScheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hs := s.handles[handle]
+	if hs == nil {
+		return 0
+	}
+	cancelled := len(hs.queue)
+	for _, op := range hs.queue {
+		op.err = errOperationCancelled
+		delete(s.ops, op.id)
+		close(op.ready)
+	}
+	hs.queue = nil
+	return cancelled
+}
+
+// removeSchedulerHandle drops a closed handle's schedule. Operations still
+// running keep their own reference and release their slot normally.
+func removeSchedulerHandle(handle int) {
+	cancelQueuedBulk(handle)
+	s := bulkScheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.handles, handle)
+}
+
+// SchedulerConfigUpdate changes the process-wide limits; omitted fields keep their value
+type SchedulerConfigUpdate struct {
+	MaxBulkOperations  *int `json:"maxBulkOperations"`
+	InteractiveReserve *int `json:"interactiveReserve"`
+}
+
+// configureScheduler applies an update to the process-wide limits
+func configureScheduler(update SchedulerConfigUpdate) (SchedulerConfig, error) {
+	if update.MaxBulkOperations != nil && *update.MaxBulkOperations < 1 {
+		return SchedulerConfig{}, fmt.Errorf("maxBulkOperations must be at least 1")
+	}
+	if update.InteractiveReserve != nil && *update.InteractiveReserve < 0 {
+		return SchedulerConfig{}, fmt.Errorf("interactiveReserve must not be negative")
+	}
+
+	s := bulkScheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if update.MaxBulkOperations != nil {
+		s.config.MaxBulkOperations = *update.MaxBulkOperations
+	}
+	if update.InteractiveReserve != nil {
+		s.config.InteractiveReserve = *update.InteractiveReserve
+	}
+	s.dispatchLocked()
+	return s.config, nil
+}
+
+// setHandleSchedule sets a handle's weight and concurrency limit; values <= 0 keep the current setting
+func setHandleSchedule(handle, weight, maxConcurrent int) (int, int) {
+	s := bulkScheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hs := s.handleLocked(handle)
+	if weight > 0 {
+		hs.weight = weight
+	}
+	if maxConcurrent > 0 {
+		hs.maxConcurrent = maxConcurrent
+	}
+	s.dispatchLocked()
+	return hs.weight, hs.maxConcurrent
+}
+
+// HandleSchedulerStats reports the scheduling state of one handle
+type HandleSchedulerStats struct {
+	Handle        int     `json:"handle"`
+	Weight        int     `json:"weight"`
+	MaxConcurrent int     `json:"maxConcurrent"`
+	Running       int     `json:"running"`
+	Queued        int     `json:"queued"`
+	Completed     int64   `json:"completed"`
+	AvgWaitMs     float64 `json:"avgWaitMs"` // Mean time admitted operations spent queued
+}
+
+// ScheduledOperation is an entry of the operations registry
+type ScheduledOperation struct {
+	ID        int64  `json:"id"`
+	Handle    int    `json:"handle"`
+	Kind      string `json:"kind"`
+	State     string `json:"state"` // "queued" or "running"
+	QueuedAt  string `json:"queuedAt"`
+	StartedAt string `json:"startedAt,omitempty"`
+	WaitMs    int64  `json:"waitMs"`
+}
+
+// SchedulerStats is the result of GetSchedulerStats
+type SchedulerStats struct {
+	SchedulerConfig
+	Capacity            int                    `json:"capacity"` // Bulk slots available right now
+	RunningBulk         int                    `json:"runningBulk"`
+	QueuedBulk          int                    `json:"queuedBulk"`
+	InteractiveInFlight int                    `json:"interactiveInFlight"`
+	Handles             []HandleSchedulerStats `json:"handles"`
+	Operations          []ScheduledOperation   `json:"operations"`
+}
+
+// schedulerStats snapshots the scheduler and its operations registry
+func schedulerStats() *SchedulerStats {
+	s := bulkScheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := &SchedulerStats{
+		SchedulerConfig:     s.config,
+		Capacity:            s.capacityLocked(),
+		RunningBulk:         s.running,
+		InteractiveInFlight: s.interactive,
+		Handles:             make([]HandleSchedulerStats, 0, len(s.handles)),
+		Operations:          make([]ScheduledOperation, 0, len(s.ops)),
+	}
+
+	for handle, hs := range s.handles {
+		hstats := HandleSchedulerStats{
+			Handle:        handle,
+			Weight:        hs.weight,
+			MaxConcurrent: hs.maxConcurrent,
+			Running:       hs.running,
+			Queued:        len(hs.queue),
+			Completed:     hs.completed,
+		}
+		if admitted := hs.completed + int64(hs.running); admitted > 0 {
+			hstats.AvgWaitMs = float64(hs.totalWait.Milliseconds()) / float64(admitted)
+		}
+		stats.QueuedBulk += len(hs.queue)
+		stats.Handles = append(stats.Handles, hstats)
+	}
+	sort.Slice(stats.Handles, func(i, j int) bool { return stats.Handles[i].Handle < stats.Handles[j].Handle })
+
+	now := time.Now()
+	for _, op := range s.ops {
+		entry := ScheduledOperation{
+			ID:       op.id,
+			Handle:   op.handle,
+			Kind:     op.kind,
+			State:    "queued",
+			QueuedAt: op.queuedAt.UTC().Format(time.RFC3339Nano),
+			WaitMs:   now.Sub(op.queuedAt).Milliseconds(),
+		}
+		if op.running {
+			entry.State = "running"
+			entry.StartedAt = op.startedAt.UTC().Format(time.RFC3339Nano)
+			entry.WaitMs = op.startedAt.Sub(op.queuedAt).Milliseconds()
+		}
+		stats.Operations = append(stats.Operations, entry)
+	}
+	sort.Slice(stats.Operations, func(i, j int) bool { return stats.Operations[i].ID < stats.Operations[j].ID })
+
+	return stats
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Schema comparison
+//
+// CompareSchemas diffs two schemas, each read from a session or given as the
+// metadata GetClusterMetadata returned earlier, and lists the CQL that turns
+// the "from" schema into the "to" schema. PlanSchemaMigration does the same
+// from a live cluster to a schema written as CQL (see schema_plan.go).
+// Keyspaces, user types, tables, columns and secondary indexes are compared;
+// materialized views only by name, and functions and aggregates not at all.
+// System and virtual keyspaces are skipped. Some differences cannot be
+// reconciled with ALTER (a changed primary key or column type, a removed type
+// field); they are listed as warnings and get no statement.
+
+// SchemaSource is one side of CompareSchemas: a session handle or metadata
+// exported with GetClusterMetadata
+type SchemaSource struct {
+	Handle   *int             `json:"handle,omitempty"`
+	Metadata *ClusterMetadata `json:"metadata,omitempty"`
+}
+
+// CompareSchemasOptions are the options of CompareSchemas
+type CompareSchemasOptions struct {
+	From      SchemaSource `json:"from"`      // The schema as it is
+	To        SchemaSource `json:"to"`        // The schema wanted
+	Keyspaces []string     `json:"keyspaces"` // Compare only these keyspaces (default: all non-system keyspaces)
+}
+
+// SchemaChange is one difference between the schemas, seen from "from" to "to"
+type SchemaChange struct {
+	Object   string `json:"object"` // keyspace, type, field, table, column, index or view
+	Change   string `json:"change"` // added (only in "to"), removed (only in "from") or changed
+	Keyspace string `json:"keyspace"`
+	Parent   string `json:"parent,omitempty"` // Table of a column, index or view, type of a field
+	Name     string `json:"name"`
+	From     string `json:"from,omitempty"` // Definition in "from", e.g. a column type
+	To       string `json:"to,omitempty"`   // Definition in "to"
+}
+
+// SchemaDiff is the result of CompareSchemas
+type SchemaDiff struct {
+	Identical  bool           `json:"identical"`
+	Changes    []SchemaChange `json:"changes"`
+	Statements []string       `json:"statements"`        // CQL that turns "from" into "to", in the order to run it
+	Warnings   []string       `json:"warnings"`          // Differences no statement can reconcile
+	Skipped    []string       `json:"skipped,omitempty"` // DROP statements left out because drops are not allowed
+}
+
+// Statement phases of a schema diff. Objects are created before what uses
+// them and dropped after it.
+const (
+	phaseKeyspaces = iota
+	phaseTypes
+	phaseTables
+	phaseDropViews
+	phaseDropIndexes
+	phaseCreateIndexes
+	phaseCreateViews
+	phaseDropColumns
+	phaseDropTables
+	phaseDropTypes
+	phaseDropKeyspaces
+	phaseCount
+)
+
+// schemaDiffer accumulates the diff
+type schemaDiffer struct {
+	diff       *SchemaDiff
+	phases     [phaseCount][]string
+	allowDrops bool
+}
+
+func (d *schemaDiffer) change(c SchemaChange) {
+	d.diff.Changes = append(d.diff.Changes, c)
+}
+
+func (d *schemaDiffer) statement(phase int, stmt string) {
+	d.phases[phase] = append(d.phases[phase], stmt)
+}
+
+// drop adds a statement that drops something, or records it as skipped
+// when drops are not allowed
+func (d *schemaDiffer) drop(phase int, stmt string) {
+	if !d.allowDrops {
+		d.diff.Skipped = append(d.diff.Skipped, stmt)
+		return
+	}
+	d.statement(phase, stmt)
+}
+
+func (d *schemaDiffer) warn(format string, args ...interface{}) {
+	d.diff.Warnings = append(d.diff.Warnings, fmt.Sprintf(format, args...))
+}
+
+// compareSchemas diffs two cluster metadata snapshots. Without allowDrops
+// the statements that drop keyspaces, tables, columns, types, indexes and
+// views are listed in Skipped instead.
+func compareSchemas(from, to *ClusterMetadata, keyspaces []string, allowDrops bool) *SchemaDiff {
+	d := &schemaDiffer{allowDrops: allowDrops, diff: &SchemaDiff{
+		Changes:    []SchemaChange{},
+		Statements: []string{},
+		Warnings:   []string{},
+	}}
+	fromKs := comparableKeyspaces(from, keyspaces)
+	toKs := comparableKeyspaces(to, keyspaces)
+
+	for _, name := range unionKeys(fromKs, toKs) {
+		before, inFrom := fromKs[name]
+		after, inTo := toKs[name]
+		switch {
+		case !inFrom:
+			d.change(SchemaChange{Object: "keyspace", Change: "added", Keyspace: name, Name: name, To: replicationString(after.ReplicationStrategy)})
+			d.createKeyspace(after)
+		case !inTo:
+			d.change(SchemaChange{Object: "keyspace", Change: "removed", Keyspace: name, Name: name, From: replicationString(before.ReplicationStrategy)})
+			d.drop(phaseDropKeyspaces, fmt.Sprintf("DROP KEYSPACE %s;", quoteIdentifier(name)))
+		default:
+			d.compareKeyspace(before, after)
+		}
+	}
+
+	for _, stmts := range d.phases {
+		d.diff.Statements = append(d.diff.Statements, stmts...)
+	}
+	d.diff.Identical = len(d.diff.Changes) == 0
+	return d.diff
+}
+
+// comparableKeyspaces indexes the keyspaces to compare by name
+func comparableKeyspaces(metadata *ClusterMetadata, only []string) map[string]KeyspaceInfo {
+	wanted := make(map[string]bool, len(only))
+	for _, name := range only {
+		wanted[name] = true
+	}
+	keyspaces := make(map[string]KeyspaceInfo)
+	for _, ks := range metadata.Keyspaces {
+		if ks.Virtual || isSystemKeyspace(ks.Name) || (len(wanted) > 0 && !wanted[ks.Name]) {
+			continue
+		}
+		keyspaces[ks.Name] = ks
+	}
+	return keyspaces
+}
+
+// createKeyspace adds the statements that create a keyspace and its contents
+func (d *schemaDiffer) createKeyspace(ks KeyspaceInfo) {
+	d.statement(phaseKeyspaces, generateCreateKeyspace(ddlKeyspaceInfo{
+		Name:          ks.Name,
+		Replication:   replicationStrings(ks.ReplicationStrategy),
+		DurableWrites: ks.DurableWrites,
+	}))
+	for _, t := range typesInCreateOrder(ks) {
+		d.statement(phaseTypes, createTypeStatement(ks.Name, t))
+	}
+	for _, t := range ks.Tables {
+		d.createTable(ks.Name, t)
+	}
+	for _, v := range ks.Views {
+		d.createView(ks.Name, v)
+	}
+}
+
+// compareKeyspace diffs a keyspace present on both sides
+func (d *schemaDiffer) compareKeyspace(from, to KeyspaceInfo) {
+	fromRepl, toRepl := replicationString(from.ReplicationStrategy), replicationString(to.ReplicationStrategy)
+	if fromRepl != toRepl || from.DurableWrites != to.DurableWrites {
+		d.change(SchemaChange{
+			Object: "keyspace", Change: "changed", Keyspace: to.Name, Name: to.Name,
+			From: fmt.Sprintf("%s durable_writes=%t", fromRepl, from.DurableWrites),
+			To:   fmt.Sprintf("%s durable_writes=%t", toRepl, to.DurableWrites),
+		})
+		d.statement(phaseKeyspaces, fmt.Sprintf("ALTER KEYSPACE %s WITH replication = %s AND durable_writes = %t;",
+			quoteIdentifier(to.Name), toRepl, to.DurableWrites))
+	}
+
+	d.compareTypes(to.Name, from, to)
+	d.compareTables(to.Name, from.Tables, to.Tables)
+	d.compareViews(to.Name, from.Views, to.Views)
+}
+
+// compareTypes diffs the user types of a keyspace
+func (d *schemaDiffer) compareTypes(keyspace string, from, to KeyspaceInfo) {
+	fromTypes := make(map[string]UserTypeInfo)
+	for _, t := range from.UserTypes {
+		fromTypes[t.Name] = t
+	}
+	toTypes := make(map[string]UserTypeInfo)
+	for _, t := range to.UserTypes {
+		toTypes[t.Name] = t
+	}
+
+	for _, t := range typesInCreateOrder(to) {
+		if _, ok := fromTypes[t.Name]; !ok {
+			d.change(SchemaChange{Object: "type", Change: "added", Keyspace: keyspace, Name: t.Name})
+			d.statement(phaseTypes, createTypeStatement(keyspace, t))
+		}
+	}
+	for _, name := range unionKeys(fromTypes, toTypes) {
+		before, inFrom := fromTypes[name]
+		after, inTo := toTypes[name]
+		switch {
+		case !inFrom:
+			// Created above, in dependency order
+		case !inTo:
+			d.change(SchemaChange{Object: "type", Change: "removed", Keyspace: keyspace, Name: name})
+		default:
+			d.compareTypeFields(keyspace, before, after)
+		}
+	}
+	// Types are dropped after the types that use them
+	removed := typesInCreateOrder(from)
+	for i := len(removed) - 1; i >= 0; i-- {
+		if _, ok := toTypes[removed[i].Name]; !ok {
+			d.drop(phaseDropTypes, fmt.Sprintf("DROP TYPE %s.%s;", quoteIdentifier(keyspace), quoteIdentifier(removed[i].Name)))
+		}
+	}
+}
+
+// compareTypeFields diffs the fields of a user type present on both sides.
+// Fields can be added to a type but not dropped or retyped.
+func (d *schemaDiffer) compareTypeFields(keyspace string, from, to UserTypeInfo) {
+	fromFields := make(map[string]string, len(from.FieldNames))
+	for i, name := range from.FieldNames {
+		fromFields[name] = from.FieldTypes[i]
+	}
+	toFields := make(map[string]bool, len(to.FieldNames))
+	qualified := quoteIdentifier(keyspace) + "." + quoteIdentifier(to.Name)
+
+	for i, name := range to.FieldNames {
+		toFields[name] = true
+		fieldType := to.FieldTypes[i]
+		before, ok := fromFields[name]
+		switch {
+		case !ok:
+			d.change(SchemaChange{Object: "field", Change: "added", Keyspace: keyspace, Parent: to.Name, Name: name, To: fieldType})
+			d.statement(phaseTypes, fmt.Sprintf("ALTER TYPE %s ADD %s %s;", qualified, quoteIdentifier(name), fieldType))
+		case !sameCQLType(before, fieldType, keyspace):
+			d.change(SchemaChange{Object: "field", Change: "changed", Keyspace: keyspace, Parent: to.Name, Name: name, From: before, To: fieldType})
+			d.warn("type %s.%s: field %s changes from %s to %s, which ALTER TYPE cannot do", keyspace, to.Name, name, before, fieldType)
+		}
+	}
+	for _, name := range from.FieldNames {
+		if !toFields[name] {
+			d.change(SchemaChange{Object: "field", Change: "removed", Keyspace: keyspace, Parent: to.Name, Name: name, From: fromFields[name]})
+			d.warn("type %s.%s: field %s is removed, which ALTER TYPE cannot do", keyspace, to.Name, name)
+		}
+	}
+}
+
+// compareTables diffs the tables of a keyspace
+func (d *schemaDiffer) compareTables(keyspace string, from, to []TableInfo) {
+	fromTables := make(map[string]TableInfo, len(from))
+	for _, t := range from {
+		fromTables[t.Name] = t
+	}
+	toTables := make(map[string]TableInfo, len(to))
+	for _, t := range to {
+		toTables[t.Name] = t
+	}
+
+	for _, name := range unionKeys(fromTables, toTables) {
+		before, inFrom := fromTables[name]
+		after, inTo := toTables[name]
+		switch {
+		case !inFrom:
+			d.change(SchemaChange{Object: "table", Change: "added", Keyspace: keyspace, Name: name, To: primaryKeyDefinition(after)})
+			d.createTable(keyspace, after)
+		case !inTo:
+			d.change(SchemaChange{Object: "table", Change: "removed", Keyspace: keyspace, Name: name, From: primaryKeyDefinition(before)})
+			d.drop(phaseDropTables, fmt.Sprintf("DROP TABLE %s.%s;", quoteIdentifier(keyspace), quoteIdentifier(name)))
+		default:
+			d.compareTable(keyspace, before, after)
+		}
+	}
+}
+
+// createTable adds the statements that create a table and its indexes
+func (d *schemaDiffer) createTable(keyspace string, t TableInfo) {
+	columns := make([]ddlColumnInfo, len(t.Columns))
+	for i, c := range t.Columns {
+		columns[i] = ddlColumnInfo{Name: c.Name, Type: c.CQLType, Kind: c.Kind, Position: c.Position}
+	}
+	d.statement(phaseTables, generateCreateTable(keyspace, ddlTableInfo{Name: t.Name, ClusteringOrder: clusteringOrder(t)}, columns))
+	for _, idx := range t.Indexes {
+		d.statement(phaseCreateIndexes, createIndexStatement(keyspace, t.Name, idx))
+	}
+}
+
+// compareTable diffs a table present on both sides
+func (d *schemaDiffer) compareTable(keyspace string, from, to TableInfo) {
+	qualified := quoteIdentifier(keyspace) + "." + quoteIdentifier(to.Name)
+	if !samePrimaryKey(from, to, keyspace) {
+		d.change(SchemaChange{Object: "table", Change: "changed", Keyspace: keyspace, Name: to.Name, From: primaryKeyDefinition(from), To: primaryKeyDefinition(to)})
+		d.warn("table %s.%s: the primary key changes, so the table must be recreated and its data copied", keyspace, to.Name)
+	}
+
+	fromColumns := make(map[string]ColumnInfo)
+	for _, c := range from.Columns {
+		fromColumns[c.Name] = c
+	}
+	toColumns := make(map[string]ColumnInfo)
+	for _, c := range to.Columns {
+		toColumns[c.Name] = c
+	}
+	for _, name := range unionKeys(fromColumns, toColumns) {
+		before, inFrom := fromColumns[name]
+		after, inTo := toColumns[name]
+		switch {
+		case !inFrom:
+			d.change(SchemaChange{Object: "column", Change: "added", Keyspace: keyspace, Parent: to.Name, Name: name, To: after.CQLType})
+			if isKeyColumn(after) {
+				continue // Covered by the primary key warning
+			}
+			static := ""
+			if after.Kind == "static" {
+				static = " STATIC"
+			}
+			d.statement(phaseTables, fmt.Sprintf("ALTER TABLE %s ADD %s %s%s;", qualified, quoteIdentifier(name), after.CQLType, static))
+		case !inTo:
+			d.change(SchemaChange{Object: "column", Change: "removed", Keyspace: keyspace, Parent: to.Name, Name: name, From: before.CQLType})
+			if !isKeyColumn(before) {
+				d.drop(phaseDropColumns, fmt.Sprintf("ALTER TABLE %s DROP %s;", qualified, quoteIdentifier(name)))
+			}
+		case !sameCQLType(before.CQLType, after.CQLType, keyspace):
+			d.change(SchemaChange{Object: "column", Change: "changed", Keyspace: keyspace, Parent: to.Name, Name: name, From: before.CQLType, To: after.CQLType})
+			if !isKeyColumn(after) {
+				d.warn("table %s.%s: column %s changes from %s to %s, which ALTER TABLE cannot do", keyspace, to.Name, name, before.CQLType, after.CQLType)
+			}
+		}
+	}
+
+	d.compareIndexes(keyspace, to.Name, from.Indexes, to.Indexes)
+}
+
+// compareIndexes diffs the indexes of a table; a changed index is dropped
+// and created again
+func (d *schemaDiffer) compareIndexes(keyspace, table string, from, to []IndexInfo) {
+	fromIndexes := make(map[string]IndexInfo, len(from))
+	for _, idx := range from {
+		fromIndexes[idx.Name] = idx
+	}
+	toIndexes := make(map[string]IndexInfo, len(to))
+	for _, idx := range to {
+		toIndexes[idx.Name] = idx
+	}
+	drop := func(name string) {
+		d.drop(phaseDropIndexes, fmt.Sprintf("DROP INDEX %s.%s;", quoteIdentifier(keyspace), quoteIdentifier(name)))
+	}
+
+	for _, name := range unionKeys(fromIndexes, toIndexes) {
+		before, inFrom := fromIndexes[name]
+		after, inTo := toIndexes[name]
+		switch {
+		case !inFrom:
+			d.change(SchemaChange{Object: "index", Change: "added", Keyspace: keyspace, Parent: table, Name: name, To: indexDefinition(after)})
+			d.statement(phaseCreateIndexes, createIndexStatement(keyspace, table, after))
+		case !inTo:
+			d.change(SchemaChange{Object: "index", Change: "removed", Keyspace: keyspace, Parent: table, Name: name, From: indexDefinition(before)})
+			drop(name)
+		case indexDefinition(before) != indexDefinition(after):
+			d.change(SchemaChange{Object: "index", Change: "changed", Keyspace: keyspace, Parent: table, Name: name, From: indexDefinition(before), To: indexDefinition(after)})
+			drop(name)
+			if d.allowDrops {
+				d.statement(phaseCreateIndexes, createIndexStatement(keyspace, table, after))
+			} else {
+				d.diff.Skipped = append(d.diff.Skipped, createIndexStatement(keyspace, table, after))
+			}
+		}
+	}
+}
+
+// compareViews diffs the materialized views of a keyspace by name. The
+// driver's metadata has no view definitions, so a view present on both sides
+// is not compared further.
+func (d *schemaDiffer) compareViews(keyspace string, from, to []ViewInfo) {
+	fromViews := make(map[string]ViewInfo, len(from))
+	for _, v := range from {
+		fromViews[v.Name] = v
+	}
+	toViews := make(map[string]ViewInfo, len(to))
+	for _, v := range to {
+		toViews[v.Name] = v
+	}
+	for _, name := range unionKeys(fromViews, toViews) {
+		before, inFrom := fromViews[name]
+		after, inTo := toViews[name]
+		switch {
+		case !inFrom:
+			d.change(SchemaChange{Object: "view", Change: "added", Keyspace: keyspace, Parent: after.BaseTableName, Name: name})
+			d.createView(keyspace, after)
+		case !inTo:
+			d.change(SchemaChange{Object: "view", Change: "removed", Keyspace: keyspace, Parent: before.BaseTableName, Name: name})
+			d.drop(phaseDropViews, fmt.Sprintf("DROP MATERIALIZED VIEW %s.%s;", quoteIdentifier(keyspace), quoteIdentifier(name)))
+		}
+	}
+}
+
+// createView adds the statement that creates a view, after its base table.
+// Only views read from CQL have one.
+func (d *schemaDiffer) createView(keyspace string, v ViewInfo) {
+	if v.statement == "" {
+		d.warn("view %s.%s: no definition to create it from", keyspace, v.Name)
+		return
+	}
+	d.statement(phaseCreateViews, v.statement)
+}
+
+// canonicalType renders a type for comparison. frozen is dropped, because
+// the driver's metadata does not report it; user types are qualified with
+// their keyspace; varchar is text.
+func canonicalType(typeStr, keyspace string) string {
+	parsed, err := db.ParseCQLType(typeStr)
+	if err != nil {
+		return strings.ToLower(typeStr)
+	}
+	var render func(t *db.CQLTypeInfo) string
+	render = func(t *db.CQLTypeInfo) string {
+		switch t.BaseType {
+		case "udt":
+			ks := t.Keyspace
+			if ks == "" {
+				ks = keyspace
+			}
+			return ks + "." + strings.Trim(t.UDTName, `"`)
+		case "varchar":
+			return "text"
+		}
+		if len(t.Parameters) == 0 {
+			return t.BaseType
+		}
+		params := make([]string, 0, len(t.Parameters)+1)
+		for _, p := range t.Parameters {
+			params = append(params, render(p))
+		}
+		if t.BaseType == "vector" {
+			params = append(params, strconv.Itoa(t.Dimension))
+		}
+		return t.BaseType + "<" + strings.Join(params, ", ") + ">"
+	}
+	return render(parsed)
+}
+
+// sameCQLType compares two type strings of a keyspace's objects
+func sameCQLType(a, b, keyspace string) bool {
+	return canonicalType(a, keyspace) == canonicalType(b, keyspace)
+}
+
+// samePrimaryKey compares the key columns, their types and clustering order
+func samePrimaryKey(a, b TableInfo, keyspace string) bool {
+	same := func(x, y []KeyInfo) bool {
+		if len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if x[i].Name != y[i].Name || x[i].IsReversed != y[i].IsReversed || !sameCQLType(x[i].CQLType, y[i].CQLType, keyspace) {
+				return false
+			}
+		}
+		return true
+	}
+	return same(a.PartitionKey, b.PartitionKey) && same(a.ClusteringKey, b.ClusteringKey)
+}
+
+// isKeyColumn reports whether a column is part of the primary key
+func isKeyColumn(c ColumnInfo) bool {
+	return c.Kind == "partition_key" || c.Kind == "clustering"
+}
+
+// primaryKeyDefinition renders a table's primary key with its column types
+// and clustering order, e.g. "((id uuid), ts timestamp DESC)"
+func primaryKeyDefinition(t TableInfo) string {
+	var partition, clustering []string
+	for _, k := range t.PartitionKey {
+		partition = append(partition, k.Name+" "+k.CQLType)
+	}
+	for _, k := range t.ClusteringKey {
+		part := k.Name + " " + k.CQLType
+		if k.IsReversed {
+			part += " DESC"
+		}
+		clustering = append(clustering, part)
+	}
+	key := "((" + strings.Join(partition, ", ") + ")"
+	if len(clustering) > 0 {
+		key += ", " + strings.Join(clustering, ", ")
+	}
+	return key + ")"
+}
+
+// clusteringOrder renders the CLUSTERING ORDER BY columns of a table
+func clusteringOrder(t TableInfo) string {
+	var parts []string
+	for _, k := range t.ClusteringKey {
+		order := "ASC"
+		if k.IsReversed {
+			order = "DESC"
+		}
+		parts = append(parts, quoteIdentifier(k.Name)+" "+order)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// indexDefinition renders what an index is, for comparison and display. The
+// class of a custom index is shortened, so that 'sai', 'StorageAttachedIndex'
+// and the full class name compare equal.
+func indexDefinition(idx IndexInfo) string {
+	definition := strings.ToUpper(idx.Kind) + " (" + idx.Options["target"] + ")"
+	var keys []string
+	for key := range idx.Options {
+		if key != "target" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := idx.Options[key]
+		if key == "class_name" {
+			value = value[strings.LastIndex(value, ".")+1:]
+			if strings.EqualFold(value, "sai") {
+				value = "StorageAttachedIndex"
+			}
+		}
+		definition += fmt.Sprintf(" %s=%s", key, value)
+	}
+	return definition
+}
+
+// createIndexStatement renders CREATE INDEX, with the index options of a
+// custom index such as SAI
+func createIndexStatement(keyspace, table string, idx IndexInfo) string {
+	return generateCreateIndex(keyspace, table, ddlIndexInfo{Name: idx.Name, Kind: idx.Kind, Options: idx.Options})
+}
+
+// createTypeStatement renders CREATE TYPE
+func createTypeStatement(keyspace string, t UserTypeInfo) string {
+	return generateCreateType(keyspace, ddlTypeInfo{Name: t.Name, Fields: t.FieldNames, Types: t.FieldTypes})
+}
+
+// typesInCreateOrder sorts a keyspace's user types so that every type comes
+// after the types its fields use
+func typesInCreateOrder(ks KeyspaceInfo) []UserTypeInfo {
+	byName := make(map[string]UserTypeInfo, len(ks.UserTypes))
+	for _, t := range ks.UserTypes {
+		byName[t.Name] = t
+	}
+	var ordered []UserTypeInfo
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		t, ok := byName[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, fieldType := range t.FieldTypes {
+			for _, used := range userTypesIn(fieldType, ks.Name) {
+				if usedKs, usedName, _ := strings.Cut(used, "."); usedKs == ks.Name {
+					visit(usedName)
+				}
+			}
+		}
+		ordered = append(ordered, t)
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered
+}
+
+// replicationStrings converts a replication map to strings, with the
+// strategy class shortened so that both spellings compare equal
+func replicationStrings(replication map[string]interface{}) map[string]string {
+	strs := make(map[string]string, len(replication))
+	for key, value := range replication {
+		str := fmt.Sprint(value)
+		if key == "class" {
+			str = strings.TrimPrefix(str, "org.apache.cassandra.locator.")
+		}
+		strs[key] = str
+	}
+	return strs
+}
+
+// replicationString renders a replication map in a stable order
+func replicationString(replication map[string]interface{}) string {
+	strs := replicationStrings(replication)
+	parts := make([]string, 0, len(strs))
+	for _, key := range unionKeys(strs, nil) {
+		parts = append(parts, fmt.Sprintf("'%s': '%s'", key, strs[key]))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// unionKeys returns the keys of two maps, sorted
+func unionKeys[V any](a, b map[string]V) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	keys := make([]string, 0, len(a)+len(b))
+	for _, m := range []map[string]V{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
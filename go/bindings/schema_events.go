@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// watchSchemaDrops invalidates the session's open paged queries when the
+// keyspace or table they read from is dropped, so the next FetchNextPage
+// reports SCHEMA_CHANGED instead of a driver error
+func watchSchemaDrops(session *db.Session) {
+	session.OnSchemaDropped(func(event db.SchemaDropEvent) {
+		invalidatePagedQueries(session, event)
+	})
+}
+
+// invalidatePagedQueries marks the paged queries affected by a drop.
+// It runs on a driver goroutine, so it only takes pagedQueriesMutex and never
+// waits for a fetch in progress.
+func invalidatePagedQueries(session *db.Session, event db.SchemaDropEvent) {
+	reason := fmt.Sprintf("keyspace %s was dropped", event.Keyspace)
+	if event.Table != "" {
+		reason = fmt.Sprintf("table %s.%s was dropped", event.Keyspace, event.Table)
+	}
+
+	pagedQueriesMutex.Lock()
+	defer pagedQueriesMutex.Unlock()
+	for _, state := range pagedQueries {
+		if state.Session != session || !affectedByDrop(state.Keyspace, state.Table, event) {
+			continue
+		}
+		state.schemaChanged.Store(&reason)
+	}
+}
+
+// affectedByDrop reports whether a query on keyspace.table is affected by the drop.
+// The query's names are as the schema has them (see schemaTableReference), so
+// they are compared exactly: "Users" and users are different tables.
+func affectedByDrop(keyspace, table string, event db.SchemaDropEvent) bool {
+	if keyspace == "" || keyspace != event.Keyspace {
+		return false
+	}
+	return event.Table == "" || table == event.Table
+}
+
+// isSchemaChangeError reports whether a driver error means the queried
+// keyspace or table no longer exists
+func isSchemaChangeError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unconfigured table") ||
+		strings.Contains(msg, "unconfigured columnfamily") ||
+		(strings.Contains(msg, "keyspace") && strings.Contains(msg, "does not exist"))
+}
+
+// Schema event subscriptions
+//
+// A client that shows the schema would otherwise have to reload the whole
+// cluster metadata to notice a change. A subscribed session queues the
+// schema changes the driver reports (see db.Session.OnSchemaChanged), for the
+// caller to collect with PollSchemaEvents. The driver reports a change once
+// it has read the new schema, whatever the session's schema cache mode.
+
+// maxSchemaEvents bounds the events kept per session; older ones are dropped
+const maxSchemaEvents = 1000
+
+// SchemaEventOptions configures a session's schema event subscription
+type SchemaEventOptions struct {
+	Enabled   *bool    `json:"enabled,omitempty"`   // false unsubscribes (default true)
+	Keyspaces []string `json:"keyspaces,omitempty"` // Only changes in these keyspaces; all when empty
+	Targets   []string `json:"targets,omitempty"`   // KEYSPACE, TABLE, TYPE, FUNCTION, AGGREGATE; all when empty
+}
+
+// SchemaEventBatch is the result of PollSchemaEvents
+type SchemaEventBatch struct {
+	Events  []db.SchemaChangeEvent `json:"events"`
+	Dropped int                    `json:"dropped"` // Events discarded because the queue was full
+}
+
+// schemaSubscription is the filter and undelivered events of one session
+type schemaSubscription struct {
+	active  bool
+	filter  schemaEventFilter
+	events  []db.SchemaChangeEvent
+	dropped int
+}
+
+// schemaEventFilter selects schema events by keyspace and target; an empty
+// set matches everything
+type schemaEventFilter struct {
+	keyspaces map[string]bool
+	targets   map[string]bool
+}
+
+// Schema event subscriptions per session handle. An entry stays after an
+// unsubscribe, since the session's handler cannot be removed.
+var (
+	schemaSubscriptions     = make(map[int]*schemaSubscription)
+	schemaSubscriptionsLock sync.Mutex
+)
+
+var schemaTargets = map[string]bool{
+	db.SchemaTargetKeyspace:  true,
+	db.SchemaTargetTable:     true,
+	db.SchemaTargetType:      true,
+	db.SchemaTargetFunction:  true,
+	db.SchemaTargetAggregate: true,
+}
+
+// newSchemaEventFilter validates the targets and builds a filter
+func newSchemaEventFilter(keyspaces, targets []string) (schemaEventFilter, error) {
+	filter := schemaEventFilter{keyspaces: make(map[string]bool), targets: make(map[string]bool)}
+	for _, t := range targets {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if !schemaTargets[t] {
+			return filter, fmt.Errorf("unknown schema event target %q", t)
+		}
+		filter.targets[t] = true
+	}
+	for _, ks := range keyspaces {
+		filter.keyspaces[strings.ToLower(ks)] = true
+	}
+	return filter, nil
+}
+
+// matches reports whether the filter selects an event
+func (f schemaEventFilter) matches(event db.SchemaChangeEvent) bool {
+	if len(f.keyspaces) > 0 && !f.keyspaces[strings.ToLower(event.Keyspace)] {
+		return false
+	}
+	return len(f.targets) == 0 || f.targets[event.Target]
+}
+
+// subscribeSchemaEvents starts or replaces the session's subscription,
+// keeping undelivered events
+func subscribeSchemaEvents(handle int, session *db.Session, opts SchemaEventOptions) error {
+	filter, err := newSchemaEventFilter(opts.Keyspaces, opts.Targets)
+	if err != nil {
+		return err
+	}
+
+	schemaSubscriptionsLock.Lock()
+	defer schemaSubscriptionsLock.Unlock()
+	sub := schemaSubscriptions[handle]
+	if sub == nil {
+		sub = &schemaSubscription{}
+		schemaSubscriptions[handle] = sub
+		session.OnSchemaChanged(func(event db.SchemaChangeEvent) {
+			queueSchemaEvent(handle, session, event)
+		})
+	}
+	sub.active = true
+	sub.filter = filter
+	return nil
+}
+
+// queueSchemaEvent runs on a driver goroutine, so it only takes
+// schemaSubscriptionsLock
+func queueSchemaEvent(handle int, session *db.Session, event db.SchemaChangeEvent) {
+	if getSession(handle) != session {
+		return
+	}
+	schemaSubscriptionsLock.Lock()
+	defer schemaSubscriptionsLock.Unlock()
+	sub := schemaSubscriptions[handle]
+	if sub == nil || !sub.active || !sub.filter.matches(event) {
+		return
+	}
+	sub.events = append(sub.events, event)
+	if len(sub.events) > maxSchemaEvents {
+		sub.dropped += len(sub.events) - maxSchemaEvents
+		sub.events = sub.events[len(sub.events)-maxSchemaEvents:]
+	}
+}
+
+// takeSchemaEvents returns and clears the session's undelivered events
+func takeSchemaEvents(handle int) SchemaEventBatch {
+	schemaSubscriptionsLock.Lock()
+	defer schemaSubscriptionsLock.Unlock()
+	batch := SchemaEventBatch{Events: []db.SchemaChangeEvent{}}
+	sub := schemaSubscriptions[handle]
+	if sub == nil {
+		return batch
+	}
+	if len(sub.events) > 0 {
+		batch.Events = sub.events
+	}
+	batch.Dropped = sub.dropped
+	sub.events = nil
+	sub.dropped = 0
+	return batch
+}
+
+// unsubscribeSchemaEvents stops queueing events and drops undelivered ones
+func unsubscribeSchemaEvents(handle int) {
+	schemaSubscriptionsLock.Lock()
+	defer schemaSubscriptionsLock.Unlock()
+	if sub := schemaSubscriptions[handle]; sub != nil {
+		sub.active = false
+		sub.events = nil
+		sub.dropped = 0
+	}
+}
+
+// discardSchemaSubscription forgets the subscription of a closed session
+func discardSchemaSubscription(handle int) {
+	schemaSubscriptionsLock.Lock()
+	defer schemaSubscriptionsLock.Unlock()
+	delete(schemaSubscriptions, handle)
+}
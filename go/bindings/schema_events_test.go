@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+func TestAffectedByDrop(t *testing.T) {
+	tests := []struct {
+		query string
+		event db.SchemaDropEvent
+		want  bool
+	}{
+		{"SELECT * FROM users", db.SchemaDropEvent{Keyspace: "app", Table: "users"}, true},
+		{"SELECT * FROM Users", db.SchemaDropEvent{Keyspace: "app", Table: "users"}, true},
+		{`SELECT * FROM "Users"`, db.SchemaDropEvent{Keyspace: "app", Table: "users"}, false},
+		{`SELECT * FROM "Users"`, db.SchemaDropEvent{Keyspace: "app", Table: "Users"}, true},
+		{"SELECT * FROM users", db.SchemaDropEvent{Keyspace: "app", Table: "Users"}, false},
+		{"SELECT * FROM users", db.SchemaDropEvent{Keyspace: "app"}, true},
+		{"SELECT * FROM users", db.SchemaDropEvent{Keyspace: "other"}, false},
+		{"SELECT * FROM users", db.SchemaDropEvent{Keyspace: "App"}, false},
+		{"SELECT * FROM Shop.orders", db.SchemaDropEvent{Keyspace: "shop", Table: "orders"}, true},
+		{`SELECT * FROM "Shop".orders`, db.SchemaDropEvent{Keyspace: "shop"}, false},
+		{`SELECT * FROM "Shop".orders`, db.SchemaDropEvent{Keyspace: "Shop", Table: "orders"}, true},
+		{"SELECT now() FROM system.local", db.SchemaDropEvent{Keyspace: "app"}, false},
+		{"SELECT 1", db.SchemaDropEvent{Keyspace: "app"}, false},
+	}
+	for _, tt := range tests {
+		keyspace, table := schemaTableReference(tt.query, "app")
+		if got := affectedByDrop(keyspace, table, tt.event); got != tt.want {
+			t.Errorf("%s (%s.%s), drop of %+v: %v, want %v", tt.query, keyspace, table, tt.event, got, tt.want)
+		}
+	}
+
+	// Results keep showing the names as written
+	if keyspace, table := parseTableReference(`SELECT * FROM "Shop".Orders`, "app"); keyspace != "Shop" || table != "Orders" {
+		t.Errorf("parseTableReference = %s.%s", keyspace, table)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/axonops/cqlai-node/internal/cql"
+)
+
+// Schema migration planning
+//
+// PlanSchemaMigration takes the schema a cluster should have, written as CQL
+// (a script of CREATE statements, as DESCRIBE prints it) or given as
+// metadata, and lists the statements that bring the session's cluster to it,
+// in an order that runs: keyspaces, then user types before the tables that
+// use them, tables before their indexes and base tables before their views,
+// and drops last. Drops are only planned when allowed; otherwise they are
+// listed as skipped, so a partial target never drops what it does not
+// mention.
+
+// PlanSchemaMigrationOptions are the options of PlanSchemaMigration
+type PlanSchemaMigrationOptions struct {
+	CQL        string           `json:"cql"`        // Target schema as CREATE statements
+	Metadata   *ClusterMetadata `json:"metadata"`   // Target schema as GetClusterMetadata returns it
+	Keyspaces  []string         `json:"keyspaces"`  // Keyspaces to plan (default: those of the target)
+	AllowDrops bool             `json:"allowDrops"` // Plan DROP statements for objects the target does not have
+}
+
+// planSchemaMigration diffs the live schema against the target. Ignored
+// statements of a CQL target are reported as warnings.
+func planSchemaMigration(live, target *ClusterMetadata, keyspaces []string, allowDrops bool, ignored []string) *SchemaDiff {
+	if len(keyspaces) == 0 {
+		for _, ks := range target.Keyspaces {
+			keyspaces = append(keyspaces, ks.Name)
+		}
+	}
+	diff := compareSchemas(live, target, keyspaces, allowDrops)
+	for _, stmt := range ignored {
+		diff.Warnings = append(diff.Warnings, "not planned: "+stmt)
+	}
+	return diff
+}
+
+// metadataFromDefinition converts a schema read from CQL to cluster
+// metadata. A keyspace the script uses without creating keeps the
+// replication it has on the live cluster.
+func metadataFromDefinition(def *cql.SchemaDefinition, live *ClusterMetadata) (*ClusterMetadata, error) {
+	liveKeyspaces := make(map[string]KeyspaceInfo, len(live.Keyspaces))
+	for _, ks := range live.Keyspaces {
+		liveKeyspaces[ks.Name] = ks
+	}
+
+	metadata := &ClusterMetadata{}
+	for _, ksDef := range def.Keyspaces {
+		ks := KeyspaceInfo{Name: ksDef.Name, DurableWrites: ksDef.DurableWrites}
+		if ksDef.Created {
+			ks.ReplicationStrategy = make(map[string]interface{}, len(ksDef.Replication))
+			for key, value := range ksDef.Replication {
+				ks.ReplicationStrategy[key] = value
+			}
+		} else {
+			existing, ok := liveKeyspaces[ksDef.Name]
+			if !ok {
+				return nil, fmt.Errorf("keyspace %s is not created by the script and does not exist", ksDef.Name)
+			}
+			ks.ReplicationStrategy = existing.ReplicationStrategy
+			ks.DurableWrites = existing.DurableWrites
+		}
+
+		for _, t := range ksDef.Types {
+			udt := UserTypeInfo{Name: t.Name}
+			for _, f := range t.Fields {
+				udt.FieldNames = append(udt.FieldNames, f.Name)
+				udt.FieldTypes = append(udt.FieldTypes, f.Type)
+			}
+			ks.UserTypes = append(ks.UserTypes, udt)
+		}
+		for _, t := range ksDef.Tables {
+			ks.Tables = append(ks.Tables, tableFromDefinition(t))
+		}
+		for _, v := range ksDef.Views {
+			ks.Views = append(ks.Views, ViewInfo{Name: v.Name, BaseTableName: v.BaseTable, statement: v.Statement})
+		}
+		metadata.Keyspaces = append(metadata.Keyspaces, ks)
+	}
+	return metadata, nil
+}
+
+// tableFromDefinition converts a table read from CQL
+func tableFromDefinition(def *cql.TableDefinition) TableInfo {
+	t := TableInfo{Name: def.Name}
+	types := make(map[string]string, len(def.Columns))
+	for _, c := range def.Columns {
+		types[c.Name] = c.Type
+	}
+
+	keyColumns := make(map[string]bool)
+	for i, name := range def.PartitionKey {
+		keyColumns[name] = true
+		t.PartitionKey = append(t.PartitionKey, KeyInfo{Name: name, CQLType: types[name]})
+		t.Columns = append(t.Columns, ColumnInfo{Name: name, CQLType: types[name], Kind: "partition_key", Position: i})
+	}
+	for i, c := range def.Clustering {
+		keyColumns[c.Name] = true
+		t.ClusteringKey = append(t.ClusteringKey, KeyInfo{Name: c.Name, CQLType: types[c.Name], IsReversed: c.Descending})
+		t.Columns = append(t.Columns, ColumnInfo{Name: c.Name, CQLType: types[c.Name], Kind: "clustering", Position: i, IsReversed: c.Descending})
+	}
+	t.PrimaryKey = append(append([]KeyInfo{}, t.PartitionKey...), t.ClusteringKey...)
+
+	for _, c := range def.Columns {
+		if keyColumns[c.Name] {
+			continue
+		}
+		kind := "regular"
+		if c.Static {
+			kind = "static"
+		}
+		t.Columns = append(t.Columns, ColumnInfo{Name: c.Name, CQLType: c.Type, Kind: kind, Position: -1, IsStatic: c.Static})
+	}
+
+	for _, idx := range def.Indexes {
+		index := IndexInfo{Name: idx.Name, Kind: "COMPOSITES", Options: map[string]string{"target": idx.Target}}
+		if idx.Custom {
+			index.Kind = "CUSTOM"
+			index.Options["class_name"] = idx.Class
+			for key, value := range idx.Options {
+				index.Options[key] = value
+			}
+		}
+		t.Indexes = append(t.Indexes, index)
+	}
+	return t
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// columnHistogramBounds are the upper bounds of the columns-per-table buckets
+var columnHistogramBounds = []int{5, 10, 20, 50, 100}
+
+// SchemaSummary is a rollup of the user schema for overview pages. System
+// keyspaces are only counted in SystemKeyspaces.
+type SchemaSummary struct {
+	Keyspaces       int `json:"keyspaces"`
+	SystemKeyspaces int `json:"systemKeyspaces"`
+	Tables          int `json:"tables"`
+	Views           int `json:"views"`
+	Columns         int `json:"columns"`
+	Indexes         int `json:"indexes"`
+	UserTypes       int `json:"userTypes"`
+	Functions       int `json:"functions"`
+	Aggregates      int `json:"aggregates"`
+
+	TablesPerKeyspace []KeyspaceTableCount `json:"tablesPerKeyspace"` // Largest first
+	ColumnsPerTable   []ColumnCountBucket  `json:"columnsPerTable"`
+	IndexesByKind     map[string]int       `json:"indexesByKind"` // secondary, sai, sasi, custom
+	UserTypeUsage     []UserTypeUsage      `json:"userTypeUsage"`
+	Strategies        map[string]int       `json:"strategies"` // Replication class -> keyspaces
+	Datacenters       []DatacenterRollup   `json:"datacenters"`
+	Largest           *TableColumnCount    `json:"largestTable,omitempty"` // Table with the most columns
+	Unresolved        []string             `json:"unresolved,omitempty"`   // Keyspaces whose metadata failed to load
+}
+
+// KeyspaceTableCount is the object count of one keyspace
+type KeyspaceTableCount struct {
+	Keyspace string `json:"keyspace"`
+	Tables   int    `json:"tables"`
+	Views    int    `json:"views"`
+}
+
+// ColumnCountBucket is a bucket of the columns-per-table histogram
+type ColumnCountBucket struct {
+	Label  string `json:"label"` // e.g. "6-10", "101+"
+	Min    int    `json:"min"`
+	Max    int    `json:"max,omitempty"` // 0 for the open-ended last bucket
+	Tables int    `json:"tables"`
+}
+
+// TableColumnCount names a table and its column count
+type TableColumnCount struct {
+	Keyspace string `json:"keyspace"`
+	Table    string `json:"table"`
+	Columns  int    `json:"columns"`
+}
+
+// UserTypeUsage counts where a user-defined type is used
+type UserTypeUsage struct {
+	Keyspace  string `json:"keyspace"`
+	Name      string `json:"name"`
+	Columns   int    `json:"columns"`   // Table columns using the type, directly or nested
+	Tables    int    `json:"tables"`    // Tables with such a column
+	UserTypes int    `json:"userTypes"` // Other types with a field using it
+	Unused    bool   `json:"unused"`
+}
+
+// DatacenterRollup is the replication of the user keyspaces in one datacenter
+type DatacenterRollup struct {
+	Datacenter         string         `json:"datacenter"`
+	Keyspaces          int            `json:"keyspaces"`
+	ReplicationFactors map[string]int `json:"replicationFactors"` // Replication factor -> keyspaces
+}
+
+// newColumnHistogram returns the empty columns-per-table buckets
+func newColumnHistogram() []ColumnCountBucket {
+	buckets := make([]ColumnCountBucket, 0, len(columnHistogramBounds)+1)
+	low := 1
+	for _, high := range columnHistogramBounds {
+		buckets = append(buckets, ColumnCountBucket{Label: fmt.Sprintf("%d-%d", low, high), Min: low, Max: high})
+		low = high + 1
+	}
+	return append(buckets, ColumnCountBucket{Label: fmt.Sprintf("%d+", low), Min: low})
+}
+
+// addToColumnHistogram counts a table with n columns
+func addToColumnHistogram(buckets []ColumnCountBucket, n int) {
+	for i := range buckets {
+		if buckets[i].Max == 0 || n <= buckets[i].Max {
+			buckets[i].Tables++
+			return
+		}
+	}
+}
+
+// indexKindName classifies an index by its system_schema.indexes kind and class
+func indexKindName(kind string, options map[string]string) string {
+	if strings.ToUpper(kind) != "CUSTOM" {
+		return "secondary"
+	}
+	class := options["class_name"]
+	switch {
+	case strings.HasSuffix(class, "StorageAttachedIndex"):
+		return "sai"
+	case strings.HasSuffix(class, "SASIIndex"):
+		return "sasi"
+	default:
+		return "custom"
+	}
+}
+
+// userTypesIn returns the keyspace-qualified user types a type string refers to
+func userTypesIn(typeStr, keyspace string) []string {
+	parsed, err := db.ParseCQLType(typeStr)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	var collect func(t *db.CQLTypeInfo)
+	collect = func(t *db.CQLTypeInfo) {
+		if t == nil {
+			return
+		}
+		if t.BaseType == "udt" {
+			ks := t.Keyspace
+			if ks == "" {
+				ks = keyspace
+			}
+			names = append(names, ks+"."+strings.Trim(t.UDTName, `"`))
+		}
+		for _, p := range t.Parameters {
+			collect(p)
+		}
+	}
+	collect(parsed)
+	return names
+}
+
+// replicationByDatacenter returns the replication factor per datacenter of
+// a keyspace; SimpleStrategy is reported under "*"
+func replicationByDatacenter(ks *gocql.KeyspaceMetadata) map[string]string {
+	rf := make(map[string]string)
+	if strings.HasSuffix(ks.StrategyClass, "SimpleStrategy") {
+		rf["*"] = fmt.Sprint(ks.StrategyOptions["replication_factor"])
+		return rf
+	}
+	for key, value := range ks.StrategyOptions {
+		if key == "class" || key == "replication_factor" {
+			continue
+		}
+		rf[key] = fmt.Sprint(value)
+	}
+	return rf
+}
+
+// getSchemaSummary rolls up the driver's cached schema metadata
+func getSchemaSummary(session *db.Session) (*SchemaSummary, error) {
+	var names []string
+	var name string
+	iter := session.Query("SELECT keyspace_name FROM system_schema.keyspaces").Iter()
+	for iter.Scan(&name) {
+		names = append(names, name)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to list keyspaces: %v", err)
+	}
+	names = session.ListedKeyspaces(names)
+	sort.Strings(names)
+
+	summary := &SchemaSummary{
+		TablesPerKeyspace: []KeyspaceTableCount{},
+		ColumnsPerTable:   newColumnHistogram(),
+		IndexesByKind:     make(map[string]int),
+		UserTypeUsage:     []UserTypeUsage{},
+		Strategies:        make(map[string]int),
+		Datacenters:       []DatacenterRollup{},
+	}
+
+	var keyspaces []*gocql.KeyspaceMetadata
+	for _, name := range names {
+		if isSystemKeyspace(name) {
+			summary.SystemKeyspaces++
+			continue
+		}
+		ks, err := session.KeyspaceMetadata(name)
+		if err != nil {
+			summary.Unresolved = append(summary.Unresolved, name)
+			continue
+		}
+		keyspaces = append(keyspaces, ks)
+	}
+
+	usage := make(map[string]*UserTypeUsage)
+	usageTables := make(map[string]map[string]bool)
+	datacenters := make(map[string]*DatacenterRollup)
+
+	countColumns := func(keyspace string, table *gocql.TableMetadata) {
+		for _, col := range table.Columns {
+			seen := make(map[string]bool)
+			for _, udt := range userTypesIn(col.Validator, keyspace) {
+				if u := usage[udt]; u != nil && !seen[udt] {
+					seen[udt] = true
+					u.Columns++
+					usageTables[udt][keyspace+"."+table.Name] = true
+				}
+			}
+		}
+	}
+
+	for _, ks := range keyspaces {
+		summary.Keyspaces++
+		summary.Strategies[ks.StrategyClass]++
+		for dc, rf := range replicationByDatacenter(ks) {
+			rollup := datacenters[dc]
+			if rollup == nil {
+				rollup = &DatacenterRollup{Datacenter: dc, ReplicationFactors: make(map[string]int)}
+				datacenters[dc] = rollup
+			}
+			rollup.Keyspaces++
+			rollup.ReplicationFactors[rf]++
+		}
+		for _, udt := range ks.UserTypes {
+			key := ks.Name + "." + udt.Name
+			usage[key] = &UserTypeUsage{Keyspace: ks.Name, Name: udt.Name}
+			usageTables[key] = make(map[string]bool)
+		}
+		summary.UserTypes += len(ks.UserTypes)
+		summary.Functions += len(ks.Functions)
+		summary.Aggregates += len(ks.Aggregates)
+		summary.Tables += len(ks.Tables)
+		summary.Views += len(ks.MaterializedViews)
+		summary.TablesPerKeyspace = append(summary.TablesPerKeyspace, KeyspaceTableCount{
+			Keyspace: ks.Name,
+			Tables:   len(ks.Tables),
+			Views:    len(ks.MaterializedViews),
+		})
+	}
+
+	// Usage is counted once every keyspace's types are known, since a type
+	// can be used from another keyspace's tables
+	for _, ks := range keyspaces {
+		for _, table := range ks.Tables {
+			n := len(table.Columns)
+			summary.Columns += n
+			addToColumnHistogram(summary.ColumnsPerTable, n)
+			if summary.Largest == nil || n > summary.Largest.Columns {
+				summary.Largest = &TableColumnCount{Keyspace: ks.Name, Table: table.Name, Columns: n}
+			}
+			countColumns(ks.Name, table)
+		}
+		for _, udt := range ks.UserTypes {
+			seen := make(map[string]bool)
+			for _, fieldType := range udt.FieldTypes {
+				for _, used := range userTypesIn(formatTypeInfo(fieldType), ks.Name) {
+					if u := usage[used]; u != nil && !seen[used] {
+						seen[used] = true
+						u.UserTypes++
+					}
+				}
+			}
+		}
+	}
+
+	var idxKs, idxKind string
+	var idxOptions map[string]string
+	iter = session.Query("SELECT keyspace_name, kind, options FROM system_schema.indexes").Iter()
+	for iter.Scan(&idxKs, &idxKind, &idxOptions) {
+		if isSystemKeyspace(idxKs) {
+			continue
+		}
+		summary.Indexes++
+		summary.IndexesByKind[indexKindName(idxKind, idxOptions)]++
+	}
+	_ = iter.Close() // Index counts stay zero if system_schema.indexes cannot be read
+
+	for key, u := range usage {
+		u.Tables = len(usageTables[key])
+		u.Unused = u.Columns == 0 && u.UserTypes == 0
+		summary.UserTypeUsage = append(summary.UserTypeUsage, *u)
+	}
+	sort.Slice(summary.UserTypeUsage, func(i, j int) bool {
+		a, b := summary.UserTypeUsage[i], summary.UserTypeUsage[j]
+		if a.Columns != b.Columns {
+			return a.Columns > b.Columns
+		}
+		return a.Keyspace+"."+a.Name < b.Keyspace+"."+b.Name
+	})
+	sort.SliceStable(summary.TablesPerKeyspace, func(i, j int) bool {
+		return summary.TablesPerKeyspace[i].Tables > summary.TablesPerKeyspace[j].Tables
+	})
+	for _, rollup := range datacenters {
+		summary.Datacenters = append(summary.Datacenters, *rollup)
+	}
+	sort.Slice(summary.Datacenters, func(i, j int) bool {
+		return summary.Datacenters[i].Datacenter < summary.Datacenters[j].Datacenter
+	})
+	return summary, nil
+}
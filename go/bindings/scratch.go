@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Scratch keyspaces
+//
+// CreateScratchSpace gives a session a keyspace of its own for trying out DDL
+// and data, so exploration does not leave tables behind in application
+// keyspaces. Scratch keyspaces are recognised by their name prefix and a
+// marker table whose single row is written with the lease TTL: once the row
+// has expired the keyspace counts as abandoned and any session can drop it.
+// Spaces are dropped when the session that created them is closed, unless
+// they were created with keepOnClose.
+
+const (
+	scratchKeyspacePrefix  = "cqlai_scratch_"
+	scratchMarkerTable     = "scratch_info"
+	defaultScratchLease    = 24 * time.Hour
+	maxScratchLease        = 30 * 24 * time.Hour
+	maxScratchReplicaCount = 3
+)
+
+// ScratchSpaceOptions configures CreateScratchSpace
+type ScratchSpaceOptions struct {
+	TTLSeconds        int  `json:"ttlSeconds"`        // Lease; the space counts as expired after this long (default 86400)
+	ReplicationFactor int  `json:"replicationFactor"` // Replicas in the local datacenter (default 1, max 3)
+	KeepOnClose       bool `json:"keepOnClose"`       // Do not drop the space when the session is closed
+}
+
+// ScratchSpace describes a scratch keyspace
+type ScratchSpace struct {
+	Keyspace          string   `json:"keyspace"`
+	Datacenter        string   `json:"datacenter,omitempty"`
+	ReplicationFactor int      `json:"replicationFactor,omitempty"`
+	CreatedAt         string   `json:"createdAt,omitempty"`
+	ExpiresAt         string   `json:"expiresAt,omitempty"`
+	CreatedBy         string   `json:"createdBy,omitempty"` // user@client-host
+	Tables            []string `json:"tables"`              // Tables other than the marker table
+	Expired           bool     `json:"expired"`             // The lease ran out; CleanupScratchSpaces with expired drops it
+	OwnedBySession    bool     `json:"ownedBySession"`      // Created by this session
+	KeepOnClose       bool     `json:"keepOnClose,omitempty"`
+}
+
+// CleanupScratchOptions selects the spaces CleanupScratchSpaces drops. With
+// neither field set, the spaces created by the session are dropped.
+type CleanupScratchOptions struct {
+	Keyspace string `json:"keyspace"` // Drop this scratch space
+	Expired  bool   `json:"expired"`  // Drop every expired scratch space, whoever created it
+}
+
+// CleanupScratchResult lists the dropped spaces
+type CleanupScratchResult struct {
+	Dropped []string          `json:"dropped"`
+	Errors  map[string]string `json:"errors,omitempty"` // Keyspace -> error of a failed drop
+}
+
+// scratchOwned records the spaces each session created, with their keepOnClose flag
+var (
+	scratchOwned     = make(map[int]map[string]bool)
+	scratchOwnedLock sync.Mutex
+)
+
+func rememberScratchSpace(handle int, keyspace string, keep bool) {
+	scratchOwnedLock.Lock()
+	defer scratchOwnedLock.Unlock()
+	if scratchOwned[handle] == nil {
+		scratchOwned[handle] = make(map[string]bool)
+	}
+	scratchOwned[handle][keyspace] = keep
+}
+
+func forgetScratchSpace(handle int, keyspace string) {
+	scratchOwnedLock.Lock()
+	defer scratchOwnedLock.Unlock()
+	delete(scratchOwned[handle], keyspace)
+}
+
+// ownedScratchSpaces returns the session's spaces and their keepOnClose flags
+func ownedScratchSpaces(handle int) map[string]bool {
+	scratchOwnedLock.Lock()
+	defer scratchOwnedLock.Unlock()
+	owned := make(map[string]bool, len(scratchOwned[handle]))
+	for ks, keep := range scratchOwned[handle] {
+		owned[ks] = keep
+	}
+	return owned
+}
+
+// discardScratchSpaces forgets the session's spaces when the session is closed
+func discardScratchSpaces(handle int) {
+	scratchOwnedLock.Lock()
+	delete(scratchOwned, handle)
+	scratchOwnedLock.Unlock()
+}
+
+// newScratchKeyspaceName returns a unique keyspace name such as
+// cqlai_scratch_20260105_9f3a61c2
+func newScratchKeyspaceName() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return scratchKeyspacePrefix + time.Now().UTC().Format("20060102") + "_" + hex.EncodeToString(suffix), nil
+}
+
+// scratchCreator identifies who created a space, for ListScratchSpaces
+func scratchCreator(session *db.Session) string {
+	user := session.Username()
+	if user == "" {
+		user = "anonymous"
+	}
+	if host, err := os.Hostname(); err == nil {
+		return user + "@" + host
+	}
+	return user
+}
+
+// createScratchSpace creates a scratch keyspace with its marker table
+func createScratchSpace(handle int, session *db.Session, opts ScratchSpaceOptions) (*ScratchSpace, error) {
+	lease := defaultScratchLease
+	if opts.TTLSeconds > 0 {
+		lease = min(time.Duration(opts.TTLSeconds)*time.Second, maxScratchLease)
+	}
+	rf := opts.ReplicationFactor
+	if rf <= 0 {
+		rf = 1
+	}
+	rf = min(rf, maxScratchReplicaCount)
+
+	var datacenter string
+	if err := session.Query("SELECT data_center FROM system.local").Scan(&datacenter); err != nil || datacenter == "" {
+		return nil, fmt.Errorf("cannot determine the local datacenter: %v", err)
+	}
+
+	keyspace, err := newScratchKeyspaceName()
+	if err != nil {
+		return nil, err
+	}
+	created := time.Now().UTC()
+	expires := created.Add(lease)
+	space := &ScratchSpace{
+		Keyspace:          keyspace,
+		Datacenter:        datacenter,
+		ReplicationFactor: rf,
+		CreatedAt:         created.Format(time.RFC3339),
+		ExpiresAt:         expires.Format(time.RFC3339),
+		CreatedBy:         scratchCreator(session),
+		Tables:            []string{},
+		OwnedBySession:    true,
+		KeepOnClose:       opts.KeepOnClose,
+	}
+
+	stmts := []string{
+		fmt.Sprintf("CREATE KEYSPACE %s WITH replication = {'class': 'NetworkTopologyStrategy', '%s': %d}",
+			quoteIdentifier(keyspace), escapeString(datacenter), rf),
+		fmt.Sprintf("CREATE TABLE %s.%s (id int PRIMARY KEY, created_at timestamp, expires_at timestamp, created_by text) WITH default_time_to_live = %d AND comment = '%s'",
+			quoteIdentifier(keyspace), scratchMarkerTable, int(lease.Seconds()),
+			escapeString("cqlai scratch space, expires "+space.ExpiresAt)),
+	}
+	for i, stmt := range stmts {
+		if err := session.Query(stmt).Exec(); err != nil {
+			if i > 0 {
+				_ = session.Query("DROP KEYSPACE IF EXISTS " + quoteIdentifier(keyspace)).Exec()
+			}
+			return nil, fmt.Errorf("failed to create scratch space: %v", err)
+		}
+	}
+	// The marker row is written right after the DDL, so wait until every node has the table
+	_ = session.GocqlSession().AwaitSchemaAgreement(context.Background())
+
+	insert := fmt.Sprintf("INSERT INTO %s.%s (id, created_at, expires_at, created_by) VALUES (0, ?, ?, ?)", quoteIdentifier(keyspace), scratchMarkerTable)
+	if err := session.Query(insert, created, expires, space.CreatedBy).Exec(); err != nil {
+		_ = session.Query("DROP KEYSPACE IF EXISTS " + quoteIdentifier(keyspace)).Exec()
+		return nil, fmt.Errorf("failed to write scratch space marker: %v", err)
+	}
+
+	rememberScratchSpace(handle, keyspace, opts.KeepOnClose)
+	return space, nil
+}
+
+// readScratchSpace describes a scratch keyspace from its tables and marker row.
+// It returns nil when the keyspace has no marker table and is not a scratch space.
+func readScratchSpace(session *db.Session, keyspace string) (*ScratchSpace, error) {
+	space := &ScratchSpace{Keyspace: keyspace, Tables: []string{}}
+	marked := false
+
+	var table string
+	iter := session.Query("SELECT table_name FROM system_schema.tables WHERE keyspace_name = ?", keyspace).Iter()
+	for iter.Scan(&table) {
+		if table == scratchMarkerTable {
+			marked = true
+			continue
+		}
+		space.Tables = append(space.Tables, table)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, nil
+	}
+	sort.Strings(space.Tables)
+
+	var created, expires time.Time
+	var createdBy string
+	query := fmt.Sprintf("SELECT created_at, expires_at, created_by FROM %s.%s WHERE id = 0", quoteIdentifier(keyspace), scratchMarkerTable)
+	err := session.Query(query).Scan(&created, &expires, &createdBy)
+	switch {
+	case err == nil:
+		space.CreatedAt = created.UTC().Format(time.RFC3339)
+		space.ExpiresAt = expires.UTC().Format(time.RFC3339)
+		space.CreatedBy = createdBy
+		space.Expired = time.Now().After(expires)
+	case errors.Is(err, gocql.ErrNotFound):
+		space.Expired = true // The marker row's TTL ran out
+	default:
+		return nil, err
+	}
+	return space, nil
+}
+
+// listScratchSpaces returns every scratch keyspace on the cluster
+func listScratchSpaces(handle int, session *db.Session) ([]ScratchSpace, error) {
+	var names []string
+	var keyspace string
+	iter := session.Query("SELECT keyspace_name FROM system_schema.keyspaces").Iter()
+	for iter.Scan(&keyspace) {
+		if strings.HasPrefix(keyspace, scratchKeyspacePrefix) {
+			names = append(names, keyspace)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to list keyspaces: %v", err)
+	}
+	sort.Strings(names)
+
+	owned := ownedScratchSpaces(handle)
+	spaces := []ScratchSpace{}
+	for _, name := range names {
+		space, err := readScratchSpace(session, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read scratch space %s: %v", name, err)
+		}
+		if space == nil {
+			continue
+		}
+		keep, ok := owned[name]
+		space.OwnedBySession = ok
+		space.KeepOnClose = keep
+		spaces = append(spaces, *space)
+	}
+	return spaces, nil
+}
+
+// dropScratchSpace drops a scratch keyspace after checking that it is one
+func dropScratchSpace(handle int, session *db.Session, keyspace string) error {
+	if !strings.HasPrefix(keyspace, scratchKeyspacePrefix) {
+		return fmt.Errorf("%s is not a scratch space", keyspace)
+	}
+	space, err := readScratchSpace(session, keyspace)
+	if err != nil {
+		return err
+	}
+	if space == nil {
+		return fmt.Errorf("%s is not a scratch space (no %s table)", keyspace, scratchMarkerTable)
+	}
+	if err := session.Query("DROP KEYSPACE IF EXISTS " + quoteIdentifier(keyspace)).Exec(); err != nil {
+		return err
+	}
+	forgetScratchSpace(handle, keyspace)
+	return nil
+}
+
+// cleanupScratchSpaces drops the spaces selected by opts
+func cleanupScratchSpaces(handle int, session *db.Session, opts CleanupScratchOptions) (*CleanupScratchResult, error) {
+	result := &CleanupScratchResult{Dropped: []string{}}
+
+	var targets []string
+	switch {
+	case opts.Keyspace != "":
+		targets = []string{opts.Keyspace}
+	case opts.Expired:
+		spaces, err := listScratchSpaces(handle, session)
+		if err != nil {
+			return nil, err
+		}
+		for _, space := range spaces {
+			if space.Expired {
+				targets = append(targets, space.Keyspace)
+			}
+		}
+	default:
+		for keyspace := range ownedScratchSpaces(handle) {
+			targets = append(targets, keyspace)
+		}
+		sort.Strings(targets)
+	}
+
+	for _, keyspace := range targets {
+		if err := dropScratchSpace(handle, session, keyspace); err != nil {
+			if opts.Keyspace != "" {
+				return nil, err
+			}
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[keyspace] = err.Error()
+			continue
+		}
+		result.Dropped = append(result.Dropped, keyspace)
+	}
+	return result, nil
+}
+
+// dropSessionScratchSpaces drops the session's spaces, except those kept on
+// close, before the session is closed. Failures are left to the lease.
+func dropSessionScratchSpaces(handle int, session *db.Session) {
+	for keyspace, keep := range ownedScratchSpaces(handle) {
+		if !keep {
+			_ = dropScratchSpace(handle, session, keyspace)
+		}
+	}
+}
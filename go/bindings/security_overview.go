@@ -0,0 +1,502 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Where GetSecurityOverview got its answer
+const (
+	securitySourceAuth = "system_auth" // Every role and grant
+	securitySourceList = "list"        // LIST ROLES and LIST PERMISSIONS: what the role may see
+	securitySourceNone = "none"        // Nothing readable; only the session's role is known
+)
+
+// securityMarshalTypes names the CQL types of function arguments, which
+// system_auth records as server type classes
+var securityMarshalTypes = map[string]string{
+	"AsciiType":         "ascii",
+	"LongType":          "bigint",
+	"BytesType":         "blob",
+	"BooleanType":       "boolean",
+	"CounterColumnType": "counter",
+	"SimpleDateType":    "date",
+	"DecimalType":       "decimal",
+	"DoubleType":        "double",
+	"DurationType":      "duration",
+	"FloatType":         "float",
+	"InetAddressType":   "inet",
+	"Int32Type":         "int",
+	"ShortType":         "smallint",
+	"UTF8Type":          "text",
+	"TimeType":          "time",
+	"TimestampType":     "timestamp",
+	"TimeUUIDType":      "timeuuid",
+	"ByteType":          "tinyint",
+	"UUIDType":          "uuid",
+	"IntegerType":       "varint",
+}
+
+// SecurityOverview is the result of GetSecurityOverview: the roles of the
+// cluster, and who holds which permissions on each resource
+type SecurityOverview struct {
+	Source      string             `json:"source"`   // system_auth, list or none
+	Complete    bool               `json:"complete"` // Every role and grant could be read
+	CurrentRole string             `json:"currentRole,omitempty"`
+	Summary     SecuritySummary    `json:"summary"`
+	Roles       []SecurityRole     `json:"roles"`
+	Resources   []SecurityResource `json:"resources"` // Parents before their children
+	Describe    string             `json:"describe"`  // CQL that recreates the roles and grants read
+	Warnings    []string           `json:"warnings,omitempty"`
+}
+
+// SecuritySummary counts what a SecurityOverview holds
+type SecuritySummary struct {
+	Roles      int `json:"roles"`
+	Users      int `json:"users"` // Roles that can log in, people and service accounts alike
+	Superusers int `json:"superusers"`
+	Resources  int `json:"resources"`
+	Grants     int `json:"grants"` // Permissions granted, one per role, resource and permission
+}
+
+// SecurityRole is a role, its place in the role graph and its grants
+type SecurityRole struct {
+	Name               string   `json:"name"`
+	Kind               string   `json:"kind"` // user (can log in) or role
+	Superuser          bool     `json:"superuser"`
+	EffectiveSuperuser bool     `json:"effectiveSuperuser"` // Superuser itself or through a granted role
+	CanLogin           bool     `json:"canLogin"`
+	MemberOf           []string `json:"memberOf"` // Roles granted to it
+	Members            []string `json:"members"`  // Roles it is granted to
+	Resources          int      `json:"resources"`
+	Current            bool     `json:"current,omitempty"` // The session's role
+	CQL                []string `json:"cql"`
+	Unknown            bool     `json:"unknown,omitempty"` // Named by a grant but not readable; flags unknown
+}
+
+// SecurityResource is a resource and the permissions each role holds on it
+type SecurityResource struct {
+	Resource string          `json:"resource"` // As system_auth names it: data/ks/table, roles/name, functions/ks, mbean/name...
+	Type     string          `json:"type"`     // all_keyspaces, keyspace, table, all_roles, role, all_functions, keyspace_functions, function, all_mbeans or mbean
+	Name     string          `json:"name"`     // As GRANT names it: ALL KEYSPACES, KEYSPACE ks, TABLE ks.t...
+	Keyspace string          `json:"keyspace,omitempty"`
+	Table    string          `json:"table,omitempty"`
+	Parent   string          `json:"parent,omitempty"` // Resource whose grants also apply to this one
+	Roles    []SecurityGrant `json:"roles"`
+}
+
+// SecurityGrant is the permissions a role holds on a resource
+type SecurityGrant struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// securityRoleRow is a role as read, before the graph is worked out
+type securityRoleRow struct {
+	name      string
+	superuser bool
+	canLogin  bool
+	memberOf  []string
+	unknown   bool
+}
+
+// getSecurityOverview reads the roles and permissions of the cluster. It
+// reads system_auth when the role may; otherwise it falls back to LIST ROLES
+// and LIST PERMISSIONS, which show the roles granted to the session's role
+// and their permissions, and failing that reports the session's role alone.
+// It does not fail for lack of access.
+func getSecurityOverview(session *db.Session) *SecurityOverview {
+	overview := &SecurityOverview{CurrentRole: session.Username(), Roles: []SecurityRole{}, Resources: []SecurityResource{}}
+	grants := make(map[string]map[string][]string) // resource -> role -> permissions
+
+	rows, err := readSecurityRolesFromAuth(session)
+	if err == nil {
+		overview.Source, overview.Complete = securitySourceAuth, true
+		if err := readSecurityGrantsFromAuth(session, grants); err != nil {
+			overview.Complete = false
+			overview.Warnings = append(overview.Warnings, fmt.Sprintf("system_auth.role_permissions is not readable (%v); permissions are those LIST PERMISSIONS shows", err))
+			readSecurityGrantsFromList(session, rows, grants, overview)
+		}
+	} else {
+		overview.Warnings = append(overview.Warnings, fmt.Sprintf("system_auth is not readable (%v); roles and permissions are those LIST ROLES and LIST PERMISSIONS show", err))
+		rows, err = readSecurityRolesFromList(session)
+		if err == nil {
+			overview.Source = securitySourceList
+			readSecurityGrantsFromList(session, rows, grants, overview)
+		} else {
+			overview.Source = securitySourceNone
+			overview.Warnings = append(overview.Warnings, fmt.Sprintf("LIST ROLES failed (%v); no roles or permissions could be read", err))
+			rows = nil
+			if overview.CurrentRole != "" {
+				rows = []securityRoleRow{{name: overview.CurrentRole, unknown: true}}
+			}
+		}
+	}
+
+	buildSecurityOverview(overview, rows, grants)
+	return overview
+}
+
+// readSecurityRolesFromAuth reads every role from system_auth.roles
+func readSecurityRolesFromAuth(session *db.Session) ([]securityRoleRow, error) {
+	roles, err := session.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]securityRoleRow, 0, len(roles))
+	for _, r := range roles {
+		rows = append(rows, securityRoleRow{name: r.Role, superuser: r.IsSuperuser, canLogin: r.CanLogin, memberOf: r.MemberOf})
+	}
+	return rows, nil
+}
+
+// readSecurityGrantsFromAuth reads every grant from system_auth.role_permissions
+func readSecurityGrantsFromAuth(session *db.Session, grants map[string]map[string][]string) error {
+	permissions, err := session.ListPermissions()
+	if err != nil {
+		return err
+	}
+	for _, p := range permissions {
+		addSecurityGrant(grants, p.Resource, p.Role, p.Permissions...)
+	}
+	return nil
+}
+
+// readSecurityRolesFromList reads the roles LIST ROLES shows, and the roles
+// granted to each with LIST ROLES OF
+func readSecurityRolesFromList(session *db.Session) ([]securityRoleRow, error) {
+	listed, err := listSecurityRoles(session, "LIST ROLES")
+	if err != nil {
+		return nil, err
+	}
+	for i := range listed {
+		granted, err := listSecurityRoles(session, fmt.Sprintf("LIST ROLES OF %s NORECURSIVE", quoteIdentifier(listed[i].name)))
+		if err != nil {
+			continue
+		}
+		for _, parent := range granted {
+			if parent.name != listed[i].name {
+				listed[i].memberOf = append(listed[i].memberOf, parent.name)
+			}
+		}
+	}
+	return listed, nil
+}
+
+// listSecurityRoles runs a LIST ROLES statement
+func listSecurityRoles(session *db.Session, stmt string) ([]securityRoleRow, error) {
+	iter := session.Query(stmt).Iter()
+	var rows []securityRoleRow
+	for {
+		row := make(map[string]interface{})
+		if !iter.MapScan(row) {
+			break
+		}
+		name, _ := row["role"].(string)
+		superuser, _ := row["super"].(bool)
+		canLogin, _ := row["login"].(bool)
+		rows = append(rows, securityRoleRow{name: name, superuser: superuser, canLogin: canLogin})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readSecurityGrantsFromList reads the permissions granted directly to each
+// role with LIST ALL PERMISSIONS OF. Roles whose permissions may not be
+// listed are left out, with a warning.
+func readSecurityGrantsFromList(session *db.Session, rows []securityRoleRow, grants map[string]map[string][]string, overview *SecurityOverview) {
+	var hidden []string
+	for _, role := range rows {
+		iter := session.Query(fmt.Sprintf("LIST ALL PERMISSIONS OF %s NORECURSIVE", quoteIdentifier(role.name))).Iter()
+		for {
+			row := make(map[string]interface{})
+			if !iter.MapScan(row) {
+				break
+			}
+			resource, _ := row["resource"].(string)
+			permission, _ := row["permission"].(string)
+			addSecurityGrant(grants, securityResourceFromList(resource), role.name, permission)
+		}
+		if err := iter.Close(); err != nil {
+			hidden = append(hidden, role.name)
+		}
+	}
+	if len(hidden) > 0 {
+		overview.Complete = false
+		overview.Warnings = append(overview.Warnings, fmt.Sprintf("the permissions of %s could not be listed", strings.Join(hidden, ", ")))
+	}
+}
+
+// addSecurityGrant records permissions of a role on a resource
+func addSecurityGrant(grants map[string]map[string][]string, resource, role string, permissions ...string) {
+	if grants[resource] == nil {
+		grants[resource] = make(map[string][]string)
+	}
+	for _, p := range permissions {
+		grants[resource][role] = append(grants[resource][role], strings.ToUpper(p))
+	}
+}
+
+// buildSecurityOverview works out the role graph, the resource tree and the
+// CQL describing them
+func buildSecurityOverview(overview *SecurityOverview, rows []securityRoleRow, grants map[string]map[string][]string) {
+	byName := make(map[string]*securityRoleRow, len(rows))
+	for i := range rows {
+		byName[rows[i].name] = &rows[i]
+	}
+	// Roles named by grants or member_of but not read are shown as unknown
+	var named []string
+	for _, roles := range grants {
+		for role := range roles {
+			named = append(named, role)
+		}
+	}
+	for _, row := range rows {
+		named = append(named, row.memberOf...)
+	}
+	for _, role := range named {
+		if byName[role] == nil {
+			rows = append(rows, securityRoleRow{name: role, unknown: true})
+			byName[role] = &rows[len(rows)-1]
+		}
+	}
+	members := make(map[string][]string)
+	for _, row := range rows {
+		for _, parent := range row.memberOf {
+			members[parent] = append(members[parent], row.name)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+	byName = make(map[string]*securityRoleRow, len(rows))
+	for i := range rows {
+		byName[rows[i].name] = &rows[i]
+	}
+
+	// A role is a superuser when it or any role granted to it, transitively, is
+	effectiveSuperuser := func(name string) bool {
+		seen := map[string]bool{name: true}
+		queue := []string{name}
+		for depth := 0; len(queue) > 0 && depth < accessRoleMaxDepth; depth++ {
+			var next []string
+			for _, n := range queue {
+				row := byName[n]
+				if row == nil {
+					continue
+				}
+				if row.superuser {
+					return true
+				}
+				for _, parent := range row.memberOf {
+					if !seen[parent] {
+						seen[parent] = true
+						next = append(next, parent)
+					}
+				}
+			}
+			queue = next
+		}
+		return false
+	}
+
+	// Resources, sorted so each comes after its parent
+	names := make([]string, 0, len(grants))
+	for resource := range grants {
+		names = append(names, resource)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := strings.Split(names[i], "/"), strings.Split(names[j], "/")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	roleResources := make(map[string]int)
+	roleGrants := make(map[string][]string)
+	for _, name := range names {
+		resource := describeSecurityResource(name)
+		roles := make([]string, 0, len(grants[name]))
+		for role := range grants[name] {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		for _, role := range roles {
+			permissions := sortedUnique(grants[name][role])
+			resource.Roles = append(resource.Roles, SecurityGrant{Role: role, Permissions: permissions})
+			roleResources[role]++
+			overview.Summary.Grants += len(permissions)
+			for _, p := range permissions {
+				roleGrants[role] = append(roleGrants[role], fmt.Sprintf("GRANT %s ON %s TO %s;", p, resource.Name, quoteIdentifier(role)))
+			}
+		}
+		overview.Resources = append(overview.Resources, resource)
+	}
+
+	var creates, memberships, permissions []string
+	for _, row := range rows {
+		role := SecurityRole{
+			Name:               row.name,
+			Kind:               "role",
+			Superuser:          row.superuser,
+			EffectiveSuperuser: effectiveSuperuser(row.name),
+			CanLogin:           row.canLogin,
+			MemberOf:           sortedUnique(row.memberOf),
+			Members:            sortedUnique(members[row.name]),
+			Resources:          roleResources[row.name],
+			Current:            row.name == overview.CurrentRole,
+			Unknown:            row.unknown,
+			CQL:                []string{},
+		}
+		if role.CanLogin {
+			role.Kind = "user"
+			overview.Summary.Users++
+		}
+		if role.EffectiveSuperuser {
+			overview.Summary.Superusers++
+		}
+		if !row.unknown {
+			create := fmt.Sprintf("CREATE ROLE %s WITH SUPERUSER = %t AND LOGIN = %t;", quoteIdentifier(row.name), row.superuser, row.canLogin)
+			role.CQL = append(role.CQL, create)
+			creates = append(creates, create)
+		}
+		for _, parent := range role.MemberOf {
+			grant := fmt.Sprintf("GRANT %s TO %s;", quoteIdentifier(parent), quoteIdentifier(row.name))
+			role.CQL = append(role.CQL, grant)
+			memberships = append(memberships, grant)
+		}
+		role.CQL = append(role.CQL, roleGrants[row.name]...)
+		permissions = append(permissions, roleGrants[row.name]...)
+		overview.Roles = append(overview.Roles, role)
+	}
+	overview.Summary.Roles = len(overview.Roles)
+	overview.Summary.Resources = len(overview.Resources)
+
+	// Roles first, so each GRANT names roles that exist; passwords are not readable
+	var describe []string
+	for _, section := range [][]string{creates, memberships, permissions} {
+		if len(section) > 0 {
+			describe = append(describe, strings.Join(section, "\n"))
+		}
+	}
+	overview.Describe = strings.Join(describe, "\n\n")
+}
+
+// sortedUnique returns values sorted without duplicates, never nil
+func sortedUnique(values []string) []string {
+	out := make([]string, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// describeSecurityResource names a resource of system_auth.role_permissions
+// the way GRANT does, and finds the resource it is inside
+func describeSecurityResource(resource string) SecurityResource {
+	r := SecurityResource{Resource: resource, Type: "other", Name: resource, Roles: []SecurityGrant{}}
+	parts := strings.SplitN(resource, "/", 3)
+	switch parts[0] {
+	case "data":
+		switch len(parts) {
+		case 1:
+			r.Type, r.Name = "all_keyspaces", "ALL KEYSPACES"
+		case 2:
+			r.Type, r.Keyspace, r.Parent = "keyspace", parts[1], "data"
+			r.Name = "KEYSPACE " + quoteIdentifier(parts[1])
+		default:
+			r.Type, r.Keyspace, r.Table, r.Parent = "table", parts[1], parts[2], "data/"+parts[1]
+			r.Name = "TABLE " + quoteIdentifier(parts[1]) + "." + quoteIdentifier(parts[2])
+		}
+	case "roles":
+		if len(parts) == 1 {
+			r.Type, r.Name = "all_roles", "ALL ROLES"
+		} else {
+			r.Type, r.Parent = "role", "roles"
+			r.Name = "ROLE " + quoteIdentifier(strings.Join(parts[1:], "/"))
+		}
+	case "functions":
+		switch len(parts) {
+		case 1:
+			r.Type, r.Name = "all_functions", "ALL FUNCTIONS"
+		case 2:
+			r.Type, r.Keyspace, r.Parent = "keyspace_functions", parts[1], "functions"
+			r.Name = "ALL FUNCTIONS IN KEYSPACE " + quoteIdentifier(parts[1])
+		default:
+			r.Type, r.Keyspace, r.Parent = "function", parts[1], "functions/"+parts[1]
+			r.Name = "FUNCTION " + quoteIdentifier(parts[1]) + "." + describeSecurityFunction(parts[2])
+		}
+	case "mbean":
+		if len(parts) == 1 {
+			r.Type, r.Name = "all_mbeans", "ALL MBEANS"
+		} else {
+			r.Type, r.Parent = "mbean", "mbean"
+			r.Name = "MBEAN '" + escapeString(strings.Join(parts[1:], "/")) + "'"
+		}
+	}
+	return r
+}
+
+// describeSecurityFunction turns a function of a resource name, as in
+// name[org.apache.cassandra.db.marshal.Int32Type^...], into name(int, ...)
+func describeSecurityFunction(function string) string {
+	name, args, ok := strings.Cut(function, "[")
+	if !ok {
+		return function
+	}
+	var types []string
+	for _, arg := range strings.Split(strings.TrimSuffix(args, "]"), "^") {
+		if arg == "" {
+			continue
+		}
+		short := arg[strings.LastIndexByte(arg, '.')+1:]
+		if cqlType, ok := securityMarshalTypes[short]; ok {
+			arg = cqlType
+		}
+		types = append(types, arg)
+	}
+	return quoteIdentifier(name) + "(" + strings.Join(types, ", ") + ")"
+}
+
+// securityResourceFromList turns a resource as LIST PERMISSIONS shows it,
+// e.g. <table ks.t>, into its system_auth name. Function resources keep
+// their argument list as shown.
+func securityResourceFromList(shown string) string {
+	s := strings.TrimSuffix(strings.TrimPrefix(shown, "<"), ">")
+	kind, name, _ := strings.Cut(s, " ")
+	switch {
+	case s == "all keyspaces":
+		return "data"
+	case kind == "keyspace":
+		return "data/" + name
+	case kind == "table":
+		keyspace, table, _ := strings.Cut(name, ".")
+		return "data/" + keyspace + "/" + table
+	case s == "all roles":
+		return "roles"
+	case kind == "role":
+		return "roles/" + name
+	case s == "all functions":
+		return "functions"
+	case strings.HasPrefix(s, "all functions in "):
+		return "functions/" + strings.TrimPrefix(s, "all functions in ")
+	case kind == "function":
+		keyspace, function, _ := strings.Cut(name, ".")
+		return "functions/" + keyspace + "/" + function
+	case s == "all mbeans":
+		return "mbean"
+	case kind == "mbean" || kind == "mbeans":
+		return "mbean/" + name
+	}
+	return shown
+}
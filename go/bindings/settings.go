@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Settings hierarchy
+//
+// A session setting is taken from the first of these layers that sets it:
+//
+//   - the options of a single query (executeWithOptions), for that query only
+//   - the session: its connection options and cqlshrc, then changes made on
+//     the session such as CONSISTENCY, PAGING or setQueryTimeout()
+//   - the defaults of the session's workspace (SetWorkspaceDefaults)
+//   - the bindings defaults below, or the JSON config file when it sets them
+//
+// Workspace defaults are applied once, when a session is created, so changing
+// them does not affect sessions that are already open. GetEffectiveSettings
+// reports the value of each setting and the layer it came from.
+
+// Layers a session setting can come from
+const (
+	settingDefault   = "default"   // Bindings defaults or the JSON config file
+	settingWorkspace = "workspace" // Workspace defaults
+	settingSession   = "session"   // Connection options or cqlshrc
+	settingChanged   = "changed"   // Changed on the session after it was created
+)
+
+// SessionDefaults are the session settings a workspace can set defaults for.
+// Unset (zero) fields are left to the next layer down.
+type SessionDefaults struct {
+	Consistency          string                       `json:"consistency,omitempty"`
+	PageSize             int                          `json:"pageSize,omitempty"`
+	ConnectTimeout       int                          `json:"connectTimeout,omitempty"`  // Seconds
+	RequestTimeout       int                          `json:"requestTimeout,omitempty"`  // Seconds
+	QueryTimeout         int                          `json:"queryTimeout,omitempty"`    // Milliseconds
+	SocketKeepalive      int                          `json:"socketKeepalive,omitempty"` // Seconds
+	SchemaCache          string                       `json:"schemaCache,omitempty"`
+	ConsistencyFallback  string                       `json:"consistencyFallback,omitempty"`
+	SpeculativeExecution *SpeculativeExecutionOptions `json:"speculativeExecution,omitempty"`
+	CircuitBreaker       *CircuitBreakerOptions       `json:"circuitBreaker,omitempty"`
+	LoadBalancing        *LoadBalancingOptions        `json:"loadBalancing,omitempty"`
+}
+
+// defaultSettings are the values a session uses when no other layer sets them
+var defaultSettings = SessionDefaults{
+	Consistency:    "LOCAL_ONE",
+	PageSize:       100,
+	ConnectTimeout: 10,
+	RequestTimeout: 10,
+	SchemaCache:    db.SchemaCacheFull,
+	LoadBalancing:  &LoadBalancingOptions{Policy: db.LoadBalancingRoundRobin},
+}
+
+// WorkspaceDefaultsRequest sets or clears the defaults of a workspace
+type WorkspaceDefaultsRequest struct {
+	WorkspaceID string           `json:"workspaceID"`
+	Defaults    *SessionDefaults `json:"defaults"` // nil clears them
+}
+
+// EffectiveSetting is the value of a session setting and the layer it came from
+type EffectiveSetting struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// EffectiveSettings is the result of GetEffectiveSettings
+type EffectiveSettings struct {
+	WorkspaceID       string                      `json:"workspaceID"`
+	Settings          map[string]EffectiveSetting `json:"settings"`
+	WorkspaceDefaults SessionDefaults             `json:"workspaceDefaults"` // As they are now, not when the session was created
+	Defaults          SessionDefaults             `json:"defaults"`
+}
+
+// sessionSettings records how a session's settings were resolved
+type sessionSettings struct {
+	workspace string
+	sources   map[string]string      // Layer of each setting when the session was created
+	initial   map[string]interface{} // Value of each setting when the session was created
+}
+
+var (
+	workspaceDefaults   = make(map[string]SessionDefaults)
+	workspaceDefaultsMu sync.RWMutex
+
+	sessionSettingsByHandle = make(map[int]*sessionSettings)
+	sessionSettingsMu       sync.Mutex
+)
+
+// validate checks the defaults the way connection options are checked
+func (d SessionDefaults) validate() error {
+	if d.Consistency != "" && !db.ValidConsistency(d.Consistency) {
+		return fmt.Errorf("invalid consistency level: %s", d.Consistency)
+	}
+	if d.PageSize < 0 || d.ConnectTimeout < 0 || d.RequestTimeout < 0 || d.QueryTimeout < 0 || d.SocketKeepalive < 0 {
+		return fmt.Errorf("pageSize, timeouts and socketKeepalive must not be negative")
+	}
+	var dbOpts db.SessionOptions
+	if err := applySpeculativeExecution(d.SpeculativeExecution, &dbOpts); err != nil {
+		return err
+	}
+	if err := applySchemaCacheMode(d.SchemaCache, &dbOpts); err != nil {
+		return err
+	}
+	if err := applyConsistencyFallback(d.ConsistencyFallback, &dbOpts); err != nil {
+		return err
+	}
+	if err := applyCircuitBreaker(d.CircuitBreaker, &dbOpts); err != nil {
+		return err
+	}
+	return applyLoadBalancing(nil, d.LoadBalancing, &dbOpts)
+}
+
+// setWorkspaceDefaults replaces the defaults of a workspace; nil clears them
+func setWorkspaceDefaults(workspace string, defaults *SessionDefaults) (SessionDefaults, error) {
+	workspaceDefaultsMu.Lock()
+	defer workspaceDefaultsMu.Unlock()
+	if defaults == nil {
+		delete(workspaceDefaults, workspace)
+		return SessionDefaults{}, nil
+	}
+	if err := defaults.validate(); err != nil {
+		return SessionDefaults{}, err
+	}
+	workspaceDefaults[workspace] = *defaults
+	return *defaults, nil
+}
+
+// workspaceDefaultsFor returns the defaults of a workspace, empty when it has none
+func workspaceDefaultsFor(workspace string) SessionDefaults {
+	workspaceDefaultsMu.RLock()
+	defer workspaceDefaultsMu.RUnlock()
+	return workspaceDefaults[workspace]
+}
+
+// inherit takes a setting the session leaves unset from the workspace
+// defaults, and records the layer the setting comes from
+func inherit[T comparable](sources map[string]string, name string, value *T, workspace T) {
+	var zero T
+	switch {
+	case *value != zero:
+		sources[name] = settingSession
+	case workspace != zero:
+		*value = workspace
+		sources[name] = settingWorkspace
+	default:
+		sources[name] = settingDefault
+	}
+}
+
+// applyWorkspaceDefaults fills the settings opts leaves unset from the
+// defaults of its workspace and returns the layer of each setting
+func applyWorkspaceDefaults(opts *SessionOptions) map[string]string {
+	defaults := workspaceDefaultsFor(opts.WorkspaceID)
+	sources := make(map[string]string)
+	inherit(sources, "consistency", &opts.Consistency, defaults.Consistency)
+	inherit(sources, "pageSize", &opts.PageSize, defaults.PageSize)
+	inherit(sources, "connectTimeout", &opts.ConnectTimeout, defaults.ConnectTimeout)
+	inherit(sources, "requestTimeout", &opts.RequestTimeout, defaults.RequestTimeout)
+	inherit(sources, "queryTimeout", &opts.QueryTimeout, defaults.QueryTimeout)
+	inherit(sources, "socketKeepalive", &opts.SocketKeepalive, defaults.SocketKeepalive)
+	inherit(sources, "schemaCache", &opts.SchemaCache, defaults.SchemaCache)
+	inherit(sources, "consistencyFallback", &opts.ConsistencyFallback, defaults.ConsistencyFallback)
+	inherit(sources, "speculativeExecution", &opts.SpeculativeExecution, defaults.SpeculativeExecution)
+	inherit(sources, "circuitBreaker", &opts.CircuitBreaker, defaults.CircuitBreaker)
+	inherit(sources, "loadBalancing", &opts.LoadBalancing, defaults.LoadBalancing)
+	return sources
+}
+
+// applyAstraWorkspaceDefaults is applyWorkspaceDefaults for the settings an
+// Astra connection accepts; the others come from the defaults
+func applyAstraWorkspaceDefaults(opts *AstraConnectOptions) map[string]string {
+	defaults := workspaceDefaultsFor(opts.WorkspaceID)
+	sources := make(map[string]string)
+	inherit(sources, "schemaCache", &opts.SchemaCache, defaults.SchemaCache)
+	inherit(sources, "consistencyFallback", &opts.ConsistencyFallback, defaults.ConsistencyFallback)
+	inherit(sources, "speculativeExecution", &opts.SpeculativeExecution, defaults.SpeculativeExecution)
+	inherit(sources, "circuitBreaker", &opts.CircuitBreaker, defaults.CircuitBreaker)
+	return sources
+}
+
+// currentSettings returns the value of each setting the session uses now
+func currentSettings(session *db.Session) map[string]interface{} {
+	cfg := session.EffectiveConfig()
+	return map[string]interface{}{
+		"consistency":          session.Consistency(),
+		"pageSize":             session.PageSize(),
+		"connectTimeout":       cfg.ConnectTimeout,
+		"requestTimeout":       cfg.RequestTimeout,
+		"queryTimeout":         session.QueryTimeout().Milliseconds(),
+		"socketKeepalive":      int(session.SocketKeepalive().Seconds()),
+		"schemaCache":          session.SchemaCacheMode(),
+		"consistencyFallback":  session.ConsistencyFallback(),
+		"speculativeExecution": session.SpeculativeExecution(),
+		"circuitBreaker":       session.CircuitBreaker(),
+		"loadBalancing":        session.LoadBalancing().String(),
+	}
+}
+
+// recordSessionSettings remembers how the settings of a new session were resolved
+func recordSessionSettings(handle int, session *db.Session, sources map[string]string) {
+	sessionSettingsMu.Lock()
+	defer sessionSettingsMu.Unlock()
+	sessionSettingsByHandle[handle] = &sessionSettings{
+		workspace: session.Workspace(),
+		sources:   sources,
+		initial:   currentSettings(session),
+	}
+}
+
+// discardSessionSettings forgets the settings of a closed session
+func discardSessionSettings(handle int) {
+	sessionSettingsMu.Lock()
+	defer sessionSettingsMu.Unlock()
+	delete(sessionSettingsByHandle, handle)
+}
+
+// effectiveSettings reports each setting of a session and the layer it came
+// from. A setting whose value differs from the one the session was created
+// with has been changed on the session.
+func effectiveSettings(handle int, session *db.Session) EffectiveSettings {
+	sessionSettingsMu.Lock()
+	recorded := sessionSettingsByHandle[handle]
+	sessionSettingsMu.Unlock()
+
+	result := EffectiveSettings{
+		WorkspaceID: session.Workspace(),
+		Settings:    make(map[string]EffectiveSetting),
+		Defaults:    defaultSettings,
+	}
+	result.WorkspaceDefaults = workspaceDefaultsFor(result.WorkspaceID)
+	for name, value := range currentSettings(session) {
+		source := settingSession
+		if recorded != nil {
+			if s, ok := recorded.sources[name]; ok {
+				source = s
+			} else {
+				source = settingDefault
+			}
+			if !reflect.DeepEqual(recorded.initial[name], value) {
+				source = settingChanged
+			}
+		}
+		result.Settings[name] = EffectiveSetting{Value: value, Source: source}
+	}
+	return result
+}
@@ -0,0 +1,680 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// cqlsh special commands
+//
+// ExecuteShellCommand takes a line as typed at the cqlsh prompt, so a
+// terminal emulator can pass any user input to one entry point. The cqlsh
+// special commands - DESCRIBE, SHOW, USE, CONSISTENCY, SERIAL CONSISTENCY,
+// TRACING, EXPAND, PAGING, SOURCE, CAPTURE and COPY - are parsed with the
+// grammar cqlsh uses and run on the subsystems behind the other exports
+// (GetDDL, GetQueryTrace, ExecuteSourceFiles, CopyTo and CopyFrom); anything
+// else runs as CQL. Unlike directives in a script, settings changed here last
+// for the session, as they do in cqlsh.
+
+// ShellCommandOptions are the options of ExecuteShellCommand
+type ShellCommandOptions struct {
+	CancelToken string `json:"cancelToken"` // Token for Cancel
+	StopOnError bool   `json:"stopOnError"` // SOURCE stops at the first failed statement
+	Force       bool   `json:"force"`       // Run partition scans the scan guard would refuse
+}
+
+// ShellCommandResult is the outcome of a shell command
+type ShellCommandResult struct {
+	Command  string      `json:"command"`            // DESCRIBE, SHOW, COPY, ... or CQL
+	Action   string      `json:"action,omitempty"`   // clear or exit, for the terminal to carry out
+	Message  string      `json:"message,omitempty"`  // Status line, as cqlsh prints it
+	Output   string      `json:"output,omitempty"`   // Text output: DDL, listings, rows
+	Result   interface{} `json:"result,omitempty"`   // Structured result of the subsystem that ran the command
+	Capture  string      `json:"capture,omitempty"`  // File output is being captured to
+	Warnings []string    `json:"warnings,omitempty"` // E.g. the capture file could not be written
+}
+
+// shellError is a failed shell command with its error code
+type shellError struct {
+	code    string
+	message string
+}
+
+func (e *shellError) Error() string { return e.message }
+
+func shellErrorf(code, format string, args ...interface{}) error {
+	return &shellError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// shellCopyPattern is the cqlsh COPY grammar:
+// COPY table [(col, ...)] TO|FROM 'file' [WITH opt = value [AND ...]]
+var (
+	shellCopyPattern   = regexp.MustCompile(`(?is)^COPY\s+([^\s(]+)(?:\s*\(([^)]+)\))?\s+(TO|FROM)\s+(?:'([^']+)'|"([^"]+)"|(\S+))(?:\s+WITH\s+(.+?))?\s*$`)
+	shellOptionPattern = regexp.MustCompile(`(\w+)\s*=\s*(?:'([^']*)'|"([^"]*)"|(\S+))`)
+	shellAndPattern    = regexp.MustCompile(`(?i)\s+AND\s+`)
+)
+
+// Files output is captured to, by handle
+var (
+	captureFiles     = make(map[int]string)
+	captureFilesLock sync.Mutex
+)
+
+// executeShellCommand runs one line of shell input
+func executeShellCommand(ctx context.Context, handle int, session *db.Session, line string, opts ShellCommandOptions) (*ShellCommandResult, error) {
+	stmt := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return nil, shellErrorf("INVALID_OPTIONS", "Command is required")
+	}
+	keyword := strings.ToUpper(fields[0])
+	arg := strings.TrimSpace(stmt[len(fields[0]):])
+
+	switch keyword {
+	case "USE", "CONSISTENCY", "PAGING", "TRACING", "SERIAL":
+		if _, _, ok := parseDirective(stmt); ok {
+			return shellDirective(handle, session, stmt)
+		}
+	case "EXPAND":
+		return shellExpand(session, arg)
+	case "DESC", "DESCRIBE":
+		unlock := lockHandleShared(handle)
+		defer unlock()
+		return shellDescribe(session, arg)
+	case "SHOW":
+		unlock := lockHandleShared(handle)
+		defer unlock()
+		return shellShow(session, arg)
+	case "SOURCE":
+		return shellSource(ctx, handle, session, arg, opts)
+	case "CAPTURE":
+		return shellCapture(handle, arg)
+	case "COPY":
+		return shellCopy(ctx, handle, session, stmt)
+	case "CLEAR", "CLS":
+		return &ShellCommandResult{Command: "CLEAR", Action: "clear"}, nil
+	case "EXIT", "QUIT":
+		return &ShellCommandResult{Command: "EXIT", Action: "exit"}, nil
+	}
+	return shellCQL(ctx, handle, session, stmt, keyword, opts)
+}
+
+// shellDirective runs USE, CONSISTENCY, SERIAL CONSISTENCY, PAGING or
+// TRACING, keeping the change for the session
+func shellDirective(handle int, session *db.Session, stmt string) (*ShellCommandResult, error) {
+	exec := newExecutionContext(handle, session)
+	exec.persist = true
+	defer exec.close()
+
+	sr, _ := exec.runDirective(stmt)
+	// USE takes effect once the shared lock is released
+	if err := exec.close(); err != nil && sr.Success {
+		return nil, shellErrorf("KEYSPACE_ERROR", "%v", err)
+	}
+	if !sr.Success {
+		return nil, shellErrorf(sr.ErrorCode, "%s", sr.Error)
+	}
+	return &ShellCommandResult{Command: sr.Directive.Directive, Message: sr.Message, Result: sr.Directive}, nil
+}
+
+// shellExpand shows or sets expanded (vertical) row output
+func shellExpand(session *db.Session, arg string) (*ShellCommandResult, error) {
+	result := &ShellCommandResult{Command: "EXPAND"}
+	switch strings.ToUpper(arg) {
+	case "":
+		result.Message = "EXPAND is " + onOff(session.Expand())
+	case "ON", "OFF":
+		session.SetExpand(strings.EqualFold(arg, "ON"))
+		result.Message = "EXPAND set to " + onOff(session.Expand())
+	default:
+		return nil, shellErrorf("INVALID_VALUE", "Invalid expand value: %s (use ON or OFF)", arg)
+	}
+	result.Result = map[string]interface{}{"expand": session.Expand()}
+	return result, nil
+}
+
+// shellDescribe runs DESCRIBE: the listings of KEYSPACES, TABLES, TYPES,
+// FUNCTIONS and AGGREGATES, CLUSTER, and the DDL of SCHEMA, FULL SCHEMA or
+// a keyspace, table, type, function, aggregate, materialized view or index
+func shellDescribe(session *db.Session, arg string) (*ShellCommandResult, error) {
+	result := &ShellCommandResult{Command: "DESCRIBE"}
+	current := session.Keyspace()
+	words := strings.Fields(arg)
+	if len(words) == 0 {
+		return nil, shellErrorf("INVALID_OPTIONS", "DESCRIBE requires an object, e.g. DESCRIBE KEYSPACES or DESCRIBE TABLE name")
+	}
+	what := strings.ToUpper(words[0])
+	name := strings.TrimSpace(arg[len(words[0]):])
+	requireKeyspace := func() error {
+		if current == "" {
+			return shellErrorf("INVALID_OPTIONS", "No keyspace selected; USE a keyspace first")
+		}
+		return nil
+	}
+
+	var names []string
+	switch what {
+	case "KEYSPACES":
+		keyspaces, err := session.DescribeKeyspacesQuery()
+		if err != nil {
+			return nil, shellErrorf("DESCRIBE_ERROR", "%v", err)
+		}
+		for _, ks := range keyspaces {
+			names = append(names, ks.Name)
+		}
+
+	case "TABLES", "COLUMNFAMILIES":
+		var tables []db.TableListInfo
+		var err error
+		if current != "" {
+			tables, err = session.DescribeTablesQuery(current)
+		} else {
+			tables, err = session.DescribeAllTablesQuery() // Names are keyspace.table
+		}
+		if err != nil {
+			return nil, shellErrorf("DESCRIBE_ERROR", "%v", err)
+		}
+		for _, t := range tables {
+			names = append(names, t.Name)
+		}
+
+	case "TYPES":
+		if err := requireKeyspace(); err != nil {
+			return nil, err
+		}
+		types, err := session.DescribeTypesQuery(current)
+		if err != nil {
+			return nil, shellErrorf("DESCRIBE_ERROR", "%v", err)
+		}
+		for _, t := range types {
+			names = append(names, t.Name)
+		}
+
+	case "FUNCTIONS":
+		if err := requireKeyspace(); err != nil {
+			return nil, err
+		}
+		rows, err := session.DescribeFunctionsQuery(current)
+		if err != nil {
+			return nil, shellErrorf("DESCRIBE_ERROR", "%v", err)
+		}
+		for _, row := range rows[1:] { // The first row is the header
+			names = append(names, fmt.Sprintf("%s(%s)", row[0], row[1]))
+		}
+
+	case "AGGREGATES":
+		if err := requireKeyspace(); err != nil {
+			return nil, err
+		}
+		aggregates, err := session.DescribeAggregatesQuery(current)
+		if err != nil {
+			return nil, shellErrorf("DESCRIBE_ERROR", "%v", err)
+		}
+		for _, a := range aggregates {
+			names = append(names, fmt.Sprintf("%s(%s)", a.Name, strings.Join(a.ArgumentTypes, ", ")))
+		}
+
+	case "CLUSTER":
+		info, err := session.DescribeClusterQuery()
+		if err != nil {
+			return nil, shellErrorf("DESCRIBE_ERROR", "%v", err)
+		}
+		result.Output = fmt.Sprintf("Cluster: %s\nPartitioner: %s\nVersion: %s", info.ClusterName, info.Partitioner, info.Version)
+		result.Result = info
+		return result, nil
+
+	default:
+		opts, err := describeTarget(session, what, name, arg)
+		if err != nil {
+			return nil, err
+		}
+		ddl, err := GenerateDDLWithOptions(session.GocqlSession(), *opts)
+		if err != nil {
+			return nil, shellErrorf("DESCRIBE_ERROR", "%v", err)
+		}
+		result.Output = ddl.DDL
+		result.Result = ddl
+		return result, nil
+	}
+
+	sort.Strings(names)
+	result.Output = strings.Join(names, "  ")
+	result.Result = names
+	return result, nil
+}
+
+// describeTarget maps DESCRIBE of a single object to DDL options. A bare
+// name is a keyspace if one has that name, else a table.
+func describeTarget(session *db.Session, what, name, arg string) (*DDLOptions, error) {
+	current := session.Keyspace()
+	opts := &DDLOptions{skipVirtual: !session.SupportsVirtualTables()}
+	qualified := func(n string) (string, string, error) {
+		if i := strings.Index(n, "("); i >= 0 {
+			n = n[:i] // Function and aggregate argument lists are not needed
+		}
+		ks, obj := splitTableName(n, current)
+		if obj == "" {
+			return "", "", shellErrorf("INVALID_OPTIONS", "DESCRIBE %s requires a name", what)
+		}
+		if ks == "" {
+			return "", "", shellErrorf("INVALID_OPTIONS", "No keyspace specified and no current keyspace")
+		}
+		return ks, obj, nil
+	}
+
+	var err error
+	switch what {
+	case "SCHEMA":
+		opts.Cluster = true
+	case "FULL":
+		if !strings.EqualFold(name, "SCHEMA") {
+			return nil, shellErrorf("INVALID_OPTIONS", "Use DESCRIBE FULL SCHEMA")
+		}
+		opts.Cluster, opts.IncludeSystem = true, true
+	case "KEYSPACE":
+		opts.Keyspace = current
+		if name != "" {
+			opts.Keyspace = unquoteTablePart(name)
+		}
+		if opts.Keyspace == "" {
+			return nil, shellErrorf("INVALID_OPTIONS", "No keyspace specified and no current keyspace")
+		}
+	case "TABLE", "COLUMNFAMILY":
+		opts.Keyspace, opts.Table, err = qualified(name)
+	case "TYPE":
+		opts.Keyspace, opts.Type, err = qualified(name)
+	case "FUNCTION":
+		opts.Keyspace, opts.Function, err = qualified(name)
+	case "AGGREGATE":
+		opts.Keyspace, opts.Aggregate, err = qualified(name)
+	case "MATERIALIZED":
+		rest := strings.Fields(name)
+		if len(rest) == 0 || !strings.EqualFold(rest[0], "VIEW") {
+			return nil, shellErrorf("INVALID_OPTIONS", "Use DESCRIBE MATERIALIZED VIEW name")
+		}
+		opts.Keyspace, opts.View, err = qualified(strings.TrimSpace(name[len(rest[0]):]))
+	case "INDEX":
+		if opts.Keyspace, opts.Index, err = qualified(name); err == nil {
+			index, ierr := session.DescribeIndexQuery(opts.Keyspace, opts.Index)
+			if ierr != nil {
+				return nil, shellErrorf("DESCRIBE_ERROR", "%v", ierr)
+			}
+			opts.Table = index.TableName
+		}
+	default:
+		if opts.Keyspace, opts.Table, err = qualified(arg); err != nil {
+			return nil, err
+		}
+		if !strings.Contains(arg, ".") {
+			keyspaces, kerr := session.DescribeKeyspacesQuery()
+			if kerr != nil {
+				return nil, shellErrorf("DESCRIBE_ERROR", "%v", kerr)
+			}
+			for _, ks := range keyspaces {
+				if ks.Name == opts.Table {
+					return &DDLOptions{Keyspace: ks.Name, skipVirtual: opts.skipVirtual}, nil
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// shellShow runs SHOW VERSION, SHOW HOST and SHOW SESSION <trace id>
+func shellShow(session *db.Session, arg string) (*ShellCommandResult, error) {
+	result := &ShellCommandResult{Command: "SHOW"}
+	words := strings.Fields(arg)
+	if len(words) == 0 {
+		return nil, shellErrorf("INVALID_OPTIONS", "Use SHOW VERSION, SHOW HOST or SHOW SESSION <trace id>")
+	}
+
+	switch strings.ToUpper(words[0]) {
+	case "VERSION":
+		var release, cqlVersion, protocol string
+		err := session.Query("SELECT release_version, cql_version, native_protocol_version FROM system.local").Scan(&release, &cqlVersion, &protocol)
+		if err != nil {
+			return nil, shellErrorf("QUERY_ERROR", "%v", err)
+		}
+		result.Output = fmt.Sprintf("[Cassandra %s | CQL spec %s | Native protocol v%s]", release, cqlVersion, protocol)
+		result.Result = map[string]interface{}{
+			"cassandraVersion": release,
+			"cqlVersion":       cqlVersion,
+			"protocolVersion":  protocol,
+		}
+
+	case "HOST":
+		clusterName := ""
+		if info, err := session.DescribeClusterQuery(); err == nil {
+			clusterName = info.ClusterName
+		}
+		result.Output = fmt.Sprintf("Connected to %s at %s:%d.", clusterName, session.Host(), session.Port())
+		result.Result = map[string]interface{}{
+			"clusterName": clusterName,
+			"host":        session.Host(),
+			"port":        session.Port(),
+		}
+
+	case "SESSION":
+		if len(words) != 2 {
+			return nil, shellErrorf("INVALID_OPTIONS", "Use SHOW SESSION <trace id>")
+		}
+		trace, err := getQueryTraceBySessionID(session, words[1])
+		if err != nil {
+			return nil, shellErrorf("TRACE_ERROR", "%v", err)
+		}
+		rows := make([]map[string]interface{}, len(trace.Events))
+		for i, e := range trace.Events {
+			rows[i] = map[string]interface{}{
+				"activity":       e.Activity,
+				"timestamp":      e.Timestamp,
+				"source":         e.Source,
+				"source_elapsed": e.SourceElapsed,
+			}
+		}
+		result.Output = fmt.Sprintf("Tracing session: %s\n\n%s", trace.Session.SessionID,
+			formatShellRows([]string{"activity", "timestamp", "source", "source_elapsed"}, rows, false))
+		result.Result = trace
+
+	default:
+		return nil, shellErrorf("INVALID_OPTIONS", "Use SHOW VERSION, SHOW HOST or SHOW SESSION <trace id>")
+	}
+	return result, nil
+}
+
+// shellSource runs SOURCE 'file'. Settings the file changes are kept, as
+// if its lines had been typed at the prompt.
+func shellSource(ctx context.Context, handle int, session *db.Session, arg string, opts ShellCommandOptions) (*ShellCommandResult, error) {
+	path := unquoteShellPath(arg)
+	if path == "" {
+		return nil, shellErrorf("INVALID_OPTIONS", "Use SOURCE 'file'")
+	}
+
+	release, err := acquireBulkContext(ctx, handle, "source")
+	if err != nil {
+		return nil, shellErrorf("CANCELLED", "%v", err)
+	}
+	defer release()
+
+	exec := newExecutionContext(handle, session)
+	exec.persist = true
+	defer exec.close()
+
+	var progress FileExecutionProgress
+	sourceOpts := &SourceFilesOptions{
+		Scripts:     []SourceScript{{Path: path}},
+		StopOnError: opts.StopOnError,
+	}
+	result, err := executeSourceFiles(ctx, handle, session, exec, sourceOpts, func(p FileExecutionProgress) {
+		progress = p
+	})
+	if err != nil {
+		return nil, shellErrorf("EXECUTION_ERROR", "%v", err)
+	}
+	if err := exec.close(); err != nil {
+		return nil, shellErrorf("KEYSPACE_ERROR", "%v", err)
+	}
+
+	message := fmt.Sprintf("Executed %d statements from %s", result.StatementsOK, path)
+	if result.StatementsFailed > 0 {
+		message += fmt.Sprintf(" (%d failed)", result.StatementsFailed)
+	}
+	return &ShellCommandResult{
+		Command: "SOURCE",
+		Message: message,
+		Output:  strings.Join(result.Errors, "\n"),
+		Result: map[string]interface{}{
+			"result":   result,
+			"progress": progress,
+		},
+	}, nil
+}
+
+// shellCapture runs CAPTURE 'file', CAPTURE OFF and CAPTURE, with the
+// messages cqlsh prints
+func shellCapture(handle int, arg string) (*ShellCommandResult, error) {
+	captureFilesLock.Lock()
+	defer captureFilesLock.Unlock()
+	current := captureFiles[handle]
+	result := &ShellCommandResult{Command: "CAPTURE"}
+
+	switch {
+	case arg == "":
+		if current == "" {
+			result.Message = "Not currently capturing output."
+		} else {
+			result.Message = fmt.Sprintf("Currently capturing to '%s'.", current)
+		}
+
+	case strings.EqualFold(arg, "OFF"):
+		if current == "" {
+			result.Message = "Not currently capturing output."
+			break
+		}
+		delete(captureFiles, handle)
+		result.Message = fmt.Sprintf("Stopped capture. Output saved to '%s'.", current)
+		return result, nil
+
+	default:
+		if current != "" {
+			return nil, shellErrorf("CAPTURE_ERROR", "Already capturing output to '%s'. Use CAPTURE OFF to disable.", current)
+		}
+		path, err := config.NormalizePath(unquoteShellPath(arg))
+		if err != nil {
+			return nil, shellErrorf("CAPTURE_ERROR", "%v", err)
+		}
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600) // #nosec G304 - user-provided path
+		if err != nil {
+			return nil, shellErrorf("CAPTURE_ERROR", "Cannot capture to %s: %v", path, err)
+		}
+		_ = file.Close()
+		captureFiles[handle] = path
+		result.Message = fmt.Sprintf("Now capturing query output to '%s'.", path)
+	}
+	result.Capture = captureFiles[handle]
+	return result, nil
+}
+
+// captureOutput appends the text of a command's output to the handle's
+// capture file, if any
+func captureOutput(handle int, result *ShellCommandResult) {
+	captureFilesLock.Lock()
+	defer captureFilesLock.Unlock()
+	path := captureFiles[handle]
+	if path == "" {
+		return
+	}
+	result.Capture = path
+
+	text := result.Output
+	if text == "" {
+		text = result.Message
+	}
+	if text == "" {
+		return
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304 - path chosen by CAPTURE
+	if err == nil {
+		_, err = file.WriteString(text + "\n\n")
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		result.Warnings = append(result.Warnings, "output not captured: "+err.Error())
+	}
+}
+
+// discardCapture stops the handle's capture
+func discardCapture(handle int) {
+	captureFilesLock.Lock()
+	defer captureFilesLock.Unlock()
+	delete(captureFiles, handle)
+}
+
+// shellCopy runs COPY TO and COPY FROM
+func shellCopy(ctx context.Context, handle int, session *db.Session, stmt string) (*ShellCommandResult, error) {
+	m := shellCopyPattern.FindStringSubmatch(stmt)
+	if m == nil {
+		return nil, shellErrorf("INVALID_PARAMS", "Invalid COPY syntax. Use: COPY table [(columns)] TO|FROM 'file' [WITH option = value [AND ...]]")
+	}
+	params := CopyParams{
+		Table:    m[1],
+		Filename: m[4] + m[5] + m[6],
+		Options:  make(map[string]string),
+	}
+	if m[2] != "" {
+		for _, col := range strings.Split(m[2], ",") {
+			params.Columns = append(params.Columns, strings.TrimSpace(col))
+		}
+	}
+	if m[7] != "" {
+		for _, part := range shellAndPattern.Split(m[7], -1) {
+			if opt := shellOptionPattern.FindStringSubmatch(part); opt != nil {
+				params.Options[strings.ToUpper(opt[1])] = opt[2] + opt[3] + opt[4]
+			}
+		}
+	}
+	direction, kind := strings.ToUpper(m[3]), "copyTo"
+	if direction == "FROM" {
+		kind = "copyFrom"
+	}
+
+	release, err := acquireBulk(handle, kind)
+	if err != nil {
+		return nil, shellErrorf("CANCELLED", "%v", err)
+	}
+	defer release()
+	unlock := lockHandleShared(handle)
+	defer unlock()
+
+	options := mergeCopyOptions(defaultCopyOptions(), params.Options)
+	if format, _ := copyFormat(params, options); format == copyParquet && !featureEnabled(session.Workspace(), featureParquetCopy) {
+		return nil, shellErrorf("FEATURE_DISABLED", "%s", featureDisabledMessage(session.Workspace(), featureParquetCopy))
+	}
+	result := &ShellCommandResult{Command: "COPY"}
+	if direction == "TO" {
+		if key := autoCsvOption(options); key != "" {
+			return nil, shellErrorf("INVALID_PARAMS", "%s=auto applies to COPY FROM only", key)
+		}
+		copied, err := executeCopyTo(ctx, session, params, options, nil)
+		if err != nil {
+			return nil, shellErrorf("COPY_ERROR", "%v", err)
+		}
+		result.Message = fmt.Sprintf("Exported %d rows to %s", copied.RowsExported, params.Filename)
+		result.Result = copied
+		return result, nil
+	}
+
+	copied, err := executeCopyFrom(handle, session, params, options)
+	if err != nil {
+		return nil, shellErrorf("COPY_ERROR", "%v", err)
+	}
+	result.Message = fmt.Sprintf("Imported %d rows from %s", copied.RowsImported, params.Filename)
+	if copied.Errors > 0 {
+		result.Message += fmt.Sprintf(" (%d insert errors)", copied.Errors)
+	}
+	if copied.ParseErrors > 0 {
+		result.Message += fmt.Sprintf(" (%d parse errors)", copied.ParseErrors)
+	}
+	result.Result = copied
+	result.Warnings = copied.Warnings
+	return result, nil
+}
+
+// shellCQL runs input that is not a special command as a CQL statement
+func shellCQL(ctx context.Context, handle int, session *db.Session, stmt, identifier string, opts ShellCommandOptions) (*ShellCommandResult, error) {
+	unlock := lockHandleShared(handle)
+	defer unlock()
+
+	if estimate := checkScanGuard(handle, session, stmt, opts.Force); estimate != nil {
+		return nil, shellErrorf("SCAN_LIMIT_EXCEEDED", "%s", scanGuardMessage(estimate))
+	}
+	if tooLarge := checkStatementPayload(handle, session, 0, stmt, nil); tooLarge != nil {
+		return nil, shellErrorf("PAYLOAD_TOO_LARGE", "%s", tooLarge.message())
+	}
+	sr := executeStatement(ctx, handle, session, stmt, 0, identifier, nil)
+	if !sr.Success {
+		return nil, shellErrorf(sr.ErrorCode, "%s", sr.Error)
+	}
+
+	result := &ShellCommandResult{Command: "CQL", Message: sr.Message, Result: sr}
+	if len(sr.Columns) > 0 {
+		result.Output = formatShellRows(sr.Columns, sr.Rows, session.Expand())
+	}
+	return result, nil
+}
+
+// unquoteShellPath strips the quotes around a file name
+func unquoteShellPath(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0] {
+		return arg[1 : len(arg)-1]
+	}
+	return arg
+}
+
+// formatShellRows renders rows as cqlsh prints them: a table, or one block
+// per row when expand is on, followed by the row count
+func formatShellRows(columns []string, rows []map[string]interface{}, expand bool) string {
+	cells := make([][]string, len(rows))
+	widths := make([]int, len(columns))
+	nameWidth, valueWidth := 0, 0
+	for i, col := range columns {
+		widths[i] = len(col)
+		nameWidth = max(nameWidth, len(col))
+	}
+	for r, row := range rows {
+		cells[r] = make([]string, len(columns))
+		for i, col := range columns {
+			v := "null"
+			if row[col] != nil {
+				v = formatCSVValue(row[col])
+			}
+			cells[r][i] = v
+			widths[i] = max(widths[i], len(v))
+			valueWidth = max(valueWidth, len(v))
+		}
+	}
+
+	var b strings.Builder
+	if expand {
+		for r := range cells {
+			fmt.Fprintf(&b, "@ Row %d\n%s+%s\n", r+1, strings.Repeat("-", nameWidth+2), strings.Repeat("-", valueWidth+2))
+			for i, col := range columns {
+				fmt.Fprintf(&b, " %-*s | %s\n", nameWidth, col, cells[r][i])
+			}
+			b.WriteString("\n")
+		}
+	} else {
+		line := func(values []string) {
+			parts := make([]string, len(values))
+			for i, v := range values {
+				parts[i] = fmt.Sprintf(" %-*s ", widths[i], v)
+			}
+			b.WriteString(strings.TrimRight(strings.Join(parts, "|"), " ") + "\n")
+		}
+		line(columns)
+		seps := make([]string, len(columns))
+		for i, w := range widths {
+			seps[i] = strings.Repeat("-", w+2)
+		}
+		b.WriteString(strings.Join(seps, "+") + "\n")
+		for _, row := range cells {
+			line(row)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "(%d rows)", len(rows))
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/cql"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// similarityScoreAlias is the result column a similarity score is returned in
+const similarityScoreAlias = "similarity_score"
+
+// SimilarityScore marks the result column of a vector search that holds the
+// similarity of each row to the query vector, so it can be shown as a
+// relevance column
+type SimilarityScore struct {
+	Column       string `json:"column"`       // Result column holding the score
+	Function     string `json:"function"`     // similarity_cosine, similarity_euclidean or similarity_dot_product
+	VectorColumn string `json:"vectorColumn"` // Vector column searched
+	Order        string `json:"order"`        // Always "desc": higher scores are more similar
+}
+
+// validSimilarity reports whether s is a similarityScore option value
+func validSimilarity(s string) bool {
+	_, ok := cql.SimilarityFunctions[strings.ToUpper(s)]
+	return ok || strings.EqualFold(s, "auto")
+}
+
+// addSimilarityScore rewrites a vector search (ORDER BY ... ANN OF) to also
+// select its similarity score. similarity names the function, or is "auto"
+// for the similarity_function of the column's index. Statements that are not
+// vector searches are returned unchanged with a nil score.
+func addSimilarityScore(session *db.Session, stmt, similarity string) (string, *SimilarityScore, error) {
+	analysis, err := cql.AnalyzeSelect(stmt)
+	if err != nil {
+		return stmt, nil, nil
+	}
+	ann := cql.ParseAnnOrdering(analysis.OrderBy)
+	if ann == nil {
+		return stmt, nil, nil
+	}
+
+	keyspace := analysis.Keyspace
+	if keyspace == "" {
+		keyspace = session.Keyspace()
+	}
+	var columns []string
+	if ks, err := session.KeyspaceMetadata(keyspace); err == nil {
+		if table := ks.Tables[analysis.Table]; table != nil {
+			columns = table.OrderedColumns
+		}
+	}
+
+	if strings.EqualFold(similarity, "auto") {
+		similarity = indexSimilarity(session, keyspace, analysis.Table, ann.Column)
+	}
+
+	// Keep clear of a table column with the same name
+	alias := similarityScoreAlias
+	for n := 1; slices.Contains(columns, alias); n++ {
+		alias = fmt.Sprintf("%s_%d", similarityScoreAlias, n)
+	}
+
+	rewritten, _, err := cql.AddSimilarityScore(stmt, similarity, alias, columns)
+	if err != nil {
+		return stmt, nil, err
+	}
+	return rewritten, &SimilarityScore{
+		Column:       alias,
+		Function:     cql.SimilarityFunctions[strings.ToUpper(similarity)],
+		VectorColumn: ann.Column,
+		Order:        "desc",
+	}, nil
+}
+
+// indexSimilarity returns the similarity_function of the vector index on a
+// column; COSINE, the index default, when it has none or cannot be read
+func indexSimilarity(session *db.Session, keyspace, table, column string) string {
+	var options map[string]string
+	iter := session.Query("SELECT options FROM system_schema.indexes WHERE keyspace_name = ? AND table_name = ?", keyspace, table).Iter()
+	defer iter.Close()
+	for iter.Scan(&options) {
+		if strings.Trim(options["target"], `"`) != column {
+			continue
+		}
+		if fn := strings.ToUpper(options["similarity_function"]); fn != "" {
+			return fn
+		}
+	}
+	return "COSINE"
+}
@@ -1,64 +1,107 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/axonops/cqlai-node/internal/batch"
+	"github.com/axonops/cqlai-node/internal/config"
 	"github.com/axonops/cqlai-node/internal/db"
 )
 
-// Source execution cancellation - keyed by session handle for isolation
-var (
-	sourceExecutionCancelled = make(map[int]bool)
-	sourceExecutionLock      sync.Mutex
+// FileExecutionProgress represents progress info for a single file
+type FileExecutionProgress struct {
+	FilePath         string            `json:"filePath"`
+	FileIndex        int               `json:"fileIndex"`
+	TotalFiles       int               `json:"totalFiles"`
+	StatementsTotal  int               `json:"statementsTotal"`
+	StatementsRun    int               `json:"statementsRun"`
+	StatementsOK     int               `json:"statementsOK"`
+	StatementsFailed int               `json:"statementsFailed"`
+	CurrentStatement string            `json:"currentStatement,omitempty"`
+	Errors           []string          `json:"errors,omitempty"`
+	Directives       []DirectiveEffect `json:"directives,omitempty"` // USE and cqlsh directives run from the file
+	IsComplete       bool              `json:"isComplete"`
+	Cancelled        bool              `json:"cancelled"` // true if cancelled by user
+	Duration         int64             `json:"duration"`  // milliseconds
+}
+
+// Limits for scripts downloaded from a URL
+const (
+	maxSourceScriptBytes = 16 * 1024 * 1024
+	sourceFetchTimeout   = 30 * time.Second
 )
 
-// isSourceExecutionCancelled checks if execution was cancelled for a specific session
-func isSourceExecutionCancelled(handle int) bool {
-	sourceExecutionLock.Lock()
-	defer sourceExecutionLock.Unlock()
-	return sourceExecutionCancelled[handle]
+// SourceScript is one script to execute. Exactly one of Path, Content and URL is set.
+type SourceScript struct {
+	Name    string `json:"name,omitempty"`    // Shown as filePath in progress; defaults to the path or URL
+	Path    string `json:"path,omitempty"`    // Local file
+	Content string `json:"content,omitempty"` // Script text, e.g. an editor buffer
+	URL     string `json:"url,omitempty"`     // https:// only
+	SHA256  string `json:"sha256,omitempty"`  // Hex digest of the script; required for URL
 }
 
-// cancelSourceExecution sets the cancellation flag for a specific session
-func cancelSourceExecution(handle int) {
-	sourceExecutionLock.Lock()
-	defer sourceExecutionLock.Unlock()
-	sourceExecutionCancelled[handle] = true
+// displayName returns the name used for the script in progress and errors
+func (s SourceScript) displayName(index int) string {
+	switch {
+	case s.Name != "":
+		return s.Name
+	case s.Path != "":
+		return s.Path
+	case s.URL != "":
+		return s.URL
+	default:
+		return fmt.Sprintf("<inline %d>", index+1)
+	}
 }
 
-// resetSourceExecutionCancellation resets the cancellation flag for a specific session
-func resetSourceExecutionCancellation(handle int) {
-	sourceExecutionLock.Lock()
-	defer sourceExecutionLock.Unlock()
-	delete(sourceExecutionCancelled, handle)
-}
+// validate checks that the script has exactly one source and that URLs are
+// https with a checksum, so a script is never run from an unverified download
+func (s SourceScript) validate() error {
+	sources := 0
+	for _, set := range []bool{s.Path != "", s.Content != "", s.URL != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of path, content or url is required")
+	}
 
-// FileExecutionProgress represents progress info for a single file
-type FileExecutionProgress struct {
-	FilePath         string   `json:"filePath"`
-	FileIndex        int      `json:"fileIndex"`
-	TotalFiles       int      `json:"totalFiles"`
-	StatementsTotal  int      `json:"statementsTotal"`
-	StatementsRun    int      `json:"statementsRun"`
-	StatementsOK     int      `json:"statementsOK"`
-	StatementsFailed int      `json:"statementsFailed"`
-	CurrentStatement string   `json:"currentStatement,omitempty"`
-	Errors           []string `json:"errors,omitempty"`
-	IsComplete       bool     `json:"isComplete"`
-	Cancelled        bool     `json:"cancelled"` // true if cancelled by user
-	Duration         int64    `json:"duration"`  // milliseconds
+	if s.SHA256 != "" {
+		if digest, err := hex.DecodeString(s.SHA256); err != nil || len(digest) != sha256.Size {
+			return fmt.Errorf("sha256 must be a %d character hex digest", sha256.Size*2)
+		}
+	}
+
+	if s.URL != "" {
+		u, err := url.Parse(s.URL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("url must be an https:// URL: %s", s.URL)
+		}
+		if s.SHA256 == "" {
+			return fmt.Errorf("sha256 is required for url %s", s.URL)
+		}
+	}
+	return nil
 }
 
-// SourceFilesOptions contains options for executing CQL files
+// SourceFilesOptions contains options for executing CQL scripts
 type SourceFilesOptions struct {
-	Files       []string `json:"files"`
-	StopOnError bool     `json:"stopOnError"`
+	Scripts     []SourceScript `json:"scripts"`
+	StopOnError bool           `json:"stopOnError"`
+	Savepoint   bool           `json:"savepoint"` // Record a rollback plan for schema changes
 }
 
 // SourceFilesResult is the final result after all files are executed
@@ -73,148 +116,152 @@ type SourceFilesResult struct {
 	Errors           []string `json:"errors,omitempty"`
 	Stopped          bool     `json:"stopped"`   // true if stopped due to error
 	Cancelled        bool     `json:"cancelled"` // true if cancelled by user
+	RollbackPlanID   string   `json:"rollbackPlanId,omitempty"`
 }
 
-// parseCQLFile reads a CQL file and extracts individual statements
-func parseCQLFile(filePath string) ([]string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %v", err)
+// sourceScriptOpener verifies a script and returns a function that opens it
+// for reading. Files are reopened on each call rather than held in memory;
+// downloads and inline content are checked against their checksum once.
+func sourceScriptOpener(script SourceScript) (func() (io.ReadCloser, error), error) {
+	if script.Path != "" {
+		path, err := config.NormalizePath(script.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file path: %v", err)
+		}
+		return func() (io.ReadCloser, error) {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open file: %v", err)
+			}
+			return file, nil
+		}, nil
 	}
-	defer file.Close()
-
-	var statements []string
-	var currentStatement strings.Builder
-	scanner := bufio.NewScanner(file)
-
-	// Increase buffer size for large files
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
 
-	inString := false
-	stringChar := rune(0)
-	inBlockComment := false
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Skip empty lines
-		trimmedLine := strings.TrimSpace(line)
-		if trimmedLine == "" {
-			continue
+	content := []byte(script.Content)
+	if script.URL != "" {
+		var err error
+		if content, err = fetchSourceScript(script.URL); err != nil {
+			return nil, err
 		}
+	}
 
-		// Handle single-line comments at start of line
-		if !inString && !inBlockComment {
-			if strings.HasPrefix(trimmedLine, "--") || strings.HasPrefix(trimmedLine, "//") {
-				continue
-			}
+	if script.SHA256 != "" {
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, script.SHA256) {
+			return nil, fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", strings.ToLower(script.SHA256), actual)
 		}
+	}
 
-		// Process character by character to handle strings, comments, and semicolons
-		for i := 0; i < len(line); i++ {
-			char := rune(line[i])
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}, nil
+}
 
-			// Handle block comments
-			if !inString && !inBlockComment && i+1 < len(line) && line[i:i+2] == "/*" {
-				inBlockComment = true
-				i++ // skip next char
-				continue
-			}
-			if inBlockComment {
-				if i+1 < len(line) && line[i:i+2] == "*/" {
-					inBlockComment = false
-					i++ // skip next char
-				}
-				continue
-			}
+// countSourceStatements reads a script through once to count its statements,
+// so progress has a total and a malformed script fails before anything runs
+func countSourceStatements(open func() (io.ReadCloser, error)) (int, error) {
+	r, err := open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	statements := batch.NewStatementReader(r)
+	count := 0
+	for {
+		if _, err := statements.Next(); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("error reading script: %v", err)
+		}
+		count++
+	}
+}
 
-			// Handle single-line comments
-			if !inString && i+1 < len(line) && (line[i:i+2] == "--" || line[i:i+2] == "//") {
-				break // skip rest of line
+// fetchSourceScript downloads a script over https. Redirects to other schemes are refused.
+func fetchSourceScript(scriptURL string) ([]byte, error) {
+	client := &http.Client{
+		Timeout: sourceFetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing redirect to non-https URL %s", req.URL)
 			}
-
-			if inString {
-				currentStatement.WriteRune(char)
-				if char == stringChar {
-					// Check for escaped quote (doubled)
-					if i+1 < len(line) && rune(line[i+1]) == stringChar {
-						currentStatement.WriteRune(rune(line[i+1]))
-						i++
-						continue
-					}
-					inString = false
-				}
-			} else {
-				if char == '\'' || char == '"' {
-					inString = true
-					stringChar = char
-					currentStatement.WriteRune(char)
-				} else if char == ';' {
-					// End of statement
-					stmt := strings.TrimSpace(currentStatement.String())
-					if stmt != "" {
-						statements = append(statements, stmt)
-					}
-					currentStatement.Reset()
-				} else {
-					currentStatement.WriteRune(char)
-				}
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
 			}
-		}
-
-		// Add space between lines (for multi-line statements)
-		if currentStatement.Len() > 0 {
-			currentStatement.WriteRune(' ')
-		}
+			return nil
+		},
 	}
 
-	// Handle last statement without semicolon
-	if stmt := strings.TrimSpace(currentStatement.String()); stmt != "" {
-		statements = append(statements, stmt)
+	resp, err := client.Get(scriptURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download script: %v", err)
 	}
+	defer resp.Body.Close()
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file: %v", err)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download script: HTTP %d", resp.StatusCode)
 	}
 
-	return statements, nil
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSourceScriptBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download script: %v", err)
+	}
+	if len(content) > maxSourceScriptBytes {
+		return nil, fmt.Errorf("script exceeds %d MB", maxSourceScriptBytes/(1024*1024))
+	}
+	return content, nil
 }
 
-// executeSourceFiles executes multiple CQL files and sends progress via callback
-// The handle parameter is the session handle used for per-session cancellation isolation
-func executeSourceFiles(handle int, session *db.Session, options *SourceFilesOptions, progressCallback func(FileExecutionProgress)) (*SourceFilesResult, error) {
-	// Reset cancellation flag at start for this session
-	resetSourceExecutionCancellation(handle)
-
+// executeSourceFiles executes multiple CQL scripts and sends progress via callback.
+// Execution stops when ctx is cancelled (see cancel.go); the handle owns the rollback plan.
+func executeSourceFiles(ctx context.Context, handle int, session *db.Session, exec *executionContext, options *SourceFilesOptions, progressCallback func(FileExecutionProgress)) (*SourceFilesResult, error) {
 	result := &SourceFilesResult{
-		TotalFiles: len(options.Files),
+		TotalFiles: len(options.Scripts),
 		Errors:     []string{},
 	}
 
-	gocqlSession := session.GocqlSession()
+	var sp *savepoint
+	if options.Savepoint {
+		sp = &savepoint{session: session, plan: newRollbackPlan(handle)}
+		result.RollbackPlanID = sp.plan.ID
+	}
+
 	startTime := time.Now()
 
-	for fileIndex, filePath := range options.Files {
+	for fileIndex, script := range options.Scripts {
 		// Check for cancellation before processing each file
-		if isSourceExecutionCancelled(handle) {
+		if ctx.Err() != nil {
 			result.Cancelled = true
 			result.TotalDuration = time.Since(startTime).Milliseconds()
 			return result, nil
 		}
 		fileStartTime := time.Now()
+		filePath := script.displayName(fileIndex)
 
 		progress := FileExecutionProgress{
 			FilePath:   filePath,
 			FileIndex:  fileIndex,
-			TotalFiles: len(options.Files),
+			TotalFiles: len(options.Scripts),
 			Errors:     []string{},
 		}
 
-		// Parse the CQL file
-		statements, err := parseCQLFile(filePath)
+		// Verify the script and count its statements; the script is then read
+		// again and each statement runs as soon as it is parsed
+		open, err := sourceScriptOpener(script)
+		if err == nil {
+			progress.StatementsTotal, err = countSourceStatements(open)
+		}
+		var reader io.ReadCloser
+		if err == nil {
+			reader, err = open()
+		}
 		if err != nil {
-			progress.Errors = append(progress.Errors, fmt.Sprintf("Failed to parse file: %v", err))
+			if script.Path != "" {
+				progress.Errors = append(progress.Errors, fmt.Sprintf("Failed to parse file: %v", err))
+			} else {
+				progress.Errors = append(progress.Errors, fmt.Sprintf("Failed to load script: %v", err))
+			}
 			progress.IsComplete = true
 			progress.Duration = time.Since(fileStartTime).Milliseconds()
 			progressCallback(progress)
@@ -230,14 +277,15 @@ func executeSourceFiles(handle int, session *db.Session, options *SourceFilesOpt
 			continue
 		}
 
-		progress.StatementsTotal = len(statements)
-		result.TotalStatements += len(statements)
+		result.TotalStatements += progress.StatementsTotal
+		statements := batch.NewStatementReader(reader)
 
 		// Execute each statement
 		fileHasError := false
-		for stmtIndex, stmt := range statements {
+		for stmtIndex := 0; ; stmtIndex++ {
 			// Check for cancellation before each statement
-			if isSourceExecutionCancelled(handle) {
+			if ctx.Err() != nil {
+				reader.Close()
 				progress.IsComplete = true
 				progress.Cancelled = true
 				progress.Duration = time.Since(fileStartTime).Milliseconds()
@@ -248,14 +296,77 @@ func executeSourceFiles(handle int, session *db.Session, options *SourceFilesOpt
 				return result, nil
 			}
 
+			stmt, err := statements.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// The file changed or became unreadable since it was counted
+				errMsg := fmt.Sprintf("Failed to parse file: %v", err)
+				progress.Errors = append(progress.Errors, errMsg)
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", filePath, errMsg))
+				fileHasError = true
+				if options.StopOnError {
+					reader.Close()
+					progress.IsComplete = true
+					progress.Duration = time.Since(fileStartTime).Milliseconds()
+					progressCallback(progress)
+
+					result.FilesFailed++
+					result.Stopped = true
+					result.TotalDuration = time.Since(startTime).Milliseconds()
+					return result, nil
+				}
+				break
+			}
+
 			progress.StatementsRun = stmtIndex + 1
 			progress.CurrentStatement = truncateStatement(stmt, 200)
 
 			// Send progress before execution
 			progressCallback(progress)
 
-			// Execute the statement
-			err := gocqlSession.Query(stmt).Exec()
+			// USE and cqlsh directives apply to the rest of the script
+			if sr, ok := exec.runDirective(stmt); ok {
+				if sr.Success {
+					sr.Directive.Statement = stmtIndex + 1
+					progress.Directives = append(progress.Directives, *sr.Directive)
+				} else {
+					err = errors.New(sr.Error)
+				}
+			} else {
+				// Snapshot what the statement changes while the schema is still unchanged
+				var step *RollbackStep
+				if sp != nil {
+					step = sp.prepare(filePath, stmt, exec.keyspace)
+				}
+
+				// Execute the statement; cancelling abandons it and stops before the next one
+				prof := profileStatement(handle, session, "query", stmt, nil)
+				var queryOpts *db.QueryOptions
+				if queryOpts, err = exec.queryOptions(); err == nil {
+					err = session.QueryWithOptions(ctx, stmt, queryOpts).Exec()
+				}
+				if err != nil {
+					prof.done(0, err.Error())
+				} else {
+					prof.done(0, "")
+				}
+				if err == nil && sp != nil {
+					sp.applied(step)
+				}
+			}
+			if err != nil && ctx.Err() != nil {
+				reader.Close()
+				progress.IsComplete = true
+				progress.Cancelled = true
+				progress.Duration = time.Since(fileStartTime).Milliseconds()
+				progressCallback(progress)
+
+				result.Cancelled = true
+				result.TotalDuration = time.Since(startTime).Milliseconds()
+				return result, nil
+			}
 			if err != nil {
 				progress.StatementsFailed++
 				result.StatementsFailed++
@@ -264,6 +375,7 @@ func executeSourceFiles(handle int, session *db.Session, options *SourceFilesOpt
 				fileHasError = true
 
 				if options.StopOnError {
+					reader.Close()
 					progress.IsComplete = true
 					progress.Duration = time.Since(fileStartTime).Milliseconds()
 					progressCallback(progress)
@@ -279,6 +391,7 @@ func executeSourceFiles(handle int, session *db.Session, options *SourceFilesOpt
 				result.StatementsOK++
 			}
 		}
+		reader.Close()
 
 		progress.IsComplete = true
 		progress.Duration = time.Since(fileStartTime).Milliseconds()
@@ -301,10 +414,5 @@ func truncateStatement(stmt string, maxLen int) string {
 	// Remove newlines and extra spaces
 	re := regexp.MustCompile(`\s+`)
 	stmt = re.ReplaceAllString(stmt, " ")
-	stmt = strings.TrimSpace(stmt)
-
-	if len(stmt) > maxLen {
-		return stmt[:maxLen] + "..."
-	}
-	return stmt
+	return truncateStmt(strings.TrimSpace(stmt), maxLen)
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sort"
+	"unicode/utf16"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// SourceRange locates a statement in the text it was split from. Offsets are
+// in bytes of the UTF-8 text; lines and columns start at 1, and columns count
+// UTF-16 code units, as JavaScript strings and editors do. The end is just
+// past the statement's last character.
+type SourceRange struct {
+	Start       int `json:"start"`
+	End         int `json:"end"`
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+// sourcePositions converts byte offsets of text to lines and columns
+type sourcePositions struct {
+	text       string
+	lineStarts []int // Byte offset each line starts at
+}
+
+func newSourcePositions(text string) *sourcePositions {
+	p := &sourcePositions{text: text, lineStarts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+	return p
+}
+
+// position returns the line and column of a byte offset
+func (p *sourcePositions) position(offset int) (int, int) {
+	line := sort.Search(len(p.lineStarts), func(i int) bool { return p.lineStarts[i] > offset }) - 1
+	column := 1
+	for _, r := range p.text[p.lineStarts[line]:offset] {
+		column += utf16.RuneLen(r)
+	}
+	return line + 1, column
+}
+
+// sourceRange locates span, an offset of base into the text, in the text
+func (p *sourcePositions) sourceRange(span batch.Span, base int) SourceRange {
+	r := SourceRange{Start: span.Start + base, End: span.End + base}
+	r.StartLine, r.StartColumn = p.position(r.Start)
+	r.EndLine, r.EndColumn = p.position(r.End)
+	return r
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// Statement previews in results
+const (
+	defaultStatementPreview = 500 // Characters of a statement echoed in StatementResult
+	maxRetainedStatements   = 256 // Truncated statements kept per session for GetStatementText
+)
+
+// statementStore keeps the full text of truncated statements, oldest evicted first
+type statementStore struct {
+	order []string
+	texts map[string]string
+}
+
+// Full statement text per session handle, keyed by statement hash
+var (
+	statementTexts     = make(map[int]*statementStore)
+	statementTextsLock sync.Mutex
+)
+
+// statementHash returns the hex SHA-256 of a statement, the key for GetStatementText
+func statementHash(stmt string) string {
+	sum := sha256.Sum256([]byte(stmt))
+	return hex.EncodeToString(sum[:])
+}
+
+// previewStatement returns the preview of a statement and records its full
+// text when the preview is truncated, so it can be fetched later by hash
+func previewStatement(handle int, stmt string, maxLen int) (preview, hash string, truncated bool) {
+	hash = statementHash(stmt)
+	preview = truncateStmt(stmt, maxLen)
+	if preview == stmt {
+		return preview, hash, false
+	}
+	retainStatementText(handle, hash, stmt)
+	return preview, hash, true
+}
+
+// retainStatementText records the full text of a statement for the session
+func retainStatementText(handle int, hash, stmt string) {
+	statementTextsLock.Lock()
+	defer statementTextsLock.Unlock()
+
+	store := statementTexts[handle]
+	if store == nil {
+		store = &statementStore{texts: make(map[string]string)}
+		statementTexts[handle] = store
+	}
+	if _, ok := store.texts[hash]; ok {
+		return
+	}
+	if len(store.order) >= maxRetainedStatements {
+		delete(store.texts, store.order[0])
+		store.order = store.order[1:]
+	}
+	store.order = append(store.order, hash)
+	store.texts[hash] = stmt
+}
+
+// lookupStatementText returns the full text recorded for a statement hash
+func lookupStatementText(handle int, hash string) (string, bool) {
+	statementTextsLock.Lock()
+	defer statementTextsLock.Unlock()
+	if store := statementTexts[handle]; store != nil {
+		stmt, ok := store.texts[hash]
+		return stmt, ok
+	}
+	return "", false
+}
+
+// discardStatementTexts forgets the session's statements when it is closed
+func discardStatementTexts(handle int) {
+	statementTextsLock.Lock()
+	delete(statementTexts, handle)
+	statementTextsLock.Unlock()
+}
+
+// truncateStmt truncates a statement to maxLen characters for display,
+// cutting between code points so the result stays valid UTF-8. A maxLen of
+// zero or less keeps the whole statement.
+func truncateStmt(stmt string, maxLen int) string {
+	if maxLen <= 0 || len(stmt) <= maxLen {
+		return stmt
+	}
+	count := 0
+	for i := range stmt {
+		if count == maxLen {
+			return stmt[:i] + "..."
+		}
+		count++
+	}
+	return stmt
+}
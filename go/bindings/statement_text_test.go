@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateStmt(t *testing.T) {
+	tests := []struct {
+		name   string
+		stmt   string
+		maxLen int
+		want   string
+	}{
+		{"short", "SELECT 1", 20, "SELECT 1"},
+		{"exact", "SELECT 1", 8, "SELECT 1"},
+		{"ascii", "SELECT * FROM t", 6, "SELECT..."},
+		{"zero keeps all", "SELECT * FROM t", 0, "SELECT * FROM t"},
+		{"negative keeps all", "SELECT * FROM t", -1, "SELECT * FROM t"},
+		{"multi-byte under the limit in characters", "ééé", 3, "ééé"},
+		{"multi-byte at the boundary", "'héllo'", 3, "'hé..."},
+		{"cut before a multi-byte character", "'héllo'", 2, "'h..."},
+		{"emoji kept whole", "ab😀cd", 3, "ab😀..."},
+		{"cut before an emoji", "ab😀cd", 2, "ab..."},
+		{"emoji only", "😀😀😀", 2, "😀😀..."},
+		{"combining mark is its own character", "e\u0301e\u0301", 1, "e..."},
+		{"empty", "", 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateStmt(tt.stmt, tt.maxLen)
+			if got != tt.want {
+				t.Errorf("truncateStmt(%q, %d) = %q, want %q", tt.stmt, tt.maxLen, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateStmt(%q, %d) is not valid UTF-8", tt.stmt, tt.maxLen)
+			}
+		})
+	}
+}
+
+func TestPreviewStatementRetention(t *testing.T) {
+	const handle = 1 << 24
+	t.Cleanup(func() { discardStatementTexts(handle) })
+
+	// A statement within the preview is not kept
+	preview, hash, truncated := previewStatement(handle, "SELECT 1", 20)
+	if preview != "SELECT 1" || truncated || hash != statementHash("SELECT 1") {
+		t.Fatalf("short statement: %q, %s, %v", preview, hash, truncated)
+	}
+	if _, ok := lookupStatementText(handle, hash); ok {
+		t.Error("statement shown in full was kept")
+	}
+
+	stmt := func(i int) string {
+		return fmt.Sprintf("INSERT INTO t (id, v) VALUES (%d, '%s')", i, strings.Repeat("x", 40))
+	}
+	hashes := make([]string, maxRetainedStatements+1)
+	for i := range hashes {
+		preview, hashes[i], truncated = previewStatement(handle, stmt(i), 20)
+		if !truncated || utf8.RuneCountInString(preview) != 23 {
+			t.Fatalf("statement %d: preview %q, truncated %v", i, preview, truncated)
+		}
+	}
+
+	// The oldest statement made room for the newest
+	if _, ok := lookupStatementText(handle, hashes[0]); ok {
+		t.Error("oldest statement not evicted")
+	}
+	for _, i := range []int{1, maxRetainedStatements} {
+		if text, ok := lookupStatementText(handle, hashes[i]); !ok || text != stmt(i) {
+			t.Errorf("statement %d: %q, %v", i, text, ok)
+		}
+	}
+
+	// A statement kept already is not kept twice, so it evicts nothing
+	previewStatement(handle, stmt(1), 20)
+	if _, ok := lookupStatementText(handle, hashes[1]); !ok {
+		t.Error("statement kept again was evicted")
+	}
+	if _, ok := lookupStatementText(handle, hashes[2]); !ok {
+		t.Error("statement evicted by a repeat")
+	}
+	statementTextsLock.Lock()
+	n := len(statementTexts[handle].order)
+	statementTextsLock.Unlock()
+	if n != maxRetainedStatements {
+		t.Errorf("%d statements kept, want %d", n, maxRetainedStatements)
+	}
+
+	// Other sessions see none of them, and closing forgets them
+	if _, ok := lookupStatementText(handle+1, hashes[1]); ok {
+		t.Error("statement visible to another session")
+	}
+	discardStatementTexts(handle)
+	if _, ok := lookupStatementText(handle, hashes[1]); ok {
+		t.Error("statement kept after the session closed")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Table statistics
+//
+// GetTableStats reports what nodetool tablestats would, as far as CQL can
+// see it. Partition counts and sizes come from system.size_estimates, which
+// each node fills in for the token ranges it owns every few minutes; the
+// coordinator's ranges are scaled to the whole ring, so the numbers are
+// estimates. Compaction and other table settings come from
+// system_schema.tables. On Cassandra 4.0 and later the disk usage and largest
+// partition are read from the system_views tables of every node that is up.
+// SSTable counts are not exposed through CQL on any version.
+
+// TableStats is the result of GetTableStats
+type TableStats struct {
+	Keyspace            string            `json:"keyspace"`
+	Table               string            `json:"table"`
+	CollectedAt         string            `json:"collectedAt"`
+	EstimatedPartitions int64             `json:"estimatedPartitions"`
+	MeanPartitionSize   int64             `json:"meanPartitionSize"`  // Bytes
+	EstimatedSizeBytes  int64             `json:"estimatedSizeBytes"` // estimatedPartitions x meanPartitionSize, one replica
+	RingCoverage        float64           `json:"ringCoverage"`       // Share of the ring the coordinator's estimates cover
+	SSTableCount        *int              `json:"sstableCount"`       // Always null: not readable through CQL
+	CompactionStrategy  string            `json:"compactionStrategy"`
+	CompactionOptions   map[string]string `json:"compactionOptions"`
+	Compression         map[string]string `json:"compression"`
+	GCGraceSeconds      int               `json:"gcGraceSeconds"`
+	DefaultTTL          int               `json:"defaultTTL"`
+	DiskUsageMiB        *int64            `json:"diskUsageMiB,omitempty"`        // Sum over the nodes read, all replicas
+	MaxPartitionSizeMiB *int64            `json:"maxPartitionSizeMiB,omitempty"` // Largest on any node read
+	NodesRead           int               `json:"nodesRead,omitempty"`
+	Notes               []string          `json:"notes,omitempty"`
+}
+
+// sizeEstimates sums the coordinator's system.size_estimates rows of a table
+type sizeEstimates struct {
+	partitions int64
+	bytes      float64 // Sum of partitions x mean size over the ranges
+	covered    float64 // Token range width the rows cover
+}
+
+// readSizeEstimates reads the coordinator's size estimates of a table
+func readSizeEstimates(session *db.Session, keyspace, table string) (sizeEstimates, error) {
+	iter := session.Query("SELECT range_start, range_end, partitions_count, mean_partition_size FROM system.size_estimates WHERE keyspace_name = ? AND table_name = ?", keyspace, table).Iter()
+	var est sizeEstimates
+	var start, end string
+	var partitions, mean int64
+	for iter.Scan(&start, &end, &partitions, &mean) {
+		s, err1 := strconv.ParseInt(start, 10, 64)
+		e, err2 := strconv.ParseInt(end, 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		width := float64(e) - float64(s)
+		if width <= 0 {
+			width += math.Pow(2, 64)
+		}
+		est.covered += width
+		est.partitions += partitions
+		est.bytes += float64(partitions) * float64(mean)
+	}
+	return est, iter.Close()
+}
+
+// ringPartitions scales the partition count to the whole ring
+func (est sizeEstimates) ringPartitions() int64 {
+	if est.covered == 0 {
+		return 0
+	}
+	return int64(float64(est.partitions) * math.Pow(2, 64) / est.covered)
+}
+
+// meanPartitionSize is the partition-weighted mean size in bytes
+func (est sizeEstimates) meanPartitionSize() int64 {
+	if est.partitions == 0 {
+		return 0
+	}
+	return int64(est.bytes / float64(est.partitions))
+}
+
+// collectTableStats builds the statistics of a table
+func collectTableStats(session *db.Session, keyspace, table string) (*TableStats, error) {
+	stats := &TableStats{
+		Keyspace:    keyspace,
+		Table:       table,
+		CollectedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	var compaction, compression map[string]string
+	err := session.Query("SELECT compaction, compression, gc_grace_seconds, default_time_to_live FROM system_schema.tables WHERE keyspace_name = ? AND table_name = ?", keyspace, table).
+		Scan(&compaction, &compression, &stats.GCGraceSeconds, &stats.DefaultTTL)
+	if err != nil {
+		if errors.Is(err, gocql.ErrNotFound) {
+			return nil, fmt.Errorf("table %s.%s not found", keyspace, table)
+		}
+		return nil, err
+	}
+	stats.CompactionOptions = make(map[string]string)
+	for key, value := range compaction {
+		if key == "class" {
+			stats.CompactionStrategy = value[strings.LastIndex(value, ".")+1:]
+			continue
+		}
+		stats.CompactionOptions[key] = value
+	}
+	stats.Compression = compression
+
+	est, err := readSizeEstimates(session, keyspace, table)
+	switch {
+	case err != nil:
+		stats.Notes = append(stats.Notes, "system.size_estimates could not be read: "+err.Error())
+	case est.covered == 0:
+		stats.Notes = append(stats.Notes, "no size estimates yet; they are computed every few minutes and only for tables with flushed data")
+	default:
+		stats.EstimatedPartitions = est.ringPartitions()
+		stats.MeanPartitionSize = est.meanPartitionSize()
+		stats.EstimatedSizeBytes = stats.EstimatedPartitions * stats.MeanPartitionSize
+		stats.RingCoverage = math.Round(est.covered/math.Pow(2, 64)*1000) / 1000
+	}
+
+	if session.SupportsVirtualTables() {
+		readNodeTableSizes(session, stats)
+	}
+	stats.Notes = append(stats.Notes, "SSTable counts are not exposed through CQL; use nodetool tablestats")
+	return stats, nil
+}
+
+// readNodeTableSizes adds the disk usage and largest partition from the
+// system_views tables of every node that is up
+func readNodeTableSizes(session *db.Session, stats *TableStats) {
+	var diskUsage, maxPartition int64
+	var found bool
+	for _, host := range session.GetHosts() {
+		if !host.IsUp() {
+			continue
+		}
+		var mib int64
+		err := session.Query("SELECT mebibytes FROM system_views.disk_usage WHERE keyspace_name = ? AND table_name = ?", stats.Keyspace, stats.Table).
+			SetHostID(host.HostID()).Scan(&mib)
+		if err == nil {
+			diskUsage += mib
+			found = true
+		} else if !errors.Is(err, gocql.ErrNotFound) {
+			stats.Notes = append(stats.Notes, fmt.Sprintf("%s: system_views.disk_usage: %v", host.ConnectAddressAndPort(), err))
+			continue
+		}
+		err = session.Query("SELECT max_partition_size FROM system_views.max_partition_size WHERE keyspace_name = ? AND table_name = ?", stats.Keyspace, stats.Table).
+			SetHostID(host.HostID()).Scan(&mib)
+		if err == nil && mib > maxPartition {
+			maxPartition = mib
+		}
+		stats.NodesRead++
+	}
+	if found {
+		stats.DiskUsageMiB = &diskUsage
+		stats.MaxPartitionSizeMiB = &maxPartition
+	}
+}
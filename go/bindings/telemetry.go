@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Usage telemetry
+//
+// Counts how often features are used, across every session of the process,
+// so the host app can show the counts or upload them with the user's
+// consent. Nothing is counted until telemetry is enabled, nothing is sent
+// anywhere from here, and only counts are kept: no statements, keyspace or
+// table names, hosts or values. Disabling telemetry discards the counts.
+
+// Features counted by the usage telemetry
+const (
+	usageSessions          = "sessionsOpened"     // CreateSession and CreateAstraSession
+	usageQueries           = "queries"            // Statements run, including those of scripts and source files
+	usagePrepared          = "preparedExecutions" // ExecutePrepared
+	usageBatches           = "batches"            // ExecuteBatch
+	usageScripts           = "scripts"            // ExecuteMultiQuery and ExecuteSourceFiles
+	usageShellCommands     = "shellCommands"      // ExecuteShellCommand
+	usageCopyTo            = "copyToJobs"
+	usageCopyFrom          = "copyFromJobs"
+	usageDDL               = "ddlGenerated" // GetDDL
+	usageSchemaComparisons = "schemaComparisons"
+	usageTableComparisons  = "tableComparisons"
+	usageBenchmarks        = "benchmarks"
+	usageDataGeneration    = "dataGenerations" // GenerateTestData
+)
+
+// usageFeatures lists every counter, so a snapshot reports unused features as 0
+var usageFeatures = []string{
+	usageSessions, usageQueries, usagePrepared, usageBatches, usageScripts, usageShellCommands,
+	usageCopyTo, usageCopyFrom, usageDDL, usageSchemaComparisons, usageTableComparisons, usageBenchmarks,
+	usageDataGeneration,
+}
+
+// TelemetryOptions are the options of ConfigureTelemetry
+type TelemetryOptions struct {
+	Enabled bool `json:"enabled"`
+}
+
+// TelemetrySnapshotOptions are the options of GetTelemetrySnapshot
+type TelemetrySnapshotOptions struct {
+	Reset bool `json:"reset"` // Start counting again from 0 after the snapshot, e.g. once it has been uploaded
+}
+
+// TelemetrySnapshot is the result of GetTelemetrySnapshot
+type TelemetrySnapshot struct {
+	Enabled  bool             `json:"enabled"`
+	Since    string           `json:"since,omitempty"` // When counting started: enabled or last reset
+	TakenAt  string           `json:"takenAt"`
+	Counters map[string]int64 `json:"counters"`
+}
+
+// Usage counters of the process
+var (
+	telemetryEnabled atomic.Bool
+	telemetryLock    sync.Mutex
+	telemetrySince   time.Time
+	telemetryCounts  = make(map[string]int64)
+)
+
+// recordUsage counts n uses of a feature; it does nothing while telemetry
+// is disabled
+func recordUsage(feature string, n int) {
+	if n <= 0 || !telemetryEnabled.Load() {
+		return
+	}
+	telemetryLock.Lock()
+	if telemetryEnabled.Load() {
+		telemetryCounts[feature] += int64(n)
+	}
+	telemetryLock.Unlock()
+}
+
+// configureTelemetry enables or disables counting. Enabling keeps counts that
+// already exist; disabling discards them.
+func configureTelemetry(opts TelemetryOptions) *TelemetrySnapshot {
+	telemetryLock.Lock()
+	defer telemetryLock.Unlock()
+	switch {
+	case opts.Enabled && !telemetryEnabled.Load():
+		telemetrySince = time.Now()
+	case !opts.Enabled:
+		telemetryCounts = make(map[string]int64)
+		telemetrySince = time.Time{}
+	}
+	telemetryEnabled.Store(opts.Enabled)
+	return telemetrySnapshotLocked(false)
+}
+
+// telemetrySnapshot returns the counts, optionally starting again from 0
+func telemetrySnapshot(opts TelemetrySnapshotOptions) *TelemetrySnapshot {
+	telemetryLock.Lock()
+	defer telemetryLock.Unlock()
+	return telemetrySnapshotLocked(opts.Reset)
+}
+
+func telemetrySnapshotLocked(reset bool) *TelemetrySnapshot {
+	now := time.Now()
+	snapshot := &TelemetrySnapshot{
+		Enabled:  telemetryEnabled.Load(),
+		TakenAt:  now.UTC().Format(time.RFC3339),
+		Counters: make(map[string]int64, len(usageFeatures)),
+	}
+	if !telemetrySince.IsZero() {
+		snapshot.Since = telemetrySince.UTC().Format(time.RFC3339)
+	}
+	for _, feature := range usageFeatures {
+		snapshot.Counters[feature] = telemetryCounts[feature]
+	}
+	if reset && snapshot.Enabled {
+		telemetryCounts = make(map[string]int64)
+		telemetrySince = now
+	}
+	return snapshot
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+
+	"github.com/axonops/cqlai-node/internal/db"
+	"github.com/axonops/cqlai-node/internal/ring"
+)
+
+// Token ring
+//
+// GetTokenRing reports how the token space is spread over the cluster: the
+// tokens of each node, the share of the ring each node owns as primary
+// replica, and for each replication setting in use the share each node holds
+// a replica of (what nodetool status reports as effective ownership) and the
+// replicas of every range. Keyspaces with the same replication place their
+// data alike, so they are reported together. Tokens are strings, as the
+// cluster reports them, since Murmur3 tokens exceed JavaScript's safe
+// integers.
+
+// TokenRingOptions are the options of GetTokenRing
+type TokenRingOptions struct {
+	Keyspaces []string `json:"keyspaces"` // Keyspaces to compute ownership for (default: every replicated keyspace)
+}
+
+// TokenRingHost is a node of the ring
+type TokenRingHost struct {
+	Address    string   `json:"address"`
+	HostID     string   `json:"hostId"`
+	Datacenter string   `json:"datacenter"`
+	Rack       string   `json:"rack"`
+	Up         *bool    `json:"up,omitempty"` // Absent when the driver has no connection to the node
+	Tokens     []string `json:"tokens"`
+	Ownership  float64  `json:"ownership"` // Percentage of the token space in the node's primary ranges
+}
+
+// TokenRange is a range of the ring, (start, end], and the nodes holding it
+type TokenRange struct {
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	Endpoints []string `json:"endpoints"` // Replica addresses, the primary replica first
+}
+
+// TokenRingReplication is the placement of the keyspaces sharing a
+// replication setting
+type TokenRingReplication struct {
+	Strategy    string             `json:"strategy"`
+	Replication map[string]string  `json:"replication"` // Replicas per datacenter, or "*" for SimpleStrategy
+	Keyspaces   []string           `json:"keyspaces"`
+	Ownership   map[string]float64 `json:"ownership"` // Percentage of the token space each node holds a replica of, by address
+	Ranges      []TokenRange       `json:"ranges"`
+}
+
+// TokenRing is the result of GetTokenRing
+type TokenRing struct {
+	Partitioner string                 `json:"partitioner"`
+	Hosts       []TokenRingHost        `json:"hosts"`
+	Replication []TokenRingReplication `json:"replication"`
+	Warnings    []string               `json:"warnings,omitempty"`
+}
+
+// getTokenRing reads the ring and places the ranges of the keyspaces on it
+func getTokenRing(session *db.Session, opts TokenRingOptions) (*TokenRing, error) {
+	nodes, tokens, err := readRingTokens(session)
+	if err != nil && len(nodes) == 0 {
+		return nil, fmt.Errorf("failed to read the ring: %v", err)
+	}
+	result := &TokenRing{
+		Partitioner: clusterPartitioner(session),
+		Hosts:       []TokenRingHost{},
+		Replication: []TokenRingReplication{},
+	}
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("failed to read system.peers: %v", err))
+	}
+
+	up := make(map[string]bool)
+	for _, host := range session.GetHosts() {
+		up[host.HostID()] = host.IsUp()
+	}
+	for i, node := range nodes {
+		host := TokenRingHost{
+			Address:    node.Address,
+			HostID:     node.HostID,
+			Datacenter: node.DataCenter,
+			Rack:       node.Rack,
+			Tokens:     tokens[i],
+		}
+		if host.Tokens == nil {
+			host.Tokens = []string{}
+		}
+		if isUp, ok := up[node.HostID]; ok {
+			host.Up = &isUp
+		}
+		result.Hosts = append(result.Hosts, host)
+	}
+	sort.Slice(result.Hosts, func(i, j int) bool { return result.Hosts[i].Address < result.Hosts[j].Address })
+
+	if !strings.HasSuffix(result.Partitioner, "Murmur3Partitioner") {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("ownership is only computed for the Murmur3 partitioner; the cluster uses %s", result.Partitioner))
+		return result, nil
+	}
+	r := ring.New(nodes)
+	if r.Empty() {
+		result.Warnings = append(result.Warnings, "no node reports tokens")
+		return result, nil
+	}
+
+	ranges := r.Ranges()
+	primary := make(map[string]float64)
+	for _, rg := range ranges {
+		primary[rg.Owner.Address] += rg.Fraction()
+	}
+	for i := range result.Hosts {
+		result.Hosts[i].Ownership = ownershipPercent(primary[result.Hosts[i].Address])
+	}
+
+	keyspaces, err := tokenRingKeyspaces(session, opts.Keyspaces, result)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]*TokenRingReplication)
+	strategies := make(map[string]ring.Strategy)
+	var order []string
+	for _, ks := range keyspaces {
+		strategy, err := ring.ParseStrategy(ks.StrategyClass, ks.StrategyOptions)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("keyspace %s: %v", ks.Name, err))
+			continue
+		}
+		replication := replicationByDatacenter(ks)
+		key := replicationKey(strategy.Class, replication)
+		group, ok := groups[key]
+		if !ok {
+			group = &TokenRingReplication{Strategy: strategy.Class, Replication: replication}
+			groups[key] = group
+			strategies[key] = strategy
+			order = append(order, key)
+		}
+		group.Keyspaces = append(group.Keyspaces, ks.Name)
+	}
+
+	for _, key := range order {
+		group := groups[key]
+		group.Ownership = make(map[string]float64)
+		held := make(map[string]float64)
+		group.Ranges = make([]TokenRange, 0, len(ranges))
+		for _, rg := range ranges {
+			tr := TokenRange{
+				Start:     strconv.FormatInt(rg.Start, 10),
+				End:       strconv.FormatInt(rg.End, 10),
+				Endpoints: []string{},
+			}
+			for _, node := range r.Replicas(rg.End, strategies[key]) {
+				tr.Endpoints = append(tr.Endpoints, node.Address)
+				held[node.Address] += rg.Fraction()
+			}
+			group.Ranges = append(group.Ranges, tr)
+		}
+		for _, node := range nodes {
+			if len(node.Tokens) > 0 {
+				group.Ownership[node.Address] = ownershipPercent(held[node.Address])
+			}
+		}
+		result.Replication = append(result.Replication, *group)
+	}
+	return result, nil
+}
+
+// tokenRingKeyspaces returns the metadata of the keyspaces to place: those
+// named, or every keyspace whose data is replicated over the ring
+func tokenRingKeyspaces(session *db.Session, names []string, result *TokenRing) ([]*gocql.KeyspaceMetadata, error) {
+	named := len(names) > 0
+	if !named {
+		iter := session.Query("SELECT keyspace_name FROM system_schema.keyspaces").Iter()
+		var name string
+		for iter.Scan(&name) {
+			names = append(names, name)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, fmt.Errorf("failed to list keyspaces: %v", err)
+		}
+		names = session.ListedKeyspaces(names)
+		sort.Strings(names)
+	}
+
+	var keyspaces []*gocql.KeyspaceMetadata
+	for _, name := range names {
+		ks, err := session.KeyspaceMetadata(name)
+		if err != nil {
+			if named {
+				return nil, fmt.Errorf("keyspace %s not found", name)
+			}
+			continue
+		}
+		class := ks.StrategyClass[strings.LastIndex(ks.StrategyClass, ".")+1:]
+		switch class {
+		case "SimpleStrategy", "NetworkTopologyStrategy", "EverywhereStrategy":
+			keyspaces = append(keyspaces, ks)
+		case "LocalStrategy":
+			// Every node holds its own data; there is nothing to place
+			if named {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("keyspace %s uses LocalStrategy; every node holds its own data", name))
+			}
+		default:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("replicas of keyspace %s, with strategy %s, are unknown", name, ks.StrategyClass))
+		}
+	}
+	return keyspaces, nil
+}
+
+// replicationKey identifies a replication setting
+func replicationKey(class string, replication map[string]string) string {
+	keys := make([]string, 0, len(replication))
+	for dc, rf := range replication {
+		keys = append(keys, dc+"="+rf)
+	}
+	sort.Strings(keys)
+	return class + ":" + strings.Join(keys, ",")
+}
+
+// ownershipPercent converts a share of the token space to a percentage
+// rounded to two decimals
+func ownershipPercent(fraction float64) float64 {
+	return float64(int64(fraction*10000+0.5)) / 100
+}
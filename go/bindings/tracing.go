@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/axonops/cqlai-node/internal/config"
 	"github.com/axonops/cqlai-node/internal/db"
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
 )
@@ -11,13 +19,13 @@ import (
 // TraceEvent represents a single trace event from system_traces.events
 type TraceEvent struct {
 	Activity      string `json:"activity"`
-	EventID       string `json:"event_id"`               // UUID string for the event
-	Timestamp     string `json:"timestamp"`              // Extracted from event_id TimeUUID
-	Source        string `json:"source"`                 // Source node IP
-	SourceElapsed int64  `json:"source_elapsed"`         // microseconds (snake_case for renderer)
-	SourcePort    int    `json:"source_port,omitempty"`  // Source port (if available)
-	Thread        string `json:"thread,omitempty"`       // Thread name
-	SessionID     string `json:"session_id"`             // Parent session ID
+	EventID       string `json:"event_id"`              // UUID string for the event
+	Timestamp     string `json:"timestamp"`             // Extracted from event_id TimeUUID
+	Source        string `json:"source"`                // Source node IP
+	SourceElapsed int64  `json:"source_elapsed"`        // microseconds (snake_case for renderer)
+	SourcePort    int    `json:"source_port,omitempty"` // Source port (if available)
+	Thread        string `json:"thread,omitempty"`      // Thread name
+	SessionID     string `json:"session_id"`            // Parent session ID
 }
 
 // TraceSession represents the trace session info from system_traces.sessions
@@ -34,12 +42,134 @@ type TraceSession struct {
 
 // QueryTraceResult contains the full trace information
 type QueryTraceResult struct {
-	Session TraceSession `json:"session"`
-	Events  []TraceEvent `json:"events"`
+	Session  TraceSession  `json:"session"`
+	Events   []TraceEvent  `json:"events"`
+	Complete bool          `json:"complete"`           // The coordinator finished the request (and, when waited for, no more events arrived)
+	WaitedMs int64         `json:"waitedMs,omitempty"` // Time spent waiting for the trace to be written
+	Nodes    []TraceNode   `json:"nodes"`              // Events grouped by node: coordinator first, then replicas
+	Summary  *TraceSummary `json:"summary"`
 }
 
+// TraceOptions are the options of GetQueryTraceWithOptions
+type TraceOptions struct {
+	Wait      bool `json:"wait"`      // Poll until the trace is fully written
+	TimeoutMs int  `json:"timeoutMs"` // Longest wait (default 5000)
+}
+
+// Trace wait bounds
+const (
+	defaultTraceWait = 5 * time.Second
+	maxTraceWait     = time.Minute
+	maxTracePoll     = 500 * time.Millisecond
+)
+
+// TraceNode is the part of a trace that ran on one node
+type TraceNode struct {
+	Source        string       `json:"source"`
+	Role          string       `json:"role"`          // coordinator or replica
+	StartOffset   int64        `json:"startOffset"`   // Microseconds from the start of the request to the node's first event, by the node's clock
+	ElapsedMicros int64        `json:"elapsedMicros"` // Last source_elapsed on the node
+	EventCount    int          `json:"eventCount"`
+	Phases        []TracePhase `json:"phases"`
+}
+
+// TracePhase is a run of consecutive events of a node on the same thread,
+// such as a coordinator's request handling or a replica's read stage
+type TracePhase struct {
+	Thread         string           `json:"thread"`
+	Stage          string           `json:"stage"`       // Thread without its pool number, e.g. ReadStage
+	StartMicros    int64            `json:"startMicros"` // source_elapsed before the phase's first event
+	EndMicros      int64            `json:"endMicros"`
+	DurationMicros int64            `json:"durationMicros"`
+	Events         []TraceNodeEvent `json:"events"`
+}
+
+// TraceNodeEvent is an event in a trace phase
+type TraceNodeEvent struct {
+	Activity      string `json:"activity"`
+	Timestamp     string `json:"timestamp"`
+	SourceElapsed int64  `json:"source_elapsed"`
+	DeltaMicros   int64  `json:"deltaMicros"` // Since the node's previous event
+}
+
+// TraceSummary aggregates the timing of a trace
+type TraceSummary struct {
+	DurationMicros       int64            `json:"durationMicros"` // Request duration reported by the coordinator
+	Events               int              `json:"events"`
+	Replicas             int              `json:"replicas"` // Nodes other than the coordinator
+	CoordinatorMicros    int64            `json:"coordinatorMicros"`
+	SlowestReplica       string           `json:"slowestReplica,omitempty"`
+	SlowestReplicaMicros int64            `json:"slowestReplicaMicros,omitempty"`
+	StageMicros          map[string]int64 `json:"stageMicros"`  // Time by stage across all nodes
+	SlowestSteps         []TraceStep      `json:"slowestSteps"` // Events that took longest after the previous event on their node
+}
+
+// TraceStep is one of the slowest events of a trace
+type TraceStep struct {
+	Source      string `json:"source"`
+	Activity    string `json:"activity"`
+	DeltaMicros int64  `json:"deltaMicros"`
+}
+
+// traceSlowestSteps is the number of steps the summary lists
+const traceSlowestSteps = 5
+
 // getQueryTraceBySessionID retrieves trace information for a given session ID
 func getQueryTraceBySessionID(session *db.Session, traceSessionIDStr string) (*QueryTraceResult, error) {
+	result, err := readQueryTrace(session, traceSessionIDStr)
+	if err != nil {
+		return nil, err
+	}
+	result.Nodes, result.Summary = buildTraceTree(result)
+	return result, nil
+}
+
+// waitForQueryTrace polls the trace tables until the trace is complete: the
+// coordinator has written the request's duration and a further read finds no
+// new events, since replicas write theirs asynchronously. At the timeout the
+// trace read last is returned, marked incomplete.
+func waitForQueryTrace(ctx context.Context, session *db.Session, traceSessionIDStr string, timeout time.Duration) (*QueryTraceResult, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	interval := 50 * time.Millisecond
+	var last *QueryTraceResult
+	for {
+		trace, err := readQueryTrace(session, traceSessionIDStr)
+		if err != nil && !errors.Is(err, gocql.ErrNotFound) {
+			return nil, err
+		}
+		if trace != nil {
+			settled := last != nil && trace.Complete && len(trace.Events) == len(last.Events)
+			trace.Complete = settled
+			last = trace
+			if settled {
+				break
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if last == nil {
+				return nil, err
+			}
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(interval, remaining)):
+		}
+		interval = min(interval*2, maxTracePoll)
+	}
+
+	last.WaitedMs = time.Since(start).Milliseconds()
+	last.Nodes, last.Summary = buildTraceTree(last)
+	return last, nil
+}
+
+// readQueryTrace reads a trace session and its events. The trace is complete
+// once the coordinator has written the request's duration.
+func readQueryTrace(session *db.Session, traceSessionIDStr string) (*QueryTraceResult, error) {
 	traceSessionID, err := gocql.ParseUUID(traceSessionIDStr)
 	if err != nil {
 		return nil, fmt.Errorf("invalid session ID: %v", err)
@@ -52,7 +182,7 @@ func getQueryTraceBySessionID(session *db.Session, traceSessionIDStr string) (*Q
 
 	// Get session info from system_traces.sessions
 	var coordinator, request, command, client string
-	var duration int
+	var duration *int
 	var startedAt time.Time
 	var parameters map[string]string
 
@@ -63,18 +193,21 @@ func getQueryTraceBySessionID(session *db.Session, traceSessionIDStr string) (*Q
 		&coordinator, &duration, &request, &command, &client, &startedAt, &parameters,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get trace session: %v", err)
+		return nil, fmt.Errorf("failed to get trace session: %w", err)
 	}
 
 	result.Session = TraceSession{
 		SessionID:   traceSessionID.String(),
 		Coordinator: coordinator,
-		Duration:    int64(duration),
 		StartedAt:   startedAt.Format(time.RFC3339Nano),
 		Request:     request,
 		Command:     command,
 		Client:      client,
 	}
+	if duration != nil {
+		result.Session.Duration = int64(*duration)
+		result.Complete = true
+	}
 
 	// Convert parameters map to string if present
 	if len(parameters) > 0 {
@@ -121,3 +254,226 @@ func getQueryTraceBySessionID(session *db.Session, traceSessionIDStr string) (*Q
 
 	return result, nil
 }
+
+// buildTraceTree groups a trace's events by node and, within a node, into
+// phases of consecutive events on one thread, and totals their timing
+func buildTraceTree(trace *QueryTraceResult) ([]TraceNode, *TraceSummary) {
+	summary := &TraceSummary{
+		DurationMicros: trace.Session.Duration,
+		Events:         len(trace.Events),
+		StageMicros:    make(map[string]int64),
+		SlowestSteps:   []TraceStep{},
+	}
+	startedAt, _ := time.Parse(time.RFC3339Nano, trace.Session.StartedAt)
+
+	bySource := make(map[string][]TraceEvent)
+	var sources []string
+	for _, event := range trace.Events {
+		if _, ok := bySource[event.Source]; !ok {
+			sources = append(sources, event.Source)
+		}
+		bySource[event.Source] = append(bySource[event.Source], event)
+	}
+	// Coordinator first, then replicas by address
+	sort.Slice(sources, func(i, j int) bool {
+		ci, cj := sources[i] == trace.Session.Coordinator, sources[j] == trace.Session.Coordinator
+		if ci != cj {
+			return ci
+		}
+		return sources[i] < sources[j]
+	})
+
+	var steps []TraceStep
+	nodes := make([]TraceNode, 0, len(sources))
+	for _, source := range sources {
+		events := bySource[source]
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].SourceElapsed < events[j].SourceElapsed
+		})
+
+		node := TraceNode{Source: source, Role: "replica", EventCount: len(events), Phases: []TracePhase{}}
+		if source == trace.Session.Coordinator {
+			node.Role = "coordinator"
+		}
+		if first, err := time.Parse(time.RFC3339Nano, events[0].Timestamp); err == nil && !startedAt.IsZero() {
+			node.StartOffset = first.Sub(startedAt).Microseconds() - events[0].SourceElapsed
+		}
+
+		var previous int64
+		for i, event := range events {
+			delta := max(event.SourceElapsed-previous, 0)
+			if i == 0 || event.Thread != events[i-1].Thread {
+				node.Phases = append(node.Phases, TracePhase{Thread: event.Thread, Stage: traceStage(event.Thread), StartMicros: previous})
+			}
+			phase := &node.Phases[len(node.Phases)-1]
+			phase.Events = append(phase.Events, TraceNodeEvent{
+				Activity:      event.Activity,
+				Timestamp:     event.Timestamp,
+				SourceElapsed: event.SourceElapsed,
+				DeltaMicros:   delta,
+			})
+			phase.EndMicros = event.SourceElapsed
+			phase.DurationMicros = phase.EndMicros - phase.StartMicros
+			summary.StageMicros[phase.Stage] += delta
+			steps = append(steps, TraceStep{Source: source, Activity: event.Activity, DeltaMicros: delta})
+			previous = event.SourceElapsed
+		}
+		node.ElapsedMicros = previous
+
+		if node.Role == "coordinator" {
+			summary.CoordinatorMicros = node.ElapsedMicros
+		} else {
+			summary.Replicas++
+			if node.ElapsedMicros > summary.SlowestReplicaMicros || summary.SlowestReplica == "" {
+				summary.SlowestReplica, summary.SlowestReplicaMicros = source, node.ElapsedMicros
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].DeltaMicros > steps[j].DeltaMicros })
+	for _, step := range steps {
+		if len(summary.SlowestSteps) == traceSlowestSteps || step.DeltaMicros == 0 {
+			break
+		}
+		summary.SlowestSteps = append(summary.SlowestSteps, step)
+	}
+	return nodes, summary
+}
+
+// traceStage returns the thread pool of a trace thread name, such as
+// ReadStage for ReadStage-3; "unknown" for an empty name
+func traceStage(thread string) string {
+	if thread == "" {
+		return "unknown"
+	}
+	if i := strings.LastIndexByte(thread, '-'); i > 0 && i < len(thread)-1 {
+		if _, err := strconv.Atoi(thread[i+1:]); err == nil {
+			return thread[:i]
+		}
+	}
+	return thread
+}
+
+// Trace export formats
+const (
+	TraceFormatJSON   = "json"
+	TraceFormatFolded = "folded" // Folded stacks for flamegraph.pl / speedscope
+)
+
+// TraceExport is the JSON document written by ExportTrace
+type TraceExport struct {
+	ExportedAt       string       `json:"exportedAt"`
+	CassandraVersion string       `json:"cassandraVersion"`
+	Session          TraceSession `json:"session"`
+	Events           []TraceEvent `json:"events"`
+}
+
+// TraceExportResult describes a written trace file
+type TraceExportResult struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Bytes  int    `json:"bytes"`
+	Events int    `json:"events"`
+}
+
+// exportTrace writes a trace to path as JSON or folded stacks
+func exportTrace(session *db.Session, trace *QueryTraceResult, format, path string) (*TraceExportResult, error) {
+	var data []byte
+	switch format {
+	case TraceFormatJSON:
+		doc := TraceExport{
+			ExportedAt:       time.Now().UTC().Format(time.RFC3339),
+			CassandraVersion: session.CassandraVersion(),
+			Session:          trace.Session,
+			Events:           trace.Events,
+		}
+		var err error
+		data, err = json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error encoding trace: %v", err)
+		}
+		data = append(data, '\n')
+	case TraceFormatFolded:
+		data = []byte(foldedStacks(trace))
+	default:
+		return nil, fmt.Errorf("unsupported trace format %q (use %s or %s)", format, TraceFormatJSON, TraceFormatFolded)
+	}
+
+	cleanPath, err := config.NormalizePath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path: %v", err)
+	}
+	if err := os.WriteFile(cleanPath, data, 0644); err != nil { // #nosec G306 - trace files are meant to be shared
+		return nil, fmt.Errorf("error writing file: %v", err)
+	}
+
+	return &TraceExportResult{
+		Path:   cleanPath,
+		Format: format,
+		Bytes:  len(data),
+		Events: len(trace.Events),
+	}, nil
+}
+
+// foldedStacks renders a trace as folded stacks ("frame;frame;frame weight").
+// Each node's events are ordered by source_elapsed and an activity is weighted
+// by the microseconds elapsed since the previous event on the same node, so a
+// node's total weight equals its last source_elapsed. Frames are
+// node;thread;activity under a root frame for the traced request.
+func foldedStacks(trace *QueryTraceResult) string {
+	root := foldedFrame(trace.Session.Request)
+	if root == "" {
+		root = "trace"
+	}
+
+	bySource := make(map[string][]TraceEvent)
+	var sources []string
+	for _, event := range trace.Events {
+		if _, ok := bySource[event.Source]; !ok {
+			sources = append(sources, event.Source)
+		}
+		bySource[event.Source] = append(bySource[event.Source], event)
+	}
+	sort.Strings(sources)
+
+	weights := make(map[string]int64)
+	var stacks []string
+	for _, source := range sources {
+		events := bySource[source]
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].SourceElapsed < events[j].SourceElapsed
+		})
+
+		var previous int64
+		for _, event := range events {
+			weight := event.SourceElapsed - previous
+			previous = event.SourceElapsed
+			if weight <= 0 {
+				continue
+			}
+			thread := foldedFrame(event.Thread)
+			if thread == "" {
+				thread = "unknown"
+			}
+			stack := strings.Join([]string{root, foldedFrame(source), thread, foldedFrame(event.Activity)}, ";")
+			if _, ok := weights[stack]; !ok {
+				stacks = append(stacks, stack)
+			}
+			weights[stack] += weight
+		}
+	}
+
+	var sb strings.Builder
+	for _, stack := range stacks {
+		fmt.Fprintf(&sb, "%s %d\n", stack, weights[stack])
+	}
+	return sb.String()
+}
+
+// foldedFrame makes a string safe for use as a folded-stack frame: semicolons
+// separate frames and the last space separates the weight
+func foldedFrame(s string) string {
+	s = strings.Join(strings.Fields(s), "_")
+	return strings.ReplaceAll(s, ";", ",")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFoldedStacks(t *testing.T) {
+	trace := &QueryTraceResult{
+		Session: TraceSession{Request: "Execute CQL3 query"},
+		Events: []TraceEvent{
+			// Coordinator events, listed out of order
+			{Source: "10.0.0.1", SourceElapsed: 300, Thread: "Native-Transport-Requests-1", Activity: "Sending READ message to /10.0.0.2"},
+			{Source: "10.0.0.1", SourceElapsed: 120, Thread: "Native-Transport-Requests-1", Activity: "Parsing SELECT * FROM t;"},
+			{Source: "10.0.0.1", SourceElapsed: 120, Thread: "Native-Transport-Requests-1", Activity: "Preparing statement"},
+			{Source: "10.0.0.1", SourceElapsed: 450, Thread: "Native-Transport-Requests-1", Activity: "Parsing SELECT * FROM t;"},
+			// A replica
+			{Source: "10.0.0.2", SourceElapsed: 40, Thread: "ReadStage-2", Activity: "READ message received"},
+			{Source: "10.0.0.2", SourceElapsed: 100, Activity: "Read 1 live rows"},
+		},
+	}
+
+	got := foldedStacks(trace)
+	want := strings.Join([]string{
+		"Execute_CQL3_query;10.0.0.1;Native-Transport-Requests-1;Parsing_SELECT_*_FROM_t, 270",
+		"Execute_CQL3_query;10.0.0.1;Native-Transport-Requests-1;Sending_READ_message_to_/10.0.0.2 180",
+		"Execute_CQL3_query;10.0.0.2;ReadStage-2;READ_message_received 40",
+		"Execute_CQL3_query;10.0.0.2;unknown;Read_1_live_rows 60",
+	}, "\n") + "\n"
+	if got != want {
+		t.Fatalf("folded stacks:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Each node's weights add up to its last source_elapsed
+	totals := make(map[string]int64)
+	for _, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+		i := strings.LastIndexByte(line, ' ')
+		weight, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		totals[strings.Split(line[:i], ";")[1]] += weight
+	}
+	if totals["10.0.0.1"] != 450 || totals["10.0.0.2"] != 100 {
+		t.Errorf("node totals %v, want 450 and 100", totals)
+	}
+
+	// The events themselves are left in the order given
+	if trace.Events[0].SourceElapsed != 300 {
+		t.Error("trace events reordered")
+	}
+}
+
+func TestFoldedStacksWithoutRequest(t *testing.T) {
+	trace := &QueryTraceResult{Events: []TraceEvent{
+		{Source: "10.0.0.1", SourceElapsed: 0, Thread: "t", Activity: "Starting"},
+		{Source: "10.0.0.1", SourceElapsed: 25, Thread: "t", Activity: "Done"},
+	}}
+	if got := foldedStacks(trace); got != "trace;10.0.0.1;t;Done 25\n" {
+		t.Errorf("folded stacks %q", got)
+	}
+	if got := foldedStacks(&QueryTraceResult{}); got != "" {
+		t.Errorf("empty trace folded to %q", got)
+	}
+}
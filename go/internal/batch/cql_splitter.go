@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 /**
@@ -396,28 +397,66 @@ func (sr *SplitResult) ExtractStatementText(tokens []Token) string {
 	return sr.SourceText[tokens[0].Start:tokens[len(tokens)-1].End]
 }
 
+// Span is a byte range of the source text; End is exclusive
+type Span struct {
+	Start int
+	End   int
+}
+
+// statementSpan returns the range of a statement's text without surrounding
+// whitespace, and without the semicolon of a shell command
+func (sr *SplitResult) statementSpan(tokens []Token) (Span, bool) {
+	if len(tokens) == 0 {
+		return Span{}, false
+	}
+	start, end := tokens[0].Start, tokens[len(tokens)-1].End
+	text := sr.SourceText[start:end]
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	start += len(text) - len(trimmed)
+	text = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+	end = start + len(text)
+
+	// For shell commands, remove trailing semicolon if present
+	firstWord := strings.ToLower(tokens[0].Value)
+	if commandsEndWithNewline[firstWord] && strings.HasSuffix(text, ";") {
+		text = strings.TrimRightFunc(text[:len(text)-1], unicode.IsSpace)
+		end = start + len(text)
+	}
+	return Span{Start: start, End: end}, start < end
+}
+
 // GetStatementStrings returns the statements as strings
 func (sr *SplitResult) GetStatementStrings() []string {
 	var stmts []string
-	for _, tokens := range sr.Statements {
-		text := strings.TrimSpace(sr.ExtractStatementText(tokens))
-		if text == "" {
-			continue
-		}
+	for _, span := range sr.GetStatementSpans() {
+		stmts = append(stmts, sr.SourceText[span.Start:span.End])
+	}
+	return stmts
+}
 
-		// For shell commands, remove trailing semicolon if present
-		if len(tokens) > 0 {
-			firstWord := strings.ToLower(tokens[0].Value)
-			if commandsEndWithNewline[firstWord] && strings.HasSuffix(text, ";") {
-				text = strings.TrimSpace(text[:len(text)-1])
-			}
+// GetStatementSpans returns where each statement GetStatementStrings returns
+// is in SourceText
+func (sr *SplitResult) GetStatementSpans() []Span {
+	var spans []Span
+	for _, tokens := range sr.Statements {
+		if span, ok := sr.statementSpan(tokens); ok {
+			spans = append(spans, span)
 		}
+	}
+	return spans
+}
 
-		if text != "" {
-			stmts = append(stmts, text)
-		}
+// IncompleteSpan returns where the unfinished last statement of incomplete
+// input is in SourceText, or nil when the input is complete
+func (sr *SplitResult) IncompleteSpan() *Span {
+	if !sr.Incomplete || len(sr.Statements) == 0 {
+		return nil
 	}
-	return stmts
+	span, ok := sr.statementSpan(sr.Statements[len(sr.Statements)-1])
+	if !ok {
+		return nil
+	}
+	return &span
 }
 
 // SplitForNode is the main entry point for splitting CQL input into statement strings.
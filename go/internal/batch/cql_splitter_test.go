@@ -0,0 +1,41 @@
+package batch
+
+import "testing"
+
+func TestStatementSpans(t *testing.T) {
+	text := "SELECT 1;\n  -- comment\n  INSERT INTO t (a) VALUES ('x;y');\nCONSISTENCY ONE;\nBEGIN BATCH INSERT INTO t (a) VALUES (1);"
+	result, err := SplitStatements(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := result.GetStatementStrings()
+	spans := result.GetStatementSpans()
+	if len(spans) != len(statements) {
+		t.Fatalf("%d spans for %d statements", len(spans), len(statements))
+	}
+	for i, span := range spans {
+		if got := text[span.Start:span.End]; got != statements[i] {
+			t.Errorf("span %d = %q, want %q", i, got, statements[i])
+		}
+	}
+	if statements[1] != "INSERT INTO t (a) VALUES ('x;y');" {
+		t.Errorf("statement 1 = %q", statements[1])
+	}
+	if statements[2] != "CONSISTENCY ONE" {
+		t.Errorf("statement 2 = %q", statements[2])
+	}
+
+	incomplete := result.IncompleteSpan()
+	if incomplete == nil {
+		t.Fatal("unfinished BATCH has no incomplete span")
+	}
+	if got := text[incomplete.Start:incomplete.End]; got != "BEGIN BATCH INSERT INTO t (a) VALUES (1);" {
+		t.Errorf("incomplete span = %q", got)
+	}
+
+	complete, _ := SplitStatements("SELECT 1;")
+	if complete.IncompleteSpan() != nil {
+		t.Error("complete input has an incomplete span")
+	}
+}
@@ -0,0 +1,268 @@
+package batch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultMaxStatementBytes is the largest statement a StatementReader buffers
+const DefaultMaxStatementBytes = 64 * 1024 * 1024
+
+// StatementReader splits a CQL script into statements as it is read, so only
+// the statement being assembled is held in memory. Comments are dropped and
+// line breaks outside $$ bodies become spaces. Semicolons inside strings,
+// quoted names, $$ bodies and BEGIN ... APPLY BATCH do not end a statement;
+// cqlsh shell commands (CONSISTENCY, PAGING, ...) end at the line break.
+type StatementReader struct {
+	r        *bufio.Reader
+	stmt     strings.Builder
+	maxBytes int
+	line     int // Current line, 1-based
+	start    int // Line the statement being read starts on
+	done     bool
+}
+
+// NewStatementReader returns a reader of the statements in r
+func NewStatementReader(r io.Reader) *StatementReader {
+	return &StatementReader{
+		r:        bufio.NewReaderSize(r, 64*1024),
+		maxBytes: DefaultMaxStatementBytes,
+		line:     1,
+	}
+}
+
+// SetMaxStatementBytes changes the limit on the size of a single statement
+func (sr *StatementReader) SetMaxStatementBytes(n int) {
+	sr.maxBytes = n
+}
+
+// Line returns the line the statement last returned by Next starts on
+func (sr *StatementReader) Line() int {
+	return sr.start
+}
+
+// Next returns the next statement without its terminating semicolon, or
+// io.EOF once the script is exhausted. A final statement without a
+// semicolon is returned as well.
+func (sr *StatementReader) Next() (string, error) {
+	if sr.done {
+		return "", io.EOF
+	}
+	sr.stmt.Reset()
+	sr.start = 0
+
+	for {
+		c, err := sr.readRune()
+		if err == io.EOF {
+			sr.done = true
+			if stmt := strings.TrimSpace(sr.stmt.String()); stmt != "" {
+				return stmt, nil
+			}
+			return "", io.EOF
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case c == '\r':
+			// Dropped; the following newline separates the lines
+		case c == '\n':
+			if sr.isShellCommand() {
+				return strings.TrimSpace(sr.stmt.String()), nil
+			}
+			if sr.stmt.Len() > 0 {
+				sr.stmt.WriteByte(' ')
+			}
+		case c == '-' && sr.peek('-'), c == '/' && sr.peek('/'):
+			if err := sr.skipLine(); err != nil {
+				return "", err
+			}
+		case c == '/' && sr.peek('*'):
+			if err := sr.skipBlockComment(); err != nil {
+				return "", err
+			}
+		case c == '\'' || c == '"':
+			if err := sr.readQuoted(c); err != nil {
+				return "", err
+			}
+		case c == '$' && sr.peek('$'):
+			if err := sr.readDollarBody(); err != nil {
+				return "", err
+			}
+		case c == ';':
+			if sr.inBatch() {
+				sr.stmt.WriteByte(';')
+				continue
+			}
+			if stmt := strings.TrimSpace(sr.stmt.String()); stmt != "" {
+				return stmt, nil
+			}
+			sr.stmt.Reset()
+			sr.start = 0
+		default:
+			if err := sr.write(c); err != nil {
+				return "", err
+			}
+		}
+	}
+}
+
+// readRune reads the next rune and keeps the line count
+func (sr *StatementReader) readRune() (rune, error) {
+	c, _, err := sr.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\n' {
+		sr.line++
+	}
+	return c, nil
+}
+
+// peek consumes the next byte if it is want
+func (sr *StatementReader) peek(want byte) bool {
+	next, err := sr.r.Peek(1)
+	if err != nil || next[0] != want {
+		return false
+	}
+	_, _ = sr.r.ReadByte()
+	return true
+}
+
+// write appends a rune to the statement, enforcing the size limit
+func (sr *StatementReader) write(c rune) error {
+	if sr.start == 0 && c != ' ' && c != '\t' {
+		sr.start = sr.line
+	}
+	if sr.stmt.Len() >= sr.maxBytes {
+		return fmt.Errorf("statement starting on line %d exceeds %d bytes", sr.start, sr.maxBytes)
+	}
+	sr.stmt.WriteRune(c)
+	return nil
+}
+
+// skipLine drops the rest of a -- or // comment, leaving the newline
+func (sr *StatementReader) skipLine() error {
+	for {
+		next, err := sr.r.Peek(1)
+		if err == io.EOF || (err == nil && next[0] == '\n') {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := sr.readRune(); err != nil {
+			return err
+		}
+	}
+}
+
+// skipBlockComment drops a /* */ comment
+func (sr *StatementReader) skipBlockComment() error {
+	startLine := sr.line
+	for {
+		c, err := sr.readRune()
+		if err == io.EOF {
+			return fmt.Errorf("unclosed comment starting on line %d", startLine)
+		}
+		if err != nil {
+			return err
+		}
+		if c == '*' && sr.peek('/') {
+			return nil
+		}
+	}
+}
+
+// readQuoted copies a string literal or quoted name; a doubled quote is an
+// escaped quote
+func (sr *StatementReader) readQuoted(quote rune) error {
+	if err := sr.write(quote); err != nil {
+		return err
+	}
+	for {
+		c, err := sr.readRune()
+		if err == io.EOF {
+			// Returned as is so the server reports the unclosed literal
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := sr.write(c); err != nil {
+			return err
+		}
+		if c == quote {
+			if sr.peek(byte(quote)) {
+				if err := sr.write(quote); err != nil {
+					return err
+				}
+				continue
+			}
+			return nil
+		}
+	}
+}
+
+// readDollarBody copies a $$ string verbatim, line breaks included, since
+// function bodies may contain their own comments
+func (sr *StatementReader) readDollarBody() error {
+	if err := sr.write('$'); err != nil {
+		return err
+	}
+	if err := sr.write('$'); err != nil {
+		return err
+	}
+	for {
+		c, err := sr.readRune()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := sr.write(c); err != nil {
+			return err
+		}
+		if c == '$' && sr.peek('$') {
+			return sr.write('$')
+		}
+	}
+}
+
+// isShellCommand reports whether the statement read so far is a cqlsh shell
+// command, which ends at the end of its line rather than at a semicolon
+func (sr *StatementReader) isShellCommand() bool {
+	stmt := strings.TrimLeft(sr.stmt.String(), " \t")
+	if i := strings.IndexAny(stmt, " \t"); i >= 0 {
+		stmt = stmt[:i]
+	}
+	return stmt != "" && IsShellCommand(stmt)
+}
+
+// inBatch reports whether the statement read so far is a BEGIN ... BATCH
+// that has not reached APPLY BATCH yet
+func (sr *StatementReader) inBatch() bool {
+	stmt := strings.TrimSpace(sr.stmt.String())
+	if len(stmt) < 5 || !strings.EqualFold(stmt[:5], "BEGIN") {
+		return false
+	}
+	if len(stmt) > 5 && !isSpace(stmt[5]) {
+		return false
+	}
+	tail := stmt
+	if len(tail) > 64 {
+		tail = tail[len(tail)-64:]
+	}
+	words := strings.Fields(tail)
+	n := len(words)
+	return n < 2 || !strings.EqualFold(words[n-2], "APPLY") || !strings.EqualFold(words[n-1], "BATCH")
+}
+
+// isSpace reports whether b is CQL whitespace
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
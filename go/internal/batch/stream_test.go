@@ -0,0 +1,84 @@
+package batch
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func readAll(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	sr := NewStatementReader(r)
+	var statements []string
+	for {
+		stmt, err := sr.Next()
+		if err == io.EOF {
+			return statements
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		statements = append(statements, stmt)
+	}
+}
+
+func TestStatementReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"simple", "USE ks;\nSELECT * FROM t;", []string{"USE ks", "SELECT * FROM t"}},
+		{"no final semicolon", "SELECT 1 FROM t", []string{"SELECT 1 FROM t"}},
+		{"multi-line", "SELECT a,\n  b\nFROM t;\r\n", []string{"SELECT a,   b FROM t"}},
+		{"semicolon in string", "INSERT INTO t (k) VALUES ('a;b''c');", []string{"INSERT INTO t (k) VALUES ('a;b''c')"}},
+		{"quoted name", `SELECT "x;y" FROM t;`, []string{`SELECT "x;y" FROM t`}},
+		{"comments", "-- header\nSELECT 1 /* ; */ FROM t; // trailing\n", []string{"SELECT 1  FROM t"}},
+		{
+			"shell commands",
+			"CONSISTENCY QUORUM\nSERIAL CONSISTENCY LOCAL_SERIAL;\nPAGING OFF\nSELECT *\nFROM t;\nTRACING ON",
+			[]string{"CONSISTENCY QUORUM", "SERIAL CONSISTENCY LOCAL_SERIAL", "PAGING OFF", "SELECT * FROM t", "TRACING ON"},
+		},
+		{"empty statements", ";;\n;SELECT 1 FROM t;;", []string{"SELECT 1 FROM t"}},
+		{
+			"batch",
+			"BEGIN BATCH\nINSERT INTO t (k) VALUES (1);\nINSERT INTO t (k) VALUES (2);\nAPPLY BATCH;\nSELECT * FROM t;",
+			[]string{"BEGIN BATCH INSERT INTO t (k) VALUES (1); INSERT INTO t (k) VALUES (2); APPLY BATCH", "SELECT * FROM t"},
+		},
+		{
+			"function body",
+			"CREATE FUNCTION f(x int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS $$\n// keep; me\nreturn x;\n$$;",
+			[]string{"CREATE FUNCTION f(x int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS $$\n// keep; me\nreturn x;\n$$"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readAll(t, strings.NewReader(tt.script)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			// One byte at a time, so every token spans a read boundary
+			if got := readAll(t, iotest.OneByteReader(strings.NewReader(tt.script))); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("one byte reads: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatementReaderLimits(t *testing.T) {
+	sr := NewStatementReader(strings.NewReader("SELECT 1 FROM t;\n\nINSERT INTO t (k) VALUES ('" + strings.Repeat("x", 100) + "');"))
+	sr.SetMaxStatementBytes(64)
+	if stmt, err := sr.Next(); err != nil || stmt != "SELECT 1 FROM t" || sr.Line() != 1 {
+		t.Fatalf("first statement: %q line %d, %v", stmt, sr.Line(), err)
+	}
+	if _, err := sr.Next(); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected size error for line 3, got %v", err)
+	}
+
+	sr = NewStatementReader(strings.NewReader("SELECT 1 /* never closed"))
+	if _, err := sr.Next(); err == nil {
+		t.Error("expected error for unclosed comment")
+	}
+}
@@ -0,0 +1,175 @@
+// Package catalog describes the CQL language (keywords, built-in functions,
+// types and index implementations) as data tables annotated with the server
+// version range in which each entry is valid. ForVersion filters the tables
+// for a connected server so editors can offer completions that match it.
+package catalog
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Keyword is a CQL keyword
+type Keyword struct {
+	Name     string `json:"name"`
+	Reserved bool   `json:"reserved"` // Reserved keywords must be quoted to be used as identifiers
+	Since    string `json:"since,omitempty"`
+	Until    string `json:"-"`
+}
+
+// Function is a built-in CQL function or aggregate
+type Function struct {
+	Name        string `json:"name"`
+	Signature   string `json:"signature"`
+	Returns     string `json:"returns"`
+	Category    string `json:"category"` // scalar, aggregate, time, conversion, collection, math, masking, vector, metadata
+	Description string `json:"description"`
+	Since       string `json:"since,omitempty"`
+	Until       string `json:"-"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+}
+
+// DataType is a CQL data type
+type DataType struct {
+	Name     string `json:"name"`
+	Category string `json:"category"` // native, collection, special
+	Syntax   string `json:"syntax,omitempty"`
+	Since    string `json:"since,omitempty"`
+	Until    string `json:"-"`
+}
+
+// IndexOption is an option accepted in CREATE INDEX ... WITH OPTIONS
+type IndexOption struct {
+	Name        string   `json:"name"`
+	Values      []string `json:"values,omitempty"`
+	Description string   `json:"description"`
+}
+
+// IndexType is a secondary index implementation
+type IndexType struct {
+	Name        string        `json:"name"`
+	Using       string        `json:"using,omitempty"` // Value for CREATE CUSTOM INDEX ... USING
+	Description string        `json:"description"`
+	Options     []IndexOption `json:"options,omitempty"`
+	Since       string        `json:"since,omitempty"`
+	Until       string        `json:"-"`
+}
+
+// Catalog is the set of language elements valid for a server version
+type Catalog struct {
+	ServerVersion string      `json:"serverVersion"`
+	Exact         bool        `json:"exact"` // False when the version was unknown and the full catalog is returned
+	Keywords      []Keyword   `json:"keywords"`
+	Functions     []Function  `json:"functions"`
+	Types         []DataType  `json:"types"`
+	Indexes       []IndexType `json:"indexes"`
+}
+
+// ForVersion returns the catalog entries valid for the given server version.
+// An unparseable version (e.g. "unknown") yields every entry that has not been
+// removed, flagged with Exact=false.
+func ForVersion(version string) *Catalog {
+	c := &Catalog{
+		ServerVersion: version,
+		Keywords:      make([]Keyword, 0, len(keywords)),
+		Functions:     make([]Function, 0, len(functions)),
+		Types:         make([]DataType, 0, len(dataTypes)),
+		Indexes:       make([]IndexType, 0, len(indexTypes)),
+	}
+
+	v, ok := parseVersion(version)
+	c.Exact = ok
+	valid := func(since, until string) bool {
+		if !ok {
+			return until == ""
+		}
+		return inRange(v, since, until)
+	}
+
+	for _, k := range keywords {
+		if valid(k.Since, k.Until) {
+			c.Keywords = append(c.Keywords, k)
+		}
+	}
+	for _, f := range functions {
+		if valid(f.Since, f.Until) {
+			c.Functions = append(c.Functions, f)
+		}
+	}
+	for _, t := range dataTypes {
+		if valid(t.Since, t.Until) {
+			c.Types = append(c.Types, t)
+		}
+	}
+	for _, i := range indexTypes {
+		if valid(i.Since, i.Until) {
+			c.Indexes = append(c.Indexes, i)
+		}
+	}
+
+	return c
+}
+
+// AtLeast reports whether version is at or above min. Unparseable versions
+// return false.
+func AtLeast(version, min string) bool {
+	v, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+	m, ok := parseVersion(min)
+	if !ok {
+		return false
+	}
+	return compareVersions(v, m) >= 0
+}
+
+// inRange reports whether v is within [since, until)
+func inRange(v [3]int, since, until string) bool {
+	if since != "" {
+		if s, ok := parseVersion(since); ok && compareVersions(v, s) < 0 {
+			return false
+		}
+	}
+	if until != "" {
+		if u, ok := parseVersion(until); ok && compareVersions(v, u) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseVersion parses "major.minor.patch" ignoring any pre-release suffix
+// (e.g. "5.0-beta1", "4.0.11-SNAPSHOT")
+func parseVersion(version string) ([3]int, bool) {
+	var v [3]int
+	version = strings.TrimSpace(version)
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) == 0 || parts[0] == "" {
+		return v, false
+	}
+	for i := 0; i < len(parts) && i < 3; i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+// compareVersions returns -1, 0 or 1
+func compareVersions(a, b [3]int) int {
+	for i := 0; i < 3; i++ {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
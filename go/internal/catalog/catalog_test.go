@@ -0,0 +1,98 @@
+package catalog
+
+import "testing"
+
+func hasFunction(c *Catalog, name string) bool {
+	for _, f := range c.Functions {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(c *Catalog, name string) bool {
+	for _, t := range c.Types {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasIndex(c *Catalog, name string) bool {
+	for _, i := range c.Indexes {
+		if i.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestForVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		exact    bool
+		present  []string // functions expected
+		absent   []string // functions not expected
+		vector   bool
+		sai      bool
+		duration bool
+	}{
+		{"3.11.16", true, []string{"toDate", "cast", "dateOf"}, []string{"currentTimestamp", "similarity_cosine"}, false, false, true},
+		{"4.1.3", true, []string{"currentTimestamp", "dateOf"}, []string{"to_date", "mask_null"}, false, false, true},
+		{"5.0.2", true, []string{"to_date", "similarity_cosine", "mask_hash", "toDate"}, []string{"dateOf", "unixTimestampOf"}, true, true, true},
+		{"5.0-beta1", true, []string{"collection_count"}, []string{"dateOf"}, true, true, true},
+		{"2.1.22", true, []string{"token", "now"}, []string{"toDate", "min"}, false, false, false},
+		{"unknown", false, []string{"to_date", "toDate"}, []string{"dateOf"}, true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			c := ForVersion(tt.version)
+			if c.Exact != tt.exact {
+				t.Errorf("Exact = %v, want %v", c.Exact, tt.exact)
+			}
+			for _, name := range tt.present {
+				if !hasFunction(c, name) {
+					t.Errorf("expected function %s", name)
+				}
+			}
+			for _, name := range tt.absent {
+				if hasFunction(c, name) {
+					t.Errorf("unexpected function %s", name)
+				}
+			}
+			if got := hasType(c, "vector"); got != tt.vector {
+				t.Errorf("vector type present = %v, want %v", got, tt.vector)
+			}
+			if got := hasIndex(c, "SAI"); got != tt.sai {
+				t.Errorf("SAI index present = %v, want %v", got, tt.sai)
+			}
+			if got := hasType(c, "duration"); got != tt.duration {
+				t.Errorf("duration type present = %v, want %v", got, tt.duration)
+			}
+		})
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		version, min string
+		want         bool
+	}{
+		{"4.0.4", "4.0", true},
+		{"3.11.16", "4.0", false},
+		{"5.0-rc1", "5.0", true},
+		{"3.10", "3.6", true},
+		{"3.6", "3.10", false},
+		{"unknown", "3.0", false},
+		{"", "3.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := AtLeast(tt.version, tt.min); got != tt.want {
+			t.Errorf("AtLeast(%q, %q) = %v, want %v", tt.version, tt.min, got, tt.want)
+		}
+	}
+}
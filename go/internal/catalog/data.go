@@ -0,0 +1,271 @@
+package catalog
+
+// Versions below refer to Apache Cassandra releases. Since is the first
+// release that accepts the element; Until is the first release that no longer
+// does. Entries without Since are valid on every supported version (2.1+).
+
+var keywords = []Keyword{
+	// Reserved keywords
+	{Name: "ADD", Reserved: true},
+	{Name: "ALLOW", Reserved: true},
+	{Name: "ALTER", Reserved: true},
+	{Name: "AND", Reserved: true},
+	{Name: "APPLY", Reserved: true},
+	{Name: "ASC", Reserved: true},
+	{Name: "AUTHORIZE", Reserved: true},
+	{Name: "BATCH", Reserved: true},
+	{Name: "BEGIN", Reserved: true},
+	{Name: "BY", Reserved: true},
+	{Name: "COLUMNFAMILY", Reserved: true},
+	{Name: "CREATE", Reserved: true},
+	{Name: "DELETE", Reserved: true},
+	{Name: "DESC", Reserved: true},
+	{Name: "DESCRIBE", Reserved: true},
+	{Name: "DROP", Reserved: true},
+	{Name: "ENTRIES", Reserved: true},
+	{Name: "EXECUTE", Reserved: true, Since: "2.2"},
+	{Name: "FROM", Reserved: true},
+	{Name: "FULL", Reserved: true},
+	{Name: "GRANT", Reserved: true},
+	{Name: "IF", Reserved: true},
+	{Name: "IN", Reserved: true},
+	{Name: "INDEX", Reserved: true},
+	{Name: "INFINITY", Reserved: true},
+	{Name: "INSERT", Reserved: true},
+	{Name: "INTO", Reserved: true},
+	{Name: "IS", Reserved: true, Since: "3.0"},
+	{Name: "KEYSPACE", Reserved: true},
+	{Name: "LIMIT", Reserved: true},
+	{Name: "MATERIALIZED", Reserved: true, Since: "3.0"},
+	{Name: "MODIFY", Reserved: true},
+	{Name: "NAN", Reserved: true},
+	{Name: "NORECURSIVE", Reserved: true},
+	{Name: "NOT", Reserved: true},
+	{Name: "NULL", Reserved: true},
+	{Name: "OF", Reserved: true},
+	{Name: "ON", Reserved: true},
+	{Name: "OR", Reserved: true},
+	{Name: "ORDER", Reserved: true},
+	{Name: "PRIMARY", Reserved: true},
+	{Name: "RENAME", Reserved: true},
+	{Name: "REPLACE", Reserved: true, Since: "2.2"},
+	{Name: "REVOKE", Reserved: true},
+	{Name: "SCHEMA", Reserved: true},
+	{Name: "SELECT", Reserved: true},
+	{Name: "SET", Reserved: true},
+	{Name: "TABLE", Reserved: true},
+	{Name: "TO", Reserved: true},
+	{Name: "TOKEN", Reserved: true},
+	{Name: "TRUNCATE", Reserved: true},
+	{Name: "UNLOGGED", Reserved: true},
+	{Name: "UNSET", Reserved: true, Since: "2.2"},
+	{Name: "UPDATE", Reserved: true},
+	{Name: "USE", Reserved: true},
+	{Name: "USING", Reserved: true},
+	{Name: "VIEW", Reserved: true, Since: "3.0"},
+	{Name: "WHERE", Reserved: true},
+	{Name: "WITH", Reserved: true},
+
+	// Non-reserved keywords
+	{Name: "ACCESS", Since: "4.0"},
+	{Name: "AGGREGATE", Since: "2.2"},
+	{Name: "ALL"},
+	{Name: "ANN", Since: "5.0"},
+	{Name: "AS"},
+	{Name: "CALLED", Since: "2.2"},
+	{Name: "CAST", Since: "3.2"},
+	{Name: "CIDRS", Since: "5.0"},
+	{Name: "CLUSTERING"},
+	{Name: "COMPACT"},
+	{Name: "CONTAINS"},
+	{Name: "COUNT"},
+	{Name: "CUSTOM"},
+	{Name: "DATACENTERS", Since: "4.0"},
+	{Name: "DEFAULT", Since: "3.10"},
+	{Name: "DISTINCT"},
+	{Name: "EXISTS"},
+	{Name: "FILTERING"},
+	{Name: "FINALFUNC", Since: "2.2"},
+	{Name: "FROZEN"},
+	{Name: "FUNCTION", Since: "2.2"},
+	{Name: "FUNCTIONS", Since: "2.2"},
+	{Name: "GROUP", Since: "3.10"},
+	{Name: "INITCOND", Since: "2.2"},
+	{Name: "INPUT", Since: "2.2"},
+	{Name: "JSON", Since: "2.2"},
+	{Name: "KEY"},
+	{Name: "KEYS"},
+	{Name: "KEYSPACES"},
+	{Name: "LANGUAGE", Since: "2.2"},
+	{Name: "LIKE", Since: "3.4"},
+	{Name: "LOGIN", Since: "2.2"},
+	{Name: "MASKED", Since: "5.0"},
+	{Name: "MAXWRITETIME", Since: "5.0"},
+	{Name: "MBEAN", Since: "4.0"},
+	{Name: "MBEANS", Since: "4.0"},
+	{Name: "NOLOGIN", Since: "2.2"},
+	{Name: "NOSUPERUSER"},
+	{Name: "OPTIONS", Since: "2.2"},
+	{Name: "PARTITION", Since: "3.6"},
+	{Name: "PASSWORD"},
+	{Name: "PER", Since: "3.6"},
+	{Name: "PERMISSION"},
+	{Name: "PERMISSIONS"},
+	{Name: "RETURNS", Since: "2.2"},
+	{Name: "ROLE", Since: "2.2"},
+	{Name: "ROLES", Since: "2.2"},
+	{Name: "SELECT_MASKED", Since: "5.0"},
+	{Name: "SFUNC", Since: "2.2"},
+	{Name: "STATIC"},
+	{Name: "STORAGE"},
+	{Name: "STYPE", Since: "2.2"},
+	{Name: "SUPERUSER"},
+	{Name: "TRIGGER"},
+	{Name: "TTL"},
+	{Name: "TYPE"},
+	{Name: "UNMASK", Since: "5.0"},
+	{Name: "USER"},
+	{Name: "USERS"},
+	{Name: "VALUES"},
+	{Name: "VECTOR", Since: "5.0"},
+	{Name: "WRITETIME"},
+}
+
+var functions = []Function{
+	// Partitioning and metadata
+	{Name: "token", Signature: "token(partition_key_columns...)", Returns: "bigint", Category: "metadata", Description: "Token of the partition key"},
+	{Name: "writetime", Signature: "writetime(column)", Returns: "bigint", Category: "metadata", Description: "Write timestamp of a cell in microseconds"},
+	{Name: "maxwritetime", Signature: "maxwritetime(column)", Returns: "bigint", Category: "metadata", Description: "Largest write timestamp of a multi-cell column", Since: "5.0"},
+	{Name: "ttl", Signature: "ttl(column)", Returns: "int", Category: "metadata", Description: "Remaining time-to-live of a cell in seconds"},
+
+	// Aggregates
+	{Name: "count", Signature: "count(* | column)", Returns: "bigint", Category: "aggregate", Description: "Number of rows or non-null values"},
+	{Name: "min", Signature: "min(column)", Returns: "<column type>", Category: "aggregate", Description: "Smallest value", Since: "2.2"},
+	{Name: "max", Signature: "max(column)", Returns: "<column type>", Category: "aggregate", Description: "Largest value", Since: "2.2"},
+	{Name: "sum", Signature: "sum(column)", Returns: "<column type>", Category: "aggregate", Description: "Sum of numeric values", Since: "2.2"},
+	{Name: "avg", Signature: "avg(column)", Returns: "<column type>", Category: "aggregate", Description: "Average of numeric values", Since: "2.2"},
+
+	// UUID and timeuuid
+	{Name: "uuid", Signature: "uuid()", Returns: "uuid", Category: "scalar", Description: "Random type 4 UUID"},
+	{Name: "random_uuid", Signature: "random_uuid()", Returns: "uuid", Category: "scalar", Description: "Random type 4 UUID", Since: "5.0"},
+	{Name: "now", Signature: "now()", Returns: "timeuuid", Category: "time", Description: "New unique timeuuid at the time the statement is executed"},
+	{Name: "minTimeuuid", Signature: "minTimeuuid(timestamp)", Returns: "timeuuid", Category: "time", Description: "Smallest timeuuid for a timestamp"},
+	{Name: "maxTimeuuid", Signature: "maxTimeuuid(timestamp)", Returns: "timeuuid", Category: "time", Description: "Largest timeuuid for a timestamp"},
+	{Name: "min_timeuuid", Signature: "min_timeuuid(timestamp)", Returns: "timeuuid", Category: "time", Description: "Smallest timeuuid for a timestamp", Since: "5.0"},
+	{Name: "max_timeuuid", Signature: "max_timeuuid(timestamp)", Returns: "timeuuid", Category: "time", Description: "Largest timeuuid for a timestamp", Since: "5.0"},
+	{Name: "dateOf", Signature: "dateOf(timeuuid)", Returns: "timestamp", Category: "time", Description: "Timestamp of a timeuuid", Deprecated: true, Until: "5.0"},
+	{Name: "unixTimestampOf", Signature: "unixTimestampOf(timeuuid)", Returns: "bigint", Category: "time", Description: "Milliseconds since epoch of a timeuuid", Deprecated: true, Until: "5.0"},
+
+	// Time conversion
+	{Name: "toDate", Signature: "toDate(timeuuid | timestamp)", Returns: "date", Category: "conversion", Description: "Convert to date", Since: "2.2"},
+	{Name: "toTimestamp", Signature: "toTimestamp(timeuuid | date)", Returns: "timestamp", Category: "conversion", Description: "Convert to timestamp", Since: "2.2"},
+	{Name: "toUnixTimestamp", Signature: "toUnixTimestamp(timeuuid | timestamp | date)", Returns: "bigint", Category: "conversion", Description: "Convert to milliseconds since epoch", Since: "2.2"},
+	{Name: "to_date", Signature: "to_date(timeuuid | timestamp)", Returns: "date", Category: "conversion", Description: "Convert to date", Since: "5.0"},
+	{Name: "to_timestamp", Signature: "to_timestamp(timeuuid | date)", Returns: "timestamp", Category: "conversion", Description: "Convert to timestamp", Since: "5.0"},
+	{Name: "to_unix_timestamp", Signature: "to_unix_timestamp(timeuuid | timestamp | date)", Returns: "bigint", Category: "conversion", Description: "Convert to milliseconds since epoch", Since: "5.0"},
+	{Name: "currentTimestamp", Signature: "currentTimestamp()", Returns: "timestamp", Category: "time", Description: "Current time as a timestamp", Since: "4.0"},
+	{Name: "currentDate", Signature: "currentDate()", Returns: "date", Category: "time", Description: "Current date", Since: "4.0"},
+	{Name: "currentTime", Signature: "currentTime()", Returns: "time", Category: "time", Description: "Current time of day", Since: "4.0"},
+	{Name: "currentTimeUUID", Signature: "currentTimeUUID()", Returns: "timeuuid", Category: "time", Description: "Current time as a timeuuid", Since: "4.0"},
+	{Name: "current_timestamp", Signature: "current_timestamp()", Returns: "timestamp", Category: "time", Description: "Current time as a timestamp", Since: "5.0"},
+	{Name: "current_date", Signature: "current_date()", Returns: "date", Category: "time", Description: "Current date", Since: "5.0"},
+	{Name: "current_time", Signature: "current_time()", Returns: "time", Category: "time", Description: "Current time of day", Since: "5.0"},
+	{Name: "current_timeuuid", Signature: "current_timeuuid()", Returns: "timeuuid", Category: "time", Description: "Current time as a timeuuid", Since: "5.0"},
+
+	// Type conversion
+	{Name: "cast", Signature: "cast(value AS type)", Returns: "<type>", Category: "conversion", Description: "Convert a value to another native type", Since: "3.2"},
+	{Name: "typeAsBlob", Signature: "<type>AsBlob(value)", Returns: "blob", Category: "conversion", Description: "Convert a native value to blob (e.g. intAsBlob)"},
+	{Name: "blobAsType", Signature: "blobAs<Type>(blob)", Returns: "<type>", Category: "conversion", Description: "Convert a blob to a native value (e.g. blobAsInt)"},
+	{Name: "fromJson", Signature: "fromJson(text)", Returns: "<column type>", Category: "conversion", Description: "Parse a JSON value for a column", Since: "2.2"},
+	{Name: "toJson", Signature: "toJson(column)", Returns: "text", Category: "conversion", Description: "Encode a value as JSON", Since: "2.2"},
+
+	// Collection functions
+	{Name: "map_keys", Signature: "map_keys(map)", Returns: "set", Category: "collection", Description: "Keys of a map", Since: "5.0"},
+	{Name: "map_values", Signature: "map_values(map)", Returns: "list", Category: "collection", Description: "Values of a map", Since: "5.0"},
+	{Name: "collection_count", Signature: "collection_count(collection)", Returns: "int", Category: "collection", Description: "Number of elements", Since: "5.0"},
+	{Name: "collection_min", Signature: "collection_min(collection)", Returns: "<element type>", Category: "collection", Description: "Smallest element", Since: "5.0"},
+	{Name: "collection_max", Signature: "collection_max(collection)", Returns: "<element type>", Category: "collection", Description: "Largest element", Since: "5.0"},
+	{Name: "collection_sum", Signature: "collection_sum(collection)", Returns: "<element type>", Category: "collection", Description: "Sum of numeric elements", Since: "5.0"},
+	{Name: "collection_avg", Signature: "collection_avg(collection)", Returns: "<element type>", Category: "collection", Description: "Average of numeric elements", Since: "5.0"},
+
+	// Math functions
+	{Name: "abs", Signature: "abs(number)", Returns: "<number type>", Category: "math", Description: "Absolute value", Since: "5.0"},
+	{Name: "exp", Signature: "exp(number)", Returns: "<number type>", Category: "math", Description: "e raised to the given power", Since: "5.0"},
+	{Name: "log", Signature: "log(number)", Returns: "<number type>", Category: "math", Description: "Natural logarithm", Since: "5.0"},
+	{Name: "log10", Signature: "log10(number)", Returns: "<number type>", Category: "math", Description: "Base 10 logarithm", Since: "5.0"},
+	{Name: "round", Signature: "round(number)", Returns: "<number type>", Category: "math", Description: "Round to the nearest integer", Since: "5.0"},
+
+	// Dynamic data masking
+	{Name: "mask_null", Signature: "mask_null(value)", Returns: "<value type>", Category: "masking", Description: "Replace with null", Since: "5.0"},
+	{Name: "mask_default", Signature: "mask_default(value)", Returns: "<value type>", Category: "masking", Description: "Replace with a fixed default for the type", Since: "5.0"},
+	{Name: "mask_replace", Signature: "mask_replace(value, replacement)", Returns: "<value type>", Category: "masking", Description: "Replace with the given value", Since: "5.0"},
+	{Name: "mask_inner", Signature: "mask_inner(text, begin, end[, padding])", Returns: "text", Category: "masking", Description: "Mask all but the first and last characters", Since: "5.0"},
+	{Name: "mask_outer", Signature: "mask_outer(text, begin, end[, padding])", Returns: "text", Category: "masking", Description: "Mask the first and last characters", Since: "5.0"},
+	{Name: "mask_hash", Signature: "mask_hash(value[, algorithm])", Returns: "blob", Category: "masking", Description: "Replace with a hash of the value", Since: "5.0"},
+
+	// Vector search
+	{Name: "similarity_cosine", Signature: "similarity_cosine(vector<float, n>, vector<float, n>)", Returns: "float", Category: "vector", Description: "Cosine similarity", Since: "5.0"},
+	{Name: "similarity_euclidean", Signature: "similarity_euclidean(vector<float, n>, vector<float, n>)", Returns: "float", Category: "vector", Description: "Euclidean similarity", Since: "5.0"},
+	{Name: "similarity_dot_product", Signature: "similarity_dot_product(vector<float, n>, vector<float, n>)", Returns: "float", Category: "vector", Description: "Dot product similarity", Since: "5.0"},
+}
+
+var dataTypes = []DataType{
+	{Name: "ascii", Category: "native"},
+	{Name: "bigint", Category: "native"},
+	{Name: "blob", Category: "native"},
+	{Name: "boolean", Category: "native"},
+	{Name: "counter", Category: "native"},
+	{Name: "date", Category: "native", Since: "2.2"},
+	{Name: "decimal", Category: "native"},
+	{Name: "double", Category: "native"},
+	{Name: "duration", Category: "native", Since: "3.10"},
+	{Name: "float", Category: "native"},
+	{Name: "inet", Category: "native"},
+	{Name: "int", Category: "native"},
+	{Name: "smallint", Category: "native", Since: "2.2"},
+	{Name: "text", Category: "native"},
+	{Name: "time", Category: "native", Since: "2.2"},
+	{Name: "timestamp", Category: "native"},
+	{Name: "timeuuid", Category: "native"},
+	{Name: "tinyint", Category: "native", Since: "2.2"},
+	{Name: "uuid", Category: "native"},
+	{Name: "varchar", Category: "native"},
+	{Name: "varint", Category: "native"},
+	{Name: "list", Category: "collection", Syntax: "list<type>"},
+	{Name: "set", Category: "collection", Syntax: "set<type>"},
+	{Name: "map", Category: "collection", Syntax: "map<key_type, value_type>"},
+	{Name: "tuple", Category: "special", Syntax: "tuple<type, ...>"},
+	{Name: "frozen", Category: "special", Syntax: "frozen<type>"},
+	{Name: "vector", Category: "special", Syntax: "vector<float, dimension>", Since: "5.0"},
+}
+
+var indexTypes = []IndexType{
+	{
+		Name:        "secondary",
+		Description: "Built-in legacy secondary index (CREATE INDEX)",
+	},
+	{
+		Name:        "SASI",
+		Using:       "org.apache.cassandra.index.sasi.SASIIndex",
+		Description: "SSTable-attached secondary index; experimental and disabled by default since 4.0",
+		Since:       "3.4",
+		Options: []IndexOption{
+			{Name: "mode", Values: []string{"PREFIX", "CONTAINS", "SPARSE"}, Description: "Index mode"},
+			{Name: "analyzed", Values: []string{"true", "false"}, Description: "Whether to analyze (tokenize) text values"},
+			{Name: "analyzer_class", Values: []string{"org.apache.cassandra.index.sasi.analyzer.StandardAnalyzer", "org.apache.cassandra.index.sasi.analyzer.NonTokenizingAnalyzer"}, Description: "Analyzer implementation"},
+			{Name: "case_sensitive", Values: []string{"true", "false"}, Description: "Case sensitivity for the non-tokenizing analyzer"},
+		},
+	},
+	{
+		Name:        "SAI",
+		Using:       "StorageAttachedIndex",
+		Description: "Storage-attached index supporting numeric ranges, text and vector ANN search",
+		Since:       "5.0",
+		Options: []IndexOption{
+			{Name: "case_sensitive", Values: []string{"true", "false"}, Description: "Case-sensitive matching for text columns"},
+			{Name: "normalize", Values: []string{"true", "false"}, Description: "Unicode-normalize text before indexing"},
+			{Name: "ascii", Values: []string{"true", "false"}, Description: "Fold non-ASCII characters to ASCII equivalents"},
+			{Name: "similarity_function", Values: []string{"COSINE", "EUCLIDEAN", "DOT_PRODUCT"}, Description: "Similarity function for vector columns"},
+		},
+	},
+}
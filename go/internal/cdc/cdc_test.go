@@ -0,0 +1,239 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// encodeUVInt encodes v as Cassandra's VIntCoding.writeUnsignedVInt does
+func encodeUVInt(v uint64) []byte {
+	size := (639 - bits.LeadingZeros64(v|1)*9) >> 6
+	extra := size - 1
+	out := make([]byte, size)
+	for i := size - 1; i > 0; i-- {
+		out[i] = byte(v)
+		v >>= 8
+	}
+	out[0] = byte(0xff<<(8-extra)) | byte(v)
+	return out
+}
+
+type mutationBuilder []byte
+
+func (b *mutationBuilder) byte(v byte)        { *b = append(*b, v) }
+func (b *mutationBuilder) raw(v ...byte)      { *b = append(*b, v...) }
+func (b *mutationBuilder) uvint(v uint64)     { *b = append(*b, encodeUVInt(v)...) }
+func (b *mutationBuilder) vintBytes(v []byte) { b.uvint(uint64(len(v))); b.raw(v...) }
+func (b *mutationBuilder) int32(v int32) {
+	*b = binary.BigEndian.AppendUint32(*b, uint32(v))
+}
+
+func testTable(t *testing.T) *Table {
+	parse := func(s string) *db.CQLTypeInfo {
+		typ, err := db.ParseCQLType(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typ
+	}
+	return &Table{
+		Keyspace:     "ks",
+		Name:         "events",
+		PartitionKey: []Column{{Name: "id", Type: parse("int")}},
+		Clustering:   []Column{{Name: "ck", Type: parse("int")}},
+		Columns: map[string]*db.CQLTypeInfo{
+			"s": parse("int"),
+			"v": parse("text"),
+			"m": parse("map<text, int>"),
+		},
+	}
+}
+
+// buildMutation serializes one partition update of ks.events:
+// INSERT (id, ck, v, m, s) VALUES (1, 2, 'hello', {'k': 7}, 5) and a
+// deletion of the row with ck = 3
+func buildMutation(tableID gocql.UUID, minTimestamp int64) []byte {
+	var b mutationBuilder
+	b.uvint(1) // partition updates
+	b.raw(tableID[:]...)
+	b.vintBytes([]byte{0, 0, 0, 1}) // partition key
+	b.byte(partitionHasStaticRow)
+
+	b.uvint(uint64(minTimestamp - timestampEpoch))
+	b.uvint(0) // min local deletion time
+	b.uvint(0) // min TTL
+	b.uvint(1)
+	b.vintBytes([]byte("s"))
+	b.uvint(2)
+	b.vintBytes([]byte("v"))
+	b.vintBytes([]byte("m"))
+
+	// Static row: s = 5
+	b.byte(extensionFlag | hasAllColumns)
+	b.byte(isStatic)
+	b.byte(0)  // cell flags
+	b.uvint(0) // timestamp delta
+	b.int32(5)
+
+	// Row ck = 2 with a row marker
+	b.byte(hasTimestamp | hasAllColumns)
+	b.uvint(0) // clustering header: no null or empty values
+	b.int32(2)
+	b.uvint(0) // row timestamp delta
+	b.byte(cellUseRowTimestamp)
+	b.vintBytes([]byte("hello"))
+	b.uvint(1) // map cells
+	b.byte(cellUseRowTimestamp)
+	b.vintBytes([]byte("k"))
+	b.vintBytes([]byte{0, 0, 0, 7})
+
+	// Row ck = 3 deleted, no columns
+	b.byte(hasDeletion)
+	b.uvint(0)
+	b.int32(3)
+	b.uvint(10)         // deletion timestamp delta
+	b.uvint(1700000000) // local deletion time delta
+	b.uvint(0b11)       // both regular columns missing
+
+	b.byte(endOfPartition)
+	return b
+}
+
+// writeSegment writes a version 7 segment holding the given mutations in one
+// sync section, followed by preallocated space
+func writeSegment(t *testing.T, path string, id int64, mutations ...[]byte) {
+	var seg []byte
+	params := []byte("{}")
+	seg = binary.BigEndian.AppendUint32(seg, 7)
+	seg = binary.BigEndian.AppendUint64(seg, uint64(id))
+	seg = binary.BigEndian.AppendUint16(seg, uint16(len(params)))
+	seg = append(seg, params...)
+	crc := crc32.NewIEEE()
+	writeCRCInt(crc, 7)
+	writeCRCInt(crc, uint32(id))
+	writeCRCInt(crc, uint32(uint64(id)>>32))
+	writeCRCInt(crc, uint32(len(params)))
+	crc.Write(params)
+	seg = binary.BigEndian.AppendUint32(seg, crc.Sum32())
+
+	marker := len(seg)
+	var section []byte
+	for _, m := range mutations {
+		crc := crc32.NewIEEE()
+		writeCRCInt(crc, uint32(len(m)))
+		section = binary.BigEndian.AppendUint32(section, uint32(len(m)))
+		section = binary.BigEndian.AppendUint32(section, crc.Sum32())
+		crc.Write(m)
+		section = append(section, m...)
+		section = binary.BigEndian.AppendUint32(section, crc.Sum32())
+	}
+	next := marker + syncMarkerSize + len(section)
+	seg = binary.BigEndian.AppendUint32(seg, uint32(next))
+	seg = binary.BigEndian.AppendUint32(seg, syncMarkerCRC(id, marker))
+	seg = append(seg, section...)
+	seg = append(seg, make([]byte, 64)...)
+
+	if err := os.WriteFile(path, seg, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadSegmentAndDecode(t *testing.T) {
+	dir := t.TempDir()
+	tableID := gocql.TimeUUID()
+	table := testTable(t)
+	minTimestamp := int64(1700000000000000)
+
+	name := "CommitLog-7-1234.log"
+	writeSegment(t, filepath.Join(dir, name), 1234, buildMutation(tableID, minTimestamp), buildMutation(tableID, minTimestamp))
+	if err := os.WriteFile(filepath.Join(dir, "CommitLog-7-1234_cdc.idx"), []byte("4096\nCOMPLETED\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := ListSegments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || segments[0].ID != 1234 || segments[0].Version != 7 || !segments[0].Completed || segments[0].Offset != 4096 {
+		t.Fatalf("ListSegments() = %+v", segments)
+	}
+
+	d := &Decoder{
+		Tables: func(id gocql.UUID) (*Table, error) {
+			if id == tableID {
+				return table, nil
+			}
+			return nil, nil
+		},
+		Values: db.NewBinaryDecoder(nil),
+	}
+
+	var changes []Change
+	err = ReadSegment(filepath.Join(dir, name), 0, func(e Entry) bool {
+		decoded, err := d.Decode(e.Data)
+		if err != nil {
+			t.Fatalf("Decode() at %d: %v", e.Position, err)
+		}
+		changes = append(changes, decoded...)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ReadSegment() error = %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+
+	c := changes[0]
+	if c.Keyspace != "ks" || c.Table != "events" || !reflect.DeepEqual(c.PartitionKey, map[string]interface{}{"id": int32(1)}) {
+		t.Fatalf("change = %+v", c)
+	}
+	if len(c.Rows) != 3 {
+		t.Fatalf("got %d rows, want 3: %+v", len(c.Rows), c.Rows)
+	}
+
+	static := c.Rows[0]
+	if static.Kind != "static" || len(static.Cells) != 1 || static.Cells[0].Value != int32(5) || static.Cells[0].Timestamp != minTimestamp {
+		t.Errorf("static row = %+v", static)
+	}
+
+	row := c.Rows[1]
+	if row.Kind != "row" || row.Clustering["ck"] != int32(2) || row.Timestamp == nil || *row.Timestamp != minTimestamp {
+		t.Errorf("row = %+v", row)
+	}
+	want := []Cell{
+		{Column: "v", Value: "hello", Timestamp: minTimestamp},
+		{Column: "m", Path: "k", Value: int32(7), Timestamp: minTimestamp},
+	}
+	if !reflect.DeepEqual(row.Cells, want) {
+		t.Errorf("cells = %+v, want %+v", row.Cells, want)
+	}
+
+	deleted := c.Rows[2]
+	if deleted.Clustering["ck"] != int32(3) || deleted.Deletion == nil || deleted.Deletion.Timestamp != minTimestamp+10 || len(deleted.Cells) != 0 {
+		t.Errorf("deleted row = %+v", deleted)
+	}
+
+	// A table missing from the schema stops decoding with an error
+	d.Tables = func(gocql.UUID) (*Table, error) { return nil, nil }
+	if _, err := d.Decode(buildMutation(tableID, minTimestamp)); err == nil {
+		t.Error("expected an error for an unknown table")
+	}
+}
+
+func TestReaderUVInt(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 16383, 16384, 1 << 40, 1<<64 - 1} {
+		r := &reader{data: encodeUVInt(v)}
+		if got := r.uvint(); got != v || r.err != nil || r.pos != len(r.data) {
+			t.Errorf("uvint(%d) = %d (err %v, read %d of %d bytes)", v, got, r.err, r.pos, len(r.data))
+		}
+	}
+}
@@ -0,0 +1,674 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Mutations are serialized as a count of partition updates, each being the
+// table id followed by the partition in the "unfiltered row iterator" format
+// also used between replicas (Cassandra 3.0+):
+//
+//	<key><flags><header>[<partition deletion>][<static row>][<row estimate>]<unfiltered>...<end of partition>
+//
+// Timestamps, deletion times and TTLs are written as deltas from the minimums
+// in the header. Which columns a row has is given against the column names
+// listed in the header, but clustering values and column types come from the
+// table schema, so a partition update can only be decoded with its table.
+
+// Epochs the header minimums are relative to (2015-09-22 00:00:00 UTC)
+const (
+	timestampEpoch    = int64(1442880000000000) // microseconds
+	deletionTimeEpoch = int32(1442880000)       // seconds
+)
+
+// Partition flags
+const (
+	partitionIsEmpty        = 0x01
+	partitionHasDeletion    = 0x04
+	partitionHasStaticRow   = 0x08
+	partitionHasRowEstimate = 0x10
+)
+
+// Unfiltered (row or range tombstone marker) flags
+const (
+	endOfPartition     = 0x01
+	isMarker           = 0x02
+	hasTimestamp       = 0x04
+	hasTTL             = 0x08
+	hasDeletion        = 0x10
+	hasAllColumns      = 0x20
+	hasComplexDeletion = 0x40
+	extensionFlag      = 0x80
+
+	// Extended flags
+	isStatic              = 0x01
+	hasShadowableDeletion = 0x02
+)
+
+// Cell flags
+const (
+	cellIsDeleted       = 0x01
+	cellIsExpiring      = 0x02
+	cellHasEmptyValue   = 0x04
+	cellUseRowTimestamp = 0x08
+	cellUseRowTTL       = 0x10
+)
+
+// boundKinds names the kinds of range tombstone bounds, by ordinal
+var boundKinds = []string{
+	"EXCL_END_BOUND",
+	"INCL_START_BOUND",
+	"EXCL_END_INCL_START_BOUNDARY",
+	"STATIC_CLUSTERING",
+	"CLUSTERING",
+	"INCL_END_EXCL_START_BOUNDARY",
+	"INCL_END_BOUND",
+	"EXCL_START_BOUND",
+}
+
+// Column is a primary key column with its parsed type
+type Column struct {
+	Name string
+	Type *db.CQLTypeInfo
+}
+
+// Table is the schema needed to decode the partition updates of a table
+type Table struct {
+	Keyspace     string
+	Name         string
+	PartitionKey []Column                   // In key order
+	Clustering   []Column                   // In clustering order
+	Columns      map[string]*db.CQLTypeInfo // Static and regular columns by name
+}
+
+// TableResolver returns the table with the given id, or nil when there is none
+type TableResolver func(id gocql.UUID) (*Table, error)
+
+// Change is a partition update: the writes a mutation made to one partition
+// of one table
+type Change struct {
+	Segment           string                 `json:"segment"`
+	Position          int64                  `json:"position"` // Offset of the mutation in the segment
+	Keyspace          string                 `json:"keyspace"`
+	Table             string                 `json:"table"`
+	TableID           string                 `json:"tableId"`
+	PartitionKey      map[string]interface{} `json:"partitionKey"`
+	PartitionDeletion *Deletion              `json:"partitionDeletion,omitempty"` // The whole partition was deleted
+	Rows              []Row                  `json:"rows,omitempty"`
+}
+
+// Row is a row, the static row or a range tombstone bound of a change
+type Row struct {
+	Kind       string                 `json:"kind"` // "row", "static" or "rangeTombstone"
+	Clustering map[string]interface{} `json:"clustering,omitempty"`
+	Timestamp  *int64                 `json:"timestamp,omitempty"` // Row marker write time (INSERT), microseconds
+	TTL        int                    `json:"ttl,omitempty"`       // Row marker TTL, seconds
+	Deletion   *Deletion              `json:"deletion,omitempty"`  // Row deletion, or the deletion a range tombstone bound opens
+	Cells      []Cell                 `json:"cells,omitempty"`
+
+	// Deletions of whole non-frozen collections and UDTs, by column
+	ComplexDeletions map[string]*Deletion `json:"complexDeletions,omitempty"`
+
+	Bound       string    `json:"bound,omitempty"`       // Range tombstone bound kind, e.g. INCL_START_BOUND
+	EndDeletion *Deletion `json:"endDeletion,omitempty"` // Deletion a range tombstone boundary closes
+}
+
+// Cell is a column value written by a change. Non-frozen collections and
+// UDTs have one cell per element or field, identified by Path.
+type Cell struct {
+	Column    string      `json:"column"`
+	Path      interface{} `json:"path,omitempty"` // List element id, set element, map key or UDT field name
+	Value     interface{} `json:"value"`
+	Timestamp int64       `json:"timestamp"` // Microseconds
+	TTL       int         `json:"ttl,omitempty"`
+	Deleted   bool        `json:"deleted,omitempty"` // Tombstone (DELETE, or an update to null)
+}
+
+// Deletion is a deletion time
+type Deletion struct {
+	Timestamp         int64 `json:"timestamp"`         // Write time of the deletion, microseconds
+	LocalDeletionTime int64 `json:"localDeletionTime"` // When the node applied it, seconds since the epoch
+	Shadowable        bool  `json:"shadowable,omitempty"`
+}
+
+// Decoder decodes the mutations of commit log entries
+type Decoder struct {
+	Tables TableResolver
+	Values *db.BinaryDecoder
+	UDTs   *db.UDTRegistry // Field names and types of non-frozen UDTs; optional
+}
+
+// Decode decodes the partition updates of a serialized mutation. The changes
+// decoded before an error are returned with it.
+func (d *Decoder) Decode(data []byte) ([]Change, error) {
+	r := &reader{data: data}
+	count := r.uvint()
+	if r.err == nil && count > uint64(len(data)) {
+		return nil, fmt.Errorf("implausible partition update count %d", count)
+	}
+
+	var changes []Change
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		change, err := d.decodePartitionUpdate(r)
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, *change)
+	}
+	return changes, r.err
+}
+
+// header holds the encoding minimums and column names of a partition update
+type header struct {
+	minTimestamp         int64
+	minLocalDeletionTime int32
+	minTTL               int32
+	statics              []string
+	regulars             []string
+}
+
+func (h *header) timestamp(r *reader) int64 {
+	return h.minTimestamp + int64(r.uvint()) // #nosec G115 - deltas wrap like Cassandra's long arithmetic
+}
+
+func (h *header) localDeletionTime(r *reader) int32 {
+	return h.minLocalDeletionTime + int32(r.uvint()) // #nosec G115 - deltas wrap like Cassandra's int arithmetic
+}
+
+func (h *header) ttl(r *reader) int32 {
+	return h.minTTL + int32(r.uvint()) // #nosec G115 - deltas wrap like Cassandra's int arithmetic
+}
+
+// deletion reads a deletion time, returning nil for the live (no deletion) value
+func (h *header) deletion(r *reader) *Deletion {
+	ts := h.timestamp(r)
+	ldt := h.localDeletionTime(r)
+	if ts == math.MinInt64 {
+		return nil
+	}
+	return &Deletion{Timestamp: ts, LocalDeletionTime: int64(ldt)}
+}
+
+func (d *Decoder) decodePartitionUpdate(r *reader) (*Change, error) {
+	var id gocql.UUID
+	copy(id[:], r.bytes(16))
+	if r.err != nil {
+		return nil, r.err
+	}
+	table, err := d.Tables(id)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return nil, fmt.Errorf("unknown table id %s (dropped, or not in the connected cluster)", id)
+	}
+
+	change := &Change{TableID: id.String(), Keyspace: table.Keyspace, Table: table.Name}
+	change.PartitionKey = d.decodePartitionKey(table, r.vintBytes())
+
+	flags := r.byte()
+	if r.err != nil || flags&partitionIsEmpty != 0 {
+		return change, r.err
+	}
+
+	h := &header{
+		minTimestamp:         timestampEpoch + int64(r.uvint()),    // #nosec G115 - wraps like Cassandra
+		minLocalDeletionTime: deletionTimeEpoch + int32(r.uvint()), // #nosec G115 - wraps like Cassandra
+		minTTL:               int32(r.uvint()),                     // #nosec G115 - wraps like Cassandra
+	}
+	if flags&partitionHasStaticRow != 0 {
+		h.statics = r.columnNames()
+	}
+	h.regulars = r.columnNames()
+	if flags&partitionHasDeletion != 0 {
+		change.PartitionDeletion = h.deletion(r)
+	}
+	if flags&partitionHasStaticRow != 0 {
+		row, err := d.decodeUnfiltered(r, table, h, r.byte())
+		if err != nil {
+			return change, err
+		}
+		change.Rows = append(change.Rows, *row)
+	}
+	if flags&partitionHasRowEstimate != 0 {
+		r.uvint()
+	}
+
+	for r.err == nil {
+		rowFlags := r.byte()
+		if r.err != nil || rowFlags&endOfPartition != 0 {
+			break
+		}
+		row, err := d.decodeUnfiltered(r, table, h, rowFlags)
+		if err != nil {
+			return change, err
+		}
+		change.Rows = append(change.Rows, *row)
+	}
+	return change, r.err
+}
+
+// decodeUnfiltered decodes a row or range tombstone marker whose flags were read
+func (d *Decoder) decodeUnfiltered(r *reader, table *Table, h *header, flags byte) (*Row, error) {
+	if flags&isMarker != 0 {
+		return d.decodeMarker(r, table, h)
+	}
+
+	var ext byte
+	if flags&extensionFlag != 0 {
+		ext = r.byte()
+	}
+
+	row := &Row{Kind: "row"}
+	columns := h.regulars
+	if ext&isStatic != 0 {
+		row.Kind = "static"
+		columns = h.statics
+	} else {
+		row.Clustering = d.decodeClustering(r, table, len(table.Clustering))
+	}
+
+	var rowTimestamp int64
+	var rowTTL int32
+	if flags&hasTimestamp != 0 {
+		rowTimestamp = h.timestamp(r)
+		row.Timestamp = &rowTimestamp
+	}
+	if flags&hasTTL != 0 {
+		rowTTL = h.ttl(r)
+		h.localDeletionTime(r)
+		row.TTL = int(rowTTL)
+	}
+	if flags&hasDeletion != 0 {
+		row.Deletion = h.deletion(r)
+		if row.Deletion != nil && ext&hasShadowableDeletion != 0 {
+			row.Deletion.Shadowable = true
+		}
+	}
+
+	present := columns
+	if flags&hasAllColumns == 0 {
+		present = r.subset(columns)
+	}
+
+	for _, name := range present {
+		if r.err != nil {
+			break
+		}
+		typ := table.Columns[name]
+		if typ == nil {
+			return nil, fmt.Errorf("column %s of %s.%s is not in the current schema", name, table.Keyspace, table.Name)
+		}
+		if !isComplex(typ) {
+			row.Cells = append(row.Cells, d.decodeCell(r, table, h, name, typ, false, rowTimestamp, rowTTL))
+			continue
+		}
+
+		if flags&hasComplexDeletion != 0 {
+			if del := h.deletion(r); del != nil {
+				if row.ComplexDeletions == nil {
+					row.ComplexDeletions = make(map[string]*Deletion)
+				}
+				row.ComplexDeletions[name] = del
+			}
+		}
+		count := r.uvint()
+		for i := uint64(0); i < count && r.err == nil; i++ {
+			row.Cells = append(row.Cells, d.decodeCell(r, table, h, name, typ, true, rowTimestamp, rowTTL))
+		}
+	}
+	return row, r.err
+}
+
+// decodeCell decodes a cell of a simple column, or one element of a complex one
+func (d *Decoder) decodeCell(r *reader, table *Table, h *header, name string, typ *db.CQLTypeInfo, complex bool, rowTimestamp int64, rowTTL int32) Cell {
+	flags := r.byte()
+	cell := Cell{Column: name, Deleted: flags&cellIsDeleted != 0}
+	expiring := flags&cellIsExpiring != 0
+
+	if flags&cellUseRowTimestamp != 0 {
+		cell.Timestamp = rowTimestamp
+	} else {
+		cell.Timestamp = h.timestamp(r)
+	}
+	if flags&cellUseRowTTL != 0 {
+		if expiring {
+			cell.TTL = int(rowTTL)
+		}
+	} else {
+		if cell.Deleted || expiring {
+			h.localDeletionTime(r)
+		}
+		if expiring {
+			cell.TTL = int(h.ttl(r))
+		}
+	}
+
+	valueType := typ
+	if complex {
+		var path interface{}
+		path, valueType = d.decodeCellPath(table, typ, r.vintBytes())
+		cell.Path = path
+	}
+
+	if flags&cellHasEmptyValue == 0 {
+		length := -1
+		if !complex {
+			length = fixedLength(typ)
+		}
+		var value []byte
+		if length >= 0 {
+			value = r.bytes(length)
+		} else {
+			value = r.vintBytes()
+		}
+		cell.Value = d.value(table, valueType, value)
+	}
+	return cell
+}
+
+// decodeCellPath decodes the path of a complex cell and returns it with the
+// type of the cell's value
+func (d *Decoder) decodeCellPath(table *Table, typ *db.CQLTypeInfo, path []byte) (interface{}, *db.CQLTypeInfo) {
+	switch typ.BaseType {
+	case "list":
+		return d.value(table, &db.CQLTypeInfo{BaseType: "timeuuid"}, path), typ.Parameters[0]
+	case "set":
+		return d.value(table, typ.Parameters[0], path), nil
+	case "map":
+		return d.value(table, typ.Parameters[0], path), typ.Parameters[1]
+	case "udt":
+		if len(path) != 2 {
+			return hexValue(path), nil
+		}
+		index := int(binary.BigEndian.Uint16(path))
+		if d.UDTs != nil {
+			keyspace := typ.Keyspace
+			if keyspace == "" {
+				keyspace = table.Keyspace
+			}
+			if def, err := d.UDTs.GetUDTDefinition(keyspace, typ.UDTName); err == nil && index < len(def.Fields) {
+				return def.Fields[index].Name, def.Fields[index].TypeInfo
+			}
+		}
+		return index, nil
+	}
+	return hexValue(path), nil
+}
+
+// decodeMarker decodes a range tombstone bound or boundary
+func (d *Decoder) decodeMarker(r *reader, table *Table, h *header) (*Row, error) {
+	kind := int(r.byte())
+	size := int(r.uint16())
+	if r.err != nil {
+		return nil, r.err
+	}
+	if size > len(table.Clustering) {
+		return nil, fmt.Errorf("range tombstone bound has %d clustering values, %s.%s has %d", size, table.Keyspace, table.Name, len(table.Clustering))
+	}
+
+	row := &Row{Kind: "rangeTombstone", Clustering: d.decodeClustering(r, table, size)}
+	if kind < len(boundKinds) {
+		row.Bound = boundKinds[kind]
+	}
+	if row.Bound == "EXCL_END_INCL_START_BOUNDARY" || row.Bound == "INCL_END_EXCL_START_BOUNDARY" {
+		row.EndDeletion = h.deletion(r)
+	}
+	row.Deletion = h.deletion(r)
+	return row, r.err
+}
+
+// decodeClustering decodes the first size clustering values. Values are
+// written in blocks of up to 32, each preceded by a header with two bits per
+// value: empty, and null.
+func (d *Decoder) decodeClustering(r *reader, table *Table, size int) map[string]interface{} {
+	if size == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, size)
+	var bitmap uint64
+	for i := 0; i < size && r.err == nil; i++ {
+		if i%32 == 0 {
+			bitmap = r.uvint()
+		}
+		col := table.Clustering[i]
+		shift := uint(i%32) * 2
+		switch {
+		case bitmap&(1<<(shift+1)) != 0:
+			values[col.Name] = nil
+		case bitmap&(1<<shift) != 0:
+			values[col.Name] = ""
+		default:
+			var value []byte
+			if length := fixedLength(col.Type); length >= 0 {
+				value = r.bytes(length)
+			} else {
+				value = r.vintBytes()
+			}
+			values[col.Name] = d.value(table, col.Type, value)
+		}
+	}
+	return values
+}
+
+// decodePartitionKey splits a composite partition key into its components
+// (each a 2-byte length, the value and an end-of-component byte) and decodes them
+func (d *Decoder) decodePartitionKey(table *Table, key []byte) map[string]interface{} {
+	values := make(map[string]interface{}, len(table.PartitionKey))
+	if len(table.PartitionKey) == 1 {
+		col := table.PartitionKey[0]
+		values[col.Name] = d.value(table, col.Type, key)
+		return values
+	}
+
+	pos := 0
+	for _, col := range table.PartitionKey {
+		if pos+2 > len(key) {
+			return map[string]interface{}{"key": hexValue(key)}
+		}
+		length := int(binary.BigEndian.Uint16(key[pos:]))
+		if pos+2+length+1 > len(key) {
+			return map[string]interface{}{"key": hexValue(key)}
+		}
+		values[col.Name] = d.value(table, col.Type, key[pos+2:pos+2+length])
+		pos += 2 + length + 1
+	}
+	return values
+}
+
+// value decodes a value of typ for JSON output. Values that cannot be
+// decoded, including counter contexts, are returned as hex.
+func (d *Decoder) value(table *Table, typ *db.CQLTypeInfo, data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	if typ == nil || typ.BaseType == "counter" || d.Values == nil {
+		return hexValue(data)
+	}
+	v, err := d.Values.Decode(data, typ, table.Keyspace)
+	if err != nil {
+		return hexValue(data)
+	}
+	if b, ok := v.([]byte); ok {
+		return hexValue(b)
+	}
+	return db.NormalizeJSON(v)
+}
+
+// isComplex reports whether values of typ are stored as one cell per element
+// or field: non-frozen collections and UDTs
+func isComplex(typ *db.CQLTypeInfo) bool {
+	if typ.Frozen {
+		return false
+	}
+	switch typ.BaseType {
+	case "list", "set", "map", "udt":
+		return true
+	}
+	return false
+}
+
+// fixedLength returns the serialized size of values of typ, or -1 when values
+// are written with their length (AbstractType.valueLengthIfFixed)
+func fixedLength(typ *db.CQLTypeInfo) int {
+	if typ == nil {
+		return -1
+	}
+	switch typ.BaseType {
+	case "boolean":
+		return 1
+	case "int", "float":
+		return 4
+	case "bigint", "double", "timestamp":
+		return 8
+	case "uuid", "timeuuid":
+		return 16
+	case "vector":
+		if len(typ.Parameters) == 1 {
+			if element := fixedLength(typ.Parameters[0]); element >= 0 {
+				return element * typ.Dimension
+			}
+		}
+	}
+	return -1
+}
+
+func hexValue(b []byte) string {
+	return fmt.Sprintf("0x%x", b)
+}
+
+// errTruncated is returned when a mutation ends in the middle of a value
+var errTruncated = errors.New("mutation is truncated")
+
+// reader reads a serialized mutation; the first error sticks and later reads
+// return zero values
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) byte() byte {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+// uvint reads an unsigned variable-length integer (VIntCoding): the number of
+// leading one bits of the first byte is the number of bytes that follow
+func (r *reader) uvint() uint64 {
+	first := r.byte()
+	extra := bits.LeadingZeros8(^first)
+	rest := r.bytes(extra)
+	if r.err != nil {
+		return 0
+	}
+	v := uint64(first) & (0xff >> uint(extra))
+	for _, b := range rest {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// vintBytes reads a value preceded by its length as an unsigned vint
+func (r *reader) vintBytes() []byte {
+	n := r.uvint()
+	if r.err == nil && n > uint64(len(r.data)-r.pos) {
+		r.err = errTruncated
+		return nil
+	}
+	return r.bytes(int(n)) // #nosec G115 - bounded by the data length above
+}
+
+// columnNames reads a column list of a header
+func (r *reader) columnNames() []string {
+	count := r.uvint()
+	if r.err == nil && count > uint64(len(r.data)-r.pos) {
+		r.err = errTruncated
+		return nil
+	}
+	names := make([]string, 0, count)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		names = append(names, string(r.vintBytes()))
+	}
+	return names
+}
+
+// subset reads which of the header columns a row has. Below 64 columns this
+// is a bitmap of the missing ones; above, the indexes of whichever of the
+// present or missing columns are fewer. 0 means all columns are present.
+func (r *reader) subset(columns []string) []string {
+	encoded := r.uvint()
+	if r.err != nil {
+		return nil
+	}
+	if encoded == 0 {
+		return columns
+	}
+
+	if len(columns) < 64 {
+		var present []string
+		for i, name := range columns {
+			if encoded&(1<<uint(i)) == 0 {
+				present = append(present, name)
+			}
+		}
+		return present
+	}
+
+	missing := int(encoded) // #nosec G115 - bounded by the column count below
+	if missing > len(columns) {
+		r.err = fmt.Errorf("row is missing %d of %d columns", missing, len(columns))
+		return nil
+	}
+	count := len(columns) - missing
+	var present []string
+	if count < len(columns)/2 {
+		for i := 0; i < count && r.err == nil; i++ {
+			if index := r.uvint(); index < uint64(len(columns)) {
+				present = append(present, columns[index])
+			}
+		}
+		return present
+	}
+	next := 0
+	for i := 0; i < missing && r.err == nil; i++ {
+		index := int(r.uvint()) // #nosec G115 - compared against the column count
+		for next < index && next < len(columns) {
+			present = append(present, columns[next])
+			next++
+		}
+		next++
+	}
+	return append(present, columns[min(next, len(columns)):]...)
+}
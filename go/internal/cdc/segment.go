@@ -0,0 +1,237 @@
+// Package cdc reads the commit log segments Cassandra keeps in its cdc_raw
+// directory for tables with cdc=true, and decodes the mutations in them.
+//
+// A segment (CommitLog-<version>-<id>.log) starts with a descriptor header
+// and is written in sync sections, each opened by a sync marker pointing at
+// the next one. A section holds checksummed entries, one serialized mutation
+// each. Cassandra 4.0+ also writes a CommitLog-<version>-<id>_cdc.idx file
+// with the offset up to which the segment is durable, and COMPLETED once the
+// segment is no longer written to.
+//
+// Only uncompressed, unencrypted segments of commit log versions 6 (3.0/3.x),
+// 7 (4.x) and 8 (5.0) can be read.
+package cdc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Commit log versions that share the segment and mutation format read here
+const (
+	minSegmentVersion = 6
+	maxSegmentVersion = 8
+)
+
+// syncMarkerSize is the size of the marker opening each sync section
+const syncMarkerSize = 8
+
+// minEntrySize is the smallest serialized mutation; a smaller size marks the
+// end of the written part of a section
+const minEntrySize = 10
+
+// segmentName matches commit log segment file names
+var segmentName = regexp.MustCompile(`^CommitLog-(\d+)-(\d+)\.log$`)
+
+// SegmentInfo describes a commit log segment in the CDC directory
+type SegmentInfo struct {
+	File      string `json:"file"`
+	ID        int64  `json:"id"`
+	Version   int    `json:"version"`
+	Size      int64  `json:"size"`
+	Offset    int64  `json:"offset,omitempty"` // Durable length from the _cdc.idx file (0 when there is none)
+	Completed bool   `json:"completed"`        // The segment is no longer written to
+	Changes   int    `json:"changes"`          // Partition updates read from the segment
+	Error     string `json:"error,omitempty"`  // Why (the rest of) the segment could not be read
+}
+
+// ListSegments returns the commit log segments in dir, oldest first
+func ListSegments(dir string) ([]SegmentInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []SegmentInfo
+	for _, entry := range entries {
+		m := segmentName.FindStringSubmatch(entry.Name())
+		if m == nil || entry.IsDir() {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+		id, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		seg := SegmentInfo{File: entry.Name(), ID: id, Version: version}
+		if info, err := entry.Info(); err == nil {
+			seg.Size = info.Size()
+		}
+		seg.Offset, seg.Completed = readCDCIndex(filepath.Join(dir, strings.TrimSuffix(entry.Name(), ".log")+"_cdc.idx"))
+		segments = append(segments, seg)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].ID < segments[j].ID })
+	return segments, nil
+}
+
+// readCDCIndex reads the durable offset and completion flag of a segment.
+// Segments without an index file (before 4.0) are read up to their end.
+func readCDCIndex(path string) (int64, bool) {
+	data, err := os.ReadFile(path) // #nosec G304 - path is built from a directory listing
+	if err != nil {
+		return 0, false
+	}
+	lines := strings.Fields(string(data))
+	if len(lines) == 0 {
+		return 0, false
+	}
+	offset, _ := strconv.ParseInt(lines[0], 10, 64)
+	return offset, len(lines) > 1 && lines[1] == "COMPLETED"
+}
+
+// Entry is a checksummed mutation read from a segment
+type Entry struct {
+	Position int64  // Offset of the entry in the segment file
+	Data     []byte // Serialized mutation
+}
+
+// ReadSegment reads the entries of the segment at path, in order, stopping
+// at the first one for which visit returns false. limit bounds the bytes
+// read (the durable offset from the _cdc.idx file); 0 reads the whole file.
+// Entries before the one that fails its checksum are still visited.
+func ReadSegment(path string, limit int64, visit func(Entry) bool) error {
+	data, err := os.ReadFile(path) // #nosec G304 - path is chosen by the caller
+	if err != nil {
+		return err
+	}
+	if limit > 0 && limit < int64(len(data)) {
+		data = data[:limit]
+	}
+
+	id, pos, err := readDescriptor(data)
+	if err != nil {
+		return err
+	}
+
+	for pos+syncMarkerSize <= len(data) {
+		next := int(binary.BigEndian.Uint32(data[pos:]))
+		claimed := binary.BigEndian.Uint32(data[pos+4:])
+		if next == 0 && claimed == 0 {
+			return nil // Preallocated space that was never written
+		}
+		if claimed != syncMarkerCRC(id, pos) {
+			return fmt.Errorf("invalid sync marker at offset %d", pos)
+		}
+		if next <= pos || next > len(data) {
+			// The section is still being written or cut off by limit
+			next = len(data)
+		}
+
+		done, err := readSection(data[:next], pos+syncMarkerSize, visit)
+		if err != nil || done {
+			return err
+		}
+		pos = next
+	}
+	return nil
+}
+
+// readDescriptor checks the descriptor header and returns the segment id and
+// the offset of the first sync marker
+func readDescriptor(data []byte) (int64, int, error) {
+	if len(data) < 18 {
+		return 0, 0, errors.New("segment is too short for a commit log header")
+	}
+	version := int32(binary.BigEndian.Uint32(data)) // #nosec G115 - header field is a signed int
+	id := int64(binary.BigEndian.Uint64(data[4:]))  // #nosec G115 - header field is a signed long
+	paramsLen := int(binary.BigEndian.Uint16(data[12:]))
+	end := 14 + paramsLen + 4
+	if len(data) < end {
+		return 0, 0, errors.New("segment is too short for its commit log header")
+	}
+	params := data[14 : 14+paramsLen]
+
+	crc := crc32.NewIEEE()
+	writeCRCInt(crc, uint32(version))        // #nosec G115 - checksummed as written
+	writeCRCInt(crc, uint32(id&0xFFFFFFFF))  // #nosec G115 - low half first
+	writeCRCInt(crc, uint32(uint64(id)>>32)) // #nosec G115 - then high half
+	writeCRCInt(crc, uint32(paramsLen))      // #nosec G115 - at most 65535
+	crc.Write(params)
+	if crc.Sum32() != binary.BigEndian.Uint32(data[14+paramsLen:]) {
+		return 0, 0, errors.New("commit log header checksum mismatch")
+	}
+	if version < minSegmentVersion || version > maxSegmentVersion {
+		return 0, 0, fmt.Errorf("unsupported commit log version %d", version)
+	}
+
+	if paramsLen > 0 {
+		var p map[string]interface{}
+		if err := json.Unmarshal(params, &p); err == nil {
+			if _, ok := p["compressionClass"]; ok {
+				return 0, 0, fmt.Errorf("compressed commit log segments are not supported (%v)", p["compressionClass"])
+			}
+			if _, ok := p["encCipher"]; ok {
+				return 0, 0, errors.New("encrypted commit log segments are not supported")
+			}
+		}
+	}
+	return id, end, nil
+}
+
+// readSection visits the entries from pos to the end of section and reports
+// whether visit asked to stop
+func readSection(section []byte, pos int, visit func(Entry) bool) (bool, error) {
+	for pos+4 <= len(section) {
+		size := int(int32(binary.BigEndian.Uint32(section[pos:]))) // #nosec G115 - sizes are signed ints
+		if size < minEntrySize {
+			return false, nil
+		}
+		if pos+12+size > len(section) {
+			return false, fmt.Errorf("entry at offset %d runs past the end of its section", pos)
+		}
+
+		crc := crc32.NewIEEE()
+		writeCRCInt(crc, uint32(size)) // #nosec G115 - size is positive
+		if crc.Sum32() != binary.BigEndian.Uint32(section[pos+4:]) {
+			return false, fmt.Errorf("entry size checksum mismatch at offset %d", pos)
+		}
+		data := section[pos+8 : pos+8+size]
+		crc.Write(data)
+		if crc.Sum32() != binary.BigEndian.Uint32(section[pos+8+size:]) {
+			return false, fmt.Errorf("entry checksum mismatch at offset %d", pos)
+		}
+
+		if !visit(Entry{Position: int64(pos), Data: data}) {
+			return true, nil
+		}
+		pos += 12 + size
+	}
+	return false, nil
+}
+
+// syncMarkerCRC is the checksum of the sync marker at pos: the segment id
+// and the marker's position
+func syncMarkerCRC(id int64, pos int) uint32 {
+	crc := crc32.NewIEEE()
+	writeCRCInt(crc, uint32(id&0xFFFFFFFF))  // #nosec G115 - low half first
+	writeCRCInt(crc, uint32(uint64(id)>>32)) // #nosec G115 - then high half
+	writeCRCInt(crc, uint32(pos))            // #nosec G115 - segment offsets fit in an int
+	return crc.Sum32()
+}
+
+// writeCRCInt adds v to crc as four big-endian bytes, as Cassandra's
+// FBUtilities.updateChecksumInt does
+func writeCRCInt(crc interface{ Write([]byte) (int, error) }, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	_, _ = crc.Write(b[:])
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 	
+	"github.com/axonops/cqlai-node/internal/filesink"
 	"github.com/axonops/cqlai-node/internal/logger"
 )
 
@@ -28,6 +29,7 @@ type Config struct {
 	Debug               bool            `json:"debug,omitempty"`               // Enable debug logging
 	HistoryFile         string          `json:"historyFile,omitempty"`         // Path to CQL command history file
 	AIHistoryFile       string          `json:"aiHistoryFile,omitempty"`       // Path to AI command history file
+	LogFiles            *filesink.Config `json:"logFiles,omitempty"`           // Log files and their rotation
 	SSL                 *SSLConfig      `json:"ssl,omitempty"`
 	AI                  *AIConfig       `json:"ai,omitempty"`
 	AuthProvider        *AuthProvider   `json:"authProvider,omitempty"`
@@ -64,6 +66,31 @@ type AIConfig struct {
 	OpenRouter *AIProviderConfig `json:"openrouter,omitempty"`
 }
 
+// Redacted returns a copy of the AI configuration with API keys masked
+func (c *AIConfig) Redacted() *AIConfig {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	cp.APIKey = redactSecret(c.APIKey)
+	for _, provider := range []**AIProviderConfig{&cp.OpenAI, &cp.Anthropic, &cp.Gemini, &cp.Ollama, &cp.OpenRouter} {
+		if *provider != nil {
+			p := **provider
+			p.APIKey = redactSecret(p.APIKey)
+			*provider = &p
+		}
+	}
+	return &cp
+}
+
+// redactSecret masks a non-empty secret
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
 // AIProviderConfig holds provider-specific configuration
 type AIProviderConfig struct {
 	APIKey string `json:"apiKey"`
@@ -96,8 +123,8 @@ func LoadConfig(customConfigPath ...string) (*Config, error) {
 
 	// First, try to load CQLSHRC file
 	cqlshrcPaths := []string{
-		filepath.Join(os.Getenv("HOME"), ".cassandra", "cqlshrc"),
-		filepath.Join(os.Getenv("HOME"), ".cqlshrc"),
+		filepath.Join(HomeDir(), ".cassandra", "cqlshrc"),
+		filepath.Join(HomeDir(), ".cqlshrc"),
 	}
 
 	logger.DebugfToFile("Config", "Looking for cqlshrc files in: %v", cqlshrcPaths)
@@ -123,11 +150,7 @@ func LoadConfig(customConfigPath ...string) (*Config, error) {
 		logger.DebugfToFile("Config", "Using custom config path: %s", customConfigPath[0])
 	} else {
 		// Use default locations
-		configPaths = []string{
-			"cqlai.json",
-			filepath.Join(os.Getenv("HOME"), ".cqlai.json"),
-			filepath.Join(os.Getenv("HOME"), ".config", "cqlai", "config.json"),
-		}
+		configPaths = defaultConfigPaths()
 		logger.DebugfToFile("Config", "Looking for JSON config files in: %v", configPaths)
 	}
 
@@ -171,6 +194,30 @@ func LoadConfig(customConfigPath ...string) (*Config, error) {
 	return config, nil
 }
 
+// defaultConfigPaths lists the JSON config locations in order of precedence
+func defaultConfigPaths() []string {
+	return []string{
+		"cqlai.json",
+		filepath.Join(HomeDir(), ".cqlai.json"),
+		filepath.Join(HomeDir(), ".config", "cqlai", "config.json"),
+	}
+}
+
+// FindConfigFile returns the JSON config file LoadConfig reads: the custom
+// path if given, otherwise the first default location that exists. It returns
+// an empty string when no config file is in use.
+func FindConfigFile(customConfigPath ...string) string {
+	if len(customConfigPath) > 0 && customConfigPath[0] != "" {
+		return customConfigPath[0]
+	}
+	for _, path := range defaultConfigPaths() {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
 // OverrideWithEnvVars overrides configuration with environment variables
 func OverrideWithEnvVars(config *Config) {
 	// Connection settings
@@ -515,21 +562,15 @@ func loadCQLSHRC(path string, config *Config) error {
 				logger.DebugfToFile("CQLSHRC", "SSL enabled (factory specified)")
 			case "certfile":
 				// Expand ~ to home directory
-				if strings.HasPrefix(value, "~") {
-					value = filepath.Join(os.Getenv("HOME"), value[1:])
-				}
+				value = ExpandHome(value)
 				config.SSL.CAPath = value
 				logger.DebugfToFile("CQLSHRC", "Set CA path to: %s", value)
 			case "userkey":
-				if strings.HasPrefix(value, "~") {
-					value = filepath.Join(os.Getenv("HOME"), value[1:])
-				}
+				value = ExpandHome(value)
 				config.SSL.KeyPath = value
 				logger.DebugfToFile("CQLSHRC", "Set key path to: %s", value)
 			case "usercert":
-				if strings.HasPrefix(value, "~") {
-					value = filepath.Join(os.Getenv("HOME"), value[1:])
-				}
+				value = ExpandHome(value)
 				config.SSL.CertPath = value
 				logger.DebugfToFile("CQLSHRC", "Set cert path to: %s", value)
 			case "validate":
@@ -576,10 +617,7 @@ func loadCredentialsFile(path string, config *Config) error {
 	logger.DebugfToFile("Credentials", "Loading credentials file: %s", path)
 	
 	// Expand ~ to home directory
-	if strings.HasPrefix(path, "~") {
-		path = filepath.Join(os.Getenv("HOME"), path[1:])
-		logger.DebugfToFile("Credentials", "Expanded path to: %s", path)
-	}
+	path = ExpandHome(path)
 
 	file, err := os.Open(path) // #nosec G304 - Config file path is validated
 	if err != nil {
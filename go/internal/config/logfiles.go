@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/axonops/cqlai-node/internal/filesink"
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// LogFileSettings returns the log files of the config with their paths
+// normalized, or nil if it sets none. The history log defaults to
+// historyFile.
+func (c *Config) LogFileSettings() (*filesink.Config, error) {
+	if c == nil || (c.LogFiles == nil && c.HistoryFile == "") {
+		return nil, nil
+	}
+	var files filesink.Config
+	if c.LogFiles != nil {
+		files = *c.LogFiles
+	}
+	if c.HistoryFile != "" && files.Sinks[logger.FileHistory].Path == "" {
+		sinks := make(map[string]filesink.SinkConfig, len(files.Sinks)+1)
+		for name, sink := range files.Sinks {
+			sinks[name] = sink
+		}
+		history := sinks[logger.FileHistory]
+		history.Path = c.HistoryFile
+		sinks[logger.FileHistory] = history
+		files.Sinks = sinks
+	}
+	return NormalizeLogFiles(&files)
+}
+
+// NormalizeLogFiles returns a copy of a log file config with every path
+// normalized as NormalizePath does
+func NormalizeLogFiles(files *filesink.Config) (*filesink.Config, error) {
+	if files == nil {
+		return nil, nil
+	}
+	normalized := &filesink.Config{Rotation: files.Rotation}
+	if len(files.Sinks) > 0 {
+		normalized.Sinks = make(map[string]filesink.SinkConfig, len(files.Sinks))
+	}
+	for name, sink := range files.Sinks {
+		if sink.Path != "" {
+			path, err := NormalizePath(sink.Path)
+			if err != nil {
+				return nil, fmt.Errorf("log %s: %v", name, err)
+			}
+			sink.Path = path
+		}
+		normalized.Sinks[name] = sink
+	}
+	return normalized, nil
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// windowsMaxPath is the length from which Windows needs a \\?\ path. It is
+// MAX_PATH less room for a file name when creating a directory, the same
+// limit the Go runtime uses.
+const windowsMaxPath = 248
+
+// HomeDir returns the user's home directory. HOME is used when set, as the
+// cqlshrc loader always has, so that ~ means the same everywhere; otherwise
+// the OS default (USERPROFILE on Windows).
+func HomeDir() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return home
+	}
+	home, _ := os.UserHomeDir()
+	return home
+}
+
+// ExpandHome replaces a leading ~ with the home directory. Only ~ on its own
+// or followed by a separator is expanded; ~user is left as it is.
+func ExpandHome(p string) string {
+	return expandHome(p, HomeDir(), runtime.GOOS)
+}
+
+// NormalizePath prepares a user-supplied file path for opening: ~ is
+// expanded, the path is made absolute and cleaned, and on Windows paths too
+// long for the Win32 API get the \\?\ prefix (\\?\UNC\ for network shares).
+func NormalizePath(p string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve %q: %v", p, err)
+	}
+	return normalizePath(p, runtime.GOOS, HomeDir(), cwd)
+}
+
+// normalizePath is NormalizePath for a given OS, home and working directory
+func normalizePath(p, goos, home, cwd string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+	if strings.IndexByte(p, 0) >= 0 {
+		return "", fmt.Errorf("path contains a NUL byte")
+	}
+	p = expandHome(p, home, goos)
+
+	if goos != "windows" {
+		// Names are bytes on Unix, so paths that are not UTF-8 pass through
+		if !strings.HasPrefix(p, "/") {
+			p = cwd + "/" + p
+		}
+		return path.Clean(p), nil
+	}
+
+	// Windows file names are UTF-16; a string that is not UTF-8 would be
+	// converted with replacement characters and name a different file
+	if !utf8.ValidString(p) {
+		return "", fmt.Errorf("path is not valid UTF-8")
+	}
+	return windowsPath(p, cwd), nil
+}
+
+// expandHome replaces a leading ~ with home
+func expandHome(p, home, goos string) string {
+	if home == "" || !strings.HasPrefix(p, "~") {
+		return p
+	}
+	if len(p) == 1 {
+		return home
+	}
+	if p[1] == '/' || (goos == "windows" && p[1] == '\\') {
+		return strings.TrimRight(home, `/\`) + p[1:]
+	}
+	return p
+}
+
+// windowsPath makes a Windows path absolute and clean, adding the verbatim
+// prefix when it is too long for the Win32 API. Paths that already use a
+// \\?\ or \\.\ prefix are passed through, since Windows does not parse them.
+func windowsPath(p, cwd string) string {
+	if strings.HasPrefix(p, `\\?\`) || strings.HasPrefix(p, `\\.\`) {
+		return p
+	}
+	p = strings.ReplaceAll(p, "/", `\`)
+
+	switch {
+	case strings.HasPrefix(p, `\\`):
+		// UNC share: \\server\share\dir
+		share := strings.TrimPrefix(cleanWindows(p[2:]), `\`)
+		if len(share)+2 < windowsMaxPath {
+			return `\\` + share
+		}
+		return `\\?\UNC\` + share
+	case len(p) >= 3 && p[1] == ':' && p[2] == '\\':
+		p = p[:2] + cleanWindows(p[2:])
+	case len(p) >= 2 && p[1] == ':':
+		// Drive-relative (C:dir) depends on the drive's own current
+		// directory, which only Windows knows
+		return p
+	case strings.HasPrefix(p, `\`):
+		// Rooted on the current drive
+		return windowsPath(windowsVolume(cwd)+p, cwd)
+	default:
+		return windowsPath(strings.TrimRight(cwd, `\/`)+`\`+p, cwd)
+	}
+
+	if len(p) < windowsMaxPath {
+		return p
+	}
+	return `\\?\` + p
+}
+
+// cleanWindows cleans a path below a volume, keeping the leading separator
+func cleanWindows(p string) string {
+	return strings.ReplaceAll(path.Clean("/"+strings.ReplaceAll(p, `\`, "/")), "/", `\`)
+}
+
+// windowsVolume returns the drive (C:) or share (\\server\share) of a path
+func windowsVolume(p string) string {
+	p = strings.ReplaceAll(p, "/", `\`)
+	if len(p) >= 2 && p[1] == ':' {
+		return p[:2]
+	}
+	if strings.HasPrefix(p, `\\`) {
+		parts := strings.SplitN(p[2:], `\`, 3)
+		if len(parts) >= 2 {
+			return `\\` + parts[0] + `\` + parts[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizePath(t *testing.T) {
+	longDir := strings.Repeat("d", 120)
+	tests := []struct {
+		name    string
+		goos    string
+		path    string
+		home    string
+		cwd     string
+		want    string
+		wantErr bool
+	}{
+		{"unix absolute", "linux", "/data/../data/export.csv", "/home/u", "/tmp", "/data/export.csv", false},
+		{"unix relative", "linux", "out/file.csv", "/home/u", "/work", "/work/out/file.csv", false},
+		{"unix home", "darwin", "~/exports/a.csv", "/Users/u", "/", "/Users/u/exports/a.csv", false},
+		{"unix bare home", "linux", "~", "/home/u", "/", "/home/u", false},
+		{"unix other user", "linux", "~bob/a.csv", "/home/u", "/w", "/w/~bob/a.csv", false},
+		{"unix non-utf8", "linux", "/data/caf\xe9.csv", "", "/", "/data/caf\xe9.csv", false},
+		{"empty", "linux", "", "", "/", "", true},
+		{"nul byte", "linux", "/data/a\x00b", "", "/", "", true},
+
+		{"windows drive", "windows", `C:\data\..\exports\a.csv`, "", `C:\`, `C:\exports\a.csv`, false},
+		{"windows forward slashes", "windows", "D:/exports/a.csv", "", `C:\`, `D:\exports\a.csv`, false},
+		{"windows relative", "windows", `out\a.csv`, "", `C:\work`, `C:\work\out\a.csv`, false},
+		{"windows rooted", "windows", `\exports\a.csv`, "", `E:\work`, `E:\exports\a.csv`, false},
+		{"windows home", "windows", `~\exports\a.csv`, `C:\Users\u`, `C:\`, `C:\Users\u\exports\a.csv`, false},
+		{"windows unc", "windows", `\\server\share\dir\..\a.csv`, "", `C:\`, `\\server\share\a.csv`, false},
+		{"windows verbatim", "windows", `\\?\C:\a\..\b.csv`, "", `C:\`, `\\?\C:\a\..\b.csv`, false},
+		{"windows drive relative", "windows", `C:a.csv`, "", `D:\`, `C:a.csv`, false},
+		{
+			"windows long", "windows", `C:\` + longDir + `\` + longDir + `\a.csv`, "", `C:\`,
+			`\\?\C:\` + longDir + `\` + longDir + `\a.csv`, false,
+		},
+		{
+			"windows long unc", "windows", `\\server\share\` + longDir + `\` + longDir + `\a.csv`, "", `C:\`,
+			`\\?\UNC\server\share\` + longDir + `\` + longDir + `\a.csv`, false,
+		},
+		{"windows non-utf8", "windows", "C:\\caf\xe9.csv", "", `C:\`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePath(tt.path, tt.goos, tt.home, tt.cwd)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// DefaultWatchInterval is how often a Watcher checks the config file
+const DefaultWatchInterval = 2 * time.Second
+
+// reloadableSettings are the settings an open session can pick up without
+// reconnecting. Anything else (host, credentials, SSL, ...) only applies to
+// new sessions.
+var reloadableSettings = map[string]bool{
+	"pageSize":       true,
+	"requestTimeout": true,
+	"connectTimeout": true,
+	"ai":             true,
+	"logFiles":       true,
+	"historyFile":    true,
+}
+
+// IsReloadable reports whether a setting returned by Diff can be applied to an
+// open session. Nested settings such as "ai.openai.model" follow their parent.
+func IsReloadable(setting string) bool {
+	root, _, _ := strings.Cut(setting, ".")
+	return reloadableSettings[root]
+}
+
+// Diff returns the settings that differ between two configs, as sorted JSON
+// paths such as "pageSize" or "ai.openai.model"
+func Diff(old, new *Config) []string {
+	before := flattenConfig(old)
+	after := flattenConfig(new)
+
+	var changed []string
+	for key, value := range after {
+		if prev, ok := before[key]; !ok || !reflect.DeepEqual(prev, value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// flattenConfig maps the JSON form of cfg to dotted paths
+func flattenConfig(cfg *Config) map[string]interface{} {
+	flat := make(map[string]interface{})
+	if cfg == nil {
+		return flat
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return flat
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return flat
+	}
+	var walk func(prefix string, node map[string]interface{})
+	walk = func(prefix string, node map[string]interface{}) {
+		for key, value := range node {
+			if child, ok := value.(map[string]interface{}); ok {
+				walk(prefix+key+".", child)
+				continue
+			}
+			flat[prefix+key] = value
+		}
+	}
+	walk("", tree)
+	return flat
+}
+
+// Watcher polls the active config file and reports changed settings. Polling
+// the file's size and modification time needs no platform-specific APIs and
+// also notices a config file created in a default location later on.
+type Watcher struct {
+	customPath string
+	interval   time.Duration
+	onChange   func(cfg *Config, changed []string, err error)
+
+	mu      sync.Mutex
+	path    string // Config file in use, empty when there is none
+	stamp   fileStamp
+	current *Config
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// fileStamp identifies a version of the config file
+type fileStamp struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// WatchConfig starts watching the config file LoadConfig would read for
+// customConfigPath. onChange is called from the watcher goroutine with the
+// reloaded config and the settings that changed, or with the error when the
+// changed file cannot be loaded; the previous config then stays current.
+func WatchConfig(customConfigPath string, interval time.Duration, onChange func(cfg *Config, changed []string, err error)) (*Watcher, error) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	current, err := LoadConfig(customConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		customPath: customConfigPath,
+		interval:   interval,
+		onChange:   onChange,
+		current:    current,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	w.stamp = w.currentStamp()
+	w.path = w.stamp.path
+
+	go w.run()
+	return w, nil
+}
+
+// Path returns the config file being watched, or "" when none exists yet
+func (w *Watcher) Path() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.path
+}
+
+// Config returns the config as of the last successful reload
+func (w *Watcher) Config() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Stop stops watching and waits for a reload in progress to finish
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check reloads the config when the file changed since the last check
+func (w *Watcher) check() {
+	stamp := w.currentStamp()
+
+	w.mu.Lock()
+	unchanged := stamp == w.stamp
+	w.stamp = stamp
+	w.path = stamp.path
+	previous := w.current
+	w.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	cfg, err := LoadConfig(w.customPath)
+	if err != nil {
+		logger.DebugfToFile("Config", "Reloading %s failed: %v", stamp.path, err)
+		w.onChange(nil, nil, err)
+		return
+	}
+
+	changed := Diff(previous, cfg)
+	w.mu.Lock()
+	w.current = cfg
+	w.mu.Unlock()
+	if len(changed) > 0 {
+		logger.DebugfToFile("Config", "Reloaded %s, changed: %v", stamp.path, changed)
+		w.onChange(cfg, changed, nil)
+	}
+}
+
+// currentStamp describes the config file LoadConfig would read right now
+func (w *Watcher) currentStamp() fileStamp {
+	path := FindConfigFile(w.customPath)
+	if path == "" {
+		return fileStamp{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{path: path}
+	}
+	return fileStamp{path: path, modTime: info.ModTime(), size: info.Size()}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{Host: "db1", PageSize: 100, AI: &AIConfig{Provider: "openai", OpenAI: &AIProviderConfig{Model: "a"}}}
+	updated := &Config{Host: "db1", PageSize: 500, AI: &AIConfig{Provider: "openai", OpenAI: &AIProviderConfig{Model: "b"}}, RequestTimeout: 30}
+
+	changed := Diff(old, updated)
+	want := []string{"ai.openai.model", "pageSize", "requestTimeout"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Fatalf("Diff() = %v, want %v", changed, want)
+	}
+	if changed := Diff(old, old); len(changed) != 0 {
+		t.Errorf("Diff() of identical configs = %v, want none", changed)
+	}
+
+	for setting, want := range map[string]bool{
+		"pageSize":        true,
+		"ai.openai.model": true,
+		"host":            false,
+		"ssl.enabled":     false,
+	} {
+		if got := IsReloadable(setting); got != want {
+			t.Errorf("IsReloadable(%q) = %v, want %v", setting, got, want)
+		}
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	configPath := filepath.Join(tmpDir, "cqlai.json")
+	if err := os.WriteFile(configPath, []byte(`{"host": "db1", "pageSize": 100}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type reload struct {
+		cfg     *Config
+		changed []string
+	}
+	reloads := make(chan reload, 1)
+	w, err := WatchConfig(configPath, 10*time.Millisecond, func(cfg *Config, changed []string, err error) {
+		if err != nil {
+			t.Errorf("unexpected reload error: %v", err)
+			return
+		}
+		reloads <- reload{cfg, changed}
+	})
+	if err != nil {
+		t.Fatalf("WatchConfig() error = %v", err)
+	}
+	defer w.Stop()
+
+	if w.Path() != configPath {
+		t.Errorf("Path() = %q, want %q", w.Path(), configPath)
+	}
+
+	if err := os.WriteFile(configPath, []byte(`{"host": "db1", "pageSize": 2500}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-reloads:
+		if !reflect.DeepEqual(r.changed, []string{"pageSize"}) {
+			t.Errorf("changed = %v, want [pageSize]", r.changed)
+		}
+		if r.cfg.PageSize != 2500 {
+			t.Errorf("reloaded pageSize = %d, want 2500", r.cfg.PageSize)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("config change was not reported")
+	}
+
+	if w.Config().PageSize != 2500 {
+		t.Errorf("Config().PageSize = %d, want 2500", w.Config().PageSize)
+	}
+}
@@ -0,0 +1,258 @@
+package cql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// SelectAnalysis describes the clauses of a SELECT statement
+type SelectAnalysis struct {
+	Keyspace          string   `json:"keyspace,omitempty"`
+	Table             string   `json:"table"`
+	SelectList        string   `json:"selectList"`
+	Distinct          bool     `json:"distinct,omitempty"`
+	JSON              bool     `json:"json,omitempty"`
+	Where             string   `json:"where,omitempty"`
+	GroupBy           []string `json:"groupBy,omitempty"`
+	OrderBy           string   `json:"orderBy,omitempty"`
+	PerPartitionLimit int      `json:"perPartitionLimit,omitempty"`
+	Limit             int      `json:"limit,omitempty"`
+	AllowFiltering    bool     `json:"allowFiltering,omitempty"`
+	HasAggregates     bool     `json:"hasAggregates,omitempty"`
+
+	// ScyllaDB extensions
+	BypassCache bool   `json:"bypassCache,omitempty"` // BYPASS CACHE
+	Timeout     string `json:"timeout,omitempty"`     // USING TIMEOUT duration, e.g. 500ms
+}
+
+// clauseKeywords start the clauses that may follow the table name in a SELECT
+var clauseKeywords = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "PER": true, "LIMIT": true, "ALLOW": true,
+	"BYPASS": true, "USING": true,
+}
+
+// AnalyzeSelect parses the clauses of a single SELECT statement. It is a
+// shallow, token-based parse intended for inspecting queries (e.g. to detect
+// PER PARTITION LIMIT and GROUP BY), not a full CQL grammar.
+func AnalyzeSelect(query string) (*SelectAnalysis, error) {
+	tokens, err := batch.Lex(query)
+	if err != nil {
+		return nil, err
+	}
+	// Drop a trailing semicolon
+	if n := len(tokens); n > 0 && tokens[n-1].Type == batch.TokenEndtoken {
+		tokens = tokens[:n-1]
+	}
+	if len(tokens) == 0 || !strings.EqualFold(tokens[0].Value, "SELECT") {
+		return nil, fmt.Errorf("not a SELECT statement")
+	}
+
+	a := &SelectAnalysis{}
+	pos := 1
+
+	if pos < len(tokens) && strings.EqualFold(tokens[pos].Value, "JSON") && tokens[pos].Type == batch.TokenIdentifier {
+		a.JSON = true
+		pos++
+	}
+	if pos < len(tokens) && strings.EqualFold(tokens[pos].Value, "DISTINCT") && tokens[pos].Type == batch.TokenIdentifier {
+		a.Distinct = true
+		pos++
+	}
+
+	// Select list runs until a top-level FROM
+	fromIdx := -1
+	depth := 0
+	for i := pos; i < len(tokens); i++ {
+		switch tokens[i].Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && tokens[i].Type == batch.TokenIdentifier && strings.EqualFold(tokens[i].Value, "FROM") {
+			fromIdx = i
+			break
+		}
+	}
+	if fromIdx < 0 || fromIdx == pos {
+		return nil, fmt.Errorf("SELECT is missing a FROM clause")
+	}
+	a.SelectList = strings.TrimSpace(query[tokens[pos].Start:tokens[fromIdx-1].End])
+	for i := pos; i < fromIdx-1; i++ {
+		if tokens[i+1].Value == "(" && supportedAggregates[strings.ToLower(tokens[i].Value)] {
+			a.HasAggregates = true
+		}
+	}
+
+	// Table name: name or keyspace.name
+	pos = fromIdx + 1
+	if pos >= len(tokens) {
+		return nil, fmt.Errorf("SELECT is missing a table name")
+	}
+	first := unquoteName(tokens[pos])
+	pos++
+	if pos+1 < len(tokens) && tokens[pos].Value == "." {
+		a.Keyspace = first
+		a.Table = unquoteName(tokens[pos+1])
+		pos += 2
+	} else {
+		a.Table = first
+	}
+
+	// Remaining clauses
+	for pos < len(tokens) {
+		kw := strings.ToUpper(tokens[pos].Value)
+		switch {
+		case kw == "WHERE":
+			end := nextClause(tokens, pos+1)
+			if end > pos+1 {
+				a.Where = strings.TrimSpace(query[tokens[pos+1].Start:tokens[end-1].End])
+			}
+			pos = end
+		case kw == "GROUP" && isKeyword(tokens, pos+1, "BY"):
+			end := nextClause(tokens, pos+2)
+			for i := pos + 2; i < end; i++ {
+				if tokens[i].Value != "," {
+					a.GroupBy = append(a.GroupBy, unquoteName(tokens[i]))
+				}
+			}
+			pos = end
+		case kw == "ORDER" && isKeyword(tokens, pos+1, "BY"):
+			end := nextClause(tokens, pos+2)
+			if end > pos+2 {
+				a.OrderBy = strings.TrimSpace(query[tokens[pos+2].Start:tokens[end-1].End])
+			}
+			pos = end
+		case kw == "PER" && isKeyword(tokens, pos+1, "PARTITION") && isKeyword(tokens, pos+2, "LIMIT"):
+			if pos+3 >= len(tokens) {
+				return nil, fmt.Errorf("PER PARTITION LIMIT is missing a value")
+			}
+			a.PerPartitionLimit, _ = strconv.Atoi(tokens[pos+3].Value)
+			pos += 4
+		case kw == "LIMIT":
+			if pos+1 >= len(tokens) {
+				return nil, fmt.Errorf("LIMIT is missing a value")
+			}
+			a.Limit, _ = strconv.Atoi(tokens[pos+1].Value)
+			pos += 2
+		case kw == "ALLOW" && isKeyword(tokens, pos+1, "FILTERING"):
+			a.AllowFiltering = true
+			pos += 2
+		case kw == "BYPASS" && isKeyword(tokens, pos+1, "CACHE"):
+			a.BypassCache = true
+			pos += 2
+		case kw == "USING" && isKeyword(tokens, pos+1, "TIMEOUT"):
+			end := durationEnd(tokens, pos+2)
+			if end == pos+2 {
+				return nil, fmt.Errorf("USING TIMEOUT is missing a duration")
+			}
+			a.Timeout = query[tokens[pos+2].Start:tokens[end-1].End]
+			pos = end
+		default:
+			pos++
+		}
+	}
+
+	return a, nil
+}
+
+// nextClause returns the index of the next clause keyword at or after start
+func nextClause(tokens []batch.Token, start int) int {
+	for i := start; i < len(tokens); i++ {
+		if tokens[i].Type != batch.TokenIdentifier {
+			continue
+		}
+		kw := strings.ToUpper(tokens[i].Value)
+		if !clauseKeywords[kw] {
+			continue
+		}
+		// GROUP/ORDER/PER/ALLOW only start a clause when followed by their partner keyword
+		switch kw {
+		case "GROUP", "ORDER":
+			if !isKeyword(tokens, i+1, "BY") {
+				continue
+			}
+		case "PER":
+			if !isKeyword(tokens, i+1, "PARTITION") {
+				continue
+			}
+		case "ALLOW":
+			if !isKeyword(tokens, i+1, "FILTERING") {
+				continue
+			}
+		case "BYPASS":
+			if !isKeyword(tokens, i+1, "CACHE") {
+				continue
+			}
+		case "USING":
+			if !isKeyword(tokens, i+1, "TIMEOUT") {
+				continue
+			}
+		}
+		return i
+	}
+	return len(tokens)
+}
+
+// durationEnd returns the index after the duration literal (500ms, 1h30m)
+// starting at tokens[start]. The lexer splits a duration into adjacent number
+// and unit tokens, so the literal runs until the first gap.
+func durationEnd(tokens []batch.Token, start int) int {
+	if start >= len(tokens) {
+		return start
+	}
+	end := start + 1
+	for end < len(tokens) && tokens[end].Start == tokens[end-1].End &&
+		(tokens[end].Type == batch.TokenIdentifier || tokens[end].Type == batch.TokenWholenumber) {
+		end++
+	}
+	return end
+}
+
+// isKeyword reports whether tokens[i] is the given keyword
+func isKeyword(tokens []batch.Token, i int, keyword string) bool {
+	return i < len(tokens) && tokens[i].Type == batch.TokenIdentifier && strings.EqualFold(tokens[i].Value, keyword)
+}
+
+// unquoteName returns the identifier as stored in the schema: quoted names
+// keep their case, unquoted names are lowercased
+func unquoteName(tok batch.Token) string {
+	if tok.Type == batch.TokenQuotedName {
+		return strings.ReplaceAll(tok.Value[1:len(tok.Value)-1], `""`, `"`)
+	}
+	return strings.ToLower(tok.Value)
+}
+
+// SplitConditions splits a WHERE clause into its top-level AND-ed conditions
+func SplitConditions(where string) []string {
+	tokens, err := batch.Lex(where)
+	if err != nil || len(tokens) == 0 {
+		if strings.TrimSpace(where) == "" {
+			return nil
+		}
+		return []string{strings.TrimSpace(where)}
+	}
+
+	var conditions []string
+	start := 0
+	depth := 0
+	for i, tok := range tokens {
+		switch tok.Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && tok.Type == batch.TokenIdentifier && strings.EqualFold(tok.Value, "AND") && i > start {
+			conditions = append(conditions, strings.TrimSpace(where[tokens[start].Start:tokens[i-1].End]))
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		conditions = append(conditions, strings.TrimSpace(where[tokens[start].Start:tokens[len(tokens)-1].End]))
+	}
+	return conditions
+}
@@ -0,0 +1,305 @@
+package cql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TableKeys describes a table's primary key layout
+type TableKeys struct {
+	PartitionKey      []string
+	ClusteringColumns []string
+}
+
+// Features describes which optional SELECT clauses the server supports
+type Features struct {
+	PerPartitionLimit bool // Cassandra 3.6+
+	GroupBy           bool // Cassandra 3.10+
+	Scylla            bool // ScyllaDB: BYPASS CACHE and USING TIMEOUT
+}
+
+// Aggregate is an aggregate function applied to a column
+type Aggregate struct {
+	Function string `json:"function"` // count, min, max, sum, avg
+	Column   string `json:"column"`   // Column name, or * for count(*)
+	Alias    string `json:"alias,omitempty"`
+}
+
+// SelectSpec describes a SELECT to build
+type SelectSpec struct {
+	Keyspace          string      `json:"keyspace"`
+	Table             string      `json:"table"`
+	Columns           []string    `json:"columns,omitempty"`    // Plain columns to select (default * when no aggregates)
+	Where             []string    `json:"where,omitempty"`      // CQL conditions, joined with AND
+	GroupBy           []string    `json:"groupBy,omitempty"`    // Columns to group by
+	Aggregates        []Aggregate `json:"aggregates,omitempty"` // Aggregates computed per group
+	PerPartitionLimit int         `json:"perPartitionLimit,omitempty"`
+	Limit             int         `json:"limit,omitempty"`
+	AllowFiltering    bool        `json:"allowFiltering,omitempty"`
+	BypassCache       bool        `json:"bypassCache,omitempty"` // ScyllaDB only
+	Timeout           string      `json:"timeout,omitempty"`     // USING TIMEOUT duration, e.g. 500ms (ScyllaDB only)
+}
+
+// BuildResult is a generated SELECT plus what could not be expressed in CQL
+type BuildResult struct {
+	Query                       string      `json:"query"`
+	GroupByPushedDown           bool        `json:"groupByPushedDown"`
+	PerPartitionLimitPushedDown bool        `json:"perPartitionLimitPushedDown"`
+	ClientSideGroupBy           []string    `json:"clientSideGroupBy,omitempty"`    // Grouping the caller must apply to the returned rows
+	ClientSideAggregates        []Aggregate `json:"clientSideAggregates,omitempty"` // Aggregates the caller must compute per group
+	ClientSidePerPartitionLimit int         `json:"clientSidePerPartitionLimit,omitempty"`
+	Warnings                    []string    `json:"warnings,omitempty"`
+}
+
+var supportedAggregates = map[string]bool{
+	"count": true,
+	"min":   true,
+	"max":   true,
+	"sum":   true,
+	"avg":   true,
+}
+
+// equalityCondition matches a single-column equality restriction such as
+// `id = ?`, `"Name" = 'x'` or `bucket=3`
+var equalityCondition = regexp.MustCompile(`^\s*("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)\s*=\s*[^=]`)
+
+// timeoutDuration matches a USING TIMEOUT duration such as 500ms or 1m30s
+var timeoutDuration = regexp.MustCompile(`^(?i)(\d+(h|ms|m|us|µs|ns|s))+$`)
+
+// inCondition matches a single-column IN restriction such as `id IN (1, 2)`
+var inCondition = regexp.MustCompile(`(?i)^\s*("(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_]*)\s+IN\s*\(`)
+
+// equalityRestricted returns the columns restricted by equality in the WHERE conditions
+func equalityRestricted(where []string) map[string]bool {
+	return restrictedColumns(where, equalityCondition)
+}
+
+// restrictedColumns returns the columns of the WHERE conditions matching any of the patterns
+func restrictedColumns(where []string, patterns ...*regexp.Regexp) map[string]bool {
+	restricted := make(map[string]bool)
+	for _, cond := range where {
+		for _, pattern := range patterns {
+			m := pattern.FindStringSubmatch(cond)
+			if m == nil {
+				continue
+			}
+			name := m[1]
+			if strings.HasPrefix(name, `"`) {
+				name = strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+			} else {
+				name = strings.ToLower(name)
+			}
+			restricted[name] = true
+			break
+		}
+	}
+	return restricted
+}
+
+// RestrictsPartitionKey reports whether the WHERE conditions restrict every
+// partition key column with = or IN, so the query reads known partitions
+// instead of scanning the token ring. token() ranges count as a scan.
+func RestrictsPartitionKey(where []string, keys TableKeys) bool {
+	if len(keys.PartitionKey) == 0 {
+		return false
+	}
+	restricted := restrictedColumns(where, equalityCondition, inCondition)
+	for _, col := range keys.PartitionKey {
+		if !restricted[col] {
+			return false
+		}
+	}
+	return true
+}
+
+// CanPushDownGroupBy reports whether GROUP BY on the given columns is valid
+// CQL for the table. Cassandra only groups at partition or clustering level:
+// the columns must follow primary key order, must cover the whole partition
+// key, and may only skip key columns restricted by equality in the WHERE
+// clause. The returned reason explains a rejection.
+func CanPushDownGroupBy(groupBy []string, keys TableKeys, where []string) (bool, string) {
+	if len(groupBy) == 0 {
+		return false, "no GROUP BY columns"
+	}
+
+	restricted := equalityRestricted(where)
+	keyCols := append(append([]string{}, keys.PartitionKey...), keys.ClusteringColumns...)
+
+	next := 0
+	for i, col := range keyCols {
+		if next < len(groupBy) && groupBy[next] == col {
+			next++
+			continue
+		}
+		if next == len(groupBy) && i >= len(keys.PartitionKey) {
+			break
+		}
+		if restricted[col] {
+			continue
+		}
+		if i < len(keys.PartitionKey) {
+			return false, fmt.Sprintf("GROUP BY must include partition key column %s (or restrict it with =)", col)
+		}
+		break
+	}
+
+	if next < len(groupBy) {
+		return false, fmt.Sprintf("GROUP BY column %s is not the next primary key column in order", groupBy[next])
+	}
+	return true, ""
+}
+
+// BuildSelect generates a SELECT for the spec, pushing PER PARTITION LIMIT and
+// GROUP BY down to the server where the table layout and server version allow.
+// When they cannot be pushed down the query selects the raw columns instead and
+// the result lists the grouping, aggregates or limit the caller must apply.
+func BuildSelect(spec SelectSpec, keys TableKeys, features Features) (*BuildResult, error) {
+	if spec.Table == "" {
+		return nil, fmt.Errorf("table is required")
+	}
+	for _, agg := range spec.Aggregates {
+		if !supportedAggregates[strings.ToLower(agg.Function)] {
+			return nil, fmt.Errorf("unsupported aggregate function %q", agg.Function)
+		}
+		if agg.Column == "" {
+			return nil, fmt.Errorf("aggregate %s requires a column", agg.Function)
+		}
+	}
+
+	if spec.Timeout != "" && !timeoutDuration.MatchString(spec.Timeout) {
+		return nil, fmt.Errorf("invalid timeout %q; use a duration such as 500ms or 2s", spec.Timeout)
+	}
+
+	result := &BuildResult{}
+
+	pushGroupBy := false
+	if len(spec.GroupBy) > 0 {
+		ok, reason := CanPushDownGroupBy(spec.GroupBy, keys, spec.Where)
+		switch {
+		case !features.GroupBy:
+			result.Warnings = append(result.Warnings, "GROUP BY requires Cassandra 3.10 or later; grouping must be done client-side")
+		case !ok:
+			result.Warnings = append(result.Warnings, reason+"; grouping must be done client-side")
+		default:
+			pushGroupBy = true
+		}
+	}
+	result.GroupByPushedDown = pushGroupBy
+
+	// Select list
+	selectList := make([]string, 0, len(spec.GroupBy)+len(spec.Columns)+len(spec.Aggregates))
+	seen := make(map[string]bool)
+	addColumn := func(col string) {
+		if !seen[col] {
+			seen[col] = true
+			selectList = append(selectList, QuoteIdentifier(col))
+		}
+	}
+	for _, col := range spec.GroupBy {
+		addColumn(col)
+	}
+	for _, col := range spec.Columns {
+		addColumn(col)
+	}
+
+	clientSide := len(spec.GroupBy) > 0 && !pushGroupBy
+	for _, agg := range spec.Aggregates {
+		if clientSide {
+			// Fetch the raw values so the caller can aggregate per group
+			if agg.Column != "*" {
+				addColumn(agg.Column)
+			}
+			result.ClientSideAggregates = append(result.ClientSideAggregates, agg)
+			continue
+		}
+		expr := fmt.Sprintf("%s(%s)", strings.ToLower(agg.Function), aggregateArg(agg.Column))
+		if agg.Alias != "" {
+			expr += " AS " + QuoteIdentifier(agg.Alias)
+		}
+		selectList = append(selectList, expr)
+	}
+	if clientSide {
+		result.ClientSideGroupBy = append([]string{}, spec.GroupBy...)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if len(selectList) == 0 {
+		sb.WriteString("*")
+	} else {
+		sb.WriteString(strings.Join(selectList, ", "))
+	}
+	sb.WriteString(" FROM ")
+	if spec.Keyspace != "" {
+		sb.WriteString(QuoteIdentifier(spec.Keyspace))
+		sb.WriteString(".")
+	}
+	sb.WriteString(QuoteIdentifier(spec.Table))
+
+	if len(spec.Where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(spec.Where, " AND "))
+	}
+
+	if pushGroupBy {
+		cols := make([]string, len(spec.GroupBy))
+		for i, col := range spec.GroupBy {
+			cols[i] = QuoteIdentifier(col)
+		}
+		sb.WriteString(" GROUP BY ")
+		sb.WriteString(strings.Join(cols, ", "))
+	}
+
+	if spec.PerPartitionLimit > 0 {
+		if features.PerPartitionLimit {
+			sb.WriteString(fmt.Sprintf(" PER PARTITION LIMIT %d", spec.PerPartitionLimit))
+			result.PerPartitionLimitPushedDown = true
+		} else {
+			result.ClientSidePerPartitionLimit = spec.PerPartitionLimit
+			result.Warnings = append(result.Warnings, "PER PARTITION LIMIT requires Cassandra 3.6 or later; the limit must be applied client-side")
+		}
+	}
+
+	if spec.Limit > 0 {
+		// A row LIMIT would cut rows before client-side grouping or
+		// per-partition limiting, so only apply it when fully pushed down
+		if clientSide || result.ClientSidePerPartitionLimit > 0 {
+			result.Warnings = append(result.Warnings, "LIMIT applies to the final result and must be applied client-side")
+		} else {
+			sb.WriteString(fmt.Sprintf(" LIMIT %d", spec.Limit))
+		}
+	}
+
+	if spec.AllowFiltering {
+		sb.WriteString(" ALLOW FILTERING")
+	}
+
+	// ScyllaDB clauses are left out for Cassandra, which rejects them; neither
+	// changes the rows returned
+	if spec.BypassCache {
+		if features.Scylla {
+			sb.WriteString(" BYPASS CACHE")
+		} else {
+			result.Warnings = append(result.Warnings, "BYPASS CACHE is only supported by ScyllaDB and was left out")
+		}
+	}
+	if spec.Timeout != "" {
+		if features.Scylla {
+			sb.WriteString(" USING TIMEOUT " + spec.Timeout)
+		} else {
+			result.Warnings = append(result.Warnings, "USING TIMEOUT is only supported by ScyllaDB and was left out")
+		}
+	}
+
+	result.Query = sb.String()
+	return result, nil
+}
+
+// aggregateArg formats the argument of an aggregate function
+func aggregateArg(column string) string {
+	if column == "*" {
+		return "*"
+	}
+	return QuoteIdentifier(column)
+}
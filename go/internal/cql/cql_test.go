@@ -0,0 +1,565 @@
+package cql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var eventsKeys = TableKeys{
+	PartitionKey:      []string{"tenant", "bucket"},
+	ClusteringColumns: []string{"day", "ts", "id"},
+}
+
+func TestCanPushDownGroupBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		groupBy []string
+		where   []string
+		want    bool
+	}{
+		{"full partition key", []string{"tenant", "bucket"}, nil, true},
+		{"partition key and clustering prefix", []string{"tenant", "bucket", "day"}, nil, true},
+		{"all key columns", []string{"tenant", "bucket", "day", "ts", "id"}, nil, true},
+		{"partial partition key", []string{"tenant"}, nil, false},
+		{"partial partition key restricted", []string{"tenant"}, []string{"bucket = 3"}, true},
+		{"skip restricted clustering column", []string{"tenant", "bucket", "ts"}, []string{"day = '2024-01-01'"}, true},
+		{"skip unrestricted clustering column", []string{"tenant", "bucket", "ts"}, nil, false},
+		{"range is not equality", []string{"tenant", "bucket", "ts"}, []string{"day >= '2024-01-01'"}, false},
+		{"out of order", []string{"bucket", "tenant"}, nil, false},
+		{"regular column", []string{"tenant", "bucket", "payload"}, nil, false},
+		{"empty", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := CanPushDownGroupBy(tt.groupBy, eventsKeys, tt.where)
+			if got != tt.want {
+				t.Errorf("CanPushDownGroupBy(%v, %v) = %v (%s), want %v", tt.groupBy, tt.where, got, reason, tt.want)
+			}
+			if !got && reason == "" {
+				t.Errorf("expected a reason for rejection")
+			}
+		})
+	}
+}
+
+func TestRestrictsPartitionKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		where string
+		want  bool
+	}{
+		{"no where clause", "", false},
+		{"full partition key", "tenant = 'a' AND bucket = 3", true},
+		{"in restriction", "tenant = 'a' AND bucket IN (1, 2, 3)", true},
+		{"lowercase in", "tenant in ('a', 'b') and bucket = 1", true},
+		{"partial partition key", "tenant = 'a'", false},
+		{"clustering only", "day = '2024-01-01'", false},
+		{"token range", "token(tenant, bucket) > 0", false},
+		{"range on partition key", "tenant = 'a' AND bucket > 3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RestrictsPartitionKey(SplitConditions(tt.where), eventsKeys); got != tt.want {
+				t.Errorf("RestrictsPartitionKey(%q) = %v, want %v", tt.where, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSelect(t *testing.T) {
+	all := Features{PerPartitionLimit: true, GroupBy: true}
+
+	tests := []struct {
+		name       string
+		spec       SelectSpec
+		features   Features
+		wantQuery  string
+		wantPushed bool
+		wantClient []string
+		warnings   int
+	}{
+		{
+			name:       "group by pushed down",
+			spec:       SelectSpec{Keyspace: "app", Table: "events", GroupBy: []string{"tenant", "bucket"}, Aggregates: []Aggregate{{Function: "count", Column: "*", Alias: "n"}}},
+			features:   all,
+			wantQuery:  "SELECT tenant, bucket, count(*) AS n FROM app.events GROUP BY tenant, bucket",
+			wantPushed: true,
+		},
+		{
+			name:       "group by on regular column falls back",
+			spec:       SelectSpec{Table: "events", GroupBy: []string{"payload"}, Aggregates: []Aggregate{{Function: "max", Column: "ts"}}, Limit: 10},
+			features:   all,
+			wantQuery:  "SELECT payload, ts FROM events",
+			wantClient: []string{"payload"},
+			warnings:   2,
+		},
+		{
+			name:      "per partition limit",
+			spec:      SelectSpec{Table: "events", Where: []string{"tenant = 'a'"}, PerPartitionLimit: 5, Limit: 100, AllowFiltering: true},
+			features:  all,
+			wantQuery: "SELECT * FROM events WHERE tenant = 'a' PER PARTITION LIMIT 5 LIMIT 100 ALLOW FILTERING",
+		},
+		{
+			name:      "per partition limit unsupported",
+			spec:      SelectSpec{Table: "events", PerPartitionLimit: 5},
+			features:  Features{},
+			wantQuery: "SELECT * FROM events",
+			warnings:  1,
+		},
+		{
+			name:       "group by unsupported by server",
+			spec:       SelectSpec{Table: "events", GroupBy: []string{"tenant", "bucket"}},
+			features:   Features{PerPartitionLimit: true},
+			wantQuery:  "SELECT tenant, bucket FROM events",
+			wantClient: []string{"tenant", "bucket"},
+			warnings:   1,
+		},
+		{
+			name:      "quoted identifiers",
+			spec:      SelectSpec{Keyspace: "App", Table: "Events", Columns: []string{"Name", "select"}},
+			features:  all,
+			wantQuery: `SELECT "Name", "select" FROM "App"."Events"`,
+		},
+		{
+			name:      "scylla clauses",
+			spec:      SelectSpec{Table: "events", Limit: 10, BypassCache: true, Timeout: "500ms"},
+			features:  Features{PerPartitionLimit: true, GroupBy: true, Scylla: true},
+			wantQuery: "SELECT * FROM events LIMIT 10 BYPASS CACHE USING TIMEOUT 500ms",
+		},
+		{
+			name:      "scylla clauses left out on cassandra",
+			spec:      SelectSpec{Table: "events", BypassCache: true, Timeout: "2s"},
+			features:  all,
+			wantQuery: "SELECT * FROM events",
+			warnings:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := BuildSelect(tt.spec, eventsKeys, tt.features)
+			if err != nil {
+				t.Fatalf("BuildSelect failed: %v", err)
+			}
+			if result.Query != tt.wantQuery {
+				t.Errorf("Query = %q, want %q", result.Query, tt.wantQuery)
+			}
+			if result.GroupByPushedDown != tt.wantPushed {
+				t.Errorf("GroupByPushedDown = %v, want %v", result.GroupByPushedDown, tt.wantPushed)
+			}
+			if !reflect.DeepEqual(result.ClientSideGroupBy, tt.wantClient) {
+				t.Errorf("ClientSideGroupBy = %v, want %v", result.ClientSideGroupBy, tt.wantClient)
+			}
+			if len(result.Warnings) != tt.warnings {
+				t.Errorf("Warnings = %v, want %d", result.Warnings, tt.warnings)
+			}
+		})
+	}
+
+	if _, err := BuildSelect(SelectSpec{Table: "events", Aggregates: []Aggregate{{Function: "median", Column: "ts"}}}, eventsKeys, all); err == nil {
+		t.Errorf("expected error for unsupported aggregate")
+	}
+	if _, err := BuildSelect(SelectSpec{Table: "events", Timeout: "1; DROP TABLE x"}, eventsKeys, all); err == nil {
+		t.Errorf("expected error for invalid timeout")
+	}
+}
+
+func TestAnalyzeSelect(t *testing.T) {
+	query := `SELECT tenant, bucket, count(*) FROM app."Events" WHERE tenant = 'a;b' AND bucket IN (1, 2) GROUP BY tenant, bucket PER PARTITION LIMIT 3 LIMIT 50 ALLOW FILTERING;`
+
+	a, err := AnalyzeSelect(query)
+	if err != nil {
+		t.Fatalf("AnalyzeSelect failed: %v", err)
+	}
+	if a.Keyspace != "app" || a.Table != "Events" {
+		t.Errorf("table = %s.%s, want app.Events", a.Keyspace, a.Table)
+	}
+	if a.SelectList != "tenant, bucket, count(*)" {
+		t.Errorf("SelectList = %q", a.SelectList)
+	}
+	if !a.HasAggregates {
+		t.Errorf("expected HasAggregates")
+	}
+	if a.Where != "tenant = 'a;b' AND bucket IN (1, 2)" {
+		t.Errorf("Where = %q", a.Where)
+	}
+	if !reflect.DeepEqual(a.GroupBy, []string{"tenant", "bucket"}) {
+		t.Errorf("GroupBy = %v", a.GroupBy)
+	}
+	if a.PerPartitionLimit != 3 || a.Limit != 50 || !a.AllowFiltering {
+		t.Errorf("PerPartitionLimit=%d Limit=%d AllowFiltering=%v", a.PerPartitionLimit, a.Limit, a.AllowFiltering)
+	}
+
+	conds := SplitConditions(a.Where)
+	if !reflect.DeepEqual(conds, []string{"tenant = 'a;b'", "bucket IN (1, 2)"}) {
+		t.Errorf("SplitConditions = %v", conds)
+	}
+
+	if _, err := AnalyzeSelect("INSERT INTO t (a) VALUES (1)"); err == nil {
+		t.Errorf("expected error for non-SELECT")
+	}
+
+	simple, err := AnalyzeSelect("select json distinct id from users")
+	if err != nil {
+		t.Fatalf("AnalyzeSelect failed: %v", err)
+	}
+	if !simple.JSON || !simple.Distinct || simple.Table != "users" || strings.TrimSpace(simple.SelectList) != "id" {
+		t.Errorf("unexpected analysis: %+v", simple)
+	}
+
+	// ScyllaDB clauses end the WHERE clause instead of becoming conditions
+	scylla, err := AnalyzeSelect("SELECT * FROM ks.t WHERE id = 1 BYPASS CACHE USING TIMEOUT 1m30s")
+	if err != nil {
+		t.Fatalf("AnalyzeSelect failed: %v", err)
+	}
+	if scylla.Where != "id = 1" || !scylla.BypassCache || scylla.Timeout != "1m30s" {
+		t.Errorf("unexpected analysis: %+v", scylla)
+	}
+}
+
+func TestSplitInClause(t *testing.T) {
+	split := SplitInClause(`SELECT * FROM ks.users WHERE tenant = 'a' AND id IN (1, 2, 3, 4, 5) AND kind IN ('x', 'y') ALLOW FILTERING;`, 2)
+	want := []string{
+		`SELECT * FROM ks.users WHERE tenant = 'a' AND id IN (1, 2) AND kind IN ('x', 'y') ALLOW FILTERING;`,
+		`SELECT * FROM ks.users WHERE tenant = 'a' AND id IN (3, 4) AND kind IN ('x', 'y') ALLOW FILTERING;`,
+		`SELECT * FROM ks.users WHERE tenant = 'a' AND id IN (5) AND kind IN ('x', 'y') ALLOW FILTERING;`,
+	}
+	if split == nil || split.Column != "id" || split.Values != 5 || !reflect.DeepEqual(split.Statements, want) {
+		t.Errorf("unexpected split: %+v", split)
+	}
+
+	tuples := SplitInClause(`SELECT a FROM t WHERE k = 1 AND (c1, c2) IN ((1, 'a'), (2, 'b'), (3, 'c'))`, 2)
+	if tuples == nil || tuples.Column != "(c1, c2)" || len(tuples.Statements) != 2 ||
+		tuples.Statements[1] != `SELECT a FROM t WHERE k = 1 AND (c1, c2) IN ((3, 'c'))` {
+		t.Errorf("unexpected tuple split: %+v", tuples)
+	}
+
+	for _, query := range []string{
+		"SELECT * FROM t WHERE id IN (1, 2)",
+		"SELECT * FROM t WHERE id IN (1, 2, 3) LIMIT 10",
+		"SELECT * FROM t WHERE id IN (1, 2, 3) ORDER BY c DESC",
+		"SELECT count(*) FROM t WHERE id IN (1, 2, 3)",
+		"SELECT * FROM t WHERE id IN (1, :b, 3)",
+		"SELECT * FROM t",
+	} {
+		if split := SplitInClause(query, 2); split != nil {
+			t.Errorf("%s: expected no split, got %+v", query, split)
+		}
+	}
+}
+
+func TestParseDDL(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want *DDLStatement
+	}{
+		{
+			"CREATE TABLE IF NOT EXISTS app.\"Events\" (id int PRIMARY KEY);",
+			&DDLStatement{Action: "CREATE", Kind: KindTable, Keyspace: "app", Name: "Events", IfExists: true},
+		},
+		{
+			"drop keyspace Shop",
+			&DDLStatement{Action: "DROP", Kind: KindKeyspace, Name: "shop"},
+		},
+		{
+			"CREATE INDEX ON app.users (keys(tags))",
+			&DDLStatement{Action: "CREATE", Kind: KindIndex, Keyspace: "app", Name: "users_tags_idx", Table: "users"},
+		},
+		{
+			"CREATE CUSTOM INDEX by_name ON users (name) USING 'StorageAttachedIndex'",
+			&DDLStatement{Action: "CREATE", Kind: KindIndex, Name: "by_name", Table: "users"},
+		},
+		{
+			"CREATE MATERIALIZED VIEW app.by_email AS SELECT * FROM users WHERE email IS NOT NULL AND id IS NOT NULL PRIMARY KEY (email, id)",
+			&DDLStatement{Action: "CREATE", Kind: KindView, Keyspace: "app", Name: "by_email"},
+		},
+		{
+			"CREATE OR REPLACE FUNCTION app.fmt(a int, b frozen<map<text, int>>) RETURNS NULL ON NULL INPUT RETURNS text LANGUAGE java AS $$ return \"x\"; $$",
+			&DDLStatement{Action: "CREATE", Kind: KindFunction, Keyspace: "app", Name: "fmt", OrReplace: true, Signature: "int, frozen<map<text, int>>"},
+		},
+		{
+			"DROP AGGREGATE app.total(int)",
+			&DDLStatement{Action: "DROP", Kind: KindAggregate, Keyspace: "app", Name: "total", Signature: "int"},
+		},
+		{
+			"ALTER TABLE users ADD (nick text, tags set<text>)",
+			&DDLStatement{Action: "ALTER", Kind: KindTable, Name: "users", AlterOp: "ADD", Columns: []string{"nick", "tags"}},
+		},
+		{
+			"ALTER TABLE users\n  DROP IF EXISTS \"Nick\"",
+			&DDLStatement{Action: "ALTER", Kind: KindTable, Name: "users", AlterOp: "DROP", Columns: []string{"Nick"}},
+		},
+		{
+			"ALTER TYPE app.address RENAME zip TO postcode AND st TO street",
+			&DDLStatement{Action: "ALTER", Kind: KindType, Keyspace: "app", Name: "address", AlterOp: "RENAME",
+				Renames: []Rename{{From: "zip", To: "postcode"}, {From: "st", To: "street"}}},
+		},
+		{
+			"ALTER KEYSPACE app WITH durable_writes = false",
+			&DDLStatement{Action: "ALTER", Kind: KindKeyspace, Name: "app", AlterOp: "WITH"},
+		},
+		{"INSERT INTO users (id) VALUES (1)", nil},
+		{"TRUNCATE users", nil},
+		{"CREATE ROLE admin WITH LOGIN = true", nil},
+		{"CREATE OR REPLACE", nil},
+		{"CREATE OR REPLACE;", nil},
+		{"CREATE CUSTOM", nil},
+		{"CREATE OR REPLACE CUSTOM", nil},
+		{"CREATE", nil},
+		{"DROP", nil},
+		{"DROP MATERIALIZED", nil},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDDL(tt.stmt)
+		if err != nil {
+			t.Errorf("ParseDDL(%q) failed: %v", tt.stmt, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseDDL(%q) = %+v, want %+v", tt.stmt, got, tt.want)
+		}
+	}
+}
+
+func TestParseSchemaDefinition(t *testing.T) {
+	script := `
+CREATE KEYSPACE app WITH replication = {'class': 'NetworkTopologyStrategy', 'dc1': 3} AND durable_writes = false;
+USE app;
+CREATE TYPE address (street text, "Zip" text);
+CREATE TABLE events (
+    tenant text,
+    day date,
+    ts timestamp,
+    owner frozen<address>,
+    tags MAP<text, frozen<list<int>>>,
+    region text STATIC,
+    PRIMARY KEY ((tenant, day), ts)
+) WITH CLUSTERING ORDER BY (ts DESC) AND comment = 'a, b';
+CREATE TABLE other.users (id uuid PRIMARY KEY, email text);
+CREATE INDEX ON events (keys(tags));
+CREATE CUSTOM INDEX by_email ON other.users (email) USING 'StorageAttachedIndex' WITH OPTIONS = {'case_sensitive': 'false'};
+CREATE MATERIALIZED VIEW by_ts AS SELECT * FROM events WHERE ts IS NOT NULL AND tenant IS NOT NULL AND day IS NOT NULL PRIMARY KEY (ts, tenant, day);
+CREATE FUNCTION f(a int) RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS 'return a;';
+`
+	def, err := ParseSchemaDefinition(script, "")
+	if err != nil {
+		t.Fatalf("ParseSchemaDefinition failed: %v", err)
+	}
+	if len(def.Keyspaces) != 2 || len(def.Ignored) != 1 {
+		t.Fatalf("got %d keyspaces and %d ignored statements, want 2 and 1", len(def.Keyspaces), len(def.Ignored))
+	}
+
+	app := def.Keyspaces[0]
+	if !app.Created || app.DurableWrites || !reflect.DeepEqual(app.Replication, map[string]string{"class": "NetworkTopologyStrategy", "dc1": "3"}) {
+		t.Errorf("keyspace app = %+v", app)
+	}
+	wantType := TypeDefinition{Name: "address", Fields: []ColumnDefinition{{Name: "street", Type: "text"}, {Name: "Zip", Type: "text"}}}
+	if !reflect.DeepEqual(app.Types, []TypeDefinition{wantType}) {
+		t.Errorf("types = %+v, want %+v", app.Types, wantType)
+	}
+	wantTable := &TableDefinition{
+		Name: "events",
+		Columns: []ColumnDefinition{
+			{Name: "tenant", Type: "text"}, {Name: "day", Type: "date"}, {Name: "ts", Type: "timestamp"},
+			{Name: "owner", Type: "frozen<address>"}, {Name: "tags", Type: "map<text, frozen<list<int>>>"},
+			{Name: "region", Type: "text", Static: true},
+		},
+		PartitionKey: []string{"tenant", "day"},
+		Clustering:   []ClusteringColumn{{Name: "ts", Descending: true}},
+		Indexes:      []IndexDefinition{{Name: "events_tags_idx", Target: "keys(tags)"}},
+	}
+	if !reflect.DeepEqual(app.Tables, []*TableDefinition{wantTable}) {
+		t.Errorf("tables = %+v, want %+v", app.Tables[0], wantTable)
+	}
+	if len(app.Views) != 1 || app.Views[0].BaseTable != "events" ||
+		!strings.HasPrefix(app.Views[0].Statement, "CREATE MATERIALIZED VIEW app.by_ts AS SELECT * FROM app.events WHERE") {
+		t.Errorf("views = %+v", app.Views)
+	}
+
+	other := def.Keyspaces[1]
+	wantIndex := IndexDefinition{Name: "by_email", Target: "email", Custom: true, Class: "StorageAttachedIndex", Options: map[string]string{"case_sensitive": "false"}}
+	if other.Created || len(other.Tables) != 1 || !reflect.DeepEqual(other.Tables[0].PartitionKey, []string{"id"}) ||
+		!reflect.DeepEqual(other.Tables[0].Indexes, []IndexDefinition{wantIndex}) {
+		t.Errorf("keyspace other = %+v, table %+v", other, other.Tables[0])
+	}
+
+	for _, bad := range []string{
+		"ALTER TABLE app.events ADD x int;",
+		"CREATE TABLE t (id int PRIMARY KEY);",
+		"CREATE TABLE app.t (id int, v int);",
+		"CREATE INDEX ON app.missing (v);",
+		"USE app; CREATE TYPE 0",
+		"CREATE TYPE app.address;",
+		"CREATE TABLE app.t;",
+		"CREATE TABLE app.t WITH comment = 'x';",
+	} {
+		if _, err := ParseSchemaDefinition(bad, ""); err == nil {
+			t.Errorf("ParseSchemaDefinition(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestDescribeStatement(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want StatementDescriptor
+	}{
+		{
+			"SELECT JSON * FROM app.users WHERE id = 1 ALLOW FILTERING;",
+			StatementDescriptor{Kind: "SELECT", Category: CategoryQuery, ObjectType: KindTable, Keyspace: "app", Name: "users", QualifiedName: "app.users",
+				Options: StatementOptions{JSON: true, AllowFiltering: true}},
+		},
+		{
+			"INSERT INTO users (id, name) VALUES (1, 'if') IF NOT EXISTS USING TTL 60 AND TIMESTAMP 123",
+			StatementDescriptor{Kind: "INSERT", Category: CategoryDML, ObjectType: KindTable, Name: "users", QualifiedName: "users",
+				Options: StatementOptions{IfNotExists: true, Conditional: true, TTL: true, Timestamp: true}},
+		},
+		{
+			"UPDATE \"App\".counts USING TTL 5 SET n = n + 1 WHERE id = 1 IF EXISTS",
+			StatementDescriptor{Kind: "UPDATE", Category: CategoryDML, ObjectType: KindTable, Keyspace: "App", Name: "counts", QualifiedName: "App.counts",
+				Options: StatementOptions{IfExists: true, Conditional: true, TTL: true}},
+		},
+		{
+			"UPDATE users USING TIMEOUT 500ms AND TTL 5 SET name = 'x' WHERE id = 1",
+			StatementDescriptor{Kind: "UPDATE", Category: CategoryDML, ObjectType: KindTable, Name: "users", QualifiedName: "users",
+				Options: StatementOptions{TTL: true, Timeout: true}},
+		},
+		{
+			"SELECT * FROM users BYPASS CACHE",
+			StatementDescriptor{Kind: "SELECT", Category: CategoryQuery, ObjectType: KindTable, Name: "users", QualifiedName: "users",
+				Options: StatementOptions{BypassCache: true}},
+		},
+		{
+			"DELETE tags['a'] FROM users WHERE id = 1 IF name = 'x'",
+			StatementDescriptor{Kind: "DELETE", Category: CategoryDML, ObjectType: KindTable, Name: "users", QualifiedName: "users",
+				Options: StatementOptions{Conditional: true}},
+		},
+		{
+			"BEGIN UNLOGGED BATCH INSERT INTO a (id) VALUES (1); UPDATE b SET x = 1 WHERE id = 2; APPLY BATCH",
+			StatementDescriptor{Kind: "BATCH", Category: CategoryDML, Statements: 2, Options: StatementOptions{BatchType: "UNLOGGED"}},
+		},
+		{
+			"CREATE TABLE IF NOT EXISTS app.t (id int PRIMARY KEY)",
+			StatementDescriptor{Kind: "CREATE", Category: CategoryDDL, ObjectType: KindTable, Keyspace: "app", Name: "t", QualifiedName: "app.t",
+				Options: StatementOptions{IfNotExists: true}},
+		},
+		{
+			"DROP ROLE IF EXISTS admin",
+			StatementDescriptor{Kind: "DROP", Category: CategoryDCL, ObjectType: "ROLE", Name: "admin", QualifiedName: "admin",
+				Options: StatementOptions{IfExists: true}},
+		},
+		{
+			"GRANT SELECT ON KEYSPACE app TO reader",
+			StatementDescriptor{Kind: "GRANT", Category: CategoryDCL, ObjectType: "PERMISSION"},
+		},
+		{
+			"USE app",
+			StatementDescriptor{Kind: "USE", Category: CategorySession, ObjectType: KindKeyspace, Name: "app", QualifiedName: "app"},
+		},
+		{
+			"DESCRIBE MATERIALIZED VIEW app.by_email",
+			StatementDescriptor{Kind: "DESCRIBE", Category: CategoryShell, ObjectType: KindView, Keyspace: "app", Name: "by_email", QualifiedName: "app.by_email"},
+		},
+		{
+			"DESC KEYSPACES",
+			StatementDescriptor{Kind: "DESC", Category: CategoryShell, ObjectType: "KEYSPACES"},
+		},
+		{
+			"CONSISTENCY QUORUM",
+			StatementDescriptor{Kind: "CONSISTENCY", Category: CategoryShell},
+		},
+	}
+
+	for _, tt := range tests {
+		got := DescribeStatement(tt.stmt)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DescribeStatement(%q) = %+v, want %+v", tt.stmt, got, tt.want)
+		}
+	}
+}
+
+func TestAddSimilarityScore(t *testing.T) {
+	columns := []string{"id", "Body", "embedding"}
+	tests := []struct {
+		name     string
+		query    string
+		function string
+		want     string
+		wantErr  bool
+	}{
+		{
+			"select list", "SELECT id, body FROM ks.docs ORDER BY embedding ANN OF [0.1, -0.2, 3e-1] LIMIT 5;", "cosine",
+			"SELECT id, body, similarity_cosine(embedding, [0.1, -0.2, 3e-1]) AS score FROM ks.docs ORDER BY embedding ANN OF [0.1, -0.2, 3e-1] LIMIT 5;", false,
+		},
+		{
+			"star expanded", `select * from docs where id = 1 order by "Vec" ann of [1, 2]`, "EUCLIDEAN",
+			`select id, "Body", embedding, similarity_euclidean("Vec", [1, 2]) AS score from docs where id = 1 order by "Vec" ann of [1, 2]`, false,
+		},
+		{
+			"dot product", "SELECT id FROM docs ORDER BY embedding ANN OF [1.0, 0.0] LIMIT 1", "dot_product",
+			"SELECT id, similarity_dot_product(embedding, [1.0, 0.0]) AS score FROM docs ORDER BY embedding ANN OF [1.0, 0.0] LIMIT 1", false,
+		},
+		{"not ann", "SELECT id FROM docs ORDER BY id DESC", "cosine", "", true},
+		{"bind marker", "SELECT id FROM docs ORDER BY embedding ANN OF ? LIMIT 5", "cosine", "", true},
+		{"json", "SELECT JSON id FROM docs ORDER BY embedding ANN OF [1, 2]", "cosine", "", true},
+		{"unknown function", "SELECT id FROM docs ORDER BY embedding ANN OF [1, 2]", "manhattan", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ann, err := AddSimilarityScore(tt.query, tt.function, "score", columns)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+			if ann == nil || !strings.HasPrefix(ann.Vector, "[") {
+				t.Errorf("unexpected ordering: %+v", ann)
+			}
+		})
+	}
+}
+
+func TestParseRestrictions(t *testing.T) {
+	where := `tenant = 'o''brien' AND bucket IN (1, -2, ?) AND token(tenant, bucket) > -100 AND ` +
+		`(day, seq) >= ('2024-01-01', 3) AND tags CONTAINS KEY 'x' AND attrs['k'] = ? AND "Name" != :name`
+	got, err := ParseRestrictions(where)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Restriction{
+		{Columns: []string{"tenant"}, Operator: "=", Values: []string{"'o''brien'"}},
+		{Columns: []string{"bucket"}, Operator: "IN", Values: []string{"1", "-2", "?"}},
+		{Columns: []string{"tenant", "bucket"}, Token: true, Operator: ">", Values: []string{"-100"}},
+		{Columns: []string{"day", "seq"}, Operator: ">=", Values: []string{"('2024-01-01', 3)"}},
+		{Columns: []string{"tags"}, Operator: "CONTAINS KEY", Values: []string{"'x'"}},
+		{Columns: []string{"attrs"}, Element: "'k'", Operator: "=", Values: []string{"?"}},
+		{Columns: []string{"Name"}, Operator: "!=", Values: []string{":name"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+	if LiteralText(got[0].Values[0]) != "o'brien" || !IsBindMarker(got[1].Values[2]) || !IsBindMarker(got[6].Values[0]) {
+		t.Errorf("literal %q", LiteralText(got[0].Values[0]))
+	}
+
+	// A ? inside a string is not a bind marker
+	got, err = ParseRestrictions("q = 'why?'")
+	if err != nil || len(got) != 1 || got[0].Values[0] != "'why?'" {
+		t.Errorf("quoted ?: %+v %v", got, err)
+	}
+	if _, err := ParseRestrictions("tenant"); err == nil {
+		t.Error("expected an error for a condition without an operator")
+	}
+}
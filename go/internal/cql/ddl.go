@@ -0,0 +1,273 @@
+package cql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// Schema object kinds reported by ParseDDL
+const (
+	KindKeyspace  = "KEYSPACE"
+	KindTable     = "TABLE"
+	KindType      = "TYPE"
+	KindIndex     = "INDEX"
+	KindView      = "MATERIALIZED VIEW"
+	KindFunction  = "FUNCTION"
+	KindAggregate = "AGGREGATE"
+)
+
+// Rename is a single "from TO to" pair of an ALTER ... RENAME
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// DDLStatement describes the schema object a CREATE, ALTER or DROP changes
+type DDLStatement struct {
+	Action    string `json:"action"` // CREATE, ALTER or DROP
+	Kind      string `json:"kind"`   // One of the Kind constants
+	Keyspace  string `json:"keyspace,omitempty"`
+	Name      string `json:"name"`
+	Table     string `json:"table,omitempty"`     // Indexed table for CREATE INDEX
+	IfExists  bool   `json:"ifExists,omitempty"`  // IF EXISTS or IF NOT EXISTS was given
+	OrReplace bool   `json:"orReplace,omitempty"` // CREATE OR REPLACE (functions and aggregates)
+	Signature string `json:"signature,omitempty"` // Argument types of a function or aggregate, e.g. "int, text"
+
+	// ALTER only
+	AlterOp string   `json:"alterOp,omitempty"` // ADD, DROP, RENAME, ALTER or WITH
+	Columns []string `json:"columns,omitempty"` // Columns or fields added or dropped
+	Renames []Rename `json:"renames,omitempty"`
+}
+
+// ParseDDL parses the head of a schema statement. It returns nil without an
+// error for statements that do not change a keyspace, table, type, index,
+// view, function or aggregate (DML, TRUNCATE, roles, permissions). Like
+// AnalyzeSelect it is a shallow, token-based parse.
+func ParseDDL(stmt string) (*DDLStatement, error) {
+	tokens, err := statementTokens(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) < 3 {
+		return nil, nil
+	}
+
+	d := &DDLStatement{Action: strings.ToUpper(tokens[0].Value)}
+	if d.Action != "CREATE" && d.Action != "ALTER" && d.Action != "DROP" {
+		return nil, nil
+	}
+	pos := 1
+
+	if d.Action == "CREATE" && isKeyword(tokens, pos, "OR") && isKeyword(tokens, pos+1, "REPLACE") {
+		d.OrReplace = true
+		pos += 2
+	}
+	if d.Action == "CREATE" && isKeyword(tokens, pos, "CUSTOM") {
+		pos++
+	}
+	if pos >= len(tokens) {
+		return nil, nil
+	}
+
+	switch kw := strings.ToUpper(tokens[pos].Value); {
+	case kw == "KEYSPACE" || kw == "SCHEMA":
+		d.Kind = KindKeyspace
+	case kw == "TABLE" || kw == "COLUMNFAMILY":
+		d.Kind = KindTable
+	case kw == "TYPE":
+		d.Kind = KindType
+	case kw == "INDEX":
+		d.Kind = KindIndex
+	case kw == "MATERIALIZED" && isKeyword(tokens, pos+1, "VIEW"):
+		d.Kind = KindView
+		pos++
+	case kw == "FUNCTION":
+		d.Kind = KindFunction
+	case kw == "AGGREGATE":
+		d.Kind = KindAggregate
+	default:
+		return nil, nil
+	}
+	pos++
+
+	if isKeyword(tokens, pos, "IF") {
+		if isKeyword(tokens, pos+1, "NOT") {
+			pos++
+		}
+		if !isKeyword(tokens, pos+1, "EXISTS") {
+			return nil, fmt.Errorf("expected EXISTS after IF")
+		}
+		d.IfExists = true
+		pos += 2
+	}
+
+	// Unnamed index: CREATE INDEX ON table (column)
+	if d.Kind == KindIndex && d.Action == "CREATE" && isKeyword(tokens, pos, "ON") {
+		return d, parseIndexTarget(tokens, pos, d, true)
+	}
+
+	if pos >= len(tokens) {
+		return nil, fmt.Errorf("%s %s is missing a name", d.Action, d.Kind)
+	}
+	if d.Kind == KindKeyspace {
+		d.Name = unquoteName(tokens[pos])
+		pos++
+	} else {
+		d.Keyspace, d.Name, pos = qualifiedName(tokens, pos)
+	}
+
+	switch {
+	case d.Kind == KindIndex && d.Action == "CREATE":
+		if !isKeyword(tokens, pos, "ON") {
+			return nil, fmt.Errorf("CREATE INDEX is missing ON")
+		}
+		return d, parseIndexTarget(tokens, pos, d, false)
+	case (d.Kind == KindFunction || d.Kind == KindAggregate) && pos < len(tokens) && tokens[pos].Value == "(":
+		d.Signature = parseSignature(stmt, tokens, pos, d.Kind == KindFunction && d.Action == "CREATE")
+	case d.Action == "ALTER":
+		parseAlter(tokens, pos, d)
+	}
+
+	return d, nil
+}
+
+// qualifiedName reads "name" or "keyspace.name" starting at pos
+func qualifiedName(tokens []batch.Token, pos int) (keyspace, name string, next int) {
+	name = unquoteName(tokens[pos])
+	pos++
+	if pos+1 < len(tokens) && tokens[pos].Value == "." {
+		keyspace = name
+		name = unquoteName(tokens[pos+1])
+		pos += 2
+	}
+	return keyspace, name, pos
+}
+
+// parseIndexTarget reads "ON table (column)". An unnamed index gets the name
+// Cassandra generates for it: <table>_<column>_idx.
+func parseIndexTarget(tokens []batch.Token, pos int, d *DDLStatement, unnamed bool) error {
+	if pos+1 >= len(tokens) {
+		return fmt.Errorf("CREATE INDEX is missing a table name")
+	}
+	keyspace, table, next := qualifiedName(tokens, pos+1)
+	if d.Keyspace == "" {
+		d.Keyspace = keyspace
+	}
+	d.Table = table
+	if !unnamed {
+		return nil
+	}
+
+	// Skip "(" and an optional keys( / values( / entries( / full( wrapper
+	column := ""
+	for i := next; i < len(tokens) && tokens[i].Value != ")"; i++ {
+		if tokens[i].Value == "(" {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].Value == "(" {
+			continue
+		}
+		column = unquoteName(tokens[i])
+		break
+	}
+	if column == "" {
+		return fmt.Errorf("CREATE INDEX is missing a column")
+	}
+	d.Name = table + "_" + column + "_idx"
+	return nil
+}
+
+// parseSignature returns the argument types between the parentheses at pos.
+// Function definitions name their arguments; withNames drops those names.
+func parseSignature(stmt string, tokens []batch.Token, pos int, withNames bool) string {
+	var args []string
+	depth := 0
+	argStart := -1
+	for i := pos; i < len(tokens); i++ {
+		v := tokens[i].Value
+		switch {
+		case v == "(" || v == "<":
+			depth++
+			if depth == 1 {
+				argStart = i + 1
+				continue
+			}
+		case v == ")" || v == ">":
+			depth--
+		}
+		if depth == 0 || (depth == 1 && v == ",") {
+			if argStart >= 0 && argStart < i {
+				first := argStart
+				if withNames && first+1 < i {
+					first++
+				}
+				args = append(args, strings.TrimSpace(stmt[tokens[first].Start:tokens[i-1].End]))
+			}
+			argStart = i + 1
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	return strings.Join(args, ", ")
+}
+
+// parseAlter reads the operation of an ALTER TABLE or ALTER TYPE
+func parseAlter(tokens []batch.Token, pos int, d *DDLStatement) {
+	if pos >= len(tokens) {
+		return
+	}
+	d.AlterOp = strings.ToUpper(tokens[pos].Value)
+	pos++
+
+	switch d.AlterOp {
+	case "ADD", "DROP":
+		// ADD IF NOT EXISTS / DROP IF EXISTS
+		for _, kw := range []string{"IF", "NOT", "EXISTS"} {
+			if isKeyword(tokens, pos, kw) {
+				pos++
+			}
+		}
+		if pos < len(tokens) && tokens[pos].Value == "(" {
+			// ADD (a int, b text) or DROP (a, b): the first name of each element
+			expectName := true
+			depth := 0
+			for i := pos; i < len(tokens); i++ {
+				switch tokens[i].Value {
+				case "(", "<":
+					depth++
+					continue
+				case ")", ">":
+					depth--
+					continue
+				case ",":
+					if depth == 1 {
+						expectName = true
+					}
+					continue
+				}
+				if depth == 1 && expectName {
+					d.Columns = append(d.Columns, unquoteName(tokens[i]))
+					expectName = false
+				}
+			}
+		} else if pos < len(tokens) {
+			d.Columns = append(d.Columns, unquoteName(tokens[pos]))
+		}
+	case "RENAME":
+		for pos+2 < len(tokens) && isKeyword(tokens, pos+1, "TO") {
+			d.Renames = append(d.Renames, Rename{From: unquoteName(tokens[pos]), To: unquoteName(tokens[pos+2])})
+			pos += 3
+			if !isKeyword(tokens, pos, "AND") {
+				break
+			}
+			pos++
+		}
+	case "ALTER":
+		if pos < len(tokens) {
+			d.Columns = append(d.Columns, unquoteName(tokens[pos]))
+		}
+	}
+}
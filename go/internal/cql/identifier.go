@@ -0,0 +1,67 @@
+// Package cql provides helpers for analyzing and building CQL statements
+package cql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QuoteIdentifier quotes a CQL identifier when it is a reserved word, contains
+// uppercase or special characters, or starts with a digit
+func QuoteIdentifier(name string) string {
+	// Check if identifier needs quoting
+	needsQuoting := false
+
+	// Reserved words (simplified list)
+	reserved := map[string]bool{
+		"add": true, "allow": true, "alter": true, "and": true, "any": true,
+		"apply": true, "asc": true, "authorize": true, "batch": true, "begin": true,
+		"by": true, "columnfamily": true, "create": true, "delete": true, "desc": true,
+		"drop": true, "each_quorum": true, "from": true, "grant": true, "in": true,
+		"index": true, "inet": true, "infinity": true, "insert": true, "into": true,
+		"key": true, "keyspace": true, "keyspaces": true, "limit": true, "local_one": true,
+		"local_quorum": true, "modify": true, "nan": true, "norecursive": true, "not": true,
+		"of": true, "on": true, "one": true, "order": true, "password": true,
+		"primary": true, "quorum": true, "rename": true, "revoke": true, "schema": true,
+		"select": true, "set": true, "table": true, "three": true, "to": true,
+		"token": true, "truncate": true, "two": true, "unlogged": true, "update": true,
+		"use": true, "using": true, "where": true, "with": true,
+	}
+
+	lower := strings.ToLower(name)
+	if reserved[lower] {
+		needsQuoting = true
+	}
+
+	// Check for special characters
+	for _, c := range name {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_') {
+			needsQuoting = true
+			break
+		}
+	}
+
+	// Check if starts with number
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		needsQuoting = true
+	}
+
+	// Check for uppercase (CQL identifiers are case-insensitive unless quoted)
+	for _, c := range name {
+		if c >= 'A' && c <= 'Z' {
+			needsQuoting = true
+			break
+		}
+	}
+
+	if needsQuoting {
+		return fmt.Sprintf("\"%s\"", strings.ReplaceAll(name, "\"", "\"\""))
+	}
+
+	return name
+}
+
+// EscapeString escapes single quotes for use inside a CQL string literal
+func EscapeString(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
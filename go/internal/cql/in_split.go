@@ -0,0 +1,145 @@
+package cql
+
+import (
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// InSplit is a SELECT whose IN list was split into several queries
+type InSplit struct {
+	Column     string   // Column restricted by the list, e.g. "id" or "(a, b)" for a tuple IN
+	Values     int      // Values in the list
+	Statements []string // One SELECT per chunk of the list, in list order
+}
+
+// SplitInClause splits the longest IN list of a SELECT's WHERE clause into
+// lists of at most maxValues values, each in its own copy of the statement.
+// It returns nil when no list is longer than maxValues, when the statement
+// cannot be analyzed, or when the rows of the copies cannot simply be
+// concatenated: the statement orders, limits, groups or aggregates its rows,
+// or the list has bind markers.
+func SplitInClause(query string, maxValues int) *InSplit {
+	if maxValues <= 0 {
+		return nil
+	}
+	analysis, err := AnalyzeSelect(query)
+	if err != nil || analysis.OrderBy != "" || analysis.Limit > 0 || len(analysis.GroupBy) > 0 || analysis.HasAggregates {
+		return nil
+	}
+
+	tokens, err := batch.Lex(query)
+	if err != nil {
+		return nil
+	}
+	where := -1
+	for i := range tokens {
+		if isKeyword(tokens, i, "WHERE") {
+			where = i
+			break
+		}
+	}
+	if where < 0 {
+		return nil
+	}
+	end := nextClause(tokens, where+1)
+
+	// Find the longest list of a top-level "column IN (...)" condition
+	var best [][]batch.Token
+	bestOpen, bestClose, bestColumn := -1, -1, ""
+	depth := 0
+	for i := where + 1; i < end; i++ {
+		switch tokens[i].Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth != 0 || !isKeyword(tokens, i, "IN") || i+1 >= end || tokens[i+1].Value != "(" || i == where+1 {
+			continue
+		}
+		values, closeIdx, ok := listElements(tokens, i+1, end)
+		if !ok || len(values) <= len(best) {
+			continue
+		}
+		best, bestOpen, bestClose = values, i+1, closeIdx
+		bestColumn = inColumn(query, tokens, where+1, i-1)
+	}
+	if len(best) <= maxValues {
+		return nil
+	}
+	for _, value := range best {
+		for _, tok := range value {
+			if tok.Type == batch.TokenColon {
+				return nil
+			}
+		}
+	}
+
+	head := query[:tokens[bestOpen].End]
+	tail := query[tokens[bestClose].Start:]
+	split := &InSplit{Column: bestColumn, Values: len(best)}
+	for start := 0; start < len(best); start += maxValues {
+		chunk := best[start:min(start+maxValues, len(best))]
+		texts := make([]string, len(chunk))
+		for i, value := range chunk {
+			texts[i] = query[value[0].Start:value[len(value)-1].End]
+		}
+		split.Statements = append(split.Statements, head+strings.Join(texts, ", ")+tail)
+	}
+	return split
+}
+
+// listElements splits the parenthesized list opening at tokens[open] into its
+// top-level elements and returns the index of the closing parenthesis
+func listElements(tokens []batch.Token, open, end int) ([][]batch.Token, int, bool) {
+	var elements [][]batch.Token
+	start := open + 1
+	depth := 0
+	for i := open + 1; i < end; i++ {
+		switch tokens[i].Value {
+		case "(", "[", "{":
+			depth++
+		case "]", "}":
+			depth--
+		case ")":
+			if depth == 0 {
+				if i > start {
+					elements = append(elements, tokens[start:i])
+				}
+				return elements, i, true
+			}
+			depth--
+		case ",":
+			if depth == 0 {
+				if i == start {
+					return nil, 0, false
+				}
+				elements = append(elements, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// inColumn returns the column, or parenthesized columns, before an IN at
+// tokens[last+1]
+func inColumn(query string, tokens []batch.Token, first, last int) string {
+	if tokens[last].Value != ")" {
+		return unquoteName(tokens[last])
+	}
+	depth := 0
+	for i := last; i >= first; i-- {
+		switch tokens[i].Value {
+		case ")":
+			depth++
+		case "(":
+			depth--
+		}
+		if depth == 0 {
+			return query[tokens[i].Start:tokens[last].End]
+		}
+	}
+	return query[tokens[first].Start:tokens[last].End]
+}
@@ -0,0 +1,196 @@
+package cql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// Restriction is one condition of a WHERE clause
+type Restriction struct {
+	Columns  []string `json:"columns"`           // The restricted column, a tuple's columns, or token()'s arguments
+	Token    bool     `json:"token,omitempty"`   // token(columns) compared to a value
+	Element  string   `json:"element,omitempty"` // Map element or collection index, for m['k'] = v
+	Operator string   `json:"operator"`          // =, IN, <, <=, >, >=, !=, CONTAINS, CONTAINS KEY, LIKE or IS NOT
+	Values   []string `json:"values"`            // The value as written, or each element of an IN list
+}
+
+// IsBindMarker reports whether a restriction value is a bind marker, ? or :name
+func IsBindMarker(value string) bool {
+	return value == "?" || strings.HasPrefix(value, ":")
+}
+
+// LiteralText returns the text of a literal value, unquoting strings
+func LiteralText(value string) string {
+	switch {
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	case len(value) >= 4 && strings.HasPrefix(value, "$$") && strings.HasSuffix(value, "$$"):
+		return value[2 : len(value)-2]
+	}
+	return value
+}
+
+// restrictionOperators are the comparison operators of a condition
+var restrictionOperators = map[string]bool{"=": true, "<": true, "<=": true, ">": true, ">=": true, "!=": true}
+
+// ParseRestrictions parses the top-level AND-ed conditions of a WHERE clause
+// into the columns they restrict and the values they compare them with. Like
+// AnalyzeSelect it is a shallow, token-based parse for inspecting queries.
+func ParseRestrictions(where string) ([]Restriction, error) {
+	var restrictions []Restriction
+	for _, cond := range SplitConditions(maskBindMarkers(where)) {
+		r, err := parseRestriction(cond)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+	return restrictions, nil
+}
+
+// bindMarkerMask stands in for a ? bind marker, which the lexer does not
+// accept; ParseRestrictions reports it as ?
+const bindMarkerMask = ":cqlaiqmark"
+
+// maskBindMarkers replaces the ? bind markers outside quotes with
+// bindMarkerMask
+func maskBindMarkers(where string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(where); i++ {
+		ch := where[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '$' && strings.HasPrefix(where[i:], "$$"):
+			end := strings.Index(where[i+2:], "$$")
+			if end < 0 {
+				b.WriteString(where[i:])
+				return b.String()
+			}
+			b.WriteString(where[i : i+end+4])
+			i += end + 3
+			continue
+		case ch == '?':
+			b.WriteString(bindMarkerMask)
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// parseRestriction parses a single condition
+func parseRestriction(cond string) (Restriction, error) {
+	r := Restriction{}
+	invalid := fmt.Errorf("cannot parse condition %q", strings.ReplaceAll(cond, bindMarkerMask, "?"))
+	tokens, err := batch.Lex(cond)
+	if err != nil || len(tokens) == 0 {
+		return r, invalid
+	}
+
+	pos := 0
+	switch {
+	case isKeyword(tokens, 0, "TOKEN") && len(tokens) > 1 && tokens[1].Value == "(":
+		r.Token = true
+		elements, closeIdx, ok := listElements(tokens, 1, len(tokens))
+		if !ok {
+			return r, invalid
+		}
+		r.Columns = elementNames(elements)
+		pos = closeIdx + 1
+	case tokens[0].Value == "(":
+		elements, closeIdx, ok := listElements(tokens, 0, len(tokens))
+		if !ok {
+			return r, invalid
+		}
+		r.Columns = elementNames(elements)
+		pos = closeIdx + 1
+	case tokens[0].Type == batch.TokenIdentifier || tokens[0].Type == batch.TokenQuotedName:
+		r.Columns = []string{unquoteName(tokens[0])}
+		pos = 1
+		if pos < len(tokens) && tokens[pos].Value == "[" {
+			end := pos + 1
+			for end < len(tokens) && tokens[end].Value != "]" {
+				end++
+			}
+			if end == len(tokens) || end == pos+1 {
+				return r, invalid
+			}
+			r.Element = cond[tokens[pos+1].Start:tokens[end-1].End]
+			pos = end + 1
+		}
+	default:
+		return r, invalid
+	}
+	if r.Columns == nil || pos >= len(tokens) {
+		return r, invalid
+	}
+
+	switch {
+	case restrictionOperators[tokens[pos].Value]:
+		r.Operator = tokens[pos].Value
+		pos++
+	case isKeyword(tokens, pos, "IN"), isKeyword(tokens, pos, "LIKE"):
+		r.Operator = strings.ToUpper(tokens[pos].Value)
+		pos++
+	case isKeyword(tokens, pos, "CONTAINS"):
+		r.Operator = "CONTAINS"
+		pos++
+		if isKeyword(tokens, pos, "KEY") {
+			r.Operator = "CONTAINS KEY"
+			pos++
+		}
+	case isKeyword(tokens, pos, "IS") && isKeyword(tokens, pos+1, "NOT"):
+		r.Operator = "IS NOT"
+		pos += 2
+	default:
+		return r, invalid
+	}
+	if pos >= len(tokens) {
+		return r, invalid
+	}
+
+	if r.Operator == "IN" && tokens[pos].Value == "(" {
+		elements, closeIdx, ok := listElements(tokens, pos, len(tokens))
+		if !ok || closeIdx != len(tokens)-1 {
+			return r, invalid
+		}
+		r.Values = []string{}
+		for _, element := range elements {
+			r.Values = append(r.Values, restrictionValue(cond, element))
+		}
+		return r, nil
+	}
+	r.Values = []string{restrictionValue(cond, tokens[pos:])}
+	return r, nil
+}
+
+// restrictionValue returns the text of a value's tokens, with a masked bind
+// marker reported as ?
+func restrictionValue(cond string, tokens []batch.Token) string {
+	text := strings.TrimSpace(cond[tokens[0].Start:tokens[len(tokens)-1].End])
+	if text == bindMarkerMask {
+		return "?"
+	}
+	return text
+}
+
+// elementNames returns the column names of a parenthesized list, or nil when
+// an element is not a single name
+func elementNames(elements [][]batch.Token) []string {
+	names := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if len(element) != 1 || (element[0].Type != batch.TokenIdentifier && element[0].Type != batch.TokenQuotedName) {
+			return nil
+		}
+		names = append(names, unquoteName(element[0]))
+	}
+	return names
+}
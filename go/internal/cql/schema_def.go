@@ -0,0 +1,470 @@
+package cql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// SchemaDefinition is the schema a CQL script creates, read from its
+// CREATE KEYSPACE, TYPE, TABLE, INDEX and MATERIALIZED VIEW statements
+type SchemaDefinition struct {
+	Keyspaces []*KeyspaceDefinition
+	Ignored   []string // Statements that define nothing compared, e.g. functions
+}
+
+// KeyspaceDefinition is a keyspace of a SchemaDefinition. Created is false
+// when the script only creates objects in it.
+type KeyspaceDefinition struct {
+	Name          string
+	Created       bool
+	Replication   map[string]string
+	DurableWrites bool
+	Types         []TypeDefinition
+	Tables        []*TableDefinition
+	Views         []ViewDefinition
+}
+
+// TypeDefinition is a user-defined type
+type TypeDefinition struct {
+	Name   string
+	Fields []ColumnDefinition
+}
+
+// ColumnDefinition is a table column or a type field
+type ColumnDefinition struct {
+	Name   string
+	Type   string // As written, lower case, e.g. "map<text, frozen<address>>"
+	Static bool
+}
+
+// ClusteringColumn is a clustering column and its order
+type ClusteringColumn struct {
+	Name       string
+	Descending bool
+}
+
+// TableDefinition is a table with its indexes
+type TableDefinition struct {
+	Name         string
+	Columns      []ColumnDefinition
+	PartitionKey []string
+	Clustering   []ClusteringColumn
+	Indexes      []IndexDefinition
+}
+
+// IndexDefinition is a secondary index
+type IndexDefinition struct {
+	Name    string
+	Target  string // As system_schema.indexes stores it, e.g. "email" or "keys(prefs)"
+	Custom  bool
+	Class   string            // USING class of a custom index
+	Options map[string]string // WITH OPTIONS of a custom index
+}
+
+// ViewDefinition is a materialized view. Statement is its CREATE statement
+// with the view and base table qualified by keyspace.
+type ViewDefinition struct {
+	Name      string
+	BaseTable string
+	Statement string
+}
+
+// ParseSchemaDefinition reads the schema a script of CREATE statements
+// creates. USE sets the keyspace of unqualified names, as does
+// defaultKeyspace before the first USE. Statements that change or drop
+// schema, or change data, are rejected: the script has to describe the
+// schema as a whole.
+func ParseSchemaDefinition(script, defaultKeyspace string) (*SchemaDefinition, error) {
+	split, err := batch.SplitStatements(script)
+	if err != nil {
+		return nil, err
+	}
+	if split.Incomplete {
+		return nil, fmt.Errorf("the last statement is incomplete")
+	}
+	def := &SchemaDefinition{}
+	current := defaultKeyspace
+	for _, stmt := range split.GetStatementStrings() {
+		if err := def.add(stmt, &current); err != nil {
+			return nil, fmt.Errorf("%s: %w", shorten(stmt, 60), err)
+		}
+	}
+	return def, nil
+}
+
+// shorten shortens s to at most n runes for messages
+func shorten(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "..."
+	}
+	return s
+}
+
+// add reads one statement of the script
+func (def *SchemaDefinition) add(stmt string, current *string) error {
+	tokens, err := statementTokens(stmt)
+	if err != nil {
+		return err
+	}
+	if isKeyword(tokens, 0, "USE") && len(tokens) == 2 {
+		*current = unquoteName(tokens[1])
+		return nil
+	}
+	d, err := ParseDDL(stmt)
+	if err != nil {
+		return err
+	}
+	if d == nil || d.Action != "CREATE" {
+		return fmt.Errorf("only CREATE and USE statements can describe a schema")
+	}
+	if d.Kind == KindFunction || d.Kind == KindAggregate {
+		def.Ignored = append(def.Ignored, shorten(stmt, 60))
+		return nil
+	}
+
+	keyspace := d.Keyspace
+	if d.Kind == KindKeyspace {
+		keyspace = d.Name
+	}
+	if keyspace == "" {
+		keyspace = *current
+	}
+	if keyspace == "" {
+		return fmt.Errorf("no keyspace: qualify the name or USE a keyspace first")
+	}
+	ks := def.keyspace(keyspace)
+
+	switch d.Kind {
+	case KindKeyspace:
+		if ks.Created {
+			return fmt.Errorf("keyspace %s is created twice", keyspace)
+		}
+		return parseCreateKeyspace(tokens, ks)
+	case KindType:
+		t, err := parseCreateType(tokens, d.Name)
+		if err != nil {
+			return err
+		}
+		ks.Types = append(ks.Types, t)
+	case KindTable:
+		t, err := parseCreateTable(tokens, d.Name)
+		if err != nil {
+			return err
+		}
+		ks.Tables = append(ks.Tables, t)
+	case KindIndex:
+		table := ks.table(d.Table)
+		if table == nil {
+			return fmt.Errorf("index on %s.%s, which the script does not create before it", keyspace, d.Table)
+		}
+		idx, err := parseCreateIndex(tokens, d.Name)
+		if err != nil {
+			return err
+		}
+		table.Indexes = append(table.Indexes, idx)
+	case KindView:
+		view, err := parseCreateView(stmt, tokens, keyspace, d.Name)
+		if err != nil {
+			return err
+		}
+		ks.Views = append(ks.Views, view)
+	}
+	return nil
+}
+
+// keyspace returns the definition of a keyspace, adding it if needed
+func (def *SchemaDefinition) keyspace(name string) *KeyspaceDefinition {
+	for _, ks := range def.Keyspaces {
+		if ks.Name == name {
+			return ks
+		}
+	}
+	ks := &KeyspaceDefinition{Name: name, DurableWrites: true}
+	def.Keyspaces = append(def.Keyspaces, ks)
+	return ks
+}
+
+// table returns a table of the keyspace, or nil
+func (ks *KeyspaceDefinition) table(name string) *TableDefinition {
+	for _, t := range ks.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// indexOf returns the position of the first keyword or symbol v at or after
+// pos, or -1
+func indexOf(tokens []batch.Token, pos int, v string) int {
+	for i := pos; i < len(tokens); i++ {
+		if strings.EqualFold(tokens[i].Value, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseCreateKeyspace reads the replication map and durable_writes
+func parseCreateKeyspace(tokens []batch.Token, ks *KeyspaceDefinition) error {
+	ks.Created = true
+	pos := indexOf(tokens, 0, "replication")
+	if pos < 0 || pos+2 >= len(tokens) || tokens[pos+1].Value != "=" {
+		return fmt.Errorf("CREATE KEYSPACE is missing replication")
+	}
+	replication, next, err := parseMapLiteral(tokens, pos+2)
+	if err != nil {
+		return err
+	}
+	ks.Replication = replication
+	if pos := indexOf(tokens, next, "durable_writes"); pos >= 0 && pos+2 < len(tokens) {
+		ks.DurableWrites = !strings.EqualFold(tokens[pos+2].Value, "false")
+	}
+	return nil
+}
+
+// parseMapLiteral reads a {'key': value, ...} literal starting at pos
+func parseMapLiteral(tokens []batch.Token, pos int) (map[string]string, int, error) {
+	if pos >= len(tokens) || tokens[pos].Value != "{" {
+		return nil, pos, fmt.Errorf("expected {")
+	}
+	m := make(map[string]string)
+	pos++
+	for pos < len(tokens) && tokens[pos].Value != "}" {
+		if pos+2 >= len(tokens) || tokens[pos+1].Value != ":" {
+			return nil, pos, fmt.Errorf("expected 'key': value")
+		}
+		m[literalValue(tokens[pos])] = literalValue(tokens[pos+2])
+		pos += 3
+		if pos < len(tokens) && tokens[pos].Value == "," {
+			pos++
+		}
+	}
+	if pos >= len(tokens) {
+		return nil, pos, fmt.Errorf("expected }")
+	}
+	return m, pos + 1, nil
+}
+
+// literalValue returns a string literal without its quotes, or another token as is
+func literalValue(tok batch.Token) string {
+	if tok.Type == batch.TokenQuotedStringLiteral {
+		return strings.ReplaceAll(tok.Value[1:len(tok.Value)-1], "''", "'")
+	}
+	return tok.Value
+}
+
+// parenthesized returns the top-level comma-separated elements between the
+// parenthesis at pos and its match, and the position after the match
+func parenthesized(tokens []batch.Token, pos int) ([][]batch.Token, int, error) {
+	if pos < 0 || pos >= len(tokens) || tokens[pos].Value != "(" {
+		return nil, pos, fmt.Errorf("expected (")
+	}
+	var elements [][]batch.Token
+	depth := 0
+	start := pos + 1
+	for i := pos; i < len(tokens); i++ {
+		switch tokens[i].Value {
+		case "(", "<":
+			depth++
+		case ")", ">":
+			depth--
+		}
+		if (depth == 1 && tokens[i].Value == ",") || depth == 0 {
+			if i > start {
+				elements = append(elements, tokens[start:i])
+			}
+			start = i + 1
+		}
+		if depth == 0 {
+			return elements, i + 1, nil
+		}
+	}
+	return nil, pos, fmt.Errorf("unbalanced parentheses")
+}
+
+// renderType writes the tokens of a type as system_schema stores it:
+// lower case, with a space after each comma
+func renderType(tokens []batch.Token) string {
+	var sb strings.Builder
+	for _, tok := range tokens {
+		switch {
+		case tok.Value == ",":
+			sb.WriteString(", ")
+		case tok.Type == batch.TokenIdentifier:
+			sb.WriteString(strings.ToLower(tok.Value))
+		default:
+			sb.WriteString(tok.Value)
+		}
+	}
+	return sb.String()
+}
+
+// parseCreateType reads the fields of CREATE TYPE
+func parseCreateType(tokens []batch.Token, name string) (TypeDefinition, error) {
+	t := TypeDefinition{Name: name}
+	open := indexOf(tokens, 0, "(")
+	if open < 0 {
+		return t, fmt.Errorf("CREATE TYPE %s has no field list", name)
+	}
+	elements, _, err := parenthesized(tokens, open)
+	if err != nil {
+		return t, err
+	}
+	for _, el := range elements {
+		if len(el) < 2 {
+			return t, fmt.Errorf("field %q has no type", renderType(el))
+		}
+		t.Fields = append(t.Fields, ColumnDefinition{Name: unquoteName(el[0]), Type: renderType(el[1:])})
+	}
+	return t, nil
+}
+
+// parseCreateTable reads the columns, primary key and clustering order of
+// CREATE TABLE
+func parseCreateTable(tokens []batch.Token, name string) (*TableDefinition, error) {
+	t := &TableDefinition{Name: name}
+	open := indexOf(tokens, 0, "(")
+	if open < 0 {
+		return nil, fmt.Errorf("CREATE TABLE %s has no column list", name)
+	}
+	elements, next, err := parenthesized(tokens, open)
+	if err != nil {
+		return nil, err
+	}
+	for _, el := range elements {
+		if isKeyword(el, 0, "PRIMARY") && isKeyword(el, 1, "KEY") {
+			if err := t.parsePrimaryKey(el, 2); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(el) < 2 {
+			return nil, fmt.Errorf("column %q has no type", renderType(el))
+		}
+		col := ColumnDefinition{Name: unquoteName(el[0])}
+		end := len(el)
+		if n := len(el); n >= 4 && isKeyword(el, n-2, "PRIMARY") && isKeyword(el, n-1, "KEY") {
+			t.PartitionKey = []string{col.Name}
+			end -= 2
+		}
+		if isKeyword(el, end-1, "STATIC") {
+			col.Static = true
+			end--
+		}
+		col.Type = renderType(el[1:end])
+		t.Columns = append(t.Columns, col)
+	}
+	if len(t.PartitionKey) == 0 {
+		return nil, fmt.Errorf("table %s has no primary key", name)
+	}
+
+	// WITH CLUSTERING ORDER BY (c DESC, ...)
+	if pos := indexOf(tokens, next, "CLUSTERING"); pos >= 0 && isKeyword(tokens, pos+1, "ORDER") && isKeyword(tokens, pos+2, "BY") {
+		order, _, err := parenthesized(tokens, pos+3)
+		if err != nil {
+			return nil, err
+		}
+		for _, el := range order {
+			column := unquoteName(el[0])
+			for i := range t.Clustering {
+				if t.Clustering[i].Name == column {
+					t.Clustering[i].Descending = isKeyword(el, 1, "DESC")
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// parsePrimaryKey reads PRIMARY KEY ((a, b), c, d) from pos
+func (t *TableDefinition) parsePrimaryKey(el []batch.Token, pos int) error {
+	parts, _, err := parenthesized(el, pos)
+	if err != nil || len(parts) == 0 {
+		return fmt.Errorf("invalid PRIMARY KEY")
+	}
+	if parts[0][0].Value == "(" {
+		partition, _, err := parenthesized(parts[0], 0)
+		if err != nil {
+			return err
+		}
+		for _, p := range partition {
+			t.PartitionKey = append(t.PartitionKey, unquoteName(p[0]))
+		}
+	} else {
+		t.PartitionKey = []string{unquoteName(parts[0][0])}
+	}
+	for _, p := range parts[1:] {
+		t.Clustering = append(t.Clustering, ClusteringColumn{Name: unquoteName(p[0])})
+	}
+	return nil
+}
+
+// parseCreateIndex reads the target, class and options of CREATE INDEX
+func parseCreateIndex(tokens []batch.Token, name string) (IndexDefinition, error) {
+	idx := IndexDefinition{Name: name, Custom: isKeyword(tokens, 1, "CUSTOM")}
+	on := indexOf(tokens, 0, "ON")
+	open := indexOf(tokens, on, "(")
+	if on < 0 || open < 0 {
+		return idx, fmt.Errorf("CREATE INDEX is missing its target")
+	}
+	elements, next, err := parenthesized(tokens, open)
+	if err != nil || len(elements) != 1 {
+		return idx, fmt.Errorf("CREATE INDEX needs a single target column")
+	}
+	target := elements[0]
+	if len(target) == 1 {
+		idx.Target = target[0].Value
+		if target[0].Type == batch.TokenIdentifier {
+			idx.Target = strings.ToLower(idx.Target)
+		}
+	} else {
+		idx.Target = renderType(target) // keys(m), values(l), entries(m), full(f)
+	}
+	if isKeyword(tokens, next, "USING") && next+1 < len(tokens) {
+		idx.Class = literalValue(tokens[next+1])
+		next += 2
+	}
+	if pos := indexOf(tokens, next, "OPTIONS"); pos >= 0 && pos+2 < len(tokens) {
+		options, _, err := parseMapLiteral(tokens, pos+2)
+		if err != nil {
+			return idx, err
+		}
+		idx.Options = options
+	}
+	return idx, nil
+}
+
+// parseCreateView reads the base table of CREATE MATERIALIZED VIEW and
+// qualifies the view and base table names with the keyspace
+func parseCreateView(stmt string, tokens []batch.Token, keyspace, name string) (ViewDefinition, error) {
+	view := ViewDefinition{Name: name}
+	from := indexOf(tokens, 0, "FROM")
+	if from < 0 || from+1 >= len(tokens) {
+		return view, fmt.Errorf("CREATE MATERIALIZED VIEW is missing FROM")
+	}
+	_, view.BaseTable, _ = qualifiedName(tokens, from+1)
+
+	// The view name follows VIEW [IF NOT EXISTS]
+	namePos := indexOf(tokens, 0, "VIEW") + 1
+	if isKeyword(tokens, namePos, "IF") {
+		namePos += 3
+	}
+	var sb strings.Builder
+	last := 0
+	for _, pos := range []int{namePos, from + 1} {
+		tok := tokens[pos]
+		if pos+1 < len(tokens) && tokens[pos+1].Value == "." {
+			continue // Already qualified
+		}
+		sb.WriteString(stmt[last:tok.Start])
+		sb.WriteString(QuoteIdentifier(keyspace) + "." + tok.Value)
+		last = tok.End
+	}
+	sb.WriteString(stmt[last:])
+	view.Statement = strings.TrimSuffix(strings.TrimSpace(sb.String()), ";") + ";"
+	return view, nil
+}
@@ -0,0 +1,112 @@
+package cql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// SimilarityFunctions maps the similarity_function of a vector index to the
+// CQL function that computes it
+var SimilarityFunctions = map[string]string{
+	"COSINE":      "similarity_cosine",
+	"EUCLIDEAN":   "similarity_euclidean",
+	"DOT_PRODUCT": "similarity_dot_product",
+}
+
+// AnnOrdering is the ORDER BY <column> ANN OF <vector> clause of a vector search
+type AnnOrdering struct {
+	Column string // Vector column, as stored in the schema
+	Vector string // Query vector literal, as written
+}
+
+// ParseAnnOrdering returns the ANN ordering of an ORDER BY clause (the text
+// after ORDER BY), or nil when it is not a vector search
+func ParseAnnOrdering(orderBy string) *AnnOrdering {
+	tokens, err := batch.Lex(orderBy)
+	if err != nil || len(tokens) < 4 || !isKeyword(tokens, 1, "ANN") || !isKeyword(tokens, 2, "OF") {
+		return nil
+	}
+	return &AnnOrdering{
+		Column: unquoteName(tokens[0]),
+		Vector: strings.TrimSpace(orderBy[tokens[3].Start:tokens[len(tokens)-1].End]),
+	}
+}
+
+// AddSimilarityScore rewrites a vector search SELECT to also select the
+// similarity of each row to the query vector, as the alias column. function
+// is a key of SimilarityFunctions. A SELECT * is expanded to columns, since
+// CQL does not allow * next to other selectors.
+func AddSimilarityScore(query, function, alias string, columns []string) (string, *AnnOrdering, error) {
+	name, ok := SimilarityFunctions[strings.ToUpper(function)]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown similarity function: %s", function)
+	}
+	a, err := AnalyzeSelect(query)
+	if err != nil {
+		return "", nil, err
+	}
+	ann := ParseAnnOrdering(a.OrderBy)
+	switch {
+	case ann == nil:
+		return "", nil, fmt.Errorf("not a vector search (no ORDER BY ... ANN OF)")
+	case a.JSON:
+		return "", nil, fmt.Errorf("SELECT JSON returns a single column; the score cannot be added")
+	case a.HasAggregates:
+		return "", nil, fmt.Errorf("aggregate queries cannot select a score")
+	case !strings.HasPrefix(ann.Vector, "["):
+		return "", nil, fmt.Errorf("the query vector must be a literal to be scored")
+	}
+
+	// Locate the select list again to rewrite it in place
+	tokens, err := batch.Lex(query)
+	if err != nil {
+		return "", nil, err
+	}
+	start, end := selectListSpan(tokens)
+	if start < 0 {
+		return "", nil, fmt.Errorf("SELECT is missing a FROM clause")
+	}
+
+	selectList := query[tokens[start].Start:tokens[end].End]
+	if strings.TrimSpace(selectList) == "*" {
+		if len(columns) == 0 {
+			return "", nil, fmt.Errorf("the columns of %s are needed to expand SELECT *", a.Table)
+		}
+		quoted := make([]string, len(columns))
+		for i, c := range columns {
+			quoted[i] = QuoteIdentifier(c)
+		}
+		selectList = strings.Join(quoted, ", ")
+	}
+	score := fmt.Sprintf("%s(%s, %s) AS %s", name, QuoteIdentifier(ann.Column), ann.Vector, QuoteIdentifier(alias))
+	return query[:tokens[start].Start] + selectList + ", " + score + query[tokens[end].End:], ann, nil
+}
+
+// selectListSpan returns the first and last token of the select list, after
+// any JSON or DISTINCT, or -1 when there is no top-level FROM
+func selectListSpan(tokens []batch.Token) (int, int) {
+	pos := 1
+	for _, kw := range []string{"JSON", "DISTINCT"} {
+		if isKeyword(tokens, pos, kw) {
+			pos++
+		}
+	}
+	depth := 0
+	for i := pos; i < len(tokens); i++ {
+		switch tokens[i].Value {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && isKeyword(tokens, i, "FROM") {
+			if i == pos {
+				return -1, -1
+			}
+			return pos, i - 1
+		}
+	}
+	return -1, -1
+}
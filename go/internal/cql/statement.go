@@ -0,0 +1,369 @@
+package cql
+
+import (
+	"strings"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// Statement categories reported by DescribeStatement
+const (
+	CategoryQuery   = "query"   // SELECT
+	CategoryDML     = "dml"     // INSERT, UPDATE, DELETE, BATCH, TRUNCATE
+	CategoryDDL     = "ddl"     // CREATE, ALTER, DROP of schema objects
+	CategoryDCL     = "dcl"     // Roles, users and permissions
+	CategorySession = "session" // USE
+	CategoryShell   = "shell"   // cqlsh commands handled by the client (DESCRIBE, CONSISTENCY, COPY, ...)
+)
+
+// shellCommands are the cqlsh commands that are not sent to the server as CQL
+var shellCommands = map[string]bool{
+	"HELP": true, "?": true, "CONSISTENCY": true, "SERIAL": true, "DESCRIBE": true, "DESC": true,
+	"SHOW": true, "SOURCE": true, "CAPTURE": true, "LOGIN": true, "DEBUG": true, "TRACING": true,
+	"EXPAND": true, "ELAPSED": true, "PAGING": true, "EXIT": true, "QUIT": true, "CLEAR": true,
+	"CLS": true, "HISTORY": true, "COPY": true,
+}
+
+// StatementOptions are the modifiers given on a statement
+type StatementOptions struct {
+	IfExists       bool   `json:"ifExists,omitempty"`
+	IfNotExists    bool   `json:"ifNotExists,omitempty"`
+	OrReplace      bool   `json:"orReplace,omitempty"`
+	JSON           bool   `json:"json,omitempty"`
+	Distinct       bool   `json:"distinct,omitempty"`
+	AllowFiltering bool   `json:"allowFiltering,omitempty"`
+	Conditional    bool   `json:"conditional,omitempty"` // Lightweight transaction (IF ... on INSERT, UPDATE or DELETE)
+	TTL            bool   `json:"ttl,omitempty"`         // USING TTL
+	Timestamp      bool   `json:"timestamp,omitempty"`   // USING TIMESTAMP
+	BatchType      string `json:"batchType,omitempty"`   // LOGGED, UNLOGGED or COUNTER
+
+	// ScyllaDB extensions, which Cassandra rejects
+	Timeout     bool `json:"timeout,omitempty"`     // USING TIMEOUT
+	BypassCache bool `json:"bypassCache,omitempty"` // BYPASS CACHE (SELECT)
+}
+
+// StatementDescriptor is a structured summary of one statement: what it does
+// and which object it targets. It replaces reading the identifier and the
+// second and third tokens of a statement.
+type StatementDescriptor struct {
+	Kind          string           `json:"kind"`                 // Leading keyword: SELECT, INSERT, CREATE, DESCRIBE, ...
+	Category      string           `json:"category,omitempty"`   // One of the Category constants
+	ObjectType    string           `json:"objectType,omitempty"` // TABLE, KEYSPACE, ROLE, USER, PERMISSION or a Kind constant
+	Keyspace      string           `json:"keyspace,omitempty"`
+	Name          string           `json:"name,omitempty"`
+	QualifiedName string           `json:"qualifiedName,omitempty"` // keyspace.name when the keyspace is given
+	Options       StatementOptions `json:"options"`
+	Statements    int              `json:"statements,omitempty"` // Statements inside a BATCH
+	Error         string           `json:"error,omitempty"`      // Set when the statement could not be parsed
+}
+
+// DescribeStatement builds the descriptor of a single statement. Like
+// ParseDDL it is a shallow, token-based parse; statements it does not
+// recognise only get their Kind.
+func DescribeStatement(stmt string) StatementDescriptor {
+	var d StatementDescriptor
+	tokens, err := statementTokens(stmt)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	if len(tokens) == 0 {
+		return d
+	}
+	d.Kind = strings.ToUpper(tokens[0].Value)
+
+	switch d.Kind {
+	case "SELECT":
+		d.Category = CategoryQuery
+		d.ObjectType = KindTable
+		a, err := AnalyzeSelect(stmt)
+		if err != nil {
+			d.Error = err.Error()
+			break
+		}
+		d.setName(a.Keyspace, a.Table)
+		d.Options.JSON = a.JSON
+		d.Options.Distinct = a.Distinct
+		d.Options.AllowFiltering = a.AllowFiltering
+		d.Options.BypassCache = a.BypassCache
+		d.Options.Timeout = a.Timeout != ""
+	case "INSERT":
+		d.Category = CategoryDML
+		d.ObjectType = KindTable
+		if isKeyword(tokens, 1, "INTO") && len(tokens) > 2 {
+			keyspace, name, next := qualifiedName(tokens, 2)
+			d.setName(keyspace, name)
+			d.Options.JSON = isKeyword(tokens, next, "JSON")
+		}
+		scanModifiers(tokens, 1, &d)
+	case "UPDATE":
+		d.Category = CategoryDML
+		d.ObjectType = KindTable
+		if len(tokens) > 1 {
+			keyspace, name, _ := qualifiedName(tokens, 1)
+			d.setName(keyspace, name)
+		}
+		scanModifiers(tokens, 1, &d)
+	case "DELETE":
+		d.Category = CategoryDML
+		d.ObjectType = KindTable
+		for i := 1; i+1 < len(tokens); i++ {
+			if isKeyword(tokens, i, "FROM") {
+				keyspace, name, _ := qualifiedName(tokens, i+1)
+				d.setName(keyspace, name)
+				break
+			}
+		}
+		scanModifiers(tokens, 1, &d)
+	case "TRUNCATE":
+		d.Category = CategoryDML
+		d.ObjectType = KindTable
+		pos := 1
+		if isKeyword(tokens, pos, "TABLE") || isKeyword(tokens, pos, "COLUMNFAMILY") {
+			pos++
+		}
+		if pos < len(tokens) {
+			keyspace, name, _ := qualifiedName(tokens, pos)
+			d.setName(keyspace, name)
+		}
+	case "BEGIN":
+		d.Kind = "BATCH"
+		d.Category = CategoryDML
+		describeBatch(tokens, &d)
+	case "USE":
+		d.Category = CategorySession
+		d.ObjectType = KindKeyspace
+		if len(tokens) > 1 {
+			d.setName("", unquoteName(tokens[1]))
+		}
+	case "CREATE", "ALTER", "DROP":
+		describeSchemaChange(stmt, tokens, &d)
+	case "GRANT", "REVOKE":
+		d.Category = CategoryDCL
+		d.ObjectType = "ROLE"
+		for i := 1; i < len(tokens); i++ {
+			if isKeyword(tokens, i, "ON") {
+				d.ObjectType = "PERMISSION"
+				break
+			}
+		}
+	case "LIST":
+		d.Category = CategoryDCL
+		switch {
+		case isKeyword(tokens, 1, "ROLES"):
+			d.ObjectType = "ROLE"
+		case isKeyword(tokens, 1, "USERS"):
+			d.ObjectType = "USER"
+		default:
+			d.ObjectType = "PERMISSION"
+		}
+	default:
+		if !shellCommands[d.Kind] {
+			break
+		}
+		d.Category = CategoryShell
+		if (d.Kind == "DESCRIBE" || d.Kind == "DESC") && len(tokens) > 1 {
+			describeTarget(tokens, &d)
+		}
+	}
+
+	return d
+}
+
+// setName fills Keyspace, Name and QualifiedName
+func (d *StatementDescriptor) setName(keyspace, name string) {
+	d.Keyspace = keyspace
+	d.Name = name
+	d.QualifiedName = name
+	if keyspace != "" && name != "" {
+		d.QualifiedName = keyspace + "." + name
+	}
+}
+
+// statementTokens lexes a statement and drops line breaks and a trailing semicolon
+func statementTokens(stmt string) ([]batch.Token, error) {
+	lexed, err := batch.Lex(stmt)
+	if err != nil {
+		return nil, err
+	}
+	tokens := lexed[:0]
+	for _, tok := range lexed {
+		if tok.Type != batch.TokenEndline {
+			tokens = append(tokens, tok)
+		}
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].Type == batch.TokenEndtoken {
+		tokens = tokens[:n-1]
+	}
+	return tokens, nil
+}
+
+// scanModifiers records USING TTL / TIMESTAMP and IF conditions found outside
+// parentheses from start onwards
+func scanModifiers(tokens []batch.Token, start int, d *StatementDescriptor) {
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch tokens[i].Value {
+		case "(", "[", "{":
+			depth++
+			continue
+		case ")", "]", "}":
+			depth--
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		switch {
+		case isKeyword(tokens, i, "USING"):
+			// USING TTL n AND TIMESTAMP n AND TIMEOUT 500ms, in any order
+			for j := i + 1; j < len(tokens); {
+				next := j + 2
+				if isKeyword(tokens, j, "TTL") {
+					d.Options.TTL = true
+				} else if isKeyword(tokens, j, "TIMESTAMP") {
+					d.Options.Timestamp = true
+				} else if isKeyword(tokens, j, "TIMEOUT") {
+					d.Options.Timeout = true
+					next = durationEnd(tokens, j+1)
+				} else {
+					break
+				}
+				if !isKeyword(tokens, next, "AND") {
+					break
+				}
+				j = next + 1
+			}
+		case isKeyword(tokens, i, "IF") && !d.Options.Conditional:
+			d.Options.Conditional = true
+			if isKeyword(tokens, i+1, "NOT") && isKeyword(tokens, i+2, "EXISTS") {
+				d.Options.IfNotExists = true
+			} else if isKeyword(tokens, i+1, "EXISTS") {
+				d.Options.IfExists = true
+			}
+		}
+	}
+}
+
+// describeBatch reads BEGIN [UNLOGGED | COUNTER] BATCH [USING TIMESTAMP n]
+// and counts the statements up to APPLY BATCH
+func describeBatch(tokens []batch.Token, d *StatementDescriptor) {
+	d.Options.BatchType = "LOGGED"
+	pos := 1
+	if isKeyword(tokens, pos, "UNLOGGED") || isKeyword(tokens, pos, "COUNTER") || isKeyword(tokens, pos, "LOGGED") {
+		d.Options.BatchType = strings.ToUpper(tokens[pos].Value)
+		pos++
+	}
+	if !isKeyword(tokens, pos, "BATCH") {
+		return
+	}
+	pos++
+	if isKeyword(tokens, pos, "USING") && isKeyword(tokens, pos+1, "TIMESTAMP") {
+		d.Options.Timestamp = true
+		pos += 3
+	}
+
+	// A statement starts right after the header and after each semicolon
+	startsStatement := true
+	for i := pos; i < len(tokens) && !isKeyword(tokens, i, "APPLY"); i++ {
+		if tokens[i].Type == batch.TokenEndtoken {
+			startsStatement = true
+			continue
+		}
+		if startsStatement {
+			kw := strings.ToUpper(tokens[i].Value)
+			if kw == "INSERT" || kw == "UPDATE" || kw == "DELETE" {
+				d.Statements++
+			}
+		}
+		startsStatement = false
+	}
+}
+
+// describeSchemaChange fills in a CREATE, ALTER or DROP statement. Schema
+// objects come from ParseDDL; roles, users and triggers are read here.
+func describeSchemaChange(stmt string, tokens []batch.Token, d *StatementDescriptor) {
+	d.Category = CategoryDDL
+	ddl, err := ParseDDL(stmt)
+	if err != nil {
+		d.Error = err.Error()
+		return
+	}
+	if ddl != nil {
+		d.ObjectType = ddl.Kind
+		d.setName(ddl.Keyspace, ddl.Name)
+		d.Options.OrReplace = ddl.OrReplace
+		if ddl.IfExists && d.Kind == "CREATE" {
+			d.Options.IfNotExists = true
+		} else {
+			d.Options.IfExists = ddl.IfExists
+		}
+		return
+	}
+
+	if len(tokens) < 2 {
+		return
+	}
+	d.ObjectType = strings.ToUpper(tokens[1].Value)
+	if d.ObjectType == "ROLE" || d.ObjectType == "USER" {
+		d.Category = CategoryDCL
+	}
+	pos := 2
+	if isKeyword(tokens, pos, "IF") {
+		if isKeyword(tokens, pos+1, "NOT") {
+			d.Options.IfNotExists = true
+			pos++
+		} else {
+			d.Options.IfExists = true
+		}
+		pos += 2
+	}
+	if pos >= len(tokens) {
+		return
+	}
+	if d.ObjectType == "TRIGGER" {
+		keyspace, name, _ := qualifiedName(tokens, pos)
+		d.setName(keyspace, name)
+		return
+	}
+	d.setName("", unquoteName(tokens[pos]))
+}
+
+// describeTarget reads the object of DESCRIBE TABLE / KEYSPACE / TYPE ... name
+func describeTarget(tokens []batch.Token, d *StatementDescriptor) {
+	kind := strings.ToUpper(tokens[1].Value)
+	pos := 2
+	switch kind {
+	case "KEYSPACE", "TABLE", "TYPE", "INDEX", "FUNCTION", "AGGREGATE":
+		d.ObjectType = kind
+	case "COLUMNFAMILY":
+		d.ObjectType = KindTable
+	case "MATERIALIZED":
+		d.ObjectType = KindView
+		pos++
+	default:
+		// DESCRIBE KEYSPACES, TABLES, CLUSTER, SCHEMA or a bare name
+		if describeListings[kind] {
+			d.ObjectType = kind
+		} else {
+			keyspace, name, _ := qualifiedName(tokens, 1)
+			d.setName(keyspace, name)
+		}
+		return
+	}
+	if pos >= len(tokens) {
+		return
+	}
+	if d.ObjectType == KindKeyspace {
+		d.setName("", unquoteName(tokens[pos]))
+		return
+	}
+	keyspace, name, _ := qualifiedName(tokens, pos)
+	d.setName(keyspace, name)
+}
+
+// describeListings are the DESCRIBE forms that do not name an object
+var describeListings = map[string]bool{
+	"KEYSPACES": true, "TABLES": true, "TYPES": true, "FUNCTIONS": true, "AGGREGATES": true,
+	"CLUSTER": true, "SCHEMA": true, "FULL": true, "INDEXES": true, "VIEWS": true,
+}
@@ -0,0 +1,501 @@
+// Package datagen generates synthetic column values for seeding tables. A
+// column's values follow a distribution over integer keys: numeric columns
+// take the key itself, and other types derive their value from it, so that
+// the range of keys a column draws from sets how many distinct values it
+// has. Rows are generated from the seed and the row number alone, so the
+// same seed produces the same rows whatever order they are generated in.
+package datagen
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+
+	"github.com/axonops/cqlai-node/internal/db"
+)
+
+// Distributions of ColumnSpec
+const (
+	Uniform    = "uniform"    // Any key in [min, max] equally likely
+	Sequential = "sequential" // The row's position: min, min+1, ..., wrapping after max
+	Normal     = "normal"     // Bell curve around mean, clamped to [min, max]
+	Zipf       = "zipf"       // Low keys far more frequent than high ones, by skew
+	Values     = "values"     // One of the given values
+)
+
+// Defaults of ColumnSpec
+const (
+	defaultSkew        = 1.2
+	defaultTextLength  = 12
+	defaultBlobLength  = 16
+	defaultMinElements = 1
+	defaultMaxElements = 3
+	maxGeneratedLength = 1 << 20
+	timestampSpan      = 365 * 24 * time.Hour // Default range of timestamps, up to now
+	dateSpanDays       = 10 * 365             // Default range of dates, up to today
+)
+
+// ColumnSpec controls the values generated for a column. Min and Max bound
+// the keys: the values of numeric columns, milliseconds since the epoch for
+// timestamps, days since the epoch for dates, and for other types the
+// number of distinct values.
+type ColumnSpec struct {
+	Distribution string   `json:"distribution"` // uniform (default), sequential, normal, zipf or values
+	Min          *float64 `json:"min"`
+	Max          *float64 `json:"max"`
+	Mean         *float64 `json:"mean"`      // normal: center (default the middle of the range)
+	StdDev       *float64 `json:"stddev"`    // normal: spread (default a sixth of the range)
+	Skew         float64  `json:"skew"`      // zipf: exponent above 1 (default 1.2)
+	NullRate     float64  `json:"nullRate"`  // Share of rows left null, 0 to 1
+	MinLength    int      `json:"minLength"` // Characters of text, bytes of blobs, elements of collections
+	MaxLength    int      `json:"maxLength"`
+
+	// Choices are the values of the values distribution, converted by the
+	// caller to what the driver binds
+	Choices []interface{} `json:"-"`
+}
+
+// Column generates the values of one column
+type Column struct {
+	Name     string
+	typ      gocql.TypeInfo
+	spec     ColumnSpec
+	salt     uint64 // Mixed into the keys, so columns of the same type differ
+	min, max float64
+	bounded  bool // Min or max was given
+}
+
+// NewColumn checks a column's spec against its type
+func NewColumn(name string, typ gocql.TypeInfo, spec ColumnSpec, seed uint64) (*Column, error) {
+	c := &Column{Name: name, typ: typ, spec: spec, salt: mix(seed ^ hashString(name))}
+	if c.spec.Distribution == "" {
+		c.spec.Distribution = Uniform
+	}
+	switch c.spec.Distribution {
+	case Uniform, Sequential, Normal:
+	case Zipf:
+		if c.spec.Skew == 0 {
+			c.spec.Skew = defaultSkew
+		}
+		if c.spec.Skew <= 1 {
+			return nil, fmt.Errorf("column %s: zipf skew must be above 1", name)
+		}
+	case Values:
+		if len(c.spec.Choices) == 0 {
+			return nil, fmt.Errorf("column %s: the values distribution needs values", name)
+		}
+	default:
+		return nil, fmt.Errorf("column %s: unknown distribution %q", name, c.spec.Distribution)
+	}
+	if c.spec.NullRate < 0 || c.spec.NullRate > 1 {
+		return nil, fmt.Errorf("column %s: nullRate must be between 0 and 1", name)
+	}
+	if c.spec.MinLength < 0 || c.spec.MaxLength < 0 || c.spec.MaxLength > maxGeneratedLength {
+		return nil, fmt.Errorf("column %s: minLength and maxLength must be between 0 and %d", name, maxGeneratedLength)
+	}
+	if err := supported(typ); err != nil {
+		return nil, fmt.Errorf("column %s: %v", name, err)
+	}
+
+	c.min, c.max = defaultRange(typ)
+	if spec.Min != nil {
+		c.min = *spec.Min
+		c.bounded = true
+	}
+	if spec.Max != nil {
+		c.max = *spec.Max
+		c.bounded = true
+	}
+	if c.min > c.max {
+		return nil, fmt.Errorf("column %s: min is above max", name)
+	}
+	if lo, hi, ok := integerBounds(typ); ok && (c.min < lo || c.max > hi) {
+		return nil, fmt.Errorf("column %s: min and max must be between %v and %v", name, lo, hi)
+	}
+	return c, nil
+}
+
+// Value generates the column's value for a row. seq is the position the
+// sequential distribution uses; r is the row's random source.
+func (c *Column) Value(r *rand.Rand, seq int64) interface{} {
+	if c.spec.NullRate > 0 && r.Float64() < c.spec.NullRate {
+		return nil
+	}
+	if c.spec.Distribution == Values {
+		return c.spec.Choices[r.Intn(len(c.spec.Choices))]
+	}
+	return c.valueFor(c.draw(r, seq))
+}
+
+// draw picks a key by the column's distribution
+func (c *Column) draw(r *rand.Rand, seq int64) float64 {
+	switch c.spec.Distribution {
+	case Sequential:
+		return c.sequentialKey(seq)
+	case Normal:
+		mean := (c.min + c.max) / 2
+		if c.spec.Mean != nil {
+			mean = *c.spec.Mean
+		}
+		stddev := (c.max - c.min) / 6
+		if c.spec.StdDev != nil {
+			stddev = *c.spec.StdDev
+		}
+		return math.Min(c.max, math.Max(c.min, r.NormFloat64()*stddev+mean))
+	case Zipf:
+		span := uint64(c.max - c.min)
+		return c.min + float64(rand.NewZipf(r, c.spec.Skew, 1, span).Uint64())
+	}
+	if isFloat(c.typ) {
+		return c.min + r.Float64()*(c.max-c.min)
+	}
+	if !c.bounded && !isNumeric(c.typ) && !isTemporal(c.typ) {
+		// Unbounded keys of other types make every value distinct
+		return float64(r.Int63())
+	}
+	span := uint64(c.max-c.min) + 1
+	if span == 0 {
+		return c.min + float64(r.Uint64())
+	}
+	return c.min + float64(r.Uint64()%span)
+}
+
+// sequentialKey returns the key of a position, wrapping after max
+func (c *Column) sequentialKey(seq int64) float64 {
+	if !c.bounded && !isNumeric(c.typ) && !isTemporal(c.typ) {
+		return float64(seq)
+	}
+	span := int64(c.max-c.min) + 1
+	if span <= 0 {
+		return c.min + float64(seq)
+	}
+	return c.min + float64(seq%span)
+}
+
+// valueFor derives the value of a key. Content beyond the key (text
+// characters, collection elements) comes from a source seeded by the key, so
+// equal keys give equal values.
+func (c *Column) valueFor(key float64) interface{} {
+	src := rand.New(newSplitMix(c.salt ^ math.Float64bits(key)))
+	return generate(c.typ, key, c.spec, src)
+}
+
+// generate builds a value of a type for a key
+func generate(typ gocql.TypeInfo, key float64, spec ColumnSpec, src *rand.Rand) interface{} {
+	n := int64(math.Floor(key))
+	switch typ.Type() {
+	case gocql.TypeAscii, gocql.TypeText, gocql.TypeVarchar:
+		return randomText(src, length(spec, defaultTextLength, src))
+	case gocql.TypeBlob:
+		b := make([]byte, length(spec, defaultBlobLength, src))
+		_, _ = src.Read(b)
+		return b
+	case gocql.TypeBoolean:
+		return n%2 != 0
+	case gocql.TypeTinyInt:
+		return int8(n) // #nosec G115 - bounded by the column's range
+	case gocql.TypeSmallInt:
+		return int16(n) // #nosec G115 - bounded by the column's range
+	case gocql.TypeInt:
+		return int32(n) // #nosec G115 - bounded by the column's range
+	case gocql.TypeBigInt:
+		return n
+	case gocql.TypeVarint:
+		return big.NewInt(n)
+	case gocql.TypeFloat:
+		return float32(key)
+	case gocql.TypeDouble:
+		return key
+	case gocql.TypeDecimal:
+		return db.Decimal(strconv.FormatFloat(key, 'f', 2, 64))
+	case gocql.TypeUUID:
+		var u gocql.UUID
+		_, _ = src.Read(u[:])
+		u[6] = u[6]&0x0f | 0x40 // Version 4
+		u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+		return u
+	case gocql.TypeTimeUUID:
+		return timeUUID(time.UnixMilli(n), src)
+	case gocql.TypeTimestamp:
+		return time.UnixMilli(n).UTC()
+	case gocql.TypeDate:
+		return time.Unix(n*86400, 0).UTC()
+	case gocql.TypeTime:
+		return time.Duration(src.Int63n(int64(24 * time.Hour)))
+	case gocql.TypeDuration:
+		return gocql.Duration{Days: int32(n % 366), Nanoseconds: src.Int63n(int64(24 * time.Hour))} // #nosec G115 - below 366
+	case gocql.TypeInet:
+		ip := make(net.IP, 4)
+		_, _ = src.Read(ip)
+		ip[0] = 10
+		return ip
+	case gocql.TypeList, gocql.TypeSet:
+		coll := typ.(gocql.CollectionType)
+		elems := make([]interface{}, length(spec, 0, src))
+		for i := range elems {
+			elems[i] = element(coll.Elem, src)
+		}
+		return elems
+	case gocql.TypeMap:
+		coll := typ.(gocql.CollectionType)
+		m := make(map[interface{}]interface{})
+		for range length(spec, 0, src) {
+			m[mapKey(element(coll.Key, src))] = element(coll.Elem, src)
+		}
+		return m
+	case gocql.TypeTuple:
+		tuple := typ.(gocql.TupleTypeInfo)
+		elems := make([]interface{}, len(tuple.Elems))
+		for i, elem := range tuple.Elems {
+			elems[i] = element(elem, src)
+		}
+		return elems
+	case gocql.TypeUDT:
+		udt := typ.(gocql.UDTTypeInfo)
+		fields := make(map[string]interface{}, len(udt.Elements))
+		for _, field := range udt.Elements {
+			fields[field.Name] = element(field.Type, src)
+		}
+		return fields
+	case gocql.TypeCustom:
+		vector := typ.(gocql.VectorType)
+		elems := make([]interface{}, vector.Dimensions)
+		for i := range elems {
+			if isFloat(vector.SubType) {
+				elems[i] = generate(vector.SubType, src.Float64()*2-1, ColumnSpec{}, src)
+			} else {
+				elems[i] = element(vector.SubType, src)
+			}
+		}
+		return elems
+	}
+	return nil
+}
+
+// element generates a value nested in a collection, tuple, UDT or vector,
+// with the default range and lengths of its type
+func element(typ gocql.TypeInfo, src *rand.Rand) interface{} {
+	lo, hi := defaultRange(typ)
+	key := float64(src.Int63())
+	switch {
+	case isFloat(typ):
+		key = lo + src.Float64()*(hi-lo)
+	case isNumeric(typ), isTemporal(typ):
+		key = lo + float64(src.Int63n(int64(hi-lo)+1))
+	}
+	return generate(typ, key, ColumnSpec{MinLength: defaultMinElements, MaxLength: defaultMaxElements}, src)
+}
+
+// mapKey returns a map key the driver can hash: blobs and addresses, which
+// are slices, are bound as text
+func mapKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case []byte:
+		return string(k)
+	case net.IP:
+		return k.String()
+	case []interface{}, map[interface{}]interface{}, map[string]interface{}:
+		return fmt.Sprint(k)
+	}
+	return key
+}
+
+// length picks a length in [minLength, maxLength], or the default range
+func length(spec ColumnSpec, fallback int, src *rand.Rand) int {
+	lo, hi := spec.MinLength, spec.MaxLength
+	if lo == 0 && hi == 0 {
+		if fallback > 0 {
+			return fallback
+		}
+		lo, hi = defaultMinElements, defaultMaxElements
+	}
+	hi = max(hi, lo)
+	return lo + src.Intn(hi-lo+1)
+}
+
+// textAlphabet is the characters of generated text
+const textAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// randomText returns n characters of textAlphabet
+func randomText(src *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = textAlphabet[src.Intn(len(textAlphabet))]
+	}
+	return string(b)
+}
+
+// uuidEpoch is the start of version 1 UUID time, 1582-10-15
+var uuidEpoch = time.Date(1582, 10, 15, 0, 0, 0, 0, time.UTC)
+
+// timeUUID returns a version 1 UUID of a time, with a random clock sequence
+// and node from the source
+func timeUUID(t time.Time, src *rand.Rand) gocql.UUID {
+	// In 100ns intervals; the span overflows a time.Duration
+	ticks := uint64(t.Unix()-uuidEpoch.Unix())*1e7 + uint64(t.Nanosecond()/100) // #nosec G115 - after the epoch
+	var u gocql.UUID
+	u[0], u[1], u[2], u[3] = byte(ticks>>24), byte(ticks>>16), byte(ticks>>8), byte(ticks)
+	u[4], u[5] = byte(ticks>>40), byte(ticks>>32)
+	u[6], u[7] = byte(ticks>>56)&0x0f|0x10, byte(ticks>>48)
+	_, _ = src.Read(u[8:])
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// defaultRange is the key range of a type when the spec gives none
+func defaultRange(typ gocql.TypeInfo) (float64, float64) {
+	switch typ.Type() {
+	case gocql.TypeBoolean:
+		return 0, 1
+	case gocql.TypeTinyInt:
+		return 0, 100
+	case gocql.TypeSmallInt:
+		return 0, 10000
+	case gocql.TypeInt:
+		return 0, 1000000
+	case gocql.TypeBigInt, gocql.TypeVarint:
+		return 0, 1000000000
+	case gocql.TypeFloat, gocql.TypeDouble, gocql.TypeDecimal:
+		return 0, 1000
+	case gocql.TypeTimestamp, gocql.TypeTimeUUID:
+		now := time.Now()
+		return float64(now.Add(-timestampSpan).UnixMilli()), float64(now.UnixMilli())
+	case gocql.TypeDate:
+		today := float64(time.Now().Unix() / 86400)
+		return today - dateSpanDays, today
+	}
+	return 0, math.MaxInt64
+}
+
+// supported reports whether values of a type can be generated
+func supported(typ gocql.TypeInfo) error {
+	switch typ.Type() {
+	case gocql.TypeCounter:
+		return fmt.Errorf("counter columns cannot be inserted")
+	case gocql.TypeList, gocql.TypeSet:
+		return supported(typ.(gocql.CollectionType).Elem)
+	case gocql.TypeMap:
+		coll := typ.(gocql.CollectionType)
+		if err := supported(coll.Key); err != nil {
+			return err
+		}
+		return supported(coll.Elem)
+	case gocql.TypeTuple:
+		for _, elem := range typ.(gocql.TupleTypeInfo).Elems {
+			if err := supported(elem); err != nil {
+				return err
+			}
+		}
+	case gocql.TypeUDT:
+		for _, field := range typ.(gocql.UDTTypeInfo).Elements {
+			if err := supported(field.Type); err != nil {
+				return err
+			}
+		}
+	case gocql.TypeCustom:
+		vector, ok := typ.(gocql.VectorType)
+		if !ok {
+			return fmt.Errorf("custom types are not supported")
+		}
+		return supported(vector.SubType)
+	}
+	return nil
+}
+
+// integerBounds returns the range of a fixed-size integer type
+func integerBounds(typ gocql.TypeInfo) (float64, float64, bool) {
+	switch typ.Type() {
+	case gocql.TypeTinyInt:
+		return math.MinInt8, math.MaxInt8, true
+	case gocql.TypeSmallInt:
+		return math.MinInt16, math.MaxInt16, true
+	case gocql.TypeInt:
+		return math.MinInt32, math.MaxInt32, true
+	}
+	return 0, 0, false
+}
+
+// isNumeric reports whether a type's values are its keys
+func isNumeric(typ gocql.TypeInfo) bool {
+	switch typ.Type() {
+	case gocql.TypeBoolean, gocql.TypeTinyInt, gocql.TypeSmallInt, gocql.TypeInt, gocql.TypeBigInt, gocql.TypeVarint:
+		return true
+	}
+	return isFloat(typ)
+}
+
+// isFloat reports whether a type takes fractional keys
+func isFloat(typ gocql.TypeInfo) bool {
+	switch typ.Type() {
+	case gocql.TypeFloat, gocql.TypeDouble, gocql.TypeDecimal:
+		return true
+	}
+	return false
+}
+
+// isTemporal reports whether a type's keys are points in time
+func isTemporal(typ gocql.TypeInfo) bool {
+	switch typ.Type() {
+	case gocql.TypeTimestamp, gocql.TypeTimeUUID, gocql.TypeDate:
+		return true
+	}
+	return false
+}
+
+// splitMix is the SplitMix64 generator: cheap to seed, so every row and
+// every derived value can have a source of its own
+type splitMix struct {
+	state uint64
+}
+
+func newSplitMix(seed uint64) *splitMix {
+	return &splitMix{state: seed}
+}
+
+func (s *splitMix) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return mix(s.state)
+}
+
+func (s *splitMix) Int63() int64 {
+	return int64(s.Uint64() >> 1) // #nosec G115 - 63 bits
+}
+
+func (s *splitMix) Seed(seed int64) {
+	s.state = uint64(seed) // #nosec G115 - any seed will do
+}
+
+// mix is SplitMix64's finalizer, a bijective scramble of 64 bits
+func mix(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// hashString is the FNV-1a hash of a string
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// RowSource returns the random source of a row, the same for a seed and row
+// however rows are spread over workers
+func RowSource(seed uint64, row int64) *rand.Rand {
+	return rand.New(newSplitMix(mix(seed ^ mix(uint64(row))))) // #nosec G115 - rows are non-negative
+}
+
+// PartitionSource returns the random source of a partition's key, which every
+// row of the partition shares
+func PartitionSource(seed uint64, partition int64) *rand.Rand {
+	return RowSource(^seed, partition)
+}
@@ -0,0 +1,122 @@
+package datagen
+
+import (
+	"reflect"
+	"testing"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+func parseType(t *testing.T, name string) gocql.TypeInfo {
+	t.Helper()
+	return gocql.NewNativeType(4, gocql.TypeCustom, name)
+}
+
+func TestGeneratedValuesMarshal(t *testing.T) {
+	address := gocql.UDTTypeInfo{Keyspace: "app", Name: "address", Elements: []gocql.UDTField{
+		{Name: "street", Type: parseType(t, "text")},
+		{Name: "zip", Type: parseType(t, "int")},
+		{Name: "tags", Type: parseType(t, "set<text>")},
+	}}
+	types := map[string]gocql.TypeInfo{
+		"address":   address,
+		"embedding": gocql.VectorType{SubType: parseType(t, "float"), Dimensions: 8},
+		"pair":      gocql.TupleTypeInfo{Elems: []gocql.TypeInfo{parseType(t, "bigint"), parseType(t, "inet")}},
+	}
+	for _, name := range []string{"ascii", "text", "blob", "boolean", "tinyint", "smallint", "int", "bigint", "varint",
+		"float", "double", "decimal", "uuid", "timeuuid", "timestamp", "date", "time", "duration", "inet",
+		"list<int>", "set<uuid>", "map<text, frozen<list<double>>>", "map<blob, inet>", "map<inet, date>"} {
+		types[name] = parseType(t, name)
+	}
+
+	for name, typ := range types {
+		col, err := NewColumn(name, typ, ColumnSpec{}, 7)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for row := int64(0); row < 20; row++ {
+			v := col.Value(RowSource(7, row), row)
+			if v == nil {
+				t.Fatalf("%s: nil value", name)
+			}
+			if _, err := gocql.Marshal(typ, v); err != nil {
+				t.Fatalf("%s: cannot marshal %#v: %v", name, v, err)
+			}
+		}
+	}
+
+	if _, err := NewColumn("hits", parseType(t, "counter"), ColumnSpec{}, 7); err == nil {
+		t.Errorf("counter column accepted")
+	}
+}
+
+func TestDistributions(t *testing.T) {
+	lo, hi := 10.0, 20.0
+	for _, dist := range []string{Uniform, Sequential, Normal, Zipf} {
+		col, err := NewColumn("n", parseType(t, "int"), ColumnSpec{Distribution: dist, Min: &lo, Max: &hi}, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", dist, err)
+		}
+		for row := int64(0); row < 500; row++ {
+			if v := col.Value(RowSource(1, row), row).(int32); v < 10 || v > 20 {
+				t.Fatalf("%s: %d outside [10, 20]", dist, v)
+			}
+		}
+	}
+
+	seq, _ := NewColumn("n", parseType(t, "int"), ColumnSpec{Distribution: Sequential, Min: &lo, Max: &hi}, 1)
+	if got := []interface{}{seq.Value(nil, 0), seq.Value(nil, 10), seq.Value(nil, 11)}; !reflect.DeepEqual(got, []interface{}{int32(10), int32(20), int32(10)}) {
+		t.Errorf("sequential values %v", got)
+	}
+
+	// Bounded keys of other types set the number of distinct values
+	few := 3.0
+	zero := 0.0
+	names, _ := NewColumn("name", parseType(t, "text"), ColumnSpec{Min: &zero, Max: &few}, 1)
+	distinct := make(map[string]bool)
+	for row := int64(0); row < 200; row++ {
+		distinct[names.Value(RowSource(1, row), row).(string)] = true
+	}
+	if len(distinct) != 4 {
+		t.Errorf("%d distinct names, want 4", len(distinct))
+	}
+
+	choices, _ := NewColumn("status", parseType(t, "text"), ColumnSpec{Distribution: Values, Choices: []interface{}{"new", "done"}, NullRate: 0.5}, 1)
+	nulls := 0
+	for row := int64(0); row < 1000; row++ {
+		switch v := choices.Value(RowSource(1, row), row); v {
+		case nil:
+			nulls++
+		case "new", "done":
+		default:
+			t.Fatalf("value %v not among the choices", v)
+		}
+	}
+	if nulls < 400 || nulls > 600 {
+		t.Errorf("%d nulls in 1000 rows at nullRate 0.5", nulls)
+	}
+
+	big := 1000.0
+	if _, err := NewColumn("n", parseType(t, "tinyint"), ColumnSpec{Max: &big}, 1); err == nil {
+		t.Errorf("tinyint max 1000 accepted")
+	}
+}
+
+func TestRowsAreReproducible(t *testing.T) {
+	col, _ := NewColumn("body", parseType(t, "map<text, blob>"), ColumnSpec{MinLength: 2, MaxLength: 5}, 99)
+	for row := int64(0); row < 50; row++ {
+		a := col.Value(RowSource(99, row), row)
+		b := col.Value(RowSource(99, row), row)
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("row %d differs between runs", row)
+		}
+		if n := len(a.(map[interface{}]interface{})); n < 1 || n > 5 {
+			t.Fatalf("row %d: %d map entries", row, n)
+		}
+	}
+
+	keys, _ := NewColumn("id", parseType(t, "uuid"), ColumnSpec{Distribution: Sequential}, 99)
+	if reflect.DeepEqual(keys.Value(nil, 1), keys.Value(nil, 2)) || !reflect.DeepEqual(keys.Value(nil, 1), keys.Value(nil, 1)) {
+		t.Errorf("sequential uuids are not distinct per position")
+	}
+}
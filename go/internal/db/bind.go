@@ -0,0 +1,212 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// Decimal is a decimal value in its text form (12.34, -1.5e3), bound as a
+// query value. The driver only marshals decimals from inf.Dec, so Decimal
+// encodes itself.
+type Decimal string
+
+// MarshalCQL encodes the decimal as a scale and an unscaled varint
+func (d Decimal) MarshalCQL(info gocql.TypeInfo) ([]byte, error) {
+	unscaled, scale, err := parseDecimal(string(d))
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4, 4+len(unscaled.Bytes())+1)
+	binary.BigEndian.PutUint32(buf, uint32(scale)) // #nosec G115 - two's complement of the scale
+	return append(buf, encodeVarint(unscaled)...), nil
+}
+
+// parseDecimal splits a decimal into its unscaled digits and scale
+func parseDecimal(s string) (*big.Int, int32, error) {
+	s = strings.TrimSpace(s)
+	if !decimalPattern.MatchString(s) {
+		return nil, 0, fmt.Errorf("not a valid decimal: %s", s)
+	}
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return nil, 0, fmt.Errorf("not a valid decimal: %s", s)
+		}
+		exp = e
+		s = s[:i]
+	}
+	digits, frac, _ := strings.Cut(s, ".")
+	unscaled, ok := new(big.Int).SetString(digits+frac, 10)
+	if !ok {
+		return nil, 0, fmt.Errorf("not a valid decimal: %s", s)
+	}
+	return unscaled, int32(len(frac) - exp), nil // #nosec G115 - bounded by the text length
+}
+
+// encodeVarint encodes x as a big-endian two's complement integer in the
+// fewest bytes, the CQL varint encoding
+func encodeVarint(x *big.Int) []byte {
+	switch x.Sign() {
+	case 0:
+		return []byte{0}
+	case 1:
+		b := x.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	n := new(big.Int).Not(x).BitLen()/8 + 1
+	b := new(big.Int).Add(x, new(big.Int).Lsh(big.NewInt(1), uint(n*8))).Bytes() // #nosec G115 - n is positive
+	for len(b) < n {
+		b = append([]byte{0xff}, b...)
+	}
+	return b
+}
+
+var durationUnitPattern = regexp.MustCompile(`(\d+)(y|mo|w|d|h|ms|m|us|µs|ns|s)`)
+
+// parseCQLDuration parses a duration in the cqlsh form (1y2mo3d4h) or ISO
+// 8601 form (P1Y2M3DT4H) into months, days and nanoseconds
+func parseCQLDuration(s string) (gocql.Duration, error) {
+	s = strings.TrimSpace(s)
+	var d gocql.Duration
+	neg := strings.HasPrefix(s, "-")
+	body := strings.TrimPrefix(s, "-")
+
+	if strings.HasPrefix(body, "P") {
+		m := isoDurationPattern.FindStringSubmatch(s)
+		if m == nil {
+			return d, fmt.Errorf("not a valid duration: %s", s)
+		}
+		num := func(part string) int64 {
+			n, _ := strconv.ParseInt(strings.TrimRight(part, "YMWDHS"), 10, 64)
+			return n
+		}
+		d.Months = int32(num(m[1])*12 + num(m[2])) // #nosec G115 - duration months are 32 bit
+		d.Days = int32(num(m[3])*7 + num(m[4]))    // #nosec G115 - duration days are 32 bit
+		d.Nanoseconds = num(m[6])*int64(time.Hour) + num(m[7])*int64(time.Minute)
+		if m[8] != "" {
+			secs, err := strconv.ParseFloat(strings.TrimSuffix(m[8], "S"), 64)
+			if err != nil {
+				return d, fmt.Errorf("not a valid duration: %s", s)
+			}
+			d.Nanoseconds += int64(secs * float64(time.Second))
+		}
+	} else {
+		if !durationPattern.MatchString(s) {
+			return d, fmt.Errorf("not a valid duration: %s", s)
+		}
+		for _, m := range durationUnitPattern.FindAllStringSubmatch(body, -1) {
+			n, err := strconv.ParseInt(m[1], 10, 64)
+			if err != nil {
+				return d, fmt.Errorf("not a valid duration: %s", s)
+			}
+			switch m[2] {
+			case "y":
+				d.Months += int32(n * 12) // #nosec G115 - duration months are 32 bit
+			case "mo":
+				d.Months += int32(n) // #nosec G115 - duration months are 32 bit
+			case "w":
+				d.Days += int32(n * 7) // #nosec G115 - duration days are 32 bit
+			case "d":
+				d.Days += int32(n) // #nosec G115 - duration days are 32 bit
+			case "h":
+				d.Nanoseconds += n * int64(time.Hour)
+			case "m":
+				d.Nanoseconds += n * int64(time.Minute)
+			case "s":
+				d.Nanoseconds += n * int64(time.Second)
+			case "ms":
+				d.Nanoseconds += n * int64(time.Millisecond)
+			case "us", "µs":
+				d.Nanoseconds += n * int64(time.Microsecond)
+			case "ns":
+				d.Nanoseconds += n
+			}
+		}
+	}
+	if neg {
+		d.Months, d.Days, d.Nanoseconds = -d.Months, -d.Days, -d.Nanoseconds
+	}
+	return d, nil
+}
+
+// bindable converts a coerced value to what the driver marshals for its
+// type: decimals and durations, which Coerce returns as text, are encoded,
+// and map keys, which Coerce returns as text, are typed again
+func bindable(v interface{}, t *CQLTypeInfo) (interface{}, error) {
+	if v == nil || t == nil {
+		return v, nil
+	}
+	switch t.BaseType {
+	case "decimal":
+		if s, ok := v.(string); ok {
+			return Decimal(s), nil
+		}
+	case "duration":
+		if s, ok := v.(string); ok {
+			return parseCQLDuration(s)
+		}
+	case "list", "set":
+		if elems, ok := v.([]interface{}); ok && len(t.Parameters) == 1 {
+			return bindableElements(elems, t.Parameters[0])
+		}
+	case "tuple":
+		if elems, ok := v.([]interface{}); ok {
+			out := make([]interface{}, len(elems))
+			for i, elem := range elems {
+				b, err := bindable(elem, t.Parameters[i])
+				if err != nil {
+					return nil, err
+				}
+				out[i] = b
+			}
+			return out, nil
+		}
+	case "map":
+		if m, ok := v.(map[string]interface{}); ok && len(t.Parameters) == 2 {
+			out := make(map[interface{}]interface{}, len(m))
+			for k, val := range m {
+				key, err := coerceValue(k, t.Parameters[0])
+				if err != nil {
+					return nil, fmt.Errorf("map key %s: %v", k, err)
+				}
+				if key, err = bindable(key, t.Parameters[0]); err != nil {
+					return nil, err
+				}
+				if !reflect.TypeOf(key).Comparable() {
+					return nil, fmt.Errorf("%s map keys cannot be bound", t.Parameters[0].BaseType)
+				}
+				if val, err = bindable(val, t.Parameters[1]); err != nil {
+					return nil, err
+				}
+				out[key] = val
+			}
+			return out, nil
+		}
+	}
+	return v, nil
+}
+
+// bindableElements converts the elements of a list, set or vector
+func bindableElements(elems []interface{}, t *CQLTypeInfo) ([]interface{}, error) {
+	out := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		b, err := bindable(elem, t)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = b
+	}
+	return out, nil
+}
@@ -0,0 +1,430 @@
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// Coercer converts text values, as found in CSV files, to the Go value for a
+// CQL column type. Collection, tuple and UDT values are accepted in the cqlsh
+// literal form ([1, 2], {'a': 1}, (1, 'x'), {field: 1}) and in the JSON form
+// written by COPY TO.
+type Coercer struct {
+	Type      string // CQL type the coercer was built for
+	info      *CQLTypeInfo
+	dimension int // vector dimension; info holds the element type
+}
+
+// timestampLayouts are the accepted timestamp formats, tried in order
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+var (
+	durationPattern    = regexp.MustCompile(`^-?(\d+(y|mo|w|d|h|ms|m|us|µs|ns|s))+$`)
+	isoDurationPattern = regexp.MustCompile(`^-?P(\d+Y)?(\d+M)?(\d+W)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+	vectorTypePattern  = regexp.MustCompile(`^(?i)vector\s*<\s*(.+)\s*,\s*(\d+)\s*>$`)
+	decimalPattern     = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+)
+
+// NewCoercer builds a coercer for a CQL type as written in the schema, e.g.
+// "int", "frozen<map<text, int>>" or "vector<float, 3>"
+func NewCoercer(cqlType string) (*Coercer, error) {
+	c := &Coercer{Type: cqlType}
+	if m := vectorTypePattern.FindStringSubmatch(strings.TrimSpace(cqlType)); m != nil {
+		elem, err := ParseCQLType(m[1])
+		if err != nil {
+			return nil, err
+		}
+		c.dimension, _ = strconv.Atoi(m[2])
+		c.info = elem
+		return c, nil
+	}
+	info, err := ParseCQLType(cqlType)
+	if err != nil {
+		return nil, err
+	}
+	c.info = info
+	return c, nil
+}
+
+// Coerce converts a value. An empty string is only valid for text and blob
+// types; callers handle their NULL marker before calling Coerce.
+func (c *Coercer) Coerce(value string) (interface{}, error) {
+	if c.dimension > 0 {
+		elems, err := splitLiteral(value, '[', ']')
+		if err != nil {
+			return nil, err
+		}
+		if len(elems) != c.dimension {
+			return nil, fmt.Errorf("vector has %d elements, expected %d", len(elems), c.dimension)
+		}
+		return coerceElements(elems, c.info)
+	}
+	return coerceValue(value, c.info)
+}
+
+// CoerceJSON converts a JSON value, as sent for a bind variable, to a value
+// the driver can bind. null is nil, a string is taken as the text of the
+// value, and numbers, booleans, arrays and objects are converted from their
+// JSON text, so large integers keep their precision.
+func (c *Coercer) CoerceJSON(raw json.RawMessage) (interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		raw = []byte(s)
+	}
+	return c.CoerceBindable(string(raw))
+}
+
+// CoerceBindable converts a value as Coerce does, to a value the driver can
+// bind: vectors become slices of their bindable elements
+func (c *Coercer) CoerceBindable(value string) (interface{}, error) {
+	v, err := c.Coerce(value)
+	if err != nil {
+		return nil, err
+	}
+	if c.dimension > 0 {
+		return bindableElements(v.([]interface{}), c.info)
+	}
+	return bindable(v, c.info)
+}
+
+// coerceValue converts a single value to the given type
+func coerceValue(value string, t *CQLTypeInfo) (interface{}, error) {
+	switch t.BaseType {
+	case "text", "varchar":
+		if !utf8.ValidString(value) {
+			return nil, fmt.Errorf("invalid UTF-8")
+		}
+		return value, nil
+	case "ascii":
+		for i := 0; i < len(value); i++ {
+			if value[i] > 127 {
+				return nil, fmt.Errorf("non-ASCII character at byte %d", i)
+			}
+		}
+		return value, nil
+	case "blob":
+		if value == "" {
+			return []byte{}, nil
+		}
+		if !strings.HasPrefix(strings.ToLower(value), "0x") {
+			return nil, fmt.Errorf("blob must be hex with a 0x prefix")
+		}
+		b, err := hex.DecodeString(value[2:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex: %v", err)
+		}
+		return b, nil
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("empty value for %s", t.BaseType)
+	}
+
+	switch t.BaseType {
+	case "tinyint", "smallint", "int", "bigint", "counter":
+		bits := map[string]int{"tinyint": 8, "smallint": 16, "int": 32, "bigint": 64, "counter": 64}[t.BaseType]
+		n, err := strconv.ParseInt(value, 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("not a valid %s", t.BaseType)
+		}
+		return n, nil
+	case "varint":
+		n, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("not a valid varint")
+		}
+		return n, nil
+	case "float", "double":
+		bits := 64
+		if t.BaseType == "float" {
+			bits = 32
+		}
+		var f float64
+		switch value {
+		case "NaN":
+			f = math.NaN()
+		case "Infinity", "+Infinity":
+			f = math.Inf(1)
+		case "-Infinity":
+			f = math.Inf(-1)
+		default:
+			parsed, err := strconv.ParseFloat(value, bits)
+			if err != nil {
+				return nil, fmt.Errorf("not a valid %s", t.BaseType)
+			}
+			f = parsed
+		}
+		// gocql marshals float columns only from float32
+		if bits == 32 {
+			return float32(f), nil
+		}
+		return f, nil
+	case "decimal":
+		// Returned as text: a validated decimal is also a valid CQL literal
+		if !decimalPattern.MatchString(value) {
+			return nil, fmt.Errorf("not a valid decimal")
+		}
+		return value, nil
+	case "boolean":
+		switch strings.ToLower(value) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("boolean must be true or false")
+	case "uuid", "timeuuid":
+		u, err := gocql.ParseUUID(value)
+		if err != nil {
+			return nil, fmt.Errorf("not a valid UUID")
+		}
+		if t.BaseType == "timeuuid" && u.Version() != 1 {
+			return nil, fmt.Errorf("timeuuid must be a version 1 UUID, got version %d", u.Version())
+		}
+		return u, nil
+	case "timestamp":
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.UnixMilli(ms).UTC(), nil
+		}
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, value); err == nil {
+				return ts, nil
+			}
+		}
+		return nil, fmt.Errorf("not a valid timestamp")
+	case "date":
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("date must be yyyy-mm-dd")
+		}
+		return d, nil
+	case "time":
+		if ns, err := strconv.ParseInt(value, 10, 64); err == nil {
+			if ns < 0 || ns >= int64(24*time.Hour) {
+				return nil, fmt.Errorf("time out of range")
+			}
+			return time.Duration(ns), nil
+		}
+		tm, err := time.Parse("15:04:05.999999999", value)
+		if err != nil {
+			return nil, fmt.Errorf("time must be hh:mm:ss[.fffffffff]")
+		}
+		return time.Duration(tm.Hour())*time.Hour + time.Duration(tm.Minute())*time.Minute +
+			time.Duration(tm.Second())*time.Second + time.Duration(tm.Nanosecond()), nil
+	case "duration":
+		if !durationPattern.MatchString(value) && !isoDurationPattern.MatchString(value) {
+			return nil, fmt.Errorf("not a valid duration (e.g. 1h30m or PT1H30M)")
+		}
+		return value, nil
+	case "inet":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("not a valid IP address")
+		}
+		return ip, nil
+	case "list", "set":
+		opening, closing := byte('['), byte(']')
+		if t.BaseType == "set" && strings.HasPrefix(value, "{") {
+			opening, closing = '{', '}'
+		}
+		elems, err := splitLiteral(value, opening, closing)
+		if err != nil {
+			return nil, err
+		}
+		return coerceElements(elems, t.Parameters[0])
+	case "map":
+		entries, err := splitLiteral(value, '{', '}')
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(entries))
+		for _, entry := range entries {
+			k, v, ok := splitPair(entry)
+			if !ok {
+				return nil, fmt.Errorf("map entry %q is not key: value", entry)
+			}
+			key, err := coerceValue(unquoteLiteral(k), t.Parameters[0])
+			if err != nil {
+				return nil, fmt.Errorf("map key %s: %v", k, err)
+			}
+			val, err := coerceValue(unquoteLiteral(v), t.Parameters[1])
+			if err != nil {
+				return nil, fmt.Errorf("map value for %s: %v", k, err)
+			}
+			m[fmt.Sprint(key)] = val
+		}
+		return m, nil
+	case "tuple":
+		opening, closing := byte('('), byte(')')
+		if strings.HasPrefix(value, "[") {
+			opening, closing = '[', ']'
+		}
+		elems, err := splitLiteral(value, opening, closing)
+		if err != nil {
+			return nil, err
+		}
+		if len(elems) > len(t.Parameters) {
+			return nil, fmt.Errorf("tuple has %d elements, expected at most %d", len(elems), len(t.Parameters))
+		}
+		out := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			v, err := coerceValue(unquoteLiteral(elem), t.Parameters[i])
+			if err != nil {
+				return nil, fmt.Errorf("tuple element %d: %v", i, err)
+			}
+			out[i] = v
+		}
+		return out, nil
+	case "udt":
+		// Field types come from the keyspace schema, so only the structure is checked
+		entries, err := splitLiteral(value, '{', '}')
+		if err != nil {
+			return nil, err
+		}
+		fields := make(map[string]interface{}, len(entries))
+		for _, entry := range entries {
+			k, v, ok := splitPair(entry)
+			if !ok {
+				return nil, fmt.Errorf("%s field %q is not name: value", t.UDTName, entry)
+			}
+			fields[unquoteLiteral(k)] = unquoteLiteral(v)
+		}
+		return fields, nil
+	}
+
+	// Custom and unknown types are passed through for the server to check
+	return value, nil
+}
+
+// coerceElements converts each element of a list, set or vector
+func coerceElements(elems []string, t *CQLTypeInfo) ([]interface{}, error) {
+	out := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		v, err := coerceValue(unquoteLiteral(elem), t)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %v", i, err)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// splitLiteral removes the enclosing brackets from a collection literal and
+// splits it on top-level commas, respecting quotes and nested brackets
+func splitLiteral(value string, opening, closing byte) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != opening || value[len(value)-1] != closing {
+		return nil, fmt.Errorf("expected a value enclosed in %c%c", opening, closing)
+	}
+	body := value[1 : len(value)-1]
+	if strings.TrimSpace(body) == "" {
+		return []string{}, nil
+	}
+
+	var parts []string
+	depth := 0
+	var quote byte
+	start := 0
+	for i := 0; i < len(body); i++ {
+		ch := body[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				if i+1 < len(body) && body[i+1] == quote {
+					i++ // doubled quote
+				} else {
+					quote = 0
+				}
+			} else if ch == '\\' && quote == '"' {
+				i++
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '[' || ch == '{' || ch == '(':
+			depth++
+		case ch == ']' || ch == '}' || ch == ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced %c", ch)
+			}
+		case ch == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(body[start:i]))
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced brackets")
+	}
+	return append(parts, strings.TrimSpace(body[start:])), nil
+}
+
+// splitPair splits a "key: value" entry at the first top-level colon
+func splitPair(entry string) (string, string, bool) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(entry); i++ {
+		ch := entry[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '[' || ch == '{' || ch == '(':
+			depth++
+		case ch == ']' || ch == '}' || ch == ')':
+			depth--
+		case ch == ':' && depth == 0:
+			return strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// unquoteLiteral strips CQL single quotes or JSON double quotes from an element
+func unquoteLiteral(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
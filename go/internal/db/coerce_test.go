@@ -0,0 +1,178 @@
+package db
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+func TestCoercer(t *testing.T) {
+	tests := []struct {
+		cqlType string
+		value   string
+		wantErr bool
+	}{
+		{"int", "42", false},
+		{"int", " 42 ", false},
+		{"int", "4.2", true},
+		{"int", "3000000000", true},
+		{"tinyint", "128", true},
+		{"bigint", "3000000000", false},
+		{"varint", "123456789012345678901234567890", false},
+		{"double", "1.5e10", false},
+		{"double", "NaN", false},
+		{"float", "abc", true},
+		{"decimal", "12.345", false},
+		{"decimal", "12,345", true},
+		{"boolean", "TRUE", false},
+		{"boolean", "yes", true},
+		{"text", "", false},
+		{"int", "", true},
+		{"ascii", "héllo", true},
+		{"blob", "0xCAFE", false},
+		{"blob", "CAFE", true},
+		{"uuid", "5b6e2f1c-4a3b-4c2d-8e1f-0a1b2c3d4e5f", false},
+		{"uuid", "not-a-uuid", true},
+		{"timeuuid", "5b6e2f1c-4a3b-4c2d-8e1f-0a1b2c3d4e5f", true},
+		{"timeuuid", "e7b4a3c0-0b1d-11ef-8000-000000000000", false},
+		{"timestamp", "2024-05-01T10:00:00Z", false},
+		{"timestamp", "2024-05-01 10:00:00.123+0000", false},
+		{"timestamp", "1714557600000", false},
+		{"timestamp", "yesterday", true},
+		{"date", "2024-05-01", false},
+		{"date", "01/05/2024", true},
+		{"time", "10:30:00.5", false},
+		{"time", "25:00:00", true},
+		{"duration", "1h30m", false},
+		{"duration", "PT1H30M", false},
+		{"duration", "90 minutes", true},
+		{"inet", "10.0.0.1", false},
+		{"inet", "::1", false},
+		{"inet", "10.0.0.300", true},
+		{"list<int>", "[1, 2, 3]", false},
+		{"list<int>", "[1, 'x']", true},
+		{"list<int>", "1, 2", true},
+		{"set<text>", "{'a', 'b,c'}", false},
+		{"set<text>", `["a", "b"]`, false},
+		{"frozen<map<text, int>>", "{'a': 1, 'b': 2}", false},
+		{"map<text, int>", `{"a": 1}`, false},
+		{"map<text, int>", "{'a': 'x'}", true},
+		{"map<text, int>", "{'a' 1}", true},
+		{"tuple<int, text>", "(1, 'x')", false},
+		{"tuple<int, text>", "(1, 'x', 3)", true},
+		{"frozen<address>", "{street: 'Main', zip: 1}", false},
+		{"frozen<address>", "[1]", true},
+		{"vector<float, 3>", "[0.1, 0.2, 0.3]", false},
+		{"vector<float, 3>", "[0.1, 0.2]", true},
+		{"list<frozen<list<int>>>", "[[1, 2], [3]]", false},
+		{"list<text>", "['unterminated]", true},
+	}
+
+	for _, tt := range tests {
+		c, err := NewCoercer(tt.cqlType)
+		if err != nil {
+			t.Fatalf("NewCoercer(%q): %v", tt.cqlType, err)
+		}
+		_, err = c.Coerce(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s %q: err = %v, wantErr %v", tt.cqlType, tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCoercerJSON(t *testing.T) {
+	tests := []struct {
+		cqlType string
+		raw     string
+		want    interface{}
+		wantErr bool
+	}{
+		{"int", "42", int64(42), false},
+		{"bigint", "9007199254740993", int64(9007199254740993), false},
+		{"bigint", `"9007199254740993"`, int64(9007199254740993), false},
+		{"text", `"it's"`, "it's", false},
+		{"text", "null", nil, false},
+		{"boolean", "true", true, false},
+		{"int", `"x"`, nil, true},
+		{"list<int>", "[1, 2]", []interface{}{int64(1), int64(2)}, false},
+		{"map<int, text>", `{"1": "a"}`, map[interface{}]interface{}{int64(1): "a"}, false},
+		{"decimal", "19.99", Decimal("19.99"), false},
+		{"duration", `"1d2h"`, gocql.Duration{Days: 1, Nanoseconds: int64(2 * time.Hour)}, false},
+		{"duration", `"P1Y2M"`, gocql.Duration{Months: 14}, false},
+	}
+
+	for _, tt := range tests {
+		c, err := NewCoercer(tt.cqlType)
+		if err != nil {
+			t.Fatalf("NewCoercer(%q): %v", tt.cqlType, err)
+		}
+		got, err := c.CoerceJSON([]byte(tt.raw))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s %s: err = %v, wantErr %v", tt.cqlType, tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s = %#v, want %#v", tt.cqlType, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestVectorRoundTrip(t *testing.T) {
+	vec := gocql.VectorType{SubType: gocql.NewNativeType(4, gocql.TypeFloat, ""), Dimensions: 3}
+	typ := formatTypeInfo(vec)
+	if typ != "vector<float, 3>" {
+		t.Fatalf("formatTypeInfo = %q, want vector<float, 3>", typ)
+	}
+
+	c, err := NewCoercer(typ)
+	if err != nil {
+		t.Fatalf("NewCoercer(%q): %v", typ, err)
+	}
+	// As COPY TO writes a []float32
+	v, err := c.CoerceBindable("[0.5,1.5,-2]")
+	if err != nil {
+		t.Fatalf("CoerceBindable: %v", err)
+	}
+	data, err := vec.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal(%#v): %v", v, err)
+	}
+	if want := []byte{0x3f, 0, 0, 0, 0x3f, 0xc0, 0, 0, 0xc0, 0, 0, 0}; !bytes.Equal(data, want) {
+		t.Errorf("Marshal = %x, want %x", data, want)
+	}
+
+	if _, err := c.CoerceBindable("[0.5, 1.5]"); err == nil {
+		t.Error("CoerceBindable accepted a vector of the wrong dimension")
+	}
+}
+
+func TestDecimalMarshalCQL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []byte
+	}{
+		{"12.34", []byte{0, 0, 0, 2, 0x04, 0xd2}},
+		{"-1", []byte{0, 0, 0, 0, 0xff}},
+		{"128", []byte{0, 0, 0, 0, 0x00, 0x80}},
+		{"-129", []byte{0, 0, 0, 0, 0xff, 0x7f}},
+		{"1.5e3", []byte{0xff, 0xff, 0xff, 0xfe, 0x0f}},
+		{"-.5", []byte{0, 0, 0, 1, 0xfb}},
+	}
+
+	for _, tt := range tests {
+		got, err := Decimal(tt.value).MarshalCQL(nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.value, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s = % x, want % x", tt.value, got, tt.want)
+		}
+	}
+	if _, err := Decimal("1,5").MarshalCQL(nil); err == nil {
+		t.Error("1,5: expected an error")
+	}
+}
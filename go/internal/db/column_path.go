@@ -0,0 +1,237 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PathStepKind is the kind of a step of a column path
+type PathStepKind int
+
+const (
+	StepField PathStepKind = iota // .field of a user type
+	StepIndex                     // [n] of a list, set, tuple or vector, or an integer map key
+	StepKey                       // ['key'] of a map
+)
+
+// PathStep is one step of a column path
+type PathStep struct {
+	Kind  PathStepKind
+	Field string // Field name (StepField) or map key (StepKey)
+	Index int    // StepIndex
+}
+
+// String returns the step as written in a path
+func (s PathStep) String() string {
+	switch s.Kind {
+	case StepField:
+		return "." + s.Field
+	case StepIndex:
+		return "[" + strconv.Itoa(s.Index) + "]"
+	}
+	return "['" + strings.ReplaceAll(s.Field, "'", "''") + "']"
+}
+
+// ColumnPath is a JSON-style path to a value nested in a user type or
+// collection column: address.city, phones[0].number, attrs['color'].
+// Unquoted names are case-insensitive, as in CQL; "Quoted" names are kept.
+type ColumnPath struct {
+	Path   string // As written
+	Column string
+	Steps  []PathStep
+}
+
+// ParseColumnPath parses a column path
+func ParseColumnPath(path string) (*ColumnPath, error) {
+	p := &ColumnPath{Path: path}
+	column, rest, err := readPathName(strings.TrimSpace(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q: %v", path, err)
+	}
+	p.Column = column
+
+	for rest != "" {
+		var step PathStep
+		switch rest[0] {
+		case '.':
+			step.Kind = StepField
+			step.Field, rest, err = readPathName(rest[1:])
+		case '[':
+			step, rest, err = readPathSubscript(rest[1:])
+		default:
+			err = fmt.Errorf("unexpected %q", rest[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %v", path, err)
+		}
+		p.Steps = append(p.Steps, step)
+	}
+	return p, nil
+}
+
+// readPathName reads a quoted or unquoted name from the start of s
+func readPathName(s string) (name, rest string, err error) {
+	if strings.HasPrefix(s, `"`) {
+		return readQuoted(s[1:], '"')
+	}
+	end := 0
+	for end < len(s) {
+		c := s[end]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' {
+			end++
+			continue
+		}
+		break
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("expected a name")
+	}
+	return strings.ToLower(s[:end]), s[end:], nil
+}
+
+// readQuoted reads up to the closing quote, where a doubled quote stands for
+// one, and returns the text after it
+func readQuoted(s string, quote byte) (text, rest string, err error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != quote {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			b.WriteByte(quote)
+			i++
+			continue
+		}
+		return b.String(), s[i+1:], nil
+	}
+	return "", "", fmt.Errorf("unterminated %c", quote)
+}
+
+// readPathSubscript reads [n] or ['key'] after its opening bracket
+func readPathSubscript(s string) (step PathStep, rest string, err error) {
+	if strings.HasPrefix(s, "'") || strings.HasPrefix(s, `"`) {
+		step.Kind = StepKey
+		if step.Field, rest, err = readQuoted(s[1:], s[0]); err != nil {
+			return step, "", err
+		}
+	} else {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return step, "", fmt.Errorf("unterminated [")
+		}
+		step.Kind = StepIndex
+		if step.Index, err = strconv.Atoi(strings.TrimSpace(s[:end])); err != nil || step.Index < 0 {
+			return step, "", fmt.Errorf("index must be a non-negative integer or a quoted key, got %q", s[:end])
+		}
+		rest = s[end:]
+	}
+	if !strings.HasPrefix(rest, "]") {
+		return step, "", fmt.Errorf("expected ]")
+	}
+	return step, rest[1:], nil
+}
+
+// FieldsOnly reports whether the path only selects user type fields, which
+// the server can select itself
+func (p *ColumnPath) FieldsOnly() bool {
+	for _, step := range p.Steps {
+		if step.Kind != StepField {
+			return false
+		}
+	}
+	return len(p.Steps) > 0
+}
+
+// Extract follows the path into a column value as the driver decodes it:
+// user types as map[string]interface{}, lists, sets and tuples as slices and
+// maps as Go maps. ok is false when a step finds nothing, such as an index
+// past the end of a list or a null along the way.
+func (p *ColumnPath) Extract(value interface{}) (result interface{}, ok bool) {
+	for _, step := range p.Steps {
+		if value == nil {
+			return nil, false
+		}
+		if value, ok = step.apply(value); !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// apply takes one step into a value
+func (s PathStep) apply(value interface{}) (interface{}, bool) {
+	if m, isUDT := value.(map[string]interface{}); isUDT && s.Kind != StepIndex {
+		v, found := m[s.Field]
+		return v, found
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if s.Kind == StepField {
+			return nil, false
+		}
+		key := s.Field
+		if s.Kind == StepIndex {
+			key = strconv.Itoa(s.Index)
+		}
+		// Keys are matched in their text form so any key type can be named
+		iter := rv.MapRange()
+		for iter.Next() {
+			if fmt.Sprint(iter.Key().Interface()) == key {
+				return iter.Value().Interface(), true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if s.Kind != StepIndex || rv.Type().Elem().Kind() == reflect.Uint8 { // Blobs are not indexed
+			return nil, false
+		}
+		if s.Index < rv.Len() {
+			return rv.Index(s.Index).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// ResolveType returns the type of the value the path selects from a column of
+// type col, or an error when a step does not fit the type it is applied to.
+// lookup returns the definition of a user type; keyspace qualifies user types
+// named without one.
+func (p *ColumnPath) ResolveType(col *CQLTypeInfo, keyspace string, lookup func(keyspace, name string) (*UDTDefinition, error)) (*CQLTypeInfo, error) {
+	t := col
+	for _, step := range p.Steps {
+		switch {
+		case step.Kind == StepField && t.BaseType == "udt":
+			ks := t.Keyspace
+			if ks == "" {
+				ks = keyspace
+			}
+			def, err := lookup(ks, t.UDTName)
+			if err != nil {
+				return nil, err
+			}
+			field, _, err := def.GetFieldByName(step.Field)
+			if err != nil {
+				return nil, err
+			}
+			if field.TypeInfo == nil {
+				if field.TypeInfo, err = ParseCQLType(field.TypeStr); err != nil {
+					return nil, err
+				}
+			}
+			t = field.TypeInfo
+		case step.Kind == StepIndex && (t.BaseType == "list" || t.BaseType == "set" || t.BaseType == "vector"):
+			t = t.Parameters[0]
+		case step.Kind == StepIndex && t.BaseType == "tuple" && step.Index < len(t.Parameters):
+			t = t.Parameters[step.Index]
+		case step.Kind != StepField && t.BaseType == "map":
+			t = t.Parameters[1]
+		default:
+			return nil, fmt.Errorf("%s: %s does not apply to %s", p.Path, step, t)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseColumnPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		column  string
+		steps   []PathStep
+		wantErr bool
+	}{
+		{path: "address", column: "address"},
+		{path: "Address.City", column: "address", steps: []PathStep{{Kind: StepField, Field: "city"}}},
+		{path: `"Address"."City"`, column: "Address", steps: []PathStep{{Kind: StepField, Field: "City"}}},
+		{path: "phones[0].number", column: "phones", steps: []PathStep{{Kind: StepIndex}, {Kind: StepField, Field: "number"}}},
+		{path: "attrs['it''s']", column: "attrs", steps: []PathStep{{Kind: StepKey, Field: "it's"}}},
+		{path: `attrs["color"][2]`, column: "attrs", steps: []PathStep{{Kind: StepKey, Field: "color"}, {Kind: StepIndex, Index: 2}}},
+		{path: "", wantErr: true},
+		{path: "a.", wantErr: true},
+		{path: "a[-1]", wantErr: true},
+		{path: "a[x]", wantErr: true},
+		{path: "a['x'", wantErr: true},
+		{path: "a b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := ParseColumnPath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Column != tt.column || !reflect.DeepEqual(p.Steps, tt.steps) {
+				t.Errorf("got column %q steps %+v, want %q %+v", p.Column, p.Steps, tt.column, tt.steps)
+			}
+		})
+	}
+}
+
+func TestColumnPathExtract(t *testing.T) {
+	value := map[string]interface{}{
+		"city":   "Lyon",
+		"phones": []map[string]interface{}{{"number": "555-0100"}},
+		"scores": map[int]string{7: "seven"},
+		"tags":   map[string][]string{"colors": {"red", "blue"}},
+		"blob":   []byte{1, 2},
+		"zip":    nil,
+	}
+	tests := []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"a.city", "Lyon", true},
+		{"a.phones[0].number", "555-0100", true},
+		{"a.phones[1].number", nil, false},
+		{"a.scores[7]", "seven", true},
+		{"a.scores['7']", "seven", true},
+		{"a.tags['colors'][1]", "blue", true},
+		{"a.blob[0]", nil, false},
+		{"a.zip.code", nil, false},
+		{"a.missing", nil, false},
+		{"a.city[0]", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := ParseColumnPath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := p.Extract(value)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestColumnPathResolveType(t *testing.T) {
+	types := map[string]*UDTDefinition{
+		"ks.address": {Keyspace: "ks", Name: "address", Fields: []UDTField{
+			{Name: "city", TypeStr: "text"},
+			{Name: "phones", TypeStr: "list<frozen<phone>>"},
+		}},
+		"ks.phone": {Keyspace: "ks", Name: "phone", Fields: []UDTField{
+			{Name: "number", TypeStr: "text"},
+		}},
+	}
+	lookup := func(keyspace, name string) (*UDTDefinition, error) {
+		if def, ok := types[keyspace+"."+name]; ok {
+			return def, nil
+		}
+		return nil, fmt.Errorf("type %s.%s not found", keyspace, name)
+	}
+
+	tests := []struct {
+		path    string
+		column  string
+		want    string
+		wantErr bool
+	}{
+		{"a.city", "frozen<address>", "text", false},
+		{"a.phones[0].number", "address", "text", false},
+		{"a.phones[0]", "address", "frozen<phone>", false},
+		{"m['k']", "map<text, int>", "int", false},
+		{"t[1]", "tuple<int, text>", "text", false},
+		{"t[2]", "tuple<int, text>", "", true},
+		{"a.zip", "address", "", true},
+		{"l.x", "list<int>", "", true},
+		{"l['k']", "list<int>", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := ParseColumnPath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			col, err := ParseCQLType(tt.column)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.ResolveType(col, "ks", lookup)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ResolveType = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
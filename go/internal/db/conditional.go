@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/cql"
+)
+
+// AppliedColumn is the column the server adds to the result of a lightweight
+// transaction, true when its condition held and the write was made
+const AppliedColumn = "[applied]"
+
+// isConditionalWrite reports whether a statement is an INSERT, UPDATE or
+// DELETE with an IF condition
+func isConditionalWrite(query string) bool {
+	d := cql.DescribeStatement(query)
+	switch d.Kind {
+	case "INSERT", "UPDATE", "DELETE":
+		return d.Options.Conditional
+	}
+	return false
+}
+
+// executeConditional runs a lightweight transaction. Its result has the
+// [applied] column and, when the condition did not hold, the current values of
+// the columns the condition checked; Applied is set from the first row.
+func (s *Session) executeConditional(ctx context.Context, query string, opts *QueryOptions) interface{} {
+	startTime := time.Now()
+	q := s.queryWith(ctx, query, opts)
+	observer := s.observeExecution(q)
+	iter := q.Iter()
+
+	columns := iter.Columns()
+	headers := make([]string, len(columns))
+	columnTypes := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.Name
+		columnTypes[i] = "unknown"
+		if col.TypeInfo != nil {
+			columnTypes[i] = formatTypeInfo(col.TypeInfo)
+		}
+	}
+
+	data := [][]string{headers}
+	rawData := make([]map[string]interface{}, 0, 1)
+	for {
+		rowMap := make(map[string]interface{})
+		if !iter.MapScan(rowMap) {
+			break
+		}
+		rawRow := make(map[string]interface{}, len(columns))
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			rawRow[col.Name] = rowMap[col.Name]
+			row[i] = FormatValue(rowMap[col.Name])
+		}
+		rawData = append(rawData, rawRow)
+		data = append(data, row)
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("query failed: %v", err)
+	}
+
+	// Every lightweight transaction answers with a row; a missing one is
+	// reported as not applied rather than guessed
+	applied := false
+	if len(rawData) > 0 {
+		applied, _ = rawData[0][AppliedColumn].(bool)
+	}
+	return QueryResult{
+		Data:        data,
+		RawData:     rawData,
+		Duration:    time.Since(startTime),
+		RowCount:    len(rawData),
+		ColumnTypes: columnTypes,
+		Headers:     headers,
+		Execution:   observer.Info(iter),
+		Applied:     &applied,
+	}
+}
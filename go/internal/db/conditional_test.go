@@ -0,0 +1,23 @@
+package db
+
+import "testing"
+
+func TestIsConditionalWrite(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"INSERT INTO ks.users (id, email) VALUES (1, 'a') IF NOT EXISTS", true},
+		{"update users SET email = 'b' WHERE id = 1 IF email = 'a'", true},
+		{"DELETE FROM users WHERE id = 1 IF EXISTS", true},
+		{"INSERT INTO users (id, note) VALUES (1, 'IF NOT EXISTS')", false},
+		{"UPDATE users SET tags = tags + {'if'} WHERE id = 1", false},
+		{"CREATE TABLE IF NOT EXISTS users (id int PRIMARY KEY)", false},
+		{"SELECT * FROM users", false},
+	}
+	for _, tt := range tests {
+		if got := isConditionalWrite(tt.query); got != tt.want {
+			t.Errorf("isConditionalWrite(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
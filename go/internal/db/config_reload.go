@@ -0,0 +1,175 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/config"
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// defaultPageSize is used when neither the config file nor the caller sets one
+const defaultPageSize = 100
+
+// ConfigReload reports how a reloaded config was applied to a session
+type ConfigReload struct {
+	Changed []string `json:"changed"` // Settings that differ from the previous config
+	Applied []string `json:"applied"` // In effect for the next query
+	Pending []string `json:"pending"` // In effect once the session reconnects (e.g. USE <keyspace>)
+	Ignored []string `json:"ignored"` // Overridden by the session or only used by new sessions
+}
+
+// EffectiveConfig is the merged configuration a session is actually using:
+// defaults, cqlshrc, the JSON config file, environment variables, connection
+// options and settings changed on the session
+type EffectiveConfig struct {
+	ConfigFile        string           `json:"configFile,omitempty"` // JSON config file the session was created from
+	Host              string           `json:"host"`
+	Port              int              `json:"port"`
+	Keyspace          string           `json:"keyspace"`
+	Username          string           `json:"username"`
+	Consistency       string           `json:"consistency"`
+	SerialConsistency string           `json:"serialConsistency"`
+	PageSize          int              `json:"pageSize"`
+	RequestTimeout    int              `json:"requestTimeout"` // Seconds, for the current connection
+	ConnectTimeout    int              `json:"connectTimeout"` // Seconds, for the current connection
+	SSL               bool             `json:"ssl"`
+	ContactPoints     []string         `json:"contactPoints"`
+	LoadBalancing     string           `json:"loadBalancing"`     // e.g. "token-aware dc-aware (dc1)"
+	AI                *config.AIConfig `json:"ai,omitempty"`      // API keys are redacted
+	Pending           []string         `json:"pending,omitempty"` // Reloaded settings waiting for a reconnect
+}
+
+// ApplyConfig applies the reloadable settings of a reloaded config file.
+// Settings given as connection options, or changed on the session (PAGING),
+// take precedence over the file and are left alone. Timeouts are read by the
+// driver when connecting, so they apply from the next reconnect. It only
+// changes settings guarded by settingsMu and may run while queries execute.
+func (s *Session) ApplyConfig(cfg *config.Config, changed []string) ConfigReload {
+	reload := ConfigReload{
+		Changed: changed,
+		Applied: []string{},
+		Pending: []string{},
+		Ignored: []string{},
+	}
+
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	var logFilesErr error
+	logFilesApplied := false
+	for _, setting := range changed {
+		switch {
+		case setting == "pageSize":
+			if s.pageSizeFixed {
+				reload.Ignored = append(reload.Ignored, setting)
+				continue
+			}
+			s.pageSize = cfg.PageSize
+			if s.pageSize <= 0 {
+				s.pageSize = defaultPageSize
+			}
+			reload.Applied = append(reload.Applied, setting)
+		case setting == "requestTimeout":
+			if s.requestTimeoutFixed {
+				reload.Ignored = append(reload.Ignored, setting)
+				continue
+			}
+			s.nextTimeout = configTimeout(cfg.RequestTimeout)
+			reload.Pending = append(reload.Pending, setting)
+		case setting == "connectTimeout":
+			if s.connectTimeoutFixed {
+				reload.Ignored = append(reload.Ignored, setting)
+				continue
+			}
+			s.nextConnectTimeout = configTimeout(cfg.ConnectTimeout)
+			reload.Pending = append(reload.Pending, setting)
+		case setting == "ai" || strings.HasPrefix(setting, "ai."):
+			if s.config != nil {
+				s.config.AI = cfg.AI
+			}
+			reload.Applied = append(reload.Applied, setting)
+		case setting == "historyFile" || setting == "logFiles" || strings.HasPrefix(setting, "logFiles."):
+			if !logFilesApplied {
+				logFilesErr, logFilesApplied = applyLogFiles(cfg), true
+				if logFilesErr != nil {
+					logger.DebugfToFile("Config", "Cannot apply log files: %v", logFilesErr)
+				}
+			}
+			if logFilesErr != nil {
+				reload.Ignored = append(reload.Ignored, setting)
+				continue
+			}
+			reload.Applied = append(reload.Applied, setting)
+		default:
+			reload.Ignored = append(reload.Ignored, setting)
+		}
+	}
+	return reload
+}
+
+// useNextTimeouts puts the timeouts a config reload changed into the cluster
+// config, before SetKeyspace or Reconnect connects with it
+func (s *Session) useNextTimeouts() {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	s.cluster.Timeout = s.nextTimeout
+	s.cluster.ConnectTimeout = s.nextConnectTimeout
+}
+
+// applyLogFiles configures the log files of the process from a config that
+// sets them. Log files are shared by all sessions; a config without them
+// leaves them as they are.
+func applyLogFiles(cfg *config.Config) error {
+	files, err := cfg.LogFileSettings()
+	if err != nil || files == nil {
+		return err
+	}
+	return logger.ConfigureFiles(files)
+}
+
+// configTimeout converts a timeout in seconds from the config file, applying
+// the 10 second default used at connection time
+func configTimeout(seconds int) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// EffectiveConfig returns the configuration the session is using
+func (s *Session) EffectiveConfig() EffectiveConfig {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+
+	eff := EffectiveConfig{
+		ConfigFile:        s.configFile,
+		Host:              s.host,
+		Keyspace:          s.cluster.Keyspace,
+		Username:          s.username,
+		Consistency:       s.consistency.String(),
+		SerialConsistency: s.serialConsistency.String(),
+		PageSize:          s.pageSize,
+		RequestTimeout:    int(s.activeTimeout / time.Second),
+		ConnectTimeout:    int(s.activeConnectTimeout / time.Second),
+		SSL:               s.cluster.SslOpts != nil,
+		ContactPoints:     s.contactPoints,
+		LoadBalancing:     s.loadBalancing.String(),
+	}
+	if s.config != nil {
+		eff.Port = s.config.Port
+		eff.AI = s.config.AI.Redacted()
+	}
+	if s.nextTimeout != s.activeTimeout {
+		eff.Pending = append(eff.Pending, "requestTimeout")
+	}
+	if s.nextConnectTimeout != s.activeConnectTimeout {
+		eff.Pending = append(eff.Pending, "connectTimeout")
+	}
+	return eff
+}
+
+// ConfigFile returns the JSON config file the session was created from, if any
+func (s *Session) ConfigFile() string {
+	return s.configFile
+}
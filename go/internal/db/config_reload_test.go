@@ -0,0 +1,95 @@
+package db
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/config"
+)
+
+// reloadSession is a session without a cluster connected with 10 second timeouts
+func reloadSession() *Session {
+	cluster := gocql.NewCluster("127.0.0.1")
+	cluster.Timeout = 10 * time.Second
+	cluster.ConnectTimeout = 10 * time.Second
+	return &Session{
+		cluster:              cluster,
+		pageSize:             100,
+		activeTimeout:        cluster.Timeout,
+		activeConnectTimeout: cluster.ConnectTimeout,
+		nextTimeout:          cluster.Timeout,
+		nextConnectTimeout:   cluster.ConnectTimeout,
+	}
+}
+
+func TestApplyConfigLeavesClusterConfigToReconnect(t *testing.T) {
+	s := reloadSession()
+	cfg := &config.Config{PageSize: 250, RequestTimeout: 30, ConnectTimeout: 5}
+
+	reload := s.ApplyConfig(cfg, []string{"pageSize", "requestTimeout", "connectTimeout", "host"})
+	if !reflect.DeepEqual(reload.Applied, []string{"pageSize"}) ||
+		!reflect.DeepEqual(reload.Pending, []string{"requestTimeout", "connectTimeout"}) ||
+		!reflect.DeepEqual(reload.Ignored, []string{"host"}) {
+		t.Errorf("reload = %+v", reload)
+	}
+	if s.PageSize() != 250 {
+		t.Errorf("page size %d, want 250", s.PageSize())
+	}
+
+	// The driver's cluster config is untouched until a reconnect uses it
+	if s.cluster.Timeout != 10*time.Second || s.cluster.ConnectTimeout != 10*time.Second {
+		t.Errorf("cluster timeouts changed to %v/%v by the reload", s.cluster.Timeout, s.cluster.ConnectTimeout)
+	}
+	if eff := s.EffectiveConfig(); !reflect.DeepEqual(eff.Pending, []string{"requestTimeout", "connectTimeout"}) || eff.RequestTimeout != 10 {
+		t.Errorf("effective config has pending %v, request timeout %d", eff.Pending, eff.RequestTimeout)
+	}
+
+	s.useNextTimeouts()
+	if s.cluster.Timeout != 30*time.Second || s.cluster.ConnectTimeout != 5*time.Second {
+		t.Errorf("cluster timeouts %v/%v before reconnecting, want 30s/5s", s.cluster.Timeout, s.cluster.ConnectTimeout)
+	}
+}
+
+func TestApplyConfigKeepsFixedSettings(t *testing.T) {
+	s := reloadSession()
+	s.SetPageSize(20)
+	s.requestTimeoutFixed = true
+
+	reload := s.ApplyConfig(&config.Config{PageSize: 250, RequestTimeout: 30}, []string{"pageSize", "requestTimeout"})
+	if !reflect.DeepEqual(reload.Ignored, []string{"pageSize", "requestTimeout"}) {
+		t.Errorf("ignored %v, want both", reload.Ignored)
+	}
+	if s.PageSize() != 20 || len(s.EffectiveConfig().Pending) != 0 {
+		t.Errorf("page size %d, pending %v", s.PageSize(), s.EffectiveConfig().Pending)
+	}
+}
+
+// Reloads run on the watcher goroutine while the handle is in use; run with
+// -race
+func TestApplyConfigConcurrentWithReconnectConfig(t *testing.T) {
+	s := reloadSession()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				switch g {
+				case 0:
+					s.ApplyConfig(&config.Config{PageSize: i + 1, RequestTimeout: i%5 + 1}, []string{"pageSize", "requestTimeout"})
+				case 1:
+					s.useNextTimeouts() // As SetKeyspace does under the exclusive lock
+				case 2:
+					_ = s.EffectiveConfig()
+				case 3:
+					_ = s.PageSize()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// ConsistencyDowngrade reports that a read was retried at a lower consistency
+// level because the requested one could not be met
+type ConsistencyDowngrade struct {
+	From   string `json:"from"`             // Consistency level the read was issued at
+	To     string `json:"to"`               // Consistency level that served the result
+	Reason string `json:"reason,omitempty"` // Unavailable error returned at the requested level
+}
+
+// consistencyRank orders the regular consistency levels by how many replicas
+// they wait for. Local and global quorums are ranked below EACH_QUORUM and
+// ALL since they need fewer replicas overall.
+var consistencyRank = map[gocql.Consistency]int{
+	gocql.Any:         0,
+	gocql.One:         1,
+	gocql.LocalOne:    1,
+	gocql.Two:         2,
+	gocql.Three:       3,
+	gocql.LocalQuorum: 4,
+	gocql.Quorum:      5,
+	gocql.EachQuorum:  6,
+	gocql.All:         7,
+}
+
+// parseConsistency parses a regular (non-serial) consistency level name
+func parseConsistency(level string) (gocql.Consistency, error) {
+	consistency, err := gocql.ParseConsistencyWrapper(level)
+	if _, regular := consistencyRank[consistency]; err != nil || !regular {
+		return 0, fmt.Errorf("invalid consistency level: %s", level)
+	}
+	return consistency, nil
+}
+
+// ValidConsistency reports whether level names a regular consistency level
+func ValidConsistency(level string) bool {
+	_, err := parseConsistency(level)
+	return err == nil
+}
+
+// consistencyFallbackPolicy retries a read once at the fallback level when
+// the coordinator answers Unavailable, the classic downgrading retry. An
+// Unavailable error is returned before any replica is contacted, so the
+// retry cannot apply anything twice. A policy belongs to a single query;
+// speculative executions of that query share it.
+type consistencyFallbackPolicy struct {
+	fallback gocql.Consistency
+
+	mu        sync.Mutex
+	query     gocql.RetryableQuery
+	downgrade *ConsistencyDowngrade
+}
+
+// Attempt implements gocql.RetryPolicy. The retry is bounded by
+// GetRetryType, which downgrades at most once.
+func (p *consistencyFallbackPolicy) Attempt(q gocql.RetryableQuery) bool {
+	p.mu.Lock()
+	p.query = q
+	p.mu.Unlock()
+	return true
+}
+
+// GetRetryType implements gocql.RetryPolicy. The driver calls it right after
+// Attempt, so the consistency is only lowered when the error calls for it.
+func (p *consistencyFallbackPolicy) GetRetryType(err error) gocql.RetryType {
+	var unavailable *gocql.RequestErrUnavailable
+	if !errors.As(err, &unavailable) || unavailable.Alive == 0 {
+		return gocql.Rethrow
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.downgrade != nil || p.query == nil {
+		return gocql.Rethrow
+	}
+	current := p.query.GetConsistency()
+	if consistencyRank[p.fallback] >= consistencyRank[current] {
+		return gocql.Rethrow
+	}
+	p.query.SetConsistency(p.fallback)
+	p.downgrade = &ConsistencyDowngrade{From: current.String(), To: p.fallback.String(), Reason: err.Error()}
+	return gocql.Retry
+}
+
+// downgraded returns the downgrade made for the query, or nil when it ran at
+// the requested level
+func (p *consistencyFallbackPolicy) downgraded() *ConsistencyDowngrade {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.downgrade
+}
+
+// ConsistencyFallback returns the level reads are retried at when the
+// session consistency cannot be met, or "" when fallback is disabled
+func (s *Session) ConsistencyFallback() string {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	if s.consistencyFallback == nil {
+		return ""
+	}
+	return s.consistencyFallback.String()
+}
+
+// SetConsistencyFallback sets the level reads are retried at once when the
+// coordinator reports the requested consistency cannot be met; "" disables
+// the retry. Writes are never downgraded.
+func (s *Session) SetConsistencyFallback(level string) error {
+	var fallback *gocql.Consistency
+	if level != "" {
+		consistency, err := parseConsistency(level)
+		if err != nil {
+			return err
+		}
+		fallback = &consistency
+	}
+	s.settingsMu.Lock()
+	s.consistencyFallback = fallback
+	s.settingsMu.Unlock()
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
@@ -16,21 +17,113 @@ import (
 	"github.com/axonops/cqlai-node/internal/logger"
 )
 
+// Auto-fetch row caps. Every row of an auto-fetched query is held in memory
+// and returned at once, so the cap is bounded.
+const (
+	DefaultAutoFetchMaxRows = 100000
+	MaxAutoFetchRows        = 1000000
+)
+
 // Session is a wrapper around the gocql.Session.
+//
+// A Session may be shared by several goroutines (the Node host drives a single
+// handle from multiple worker threads). The embedded gocql.Session is safe for
+// concurrent use; the per-session settings below are guarded by settingsMu and
+// must only be accessed through their getters and setters. SetKeyspace swaps the
+// embedded session and therefore must not run concurrently with queries; the
+// bindings layer serializes it with a per-handle lock.
 type Session struct {
 	*gocql.Session
+	settingsMu       sync.RWMutex // Guards consistency, serialConsistency, pageSize, tracing, autoFetch, autoFetchMaxRows, expand, udtRegistry, lastTraceID
 	cluster          *gocql.ClusterConfig
 	consistency      gocql.Consistency
 	pageSize         int
 	tracing          bool
 	autoFetch        bool   // Auto-fetch all pages without scroll pauses
+	autoFetchMaxRows int    // Row cap for auto-fetch; 0 = DefaultAutoFetchMaxRows
 	expand           bool   // Expand mode (vertical row display)
 	username         string // Current connection username
 	host             string // Connection host
 	cassandraVersion string
 	schemaCache      *SchemaCache
+	schemaCacheMode  string // SchemaCacheFull, SchemaCacheKeyspace or SchemaCacheOff
+	schemaCacheDir   string // Directory a full schema cache is saved in; "" when not persisted
 	udtRegistry      *UDTRegistry
 	lastTraceID      []byte // Store the last trace ID for retrieval
+
+	// Consistency of the Paxos phase of lightweight transactions (SERIAL or
+	// LOCAL_SERIAL). Guarded by settingsMu.
+	serialConsistency gocql.Consistency
+
+	// Speculative execution policy applied to idempotent reads; nil when
+	// disabled. Set once at creation, so it is read without settingsMu.
+	speculative *gocql.SimpleSpeculativeExecution
+
+	// Level reads are retried at when the coordinator reports the session
+	// consistency cannot be met; nil when disabled. Guarded by settingsMu.
+	consistencyFallback *gocql.Consistency
+
+	// Contact points and load balancing options. Set once at creation, so
+	// they are read without settingsMu.
+	contactPoints []string
+	loadBalancing LoadBalancingOptions
+
+	// Time a statement may take, all of its pages included; 0 when
+	// unlimited. Guarded by settingsMu.
+	queryTimeout time.Duration
+
+	// Forwards keyspace/table drop events from the driver; survives SetKeyspace
+	// because it is registered on the cluster config
+	schemaDrops *schemaDropListener
+
+	// Forwards user type changes from the driver, registered the same way
+	udtChanges *udtChangeListener
+
+	// Forwards every schema change from the driver, registered the same way
+	schemaChanges *schemaChangeListener
+
+	// Dials every connection through an SNI proxy (Astra); nil when the
+	// session connects directly. Set once at creation.
+	sni *sniDialer
+
+	// Per-coordinator error rates and the circuit breaker. Fed by observer
+	// and wrapped around the host selection policy of each driver session.
+	health *hostHealth
+
+	// Default query and batch observer, registered on the cluster config;
+	// also writes each attempt to the debug log under the workspace's
+	// redaction policy (statement_log.go)
+	observer *sessionObserver
+
+	// Whether system_virtual_schema exists, determined once on first use
+	virtualTablesOnce      sync.Once
+	virtualTablesSupported bool
+	scyllaOnce             sync.Once
+	scyllaVersion          string
+
+	// Merged configuration the session was created from, updated by
+	// ApplyConfig when the config file is reloaded. Settings given as
+	// connection options, or changed on the session, are not taken from the
+	// file again.
+	config              *config.Config
+	configFile          string
+	pageSizeFixed       bool
+	requestTimeoutFixed bool
+	connectTimeoutFixed bool
+
+	// Timeouts of the current connection, and the ones the next reconnect
+	// uses once a config reload changed them. Guarded by settingsMu, so a
+	// reload never writes the cluster config a reconnect is reading.
+	activeTimeout        time.Duration
+	activeConnectTimeout time.Duration
+	nextTimeout          time.Duration
+	nextConnectTimeout   time.Duration
+
+	// Schema snapshot metadata is read from while the schema is pinned; nil
+	// when the session follows the live schema (schema_pin.go)
+	pinMu     sync.RWMutex
+	pin       *schemaPin
+	pinHooked bool // The schema change handler that records divergence is registered
 }
 
 // SessionOptions represents options for creating a session with command-line overrides
@@ -43,9 +136,46 @@ type SessionOptions struct {
 	Consistency    string // Default consistency level (e.g., "LOCAL_ONE", "QUORUM")
 	SSL            *config.SSLConfig
 	BatchMode      bool   // Skip schema caching for batch mode
+	SchemaCache    string // Schema cache mode: "full" (default), "keyspace" or "off"; ignored in batch mode
+	SchemaCacheDir string // Directory to save a full schema cache in between connections ("" = not saved)
 	ConnectTimeout int    // Connection timeout in seconds (0 = use default)
 	RequestTimeout int    // Request timeout in seconds (0 = use default)
 	ConfigFile     string // Path to custom config file
+
+	// Time a statement may take, all of its pages included (0 = no limit).
+	// RequestTimeout bounds each request the statement makes.
+	QueryTimeout time.Duration
+
+	// Contact points besides Host, as "host" or "host:port" (Port when
+	// omitted), and how coordinators are picked (nil = round-robin); see
+	// load_balancing.go
+	Hosts         []string
+	LoadBalancing *LoadBalancingOptions
+
+	// Connect through an SNI proxy, such as Astra's, instead of to Host;
+	// requires SSL. See sni.go.
+	SNIProxy *SNIProxyOptions
+
+	// TCP keepalive period of driver connections (0 = the Go default of
+	// 15s); see heartbeat.go
+	SocketKeepalive time.Duration
+
+	// Speculative execution for reads: start up to SpeculativeAttempts extra
+	// executions on other coordinators, SpeculativeDelay apart (0 = disabled)
+	SpeculativeAttempts int
+	SpeculativeDelay    time.Duration
+
+	// Consistency level to retry a read at, once, when the requested level
+	// cannot be met ("" = disabled). Must be a level ValidConsistency accepts.
+	ConsistencyFallback string
+
+	// Client-side circuit breaker that avoids coordinators with a high error
+	// rate (nil = disabled); see host_health.go
+	CircuitBreaker *CircuitBreakerOptions
+
+	// Workspace whose redaction policy applies to statements the session
+	// logs ("" = the default policy); see logger.SetRedactionPolicy
+	Workspace string
 }
 
 // NewSession creates a new Cassandra session.
@@ -53,14 +183,6 @@ func NewSession() (*Session, error) {
 	return NewSessionWithOptions(SessionOptions{})
 }
 
-// customLogger suppresses gocql error messages to prevent terminal corruption
-type customLogger struct{}
-
-func (c *customLogger) Error(msg string, fields ...gocql.LogField)   {}
-func (c *customLogger) Warning(msg string, fields ...gocql.LogField) {}
-func (c *customLogger) Info(msg string, fields ...gocql.LogField)    {}
-func (c *customLogger) Debug(msg string, fields ...gocql.LogField)   {}
-
 // NewSessionWithOptions creates a new Cassandra session with command-line overrides.
 func NewSessionWithOptions(options SessionOptions) (*Session, error) {
 	// Also redirect standard log output to discard
@@ -120,10 +242,27 @@ func NewSessionWithOptions(options SessionOptions) (*Session, error) {
 	logger.DebugfToFile("Session", "Final config for connection: host=%s:%d, username=%s, keyspace=%s, hasPassword=%v", 
 		cfg.Host, cfg.Port, cfg.Username, cfg.Keyspace, cfg.Password != "")
 
+	if err := applyLogFiles(cfg); err != nil {
+		logger.DebugfToFile("Session", "Ignoring log files in config: %v", err)
+	}
+
+	var loadBalancing LoadBalancingOptions
+	if options.LoadBalancing != nil {
+		loadBalancing = *options.LoadBalancing
+	}
+	if loadBalancing, err = loadBalancing.WithDefaults(); err != nil {
+		return nil, err
+	}
+	points, err := contactPoints(cfg.Host, cfg.Port, options.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	logger.DebugfToFile("Session", "Contact points: %s; load balancing: %s", strings.Join(points, ", "), loadBalancing)
+
 	// Create cluster configuration
-	cluster := gocql.NewCluster(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port))
-	// Suppress gocql's default logging to prevent terminal corruption
-	cluster.Logger = &customLogger{}
+	cluster := gocql.NewCluster(points...)
+	// Keep gocql's logging off the terminal, which it would corrupt
+	cluster.Logger = &driverLogger{}
 	cluster.Consistency = gocql.LocalOne
 	
 	// Set timeouts based on options, config, or use defaults
@@ -147,6 +286,32 @@ func NewSessionWithOptions(options SessionOptions) (*Session, error) {
 	
 	cluster.DisableInitialHostLookup = true
 
+	// Listen for schema changes (requires the default Full metadata cache mode)
+	schemaDrops := &schemaDropListener{}
+	udtChanges := &udtChangeListener{}
+	schemaChanges := &schemaChangeListener{}
+	cluster.Metadata.SchemaListener = gocql.SchemaListenersConfig{
+		KeyspaceChangeListener:  gocql.SchemaListenersMux{Keyspaces: []gocql.KeyspaceChangeListener{schemaDrops, schemaChanges}},
+		TableChangeListener:     gocql.SchemaListenersMux{Tables: []gocql.TableChangeListener{schemaDrops, schemaChanges}},
+		UserTypeChangeListener:  gocql.SchemaListenersMux{UserTypes: []gocql.UserTypeChangeListener{udtChanges, schemaChanges}},
+		FunctionChangeListener:  schemaChanges,
+		AggregateChangeListener: schemaChanges,
+	}
+
+	// Track coordinator errors; the breaker itself is off unless configured
+	health := newHostHealth()
+	if err := health.setBreaker(options.CircuitBreaker); err != nil {
+		return nil, err
+	}
+	observer := &sessionObserver{health: health, workspace: options.Workspace}
+	cluster.QueryObserver = observer
+	cluster.BatchObserver = observer
+	cluster.FrameHeaderObserver = observer
+	cluster.ConnectObserver = observer
+	if options.SocketKeepalive > 0 {
+		cluster.SocketKeepalive = options.SocketKeepalive
+	}
+
 	if cfg.Keyspace != "" {
 		cluster.Keyspace = cfg.Keyspace
 	}
@@ -159,8 +324,9 @@ func NewSessionWithOptions(options SessionOptions) (*Session, error) {
 	}
 
 	// Configure SSL if enabled
+	var tlsConfig *tls.Config
 	if cfg.SSL != nil && cfg.SSL.Enabled {
-		tlsConfig, err := createTLSConfig(cfg.SSL, cfg.Host)
+		tlsConfig, err = createTLSConfig(cfg.SSL, cfg.Host)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create TLS configuration: %v", err)
 		}
@@ -169,6 +335,16 @@ func NewSessionWithOptions(options SessionOptions) (*Session, error) {
 		}
 	}
 
+	// An SNI proxy dialer does its own TLS, so SslOpts is then unused
+	var sni *sniDialer
+	if options.SNIProxy != nil {
+		sni, err = newSNIDialer(options.SNIProxy, tlsConfig, cluster.ConnectTimeout, cluster.SocketKeepalive)
+		if err != nil {
+			return nil, err
+		}
+		cluster.HostDialer = sni
+	}
+
 	// Try to connect with progressively lower protocol versions
 	// Protocol v5: Cassandra 3.10+, 4.0+, 5.0+
 	// Protocol v4: Cassandra 3.0+
@@ -178,6 +354,7 @@ func NewSessionWithOptions(options SessionOptions) (*Session, error) {
 	
 	for _, protoVer := range protocolVersions {
 		cluster.ProtoVersion = protoVer
+		cluster.PoolConfig.HostSelectionPolicy = health.policy(loadBalancing.hostPolicy())
 		session, err = cluster.CreateSession()
 		if err == nil {
 			// Successfully connected
@@ -254,24 +431,84 @@ func NewSessionWithOptions(options SessionOptions) (*Session, error) {
 		Session:          session,
 		cluster:          cluster,
 		consistency:      initialConsistency,
-		pageSize:         100,
+		pageSize:         defaultPageSize,
 		tracing:          false,
 		username:         cfg.Username,
 		host:             cfg.Host,
 		cassandraVersion: releaseVersion,
+		schemaDrops:      schemaDrops,
+		udtChanges:       udtChanges,
+		schemaChanges:    schemaChanges,
+		sni:              sni,
+		health:           health,
+		observer:         observer,
+
+		serialConsistency: gocql.Serial,
+		queryTimeout:      options.QueryTimeout,
+		contactPoints:     points,
+		loadBalancing:     loadBalancing,
+
+		config:               cfg,
+		configFile:           config.FindConfigFile(options.ConfigFile),
+		requestTimeoutFixed:  options.RequestTimeout > 0,
+		connectTimeoutFixed:  options.ConnectTimeout > 0,
+		activeTimeout:        cluster.Timeout,
+		activeConnectTimeout: cluster.ConnectTimeout,
+		nextTimeout:          cluster.Timeout,
+		nextConnectTimeout:   cluster.ConnectTimeout,
+	}
+	if cfg.PageSize > 0 {
+		s.pageSize = cfg.PageSize
+	}
+
+	// Reload cached UDT definitions after a type changes or its keyspace is dropped
+	s.OnUserTypeChanged(s.invalidateUDT)
+	s.OnSchemaDropped(func(event SchemaDropEvent) {
+		if event.Table == "" {
+			s.invalidateUDT(event.Keyspace, "")
+		}
+	})
+
+	if options.SpeculativeAttempts > 0 && options.SpeculativeDelay > 0 {
+		s.speculative = &gocql.SimpleSpeculativeExecution{
+			NumAttempts:  options.SpeculativeAttempts,
+			TimeoutDelay: options.SpeculativeDelay,
+		}
+		logger.DebugfToFile("Session", "Speculative execution enabled: %d attempts, %v delay",
+			options.SpeculativeAttempts, options.SpeculativeDelay)
+	}
+
+	if options.ConsistencyFallback != "" {
+		if err := s.SetConsistencyFallback(options.ConsistencyFallback); err != nil {
+			session.Close()
+			return nil, err
+		}
 	}
 
 	// Initialize schema cache for AI features (skip in batch mode)
-	if !options.BatchMode {
-		s.schemaCache = NewSchemaCache(s)
-		if err := s.schemaCache.Refresh(); err != nil {
+	s.schemaCacheMode = options.SchemaCache
+	if s.schemaCacheMode == "" {
+		s.schemaCacheMode = SchemaCacheFull
+	}
+	if options.BatchMode {
+		s.schemaCacheMode = SchemaCacheOff
+		logger.DebugfToFile("Session", "Skipping schema cache initialization in batch mode")
+	} else if s.schemaCacheMode != SchemaCacheOff {
+		s.schemaCacheDir = options.SchemaCacheDir
+		s.schemaCache = NewSchemaCacheWithMode(s, s.schemaCacheMode)
+		if s.loadPersistedSchema(s.schemaCache) {
+			logger.DebugfToFile("Session", "Schema cache (%s) loaded from disk with %d keyspaces", s.schemaCacheMode, len(s.schemaCache.Keyspaces))
+		} else if err := s.schemaCache.Refresh(); err != nil {
 			// Log error but don't fail connection - AI features will work without cache
 			logger.DebugfToFile("Session", "Failed to initialize schema cache: %v", err)
 		} else {
-			logger.DebugfToFile("Session", "Schema cache initialized with %d keyspaces", len(s.schemaCache.Keyspaces))
+			logger.DebugfToFile("Session", "Schema cache (%s) initialized with %d keyspaces", s.schemaCacheMode, len(s.schemaCache.Keyspaces))
+			if err := s.SaveSchemaCache(); err != nil {
+				logger.DebugfToFile("Session", "Failed to save schema cache: %v", err)
+			}
 		}
 	} else {
-		logger.DebugfToFile("Session", "Skipping schema cache initialization in batch mode")
+		logger.DebugfToFile("Session", "Schema cache disabled by session option")
 	}
 
 	return s, nil
@@ -298,7 +535,11 @@ func loadConfig(customConfigPath string) (*config.Config, error) {
 
 // Consistency returns the current consistency level
 func (s *Session) Consistency() string {
-	switch s.consistency {
+	s.settingsMu.RLock()
+	consistency := s.consistency
+	s.settingsMu.RUnlock()
+
+	switch consistency {
 	case gocql.Any:
 		return "ANY"
 	case gocql.One:
@@ -347,48 +588,103 @@ func (s *Session) SetConsistency(level string) error {
 	default:
 		return fmt.Errorf("invalid consistency level: %s", level)
 	}
+	s.settingsMu.Lock()
 	s.consistency = consistency
+	s.settingsMu.Unlock()
+	return nil
+}
+
+// SerialConsistency returns the serial consistency level used by lightweight transactions
+func (s *Session) SerialConsistency() string {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.serialConsistency.String()
+}
+
+// SetSerialConsistency sets the serial consistency level used by lightweight
+// transactions: SERIAL or LOCAL_SERIAL
+func (s *Session) SetSerialConsistency(level string) error {
+	serial, err := parseSerialConsistency(level)
+	if err != nil {
+		return err
+	}
+	s.settingsMu.Lock()
+	s.serialConsistency = serial
+	s.settingsMu.Unlock()
 	return nil
 }
 
 // PageSize returns the current page size
 func (s *Session) PageSize() int {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
 	return s.pageSize
 }
 
-// SetPageSize sets the page size
+// SetPageSize sets the page size. A reloaded config file no longer changes it.
 func (s *Session) SetPageSize(size int) {
+	s.settingsMu.Lock()
 	s.pageSize = size
+	s.pageSizeFixed = true
+	s.settingsMu.Unlock()
 }
 
 // Tracing returns whether tracing is enabled
 func (s *Session) Tracing() bool {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
 	return s.tracing
 }
 
 // SetTracing enables or disables tracing
 func (s *Session) SetTracing(enabled bool) {
+	s.settingsMu.Lock()
 	s.tracing = enabled
+	s.settingsMu.Unlock()
 }
 
 // AutoFetch returns whether auto-fetch is enabled
 func (s *Session) AutoFetch() bool {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
 	return s.autoFetch
 }
 
-// SetAutoFetch enables or disables auto-fetching all pages
-func (s *Session) SetAutoFetch(enabled bool) {
+// AutoFetchMaxRows returns the most rows an auto-fetched query reads
+func (s *Session) AutoFetchMaxRows() int {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	if s.autoFetchMaxRows <= 0 {
+		return DefaultAutoFetchMaxRows
+	}
+	return s.autoFetchMaxRows
+}
+
+// SetAutoFetch enables or disables auto-fetching all pages, up to maxRows
+// rows per query (0 = DefaultAutoFetchMaxRows)
+func (s *Session) SetAutoFetch(enabled bool, maxRows int) error {
+	if maxRows < 0 || maxRows > MaxAutoFetchRows {
+		return fmt.Errorf("maxRows must be between 0 and %d", MaxAutoFetchRows)
+	}
+	s.settingsMu.Lock()
 	s.autoFetch = enabled
+	s.autoFetchMaxRows = maxRows
+	s.settingsMu.Unlock()
+	return nil
 }
 
 // Expand returns whether expand mode is enabled
 func (s *Session) Expand() bool {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
 	return s.expand
 }
 
 // SetExpand enables or disables expand mode (vertical row display)
 func (s *Session) SetExpand(enabled bool) {
+	s.settingsMu.Lock()
 	s.expand = enabled
+	s.settingsMu.Unlock()
 }
 
 // Username returns the current connection username
@@ -401,6 +697,28 @@ func (s *Session) Host() string {
 	return s.host
 }
 
+// Port returns the connection port
+func (s *Session) Port() int {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	if s.config == nil || s.config.Port == 0 {
+		return 9042
+	}
+	return s.config.Port
+}
+
+// SSL returns a copy of the TLS settings the session connected with, or nil
+// when TLS is off
+func (s *Session) SSL() *config.SSLConfig {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	if s.config == nil || s.config.SSL == nil || !s.config.SSL.Enabled {
+		return nil
+	}
+	ssl := *s.config.SSL
+	return &ssl
+}
+
 // GocqlSession returns the underlying gocql.Session
 func (s *Session) GocqlSession() *gocql.Session {
 	return s.Session
@@ -408,20 +726,52 @@ func (s *Session) GocqlSession() *gocql.Session {
 
 // LastTraceID returns the last trace session ID as a hex string
 func (s *Session) LastTraceID() string {
-	if s.lastTraceID == nil {
+	traceID := s.lastTraceIDBytes()
+	if traceID == nil {
 		return ""
 	}
-	return fmt.Sprintf("%x", s.lastTraceID)
+	return fmt.Sprintf("%x", traceID)
+}
+
+// lastTraceIDBytes returns the raw last trace session ID
+func (s *Session) lastTraceIDBytes() []byte {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.lastTraceID
+}
+
+// setLastTraceID records the trace session ID of the most recent traced query
+func (s *Session) setLastTraceID(traceID []byte) {
+	s.settingsMu.Lock()
+	s.lastTraceID = traceID
+	s.settingsMu.Unlock()
 }
 
 // Query creates a new query with session defaults applied
 func (s *Session) Query(stmt string, values ...interface{}) *gocql.Query {
+	// Snapshot the settings so a concurrent SetConsistency/SetPageSize cannot
+	// produce a query with a mix of old and new values
+	s.settingsMu.RLock()
+	consistency := s.consistency
+	serialConsistency := s.serialConsistency
+	pageSize := s.pageSize
+	s.settingsMu.RUnlock()
+
 	query := s.Session.Query(stmt, values...)
-	query.Consistency(s.consistency)
+	query.Consistency(consistency)
+	// Only conditional statements (IF ...) have a serial phase; the server
+	// ignores the level on anything else
+	if serialConsistency != 0 {
+		query.SerialConsistency(serialConsistency)
+	}
 	// Only set page size if it's greater than 0
 	// PageSize 0 means use server default (no client-side paging control)
-	if s.pageSize > 0 {
-		query.PageSize(s.pageSize)
+	if pageSize > 0 {
+		query.PageSize(pageSize)
+	}
+	// The driver only speculates on queries marked idempotent
+	if s.speculative != nil && isIdempotentRead(stmt) {
+		query.Idempotent(true).SetSpeculativeExecutionPolicy(s.speculative)
 	}
 	// Tracing will be handled in ExecuteSelectQuery when needed
 	return query
@@ -469,11 +819,79 @@ func (s *Session) IsVersion3OrHigher() bool {
 	return majorVersion >= 3
 }
 
+// SupportsVirtualTables reports whether the cluster has virtual tables
+// (system_virtual_schema, system_views), which were added in Cassandra 4.0.
+// Code reading virtual tables must check this first so 3.x clusters never
+// receive those queries. When the release version cannot be parsed the
+// capability is probed once with a single query.
+func (s *Session) SupportsVirtualTables() bool {
+	s.virtualTablesOnce.Do(func() {
+		major, err := strconv.Atoi(strings.SplitN(s.CassandraVersion(), ".", 2)[0])
+		if err == nil {
+			s.virtualTablesSupported = major >= 4
+			return
+		}
+		var name string
+		probeErr := s.Session.Query("SELECT keyspace_name FROM system_virtual_schema.keyspaces LIMIT 1").Scan(&name)
+		s.virtualTablesSupported = probeErr == nil || probeErr == gocql.ErrNotFound
+		logger.DebugfToFile("Session", "Probed virtual table support for version %q: %v", s.CassandraVersion(), s.virtualTablesSupported)
+	})
+	return s.virtualTablesSupported
+}
+
+// ScyllaVersion returns the ScyllaDB version of the connected cluster, or ""
+// when it is Apache Cassandra. ScyllaDB reports a Cassandra-compatible
+// release_version (3.0.8), so it is recognised by its system.versions table,
+// probed once per session.
+func (s *Session) ScyllaVersion() string {
+	s.scyllaOnce.Do(func() {
+		var version string
+		if err := s.Session.Query("SELECT version FROM system.versions").Scan(&version); err == nil {
+			s.scyllaVersion = version
+		}
+		logger.DebugfToFile("Session", "Probed ScyllaDB version: %q", s.scyllaVersion)
+	})
+	return s.scyllaVersion
+}
+
+// IsScylla reports whether the connected cluster is ScyllaDB
+func (s *Session) IsScylla() bool {
+	return s.ScyllaVersion() != ""
+}
+
 // GetSchemaCache returns the schema cache
 func (s *Session) GetSchemaCache() *SchemaCache {
 	return s.schemaCache
 }
 
+// SchemaCacheMode returns the session's schema cache mode
+func (s *Session) SchemaCacheMode() string {
+	if s.schemaCacheMode == "" {
+		return SchemaCacheOff
+	}
+	return s.schemaCacheMode
+}
+
+// SetSchemaCacheMode rebuilds the schema cache in a new mode, or drops it for
+// SchemaCacheOff so its memory can be reclaimed. Callers must hold the handle
+// exclusively, as for SetKeyspace.
+func (s *Session) SetSchemaCacheMode(mode string) error {
+	if !ValidSchemaCacheMode(mode) {
+		return fmt.Errorf("invalid schema cache mode %q (expected full, keyspace or off)", mode)
+	}
+	s.schemaCacheMode = mode
+	if mode == SchemaCacheOff {
+		s.schemaCache = nil
+		return nil
+	}
+	cache := NewSchemaCacheWithMode(s, mode)
+	if err := cache.Refresh(); err != nil {
+		return err
+	}
+	s.schemaCache = cache
+	return nil
+}
+
 // TraceInfo holds trace session summary information
 type TraceInfo struct {
 	Coordinator string
@@ -482,7 +900,8 @@ type TraceInfo struct {
 
 // GetTraceData retrieves trace data for the last executed query
 func (s *Session) GetTraceData() ([][]string, []string, *TraceInfo, error) {
-	if s.lastTraceID == nil {
+	lastTraceID := s.lastTraceIDBytes()
+	if lastTraceID == nil {
 		return nil, nil, nil, fmt.Errorf("no trace data available")
 	}
 
@@ -495,7 +914,7 @@ func (s *Session) GetTraceData() ([][]string, []string, *TraceInfo, error) {
 	          ORDER BY event_id`
 
 	// Use LOCAL_ONE consistency for trace queries regardless of session consistency
-	iter := s.Session.Query(query, s.lastTraceID).Consistency(gocql.LocalOne).Iter()
+	iter := s.Session.Query(query, lastTraceID).Consistency(gocql.LocalOne).Iter()
 	defer iter.Close()
 
 	// Define headers
@@ -529,7 +948,7 @@ func (s *Session) GetTraceData() ([][]string, []string, *TraceInfo, error) {
 	var duration int
 	sessionIter := s.Session.Query(`SELECT coordinator, duration
 	                                FROM system_traces.sessions
-	                                WHERE session_id = ?`, s.lastTraceID).Consistency(gocql.LocalOne).Iter()
+	                                WHERE session_id = ?`, lastTraceID).Consistency(gocql.LocalOne).Iter()
 	if sessionIter.Scan(&coordinator, &duration) {
 		traceInfo = &TraceInfo{
 			Coordinator: coordinator,
@@ -549,14 +968,37 @@ func (s *Session) Keyspace() string {
 	return ""
 }
 
+// ProtocolVersion returns the native protocol version the session connected
+// with, or 0 when it is not connected
+func (s *Session) ProtocolVersion() int {
+	if s.cluster != nil {
+		return s.cluster.ProtoVersion
+	}
+	return 0
+}
+
 // GetUDTRegistry returns the UDT registry
 func (s *Session) GetUDTRegistry() *UDTRegistry {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
 	return s.udtRegistry
 }
 
 // SetUDTRegistry sets the UDT registry
 func (s *Session) SetUDTRegistry(registry *UDTRegistry) {
+	s.settingsMu.Lock()
 	s.udtRegistry = registry
+	s.settingsMu.Unlock()
+}
+
+// ensureUDTRegistry returns the UDT registry, creating it on first use
+func (s *Session) ensureUDTRegistry() *UDTRegistry {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if s.udtRegistry == nil {
+		s.udtRegistry = NewUDTRegistry(s.Session)
+	}
+	return s.udtRegistry
 }
 
 // GetColumnTypeFromSystemTable gets the full type definition for a column
@@ -573,23 +1015,48 @@ func (s *Session) SetKeyspace(keyspace string) error {
 	// Update cluster config with new keyspace
 	s.cluster.Keyspace = keyspace
 
-	// Create new session with the new keyspace
+	// Create new session with the new keyspace. A driver session cannot
+	// share its host selection policy with another.
+	if s.health != nil {
+		s.cluster.PoolConfig.HostSelectionPolicy = s.health.policy(s.loadBalancing.hostPolicy())
+	}
+	s.useNextTimeouts()
 	newSession, err := s.cluster.CreateSession()
 	if err != nil {
 		return fmt.Errorf("failed to create session with keyspace %s: %w", keyspace, err)
 	}
 
-	// Update the session
+	// Update the session. The UDT registry queries through the old session,
+	// so it is recreated on next use.
 	s.Session = newSession
+	s.SetUDTRegistry(nil)
+
+	// Timeouts changed by a config reload are now in effect
+	s.settingsMu.Lock()
+	s.activeTimeout = s.cluster.Timeout
+	s.activeConnectTimeout = s.cluster.ConnectTimeout
+	s.settingsMu.Unlock()
 
-	// Reinitialize schema cache for the new keyspace
+	// Reinitialize schema cache for the new keyspace. A keyspace-scoped cache
+	// is reloaded right away since its contents depend on the keyspace.
 	if s.schemaCache != nil {
-		s.schemaCache = NewSchemaCache(s)
+		s.schemaCache = NewSchemaCacheWithMode(s, s.schemaCacheMode)
+		if s.schemaCacheMode == SchemaCacheKeyspace {
+			if err := s.schemaCache.Refresh(); err != nil {
+				logger.DebugfToFile("Session", "Failed to refresh schema cache for keyspace %s: %v", keyspace, err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// NewTLSConfig returns the TLS configuration a session with these SSL
+// settings connects with, for checking a server outside the driver
+func NewTLSConfig(sslConfig *config.SSLConfig, hostname string) (*tls.Config, error) {
+	return createTLSConfig(sslConfig, hostname)
+}
+
 // createTLSConfig creates a TLS configuration based on the SSL settings
 func createTLSConfig(sslConfig *config.SSLConfig, hostname string) (*tls.Config, error) {
 	// Determine server name for hostname verification
@@ -22,6 +22,24 @@ func (s *Session) CreateBatch(batchType gocql.BatchType) *gocql.Batch {
 	return s.Batch(batchType)
 }
 
+// NewBatchWithDefaults creates a batch with the session's consistency levels
+// and tracing applied, as Query does for single statements
+func (s *Session) NewBatchWithDefaults(batchType gocql.BatchType) *gocql.Batch {
+	s.settingsMu.RLock()
+	consistency := s.consistency
+	serialConsistency := s.serialConsistency
+	s.settingsMu.RUnlock()
+
+	batch := s.Batch(batchType).Consistency(consistency)
+	if serialConsistency != 0 {
+		batch.SerialConsistency(serialConsistency)
+	}
+	if s.Tracing() {
+		batch.Trace(sessionTracer{s})
+	}
+	return batch
+}
+
 // ExecuteBatch executes a batch of statements
 func (s *Session) ExecuteBatch(batch *gocql.Batch) error {
 	if batch == nil {
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// maxObservedAttempts bounds the attempt log kept per query; paged queries
+// report one attempt per page fetched
+const maxObservedAttempts = 32
+
+// SpeculativeExecutionInfo describes the speculative execution policy of a session
+type SpeculativeExecutionInfo struct {
+	MaxAttempts int   `json:"maxAttempts"` // Additional executions started while waiting
+	DelayMs     int64 `json:"delayMs"`     // Delay before each additional execution
+}
+
+// AttemptInfo describes a single execution of a statement against a coordinator
+type AttemptInfo struct {
+	Attempt   int     `json:"attempt"` // 0 for the first execution, >0 for retries and speculative executions
+	Host      string  `json:"host,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ExecutionInfo describes how a query was executed, for latency investigation
+type ExecutionInfo struct {
+	Host            string        `json:"host,omitempty"`            // Coordinator that served the result
+	Attempts        int           `json:"attempts"`                  // Executions sent, including retries and speculative executions
+	ServedByAttempt *int          `json:"servedByAttempt,omitempty"` // Attempt that produced the result, when it can be identified
+	Speculative     bool          `json:"speculative,omitempty"`     // Speculative execution was enabled for this query
+	AvgLatencyMs    float64       `json:"avgLatencyMs"`
+	AttemptLog      []AttemptInfo `json:"attemptLog,omitempty"`
+
+	// Set when the requested consistency could not be met and the result was
+	// read at the session's fallback level instead
+	ConsistencyDowngrade *ConsistencyDowngrade `json:"consistencyDowngrade,omitempty"`
+}
+
+// ExecutionObserver records the attempts the driver makes for a query.
+// With speculative execution enabled, attempts are reported from several
+// goroutines at once.
+type ExecutionObserver struct {
+	mu          sync.Mutex
+	speculative bool
+	attempts    []AttemptInfo
+	fallback    *consistencyFallbackPolicy // Set when the query may be downgraded
+	session     *sessionObserver           // Receives every attempt, since the query's observer replaces the session's
+}
+
+// ObserveQuery implements gocql.QueryObserver
+func (o *ExecutionObserver) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	attempt := AttemptInfo{
+		Attempt:   q.Attempt,
+		LatencyMs: float64(q.End.Sub(q.Start)) / float64(time.Millisecond),
+	}
+	if q.Host != nil {
+		attempt.Host = q.Host.ConnectAddressAndPort()
+	}
+	if q.Err != nil {
+		attempt.Error = q.Err.Error()
+	}
+	if o.session != nil {
+		o.session.ObserveQuery(ctx, q)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.attempts) >= maxObservedAttempts {
+		o.attempts = o.attempts[1:]
+	}
+	o.attempts = append(o.attempts, attempt)
+}
+
+// Info summarizes the attempts observed so far for the query behind iter
+func (o *ExecutionObserver) Info(iter *gocql.Iter) *ExecutionInfo {
+	if o == nil || iter == nil {
+		return nil
+	}
+
+	info := &ExecutionInfo{
+		Attempts:     iter.Attempts(),
+		Speculative:  o.speculative,
+		AvgLatencyMs: float64(iter.Latency()) / float64(time.Millisecond),
+
+		ConsistencyDowngrade: o.fallback.downgraded(),
+	}
+	if host := iter.Host(); host != nil {
+		info.Host = host.ConnectAddressAndPort()
+	}
+
+	o.mu.Lock()
+	info.AttemptLog = append([]AttemptInfo(nil), o.attempts...)
+	o.mu.Unlock()
+
+	// The driver does not say which execution won a speculative race; the
+	// latest successful attempt on the serving coordinator is the best match
+	if info.Host != "" {
+		for i := len(info.AttemptLog) - 1; i >= 0; i-- {
+			a := info.AttemptLog[i]
+			if a.Host == info.Host && a.Error == "" {
+				served := a.Attempt
+				info.ServedByAttempt = &served
+				break
+			}
+		}
+	}
+
+	return info
+}
+
+// observeExecution attaches an ExecutionObserver to q. When the session has a
+// consistency fallback, reads also get the downgrading retry here rather than
+// in Query, so that every downgrade is reported through the observer.
+func (s *Session) observeExecution(q *gocql.Query) *ExecutionObserver {
+	o := &ExecutionObserver{speculative: s.speculative != nil && q.IsIdempotent(), session: s.observer}
+
+	s.settingsMu.RLock()
+	fallback := s.consistencyFallback
+	s.settingsMu.RUnlock()
+	if fallback != nil && isIdempotentRead(q.Statement()) {
+		o.fallback = &consistencyFallbackPolicy{fallback: *fallback}
+		// The driver only retries queries marked idempotent
+		q.Idempotent(true).RetryPolicy(o.fallback)
+	}
+
+	q.Observer(o)
+	return o
+}
+
+// SpeculativeExecution returns the session's speculative execution policy, or nil when disabled
+func (s *Session) SpeculativeExecution() *SpeculativeExecutionInfo {
+	if s.speculative == nil {
+		return nil
+	}
+	return &SpeculativeExecutionInfo{
+		MaxAttempts: s.speculative.NumAttempts,
+		DelayMs:     s.speculative.TimeoutDelay.Milliseconds(),
+	}
+}
+
+// isIdempotentRead reports whether a statement can safely be executed more
+// than once concurrently. Only plain reads qualify; writes such as counter
+// updates, list appends and LWTs are not idempotent.
+func isIdempotentRead(stmt string) bool {
+	trimmed := strings.TrimSpace(stmt)
+	return len(trimmed) >= 6 && strings.EqualFold(trimmed[:6], "SELECT")
+}
+
+// ReadRepairHint explains how read repair interacts with a consistency level.
+// Read repair is configured per table on the server (read_repair in 4.0+,
+// read_repair_chance before); the hint only covers what the client controls.
+func ReadRepairHint(consistency string) string {
+	switch strings.ToUpper(consistency) {
+	case "ONE", "LOCAL_ONE", "TWO", "THREE":
+		return "Reads at " + strings.ToUpper(consistency) + " do not wait for a quorum; a replica that missed a write is only repaired when a later quorum read or repair touches it. Use QUORUM or LOCAL_QUORUM reads with quorum writes for read-your-writes."
+	case "QUORUM", "LOCAL_QUORUM", "EACH_QUORUM":
+		return "Reads at " + strings.ToUpper(consistency) + " repair mismatched replicas in the read path (blocking read repair), which can add latency when replicas disagree. Speculative executions help with slow replicas, not with repair time."
+	case "ALL":
+		return "Reads at ALL fail if any replica is down and repair every mismatch in the read path."
+	case "ANY":
+		return "ANY is only valid for writes."
+	default:
+		return ""
+	}
+}
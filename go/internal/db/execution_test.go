@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+func TestIsIdempotentRead(t *testing.T) {
+	tests := []struct {
+		stmt string
+		want bool
+	}{
+		{"SELECT * FROM ks.t", true},
+		{"  select id from t where id = 1", true},
+		{"INSERT INTO t (id) VALUES (1)", false},
+		{"UPDATE t SET c = c + 1 WHERE id = 1", false},
+		{"SEL", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIdempotentRead(tt.stmt); got != tt.want {
+			t.Errorf("isIdempotentRead(%q) = %v, want %v", tt.stmt, got, tt.want)
+		}
+	}
+}
+
+func TestExecutionObserverBoundsAttemptLog(t *testing.T) {
+	o := &ExecutionObserver{}
+	start := time.Now()
+	for i := 0; i < maxObservedAttempts+5; i++ {
+		q := gocql.ObservedQuery{Attempt: i, Start: start, End: start.Add(2 * time.Millisecond)}
+		if i == maxObservedAttempts+4 {
+			q.Err = errors.New("timeout")
+		}
+		o.ObserveQuery(context.Background(), q)
+	}
+
+	if len(o.attempts) != maxObservedAttempts {
+		t.Fatalf("attempt log length = %d, want %d", len(o.attempts), maxObservedAttempts)
+	}
+	if o.attempts[0].Attempt != 5 {
+		t.Errorf("oldest attempt = %d, want 5", o.attempts[0].Attempt)
+	}
+	last := o.attempts[len(o.attempts)-1]
+	if last.Error != "timeout" || last.LatencyMs != 2 {
+		t.Errorf("last attempt = %+v", last)
+	}
+}
+
+func TestReadRepairHint(t *testing.T) {
+	for _, level := range []string{"ONE", "local_one", "QUORUM", "LOCAL_QUORUM", "ALL"} {
+		if ReadRepairHint(level) == "" {
+			t.Errorf("expected a hint for %s", level)
+		}
+	}
+	if ReadRepairHint("SERIAL") != "" {
+		t.Errorf("expected no hint for SERIAL")
+	}
+}
+
+type fakeRetryableQuery struct {
+	attempts    int
+	consistency gocql.Consistency
+}
+
+func (q *fakeRetryableQuery) Attempts() int                      { return q.attempts }
+func (q *fakeRetryableQuery) SetConsistency(c gocql.Consistency) { q.consistency = c }
+func (q *fakeRetryableQuery) GetConsistency() gocql.Consistency  { return q.consistency }
+func (q *fakeRetryableQuery) Context() context.Context           { return context.Background() }
+
+func TestConsistencyFallbackPolicy(t *testing.T) {
+	unavailable := &gocql.RequestErrUnavailable{Consistency: gocql.LocalQuorum, Required: 2, Alive: 1}
+
+	q := &fakeRetryableQuery{attempts: 1, consistency: gocql.LocalQuorum}
+	p := &consistencyFallbackPolicy{fallback: gocql.LocalOne}
+	if !p.Attempt(q) || p.GetRetryType(unavailable) != gocql.Retry {
+		t.Fatal("expected a retry after Unavailable")
+	}
+	if q.consistency != gocql.LocalOne {
+		t.Errorf("retry consistency = %v, want LOCAL_ONE", q.consistency)
+	}
+	d := p.downgraded()
+	if d == nil || d.From != "LOCAL_QUORUM" || d.To != "LOCAL_ONE" {
+		t.Fatalf("downgrade = %+v", d)
+	}
+
+	// Only one downgrade per query
+	q.attempts = 2
+	if p.Attempt(q); p.GetRetryType(unavailable) != gocql.Rethrow {
+		t.Error("expected no second retry")
+	}
+
+	// Other errors, no live replicas and a fallback that is not lower are rethrown
+	for _, tt := range []struct {
+		name     string
+		fallback gocql.Consistency
+		err      error
+	}{
+		{"timeout", gocql.LocalOne, &gocql.RequestErrReadTimeout{}},
+		{"no replicas alive", gocql.LocalOne, &gocql.RequestErrUnavailable{Alive: 0}},
+		{"fallback not lower", gocql.Quorum, unavailable},
+	} {
+		q := &fakeRetryableQuery{attempts: 1, consistency: gocql.LocalQuorum}
+		p := &consistencyFallbackPolicy{fallback: tt.fallback}
+		p.Attempt(q)
+		if p.GetRetryType(tt.err) != gocql.Rethrow || p.downgraded() != nil || q.consistency != gocql.LocalQuorum {
+			t.Errorf("%s: expected the error to be rethrown at LOCAL_QUORUM", tt.name)
+		}
+	}
+}
+
+func TestSetConsistencyFallback(t *testing.T) {
+	s := &Session{}
+	if err := s.SetConsistencyFallback("local_one"); err != nil || s.ConsistencyFallback() != "LOCAL_ONE" {
+		t.Fatalf("SetConsistencyFallback(local_one) = %v, fallback %q", err, s.ConsistencyFallback())
+	}
+	if err := s.SetConsistencyFallback("SERIAL"); err == nil {
+		t.Error("expected SERIAL to be rejected")
+	}
+	if err := s.SetConsistencyFallback(""); err != nil || s.ConsistencyFallback() != "" {
+		t.Errorf("expected fallback to be disabled, got %q", s.ConsistencyFallback())
+	}
+}
+
+func TestSetSerialConsistency(t *testing.T) {
+	s := &Session{serialConsistency: gocql.Serial}
+	if err := s.SetSerialConsistency("LOCAL_SERIAL"); err != nil || s.SerialConsistency() != "LOCAL_SERIAL" {
+		t.Fatalf("SetSerialConsistency(LOCAL_SERIAL) = %v, serial %q", err, s.SerialConsistency())
+	}
+	if err := s.SetSerialConsistency("QUORUM"); err == nil || s.SerialConsistency() != "LOCAL_SERIAL" {
+		t.Errorf("expected QUORUM to be rejected and LOCAL_SERIAL kept, got %v, %q", err, s.SerialConsistency())
+	}
+}
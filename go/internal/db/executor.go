@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"net"
@@ -253,7 +254,7 @@ func (s *Session) getColumnTypeUsingMetadata(keyspace, table, column string) str
 		typeStr := formatTypeInfo(colMeta.Type)
 
 		// For UDT types, ensure we have the fully qualified name
-		if colMeta.Type.Type() == gocql.TypeUDT || colMeta.Type.Type() == gocql.TypeCustom {
+		if _, isVector := colMeta.Type.(gocql.VectorType); !isVector && (colMeta.Type.Type() == gocql.TypeUDT || colMeta.Type.Type() == gocql.TypeCustom) {
 			// Try to cast to UDTTypeInfo
 			if udtInfo, ok := colMeta.Type.(gocql.UDTTypeInfo); ok {
 				// Return the fully qualified UDT name
@@ -285,9 +286,33 @@ func (t *captureTracer) Trace(traceID []byte) {
 	t.traceID = traceID
 }
 
+// sessionTracer records the trace of a query as the session's last trace
+type sessionTracer struct {
+	s *Session
+}
+
+func (t sessionTracer) Trace(traceID []byte) {
+	t.s.setLastTraceID(traceID)
+}
+
+// Traced turns on tracing for q when the session traces queries, keeping
+// its trace ID as the session's last trace for GetTraceData
+func (s *Session) Traced(q *gocql.Query) *gocql.Query {
+	if s.Tracing() {
+		q = q.Trace(sessionTracer{s})
+	}
+	return q
+}
+
 // ExecuteCQLQuery executes a regular CQL query
 func (s *Session) ExecuteCQLQuery(query string) interface{} {
-	logger.DebugfToFile("ExecuteCQLQuery", "Called with query: %s", query)
+	return s.ExecuteCQLQueryWithOptions(context.Background(), query, nil)
+}
+
+// ExecuteCQLQueryWithOptions executes a regular CQL query with opts overriding
+// the session's settings. ctx bounds the query, all of its pages included.
+func (s *Session) ExecuteCQLQueryWithOptions(ctx context.Context, query string, opts *QueryOptions) interface{} {
+	logger.DebugStatement(s.Workspace(), "ExecuteCQLQuery", "Called with query: ", query, nil)
 
 	if s == nil || s.Session == nil {
 		return fmt.Errorf("not connected to database")
@@ -298,7 +323,7 @@ func (s *Session) ExecuteCQLQuery(query string) interface{} {
 	switch {
 	case strings.HasPrefix(upperQuery, "SELECT") || strings.HasPrefix(upperQuery, "DESCRIBE") || strings.HasPrefix(upperQuery, "LIST"):
 		logger.DebugToFile("ExecuteCQLQuery", "Routing to ExecuteSelectQuery for query that returns results")
-		return s.ExecuteSelectQuery(query)
+		return s.executeSelectQuery(ctx, query, opts)
 	case strings.HasPrefix(upperQuery, "USE "):
 		// Handle USE statement - gocql doesn't support USE directly
 		// Return the keyspace name for the UI/router layer to handle
@@ -329,9 +354,12 @@ func (s *Session) ExecuteCQLQuery(query string) interface{} {
 			return fmt.Sprintf("Now using keyspace %s", keyspace)
 		}
 		return "Invalid USE statement"
+	case isConditionalWrite(query):
+		// A lightweight transaction answers with [applied], which Exec drops
+		return s.executeConditional(ctx, query, opts)
 	default:
 		// Execute non-SELECT query
-		if err := s.Query(query).Exec(); err != nil {
+		if err := s.queryWith(ctx, query, opts).Exec(); err != nil {
 			// Check if it's a connection error
 			errStr := err.Error()
 			if strings.Contains(errStr, "connection refused") ||
@@ -341,48 +369,54 @@ func (s *Session) ExecuteCQLQuery(query string) interface{} {
 			}
 			return fmt.Errorf("query failed: %v", err)
 		}
+		s.invalidateUDTsAfterDDL(query)
 		return "Query executed successfully"
 	}
 }
 
 // ExecuteSelectQuery executes a SELECT query and returns formatted results
 func (s *Session) ExecuteSelectQuery(query string) interface{} {
+	return s.executeSelectQuery(context.Background(), query, nil)
+}
+
+// executeSelectQuery executes a SELECT query with per-query options
+func (s *Session) executeSelectQuery(ctx context.Context, query string, opts *QueryOptions) interface{} {
 	// Add debug logging
 	logger.DebugToFile("executeSelectQuery", "Starting executeSelectQuery")
 
 	// Initialize UDT registry if needed (will be cached)
-	if s.udtRegistry == nil {
-		s.udtRegistry = NewUDTRegistry(s.Session)
-	}
+	udtRegistry := s.ensureUDTRegistry()
 
 	// Check if we should use streaming for large results
 	// This is a simple heuristic - could be made configurable
 	useStreaming := s.shouldUseStreaming(query)
 
 	if useStreaming {
-		return s.ExecuteStreamingQuery(query)
+		return s.executeStreamingQuery(ctx, query, opts)
 	}
 
 	// Track query execution time
 	startTime := time.Now()
 
 	// Create the query
-	q := s.Query(query)
+	q := s.queryWith(ctx, query, opts)
 	
 	// Enable tracing if needed and capture trace ID
 	var tracer *captureTracer
-	if s.tracing {
+	tracing := opts.TracingEnabled(s)
+	if tracing {
 		tracer = &captureTracer{}
 		q = q.Trace(tracer)
 		defer func() {
 			// Store the trace ID for later retrieval
 			if tracer != nil && tracer.traceID != nil {
-				s.lastTraceID = tracer.traceID
+				s.setLastTraceID(tracer.traceID)
 			}
 		}()
 	}
 
 	iter := q.Iter()
+	var observer *ExecutionObserver
 
 	// Check for connection errors early
 	if err := iter.Close(); err != nil {
@@ -393,17 +427,19 @@ func (s *Session) ExecuteSelectQuery(query string) interface{} {
 			return fmt.Errorf("connection lost to Cassandra - please check if the server is running")
 		}
 		// Re-create the iterator if no connection error
-		q = s.Query(query)
-		if s.tracing && tracer != nil {
+		q = s.queryWith(ctx, query, opts)
+		if tracing && tracer != nil {
 			q = q.Trace(tracer)
 		}
+		observer = s.observeExecution(q)
 		iter = q.Iter()
 	} else {
 		// Re-create the iterator since we closed it
-		q = s.Query(query)
-		if s.tracing && tracer != nil {
+		q = s.queryWith(ctx, query, opts)
+		if tracing && tracer != nil {
 			q = q.Trace(tracer)
 		}
+		observer = s.observeExecution(q)
 		iter = q.Iter()
 	}
 
@@ -642,7 +678,7 @@ func (s *Session) ExecuteSelectQuery(query string) interface{} {
 						logger.DebugfToFile("ExecuteSelectQuery", "UDT %s came as bytes: %d bytes", col.Name, len(bytes))
 
 						// Use our binary decoder to decode the UDT
-						decoder := NewBinaryDecoder(s.udtRegistry)
+						decoder := NewBinaryDecoder(udtRegistry)
 
 						// Determine the keyspace - prefer query keyspace, then current
 						keyspace := currentKeyspace
@@ -693,6 +729,16 @@ func (s *Session) ExecuteSelectQuery(query string) interface{} {
 						row[i] = fmt.Sprintf("%v", val)
 					}
 
+				case typeInfo != nil && typeInfo.BaseType == "vector":
+					// A vector the driver did not unmarshal arrives as its serialized bytes
+					if data, ok := val.([]byte); ok {
+						if decoded, err := NewBinaryDecoder(udtRegistry).Decode(data, typeInfo, currentKeyspace); err == nil {
+							val = decoded
+						}
+					}
+					rawRow[cleanHeaders[i]] = val
+					row[i] = FormatValue(val)
+
 				case isCollection:
 					// Collections are already decoded by gocql, just format them
 					rawRow[cleanHeaders[i]] = val
@@ -730,6 +776,7 @@ func (s *Session) ExecuteSelectQuery(query string) interface{} {
 		ColumnTypes:     columnTypes,
 		ColumnTypeInfos: columnTypeInfos,
 		Headers:         cleanHeaders,
+		Execution:       observer.Info(iter),
 	}
 
 	// Just pass the result, UI will handle formatting
@@ -765,29 +812,34 @@ func (s *Session) shouldUseStreaming(query string) bool {
 
 // ExecuteStreamingQuery executes a query and returns a streaming result
 func (s *Session) ExecuteStreamingQuery(query string) interface{} {
+	return s.executeStreamingQuery(context.Background(), query, nil)
+}
+
+// executeStreamingQuery executes a query with per-query options and returns a
+// streaming result
+func (s *Session) executeStreamingQuery(ctx context.Context, query string, opts *QueryOptions) interface{} {
 	logger.DebugToFile("ExecuteStreamingQuery", "Starting streaming query execution")
 
 	startTime := time.Now()
 	// Use the session's page size for pagination
-	q := s.Query(query)
-	// Only set page size if it's greater than 0
-	// Setting to 0 or not setting at all disables client-side paging
-	if s.pageSize > 0 {
-		q.PageSize(s.pageSize)
-	}
+	// Query() applies the session's page size; a size of 0 leaves client-side
+	// paging disabled
+	q := s.queryWith(ctx, query, opts)
 	
 	// Enable tracing if needed and capture trace ID
 	var tracer *captureTracer
-	if s.tracing {
+	tracing := opts.TracingEnabled(s)
+	if tracing {
 		tracer = &captureTracer{}
 		q = q.Trace(tracer)
 		defer func() {
 			// Store the trace ID for later retrieval
 			if tracer != nil && tracer.traceID != nil {
-				s.lastTraceID = tracer.traceID
+				s.setLastTraceID(tracer.traceID)
 			}
 		}()
 	}
+	observer := s.observeExecution(q)
 	
 	iter := q.Iter()
 
@@ -884,6 +936,7 @@ func (s *Session) ExecuteStreamingQuery(query string) interface{} {
 		Iterator:        iter,
 		StartTime:       startTime,
 		Keyspace:        currentKeyspace,
+		Execution:       observer,
 	}
 }
 
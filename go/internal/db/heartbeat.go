@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// Connection heartbeats
+//
+// Firewalls and NAT gateways drop connections that stay idle for too long,
+// often without telling either end, so the first query after a quiet spell
+// fails. Two mechanisms keep driver connections alive:
+//
+//   - the driver sends an OPTIONS request on every connection every
+//     DriverHeartbeatInterval and closes the connection after 5 missed
+//     replies; the interval is fixed by the driver
+//   - TCP keepalive probes, sent after SessionOptions.SocketKeepalive of
+//     silence on the socket
+//
+// The session observes each heartbeat reply and each new connection, so
+// HostMetrics shows when a host last answered and whether its connections
+// had to be opened again.
+
+// DriverHeartbeatInterval is how often the driver sends a heartbeat on each
+// connection once it is established
+const DriverHeartbeatInterval = 5 * time.Second
+
+// opSupported is the opcode of the SUPPORTED frame that answers a heartbeat
+const opSupported = 0x06
+
+// ObserveFrameHeader implements gocql.FrameHeaderObserver. It is called for
+// every frame received, so anything but a heartbeat reply returns at once.
+func (o *sessionObserver) ObserveFrameHeader(_ context.Context, f gocql.ObservedFrameHeader) {
+	if byte(f.Opcode) != opSupported || f.Host == nil {
+		return
+	}
+	o.health.heartbeat(f.Host, f.End)
+}
+
+// ObserveConnect implements gocql.ConnectObserver
+func (o *sessionObserver) ObserveConnect(c gocql.ObservedConnect) {
+	if c.Host == nil {
+		return
+	}
+	o.health.connected(c.Host, c.End, c.Err)
+}
+
+// heartbeat records a heartbeat reply from host
+func (h *hostHealth) heartbeat(host *gocql.HostInfo, at time.Time) {
+	addr := host.ConnectAddressAndPort()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := h.stats(addr)
+	st.heartbeats++
+	st.lastHeartbeat = at
+}
+
+// connected records a connection opened to host, or the error that prevented it
+func (h *hostHealth) connected(host *gocql.HostInfo, at time.Time, err error) {
+	addr := host.ConnectAddressAndPort()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := h.stats(addr)
+	if err != nil {
+		st.connectErrors++
+		st.lastConnectError = err.Error()
+		return
+	}
+	st.connects++
+	st.lastConnect = at
+}
+
+// SocketKeepalive returns the TCP keepalive period of driver connections; 0
+// means the Go default of 15s
+func (s *Session) SocketKeepalive() time.Duration {
+	if s.cluster == nil {
+		return 0
+	}
+	return s.cluster.SocketKeepalive
+}
@@ -0,0 +1,445 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// Circuit breaker states of a host
+const (
+	BreakerClosed   = "closed"    // The host is used normally
+	BreakerOpen     = "open"      // The host is avoided until RetryAt
+	BreakerHalfOpen = "half-open" // One probe request decides whether the host is used again
+)
+
+// healthBuckets is the number of slices the error rate window is kept in, so
+// old requests leave the window a slice at a time
+const healthBuckets = 10
+
+// CircuitBreakerOptions configures the client-side circuit breaker. A host
+// whose error rate over Window reaches ErrorRate, once it has served at least
+// MinRequests in that window, is avoided for OpenFor; then a single probe
+// request decides whether it is used again or avoided for another OpenFor.
+type CircuitBreakerOptions struct {
+	ErrorRate   float64
+	MinRequests int
+	Window      time.Duration
+	OpenFor     time.Duration
+}
+
+// DefaultCircuitBreakerOptions returns the breaker settings used for options
+// left at zero
+func DefaultCircuitBreakerOptions() CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		ErrorRate:   0.5,
+		MinRequests: 20,
+		Window:      time.Minute,
+		OpenFor:     30 * time.Second,
+	}
+}
+
+// WithDefaults fills in the options left at zero and checks the rest
+func (o CircuitBreakerOptions) WithDefaults() (CircuitBreakerOptions, error) {
+	def := DefaultCircuitBreakerOptions()
+	if o.ErrorRate == 0 {
+		o.ErrorRate = def.ErrorRate
+	}
+	if o.MinRequests == 0 {
+		o.MinRequests = def.MinRequests
+	}
+	if o.Window == 0 {
+		o.Window = def.Window
+	}
+	if o.OpenFor == 0 {
+		o.OpenFor = def.OpenFor
+	}
+	switch {
+	case o.ErrorRate < 0 || o.ErrorRate > 1:
+		return o, fmt.Errorf("circuit breaker error rate must be between 0 and 1")
+	case o.MinRequests < 1:
+		return o, fmt.Errorf("circuit breaker minimum requests must be at least 1")
+	case o.Window < time.Second:
+		return o, fmt.Errorf("circuit breaker window must be at least 1s")
+	case o.OpenFor < 0:
+		return o, fmt.Errorf("circuit breaker open time must not be negative")
+	}
+	return o, nil
+}
+
+// HostMetrics reports the requests a coordinator served and its breaker state
+type HostMetrics struct {
+	Host              string  `json:"host"`
+	Requests          int64   `json:"requests"` // Since the session was created
+	Errors            int64   `json:"errors"`
+	WindowRequests    int64   `json:"windowRequests"` // In the breaker window
+	WindowErrors      int64   `json:"windowErrors"`
+	ErrorRate         float64 `json:"errorRate"` // windowErrors / windowRequests
+	ConsecutiveErrors int     `json:"consecutiveErrors"`
+	AvgLatencyMs      float64 `json:"avgLatencyMs"`
+	LastError         string  `json:"lastError,omitempty"`
+	LastErrorAt       string  `json:"lastErrorAt,omitempty"`
+	Breaker           string  `json:"breaker"`           // closed, open or half-open
+	Trips             int     `json:"trips"`             // Times the breaker opened
+	RetryAt           string  `json:"retryAt,omitempty"` // When an open breaker lets a probe through
+	Avoided           int64   `json:"avoided"`           // Times the host was passed over for another
+
+	// Connection liveness (see heartbeat.go)
+	Heartbeats       int64  `json:"heartbeats"`                 // Heartbeat replies on all connections
+	LastHeartbeatAt  string `json:"lastHeartbeatAt,omitempty"`  // Most recent heartbeat reply
+	Connects         int64  `json:"connects"`                   // Connections opened, reconnects included
+	LastConnectAt    string `json:"lastConnectAt,omitempty"`    // Most recent connection opened
+	ConnectErrors    int64  `json:"connectErrors"`              // Connection attempts that failed
+	LastConnectError string `json:"lastConnectError,omitempty"` // Error of the most recent failed attempt
+}
+
+// healthBucket counts the requests of one slice of the window
+type healthBucket struct {
+	start    time.Time
+	requests int64
+	errors   int64
+}
+
+// hostStats is the health of one coordinator
+type hostStats struct {
+	requests          int64
+	errors            int64
+	latency           time.Duration
+	consecutiveErrors int
+	lastError         string
+	lastErrorAt       time.Time
+	buckets           [healthBuckets]healthBucket
+
+	state    string
+	openedAt time.Time
+	probeAt  time.Time // When the half-open probe was let through; zero when none is in flight
+	trips    int
+	avoided  int64
+
+	heartbeats       int64
+	lastHeartbeat    time.Time
+	connects         int64
+	lastConnect      time.Time
+	connectErrors    int64
+	lastConnectError string
+}
+
+// hostHealth tracks the error rate of each coordinator from the requests the
+// driver reports to the session's observers, and runs the circuit breaker
+// when one is configured. Errors that say nothing about the coordinator, such
+// as syntax errors or missing permissions, are not counted.
+type hostHealth struct {
+	mu      sync.Mutex
+	hosts   map[string]*hostStats
+	breaker *CircuitBreakerOptions // nil when the breaker is disabled
+	now     func() time.Time
+}
+
+func newHostHealth() *hostHealth {
+	return &hostHealth{hosts: make(map[string]*hostStats), now: time.Now}
+}
+
+// hostFault reports whether an error counts against the coordinator that
+// returned it
+func hostFault(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, gocql.ErrNotFound) {
+		return false
+	}
+	var reqErr gocql.RequestError
+	if errors.As(err, &reqErr) {
+		switch reqErr.Code() {
+		case gocql.ErrCodeProtocol, gocql.ErrCodeCredentials, gocql.ErrCodeUnavailable,
+			gocql.ErrCodeFunctionFailure, gocql.ErrCodeCASWriteUnknown:
+			return false
+		}
+		// Syntax, unauthorized, invalid, config, already exists and unprepared
+		return reqErr.Code() < gocql.ErrCodeSyntax
+	}
+	return true
+}
+
+// record counts a request sent to host and updates its breaker
+func (h *hostHealth) record(host *gocql.HostInfo, latency time.Duration, err error) {
+	if host == nil {
+		return
+	}
+	addr := host.ConnectAddressAndPort()
+	fault := hostFault(err)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	st := h.stats(addr)
+	st.requests++
+	st.latency += latency
+	b := h.bucket(st, now)
+	b.requests++
+	if fault {
+		st.errors++
+		st.consecutiveErrors++
+		st.lastError = err.Error()
+		st.lastErrorAt = now
+		b.errors++
+	} else {
+		st.consecutiveErrors = 0
+	}
+
+	if h.breaker == nil {
+		return
+	}
+	switch st.state {
+	case BreakerHalfOpen:
+		st.probeAt = time.Time{}
+		if fault {
+			h.trip(st, now)
+		} else {
+			st.state = BreakerClosed
+			h.reset(st)
+		}
+	case BreakerClosed:
+		requests, errs := h.window(st, now)
+		if fault && requests >= int64(h.breaker.MinRequests) && float64(errs) >= h.breaker.ErrorRate*float64(requests) {
+			h.trip(st, now)
+		}
+	}
+}
+
+// stats returns the stats of a host, creating them on first use. h.mu must be held.
+func (h *hostHealth) stats(addr string) *hostStats {
+	st := h.hosts[addr]
+	if st == nil {
+		st = &hostStats{state: BreakerClosed}
+		h.hosts[addr] = st
+	}
+	return st
+}
+
+// bucketWidth is the time slice each bucket covers
+func (h *hostHealth) bucketWidth() time.Duration {
+	window := DefaultCircuitBreakerOptions().Window
+	if h.breaker != nil {
+		window = h.breaker.Window
+	}
+	return window / healthBuckets
+}
+
+// bucket returns the bucket counting requests made at now. h.mu must be held.
+func (h *hostHealth) bucket(st *hostStats, now time.Time) *healthBucket {
+	width := h.bucketWidth()
+	start := now.Truncate(width)
+	b := &st.buckets[(start.UnixNano()/int64(width))%healthBuckets]
+	if !b.start.Equal(start) {
+		*b = healthBucket{start: start}
+	}
+	return b
+}
+
+// window returns the requests and errors of the last window. h.mu must be held.
+func (h *hostHealth) window(st *hostStats, now time.Time) (requests, errs int64) {
+	oldest := now.Add(-h.bucketWidth() * healthBuckets)
+	for _, b := range st.buckets {
+		if b.start.After(oldest) {
+			requests += b.requests
+			errs += b.errors
+		}
+	}
+	return requests, errs
+}
+
+// trip opens the breaker of a host. h.mu must be held.
+func (h *hostHealth) trip(st *hostStats, now time.Time) {
+	st.state = BreakerOpen
+	st.openedAt = now
+	st.trips++
+}
+
+// reset forgets the window of a host so a recovered host starts clean. h.mu must be held.
+func (h *hostHealth) reset(st *hostStats) {
+	st.buckets = [healthBuckets]healthBucket{}
+}
+
+// allow reports whether a request may be sent to addr. An open breaker turns
+// half-open once OpenFor has passed and lets one probe request through; a
+// probe that is never reported back is replaced after another OpenFor.
+func (h *hostHealth) allow(addr string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.breaker == nil {
+		return true
+	}
+	st := h.hosts[addr]
+	if st == nil {
+		return true
+	}
+	now := h.now()
+	if st.state == BreakerOpen && now.Sub(st.openedAt) >= h.breaker.OpenFor {
+		st.state = BreakerHalfOpen
+	}
+	switch st.state {
+	case BreakerOpen:
+		st.avoided++
+		return false
+	case BreakerHalfOpen:
+		if !st.probeAt.IsZero() && now.Sub(st.probeAt) < h.breaker.OpenFor {
+			st.avoided++
+			return false
+		}
+		st.probeAt = now
+	}
+	return true
+}
+
+// setBreaker enables the breaker with opts, or disables it when opts is nil.
+// Disabling closes every breaker, and a new window starts counting afresh.
+func (h *hostHealth) setBreaker(opts *CircuitBreakerOptions) error {
+	if opts != nil {
+		checked, err := opts.WithDefaults()
+		if err != nil {
+			return err
+		}
+		opts = &checked
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if opts == nil || h.breaker == nil || opts.Window != h.breaker.Window {
+		for _, st := range h.hosts {
+			h.reset(st)
+		}
+	}
+	h.breaker = opts
+	if opts == nil {
+		for _, st := range h.hosts {
+			st.state = BreakerClosed
+			st.probeAt = time.Time{}
+		}
+	}
+	return nil
+}
+
+// breakerOptions returns the breaker settings, or nil when it is disabled
+func (h *hostHealth) breakerOptions() *CircuitBreakerOptions {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.breaker == nil {
+		return nil
+	}
+	opts := *h.breaker
+	return &opts
+}
+
+// metrics returns the health of every host seen, by address
+func (h *hostHealth) metrics() []HostMetrics {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now()
+	out := make([]HostMetrics, 0, len(h.hosts))
+	for addr, st := range h.hosts {
+		m := HostMetrics{
+			Host:              addr,
+			Requests:          st.requests,
+			Errors:            st.errors,
+			ConsecutiveErrors: st.consecutiveErrors,
+			LastError:         st.lastError,
+			Breaker:           st.state,
+			Trips:             st.trips,
+			Avoided:           st.avoided,
+			Heartbeats:        st.heartbeats,
+			Connects:          st.connects,
+			ConnectErrors:     st.connectErrors,
+			LastConnectError:  st.lastConnectError,
+		}
+		m.WindowRequests, m.WindowErrors = h.window(st, now)
+		if m.WindowRequests > 0 {
+			m.ErrorRate = float64(m.WindowErrors) / float64(m.WindowRequests)
+		}
+		if st.requests > 0 {
+			m.AvgLatencyMs = float64(st.latency) / float64(st.requests) / float64(time.Millisecond)
+		}
+		if !st.lastErrorAt.IsZero() {
+			m.LastErrorAt = st.lastErrorAt.UTC().Format(time.RFC3339)
+		}
+		if !st.lastHeartbeat.IsZero() {
+			m.LastHeartbeatAt = st.lastHeartbeat.UTC().Format(time.RFC3339)
+		}
+		if !st.lastConnect.IsZero() {
+			m.LastConnectAt = st.lastConnect.UTC().Format(time.RFC3339)
+		}
+		if st.state == BreakerOpen && h.breaker != nil {
+			m.RetryAt = st.openedAt.Add(h.breaker.OpenFor).UTC().Format(time.RFC3339)
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Host < out[j].Host })
+	return out
+}
+
+// policy wraps a host selection policy so that hosts with an open breaker are
+// tried only after every other host. A new policy is needed for each driver
+// session.
+func (h *hostHealth) policy(base gocql.HostSelectionPolicy) gocql.HostSelectionPolicy {
+	return &breakerPolicy{HostSelectionPolicy: base, health: h}
+}
+
+// breakerPolicy is a host selection policy that defers hosts whose breaker is open
+type breakerPolicy struct {
+	gocql.HostSelectionPolicy
+	health *hostHealth
+}
+
+// Pick returns the hosts of the wrapped policy in order, leaving out hosts
+// with an open breaker until the others run out, so a query still goes
+// somewhere when every breaker is open
+func (p *breakerPolicy) Pick(stmt gocql.ExecutableStatement) gocql.NextHost {
+	next := p.HostSelectionPolicy.Pick(stmt)
+	var deferred []gocql.SelectedHost
+	return func() gocql.SelectedHost {
+		for {
+			host := next()
+			if host == nil {
+				break
+			}
+			if p.health.allow(host.Info().ConnectAddressAndPort()) {
+				return host
+			}
+			deferred = append(deferred, host)
+		}
+		if len(deferred) == 0 {
+			return nil
+		}
+		host := deferred[0]
+		deferred = deferred[1:]
+		return host
+	}
+}
+
+// SetCircuitBreaker enables the client-side circuit breaker, or disables it
+// when opts is nil. Options left at zero take their defaults.
+func (s *Session) SetCircuitBreaker(opts *CircuitBreakerOptions) error {
+	if s.health == nil {
+		return fmt.Errorf("session does not track host health")
+	}
+	return s.health.setBreaker(opts)
+}
+
+// CircuitBreaker returns the circuit breaker settings, or nil when disabled
+func (s *Session) CircuitBreaker() *CircuitBreakerOptions {
+	if s.health == nil {
+		return nil
+	}
+	return s.health.breakerOptions()
+}
+
+// HostMetrics returns the requests, errors and breaker state of every
+// coordinator the session has sent requests to
+func (s *Session) HostMetrics() []HostMetrics {
+	if s.health == nil {
+		return []HostMetrics{}
+	}
+	return s.health.metrics()
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// fakeRequestError is a server error with a protocol error code
+type fakeRequestError int
+
+func (e fakeRequestError) Code() int       { return int(e) }
+func (e fakeRequestError) Message() string { return fmt.Sprintf("code %#x", int(e)) }
+func (e fakeRequestError) Error() string   { return e.Message() }
+
+func TestHostFault(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"cancelled", fmt.Errorf("query: %w", context.Canceled), false},
+		{"not found", gocql.ErrNotFound, false},
+		{"timeout", gocql.ErrTimeoutNoResponse, true},
+		{"connection", errors.New("connection refused"), true},
+		{"read timeout", fakeRequestError(gocql.ErrCodeReadTimeout), true},
+		{"overloaded", fakeRequestError(gocql.ErrCodeOverloaded), true},
+		{"server", fakeRequestError(gocql.ErrCodeServer), true},
+		{"unavailable", fakeRequestError(gocql.ErrCodeUnavailable), false},
+		{"syntax", fakeRequestError(gocql.ErrCodeSyntax), false},
+		{"unauthorized", fakeRequestError(gocql.ErrCodeUnauthorized), false},
+		{"invalid", fakeRequestError(gocql.ErrCodeInvalid), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostFault(tt.err); got != tt.want {
+				t.Errorf("hostFault(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostHealthBreaker(t *testing.T) {
+	host, err := gocql.NewHostInfoFromAddrPort(net.ParseIP("10.0.0.1"), 9042)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := host.ConnectAddressAndPort()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h := newHostHealth()
+	h.now = func() time.Time { return now }
+	if err := h.setBreaker(&CircuitBreakerOptions{ErrorRate: 0.5, MinRequests: 4, OpenFor: 10 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	state := func() string { return h.metrics()[0].Breaker }
+	timeout := fakeRequestError(gocql.ErrCodeReadTimeout)
+
+	// Below MinRequests the breaker stays closed whatever the rate
+	h.record(host, time.Millisecond, timeout)
+	h.record(host, time.Millisecond, nil)
+	h.record(host, time.Millisecond, timeout)
+	if state() != BreakerClosed || !h.allow(addr) {
+		t.Fatalf("breaker %s after 3 requests, want closed", state())
+	}
+
+	// The fourth request reaches MinRequests with 3 errors in 4
+	h.record(host, time.Millisecond, timeout)
+	if state() != BreakerOpen || h.allow(addr) {
+		t.Fatalf("breaker %s, want open", state())
+	}
+	if m := h.metrics()[0]; m.Trips != 1 || m.RetryAt == "" || m.Avoided != 1 || m.ErrorRate != 0.75 {
+		t.Errorf("metrics %+v", m)
+	}
+
+	// After OpenFor one probe goes through and a failed probe reopens
+	now = now.Add(10 * time.Second)
+	if !h.allow(addr) || h.allow(addr) {
+		t.Fatal("want exactly one probe when half-open")
+	}
+	h.record(host, time.Millisecond, timeout)
+	if state() != BreakerOpen {
+		t.Fatalf("breaker %s after a failed probe, want open", state())
+	}
+
+	// A successful probe closes the breaker and starts a clean window
+	now = now.Add(10 * time.Second)
+	if !h.allow(addr) {
+		t.Fatal("probe not allowed")
+	}
+	h.record(host, time.Millisecond, nil)
+	if m := h.metrics()[0]; m.Breaker != BreakerClosed || m.WindowRequests != 0 || m.Trips != 2 {
+		t.Errorf("metrics after recovery %+v", m)
+	}
+
+	// Disabling the breaker lets every request through
+	h.record(host, time.Millisecond, timeout)
+	if err := h.setBreaker(nil); err != nil {
+		t.Fatal(err)
+	}
+	if !h.allow(addr) || state() != BreakerClosed {
+		t.Error("disabled breaker still avoids the host")
+	}
+}
+
+func TestSessionObserverHeartbeats(t *testing.T) {
+	host, err := gocql.NewHostInfoFromAddrPort(net.ParseIP("10.0.0.2"), 9042)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	o := &sessionObserver{health: newHostHealth()}
+
+	o.ObserveConnect(gocql.ObservedConnect{Host: host, End: at})
+	o.ObserveConnect(gocql.ObservedConnect{Host: host, End: at, Err: errors.New("connection refused")})
+	// Only SUPPORTED frames answer heartbeats; RESULT frames are ignored
+	o.ObserveFrameHeader(context.Background(), gocql.ObservedFrameHeader{Opcode: 0x08, Host: host, End: at})
+	o.ObserveFrameHeader(context.Background(), gocql.ObservedFrameHeader{Opcode: opSupported, Host: host, End: at.Add(DriverHeartbeatInterval)})
+
+	m := o.health.metrics()[0]
+	if m.Heartbeats != 1 || m.LastHeartbeatAt != "2024-05-01T12:00:05Z" {
+		t.Errorf("heartbeats %d at %q, want 1 at 12:00:05", m.Heartbeats, m.LastHeartbeatAt)
+	}
+	if m.Connects != 1 || m.LastConnectAt != "2024-05-01T12:00:00Z" || m.ConnectErrors != 1 || m.LastConnectError != "connection refused" {
+		t.Errorf("connects %+v", m)
+	}
+	if m.Requests != 0 {
+		t.Errorf("requests = %d, want heartbeats not counted as requests", m.Requests)
+	}
+}
+
+func TestLoadBalancingOptionsWithDefaults(t *testing.T) {
+	tests := []struct {
+		opts    LoadBalancingOptions
+		want    string
+		wantErr bool
+	}{
+		{opts: LoadBalancingOptions{}, want: "round-robin"},
+		{opts: LoadBalancingOptions{LocalDC: "dc1"}, want: "dc-aware (dc1)"},
+		{opts: LoadBalancingOptions{Policy: "DC-Aware", LocalDC: "dc1", TokenAware: true}, want: "token-aware dc-aware (dc1)"},
+		{opts: LoadBalancingOptions{Policy: "dc-aware"}, wantErr: true},
+		{opts: LoadBalancingOptions{Policy: "round-robin", LocalDC: "dc1"}, wantErr: true},
+		{opts: LoadBalancingOptions{Policy: "nearest"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.opts.WithDefaults()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("WithDefaults(%+v) error = %v, want error %v", tt.opts, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("WithDefaults(%+v) = %q, want %q", tt.opts, got.String(), tt.want)
+		}
+	}
+}
+
+func TestContactPoints(t *testing.T) {
+	got, err := contactPoints("10.0.0.1", 9042, []string{"10.0.0.2", " 10.0.0.1:9042 ", "10.0.0.3:9142", "", "::1", "10.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.1:9042", "10.0.0.2:9042", "10.0.0.3:9142", "[::1]:9042"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("contactPoints = %v, want %v", got, want)
+	}
+	if _, err := contactPoints("10.0.0.1", 9042, []string{"10.0.0.2:port"}); err == nil {
+		t.Error("contactPoints accepted a non-numeric port")
+	}
+}
+
+func TestSNIDialerRoute(t *testing.T) {
+	d, err := newSNIDialer(&SNIProxyOptions{Address: "proxy:29042", ServerNames: []string{"a", "b"}}, &tls.Config{}, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contact, err := gocql.NewHostInfoFromAddrPort(net.ParseIP("10.0.0.3"), 29042)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The contact point rotates across the server names
+	var names []string
+	for i := 0; i < 3; i++ {
+		address, name := d.route(contact)
+		if address != "proxy:29042" {
+			t.Errorf("address = %q", address)
+		}
+		names = append(names, name)
+	}
+	if got := strings.Join(names, ","); got != "a,b,a" {
+		t.Errorf("server names = %s, want a,b,a", got)
+	}
+
+	// A refresh replaces them for the next connections
+	if err := d.set("proxy2:29042", []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if address, name := d.route(contact); address != "proxy2:29042" || name != "c" {
+		t.Errorf("after set: %s %s", address, name)
+	}
+	if err := d.set("proxy2", []string{"c"}); err == nil {
+		t.Error("set accepted an address without a port")
+	}
+	if err := d.set("proxy2:29042", nil); err == nil {
+		t.Error("set accepted no server names")
+	}
+	if info := d.info(); len(info.ServerNames) != 1 || info.Address != "proxy2:29042" {
+		t.Errorf("info = %+v", info)
+	}
+}
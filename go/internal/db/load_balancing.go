@@ -0,0 +1,120 @@
+package db
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// Contact points and load balancing
+//
+// The driver only needs one reachable contact point to discover the rest of
+// the cluster, but a session created with a single host cannot connect while
+// that host is down. SessionOptions.Hosts adds contact points that are tried
+// as well. Once connected, the load balancing policy decides which
+// coordinator each request goes to; it is wrapped by the circuit breaker's
+// policy (host_health.go), which only changes the order of the hosts it picks.
+
+// Load balancing policies
+const (
+	LoadBalancingRoundRobin = "round-robin" // Every host in turn (default)
+	LoadBalancingDCAware    = "dc-aware"    // Hosts of LocalDC in turn, then the other data centers
+)
+
+// LoadBalancingOptions chooses how coordinators are picked
+type LoadBalancingOptions struct {
+	Policy     string // LoadBalancingRoundRobin or LoadBalancingDCAware; dc-aware when only LocalDC is set
+	LocalDC    string // Data center whose hosts are preferred; required by dc-aware
+	TokenAware bool   // Send a statement to a replica of its partition first, when the routing key is known
+}
+
+// WithDefaults fills in the policy and checks the options
+func (o LoadBalancingOptions) WithDefaults() (LoadBalancingOptions, error) {
+	o.Policy = strings.ToLower(strings.TrimSpace(o.Policy))
+	o.LocalDC = strings.TrimSpace(o.LocalDC)
+	if o.Policy == "" {
+		o.Policy = LoadBalancingRoundRobin
+		if o.LocalDC != "" {
+			o.Policy = LoadBalancingDCAware
+		}
+	}
+	switch o.Policy {
+	case LoadBalancingRoundRobin:
+		if o.LocalDC != "" {
+			return o, fmt.Errorf("localDC needs the %s load balancing policy", LoadBalancingDCAware)
+		}
+	case LoadBalancingDCAware:
+		if o.LocalDC == "" {
+			return o, fmt.Errorf("the %s load balancing policy needs localDC", LoadBalancingDCAware)
+		}
+	default:
+		return o, fmt.Errorf("unknown load balancing policy %q: use %s or %s", o.Policy, LoadBalancingRoundRobin, LoadBalancingDCAware)
+	}
+	return o, nil
+}
+
+// hostPolicy returns a new driver policy for the options, which must have
+// been checked. A driver session cannot share its policy with another.
+func (o LoadBalancingOptions) hostPolicy() gocql.HostSelectionPolicy {
+	var policy gocql.HostSelectionPolicy
+	if o.Policy == LoadBalancingDCAware {
+		policy = gocql.DCAwareRoundRobinPolicy(o.LocalDC)
+	} else {
+		policy = gocql.RoundRobinHostPolicy()
+	}
+	if o.TokenAware {
+		policy = gocql.TokenAwareHostPolicy(policy)
+	}
+	return policy
+}
+
+// String describes the options, e.g. "token-aware dc-aware (dc1)"
+func (o LoadBalancingOptions) String() string {
+	desc := o.Policy
+	if o.Policy == LoadBalancingDCAware {
+		desc += " (" + o.LocalDC + ")"
+	}
+	if o.TokenAware {
+		desc = "token-aware " + desc
+	}
+	return desc
+}
+
+// contactPoints returns host:port for the main host followed by the extra
+// hosts, without duplicates. Extra hosts without a port use port.
+func contactPoints(host string, port int, extra []string) ([]string, error) {
+	points := []string{net.JoinHostPort(host, strconv.Itoa(port))}
+	seen := map[string]bool{points[0]: true}
+	for _, h := range extra {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		point := h
+		if hostPart, portPart, err := net.SplitHostPort(h); err == nil {
+			if _, err := strconv.Atoi(portPart); err != nil || hostPart == "" {
+				return nil, fmt.Errorf("invalid contact point %q", h)
+			}
+		} else {
+			point = net.JoinHostPort(strings.Trim(h, "[]"), strconv.Itoa(port))
+		}
+		if !seen[point] {
+			seen[point] = true
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
+
+// ContactPoints returns the contact points the session connects through
+func (s *Session) ContactPoints() []string {
+	return s.contactPoints
+}
+
+// LoadBalancing returns the session's load balancing options
+func (s *Session) LoadBalancing() LoadBalancingOptions {
+	return s.loadBalancing
+}
@@ -64,11 +64,12 @@ func (s *Session) GetMaterializedViewMetadata(keyspace, viewName string) (*gocql
 
 // LoadKeyspaceUDTsUsingMetadata delegates to the registry's simplified method
 func (s *Session) LoadKeyspaceUDTsUsingMetadata(keyspace string) error {
-	if s.udtRegistry == nil {
+	udtRegistry := s.GetUDTRegistry()
+	if udtRegistry == nil {
 		return fmt.Errorf("UDT registry not initialized")
 	}
 	// The new simplified registry uses gocql's cache directly
-	return s.udtRegistry.LoadKeyspaceUDTsUsingMetadata(keyspace)
+	return udtRegistry.LoadKeyspaceUDTsUsingMetadata(keyspace)
 }
 
 // formatTypeInfo converts gocql.TypeInfo to a string representation
@@ -115,6 +116,11 @@ func formatTypeInfo(typeInfo gocql.TypeInfo) string {
 			// but we can still return the UDT name which is what we need
 			return udtName
 		}
+	case gocql.TypeCustom:
+		// Vectors are the only custom type the driver describes
+		if vecType, ok := typeInfo.(gocql.VectorType); ok {
+			return fmt.Sprintf("vector<%s, %d>", formatTypeInfo(vecType.SubType), vecType.Dimensions)
+		}
 	default:
 		// Handle native types
 		return typeNameFromType(baseType)
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Query contexts
+//
+// The driver's request timeout bounds each request, so a SELECT that reads
+// hundreds of pages can run far longer than it. The session query timeout
+// bounds a whole statement, every page included. Both it and cancellation
+// work through the context a statement runs under: the driver abandons the
+// in-flight request as soon as the context is done, rather than when the
+// next page would be fetched.
+
+// QueryTimeout returns the time a statement may take, all of its pages
+// included; 0 means no limit
+func (s *Session) QueryTimeout() time.Duration {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.queryTimeout
+}
+
+// SetQueryTimeout sets the time a statement may take, all of its pages
+// included; 0 removes the limit
+func (s *Session) SetQueryTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	s.settingsMu.Lock()
+	s.queryTimeout = timeout
+	s.settingsMu.Unlock()
+}
+
+// WithQueryTimeout returns ctx bounded by the session query timeout. A ctx
+// that already has a deadline keeps it, so a per-query timeout takes
+// precedence. The cancel function must be called once the result has been
+// read.
+func (s *Session) WithQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := s.QueryTimeout()
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// ExecuteCQLQueryCtx executes a regular CQL query under ctx. Cancelling ctx
+// interrupts the request in flight; a streaming result must be read before
+// ctx is cancelled.
+func (s *Session) ExecuteCQLQueryCtx(ctx context.Context, query string) interface{} {
+	return s.ExecuteCQLQueryWithOptions(ctx, query, nil)
+}
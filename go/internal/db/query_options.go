@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// QueryOptions overrides the session's settings for a single statement, so a
+// mixed workload can run some statements at QUORUM and others at LOCAL_ONE
+// without changing the session. Zero fields keep the session's setting.
+type QueryOptions struct {
+	Consistency       string `json:"consistency,omitempty"`       // Regular consistency level, e.g. LOCAL_QUORUM
+	SerialConsistency string `json:"serialConsistency,omitempty"` // SERIAL or LOCAL_SERIAL, for conditional statements
+	PageSize          int    `json:"pageSize,omitempty"`          // Rows per page; the session's when 0
+	Idempotent        *bool  `json:"idempotent,omitempty"`        // Whether the driver may retry or speculate; by statement kind when unset
+
+	// Set by script directives (USE, PAGING, TRACING) rather than by callers
+	Keyspace      string `json:"-"` // Keyspace for unqualified names; needs protocol v5
+	DefaultPaging bool   `json:"-"` // The driver's page size, as a session page size of 0 gives
+	Tracing       *bool  `json:"-"` // Whether the statement is traced; the session's setting when unset
+
+	consistency       gocql.Consistency
+	serialConsistency gocql.Consistency
+}
+
+// Validate checks the option values and normalizes the consistency names
+func (o *QueryOptions) Validate() error {
+	if o.Consistency != "" {
+		o.Consistency = strings.ToUpper(strings.TrimSpace(o.Consistency))
+		consistency, err := parseConsistency(o.Consistency)
+		if err != nil {
+			return err
+		}
+		o.consistency = consistency
+	}
+	if o.SerialConsistency != "" {
+		o.SerialConsistency = strings.ToUpper(strings.TrimSpace(o.SerialConsistency))
+		serial, err := parseSerialConsistency(o.SerialConsistency)
+		if err != nil {
+			return err
+		}
+		o.serialConsistency = serial
+	}
+	if o.PageSize < 0 {
+		return fmt.Errorf("pageSize must not be negative")
+	}
+	return nil
+}
+
+// parseSerialConsistency parses SERIAL or LOCAL_SERIAL
+func parseSerialConsistency(level string) (gocql.Consistency, error) {
+	switch level {
+	case "SERIAL":
+		return gocql.Serial, nil
+	case "LOCAL_SERIAL":
+		return gocql.LocalSerial, nil
+	}
+	return 0, fmt.Errorf("invalid serial consistency level: %s", level)
+}
+
+// queryWith creates a query with the session defaults, then opts, which must
+// have been validated, applied over them. ctx bounds every page of the query;
+// nil opts leave the settings as Query makes them.
+func (s *Session) queryWith(ctx context.Context, stmt string, opts *QueryOptions) *gocql.Query {
+	q := s.Query(stmt).WithContext(ctx)
+	if opts == nil {
+		return q
+	}
+	if opts.Consistency != "" {
+		q.Consistency(opts.consistency)
+	}
+	if opts.SerialConsistency != "" {
+		q.SerialConsistency(opts.serialConsistency)
+	}
+	if opts.PageSize > 0 {
+		q.PageSize(opts.PageSize)
+	}
+	if opts.DefaultPaging && s.cluster != nil {
+		q.PageSize(s.cluster.PageSize)
+	}
+	if opts.Keyspace != "" {
+		q.SetKeyspace(opts.Keyspace)
+	}
+	if opts.Idempotent != nil {
+		q.Idempotent(*opts.Idempotent)
+		if *opts.Idempotent && s.speculative != nil {
+			q.SetSpeculativeExecutionPolicy(s.speculative)
+		}
+	}
+	return q
+}
+
+// QueryWithOptions creates a query as queryWith does, traced when opts or the
+// session turn tracing on. opts must have been validated.
+func (s *Session) QueryWithOptions(ctx context.Context, stmt string, opts *QueryOptions) *gocql.Query {
+	q := s.queryWith(ctx, stmt, opts)
+	if opts.TracingEnabled(s) {
+		q = q.Trace(sessionTracer{s})
+	}
+	return q
+}
+
+// TracingEnabled reports whether a statement run with o is traced: Tracing
+// when set, otherwise the session's setting
+func (o *QueryOptions) TracingEnabled(s *Session) bool {
+	if o != nil && o.Tracing != nil {
+		return *o.Tracing
+	}
+	return s.Tracing()
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+func TestQueryOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts    QueryOptions
+		want    gocql.Consistency
+		wantErr bool
+	}{
+		{opts: QueryOptions{Consistency: "local_one"}, want: gocql.LocalOne},
+		{opts: QueryOptions{Consistency: "ANY"}, want: gocql.Any},
+		{opts: QueryOptions{Consistency: "SERIAL"}, wantErr: true},
+		{opts: QueryOptions{SerialConsistency: "local_serial"}},
+		{opts: QueryOptions{SerialConsistency: "QUORUM"}, wantErr: true},
+		{opts: QueryOptions{PageSize: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		opts := tt.opts
+		err := opts.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, want error %v", tt.opts, err, tt.wantErr)
+			continue
+		}
+		if err == nil && opts.consistency != tt.want {
+			t.Errorf("Validate(%+v) consistency = %v, want %v", tt.opts, opts.consistency, tt.want)
+		}
+	}
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	s := &Session{}
+	ctx, cancel := s.WithQueryTimeout(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("no query timeout: context has a deadline")
+	}
+	cancel()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("cancel: context error = %v, want context.Canceled", ctx.Err())
+	}
+
+	s.SetQueryTimeout(time.Minute)
+	ctx, cancel = s.WithQueryTimeout(context.Background())
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("query timeout: deadline = %v, %v, want within a minute", deadline, ok)
+	}
+	cancel()
+
+	// A per-query deadline takes precedence over the session timeout
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelParent()
+	ctx, cancel = s.WithQueryTimeout(parent)
+	defer cancel()
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) < 59*time.Minute {
+		t.Errorf("per-query deadline: got %v, want the parent's", deadline)
+	}
+}
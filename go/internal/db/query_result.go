@@ -15,17 +15,20 @@ type QueryResult struct {
 	ColumnTypes     []string         // Data types of each column
 	ColumnTypeInfos []gocql.TypeInfo // TypeInfo objects for each column (for UDT support)
 	Headers         []string         // Column names without PK/C indicators
+	Execution       *ExecutionInfo   // Coordinator and attempts that served the query
+	Applied         *bool            // Whether a lightweight transaction was applied; nil for other statements
 }
 
 // StreamingQueryResult wraps query results for progressive loading
 type StreamingQueryResult struct {
-	Headers         []string         // Column headers (with PK/C indicators)
-	ColumnNames     []string         // Original column names (for data lookup)
-	ColumnTypes     []string         // Data types of each column
-	ColumnTypeInfos []gocql.TypeInfo // TypeInfo objects for each column (for UDT support)
-	Iterator        *gocql.Iter      // Iterator for fetching more rows
-	StartTime       time.Time        // Query start time for duration calculation
-	Keyspace        string           // Keyspace extracted from query or session
+	Headers         []string           // Column headers (with PK/C indicators)
+	ColumnNames     []string           // Original column names (for data lookup)
+	ColumnTypes     []string           // Data types of each column
+	ColumnTypeInfos []gocql.TypeInfo   // TypeInfo objects for each column (for UDT support)
+	Iterator        *gocql.Iter        // Iterator for fetching more rows
+	StartTime       time.Time          // Query start time for duration calculation
+	Keyspace        string             // Keyspace extracted from query or session
+	Execution       *ExecutionObserver // Attempts made so far; call Info(Iterator) after reading
 }
 
 // KeyColumnInfo holds information about key columns
@@ -50,12 +53,12 @@ func TypeInfoToString(typeInfo gocql.TypeInfo) string {
 		return "udt"
 	}
 
-	// For custom types, try to get more specific information
+	// Vectors are the only custom type the driver describes
 	if t == gocql.TypeCustom {
-		// Check if it's a vector type by looking at the string representation
-		// The TypeInfo interface doesn't expose the custom type name directly,
-		// but we can infer it from context or default to "vector" for now
-		return "vector"
+		if _, ok := typeInfo.(gocql.VectorType); ok {
+			return "vector"
+		}
+		return "custom"
 	}
 
 	// Handle collection types with their element types
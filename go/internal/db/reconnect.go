@@ -0,0 +1,105 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// Reconnect
+//
+// The driver reopens the connections it loses on its own, but after a long
+// network outage a session can be left with a control connection or pools
+// that never recover. Reconnect builds a new driver session from the cluster
+// config the session was created with and swaps it in. The settings changed
+// on the session (CONSISTENCY, PAGING, TRACING, EXPAND, ...) live on Session
+// rather than on the driver session, and the observers and schema listeners
+// are registered on the cluster config, so all of them carry over.
+
+// ReconnectReport describes a reconnected session and the state it kept
+type ReconnectReport struct {
+	Keyspace            string   `json:"keyspace"`
+	Consistency         string   `json:"consistency"`
+	SerialConsistency   string   `json:"serialConsistency"`
+	PageSize            int      `json:"pageSize"`
+	Tracing             bool     `json:"tracing"`
+	Expand              bool     `json:"expand"`
+	AutoFetch           bool     `json:"autoFetch"`
+	QueryTimeoutMs      int64    `json:"queryTimeoutMs"`
+	ConsistencyFallback string   `json:"consistencyFallback,omitempty"`
+	CircuitBreaker      bool     `json:"circuitBreaker"`
+	Observers           []string `json:"observers"` // Observers and listeners registered on the new driver session
+	DurationMs          float64  `json:"durationMs"`
+}
+
+// Reconnect replaces the driver session with a new one connected with the
+// session's cluster config and current keyspace. The old driver session is
+// closed only once the new one is connected, so a failed reconnect leaves
+// the session as it was. Like SetKeyspace it must not run concurrently with
+// queries.
+func (s *Session) Reconnect() (*ReconnectReport, error) {
+	start := time.Now()
+	if s.health != nil {
+		s.cluster.PoolConfig.HostSelectionPolicy = s.health.policy(s.loadBalancing.hostPolicy())
+	}
+	s.useNextTimeouts()
+	newSession, err := s.cluster.CreateSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconnect: %w", err)
+	}
+
+	old := s.Session
+	s.Session = newSession
+	s.SetUDTRegistry(nil)
+	if old != nil {
+		old.Close()
+	}
+
+	// Timeouts changed by a config reload are now in effect
+	s.settingsMu.Lock()
+	s.activeTimeout = s.cluster.Timeout
+	s.activeConnectTimeout = s.cluster.ConnectTimeout
+	s.settingsMu.Unlock()
+
+	report := &ReconnectReport{
+		Keyspace:            s.Keyspace(),
+		Consistency:         s.Consistency(),
+		SerialConsistency:   s.SerialConsistency(),
+		PageSize:            s.PageSize(),
+		Tracing:             s.Tracing(),
+		Expand:              s.Expand(),
+		AutoFetch:           s.AutoFetch(),
+		QueryTimeoutMs:      s.QueryTimeout().Milliseconds(),
+		ConsistencyFallback: s.ConsistencyFallback(),
+		CircuitBreaker:      s.CircuitBreaker() != nil,
+		Observers:           s.registeredObservers(),
+		DurationMs:          float64(time.Since(start).Microseconds()) / 1000,
+	}
+	logger.DebugfToFile("Session", "Reconnected to %v (keyspace %q) in %.1fms", s.contactPoints, report.Keyspace, report.DurationMs)
+	return report, nil
+}
+
+// registeredObservers names the observers and listeners on the cluster config
+func (s *Session) registeredObservers() []string {
+	observers := []string{}
+	if s.cluster.QueryObserver != nil {
+		observers = append(observers, "query")
+	}
+	if s.cluster.BatchObserver != nil {
+		observers = append(observers, "batch")
+	}
+	if s.cluster.FrameHeaderObserver != nil {
+		observers = append(observers, "heartbeat")
+	}
+	if s.cluster.ConnectObserver != nil {
+		observers = append(observers, "connect")
+	}
+	if s.cluster.Metadata.SchemaListener.KeyspaceChangeListener != nil {
+		observers = append(observers, "schemaChanges")
+	}
+	if s.cluster.Metadata.SchemaListener.UserTypeChangeListener != nil {
+		observers = append(observers, "userTypeChanges")
+	}
+	return observers
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"sync"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// rowMapPool holds row maps handed back by ReleaseRows. Paging reads the
+// same shape of row over and over, so reusing the maps keeps their buckets
+// allocated between pages instead of growing a fresh map per row.
+var rowMapPool = sync.Pool{
+	New: func() interface{} { return make(map[string]interface{}) },
+}
+
+// ReleaseRows returns rows read by a RowScanner to the pool. The rows must
+// not be used afterwards, so callers release them once they are serialized.
+func ReleaseRows(rows []map[string]interface{}) {
+	for i, row := range rows {
+		if row == nil {
+			continue
+		}
+		clear(row)
+		rowMapPool.Put(row)
+		rows[i] = nil
+	}
+}
+
+// RowScanner reads iterator rows into pooled maps. It is the allocation-lean
+// equivalent of gocql's MapScan: column names, including the expanded
+// names of tuple elements, are resolved once per query and shared by every
+// row, and the scan destinations are reused rather than rebuilt per row.
+type RowScanner struct {
+	scan  func(dest ...interface{}) bool
+	names []string
+	zeros []interface{}
+	slots []interface{} // Values, reset to the column's zero before each row
+	dests []interface{} // Pointers into slots, passed to scan
+}
+
+// NewRowScanner returns a scanner over the rows of iter
+func NewRowScanner(iter *gocql.Iter) *RowScanner {
+	var names []string
+	var zeros []interface{}
+	for _, column := range iter.Columns() {
+		if tuple, ok := column.TypeInfo.(gocql.TupleTypeInfo); ok {
+			for i, elem := range tuple.Elems {
+				names = append(names, gocql.TupleColumnName(column.Name, i))
+				zeros = append(zeros, elem.Zero())
+			}
+			continue
+		}
+		names = append(names, column.Name)
+		zeros = append(zeros, column.TypeInfo.Zero())
+	}
+	return newRowScanner(iter.Scan, names, zeros)
+}
+
+// newRowScanner builds a scanner over any scan function; tests use it to
+// feed rows without a cluster
+func newRowScanner(scan func(dest ...interface{}) bool, names []string, zeros []interface{}) *RowScanner {
+	rs := &RowScanner{
+		scan:  scan,
+		names: names,
+		zeros: zeros,
+		slots: make([]interface{}, len(names)),
+		dests: make([]interface{}, len(names)),
+	}
+	for i := range rs.slots {
+		rs.dests[i] = &rs.slots[i]
+	}
+	return rs
+}
+
+// Next reads the next row into a pooled map, or returns false when the
+// iterator is exhausted or failed; the iterator's Close reports the error
+func (rs *RowScanner) Next() (map[string]interface{}, bool) {
+	copy(rs.slots, rs.zeros)
+	if !rs.scan(rs.dests...) {
+		return nil, false
+	}
+	row := rowMapPool.Get().(map[string]interface{})
+	for i, name := range rs.names {
+		row[name] = rs.slots[i]
+	}
+	return row, true
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// fakeRows returns a scan function producing n rows of (id int, name text, score double)
+func fakeRows(n int) func(dest ...interface{}) bool {
+	i := 0
+	return func(dest ...interface{}) bool {
+		if i >= n {
+			return false
+		}
+		*dest[0].(*interface{}) = i
+		if i%2 == 0 {
+			*dest[1].(*interface{}) = fmt.Sprintf("name-%d", i)
+		}
+		*dest[2].(*interface{}) = float64(i) / 2
+		i++
+		return true
+	}
+}
+
+var fakeNames = []string{"id", "name", "score"}
+
+func TestRowScanner(t *testing.T) {
+	rs := newRowScanner(fakeRows(3), fakeNames, []interface{}{0, "", 0.0})
+
+	var rows []map[string]interface{}
+	for {
+		row, ok := rs.Next()
+		if !ok {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	// Row 1 has no name; the slot must not carry row 0's value over
+	if rows[1]["name"] != "" || rows[2]["name"] != "name-2" || rows[2]["score"] != 1.0 {
+		t.Errorf("unexpected rows: %v", rows)
+	}
+
+	ReleaseRows(rows)
+	if rows[0] != nil {
+		t.Error("released rows should be cleared from the slice")
+	}
+	// A map from the pool starts empty whether or not it was reused
+	rs = newRowScanner(fakeRows(1), fakeNames, []interface{}{0, "", 0.0})
+	if row, _ := rs.Next(); len(row) != len(fakeNames) {
+		t.Errorf("reused row has %d keys, want %d", len(row), len(fakeNames))
+	}
+}
+
+// mapScanRows mimics gocql's MapScan: names, destinations and the row map
+// are allocated again for every row
+func mapScanRows(scan func(dest ...interface{}) bool, zeros []interface{}) (map[string]interface{}, bool) {
+	names := make([]string, 0, len(fakeNames))
+	values := make([]interface{}, 0, len(fakeNames))
+	for i, name := range fakeNames {
+		zero := zeros[i]
+		names = append(names, name)
+		values = append(values, &zero)
+	}
+	if !scan(values...) {
+		return nil, false
+	}
+	row := make(map[string]interface{})
+	for i, name := range names {
+		row[name] = *values[i].(*interface{})
+	}
+	return row, true
+}
+
+// benchmarkPaging pages a million rows 100 at a time, serializing each page
+// as ExecuteQueryPaged does, and reports the GC pause time per operation
+func benchmarkPaging(b *testing.B, pooled bool) {
+	const total, pageSize = 1_000_000, 100
+	zeros := []interface{}{0, "", 0.0}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		scan := fakeRows(total)
+		rs := newRowScanner(scan, fakeNames, zeros)
+		page := make([]map[string]interface{}, 0, pageSize)
+		for done := false; !done; {
+			page = page[:0]
+			for len(page) < pageSize {
+				var row map[string]interface{}
+				var ok bool
+				if pooled {
+					row, ok = rs.Next()
+				} else {
+					row, ok = mapScanRows(scan, zeros)
+				}
+				if !ok {
+					done = true
+					break
+				}
+				page = append(page, row)
+			}
+			if _, err := json.Marshal(page); err != nil {
+				b.Fatal(err)
+			}
+			if pooled {
+				ReleaseRows(page)
+			}
+		}
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(b.N), "gc-pause-ns/op")
+	b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gcs/op")
+}
+
+func BenchmarkPagingMapScan(b *testing.B) { benchmarkPaging(b, false) }
+
+func BenchmarkPagingRowScanner(b *testing.B) { benchmarkPaging(b, true) }
@@ -9,9 +9,24 @@ import (
 	"github.com/axonops/cqlai-node/internal/logger"
 )
 
+// Schema cache modes. On clusters with many thousands of tables the full cache
+// (and the driver metadata it loads) can take a lot of memory, so a session can
+// limit it to its current keyspace or turn it off.
+const (
+	SchemaCacheFull     = "full"     // Tables and columns of every keyspace (default)
+	SchemaCacheKeyspace = "keyspace" // Tables and columns of the current keyspace only
+	SchemaCacheOff      = "off"      // No cache
+)
+
+// ValidSchemaCacheMode reports whether mode is one of the schema cache modes
+func ValidSchemaCacheMode(mode string) bool {
+	return mode == SchemaCacheFull || mode == SchemaCacheKeyspace || mode == SchemaCacheOff
+}
+
 // SchemaCache provides schema information using gocql's metadata API
 // This replaces the old implementation that maintained its own cache
 type SchemaCache struct {
+	Mode        string // SchemaCacheFull or SchemaCacheKeyspace
 	Keyspaces   []string
 	Tables      map[string][]CachedTableInfo        // keyspace -> tables
 	Columns     map[string]map[string][]ColumnInfo // keyspace -> table -> columns
@@ -19,6 +34,11 @@ type SchemaCache struct {
 	LastRefresh time.Time
 	Mu          sync.RWMutex
 	session     *Session
+
+	// Cluster schema_version the contents were read at, when the cache is
+	// persisted, and where they were last loaded from
+	SchemaVersion string
+	Source        string // SchemaSourceCluster or SchemaSourceDisk
 }
 
 // CachedTableInfo extends TableInfo with cache-specific fields
@@ -35,7 +55,14 @@ type SearchIndex struct {
 
 // NewSchemaCache creates a new schema cache using gocql metadata
 func NewSchemaCache(session *Session) *SchemaCache {
+	return NewSchemaCacheWithMode(session, SchemaCacheFull)
+}
+
+// NewSchemaCacheWithMode creates a schema cache covering every keyspace or
+// only the session's current one
+func NewSchemaCacheWithMode(session *Session, mode string) *SchemaCache {
 	return &SchemaCache{
+		Mode:        mode,
 		session:     session,
 		Tables:      make(map[string][]CachedTableInfo),
 		Columns:     make(map[string]map[string][]ColumnInfo),
@@ -70,7 +97,7 @@ func (sc *SchemaCache) GetAllKeyspaces() ([]string, error) {
 		return nil, fmt.Errorf("failed to get keyspaces: %w", err)
 	}
 
-	return keyspaces, nil
+	return sc.session.ListedKeyspaces(keyspaces), nil
 }
 
 // GetKeyspaceTables returns all tables for a specific keyspace using gocql metadata
@@ -181,62 +208,96 @@ func (sc *SchemaCache) GetTableColumns(keyspace, table string) ([]ColumnInfo, er
 }
 
 // Refresh loads or refreshes the schema metadata
-// With gocql's metadata API, this mainly updates the search index
+// With gocql's metadata API, this mainly updates the search index. The new
+// contents are built before the lock is taken, so lookups keep answering from
+// the previous contents while a refresh runs.
 func (sc *SchemaCache) Refresh() error {
-	sc.Mu.Lock()
-	defer sc.Mu.Unlock()
-
 	logger.DebugToFile("SchemaCache", "Starting schema refresh using metadata API")
 
+	// Read the version first: if the schema changes during the load, the
+	// cache is saved under the older version and rebuilt by the next load
+	schemaVersion := ""
+	if sc.session != nil && sc.session.schemaCacheDir != "" {
+		if _, version, err := sc.session.clusterSchemaVersion(); err == nil {
+			schemaVersion = version
+		}
+	}
+
 	// Get all keyspaces
 	keyspaces, err := sc.GetAllKeyspaces()
 	if err != nil {
 		return fmt.Errorf("failed to get keyspaces: %w", err)
 	}
 
-	sc.Keyspaces = keyspaces
-
-	// Clear and rebuild the search-related caches
-	sc.Tables = make(map[string][]CachedTableInfo)
-	sc.Columns = make(map[string]map[string][]ColumnInfo)
-	sc.SearchIndex = &SearchIndex{
-		TableTokens: make(map[string][]string),
-	}
+	tables := make(map[string][]CachedTableInfo)
+	columns := make(map[string]map[string][]ColumnInfo)
 
-	// Populate tables and columns for each keyspace
-	for _, ks := range keyspaces {
-		tables, err := sc.GetKeyspaceTables(ks)
+	// Populate tables and columns for each keyspace in scope
+	for _, ks := range sc.scope(keyspaces) {
+		ksTables, err := sc.GetKeyspaceTables(ks)
 		if err != nil {
 			logger.DebugfToFile("SchemaCache", "Failed to get tables for keyspace %s: %v", ks, err)
 			continue
 		}
 
-		sc.Tables[ks] = tables
-
-		// Initialize column map for keyspace
-		if sc.Columns[ks] == nil {
-			sc.Columns[ks] = make(map[string][]ColumnInfo)
-		}
+		tables[ks] = ksTables
+		columns[ks] = make(map[string][]ColumnInfo)
 
 		// Get columns for each table
-		for _, table := range tables {
-			columns, err := sc.GetTableColumns(ks, table.TableName)
+		for _, table := range ksTables {
+			tableColumns, err := sc.GetTableColumns(ks, table.TableName)
 			if err != nil {
 				logger.DebugfToFile("SchemaCache", "Failed to get columns for %s.%s: %v", ks, table.TableName, err)
 				continue
 			}
+			columns[ks][table.TableName] = tableColumns
+		}
+	}
 
-			sc.Columns[ks][table.TableName] = columns
+	sc.install(keyspaces, tables, columns, time.Now(), schemaVersion, SchemaSourceCluster)
+	logger.DebugfToFile("SchemaCache", "Schema refresh completed. Found %d keyspaces", len(keyspaces))
 
+	return nil
+}
+
+// install replaces the cache contents and rebuilds the search index
+func (sc *SchemaCache) install(keyspaces []string, tables map[string][]CachedTableInfo, columns map[string]map[string][]ColumnInfo, loaded time.Time, schemaVersion, source string) {
+	index := &SearchIndex{
+		TableTokens: make(map[string][]string),
+	}
+	for ks, ksColumns := range columns {
+		for table := range ksColumns {
 			// Build search tokens for fuzzy matching
-			tokens := buildSearchTokens(table.TableName)
-			sc.SearchIndex.TableTokens[fmt.Sprintf("%s.%s", ks, table.TableName)] = tokens
+			index.TableTokens[fmt.Sprintf("%s.%s", ks, table)] = buildSearchTokens(table)
 		}
 	}
 
-	sc.LastRefresh = time.Now()
-	logger.DebugfToFile("SchemaCache", "Schema refresh completed. Found %d keyspaces", len(keyspaces))
+	sc.Mu.Lock()
+	defer sc.Mu.Unlock()
+	sc.Keyspaces = keyspaces
+	sc.Tables = tables
+	sc.Columns = columns
+	sc.SearchIndex = index
+	sc.LastRefresh = loaded
+	sc.SchemaVersion = schemaVersion
+	sc.Source = source
+}
 
+// scope returns the keyspaces whose tables and columns are cached. Keyspace
+// names are always kept; they are cheap and needed for completion.
+func (sc *SchemaCache) scope(keyspaces []string) []string {
+	if sc.Mode != SchemaCacheKeyspace {
+		return keyspaces
+	}
+	current := ""
+	if sc.session != nil {
+		current = sc.session.Keyspace()
+	}
+	for _, ks := range keyspaces {
+		if ks == current {
+			return []string{ks}
+		}
+	}
 	return nil
 }
 
@@ -343,6 +404,73 @@ func (sc *SchemaCache) CountTotalTables() int {
 	return count
 }
 
+// SchemaCacheStats summarizes the contents of the schema cache
+type SchemaCacheStats struct {
+	Mode           string
+	Keyspaces      int
+	Tables         int
+	Columns        int
+	EstimatedBytes int64 // Approximate memory held by the cache itself
+	LastRefresh    time.Time
+	SchemaVersion  string
+	Source         string
+}
+
+// Approximate fixed sizes of cached entries, excluding their strings
+const (
+	cachedTableOverhead  = 160
+	cachedColumnOverhead = 56
+	stringOverhead       = 16
+)
+
+// Stats returns the number of cached keyspaces, tables and columns and an
+// estimate of the memory they use
+func (sc *SchemaCache) Stats() SchemaCacheStats {
+	sc.Mu.RLock()
+	defer sc.Mu.RUnlock()
+
+	stats := SchemaCacheStats{
+		Mode:          sc.Mode,
+		Keyspaces:     len(sc.Keyspaces),
+		LastRefresh:   sc.LastRefresh,
+		SchemaVersion: sc.SchemaVersion,
+		Source:        sc.Source,
+	}
+	str := func(s string) int64 { return stringOverhead + int64(len(s)) }
+	for _, ks := range sc.Keyspaces {
+		stats.EstimatedBytes += str(ks)
+	}
+	for _, tables := range sc.Tables {
+		stats.Tables += len(tables)
+		for _, t := range tables {
+			stats.EstimatedBytes += cachedTableOverhead + str(t.KeyspaceName) + str(t.TableName)
+			for _, k := range t.PartitionKeys {
+				stats.EstimatedBytes += str(k)
+			}
+			for _, k := range t.ClusteringKeys {
+				stats.EstimatedBytes += str(k)
+			}
+		}
+	}
+	for _, tables := range sc.Columns {
+		for _, columns := range tables {
+			stats.Columns += len(columns)
+			for _, c := range columns {
+				stats.EstimatedBytes += cachedColumnOverhead + str(c.Name) + str(c.DataType) + str(c.Kind)
+			}
+		}
+	}
+	if sc.SearchIndex != nil {
+		for name, tokens := range sc.SearchIndex.TableTokens {
+			stats.EstimatedBytes += str(name)
+			for _, tok := range tokens {
+				stats.EstimatedBytes += str(tok)
+			}
+		}
+	}
+	return stats
+}
+
 // GetTableSchema returns schema information for a specific table
 // This method is used by AI components for query context
 func (sc *SchemaCache) GetTableSchema(keyspace, table string) (*TableSchema, error) {
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 )
@@ -25,6 +26,87 @@ func TestSchemaCache_CountTotalTables(t *testing.T) {
 	}
 }
 
+func TestSchemaCache_Stats(t *testing.T) {
+	refreshed := time.Now()
+	sc := &SchemaCache{
+		Keyspaces: []string{"keyspace1", "keyspace2"},
+		Tables: map[string][]CachedTableInfo{
+			"keyspace1": {
+				{TableInfo: TableInfo{TableName: "table1"}},
+				{TableInfo: TableInfo{TableName: "table2"}},
+			},
+			"keyspace2": {
+				{TableInfo: TableInfo{TableName: "table3"}},
+			},
+		},
+		Columns: map[string]map[string][]ColumnInfo{
+			"keyspace1": {
+				"table1": {{Name: "id"}, {Name: "name"}},
+				"table2": {{Name: "id"}},
+			},
+		},
+		LastRefresh: refreshed,
+	}
+
+	stats := sc.Stats()
+	if stats.Keyspaces != 2 {
+		t.Errorf("Expected 2 keyspaces, got %d", stats.Keyspaces)
+	}
+	if stats.Tables != 3 {
+		t.Errorf("Expected 3 tables, got %d", stats.Tables)
+	}
+	if stats.Columns != 3 {
+		t.Errorf("Expected 3 columns, got %d", stats.Columns)
+	}
+	if !stats.LastRefresh.Equal(refreshed) {
+		t.Errorf("Expected LastRefresh %v, got %v", refreshed, stats.LastRefresh)
+	}
+}
+
+func TestSchemaCache_StatsEstimatedBytes(t *testing.T) {
+	sc := &SchemaCache{Mode: SchemaCacheFull}
+	empty := sc.Stats().EstimatedBytes
+
+	sc.Keyspaces = []string{"keyspace1"}
+	sc.Tables = map[string][]CachedTableInfo{
+		"keyspace1": {{TableInfo: TableInfo{KeyspaceName: "keyspace1", TableName: "table1", PartitionKeys: []string{"id"}}}},
+	}
+	sc.Columns = map[string]map[string][]ColumnInfo{
+		"keyspace1": {"table1": {{Name: "id", DataType: "uuid", Kind: "partition_key"}}},
+	}
+	stats := sc.Stats()
+	if stats.Mode != SchemaCacheFull {
+		t.Errorf("Expected mode %q, got %q", SchemaCacheFull, stats.Mode)
+	}
+	if stats.EstimatedBytes <= empty {
+		t.Errorf("Expected estimate to grow with contents, got %d (empty %d)", stats.EstimatedBytes, empty)
+	}
+}
+
+func TestSchemaCache_Scope(t *testing.T) {
+	keyspaces := []string{"keyspace1", "keyspace2"}
+
+	full := &SchemaCache{Mode: SchemaCacheFull}
+	if got := full.scope(keyspaces); len(got) != 2 {
+		t.Errorf("Expected full mode to cover every keyspace, got %v", got)
+	}
+
+	// Without a session there is no current keyspace to cache
+	scoped := &SchemaCache{Mode: SchemaCacheKeyspace}
+	if got := scoped.scope(keyspaces); len(got) != 0 {
+		t.Errorf("Expected keyspace mode without a current keyspace to cover nothing, got %v", got)
+	}
+
+	for _, mode := range []string{"full", "keyspace", "off"} {
+		if !ValidSchemaCacheMode(mode) {
+			t.Errorf("Expected %q to be a valid mode", mode)
+		}
+	}
+	if ValidSchemaCacheMode("partial") {
+		t.Error("Expected \"partial\" to be rejected")
+	}
+}
+
 func TestSchemaCache_GetTableSchema(t *testing.T) {
 	// Create a mock schema cache
 	sc := &SchemaCache{
@@ -97,4 +179,57 @@ func TestSchemaCache_RefreshIfNeeded(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for refresh without session")
 	}
-}
\ No newline at end of file
+}
+func TestSchemaCache_PersistedRoundTrip(t *testing.T) {
+	saved := persistedSchema{
+		FormatVersion: schemaFileFormat,
+		SchemaVersion: "9b1c0f4e-2a7d-3c55-8e21-4f0d6a1b7c90",
+		SavedAt:       time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Keyspaces:     []string{"app"},
+		Tables: map[string][]CachedTableInfo{
+			"app": {{TableInfo: TableInfo{KeyspaceName: "app", TableName: "user_events", PartitionKeys: []string{"id"}}}},
+		},
+		Columns: map[string]map[string][]ColumnInfo{
+			"app": {"user_events": {{Name: "id", DataType: "uuid", Kind: "partition_key"}}},
+		},
+	}
+	registry := NewUDTRegistry(nil)
+	registry.types["app.address"] = &UDTDefinition{Keyspace: "app", Name: "address", Fields: []UDTField{
+		{Name: "street", TypeStr: "text"},
+		{Name: "phones", TypeStr: "frozen<list<text>>"},
+	}}
+	saved.UDTs = registry.persisted()
+	saved.UDTs = append(saved.UDTs, persistedUDT{Keyspace: "app", Name: "broken", Fields: []persistedUDTField{{Name: "f", Type: "map<text"}}})
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded persistedSchema
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := NewSchemaCacheWithMode(nil, SchemaCacheFull)
+	sc.install(loaded.Keyspaces, loaded.Tables, loaded.Columns, loaded.SavedAt, loaded.SchemaVersion, SchemaSourceDisk)
+	stats := sc.Stats()
+	if stats.Tables != 1 || stats.Columns != 1 || stats.Source != SchemaSourceDisk || stats.SchemaVersion != saved.SchemaVersion {
+		t.Errorf("Unexpected stats after load: %+v", stats)
+	}
+	if !stats.LastRefresh.Equal(saved.SavedAt) {
+		t.Errorf("Expected LastRefresh %v, got %v", saved.SavedAt, stats.LastRefresh)
+	}
+	if len(sc.SearchIndex.TableTokens["app.user_events"]) == 0 {
+		t.Error("Expected search tokens for app.user_events")
+	}
+
+	seeded := NewUDTRegistry(nil)
+	seeded.seed(loaded.UDTs)
+	def := seeded.types["app.address"]
+	if def == nil || len(def.Fields) != 2 || def.Fields[1].TypeInfo == nil || !def.Fields[1].TypeInfo.Frozen {
+		t.Errorf("Expected app.address with parsed field types, got %+v", def)
+	}
+	if _, ok := seeded.types["app.broken"]; ok {
+		t.Error("Expected a type whose fields do not parse to be left out")
+	}
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// SchemaDropEvent describes a keyspace or table dropped on the cluster.
+// Table is empty when the whole keyspace was dropped.
+type SchemaDropEvent struct {
+	Keyspace string
+	Table    string
+}
+
+// schemaDropListener receives schema change events from the driver and
+// forwards keyspace and table drops to the registered handlers. Events are
+// delivered on a driver goroutine, so handlers must not block.
+type schemaDropListener struct {
+	mu       sync.RWMutex
+	handlers []func(SchemaDropEvent)
+}
+
+func (l *schemaDropListener) add(fn func(SchemaDropEvent)) {
+	l.mu.Lock()
+	l.handlers = append(l.handlers, fn)
+	l.mu.Unlock()
+}
+
+func (l *schemaDropListener) notify(event SchemaDropEvent) {
+	l.mu.RLock()
+	handlers := l.handlers
+	l.mu.RUnlock()
+	for _, fn := range handlers {
+		fn(event)
+	}
+}
+
+func (l *schemaDropListener) OnKeyspaceCreated(gocql.OnKeyspaceCreatedEvent) {}
+func (l *schemaDropListener) OnKeyspaceUpdated(gocql.OnKeyspaceUpdatedEvent) {}
+
+func (l *schemaDropListener) OnKeyspaceDropped(event gocql.OnKeyspaceDroppedEvent) {
+	if event.Keyspace != nil {
+		l.notify(SchemaDropEvent{Keyspace: event.Keyspace.Name})
+	}
+}
+
+func (l *schemaDropListener) OnTableCreated(gocql.OnTableCreatedEvent) {}
+func (l *schemaDropListener) OnTableUpdated(gocql.OnTableUpdatedEvent) {}
+
+func (l *schemaDropListener) OnTableDropped(event gocql.OnTableDroppedEvent) {
+	if event.Table != nil {
+		l.notify(SchemaDropEvent{Keyspace: event.Table.Keyspace, Table: event.Table.Name})
+	}
+}
+
+// udtChangeListener forwards user type changes from the driver to the
+// registered handlers as (keyspace, type name). Like schemaDropListener,
+// handlers run on a driver goroutine and must not block.
+type udtChangeListener struct {
+	mu       sync.RWMutex
+	handlers []func(keyspace, name string)
+}
+
+func (l *udtChangeListener) add(fn func(keyspace, name string)) {
+	l.mu.Lock()
+	l.handlers = append(l.handlers, fn)
+	l.mu.Unlock()
+}
+
+func (l *udtChangeListener) notify(udt *gocql.UserTypeMetadata) {
+	if udt == nil {
+		return
+	}
+	l.mu.RLock()
+	handlers := l.handlers
+	l.mu.RUnlock()
+	for _, fn := range handlers {
+		fn(udt.Keyspace, udt.Name)
+	}
+}
+
+func (l *udtChangeListener) OnUserTypeCreated(event gocql.OnUserTypeCreatedEvent) {
+	l.notify(event.UserType)
+}
+
+func (l *udtChangeListener) OnUserTypeUpdated(event gocql.OnUserTypeUpdatedEvent) {
+	l.notify(event.New)
+}
+
+func (l *udtChangeListener) OnUserTypeDropped(event gocql.OnUserTypeDroppedEvent) {
+	l.notify(event.UserType)
+}
+
+// OnUserTypeChanged registers fn to be called when a user type is created,
+// altered or dropped. fn runs on a driver goroutine and must return quickly.
+func (s *Session) OnUserTypeChanged(fn func(keyspace, name string)) {
+	if s.udtChanges != nil {
+		s.udtChanges.add(fn)
+	}
+}
+
+// OnSchemaDropped registers fn to be called when a keyspace or table is
+// dropped. fn runs on a driver goroutine and must return quickly.
+func (s *Session) OnSchemaDropped(fn func(SchemaDropEvent)) {
+	if s.schemaDrops != nil {
+		s.schemaDrops.add(fn)
+	}
+}
+
+// Schema change kinds and targets, named as in the native protocol's
+// SCHEMA_CHANGE events
+const (
+	SchemaCreated = "CREATED"
+	SchemaUpdated = "UPDATED"
+	SchemaDropped = "DROPPED"
+
+	SchemaTargetKeyspace  = "KEYSPACE"
+	SchemaTargetTable     = "TABLE"
+	SchemaTargetType      = "TYPE"
+	SchemaTargetFunction  = "FUNCTION"
+	SchemaTargetAggregate = "AGGREGATE"
+)
+
+// SchemaChangeEvent describes a schema element created, altered or dropped
+// on the cluster
+type SchemaChangeEvent struct {
+	Change   string    `json:"change"` // SchemaCreated, SchemaUpdated or SchemaDropped
+	Target   string    `json:"target"` // SchemaTargetKeyspace, SchemaTargetTable, ...
+	Keyspace string    `json:"keyspace"`
+	Name     string    `json:"name,omitempty"` // Empty for keyspaces
+	Time     time.Time `json:"time"`
+}
+
+// schemaChangeListener forwards every schema change the driver reports to
+// the registered handlers. The driver reports changes once its metadata has
+// been refreshed, so a handler that reads the metadata sees the new schema.
+// Like schemaDropListener, handlers run on a driver goroutine and must not
+// block.
+type schemaChangeListener struct {
+	mu       sync.RWMutex
+	handlers []func(SchemaChangeEvent)
+}
+
+func (l *schemaChangeListener) add(fn func(SchemaChangeEvent)) {
+	l.mu.Lock()
+	l.handlers = append(l.handlers, fn)
+	l.mu.Unlock()
+}
+
+func (l *schemaChangeListener) notify(change, target, keyspace, name string) {
+	event := SchemaChangeEvent{Change: change, Target: target, Keyspace: keyspace, Name: name, Time: time.Now().UTC()}
+	l.mu.RLock()
+	handlers := l.handlers
+	l.mu.RUnlock()
+	for _, fn := range handlers {
+		fn(event)
+	}
+}
+
+func (l *schemaChangeListener) keyspace(change string, ks *gocql.KeyspaceMetadata) {
+	if ks != nil {
+		l.notify(change, SchemaTargetKeyspace, ks.Name, "")
+	}
+}
+
+func (l *schemaChangeListener) table(change string, t *gocql.TableMetadata) {
+	if t != nil {
+		l.notify(change, SchemaTargetTable, t.Keyspace, t.Name)
+	}
+}
+
+func (l *schemaChangeListener) userType(change string, t *gocql.UserTypeMetadata) {
+	if t != nil {
+		l.notify(change, SchemaTargetType, t.Keyspace, t.Name)
+	}
+}
+
+func (l *schemaChangeListener) function(change string, f *gocql.FunctionMetadata) {
+	if f != nil {
+		l.notify(change, SchemaTargetFunction, f.Keyspace, f.Name)
+	}
+}
+
+func (l *schemaChangeListener) aggregate(change string, a *gocql.AggregateMetadata) {
+	if a != nil {
+		l.notify(change, SchemaTargetAggregate, a.Keyspace, a.Name)
+	}
+}
+
+func (l *schemaChangeListener) OnKeyspaceCreated(e gocql.OnKeyspaceCreatedEvent) {
+	l.keyspace(SchemaCreated, e.Keyspace)
+}
+func (l *schemaChangeListener) OnKeyspaceUpdated(e gocql.OnKeyspaceUpdatedEvent) {
+	l.keyspace(SchemaUpdated, e.New)
+}
+func (l *schemaChangeListener) OnKeyspaceDropped(e gocql.OnKeyspaceDroppedEvent) {
+	l.keyspace(SchemaDropped, e.Keyspace)
+}
+func (l *schemaChangeListener) OnTableCreated(e gocql.OnTableCreatedEvent) {
+	l.table(SchemaCreated, e.Table)
+}
+func (l *schemaChangeListener) OnTableUpdated(e gocql.OnTableUpdatedEvent) {
+	l.table(SchemaUpdated, e.New)
+}
+func (l *schemaChangeListener) OnTableDropped(e gocql.OnTableDroppedEvent) {
+	l.table(SchemaDropped, e.Table)
+}
+func (l *schemaChangeListener) OnUserTypeCreated(e gocql.OnUserTypeCreatedEvent) {
+	l.userType(SchemaCreated, e.UserType)
+}
+func (l *schemaChangeListener) OnUserTypeUpdated(e gocql.OnUserTypeUpdatedEvent) {
+	l.userType(SchemaUpdated, e.New)
+}
+func (l *schemaChangeListener) OnUserTypeDropped(e gocql.OnUserTypeDroppedEvent) {
+	l.userType(SchemaDropped, e.UserType)
+}
+func (l *schemaChangeListener) OnFunctionCreated(e gocql.OnFunctionCreatedEvent) {
+	l.function(SchemaCreated, e.Function)
+}
+func (l *schemaChangeListener) OnFunctionUpdated(e gocql.OnFunctionUpdatedEvent) {
+	l.function(SchemaUpdated, e.New)
+}
+func (l *schemaChangeListener) OnFunctionDropped(e gocql.OnFunctionDroppedEvent) {
+	l.function(SchemaDropped, e.Function)
+}
+func (l *schemaChangeListener) OnAggregateCreated(e gocql.OnAggregateCreatedEvent) {
+	l.aggregate(SchemaCreated, e.Aggregate)
+}
+func (l *schemaChangeListener) OnAggregateUpdated(e gocql.OnAggregateUpdatedEvent) {
+	l.aggregate(SchemaUpdated, e.New)
+}
+func (l *schemaChangeListener) OnAggregateDropped(e gocql.OnAggregateDroppedEvent) {
+	l.aggregate(SchemaDropped, e.Aggregate)
+}
+
+// OnSchemaChanged registers fn to be called for every keyspace, table, user
+// type, function and aggregate created, altered or dropped. fn runs on a
+// driver goroutine and must return quickly.
+func (s *Session) OnSchemaChanged(fn func(SchemaChangeEvent)) {
+	if s.schemaChanges != nil {
+		s.schemaChanges.add(fn)
+	}
+}
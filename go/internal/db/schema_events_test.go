@@ -0,0 +1,64 @@
+package db
+
+import (
+	"testing"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+func TestSchemaDropListener(t *testing.T) {
+	l := &schemaDropListener{}
+	s := &Session{schemaDrops: l}
+
+	var events []SchemaDropEvent
+	s.OnSchemaDropped(func(e SchemaDropEvent) { events = append(events, e) })
+
+	l.OnTableDropped(gocql.OnTableDroppedEvent{Table: &gocql.TableMetadata{Keyspace: "app", Name: "events"}})
+	l.OnKeyspaceDropped(gocql.OnKeyspaceDroppedEvent{Keyspace: &gocql.KeyspaceMetadata{Name: "old"}})
+	l.OnTableCreated(gocql.OnTableCreatedEvent{Table: &gocql.TableMetadata{Keyspace: "app", Name: "new"}})
+	l.OnTableDropped(gocql.OnTableDroppedEvent{})
+
+	want := []SchemaDropEvent{{Keyspace: "app", Table: "events"}, {Keyspace: "old"}}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+
+	// A session without a listener ignores registrations
+	(&Session{}).OnSchemaDropped(func(SchemaDropEvent) {})
+}
+
+func TestSchemaChangeListener(t *testing.T) {
+	l := &schemaChangeListener{}
+	s := &Session{schemaChanges: l}
+
+	var events []SchemaChangeEvent
+	s.OnSchemaChanged(func(e SchemaChangeEvent) { events = append(events, e) })
+
+	l.OnKeyspaceCreated(gocql.OnKeyspaceCreatedEvent{Keyspace: &gocql.KeyspaceMetadata{Name: "app"}})
+	l.OnTableUpdated(gocql.OnTableUpdatedEvent{New: &gocql.TableMetadata{Keyspace: "app", Name: "events"}})
+	l.OnUserTypeDropped(gocql.OnUserTypeDroppedEvent{UserType: &gocql.UserTypeMetadata{Keyspace: "app", Name: "address"}})
+	l.OnFunctionCreated(gocql.OnFunctionCreatedEvent{Function: &gocql.FunctionMetadata{Keyspace: "app", Name: "f"}})
+	l.OnAggregateDropped(gocql.OnAggregateDroppedEvent{})
+
+	want := []SchemaChangeEvent{
+		{Change: SchemaCreated, Target: SchemaTargetKeyspace, Keyspace: "app"},
+		{Change: SchemaUpdated, Target: SchemaTargetTable, Keyspace: "app", Name: "events"},
+		{Change: SchemaDropped, Target: SchemaTargetType, Keyspace: "app", Name: "address"},
+		{Change: SchemaCreated, Target: SchemaTargetFunction, Keyspace: "app", Name: "f"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		got := events[i]
+		got.Time = want[i].Time
+		if got != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
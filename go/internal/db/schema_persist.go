@@ -0,0 +1,264 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// Persisted schema cache
+//
+// A full schema cache reads the metadata of every table, which on a cluster
+// with thousands of tables dominates the time it takes to connect. With
+// SessionOptions.SchemaCacheDir set, the cache and the UDT definitions loaded
+// so far are saved to a file per cluster, host and user, together with the
+// schema_version the cluster reported when they were read. A connection that
+// finds the cluster at the same schema_version loads the file instead of
+// reading the metadata; any other version means the schema has changed since,
+// so the file is deleted and the cache is read from the cluster again.
+
+// Where a schema cache's contents were loaded from
+const (
+	SchemaSourceCluster = "cluster"
+	SchemaSourceDisk    = "disk"
+)
+
+// schemaFileFormat is bumped whenever the file layout changes, so files
+// written by an older version are discarded rather than misread
+const schemaFileFormat = 1
+
+// persistedSchema is the file layout of a saved schema cache
+type persistedSchema struct {
+	FormatVersion int                                `json:"formatVersion"`
+	SchemaVersion string                             `json:"schemaVersion"`
+	SavedAt       time.Time                          `json:"savedAt"`
+	Keyspaces     []string                           `json:"keyspaces"`
+	Tables        map[string][]CachedTableInfo       `json:"tables"`
+	Columns       map[string]map[string][]ColumnInfo `json:"columns"`
+	UDTs          []persistedUDT                     `json:"udts,omitempty"`
+}
+
+// persistedUDT is a saved UDT definition. Field types are parsed again when
+// the file is loaded.
+type persistedUDT struct {
+	Keyspace string              `json:"keyspace"`
+	Name     string              `json:"name"`
+	Fields   []persistedUDTField `json:"fields"`
+}
+
+type persistedUDTField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// clusterSchemaVersion returns the cluster name and the schema version of the
+// coordinator
+func (s *Session) clusterSchemaVersion() (string, string, error) {
+	var clusterName string
+	var schemaVersion gocql.UUID
+	if err := s.Query("SELECT cluster_name, schema_version FROM system.local").Scan(&clusterName, &schemaVersion); err != nil {
+		return "", "", err
+	}
+	return clusterName, schemaVersion.String(), nil
+}
+
+// schemaCachePath returns the file the schema cache of a cluster is saved to.
+// The user is part of the name since permissions can hide keyspaces.
+func (s *Session) schemaCachePath(clusterName string) string {
+	sum := sha256.Sum256([]byte(clusterName + "\x00" + s.host + "\x00" + s.username))
+	return filepath.Join(s.schemaCacheDir, "schema-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadPersistedSchema fills cache from its saved file and seeds the UDT
+// registry, when the file was saved at the cluster's current schema version.
+// It reports whether the cache was loaded; a file saved at another version, or
+// one that cannot be read, is deleted.
+func (s *Session) loadPersistedSchema(cache *SchemaCache) bool {
+	if s.schemaCacheDir == "" || cache.Mode != SchemaCacheFull {
+		return false
+	}
+	clusterName, schemaVersion, err := s.clusterSchemaVersion()
+	if err != nil {
+		logger.DebugfToFile("SchemaCache", "Cannot read the schema version; not using the saved cache: %v", err)
+		return false
+	}
+	path := s.schemaCachePath(clusterName)
+	data, err := os.ReadFile(path) // #nosec G304 - path within the cache directory
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.DebugfToFile("SchemaCache", "Cannot read saved schema cache %s: %v", path, err)
+		}
+		return false
+	}
+
+	var saved persistedSchema
+	if err := json.Unmarshal(data, &saved); err != nil || saved.FormatVersion != schemaFileFormat {
+		logger.DebugfToFile("SchemaCache", "Discarding unreadable schema cache %s", path)
+		_ = os.Remove(path)
+		return false
+	}
+	if saved.SchemaVersion != schemaVersion {
+		logger.DebugfToFile("SchemaCache", "Schema version changed from %s to %s; discarding %s", saved.SchemaVersion, schemaVersion, path)
+		_ = os.Remove(path)
+		return false
+	}
+	if saved.Tables == nil {
+		saved.Tables = make(map[string][]CachedTableInfo)
+	}
+	if saved.Columns == nil {
+		saved.Columns = make(map[string]map[string][]ColumnInfo)
+	}
+
+	cache.install(saved.Keyspaces, saved.Tables, saved.Columns, saved.SavedAt, saved.SchemaVersion, SchemaSourceDisk)
+	s.ensureUDTRegistry().seed(saved.UDTs)
+	logger.DebugfToFile("SchemaCache", "Loaded schema cache saved %s at schema version %s", saved.SavedAt.Format(time.RFC3339), schemaVersion)
+	return true
+}
+
+// SaveSchemaCache writes the schema cache and the UDT definitions loaded so far
+// to disk for the next connection to the cluster. It does nothing unless the
+// session persists its cache and the cache is full and loaded. When the
+// cluster's schema has changed since the cache was loaded, the saved file is
+// deleted instead. A cache built from a pinned schema is not saved.
+func (s *Session) SaveSchemaCache() error {
+	cache := s.schemaCache
+	if s.schemaCacheDir == "" || cache == nil || cache.Mode != SchemaCacheFull || s.SchemaPinned() {
+		return nil
+	}
+	clusterName, schemaVersion, err := s.clusterSchemaVersion()
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	path := s.schemaCachePath(clusterName)
+
+	// Refresh replaces the maps rather than changing them, so they can be
+	// encoded after the lock is released
+	cache.Mu.RLock()
+	saved := persistedSchema{
+		FormatVersion: schemaFileFormat,
+		SchemaVersion: cache.SchemaVersion,
+		SavedAt:       cache.LastRefresh,
+		Keyspaces:     cache.Keyspaces,
+		Tables:        cache.Tables,
+		Columns:       cache.Columns,
+	}
+	cache.Mu.RUnlock()
+	if saved.SavedAt.IsZero() || saved.SchemaVersion == "" {
+		return nil
+	}
+	if saved.SchemaVersion != schemaVersion {
+		logger.DebugfToFile("SchemaCache", "Schema version changed from %s to %s; removing %s", saved.SchemaVersion, schemaVersion, path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if registry := s.GetUDTRegistry(); registry != nil {
+		saved.UDTs = registry.persisted()
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("failed to encode schema cache: %w", err)
+	}
+	if err := os.MkdirAll(s.schemaCacheDir, 0700); err != nil {
+		return fmt.Errorf("failed to create schema cache directory: %w", err)
+	}
+	// Write to a temporary file and rename it, so a concurrent load never
+	// reads a partial file
+	tmp, err := os.CreateTemp(s.schemaCacheDir, filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save schema cache: %w", err)
+	}
+	logger.DebugfToFile("SchemaCache", "Saved schema cache to %s", path)
+	return nil
+}
+
+// RefreshSchemaCache reloads the schema cache from the cluster and saves it.
+// Definitions in the UDT registry are dropped when the schema has changed
+// since the cache was loaded.
+func (s *Session) RefreshSchemaCache() error {
+	cache := s.schemaCache
+	if cache == nil {
+		return nil
+	}
+	cache.Mu.RLock()
+	before := cache.SchemaVersion
+	cache.Mu.RUnlock()
+
+	if err := cache.Refresh(); err != nil {
+		return err
+	}
+	cache.Mu.RLock()
+	changed := cache.SchemaVersion != before
+	cache.Mu.RUnlock()
+	if registry := s.GetUDTRegistry(); registry != nil && changed {
+		registry.Clear()
+	}
+	return s.SaveSchemaCache()
+}
+
+// SchemaCacheDir returns the directory the schema cache is saved in, or ""
+// when it is not persisted
+func (s *Session) SchemaCacheDir() string {
+	return s.schemaCacheDir
+}
+
+// persisted returns the cached UDT definitions in their file layout
+func (r *UDTRegistry) persisted() []persistedUDT {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	udts := make([]persistedUDT, 0, len(r.types))
+	for _, def := range r.types {
+		udt := persistedUDT{Keyspace: def.Keyspace, Name: def.Name}
+		for _, f := range def.Fields {
+			udt.Fields = append(udt.Fields, persistedUDTField{Name: f.Name, Type: f.TypeStr})
+		}
+		udts = append(udts, udt)
+	}
+	return udts
+}
+
+// seed adds saved UDT definitions that are not cached yet. A definition whose
+// field types no longer parse is left to be loaded on first use.
+func (r *UDTRegistry) seed(udts []persistedUDT) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, udt := range udts {
+		key := udt.Keyspace + "." + udt.Name
+		if _, ok := r.types[key]; ok {
+			continue
+		}
+		def := &UDTDefinition{Keyspace: udt.Keyspace, Name: udt.Name, Fields: make([]UDTField, len(udt.Fields))}
+		valid := true
+		for i, f := range udt.Fields {
+			typeInfo, err := ParseCQLType(f.Type)
+			if err != nil {
+				valid = false
+				break
+			}
+			def.Fields[i] = UDTField{Name: f.Name, TypeStr: f.Type, TypeInfo: typeInfo}
+		}
+		if valid {
+			r.types[key] = def
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// Schema pinning
+//
+// A browsing session can pin the schema: the keyspace metadata is copied
+// once, and every metadata lookup through the session (table and keyspace
+// metadata, the schema cache behind completions, query builders) reads the
+// copy until the pin is released. A table altered or dropped by a migration
+// while the user inspects it then keeps its shape. The live schema version
+// and the schema changes the driver reports are compared with the pin, so
+// the caller can tell the user the snapshot is stale.
+
+// maxPinChanges caps the schema changes kept while the schema is pinned
+const maxPinChanges = 100
+
+// schemaPin is a session's pinned schema snapshot
+type schemaPin struct {
+	version   string
+	pinnedAt  time.Time
+	all       bool // Every keyspace was pinned, so changes anywhere count
+	keyspaces map[string]*gocql.KeyspaceMetadata
+	changes   []SchemaChangeEvent
+	dropped   int // Changes beyond maxPinChanges
+}
+
+// SchemaPinStatus describes a session's pinned schema
+type SchemaPinStatus struct {
+	Pinned            bool                `json:"pinned"`
+	SchemaVersion     string              `json:"schemaVersion,omitempty"`     // Schema version the snapshot was taken at
+	LiveSchemaVersion string              `json:"liveSchemaVersion,omitempty"` // Schema version of the coordinator now
+	PinnedAt          *time.Time          `json:"pinnedAt,omitempty"`
+	Keyspaces         []string            `json:"keyspaces,omitempty"`
+	Diverged          bool                `json:"diverged"` // The live schema no longer matches the snapshot
+	Changes           []SchemaChangeEvent `json:"changes,omitempty"`
+	ChangesDropped    int                 `json:"changesDropped,omitempty"`
+}
+
+// PinSchema snapshots the metadata of the keyspaces, or of every keyspace
+// when none are given, and serves metadata lookups from it until UnpinSchema.
+// Pinning again replaces the snapshot.
+func (s *Session) PinSchema(keyspaces []string) (*SchemaPinStatus, error) {
+	_, version, err := s.clusterSchemaVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the schema version: %v", err)
+	}
+	all := len(keyspaces) == 0
+	if all {
+		iter := s.Query("SELECT keyspace_name FROM system_schema.keyspaces").Iter()
+		var name string
+		for iter.Scan(&name) {
+			keyspaces = append(keyspaces, name)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, fmt.Errorf("failed to list keyspaces: %v", err)
+		}
+	}
+
+	pin := &schemaPin{
+		version:   version,
+		pinnedAt:  time.Now().UTC(),
+		all:       all,
+		keyspaces: make(map[string]*gocql.KeyspaceMetadata, len(keyspaces)),
+	}
+	for _, name := range keyspaces {
+		ks, err := s.Session.KeyspaceMetadata(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot keyspace %s: %v", name, err)
+		}
+		pin.keyspaces[name] = ks.Clone()
+	}
+
+	s.pinMu.Lock()
+	s.pin = pin
+	hook := !s.pinHooked
+	s.pinHooked = true
+	s.pinMu.Unlock()
+	if hook {
+		s.OnSchemaChanged(s.recordPinChange)
+	}
+	return s.SchemaPinStatus(), nil
+}
+
+// UnpinSchema returns the session to the live schema. It reports whether the
+// schema was pinned. The schema cache is reloaded when the schema changed
+// while it was pinned.
+func (s *Session) UnpinSchema() bool {
+	s.pinMu.Lock()
+	pin := s.pin
+	s.pin = nil
+	s.pinMu.Unlock()
+	if pin == nil {
+		return false
+	}
+	if len(pin.changes) > 0 || pin.dropped > 0 {
+		if err := s.RefreshSchemaCache(); err != nil {
+			logger.DebugfToFile("SchemaCache", "Refresh after unpinning the schema failed: %v", err)
+		}
+	}
+	return true
+}
+
+// SchemaPinned reports whether the session reads a schema snapshot
+func (s *Session) SchemaPinned() bool {
+	s.pinMu.RLock()
+	defer s.pinMu.RUnlock()
+	return s.pin != nil
+}
+
+// SchemaPinStatus describes the pinned schema, reading the live schema
+// version to tell whether it diverged
+func (s *Session) SchemaPinStatus() *SchemaPinStatus {
+	s.pinMu.RLock()
+	pin := s.pin
+	var status SchemaPinStatus
+	if pin != nil {
+		status = SchemaPinStatus{
+			Pinned:         true,
+			SchemaVersion:  pin.version,
+			PinnedAt:       &pin.pinnedAt,
+			Changes:        append([]SchemaChangeEvent(nil), pin.changes...),
+			ChangesDropped: pin.dropped,
+		}
+		for name := range pin.keyspaces {
+			status.Keyspaces = append(status.Keyspaces, name)
+		}
+	}
+	s.pinMu.RUnlock()
+	if pin == nil {
+		return &status
+	}
+
+	sort.Strings(status.Keyspaces)
+	if _, live, err := s.clusterSchemaVersion(); err == nil {
+		status.LiveSchemaVersion = live
+	}
+	// The version changes with any schema change, so a change recorded in a
+	// pinned keyspace is what tells a partial pin diverged
+	status.Diverged = len(status.Changes) > 0 || (pin.all && status.LiveSchemaVersion != "" && status.LiveSchemaVersion != pin.version)
+	return &status
+}
+
+// recordPinChange keeps the schema changes that affect the snapshot
+func (s *Session) recordPinChange(event SchemaChangeEvent) {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+	if s.pin == nil {
+		return
+	}
+	if _, ok := s.pin.keyspaces[event.Keyspace]; !ok && !s.pin.all {
+		return
+	}
+	if len(s.pin.changes) >= maxPinChanges {
+		s.pin.dropped++
+		return
+	}
+	s.pin.changes = append(s.pin.changes, event)
+}
+
+// KeyspaceMetadata returns the metadata of a keyspace: from the snapshot
+// while the schema is pinned and the keyspace is in it, otherwise the
+// driver's live metadata. It shadows the driver method so that every lookup
+// through the session honours the pin.
+func (s *Session) KeyspaceMetadata(keyspace string) (*gocql.KeyspaceMetadata, error) {
+	s.pinMu.RLock()
+	var ks *gocql.KeyspaceMetadata
+	if s.pin != nil {
+		ks = s.pin.keyspaces[keyspace]
+	}
+	s.pinMu.RUnlock()
+	if ks != nil {
+		return ks, nil
+	}
+	return s.Session.KeyspaceMetadata(keyspace)
+}
+
+// ListedKeyspaces returns the keyspaces a listing shows, given those of the
+// live schema: with every keyspace pinned, the snapshot's; with some pinned,
+// the live ones plus the pinned ones dropped since
+func (s *Session) ListedKeyspaces(live []string) []string {
+	s.pinMu.RLock()
+	defer s.pinMu.RUnlock()
+	if s.pin == nil {
+		return live
+	}
+	listed := make(map[string]bool, len(live))
+	names := live
+	if s.pin.all {
+		names = nil
+	} else {
+		for _, name := range live {
+			listed[name] = true
+		}
+	}
+	var pinned []string
+	for name := range s.pin.keyspaces {
+		if !listed[name] {
+			pinned = append(pinned, name)
+		}
+	}
+	sort.Strings(pinned)
+	return append(names, pinned...)
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+func TestSchemaPinSnapshot(t *testing.T) {
+	orders := &gocql.KeyspaceMetadata{Name: "shop", Tables: map[string]*gocql.TableMetadata{"orders": {Keyspace: "shop", Name: "orders"}}}
+	s := &Session{pin: &schemaPin{keyspaces: map[string]*gocql.KeyspaceMetadata{"shop": orders}}}
+
+	// Lookups of a pinned keyspace never reach the driver
+	table, err := s.GetTableMetadata("shop", "orders")
+	if err != nil || table.Name != "orders" {
+		t.Fatalf("pinned table: %v, %v", table, err)
+	}
+
+	// Partial pin: live keyspaces plus the pinned ones dropped since
+	if got := s.ListedKeyspaces([]string{"app"}); !reflect.DeepEqual(got, []string{"app", "shop"}) {
+		t.Errorf("partial pin lists %v", got)
+	}
+	s.pin.all = true
+	if got := s.ListedKeyspaces([]string{"app", "shop"}); !reflect.DeepEqual(got, []string{"shop"}) {
+		t.Errorf("full pin lists %v", got)
+	}
+	s.pin.all = false
+
+	s.recordPinChange(SchemaChangeEvent{Change: SchemaUpdated, Target: SchemaTargetTable, Keyspace: "app", Name: "users"})
+	if len(s.pin.changes) != 0 {
+		t.Errorf("change to an unpinned keyspace recorded")
+	}
+	for i := 0; i < maxPinChanges+2; i++ {
+		s.recordPinChange(SchemaChangeEvent{Change: SchemaUpdated, Target: SchemaTargetTable, Keyspace: "shop", Name: "orders"})
+	}
+	if len(s.pin.changes) != maxPinChanges || s.pin.dropped != 2 {
+		t.Errorf("kept %d changes, dropped %d", len(s.pin.changes), s.pin.dropped)
+	}
+
+	// Without a pin listings are unchanged and changes are ignored
+	unpinned := &Session{}
+	if got := unpinned.ListedKeyspaces([]string{"app"}); !reflect.DeepEqual(got, []string{"app"}) {
+		t.Errorf("unpinned lists %v", got)
+	}
+	unpinned.recordPinChange(SchemaChangeEvent{Keyspace: "app"})
+	if status := unpinned.SchemaPinStatus(); status.Pinned || status.Diverged {
+		t.Errorf("unpinned status %+v", status)
+	}
+}
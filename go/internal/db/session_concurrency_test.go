@@ -0,0 +1,136 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// These tests drive a single Session from many goroutines the way the Node
+// host does when a handle is shared across worker threads. They do not need a
+// cluster and are most useful when run with -race.
+
+func TestSessionSettingsConcurrentAccess(t *testing.T) {
+	s := &Session{}
+	levels := []string{"ONE", "QUORUM", "LOCAL_ONE", "LOCAL_QUORUM", "ALL"}
+
+	const goroutines = 32
+	const iterations = 500
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				switch (g + i) % 6 {
+				case 0:
+					if err := s.SetConsistency(levels[i%len(levels)]); err != nil {
+						t.Errorf("SetConsistency failed: %v", err)
+						return
+					}
+				case 1:
+					s.SetPageSize(i % 1000)
+				case 2:
+					s.SetTracing(i%2 == 0)
+				case 3:
+					s.SetExpand(i%2 == 0)
+				case 4:
+					if err := s.SetAutoFetch(i%2 == 0, i%1000); err != nil {
+						t.Errorf("SetAutoFetch failed: %v", err)
+						return
+					}
+				case 5:
+					s.setLastTraceID([]byte{byte(g), byte(i)})
+				}
+
+				// Readers run interleaved with the writers above
+				if c := s.Consistency(); c == "UNKNOWN" && i > iterations/2 {
+					t.Errorf("Consistency() = UNKNOWN after writes")
+					return
+				}
+				if ps := s.PageSize(); ps < 0 || ps >= 1000 {
+					t.Errorf("PageSize() = %d, out of range", ps)
+					return
+				}
+				_ = s.Tracing()
+				_ = s.Expand()
+				_ = s.AutoFetch()
+				if m := s.AutoFetchMaxRows(); m <= 0 || m > MaxAutoFetchRows {
+					t.Errorf("AutoFetchMaxRows() = %d, out of range", m)
+					return
+				}
+				_ = s.LastTraceID()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	valid := false
+	for _, level := range levels {
+		if s.Consistency() == level {
+			valid = true
+		}
+	}
+	if !valid {
+		t.Errorf("final Consistency() = %s, want one of %v", s.Consistency(), levels)
+	}
+}
+
+func TestSessionEnsureUDTRegistryConcurrent(t *testing.T) {
+	s := &Session{}
+
+	const goroutines = 64
+	registries := make([]*UDTRegistry, goroutines)
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			registries[g] = s.ensureUDTRegistry()
+		}(g)
+	}
+	wg.Wait()
+
+	for i, r := range registries {
+		if r == nil {
+			t.Fatalf("goroutine %d got nil registry", i)
+		}
+		if r != registries[0] {
+			t.Errorf("goroutine %d got a different registry instance", i)
+		}
+	}
+	if s.GetUDTRegistry() != registries[0] {
+		t.Errorf("GetUDTRegistry() does not return the lazily created registry")
+	}
+}
+
+func TestSessionLastTraceIDConcurrent(t *testing.T) {
+	s := &Session{}
+	if got := s.LastTraceID(); got != "" {
+		t.Errorf("LastTraceID() on new session = %q, want empty", got)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				s.setLastTraceID([]byte{byte(g)})
+				id := s.LastTraceID()
+				if len(id) != 2 {
+					t.Errorf("LastTraceID() = %q, want 2 hex chars", id)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	s.setLastTraceID([]byte{0xab, 0xcd})
+	if got, want := s.LastTraceID(), fmt.Sprintf("%x", []byte{0xab, 0xcd}); got != want {
+		t.Errorf("LastTraceID() = %q, want %q", got, want)
+	}
+}
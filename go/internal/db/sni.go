@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// SNI proxy routing
+//
+// Astra databases are reached through a single SNI proxy: every connection
+// goes to the proxy's address, and the TLS server name tells the proxy which
+// node to forward it to, by host ID. A node the driver has discovered is
+// dialed with its own host ID. The contact point is not a node, so its
+// connections rotate across the contact point host IDs from the metadata
+// service; a host ID that has disappeared then fails one attempt rather than
+// every one. The proxy address and host IDs can be replaced while the
+// session is open (see SetSNIProxy), so a refreshed list of contact points
+// is used by the next connection.
+
+// SNIProxyOptions routes every connection through an SNI proxy
+type SNIProxyOptions struct {
+	Address     string   // Proxy host:port
+	ServerNames []string // Server names (host IDs) of the contact points, tried in turn
+}
+
+// SNIEndpoint reports the connections made with one server name
+type SNIEndpoint struct {
+	ServerName      string `json:"serverName"`
+	ContactPoint    bool   `json:"contactPoint"` // In the current contact point list
+	OpenConnections int64  `json:"openConnections"`
+	Dials           int64  `json:"dials"`
+	Failures        int64  `json:"failures"`
+	LastDialAt      string `json:"lastDialAt,omitempty"`
+	LastError       string `json:"lastError,omitempty"`
+}
+
+// SNIProxyInfo reports the proxy a session connects through and the server
+// names it has used
+type SNIProxyInfo struct {
+	Address     string        `json:"address"`
+	ServerNames []string      `json:"serverNames"` // Contact point host IDs, in rotation order
+	Endpoints   []SNIEndpoint `json:"endpoints"`   // Every server name dialed, most open connections first
+}
+
+// sniDialer implements gocql.HostDialer for an SNI proxy
+type sniDialer struct {
+	tlsConfig *tls.Config // Without ServerName; set per connection
+	dialer    net.Dialer
+
+	mu        sync.Mutex
+	address   string
+	names     []string
+	next      int
+	endpoints map[string]*SNIEndpoint
+}
+
+func newSNIDialer(opts *SNIProxyOptions, tlsConfig *tls.Config, connectTimeout, keepalive time.Duration) (*sniDialer, error) {
+	if tlsConfig == nil {
+		return nil, fmt.Errorf("an SNI proxy needs SSL")
+	}
+	d := &sniDialer{
+		tlsConfig: tlsConfig,
+		dialer:    net.Dialer{Timeout: connectTimeout, KeepAlive: keepalive},
+		endpoints: make(map[string]*SNIEndpoint),
+	}
+	if err := d.set(opts.Address, opts.ServerNames); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// set replaces the proxy address and contact point server names
+func (d *sniDialer) set(address string, names []string) error {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return fmt.Errorf("invalid SNI proxy address %q: %v", address, err)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("an SNI proxy needs at least one server name")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.address = address
+	d.names = append([]string(nil), names...)
+	d.next = 0
+	return nil
+}
+
+// route returns the proxy address and the server name to dial host with
+func (d *sniDialer) route(host *gocql.HostInfo) (string, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id := host.HostID(); id != "" {
+		return d.address, id
+	}
+	name := d.names[d.next%len(d.names)]
+	d.next++
+	return d.address, name
+}
+
+// endpoint returns the stats of a server name; d.mu must be held
+func (d *sniDialer) endpoint(name string) *SNIEndpoint {
+	ep := d.endpoints[name]
+	if ep == nil {
+		ep = &SNIEndpoint{ServerName: name}
+		d.endpoints[name] = ep
+	}
+	return ep
+}
+
+// DialHost implements gocql.HostDialer
+func (d *sniDialer) DialHost(ctx context.Context, host *gocql.HostInfo) (*gocql.DialedHost, error) {
+	address, name := d.route(host)
+	conn, err := d.dialer.DialContext(ctx, "tcp", address)
+	if err == nil {
+		cfg := d.tlsConfig.Clone()
+		cfg.ServerName = name
+		tconn := tls.Client(conn, cfg)
+		if err = tconn.HandshakeContext(ctx); err == nil {
+			d.dialed(name, nil)
+			return &gocql.DialedHost{
+				Conn:            &sniConn{Conn: tconn, dialer: d, name: name},
+				DisableCoalesce: true, // TLS connections cannot use writev
+			}, nil
+		}
+		conn.Close()
+	}
+	d.dialed(name, err)
+	return nil, fmt.Errorf("SNI proxy %s (%s): %w", address, name, err)
+}
+
+// dialed records a connection attempt
+func (d *sniDialer) dialed(name string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ep := d.endpoint(name)
+	ep.Dials++
+	ep.LastDialAt = time.Now().UTC().Format(time.RFC3339)
+	if err != nil {
+		ep.Failures++
+		ep.LastError = err.Error()
+		return
+	}
+	ep.OpenConnections++
+}
+
+// info reports the proxy and the server names dialed
+func (d *sniDialer) info() *SNIProxyInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	info := &SNIProxyInfo{
+		Address:     d.address,
+		ServerNames: append([]string(nil), d.names...),
+		Endpoints:   make([]SNIEndpoint, 0, len(d.endpoints)),
+	}
+	contact := make(map[string]bool, len(d.names))
+	for _, name := range d.names {
+		contact[name] = true
+	}
+	for _, ep := range d.endpoints {
+		e := *ep
+		e.ContactPoint = contact[e.ServerName]
+		info.Endpoints = append(info.Endpoints, e)
+	}
+	sort.Slice(info.Endpoints, func(i, j int) bool {
+		a, b := info.Endpoints[i], info.Endpoints[j]
+		if a.OpenConnections != b.OpenConnections {
+			return a.OpenConnections > b.OpenConnections
+		}
+		return a.ServerName < b.ServerName
+	})
+	return info
+}
+
+// sniConn counts a connection as open until it is closed
+type sniConn struct {
+	net.Conn
+	dialer *sniDialer
+	name   string
+	once   sync.Once
+}
+
+func (c *sniConn) Close() error {
+	c.once.Do(func() {
+		c.dialer.mu.Lock()
+		c.dialer.endpoint(c.name).OpenConnections--
+		c.dialer.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// SNIProxy returns the SNI proxy the session connects through and the server
+// names it has used, or nil when it connects directly
+func (s *Session) SNIProxy() *SNIProxyInfo {
+	if s.sni == nil {
+		return nil
+	}
+	return s.sni.info()
+}
+
+// SetSNIProxy replaces the SNI proxy address and contact point server names
+// used by the session's next connections. Open connections are kept.
+func (s *Session) SetSNIProxy(address string, serverNames []string) error {
+	if s.sni == nil {
+		return fmt.Errorf("session does not connect through an SNI proxy")
+	}
+	return s.sni.set(address, serverNames)
+}
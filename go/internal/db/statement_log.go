@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/logger"
+)
+
+// sessionObserver is registered on the cluster config as the default query
+// and batch observer, and ExecutionObserver forwards its attempts here. Each
+// attempt feeds the coordinator's health and, with debug logging on, is
+// written to the debug log under the workspace's redaction policy: the
+// statement's shape and its bind values hashed or masked, never as given.
+type sessionObserver struct {
+	health    *hostHealth
+	workspace string
+}
+
+// ObserveQuery implements gocql.QueryObserver
+func (o *sessionObserver) ObserveQuery(_ context.Context, q gocql.ObservedQuery) {
+	o.health.record(q.Host, q.End.Sub(q.Start), q.Err)
+	if logger.IsDebugEnabled() {
+		logger.DebugToFile("Statement", attemptPrefix(q.Attempt, q.Host, q.End.Sub(q.Start), q.Err)+
+			logger.RedactionPolicyFor(o.workspace).Statement(q.Statement, q.Values))
+	}
+}
+
+// ObserveBatch implements gocql.BatchObserver
+func (o *sessionObserver) ObserveBatch(_ context.Context, b gocql.ObservedBatch) {
+	o.health.record(b.Host, b.End.Sub(b.Start), b.Err)
+	if logger.IsDebugEnabled() {
+		policy := logger.RedactionPolicyFor(o.workspace)
+		statements := make([]string, len(b.Statements))
+		for i, stmt := range b.Statements {
+			var values []interface{}
+			if i < len(b.Values) {
+				values = b.Values[i]
+			}
+			statements[i] = policy.Statement(stmt, values)
+		}
+		logger.DebugToFile("Batch", attemptPrefix(b.Attempt, b.Host, b.End.Sub(b.Start), b.Err)+
+			strings.Join(statements, "; "))
+	}
+}
+
+// attemptPrefix describes an attempt for the debug log. Server errors can
+// echo part of the statement, so their quoted strings are scrubbed.
+func attemptPrefix(attempt int, host *gocql.HostInfo, latency time.Duration, err error) string {
+	coordinator := "-"
+	if host != nil {
+		coordinator = host.ConnectAddressAndPort()
+	}
+	prefix := fmt.Sprintf("attempt=%d host=%s latency=%s ", attempt, coordinator, latency.Round(time.Microsecond))
+	if err != nil {
+		prefix += "error=" + logger.ScrubText(err.Error()) + " "
+	}
+	return prefix
+}
+
+// Workspace returns the workspace whose redaction policy the session's logs
+// follow
+func (s *Session) Workspace() string {
+	if s == nil || s.observer == nil {
+		return ""
+	}
+	return s.observer.workspace
+}
+
+// driverLogger writes the driver's warnings and errors to the debug log
+// instead of the terminal, which they would corrupt. Statements the driver
+// logs are reduced to their shape and quoted strings in errors are scrubbed.
+type driverLogger struct{}
+
+func (l *driverLogger) Error(msg string, fields ...gocql.LogField)   { l.log("ERROR", msg, fields) }
+func (l *driverLogger) Warning(msg string, fields ...gocql.LogField) { l.log("WARN", msg, fields) }
+func (l *driverLogger) Info(msg string, fields ...gocql.LogField)    {}
+func (l *driverLogger) Debug(msg string, fields ...gocql.LogField)   {}
+
+func (l *driverLogger) log(level, msg string, fields []gocql.LogField) {
+	if !logger.IsDebugEnabled() {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(logger.ScrubText(msg))
+	for _, f := range fields {
+		value := f.Value.String()
+		switch f.Name {
+		case "stmt", "statement":
+			value = logger.StatementShape(value)
+		default:
+			value = logger.ScrubText(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.Name, value)
+	}
+	logger.DebugToFile("Driver", b.String())
+}
@@ -125,6 +125,17 @@ func (sp *StreamingProcessor) formatRow(rowMap map[string]interface{}) []string
 			}
 		}
 
+		// A vector the driver did not unmarshal arrives as its serialized bytes
+		if data, ok := val.([]byte); ok && col != nil && sp.decoder != nil {
+			if _, isVector := col.TypeInfo.(gocql.VectorType); isVector {
+				if typeInfo, err := ParseCQLType(formatTypeInfo(col.TypeInfo)); err == nil {
+					if decoded, err := sp.decoder.Decode(data, typeInfo, sp.currentKeyspace); err == nil {
+						val = decoded
+					}
+				}
+			}
+		}
+
 		// Format the value
 		if col != nil && col.TypeInfo != nil {
 			row[i] = sp.typeHandler.FormatValue(val, col.TypeInfo)
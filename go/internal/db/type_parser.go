@@ -2,6 +2,7 @@ package db
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -12,6 +13,7 @@ type CQLTypeInfo struct {
 	Parameters []*CQLTypeInfo // For collections/tuples - element types
 	UDTName    string         // For UDT types - the name of the UDT
 	Keyspace   string         // For UDT types - optional keyspace qualifier
+	Dimension  int            // For vector types - number of elements
 }
 
 // ParseCQLType parses a CQL type string into structured type information
@@ -99,6 +101,27 @@ func (p *typeParser) parseType() (*CQLTypeInfo, error) {
 		}
 		typeInfo.Parameters = []*CQLTypeInfo{keyType, valueType}
 
+	case "vector":
+		if !p.consume('<') {
+			return nil, fmt.Errorf("expected '<' after 'vector' at position %d", p.pos)
+		}
+		elementType, err := p.parseType()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse vector element type: %w", err)
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("expected ',' before vector dimension at position %d", p.pos)
+		}
+		dimension, err := strconv.Atoi(p.parseIdentifier())
+		if err != nil || dimension <= 0 {
+			return nil, fmt.Errorf("invalid vector dimension at position %d", p.pos)
+		}
+		if !p.consume('>') {
+			return nil, fmt.Errorf("expected '>' to close 'vector' at position %d", p.pos)
+		}
+		typeInfo.Parameters = []*CQLTypeInfo{elementType}
+		typeInfo.Dimension = dimension
+
 	case "tuple":
 		if !p.consume('<') {
 			return nil, fmt.Errorf("expected '<' after 'tuple' at position %d", p.pos)
@@ -243,6 +266,12 @@ func (t *CQLTypeInfo) String() string {
 			result.WriteString(t.Parameters[1].String())
 		}
 		result.WriteString(">")
+	case "vector":
+		result.WriteString("vector<")
+		if len(t.Parameters) > 0 {
+			result.WriteString(t.Parameters[0].String())
+		}
+		result.WriteString(fmt.Sprintf(", %d>", t.Dimension))
 	case "tuple":
 		result.WriteString("tuple<")
 		for i, param := range t.Parameters {
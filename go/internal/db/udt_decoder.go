@@ -2,10 +2,13 @@ package db
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/big"
+	"math/bits"
 	"net"
+	"strings"
 	"time"
 
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
@@ -90,6 +93,8 @@ func (d *BinaryDecoder) Decode(data []byte, typeInfo *CQLTypeInfo, keyspace stri
 		return d.decodeMap(data, typeInfo.Parameters[0], typeInfo.Parameters[1], keyspace)
 	case "tuple":
 		return d.decodeTuple(data, typeInfo.Parameters, keyspace)
+	case "vector":
+		return d.decodeVector(data, typeInfo.Parameters[0], typeInfo.Dimension, keyspace)
 
 	// UDT type
 	case "udt":
@@ -117,33 +122,21 @@ func (d *BinaryDecoder) decodeSmallInt(data []byte) (int16, error) {
 	if len(data) != 2 {
 		return 0, fmt.Errorf("invalid smallint data length: %d", len(data))
 	}
-	val := binary.BigEndian.Uint16(data)
-	if val > math.MaxInt16 {
-		return 0, fmt.Errorf("smallint value %d exceeds int16 range", val)
-	}
-	return int16(val), nil
+	return int16(binary.BigEndian.Uint16(data)), nil // #nosec G115 - two's complement
 }
 
 func (d *BinaryDecoder) decodeInt(data []byte) (int32, error) {
 	if len(data) != 4 {
 		return 0, fmt.Errorf("invalid int data length: %d", len(data))
 	}
-	val := binary.BigEndian.Uint32(data)
-	if val > math.MaxInt32 {
-		return 0, fmt.Errorf("int value %d exceeds int32 range", val)
-	}
-	return int32(val), nil
+	return int32(binary.BigEndian.Uint32(data)), nil // #nosec G115 - two's complement
 }
 
 func (d *BinaryDecoder) decodeBigInt(data []byte) (int64, error) {
 	if len(data) != 8 {
 		return 0, fmt.Errorf("invalid bigint data length: %d", len(data))
 	}
-	val := binary.BigEndian.Uint64(data)
-	if val > math.MaxInt64 {
-		return 0, fmt.Errorf("bigint value %d exceeds int64 range", val)
-	}
-	return int64(val), nil
+	return int64(binary.BigEndian.Uint64(data)), nil // #nosec G115 - two's complement
 }
 
 func (d *BinaryDecoder) decodeVarInt(data []byte) (*big.Int, error) {
@@ -186,11 +179,7 @@ func (d *BinaryDecoder) decodeDecimal(data []byte) (string, error) {
 		return "", fmt.Errorf("invalid decimal data length: %d", len(data))
 	}
 
-	scaleVal := binary.BigEndian.Uint32(data[:4])
-	if scaleVal > math.MaxInt32 {
-		return "", fmt.Errorf("decimal scale %d exceeds int32 range", scaleVal)
-	}
-	scale := int32(scaleVal)
+	scale := int32(binary.BigEndian.Uint32(data[:4])) // #nosec G115 - the scale is a signed int
 	unscaled := new(big.Int)
 	unscaled.SetBytes(data[4:])
 
@@ -208,7 +197,12 @@ func (d *BinaryDecoder) decodeDecimal(data []byte) (string, error) {
 		unscaled = unscaled.Neg(unscaled)
 	}
 
-	// Format with scale
+	// Format the magnitude with scale, then add the sign
+	sign := ""
+	if unscaled.Sign() < 0 {
+		sign = "-"
+		unscaled.Neg(unscaled)
+	}
 	str := unscaled.String()
 	if scale > 0 {
 		if len(str) <= int(scale) {
@@ -221,9 +215,12 @@ func (d *BinaryDecoder) decodeDecimal(data []byte) (string, error) {
 		// Insert decimal point
 		pos := len(str) - int(scale)
 		str = str[:pos] + "." + str[pos:]
+	} else if scale < 0 && unscaled.Sign() != 0 {
+		// A negative scale multiplies by a power of ten, e.g. 12 with scale -3 is 12000
+		str += strings.Repeat("0", int(-scale))
 	}
 
-	return str, nil
+	return sign + str, nil
 }
 
 func (d *BinaryDecoder) decodeBoolean(data []byte) (bool, error) {
@@ -246,27 +243,18 @@ func (d *BinaryDecoder) decodeTimestamp(data []byte) (time.Time, error) {
 	if len(data) != 8 {
 		return time.Time{}, fmt.Errorf("invalid timestamp data length: %d", len(data))
 	}
-	val := binary.BigEndian.Uint64(data)
-	// Check for overflow before converting to int64
-	if val > math.MaxInt64 {
-		return time.Time{}, fmt.Errorf("timestamp value %d exceeds int64 range", val)
-	}
-	millis := int64(val)
-	return time.Unix(0, millis*int64(time.Millisecond)), nil
+	// Milliseconds since the epoch, negative before 1970
+	millis := int64(binary.BigEndian.Uint64(data)) // #nosec G115 - two's complement
+	return time.UnixMilli(millis), nil
 }
 
 func (d *BinaryDecoder) decodeDate(data []byte) (time.Time, error) {
 	if len(data) != 4 {
 		return time.Time{}, fmt.Errorf("invalid date data length: %d", len(data))
 	}
-	val := binary.BigEndian.Uint32(data)
-	// Check for overflow before converting to int32
-	if val > math.MaxInt32 {
-		return time.Time{}, fmt.Errorf("date value %d exceeds int32 range", val)
-	}
-	days := int32(val)
-	// Cassandra date epoch is 1970-01-01 with day precision
-	// Days are stored as days since epoch (can be negative)
+	// Days are stored unsigned with 1970-01-01 at 2^31, so earlier dates
+	// are below 2^31
+	days := int64(binary.BigEndian.Uint32(data)) - 1<<31
 	epoch := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
 	return epoch.AddDate(0, 0, int(days)), nil
 }
@@ -275,26 +263,31 @@ func (d *BinaryDecoder) decodeTime(data []byte) (time.Duration, error) {
 	if len(data) != 8 {
 		return 0, fmt.Errorf("invalid time data length: %d", len(data))
 	}
-	val := binary.BigEndian.Uint64(data)
-	// Check for overflow before converting to int64
-	if val > math.MaxInt64 {
-		return 0, fmt.Errorf("time value %d exceeds int64 range", val)
+	// Nanoseconds since midnight
+	nanos := int64(binary.BigEndian.Uint64(data)) // #nosec G115 - two's complement
+	if nanos < 0 || nanos >= int64(24*time.Hour) {
+		return 0, fmt.Errorf("time value %d is outside a day", nanos)
 	}
-	nanos := int64(val)
 	return time.Duration(nanos), nil
 }
 
 func (d *BinaryDecoder) decodeDuration(data []byte) (map[string]interface{}, error) {
-	// Duration is encoded as vint months, vint days, vint nanoseconds
+	// Duration is encoded as signed vint months, days and nanoseconds. All
+	// three have the same sign, so a negative duration has negative parts.
+	var parts [3]int64
 	pos := 0
-
-	months, bytesRead := d.readVInt(data[pos:])
-	pos += bytesRead
-
-	days, bytesRead := d.readVInt(data[pos:])
-	pos += bytesRead
-
-	nanos, _ := d.readVInt(data[pos:])
+	for i := range parts {
+		val, n := d.readVInt(data[pos:])
+		if n == 0 {
+			return nil, fmt.Errorf("invalid duration data")
+		}
+		parts[i] = val
+		pos += n
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("invalid duration data length: %d", len(data))
+	}
+	months, days, nanos := parts[0], parts[1], parts[2]
 
 	return map[string]interface{}{
 		"months": months,
@@ -438,12 +431,7 @@ func (d *BinaryDecoder) decodeMap(data []byte, keyType, valueType *CQLTypeInfo,
 			}
 		}
 
-		// Convert key to string for string keys (common case)
-		if keyStr, ok := key.(string); ok {
-			result[keyStr] = value
-		} else {
-			result[key] = value
-		}
+		result[mapKey(key)] = value
 	}
 
 	return result, nil
@@ -490,6 +478,46 @@ func (d *BinaryDecoder) decodeTuple(data []byte, elementTypes []*CQLTypeInfo, ke
 	return result, nil
 }
 
+// vectorElementSizes are the serialized sizes of fixed-length types. Vectors
+// of these types are packed without length prefixes.
+var vectorElementSizes = map[string]int{
+	"boolean": 1, "tinyint": 1, "smallint": 2, "int": 4, "float": 4, "date": 4,
+	"bigint": 8, "double": 8, "timestamp": 8, "time": 8, "uuid": 16, "timeuuid": 16,
+}
+
+// decodeVector decodes vector<type, n>. Fixed-length elements are packed back
+// to back; variable-length elements are each preceded by an unsigned vint size.
+// Vector elements cannot be null.
+func (d *BinaryDecoder) decodeVector(data []byte, elementType *CQLTypeInfo, dimension int, keyspace string) ([]interface{}, error) {
+	result := make([]interface{}, 0, dimension)
+	size, fixed := vectorElementSizes[elementType.BaseType]
+	if fixed && len(data) != size*dimension {
+		return nil, fmt.Errorf("invalid vector data length: %d, want %d", len(data), size*dimension)
+	}
+
+	pos := 0
+	for i := 0; i < dimension; i++ {
+		if !fixed {
+			n, read := d.readUnsignedVInt(data[pos:])
+			if read == 0 || n > uint64(len(data)-pos-read) {
+				return nil, fmt.Errorf("invalid vector element at index %d", i)
+			}
+			pos += read
+			size = int(n)
+		}
+		element, err := d.Decode(data[pos:pos+size], elementType, keyspace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode vector element at index %d: %w", i, err)
+		}
+		result = append(result, element)
+		pos += size
+	}
+	if pos != len(data) {
+		return nil, fmt.Errorf("invalid vector data: %d trailing bytes", len(data)-pos)
+	}
+	return result, nil
+}
+
 // UDT decoder
 
 func (d *BinaryDecoder) decodeUDT(data []byte, typeInfo *CQLTypeInfo, keyspace string) (map[string]interface{}, error) {
@@ -545,49 +573,79 @@ func (d *BinaryDecoder) decodeUDT(data []byte, typeInfo *CQLTypeInfo, keyspace s
 
 // Helper functions
 
-func (d *BinaryDecoder) readVInt(data []byte) (int64, int) {
+// readUnsignedVInt reads an unsigned variable-length integer. The number of
+// leading one bits in the first byte is the number of extra bytes that follow.
+// It returns the value and the bytes read, or 0 bytes read if data is too short.
+func (d *BinaryDecoder) readUnsignedVInt(data []byte) (uint64, int) {
 	if len(data) == 0 {
 		return 0, 0
 	}
-
-	firstByte := data[0]
-
-	// Check if it's a single byte vint
-	if firstByte&0x80 == 0 {
-		// Positive single byte
-		return int64(firstByte), 1
+	extra := bits.LeadingZeros8(^data[0])
+	if len(data) < extra+1 {
+		return 0, 0
 	}
-
-	// Multi-byte vint
-	// Count leading ones to determine length
-	length := 0
-	for i := 7; i >= 0; i-- {
-		if firstByte&(1<<uint(i)) == 0 {
-			break
-		}
-		length++
+	var result uint64
+	if extra < 7 {
+		result = uint64(data[0] & (0xff >> uint(extra+1)))
 	}
-
-	if length == 0 || length > 8 || length > len(data) {
-		return 0, 0
+	for i := 1; i <= extra; i++ {
+		result = result<<8 | uint64(data[i])
 	}
+	return result, extra + 1
+}
 
-	// Extract value
-	// Safely calculate the shift amount
-	if length > 8 || length < 1 {
-		return 0, 0
-	}
-	shiftAmount := 8 - length
-	result := int64(firstByte & ((1 << shiftAmount) - 1))
-	for i := 1; i < length; i++ {
-		result = (result << 8) | int64(data[i])
+// readVInt reads a signed variable-length integer, which is zigzag encoded
+// (0, -1, 1, -2, ... become 0, 1, 2, 3, ...)
+func (d *BinaryDecoder) readVInt(data []byte) (int64, int) {
+	u, n := d.readUnsignedVInt(data)
+	return int64(u>>1) ^ -int64(u&1), n // #nosec G115 - zigzag decoding
+}
+
+// mapKey returns key as a usable map key. Frozen collections and UDTs decode
+// to slices and maps, which cannot be keys, so they are keyed by their JSON form.
+func mapKey(key interface{}) interface{} {
+	switch k := key.(type) {
+	case []byte:
+		return fmt.Sprintf("0x%x", k)
+	case net.IP:
+		return k.String()
+	case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+		if b, err := json.Marshal(normalizeJSONKey(k)); err == nil {
+			return string(b)
+		}
+		return fmt.Sprintf("%v", k)
 	}
+	return key
+}
 
-	// Handle negative numbers
-	if length == 8 {
-		// Special case for maximum negative value
-		result = -result
+// normalizeJSONKey converts map[interface{}]interface{} values, which
+// encoding/json cannot marshal, to map[string]interface{}
+func normalizeJSONKey(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprintf("%v", k)] = normalizeJSONKey(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = normalizeJSONKey(val)
+		}
+		return m
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = normalizeJSONKey(val)
+		}
+		return out
 	}
+	return v
+}
 
-	return result, length
-}
\ No newline at end of file
+// NormalizeJSON converts the maps in a decoded value to string-keyed maps so
+// the value can be marshalled with encoding/json
+func NormalizeJSON(v interface{}) interface{} {
+	return normalizeJSONKey(v)
+}
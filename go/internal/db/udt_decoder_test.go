@@ -2,6 +2,7 @@ package db
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"math"
 	"math/big"
 	"net"
@@ -126,8 +127,9 @@ func TestBinaryDecoder_PrimitiveTypes(t *testing.T) {
 		epoch := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
 		days := int32(date.Sub(epoch).Hours() / 24)
 
+		// Dates are sent unsigned with the epoch at 2^31
 		data := make([]byte, 4)
-		binary.BigEndian.PutUint32(data, uint32(days))
+		binary.BigEndian.PutUint32(data, uint32(days)+1<<31)
 
 		result, err := decoder.Decode(data, &CQLTypeInfo{BaseType: "date"}, "")
 		require.NoError(t, err)
@@ -505,4 +507,98 @@ func TestBinaryDecoder_UDT(t *testing.T) {
 		assert.Nil(t, udt["city"])
 		assert.Equal(t, int32(10001), udt["zip"])
 	})
-}
\ No newline at end of file
+}
+
+// TestBinaryDecoder_Golden decodes values as Cassandra serializes them (native
+// protocol v4/v5, which share the value encodings), including the signed and
+// variable-length encodings that are easy to get wrong.
+func TestBinaryDecoder_Golden(t *testing.T) {
+	registry := NewUDTRegistry(nil)
+	registry.types["ks.address"] = &UDTDefinition{
+		Keyspace: "ks",
+		Name:     "address",
+		Fields: []UDTField{
+			{Name: "street", TypeStr: "text", TypeInfo: &CQLTypeInfo{BaseType: "text"}},
+			{Name: "zip", TypeStr: "int", TypeInfo: &CQLTypeInfo{BaseType: "int"}},
+		},
+	}
+	registry.types["ks.embedding"] = &UDTDefinition{
+		Keyspace: "ks",
+		Name:     "embedding",
+		Fields: []UDTField{
+			{Name: "model", TypeStr: "text", TypeInfo: &CQLTypeInfo{BaseType: "text"}},
+			{Name: "v", TypeStr: "vector<float, 2>", TypeInfo: &CQLTypeInfo{BaseType: "vector", Dimension: 2,
+				Parameters: []*CQLTypeInfo{{BaseType: "float"}}}},
+		},
+	}
+	decoder := NewBinaryDecoder(registry)
+
+	tests := []struct {
+		name     string
+		cqlType  string
+		hex      string
+		expected interface{}
+	}{
+		{"negative int", "int", "ffffffff", int32(-1)},
+		{"negative smallint", "smallint", "fffe", int16(-2)},
+		{"min bigint", "bigint", "8000000000000000", int64(math.MinInt64)},
+		{"timestamp before epoch", "timestamp", "fffffffffffffc18", time.UnixMilli(-1000)},
+		{"date", "date", "80004d19", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"date before epoch", "date", "7fffffff", time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{"time", "time", "0000034630b8a000", time.Hour},
+		{"negative decimal", "decimal", "00000002cfc7", "-123.45"},
+		{"small negative decimal", "decimal", "00000002fb", "-0.05"},
+		{"decimal with negative scale", "decimal", "fffffffd0c", "12000"},
+		{"duration", "duration", "020406", map[string]interface{}{"months": int64(1), "days": int64(2), "nanos": int64(3)}},
+		{"negative duration", "duration", "010305", map[string]interface{}{"months": int64(-1), "days": int64(-2), "nanos": int64(-3)}},
+		{"duration with multi-byte nanos", "duration", "0000fc068c61714000",
+			map[string]interface{}{"months": int64(0), "days": int64(0), "nanos": int64(time.Hour)}},
+		{"negative duration with multi-byte nanos", "duration", "0000fc068c61713fff",
+			map[string]interface{}{"months": int64(0), "days": int64(0), "nanos": -int64(time.Hour)}},
+		{"vector of float", "vector<float, 3>", "3f80000040200000c0400000",
+			[]interface{}{float32(1), float32(2.5), float32(-3)}},
+		{"vector of text", "vector<text, 2>", "0161026263", []interface{}{"a", "bc"}},
+		{"list of frozen vector", "list<frozen<vector<int, 2>>>", "00000001000000080000000100000002",
+			[]interface{}{[]interface{}{int32(1), int32(2)}}},
+		{"map keyed by frozen tuple", "frozen<map<frozen<tuple<int, text>>, int>>",
+			"00000001" + "0000000d" + "00000004000000010000000161" + "00000004" + "0000002a",
+			map[interface{}]interface{}{`[1,"a"]`: int32(42)}},
+		{"map keyed by frozen udt", "frozen<map<frozen<address>, int>>",
+			"00000001" + "0000000d" + "00000001610000000400000001" + "00000004" + "00000007",
+			map[interface{}]interface{}{`{"street":"a","zip":1}`: int32(7)}},
+		{"map keyed by blob", "map<blob, text>", "00000001" + "00000002cafe" + "0000000178",
+			map[interface{}]interface{}{"0xcafe": "x"}},
+		{"udt with vector field", "frozen<embedding>",
+			"00000001" + "6d" + "00000008" + "3f80000040000000",
+			map[string]interface{}{"model": "m", "v": []interface{}{float32(1), float32(2)}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			typeInfo, err := ParseCQLType(tc.cqlType)
+			require.NoError(t, err)
+			data, err := hex.DecodeString(tc.hex)
+			require.NoError(t, err)
+
+			result, err := decoder.Decode(data, typeInfo, "ks")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+
+	t.Run("malformed input", func(t *testing.T) {
+		for _, tc := range []struct{ cqlType, hex string }{
+			{"vector<float, 3>", "3f800000"},      // Too few elements
+			{"vector<text, 1>", "05616263"},       // Element longer than the data
+			{"duration", "02fc"},                  // Truncated vint
+			{"time", "ffffffffffffffff"},          // Negative time of day
+			{"vector<bigint, 1>", "000000000001"}, // Wrong element size
+		} {
+			typeInfo, err := ParseCQLType(tc.cqlType)
+			require.NoError(t, err)
+			data, _ := hex.DecodeString(tc.hex)
+			_, err = decoder.Decode(data, typeInfo, "ks")
+			assert.Error(t, err, "%s %s", tc.cqlType, tc.hex)
+		}
+	})
+}
@@ -3,8 +3,10 @@ package db
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	gocql "github.com/apache/cassandra-gocql-driver/v2"
+	"github.com/axonops/cqlai-node/internal/cql"
 )
 
 // UDTField represents a field within a User-Defined Type
@@ -21,25 +23,92 @@ type UDTDefinition struct {
 	Fields   []UDTField
 }
 
-// UDTRegistry manages UDT definitions using gocql's cached metadata
-// This simplified version relies on gocql's internal caching instead of maintaining our own cache
+// UDTRegistry caches parsed UDT definitions. Definitions are read from
+// system_schema.types, which reflects an ALTER TYPE as soon as it completes,
+// and fall back to gocql's metadata cache on servers without that table.
+// Entries are dropped by Invalidate when a type changes.
 type UDTRegistry struct {
 	session *gocql.Session
+
+	mu         sync.RWMutex
+	types      map[string]*UDTDefinition // keyed by keyspace.name
+	generation uint64                    // Bumped by every invalidation
 }
 
 // NewUDTRegistry creates a new UDT registry with the given session
 func NewUDTRegistry(session *gocql.Session) *UDTRegistry {
 	return &UDTRegistry{
 		session: session,
+		types:   make(map[string]*UDTDefinition),
 	}
 }
 
-// GetUDTDefinition retrieves a UDT definition from gocql's cached metadata
+// GetUDTDefinition returns a UDT definition, loading it on first use
 func (r *UDTRegistry) GetUDTDefinition(keyspace, udtName string) (*UDTDefinition, error) {
+	key := keyspace + "." + udtName
+	r.mu.RLock()
+	udtDef, ok := r.types[key]
+	generation := r.generation
+	r.mu.RUnlock()
+	if ok {
+		return udtDef, nil
+	}
+
 	if r.session == nil {
 		return nil, fmt.Errorf("no session available")
 	}
 
+	udtDef, err := r.loadUDTDefinition(keyspace, udtName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't cache a definition loaded before a concurrent invalidation
+	r.mu.Lock()
+	if r.generation == generation {
+		r.types[key] = udtDef
+	}
+	r.mu.Unlock()
+	return udtDef, nil
+}
+
+// loadUDTDefinition reads a UDT from system_schema.types, or from gocql's
+// metadata when that table is not available (Cassandra 2.x)
+func (r *UDTRegistry) loadUDTDefinition(keyspace, udtName string) (*UDTDefinition, error) {
+	var fieldNames, fieldTypes []string
+	err := r.session.Query(
+		"SELECT field_names, field_types FROM system_schema.types WHERE keyspace_name = ? AND type_name = ?",
+		keyspace, udtName).Scan(&fieldNames, &fieldTypes)
+	switch {
+	case err == gocql.ErrNotFound:
+		return nil, fmt.Errorf("UDT %s.%s not found", keyspace, udtName)
+	case err != nil:
+		return r.loadUDTFromMetadata(keyspace, udtName)
+	case len(fieldNames) != len(fieldTypes):
+		return nil, fmt.Errorf("UDT %s.%s has %d field names but %d field types", keyspace, udtName, len(fieldNames), len(fieldTypes))
+	}
+
+	udtDef := &UDTDefinition{
+		Keyspace: keyspace,
+		Name:     udtName,
+		Fields:   make([]UDTField, len(fieldNames)),
+	}
+	for i, name := range fieldNames {
+		typeInfo, err := ParseCQLType(fieldTypes[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse type for field %s in UDT %s.%s: %w", name, keyspace, udtName, err)
+		}
+		udtDef.Fields[i] = UDTField{
+			Name:     name,
+			TypeStr:  fieldTypes[i],
+			TypeInfo: typeInfo,
+		}
+	}
+	return udtDef, nil
+}
+
+// loadUDTFromMetadata builds a UDT definition from gocql's cached metadata
+func (r *UDTRegistry) loadUDTFromMetadata(keyspace, udtName string) (*UDTDefinition, error) {
 	// Get keyspace metadata from gocql (this is cached internally by gocql)
 	ksMetadata, err := r.session.KeyspaceMetadata(keyspace)
 	if err != nil {
@@ -81,14 +150,14 @@ func (r *UDTRegistry) GetUDTDefinition(keyspace, udtName string) (*UDTDefinition
 	return udtDef, nil
 }
 
-// GetUDTDefinitionOrLoad is now just an alias for GetUDTDefinition
-// since gocql handles the loading and caching internally
+// GetUDTDefinitionOrLoad is an alias for GetUDTDefinition, which loads
+// definitions that are not cached yet
 func (r *UDTRegistry) GetUDTDefinitionOrLoad(keyspace, udtName string) (*UDTDefinition, error) {
 	return r.GetUDTDefinition(keyspace, udtName)
 }
 
-// LoadKeyspaceUDTs is now a no-op since gocql handles loading automatically
-// Kept for backward compatibility
+// LoadKeyspaceUDTs makes sure gocql has loaded the keyspace metadata.
+// Kept for backward compatibility; definitions are loaded on demand.
 func (r *UDTRegistry) LoadKeyspaceUDTs(keyspace string) error {
 	if r.session == nil {
 		return fmt.Errorf("no session available")
@@ -98,21 +167,78 @@ func (r *UDTRegistry) LoadKeyspaceUDTs(keyspace string) error {
 	return err
 }
 
-// LoadKeyspaceUDTsUsingMetadata is now a no-op since we always use metadata
+// LoadKeyspaceUDTsUsingMetadata is an alias for LoadKeyspaceUDTs
 // Kept for backward compatibility
 func (r *UDTRegistry) LoadKeyspaceUDTsUsingMetadata(keyspace string) error {
 	return r.LoadKeyspaceUDTs(keyspace)
 }
 
-// Clear is a no-op since we don't maintain our own cache
-// gocql's cache is managed internally
+// Invalidate drops a cached UDT definition so the next lookup reloads it
+func (r *UDTRegistry) Invalidate(keyspace, udtName string) {
+	r.mu.Lock()
+	delete(r.types, keyspace+"."+udtName)
+	r.generation++
+	r.mu.Unlock()
+}
+
+// Clear drops all cached UDT definitions
 func (r *UDTRegistry) Clear() {
-	// No-op - gocql manages its own cache
+	r.mu.Lock()
+	r.types = make(map[string]*UDTDefinition)
+	r.generation++
+	r.mu.Unlock()
 }
 
-// ClearKeyspace is a no-op since we don't maintain our own cache
+// ClearKeyspace drops the cached UDT definitions of one keyspace
 func (r *UDTRegistry) ClearKeyspace(keyspace string) {
-	// No-op - gocql manages its own cache
+	prefix := keyspace + "."
+	r.mu.Lock()
+	for key := range r.types {
+		if strings.HasPrefix(key, prefix) {
+			delete(r.types, key)
+		}
+	}
+	r.generation++
+	r.mu.Unlock()
+}
+
+// GetUDTDefinition returns a user type through the session's UDT registry
+func (s *Session) GetUDTDefinition(keyspace, name string) (*UDTDefinition, error) {
+	return s.ensureUDTRegistry().GetUDTDefinition(keyspace, name)
+}
+
+// invalidateUDT drops the cached definition of a type, or of every type in
+// the keyspace when name is empty
+func (s *Session) invalidateUDT(keyspace, name string) {
+	registry := s.GetUDTRegistry()
+	if registry == nil {
+		return
+	}
+	if name == "" {
+		registry.ClearKeyspace(keyspace)
+	} else {
+		registry.Invalidate(keyspace, name)
+	}
+}
+
+// invalidateUDTsAfterDDL drops cached definitions a statement executed on this
+// session may have changed. Schema change events do the same for all clients,
+// but arrive only after the driver has refreshed its metadata.
+func (s *Session) invalidateUDTsAfterDDL(query string) {
+	ddl, err := cql.ParseDDL(query)
+	if err != nil || ddl == nil {
+		return
+	}
+	switch {
+	case ddl.Kind == cql.KindType:
+		keyspace := ddl.Keyspace
+		if keyspace == "" {
+			keyspace = s.Keyspace()
+		}
+		s.invalidateUDT(keyspace, ddl.Name)
+	case ddl.Kind == cql.KindKeyspace && ddl.Action == "DROP":
+		s.invalidateUDT(ddl.Name, "")
+	}
 }
 
 // GetAllUDTs returns all UDT definitions for a keyspace from gocql's cached metadata
@@ -8,8 +8,7 @@ import (
 )
 
 func TestUDTRegistry(t *testing.T) {
-	// Note: Most tests require a real Cassandra connection since the simplified
-	// registry relies on gocql's KeyspaceMetadata API
+	// Note: Loading definitions requires a real Cassandra connection
 
 	t.Run("creation", func(t *testing.T) {
 		// This test can run without a session
@@ -27,7 +26,7 @@ func TestUDTRegistry(t *testing.T) {
 		_, err = registry.GetUDTDefinitionOrLoad("test_ks", "address")
 		assert.Error(t, err)
 
-		// These are no-ops in the simplified version
+		// Clearing an empty registry is safe
 		registry.Clear()
 		registry.ClearKeyspace("test_ks")
 
@@ -37,6 +36,24 @@ func TestUDTRegistry(t *testing.T) {
 		// Should return nil without a session
 		assert.Nil(t, registry.GetAllUDTs("test_ks"))
 	})
+
+	t.Run("invalidation", func(t *testing.T) {
+		registry := NewUDTRegistry(nil)
+		for _, key := range []string{"ks1.address", "ks1.phone", "ks2.address"} {
+			registry.types[key] = &UDTDefinition{}
+		}
+
+		registry.Invalidate("ks1", "address")
+		assert.NotContains(t, registry.types, "ks1.address")
+		assert.Contains(t, registry.types, "ks1.phone")
+
+		registry.ClearKeyspace("ks1")
+		assert.NotContains(t, registry.types, "ks1.phone")
+		assert.Contains(t, registry.types, "ks2.address")
+
+		registry.Clear()
+		assert.Empty(t, registry.types)
+	})
 }
 
 func TestUDTDefinition(t *testing.T) {
@@ -0,0 +1,24 @@
+package db
+
+import "testing"
+
+func TestSupportsVirtualTablesFromVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"3.11.4", false},
+		{"3.0.29", false},
+		{"4.0.1", true},
+		{"5.0.2", true},
+	}
+
+	for _, tt := range tests {
+		// A parseable version must decide without querying the cluster,
+		// so no gocql session is needed here
+		s := &Session{cassandraVersion: tt.version}
+		if got := s.SupportsVirtualTables(); got != tt.want {
+			t.Errorf("SupportsVirtualTables() for %s = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+// Package filesink writes the append-only log files of the library: the
+// debug log and the history, audit and slow query logs the host application
+// keeps. A sink rotates its file by size and by age, gzips the rotated files
+// and keeps a bounded number of them.
+//
+// Writes are crash safe in the sense that matters for logs: each record is
+// appended with a single write, a record torn by a crash is ended before the
+// next one is written, a rotated file is renamed into place before a new file
+// is started, and a compressed copy only replaces the rotated file once it
+// is complete. A rotation interrupted by a crash is finished when the sink is
+// next opened. Sinks are safe for concurrent use within a process; processes
+// sharing a file may each rotate it.
+package filesink
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of Options
+const (
+	DefaultMaxSizeMB  = 10
+	DefaultMaxBackups = 5
+)
+
+// rotatedTimeFormat names rotated files; it sorts in time order
+const rotatedTimeFormat = "20060102-150405.000"
+
+// Suffixes of compressed rotated files and of compressions in progress
+const (
+	gzSuffix  = ".gz"
+	tmpSuffix = ".tmp"
+)
+
+// rotatedPattern matches what rotation appends to the name of a sink's file
+var rotatedPattern = regexp.MustCompile(`^\.\d{8}-\d{6}\.\d{3}(-\d+)?(\.gz)?(\.tmp)?$`)
+
+// Options control the rotation of a sink's file. A zero field takes the
+// default, or in a per-sink override the shared setting; a negative one
+// turns the limit off.
+type Options struct {
+	MaxSizeMB   int   `json:"maxSizeMB,omitempty"`   // Rotate before the file grows past this size (default 10)
+	RotateHours int   `json:"rotateHours,omitempty"` // Rotate once the file is this old (default never)
+	MaxBackups  int   `json:"maxBackups,omitempty"`  // Rotated files kept (default 5)
+	Compress    *bool `json:"compress,omitempty"`    // Gzip rotated files (default true)
+	Sync        *bool `json:"sync,omitempty"`        // Flush every record to disk (default false)
+}
+
+// Merge returns o with the fields override sets replaced
+func (o Options) Merge(override Options) Options {
+	if override.MaxSizeMB != 0 {
+		o.MaxSizeMB = override.MaxSizeMB
+	}
+	if override.RotateHours != 0 {
+		o.RotateHours = override.RotateHours
+	}
+	if override.MaxBackups != 0 {
+		o.MaxBackups = override.MaxBackups
+	}
+	if override.Compress != nil {
+		o.Compress = override.Compress
+	}
+	if override.Sync != nil {
+		o.Sync = override.Sync
+	}
+	return o
+}
+
+// Validate reports options that cannot be applied
+func (o Options) Validate() error {
+	if o.MaxSizeMB > 1<<20 {
+		return fmt.Errorf("maxSizeMB must be at most %d", 1<<20)
+	}
+	if o.RotateHours > 24*366 {
+		return fmt.Errorf("rotateHours must be at most %d", 24*366)
+	}
+	return nil
+}
+
+// maxBytes returns the size limit, or 0 for none
+func (o Options) maxBytes() int64 {
+	switch {
+	case o.MaxSizeMB > 0:
+		return int64(o.MaxSizeMB) << 20
+	case o.MaxSizeMB == 0:
+		return DefaultMaxSizeMB << 20
+	}
+	return 0
+}
+
+// maxAge returns the age limit, or 0 for none
+func (o Options) maxAge() time.Duration {
+	return time.Duration(max(o.RotateHours, 0)) * time.Hour
+}
+
+// backups returns the number of rotated files kept, or -1 for all
+func (o Options) backups() int {
+	switch {
+	case o.MaxBackups > 0:
+		return o.MaxBackups
+	case o.MaxBackups == 0:
+		return DefaultMaxBackups
+	}
+	return -1
+}
+
+func (o Options) compress() bool {
+	return o.Compress == nil || *o.Compress
+}
+
+func (o Options) sync() bool {
+	return o.Sync != nil && *o.Sync
+}
+
+// SinkConfig is a named sink: its file and its overrides of the shared
+// rotation settings
+type SinkConfig struct {
+	Path string `json:"path,omitempty"`
+	Options
+}
+
+// Config configures the sinks of a process
+type Config struct {
+	Rotation Options               `json:"rotation"`        // Shared by every sink
+	Sinks    map[string]SinkConfig `json:"sinks,omitempty"` // By name, e.g. debug, history, audit, slowQuery
+}
+
+// Resolve returns the file and options of a named sink
+func (c *Config) Resolve(name string) (string, Options) {
+	if c == nil {
+		return "", Options{}
+	}
+	sink := c.Sinks[name]
+	return sink.Path, c.Rotation.Merge(sink.Options)
+}
+
+// Validate reports settings that cannot be applied
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Rotation.Validate(); err != nil {
+		return fmt.Errorf("rotation: %v", err)
+	}
+	for name, sink := range c.Sinks {
+		if err := sink.Options.Validate(); err != nil {
+			return fmt.Errorf("sink %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Status describes a sink's file
+type Status struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`               // Bytes in the current file
+	Rotated   []string  `json:"rotated"`            // Rotated files, oldest first
+	StartedAt time.Time `json:"startedAt,omitzero"` // When the current file was started, as far as known
+	Options   Options   `json:"options"`
+}
+
+// Sink appends records to a file, rotating it as its options say
+type Sink struct {
+	path string
+
+	mu      sync.Mutex
+	opts    Options
+	file    *os.File
+	size    int64
+	started time.Time
+	closed  bool
+
+	background sync.WaitGroup // Compressions of rotated files
+}
+
+// New returns a sink for path. The file is opened by the first write.
+func New(path string, opts Options) *Sink {
+	return &Sink{path: filepath.Clean(path), opts: opts}
+}
+
+// Path returns the sink's file
+func (s *Sink) Path() string {
+	return s.path
+}
+
+// SetOptions changes the rotation of the sink, from its next write
+func (s *Sink) SetOptions(opts Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts = opts
+}
+
+// Write appends p to the file as one record
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	if s.file == nil {
+		if err := s.openLocked(); err != nil {
+			return 0, err
+		}
+	}
+	if s.dueLocked(int64(len(p))) {
+		if err := s.rotateLocked(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	if err == nil && s.opts.sync() {
+		err = s.file.Sync()
+	}
+	return n, err
+}
+
+// WriteRecord appends a record, ending it with a newline if it has none
+func (s *Sink) WriteRecord(record string) error {
+	if !strings.HasSuffix(record, "\n") {
+		record += "\n"
+	}
+	_, err := s.Write([]byte(record))
+	return err
+}
+
+// Rotate starts a new file, unless the current one is empty
+func (s *Sink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return os.ErrClosed
+	}
+	if s.file == nil {
+		if err := s.openLocked(); err != nil {
+			return err
+		}
+	}
+	if s.size == 0 {
+		return nil
+	}
+	return s.rotateLocked()
+}
+
+// Status returns the state of the sink's file
+func (s *Sink) Status() Status {
+	s.mu.Lock()
+	status := Status{Path: s.path, Size: s.size, StartedAt: s.started, Options: s.opts}
+	if s.file == nil {
+		if info, err := os.Stat(s.path); err == nil {
+			status.Size = info.Size()
+		}
+	}
+	s.mu.Unlock()
+
+	status.Rotated, _ = rotatedFiles(s.path)
+	if status.Rotated == nil {
+		status.Rotated = []string{}
+	}
+	return status
+}
+
+// Close closes the file and waits for compressions in progress. A closed
+// sink cannot be written to.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+	s.mu.Unlock()
+	s.background.Wait()
+	return err
+}
+
+// openLocked opens the file for appending, ending a record left torn by a
+// crash and finishing an interrupted rotation
+func (s *Sink) openLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) // #nosec G304 - configured log path
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	s.file, s.size, s.started = file, info.Size(), time.Now()
+	if s.size > 0 {
+		s.started = info.ModTime()
+		if torn, _ := endsTorn(s.path, s.size); torn {
+			n, _ := file.Write([]byte("\n"))
+			s.size += int64(n)
+		}
+	}
+	s.recover()
+	return nil
+}
+
+// endsTorn reports whether a file of size bytes ends within a record
+func endsTorn(path string, size int64) (bool, error) {
+	f, err := os.Open(path) // #nosec G304 - configured log path
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// recover removes partial compressions and compresses rotated files a crash
+// left uncompressed
+func (s *Sink) recover() {
+	dir, base := filepath.Split(s.path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !isRotated(base, entry) {
+			continue
+		}
+		full := filepath.Join(dir, name)
+		switch {
+		case strings.HasSuffix(name, tmpSuffix):
+			_ = os.Remove(full)
+		case !strings.HasSuffix(name, gzSuffix) && s.opts.compress():
+			s.compressLater(full)
+		}
+	}
+}
+
+// dueLocked reports whether the file must be rotated before a write of n bytes
+func (s *Sink) dueLocked(n int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if limit := s.opts.maxBytes(); limit > 0 && s.size+n > limit {
+		return true
+	}
+	age := s.opts.maxAge()
+	return age > 0 && time.Since(s.started) >= age
+}
+
+// rotateLocked renames the file aside and starts a new one
+func (s *Sink) rotateLocked() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	rotated := s.path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	for i := 1; exists(rotated) || exists(rotated+gzSuffix); i++ {
+		rotated = fmt.Sprintf("%s.%s-%d", s.path, time.Now().UTC().Format(rotatedTimeFormat), i)
+	}
+	if err := os.Rename(s.path, rotated); err != nil {
+		// Keep appending to the current file rather than lose records
+		file, openErr := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) // #nosec G304 - configured log path
+		if openErr == nil {
+			s.file = file
+		}
+		return fmt.Errorf("cannot rotate %s: %v", s.path, err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) // #nosec G304 - configured log path
+	if err != nil {
+		return err
+	}
+	s.file, s.size, s.started = file, 0, time.Now()
+
+	if s.opts.compress() {
+		s.compressLater(rotated)
+	} else {
+		prune(s.path, s.opts.backups())
+	}
+	return nil
+}
+
+// compressLater gzips a rotated file in the background, then prunes. It is
+// called with the sink locked.
+func (s *Sink) compressLater(path string) {
+	keep := s.opts.backups()
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		_ = compressFile(path)
+		prune(s.path, keep)
+	}()
+}
+
+// compressFile replaces a file with its gzipped copy once the copy is
+// complete on disk
+func compressFile(path string) error {
+	src, err := os.Open(path) // #nosec G304 - rotated log file
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + gzSuffix + tmpSuffix
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) // #nosec G304 - rotated log file
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if serr := dst.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+gzSuffix)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	_ = src.Close()
+	return os.Remove(path)
+}
+
+// prune removes the oldest rotated files of path beyond the number kept
+func prune(path string, keep int) {
+	if keep < 0 {
+		return
+	}
+	rotated, err := rotatedFiles(path)
+	if err != nil {
+		return
+	}
+	for len(rotated) > keep {
+		_ = os.Remove(rotated[0])
+		rotated = rotated[1:]
+	}
+}
+
+// rotatedFiles lists the rotated files of path, oldest first
+func rotatedFiles(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if name := entry.Name(); isRotated(base, entry) && !strings.HasSuffix(name, tmpSuffix) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return strings.TrimSuffix(files[i], gzSuffix) < strings.TrimSuffix(files[j], gzSuffix)
+	})
+	return files, nil
+}
+
+// isRotated reports whether a directory entry is a rotated file of the file
+// named base
+func isRotated(base string, entry os.DirEntry) bool {
+	name := entry.Name()
+	return !entry.IsDir() && strings.HasPrefix(name, base) && rotatedPattern.MatchString(name[len(base):])
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
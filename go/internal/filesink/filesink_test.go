@@ -0,0 +1,162 @@
+package filesink
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+// readAll returns the records of a sink's current and rotated files
+func readAll(t *testing.T, s *Sink) string {
+	t.Helper()
+	var all strings.Builder
+	files, err := rotatedFiles(s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range append(files, s.Path()) {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(path, gzSuffix) {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+		}
+		data, err := io.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		all.Write(data)
+	}
+	return all.String()
+}
+
+func TestRotationBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.log")
+	s := New(path, Options{MaxSizeMB: 1, MaxBackups: 2})
+	record := strings.Repeat("x", 1<<18-1) // Four records per file
+	for i := 0; i < 14; i++ {
+		if err := s.WriteRecord(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 14 records: 3 full files rotated, 2 of them kept, and 2 records current
+	files, _ := rotatedFiles(s.Path())
+	if len(files) != 2 {
+		t.Fatalf("rotated files %v, want 2", files)
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f, gzSuffix) {
+			t.Errorf("%s not compressed", f)
+		}
+	}
+	if got := strings.Count(readAll(t, s), "\n"); got != 10 {
+		t.Errorf("%d records kept, want 10", got)
+	}
+
+	// A file of its own name plus a suffix is not one of the sink's
+	other := path + ".bak"
+	if err := os.WriteFile(other, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := rotatedFiles(s.Path()); len(files) != 2 {
+		t.Errorf("rotated files %v include other files", files)
+	}
+}
+
+func TestConcurrentWritesAndRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.log")
+	s := New(path, Options{MaxBackups: -1, Compress: boolPtr(false)})
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				_ = s.WriteRecord(fmt.Sprintf("worker %d record %d", w, i))
+				if i%50 == 0 {
+					_ = s.Rotate()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	s.Close()
+
+	lines := strings.Split(strings.TrimSuffix(readAll(t, s), "\n"), "\n")
+	if len(lines) != 1600 {
+		t.Fatalf("%d records, want 1600", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "worker ") {
+			t.Fatalf("interleaved record %q", line)
+		}
+	}
+	if err := s.WriteRecord("late"); err == nil {
+		t.Errorf("write to a closed sink succeeded")
+	}
+}
+
+func TestRecoveryAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "slow.log")
+
+	// A torn record, a rotated file left uncompressed and a partial compression
+	if err := os.WriteFile(path, []byte("complete\ntorn"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rotated := path + ".20260101-000000.000"
+	if err := os.WriteFile(rotated, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rotated+gzSuffix+tmpSuffix, []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(path, Options{})
+	if err := s.WriteRecord("next"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if got := readAll(t, s); got != "old\ncomplete\ntorn\nnext\n" {
+		t.Errorf("records %q", got)
+	}
+	if exists(rotated) || exists(rotated+gzSuffix+tmpSuffix) || !exists(rotated+gzSuffix) {
+		t.Errorf("interrupted rotation not finished")
+	}
+}
+
+func TestConfigResolve(t *testing.T) {
+	cfg := &Config{
+		Rotation: Options{MaxSizeMB: 50, MaxBackups: 3},
+		Sinks: map[string]SinkConfig{
+			"audit": {Path: "/var/log/audit.log", Options: Options{MaxBackups: -1, Compress: boolPtr(false)}},
+		},
+	}
+	path, opts := cfg.Resolve("audit")
+	if path != "/var/log/audit.log" || opts.MaxSizeMB != 50 || opts.backups() != -1 || opts.compress() {
+		t.Errorf("audit resolved to %s %+v", path, opts)
+	}
+	if _, opts := cfg.Resolve("history"); opts.MaxBackups != 3 || !opts.compress() || opts.maxBytes() != 50<<20 {
+		t.Errorf("history resolved to %+v", opts)
+	}
+	if err := (&Config{Sinks: map[string]SinkConfig{"debug": {Options: Options{RotateHours: 1 << 20}}}}).Validate(); err == nil {
+		t.Errorf("rotateHours of 2^20 accepted")
+	}
+}
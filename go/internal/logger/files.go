@@ -0,0 +1,213 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/axonops/cqlai-node/internal/filesink"
+)
+
+// Log files
+//
+// The debug log, and the trace, history, audit and slow query logs the host
+// application keeps, are written through rotating file sinks (see
+// internal/filesink). They are configured together, per process: shared
+// rotation settings with overrides per log. Logs given the same file share
+// its sink, so their records are never interleaved and the file is rotated
+// once.
+
+// Log file names
+const (
+	FileDebug     = "debug"
+	FileTrace     = "trace"
+	FileHistory   = "history"
+	FileAudit     = "audit"
+	FileSlowQuery = "slowQuery"
+)
+
+// FileNames lists the log files in the order they are reported
+var FileNames = []string{FileDebug, FileTrace, FileHistory, FileAudit, FileSlowQuery}
+
+// LogFile describes the file of a configured log
+type LogFile struct {
+	Name string `json:"name"`
+	filesink.Status
+}
+
+var (
+	filesMu    sync.Mutex
+	fileConfig *filesink.Config
+	fileSinks  = make(map[string]*filesink.Sink) // By log name
+)
+
+// ConfigureFiles sets the files and rotation of the logs. Paths must be
+// absolute; a log other than the debug log without one is not written. Sinks
+// whose file is unchanged keep it open and pick up the new rotation from
+// their next record.
+func ConfigureFiles(cfg *filesink.Config) error {
+	if cfg == nil {
+		cfg = &filesink.Config{}
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	for name, sink := range cfg.Sinks {
+		if !isFileName(name) {
+			return fmt.Errorf("unknown log %q (want one of %v)", name, FileNames)
+		}
+		if sink.Path != "" && !filepath.IsAbs(sink.Path) {
+			return fmt.Errorf("log %s: path %q is not absolute", name, sink.Path)
+		}
+	}
+
+	// Resolve every log first, so a conflict leaves the current files alone
+	paths := make(map[string]string)
+	options := make(map[string]filesink.Options)
+	owner := make(map[string]string) // First log of each file
+	for _, name := range FileNames {
+		path, opts := resolveFile(cfg, name)
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		if first, ok := owner[path]; ok && !reflect.DeepEqual(options[first], opts) {
+			return fmt.Errorf("logs %s and %s share %s but not its rotation settings", first, name, path)
+		} else if !ok {
+			owner[path] = name
+		}
+		paths[name], options[name] = path, opts
+	}
+
+	filesMu.Lock()
+	byPath := make(map[string]*filesink.Sink)
+	for _, sink := range fileSinks {
+		byPath[sink.Path()] = sink
+	}
+	sinks := make(map[string]*filesink.Sink)
+	for _, name := range FileNames {
+		path, ok := paths[name]
+		if !ok {
+			continue
+		}
+		sink := byPath[path]
+		if sink == nil {
+			sink = filesink.New(path, options[name])
+			byPath[path] = sink
+		} else {
+			sink.SetOptions(options[name])
+		}
+		sinks[name] = sink
+	}
+	var unused []*filesink.Sink
+	for path, sink := range byPath {
+		if _, ok := owner[path]; !ok {
+			unused = append(unused, sink)
+		}
+	}
+	fileConfig, fileSinks = cfg, sinks
+	filesMu.Unlock()
+
+	// Closing waits for rotated files to be compressed
+	for _, sink := range unused {
+		_ = sink.Close()
+	}
+	return nil
+}
+
+// resolveFile returns the file and rotation of a log. The debug log defaults
+// to CQLAI_DEBUG_LOG_PATH, or cqlai_debug.log in the working directory, and
+// flushes every record unless told otherwise.
+func resolveFile(cfg *filesink.Config, name string) (string, filesink.Options) {
+	path, opts := cfg.Resolve(name)
+	if name != FileDebug {
+		return path, opts
+	}
+	if path == "" {
+		path = defaultDebugLogPath()
+	}
+	if opts.Sync == nil {
+		flush := true
+		opts.Sync = &flush
+	}
+	return path, opts
+}
+
+func defaultDebugLogPath() string {
+	if path := os.Getenv("CQLAI_DEBUG_LOG_PATH"); path != "" {
+		return path
+	}
+	cwd, _ := os.Getwd()
+	return filepath.Join(cwd, "cqlai_debug.log")
+}
+
+func isFileName(name string) bool {
+	for _, n := range FileNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fileSink returns the sink of a log, or nil if the log has no file. The
+// debug log has one even before the files are configured.
+func fileSink(name string) *filesink.Sink {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	sink := fileSinks[name]
+	if sink == nil && name == FileDebug && fileConfig == nil {
+		path, opts := resolveFile(&filesink.Config{}, FileDebug)
+		sink = filesink.New(path, opts)
+		fileSinks[name] = sink
+	}
+	return sink
+}
+
+// WriteRecord appends a record to a log, ending it with a newline
+func WriteRecord(name, record string) error {
+	if !isFileName(name) {
+		return fmt.Errorf("unknown log %q (want one of %v)", name, FileNames)
+	}
+	sink := fileSink(name)
+	if sink == nil {
+		return fmt.Errorf("no file is configured for the %s log", name)
+	}
+	err := sink.WriteRecord(record)
+	if errors.Is(err, os.ErrClosed) {
+		// The log moved to another file while the record was on its way
+		if sink = fileSink(name); sink != nil {
+			err = sink.WriteRecord(record)
+		}
+	}
+	return err
+}
+
+// RotateFile starts a new file for a log, unless its file is empty
+func RotateFile(name string) (*LogFile, error) {
+	if !isFileName(name) {
+		return nil, fmt.Errorf("unknown log %q (want one of %v)", name, FileNames)
+	}
+	sink := fileSink(name)
+	if sink == nil {
+		return nil, fmt.Errorf("no file is configured for the %s log", name)
+	}
+	if err := sink.Rotate(); err != nil {
+		return nil, err
+	}
+	return &LogFile{Name: name, Status: sink.Status()}, nil
+}
+
+// Files describes the file of each log that has one
+func Files() []LogFile {
+	files := []LogFile{}
+	for _, name := range FileNames {
+		if sink := fileSink(name); sink != nil {
+			files = append(files, LogFile{Name: name, Status: sink.Status()})
+		}
+	}
+	return files
+}
@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axonops/cqlai-node/internal/filesink"
+)
+
+func TestConfigureFiles(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "audit.log")
+	t.Cleanup(func() { _ = ConfigureFiles(nil) })
+
+	cfg := &filesink.Config{Sinks: map[string]filesink.SinkConfig{
+		FileDebug:     {Path: filepath.Join(dir, "debug.log")},
+		FileAudit:     {Path: shared},
+		FileSlowQuery: {Path: shared},
+	}}
+	if err := ConfigureFiles(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteRecord(FileAudit, "grant"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteRecord(FileSlowQuery, "select\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteRecord(FileHistory, "use ks"); err == nil {
+		t.Errorf("history written without a file")
+	}
+	if data, _ := os.ReadFile(shared); string(data) != "grant\nselect\n" {
+		t.Errorf("shared file holds %q", data)
+	}
+
+	// A conflict leaves the files as they were
+	conflict := &filesink.Config{Sinks: map[string]filesink.SinkConfig{
+		FileAudit:     {Path: shared, Options: filesink.Options{MaxBackups: -1}},
+		FileSlowQuery: {Path: shared},
+	}}
+	if err := ConfigureFiles(conflict); err == nil {
+		t.Errorf("shared file with different rotation accepted")
+	}
+	if err := ConfigureFiles(&filesink.Config{Sinks: map[string]filesink.SinkConfig{"queries": {}}}); err == nil {
+		t.Errorf("unknown log accepted")
+	}
+	if len(Files()) != 3 {
+		t.Fatalf("files %+v", Files())
+	}
+
+	file, err := RotateFile(FileSlowQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Size != 0 || len(file.Rotated) != 1 {
+		t.Errorf("after rotating: %+v", file)
+	}
+}
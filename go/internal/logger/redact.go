@@ -0,0 +1,282 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/axonops/cqlai-node/internal/batch"
+)
+
+// Statement redaction
+//
+// Every log that records a statement goes through one policy: the statement
+// is reduced to its shape, with each literal replaced by ?, and each bind
+// value is written as its type plus a keyed hash, a partly masked form, or
+// its type alone. A hash stays the same for the same value and salt, so two
+// log lines can be matched against each other, and against a value the
+// reader already knows, without the value itself ever being written.
+// Policies are set per workspace; the "" workspace is the default for
+// sessions and callers without one.
+
+// Redaction modes
+const (
+	RedactHash = "hash" // Type and keyed hash of the value (default)
+	RedactMask = "mask" // Value with all but a few characters at each end masked
+	RedactType = "type" // Type and length only
+	RedactNone = "none" // Value as is, for local debugging
+)
+
+const (
+	redactHashLength    = 12 // Hex digits of the hash kept
+	redactMaskChar      = '*'
+	defaultKeepChars    = 2    // Mask mode: characters kept at each end
+	defaultMaxValueLen  = 64   // Longest value written before it is cut
+	defaultMaxStatement = 2000 // Longest statement shape written before it is cut
+)
+
+// RedactionPolicy controls how statements and bind values are written to logs
+type RedactionPolicy struct {
+	Mode           string `json:"mode"`                     // hash, mask, type or none
+	Salt           string `json:"salt,omitempty"`           // Key for hash mode, so short values cannot be guessed from their hash
+	KeepChars      int    `json:"keepChars,omitempty"`      // Mask mode: characters kept at each end
+	MaxValueLength int    `json:"maxValueLength,omitempty"` // Longest value written, in characters
+	MaxStatement   int    `json:"maxStatement,omitempty"`   // Longest statement shape written, in characters
+}
+
+// DefaultRedactionPolicy returns the policy used when a workspace has none
+func DefaultRedactionPolicy() RedactionPolicy {
+	return RedactionPolicy{
+		Mode:           RedactHash,
+		KeepChars:      defaultKeepChars,
+		MaxValueLength: defaultMaxValueLen,
+		MaxStatement:   defaultMaxStatement,
+	}
+}
+
+// WithDefaults fills unset fields from the default policy and checks the rest
+func (p RedactionPolicy) WithDefaults() (RedactionPolicy, error) {
+	def := DefaultRedactionPolicy()
+	p.Mode = strings.ToLower(strings.TrimSpace(p.Mode))
+	switch p.Mode {
+	case "":
+		p.Mode = def.Mode
+	case RedactHash, RedactMask, RedactType, RedactNone:
+	default:
+		return p, fmt.Errorf("unknown redaction mode %q: use hash, mask, type or none", p.Mode)
+	}
+	if p.KeepChars < 0 || p.MaxValueLength < 0 || p.MaxStatement < 0 {
+		return p, fmt.Errorf("keepChars, maxValueLength and maxStatement must not be negative")
+	}
+	if p.KeepChars == 0 {
+		p.KeepChars = def.KeepChars
+	}
+	if p.MaxValueLength == 0 {
+		p.MaxValueLength = def.MaxValueLength
+	}
+	if p.MaxStatement == 0 {
+		p.MaxStatement = def.MaxStatement
+	}
+	return p, nil
+}
+
+// Redaction policies by workspace ID
+var (
+	redactionPolicies     = make(map[string]RedactionPolicy)
+	redactionPoliciesLock sync.RWMutex
+)
+
+// SetRedactionPolicy sets the policy of a workspace; nil restores the default
+func SetRedactionPolicy(workspace string, policy *RedactionPolicy) (RedactionPolicy, error) {
+	redactionPoliciesLock.Lock()
+	defer redactionPoliciesLock.Unlock()
+	if policy == nil {
+		delete(redactionPolicies, workspace)
+		return DefaultRedactionPolicy(), nil
+	}
+	p, err := policy.WithDefaults()
+	if err != nil {
+		return p, err
+	}
+	redactionPolicies[workspace] = p
+	return p, nil
+}
+
+// RedactionPolicyFor returns the policy of a workspace, else the policy of
+// the "" workspace, else the default
+func RedactionPolicyFor(workspace string) RedactionPolicy {
+	redactionPoliciesLock.RLock()
+	defer redactionPoliciesLock.RUnlock()
+	if p, ok := redactionPolicies[workspace]; ok {
+		return p
+	}
+	if p, ok := redactionPolicies[""]; ok {
+		return p
+	}
+	return DefaultRedactionPolicy()
+}
+
+// literalPattern finds string, blob and numeric literals when a statement
+// cannot be lexed
+var literalPattern = regexp.MustCompile(`'(?:[^']|'')*'?|\$\$[\s\S]*?(?:\$\$|$)|\b0[xX][0-9a-fA-F]*|\b\d+(?:\.\d+)?(?:[eE][+-]?\d+)?\b`)
+
+// commentPattern finds comments when a statement cannot be lexed
+var commentPattern = regexp.MustCompile(`(?:--|//)[^\n]*|/\*[\s\S]*?(?:\*/|$)`)
+
+// quotedPattern finds quoted strings in free text such as an error message
+var quotedPattern = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// StatementShape returns a statement with every literal replaced by ? and
+// comments removed, so statements that differ only in their values have the
+// same shape
+func StatementShape(query string) string {
+	// The lexer has no bind markers; lex each ? as a one-letter identifier
+	// and take the token text from the query itself
+	tokens, err := batch.Lex(strings.ReplaceAll(query, "?", "x"))
+	if err != nil {
+		query = commentPattern.ReplaceAllString(query, " ")
+		return strings.Join(strings.Fields(literalPattern.ReplaceAllString(query, "?")), " ")
+	}
+
+	var b strings.Builder
+	end := 0
+	for i, tok := range tokens {
+		if i > 0 && tok.Start > end {
+			b.WriteByte(' ')
+		}
+		end = tok.End
+		switch tok.Type {
+		case batch.TokenQuotedStringLiteral, batch.TokenPgStringLiteral,
+			batch.TokenUnclosedString, batch.TokenUnclosedPgString,
+			batch.TokenFloat, batch.TokenUUID, batch.TokenBlobLiteral, batch.TokenWholenumber:
+			b.WriteByte('?')
+		case batch.TokenUnclosedComment:
+		case batch.TokenEndline:
+			b.WriteByte(' ')
+		default:
+			b.WriteString(query[tok.Start:tok.End])
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// ScrubText replaces the quoted strings of free text, such as a server error
+// that echoes part of a statement, with ?
+func ScrubText(text string) string {
+	return quotedPattern.ReplaceAllString(text, "?")
+}
+
+// Statement returns the shape of a statement followed by its redacted bind
+// values
+func (p RedactionPolicy) Statement(query string, values []interface{}) string {
+	shape := cut(StatementShape(query), p.MaxStatement)
+	if len(values) == 0 {
+		return shape
+	}
+	return shape + " [" + strings.Join(p.Values(values), ", ") + "]"
+}
+
+// Values returns each bind value redacted
+func (p RedactionPolicy) Values(values []interface{}) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = p.Value(v)
+	}
+	return out
+}
+
+// NamedValues returns bind values by name, redacted, in name order
+func (p RedactionPolicy) NamedValues(values map[string]interface{}) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = name + "=" + p.Value(values[name])
+	}
+	return out
+}
+
+// Value returns a bind value as the policy allows it to be written
+func (p RedactionPolicy) Value(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	kind, text := valueText(v)
+	switch p.Mode {
+	case RedactNone:
+		return cut(text, p.MaxValueLength)
+	case RedactType:
+		return fmt.Sprintf("<%s len=%d>", kind, len([]rune(text)))
+	case RedactMask:
+		return kind + ":" + cut(mask(text, p.KeepChars), p.MaxValueLength)
+	}
+	mac := hmac.New(sha256.New, []byte(p.Salt))
+	mac.Write([]byte(text))
+	return kind + "#" + hex.EncodeToString(mac.Sum(nil))[:redactHashLength]
+}
+
+// valueText returns the kind of a value and the text it is hashed or masked
+// as. Text, numbers and UUIDs give the same text whether they came from JSON
+// or were converted for the driver, so their hashes match across logs.
+func valueText(v interface{}) (string, string) {
+	switch val := v.(type) {
+	case string:
+		return "text", val
+	case []byte:
+		return "blob", "0x" + hex.EncodeToString(val)
+	case bool:
+		return "boolean", fmt.Sprint(val)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "number", fmt.Sprint(val)
+	case float32, float64:
+		return "number", fmt.Sprint(val)
+	case json.Number:
+		return "number", val.String()
+	case time.Time:
+		return "timestamp", val.UTC().Format(time.RFC3339Nano)
+	case []interface{}, map[string]interface{}:
+		text, _ := json.Marshal(val)
+		return "collection", string(text)
+	case fmt.Stringer:
+		return "value", val.String()
+	}
+	return fmt.Sprintf("%T", v), fmt.Sprint(v)
+}
+
+// mask keeps keep characters at each end of s and masks the rest; a value
+// too short to keep anything is masked entirely
+func mask(s string, keep int) string {
+	r := []rune(s)
+	if len(r) <= 2*keep+1 {
+		return strings.Repeat(string(redactMaskChar), len(r))
+	}
+	return string(r[:keep]) + strings.Repeat(string(redactMaskChar), len(r)-2*keep) + string(r[len(r)-keep:])
+}
+
+// cut shortens s to n characters, marking where it was cut
+func cut(s string, n int) string {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
+
+// DebugStatement writes a statement and its bind values to the debug log
+// under the workspace's redaction policy
+func DebugStatement(workspace, context, prefix, query string, values []interface{}) {
+	if !IsDebugEnabled() {
+		return
+	}
+	DebugToFile(context, prefix+RedactionPolicyFor(workspace).Statement(query, values))
+}
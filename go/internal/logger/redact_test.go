@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatementShape(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM ks.users WHERE id = 42", "SELECT * FROM ks.users WHERE id = ?"},
+		{"INSERT INTO users (id, email, pw)\n  VALUES (uuid(), 'a@b.com', 'it''s secret');", "INSERT INTO users (id, email, pw) VALUES (uuid(), ?, ?);"},
+		{"UPDATE t SET v = 0xcafe, f = 1.5 WHERE k = 5b6962dd-3f90-4c93-8f61-eabfa4a803e2", "UPDATE t SET v = ?, f = ? WHERE k = ?"},
+		{"SELECT * FROM t -- token 'abc'\nWHERE k = ?", "SELECT * FROM t WHERE k = ?"},
+		{"SELECT * FROM t WHERE k = 'unclosed", "SELECT * FROM t WHERE k = ?"},
+	}
+
+	for _, tt := range tests {
+		if got := StatementShape(tt.query); got != tt.want {
+			t.Errorf("StatementShape(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRedactionPolicyValue(t *testing.T) {
+	hash, _ := RedactionPolicy{Salt: "s1"}.WithDefaults()
+	other, _ := RedactionPolicy{Salt: "s2"}.WithDefaults()
+	masked, _ := RedactionPolicy{Mode: RedactMask}.WithDefaults()
+	typed, _ := RedactionPolicy{Mode: RedactType}.WithDefaults()
+
+	secret := "hunter2-password"
+	if got := hash.Value(secret); strings.Contains(got, "hunter") || !strings.HasPrefix(got, "text#") {
+		t.Errorf("hash.Value = %q", got)
+	}
+	if hash.Value(secret) != hash.Value(secret) || hash.Value(secret) == other.Value(secret) {
+		t.Error("hash must be stable for a salt and differ between salts")
+	}
+	if hash.Value(int64(7)) != hash.Value(float64(7)) {
+		t.Error("numbers must hash the same whatever their Go type")
+	}
+	if got := masked.Value(secret); got != "text:hu************rd" {
+		t.Errorf("masked.Value = %q", got)
+	}
+	if got := masked.Value("abc"); got != "text:***" {
+		t.Errorf("masked.Value of a short value = %q", got)
+	}
+	if got := typed.Value([]byte{1, 2}); got != "<blob len=6>" {
+		t.Errorf("typed.Value = %q", got)
+	}
+	if got := hash.Value(nil); got != "null" {
+		t.Errorf("hash.Value(nil) = %q", got)
+	}
+	if _, err := (RedactionPolicy{Mode: "rot13"}).WithDefaults(); err == nil {
+		t.Error("unknown mode accepted")
+	}
+}
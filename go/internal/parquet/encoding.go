@@ -0,0 +1,300 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var errTruncated = errors.New("truncated page")
+
+// appendPlain appends a non-null value in the PLAIN encoding. Booleans are
+// bit-packed by the caller.
+func appendPlain(buf []byte, col Column, v interface{}) ([]byte, error) {
+	switch col.Type {
+	case Int32:
+		i, ok := v.(int32)
+		if !ok {
+			return nil, fmt.Errorf("column %s: want int32, got %T", col.Name, v)
+		}
+		return binary.LittleEndian.AppendUint32(buf, uint32(i)), nil
+	case Int64:
+		i, ok := v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("column %s: want int64, got %T", col.Name, v)
+		}
+		return binary.LittleEndian.AppendUint64(buf, uint64(i)), nil
+	case Float:
+		f, ok := v.(float32)
+		if !ok {
+			return nil, fmt.Errorf("column %s: want float32, got %T", col.Name, v)
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(f)), nil
+	case Double:
+		f, ok := v.(float64)
+		if !ok {
+			return nil, fmt.Errorf("column %s: want float64, got %T", col.Name, v)
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case ByteArray:
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("column %s: want []byte, got %T", col.Name, v)
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b)))
+		return append(buf, b...), nil
+	case FixedLenByteArray, Int96:
+		b, ok := v.([]byte)
+		size := col.TypeLength
+		if col.Type == Int96 {
+			size = 12
+		}
+		if !ok || len(b) != size {
+			return nil, fmt.Errorf("column %s: want %d bytes, got %T of length %d", col.Name, size, v, len(b))
+		}
+		return append(buf, b...), nil
+	}
+	return nil, fmt.Errorf("column %s: cannot write type %s", col.Name, col.Type)
+}
+
+// decodePlain decodes n PLAIN encoded values
+func decodePlain(buf []byte, col Column, n int) ([]interface{}, error) {
+	values := make([]interface{}, n)
+	pos := 0
+	need := func(size int) error {
+		if size < 0 || len(buf)-pos < size {
+			return errTruncated
+		}
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		switch col.Type {
+		case Boolean:
+			if i/8 >= len(buf) {
+				return nil, errTruncated
+			}
+			values[i] = buf[i/8]&(1<<(i%8)) != 0
+		case Int32:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			values[i] = int32(binary.LittleEndian.Uint32(buf[pos:]))
+			pos += 4
+		case Int64:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			values[i] = int64(binary.LittleEndian.Uint64(buf[pos:]))
+			pos += 8
+		case Float:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[pos:]))
+			pos += 4
+		case Double:
+			if err := need(8); err != nil {
+				return nil, err
+			}
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[pos:]))
+			pos += 8
+		case ByteArray:
+			if err := need(4); err != nil {
+				return nil, err
+			}
+			size := int(int32(binary.LittleEndian.Uint32(buf[pos:])))
+			pos += 4
+			if err := need(size); err != nil {
+				return nil, err
+			}
+			values[i] = buf[pos : pos+size : pos+size]
+			pos += size
+		case FixedLenByteArray, Int96:
+			size := col.TypeLength
+			if col.Type == Int96 {
+				size = 12
+			}
+			if err := need(size); err != nil || size <= 0 {
+				return nil, errTruncated
+			}
+			values[i] = buf[pos : pos+size : pos+size]
+			pos += size
+		default:
+			return nil, fmt.Errorf("column %s: cannot read type %s", col.Name, col.Type)
+		}
+	}
+	return values, nil
+}
+
+// appendLevels appends definition levels of bit width 1 in the RLE/bit-packed
+// hybrid encoding, as RLE runs
+func appendLevels(buf []byte, defined []bool) []byte {
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		if defined[i] {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		i = j
+	}
+	return buf
+}
+
+// decodeHybrid decodes n values of bitWidth bits in the RLE/bit-packed hybrid
+// encoding: runs of one repeated value, and groups of 8 bit-packed values
+func decodeHybrid(buf []byte, bitWidth, n int) ([]int32, error) {
+	if bitWidth < 0 || bitWidth > 32 {
+		return nil, fmt.Errorf("invalid bit width %d", bitWidth)
+	}
+	out := make([]int32, 0, n)
+	byteWidth := (bitWidth + 7) / 8
+	pos := 0
+	for len(out) < n {
+		header, size := binary.Uvarint(buf[pos:])
+		if size <= 0 {
+			return nil, errTruncated
+		}
+		pos += size
+
+		if header&1 == 0 {
+			count := int(header >> 1)
+			if len(buf)-pos < byteWidth || count < 0 {
+				return nil, errTruncated
+			}
+			var v uint32
+			for b := 0; b < byteWidth; b++ {
+				v |= uint32(buf[pos+b]) << (8 * b)
+			}
+			pos += byteWidth
+			for k := 0; k < count && len(out) < n; k++ {
+				out = append(out, int32(v))
+			}
+			continue
+		}
+
+		groups := int(header >> 1)
+		size = groups * bitWidth
+		if size < 0 || len(buf)-pos < size {
+			return nil, errTruncated
+		}
+		packed := buf[pos : pos+size]
+		pos += size
+		for k := 0; k < groups*8 && len(out) < n; k++ {
+			var v uint32
+			for b := 0; b < bitWidth; b++ {
+				bit := k*bitWidth + b
+				if packed[bit/8]&(1<<(bit%8)) != 0 {
+					v |= 1 << b
+				}
+			}
+			out = append(out, int32(v))
+		}
+	}
+	return out, nil
+}
+
+// decompress expands a page with the chunk's codec
+func decompress(codec int32, data []byte, size int) ([]byte, error) {
+	switch codec {
+	case codecUncompressed:
+		return data, nil
+	case codecSnappy:
+		return snappyDecode(data)
+	case codecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 0, size)
+		buf := bytes.NewBuffer(out)
+		if _, err := io.Copy(buf, io.LimitReader(zr, int64(size)+1)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	names := map[int32]string{3: "LZO", 4: "BROTLI", 5: "LZ4", 6: "ZSTD", 7: "LZ4_RAW"}
+	if name, ok := names[codec]; ok {
+		return nil, fmt.Errorf("%s compression is not supported; write the file with SNAPPY, GZIP or no compression", name)
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", codec)
+}
+
+// snappyDecode decodes a snappy block: the uncompressed length as a varint,
+// then literals and back-references to the output so far
+func snappyDecode(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length > maxThriftLength {
+		return nil, fmt.Errorf("invalid snappy block")
+	}
+	dst := make([]byte, 0, length)
+	pos := n
+	for pos < len(src) {
+		tag := src[pos]
+		pos++
+		var size, offset int
+		switch tag & 3 {
+		case 0: // Literal
+			size = int(tag >> 2)
+			if size >= 60 {
+				extra := size - 59
+				if len(src)-pos < extra {
+					return nil, errTruncated
+				}
+				size = 0
+				for b := 0; b < extra; b++ {
+					size |= int(src[pos+b]) << (8 * b)
+				}
+				pos += extra
+			}
+			size++
+			if size <= 0 || len(src)-pos < size {
+				return nil, errTruncated
+			}
+			dst = append(dst, src[pos:pos+size]...)
+			pos += size
+			continue
+		case 1: // Copy with a 1-byte offset
+			if pos >= len(src) {
+				return nil, errTruncated
+			}
+			size = 4 + int(tag>>2)&7
+			offset = int(tag>>5)<<8 | int(src[pos])
+			pos++
+		case 2: // Copy with a 2-byte offset
+			if len(src)-pos < 2 {
+				return nil, errTruncated
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[pos:]))
+			pos += 2
+		case 3: // Copy with a 4-byte offset
+			if len(src)-pos < 4 {
+				return nil, errTruncated
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[pos:]))
+			pos += 4
+		}
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+size) > length {
+			return nil, fmt.Errorf("invalid snappy copy")
+		}
+		// Copies may overlap the bytes they produce
+		start := len(dst) - offset
+		for k := 0; k < size; k++ {
+			dst = append(dst, dst[start+k])
+		}
+	}
+	if uint64(len(dst)) != length {
+		return nil, fmt.Errorf("snappy block decodes to %d bytes, want %d", len(dst), length)
+	}
+	return dst, nil
+}
@@ -0,0 +1,426 @@
+package parquet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fileMeta is the part of the file metadata the reader and writer use
+type fileMeta struct {
+	columns   []Column
+	numRows   int64
+	rowGroups []rowGroup
+	createdBy string
+}
+
+type rowGroup struct {
+	numRows    int64
+	totalBytes int64
+	chunks     []columnChunk // One per column, in schema order
+}
+
+type columnChunk struct {
+	codec            int32
+	encodings        []int32
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+	dataPageOffset   int64
+	dictPageOffset   int64 // 0 when the chunk has no dictionary page
+}
+
+// start returns the offset of the chunk's first page
+func (c columnChunk) start() int64 {
+	if c.dictPageOffset > 0 && c.dictPageOffset < c.dataPageOffset {
+		return c.dictPageOffset
+	}
+	return c.dataPageOffset
+}
+
+// pageHeader is a decoded page header
+type pageHeader struct {
+	typ              int32
+	uncompressedSize int32
+	compressedSize   int32
+
+	numValues   int32 // Data and dictionary pages
+	encoding    int32
+	defEncoding int32 // v1 data pages
+
+	// v2 data pages: the levels come first, uncompressed
+	numNulls     int32
+	defLength    int32
+	repLength    int32
+	isCompressed bool
+}
+
+// encodeFileMeta encodes the FileMetaData struct
+func encodeFileMeta(m *fileMeta) []byte {
+	w := &thriftWriter{}
+	w.beginStruct()
+	w.i32Field(1, 1) // version
+
+	w.listField(2, ctStruct, len(m.columns)+1)
+	w.beginStruct() // root
+	w.stringField(4, "schema")
+	w.i32Field(5, int32(len(m.columns)))
+	w.endStruct()
+	for _, col := range m.columns {
+		encodeSchemaElement(w, col)
+	}
+
+	w.i64Field(3, m.numRows)
+	w.listField(4, ctStruct, len(m.rowGroups))
+	for _, rg := range m.rowGroups {
+		w.beginStruct()
+		w.listField(1, ctStruct, len(rg.chunks))
+		for i, c := range rg.chunks {
+			w.beginStruct()
+			w.i64Field(2, c.start()) // file_offset
+			w.structField(3)         // meta_data
+			w.i32Field(1, int32(m.columns[i].Type))
+			w.listField(2, ctI32, len(c.encodings))
+			for _, e := range c.encodings {
+				w.i32(e)
+			}
+			w.listField(3, ctBinary, 1)
+			w.str(m.columns[i].Name)
+			w.i32Field(4, c.codec)
+			w.i64Field(5, c.numValues)
+			w.i64Field(6, c.uncompressedSize)
+			w.i64Field(7, c.compressedSize)
+			w.i64Field(9, c.dataPageOffset)
+			if c.dictPageOffset > 0 {
+				w.i64Field(11, c.dictPageOffset)
+			}
+			w.endStruct()
+			w.endStruct()
+		}
+		w.i64Field(2, rg.totalBytes)
+		w.i64Field(3, rg.numRows)
+		w.endStruct()
+	}
+	if m.createdBy != "" {
+		w.stringField(6, m.createdBy)
+	}
+	w.endStruct()
+	return w.buf
+}
+
+// encodeSchemaElement writes a leaf column as a list element
+func encodeSchemaElement(w *thriftWriter, col Column) {
+	w.beginStruct()
+	w.i32Field(1, int32(col.Type))
+	if col.Type == FixedLenByteArray {
+		w.i32Field(2, int32(col.TypeLength))
+	}
+	if col.Required {
+		w.i32Field(3, repRequired)
+	} else {
+		w.i32Field(3, repOptional)
+	}
+	w.stringField(4, col.Name)
+	if conv, ok := convertedType(col); ok {
+		w.i32Field(6, conv)
+	}
+	if col.Logical == LogicalDecimal {
+		w.i32Field(7, int32(col.Scale))
+		w.i32Field(8, int32(col.Precision))
+	}
+	if col.Logical != LogicalNone {
+		w.structField(10)
+		encodeLogicalType(w, col)
+		w.endStruct()
+	}
+	w.endStruct()
+}
+
+// encodeLogicalType writes the member of the LogicalType union for col
+func encodeLogicalType(w *thriftWriter, col Column) {
+	switch col.Logical {
+	case LogicalString:
+		w.emptyStructField(1)
+	case LogicalDecimal:
+		w.structField(5)
+		w.i32Field(1, int32(col.Scale))
+		w.i32Field(2, int32(col.Precision))
+		w.endStruct()
+	case LogicalDate:
+		w.emptyStructField(6)
+	case LogicalTime, LogicalTimestamp:
+		if col.Logical == LogicalTime {
+			w.structField(7)
+		} else {
+			w.structField(8)
+		}
+		w.boolField(1, col.UTC)
+		w.structField(2)
+		w.emptyStructField(int16(col.Unit) + 1)
+		w.endStruct()
+		w.endStruct()
+	case LogicalInt:
+		w.structField(10)
+		w.byteField(1, int8(col.BitWidth))
+		w.boolField(2, !col.Unsigned)
+		w.endStruct()
+	case LogicalJSON:
+		w.emptyStructField(12)
+	case LogicalUUID:
+		w.emptyStructField(14)
+	}
+}
+
+// convertedType returns the converted type matching col's logical type
+func convertedType(col Column) (int32, bool) {
+	switch col.Logical {
+	case LogicalString:
+		return convUTF8, true
+	case LogicalJSON:
+		return convJSON, true
+	case LogicalDecimal:
+		return convDecimal, true
+	case LogicalDate:
+		return convDate, true
+	case LogicalTime:
+		switch col.Unit {
+		case Millis:
+			return convTimeMillis, true
+		case Micros:
+			return convTimeMicros, true
+		}
+	case LogicalTimestamp:
+		switch col.Unit {
+		case Millis:
+			return convTimestampMillis, true
+		case Micros:
+			return convTimestampMicros, true
+		}
+	case LogicalInt:
+		conv := map[int]int32{8: convInt8, 16: convInt16, 32: convInt32, 64: convInt64}
+		if col.Unsigned {
+			conv = map[int]int32{8: convUint8, 16: convUint16, 32: convUint32, 64: convUint64}
+		}
+		v, ok := conv[col.BitWidth]
+		return v, ok
+	}
+	return 0, false
+}
+
+// encodeDataPageHeader encodes the header of an uncompressed v1 data page
+func encodeDataPageHeader(size, numValues int) []byte {
+	w := &thriftWriter{}
+	w.beginStruct()
+	w.i32Field(1, pageData)
+	w.i32Field(2, int32(size))
+	w.i32Field(3, int32(size))
+	w.structField(5)
+	w.i32Field(1, int32(numValues))
+	w.i32Field(2, encPlain)
+	w.i32Field(3, encRLE)
+	w.i32Field(4, encRLE)
+	w.endStruct()
+	w.endStruct()
+	return w.buf
+}
+
+// decodeFileMeta decodes the FileMetaData struct
+func decodeFileMeta(buf []byte) (*fileMeta, error) {
+	r := &thriftReader{buf: buf}
+	s, err := r.readStruct(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file metadata: %v", err)
+	}
+
+	m := &fileMeta{numRows: s.i64(3), createdBy: s.str(6)}
+	schema := s.list(2)
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("file has no schema")
+	}
+	root, _ := schema[0].(tstruct)
+	if int(root.i32(5)) != len(schema)-1 {
+		return nil, fmt.Errorf("nested columns are not supported; only flat files can be read")
+	}
+	for _, el := range schema[1:] {
+		e, _ := el.(tstruct)
+		col, err := decodeSchemaElement(e)
+		if err != nil {
+			return nil, err
+		}
+		m.columns = append(m.columns, col)
+	}
+
+	for _, g := range s.list(4) {
+		gs, _ := g.(tstruct)
+		rg := rowGroup{numRows: gs.i64(3), totalBytes: gs.i64(2)}
+		chunks := gs.list(1)
+		if len(chunks) != len(m.columns) {
+			return nil, fmt.Errorf("row group has %d column chunks for %d columns", len(chunks), len(m.columns))
+		}
+		for _, c := range chunks {
+			cs, _ := c.(tstruct)
+			if cs.str(1) != "" {
+				return nil, fmt.Errorf("column chunks in other files are not supported")
+			}
+			md := cs.child(3)
+			if md == nil {
+				return nil, fmt.Errorf("column chunk has no metadata")
+			}
+			chunk := columnChunk{
+				codec:            md.i32(4),
+				numValues:        md.i64(5),
+				uncompressedSize: md.i64(6),
+				compressedSize:   md.i64(7),
+				dataPageOffset:   md.i64(9),
+				dictPageOffset:   md.i64(11),
+			}
+			for _, e := range md.list(2) {
+				v, _ := e.(int64)
+				chunk.encodings = append(chunk.encodings, int32(v))
+			}
+			rg.chunks = append(rg.chunks, chunk)
+		}
+		m.rowGroups = append(m.rowGroups, rg)
+	}
+	return m, nil
+}
+
+// decodeSchemaElement decodes a leaf column, preferring its logical type to
+// its converted type
+func decodeSchemaElement(e tstruct) (Column, error) {
+	col := Column{
+		Name:       e.str(4),
+		Type:       Type(e.i32(1)),
+		TypeLength: int(e.i32(2)),
+		Required:   e.i32(3) == repRequired,
+		Scale:      int(e.i32(7)),
+		Precision:  int(e.i32(8)),
+	}
+	if e.i32(5) > 0 || !e.has(1) {
+		return col, fmt.Errorf("column %s is a group; nested columns are not supported", col.Name)
+	}
+	if e.i32(3) == repRepeated {
+		return col, fmt.Errorf("column %s is repeated; nested columns are not supported", col.Name)
+	}
+
+	if lt := e.child(10); lt != nil {
+		switch {
+		case lt.has(1), lt.has(4):
+			col.Logical = LogicalString
+		case lt.has(5):
+			d := lt.child(5)
+			col.Logical, col.Scale, col.Precision = LogicalDecimal, int(d.i32(1)), int(d.i32(2))
+		case lt.has(6):
+			col.Logical = LogicalDate
+		case lt.has(7), lt.has(8):
+			t := lt.child(7)
+			col.Logical = LogicalTime
+			if lt.has(8) {
+				t, col.Logical = lt.child(8), LogicalTimestamp
+			}
+			col.UTC = t.boolean(1)
+			unit := t.child(2)
+			switch {
+			case unit.has(2):
+				col.Unit = Micros
+			case unit.has(3):
+				col.Unit = Nanos
+			}
+		case lt.has(10):
+			i := lt.child(10)
+			col.Logical, col.BitWidth, col.Unsigned = LogicalInt, int(i.i64(1)), !i.boolean(2)
+		case lt.has(12):
+			col.Logical = LogicalJSON
+		case lt.has(14):
+			col.Logical = LogicalUUID
+		}
+		return col, nil
+	}
+
+	if !e.has(6) {
+		return col, nil
+	}
+	switch conv := e.i32(6); conv {
+	case convUTF8:
+		col.Logical = LogicalString
+	case convJSON:
+		col.Logical = LogicalJSON
+	case convDecimal:
+		col.Logical = LogicalDecimal
+	case convDate:
+		col.Logical = LogicalDate
+	case convTimeMillis, convTimeMicros:
+		col.Logical, col.UTC, col.Unit = LogicalTime, true, Millis
+		if conv == convTimeMicros {
+			col.Unit = Micros
+		}
+	case convTimestampMillis, convTimestampMicros:
+		col.Logical, col.UTC, col.Unit = LogicalTimestamp, true, Millis
+		if conv == convTimestampMicros {
+			col.Unit = Micros
+		}
+	case convInt8, convInt16, convInt32, convInt64:
+		col.Logical, col.BitWidth = LogicalInt, 8<<(conv-convInt8)
+	case convUint8, convUint16, convUint32, convUint64:
+		col.Logical, col.BitWidth, col.Unsigned = LogicalInt, 8<<(conv-convUint8), true
+	}
+	return col, nil
+}
+
+// decodePageHeader decodes a page header at the start of buf and returns its length
+func decodePageHeader(buf []byte) (*pageHeader, int, error) {
+	r := &thriftReader{buf: buf}
+	s, err := r.readStruct(0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid page header: %v", err)
+	}
+	h := &pageHeader{
+		typ:              s.i32(1),
+		uncompressedSize: s.i32(2),
+		compressedSize:   s.i32(3),
+		isCompressed:     true,
+	}
+	switch h.typ {
+	case pageData:
+		d := s.child(5)
+		h.numValues, h.encoding, h.defEncoding = d.i32(1), d.i32(2), d.i32(3)
+	case pageDictionary:
+		d := s.child(7)
+		h.numValues, h.encoding = d.i32(1), d.i32(2)
+	case pageDataV2:
+		d := s.child(8)
+		h.numValues, h.numNulls, h.encoding = d.i32(1), d.i32(2), d.i32(4)
+		h.defLength, h.repLength = d.i32(5), d.i32(6)
+		if d.has(7) {
+			h.isCompressed = d.boolean(7)
+		}
+	}
+	if h.compressedSize < 0 || h.uncompressedSize < 0 {
+		return nil, 0, fmt.Errorf("invalid page header: negative page size")
+	}
+	return h, r.pos, nil
+}
+
+// String describes a column for error messages
+func (c Column) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name + " " + c.Type.String())
+	switch c.Logical {
+	case LogicalString:
+		b.WriteString(" (STRING)")
+	case LogicalJSON:
+		b.WriteString(" (JSON)")
+	case LogicalDecimal:
+		fmt.Fprintf(&b, " (DECIMAL(%d,%d))", c.Precision, c.Scale)
+	case LogicalDate:
+		b.WriteString(" (DATE)")
+	case LogicalTime:
+		b.WriteString(" (TIME)")
+	case LogicalTimestamp:
+		b.WriteString(" (TIMESTAMP)")
+	case LogicalInt:
+		fmt.Fprintf(&b, " (INT(%d))", c.BitWidth)
+	case LogicalUUID:
+		b.WriteString(" (UUID)")
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+// Package parquet reads and writes flat Apache Parquet files: one level of
+// optional or required columns, which is what a table row maps to.
+//
+// A file is the magic "PAR1", the column chunks of each row group, then the
+// file metadata, its length and "PAR1" again. Each column chunk is a sequence
+// of pages: an optional dictionary page, then data pages holding the
+// definition levels (whether each value is null) and the non-null values.
+// Metadata and page headers are Thrift structs in the compact protocol.
+//
+// The writer produces uncompressed, PLAIN encoded v1 data pages. The reader
+// also takes dictionary encoding, v2 data pages and SNAPPY or GZIP
+// compression, which covers the defaults of Spark, Arrow and pandas. Nested
+// columns (lists, maps and structs) are not supported; the COPY subsystem
+// stores collections as JSON text instead.
+package parquet
+
+import "fmt"
+
+var magic = []byte("PAR1")
+
+// Type is a physical type
+type Type int32
+
+// Physical types
+const (
+	Boolean           Type = 0
+	Int32             Type = 1
+	Int64             Type = 2
+	Int96             Type = 3 // Legacy nanosecond timestamps, written by older Spark and Impala
+	Float             Type = 4
+	Double            Type = 5
+	ByteArray         Type = 6
+	FixedLenByteArray Type = 7
+)
+
+func (t Type) String() string {
+	switch t {
+	case Boolean:
+		return "BOOLEAN"
+	case Int32:
+		return "INT32"
+	case Int64:
+		return "INT64"
+	case Int96:
+		return "INT96"
+	case Float:
+		return "FLOAT"
+	case Double:
+		return "DOUBLE"
+	case ByteArray:
+		return "BYTE_ARRAY"
+	case FixedLenByteArray:
+		return "FIXED_LEN_BYTE_ARRAY"
+	}
+	return fmt.Sprintf("Type(%d)", int32(t))
+}
+
+// Logical says how the physical values of a column are to be read
+type Logical int
+
+// Logical types
+const (
+	LogicalNone      Logical = iota
+	LogicalString            // UTF-8 text in a BYTE_ARRAY
+	LogicalJSON              // JSON text in a BYTE_ARRAY
+	LogicalInt               // INT32 or INT64 of BitWidth bits
+	LogicalDecimal           // Unscaled two's complement integer with Scale and Precision
+	LogicalDate              // INT32 days since 1970-01-01
+	LogicalTime              // INT32 or INT64 time of day in Unit
+	LogicalTimestamp         // INT64 since the epoch in Unit
+	LogicalUUID              // FIXED_LEN_BYTE_ARRAY(16)
+)
+
+// TimeUnit is the unit of a time or timestamp column
+type TimeUnit int
+
+// Time units
+const (
+	Millis TimeUnit = iota
+	Micros
+	Nanos
+)
+
+// Column describes a leaf column
+type Column struct {
+	Name       string
+	Type       Type
+	TypeLength int // Bytes of a FIXED_LEN_BYTE_ARRAY value
+	Required   bool
+	Logical    Logical
+	BitWidth   int      // LogicalInt: 8, 16, 32 or 64
+	Unsigned   bool     // LogicalInt
+	Precision  int      // LogicalDecimal
+	Scale      int      // LogicalDecimal
+	Unit       TimeUnit // LogicalTime and LogicalTimestamp
+	UTC        bool     // LogicalTime and LogicalTimestamp: adjusted to UTC
+}
+
+// Values are passed to the writer and returned by the reader as:
+//
+//	BOOLEAN               bool
+//	INT32                 int32
+//	INT64                 int64
+//	INT96                 []byte (12 bytes)
+//	FLOAT                 float32
+//	DOUBLE                float64
+//	BYTE_ARRAY            []byte
+//	FIXED_LEN_BYTE_ARRAY  []byte
+//
+// and nil for null.
+
+// Encodings
+const (
+	encPlain         = 0
+	encPlainDict     = 2
+	encRLE           = 3
+	encBitPacked     = 4
+	encRLEDictionary = 8
+)
+
+// Compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+)
+
+// Page types
+const (
+	pageData       = 0
+	pageDictionary = 2
+	pageDataV2     = 3
+)
+
+// Repetition types
+const (
+	repRequired = 0
+	repOptional = 1
+	repRepeated = 2
+)
+
+// Converted types, the older form of logical types, written alongside them
+// for readers that predate logical types
+const (
+	convUTF8            = 0
+	convDecimal         = 5
+	convDate            = 6
+	convTimeMillis      = 7
+	convTimeMicros      = 8
+	convTimestampMillis = 9
+	convTimestampMicros = 10
+	convUint8           = 11
+	convUint16          = 12
+	convUint32          = 13
+	convUint64          = 14
+	convInt8            = 15
+	convInt16           = 16
+	convInt32           = 17
+	convInt64           = 18
+	convJSON            = 19
+)
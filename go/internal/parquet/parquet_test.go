@@ -0,0 +1,179 @@
+package parquet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	columns := []Column{
+		{Name: "id", Type: Int32, Required: true},
+		{Name: "name", Type: ByteArray, Logical: LogicalString},
+		{Name: "big", Type: Int64, Logical: LogicalInt, BitWidth: 64},
+		{Name: "ok", Type: Boolean},
+		{Name: "f", Type: Float},
+		{Name: "d", Type: Double},
+		{Name: "ts", Type: Int64, Logical: LogicalTimestamp, Unit: Millis, UTC: true},
+		{Name: "day", Type: Int32, Logical: LogicalDate},
+		{Name: "uid", Type: FixedLenByteArray, TypeLength: 16, Logical: LogicalUUID},
+		{Name: "price", Type: FixedLenByteArray, TypeLength: 16, Logical: LogicalDecimal, Precision: 38, Scale: 2},
+		{Name: "tags", Type: ByteArray, Logical: LogicalJSON},
+	}
+
+	var rows [][]interface{}
+	for i := 0; i < 25; i++ {
+		row := []interface{}{
+			int32(i), []byte("row"), int64(i) << 40, i%3 == 0, float32(i) / 2, float64(i) / 4,
+			int64(1700000000000 + i), int32(19000 + i), bytes.Repeat([]byte{byte(i)}, 16),
+			append(make([]byte, 15), byte(i)), []byte(`["a","b"]`),
+		}
+		// Every column but the required one is null in some rows
+		for c := 1; c < len(row); c++ {
+			if (i+c)%4 == 0 {
+				row[c] = nil
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, columns, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A bad row is rejected without affecting the rows around it
+	bad := append([]interface{}{}, rows[0]...)
+	bad[4] = "not a float"
+	if err := w.Write(bad); err == nil {
+		t.Fatal("row with a wrong type accepted")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Columns(), columns) {
+		t.Errorf("columns = %+v, want %+v", r.Columns(), columns)
+	}
+	if r.NumRows() != 25 || r.NumRowGroups() != 3 {
+		t.Fatalf("%d rows in %d row groups, want 25 in 3", r.NumRows(), r.NumRowGroups())
+	}
+	var got [][]interface{}
+	for g := 0; g < r.NumRowGroups(); g++ {
+		cols, err := r.ReadRowGroup(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range cols[0] {
+			row := make([]interface{}, len(cols))
+			for c := range cols {
+				row[c] = cols[c][i]
+			}
+			got = append(got, row)
+		}
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("rows read back differ:\n got %v\nwant %v", got, rows)
+	}
+}
+
+// TestReadDictionarySnappyV2 reads a chunk written the way Spark and Arrow
+// write one: a dictionary page, then a v2 data page of SNAPPY compressed
+// dictionary indexes. The bytes follow the Parquet format specification.
+func TestReadDictionarySnappyV2(t *testing.T) {
+	col := Column{Name: "s", Type: ByteArray, Logical: LogicalString}
+	file := append([]byte{}, magic...)
+
+	// Dictionary of "x" and "y", PLAIN encoded, stored as a snappy literal
+	dictOffset := int64(len(file))
+	dict := []byte{1, 0, 0, 0, 'x', 1, 0, 0, 0, 'y'}
+	dictPage := append([]byte{byte(len(dict)), byte(len(dict)-1) << 2}, dict...)
+	h := &thriftWriter{}
+	h.beginStruct()
+	h.i32Field(1, pageDictionary)
+	h.i32Field(2, int32(len(dict)))
+	h.i32Field(3, int32(len(dictPage)))
+	h.structField(7)
+	h.i32Field(1, 2)
+	h.i32Field(2, encPlainDict)
+	h.endStruct()
+	h.endStruct()
+	file = append(append(file, h.buf...), dictPage...)
+
+	// Four values, the second null: definition levels 1,0,1,1 bit-packed,
+	// then indexes 1,0,1 of bit width 1, the indexes compressed
+	dataOffset := int64(len(file))
+	levels := []byte{0x03, 0x0d}
+	indexes := []byte{0x01, 0x03, 0x05}
+	compressed := append([]byte{byte(len(indexes)), byte(len(indexes)-1) << 2}, indexes...)
+	h = &thriftWriter{}
+	h.beginStruct()
+	h.i32Field(1, pageDataV2)
+	h.i32Field(2, int32(len(levels)+len(indexes)))
+	h.i32Field(3, int32(len(levels)+len(compressed)))
+	h.structField(8)
+	h.i32Field(1, 4)
+	h.i32Field(2, 1)
+	h.i32Field(3, 4)
+	h.i32Field(4, encRLEDictionary)
+	h.i32Field(5, int32(len(levels)))
+	h.i32Field(6, 0)
+	h.endStruct()
+	h.endStruct()
+	file = append(append(append(file, h.buf...), levels...), compressed...)
+
+	size := int64(len(file)) - dictOffset
+	footer := encodeFileMeta(&fileMeta{
+		columns: []Column{col},
+		numRows: 4,
+		rowGroups: []rowGroup{{numRows: 4, totalBytes: size, chunks: []columnChunk{{
+			codec:            codecSnappy,
+			encodings:        []int32{encPlainDict, encRLEDictionary, encRLE},
+			numValues:        4,
+			uncompressedSize: size,
+			compressedSize:   size,
+			dataPageOffset:   dataOffset,
+			dictPageOffset:   dictOffset,
+		}}}},
+	})
+	file = append(file, footer...)
+	file = append(file, byte(len(footer)), byte(len(footer)>>8), 0, 0)
+	file = append(file, magic...)
+
+	r, err := NewReader(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols, err := r.ReadRowGroup(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{[]byte("y"), nil, []byte("x"), []byte("y")}
+	if !reflect.DeepEqual(cols[0], want) {
+		t.Errorf("values = %q, want %q", cols[0], want)
+	}
+}
+
+func TestSnappyDecode(t *testing.T) {
+	// "abc" as a literal, then a copy of 9 bytes from 3 back, which overlaps
+	// the bytes it produces
+	got, err := snappyDecode([]byte{12, 0x08, 'a', 'b', 'c', 0x15, 0x03})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "abcabcabcabc" {
+		t.Errorf("snappyDecode = %q", got)
+	}
+	if _, err := snappyDecode([]byte{12, 0x08, 'a', 'b', 'c', 0x15, 0x09}); err == nil {
+		t.Error("copy from before the start accepted")
+	}
+}
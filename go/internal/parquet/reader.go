@@ -0,0 +1,257 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// maxFooterLength bounds the file metadata read into memory
+const maxFooterLength = 64 << 20
+
+// Reader reads the row groups of a flat Parquet file
+type Reader struct {
+	r    io.ReaderAt
+	size int64
+	meta *fileMeta
+}
+
+// NewReader reads the metadata of a Parquet file of size bytes
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < 12 {
+		return nil, fmt.Errorf("not a parquet file: too short")
+	}
+	tail := make([]byte, 8)
+	if _, err := r.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	if string(tail[4:]) != string(magic) {
+		return nil, fmt.Errorf("not a parquet file: no PAR1 footer")
+	}
+	length := int64(binary.LittleEndian.Uint32(tail))
+	if length <= 0 || length > maxFooterLength || length > size-12 {
+		return nil, fmt.Errorf("invalid parquet footer length %d", length)
+	}
+	footer := make([]byte, length)
+	if _, err := r.ReadAt(footer, size-8-length); err != nil {
+		return nil, err
+	}
+	meta, err := decodeFileMeta(footer)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, size: size, meta: meta}, nil
+}
+
+// Columns returns the file's columns
+func (pr *Reader) Columns() []Column {
+	return pr.meta.columns
+}
+
+// NumRows returns the number of rows in the file
+func (pr *Reader) NumRows() int64 {
+	return pr.meta.numRows
+}
+
+// NumRowGroups returns the number of row groups in the file
+func (pr *Reader) NumRowGroups() int {
+	return len(pr.meta.rowGroups)
+}
+
+// ReadRowGroup returns the values of row group i, one slice per column
+func (pr *Reader) ReadRowGroup(i int) ([][]interface{}, error) {
+	rg := pr.meta.rowGroups[i]
+	columns := make([][]interface{}, len(pr.meta.columns))
+	for c, chunk := range rg.chunks {
+		values, err := pr.readChunk(pr.meta.columns[c], chunk, rg.numRows)
+		if err != nil {
+			return nil, fmt.Errorf("row group %d, column %s: %v", i, pr.meta.columns[c].Name, err)
+		}
+		columns[c] = values
+	}
+	return columns, nil
+}
+
+// readChunk decodes every page of a column chunk
+func (pr *Reader) readChunk(col Column, chunk columnChunk, numRows int64) ([]interface{}, error) {
+	start := chunk.start()
+	if start < 4 || chunk.compressedSize <= 0 || start+chunk.compressedSize > pr.size || chunk.numValues != numRows {
+		return nil, fmt.Errorf("invalid column chunk")
+	}
+	data := make([]byte, chunk.compressedSize)
+	if _, err := pr.r.ReadAt(data, start); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, 0, numRows)
+	var dict []interface{}
+	for pos := 0; len(values) < int(numRows); {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("chunk ends after %d of %d values", len(values), numRows)
+		}
+		h, n, err := decodePageHeader(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+		if int(h.compressedSize) > len(data)-pos {
+			return nil, errTruncated
+		}
+		page := data[pos : pos+int(h.compressedSize)]
+		pos += int(h.compressedSize)
+
+		switch h.typ {
+		case pageDictionary:
+			body, err := decompress(chunk.codec, page, int(h.uncompressedSize))
+			if err != nil {
+				return nil, err
+			}
+			if int64(h.numValues) > int64(len(body))+1 {
+				return nil, errTruncated
+			}
+			if dict, err = decodePlain(body, col, int(h.numValues)); err != nil {
+				return nil, fmt.Errorf("dictionary page: %v", err)
+			}
+		case pageData, pageDataV2:
+			if h.numValues < 0 || int64(h.numValues) > numRows-int64(len(values)) {
+				return nil, fmt.Errorf("page has more values than the chunk")
+			}
+			pageValues, err := decodeDataPage(h, page, chunk.codec, col, dict)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, pageValues...)
+		default:
+			// Index pages and unknown page types are skipped
+		}
+	}
+	return values, nil
+}
+
+// decodeDataPage decodes a v1 or v2 data page into its values, nil for null
+func decodeDataPage(h *pageHeader, page []byte, codec int32, col Column, dict []interface{}) ([]interface{}, error) {
+	n := int(h.numValues)
+	var levels, body []byte
+
+	if h.typ == pageDataV2 {
+		levelBytes := int(h.repLength) + int(h.defLength)
+		if h.repLength < 0 || h.defLength < 0 || levelBytes > len(page) {
+			return nil, errTruncated
+		}
+		levels = page[h.repLength:levelBytes]
+		body = page[levelBytes:]
+		if h.isCompressed {
+			var err error
+			if body, err = decompress(codec, body, int(h.uncompressedSize)-levelBytes); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var err error
+		if body, err = decompress(codec, page, int(h.uncompressedSize)); err != nil {
+			return nil, err
+		}
+		if !col.Required {
+			if h.defEncoding != encRLE {
+				return nil, fmt.Errorf("definition level encoding %d is not supported", h.defEncoding)
+			}
+			if len(body) < 4 {
+				return nil, errTruncated
+			}
+			size := int(binary.LittleEndian.Uint32(body))
+			if size < 0 || size > len(body)-4 {
+				return nil, errTruncated
+			}
+			levels = body[4 : 4+size]
+			body = body[4+size:]
+		}
+	}
+
+	// Definition level 1 is a value, 0 a null
+	defined := n
+	var defs []int32
+	if !col.Required {
+		var err error
+		if defs, err = decodeHybrid(levels, 1, n); err != nil {
+			return nil, fmt.Errorf("definition levels: %v", err)
+		}
+		defined = 0
+		for _, d := range defs {
+			defined += int(d)
+		}
+	}
+
+	var present []interface{}
+	var err error
+	switch h.encoding {
+	case encPlain:
+		present, err = decodePlain(body, col, defined)
+	case encPlainDict, encRLEDictionary:
+		present, err = decodeDictionary(body, dict, defined)
+	case encRLE:
+		if col.Type != Boolean {
+			return nil, fmt.Errorf("RLE encoding of %s values is not supported", col.Type)
+		}
+		present, err = decodeRLEBooleans(body, defined)
+	default:
+		return nil, fmt.Errorf("encoding %d is not supported; write the file with PLAIN or dictionary encoding", h.encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if col.Required {
+		return present, nil
+	}
+
+	values := make([]interface{}, n)
+	next := 0
+	for i, d := range defs {
+		if d != 0 {
+			values[i] = present[next]
+			next++
+		}
+	}
+	return values, nil
+}
+
+// decodeDictionary decodes n dictionary indexes: their bit width in one byte,
+// then the indexes in the hybrid encoding
+func decodeDictionary(body []byte, dict []interface{}, n int) ([]interface{}, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	if dict == nil {
+		return nil, fmt.Errorf("dictionary encoded page without a dictionary")
+	}
+	if len(body) < 1 {
+		return nil, errTruncated
+	}
+	indexes, err := decodeHybrid(body[1:], int(body[0]), n)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, n)
+	for i, idx := range indexes {
+		if idx < 0 || int(idx) >= len(dict) {
+			return nil, fmt.Errorf("dictionary index %d out of range", idx)
+		}
+		values[i] = dict[idx]
+	}
+	return values, nil
+}
+
+// decodeRLEBooleans decodes booleans in the hybrid encoding, after a 4-byte length
+func decodeRLEBooleans(body []byte, n int) ([]interface{}, error) {
+	if len(body) < 4 {
+		return nil, errTruncated
+	}
+	bits, err := decodeHybrid(body[4:], 1, n)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, n)
+	for i, b := range bits {
+		values[i] = b != 0
+	}
+	return values, nil
+}
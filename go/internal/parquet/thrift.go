@@ -0,0 +1,333 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Thrift compact protocol
+//
+// Each field is a header byte holding the field id as a delta from the
+// previous field's (or, when the delta does not fit in 4 bits, the type alone
+// followed by the id as a zigzag varint) and the type in the low 4 bits.
+// Integers are zigzag varints, binaries are a varint length and the bytes,
+// and booleans are carried in the field type itself. A struct ends with a
+// zero byte.
+
+// Compact protocol types
+const (
+	ctStop   = 0
+	ctTrue   = 1
+	ctFalse  = 2
+	ctByte   = 3
+	ctI16    = 4
+	ctI32    = 5
+	ctI64    = 6
+	ctDouble = 7
+	ctBinary = 8
+	ctList   = 9
+	ctSet    = 10
+	ctMap    = 11
+	ctStruct = 12
+)
+
+// thriftWriter encodes structs in the compact protocol
+type thriftWriter struct {
+	buf    []byte
+	lastID []int16 // Previous field id of each open struct
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &w.lastID[len(w.lastID)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.zigzag(int64(id))
+	}
+	*last = id
+}
+
+// beginStruct opens a top-level struct or a list element
+func (w *thriftWriter) beginStruct() {
+	w.lastID = append(w.lastID, 0)
+}
+
+// endStruct closes the innermost struct
+func (w *thriftWriter) endStruct() {
+	w.buf = append(w.buf, ctStop)
+	w.lastID = w.lastID[:len(w.lastID)-1]
+}
+
+// structField opens a struct-valued field; close it with endStruct
+func (w *thriftWriter) structField(id int16) {
+	w.fieldHeader(id, ctStruct)
+	w.beginStruct()
+}
+
+func (w *thriftWriter) i32Field(id int16, v int32) {
+	w.fieldHeader(id, ctI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64Field(id int16, v int64) {
+	w.fieldHeader(id, ctI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) byteField(id int16, v int8) {
+	w.fieldHeader(id, ctByte)
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *thriftWriter) boolField(id int16, v bool) {
+	if v {
+		w.fieldHeader(id, ctTrue)
+	} else {
+		w.fieldHeader(id, ctFalse)
+	}
+}
+
+func (w *thriftWriter) stringField(id int16, v string) {
+	w.fieldHeader(id, ctBinary)
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// emptyStructField writes a struct with no fields, as the logical type
+// unions use for most of their members
+func (w *thriftWriter) emptyStructField(id int16) {
+	w.structField(id)
+	w.endStruct()
+}
+
+// listField opens a list field of n elements; write the elements with
+// i32, str or beginStruct/endStruct
+func (w *thriftWriter) listField(id int16, elemType byte, n int) {
+	w.fieldHeader(id, ctList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|elemType)
+	} else {
+		w.buf = append(w.buf, 0xf0|elemType)
+		w.varint(uint64(n))
+	}
+}
+
+func (w *thriftWriter) i32(v int32) {
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) str(v string) {
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// tstruct is a decoded struct: field values by id. Integers of every width
+// are int64, binaries []byte, lists []interface{} and structs tstruct.
+type tstruct map[int16]interface{}
+
+func (s tstruct) i64(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s tstruct) i32(id int16) int32 {
+	return int32(s.i64(id))
+}
+
+func (s tstruct) str(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s tstruct) boolean(id int16) bool {
+	v, _ := s[id].(bool)
+	return v
+}
+
+func (s tstruct) has(id int16) bool {
+	_, ok := s[id]
+	return ok
+}
+
+func (s tstruct) child(id int16) tstruct {
+	v, _ := s[id].(tstruct)
+	return v
+}
+
+func (s tstruct) list(id int16) []interface{} {
+	v, _ := s[id].([]interface{})
+	return v
+}
+
+// Limits that stop a corrupt file from making the decoder allocate without bound
+const (
+	maxThriftDepth  = 64
+	maxThriftLength = 1 << 28
+)
+
+var errThriftTruncated = errors.New("truncated thrift struct")
+
+// thriftReader decodes compact protocol structs
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errThriftTruncated
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, errThriftTruncated
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *thriftReader) zigzag() (int64, error) {
+	v, err := r.varint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (r *thriftReader) length() (int, error) {
+	n, err := r.varint()
+	if err != nil {
+		return 0, err
+	}
+	if n > maxThriftLength || int(n) > len(r.buf)-r.pos {
+		return 0, errThriftTruncated
+	}
+	return int(n), nil
+}
+
+// readStruct decodes a struct up to and including its stop byte
+func (r *thriftReader) readStruct(depth int) (tstruct, error) {
+	if depth > maxThriftDepth {
+		return nil, fmt.Errorf("thrift struct nested too deeply")
+	}
+	s := tstruct{}
+	var lastID int16
+	for {
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if header == ctStop {
+			return s, nil
+		}
+		typ := header & 0x0f
+		id := lastID + int16(header>>4)
+		if header>>4 == 0 {
+			v, err := r.zigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		lastID = id
+
+		switch typ {
+		case ctTrue:
+			s[id] = true
+		case ctFalse:
+			s[id] = false
+		default:
+			v, err := r.readValue(typ, depth)
+			if err != nil {
+				return nil, err
+			}
+			s[id] = v
+		}
+	}
+}
+
+// readValue decodes a value of a type other than a field boolean
+func (r *thriftReader) readValue(typ byte, depth int) (interface{}, error) {
+	switch typ {
+	case ctTrue, ctFalse:
+		// A boolean list element is a byte of its own
+		b, err := r.byte()
+		return b == ctTrue, err
+	case ctByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case ctI16, ctI32, ctI64:
+		return r.zigzag()
+	case ctDouble:
+		if len(r.buf)-r.pos < 8 {
+			return nil, errThriftTruncated
+		}
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.buf[r.pos:]))
+		r.pos += 8
+		return v, nil
+	case ctBinary:
+		n, err := r.length()
+		if err != nil {
+			return nil, err
+		}
+		v := r.buf[r.pos : r.pos+n]
+		r.pos += n
+		return v, nil
+	case ctList, ctSet:
+		header, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		n := int(header >> 4)
+		if n == 15 {
+			if n, err = r.length(); err != nil {
+				return nil, err
+			}
+		}
+		elemType := header & 0x0f
+		list := make([]interface{}, 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			v, err := r.readValue(elemType, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case ctMap:
+		n, err := r.length()
+		if err != nil || n == 0 {
+			return nil, err
+		}
+		types, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		// Maps are read past and dropped; no field the reader uses is a map
+		for i := 0; i < n; i++ {
+			if _, err := r.readValue(types>>4, depth+1); err != nil {
+				return nil, err
+			}
+			if _, err := r.readValue(types&0x0f, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case ctStruct:
+		return r.readStruct(depth + 1)
+	}
+	return nil, fmt.Errorf("unknown thrift type %d", typ)
+}
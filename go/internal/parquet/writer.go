@@ -0,0 +1,216 @@
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// DefaultRowGroupRows is the number of rows buffered before a row group
+	// is written, when the caller does not choose
+	DefaultRowGroupRows = 10000
+
+	// maxRowGroupBytes ends a row group early when its values grow past it,
+	// so wide rows do not hold a whole row group of blobs in memory
+	maxRowGroupBytes = 64 << 20
+
+	createdBy = "cqlai-node"
+)
+
+// Writer writes rows to a Parquet file. Rows are buffered and written a row
+// group at a time, one uncompressed PLAIN page per column; Close writes the
+// buffered rows and the file metadata.
+type Writer struct {
+	w            io.Writer
+	pos          int64
+	columns      []Column
+	buffers      []columnBuffer
+	rows         int
+	rowGroupRows int
+	meta         fileMeta
+	err          error
+}
+
+// columnBuffer holds the values of one column of the current row group
+type columnBuffer struct {
+	defined []bool
+	plain   []byte
+	bools   []bool // BOOLEAN values, bit-packed when the page is written
+	mark    [3]int // Lengths of the above before the row being added
+}
+
+// NewWriter starts a Parquet file with the given columns on w
+func NewWriter(w io.Writer, columns []Column, rowGroupRows int) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("a parquet file needs at least one column")
+	}
+	seen := make(map[string]bool)
+	for _, col := range columns {
+		if col.Name == "" || seen[col.Name] {
+			return nil, fmt.Errorf("column names must be unique and not empty: %q", col.Name)
+		}
+		seen[col.Name] = true
+		if col.Type == FixedLenByteArray && col.TypeLength <= 0 {
+			return nil, fmt.Errorf("column %s: FIXED_LEN_BYTE_ARRAY needs a length", col.Name)
+		}
+	}
+	if rowGroupRows <= 0 {
+		rowGroupRows = DefaultRowGroupRows
+	}
+
+	pw := &Writer{
+		w:            w,
+		columns:      columns,
+		buffers:      make([]columnBuffer, len(columns)),
+		rowGroupRows: rowGroupRows,
+		meta:         fileMeta{columns: columns, createdBy: createdBy},
+	}
+	if err := pw.write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *Writer) write(p []byte) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	n, err := pw.w.Write(p)
+	pw.pos += int64(n)
+	pw.err = err
+	return err
+}
+
+// Write adds a row, one value per column in column order. A row with a value
+// of the wrong type is rejected whole and the file is unaffected.
+func (pw *Writer) Write(row []interface{}) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(row), len(pw.columns))
+	}
+
+	// On error the columns are cut back to where the row began
+	for i := range pw.buffers {
+		buf := &pw.buffers[i]
+		buf.mark = [3]int{len(buf.defined), len(buf.plain), len(buf.bools)}
+	}
+	rollback := func() {
+		for i := range pw.buffers {
+			buf := &pw.buffers[i]
+			buf.defined, buf.plain, buf.bools = buf.defined[:buf.mark[0]], buf.plain[:buf.mark[1]], buf.bools[:buf.mark[2]]
+		}
+	}
+
+	size := 0
+	for i, v := range row {
+		col := pw.columns[i]
+		buf := &pw.buffers[i]
+		switch {
+		case v == nil && col.Required:
+			rollback()
+			return fmt.Errorf("column %s: null in a required column", col.Name)
+		case v == nil:
+		case col.Type == Boolean:
+			b, ok := v.(bool)
+			if !ok {
+				rollback()
+				return fmt.Errorf("column %s: want bool, got %T", col.Name, v)
+			}
+			buf.bools = append(buf.bools, b)
+		default:
+			plain, err := appendPlain(buf.plain, col, v)
+			if err != nil {
+				rollback()
+				return err
+			}
+			buf.plain = plain
+		}
+		buf.defined = append(buf.defined, v != nil)
+		size += len(buf.plain)
+	}
+
+	pw.rows++
+	if pw.rows >= pw.rowGroupRows || size >= maxRowGroupBytes {
+		return pw.Flush()
+	}
+	return nil
+}
+
+// Flush writes the buffered rows as a row group
+func (pw *Writer) Flush() error {
+	if pw.err != nil || pw.rows == 0 {
+		return pw.err
+	}
+
+	start := pw.pos
+	rg := rowGroup{numRows: int64(pw.rows)}
+	for i, col := range pw.columns {
+		buf := &pw.buffers[i]
+		var page []byte
+		if !col.Required {
+			levels := appendLevels(nil, buf.defined)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+			page = append(page, levels...)
+		}
+		if col.Type == Boolean {
+			packed := make([]byte, (len(buf.bools)+7)/8)
+			for k, b := range buf.bools {
+				if b {
+					packed[k/8] |= 1 << (k % 8)
+				}
+			}
+			page = append(page, packed...)
+		} else {
+			page = append(page, buf.plain...)
+		}
+
+		offset := pw.pos
+		header := encodeDataPageHeader(len(page), pw.rows)
+		if err := pw.write(header); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		size := int64(len(header) + len(page))
+		rg.chunks = append(rg.chunks, columnChunk{
+			codec:            codecUncompressed,
+			encodings:        []int32{encPlain, encRLE},
+			numValues:        int64(pw.rows),
+			uncompressedSize: size,
+			compressedSize:   size,
+			dataPageOffset:   offset,
+		})
+		*buf = columnBuffer{defined: buf.defined[:0], plain: buf.plain[:0], bools: buf.bools[:0]}
+	}
+	rg.totalBytes = pw.pos - start
+
+	pw.meta.rowGroups = append(pw.meta.rowGroups, rg)
+	pw.meta.numRows += int64(pw.rows)
+	pw.rows = 0
+	return nil
+}
+
+// Close writes the remaining rows and the file metadata. It does not close
+// the underlying writer.
+func (pw *Writer) Close() error {
+	if err := pw.Flush(); err != nil {
+		return err
+	}
+	footer := encodeFileMeta(&pw.meta)
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	footer = append(footer, magic...)
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	pw.err = fmt.Errorf("parquet writer is closed")
+	return nil
+}
+
+// Rows returns the number of rows written so far, buffered ones included
+func (pw *Writer) Rows() int64 {
+	return pw.meta.numRows + int64(pw.rows)
+}
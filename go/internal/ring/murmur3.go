@@ -0,0 +1,112 @@
+// Package ring computes where Cassandra stores a partition: the Murmur3
+// token of a partition key, and the replicas a keyspace's replication
+// strategy places it on, from the nodes' tokens.
+package ring
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Murmur3 constants of MurmurHash3_x64_128
+const (
+	murmurC1 uint64 = 0x87c37b91114253d5
+	murmurC2 uint64 = 0x4cf5ad432745937f
+)
+
+// Murmur3Token returns the token Murmur3Partitioner assigns to a serialized
+// partition key: the first half of its MurmurHash3_x64_128 with seed 0.
+// Cassandra reads the tail bytes as signed, which changes the hash of keys
+// with tail bytes of 0x80 and above, and never uses the minimum token.
+func Murmur3Token(key []byte) int64 {
+	var h1, h2 uint64
+	nBlocks := len(key) / 16
+	for i := 0; i < nBlocks; i++ {
+		k1 := binary.LittleEndian.Uint64(key[i*16:])
+		k2 := binary.LittleEndian.Uint64(key[i*16+8:])
+
+		h1 ^= mixK1(k1)
+		h1 = rotl(h1, 27) + h2
+		h1 = h1*5 + 0x52dce729
+
+		h2 ^= mixK2(k2)
+		h2 = rotl(h2, 31) + h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	tail := key[nBlocks*16:]
+	var k1, k2 uint64
+	for i := len(tail) - 1; i >= 8; i-- {
+		k2 ^= signedByte(tail[i]) << (8 * (i - 8))
+	}
+	for i := min(len(tail), 8) - 1; i >= 0; i-- {
+		k1 ^= signedByte(tail[i]) << (8 * i)
+	}
+	if len(tail) > 8 {
+		h2 ^= mixK2(k2)
+	}
+	if len(tail) > 0 {
+		h1 ^= mixK1(k1)
+	}
+
+	h1 ^= uint64(len(key))
+	h2 ^= uint64(len(key))
+	h1 += h2
+	h2 += h1
+	h1 = fmix(h1)
+	h2 = fmix(h2)
+	h1 += h2
+
+	token := int64(h1)
+	if token == math.MinInt64 {
+		return math.MaxInt64
+	}
+	return token
+}
+
+// PartitionKey serializes the values of a partition key's columns, each
+// already encoded in the native protocol format, as Cassandra hashes them:
+// a single column as is, several as a composite of length-prefixed
+// components each followed by a zero byte
+func PartitionKey(components [][]byte) []byte {
+	if len(components) == 1 {
+		return components[0]
+	}
+	var key []byte
+	for _, c := range components {
+		key = binary.BigEndian.AppendUint16(key, uint16(len(c)))
+		key = append(key, c...)
+		key = append(key, 0)
+	}
+	return key
+}
+
+func mixK1(k uint64) uint64 {
+	k *= murmurC1
+	k = rotl(k, 31)
+	return k * murmurC2
+}
+
+func mixK2(k uint64) uint64 {
+	k *= murmurC2
+	k = rotl(k, 33)
+	return k * murmurC1
+}
+
+func fmix(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+func rotl(x uint64, r uint) uint64 {
+	return x<<r | x>>(64-r)
+}
+
+// signedByte widens a byte as Java does, sign-extending it
+func signedByte(b byte) uint64 {
+	return uint64(int64(int8(b)))
+}
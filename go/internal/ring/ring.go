@@ -0,0 +1,248 @@
+package ring
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Node is a node of the ring with the tokens it owns
+type Node struct {
+	Address    string
+	HostID     string
+	DataCenter string
+	Rack       string
+	Tokens     []int64
+}
+
+// Ring is the nodes of a cluster ordered by token. Each token owns the range
+// from the previous token, exclusive, to itself, inclusive; the first token
+// also owns the range that wraps around from the last.
+type Ring struct {
+	tokens []int64
+	owners []*Node        // owners[i] owns tokens[i]
+	racks  map[string]int // Racks per datacenter
+	nodes  map[string]int // Nodes per datacenter
+}
+
+// New builds the ring of the nodes. Nodes without tokens (joining, or
+// listed without them) own nothing.
+func New(nodes []Node) *Ring {
+	r := &Ring{racks: make(map[string]int), nodes: make(map[string]int)}
+	type entry struct {
+		token int64
+		node  *Node
+	}
+	var entries []entry
+	racks := make(map[string]map[string]bool)
+	for i := range nodes {
+		node := &nodes[i]
+		for _, t := range node.Tokens {
+			entries = append(entries, entry{t, node})
+		}
+		if len(node.Tokens) > 0 {
+			if racks[node.DataCenter] == nil {
+				racks[node.DataCenter] = make(map[string]bool)
+			}
+			racks[node.DataCenter][node.Rack] = true
+			r.nodes[node.DataCenter]++
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].token < entries[j].token })
+	for _, e := range entries {
+		r.tokens = append(r.tokens, e.token)
+		r.owners = append(r.owners, e.node)
+	}
+	for dc, set := range racks {
+		r.racks[dc] = len(set)
+	}
+	return r
+}
+
+// Empty reports whether no node owns a token
+func (r *Ring) Empty() bool {
+	return len(r.tokens) == 0
+}
+
+// index returns the position of the token that owns t
+func (r *Ring) index(t int64) int {
+	i := sort.Search(len(r.tokens), func(i int) bool { return r.tokens[i] >= t })
+	if i == len(r.tokens) {
+		return 0
+	}
+	return i
+}
+
+// Owner returns the node whose primary range contains t, and the range's
+// bounds: (start, end]
+func (r *Ring) Owner(t int64) (Node, int64, int64) {
+	if r.Empty() {
+		return Node{}, 0, 0
+	}
+	i := r.index(t)
+	prev := r.tokens[(i-1+len(r.tokens))%len(r.tokens)]
+	return *r.owners[i], prev, r.tokens[i]
+}
+
+// Range is a token range, (Start, End], with the node whose primary range
+// it is
+type Range struct {
+	Start int64
+	End   int64
+	Owner Node
+}
+
+// Ranges returns the primary ranges of the ring in token order. The first
+// range wraps around from the last token.
+func (r *Ring) Ranges() []Range {
+	ranges := make([]Range, len(r.tokens))
+	for i, t := range r.tokens {
+		ranges[i] = Range{Start: r.tokens[(i-1+len(r.tokens))%len(r.tokens)], End: t, Owner: *r.owners[i]}
+	}
+	return ranges
+}
+
+// Fraction returns the share of the Murmur3 token space the range covers.
+// A ring of a single token has one range, covering all of it.
+func (rg Range) Fraction() float64 {
+	if rg.Start == rg.End {
+		return 1
+	}
+	return float64(uint64(rg.End-rg.Start)) / math.Exp2(64)
+}
+
+// Strategy is a keyspace's replication
+type Strategy struct {
+	Class             string         // Short class name, e.g. NetworkTopologyStrategy
+	ReplicationFactor int            // SimpleStrategy
+	DataCenters       map[string]int // NetworkTopologyStrategy, replicas per datacenter
+}
+
+// ParseStrategy reads the replication of a keyspace as the driver reports
+// it: the strategy class and its options. A Cassandra 4 factor with
+// transient replicas ("3/1") counts every replica.
+func ParseStrategy(class string, options map[string]interface{}) (Strategy, error) {
+	s := Strategy{Class: class[strings.LastIndex(class, ".")+1:], DataCenters: make(map[string]int)}
+	for key, value := range options {
+		if key == "class" {
+			continue
+		}
+		text := fmt.Sprint(value)
+		if slash := strings.IndexByte(text, '/'); slash >= 0 {
+			text = text[:slash]
+		}
+		rf, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return s, fmt.Errorf("invalid replication factor %q for %s", fmt.Sprint(value), key)
+		}
+		if key == "replication_factor" {
+			s.ReplicationFactor = rf
+		} else {
+			s.DataCenters[key] = rf
+		}
+	}
+	return s, nil
+}
+
+// Replicas returns the nodes that hold t under the strategy, the primary
+// owner first, as Cassandra places them. NetworkTopologyStrategy spreads
+// each datacenter's replicas over its racks before it places a second
+// replica on a rack. LocalStrategy and unknown strategies return nil.
+func (r *Ring) Replicas(t int64, s Strategy) []Node {
+	if r.Empty() {
+		return nil
+	}
+	switch s.Class {
+	case "SimpleStrategy":
+		return r.walk(t, s.ReplicationFactor)
+	case "NetworkTopologyStrategy":
+		return r.networkTopology(t, s.DataCenters)
+	case "EverywhereStrategy":
+		return r.walk(t, len(r.tokens))
+	}
+	return nil
+}
+
+// walk returns the first n distinct nodes of the ring from the owner of t
+func (r *Ring) walk(t int64, n int) []Node {
+	out := []Node{}
+	seen := make(map[*Node]bool)
+	start := r.index(t)
+	for i := 0; i < len(r.tokens) && len(out) < n; i++ {
+		node := r.owners[(start+i)%len(r.tokens)]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		out = append(out, *node)
+	}
+	return out
+}
+
+// networkTopology places replicas per datacenter: walking the ring, a node
+// on a rack the datacenter has not used yet is taken; one on a used rack is
+// set aside, and taken once every rack of the datacenter has a replica
+func (r *Ring) networkTopology(t int64, dcs map[string]int) []Node {
+	taken := make(map[string]int)
+	racksSeen := make(map[string]map[string]bool)
+	skipped := make(map[string][]*Node)
+	wanted := make(map[string]int, len(dcs))
+	var order []*Node
+	remaining := 0
+	for dc, rf := range dcs {
+		// A datacenter cannot hold more replicas than it has nodes
+		rf = min(rf, r.nodes[dc])
+		wanted[dc] = rf
+		remaining += rf
+		racksSeen[dc] = make(map[string]bool)
+	}
+
+	seen := make(map[*Node]bool)
+	start := r.index(t)
+	for n := 0; n < len(r.tokens) && remaining > 0; n++ {
+		node := r.owners[(start+n)%len(r.tokens)]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		dc := node.DataCenter
+		rf, ok := wanted[dc]
+		if !ok || taken[dc] >= rf {
+			continue
+		}
+		if len(racksSeen[dc]) == r.racks[dc] {
+			order = append(order, node)
+			taken[dc]++
+			remaining--
+			continue
+		}
+		if racksSeen[dc][node.Rack] {
+			skipped[dc] = append(skipped[dc], node)
+			continue
+		}
+		order = append(order, node)
+		taken[dc]++
+		remaining--
+		racksSeen[dc][node.Rack] = true
+		if len(racksSeen[dc]) == r.racks[dc] {
+			// Every rack has a replica; the nodes set aside come next
+			for _, s := range skipped[dc] {
+				if taken[dc] >= rf {
+					break
+				}
+				order = append(order, s)
+				taken[dc]++
+				remaining--
+			}
+			skipped[dc] = nil
+		}
+	}
+
+	out := make([]Node, len(order))
+	for i, node := range order {
+		out[i] = *node
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package ring
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestMurmur3Token(t *testing.T) {
+	int1 := binary.BigEndian.AppendUint32(nil, 1)
+	bigint1 := binary.BigEndian.AppendUint64(nil, 1)
+	tests := []struct {
+		name string
+		key  []byte
+		want int64
+	}{
+		{"empty", []byte{}, 0},
+		{"text a", []byte("a"), -8839064797231613815},
+		{"text hello", []byte("hello"), -3758069500696749310},
+		{"two blocks", []byte("123456789012345678"), -1519150012378291793},
+		{"int 1", int1, -4069959284402364209},
+		{"bigint 1", bigint1, 6292367497774912474},
+		{"composite", PartitionKey([][]byte{int1, []byte("a")}), 6516349416904725244},
+	}
+	for _, tt := range tests {
+		if got := Murmur3Token(tt.key); got != tt.want {
+			t.Errorf("%s: token %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	single := []byte{1, 2}
+	if got := PartitionKey([][]byte{single}); string(got) != string(single) {
+		t.Errorf("single component encoded as %x", got)
+	}
+	got := PartitionKey([][]byte{{7}, []byte("ab")})
+	want := []byte{0, 1, 7, 0, 0, 2, 'a', 'b', 0}
+	if string(got) != string(want) {
+		t.Errorf("composite %x, want %x", got, want)
+	}
+}
+
+func addresses(nodes []Node) []string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = n.Address
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSimpleStrategy(t *testing.T) {
+	r := New([]Node{
+		{Address: "n1", Tokens: []int64{-100, 200}},
+		{Address: "n2", Tokens: []int64{0}},
+		{Address: "n3", Tokens: []int64{100}},
+	})
+	s := Strategy{Class: "SimpleStrategy", ReplicationFactor: 2}
+	tests := []struct {
+		token int64
+		want  []string
+	}{
+		{-100, []string{"n1", "n2"}},
+		{-50, []string{"n2", "n3"}},
+		{150, []string{"n1", "n2"}},
+		{300, []string{"n1", "n2"}}, // wraps to the first token
+	}
+	for _, tt := range tests {
+		if got := addresses(r.Replicas(tt.token, s)); !equal(got, tt.want) {
+			t.Errorf("token %d: replicas %v, want %v", tt.token, got, tt.want)
+		}
+	}
+
+	owner, start, end := r.Owner(50)
+	if owner.Address != "n3" || start != 0 || end != 100 {
+		t.Errorf("owner of 50: %s (%d, %d]", owner.Address, start, end)
+	}
+	if got := r.Replicas(0, Strategy{Class: "SimpleStrategy", ReplicationFactor: 5}); len(got) != 3 {
+		t.Errorf("RF above the node count: %d replicas", len(got))
+	}
+}
+
+func TestNetworkTopologyStrategy(t *testing.T) {
+	// dc1 has two racks; the second node on the ring from 0 is on the rack
+	// of the first, so the third takes the second replica
+	r := New([]Node{
+		{Address: "a1", DataCenter: "dc1", Rack: "r1", Tokens: []int64{0}},
+		{Address: "b1", DataCenter: "dc2", Rack: "r1", Tokens: []int64{10}},
+		{Address: "a2", DataCenter: "dc1", Rack: "r1", Tokens: []int64{20}},
+		{Address: "b2", DataCenter: "dc2", Rack: "r1", Tokens: []int64{30}},
+		{Address: "a3", DataCenter: "dc1", Rack: "r2", Tokens: []int64{40}},
+		{Address: "a4", DataCenter: "dc1", Rack: "r2", Tokens: []int64{50}},
+	})
+	s, err := ParseStrategy("org.apache.cassandra.locator.NetworkTopologyStrategy",
+		map[string]interface{}{"class": "NetworkTopologyStrategy", "dc1": "3", "dc2": "1", "dc3": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Class != "NetworkTopologyStrategy" {
+		t.Fatalf("class %q", s.Class)
+	}
+	got := addresses(r.Replicas(0, s))
+	want := []string{"a1", "b1", "a3", "a2"}
+	if !equal(got, want) {
+		t.Errorf("replicas %v, want %v", got, want)
+	}
+
+	if _, err := ParseStrategy("SimpleStrategy", map[string]interface{}{"replication_factor": "x"}); err == nil {
+		t.Error("invalid replication factor accepted")
+	}
+	transient, _ := ParseStrategy("NetworkTopologyStrategy", map[string]interface{}{"dc1": "3/1"})
+	if transient.DataCenters["dc1"] != 3 {
+		t.Errorf("transient factor read as %d", transient.DataCenters["dc1"])
+	}
+}
+
+func TestRanges(t *testing.T) {
+	r := New([]Node{
+		{Address: "n1", Tokens: []int64{math.MinInt64 / 2}},
+		{Address: "n2", Tokens: []int64{0}},
+		{Address: "n3", Tokens: []int64{math.MaxInt64 / 2}},
+	})
+	ranges := r.Ranges()
+	if len(ranges) != 3 || ranges[0].Start != math.MaxInt64/2 || ranges[0].Owner.Address != "n1" || ranges[2].End != math.MaxInt64/2 {
+		t.Fatalf("ranges %+v", ranges)
+	}
+	want := []float64{0.5, 0.25, 0.25} // n1's range wraps around
+	total := 0.0
+	for i, rg := range ranges {
+		if f := rg.Fraction(); math.Abs(f-want[i]) > 1e-9 {
+			t.Errorf("range %d covers %v, want %v", i, f, want[i])
+		}
+		total += rg.Fraction()
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("ranges cover %v of the ring", total)
+	}
+
+	single := New([]Node{{Address: "n1", Tokens: []int64{42}}}).Ranges()
+	if len(single) != 1 || single[0].Fraction() != 1 {
+		t.Errorf("single token ranges %+v", single)
+	}
+}
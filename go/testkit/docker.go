@@ -0,0 +1,84 @@
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errNoDocker is returned by Start when there is no Docker to start a node in
+var errNoDocker = errors.New("docker is not available")
+
+// Container arguments of the flavors: a small heap, and a single shard for
+// Scylla, so a node fits on a CI runner
+var containerArgs = map[Flavor]struct {
+	env  []string
+	args []string
+}{
+	Cassandra: {env: []string{"MAX_HEAP_SIZE=512M", "HEAP_NEWSIZE=128M", "CASSANDRA_DC=datacenter1"}},
+	Scylla:    {args: []string{"--smp", "1", "--memory", "750M", "--overprovisioned", "1", "--developer-mode", "1"}},
+}
+
+// startContainer starts a node and returns its container ID and the
+// address its CQL port is published on
+func startContainer(ctx context.Context, opts Options) (string, string, int, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", "", 0, errNoDocker
+	}
+	if _, err := docker(ctx, "info", "--format", "{{.ServerVersion}}"); err != nil {
+		return "", "", 0, errNoDocker
+	}
+	if opts.Image == "" {
+		return "", "", 0, fmt.Errorf("unknown flavor %q and no image", opts.Flavor)
+	}
+
+	// Publish the CQL port on a free port of the loopback interface
+	args := []string{"run", "-d", "--rm", "-p", "127.0.0.1::9042"}
+	for _, env := range containerArgs[opts.Flavor].env {
+		args = append(args, "-e", env)
+	}
+	args = append(args, opts.Image)
+	args = append(args, containerArgs[opts.Flavor].args...)
+	id, err := docker(ctx, args...)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to start %s: %v", opts.Image, err)
+	}
+
+	published, err := docker(ctx, "port", id, "9042/tcp")
+	if err != nil {
+		_ = removeContainer(id)
+		return "", "", 0, fmt.Errorf("failed to read the published CQL port: %v", err)
+	}
+	// One line per address family; the first is the IPv4 one asked for
+	host, port, err := splitHostPort(strings.SplitN(published, "\n", 2)[0])
+	if err != nil {
+		_ = removeContainer(id)
+		return "", "", 0, err
+	}
+	return id, host, port, nil
+}
+
+// removeContainer stops and removes a container
+func removeContainer(id string) error {
+	if _, err := docker(context.Background(), "rm", "-f", id); err != nil {
+		return fmt.Errorf("failed to remove container %s: %v", id, err)
+	}
+	return nil
+}
+
+// docker runs a docker command and returns its trimmed output
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,76 @@
+package testkit
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// keyspaceSeq keeps the keyspaces of tests with the same name apart
+var keyspaceSeq atomic.Int64
+
+// maxKeyspaceName is Cassandra's limit on keyspace names
+const maxKeyspaceName = 48
+
+// Keyspace creates a keyspace for the test, runs stmts in it and drops it
+// when the test ends. Its name is derived from the test's name, so leftovers
+// of an interrupted run are easy to spot.
+func (c *Cluster) Keyspace(t testing.TB, stmts ...string) string {
+	t.Helper()
+	name := keyspaceName(t.Name(), keyspaceSeq.Add(1))
+
+	c.Exec(t, "", fmt.Sprintf("CREATE KEYSPACE %s WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}", name))
+	t.Cleanup(func() {
+		session, err := c.Session("")
+		if err != nil {
+			t.Logf("testkit: keyspace %s not dropped: %v", name, err)
+			return
+		}
+		defer session.Close()
+		if err := session.Query("DROP KEYSPACE IF EXISTS " + name).Exec(); err != nil {
+			t.Logf("testkit: keyspace %s not dropped: %v", name, err)
+		}
+	})
+
+	c.Exec(t, name, stmts...)
+	return name
+}
+
+// Exec runs statements in keyspace (none when empty), failing the test at
+// the first error
+func (c *Cluster) Exec(t testing.TB, keyspace string, stmts ...string) {
+	t.Helper()
+	if len(stmts) == 0 {
+		return
+	}
+	session, err := c.Session(keyspace)
+	if err != nil {
+		t.Fatalf("testkit: connect: %v", err)
+	}
+	defer session.Close()
+	for _, stmt := range stmts {
+		if err := session.Query(stmt).Exec(); err != nil {
+			t.Fatalf("testkit: %s: %v", stmt, err)
+		}
+	}
+}
+
+// keyspaceName turns a test name into a valid, unique keyspace name
+func keyspaceName(testName string, seq int64) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(testName) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	suffix := fmt.Sprintf("_%d", seq)
+	name := "tk_" + b.String()
+	if len(name) > maxKeyspaceName-len(suffix) {
+		name = name[:maxKeyspaceName-len(suffix)]
+	}
+	return name + suffix
+}
@@ -0,0 +1,218 @@
+package testkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites golden files with the responses instead of comparing them:
+// go test -tags integration ./... -args -testkit.update
+var update = flag.Bool("testkit.update", false, "rewrite testkit golden files")
+
+// Response is the envelope every cqlai-node export returns
+type Response struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Code    string          `json:"code,omitempty"`
+}
+
+// Decode parses a response, failing the test when it is not one
+func Decode(t testing.TB, raw string) Response {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+		t.Fatalf("testkit: not a response: %v\n%s", err, raw)
+	}
+	return resp
+}
+
+// Succeeded parses a response and fails the test unless it succeeded
+func Succeeded(t testing.TB, raw string) Response {
+	t.Helper()
+	resp := Decode(t, raw)
+	if !resp.Success {
+		t.Fatalf("testkit: call failed: %s (%s)", resp.Error, resp.Code)
+	}
+	return resp
+}
+
+// Data parses a successful response's data into v
+func Data(t testing.TB, raw string, v interface{}) {
+	t.Helper()
+	resp := Succeeded(t, raw)
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		t.Fatalf("testkit: data: %v\n%s", err, resp.Data)
+	}
+}
+
+// volatileKeys are fields whose values change from run to run; Golden
+// replaces them wherever they appear
+var volatileKeys = []string{"duration", "durationMs", "elapsedMs", "queryId", "traceSessionId", "execution", "jobId"}
+
+// GoldenOption adjusts how Golden normalizes a response
+type GoldenOption func(*goldenConfig)
+
+type goldenConfig struct {
+	shape    bool
+	ignore   map[string]bool
+	drop     map[string]bool
+	replacer []string
+}
+
+// Shape compares only the structure of the response: field names, and the
+// JSON types of the values, not the values themselves
+func Shape() GoldenOption {
+	return func(c *goldenConfig) { c.shape = true }
+}
+
+// Ignore replaces the values of more fields, at any depth
+func Ignore(keys ...string) GoldenOption {
+	return func(c *goldenConfig) {
+		for _, key := range keys {
+			c.ignore[key] = true
+		}
+	}
+}
+
+// Drop removes fields, at any depth, whose presence depends on the server
+// or the driver rather than on the flow under test
+func Drop(keys ...string) GoldenOption {
+	return func(c *goldenConfig) {
+		for _, key := range keys {
+			c.drop[key] = true
+		}
+	}
+}
+
+// Replace substitutes text in the raw response before it is parsed, such as
+// a test keyspace's name with a placeholder
+func Replace(old, new string) GoldenOption {
+	return func(c *goldenConfig) { c.replacer = append(c.replacer, old, new) }
+}
+
+// Golden compares a response with testdata/<name>.golden.json, after
+// normalizing it, and rewrites the file instead with -testkit.update
+func Golden(t testing.TB, name, raw string, opts ...GoldenOption) {
+	t.Helper()
+	got, err := Normalize(raw, opts...)
+	if err != nil {
+		t.Fatalf("testkit: %s: %v", name, err)
+	}
+
+	path := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("testkit: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("testkit: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("testkit: %v (run with -testkit.update to create it)", err)
+	}
+	if diff := firstDifference(want, got); diff != "" {
+		t.Errorf("testkit: response differs from %s:\n%s", path, diff)
+	}
+}
+
+// Normalize returns a response as indented JSON with sorted keys, volatile
+// fields replaced, and with Shape only the types of the values
+func Normalize(raw string, opts ...GoldenOption) ([]byte, error) {
+	cfg := &goldenConfig{ignore: make(map[string]bool), drop: make(map[string]bool)}
+	for _, key := range volatileKeys {
+		cfg.ignore[key] = true
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if len(cfg.replacer) > 0 {
+		raw = strings.NewReplacer(cfg.replacer...).Replace(raw)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	v = cfg.normalize(v)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalize walks a decoded value; maps are encoded with sorted keys
+func (c *goldenConfig) normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for key, value := range x {
+			if c.drop[key] {
+				delete(x, key)
+				continue
+			}
+			if c.ignore[key] {
+				x[key] = "<" + key + ">"
+				continue
+			}
+			x[key] = c.normalize(value)
+		}
+		return x
+	case []interface{}:
+		for i := range x {
+			x[i] = c.normalize(x[i])
+		}
+		return x
+	}
+	if !c.shape {
+		return v
+	}
+	switch v.(type) {
+	case nil:
+		return "<null>"
+	case bool:
+		return "<bool>"
+	case json.Number:
+		return "<number>"
+	}
+	return "<string>"
+}
+
+// firstDifference describes the first line where two files differ, or
+// returns "" when they are equal
+func firstDifference(want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package testkit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	raw := `{"success":true,"data":{"rows":[{"id":1,"name":"a<b","ks":"tk_x_1"}],"rowCount":1,"duration":"1.2ms","queryId":"q-7"}}`
+
+	got, err := Normalize(raw, Replace("tk_x_1", "<keyspace>"))
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "data": {
+    "duration": "<duration>",
+    "queryId": "<queryId>",
+    "rowCount": 1,
+    "rows": [
+      {
+        "id": 1,
+        "ks": "<keyspace>",
+        "name": "a<b"
+      }
+    ]
+  },
+  "success": true
+}
+`, string(got))
+
+	got, err = Normalize(raw, Shape(), Ignore("rows"), Drop("queryId"))
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "data": {
+    "duration": "<duration>",
+    "rowCount": "<number>",
+    "rows": "<rows>"
+  },
+  "success": "<bool>"
+}
+`, string(got))
+
+	_, err = Normalize("not json")
+	assert.Error(t, err)
+}
+
+func TestKeyspaceName(t *testing.T) {
+	assert.Equal(t, "tk_testcopy_round_trip_3", keyspaceName("TestCopy/round-trip", 3))
+	long := keyspaceName("TestAVeryLongTestNameThatWouldNotFitInAKeyspaceName/subtest", 12)
+	assert.Len(t, long, maxKeyspaceName)
+	assert.Equal(t, "_12", long[len(long)-3:])
+}
@@ -0,0 +1,246 @@
+// Package testkit runs compatibility tests against a real Cassandra or
+// ScyllaDB node.
+//
+// It starts a single-node cluster in Docker, or uses the one named by
+// CQLAI_TESTKIT_HOST, creates a throwaway keyspace per test, and compares
+// JSON responses with golden files. The integration suites of cqlai-node
+// (go test -tags integration ./...) use it, and embedders of the Go core can
+// run the same kind of tests against their own flows:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(testkit.Run(m, testkit.Options{}))
+//	}
+//
+//	func TestOrders(t *testing.T) {
+//		cluster := testkit.Require(t)
+//		ks := cluster.Keyspace(t, "CREATE TABLE orders (id int PRIMARY KEY, total decimal)")
+//		...
+//		testkit.Golden(t, "orders", response)
+//	}
+//
+// Without Docker and without CQLAI_TESTKIT_HOST, tests that call Require are
+// skipped rather than failed, so the suites can sit next to unit tests.
+//
+// Environment:
+//
+//	CQLAI_TESTKIT_HOST    host:port of a running node; no container is started
+//	CQLAI_TESTKIT_FLAVOR  cassandra (default) or scylla
+//	CQLAI_TESTKIT_IMAGE   image to run instead of the flavor's default
+//	CQLAI_TESTKIT_KEEP    set to leave the container running after the tests
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	gocql "github.com/apache/cassandra-gocql-driver/v2"
+)
+
+// Flavor is the server a cluster runs
+type Flavor string
+
+// Supported flavors
+const (
+	Cassandra Flavor = "cassandra"
+	Scylla    Flavor = "scylla"
+)
+
+// Default images of the flavors
+var defaultImages = map[Flavor]string{
+	Cassandra: "cassandra:5.0",
+	Scylla:    "scylladb/scylla:6.2",
+}
+
+// Options configure the cluster a test run uses. Zero values take the
+// defaults, and the environment variables override them.
+type Options struct {
+	Flavor       Flavor
+	Image        string        // Docker image (default: the flavor's)
+	StartTimeout time.Duration // How long the node may take to accept CQL (default 3 minutes)
+	Username     string
+	Password     string
+}
+
+// defaultStartTimeout covers a cold Cassandra start on a CI runner
+const defaultStartTimeout = 3 * time.Minute
+
+// Cluster is a node the tests run against
+type Cluster struct {
+	Flavor   Flavor
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	container string // Docker container ID; empty for an external node
+	keep      bool
+}
+
+// Addr returns the node's host:port
+func (c *Cluster) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// Start starts a node in Docker, or connects to CQLAI_TESTKIT_HOST, and
+// waits until it accepts CQL
+func Start(ctx context.Context, opts Options) (*Cluster, error) {
+	opts = withEnv(opts)
+	cluster := &Cluster{
+		Flavor:   opts.Flavor,
+		Username: opts.Username,
+		Password: opts.Password,
+		keep:     os.Getenv("CQLAI_TESTKIT_KEEP") != "",
+	}
+
+	if addr := os.Getenv("CQLAI_TESTKIT_HOST"); addr != "" {
+		host, port, err := splitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("CQLAI_TESTKIT_HOST: %v", err)
+		}
+		cluster.Host, cluster.Port = host, port
+	} else {
+		id, host, port, err := startContainer(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		cluster.container, cluster.Host, cluster.Port = id, host, port
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.StartTimeout)
+	defer cancel()
+	if err := cluster.waitReady(ctx); err != nil {
+		_ = cluster.Stop()
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// Stop removes the cluster's container, unless CQLAI_TESTKIT_KEEP is set.
+// An external node is left alone.
+func (c *Cluster) Stop() error {
+	if c.container == "" || c.keep {
+		return nil
+	}
+	return removeContainer(c.container)
+}
+
+// Session opens a driver session to the cluster, using keyspace when it is
+// not empty
+func (c *Cluster) Session(keyspace string) (*gocql.Session, error) {
+	cfg := gocql.NewCluster(c.Host)
+	cfg.Port = c.Port
+	cfg.Keyspace = keyspace
+	cfg.Consistency = gocql.One
+	cfg.Timeout = 30 * time.Second
+	cfg.ConnectTimeout = 10 * time.Second
+	cfg.DisableInitialHostLookup = true // The container's own address is not reachable from the host
+	if c.Username != "" {
+		cfg.Authenticator = gocql.PasswordAuthenticator{Username: c.Username, Password: c.Password}
+	}
+	return cfg.CreateSession()
+}
+
+// waitReady polls the node until a query succeeds
+func (c *Cluster) waitReady(ctx context.Context) error {
+	var lastErr error
+	for {
+		session, err := c.Session("")
+		if err == nil {
+			var version string
+			err = session.Query("SELECT release_version FROM system.local").WithContext(ctx).Scan(&version)
+			session.Close()
+			if err == nil {
+				return nil
+			}
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("node at %s did not accept CQL: %v", c.Addr(), lastErr)
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// The cluster started by Run, or why none is available
+var (
+	shared     *Cluster
+	sharedSkip string
+)
+
+// Run starts a cluster, runs the tests and stops the cluster, returning the
+// exit code for os.Exit. Call it from TestMain; tests get the cluster with
+// Require. When no cluster can be started the tests still run, and Require
+// skips them.
+func Run(m *testing.M, opts Options) int {
+	opts = withEnv(opts)
+	cluster, err := Start(context.Background(), opts)
+	switch {
+	case errors.Is(err, errNoDocker):
+		sharedSkip = "no cluster: Docker is not available and CQLAI_TESTKIT_HOST is not set"
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "testkit: %v\n", err)
+		return 1
+	default:
+		shared = cluster
+		defer func() {
+			if err := cluster.Stop(); err != nil {
+				fmt.Fprintf(os.Stderr, "testkit: %v\n", err)
+			}
+		}()
+	}
+	return m.Run()
+}
+
+// Require returns the cluster started by Run, and skips the test when
+// there is none
+func Require(t testing.TB) *Cluster {
+	t.Helper()
+	if shared == nil {
+		if sharedSkip == "" {
+			t.Fatal("testkit.Require called without testkit.Run in TestMain")
+		}
+		t.Skip(sharedSkip)
+	}
+	return shared
+}
+
+// withEnv applies the environment and the defaults to opts
+func withEnv(opts Options) Options {
+	if flavor := os.Getenv("CQLAI_TESTKIT_FLAVOR"); flavor != "" {
+		opts.Flavor = Flavor(flavor)
+	}
+	if opts.Flavor == "" {
+		opts.Flavor = Cassandra
+	}
+	if image := os.Getenv("CQLAI_TESTKIT_IMAGE"); image != "" {
+		opts.Image = image
+	}
+	if opts.Image == "" {
+		opts.Image = defaultImages[opts.Flavor]
+	}
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = defaultStartTimeout
+	}
+	return opts
+}
+
+// splitHostPort parses host:port, defaulting the port to 9042
+func splitHostPort(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 9042, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 {
+		return "", 0, fmt.Errorf("invalid port in %q", addr)
+	}
+	return host, port, nil
+}
@@ -45,10 +45,28 @@ const native = {
   TestConnection: lib.func('char* TestConnection(const char* optionsJSON)'),
   TestConnectionWithID: lib.func('char* TestConnectionWithID(const char* optionsJSON)'),
   CancelTestConnection: lib.func('char* CancelTestConnection(const char* requestID)'),
+  GetConnectionProgress: lib.func('char* GetConnectionProgress(const char* cancelToken)'),
+
+  // Cancellation of long-running calls by token
+  NewCancelToken: lib.func('char* NewCancelToken()'),
+  Cancel: lib.func('char* Cancel(const char* token)'),
 
   // Query execution
   ExecuteQuery: lib.func('char* ExecuteQuery(int handle, const char* query)'),
+  ExecuteQueryWithOptions: lib.func('char* ExecuteQueryWithOptions(int handle, const char* query, const char* optionsJSON)'),
   ExecuteMultiQuery: lib.func('char* ExecuteMultiQuery(int handle, const char* query, const char* optionsJSON)'),
+  GetStatementText: lib.func('char* GetStatementText(int handle, const char* hash)'),
+
+  // Prepared statements with bind values
+  PrepareStatement: lib.func('char* PrepareStatement(int handle, const char* query)'),
+  ExecutePrepared: lib.func('char* ExecutePrepared(int handle, const char* statementID, const char* valuesJSON)'),
+  ClosePrepared: lib.func('char* ClosePrepared(int handle, const char* statementID)'),
+
+  // Batches
+  ExecuteBatch: lib.func('char* ExecuteBatch(int handle, const char* batchJSON)'),
+
+  // cqlsh special commands
+  ExecuteShellCommand: lib.func('char* ExecuteShellCommand(int handle, const char* command, const char* optionsJSON)'),
 
   // CQL parsing
   SplitCQL: lib.func('char* SplitCQL(const char* cql)'),
@@ -58,20 +76,142 @@ const native = {
   FetchNextPage: lib.func('char* FetchNextPage(int handle, const char* queryID)'),
   CancelPagedQuery: lib.func('char* CancelPagedQuery(int handle, const char* queryID)'),
   CancelQuery: lib.func('char* CancelQuery(int handle)'),
+  AbortRunningQuery: lib.func('char* AbortRunningQuery(int handle)'),
+
+  // Asynchronous query execution (polled from JS)
+  ExecuteQueryAsync: lib.func('char* ExecuteQueryAsync(int handle, const char* query, const char* optionsJSON)'),
+  PollQueryResult: lib.func('char* PollQueryResult(int handle, const char* queryID)'),
+  CancelAsyncQuery: lib.func('char* CancelAsyncQuery(int handle, const char* queryID)'),
+
+  // Flow-controlled streams (rows, COPY progress, schema events)
+  OpenStream: lib.func('char* OpenStream(int handle, const char* optionsJSON)'),
+  ReadStream: lib.func('char* ReadStream(int handle, const char* streamID, const char* optionsJSON)'),
+  GrantStreamCredits: lib.func('char* GrantStreamCredits(int handle, const char* streamID, int credits)'),
+  CloseStream: lib.func('char* CloseStream(int handle, const char* streamID)'),
+
+  // Table browsing (keyset pagination by primary key)
+  BrowseTable: lib.func('char* BrowseTable(int handle, const char* optionsJSON)'),
+
+  // Table samples (first rows, random token ranges, last rows of a partition)
+  SampleTable: lib.func('char* SampleTable(int handle, const char* optionsJSON)'),
+  GetSampleModes: lib.func('char* GetSampleModes(int handle, const char* keyspace, const char* table)'),
+
+  // Row-level change capture from CDC commit log segments
+  BrowseCDC: lib.func('char* BrowseCDC(int handle, const char* optionsJSON)'),
+
+  // Row-level data comparison between tables (e.g. migration source and target)
+  CompareTables: lib.func('char* CompareTables(int handleA, const char* tableA, int handleB, const char* tableB, const char* sampleSpecJSON)'),
+
+  // Schema diff between two sessions or exported metadata, with the statements to reconcile them
+  CompareSchemas: lib.func('char* CompareSchemas(const char* optionsJSON)'),
+  PlanSchemaMigration: lib.func('char* PlanSchemaMigration(int handle, const char* optionsJSON)'),
+
+  // Token-range partition search with a client-side predicate (orphaned data debugging)
+  FindPartitions: lib.func('char* FindPartitions(int handle, const char* keyspace, const char* table, const char* predicateJSON, int maxResults)'),
+
+  // Exact row counts with parallel token-range COUNT(*) queries
+  CountTable: lib.func('char* CountTable(int handle, const char* keyspace, const char* table, const char* optionsJSON)'),
+  GetCountProgress: lib.func('char* GetCountProgress(int handle)'),
+
+  // Latency micro-benchmarks
+  BenchmarkWrites: lib.func('char* BenchmarkWrites(int handle, const char* tableSpecJSON, const char* optionsJSON)'),
+  BenchmarkReads: lib.func('char* BenchmarkReads(int handle, const char* keyspace, const char* table, const char* optionsJSON)'),
+  GenerateTestData: lib.func('char* GenerateTestData(int handle, const char* keyspace, const char* table, const char* optionsJSON)'),
+
+  // Scratch keyspaces for experiments, dropped when the session closes
+  CreateScratchSpace: lib.func('char* CreateScratchSpace(int handle, const char* optionsJSON)'),
+  ListScratchSpaces: lib.func('char* ListScratchSpaces(int handle)'),
+  CleanupScratchSpaces: lib.func('char* CleanupScratchSpaces(int handle, const char* optionsJSON)'),
+
+  // Row writes with explicit null / unset semantics
+  InsertRows: lib.func('char* InsertRows(int handle, const char* keyspace, const char* table, const char* rowsJSON, const char* optionsJSON)'),
+  DeletePartition: lib.func('char* DeletePartition(int handle, const char* keyspace, const char* table, const char* keyJSON, const char* optionsJSON)'),
+  DeleteRange: lib.func('char* DeleteRange(int handle, const char* keyspace, const char* table, const char* keyJSON, const char* rangeJSON, const char* optionsJSON)'),
+
+  // Query analysis and building (GROUP BY / PER PARTITION LIMIT pushdown)
+  BuildSelectQuery: lib.func('char* BuildSelectQuery(int handle, const char* specJSON)'),
+  AnalyzeQuery: lib.func('char* AnalyzeQuery(int handle, const char* query)'),
+  ExplainQuery: lib.func('char* ExplainQuery(int handle, const char* query)'),
 
   // Session configuration
   SetConsistency: lib.func('char* SetConsistency(int handle, const char* level)'),
+  SetSerialConsistency: lib.func('char* SetSerialConsistency(int handle, const char* level)'),
+  SetConsistencyFallback: lib.func('char* SetConsistencyFallback(int handle, const char* level)'),
+  SetQueryTimeout: lib.func('char* SetQueryTimeout(int handle, int timeoutMs)'),
+  SetCircuitBreaker: lib.func('char* SetCircuitBreaker(int handle, const char* optionsJSON)'),
   SetKeyspace: lib.func('char* SetKeyspace(int handle, const char* keyspace)'),
+  ReconnectSession: lib.func('char* ReconnectSession(int handle)'),
   SetPaging: lib.func('char* SetPaging(int handle, const char* value)'),
   SetTracing: lib.func('char* SetTracing(int handle, int enabled)'),
   SetExpand: lib.func('char* SetExpand(int handle, int enabled)'),
+  SetAutoFetch: lib.func('char* SetAutoFetch(int handle, int enabled, int maxRows)'),
+  GetFetchProgress: lib.func('char* GetFetchProgress(int handle)'),
   GetSessionInfo: lib.func('char* GetSessionInfo(int handle)'),
+  GetResourceUsage: lib.func('char* GetResourceUsage(int handle)'),
+  GetSessionMetrics: lib.func('char* GetSessionMetrics(int handle)'),
+  SetSchemaCacheMode: lib.func('char* SetSchemaCacheMode(int handle, const char* mode)'),
+  PinSchema: lib.func('char* PinSchema(int handle, const char* optionsJson)'),
+  UnpinSchema: lib.func('char* UnpinSchema(int handle)'),
+  GetSchemaPin: lib.func('char* GetSchemaPin(int handle)'),
+  GetLanguageCatalog: lib.func('char* GetLanguageCatalog(int handle)'),
+
+  // Bulk operation scheduler (shared by all sessions in the process)
+  GetSchedulerStats: lib.func('char* GetSchedulerStats()'),
+  ConfigureScheduler: lib.func('char* ConfigureScheduler(const char* optionsJSON)'),
+  SetSchedulerLimits: lib.func('char* SetSchedulerLimits(int handle, int weight, int maxConcurrent)'),
+
+  // Opt-in usage counters (shared by all sessions in the process)
+  ConfigureTelemetry: lib.func('char* ConfigureTelemetry(const char* optionsJSON)'),
+  GetTelemetrySnapshot: lib.func('char* GetTelemetrySnapshot(const char* optionsJSON)'),
+
+  // Redaction of statements and bind values in logs (per workspace)
+  SetRedactionPolicy: lib.func('char* SetRedactionPolicy(const char* optionsJSON)'),
+  GetRedactionPolicy: lib.func('char* GetRedactionPolicy(const char* workspaceID)'),
+  RedactStatement: lib.func('char* RedactStatement(const char* optionsJSON)'),
+  ConfigureLogFiles: lib.func('char* ConfigureLogFiles(const char* optionsJSON)'),
+  GetLogFiles: lib.func('char* GetLogFiles()'),
+  WriteLogRecord: lib.func('char* WriteLogRecord(const char* name, const char* record)'),
+  RotateLogFile: lib.func('char* RotateLogFile(const char* name)'),
+
+  // Settings hierarchy (workspace defaults and effective session settings)
+  SetWorkspaceDefaults: lib.func('char* SetWorkspaceDefaults(const char* optionsJSON)'),
+  GetWorkspaceDefaults: lib.func('char* GetWorkspaceDefaults(const char* workspaceID)'),
+  SetFeatureFlags: lib.func('char* SetFeatureFlags(const char* optionsJSON)'),
+  GetFeatureFlags: lib.func('char* GetFeatureFlags(const char* workspaceID)'),
+  GetEffectiveSettings: lib.func('char* GetEffectiveSettings(int handle)'),
+
+  // Partition scan guard (size_estimates check before unrestricted SELECTs)
+  SetScanGuard: lib.func('char* SetScanGuard(int handle, const char* optionsJSON)'),
+  SetResultLimit: lib.func('char* SetResultLimit(int handle, const char* optionsJSON)'),
+  SetInSplit: lib.func('char* SetInSplit(int handle, const char* optionsJSON)'),
+  GetPayloadLimits: lib.func('char* GetPayloadLimits(int handle)'),
+
+  // Config file watching
+  WatchConfig: lib.func('char* WatchConfig(int handle, const char* optionsJSON)'),
+  PollConfigEvents: lib.func('char* PollConfigEvents(int handle)'),
+  GetEffectiveConfig: lib.func('char* GetEffectiveConfig(int handle)'),
+
+  // Schema change events
+  SubscribeSchemaEvents: lib.func('char* SubscribeSchemaEvents(int handle, const char* optionsJSON)'),
+  PollSchemaEvents: lib.func('char* PollSchemaEvents(int handle)'),
 
   // Metadata
   GetClusterMetadata: lib.func('char* GetClusterMetadata(int handle)'),
+  GetSchemaSummary: lib.func('char* GetSchemaSummary(int handle)'),
+  GetTokenRing: lib.func('char* GetTokenRing(int handle, const char* optionsJSON)'),
+  GetUDTDefinition: lib.func('char* GetUDTDefinition(int handle, const char* keyspace, const char* name)'),
+  GetTableStats: lib.func('char* GetTableStats(int handle, const char* keyspace, const char* table)'),
+  CollectNodeMetrics: lib.func('char* CollectNodeMetrics(int handle)'),
+  ConfigureAccessHeatmap: lib.func('char* ConfigureAccessHeatmap(int handle, const char* optionsJSON)'),
+  GetAccessHeatmap: lib.func('char* GetAccessHeatmap(int handle)'),
+  EnableQueryProfiling: lib.func('char* EnableQueryProfiling(int handle, const char* optionsJSON)'),
+  GetQueryProfile: lib.func('char* GetQueryProfile(int handle, const char* optionsJSON)'),
+  GetAccessibleObjects: lib.func('char* GetAccessibleObjects(int handle)'),
+  GetSecurityOverview: lib.func('char* GetSecurityOverview(int handle)'),
 
   // DDL Generation
   GetDDL: lib.func('char* GetDDL(int handle, const char* scope)'),
+  GetDDLChunk: lib.func('char* GetDDLChunk(int handle, const char* operationID, int index)'),
 
   // TLS Security
   CheckTLS: lib.func('char* CheckTLS(const char* optionsJSON)'),
@@ -84,19 +224,33 @@ const native = {
   ValidateAstraSecureBundle: lib.func('char* ValidateAstraSecureBundle(const char* bundlePath)'),
   CreateAstraSession: lib.func('char* CreateAstraSession(const char* optionsJSON)'),
   TestAstraConnectionWithID: lib.func('char* TestAstraConnectionWithID(const char* optionsJSON)'),
+  DiagnoseAstraConnectivity: lib.func('char* DiagnoseAstraConnectivity(const char* optionsJSON)'),
   CleanupAstraExtracted: lib.func('char* CleanupAstraExtracted(const char* extractedDir)'),
 
+  // Connection bundles (cqlshrc + credentials + certs for self-managed clusters)
+  ParseConnectionBundle: lib.func('char* ParseConnectionBundle(const char* optionsJSON)'),
+  CleanupConnectionBundle: lib.func('char* CleanupConnectionBundle(const char* extractedDir)'),
+
   // COPY TO/FROM (CSV export/import)
   CopyTo: lib.func('char* CopyTo(int handle, const char* paramsJSON)'),
   CopyFrom: lib.func('char* CopyFrom(int handle, const char* paramsJSON)'),
+  GetCopyCheckpoint: lib.func('char* GetCopyCheckpoint(const char* optionsJSON)'),
+  GetCopyProgress: lib.func('char* GetCopyProgress(int handle, const char* jobID)'),
+  CancelCopy: lib.func('char* CancelCopy(int handle, const char* jobID)'),
+  PlanCsvMapping: lib.func('char* PlanCsvMapping(int handle, const char* paramsJSON)'),
+  DetectCsvDialect: lib.func('char* DetectCsvDialect(int handle, const char* paramsJSON)'),
+  GenerateLoaderConfig: lib.func('char* GenerateLoaderConfig(int handle, const char* keyspace, const char* table, const char* target)'),
 
   // Source file execution (CQL files)
   ExecuteSourceFiles: lib.func('char* ExecuteSourceFiles(int handle, const char* optionsJSON)'),
   GetSourceProgress: lib.func('char* GetSourceProgress(int handle)'),
   StopSourceExecution: lib.func('char* StopSourceExecution(int handle)'),
+  RollbackPlan: lib.func('char* RollbackPlan(int handle, const char* optionsJSON)'),
 
   // Query tracing
   GetQueryTrace: lib.func('char* GetQueryTrace(int handle, const char* sessionID)'),
+  GetQueryTraceWithOptions: lib.func('char* GetQueryTraceWithOptions(int handle, const char* sessionID, const char* optionsJSON)'),
+  ExportTrace: lib.func('char* ExportTrace(int handle, const char* sessionID, const char* format, const char* path)'),
 
   // Memory management
   FreeString: lib.func('void FreeString(char* str)'),
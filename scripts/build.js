@@ -42,8 +42,10 @@ console.log(`  Output: ${outputLib}`);
 try {
   // Build the shared library from Go source
   // -ldflags="-s -w" strips debug symbols, reducing binary size by ~30%
+  // CQLAI_BUILD_TAGS=nopreviews builds without the preview features (see getFeatureFlags())
+  const tags = process.env.CQLAI_BUILD_TAGS ? ` -tags "${process.env.CQLAI_BUILD_TAGS}"` : '';
   execSync(
-    `go build -buildmode=c-shared -ldflags="-s -w" -o "${outputLib}" ./bindings/`,
+    `go build -buildmode=c-shared -ldflags="-s -w"${tags} -o "${outputLib}" ./bindings/`,
     {
       cwd: goDir,
       stdio: 'inherit',
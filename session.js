@@ -1,3 +1,4 @@
+const { Readable } = require('stream');
 const { native, callNativeAsync, callNativeTrueAsync } = require('./native');
 
 /**
@@ -10,6 +11,8 @@ class CQLSession {
     this._keyspace = keyspace;
     this._username = username || '';
     this._host = host || '';
+    this._configWatchTimer = null;
+    this._schemaEventTimer = null;
   }
 
   /**
@@ -62,14 +65,17 @@ class CQLSession {
   /**
    * Test connection with cancellation support
    * @param {Object} options - Connection options (same as testConnection)
-   * @param {string} options.requestID - Unique request ID for cancellation (required)
-   * @returns {Promise<Object>} { success, data?, error?, code? }
+   * @param {string} options.cancelToken - Token for CQLSession.cancel() (this or requestID is required)
+   * @param {string} options.requestID - Older name for cancelToken
+   * @param {Object} [options.phaseTimeouts] - Timeout of each phase in ms: configMs, connectMs, tlsMs, authMs, queryMs
+   * @returns {Promise<Object>} { success, data?, error?, code? } - data.phases times each phase
    *
    * If cancelled, returns: { success: false, error: 'Connection cancelled', code: 'CANCELLED' }
+   * A phase that runs past its timeout fails with code PHASE_TIMEOUT and data { failedAt, phases }
    */
   static async testConnectionWithID(options = {}) {
-    if (!options.requestID) {
-      return { success: false, error: 'requestID is required for cancellable connection test' };
+    if (!options.requestID && !options.cancelToken) {
+      return { success: false, error: 'cancelToken or requestID is required for cancellable connection test' };
     }
 
     const optionsJSON = JSON.stringify(options);
@@ -78,7 +84,7 @@ class CQLSession {
   }
 
   /**
-   * Cancel a pending test connection
+   * Cancel a pending test connection (same as CQLSession.cancel(requestID))
    * @param {string} requestID - The request ID passed to testConnectionWithID
    * @returns {Promise<Object>} { success, data: { cancelled: boolean, reason?: string } }
    */
@@ -92,6 +98,70 @@ class CQLSession {
     );
   }
 
+  /**
+   * Get the progress of a running connection test (testConnectionWithID or
+   * testAstraConnectionWithID), to poll while it runs and for 5 minutes after
+   * @param {string} cancelToken - The cancelToken (or requestID) of the test
+   * @returns {Promise<Object>} { success, data?: { cancelToken, status, phase?, step, steps, phaseElapsedMs?, elapsedMs, phases, failedAt? }, error? }
+   */
+  static async getConnectionProgress(cancelToken) {
+    if (!cancelToken) {
+      return { success: false, error: 'cancelToken is required' };
+    }
+
+    return await callNativeTrueAsync(native.GetConnectionProgress, cancelToken);
+  }
+
+  /**
+   * Issue a cancel token to pass as the cancelToken option of a long-running call
+   * (executeMulti, executeSourceFiles, findPartitions, countTable,
+   * benchmarkWrites, benchmarkReads, generateTestData, testConnectionWithID, testAstraConnectionWithID, copyTo). Any unique string the caller picks works too.
+   * @returns {Promise<Object>} { success, data?: { cancelToken }, error? }
+   */
+  static async newCancelToken() {
+    return await callNativeAsync(() => native.NewCancelToken());
+  }
+
+  /**
+   * Cancel the call running with a cancel token, or close the paged query with that ID.
+   * Works for every session. A token not in use yet cancels the call that starts with it
+   * within the next minute, so a cancel racing the start of the call is not lost.
+   * @param {string} token - Cancel token or paged query ID
+   * @returns {Promise<Object>} { success, data?: { cancelled, kind?, reason? }, error? }
+   */
+  static async cancel(token) {
+    if (!token) {
+      return { success: false, error: 'token is required' };
+    }
+
+    return await callNativeAsync(() => native.Cancel(token));
+  }
+
+  /**
+   * Split CQL into statements without running them, with where each one is in the text,
+   * e.g. to place per-statement gutter icons in an editor
+   * @param {string} cql - CQL statement(s) or shell command(s)
+   * @returns {Promise<Object>} { success, data?: { statements, descriptors, ranges, incomplete, incompleteRange?, error? }, error? }
+   */
+  static async splitCQL(cql) {
+    return await callNativeAsync(() => native.SplitCQL(cql || ''));
+  }
+
+  /**
+   * Compare two schemas and list the CQL that turns the first into the second,
+   * e.g. to review a migration
+   * @param {CQLSession|Object} from - The schema as it is: a session or a getClusterMetadata() result's data
+   * @param {CQLSession|Object} to - The schema wanted: a session or a getClusterMetadata() result's data
+   * @param {Object} [options] - Comparison options
+   * @param {string[]} [options.keyspaces] - Compare only these keyspaces (default: all non-system keyspaces)
+   * @returns {Promise<Object>} { success, data?: { identical, changes, statements, warnings }, error? }
+   */
+  static async compareSchemas(from, to, options = {}) {
+    const side = (schema) => schema instanceof CQLSession ? { handle: schema._handle } : { metadata: schema };
+    const optionsJSON = JSON.stringify({ ...options, from: side(from), to: side(to) });
+    return await callNativeTrueAsync(native.CompareSchemas, optionsJSON);
+  }
+
   /**
    * Connect to a Cassandra cluster
    * @param {Object} options - Connection options
@@ -103,8 +173,25 @@ class CQLSession {
    * @param {string} [options.consistency] - Consistency level
    * @param {number} [options.connectTimeout] - Connection timeout in seconds
    * @param {number} [options.requestTimeout] - Request timeout in seconds
+   * @param {number} [options.queryTimeout] - Milliseconds a statement may take, all pages included (default: none)
+   * @param {number} [options.socketKeepalive] - Seconds of silence before TCP keepalive probes are sent (default: 15)
+   * @param {number} [options.pageSize] - Rows per page (default: the JSON config file or 100)
    * @param {string} [options.rsaPrivateKey] - PEM-encoded RSA private key for credential decryption
    * @param {string} [options.rsaPrivateKeyFile] - Path to RSA private key file for credential decryption
+   * @param {Object} [options.speculativeExecution] - Speculative execution for SELECT statements
+   * @param {number} options.speculativeExecution.maxAttempts - Additional executions to start on other coordinators
+   * @param {number} options.speculativeExecution.delayMs - Delay before each additional execution
+   * @param {string} [options.schemaCache='full'] - Schema cache scope: 'full', 'keyspace' (current keyspace only) or 'off'
+   * @param {boolean} [options.persistSchemaCache=false] - Save a full schema cache between connections; a reconnect to a
+   *   cluster whose schema_version has not changed loads it from disk and refreshes it in the background
+   * @param {string} [options.schemaCacheDir] - Directory to save it in (default: cqlai/schema-cache in the user cache directory)
+   * @param {string} [options.consistencyFallback] - Consistency level to retry a SELECT at, once, when the requested one cannot be met
+   * @param {Object} [options.circuitBreaker] - Avoid coordinators with a high error rate: { errorRate=0.5, minRequests=20,
+   *   windowMs=60000, openMs=30000 }
+   * @param {string[]} [options.hosts] - More contact points ('host' or 'host:port'), tried when host is down
+   * @param {Object} [options.loadBalancing] - How coordinators are picked: { policy='round-robin'|'dc-aware', localDC,
+   *   tokenAware=false }
+   * @param {string} [options.workspaceID] - Workspace for cqlshrc variables and the redaction policy of the session's logs
    * @returns {Promise<Object>} { success, data?: CQLSession, error? }
    */
   static async connect(options = {}) {
@@ -141,14 +228,18 @@ class CQLSession {
    * @param {string} cql - CQL query string(s) or shell command(s)
    * @param {Object} options - Execution options
    * @param {boolean} [options.stopOnError=false] - Stop on first error
+   * @param {boolean} [options.force=false] - Run SELECTs the scan guard would refuse (see setScanGuard)
+   * @param {Function} [options.onFetchProgress] - With auto-fetch on, called with { rows, pages, maxRows, running, truncated, elapsedMs } while a SELECT reads its pages
    * @param {Function} [options.onProgress] - Callback called after each statement completes
    *   Receives: { success, data, index, identifier, allCompleted, promptInfo }
    *   For SELECT with paging: data includes { hasMore, queryId } if more rows available
-   * @returns {Promise<Object>} { success, data?, error?, statementsCount?, identifiers?, extraTokens?, promptInfo }
+   *   Each result also carries descriptor: { kind, category, objectType, keyspace, name, qualifiedName, options }
+   *   and range: { start, end, startLine, startColumn, endLine, endColumn }, where the statement is in cql
+   * @returns {Promise<Object>} { success, data?, error?, statementsCount?, identifiers?, extraTokens?, descriptors?, ranges?, promptInfo }
    */
   async execute(cql, options = {}) {
     try {
-      const { stopOnError = false, onProgress } = options;
+      const { stopOnError = false, force = false, onProgress, onFetchProgress } = options;
       const trimmed = cql.trim();
 
       // Handle empty input
@@ -156,27 +247,28 @@ class CQLSession {
         return { success: true, statementsCount: 0, identifiers: [], extraTokens: [], data: { message: '' }, promptInfo: this.getPromptInfo() };
       }
 
-      // Split into individual statements using native Go splitter
-      const splitResponse = await callNativeAsync(() => native.SplitCQL(trimmed));
+      // Split into individual statements using native Go splitter. The untrimmed
+      // text is passed so that statement ranges point into the caller's buffer.
+      const splitResponse = await callNativeAsync(() => native.SplitCQL(cql));
     if (!splitResponse.success) {
       return { success: false, error: splitResponse.error || 'Failed to split CQL', code: 'PARSE_ERROR', statementsCount: 0, identifiers: [], extraTokens: [], promptInfo: this.getPromptInfo() };
     }
 
-    const { statements, incomplete, identifiers, extraTokens, secondTokens, thirdTokens, error: splitError } = splitResponse.data;
+    const { statements, incomplete, identifiers, extraTokens, secondTokens, thirdTokens, descriptors = [], ranges = [], incompleteRange, error: splitError } = splitResponse.data;
 
     // Handle split errors (unclosed strings, comments, etc.)
     if (splitError) {
-      return { success: false, error: splitError, code: 'PARSE_ERROR', statementsCount: 0, statements: statements || [], identifiers: identifiers || [], extraTokens: extraTokens || [], secondTokens: secondTokens || [], thirdTokens: thirdTokens || [], promptInfo: this.getPromptInfo() };
+      return { success: false, error: splitError, code: 'PARSE_ERROR', statementsCount: 0, statements: statements || [], identifiers: identifiers || [], extraTokens: extraTokens || [], secondTokens: secondTokens || [], thirdTokens: thirdTokens || [], descriptors, promptInfo: this.getPromptInfo() };
     }
 
     // Handle incomplete statements
     if (incomplete) {
-      return { success: false, error: 'Incomplete statement', code: 'INCOMPLETE_STATEMENT', statementsCount: 0, statements: statements || [], identifiers: identifiers || [], extraTokens: extraTokens || [], secondTokens: secondTokens || [], thirdTokens: thirdTokens || [], promptInfo: this.getPromptInfo() };
+      return { success: false, error: 'Incomplete statement', code: 'INCOMPLETE_STATEMENT', statementsCount: 0, statements: statements || [], identifiers: identifiers || [], extraTokens: extraTokens || [], secondTokens: secondTokens || [], thirdTokens: thirdTokens || [], descriptors, ranges, incompleteRange, promptInfo: this.getPromptInfo() };
     }
 
     // Handle empty after split (e.g., only comments)
     if (!statements || statements.length === 0) {
-      return { success: true, statementsCount: 0, identifiers: [], extraTokens: [], secondTokens: [], thirdTokens: [], data: { message: '' }, promptInfo: this.getPromptInfo() };
+      return { success: true, statementsCount: 0, identifiers: [], extraTokens: [], secondTokens: [], thirdTokens: [], descriptors: [], data: { message: '' }, promptInfo: this.getPromptInfo() };
     }
 
     // Check if any statements are shell commands
@@ -190,7 +282,8 @@ class CQLSession {
     // If no shell commands, multiple statements, and no onProgress callback - use batch execution
     // (batch execution doesn't support per-statement progress callbacks)
     if (!hasShellCommands && statements.length > 1 && !onProgress) {
-      return this.executeMulti(trimmed, { stopOnError });
+      const multi = await this.executeMulti(trimmed, { stopOnError, force });
+      return { ...multi, ranges };
     }
 
     // Get current page size for SELECT paging support
@@ -222,9 +315,15 @@ class CQLSession {
         // Note: 'identifier' comes from the CQL splitter which properly tokenizes the statement
         // (handles comments, whitespace, etc.) - NOT a regex/string check
         const upperIdentifier = identifier.toUpperCase();
-        if (upperIdentifier === 'SELECT' && pageSize > 0) {
+        if (upperIdentifier === 'SELECT' && force) {
+          // Only multi-query execution takes per-call options; forced scans are not paged
+          const forced = await this.executeMulti(stmtTrimmed, { force: true });
+          result = { success: forced.success, error: forced.error, code: forced.code, data: forced.data };
+        } else if (upperIdentifier === 'SELECT' && pageSize > 0) {
           // Use paged execution - returns hasMore and queryId if more rows available
-          const response = await callNativeTrueAsync(native.ExecuteQueryPaged, this._handle, stmtTrimmed);
+          const response = await this._withFetchProgress(onFetchProgress, () =>
+            callNativeTrueAsync(native.ExecuteQueryPaged, this._handle, stmtTrimmed)
+          );
           result = response;
         } else {
           // Regular execution
@@ -243,6 +342,8 @@ class CQLSession {
       result.identifier = identifier;
       result.secondToken = secondTokens[i] || '';   // 2nd meaningful token
       result.thirdToken = thirdTokens[i] || '';     // 3rd meaningful token
+      result.descriptor = descriptors[i] || null;   // Structured kind, target and options
+      result.range = ranges[i] || null;             // Where the statement is in cql
       result.statement = stmtTrimmed;  // Original statement text
       result.statementsCount = statements.length;  // Total number of statements
       result.allCompleted = isLast && !stoppedEarly;
@@ -276,6 +377,8 @@ class CQLSession {
         extraTokens,
         secondTokens,
         thirdTokens,
+        descriptors,
+        ranges,
         promptInfo: this.getPromptInfo()
       };
     }
@@ -290,6 +393,8 @@ class CQLSession {
       extraTokens,
       secondTokens,
       thirdTokens,
+      descriptors,
+      ranges,
       stopped: stoppedEarly,
       data: {
         results: results.map(r => ({
@@ -299,6 +404,8 @@ class CQLSession {
           identifier: r.identifier,
           secondToken: r.secondToken,
           thirdToken: r.thirdToken,
+          descriptor: r.descriptor,
+          range: r.range,
           statement: r.statement,
           allCompleted: r.allCompleted,
           ...r.data
@@ -322,11 +429,17 @@ class CQLSession {
 
   /**
    * Execute multiple CQL statements using Go's native batch execution
-   * Use this for pure CQL (no shell commands) for better performance
+   * Use this for CQL scripts for better performance. USE switches the session keyspace as in cqlsh;
+   * CONSISTENCY, SERIAL CONSISTENCY, PAGING and TRACING lines apply to the statements after them
+   * until the script ends. Other shell commands are not supported here.
    * @param {string} cql - CQL statement(s) separated by semicolons
    * @param {Object} options - Execution options
    * @param {boolean} [options.stopOnError=false] - Stop execution on first error
-   * @returns {Promise<Object>} { success, data?, error?, statementsCount?, identifiers?, results? }
+   * @param {boolean} [options.force=false] - Run SELECTs the scan guard would refuse (see setScanGuard)
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel(); stops before the next statement
+   * @param {number} [options.previewLength=500] - Characters of each statement echoed in results; negative keeps all
+   * @param {string} [options.similarityScore] - Add the similarity score to vector searches: 'cosine', 'euclidean', 'dot_product' or 'auto'
+   * @returns {Promise<Object>} { success, data?, error?, statementsCount?, identifiers?, descriptors?, results?, cancelled? }
    */
   async executeMulti(cql, options = {}) {
     const trimmed = cql.trim();
@@ -340,6 +453,7 @@ class CQLSession {
         extraTokens: [],
         secondTokens: [],
         thirdTokens: [],
+        descriptors: [],
         data: { message: '' },
         promptInfo: this.getPromptInfo()
       };
@@ -347,7 +461,11 @@ class CQLSession {
 
     // Use Go's native multi-statement execution
     const optionsJSON = JSON.stringify({
-      stopOnError: options.stopOnError || false
+      stopOnError: options.stopOnError || false,
+      force: options.force || false,
+      cancelToken: options.cancelToken || '',
+      previewLength: options.previewLength || 0,
+      similarityScore: options.similarityScore || ''
     });
 
     const response = await callNativeTrueAsync(
@@ -379,6 +497,7 @@ class CQLSession {
         extraTokens: result.extraTokens || [],
         secondTokens: result.secondTokens || [],
         thirdTokens: result.thirdTokens || [],
+        descriptors: result.descriptors || [],
         promptInfo: this.getPromptInfo()
       };
     }
@@ -398,6 +517,7 @@ class CQLSession {
         extraTokens: result.extraTokens,
         secondTokens: result.secondTokens || [],
         thirdTokens: result.thirdTokens || [],
+        descriptors: result.descriptors || [],
         data: this._formatStatementResult(sr),
         promptInfo: this.getPromptInfo()
       };
@@ -405,14 +525,17 @@ class CQLSession {
 
     // Multiple statements
     return {
-      success: !result.stopped,
+      success: !result.stopped && !result.cancelled,
+      code: result.cancelled ? 'CANCELLED' : undefined,
       statementsCount: result.statementsCount,
       statementsExecuted: result.statementsExecuted,
       identifiers: result.identifiers,
       extraTokens: result.extraTokens,
       secondTokens: result.secondTokens || [],
       thirdTokens: result.thirdTokens || [],
+      descriptors: result.descriptors || [],
       stopped: result.stopped,
+      cancelled: result.cancelled || false,
       data: {
         results: (result.results || []).map((sr, idx) => ({
           success: sr.success,
@@ -421,6 +544,7 @@ class CQLSession {
           identifier: sr.identifier,
           secondToken: (result.secondTokens || [])[idx] || '',
           thirdToken: (result.thirdTokens || [])[idx] || '',
+          descriptor: sr.descriptor || null,
           ...this._formatStatementResult(sr)
         }))
       },
@@ -428,12 +552,164 @@ class CQLSession {
     };
   }
 
+  /**
+   * Execute a single CQL statement with settings that apply to this call only
+   * The session's consistency, serial consistency and page size are left as they are.
+   * @param {string} cql - CQL statement
+   * @param {Object} [options]
+   * @param {string} [options.consistency] - Consistency level, e.g. 'QUORUM' or 'LOCAL_ONE'
+   * @param {string} [options.serialConsistency] - 'SERIAL' or 'LOCAL_SERIAL', for conditional statements
+   * @param {number} [options.timeout] - Milliseconds the statement may take, all pages included (default: the session query timeout)
+   * @param {number} [options.pageSize] - Rows per page (default: the session's)
+   * @param {boolean} [options.idempotent] - Whether the driver may retry or speculatively execute the statement
+   *   (default: reads are, writes are not)
+   * @param {Object} [options.display] - Columns of the result to return; the rest are dropped before serialization
+   * @param {string[]} [options.display.columns] - Columns to return, in this order (default: all)
+   * @param {Object<string, string>} [options.display.rename] - Result column -> name to return it under
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel(); abortRunningQuery() works too
+   * @param {Object} [options.resultLimit] - { maxRows, maxBytes } replacing the session's result limit (see setResultLimit)
+   * @param {Object} [options.inSplit] - { maxValues, concurrency } replacing the session's IN list splitting (see setInSplit)
+   * @returns {Promise<Object>} { success, data?, error?, code? }
+   */
+  async executeWithOptions(cql, options = {}) {
+    if (!cql) {
+      return { success: false, error: 'cql is required' };
+    }
+
+    const optionsJSON = JSON.stringify({
+      consistency: options.consistency,
+      serialConsistency: options.serialConsistency,
+      timeout: options.timeout,
+      pageSize: options.pageSize,
+      idempotent: options.idempotent,
+      display: options.display,
+      cancelToken: options.cancelToken,
+      resultLimit: options.resultLimit,
+      inSplit: options.inSplit,
+    });
+    return await callNativeTrueAsync(native.ExecuteQueryWithOptions, this._handle, cql, optionsJSON);
+  }
+
+  /**
+   * Get the full text of a statement shown truncated in an executeMulti() result
+   * @param {string} statementHash - statementHash from the statement result
+   * @returns {Promise<Object>} { success, data?: { statement, statementHash }, error? }
+   */
+  async getStatementText(statementHash) {
+    return await callNativeTrueAsync(native.GetStatementText, this._handle, statementHash);
+  }
+
+  /**
+   * Prepare a statement with bind markers (? or :name) on the server
+   * @param {string} cql - CQL statement
+   * @returns {Promise<Object>} { success, data?: { statementId, query, keyspace?, table?, variables: [{ name, type }], partitionKeyIndexes?, columns? }, error? }
+   */
+  async prepare(cql) {
+    if (!cql) {
+      return { success: false, error: 'cql is required' };
+    }
+
+    return await callNativeTrueAsync(native.PrepareStatement, this._handle, cql);
+  }
+
+  /**
+   * Execute a prepared statement with bind values
+   * Each value is converted to the type of its bind variable: numbers, booleans,
+   * strings (text, uuid, timestamp, 0x blob...), arrays and objects for collections.
+   * @param {string} statementId - statementId returned by prepare()
+   * @param {Array|Object} [values=[]] - Values in bind marker order, or by variable name
+   * @returns {Promise<Object>} { success, data?: { statementId, columns?, columnTypes?, rows?, rowCount, duration, traceSessionId? }, error? }
+   */
+  async executePrepared(statementId, values = []) {
+    if (!statementId) {
+      return { success: false, error: 'statementId is required' };
+    }
+
+    return await callNativeTrueAsync(native.ExecutePrepared, this._handle, statementId, JSON.stringify(values));
+  }
+
+  /**
+   * Forget a prepared statement
+   * @param {string} statementId - statementId returned by prepare()
+   * @returns {Promise<Object>} { success, data?: { closed }, error? }
+   */
+  async closePrepared(statementId) {
+    if (!statementId) {
+      return { success: false, error: 'statementId is required' };
+    }
+
+    return await callNativeTrueAsync(native.ClosePrepared, this._handle, statementId);
+  }
+
+  /**
+   * Run INSERT, UPDATE and DELETE statements as a single BATCH in one round trip
+   * @param {Array<Object>} statements - { query, values? } or { statementId, values? } (from prepare())
+   * @param {Object} [options]
+   * @param {string} [options.type='LOGGED'] - 'LOGGED' (atomic), 'UNLOGGED' or 'COUNTER'
+   * @param {number} [options.timestamp] - Write time in microseconds for every statement
+   * @param {boolean} [options.chunk=false] - Send an UNLOGGED or COUNTER batch larger than the server's
+   *   batch_size_fail_threshold as several batches, in order
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel()
+   * @returns {Promise<Object>} { success, data?: { type, statements, batches?, applied?, rows?, duration, traceSessionId?, warnings? }, error?, code? }
+   */
+  async executeBatch(statements, options = {}) {
+    if (!Array.isArray(statements) || statements.length === 0) {
+      return { success: false, error: 'statements array is required' };
+    }
+
+    const batchJSON = JSON.stringify({
+      type: options.type || 'LOGGED',
+      statements,
+      timestamp: options.timestamp || 0,
+      chunk: options.chunk || false,
+      cancelToken: options.cancelToken || ''
+    });
+    return await callNativeTrueAsync(native.ExecuteBatch, this._handle, batchJSON);
+  }
+
+  /**
+   * Run one line of input as cqlsh would: a special command (DESCRIBE, SHOW, USE,
+   * CONSISTENCY, SERIAL CONSISTENCY, TRACING, EXPAND, PAGING, SOURCE, CAPTURE, COPY)
+   * or a CQL statement. Settings changed here last for the session.
+   * @param {string} command - Input line, with or without a trailing semicolon
+   * @param {Object} [options]
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel()
+   * @param {boolean} [options.stopOnError=false] - SOURCE stops at the first failed statement
+   * @param {boolean} [options.force=false] - Run partition scans the scan guard would refuse
+   * @returns {Promise<Object>} { success, data?: { command, action?, message?, output?, result?, capture?, warnings? }, error?, code? }
+   */
+  async executeShellCommand(command, options = {}) {
+    if (!command || !command.trim()) {
+      return { success: false, error: 'command is required' };
+    }
+
+    const result = await callNativeTrueAsync(native.ExecuteShellCommand, this._handle, command, JSON.stringify({
+      cancelToken: options.cancelToken || '',
+      stopOnError: options.stopOnError || false,
+      force: options.force || false
+    }));
+    if (result.success) {
+      // USE typed directly or run by a sourced file switches the keyspace
+      const data = result.data;
+      const effects = data.command === 'SOURCE' ? (data.result.progress.directives || []) : [data.result];
+      for (const effect of effects) {
+        if (effect && effect.directive === 'USE') {
+          this._keyspace = effect.value;
+        }
+      }
+    }
+    return result;
+  }
+
   /**
    * Format a StatementResult from Go into the expected data format
    * @private
    */
   _formatStatementResult(sr) {
     return {
+      statement: sr.statement || '',
+      statementHash: sr.statementHash || '',
+      truncated: sr.truncated || false,
       columns: sr.columns || [],
       columnTypes: sr.columnTypes || [],
       rows: sr.rows || [],
@@ -442,7 +718,13 @@ class CQLSession {
       message: sr.message || '',
       traceSessionId: sr.traceSessionId,
       keyspace: sr.keyspace,
-      table: sr.table
+      table: sr.table,
+      applied: sr.applied,
+      scanEstimate: sr.scanEstimate,
+      score: sr.score,
+      directive: sr.directive,
+      settings: sr.settings,
+      warnings: sr.warnings
     };
   }
 
@@ -452,12 +734,8 @@ class CQLSession {
    */
   _updateKeyspaceFromResults(results) {
     for (const sr of results) {
-      if (sr.identifier === 'USE' && sr.success && sr.message) {
-        // Extract keyspace from "Now using keyspace X"
-        const match = sr.message.match(/Now using keyspace (\w+)/i);
-        if (match) {
-          this._keyspace = match[1];
-        }
+      if (sr.success && sr.directive && sr.directive.directive === 'USE') {
+        this._keyspace = sr.directive.value;
       }
     }
   }
@@ -465,16 +743,22 @@ class CQLSession {
   /**
    * Fetch the next page of results for a paged query
    * @param {string} queryId - The query ID returned from execute() (when hasMore is true)
-   * @returns {Promise<Object>} { success, data?: { columns, columnTypes, rows, rowCount, hasMore, queryId }, error? }
+   * @param {Object} [options]
+   * @param {Function} [options.onFetchProgress] - With auto-fetch on, called with { rows, pages, maxRows, running, truncated, elapsedMs } while pages are read
+   * @returns {Promise<Object>} { success, data?: { columns, columnTypes, rows, rowCount, hasMore, truncated?, queryId }, error? }
    *
    * If hasMore is false, the query is automatically closed and queryId is cleared.
+   * With auto-fetch on (setAutoFetch), every remaining page is read up to the row cap.
+   * Fails with code SCHEMA_CHANGED (and closes the query) if its keyspace or table was dropped.
    */
-  async fetchNextPage(queryId) {
+  async fetchNextPage(queryId, options = {}) {
     if (!queryId) {
       return { success: false, error: 'queryId is required' };
     }
 
-    return await callNativeTrueAsync(native.FetchNextPage, this._handle, queryId);
+    return await this._withFetchProgress(options.onFetchProgress, () =>
+      callNativeTrueAsync(native.FetchNextPage, this._handle, queryId)
+    );
   }
 
   /**
@@ -494,523 +778,1702 @@ class CQLSession {
   /**
    * Cancel any active queries on this session
    * Used for handling user interrupts (CTRL+C / SIGINT)
-   * @returns {Promise<Object>} { success, data?: { cancelledQueries: number }, error? }
+   * @returns {Promise<Object>} { success, data?: { cancelledQueries: number, cancelledMultiQueries: number, cancelledScans: number, cancelledQueued: number, cancelledAsyncQueries: number, abortedQueries: number }, error? }
    */
   async cancelQuery() {
     return await callNativeTrueAsync(native.CancelQuery, this._handle);
   }
 
   /**
-   * Handle shell commands - dispatch by identifier from CQL splitter
-   * Pattern: identifier = first token from splitter, handler = _do_<identifier>
-   * @private
-   * @param {string} identifier - Statement identifier from CQL splitter (properly tokenized)
-   * @param {string} original - Original command string (for argument parsing)
-   * @returns {Object|null} Response object or null if not a shell command
+   * Interrupt the statements this session is running through execute() and
+   * executeWithOptions(). The request in flight is abandoned, so each one
+   * fails at once with code CANCELLED; a write the coordinator already
+   * received may still be applied.
+   * @returns {Promise<Object>} { success, data?: { abortedQueries: number }, error? }
    */
-  async _handleShellCommand(identifier, original) {
-    // Use identifier from CQL splitter for command dispatch
-    // The splitter properly handles comments, whitespace, etc.
-    let cmdword = (identifier || '').toLowerCase();
+  async abortRunningQuery() {
+    return await callNativeTrueAsync(native.AbortRunningQuery, this._handle);
+  }
 
-    // Handle ? -> help (like Python: if cmdword == '?': cmdword = 'help')
-    if (cmdword === '?') {
-      cmdword = 'help';
+  /**
+   * Start a query in the background and return its query ID at once
+   * Unlike execute(), the native call returns immediately; poll the ID with
+   * pollQueryResult() until its status is no longer 'running'.
+   * @param {string} cql - CQL statement
+   * @param {Object} [options]
+   * @param {boolean} [options.force] - Run a partition scan the scan guard would refuse
+   * @param {string} [options.cancelToken] - Query ID to use, so cancel(token) can stop it too (default: one is issued)
+   * @returns {Promise<Object>} { success, data?: { queryId }, error? }
+   */
+  async executeAsync(cql, options = {}) {
+    if (!cql) {
+      return { success: false, error: 'cql is required' };
     }
 
-    // Dispatch to handler based on identifier
-    const handler = this['_do_' + cmdword];
-    if (handler) {
-      // Parse original for arguments (handlers need parts[1], parts[2], etc.)
-      const parts = original.trim().split(/\s+/);
-      return handler.call(this, parts, original);
+    const optionsJSON = JSON.stringify({
+      force: options.force || false,
+      cancelToken: options.cancelToken || '',
+    });
+    return await callNativeTrueAsync(native.ExecuteQueryAsync, this._handle, cql, optionsJSON);
+  }
+
+  /**
+   * Get the status of a query started with executeAsync()
+   * The result is returned once, by the first poll after the query finished;
+   * the query ID is forgotten after that.
+   * @param {string} queryId - The query ID returned from executeAsync()
+   * @returns {Promise<Object>} { success, data?: { queryId, status: 'running'|'completed'|'failed'|'cancelled', elapsedMs, result?: { success, error?, code?, columns, rows, rowCount, ... } }, error? }
+   */
+  async pollQueryResult(queryId) {
+    if (!queryId) {
+      return { success: false, error: 'queryId is required' };
     }
 
-    // Not a shell command
-    return null;
+    const response = await callNativeTrueAsync(native.PollQueryResult, this._handle, queryId);
+    const sr = response.success && response.data.result;
+    if (sr) {
+      response.data.result = {
+        success: sr.success,
+        error: sr.error,
+        code: sr.errorCode,
+        ...this._formatStatementResult(sr)
+      };
+    }
+    return response;
   }
 
-  // ============================================
-  // Shell Command Handlers (do_<command> pattern from Python cqlsh)
-  // ============================================
-
   /**
-   * CONSISTENCY [level] - Show or set consistency level
-   * From cqlshmain.py do_consistency()
-   * Note: Only shows/sets REGULAR consistency, not serial
+   * Cancel a query started with executeAsync()
+   * A statement already sent to the server is abandoned rather than
+   * interrupted: the query reports 'cancelled' and its late result is dropped.
+   * @param {string} queryId - The query ID returned from executeAsync()
+   * @returns {Promise<Object>} { success, data?: { queryId, status, elapsedMs }, error? }
    */
-  async _do_consistency(parts, original) {
-    const level = parts[1]?.replace(/;$/, '').toUpperCase();
-
-    if (!level) {
-      // Show current consistency (regular only, matching Python cqlsh behavior)
-      const info = await this.getInfo();
-      if (info.success) {
-        const consistency = info.data.consistency;
-        return this._textResponse(
-          `Current consistency level is ${consistency}.`,
-          {
-            command: 'consistency',
-            action: 'show',
-            consistency: consistency
-          }
-        );
-      }
-      return { success: false, error: 'Failed to get session info' };
+  async cancelAsyncQuery(queryId) {
+    if (!queryId) {
+      return { success: false, error: 'queryId is required' };
     }
 
-    // Set consistency
-    const result = await callNativeAsync(() => native.SetConsistency(this._handle, level));
-    if (result.success) {
-      return this._textResponse(
-        `Consistency level set to ${level}.`,
-        {
-          command: 'consistency',
-          action: 'set',
-          consistency: level
-        }
-      );
+    return await callNativeTrueAsync(native.CancelAsyncQuery, this._handle, queryId);
+  }
+
+  /**
+   * Open a flow-controlled stream of a SELECT's rows, a COPY TO job's progress
+   * or schema events
+   * The stream queues at most as many items as it has credits for and then
+   * pauses its producer, so a slow consumer cannot make the native side
+   * buffer without bound. Read items with readStream() and grant more
+   * credits as they are consumed.
+   * @param {Object} options
+   * @param {string} options.kind - 'rows', 'copyProgress' or 'schemaEvents'
+   * @param {number} [options.credits] - Items the stream may queue before the first read (default: 100)
+   * @param {string} [options.query] - SELECT to stream (kind 'rows')
+   * @param {boolean} [options.force] - Run a partition scan the scan guard would refuse (kind 'rows')
+   * @param {string} [options.cancelToken] - Stream ID to use, so cancel(token) can stop it too (kind 'rows')
+   * @param {string} [options.jobId] - COPY TO job started with a jobId (kind 'copyProgress')
+   * @param {number} [options.intervalMs] - Progress sampling interval (kind 'copyProgress', default: 500)
+   * @param {string[]} [options.keyspaces] - Only events for these keyspaces (kind 'schemaEvents')
+   * @param {string[]} [options.targets] - Only these targets: KEYSPACE, TABLE, TYPE, FUNCTION, AGGREGATE (kind 'schemaEvents')
+   * @returns {Promise<Object>} { success, data?: { streamId, kind, credits, buffered, bufferedBytes, paused, delivered, dropped? }, error? }
+   */
+  async openStream(options) {
+    if (!options || !options.kind) {
+      return { success: false, error: 'kind is required' };
     }
-    return { success: false, error: `Invalid consistency level: ${level}` };
+
+    return await callNativeTrueAsync(native.OpenStream, this._handle, JSON.stringify(options));
   }
 
   /**
-   * SERIAL CONSISTENCY [level] - Show or set serial consistency level
-   * From cqlshmain.py do_serial()
-   * Note: Command is "SERIAL CONSISTENCY" but handler is do_serial (first word)
+   * Read the items a stream has queued
+   * @param {string} streamId - The stream ID returned from openStream()
+   * @param {Object} [options]
+   * @param {number} [options.max] - Most items to return (default: all queued)
+   * @param {number} [options.waitMs] - Wait up to this long for an item when none is queued (max: 30000)
+   * @param {number} [options.grant] - Credits to add after reading
+   * @param {number} [options.window] - Top credits up so that credits plus queued items reach this
+   * @returns {Promise<Object>} { success, data?: { streamId, credits, buffered, paused, delivered, columns?, columnTypes?, items, done, error?, errorCode? }, error? }
    */
-  async _do_serial(parts, original) {
-    // parts[0] = SERIAL, parts[1] = CONSISTENCY, parts[2] = level (optional)
-    const level = parts[2]?.replace(/;$/, '').toUpperCase();
+  async readStream(streamId, options = {}) {
+    if (!streamId) {
+      return { success: false, error: 'streamId is required' };
+    }
 
-    if (!level) {
-      // Show current serial consistency
-      const info = await this.getInfo();
-      if (info.success) {
-        const serialConsistency = info.data.serialConsistency || 'SERIAL';
-        return this._textResponse(
-          `Current serial consistency level is ${serialConsistency}.`,
-          {
-            command: 'serial',
-            action: 'show',
-            serialConsistency: serialConsistency
-          }
-        );
-      }
-      return { success: false, error: 'Failed to get session info' };
+    return await callNativeTrueAsync(native.ReadStream, this._handle, streamId, JSON.stringify(options));
+  }
+
+  /**
+   * Let a stream queue more items
+   * @param {string} streamId - The stream ID returned from openStream()
+   * @param {number} credits - Items to add
+   * @returns {Promise<Object>} { success, data?: { streamId, credits, buffered, paused, ... }, error? }
+   */
+  async grantStreamCredits(streamId, credits) {
+    if (!streamId) {
+      return { success: false, error: 'streamId is required' };
     }
 
-    // Validate level
-    if (level !== 'SERIAL' && level !== 'LOCAL_SERIAL') {
-      return { success: false, error: `Invalid serial consistency level: ${level}. Valid levels are: SERIAL, LOCAL_SERIAL.` };
+    return await callNativeAsync(native.GrantStreamCredits, this._handle, streamId, credits);
+  }
+
+  /**
+   * Close a stream, stopping its producer and dropping its queued items
+   * @param {string} streamId - The stream ID returned from openStream()
+   * @returns {Promise<Object>} { success, data?: { streamId, delivered, ... }, error? }
+   */
+  async closeStream(streamId) {
+    if (!streamId) {
+      return { success: false, error: 'streamId is required' };
     }
 
-    // Set serial consistency (would need Go binding for SetSerialConsistency)
-    // For now, just acknowledge - TODO: add SetSerialConsistency to Go bindings
-    return this._textResponse(
-      `Serial consistency level set to ${level}.`,
-      {
-        command: 'serial',
-        action: 'set',
-        serialConsistency: level
-      }
-    );
+    return await callNativeAsync(native.CloseStream, this._handle, streamId);
   }
 
   /**
-   * PAGING [ON|OFF|number] - Show or set query paging
-   * From cqlshmain.py do_paging()
+   * Open a stream as a Node.js Readable in object mode
+   * Credits follow the Readable's own backpressure: the native side queues no
+   * more than highWaterMark items, and only refills as the consumer reads.
+   * @param {Object} options - openStream() options
+   * @param {number} [options.highWaterMark] - Items buffered on each side (default: 100)
+   * @returns {Readable} Emits rows, progress samples or schema events; 'columns' carries the columns of a row stream
    */
-  async _do_paging(parts, original) {
-    const value = parts[1]?.replace(/;$/, '');
+  createReadableStream(options) {
+    const window = options.highWaterMark || 100;
+    const openOptions = { ...options, credits: window };
+    delete openOptions.highWaterMark;
+
+    let streamId = null;
+    const session = this;
+    const stream = new Readable({
+      objectMode: true,
+      highWaterMark: window,
+
+      async read(size) {
+        try {
+          if (!streamId) {
+            const opened = await session.openStream(openOptions);
+            if (!opened.success) {
+              throw new Error(opened.error);
+            }
+            streamId = opened.data.streamId;
+          }
 
-    if (!value) {
-      // Show current paging state
-      const info = await this.getInfo();
-      if (info.success) {
-        const pageSize = info.data.pageSize;
-        const enabled = pageSize > 0;
-        return this._textResponse(
-          enabled ? `Page size: ${pageSize}` : 'Disabled paging.',
-          {
-            command: 'paging',
-            action: 'show',
-            enabled: enabled,
-            pageSize: pageSize
+          for (;;) {
+            const read = await session.readStream(streamId, { max: size, waitMs: 1000, window });
+            if (!read.success) {
+              throw new Error(read.error);
+            }
+            const batch = read.data;
+            if (batch.columns && !stream._columnsEmitted) {
+              stream._columnsEmitted = true;
+              stream.emit('columns', { columns: batch.columns, columnTypes: batch.columnTypes });
+            }
+            for (const item of batch.items) {
+              this.push(item);
+            }
+            if (batch.error) {
+              const err = new Error(batch.error);
+              err.code = batch.errorCode;
+              throw err;
+            }
+            if (batch.done) {
+              this.push(null);
+              return;
+            }
+            if (batch.items.length > 0 || stream.destroyed) {
+              return;
+            }
           }
-        );
-      }
-      return { success: false, error: 'Failed to get session info' };
-    }
+        } catch (err) {
+          this.destroy(err);
+        }
+      },
 
-    // Set paging
-    const result = await callNativeAsync(() => native.SetPaging(this._handle, value));
-    if (result.success) {
-      const pageSize = result.data.pageSize || 0;
-      const enabled = result.data.paging !== 'OFF' && pageSize > 0;
-      return this._textResponse(
-        enabled ? `Page size: ${pageSize}` : 'Disabled paging.',
-        {
-          command: 'paging',
-          action: 'set',
-          enabled: enabled,
-          pageSize: pageSize
+      destroy(err, callback) {
+        if (!streamId) {
+          callback(err);
+          return;
         }
-      );
-    }
-    return { success: false, error: `Invalid paging value: ${value}` };
+        session.closeStream(streamId).finally(() => callback(err));
+      }
+    });
+    return stream;
   }
 
   /**
-   * TRACING [ON|OFF] - Show or set tracing
-   * From cqlshmain.py do_tracing()
+   * Browse a table page by page using keyset pagination on the primary key
+   * Unlike fetchNextPage(), no iterator is kept open: each page is fetched with
+   * WHERE clauses built from the last row's key, so cursors survive restarts
+   * and can be used to go back a page.
+   * @param {string} table - Table name
+   * @param {Object} [options] - Browse options
+   * @param {string} [options.keyspace] - Keyspace name (default: current keyspace)
+   * @param {string[]} [options.columns] - Columns to select (primary key columns are always included)
+   * @param {number} [options.pageSize] - Rows per page (default: session page size, then 100)
+   * @param {string} [options.cursor] - nextCursor or prevCursor from a previous page
+   * @param {boolean} [options.includeTTL] - Add 'ttl(col)' and 'writetime(col)' fields to each row for the selected columns
+   * @param {string[]} [options.projections] - Paths into UDT and collection columns (e.g. 'address.city', 'phones[0].number') returned as extra columns
+   * @returns {Promise<Object>} { success, data?: { columns, columnTypes, rows, rowCount, hasMore, pageNumber, nextCursor?, prevCursor?, keyspace, table, ttlColumns?, projections? }, error? }
    */
-  async _do_tracing(parts, original) {
-    const value = parts[1]?.replace(/;$/, '').toUpperCase();
+  async browseTable(table, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
 
-    if (!value) {
-      // Show current tracing state
-      const info = await this.getInfo();
-      if (info.success) {
-        const enabled = info.data.tracing;
-        return this._textResponse(
-          `TRACING is ${enabled ? 'ON' : 'OFF'}`,
-          { command: 'tracing', action: 'show', enabled: enabled }
-        );
-      }
-      return { success: false, error: 'Failed to get session info' };
+    const optionsJSON = JSON.stringify({ ...options, table });
+    return await callNativeTrueAsync(native.BrowseTable, this._handle, optionsJSON);
+  }
+
+  /**
+   * Read a sample of a table's rows for a preview
+   * 'first' reads the first rows in token order, 'random' reads short runs of
+   * rows from random token ranges (Murmur3 partitioner only) and 'last' reads
+   * the last rows of one partition by reversing its clustering order. Use
+   * getSampleModes() to find which modes a table supports.
+   * @param {string} table - Table name
+   * @param {Object} [options] - Sample options
+   * @param {string} [options.keyspace] - Keyspace name (default: current keyspace)
+   * @param {string} [options.mode] - 'first' (default), 'random' or 'last'
+   * @param {number} [options.limit] - Rows to return (default: 100, at most 10000)
+   * @param {string[]} [options.columns] - Columns to select (default: all)
+   * @param {Object} [options.partition] - Partition key values; required for 'last', optional for 'first'
+   * @returns {Promise<Object>} { success, data?: { keyspace, table, mode, columns, columnTypes, rows, rowCount, query? }, error? }
+   */
+  async sampleTable(table, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
     }
 
-    // Set tracing
-    if (value === 'ON') {
-      const result = await callNativeAsync(() => native.SetTracing(this._handle, 1));
-      if (result.success) {
+    const optionsJSON = JSON.stringify({ ...options, table });
+    return await callNativeTrueAsync(native.SampleTable, this._handle, optionsJSON);
+  }
+
+  /**
+   * Report which sampleTable() modes a table supports
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @returns {Promise<Object>} { success, data?: [{ mode, available, needsPartition?, reason? }], error? }
+   */
+  async getSampleModes(keyspace, table) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+
+    return await callNativeTrueAsync(native.GetSampleModes, this._handle, keyspace || '', table);
+  }
+
+  /**
+   * Read row-level changes from the CDC log
+   * Parses the commit log segments Cassandra keeps in its cdc_raw directory for
+   * tables with cdc=true. The directory must be readable from this machine (a
+   * local node, a mounted volume or a copied directory); mutations are decoded
+   * with this session's schema.
+   * @param {Object} [options] - CDC options
+   * @param {string} [options.directory] - cdc_raw directory (default: the node's cdc_raw_directory setting, then the usual install locations)
+   * @param {string} [options.keyspace] - Only changes to this keyspace
+   * @param {string} [options.table] - Only changes to this table (keyspace defaults to the current one)
+   * @param {number} [options.limit] - Changes per call (default: 100, max: 1000)
+   * @param {string} [options.cursor] - nextCursor from a previous call
+   * @returns {Promise<Object>} { success, data?: { directory, cdcTables, segments, changes, errors?, nextCursor? }, error?, code? }
+   */
+  async browseCDC(options = {}) {
+    return await callNativeTrueAsync(native.BrowseCDC, this._handle, JSON.stringify(options));
+  }
+
+  /**
+   * Compare a sample of rows between two tables, e.g. a migration source and target.
+   * Rows are sampled from this session's table, looked up by primary key in the
+   * other table and diffed column by column.
+   * @param {string} table - Source table ('keyspace.table' or a table in the current keyspace)
+   * @param {CQLSession} target - Session holding the target table (may be this session)
+   * @param {string} targetTable - Target table ('keyspace.table' or a table in the target's keyspace)
+   * @param {Object} [spec] - Sampling and tolerance options
+   * @param {number} [spec.sampleSize=1000] - Rows to sample (max 100000)
+   * @param {string[]} [spec.columns] - Columns to compare (default: all non-key columns in both tables)
+   * @param {number} [spec.timestampToleranceMs=0] - Allowed timestamp difference
+   * @param {number} [spec.floatTolerance=0] - Allowed absolute difference for float, double and decimal
+   * @param {number} [spec.maxMismatches=100] - Mismatched rows reported in detail
+   * @returns {Promise<Object>} { success, data?: { source, target, sampling, columns, sampled, matched, mismatched, missingInTarget, columnMismatches?, mismatches, truncated?, durationMs }, error? }
+   */
+  async compareTables(table, target, targetTable, spec = {}) {
+    if (!table || !targetTable) {
+      return { success: false, error: 'Both tables are required' };
+    }
+    if (!target || target._handle === undefined) {
+      return { success: false, error: 'target session is required' };
+    }
+
+    return await callNativeTrueAsync(native.CompareTables, this._handle, table, target._handle, targetTable, JSON.stringify(spec));
+  }
+
+  /**
+   * Plan the statements that bring this session's cluster to a target schema,
+   * e.g. a schema file kept in version control
+   * @param {string|Object} target - CREATE statements, or a getClusterMetadata() result's data
+   * @param {Object} [options] - Planning options
+   * @param {string[]} [options.keyspaces] - Plan only these keyspaces (default: those of the target)
+   * @param {boolean} [options.allowDrops=false] - Plan drops of objects the target does not have
+   * @returns {Promise<Object>} { success, data?: { identical, changes, statements, warnings, skipped? }, error?, code? }
+   */
+  async planSchemaMigration(target, options = {}) {
+    if (!target) {
+      return { success: false, error: 'target schema is required' };
+    }
+
+    const schema = typeof target === 'string' ? { cql: target } : { metadata: target };
+    return await callNativeTrueAsync(native.PlanSchemaMigration, this._handle, JSON.stringify({ ...options, ...schema }));
+  }
+
+  /**
+   * Find partitions with rows matching a predicate on any columns by scanning the
+   * table's token ranges and filtering client-side. This reads the whole table:
+   * the scan is rate limited, stops at maxRowsScanned or maxDurationMs, and can be
+   * resumed from nextToken or stopped with cancelQuery().
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @param {Object} predicate - Conditions and scan limits
+   * @param {Object[]} predicate.conditions - { column, op, value? }; op is =, !=, <, <=, >, >=, contains, matches, isNull or isNotNull
+   * @param {string} [predicate.match='all'] - 'all' or 'any' of the conditions
+   * @param {number} [predicate.rowsPerSecond=2000] - Read rate limit
+   * @param {number} [predicate.maxRowsScanned=1000000] - Stop after reading this many rows
+   * @param {number} [predicate.maxDurationMs=300000] - Stop after this long
+   * @param {number} [predicate.pageSize=500] - Rows per page
+   * @param {number} [predicate.startToken] - nextToken from a previous incomplete scan
+   * @param {string} [predicate.cancelToken] - Token for CQLSession.cancel()
+   * @param {number} [maxResults=100] - Stop after this many matching partitions
+   * @returns {Promise<Object>} { success, data?: { partitions, rowsScanned, rangesScanned, rangesTotal, complete, stopReason?, nextToken?, estimatedRows?, durationMs, warnings }, error? }
+   */
+  async findPartitions(keyspace, table, predicate, maxResults = 100) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+    if (!predicate || !Array.isArray(predicate.conditions) || predicate.conditions.length === 0) {
+      return { success: false, error: 'predicate.conditions is required' };
+    }
+
+    return await callNativeTrueAsync(native.FindPartitions, this._handle, keyspace || '', table, JSON.stringify(predicate), maxResults);
+  }
+
+  /**
+   * Count the rows of a table exactly. The token ring is split into ranges that
+   * are counted with separate SELECT COUNT(*) queries, several at a time, so
+   * large tables do not time out on a single coordinator.
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @param {Object} [options] - Count options
+   * @param {number} [options.splits=256] - Token ranges to count separately
+   * @param {number} [options.concurrency=8] - Ranges counted at once (max 64)
+   * @param {string} [options.consistency] - Consistency level for the range queries
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel(); cancelQuery() works too
+   * @param {Function} [options.onProgress] - Called with { count, rangesCounted, rangesTotal, running, elapsedMs } while counting
+   * @returns {Promise<Object>} { success, data?: { keyspace, table, count, rangesCounted, rangesTotal, rangesRetried?, complete, stopReason?, estimatedRows?, durationMs, warnings }, error? }
+   */
+  async countTable(keyspace, table, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+
+    const { onProgress, ...countOptions } = options;
+    const optionsJSON = JSON.stringify(countOptions);
+    if (!onProgress) {
+      return await callNativeTrueAsync(native.CountTable, this._handle, keyspace || '', table, optionsJSON);
+    }
+
+    const pollProgress = async () => {
+      const progressResult = await callNativeAsync(() => native.GetCountProgress(this._handle));
+      if (progressResult.success && progressResult.data) {
+        onProgress(progressResult.data);
+      }
+    };
+    const pollTimer = setInterval(pollProgress, 250);
+
+    try {
+      const result = await callNativeTrueAsync(native.CountTable, this._handle, keyspace || '', table, optionsJSON);
+      await pollProgress();
+      return result;
+    } finally {
+      clearInterval(pollTimer);
+    }
+  }
+
+  /**
+   * Measure write latency with synthetic rows, once per consistency level and
+   * concurrency. The table is created for the benchmark (in a scratch keyspace
+   * unless tableSpec.keyspace is given) and dropped afterwards.
+   * @param {Object} [tableSpec] - Synthetic table
+   * @param {string} [tableSpec.keyspace] - Keyspace for the table (default: a new scratch keyspace)
+   * @param {number} [tableSpec.valueColumns=4] - Text columns per row (max 32)
+   * @param {number} [tableSpec.valueSize=100] - Bytes per value (max 65536)
+   * @param {number} [tableSpec.rowsPerPartition=1] - Rows written to each partition
+   * @param {Object} [options] - Runs and limits
+   * @param {string[]} [options.consistencyLevels=['ONE','LOCAL_QUORUM']] - Consistency levels to measure
+   * @param {number[]} [options.concurrency=[1,8]] - Requests in flight (max 256)
+   * @param {number} [options.requests=1000] - Measured requests per run (max 100000)
+   * @param {number} [options.ratePerSecond=500] - Request rate limit per run (max 50000)
+   * @param {number} [options.maxDurationMs=60000] - Hard limit for the whole benchmark (max 600000)
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel(); cancelQuery() works too
+   * @returns {Promise<Object>} { success, data?: { keyspace, table, scratchSpace?, runs, complete, stopReason?, cleanupError?, ratePerSecond, durationMs, warnings }, error? }
+   */
+  async benchmarkWrites(tableSpec = {}, options = {}) {
+    return await callNativeTrueAsync(native.BenchmarkWrites, this._handle, JSON.stringify(tableSpec), JSON.stringify(options));
+  }
+
+  /**
+   * Measure read latency against an existing table, once per consistency level
+   * and concurrency. Partition keys are sampled from random positions of the
+   * token ring and read in turn.
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @param {Object} [options] - Runs and limits; takes the benchmarkWrites() options plus:
+   * @param {number} [options.sampleKeys=1000] - Partition keys to sample (max 10000)
+   * @param {number} [options.rowsPerRead=100] - LIMIT of each partition read
+   * @returns {Promise<Object>} { success, data?: { keyspace, table, sampledKeys, runs, complete, stopReason?, serverVersion, datacenter, replication?, ratePerSecond, durationMs, warnings }, error? }
+   */
+  async benchmarkReads(keyspace, table, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+    return await callNativeTrueAsync(native.BenchmarkReads, this._handle, keyspace || '', table, JSON.stringify(options));
+  }
+
+  /**
+   * Fill an existing table with synthetic rows. Every column gets values of its
+   * type, UDTs, collections and vectors included. Rows derive from the seed, so
+   * passing the reported seed again generates the same rows.
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @param {Object} [options] - Generation options
+   * @param {number} [options.rows=1000] - Rows to insert (max 10000000)
+   * @param {number} [options.rowsPerPartition=1] - Rows of each partition
+   * @param {Object} [options.columns] - Per column settings by name: { distribution, min, max, mean, stddev, skew, nullRate, minLength, maxLength, values }
+   * @param {number} [options.seed] - Seed of the rows (default random)
+   * @param {number} [options.concurrency=8] - Inserts in flight (max 256)
+   * @param {number} [options.ratePerSecond] - Insert rate limit (default unlimited)
+   * @param {string} [options.consistency] - Consistency of the inserts (default the session's)
+   * @param {number} [options.ttlSeconds] - TTL of the inserted rows
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel(); cancelQuery() works too
+   * @returns {Promise<Object>} { success, data?: { keyspace, table, seed, rowsRequested, rowsWritten, partitions, errors, errorTypes?, firstError?, complete, stopReason?, durationMs, rowsPerSecond, warnings }, error? }
+   */
+  async generateTestData(keyspace, table, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+    return await callNativeTrueAsync(native.GenerateTestData, this._handle, keyspace || '', table, JSON.stringify(options));
+  }
+
+  /**
+   * Create a uniquely named keyspace for trying out DDL and data without
+   * touching application keyspaces. It is dropped when the session is closed.
+   * @param {Object} [options] - Scratch space options
+   * @param {number} [options.ttlSeconds=86400] - Lease; afterwards the space counts as expired
+   * @param {number} [options.replicationFactor=1] - Replicas in the local datacenter (max 3)
+   * @param {boolean} [options.keepOnClose=false] - Keep the space when the session is closed
+   * @returns {Promise<Object>} { success, data?: { keyspace, datacenter, replicationFactor, createdAt, expiresAt, createdBy, tables, expired, ownedBySession, keepOnClose? }, error? }
+   */
+  async createScratchSpace(options = {}) {
+    return await callNativeTrueAsync(native.CreateScratchSpace, this._handle, JSON.stringify(options));
+  }
+
+  /**
+   * List the scratch keyspaces on the cluster, including those of other
+   * sessions and abandoned ones whose lease has expired
+   * @returns {Promise<Object>} { success, data?: Array<{ keyspace, createdAt?, expiresAt?, createdBy?, tables, expired, ownedBySession }>, error? }
+   */
+  async listScratchSpaces() {
+    return await callNativeTrueAsync(native.ListScratchSpaces, this._handle);
+  }
+
+  /**
+   * Drop scratch keyspaces. Without options the spaces created by this session
+   * are dropped.
+   * @param {Object} [options] - Spaces to drop
+   * @param {string} [options.keyspace] - Drop this scratch space
+   * @param {boolean} [options.expired=false] - Drop every expired scratch space
+   * @returns {Promise<Object>} { success, data?: { dropped, errors? }, error? }
+   */
+  async cleanupScratchSpaces(options = {}) {
+    return await callNativeTrueAsync(native.CleanupScratchSpaces, this._handle, JSON.stringify(options));
+  }
+
+  /**
+   * Insert rows given as plain objects. A key set to null deletes that cell,
+   * which writes a tombstone; a key that is absent leaves the column unset and
+   * keeps any existing value. Values are converted by the server (INSERT JSON),
+   * so strings, numbers, arrays and objects are accepted for any column type.
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @param {Object[]} rows - Rows to insert
+   * @param {Object} [options] - Write options
+   * @param {string} [options.missing='unset'] - Absent keys: 'unset' keeps existing values, 'null' deletes them
+   * @param {string} [options.nulls='write'] - Null values: 'write' deletes the cell, 'unset' treats null as absent
+   * @param {number} [options.warnNullCells=1000] - Warn when more null cells than this are written (-1 disables)
+   * @param {boolean} [options.stopOnError=false] - Stop at the first failed row
+   * @param {number} [options.ttl] - USING TTL seconds
+   * @param {number} [options.timestamp] - USING TIMESTAMP microseconds
+   * @returns {Promise<Object>} { success, data?: { inserted, failed, nullCells, unsetNulls, missingAction, errors?, warnings?, durationMs }, error? }
+   */
+  async insertRows(keyspace, table, rows, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+    if (!Array.isArray(rows)) {
+      return { success: false, error: 'rows must be an array' };
+    }
+
+    return await callNativeTrueAsync(native.InsertRows, this._handle, keyspace || '', table, JSON.stringify(rows), JSON.stringify(options));
+  }
+
+  /**
+   * Delete a whole partition with a single partition tombstone. The rows in
+   * the partition are counted first; above options.confirmAbove the delete is
+   * refused with code CONFIRMATION_REQUIRED and the plan in data.
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @param {Object} key - Value of every partition key column
+   * @param {Object} [options] - Delete options
+   * @param {boolean} [options.confirm=false] - Allow deletes above confirmAbove rows
+   * @param {number} [options.confirmAbove=1000] - Row count that requires confirm (0 always requires it)
+   * @param {boolean} [options.dryRun=false] - Return the plan without deleting
+   * @param {number} [options.timestamp] - USING TIMESTAMP microseconds
+   * @returns {Promise<Object>} { success, data?: { statement, strategy, rowsAffected, tombstones, gcGraceSeconds, views?, confirmationRequired, executed, warnings?, durationMs }, error?, code? }
+   */
+  async deletePartition(keyspace, table, key, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+    if (!key || typeof key !== 'object') {
+      return { success: false, error: 'key must be an object' };
+    }
+
+    return await callNativeTrueAsync(native.DeletePartition, this._handle, keyspace || '', table, JSON.stringify(key), JSON.stringify(options));
+  }
+
+  /**
+   * Delete the rows under a clustering prefix, optionally bounded on the next
+   * clustering column, with a single range tombstone instead of one tombstone
+   * per row. Servers before Cassandra 3.0 fall back to row-by-row deletes.
+   * Confirmation works as in deletePartition.
+   * @param {string} keyspace - Keyspace name (empty: current keyspace)
+   * @param {string} table - Table name
+   * @param {Object} key - Partition key columns plus any leading clustering columns
+   * @param {Object} [range] - Bounds on the clustering column after the key prefix
+   * @param {string} range.column - That clustering column
+   * @param {*} [range.from] - Lower bound (omit for none)
+   * @param {*} [range.to] - Upper bound (omit for none)
+   * @param {boolean} [range.fromInclusive=true] - Include the lower bound
+   * @param {boolean} [range.toInclusive=false] - Include the upper bound
+   * @param {Object} [options] - Same as deletePartition
+   * @returns {Promise<Object>} { success, data?: DeletePlan, error?, code? }
+   */
+  async deleteRange(keyspace, table, key, range = null, options = {}) {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+    if (!key || typeof key !== 'object') {
+      return { success: false, error: 'key must be an object' };
+    }
+
+    return await callNativeTrueAsync(native.DeleteRange, this._handle, keyspace || '', table, JSON.stringify(key), range ? JSON.stringify(range) : '', JSON.stringify(options));
+  }
+
+  /**
+   * Build a SELECT for a grouping/limit spec. GROUP BY and PER PARTITION LIMIT are
+   * generated when the table's primary key and the server version allow it;
+   * otherwise the result lists what must be applied client-side.
+   * @param {Object} spec - Select specification
+   * @param {string} spec.table - Table name
+   * @param {string} [spec.keyspace] - Keyspace (default: current keyspace)
+   * @param {string[]} [spec.columns] - Columns to select
+   * @param {string[]} [spec.where] - CQL conditions, joined with AND
+   * @param {string[]} [spec.groupBy] - Columns to group by
+   * @param {Array<{function: string, column: string, alias?: string}>} [spec.aggregates] - Aggregates per group
+   * @param {number} [spec.perPartitionLimit] - Maximum rows per partition
+   * @param {number} [spec.limit] - Maximum rows overall
+   * @param {boolean} [spec.allowFiltering] - Append ALLOW FILTERING
+   * @param {boolean} [spec.bypassCache] - Append BYPASS CACHE (ScyllaDB only; left out with a warning on Cassandra)
+   * @param {string} [spec.timeout] - Append USING TIMEOUT with this duration, e.g. '500ms' (ScyllaDB only)
+   * @returns {Promise<Object>} { success, data?: { query, groupByPushedDown, perPartitionLimitPushedDown, clientSideGroupBy?, clientSideAggregates?, clientSidePerPartitionLimit?, warnings? }, error? }
+   */
+  async buildSelectQuery(spec) {
+    if (!spec || !spec.table) {
+      return { success: false, error: 'table is required' };
+    }
+
+    return await callNativeTrueAsync(native.BuildSelectQuery, this._handle, JSON.stringify(spec));
+  }
+
+  /**
+   * Analyze a SELECT statement: its clauses, and whether its GROUP BY and
+   * PER PARTITION LIMIT are valid for the table and server version
+   * @param {string} cql - SELECT statement
+   * @returns {Promise<Object>} { success, data?: { analysis, groupByValid?, perPartitionLimitValid?, warnings? }, error? }
+   */
+  async analyzeQuery(cql) {
+    return await callNativeTrueAsync(native.AnalyzeQuery, this._handle, cql);
+  }
+
+  /**
+   * Explain where a SELECT reads without running it: the token and replicas
+   * of each partition it restricts, and whether it needs ALLOW FILTERING
+   * @param {string} cql - SELECT statement
+   * @returns {Promise<Object>} { success, data?: { keyspace, table, access, partitionRestricted, requiresAllowFiltering, partitions?, ... }, error? }
+   */
+  async explainQuery(cql) {
+    return await callNativeTrueAsync(native.ExplainQuery, this._handle, cql);
+  }
+
+  /**
+   * Handle shell commands - dispatch by identifier from CQL splitter
+   * Pattern: identifier = first token from splitter, handler = _do_<identifier>
+   * @private
+   * @param {string} identifier - Statement identifier from CQL splitter (properly tokenized)
+   * @param {string} original - Original command string (for argument parsing)
+   * @returns {Object|null} Response object or null if not a shell command
+   */
+  async _handleShellCommand(identifier, original) {
+    // Use identifier from CQL splitter for command dispatch
+    // The splitter properly handles comments, whitespace, etc.
+    let cmdword = (identifier || '').toLowerCase();
+
+    // Handle ? -> help (like Python: if cmdword == '?': cmdword = 'help')
+    if (cmdword === '?') {
+      cmdword = 'help';
+    }
+
+    // Dispatch to handler based on identifier
+    const handler = this['_do_' + cmdword];
+    if (handler) {
+      // Parse original for arguments (handlers need parts[1], parts[2], etc.)
+      const parts = original.trim().split(/\s+/);
+      return handler.call(this, parts, original);
+    }
+
+    // Not a shell command
+    return null;
+  }
+
+  // ============================================
+  // Shell Command Handlers (do_<command> pattern from Python cqlsh)
+  // ============================================
+
+  /**
+   * CONSISTENCY [level] - Show or set consistency level
+   * From cqlshmain.py do_consistency()
+   * Note: Only shows/sets REGULAR consistency, not serial
+   */
+  async _do_consistency(parts, original) {
+    const level = parts[1]?.replace(/;$/, '').toUpperCase();
+
+    if (!level) {
+      // Show current consistency (regular only, matching Python cqlsh behavior)
+      const info = await this.getInfo();
+      if (info.success) {
+        const consistency = info.data.consistency;
         return this._textResponse(
-          'TRACING set to ON',
-          { command: 'tracing', action: 'set', enabled: true }
+          `Current consistency level is ${consistency}.`,
+          {
+            command: 'consistency',
+            action: 'show',
+            consistency: consistency
+          }
         );
       }
-    } else if (value === 'OFF') {
-      const result = await callNativeAsync(() => native.SetTracing(this._handle, 0));
-      if (result.success) {
+      return { success: false, error: 'Failed to get session info' };
+    }
+
+    // Set consistency
+    const result = await callNativeAsync(() => native.SetConsistency(this._handle, level));
+    if (result.success) {
+      return this._textResponse(
+        `Consistency level set to ${level}.`,
+        {
+          command: 'consistency',
+          action: 'set',
+          consistency: level
+        }
+      );
+    }
+    return { success: false, error: `Invalid consistency level: ${level}` };
+  }
+
+  /**
+   * SERIAL CONSISTENCY [level] - Show or set serial consistency level
+   * From cqlshmain.py do_serial()
+   * Note: Command is "SERIAL CONSISTENCY" but handler is do_serial (first word)
+   */
+  async _do_serial(parts, original) {
+    // parts[0] = SERIAL, parts[1] = CONSISTENCY, parts[2] = level (optional)
+    const level = parts[2]?.replace(/;$/, '').toUpperCase();
+
+    if (!level) {
+      // Show current serial consistency
+      const info = await this.getInfo();
+      if (info.success) {
+        const serialConsistency = info.data.serialConsistency || 'SERIAL';
         return this._textResponse(
-          'TRACING set to OFF',
-          { command: 'tracing', action: 'set', enabled: false }
+          `Current serial consistency level is ${serialConsistency}.`,
+          {
+            command: 'serial',
+            action: 'show',
+            serialConsistency: serialConsistency
+          }
         );
       }
+      return { success: false, error: 'Failed to get session info' };
     }
-    return { success: false, error: `Invalid tracing value: ${value} (use ON or OFF)` };
+
+    // Validate level
+    if (level !== 'SERIAL' && level !== 'LOCAL_SERIAL') {
+      return { success: false, error: `Invalid serial consistency level: ${level}. Valid levels are: SERIAL, LOCAL_SERIAL.` };
+    }
+
+    const result = await this.setSerialConsistency(level);
+    if (result.success) {
+      return this._textResponse(
+        `Serial consistency level set to ${level}.`,
+        {
+          command: 'serial',
+          action: 'set',
+          serialConsistency: level
+        }
+      );
+    }
+    return { success: false, error: result.error };
+  }
+
+  /**
+   * PAGING [ON|OFF|number] - Show or set query paging
+   * From cqlshmain.py do_paging()
+   */
+  async _do_paging(parts, original) {
+    const value = parts[1]?.replace(/;$/, '');
+
+    if (!value) {
+      // Show current paging state
+      const info = await this.getInfo();
+      if (info.success) {
+        const pageSize = info.data.pageSize;
+        const enabled = pageSize > 0;
+        return this._textResponse(
+          enabled ? `Page size: ${pageSize}` : 'Disabled paging.',
+          {
+            command: 'paging',
+            action: 'show',
+            enabled: enabled,
+            pageSize: pageSize
+          }
+        );
+      }
+      return { success: false, error: 'Failed to get session info' };
+    }
+
+    // Set paging
+    const result = await callNativeAsync(() => native.SetPaging(this._handle, value));
+    if (result.success) {
+      const pageSize = result.data.pageSize || 0;
+      const enabled = result.data.paging !== 'OFF' && pageSize > 0;
+      return this._textResponse(
+        enabled ? `Page size: ${pageSize}` : 'Disabled paging.',
+        {
+          command: 'paging',
+          action: 'set',
+          enabled: enabled,
+          pageSize: pageSize
+        }
+      );
+    }
+    return { success: false, error: `Invalid paging value: ${value}` };
+  }
+
+  /**
+   * TRACING [ON|OFF] - Show or set tracing
+   * From cqlshmain.py do_tracing()
+   */
+  async _do_tracing(parts, original) {
+    const value = parts[1]?.replace(/;$/, '').toUpperCase();
+
+    if (!value) {
+      // Show current tracing state
+      const info = await this.getInfo();
+      if (info.success) {
+        const enabled = info.data.tracing;
+        return this._textResponse(
+          `TRACING is ${enabled ? 'ON' : 'OFF'}`,
+          { command: 'tracing', action: 'show', enabled: enabled }
+        );
+      }
+      return { success: false, error: 'Failed to get session info' };
+    }
+
+    // Set tracing
+    if (value === 'ON') {
+      const result = await callNativeAsync(() => native.SetTracing(this._handle, 1));
+      if (result.success) {
+        return this._textResponse(
+          'TRACING set to ON',
+          { command: 'tracing', action: 'set', enabled: true }
+        );
+      }
+    } else if (value === 'OFF') {
+      const result = await callNativeAsync(() => native.SetTracing(this._handle, 0));
+      if (result.success) {
+        return this._textResponse(
+          'TRACING set to OFF',
+          { command: 'tracing', action: 'set', enabled: false }
+        );
+      }
+    }
+    return { success: false, error: `Invalid tracing value: ${value} (use ON or OFF)` };
+  }
+
+  /**
+   * EXPAND [ON|OFF] - Show or set expanded output
+   * From cqlshmain.py do_expand()
+   */
+  async _do_expand(parts, original) {
+    const value = parts[1]?.replace(/;$/, '').toUpperCase();
+
+    if (!value) {
+      // Show current expand state
+      const info = await this.getInfo();
+      if (info.success) {
+        const enabled = info.data.expand;
+        return this._textResponse(
+          `EXPAND is ${enabled ? 'ON' : 'OFF'}`,
+          { command: 'expand', action: 'show', enabled: enabled }
+        );
+      }
+      return { success: false, error: 'Failed to get session info' };
+    }
+
+    // Set expand
+    if (value === 'ON') {
+      const result = await callNativeAsync(() => native.SetExpand(this._handle, 1));
+      if (result.success) {
+        return this._textResponse(
+          'EXPAND set to ON',
+          { command: 'expand', action: 'set', enabled: true }
+        );
+      }
+    } else if (value === 'OFF') {
+      const result = await callNativeAsync(() => native.SetExpand(this._handle, 0));
+      if (result.success) {
+        return this._textResponse(
+          'EXPAND set to OFF',
+          { command: 'expand', action: 'set', enabled: false }
+        );
+      }
+    }
+    return { success: false, error: `Invalid expand value: ${value} (use ON or OFF)` };
+  }
+
+  /**
+   * CLEAR/CLS - Clear screen
+   * From cqlshmain.py do_clear()
+   */
+  async _do_clear(parts, original) {
+    return this._textResponse('', { command: 'clear', action: 'execute' });
+  }
+
+  async _do_cls(parts, original) {
+    return this._textResponse('', { command: 'cls', action: 'execute' });
+  }
+
+  /**
+   * EXIT/QUIT - Exit cqlsh (handled at pty.js level, but we acknowledge here)
+   * From cqlshmain.py do_exit()
+   */
+  async _do_exit(parts, original) {
+    return this._textResponse('', { command: 'exit', action: 'execute' });
+  }
+
+  async _do_quit(parts, original) {
+    return this._textResponse('', { command: 'quit', action: 'execute' });
+  }
+
+  /**
+   * HELP/? - Show help (minimal implementation)
+   * From cqlshmain.py do_help()
+   */
+  async _do_help(parts, original) {
+    const commands = ['CONSISTENCY', 'SERIAL CONSISTENCY', 'PAGING', 'TRACING', 'EXPAND', 'CLEAR', 'EXIT'];
+    return this._textResponse(
+      `CQL Shell Commands: ${commands.join(', ')}`,
+      { command: 'help', action: 'show', commands: commands }
+    );
+  }
+
+  /**
+   * ELAPSED [ON|OFF] - Show or set elapsed time display
+   * From cqlshmain.py do_elapsed()
+   */
+  async _do_elapsed(parts, original) {
+    const value = parts[1]?.replace(/;$/, '').toUpperCase();
+    if (!value) {
+      return this._textResponse(
+        'ELAPSED is OFF',
+        { command: 'elapsed', action: 'show', enabled: false }
+      );
+    }
+    const enabled = value === 'ON';
+    return this._textResponse(
+      `ELAPSED set to ${value}`,
+      { command: 'elapsed', action: 'set', enabled: enabled }
+    );
+  }
+
+  /**
+   * USE <keyspace> - Switch to a keyspace
+   * From cqlshmain.py do_use()
+   */
+  async _do_use(parts, original) {
+    // Extract keyspace name (remove quotes and trailing semicolon)
+    let keyspace = parts[1]?.replace(/;$/, '').replace(/^["']|["']$/g, '');
+
+    if (!keyspace) {
+      return { success: false, error: 'USE requires a keyspace name' };
+    }
+
+    // Set the keyspace via native binding
+    const result = await callNativeAsync(() => native.SetKeyspace(this._handle, keyspace));
+
+    if (result.success) {
+      // Update local keyspace tracking for prompt
+      this._keyspace = keyspace;
+      return this._textResponse(
+        '',  // USE typically has no output on success
+        {
+          command: 'use',
+          action: 'set',
+          keyspace: keyspace,
+          prompt: this.getPrompt()
+        }
+      );
+    }
+
+    return { success: false, error: result.error || `Keyspace '${keyspace}' does not exist` };
+  }
+
+  async _do_copy(parts, original) {
+    // Parse COPY command: COPY table [(col1, col2)] TO|FROM 'filename' [WITH options]
+    const pattern = /COPY\s+(\S+)(?:\s*\(([^)]+)\))?\s+(TO|FROM)\s+(?:'([^']+)'|"([^"]+)"|(\S+))(?:\s+WITH\s+(.+?))?;?\s*$/i;
+    const match = original.match(pattern);
+
+    if (!match) {
+      return { success: false, error: "Invalid COPY syntax. Use: COPY table TO 'file.csv' or COPY table FROM 'file.csv' [WITH HEADER = true]" };
+    }
+
+    const table = match[1];
+    const columnsStr = match[2];
+    const direction = match[3].toUpperCase();
+    const filename = match[4] || match[5] || match[6];
+    const withStr = match[7];
+
+    // Parse columns
+    const columns = columnsStr
+      ? columnsStr.split(',').map(c => c.trim())
+      : undefined;
+
+    // Parse WITH options: key = value [AND key = value ...]
+    const options = {};
+    if (withStr) {
+      const optParts = withStr.split(/\s+AND\s+/i);
+      for (const part of optParts) {
+        const optMatch = part.match(/(\w+)\s*=\s*(?:'([^']*)'|"([^"]*)"|(\S+))/);
+        if (optMatch) {
+          const key = optMatch[1].toUpperCase();
+          const value = optMatch[2] ?? optMatch[3] ?? optMatch[4];
+          options[key] = value;
+        }
+      }
+    }
+
+    const params = { table, filename, options };
+    if (columns) params.columns = columns;
+    const paramsJSON = JSON.stringify(params);
+
+    let result;
+    if (direction === 'TO') {
+      result = await callNativeTrueAsync(native.CopyTo, this._handle, paramsJSON);
+    } else {
+      result = await callNativeTrueAsync(native.CopyFrom, this._handle, paramsJSON);
+    }
+
+    if (result.success) {
+      const data = result.data || {};
+      let message;
+      if (direction === 'TO') {
+        message = `Exported ${data.rows_exported || 0} rows to ${filename}`;
+      } else {
+        message = `Imported ${data.rows_imported || 0} rows from ${filename}`;
+        if (data.errors > 0) message += ` (${data.errors} insert errors)`;
+        if (data.parse_errors > 0) message += ` (${data.parse_errors} parse errors)`;
+      }
+      return this._textResponse(message, { command: 'copy', direction: direction.toLowerCase(), ...data });
+    }
+
+    return result;
+  }
+
+  /**
+   * Create a text response (for shell commands)
+   * Includes both message (for display) and structured commandResult (for programmatic access)
+   * Note: promptInfo is added at the top level by execute(), not here
+   * @private
+   */
+  _textResponse(message, commandResult = {}) {
+    return {
+      success: true,
+      data: {
+        columns: [],
+        columnTypes: [],
+        rows: [],
+        rowCount: 0,
+        duration: '',
+        message: message,
+        commandResult: commandResult,  // Structured data for the command
+      },
+    };
+  }
+
+  /**
+   * Set the consistency level
+   * @param {string} level - Consistency level (e.g., 'LOCAL_ONE', 'QUORUM')
+   * @returns {Promise<Object>} { success, data?, error? }
+   */
+  async setConsistency(level) {
+    return await callNativeAsync(() =>
+      native.SetConsistency(this._handle, level)
+    );
+  }
+
+  /**
+   * Set the serial consistency level used by lightweight transactions
+   * @param {string} level - 'SERIAL' or 'LOCAL_SERIAL'
+   * @returns {Promise<Object>} { success, data?: { serialConsistency }, error? }
+   */
+  async setSerialConsistency(level) {
+    return await callNativeAsync(() =>
+      native.SetSerialConsistency(this._handle, level)
+    );
+  }
+
+  /**
+   * Set the consistency level a SELECT is retried at, once, when the session
+   * consistency cannot be met. Downgraded results report
+   * execution.consistencyDowngrade.
+   * @param {string|null} level - Fallback level (e.g., 'LOCAL_ONE'), or null to disable
+   * @returns {Promise<Object>} { success, data?: { consistency, consistencyFallback }, error? }
+   */
+  async setConsistencyFallback(level) {
+    return await callNativeAsync(() =>
+      native.SetConsistencyFallback(this._handle, level || '')
+    );
+  }
+
+  /**
+   * Set the time a statement may take, all of its pages included. Statements
+   * that run past it fail with code TIMEOUT; executeWithOptions() timeouts
+   * override it.
+   * @param {number} timeoutMs - Milliseconds, or 0 for no limit
+   * @returns {Promise<Object>} { success, data?: { queryTimeout }, error? }
+   */
+  async setQueryTimeout(timeoutMs) {
+    return await callNativeAsync(() =>
+      native.SetQueryTimeout(this._handle, timeoutMs || 0)
+    );
+  }
+
+  /**
+   * Enable the client-side circuit breaker, which tries coordinators whose
+   * error rate reached the threshold only after the others, or disable it
+   * @param {Object|null} options - { errorRate, minRequests, windowMs, openMs } (0 or omitted for defaults), or null to disable
+   * @returns {Promise<Object>} { success, data?: { circuitBreaker }, error? }
+   */
+  async setCircuitBreaker(options) {
+    return await callNativeAsync(() =>
+      native.SetCircuitBreaker(this._handle, options ? JSON.stringify(options) : '')
+    );
+  }
+
+  /**
+   * Set paging size or disable paging
+   * @param {string|number} value - Page size number or 'OFF' to disable
+   * @returns {Promise<Object>} { success, data?: { paging, pageSize }, error? }
+   */
+  async setPaging(value) {
+    const valueStr = String(value);
+    return await callNativeAsync(() =>
+      native.SetPaging(this._handle, valueStr)
+    );
+  }
+
+  /**
+   * Enable or disable query tracing
+   * @param {boolean} enabled - Whether to enable tracing
+   * @returns {Promise<Object>} { success, data?: { tracing }, error? }
+   */
+  async setTracing(enabled) {
+    return await callNativeAsync(() =>
+      native.SetTracing(this._handle, enabled ? 1 : 0)
+    );
+  }
+
+  /**
+   * Enable or disable auto-fetch. While on, a paged SELECT and fetchNextPage()
+   * read every page up to maxRows rows instead of one page; a result cut off
+   * by the cap has truncated: true and hasMore: true.
+   * @param {boolean} enabled - Whether to fetch all pages automatically
+   * @param {number} [maxRows=0] - Row cap per query (0 = 100000, max 1000000)
+   * @returns {Promise<Object>} { success, data?: { autoFetch, maxRows }, error? }
+   */
+  async setAutoFetch(enabled, maxRows = 0) {
+    return await callNativeAsync(() =>
+      native.SetAutoFetch(this._handle, enabled ? 1 : 0, maxRows)
+    );
+  }
+
+  /**
+   * Get the progress of the running or latest auto-fetch
+   * @returns {Promise<Object>} { success, data?: { rows, pages, maxRows, running, truncated, elapsedMs } | null, error? }
+   */
+  async getFetchProgress() {
+    return await callNativeAsync(() => native.GetFetchProgress(this._handle));
+  }
+
+  /**
+   * Run fn while polling auto-fetch progress into onFetchProgress
+   * @private
+   */
+  async _withFetchProgress(onFetchProgress, fn) {
+    if (!onFetchProgress) {
+      return await fn();
+    }
+
+    const pollProgress = async () => {
+      const progressResult = await callNativeAsync(() => native.GetFetchProgress(this._handle));
+      if (progressResult.success && progressResult.data) {
+        onFetchProgress(progressResult.data);
+      }
+    };
+    const pollTimer = setInterval(pollProgress, 250);
+
+    try {
+      const result = await fn();
+      await pollProgress();
+      return result;
+    } finally {
+      clearInterval(pollTimer);
+    }
+  }
+
+  /**
+   * Enable or disable expand mode (vertical row display)
+   * @param {boolean} enabled - Whether to enable expand mode
+   * @returns {Promise<Object>} { success, data?: { expand }, error? }
+   */
+  async setExpand(enabled) {
+    return await callNativeAsync(() =>
+      native.SetExpand(this._handle, enabled ? 1 : 0)
+    );
   }
 
   /**
-   * EXPAND [ON|OFF] - Show or set expanded output
-   * From cqlshmain.py do_expand()
+   * Set the current keyspace
+   * @param {string} keyspace - Keyspace name
+   * @returns {Promise<Object>} { success, data?, error? }
    */
-  async _do_expand(parts, original) {
-    const value = parts[1]?.replace(/;$/, '').toUpperCase();
+  async setKeyspace(keyspace) {
+    const response = await callNativeAsync(() =>
+      native.SetKeyspace(this._handle, keyspace)
+    );
 
-    if (!value) {
-      // Show current expand state
-      const info = await this.getInfo();
-      if (info.success) {
-        const enabled = info.data.expand;
-        return this._textResponse(
-          `EXPAND is ${enabled ? 'ON' : 'OFF'}`,
-          { command: 'expand', action: 'show', enabled: enabled }
-        );
-      }
-      return { success: false, error: 'Failed to get session info' };
+    if (response.success) {
+      this._keyspace = keyspace;
     }
 
-    // Set expand
-    if (value === 'ON') {
-      const result = await callNativeAsync(() => native.SetExpand(this._handle, 1));
-      if (result.success) {
-        return this._textResponse(
-          'EXPAND set to ON',
-          { command: 'expand', action: 'set', enabled: true }
-        );
-      }
-    } else if (value === 'OFF') {
-      const result = await callNativeAsync(() => native.SetExpand(this._handle, 0));
-      if (result.success) {
-        return this._textResponse(
-          'EXPAND set to OFF',
-          { command: 'expand', action: 'set', enabled: false }
-        );
-      }
-    }
-    return { success: false, error: `Invalid expand value: ${value} (use ON or OFF)` };
+    return response;
   }
 
   /**
-   * CLEAR/CLS - Clear screen
-   * From cqlshmain.py do_clear()
+   * Reconnect after a network outage, keeping the session, its settings and its prepared
+   * statements. Paged results still being read are closed.
+   * @returns {Promise<Object>} { success, data?: { restored, preparedStatements, closedPagedQueries }, error? }
    */
-  async _do_clear(parts, original) {
-    return this._textResponse('', { command: 'clear', action: 'execute' });
+  async reconnect() {
+    return await callNativeAsync(() => native.ReconnectSession(this._handle));
   }
 
-  async _do_cls(parts, original) {
-    return this._textResponse('', { command: 'cls', action: 'execute' });
+  /**
+   * Get session information. Astra sessions also report the SNI proxy and
+   * contact points they connect through, under astra.
+   * @returns {Promise<Object>} { success, data?, error? }
+   */
+  async getInfo() {
+    return await callNativeAsync(() =>
+      native.GetSessionInfo(this._handle)
+    );
   }
 
   /**
-   * EXIT/QUIT - Exit cqlsh (handled at pty.js level, but we acknowledge here)
-   * From cqlshmain.py do_exit()
+   * Get resources currently held by this session (open iterators, buffered rows,
+   * goroutines, schema cache size) for diagnostics and leak debugging
+   * @returns {Promise<Object>} { success, data?: ResourceUsage, error? }
    */
-  async _do_exit(parts, original) {
-    return this._textResponse('', { command: 'exit', action: 'execute' });
+  async getResourceUsage() {
+    return await callNativeAsync(() =>
+      native.GetResourceUsage(this._handle)
+    );
   }
 
-  async _do_quit(parts, original) {
-    return this._textResponse('', { command: 'quit', action: 'execute' });
+  /**
+   * Get the requests, error rate, latency, circuit breaker state and
+   * connection heartbeats of each coordinator the session has used
+   * @returns {Promise<Object>} { success, data?: { hosts, circuitBreaker, heartbeatInterval }, error? }
+   */
+  async getSessionMetrics() {
+    return await callNativeAsync(() =>
+      native.GetSessionMetrics(this._handle)
+    );
   }
 
   /**
-   * HELP/? - Show help (minimal implementation)
-   * From cqlshmain.py do_help()
+   * Change the schema cache scope. 'off' releases the cache; 'full' and
+   * 'keyspace' rebuild it before returning.
+   * @param {string} mode - 'full', 'keyspace' (current keyspace only) or 'off'
+   * @returns {Promise<Object>} { success, data?: { enabled, mode, keyspaces, tables, columns, estimatedBytes, lastRefresh? }, error? }
    */
-  async _do_help(parts, original) {
-    const commands = ['CONSISTENCY', 'SERIAL CONSISTENCY', 'PAGING', 'TRACING', 'EXPAND', 'CLEAR', 'EXIT'];
-    return this._textResponse(
-      `CQL Shell Commands: ${commands.join(', ')}`,
-      { command: 'help', action: 'show', commands: commands }
+  async setSchemaCacheMode(mode) {
+    return await callNativeTrueAsync(native.SetSchemaCacheMode, this._handle, mode);
+  }
+
+  /**
+   * Pin the schema: metadata, completions and query builders read a snapshot
+   * taken now until unpinSchema(), so objects altered or dropped meanwhile
+   * keep their shape
+   * @param {Object} [options]
+   * @param {string[]} [options.keyspaces] - Keyspaces to snapshot (default every keyspace)
+   * @returns {Promise<Object>} { success, data?: { pinned, schemaVersion, liveSchemaVersion, pinnedAt, keyspaces, diverged, changes? }, error? }
+   */
+  async pinSchema(options = {}) {
+    return await callNativeTrueAsync(native.PinSchema, this._handle, JSON.stringify(options));
+  }
+
+  /**
+   * Return to the live schema after pinSchema()
+   * @returns {Promise<Object>} { success, data?: { unpinned }, error? }
+   */
+  async unpinSchema() {
+    return await callNativeTrueAsync(native.UnpinSchema, this._handle);
+  }
+
+  /**
+   * Report whether the schema is pinned and whether the live schema has
+   * diverged from the snapshot
+   * @returns {Promise<Object>} { success, data?: { pinned, schemaVersion?, liveSchemaVersion?, pinnedAt?, keyspaces?, diverged, changes? }, error? }
+   */
+  async getSchemaPin() {
+    return await callNativeTrueAsync(native.GetSchemaPin, this._handle);
+  }
+
+  /**
+   * Set this session's share of the process-wide bulk operation slots
+   * (COPY, executeSourceFiles, findPartitions, countTable, benchmarks, compareTables)
+   * @param {Object} limits - Scheduler limits; omitted values are unchanged
+   * @param {number} [limits.weight=1] - Relative share when sessions compete for slots
+   * @param {number} [limits.maxConcurrent=2] - Bulk operations this session may run at once
+   * @returns {Promise<Object>} { success, data?: { weight, maxConcurrent }, error? }
+   */
+  async setSchedulerLimits(limits = {}) {
+    return await callNativeAsync(() =>
+      native.SetSchedulerLimits(this._handle, limits.weight || 0, limits.maxConcurrent || 0)
     );
   }
 
   /**
-   * ELAPSED [ON|OFF] - Show or set elapsed time display
-   * From cqlshmain.py do_elapsed()
+   * Refuse SELECTs that scan more partitions than allowed. Before a SELECT that does not
+   * restrict the whole partition key with = or IN runs, system.size_estimates is consulted;
+   * above the limit the query fails with code SCAN_LIMIT_EXCEEDED and the estimate in data
+   * (or scanEstimate for executeMulti). Pass { force: true } to execute() to run it anyway.
+   * @param {Object} options - Scan guard options
+   * @param {number} [options.maxPartitions=0] - Estimated partition limit (0 disables the guard)
+   * @returns {Promise<Object>} { success, data?: { maxPartitions }, error? }
    */
-  async _do_elapsed(parts, original) {
-    const value = parts[1]?.replace(/;$/, '').toUpperCase();
-    if (!value) {
-      return this._textResponse(
-        'ELAPSED is OFF',
-        { command: 'elapsed', action: 'show', enabled: false }
-      );
-    }
-    const enabled = value === 'ON';
-    return this._textResponse(
-      `ELAPSED set to ${value}`,
-      { command: 'elapsed', action: 'set', enabled: enabled }
+  async setScanGuard(options = {}) {
+    const optionsJSON = JSON.stringify({ maxPartitions: options.maxPartitions || 0 });
+    return await callNativeAsync(() =>
+      native.SetScanGuard(this._handle, optionsJSON)
     );
   }
 
   /**
-   * USE <keyspace> - Switch to a keyspace
-   * From cqlshmain.py do_use()
+   * Stop buffering results that grow past a limit. A non-paged SELECT whose result passes
+   * maxRows rows or maxBytes bytes of JSON returns the rows read so far with modeSwitched,
+   * hasMore and a queryId; fetchNextPage(queryId) reads the rest.
+   * @param {Object} options - Result limit options
+   * @param {number} [options.maxRows=0] - Row limit (0: none)
+   * @param {number} [options.maxBytes=0] - Byte limit (0: none)
+   * @returns {Promise<Object>} { success, data?: { maxRows, maxBytes }, error? }
    */
-  async _do_use(parts, original) {
-    // Extract keyspace name (remove quotes and trailing semicolon)
-    let keyspace = parts[1]?.replace(/;$/, '').replace(/^["']|["']$/g, '');
+  async setResultLimit(options = {}) {
+    const optionsJSON = JSON.stringify({ maxRows: options.maxRows || 0, maxBytes: options.maxBytes || 0 });
+    return await callNativeAsync(() =>
+      native.SetResultLimit(this._handle, optionsJSON)
+    );
+  }
 
-    if (!keyspace) {
-      return { success: false, error: 'USE requires a keyspace name' };
-    }
+  /**
+   * Split SELECTs with long IN lists into several queries. A non-paged SELECT whose IN list has
+   * more than maxValues values runs as queries of at most maxValues values, concurrency at a
+   * time, and returns their rows in list order with split: { column, values, maxValues, queries }.
+   * @param {Object} options - IN split options
+   * @param {number} [options.maxValues=0] - Longest IN list run as one query (0 disables splitting)
+   * @param {number} [options.concurrency=4] - Queries of a split list run at once (max 32)
+   * @returns {Promise<Object>} { success, data?: { maxValues, concurrency }, error? }
+   */
+  async setInSplit(options = {}) {
+    const optionsJSON = JSON.stringify({ maxValues: options.maxValues || 0, concurrency: options.concurrency || 0 });
+    return await callNativeAsync(() =>
+      native.SetInSplit(this._handle, optionsJSON)
+    );
+  }
 
-    // Set the keyspace via native binding
-    const result = await callNativeAsync(() => native.SetKeyspace(this._handle, keyspace));
+  /**
+   * Get the request size limits statements are checked against before they are sent,
+   * read from system_views.settings (Cassandra 4.0+) or the server version's defaults.
+   * Statements over a limit fail with code PAYLOAD_TOO_LARGE.
+   * @returns {Promise<Object>} { success, data?: { maxMutationBytes, maxFrameBytes, batchFailBytes, source }, error? }
+   */
+  async getPayloadLimits() {
+    return await callNativeTrueAsync(native.GetPayloadLimits, this._handle);
+  }
 
-    if (result.success) {
-      // Update local keyspace tracking for prompt
-      this._keyspace = keyspace;
-      return this._textResponse(
-        '',  // USE typically has no output on success
-        {
-          command: 'use',
-          action: 'set',
-          keyspace: keyspace,
-          prompt: this.getPrompt()
+  /**
+   * Watch the JSON config file (cqlai.json, ~/.cqlai.json or ~/.config/cqlai/config.json)
+   * and apply safe changes to this session: pageSize right away, AI settings right away,
+   * requestTimeout and connectTimeout on the next reconnect (e.g. USE <keyspace>).
+   * Settings given when connecting, or changed with PAGING, are not overridden.
+   * Calling it again replaces the previous watch.
+   * @param {Object} [options] - Watch options
+   * @param {number} [options.intervalMs=2000] - How often the file is checked
+   * @param {Function} [options.onReload] - Called with each CONFIG_RELOADED event:
+   *   { type, path, time, changed, applied, pending, ignored, error? }
+   * @returns {Promise<Object>} { success, data?: { watching, path }, error? }
+   */
+  async watchConfig(options = {}) {
+    const { intervalMs = 2000, onReload } = options;
+    const optionsJSON = JSON.stringify({ intervalMs });
+    const result = await callNativeAsync(() =>
+      native.WatchConfig(this._handle, optionsJSON)
+    );
+    if (!result.success) {
+      return result;
+    }
+
+    this._stopConfigPolling();
+    if (onReload) {
+      const poll = async () => {
+        const events = await callNativeAsync(() => native.PollConfigEvents(this._handle));
+        if (events.success && events.data) {
+          events.data.forEach((event) => onReload(event));
         }
-      );
+      };
+      this._configWatchTimer = setInterval(poll, intervalMs);
+      // Don't keep the process alive just to watch the config file
+      this._configWatchTimer.unref();
     }
+    return result;
+  }
 
-    return { success: false, error: result.error || `Keyspace '${keyspace}' does not exist` };
+  /**
+   * Stop watching the config file
+   * @returns {Promise<Object>} { success, data?: { watching: false }, error? }
+   */
+  async unwatchConfig() {
+    this._stopConfigPolling();
+    const optionsJSON = JSON.stringify({ enabled: false });
+    return await callNativeAsync(() =>
+      native.WatchConfig(this._handle, optionsJSON)
+    );
   }
 
-  async _do_copy(parts, original) {
-    // Parse COPY command: COPY table [(col1, col2)] TO|FROM 'filename' [WITH options]
-    const pattern = /COPY\s+(\S+)(?:\s*\(([^)]+)\))?\s+(TO|FROM)\s+(?:'([^']+)'|"([^"]+)"|(\S+))(?:\s+WITH\s+(.+?))?;?\s*$/i;
-    const match = original.match(pattern);
+  /**
+   * Collect the CONFIG_RELOADED events queued since the last call, for callers that
+   * watch without onReload
+   * @returns {Promise<Object>} { success, data?: Array<Object>, error? }
+   */
+  async pollConfigEvents() {
+    return await callNativeAsync(() => native.PollConfigEvents(this._handle));
+  }
 
-    if (!match) {
-      return { success: false, error: "Invalid COPY syntax. Use: COPY table TO 'file.csv' or COPY table FROM 'file.csv' [WITH HEADER = true]" };
-    }
+  /**
+   * Get the merged settings this session is using: defaults, cqlshrc, the JSON config
+   * file, environment variables, connection options and session changes such as PAGING.
+   * API keys are redacted.
+   * @returns {Promise<Object>} { success, data?: { configFile, host, port, keyspace, username,
+   *   consistency, pageSize, requestTimeout, connectTimeout, ssl, ai, pending }, error? }
+   */
+  async getEffectiveConfig() {
+    return await callNativeAsync(() => native.GetEffectiveConfig(this._handle));
+  }
 
-    const table = match[1];
-    const columnsStr = match[2];
-    const direction = match[3].toUpperCase();
-    const filename = match[4] || match[5] || match[6];
-    const withStr = match[7];
+  /**
+   * Get each session setting with the layer it came from: 'default', 'workspace' (workspace
+   * defaults), 'session' (connection options or cqlshrc) or 'changed' (changed on the session since)
+   * @returns {Promise<Object>} { success, data?: { workspaceID, settings, workspaceDefaults, defaults }, error? }
+   */
+  async getEffectiveSettings() {
+    return await callNativeAsync(() => native.GetEffectiveSettings(this._handle));
+  }
 
-    // Parse columns
-    const columns = columnsStr
-      ? columnsStr.split(',').map(c => c.trim())
-      : undefined;
+  /**
+   * Queue the schema changes made on the cluster (keyspaces, tables, types, functions and
+   * aggregates created, altered or dropped), so the schema can be updated without reloading
+   * all cluster metadata. Calling it again replaces the filters and keeps queued events.
+   * @param {Object} [options] - Subscription options
+   * @param {string[]} [options.keyspaces] - Only changes in these keyspaces (default: all)
+   * @param {string[]} [options.targets] - Only these targets: 'KEYSPACE', 'TABLE', 'TYPE',
+   *   'FUNCTION', 'AGGREGATE' (default: all)
+   * @param {number} [options.intervalMs=1000] - How often onChange polls for events
+   * @param {Function} [options.onChange] - Called with each event: { change, target, keyspace, name?, time }
+   * @returns {Promise<Object>} { success, data?: { subscribed }, error? }
+   */
+  async subscribeSchemaEvents(options = {}) {
+    const { keyspaces, targets, intervalMs = 1000, onChange } = options;
+    const optionsJSON = JSON.stringify({ keyspaces, targets });
+    const result = await callNativeAsync(() =>
+      native.SubscribeSchemaEvents(this._handle, optionsJSON)
+    );
+    if (!result.success) {
+      return result;
+    }
 
-    // Parse WITH options: key = value [AND key = value ...]
-    const options = {};
-    if (withStr) {
-      const optParts = withStr.split(/\s+AND\s+/i);
-      for (const part of optParts) {
-        const optMatch = part.match(/(\w+)\s*=\s*(?:'([^']*)'|"([^"]*)"|(\S+))/);
-        if (optMatch) {
-          const key = optMatch[1].toUpperCase();
-          const value = optMatch[2] ?? optMatch[3] ?? optMatch[4];
-          options[key] = value;
+    this._stopSchemaEventPolling();
+    if (onChange) {
+      const poll = async () => {
+        const batch = await callNativeAsync(() => native.PollSchemaEvents(this._handle));
+        if (batch.success && batch.data) {
+          batch.data.events.forEach((event) => onChange(event));
         }
-      }
+      };
+      this._schemaEventTimer = setInterval(poll, intervalMs);
+      this._schemaEventTimer.unref();
     }
+    return result;
+  }
 
-    const params = { table, filename, options };
-    if (columns) params.columns = columns;
-    const paramsJSON = JSON.stringify(params);
+  /**
+   * Stop queueing schema changes; queued events are dropped
+   * @returns {Promise<Object>} { success, data?: { subscribed: false }, error? }
+   */
+  async unsubscribeSchemaEvents() {
+    this._stopSchemaEventPolling();
+    const optionsJSON = JSON.stringify({ enabled: false });
+    return await callNativeAsync(() =>
+      native.SubscribeSchemaEvents(this._handle, optionsJSON)
+    );
+  }
 
-    let result;
-    if (direction === 'TO') {
-      result = await callNativeTrueAsync(native.CopyTo, this._handle, paramsJSON);
-    } else {
-      result = await callNativeTrueAsync(native.CopyFrom, this._handle, paramsJSON);
+  /**
+   * Collect the schema changes queued since the last call, for callers that subscribe
+   * without onChange
+   * @returns {Promise<Object>} { success, data?: { events, dropped }, error? }
+   */
+  async pollSchemaEvents() {
+    return await callNativeAsync(() => native.PollSchemaEvents(this._handle));
+  }
+
+  /**
+   * Stop polling for schema events
+   * @private
+   */
+  _stopSchemaEventPolling() {
+    if (this._schemaEventTimer) {
+      clearInterval(this._schemaEventTimer);
+      this._schemaEventTimer = null;
     }
+  }
 
-    if (result.success) {
-      const data = result.data || {};
-      let message;
-      if (direction === 'TO') {
-        message = `Exported ${data.rows_exported || 0} rows to ${filename}`;
-      } else {
-        message = `Imported ${data.rows_imported || 0} rows from ${filename}`;
-        if (data.errors > 0) message += ` (${data.errors} insert errors)`;
-        if (data.parse_errors > 0) message += ` (${data.parse_errors} parse errors)`;
-      }
-      return this._textResponse(message, { command: 'copy', direction: direction.toLowerCase(), ...data });
+  /**
+   * Stop polling for config events
+   * @private
+   */
+  _stopConfigPolling() {
+    if (this._configWatchTimer) {
+      clearInterval(this._configWatchTimer);
+      this._configWatchTimer = null;
     }
+  }
+
+  /**
+   * Get the CQL keywords, built-in functions, types and index options valid
+   * for the connected server version (for editor completion and highlighting)
+   * @returns {Promise<Object>} { success, data?: { serverVersion, exact, keywords, functions, types, indexes }, error? }
+   */
+  async getLanguageCatalog() {
+    return await callNativeAsync(() =>
+      native.GetLanguageCatalog(this._handle)
+    );
+  }
+
+  /**
+   * Get full cluster metadata (keyspaces, tables, columns, indexes, types, functions, etc.)
+   * @returns {Promise<Object>} { success, data?: ClusterMetadata, error? }
+   */
+  async getClusterMetadata() {
+    return await callNativeTrueAsync(native.GetClusterMetadata, this._handle);
+  }
 
-    return result;
+  /**
+   * Get counts and rollups of the user schema for overview pages, without
+   * downloading the full metadata
+   * @returns {Promise<Object>} { success, data?: { keyspaces, tables, views, columns, indexes, userTypes, tablesPerKeyspace, columnsPerTable, indexesByKind, userTypeUsage, strategies, datacenters, ... }, error? }
+   */
+  async getSchemaSummary() {
+    return await callNativeTrueAsync(native.GetSchemaSummary, this._handle);
   }
 
   /**
-   * Create a text response (for shell commands)
-   * Includes both message (for display) and structured commandResult (for programmatic access)
-   * Note: promptInfo is added at the top level by execute(), not here
-   * @private
+   * Get the token ring: the tokens and primary ownership of each node, and for
+   * each replication setting in use the effective ownership of each node and
+   * the replicas of every range
+   * @param {Object} [options]
+   * @param {string[]} [options.keyspaces] - Keyspaces to place (default: every replicated keyspace)
+   * @returns {Promise<Object>} { success, data?: { partitioner, hosts, replication, warnings? }, error? }
    */
-  _textResponse(message, commandResult = {}) {
-    return {
-      success: true,
-      data: {
-        columns: [],
-        columnTypes: [],
-        rows: [],
-        rowCount: 0,
-        duration: '',
-        message: message,
-        commandResult: commandResult,  // Structured data for the command
-      },
-    };
+  async getTokenRing(options = {}) {
+    return await callNativeTrueAsync(native.GetTokenRing, this._handle, JSON.stringify(options));
   }
 
   /**
-   * Set the consistency level
-   * @param {string} level - Consistency level (e.g., 'LOCAL_ONE', 'QUORUM')
-   * @returns {Promise<Object>} { success, data?, error? }
+   * Get the current definition of a user-defined type
+   * Definitions are cached and reloaded after CREATE/ALTER/DROP TYPE
+   * @param {string|null} keyspace - Keyspace of the type (null: current keyspace)
+   * @param {string} name - Type name as stored in the schema
+   * @returns {Promise<Object>} { success, data?: { keyspace, name, field_names, field_types, nested_types? }, error? }
    */
-  async setConsistency(level) {
-    return await callNativeAsync(() =>
-      native.SetConsistency(this._handle, level)
-    );
+  async getUDTDefinition(keyspace, name) {
+    return await callNativeTrueAsync(native.GetUDTDefinition, this._handle, keyspace || '', name);
   }
 
   /**
-   * Set paging size or disable paging
-   * @param {string|number} value - Page size number or 'OFF' to disable
-   * @returns {Promise<Object>} { success, data?: { paging, pageSize }, error? }
+   * Get the estimated partition count and mean partition size of a table from
+   * system.size_estimates, and its compaction strategy and settings from
+   * system_schema.tables. Disk usage is added on Cassandra 4.0+.
+   * @param {string|null} keyspace - Keyspace of the table (null: current keyspace)
+   * @param {string} table - Table name as stored in the schema
+   * @returns {Promise<Object>} { success, data?: TableStats, error? }
    */
-  async setPaging(value) {
-    const valueStr = String(value);
-    return await callNativeAsync(() =>
-      native.SetPaging(this._handle, valueStr)
-    );
+  async getTableStats(keyspace, table) {
+    return await callNativeTrueAsync(native.GetTableStats, this._handle, keyspace || '', table);
   }
 
   /**
-   * Enable or disable query tracing
-   * @param {boolean} enabled - Whether to enable tracing
-   * @returns {Promise<Object>} { success, data?: { tracing }, error? }
+   * Collect per-node metrics from system_views (caches, thread pools, tombstones
+   * per read, local and coordinator read latency). Requires Cassandra 4.0+.
+   * @returns {Promise<Object>} { success, data?: { collectedAt, tables, nodes, reachable, unreachable }, error? }
    */
-  async setTracing(enabled) {
-    return await callNativeAsync(() =>
-      native.SetTracing(this._handle, enabled ? 1 : 0)
-    );
+  async collectNodeMetrics() {
+    return await callNativeTrueAsync(native.CollectNodeMetrics, this._handle);
   }
 
   /**
-   * Enable or disable expand mode (vertical row display)
-   * @param {boolean} enabled - Whether to enable expand mode
-   * @returns {Promise<Object>} { success, data?: { expand }, error? }
+   * Start or stop sampling per-table access from the coordinator latency
+   * virtual tables (and system_views.queries on 4.1+). Off by default.
+   * @param {Object} [options]
+   * @param {boolean} [options.enabled=true] - false stops sampling and drops the counters
+   * @param {number} [options.intervalMs=10000] - Time between samples (minimum 1000)
+   * @returns {Promise<Object>} { success, data?: AccessHeatmap, error? }
    */
-  async setExpand(enabled) {
-    return await callNativeAsync(() =>
-      native.SetExpand(this._handle, enabled ? 1 : 0)
-    );
+  async configureAccessHeatmap(options = {}) {
+    return await callNativeTrueAsync(native.ConfigureAccessHeatmap, this._handle, JSON.stringify(options));
   }
 
   /**
-   * Set the current keyspace
-   * @param {string} keyspace - Keyspace name
-   * @returns {Promise<Object>} { success, data?, error? }
+   * Get the per-table access counters sampled since configureAccessHeatmap()
+   * @returns {Promise<Object>} { success, data?: { sampling, samples, tables, ... }, error? }
    */
-  async setKeyspace(keyspace) {
-    const response = await callNativeAsync(() =>
-      native.SetKeyspace(this._handle, keyspace)
-    );
+  async getAccessHeatmap() {
+    return await callNativeTrueAsync(native.GetAccessHeatmap, this._handle);
+  }
 
-    if (response.success) {
-      this._keyspace = keyspace;
-    }
+  /**
+   * Start or stop recording every statement the session runs (text, duration,
+   * rows, consistency, error, trace ID) into an in-memory ring buffer. Off by
+   * default; enabling again empties the buffer.
+   * @param {Object} [options]
+   * @param {boolean} [options.enabled=true] - false stops profiling and drops the recorded statements
+   * @param {number} [options.capacity=1000] - Statements kept before the oldest are overwritten (max 100000)
+   * @returns {Promise<Object>} { success, data?: QueryProfile, error? }
+   */
+  async enableQueryProfiling(options = {}) {
+    return await callNativeAsync(native.EnableQueryProfiling, this._handle, JSON.stringify(options));
+  }
 
-    return response;
+  /**
+   * Get the latency percentiles, rows and errors of each statement shape
+   * recorded since enableQueryProfiling()
+   * @param {Object} [options]
+   * @param {boolean} [options.statements] - Include the recorded statements, newest first
+   * @param {string} [options.shape] - Only statements and stats of this shape
+   * @param {boolean} [options.reset] - Empty the buffer after the profile is taken
+   * @returns {Promise<Object>} { success, data?: { profiling, recorded, buffered, dropped, shapes, statements? }, error? }
+   */
+  async getQueryProfile(options = {}) {
+    return await callNativeAsync(native.GetQueryProfile, this._handle, JSON.stringify(options));
   }
 
   /**
-   * Get session information
-   * @returns {Promise<Object>} { success, data?, error? }
+   * Find which keyspaces and tables the current role can SELECT and MODIFY,
+   * from system_auth when readable, otherwise by trial reads
+   * @returns {Promise<Object>} { success, data?: { source, keyspaces, tables, ... }, error? }
    */
-  async getInfo() {
-    return await callNativeAsync(() =>
-      native.GetSessionInfo(this._handle)
-    );
+  async getAccessibleObjects() {
+    return await callNativeTrueAsync(native.GetAccessibleObjects, this._handle);
   }
 
   /**
-   * Get full cluster metadata (keyspaces, tables, columns, indexes, types, functions, etc.)
-   * @returns {Promise<Object>} { success, data?: ClusterMetadata, error? }
+   * Describe the roles of the cluster, their members and superuser flags, and
+   * the permissions each role holds per resource, with the CQL that recreates
+   * them. Reads system_auth when readable, otherwise what LIST ROLES and LIST
+   * PERMISSIONS show to the current role
+   * @returns {Promise<Object>} { success, data?: { source, complete, summary, roles, resources, describe, warnings? }, error? }
    */
-  async getClusterMetadata() {
-    return await callNativeTrueAsync(native.GetClusterMetadata, this._handle);
+  async getSecurityOverview() {
+    return await callNativeTrueAsync(native.GetSecurityOverview, this._handle);
   }
 
   /**
-   * Export table data to a CSV file (COPY TO)
-   * @param {string} table - Table name (can be keyspace.table)
-   * @param {string} filename - Output CSV file path
+   * Export table data, or the result of a SELECT, to a CSV, JSON, JSONL or Parquet file (COPY TO)
+   * @param {string} table - Table name (can be keyspace.table) or a single SELECT statement
+   * @param {string} filename - Output file path
    * @param {Object} [options] - Export options
-   * @param {string[]} [options.columns] - Specific columns to export (default: all)
+   * @param {string} [options.format='csv'] - 'csv', 'json' (one array of row objects), 'jsonl' (one object per line)
+   *   or 'parquet'; the JSON formats keep collections and UDTs as the server encodes them, and Parquet stores them
+   *   as JSON text columns
+   * @param {string[]} [options.columns] - Specific columns to export (default: all; not with a SELECT)
    * @param {boolean} [options.header=false] - Include column header row
    * @param {string} [options.delimiter=','] - Column delimiter
    * @param {string} [options.nullval='null'] - String to use for NULL values
    * @param {number} [options.maxrows=-1] - Max rows to export (-1 for unlimited)
    * @param {number} [options.pagesize=1000] - Rows per page for streaming
+   * @param {number} [options.decimalscale] - Parquet: write decimals as DECIMAL(38, scale) instead of text
+   * @param {number} [options.rowgroupsize=10000] - Parquet: rows per row group
+   * @param {string} [options.jobId] - Job ID for getCopyProgress() and cancelCopy(); also a cancel token
+   * @param {Function} [options.onProgress] - Called with { jobId, status, rowsExported, bytesWritten, rowsPerSecond,
+   *   bytesPerSecond, elapsedMs } while exporting (a job ID is issued when none is given)
    * @returns {Promise<Object>} { success, data?: { rows_exported }, error? }
    */
   async copyTo(table, filename, options = {}) {
+    const isQuery = /^\s*select\s/i.test(table);
     const params = {
-      table,
+      table: isQuery ? undefined : table,
+      query: isQuery ? table : undefined,
       filename,
       columns: options.columns,
       options: {},
+      format: options.format,
+      jobId: options.jobId,
     };
     // Map JS-friendly option names to COPY option keys
     if (options.header !== undefined) params.options.HEADER = String(options.header);
@@ -1018,47 +2481,206 @@ class CQLSession {
     if (options.nullval !== undefined) params.options.NULLVAL = options.nullval;
     if (options.maxrows !== undefined) params.options.MAXROWS = String(options.maxrows);
     if (options.pagesize !== undefined) params.options.PAGESIZE = String(options.pagesize);
+    if (options.decimalscale !== undefined) params.options.DECIMALSCALE = String(options.decimalscale);
+    if (options.rowgroupsize !== undefined) params.options.ROWGROUPSIZE = String(options.rowgroupsize);
 
-    const paramsJSON = JSON.stringify(params);
-    return await callNativeTrueAsync(native.CopyTo, this._handle, paramsJSON);
+    const { onProgress } = options;
+    if (!onProgress) {
+      return await callNativeTrueAsync(native.CopyTo, this._handle, JSON.stringify(params));
+    }
+    if (!params.jobId) {
+      const tokenResult = await CQLSession.newCancelToken();
+      if (!tokenResult.success) {
+        return tokenResult;
+      }
+      params.jobId = tokenResult.data.cancelToken;
+    }
+
+    const pollProgress = async () => {
+      const progressResult = await callNativeAsync(() => native.GetCopyProgress(this._handle, params.jobId));
+      if (progressResult.success && progressResult.data) {
+        onProgress(progressResult.data);
+      }
+    };
+    const pollTimer = setInterval(pollProgress, 250);
+
+    try {
+      const result = await callNativeTrueAsync(native.CopyTo, this._handle, JSON.stringify(params));
+      await pollProgress();
+      return result;
+    } finally {
+      clearInterval(pollTimer);
+    }
+  }
+
+  /**
+   * Get the progress of a COPY TO started with options.jobId. Finished jobs
+   * are kept for ten minutes.
+   * @param {string} jobId - Job ID passed to copyTo()
+   * @returns {Promise<Object>} { success, data?: { jobId, status, table?, filename, rowsExported, bytesWritten,
+   *   rowsPerSecond, bytesPerSecond, elapsedMs, error? }, error? }
+   */
+  async getCopyProgress(jobId) {
+    if (!jobId) {
+      return { success: false, error: 'jobId is required' };
+    }
+    return await callNativeTrueAsync(native.GetCopyProgress, this._handle, jobId);
+  }
+
+  /**
+   * Stop a running COPY TO between rows. The copyTo() call fails with
+   * CANCELLED; the rows already written stay in the file.
+   * @param {string} jobId - Job ID passed to copyTo()
+   * @returns {Promise<Object>} { success, data?: { jobId, status, rowsExported, ... }, error? }
+   */
+  async cancelCopy(jobId) {
+    if (!jobId) {
+      return { success: false, error: 'jobId is required' };
+    }
+    return await callNativeTrueAsync(native.CancelCopy, this._handle, jobId);
   }
 
   /**
-   * Import data from a CSV file into a table (COPY FROM)
+   * Import data from a CSV, JSON, JSONL or Parquet file into a table (COPY FROM)
    * @param {string} table - Table name (can be keyspace.table)
-   * @param {string} filename - Input CSV file path
+   * @param {string} filename - Input file path
    * @param {Object} [options] - Import options
+   * @param {string} [options.format='csv'] - 'csv', 'json', 'jsonl' or 'parquet'; JSON and Parquet rows are converted
+   *   by the server (INSERT ... JSON), and columns, mapping and validateOnly apply to CSV only
    * @param {string[]} [options.columns] - Column names matching CSV columns (default: from header or schema)
-   * @param {boolean} [options.header=false] - CSV file has a header row
-   * @param {string} [options.delimiter=','] - Column delimiter
+   * @param {Object<string, string>} [options.mapping] - Header field -> table column, as returned by planCsvMapping();
+   *   implies header and replaces columns. Header fields left out (or mapped to '') are skipped
+   * @param {boolean|string} [options.header=false] - CSV file has a header row, or 'auto' to detect it
+   * @param {string} [options.delimiter=','] - Column delimiter, or 'auto'
+   * @param {string} [options.quote='"'] - Quote character, '"' or "'", or 'auto'
+   * @param {string} [options.encoding='utf8'] - 'utf8', 'utf16', 'utf16le', 'utf16be', 'latin1' or 'auto'
+   * @param {boolean} [options.detectDialect=false] - Detect header, delimiter, quote and encoding where not given
+   *   (see detectCsvDialect()); the dialect used is returned as data.dialect
    * @param {string} [options.nullval='null'] - String representing NULL values
    * @param {number} [options.maxrows=-1] - Max rows to import (-1 for unlimited)
    * @param {number} [options.skiprows=0] - Number of rows to skip at start
-   * @param {number} [options.chunksize=5000] - Progress reporting chunk size
+   * @param {number} [options.chunksize=5000] - CSV rows grouped by partition and replica before batching
    * @param {number} [options.maxbatchsize=20] - Max rows per batch insert
+   * @param {number} [options.minbatchsize=2] - Rows of one partition in a chunk that get batches of their own
    * @param {number} [options.maxrequests=6] - Max concurrent batch workers
-   * @returns {Promise<Object>} { success, data?: { rows_imported, errors, parse_errors, skipped_rows }, error? }
+   * @param {number} [options.maxattempts=5] - Attempts per batch when it times out or the coordinator is overloaded
+   * @param {boolean} [options.unsetnulls=false] - Leave nullval fields unset instead of writing null (no tombstones)
+   * @param {number} [options.warnnulltombstones=-1] - Warn when more null cells than this would be written (-1 disables)
+   * @param {boolean} [options.validateOnly=false] - Check every value against the column types without writing;
+   *   returns { columns, rowsChecked, validRows, invalidRows, parseErrors, errorsByColumn, errors, truncated?,
+   *   bytes, roundTripMs, estimatedDurationMs, durationMs } where errors holds up to 100 { line, column?, value?, error }
+   * @param {boolean} [options.resume=false] - CSV and JSONL: record progress in a checkpoint file and carry on from the
+   *   checkpoint an interrupted import left, instead of starting over (see CQLSession.getCopyCheckpoint())
+   * @param {string} [options.checkpointFile] - Checkpoint file to use instead of <filename>.checkpoint
+   * @returns {Promise<Object>} { success, data?: { rows_imported, errors, parse_errors, skipped_rows, null_values?, warnings?,
+   *   batches, retries?, checkpoint?, resumed_from?, dialect? }, error? }
    */
   async copyFrom(table, filename, options = {}) {
     const params = {
       table,
       filename,
       columns: options.columns,
+      mapping: options.mapping,
       options: {},
+      format: options.format,
+      validateOnly: options.validateOnly || undefined,
+      resume: options.resume || undefined,
+      checkpointFile: options.checkpointFile,
     };
     if (options.header !== undefined) params.options.HEADER = String(options.header);
     if (options.delimiter !== undefined) params.options.DELIMITER = options.delimiter;
+    if (options.quote !== undefined) params.options.QUOTE = options.quote;
+    if (options.encoding !== undefined) params.options.ENCODING = options.encoding;
+    if (options.detectDialect) {
+      for (const key of ['HEADER', 'DELIMITER', 'QUOTE', 'ENCODING']) {
+        if (params.options[key] === undefined) params.options[key] = 'auto';
+      }
+    }
     if (options.nullval !== undefined) params.options.NULLVAL = options.nullval;
     if (options.maxrows !== undefined) params.options.MAXROWS = String(options.maxrows);
     if (options.skiprows !== undefined) params.options.SKIPROWS = String(options.skiprows);
     if (options.chunksize !== undefined) params.options.CHUNKSIZE = String(options.chunksize);
     if (options.maxbatchsize !== undefined) params.options.MAXBATCHSIZE = String(options.maxbatchsize);
+    if (options.minbatchsize !== undefined) params.options.MINBATCHSIZE = String(options.minbatchsize);
     if (options.maxrequests !== undefined) params.options.MAXREQUESTS = String(options.maxrequests);
+    if (options.maxattempts !== undefined) params.options.MAXATTEMPTS = String(options.maxattempts);
+    if (options.unsetnulls !== undefined) params.options.UNSETNULLS = String(options.unsetnulls);
+    if (options.warnnulltombstones !== undefined) params.options.WARNNULLTOMBSTONES = String(options.warnnulltombstones);
 
     const paramsJSON = JSON.stringify(params);
     return await callNativeTrueAsync(native.CopyFrom, this._handle, paramsJSON);
   }
 
+  /**
+   * Match the header of a CSV file to a table's columns before a COPY FROM
+   * Header fields are matched exactly, case-insensitively, ignoring separators
+   * (customer_id / Customer ID) and then fuzzily. A sample of rows is checked
+   * against the matched column types. The returned mapping, edited as needed,
+   * can be passed to copyFrom() as options.mapping.
+   * @param {string} table - Table name (can be keyspace.table)
+   * @param {string} filename - CSV file path; its first line is the header
+   * @param {Object} [options] - Options
+   * @param {string} [options.delimiter=','] - Column delimiter
+   * @param {string} [options.nullval='null'] - String representing NULL values
+   * @param {number} [options.skiprows=0] - Rows to skip after the header
+   * @param {number} [options.sampleRows=100] - Rows checked against the column types (max 10000)
+   * @returns {Promise<Object>} { success, data?: { keyspace, table, header, columns, mapping, unmappedHeaders, missingColumns, missingKeyColumns, sampledRows, ready }, error? }
+   */
+  async planCsvMapping(table, filename, options = {}) {
+    const params = { table, filename, options: {}, sampleRows: options.sampleRows };
+    if (options.delimiter !== undefined) params.options.DELIMITER = options.delimiter;
+    if (options.nullval !== undefined) params.options.NULLVAL = options.nullval;
+    if (options.skiprows !== undefined) params.options.SKIPROWS = String(options.skiprows);
+
+    return await callNativeTrueAsync(native.PlanCsvMapping, this._handle, JSON.stringify(params));
+  }
+
+  /**
+   * Detect the encoding, quote character, delimiter and header of a CSV file from a sample
+   * of it, to confirm before copyFrom(). With a table, a first row naming its columns, or
+   * with values their types reject while the rows below fit, is taken for a header.
+   * @param {string|null} table - Table name (can be keyspace.table), or null to detect without the schema
+   * @param {string} filename - CSV file path
+   * @param {Object} [options] - Options given here are kept rather than detected
+   * @param {boolean} [options.header] - CSV file has a header row
+   * @param {string} [options.delimiter] - Column delimiter
+   * @param {string} [options.quote] - Quote character
+   * @param {string} [options.encoding] - File encoding
+   * @returns {Promise<Object>} { success, data?: { encoding, bom, delimiter, quote, header, fields, sampledRows,
+   *   consistency, headerColumns?, detected, options, warnings? }, error? }
+   */
+  async detectCsvDialect(table, filename, options = {}) {
+    const params = { table: table || undefined, filename, options: {} };
+    if (options.header !== undefined) params.options.HEADER = String(options.header);
+    if (options.delimiter !== undefined) params.options.DELIMITER = options.delimiter;
+    if (options.quote !== undefined) params.options.QUOTE = options.quote;
+    if (options.encoding !== undefined) params.options.ENCODING = options.encoding;
+
+    return await callNativeTrueAsync(native.DetectCsvDialect, this._handle, JSON.stringify(params));
+  }
+
+  /**
+   * Generate a DataStax Bulk Loader or Spark Cassandra Connector configuration
+   * for a table that connects like this session, for transfers too large for COPY
+   * Passwords are not written into the file; the loader reads CASSANDRA_PASSWORD.
+   * @param {string} table - Table name (can be keyspace.table)
+   * @param {string} [target='dsbulk'] - 'dsbulk' or 'spark'
+   * @returns {Promise<Object>} { success, data?: { target, keyspace, table, fileName, content, commands, notes? }, error? }
+   */
+  async generateLoaderConfig(table, target = 'dsbulk') {
+    if (!table) {
+      return { success: false, error: 'table is required' };
+    }
+
+    let keyspace = '';
+    const dot = table.indexOf('.');
+    if (dot > 0) {
+      keyspace = table.slice(0, dot);
+      table = table.slice(dot + 1);
+    }
+    return await callNativeTrueAsync(native.GenerateLoaderConfig, this._handle, keyspace, table, target);
+  }
+
   /**
    * Generate DDL (CREATE statements) for various scopes
    * @param {Object} options - DDL generation options
@@ -1071,7 +2693,11 @@ class CQLSession {
    * @param {string} [options.function] - Function name (optional, requires keyspace)
    * @param {string} [options.aggregate] - Aggregate name (optional, requires keyspace)
    * @param {string} [options.view] - Materialized view name (optional, requires keyspace)
-   * @returns {Promise<Object>} { success, data?: { ddl: string, scope: string }, error? }
+   * @param {string} [options.outputPath] - Write the DDL to this file instead of returning it
+   * @param {string} [options.outputDir] - Write one .cql file per object and a manifest.json to this directory (cluster or keyspace scope)
+   * @param {boolean} [options.chunked] - Keep the DDL for getDDLChunk() and return an operation ID
+   * @param {number} [options.chunkSize=1048576] - Maximum chunk size in bytes; a larger keyspace gets its own chunk
+   * @returns {Promise<Object>} { success, data?: { ddl: string, scope: string, virtualTablesSupported: boolean, outputPath?, bytes?, outputDir?, manifestPath?, files?, operationId?, chunks?, keyspaces? }, error? }
    *
    * @example
    * // Get DDL for entire cluster (includes system keyspaces by default)
@@ -1088,6 +2714,18 @@ class CQLSession {
    *
    * // Get DDL for specific index
    * await session.getDDL({ keyspace: 'mhmd', table: 'users', index: 'users_email_idx' });
+   *
+   * // Write cluster DDL to a file
+   * await session.getDDL({ cluster: true, outputPath: '/tmp/schema.cql' });
+   *
+   * // Export one file per object, e.g. into a schema repository
+   * await session.getDDL({ cluster: true, includeSystem: false, outputDir: './schema' });
+   *
+   * // Read cluster DDL in chunks
+   * const op = await session.getDDL({ cluster: true, chunked: true });
+   * for (let i = 0; i < op.data.chunks; i++) {
+   *   const chunk = await session.getDDLChunk(op.data.operationId, i);
+   * }
    */
   async getDDL(options = {}) {
     // Default includeSystem to true
@@ -1096,11 +2734,24 @@ class CQLSession {
     return await callNativeTrueAsync(native.GetDDL, this._handle, optionsJSON);
   }
 
+  /**
+   * Read a chunk of a chunked getDDL() operation
+   * Chunks contain whole keyspaces. The operation is released once every chunk has been read.
+   * @param {string} operationId - Operation ID returned by getDDL({ chunked: true })
+   * @param {number} index - Chunk index, from 0 to chunks - 1
+   * @returns {Promise<Object>} { success, data?: { operationId, index, total, keyspaces, ddl, done }, error? }
+   */
+  async getDDLChunk(operationId, index) {
+    return await callNativeTrueAsync(native.GetDDLChunk, this._handle, operationId, index);
+  }
+
   /**
    * Close the session
    * @returns {Promise<Object>} { success, error? }
    */
   async close() {
+    this._stopConfigPolling();
+    this._stopSchemaEventPolling();
     return await callNativeAsync(() =>
       native.CloseSession(this._handle)
     );
@@ -1109,8 +2760,12 @@ class CQLSession {
   /**
    * Execute multiple CQL files (SOURCE command equivalent)
    * @param {Object} options - Execution options
-   * @param {string[]} options.files - Array of file paths to execute
+   * @param {string[]} [options.files] - Array of file paths to execute
+   * @param {Object[]} [options.sources] - Scripts without a file, run after files:
+   *   { content, name? } for inline text or { url, sha256, name? } for an https:// URL
    * @param {boolean} [options.stopOnError=false] - Stop execution on first error
+   * @param {boolean} [options.savepoint=false] - Record a rollback plan for schema changes (see rollbackPlan())
+   * @param {string} [options.cancelToken] - Token for CQLSession.cancel(); stopSourceExecution() works too
    * @param {Function} [options.onProgress] - Callback for progress updates
    * @returns {Promise<Object>} { success, data?: { result, progress }, error? }
    *
@@ -1125,6 +2780,7 @@ class CQLSession {
    *   statementsFailed: number,
    *   currentStatement: string,
    *   errors: string[],
+   *   directives?: [{ directive, value, previous?, scope, statement }],
    *   isComplete: boolean,
    *   duration: number (ms)
    * }
@@ -1143,17 +2799,19 @@ class CQLSession {
    * }
    */
   async executeSourceFiles(options = {}) {
-    const { files, stopOnError = false, onProgress } = options;
+    const { files = [], sources = [], stopOnError = false, savepoint = false, cancelToken = '', onProgress } = options;
 
-    if (!files || !Array.isArray(files) || files.length === 0) {
-      return { success: false, error: 'Files array is required' };
+    if (!Array.isArray(files) || !Array.isArray(sources) || files.length + sources.length === 0) {
+      return { success: false, error: 'Files or sources array is required' };
     }
 
-    const optionsJSON = JSON.stringify({ files, stopOnError });
+    const optionsJSON = JSON.stringify({ files, sources, stopOnError, savepoint, cancelToken });
 
     // If no progress callback, just execute and return
     if (!onProgress) {
-      return await callNativeTrueAsync(native.ExecuteSourceFiles, this._handle, optionsJSON);
+      const result = await callNativeTrueAsync(native.ExecuteSourceFiles, this._handle, optionsJSON);
+      this._updateKeyspaceFromProgress(result);
+      return result;
     }
 
     // With progress callback, we need to poll for progress
@@ -1199,6 +2857,7 @@ class CQLSession {
       // Final poll to get any remaining progress
       await pollProgress();
 
+      this._updateKeyspaceFromProgress(result);
       return result;
     } finally {
       if (pollTimer) {
@@ -1207,6 +2866,21 @@ class CQLSession {
     }
   }
 
+  /**
+   * Update keyspace from the USE statements run by executeSourceFiles()
+   * @private
+   */
+  _updateKeyspaceFromProgress(result) {
+    const progress = (result.success && result.data && result.data.progress) || [];
+    for (const file of progress) {
+      for (const directive of file.directives || []) {
+        if (directive.directive === 'USE') {
+          this._keyspace = directive.value;
+        }
+      }
+    }
+  }
+
   /**
    * Stop the currently running source file execution for this session.
    * @returns {Promise<Object>} { success: boolean, error?: string }
@@ -1215,9 +2889,25 @@ class CQLSession {
     return await callNativeAsync(() => native.StopSourceExecution(this._handle));
   }
 
+  /**
+   * Get or execute the rollback plan recorded by the last executeSourceFiles()
+   * run with savepoint enabled. Steps revert schema changes, most recent first.
+   * @param {Object} [options] - Rollback options
+   * @param {string} [options.planId] - Expected plan ID (result.rollbackPlanId)
+   * @param {boolean} [options.execute=false] - Run the compensating statements
+   * @returns {Promise<Object>} { success, data?: { plan, executed, done, failed, skipped }, error? }
+   */
+  async rollbackPlan(options = {}) {
+    const { planId = '', execute = false } = options;
+    return await callNativeTrueAsync(native.RollbackPlan, this._handle, JSON.stringify({ planId, execute }));
+  }
+
   /**
    * Get query trace by session ID
    * @param {string} sessionId - The trace session UUID
+   * @param {Object} [options] - Trace options
+   * @param {boolean} [options.wait=false] - Poll until the coordinator and replicas have finished writing the trace
+   * @param {number} [options.timeoutMs=5000] - Longest wait (at most 60000); the trace read last is returned, with complete: false
    * @returns {Promise<Object>} { success, data?: QueryTraceResult, error? }
    *
    * QueryTraceResult contains:
@@ -1238,15 +2928,54 @@ class CQLSession {
    *     source: string,
    *     sourceElapsed: number (microseconds),
    *     thread: string
-   *   }]
+   *   }],
+   *   complete: boolean,
+   *   waitedMs?: number,
+   *   nodes: [{
+   *     source: string,
+   *     role: 'coordinator' | 'replica',
+   *     startOffset: number, elapsedMicros: number, eventCount: number,
+   *     phases: [{ thread, stage, startMicros, endMicros, durationMicros, events: [{ activity, timestamp, source_elapsed, deltaMicros }] }]
+   *   }],
+   *   summary: {
+   *     durationMicros, events, replicas, coordinatorMicros,
+   *     slowestReplica?, slowestReplicaMicros?,
+   *     stageMicros: { [stage]: number },
+   *     slowestSteps: [{ source, activity, deltaMicros }]
+   *   }
    * }
    */
-  async getQueryTrace(sessionId) {
+  async getQueryTrace(sessionId, options = {}) {
+    if (!sessionId) {
+      return { success: false, error: 'Session ID is required' };
+    }
+
+    if (!options.wait && options.timeoutMs === undefined) {
+      return await callNativeTrueAsync(native.GetQueryTrace, this._handle, sessionId);
+    }
+    const optionsJSON = JSON.stringify({
+      wait: options.wait,
+      timeoutMs: options.timeoutMs,
+    });
+    return await callNativeTrueAsync(native.GetQueryTraceWithOptions, this._handle, sessionId, optionsJSON);
+  }
+
+  /**
+   * Write a query trace to a file for offline analysis or sharing with support
+   * @param {string} sessionId - Trace session ID (UUID string)
+   * @param {string} [format='json'] - 'json' (session + events) or 'folded' (flamegraph folded stacks)
+   * @param {string} path - Output file path
+   * @returns {Promise<Object>} { success, data?: { path, format, bytes, events }, error? }
+   */
+  async exportTrace(sessionId, format = 'json', path) {
     if (!sessionId) {
       return { success: false, error: 'Session ID is required' };
     }
+    if (!path) {
+      return { success: false, error: 'Path is required' };
+    }
 
-    return await callNativeTrueAsync(native.GetQueryTrace, this._handle, sessionId);
+    return await callNativeTrueAsync(native.ExportTrace, this._handle, sessionId, format || 'json', path);
   }
 
   /**
@@ -1308,6 +3037,190 @@ class CQLSession {
     );
   }
 
+  /**
+   * Get the state of the process-wide bulk operation scheduler
+   * @returns {Promise<Object>} { success, data?: SchedulerStats, error? }
+   */
+  static async getSchedulerStats() {
+    return await callNativeAsync(() => native.GetSchedulerStats());
+  }
+
+  /**
+   * Change the process-wide bulk operation limits
+   * @param {Object} options - Scheduler options; omitted values are unchanged
+   * @param {number} [options.maxBulkOperations=4] - Bulk operations running at once across all sessions
+   * @param {number} [options.interactiveReserve=1] - Slots withheld from bulk work while interactive queries run
+   * @returns {Promise<Object>} { success, data?: { maxBulkOperations, interactiveReserve }, error? }
+   */
+  static async configureScheduler(options = {}) {
+    const optionsJSON = JSON.stringify(options);
+    return await callNativeAsync(() => native.ConfigureScheduler(optionsJSON));
+  }
+
+  /**
+   * Enable or disable the process-wide usage counters (disabled by default).
+   * Only counts are kept, in memory; disabling discards them.
+   * @param {Object} options - Telemetry options
+   * @param {boolean} options.enabled - Count feature usage
+   * @returns {Promise<Object>} { success, data?: TelemetrySnapshot, error? }
+   */
+  static async configureTelemetry(options = {}) {
+    const optionsJSON = JSON.stringify(options);
+    return await callNativeAsync(() => native.ConfigureTelemetry(optionsJSON));
+  }
+
+  /**
+   * Get the usage counters, to show them or upload them with the user's consent
+   * @param {Object} [options] - Snapshot options
+   * @param {boolean} [options.reset=false] - Start counting again from 0 after the snapshot
+   * @returns {Promise<Object>} { success, data?: { enabled, since?, takenAt, counters }, error? }
+   */
+  static async getTelemetrySnapshot(options = {}) {
+    const optionsJSON = JSON.stringify(options);
+    return await callNativeAsync(() => native.GetTelemetrySnapshot(optionsJSON));
+  }
+
+  /**
+   * Set how statements and bind values are written to logs for a workspace
+   * @param {string} workspaceID - Workspace ID ('' for the default policy)
+   * @param {Object|null} policy - Redaction policy, or null to restore the default
+   * @param {string} [policy.mode='hash'] - 'hash', 'mask', 'type' or 'none'
+   * @param {string} [policy.salt] - Key for hashed values
+   * @param {number} [policy.keepChars=2] - Mask mode: characters kept at each end
+   * @param {number} [policy.maxValueLength=64] - Longest value written
+   * @param {number} [policy.maxStatement=2000] - Longest statement shape written
+   * @returns {Promise<Object>} { success, data?: RedactionPolicy, error? }
+   */
+  static async setRedactionPolicy(workspaceID, policy) {
+    const optionsJSON = JSON.stringify({ workspaceID: workspaceID || '', policy: policy || null });
+    return await callNativeAsync(() => native.SetRedactionPolicy(optionsJSON));
+  }
+
+  /**
+   * Get the redaction policy of a workspace
+   * @param {string} [workspaceID=''] - Workspace ID
+   * @returns {Promise<Object>} { success, data?: RedactionPolicy, error? }
+   */
+  static async getRedactionPolicy(workspaceID = '') {
+    return await callNativeAsync(() => native.GetRedactionPolicy(workspaceID));
+  }
+
+  /**
+   * Redact a statement and its bind values for a history, audit or slow query log
+   * @param {string} workspaceID - Workspace whose policy applies ('' for the default)
+   * @param {string} query - CQL statement
+   * @param {Array|Object} [values] - Bind values in marker order, or by variable name
+   * @returns {Promise<Object>} { success, data?: { shape, values, text, mode }, error? }
+   */
+  static async redactStatement(workspaceID, query, values) {
+    const optionsJSON = JSON.stringify({ workspaceID: workspaceID || '', query, values });
+    return await callNativeAsync(() => native.RedactStatement(optionsJSON));
+  }
+
+  /**
+   * Set the files and rotation of the debug, trace, history, audit and slow query logs.
+   * Applies to the whole process; logs given the same file share it.
+   * @param {Object} [options] - { rotation, sinks }
+   * @param {Object} [options.rotation] - Shared settings: { maxSizeMB, rotateHours, maxBackups,
+   *   compress, sync }; 0 or unset takes the default, a negative number turns the limit off
+   * @param {Object} [options.sinks] - By log name (debug, trace, history, audit, slowQuery):
+   *   { path, ...overrides of rotation }
+   * @returns {Promise<Object>} { success, data?: LogFile[], error? }
+   */
+  static async configureLogFiles(options = {}) {
+    const optionsJSON = JSON.stringify(options || {});
+    return await callNativeAsync(() => native.ConfigureLogFiles(optionsJSON));
+  }
+
+  /**
+   * Get the file, size and rotated files of each log that has a file
+   * @returns {Promise<Object>} { success, data?: LogFile[], error? }
+   */
+  static async getLogFiles() {
+    return await callNativeAsync(() => native.GetLogFiles());
+  }
+
+  /**
+   * Append a record to a log file, rotating the file when it is due
+   * @param {string} name - debug, trace, history, audit or slowQuery
+   * @param {string} record - One record; a newline is added when it has none
+   * @returns {Promise<Object>} { success, error? }
+   */
+  static async writeLogRecord(name, record) {
+    return await callNativeAsync(() => native.WriteLogRecord(name, String(record)));
+  }
+
+  /**
+   * Start a new file for a log now, unless its file is empty
+   * @param {string} name - debug, trace, history, audit or slowQuery
+   * @returns {Promise<Object>} { success, data?: LogFile, error? }
+   */
+  static async rotateLogFile(name) {
+    return await callNativeAsync(() => native.RotateLogFile(name));
+  }
+
+  /**
+   * Get the checkpoint copyFrom() with resume keeps for a file: how far the import got,
+   * and whether the file changed since it started
+   * @param {string} filename - File being imported
+   * @param {Object} [options] - Options
+   * @param {string} [options.checkpointFile] - Checkpoint file, when copyFrom() was given one
+   * @returns {Promise<Object>} { success, data?: { filename, table, format, columns?, fileSize, offset, rowsRead,
+   *   rowsImported, errors, parseErrors, skippedRows, completed, startedAt, updatedAt, checkpointFile,
+   *   percentDone, fileChanged }, error? } - code CHECKPOINT_NOT_FOUND when there is none
+   */
+  static async getCopyCheckpoint(filename, options = {}) {
+    const optionsJSON = JSON.stringify({ filename, checkpointFile: options.checkpointFile });
+    return await callNativeAsync(() => native.GetCopyCheckpoint(optionsJSON));
+  }
+
+  /**
+   * Set the settings sessions of a workspace inherit when their connection options leave
+   * them unset. Sessions already open keep their settings.
+   * @param {string} workspaceID - Workspace ID ('' for sessions without one)
+   * @param {Object|null} defaults - Defaults, or null to clear them: { consistency, pageSize,
+   *   connectTimeout, requestTimeout, queryTimeout, socketKeepalive, schemaCache,
+   *   consistencyFallback, speculativeExecution, circuitBreaker, loadBalancing }, as for connect()
+   * @returns {Promise<Object>} { success, data?: SessionDefaults, error? }
+   */
+  static async setWorkspaceDefaults(workspaceID, defaults) {
+    const optionsJSON = JSON.stringify({ workspaceID: workspaceID || '', defaults: defaults || null });
+    return await callNativeAsync(() => native.SetWorkspaceDefaults(optionsJSON));
+  }
+
+  /**
+   * Get the session defaults of a workspace
+   * @param {string} [workspaceID=''] - Workspace ID
+   * @returns {Promise<Object>} { success, data?: SessionDefaults, error? }
+   */
+  static async getWorkspaceDefaults(workspaceID = '') {
+    return await callNativeAsync(() => native.GetWorkspaceDefaults(workspaceID));
+  }
+
+  /**
+   * Turn experimental subsystems (asyncQueries, parquetCopy, aiBridge) on or off for a
+   * workspace, or for the whole process. Workspace flags take precedence over process-wide
+   * flags, which take precedence over each flag's default. Open sessions are affected.
+   * @param {string} workspaceID - Workspace ID ('' for the process-wide flags)
+   * @param {Object|null} flags - Flags to set, e.g. { parquetCopy: true }, or null to clear them
+   * @returns {Promise<Object>} { success, data?: { workspaceID?, flags: [{ name, description,
+   *   compiled, default, enabled, source }] }, error? }
+   */
+  static async setFeatureFlags(workspaceID, flags) {
+    const optionsJSON = JSON.stringify({ workspaceID: workspaceID || '', flags: flags || null });
+    return await callNativeAsync(() => native.SetFeatureFlags(optionsJSON));
+  }
+
+  /**
+   * Get the feature flags the loaded library supports and whether each is on for a workspace
+   * @param {string} [workspaceID=''] - Workspace ID ('' for the process-wide flags)
+   * @returns {Promise<Object>} { success, data?: { workspaceID?, flags: [{ name, description,
+   *   compiled, default, enabled, source }] }, error? }
+   */
+  static async getFeatureFlags(workspaceID = '') {
+    return await callNativeAsync(() => native.GetFeatureFlags(workspaceID));
+  }
+
   /**
    * Parse a DataStax Astra secure connect bundle
    * @param {Object} options - Bundle options
@@ -1341,6 +3254,15 @@ class CQLSession {
    * @param {string} options.password - Astra client secret
    * @param {string} [options.keyspace] - Override keyspace from bundle
    * @param {string} [options.extractDir] - Directory to extract to
+   * @param {Object} [options.speculativeExecution] - { maxAttempts, delayMs } speculative execution for SELECT statements
+   * @param {string} [options.schemaCache='full'] - Schema cache scope: 'full', 'keyspace' or 'off'
+   * @param {boolean} [options.persistSchemaCache=false] - Save a full schema cache between connections, as for connect()
+   * @param {string} [options.schemaCacheDir] - Directory to save it in, as for connect()
+   * @param {string} [options.consistencyFallback] - Consistency level to retry a SELECT at when the requested one cannot be met
+   * @param {Object} [options.circuitBreaker] - { errorRate, minRequests, windowMs, openMs }, as for connect()
+   * @param {number} [options.metadataRefreshSeconds=300] - How often to fetch the contact points again; negative never does
+   * @param {Object} [options.metadataFetch] - Metadata service requests: { timeoutSeconds=10, attempts=3, backoffMs=500, maxBackoffMs=8000 }
+   * @param {string} [options.workspaceID] - Workspace whose redaction policy the session's logs follow
    * @returns {Promise<Object>} { success, data?: { session, bundleInfo }, error? }
    */
   static async connectWithAstraBundle(options) {
@@ -1378,17 +3300,19 @@ class CQLSession {
    * @param {string} options.bundlePath - Path to secure-connect-*.zip bundle
    * @param {string} options.username - Astra client ID
    * @param {string} options.password - Astra client secret
-   * @param {string} options.requestID - Unique request ID for cancellation (required)
+   * @param {string} options.cancelToken - Token for CQLSession.cancel() (this or requestID is required)
+   * @param {string} options.requestID - Older name for cancelToken
    * @param {string} [options.keyspace] - Override keyspace from bundle
    * @param {string} [options.extractDir] - Directory to extract to
-   * @returns {Promise<Object>} { success, data?, error?, code? }
+   * @param {Object} [options.metadataFetch] - Metadata service requests, as for connectWithAstraBundle()
+   * @returns {Promise<Object>} { success, data?, error?, code? } - data.phases times each phase
    *
-   * Returns same format as testConnection. If cancelled:
+   * Returns same format as testConnection. A failed phase's data is { failedAt, phases }. If cancelled:
    * { success: false, error: 'Connection cancelled', code: 'CANCELLED' }
    */
   static async testAstraConnectionWithID(options) {
-    if (!options.requestID) {
-      return { success: false, error: 'requestID is required for cancellable connection test' };
+    if (!options.requestID && !options.cancelToken) {
+      return { success: false, error: 'cancelToken or requestID is required for cancellable connection test' };
     }
     if (!options.bundlePath) {
       return { success: false, error: 'bundlePath is required' };
@@ -1402,6 +3326,20 @@ class CQLSession {
     return await callNativeTrueAsync(native.TestAstraConnectionWithID, optionsJSON);
   }
 
+  /**
+   * Check each hop of an Astra connection in turn: the bundle, DNS resolution of the
+   * metadata service, an HTTPS request to it and a TCP connection to the SNI proxy.
+   * Checks after the first failure are skipped; failedAt names the hop that failed.
+   * @param {Object} options - Diagnostic options
+   * @param {string} options.bundlePath - Path to secure-connect-*.zip bundle
+   * @param {string} [options.extractDir] - Directory to extract to
+   * @param {number} [options.timeoutSeconds=10] - Timeout of each check
+   * @returns {Promise<Object>} { success, data?: { ok, failedAt?, checks }, error? }
+   */
+  static async diagnoseAstraConnectivity(options) {
+    return await callNativeTrueAsync(native.DiagnoseAstraConnectivity, JSON.stringify(options));
+  }
+
   /**
    * Cleanup extracted Astra bundle files
    * @param {string} extractedDir - Directory containing extracted bundle
@@ -1412,6 +3350,32 @@ class CQLSession {
       native.CleanupAstraExtracted(extractedDir)
     );
   }
+
+  /**
+   * Parse a connection bundle for a self-managed cluster: a zip holding a
+   * cqlshrc and the credentials file and certificates it references. The
+   * bundle is extracted to a private per-user directory and every referenced
+   * file is checked; data.sessionOptions can be passed to connect() as is.
+   * @param {Object} options - Bundle options
+   * @param {string} options.bundlePath - Path to the bundle zip
+   * @param {string} [options.extractDir] - Directory to extract to (managed cache directory if not specified)
+   * @returns {Promise<Object>} { success, data?: ConnectionBundleInfo, error? }
+   */
+  static async parseConnectionBundle(options) {
+    const optionsJSON = JSON.stringify(options);
+    return await callNativeTrueAsync(native.ParseConnectionBundle, optionsJSON);
+  }
+
+  /**
+   * Remove the files extracted by parseConnectionBundle
+   * @param {string} extractedDir - data.extractedDir from parseConnectionBundle
+   * @returns {Promise<Object>} { success, error? }
+   */
+  static async cleanupConnectionBundle(extractedDir) {
+    return await callNativeAsync(() =>
+      native.CleanupConnectionBundle(extractedDir)
+    );
+  }
 }
 
 module.exports = { CQLSession };